@@ -44,6 +44,12 @@ type AddrManager struct {
 	quit           chan struct{}
 	nTried         int
 	nNew           int
+	nTriedNet      [numNetworks]int
+	nNewNet        [numNetworks]int
+	unreachable    [numNetworks]bool
+	preferNet      Network
+	hasPreferNet   bool
+	isBanned       func(net.IP) bool
 	lamtx          sync.Mutex
 	localAddresses map[string]*localAddress
 }
@@ -156,6 +162,16 @@ const (
 
 	// serialisationVersion is the current version of the on-disk format.
 	serialisationVersion = 1
+
+	// unpreferredChance is the factor the chance of choosing an address is
+	// scaled by when a preferred network is set and the address is on
+	// another network.
+	unpreferredChance = 0.1
+
+	// maxBannedPicks is the number of banned addresses GetAddress picks
+	// before giving up, which keeps it from picking forever when all of
+	// the known addresses are banned.
+	maxBannedPicks = 100
 )
 
 // updateAddress is a helper function to either update an address already known
@@ -209,7 +225,7 @@ func (a *AddrManager) updateAddress(netAddr, srcAddr *wire.NetAddress) {
 		netAddrCopy := *netAddr
 		ka = &KnownAddress{na: &netAddrCopy, srcAddr: srcAddr}
 		a.addrIndex[addr] = ka
-		a.nNew++
+		a.countNew(ka, 1)
 		// XXX time penalty?
 	}
 
@@ -249,7 +265,7 @@ func (a *AddrManager) expireNew(bucket int) {
 			delete(a.addrNew[bucket], k)
 			v.refs--
 			if v.refs == 0 {
-				a.nNew--
+				a.countNew(v, -1)
 				delete(a.addrIndex, k)
 			}
 			continue
@@ -268,7 +284,7 @@ func (a *AddrManager) expireNew(bucket int) {
 		delete(a.addrNew[bucket], key)
 		oldest.refs--
 		if oldest.refs == 0 {
-			a.nNew--
+			a.countNew(oldest, -1)
 			delete(a.addrIndex, key)
 		}
 	}
@@ -484,7 +500,7 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 			}
 
 			if ka.refs == 0 {
-				a.nNew++
+				a.countNew(ka, 1)
 			}
 			ka.refs++
 			a.addrNew[i][val] = ka
@@ -499,7 +515,7 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 			}
 
 			ka.tried = true
-			a.nTried++
+			a.countTried(ka, 1)
 			a.addrTried[i].PushBack(ka)
 		}
 	}
@@ -610,6 +626,20 @@ func (a *AddrManager) AddAddressByIP(addrIP string) error {
 	return nil
 }
 
+// countNew adjusts the number of addresses in the new buckets, both overall and
+// on the network of the passed address, by the passed delta.
+func (a *AddrManager) countNew(ka *KnownAddress, delta int) {
+	a.nNew += delta
+	a.nNewNet[AddrNetwork(ka.na)] += delta
+}
+
+// countTried adjusts the number of addresses in the tried buckets, both overall
+// and on the network of the passed address, by the passed delta.
+func (a *AddrManager) countTried(ka *KnownAddress, delta int) {
+	a.nTried += delta
+	a.nTriedNet[AddrNetwork(ka.na)] += delta
+}
+
 // NumAddresses returns the number of addresses known to the address manager.
 func (a *AddrManager) numAddresses() int {
 	return a.nTried + a.nNew
@@ -623,6 +653,16 @@ func (a *AddrManager) NumAddresses() int {
 	return a.numAddresses()
 }
 
+// NumNewAndTried returns the number of addresses in the new buckets, which
+// were learned from peers but never connected to successfully, and the number
+// of addresses in the tried buckets.
+func (a *AddrManager) NumNewAndTried() (int, int) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	return a.nNew, a.nTried
+}
+
 // NeedMoreAddresses returns whether or not the address manager needs more
 // addresses.
 func (a *AddrManager) NeedMoreAddresses() bool {
@@ -646,8 +686,12 @@ func (a *AddrManager) AddressCache() []*wire.NetAddress {
 	allAddr := make([]*wire.NetAddress, 0, addrIndexLen)
 	// Iteration order is undefined here, but we randomise it anyway.
 	for _, v := range a.addrIndex {
+		if a.banned(v.na) {
+			continue
+		}
 		allAddr = append(allAddr, v.na)
 	}
+	addrIndexLen = len(allAddr)
 
 	numAddresses := addrIndexLen * getAddrPercent / 100
 	if numAddresses > getAddrMax {
@@ -671,6 +715,9 @@ func (a *AddrManager) AddressCache() []*wire.NetAddress {
 func (a *AddrManager) reset() {
 
 	a.addrIndex = make(map[string]*KnownAddress)
+	a.nNew, a.nTried = 0, 0
+	a.nNewNet = [numNetworks]int{}
+	a.nTriedNet = [numNetworks]int{}
 
 	// fill key with bytes from a good random source.
 	io.ReadFull(crand.Reader, a.key[:])
@@ -737,18 +784,30 @@ func NetAddressKey(na *wire.NetAddress) string {
 // GetAddress returns a single address that should be routable.  It picks a
 // random one from the possible addresses with preference given to ones that
 // have not been used recently and should not pick 'close' addresses
-// consecutively.
+// consecutively.  Addresses on unreachable networks are never picked, and
+// addresses on the preferred network, if any, are picked more often than
+// others.
 func (a *AddrManager) GetAddress() *KnownAddress {
 	// Protect concurrent access.
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
-	if a.numAddresses() == 0 {
+	var nTried, nNew int
+	for n := Network(0); n < numNetworks; n++ {
+		if !a.unreachable[n] {
+			nTried += a.nTriedNet[n]
+			nNew += a.nNewNet[n]
+		}
+	}
+	if nTried+nNew == 0 {
 		return nil
 	}
 
 	// Use a 50% chance for choosing between tried and new table entries.
-	if a.nTried > 0 && (a.nNew == 0 || a.rand.Intn(2) == 0) {
+	// Banned addresses are skipped, and no address is returned when only
+	// banned ones keep being picked.
+	var bannedPicks int
+	if nTried > 0 && (nNew == 0 || a.rand.Intn(2) == 0) {
 		// Tried entry.
 		large := 1 << 30
 		factor := 1.0
@@ -766,8 +825,18 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 				e = e.Next()
 			}
 			ka := e.Value.(*KnownAddress)
+			if !a.isReachable(ka.na) {
+				continue
+			}
+			if a.banned(ka.na) {
+				bannedPicks++
+				if bannedPicks >= maxBannedPicks {
+					return nil
+				}
+				continue
+			}
 			randval := a.rand.Intn(large)
-			if float64(randval) < (factor * ka.chance() * float64(large)) {
+			if float64(randval) < (factor * a.chance(ka) * float64(large)) {
 				log.Tracef("Selected %v from tried bucket",
 					NetAddressKey(ka.na))
 				return ka
@@ -794,8 +863,18 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 				}
 				nth--
 			}
+			if !a.isReachable(ka.na) {
+				continue
+			}
+			if a.banned(ka.na) {
+				bannedPicks++
+				if bannedPicks >= maxBannedPicks {
+					return nil
+				}
+				continue
+			}
 			randval := a.rand.Intn(large)
-			if float64(randval) < (factor * ka.chance() * float64(large)) {
+			if float64(randval) < (factor * a.chance(ka) * float64(large)) {
 				log.Tracef("Selected %v from new bucket",
 					NetAddressKey(ka.na))
 				return ka
@@ -805,6 +884,73 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 	}
 }
 
+// isReachable returns whether the passed address is on a reachable network.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) isReachable(na *wire.NetAddress) bool {
+	return !a.unreachable[AddrNetwork(na)]
+}
+
+// banned returns whether the passed address is banned.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) banned(na *wire.NetAddress) bool {
+	return a.isBanned != nil && a.isBanned(na.IP)
+}
+
+// chance returns the chance of picking the passed address, which is reduced
+// when the address isn't on the preferred network.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) chance(ka *KnownAddress) float64 {
+	c := ka.chance()
+	if a.hasPreferNet && AddrNetwork(ka.na) != a.preferNet {
+		c *= unpreferredChance
+	}
+	return c
+}
+
+// SetReachable sets whether addresses on the passed network can be connected
+// to.  Addresses on unreachable networks are still kept and shared with peers,
+// but GetAddress never returns them.  All networks are reachable by default.
+func (a *AddrManager) SetReachable(n Network, reachable bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.unreachable[n] = !reachable
+}
+
+// IsReachable returns whether addresses on the passed network can be connected
+// to.
+func (a *AddrManager) IsReachable(n Network) bool {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	return !a.unreachable[n]
+}
+
+// SetPreferredNetwork makes GetAddress pick addresses on the passed network
+// more often than those on other networks, which are still picked when no
+// address on the preferred network is known or suitable.
+func (a *AddrManager) SetPreferredNetwork(n Network) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.preferNet = n
+	a.hasPreferNet = true
+}
+
+// SetBanFilter sets the function which reports whether an IP address is
+// banned.  Banned addresses are still kept, but neither GetAddress nor
+// AddressCache return them, so they are handed out again once the ban is
+// lifted.
+func (a *AddrManager) SetBanFilter(isBanned func(net.IP) bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.isBanned = isBanned
+}
+
 func (a *AddrManager) find(addr *wire.NetAddress) *KnownAddress {
 	return a.addrIndex[NetAddressKey(addr)]
 }
@@ -889,7 +1035,7 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 			}
 		}
 	}
-	a.nNew--
+	a.countNew(ka, -1)
 
 	if oldBucket == -1 {
 		// What? wasn't in a bucket after all.... Panic?
@@ -902,7 +1048,7 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 	if a.addrTried[bucket].Len() < triedBucketSize {
 		ka.tried = true
 		a.addrTried[bucket].PushBack(ka)
-		a.nTried++
+		a.countTried(ka, 1)
 		return
 	}
 
@@ -926,10 +1072,12 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 	rmka.tried = false
 	rmka.refs++
 
-	// We don't touch a.nTried here since the number of tried stays the same
-	// but we decemented new above, raise it again since we're putting
-	// something back.
-	a.nNew++
+	// The number of tried addresses stays the same, although the network
+	// of the replaced one may differ, but we decemented new above, raise
+	// it again since we're putting something back.
+	a.countTried(rmka, -1)
+	a.countTried(ka, 1)
+	a.countNew(rmka, 1)
 
 	rmkey := NetAddressKey(rmka.na)
 	log.Tracef("Replacing %s with %s in tried", rmkey, addrKey)
@@ -963,6 +1111,55 @@ func (a *AddrManager) AddLocalAddress(na *wire.NetAddress, priority AddressPrior
 	return nil
 }
 
+// AddInterfaceAddresses adds the routable addresses on the passed network among
+// the passed interface addresses, as returned by net.InterfaceAddrs, to the
+// known local addresses with the passed port and services.  It returns the
+// number of addresses added.
+func (a *AddrManager) AddInterfaceAddresses(ifaceAddrs []net.Addr, n Network,
+	port uint16, services wire.ServiceFlag) int {
+
+	var added int
+	for _, ifaceAddr := range ifaceAddrs {
+		ip := interfaceIP(ifaceAddr)
+		if ip == nil {
+			continue
+		}
+		na := wire.NewNetAddressIPPort(ip, port, services)
+		if AddrNetwork(na) != n {
+			continue
+		}
+		if err := a.AddLocalAddress(na, InterfacePrio); err != nil {
+			log.Debugf("Skipping interface address: %v", err)
+			continue
+		}
+		added++
+	}
+	return added
+}
+
+// LocalAddress is a known local address along with the score it is chosen by
+// when advertised.
+type LocalAddress struct {
+	NetAddress *wire.NetAddress
+	Score      AddressPriority
+}
+
+// LocalAddresses returns all of the known local addresses in no particular
+// order.
+func (a *AddrManager) LocalAddresses() []LocalAddress {
+	a.lamtx.Lock()
+	defer a.lamtx.Unlock()
+
+	addrs := make([]LocalAddress, 0, len(a.localAddresses))
+	for _, la := range a.localAddresses {
+		addrs = append(addrs, LocalAddress{
+			NetAddress: la.na,
+			Score:      la.score,
+		})
+	}
+	return addrs
+}
+
 // getReachabilityFrom returns the relative reachability of the provided local
 // address to the provided remote address.
 func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddress) int {
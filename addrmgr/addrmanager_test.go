@@ -207,6 +207,23 @@ func TestAddLocalAddress(t *testing.T) {
 			continue
 		}
 	}
+
+	// The address added twice is only known once with its score raised
+	// above the higher priority it was added with.
+	localAddrs := amgr.LocalAddresses()
+	if len(localAddrs) != 2 {
+		t.Fatalf("TestAddLocalAddress: got %d local addresses, want 2",
+			len(localAddrs))
+	}
+	for _, la := range localAddrs {
+		if la.NetAddress.IP.Equal(net.ParseIP("204.124.1.1")) &&
+			la.Score != addrmgr.BoundPrio+1 {
+
+			t.Errorf("TestAddLocalAddress: got score %d for %s, "+
+				"want %d", la.Score, la.NetAddress.IP,
+				addrmgr.BoundPrio+1)
+		}
+	}
 }
 
 func TestAttempt(t *testing.T) {
@@ -308,6 +325,11 @@ func TestGood(t *testing.T) {
 	if numAddrs >= addrsToAdd {
 		t.Errorf("Number of addresses is too many: %d vs %d", numAddrs, addrsToAdd)
 	}
+	numNew, numTried := n.NumNewAndTried()
+	if numNew != 0 || numTried != numAddrs {
+		t.Errorf("Got %d new and %d tried addresses, want 0 and %d",
+			numNew, numTried, numAddrs)
+	}
 
 	numCache := len(n.AddressCache())
 	if numCache >= numAddrs/4 {
@@ -458,6 +480,210 @@ func TestGetBestLocalAddress(t *testing.T) {
 	*/
 }
 
+// TestNetworkSelection ensures the networks reachable from the interfaces of
+// IPv6-only, IPv4-only, and dual-stack hosts limit the addresses picked to
+// connect to, and that the routable interface addresses are advertised to the
+// remote addresses which can reach them.
+func TestNetworkSelection(t *testing.T) {
+	ipNet := func(ip string, ones, bits int) net.Addr {
+		return &net.IPNet{IP: net.ParseIP(ip), Mask: net.CIDRMask(ones, bits)}
+	}
+	loopback := []net.Addr{ipNet("127.0.0.1", 8, 32), ipNet("::1", 128, 128)}
+	ipv4Addrs := []net.Addr{ipNet("10.0.0.5", 8, 32),
+		ipNet("204.124.8.100", 24, 32)}
+	ipv6Addrs := []net.Addr{ipNet("fe80::1", 64, 128),
+		&net.IPAddr{IP: net.ParseIP("2602:100:abcd::5")}}
+	join := func(lists ...[]net.Addr) []net.Addr {
+		var addrs []net.Addr
+		for _, list := range lists {
+			addrs = append(addrs, list...)
+		}
+		return addrs
+	}
+
+	remote4 := wire.NewNetAddressIPPort(net.ParseIP(someIP), 8333, 0)
+	remote6 := wire.NewNetAddressIPPort(net.ParseIP("2001:470::66"), 8333, 0)
+	tests := []struct {
+		name       string
+		ifaceAddrs []net.Addr
+		ipv4, ipv6 bool
+		best4      string // best local address for remote4
+		best6      string // best local address for remote6
+	}{
+		{
+			name:       "ipv6 only",
+			ifaceAddrs: join(loopback, ipv6Addrs),
+			ipv6:       true,
+			best4:      "0.0.0.0",
+			best6:      "2602:100:abcd::5",
+		},
+		{
+			name:       "ipv4 only",
+			ifaceAddrs: join(loopback, ipv4Addrs),
+			ipv4:       true,
+			best4:      "204.124.8.100",
+			best6:      "204.124.8.100",
+		},
+		{
+			name:       "dual stack",
+			ifaceAddrs: join(loopback, ipv4Addrs, ipv6Addrs),
+			ipv4:       true,
+			ipv6:       true,
+			best4:      "204.124.8.100",
+			best6:      "2602:100:abcd::5",
+		},
+	}
+
+	for _, test := range tests {
+		ipv4, ipv6 := addrmgr.InterfaceNetworks(test.ifaceAddrs)
+		if ipv4 != test.ipv4 || ipv6 != test.ipv6 {
+			t.Errorf("%s: InterfaceNetworks got ipv4 %v and ipv6 %v, "+
+				"want %v and %v", test.name, ipv4, ipv6, test.ipv4,
+				test.ipv6)
+			continue
+		}
+
+		n := addrmgr.New("testnetworkselection", lookupFunc)
+		n.SetReachable(addrmgr.NetIPv4, ipv4)
+		n.SetReachable(addrmgr.NetIPv6, ipv6)
+		var numLocal int
+		for _, network := range []addrmgr.Network{addrmgr.NetIPv4,
+			addrmgr.NetIPv6} {
+
+			numLocal += n.AddInterfaceAddresses(test.ifaceAddrs,
+				network, 8333, wire.SFNodeNetwork)
+		}
+		if len(n.LocalAddresses()) != numLocal {
+			t.Errorf("%s: got %d local addresses, want %d",
+				test.name, len(n.LocalAddresses()), numLocal)
+		}
+		best := n.GetBestLocalAddress(remote4)
+		if best.IP.String() != test.best4 {
+			t.Errorf("%s: got best local address %v for %v, want %v",
+				test.name, best.IP, remote4.IP, test.best4)
+		}
+		best = n.GetBestLocalAddress(remote6)
+		if best.IP.String() != test.best6 {
+			t.Errorf("%s: got best local address %v for %v, want %v",
+				test.name, best.IP, remote6.IP, test.best6)
+		}
+
+		// Only addresses on the reachable networks are picked, whether
+		// the address on the other network was tried or not.
+		n.AddAddress(remote4, remote4)
+		n.AddAddress(remote6, remote6)
+		n.Good(remote4)
+		seen := make(map[addrmgr.Network]bool)
+		for i := 0; i < 100; i++ {
+			ka := n.GetAddress()
+			if ka == nil {
+				t.Fatalf("%s: GetAddress returned no address",
+					test.name)
+			}
+			seen[addrmgr.AddrNetwork(ka.NetAddress())] = true
+		}
+		if seen[addrmgr.NetIPv4] != ipv4 || seen[addrmgr.NetIPv6] != ipv6 {
+			t.Errorf("%s: picked ipv4 %v and ipv6 %v addresses, want "+
+				"%v and %v", test.name, seen[addrmgr.NetIPv4],
+				seen[addrmgr.NetIPv6], ipv4, ipv6)
+		}
+
+		// No address is picked once no network is reachable.
+		n.SetReachable(addrmgr.NetIPv4, false)
+		n.SetReachable(addrmgr.NetIPv6, false)
+		if ka := n.GetAddress(); ka != nil {
+			t.Errorf("%s: GetAddress picked %v on an unreachable "+
+				"network", test.name, ka.NetAddress().IP)
+		}
+	}
+}
+
+// TestPreferredNetwork ensures addresses on the preferred network are picked
+// more often than those on other networks, which are still picked.
+func TestPreferredNetwork(t *testing.T) {
+	n := addrmgr.New("testpreferrednetwork", lookupFunc)
+	n.SetPreferredNetwork(addrmgr.NetIPv6)
+	if err := n.AddAddressByIP(someIP + ":8333"); err != nil {
+		t.Fatalf("Adding address failed: %v", err)
+	}
+	if err := n.AddAddressByIP("[2001:470::66]:8333"); err != nil {
+		t.Fatalf("Adding address failed: %v", err)
+	}
+
+	picked := make(map[addrmgr.Network]int)
+	for i := 0; i < 1000; i++ {
+		picked[addrmgr.AddrNetwork(n.GetAddress().NetAddress())]++
+	}
+	if picked[addrmgr.NetIPv6] < 2*picked[addrmgr.NetIPv4] ||
+		picked[addrmgr.NetIPv4] == 0 {
+
+		t.Errorf("picked %d ipv6 and %d ipv4 addresses, want mostly "+
+			"but not only ipv6", picked[addrmgr.NetIPv6],
+			picked[addrmgr.NetIPv4])
+	}
+
+	// An address on another network is still picked when there is none
+	// on the preferred network.
+	n.SetPreferredNetwork(addrmgr.NetOnion)
+	if ka := n.GetAddress(); ka == nil {
+		t.Errorf("GetAddress returned no address")
+	}
+}
+
+// TestBanFilter ensures banned addresses are neither picked nor shared, and
+// are handed out again once the ban is lifted.
+func TestBanFilter(t *testing.T) {
+	n := addrmgr.New("testbanfilter", lookupFunc)
+	if err := n.AddAddressByIP(someIP + ":8333"); err != nil {
+		t.Fatalf("Adding address failed: %v", err)
+	}
+	if err := n.AddAddressByIP("[2001:470::66]:8333"); err != nil {
+		t.Fatalf("Adding address failed: %v", err)
+	}
+
+	bannedIP := net.ParseIP("2001:470::66")
+	banned := true
+	n.SetBanFilter(func(ip net.IP) bool {
+		return banned && ip.Equal(bannedIP)
+	})
+	for i := 0; i < 100; i++ {
+		ka := n.GetAddress()
+		if ka == nil {
+			t.Fatalf("GetAddress returned no address")
+		}
+		if ka.NetAddress().IP.Equal(bannedIP) {
+			t.Fatalf("GetAddress picked banned address %v", bannedIP)
+		}
+	}
+	for _, na := range n.AddressCache() {
+		if na.IP.Equal(bannedIP) {
+			t.Fatalf("AddressCache returned banned address %v",
+				bannedIP)
+		}
+	}
+
+	// No address is picked when all of them are banned.
+	n.SetBanFilter(func(ip net.IP) bool { return true })
+	if ka := n.GetAddress(); ka != nil {
+		t.Errorf("GetAddress picked banned address %v",
+			ka.NetAddress().IP)
+	}
+
+	// The address is picked again once the ban is lifted.
+	n.SetBanFilter(func(ip net.IP) bool {
+		return banned && ip.Equal(bannedIP)
+	})
+	banned = false
+	var picked bool
+	for i := 0; i < 100 && !picked; i++ {
+		picked = n.GetAddress().NetAddress().IP.Equal(bannedIP)
+	}
+	if !picked {
+		t.Errorf("GetAddress never picked %v after its ban was lifted",
+			bannedIP)
+	}
+}
+
 func TestNetAddressKey(t *testing.T) {
 	addNaTests()
 
@@ -93,6 +93,64 @@ var (
 	heNet = ipNet("2001:470::", 32, 128)
 )
 
+// Network identifies the network an address is reached over.
+type Network int
+
+const (
+	// NetIPv4 is the IPv4 network.
+	NetIPv4 Network = iota
+
+	// NetIPv6 is the IPv6 network, which includes the IPv6 ranges that
+	// embed IPv4 addresses since they are still dialed over IPv6.
+	NetIPv6
+
+	// NetOnion is the Tor network, whose addresses are encoded in the
+	// OnionCat range.
+	NetOnion
+
+	// numNetworks is the number of networks.  It must be the last item.
+	numNetworks
+)
+
+// networkNames maps each network to the name it is configured and reported
+// by.
+var networkNames = [numNetworks]string{
+	NetIPv4:  "ipv4",
+	NetIPv6:  "ipv6",
+	NetOnion: "onion",
+}
+
+// String returns the name of the network.
+func (n Network) String() string {
+	if n < 0 || n >= numNetworks {
+		return fmt.Sprintf("Unknown Network (%d)", int(n))
+	}
+	return networkNames[n]
+}
+
+// ParseNetwork returns the network with the passed name, which is one of ipv4,
+// ipv6, or onion.
+func ParseNetwork(name string) (Network, error) {
+	for n, networkName := range networkNames {
+		if name == networkName {
+			return Network(n), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown network %q", name)
+}
+
+// AddrNetwork returns the network the passed address is reached over.
+func AddrNetwork(na *wire.NetAddress) Network {
+	switch {
+	case IsIPv4(na):
+		return NetIPv4
+	case IsOnionCatTor(na):
+		return NetOnion
+	default:
+		return NetIPv6
+	}
+}
+
 // ipNet returns a net.IPNet struct given the passed IP address string, number
 // of one bits to include at the start of the mask, and the total number of bits
 // for the mask.
@@ -230,6 +288,39 @@ func IsRoutable(na *wire.NetAddress) bool {
 		IsLocal(na) || (IsRFC4193(na) && !IsOnionCatTor(na)))
 }
 
+// interfaceIP returns the IP of the passed interface address, which is either a
+// *net.IPNet or a *net.IPAddr depending on the platform, or nil for any other
+// address.
+func interfaceIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.IPNet:
+		return addr.IP
+	case *net.IPAddr:
+		return addr.IP
+	}
+	return nil
+}
+
+// InterfaceNetworks returns whether the IPv4 and IPv6 networks can be reached
+// directly from a host with the passed interface addresses, as returned by
+// net.InterfaceAddrs.  A network is considered reachable when an interface has
+// a global unicast address on it, which includes the private IPv4 ranges since
+// they usually reach the internet through NAT.
+func InterfaceNetworks(ifaceAddrs []net.Addr) (ipv4, ipv6 bool) {
+	for _, ifaceAddr := range ifaceAddrs {
+		ip := interfaceIP(ifaceAddr)
+		if ip == nil || !ip.IsGlobalUnicast() {
+			continue
+		}
+		if ip.To4() != nil {
+			ipv4 = true
+		} else {
+			ipv6 = true
+		}
+	}
+	return ipv4, ipv6
+}
+
 // GroupKey returns a string representing the network group an address is part
 // of.  This is the /16 for IPv4, the /32 (/36 for he.net) for IPv6, the string
 // "local" for a local address, the string "tor:key" where key is the /4 of the
@@ -201,3 +201,42 @@ func TestGroupKey(t *testing.T) {
 		}
 	}
 }
+
+// TestAddrNetwork tests the AddrNetwork function to ensure it properly assigns
+// various IP addresses to their networks, and that the network names parse
+// back to the networks.
+func TestAddrNetwork(t *testing.T) {
+	tests := []struct {
+		name     string
+		ip       string
+		expected addrmgr.Network
+	}{
+		{name: "ipv4", ip: "12.1.2.3", expected: addrmgr.NetIPv4},
+		{name: "ipv4 mapped", ip: "::ffff:12.1.2.3", expected: addrmgr.NetIPv4},
+		{name: "ipv6", ip: "2602:100::1", expected: addrmgr.NetIPv6},
+		{name: "ipv6 rfc3964", ip: "2002:0c01:0203::", expected: addrmgr.NetIPv6},
+		{name: "ipv6 rfc6052", ip: "64:ff9b::0c01:0203", expected: addrmgr.NetIPv6},
+		{name: "tor onioncat", ip: "fd87:d87e:eb43:1234::5678", expected: addrmgr.NetOnion},
+	}
+
+	for i, test := range tests {
+		nip := net.ParseIP(test.ip)
+		na := wire.NewNetAddressIPPort(nip, 8333, wire.SFNodeNetwork)
+		n := addrmgr.AddrNetwork(na)
+		if n != test.expected {
+			t.Errorf("TestAddrNetwork #%d (%s): unexpected network "+
+				"- got %v, want %v", i, test.name, n, test.expected)
+			continue
+		}
+		parsed, err := addrmgr.ParseNetwork(n.String())
+		if err != nil || parsed != n {
+			t.Errorf("TestAddrNetwork #%d (%s): ParseNetwork(%q) "+
+				"- got %v (err %v), want %v", i, test.name,
+				n.String(), parsed, err, n)
+		}
+	}
+
+	if _, err := addrmgr.ParseNetwork("ipx"); err == nil {
+		t.Errorf("ParseNetwork: accepted unknown network ipx")
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitgo/prova/addrmgr"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// maxAddrRelay is the maximum number of addresses sent to a peer at
+	// once.  Each peer is sent a different random subset of the addresses
+	// when there are more, so no peer learns all of them at once.
+	maxAddrRelay = wire.MaxAddrPerMsg / 2
+
+	// defaultAddrRelayMaxDelay is the default upper bound of the random
+	// delay before addresses are sent to a peer, which keeps peers from
+	// correlating the timing of the announcements with connections.
+	defaultAddrRelayMaxDelay = time.Second * 5
+)
+
+// addrRelayStats houses the number of addresses which were not sent to peers
+// to keep them private.  It is safe for concurrent access.
+type addrRelayStats struct {
+	// The following variables must only be used atomically.
+	unroutable uint64
+	private    uint64
+	self       uint64
+}
+
+// addrRelay filters, randomizes, and delays the addresses sent to peers so the
+// addresses of private networks are never gossiped to the public network.  It
+// is safe for concurrent access.
+type addrRelay struct {
+	stats       addrRelayStats
+	privateNets []*net.IPNet
+	maxDelay    time.Duration
+}
+
+// newAddrRelay returns a new address relay which never relays the addresses of
+// the passed networks and delays each relay by a random duration below the
+// passed one.
+func newAddrRelay(privateNets []*net.IPNet, maxDelay time.Duration) *addrRelay {
+	return &addrRelay{
+		privateNets: privateNets,
+		maxDelay:    maxDelay,
+	}
+}
+
+// isPrivate returns whether the passed address is in one of the networks
+// configured to be private.
+func (r *addrRelay) isPrivate(na *wire.NetAddress) bool {
+	for _, ipNet := range r.privateNets {
+		if ipNet.Contains(na.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the passed addresses which may be relayed to peers as a new
+// slice.  Unroutable addresses, which include the RFC1918 private networks,
+// and the addresses of the networks configured to be private are left out and
+// counted.
+func (r *addrRelay) Filter(addrs []*wire.NetAddress) []*wire.NetAddress {
+	relayable := make([]*wire.NetAddress, 0, len(addrs))
+	for _, na := range addrs {
+		switch {
+		case !addrmgr.IsRoutable(na):
+			atomic.AddUint64(&r.stats.unroutable, 1)
+		case r.isPrivate(na):
+			atomic.AddUint64(&r.stats.private, 1)
+		default:
+			relayable = append(relayable, na)
+		}
+	}
+	return relayable
+}
+
+// Subset returns a random subset of at most maxAddrRelay of the passed
+// addresses in random order.  The passed slice is shuffled in place.
+func (r *addrRelay) Subset(addrs []*wire.NetAddress) []*wire.NetAddress {
+	for i := range addrs {
+		j := rand.Intn(i + 1)
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	}
+	if len(addrs) > maxAddrRelay {
+		addrs = addrs[:maxAddrRelay]
+	}
+	return addrs
+}
+
+// Delay returns a random delay below the maximum delay of the relay.
+func (r *addrRelay) Delay() time.Duration {
+	if r.maxDelay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(r.maxDelay)))
+}
+
+// SuppressSelf counts an announcement of a local address which was suppressed.
+func (r *addrRelay) SuppressSelf() {
+	atomic.AddUint64(&r.stats.self, 1)
+}
+
+// Stats returns the number of unroutable and private addresses which were not
+// relayed, and the number of announcements of local addresses which were
+// suppressed.
+func (r *addrRelay) Stats() (uint64, uint64, uint64) {
+	return atomic.LoadUint64(&r.stats.unroutable),
+		atomic.LoadUint64(&r.stats.private),
+		atomic.LoadUint64(&r.stats.self)
+}
+
+// relayAddrs sends a random subset of the passed addresses which may be
+// relayed to the peer after a random delay.  Addresses which must stay private
+// are never sent.
+func (sp *serverPeer) relayAddrs(addrs []*wire.NetAddress) {
+	relay := sp.server.addrRelay
+	addrs = relay.Subset(relay.Filter(addrs))
+	if len(addrs) == 0 {
+		return
+	}
+	delay := relay.Delay()
+	if delay == 0 {
+		sp.pushAddrMsg(addrs)
+		return
+	}
+	time.AfterFunc(delay, func() {
+		if sp.Connected() {
+			sp.pushAddrMsg(addrs)
+		}
+	})
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/addrmgr"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/peer"
+	"github.com/bitgo/prova/wire"
+)
+
+// testPrivateNet is the network configured to be private by the tests.  Its
+// addresses are routable, so only the configuration keeps them private.
+var testPrivateNet = func() *net.IPNet {
+	_, ipNet, err := net.ParseCIDR("44.0.0.0/8")
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}()
+
+// testRelayAddrs returns the passed number of public addresses, of RFC1918
+// private addresses, and of addresses in testPrivateNet.
+func testRelayAddrs(n int) ([]*wire.NetAddress, []*wire.NetAddress, []*wire.NetAddress) {
+	var public, rfc1918, private []*wire.NetAddress
+	for i := 0; i < n; i++ {
+		ip := func(format string) net.IP {
+			return net.ParseIP(fmt.Sprintf(format, i/256, i%256))
+		}
+		public = append(public, wire.NewNetAddressIPPort(
+			ip("173.194.%d.%d"), 18333, wire.SFNodeNetwork))
+		rfc1918 = append(rfc1918, wire.NewNetAddressIPPort(
+			ip("10.1.%d.%d"), 18333, wire.SFNodeNetwork))
+		private = append(private, wire.NewNetAddressIPPort(
+			ip("44.1.%d.%d"), 18333, wire.SFNodeNetwork))
+	}
+	return public, rfc1918, private
+}
+
+// TestAddrRelayFilter ensures the addresses which are relayed out of those
+// known to the address manager never include unroutable addresses or those of
+// the networks configured to be private, that the left out addresses are
+// counted, and that the relayed subsets and delays are bounded.
+func TestAddrRelayFilter(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "addrrelayfilter")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The address manager itself only drops the unroutable addresses, so
+	// the addresses of the private network are among the cached ones.
+	public, rfc1918, private := testRelayAddrs(2000)
+	src := wire.NewNetAddressIPPort(net.ParseIP("173.194.115.66"), 18333, 0)
+	amgr := addrmgr.New(tmpDir, nil)
+	amgr.AddAddresses(public, src)
+	amgr.AddAddresses(rfc1918, src)
+	amgr.AddAddresses(private, src)
+
+	maxDelay := time.Millisecond * 100
+	relay := newAddrRelay([]*net.IPNet{testPrivateNet}, maxDelay)
+	var numCachedPrivate uint64
+	for i := 0; i < 10; i++ {
+		cache := amgr.AddressCache()
+		for _, na := range cache {
+			if testPrivateNet.Contains(na.IP) {
+				numCachedPrivate++
+			}
+		}
+		addrs := relay.Subset(relay.Filter(cache))
+		if len(addrs) == 0 || len(addrs) > maxAddrRelay {
+			t.Fatalf("relayed %d addresses, want between 1 and %d",
+				len(addrs), maxAddrRelay)
+		}
+		for _, na := range addrs {
+			if !addrmgr.IsRoutable(na) || testPrivateNet.Contains(na.IP) {
+				t.Fatalf("address %v was relayed", na.IP)
+			}
+		}
+		if delay := relay.Delay(); delay < 0 || delay >= maxDelay {
+			t.Fatalf("delay %v is not below %v", delay, maxDelay)
+		}
+	}
+	if numCachedPrivate == 0 {
+		t.Fatalf("no private addresses were cached")
+	}
+
+	// Unroutable addresses, which the address manager never returns, are
+	// left out as well.
+	relay.Filter(rfc1918)
+	relay.SuppressSelf()
+	unroutable, suppressed, self := relay.Stats()
+	if unroutable != uint64(len(rfc1918)) || suppressed != numCachedPrivate ||
+		self != 1 {
+
+		t.Fatalf("got %d unroutable, %d private, and %d self "+
+			"suppressed, want %d, %d, and 1", unroutable, suppressed,
+			self, len(rfc1918), numCachedPrivate)
+	}
+
+	// A relay without a maximum delay relays immediately.
+	if delay := newAddrRelay(nil, 0).Delay(); delay != 0 {
+		t.Fatalf("got delay %v, want 0", delay)
+	}
+}
+
+// TestAddrRelayGetAddr ensures a server answers a getaddr request with a
+// bounded number of the addresses it knows without any of those of the
+// networks configured to be private, and reports them as suppressed.
+func TestAddrRelayGetAddr(t *testing.T) {
+	defer func(c *config, p *params) {
+		cfg = c
+		activeNetParams = p
+	}(cfg, activeNetParams)
+	activeNetParams = &regressionNetParams
+	chainParams := activeNetParams.Params
+
+	// Pass the address of a closed listener as the listen address of the
+	// server so the test can connect to it.
+	unused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	listenAddr := unused.Addr().String()
+	unused.Close()
+
+	tmpDir, err := ioutil.TempDir("", "addrrelaygetaddr")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cfg = newTestConfig(tmpDir)
+	cfg.DisableListen = false
+	cfg.Listeners = []string{listenAddr}
+	cfg.privateNets = []*net.IPNet{testPrivateNet}
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		chainParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+	s, err := newServer(cfg.Listeners, db, chainParams)
+	if err != nil {
+		t.Fatalf("newServer: unexpected error: %v", err)
+	}
+	s.addrRelay.maxDelay = 0
+	public, _, private := testRelayAddrs(1000)
+	src := wire.NewNetAddressIPPort(net.ParseIP("173.194.115.66"), 18333, 0)
+	s.addrManager.AddAddresses(public, src)
+	s.addrManager.AddAddresses(private, src)
+	s.Start()
+	defer func() {
+		s.Stop()
+		s.WaitForShutdown()
+	}()
+
+	// Negotiate the protocol with the server and request its addresses.
+	conn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("unable to connect to the server: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second * 10))
+	pver := peer.MaxProtocolVersion
+	btcnet := chainParams.Net
+	addr := wire.NewNetAddressIPPort(net.ParseIP("127.0.0.1"), 0, 0)
+	version := wire.NewMsgVersion(addr, addr, 1, 0)
+	for _, msg := range []wire.Message{version, wire.NewMsgVerAck(),
+		wire.NewMsgGetAddr()} {
+
+		if err := wire.WriteMessage(conn, msg, pver, btcnet); err != nil {
+			t.Fatalf("unable to send %s: %v", msg.Command(), err)
+		}
+	}
+	var addrMsg *wire.MsgAddr
+	for addrMsg == nil {
+		msg, _, err := wire.ReadMessage(conn, pver, btcnet)
+		if err != nil {
+			t.Fatalf("unable to read addresses: %v", err)
+		}
+		addrMsg, _ = msg.(*wire.MsgAddr)
+	}
+	if len(addrMsg.AddrList) == 0 || len(addrMsg.AddrList) > maxAddrRelay {
+		t.Fatalf("got %d addresses, want between 1 and %d",
+			len(addrMsg.AddrList), maxAddrRelay)
+	}
+	for _, na := range addrMsg.AddrList {
+		if testPrivateNet.Contains(na.IP) {
+			t.Fatalf("private address %v was relayed", na.IP)
+		}
+	}
+
+	result, err := handleGetAddrManInfo(&rpcServer{server: s},
+		btcjson.NewGetAddrManInfoCmd(), nil)
+	if err != nil {
+		t.Fatalf("handleGetAddrManInfo: unexpected error: %v", err)
+	}
+	info := result.(*btcjson.GetAddrManInfoResult)
+	if info.Addresses == 0 || info.Addresses != info.New+info.Tried {
+		t.Errorf("got %d addresses, %d new, and %d tried",
+			info.Addresses, info.New, info.Tried)
+	}
+	if info.SuppressedPrivate == 0 || info.SuppressedSelf != 0 {
+		t.Errorf("got %d private and %d self suppressed, want some "+
+			"and 0", info.SuppressedPrivate, info.SuppressedSelf)
+	}
+}
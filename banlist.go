@@ -0,0 +1,452 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/database"
+)
+
+var (
+	// banListBucketName is the name of the database bucket used to house
+	// the banned subnets.  The entries are keyed by the subnet in CIDR
+	// notation.
+	banListBucketName = []byte("banlist")
+)
+
+// errBanSubnet describes an error due to a subnet passed to the ban list which
+// is not a valid IP address or subnet in CIDR notation.
+type errBanSubnet string
+
+// Error implements the error interface.
+func (e errBanSubnet) Error() string {
+	return string(e)
+}
+
+// parseBanSubnet returns the subnet described by the passed string, which is
+// either an IP address, which is banned on its own, or a subnet in CIDR
+// notation.  IPv4 addresses and subnets written as IPv4-mapped IPv6 ones are
+// returned as IPv4 ones so they match the same connections.
+func parseBanSubnet(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			str := fmt.Sprintf("invalid IP address %q", s)
+			return nil, errBanSubnet(str)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+
+	_, subnet, err := net.ParseCIDR(s)
+	if err != nil {
+		str := fmt.Sprintf("invalid subnet %q", s)
+		return nil, errBanSubnet(str)
+	}
+	ones, bits := subnet.Mask.Size()
+	if ip4 := subnet.IP.To4(); ip4 != nil && bits == 128 && ones >= 96 {
+		subnet = &net.IPNet{IP: ip4, Mask: net.CIDRMask(ones-96, 32)}
+	}
+	return subnet, nil
+}
+
+// banRecord is the database representation of a ban.  The times are Unix
+// timestamps.
+type banRecord struct {
+	Subnet  string `json:"subnet"`
+	Reason  string `json:"reason,omitempty"`
+	Created int64  `json:"created"`
+	Expires int64  `json:"expires"`
+}
+
+// ban describes a banned subnet.
+type ban struct {
+	subnet  *net.IPNet
+	reason  string
+	created time.Time
+	expires time.Time
+}
+
+// newBan returns the ban described by the passed record.
+func newBan(record *banRecord) (*ban, error) {
+	subnet, err := parseBanSubnet(record.Subnet)
+	if err != nil {
+		return nil, err
+	}
+	return &ban{
+		subnet:  subnet,
+		reason:  record.Reason,
+		created: time.Unix(record.Created, 0),
+		expires: time.Unix(record.Expires, 0),
+	}, nil
+}
+
+// record returns the database representation of the ban.
+func (b *ban) record() *banRecord {
+	return &banRecord{
+		Subnet:  b.subnet.String(),
+		Reason:  b.reason,
+		Created: b.created.Unix(),
+		Expires: b.expires.Unix(),
+	}
+}
+
+// result returns the JSON-RPC representation of the ban.
+func (b *ban) result() *btcjson.BanListEntry {
+	record := b.record()
+	return &btcjson.BanListEntry{
+		Subnet:  record.Subnet,
+		Reason:  record.Reason,
+		Created: record.Created,
+		Expires: record.Expires,
+	}
+}
+
+// Expired returns whether the ban is expired at the passed time.
+func (b *ban) Expired(now time.Time) bool {
+	return !now.Before(b.expires)
+}
+
+// banSorter implements sort.Interface to allow a slice of bans to be sorted in
+// the order they were created.
+type banSorter []*ban
+
+// Len returns the number of bans in the slice.  It is part of the
+// sort.Interface implementation.
+func (s banSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the bans at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s banSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the ban with index i should sort before the ban with
+// index j.  It is part of the sort.Interface implementation.
+func (s banSorter) Less(i, j int) bool {
+	if !s[i].created.Equal(s[j].created) {
+		return s[i].created.Before(s[j].created)
+	}
+	return s[i].subnet.String() < s[j].subnet.String()
+}
+
+// banTrieNode is a node of a binary trie of banned subnets.  The children of a
+// node extend its prefix by a zero and a one bit respectively, and the ban of
+// a node, if any, covers all addresses which start with its prefix.
+type banTrieNode struct {
+	children [2]*banTrieNode
+	ban      *ban
+}
+
+// ipBit returns the bit of the passed IP address at the passed index, counting
+// from the most significant bit.
+func ipBit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+// insert adds the passed ban to the trie, replacing the ban of the same subnet.
+func (n *banTrieNode) insert(b *ban) {
+	ones, _ := b.subnet.Mask.Size()
+	for i := 0; i < ones; i++ {
+		bit := ipBit(b.subnet.IP, i)
+		if n.children[bit] == nil {
+			n.children[bit] = &banTrieNode{}
+		}
+		n = n.children[bit]
+	}
+	n.ban = b
+}
+
+// remove removes the ban of the passed subnet from the trie along with the
+// nodes which no longer lead to a ban.  It returns whether the node itself no
+// longer leads to a ban.
+func (n *banTrieNode) remove(subnet *net.IPNet, depth int) bool {
+	ones, _ := subnet.Mask.Size()
+	if depth == ones {
+		n.ban = nil
+	} else {
+		bit := ipBit(subnet.IP, depth)
+		child := n.children[bit]
+		if child != nil && child.remove(subnet, depth+1) {
+			n.children[bit] = nil
+		}
+	}
+	return n.ban == nil && n.children[0] == nil && n.children[1] == nil
+}
+
+// match returns the ban covering the passed IP address which is not expired at
+// the passed time, or nil when there is none.  The trie is walked along the
+// bits of the address, so the cost only depends on the length of the address
+// rather than on the number of bans.
+func (n *banTrieNode) match(ip net.IP, now time.Time) *ban {
+	for i := 0; n != nil; i++ {
+		if n.ban != nil && !n.ban.Expired(now) {
+			return n.ban
+		}
+		if i == len(ip)*8 {
+			break
+		}
+		n = n.children[ipBit(ip, i)]
+	}
+	return nil
+}
+
+// banList houses the banned subnets, which are refused both when they connect
+// and when connecting to them.  The bans are kept in a binary trie for each
+// address family so checking an address doesn't depend on the number of bans,
+// and are persisted in the database so they survive restarts.  Expired bans
+// are ignored and removed the next time the ban list is modified.
+type banList struct {
+	sync.RWMutex
+	db   database.DB
+	bans map[string]*ban
+	ipv4 banTrieNode
+	ipv6 banTrieNode
+}
+
+// newBanList returns a ban list backed by the passed database.  The existing
+// bans are loaded from the database.
+func newBanList(db database.DB, readOnly bool) (*banList, error) {
+	bl := &banList{
+		db:   db,
+		bans: make(map[string]*ban),
+	}
+	load := func(bucket database.Bucket) error {
+		return bucket.ForEach(func(k, v []byte) error {
+			var record banRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("malformed ban of %s: %v", k,
+					err)
+			}
+			b, err := newBan(&record)
+			if err != nil {
+				return fmt.Errorf("malformed ban of %s: %v", k,
+					err)
+			}
+			bl.add(b)
+			return nil
+		})
+	}
+
+	var err error
+	if readOnly {
+		err = db.View(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(banListBucketName)
+			if bucket == nil {
+				return nil
+			}
+			return load(bucket)
+		})
+	} else {
+		err = db.Update(func(dbTx database.Tx) error {
+			bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+				banListBucketName)
+			if err != nil {
+				return err
+			}
+			return load(bucket)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return bl, nil
+}
+
+// trie returns the trie which houses the bans of the passed subnet.
+//
+// This function MUST be called with the ban list lock held.
+func (bl *banList) trie(subnet *net.IPNet) *banTrieNode {
+	if len(subnet.IP) == net.IPv4len {
+		return &bl.ipv4
+	}
+	return &bl.ipv6
+}
+
+// add adds the passed ban to the memory state of the ban list, replacing the
+// ban of the same subnet.
+//
+// This function MUST be called with the ban list lock held (for writes).
+func (bl *banList) add(b *ban) {
+	bl.bans[b.subnet.String()] = b
+	bl.trie(b.subnet).insert(b)
+}
+
+// remove removes the ban of the passed subnet from the memory state of the ban
+// list.
+//
+// This function MUST be called with the ban list lock held (for writes).
+func (bl *banList) remove(subnet *net.IPNet) {
+	delete(bl.bans, subnet.String())
+	bl.trie(subnet).remove(subnet, 0)
+}
+
+// update persists the passed bans and removes the bans of the passed subnets
+// along with the expired ones from the database, and then applies the same
+// changes to the memory state of the ban list.
+//
+// This function MUST be called with the ban list lock held (for writes).
+func (bl *banList) update(add []*ban, remove []*net.IPNet, now time.Time) error {
+	for _, b := range bl.bans {
+		if b.Expired(now) {
+			remove = append(remove, b.subnet)
+		}
+	}
+	serialized := make([][]byte, 0, len(add))
+	for _, b := range add {
+		s, err := json.Marshal(b.record())
+		if err != nil {
+			return err
+		}
+		serialized = append(serialized, s)
+	}
+	err := bl.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(banListBucketName)
+		for _, subnet := range remove {
+			if err := bucket.Delete([]byte(subnet.String())); err != nil {
+				return err
+			}
+		}
+		for i, b := range add {
+			err := bucket.Put([]byte(b.subnet.String()), serialized[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, subnet := range remove {
+		bl.remove(subnet)
+	}
+	for _, b := range add {
+		bl.add(b)
+	}
+	return nil
+}
+
+// Ban bans the passed subnet for the passed reason until the passed expiry,
+// which is truncated to the second, and persists the ban.  An existing ban of
+// the same subnet is replaced.
+//
+// This function is safe for concurrent access.
+func (bl *banList) Ban(subnet *net.IPNet, reason string, expires time.Time) error {
+	now := time.Now()
+	b := &ban{
+		subnet:  subnet,
+		reason:  reason,
+		created: time.Unix(now.Unix(), 0),
+		expires: time.Unix(expires.Unix(), 0),
+	}
+	if b.Expired(now) {
+		return errBanSubnet("the ban expiry time is in the past")
+	}
+
+	bl.Lock()
+	defer bl.Unlock()
+
+	return bl.update([]*ban{b}, nil, now)
+}
+
+// Unban lifts the ban of the passed subnet and removes it from the database.
+// It returns whether the subnet was banned.  The bans of other subnets which
+// cover or are covered by the subnet are not affected.
+//
+// This function is safe for concurrent access.
+func (bl *banList) Unban(subnet *net.IPNet) (bool, error) {
+	now := time.Now()
+
+	bl.Lock()
+	defer bl.Unlock()
+
+	b, ok := bl.bans[subnet.String()]
+	if !ok || b.Expired(now) {
+		return false, nil
+	}
+	return true, bl.update(nil, []*net.IPNet{subnet}, now)
+}
+
+// Import adds the bans described by the passed entries, such as those exported
+// by another node, and persists them.  Existing bans of the same subnets are
+// replaced, and entries which are already expired are skipped.  It returns
+// the number of imported bans.  An error is returned, and nothing is
+// imported, if any of the entries describes an invalid subnet.
+//
+// This function is safe for concurrent access.
+func (bl *banList) Import(entries []btcjson.BanListEntry) (int, error) {
+	now := time.Now()
+	bans := make([]*ban, 0, len(entries))
+	for i := range entries {
+		b, err := newBan((*banRecord)(&entries[i]))
+		if err != nil {
+			return 0, err
+		}
+		if !b.Expired(now) {
+			bans = append(bans, b)
+		}
+	}
+
+	bl.Lock()
+	defer bl.Unlock()
+
+	if err := bl.update(bans, nil, now); err != nil {
+		return 0, err
+	}
+	return len(bans), nil
+}
+
+// Bans returns the bans which are not expired in the order they were created.
+//
+// This function is safe for concurrent access.
+func (bl *banList) Bans() []*ban {
+	now := time.Now()
+
+	bl.RLock()
+	bans := make([]*ban, 0, len(bl.bans))
+	for _, b := range bl.bans {
+		if !b.Expired(now) {
+			bans = append(bans, b)
+		}
+	}
+	bl.RUnlock()
+
+	sort.Sort(banSorter(bans))
+	return bans
+}
+
+// Banned returns whether the passed IP address is covered by a ban which is
+// not expired.
+//
+// This function is safe for concurrent access.
+func (bl *banList) Banned(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	now := time.Now()
+
+	bl.RLock()
+	defer bl.RUnlock()
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return bl.ipv4.match(ip4, now) != nil
+	}
+	return bl.ipv6.match(ip.To16(), now) != nil
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/database"
+)
+
+// TestParseBanSubnet ensures IP addresses and subnets are parsed into the
+// subnets they ban, with IPv4-mapped IPv6 ones treated as IPv4 ones.
+func TestParseBanSubnet(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // empty when the subnet is invalid
+	}{
+		{in: "203.0.113.7", want: "203.0.113.7/32"},
+		{in: "203.0.113.7/24", want: "203.0.113.0/24"},
+		{in: "0.0.0.0/0", want: "0.0.0.0/0"},
+		{in: "2001:db8::1", want: "2001:db8::1/128"},
+		{in: "2001:db8:ffff::/33", want: "2001:db8:8000::/33"},
+		{in: "::/0", want: "::/0"},
+		{in: "::ffff:203.0.113.7", want: "203.0.113.7/32"},
+		{in: "::ffff:203.0.113.0/120", want: "203.0.113.0/24"},
+		{in: "203.0.113.256"},
+		{in: "203.0.113.0/33"},
+		{in: "2001:db8::/129"},
+		{in: "example.com"},
+	}
+
+	for _, test := range tests {
+		subnet, err := parseBanSubnet(test.in)
+		if test.want == "" {
+			if _, ok := err.(errBanSubnet); !ok {
+				t.Errorf("parseBanSubnet(%q): got error %v, want "+
+					"errBanSubnet", test.in, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseBanSubnet(%q): unexpected error: %v",
+				test.in, err)
+			continue
+		}
+		if subnet.String() != test.want {
+			t.Errorf("parseBanSubnet(%q): got %v, want %v", test.in,
+				subnet, test.want)
+		}
+	}
+}
+
+// TestBanList ensures the addresses covered by nested IPv4 and IPv6 subnet
+// bans are banned until the bans are lifted or expire, that the bans survive
+// restarts, and that exported bans are imported by another ban list.
+func TestBanList(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	tmpDir, err := ioutil.TempDir("", "banlist")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		params.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+
+	bl, err := newBanList(db, false)
+	if err != nil {
+		t.Fatalf("newBanList: unexpected error: %v", err)
+	}
+	mustBan := func(s string, expires time.Time) {
+		subnet, err := parseBanSubnet(s)
+		if err != nil {
+			t.Fatalf("parseBanSubnet(%q): unexpected error: %v", s, err)
+		}
+		if err := bl.Ban(subnet, "abuse", expires); err != nil {
+			t.Fatalf("Ban(%s): unexpected error: %v", s, err)
+		}
+	}
+	mustUnban := func(s string, want bool) {
+		subnet, err := parseBanSubnet(s)
+		if err != nil {
+			t.Fatalf("parseBanSubnet(%q): unexpected error: %v", s, err)
+		}
+		unbanned, err := bl.Unban(subnet)
+		if err != nil {
+			t.Fatalf("Unban(%s): unexpected error: %v", s, err)
+		}
+		if unbanned != want {
+			t.Fatalf("Unban(%s): got %v, want %v", s, unbanned, want)
+		}
+	}
+	checkBanned := func(desc string, bl *banList, banned, allowed []string) {
+		for _, ip := range banned {
+			if !bl.Banned(net.ParseIP(ip)) {
+				t.Errorf("%s: %s is not banned", desc, ip)
+			}
+		}
+		for _, ip := range allowed {
+			if bl.Banned(net.ParseIP(ip)) {
+				t.Errorf("%s: %s is banned", desc, ip)
+			}
+		}
+	}
+
+	// Ban an IPv4 subnet along with a smaller subnet inside of it which is
+	// banned for longer, and an IPv6 subnet with a prefix which doesn't
+	// end on a byte boundary along with a single address.
+	now := time.Now()
+	mustBan("10.1.0.0/16", now.Add(time.Hour))
+	mustBan("10.1.2.0/24", now.Add(2*time.Hour))
+	mustBan("2001:db8::/33", now.Add(time.Hour))
+	mustBan("2001:db9::5", now.Add(time.Hour))
+	checkBanned("banned", bl, []string{"10.1.0.0", "10.1.2.3",
+		"10.1.255.255", "::ffff:10.1.7.7", "2001:db8::1",
+		"2001:db8:7fff:ffff::1", "2001:db9::5"},
+		[]string{"10.0.255.255", "10.2.0.0", "2001:db8:8000::1",
+			"2001:db9::6", "::a01:203"})
+	if bl.Banned(nil) {
+		t.Errorf("banned: a missing IP address is banned")
+	}
+
+	// Banning an expired ban is refused.
+	subnet, _ := parseBanSubnet("192.0.2.0/24")
+	if err := bl.Ban(subnet, "", now.Add(-time.Second)); err == nil {
+		t.Errorf("Ban with an expiry in the past: unexpected success")
+	}
+
+	// Lifting the ban of the outer subnet keeps the nested subnet banned,
+	// and lifting the ban of a subnet which isn't banned on its own fails.
+	mustUnban("10.1.0.0/16", true)
+	mustUnban("10.1.0.0/16", false)
+	mustUnban("2001:db8::/32", false)
+	checkBanned("unbanned outer subnet", bl, []string{"10.1.2.3"},
+		[]string{"10.1.3.0"})
+
+	// The bans are ignored once they expire.
+	trie := &bl.ipv4
+	if trie.match(net.ParseIP("10.1.2.3").To4(), now.Add(time.Hour)) == nil {
+		t.Errorf("ban of 10.1.2.0/24 expired early")
+	}
+	if trie.match(net.ParseIP("10.1.2.3").To4(), now.Add(3*time.Hour)) != nil {
+		t.Errorf("ban of 10.1.2.0/24 did not expire")
+	}
+
+	// The bans survive restarts.
+	bl, err = newBanList(db, false)
+	if err != nil {
+		t.Fatalf("newBanList: unexpected error: %v", err)
+	}
+	checkBanned("restarted", bl, []string{"10.1.2.3", "2001:db8::1",
+		"2001:db9::5"}, []string{"10.1.3.0"})
+	exported := bl.Bans()
+	if len(exported) != 3 {
+		t.Fatalf("Bans: got %d bans, want 3", len(exported))
+	}
+
+	// Exported bans are imported by another ban list, skipping the expired
+	// ones, and invalid subnets are refused.
+	otherDB, err := database.Create("ffldb", filepath.Join(tmpDir,
+		"otherffldb"), params.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer otherDB.Close()
+	other, err := newBanList(otherDB, false)
+	if err != nil {
+		t.Fatalf("newBanList: unexpected error: %v", err)
+	}
+	entries := make([]btcjson.BanListEntry, 0, len(exported)+1)
+	for _, b := range exported {
+		entries = append(entries, *b.result())
+	}
+	entries = append(entries, btcjson.BanListEntry{
+		Subnet:  "192.0.2.0/24",
+		Created: now.Add(-2 * time.Hour).Unix(),
+		Expires: now.Add(-time.Hour).Unix(),
+	})
+	_, err = other.Import(append(entries, btcjson.BanListEntry{
+		Subnet: "192.0.2.0/33",
+	}))
+	if _, ok := err.(errBanSubnet); !ok {
+		t.Fatalf("Import of an invalid subnet: got error %v, want "+
+			"errBanSubnet", err)
+	}
+	imported, err := other.Import(entries)
+	if err != nil {
+		t.Fatalf("Import: unexpected error: %v", err)
+	}
+	if imported != 3 {
+		t.Fatalf("Import: got %d imported bans, want 3", imported)
+	}
+	checkBanned("imported", other, []string{"10.1.2.3", "2001:db8::1",
+		"2001:db9::5"}, []string{"10.1.3.0", "192.0.2.1"})
+	for i, b := range other.Bans() {
+		if *b.result() != entries[i] {
+			t.Errorf("imported ban #%d: got %+v, want %+v", i,
+				*b.result(), entries[i])
+		}
+	}
+}
@@ -39,6 +39,16 @@ func (b *BlockChain) maybeAcceptBlock(block *provautil.Block, flags BehaviorFlag
 	// position of the block within the block chain.
 	err = b.checkBlockContext(block, prevNode, flags)
 	if err != nil {
+		// Only rule errors are a verdict on the block.  Other errors,
+		// such as failures to load data from the database, are not
+		// cached since the block may well be valid.
+		if _, ok := err.(RuleError); ok {
+			b.validationCache.add(block, flags, err, true,
+				b.bestNode.hash)
+			if !dryRun {
+				b.removeHeaderNode(block.Hash())
+			}
+		}
 		return false, err
 	}
 
@@ -51,17 +61,54 @@ func (b *BlockChain) maybeAcceptBlock(block *provautil.Block, flags BehaviorFlag
 	// expensive connection logic.  It also has some other nice properties
 	// such as making blocks that never become part of the main chain or
 	// blocks that fail to connect available for further analysis.
+	//
+	// The block is also recorded as a tip of the block tree in place of
+	// its parent along with it, and whether the validate key which signed
+	// the block signed a different block at the same height is detected,
+	// which is reported regardless of whether the block ultimately
+	// connects since the signature alone is the evidence.
+	var parentWasTip bool
+	var doubleSign *DoubleSign
+	blockHeader := &block.MsgBlock().Header
 	err = b.db.Update(func(dbTx database.Tx) error {
-		return dbMaybeStoreBlock(dbTx, block)
+		if err := dbMaybeStoreBlock(dbTx, block); err != nil {
+			return err
+		}
+		if dryRun {
+			return nil
+		}
+		var err error
+		parentWasTip, err = dbPutChainTip(dbTx, block.Hash(),
+			&blockHeader.PrevBlock)
+		if err != nil {
+			return err
+		}
+		doubleSign, err = b.detectDoubleSign(dbTx, blockHeader)
+		return err
 	})
 	if err != nil {
 		return false, err
 	}
+	if doubleSign != nil {
+		b.recordDoubleSign(doubleSign)
+		b.chainLock.Unlock()
+		b.sendNotification(NTDoubleSign, doubleSign)
+		b.chainLock.Lock()
+	}
 
 	// Create a new block node for the block and add it to the in-memory
-	// block chain (could be either a side chain or the main chain).
-	blockHeader := &block.MsgBlock().Header
-	newNode := newBlockNode(blockHeader, block.Hash())
+	// block chain (could be either a side chain or the main chain).  The
+	// headers-only entry of the block, when its header was processed
+	// first, is upgraded instead so the headers-only entries which extend
+	// it remain linked to it.
+	newNode, headerOnly := b.headerNodes[*block.Hash()]
+	if !headerOnly || dryRun {
+		newNode = newBlockNode(blockHeader, block.Hash())
+	} else {
+		newNode.workSum = CalcWork(blockHeader.Bits)
+	}
+	b.blocksReceived++
+	newNode.received = b.blocksReceived
 	if prevNode != nil {
 		newNode.parent = prevNode
 		newNode.height = blockHeader.Height
@@ -72,9 +119,43 @@ func (b *BlockChain) maybeAcceptBlock(block *provautil.Block, flags BehaviorFlag
 	// selection according to the chain with the most proof of work.  This
 	// also handles validation of the transaction scripts.
 	isMainChain, err := b.connectBestChain(newNode, block, flags)
+	if headerOnly && !dryRun {
+		// The entry is no longer headers-only once the block is in
+		// the block index, and is dropped when the block broke a rule.
+		_, inIndex := b.index[*block.Hash()]
+		if _, ok := err.(RuleError); ok || inIndex {
+			b.removeHeaderNode(block.Hash())
+		}
+	}
 	if err != nil {
+		// The block has already been stored, so make sure it is not
+		// treated as a known block from now on when it failed to connect
+		// for a reason other than breaking a rule.  This allows it to be
+		// processed again once the underlying problem is resolved.
+		if _, ok := err.(RuleError); !ok {
+			if _, ok := b.index[*block.Hash()]; !ok {
+				b.indexLock.Lock()
+				b.failedBlocks[*block.Hash()] = struct{}{}
+				b.indexLock.Unlock()
+			}
+		} else if _, ok := b.index[*block.Hash()]; !ok && !dryRun {
+			// A block which broke a rule doesn't extend the block
+			// tree, so its parent is restored as a tip.
+			dbErr := b.db.Update(func(dbTx database.Tx) error {
+				return dbRemoveChainTip(dbTx, block.Hash(),
+					&blockHeader.PrevBlock, parentWasTip)
+			})
+			if dbErr != nil {
+				return false, dbErr
+			}
+		}
 		return false, err
 	}
+	if _, ok := b.failedBlocks[*block.Hash()]; ok {
+		b.indexLock.Lock()
+		delete(b.failedBlocks, *block.Hash())
+		b.indexLock.Unlock()
+	}
 
 	// Notify the caller that the new block was accepted into the block
 	// chain.  The caller would typically want to react by relaying the
@@ -0,0 +1,378 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"github.com/bitgo/prova/blockchain/adminstate"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// AdminOpType identifies the kind of an admin operation.
+type AdminOpType int
+
+const (
+	// AdminOpAddKey adds a key to an admin key set or provisions an ASP
+	// keyID.
+	AdminOpAddKey AdminOpType = iota
+
+	// AdminOpRevokeKey revokes a key of an admin key set or an ASP keyID.
+	AdminOpRevokeKey
+
+	// AdminOpIssue issues new tokens.
+	AdminOpIssue
+
+	// AdminOpDestroy destroys tokens.
+	AdminOpDestroy
+
+	// AdminOpUnknown is an admin operation reserved for later soft forks,
+	// which doesn't change the admin state.
+	AdminOpUnknown
+)
+
+// adminOpTypeStrings is a map of admin operation types back to the names they
+// are reported with.
+var adminOpTypeStrings = map[AdminOpType]string{
+	AdminOpAddKey:    "ADD_KEY",
+	AdminOpRevokeKey: "REVOKE_KEY",
+	AdminOpIssue:     "ISSUE",
+	AdminOpDestroy:   "DESTROY",
+	AdminOpUnknown:   "UNKNOWN_OP",
+}
+
+// String returns the AdminOpType as a human-readable name.
+func (t AdminOpType) String() string {
+	if str, ok := adminOpTypeStrings[t]; ok {
+		return str
+	}
+	return "UNKNOWN_OP"
+}
+
+// AdminOpRecord describes an admin operation performed by a block along with
+// the part of the admin state it results in.
+type AdminOpRecord struct {
+	// TxHash is the hash of the admin transaction performing the
+	// operation.
+	TxHash chainhash.Hash
+
+	// Thread is the admin thread of the transaction.
+	Thread provautil.ThreadID
+
+	// Op is the kind of the operation.
+	Op AdminOpType
+
+	// KeySet, PubKey and KeyID identify the key affected by key
+	// operations.  KeyID is only set for ASP keys.
+	KeySet btcec.KeySetType
+	PubKey *btcec.PublicKey
+	KeyID  btcec.KeyID
+
+	// Amount is the number of atoms issued or destroyed by the
+	// transaction.
+	Amount int64
+
+	// SetSize is the number of keys of the affected key set, or the number
+	// of provisioned ASP keyIDs, after a key operation.
+	SetSize int
+
+	// TotalSupply is the total supply after an issuance or destruction.
+	TotalSupply uint64
+}
+
+// blockAdminTxs returns the admin transactions of the passed block.
+func blockAdminTxs(block *provautil.Block) []*provautil.Tx {
+	var adminTxs []*provautil.Tx
+	// The coinbase can't be an admin transaction.
+	for _, tx := range block.Transactions()[1:] {
+		if threadInt, _ := txscript.GetAdminDetails(tx); threadInt >= 0 {
+			adminTxs = append(adminTxs, tx)
+		}
+	}
+	return adminTxs
+}
+
+// blockIssueTxCounts returns the number of issuance and destruction
+// transactions of the passed block.  Like connectAdminOps, it treats the issue
+// thread transactions spending more than the thread tip as destructions.
+func blockIssueTxCounts(block *provautil.Block) (uint64, uint64) {
+	var issuances, destructions uint64
+	for _, tx := range blockAdminTxs(block) {
+		threadInt, _ := txscript.GetAdminDetails(tx)
+		if provautil.ThreadID(threadInt) != provautil.IssueThread {
+			continue
+		}
+		if len(tx.MsgTx().TxIn) > 1 {
+			destructions++
+		} else {
+			issuances++
+		}
+	}
+	return issuances, destructions
+}
+
+// connectAdminOps executes the admin operations of the passed admin
+// transaction on the passed state and returns a record of each of them.
+// Operations which don't apply to the state, which is only possible for blocks
+// of side chains that were never validated against an admin state, leave it
+// unchanged.
+func connectAdminOps(state *adminstate.State, tx *provautil.Tx) []AdminOpRecord {
+	threadInt, adminOutputs := txscript.GetAdminDetails(tx)
+	if threadInt < 0 {
+		return nil
+	}
+	threadID := provautil.ThreadID(threadInt)
+	msgTx := tx.MsgTx()
+
+	if threadID == provautil.IssueThread {
+		record := AdminOpRecord{
+			TxHash: *tx.Hash(),
+			Thread: threadID,
+			Op:     AdminOpIssue,
+		}
+		if len(msgTx.TxIn) > 1 {
+			record.Op = AdminOpDestroy
+			for i := 0; i < len(adminOutputs); i++ {
+				if txscript.TypeOfScript(adminOutputs[i]) == txscript.NullDataTy {
+					record.Amount += msgTx.TxOut[i+1].Value
+				}
+			}
+		} else {
+			for i := 1; i < len(msgTx.TxOut); i++ {
+				record.Amount += msgTx.TxOut[i].Value
+			}
+		}
+		state.ConnectTransaction(tx)
+		record.TotalSupply = state.TotalSupply
+		return []AdminOpRecord{record}
+	}
+
+	records := make([]AdminOpRecord, 0, len(adminOutputs))
+	for i := 0; i < len(adminOutputs); i++ {
+		record := AdminOpRecord{
+			TxHash: *tx.Hash(),
+			Thread: threadID,
+		}
+		if txscript.IsUpgradableAdminOp(adminOutputs[i]) {
+			record.Op = AdminOpUnknown
+			records = append(records, record)
+			continue
+		}
+		if !txscript.IsValidAdminOp(adminOutputs[i], threadID) {
+			continue
+		}
+		isAddOp, keySetType, pubKey,
+			keyID := txscript.ExtractAdminOpData(adminOutputs[i])
+		record.Op = AdminOpRevokeKey
+		if isAddOp {
+			record.Op = AdminOpAddKey
+		}
+		record.KeySet = keySetType
+		record.PubKey = pubKey
+		record.KeyID = keyID
+
+		if keySetType == btcec.ASPKeySet {
+			if isAddOp {
+				state.KeyIDs[keyID] = pubKey
+				if keyID > state.LastKeyID {
+					state.LastKeyID = keyID
+				}
+			} else {
+				delete(state.KeyIDs, keyID)
+				revoked := state.RevokedKeys[keyID]
+				revoked.PubKey = pubKey
+				revoked.Revocations++
+				state.RevokedKeys[keyID] = revoked
+			}
+			record.SetSize = len(state.KeyIDs)
+		} else {
+			keySet := state.KeySets[keySetType]
+			if isAddOp {
+				keySet = keySet.Add(pubKey)
+			} else {
+				keySet = keySet.Remove(keySet.Pos(pubKey))
+			}
+			state.KeySets[keySetType] = keySet
+			record.SetSize = len(keySet)
+		}
+		records = append(records, record)
+	}
+	state.ThreadTips[threadID] = wire.NewOutPoint(tx.Hash(), 0)
+	return records
+}
+
+// connectBlockAdminOps executes the passed admin transactions on the passed
+// state, which must be the admin state before them, and returns a record of
+// each of their operations.
+func connectBlockAdminOps(state *adminstate.State, adminTxs []*provautil.Tx) []AdminOpRecord {
+	records := make([]AdminOpRecord, 0, len(adminTxs))
+	for _, tx := range adminTxs {
+		records = append(records, connectAdminOps(state, tx)...)
+	}
+	return records
+}
+
+// disconnectBlockAdminTxs undoes the admin transactions of the passed block,
+// which must be the last block connected to the passed state, in reverse
+// order.
+func disconnectBlockAdminTxs(state *adminstate.State, block *provautil.Block) {
+	adminTxs := blockAdminTxs(block)
+	for i := len(adminTxs) - 1; i >= 0; i-- {
+		state.DisconnectTransaction(adminTxs[i])
+	}
+}
+
+// adminStateBefore returns the admin state as of the parent of the passed
+// stored block, which may be in the main chain or in a side chain.  Starting
+// from the admin state of the best chain, the admin transactions of the main
+// chain blocks after the fork point of the block are undone and then those of
+// the side chain blocks between the fork point and the block are executed.
+// The cost therefore grows with the distance of the block to the tip.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) adminStateBefore(block *provautil.Block) (*adminstate.State, error) {
+	state := b.AdminState()
+	err := b.db.View(func(dbTx database.Tx) error {
+		// Collect the side chain blocks before the block, from the
+		// newest to the oldest, until the main chain is reached.
+		var sideBlocks []*provautil.Block
+		prevHash := &block.MsgBlock().Header.PrevBlock
+		for !dbMainChainHasBlock(dbTx, prevHash) {
+			sideBlock, err := dbFetchBlockByHash(dbTx,
+				b.chainParams, prevHash)
+			if err != nil {
+				return err
+			}
+			sideBlocks = append(sideBlocks, sideBlock)
+			prevHash = &sideBlock.MsgBlock().Header.PrevBlock
+		}
+		forkHeight, err := dbFetchHeightByHash(dbTx, prevHash)
+		if err != nil {
+			return err
+		}
+
+		// Undo the main chain blocks after the fork point.
+		for height := b.bestNode.height; height > forkHeight; height-- {
+			mainBlock, err := dbFetchBlockByHeight(dbTx,
+				b.chainParams, height)
+			if err != nil {
+				return err
+			}
+			disconnectBlockAdminTxs(state, mainBlock)
+		}
+
+		// Execute the side chain blocks from the fork point on.
+		for i := len(sideBlocks) - 1; i >= 0; i-- {
+			connectBlockAdminOps(state, blockAdminTxs(sideBlocks[i]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// adminKeyChanges returns the admin key changes made by the key operations of
+// the passed records of the block at the passed height.  When the block was
+// disconnected, the changes are the inverse of the operations, in reverse
+// order.
+func adminKeyChanges(records []AdminOpRecord, height uint32, disconnected bool) []*AdminKeyChange {
+	var changes []*AdminKeyChange
+	for i := range records {
+		record := &records[i]
+		if record.Op != AdminOpAddKey && record.Op != AdminOpRevokeKey {
+			continue
+		}
+		changes = append(changes, &AdminKeyChange{
+			KeySet: record.KeySet,
+			PubKey: record.PubKey,
+			KeyID:  record.KeyID,
+			Added:  (record.Op == AdminOpAddKey) != disconnected,
+			TxHash: record.TxHash,
+			Height: height,
+		})
+	}
+	if disconnected {
+		for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+			changes[i], changes[j] = changes[j], changes[i]
+		}
+	}
+	return changes
+}
+
+// blockAdminKeyChanges returns the admin key changes made by connecting the
+// passed block, which MUST be the best block, or by disconnecting it, in which
+// case it MUST be the block which was just disconnected from the main chain.
+// Nothing is computed when nobody receives notifications.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) blockAdminKeyChanges(block *provautil.Block, disconnected bool) []*AdminKeyChange {
+	adminTxs := blockAdminTxs(block)
+	if len(adminTxs) == 0 || !b.hasNotificationReceivers() {
+		return nil
+	}
+
+	// The operations are executed on the admin state before the block,
+	// which is the current admin state once the block was disconnected.
+	state := b.AdminState()
+	if !disconnected {
+		disconnectBlockAdminTxs(state, block)
+	}
+	records := connectBlockAdminOps(state, adminTxs)
+	return adminKeyChanges(records, block.MsgBlock().Header.Height,
+		disconnected)
+}
+
+// AdminOpsInBlock returns a record of each admin operation performed by the
+// stored block with the passed hash, in the order of the transactions and of
+// their outputs, along with the part of the admin state each of them results
+// in.  The block may be in the main chain or in a side chain, in which case
+// the records describe the admin state of the side chain.  Blocks without
+// admin transactions return an empty list without computing any admin state.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AdminOpsInBlock(hash *chainhash.Hash) ([]AdminOpRecord, error) {
+	var block *provautil.Block
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		block, err = dbFetchBlockByHash(dbTx, b.chainParams, hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	adminTxs := blockAdminTxs(block)
+	if len(adminTxs) == 0 {
+		return []AdminOpRecord{}, nil
+	}
+
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+	state, err := b.adminStateBefore(block)
+	if err != nil {
+		return nil, err
+	}
+	return connectBlockAdminOps(state, adminTxs), nil
+}
+
+// BestBlockAdminOps returns the same records as AdminOpsInBlock for the passed
+// block, which MUST be the best block of the main chain, such as the block of
+// a block connected notification.  Unlike AdminOpsInBlock, it does not acquire
+// the chain state lock, so it may be called while handling notifications.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BestBlockAdminOps(block *provautil.Block) []AdminOpRecord {
+	adminTxs := blockAdminTxs(block)
+	if len(adminTxs) == 0 {
+		return []AdminOpRecord{}
+	}
+	state := b.AdminState()
+	disconnectBlockAdminTxs(state, block)
+	return connectBlockAdminOps(state, adminTxs)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/bitgo/prova/blockchain/adminstate"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// blockProofTxs returns the admin transactions of the passed block at the
+// passed height along with the merkle branches which prove they are included
+// in it.
+func blockProofTxs(block *provautil.Block, height uint32) []adminstate.ProofTx {
+	adminTxs := blockAdminTxs(block)
+	if len(adminTxs) == 0 {
+		return nil
+	}
+	merkles := BuildMerkleTreeStore(block.Transactions())
+	proofTxs := make([]adminstate.ProofTx, 0, len(adminTxs))
+	for _, tx := range adminTxs {
+		proofTxs = append(proofTxs, adminstate.ProofTx{
+			Tx:           tx.MsgTx(),
+			Height:       height,
+			Index:        uint32(tx.Index()),
+			MerkleBranch: merkleBranch(merkles, tx.Index()),
+		})
+	}
+	return proofTxs
+}
+
+// AdminProof returns a proof of the admin state as of the main chain block at
+// the passed height, which can be verified without the chain by trusting the
+// hash of the checkpoint block it starts from and the hash of the admin state
+// as of that block.  The proof starts from the most recent checkpoint at or
+// before the height, or from the genesis block when there is none.  An error is
+// returned when the proof would exceed the size limits of proofs.
+//
+// The admin state as of the checkpoint is computed by undoing the admin
+// transactions of the main chain blocks after it, so the cost grows with the
+// distance of the checkpoint to the tip.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AdminProof(height uint32) (*adminstate.Proof, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	if height > b.bestNode.height {
+		return nil, fmt.Errorf("no block at height %d exists", height)
+	}
+	var checkpointHeight uint32
+	for _, checkpoint := range b.Checkpoints() {
+		if checkpoint.Height <= height &&
+			checkpoint.Height > checkpointHeight {
+
+			checkpointHeight = checkpoint.Height
+		}
+	}
+	numHeaders := height - checkpointHeight
+	if numHeaders > adminstate.MaxProofHeaders {
+		return nil, fmt.Errorf("the proof for height %d would have %d "+
+			"headers after the checkpoint at height %d, which "+
+			"exceeds the maximum of %d", height, numHeaders,
+			checkpointHeight, adminstate.MaxProofHeaders)
+	}
+
+	// Undo the admin transactions of the main chain blocks after the
+	// checkpoint, from the tip down, while collecting the headers and
+	// admin transactions of the blocks up to the height.
+	state := b.AdminState()
+	proof := &adminstate.Proof{
+		CheckpointHeight: checkpointHeight,
+		Headers:          make([]wire.BlockHeader, numHeaders),
+	}
+	blockTxs := make([][]adminstate.ProofTx, numHeaders)
+	err := b.db.View(func(dbTx database.Tx) error {
+		for h := b.bestNode.height; h > checkpointHeight; h-- {
+			block, err := dbFetchBlockByHeight(dbTx,
+				b.chainParams, h)
+			if err != nil {
+				return err
+			}
+			disconnectBlockAdminTxs(state, block)
+			if h > height {
+				continue
+			}
+			i := h - checkpointHeight - 1
+			proof.Headers[i] = block.MsgBlock().Header
+			blockTxs[i] = blockProofTxs(block, h)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	proof.CheckpointState = state
+
+	for _, txs := range blockTxs {
+		proof.AdminTxs = append(proof.AdminTxs, txs...)
+	}
+	if len(proof.AdminTxs) > adminstate.MaxProofAdminTxs {
+		return nil, fmt.Errorf("the proof for height %d would have %d "+
+			"admin transactions, which exceeds the maximum of %d",
+			height, len(proof.AdminTxs), adminstate.MaxProofAdminTxs)
+	}
+	return proof, nil
+}
@@ -0,0 +1,263 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/bitgo/prova/blockchain/adminstate"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/database"
+)
+
+// adminSnapshotBucketName is the name of the db bucket used to house the
+// snapshots of the admin state of the main chain, keyed by the big endian
+// height of the block they are the admin state as of.
+var adminSnapshotBucketName = []byte("adminsnapshots")
+
+// adminSnapshotInterval is the number of blocks between the snapshots of the
+// admin state of the main chain, which bounds the number of blocks replayed to
+// reconstruct the admin state as of any height.  Lookups use whichever
+// snapshots are stored, so changing it does not invalidate existing ones.  It
+// is a variable so the tests can lower it.
+var adminSnapshotInterval uint32 = 1000
+
+// adminSnapshotKey returns the database key of the snapshot of the admin state
+// as of the passed height.  It is big endian so the snapshots are ordered by
+// height.
+func adminSnapshotKey(height uint32) []byte {
+	var key [4]byte
+	binary.BigEndian.PutUint32(key[:], height)
+	return key[:]
+}
+
+// dbPutAdminSnapshot uses an existing database transaction to store the passed
+// admin state as the snapshot as of the passed height.
+func dbPutAdminSnapshot(dbTx database.Tx, height uint32, state *adminstate.State) error {
+	bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+		adminSnapshotBucketName)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(adminSnapshotKey(height), state.Serialize())
+}
+
+// dbRemoveAdminSnapshot uses an existing database transaction to remove the
+// snapshot of the admin state as of the passed height, if any.
+func dbRemoveAdminSnapshot(dbTx database.Tx, height uint32) error {
+	bucket := dbTx.Metadata().Bucket(adminSnapshotBucketName)
+	if bucket == nil {
+		return nil
+	}
+	return bucket.Delete(adminSnapshotKey(height))
+}
+
+// adminSnapshotAt decodes the snapshot the passed cursor points to.
+func adminSnapshotAt(cursor database.Cursor) (uint32, *adminstate.State, error) {
+	key := cursor.Key()
+	if len(key) != 4 {
+		return 0, nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: fmt.Sprintf("corrupt admin snapshot key %x", key),
+		}
+	}
+	height := binary.BigEndian.Uint32(key)
+	state, err := adminstate.Deserialize(cursor.Value())
+	if err != nil {
+		return 0, nil, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("corrupt admin snapshot at "+
+				"height %d: %v", height, err),
+		}
+	}
+	return height, state, nil
+}
+
+// dbFetchAdminSnapshots uses an existing database transaction to fetch the
+// latest snapshot of the admin state at or before the passed height and the
+// earliest one after it.  The state of a snapshot which doesn't exist is nil.
+func dbFetchAdminSnapshots(dbTx database.Tx, height uint32) (uint32, *adminstate.State, uint32, *adminstate.State, error) {
+	bucket := dbTx.Metadata().Bucket(adminSnapshotBucketName)
+	if bucket == nil {
+		return 0, nil, 0, nil, nil
+	}
+
+	var prevHeight, nextHeight uint32
+	var prevState, nextState *adminstate.State
+	var err error
+	cursor := bucket.Cursor()
+	ok := cursor.Seek(adminSnapshotKey(height))
+	if ok {
+		nextHeight, nextState, err = adminSnapshotAt(cursor)
+		if err != nil {
+			return 0, nil, 0, nil, err
+		}
+		if nextHeight == height {
+			prevHeight, prevState = nextHeight, nextState
+			nextState = nil
+			if cursor.Next() {
+				nextHeight, nextState, err = adminSnapshotAt(cursor)
+				if err != nil {
+					return 0, nil, 0, nil, err
+				}
+			}
+			return prevHeight, prevState, nextHeight, nextState, nil
+		}
+		ok = cursor.Prev()
+	} else {
+		ok = cursor.Last()
+	}
+	if ok {
+		prevHeight, prevState, err = adminSnapshotAt(cursor)
+		if err != nil {
+			return 0, nil, 0, nil, err
+		}
+	}
+	return prevHeight, prevState, nextHeight, nextState, nil
+}
+
+// adminStateAtHeight returns the admin state as of the main chain block at the
+// passed height.  It starts from whichever is closest to the height among the
+// latest snapshot at or before it, which is replayed forward, and the earliest
+// snapshot after it or the admin state of the best chain, which are undone
+// backward, so at most half of the blocks between two snapshots are visited.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) adminStateAtHeight(height uint32) (*adminstate.State, error) {
+	bestHeight := b.bestNode.height
+	if height > bestHeight {
+		return nil, fmt.Errorf("no block at height %d exists, the best "+
+			"height is %d", height, bestHeight)
+	}
+
+	var state *adminstate.State
+	err := b.db.View(func(dbTx database.Tx) error {
+		prevHeight, prevState, nextHeight, nextState, err :=
+			dbFetchAdminSnapshots(dbTx, height)
+		if err != nil {
+			return err
+		}
+		if nextState == nil || nextHeight > bestHeight {
+			nextHeight, nextState = bestHeight, b.AdminState()
+		}
+
+		// Undo the admin transactions of the blocks after the height
+		// when the later state is closer.
+		if prevState == nil || nextHeight-height < height-prevHeight {
+			state = nextState
+			for h := nextHeight; h > height; h-- {
+				block, err := dbFetchBlockByHeight(dbTx,
+					b.chainParams, h)
+				if err != nil {
+					return err
+				}
+				disconnectBlockAdminTxs(state, block)
+			}
+			return nil
+		}
+
+		// Otherwise execute the admin transactions of the blocks from
+		// the earlier snapshot up to the height.
+		state = prevState
+		for h := prevHeight + 1; h <= height; h++ {
+			block, err := dbFetchBlockByHeight(dbTx,
+				b.chainParams, h)
+			if err != nil {
+				return err
+			}
+			connectBlockAdminOps(state, blockAdminTxs(block))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// AdminKeySetsAtHeight returns the admin key sets as of the main chain block
+// at the passed height, such as to check a historical signature or to find out
+// when a key was authorized.  The key sets are reconstructed from the periodic
+// snapshots of the admin state, so the cost doesn't depend on the distance of
+// the height to the best block.  Undoing the revocation of a key doesn't
+// restore its position in the key set, so the keys of a set may be ordered
+// differently than AdminKeySets reported at the height.  An error is returned
+// for heights beyond the best block.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AdminKeySetsAtHeight(height uint32) (map[btcec.KeySetType]btcec.PublicKeySet, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	state, err := b.adminStateAtHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	return state.KeySets, nil
+}
+
+// upgradeToV3Batch stores the snapshots of the admin state of the main chain,
+// which version 3 of the chain state adds, for the next batch of blocks.  The
+// snapshots are taken from the best block down by undoing the admin
+// transactions of each block, adminSnapshotInterval blocks per batch.  The
+// progress is the big endian height of the next block to undo followed by the
+// serialized admin state as of it.
+func upgradeToV3Batch(dbTx database.Tx, params *chaincfg.Params, progress []byte) ([]byte, error) {
+	meta := dbTx.Metadata()
+	var height uint32
+	if len(progress) == 0 {
+		best, err := deserializeBestChainState(meta.Get(chainStateKeyName))
+		if err != nil {
+			return nil, err
+		}
+		_, err = meta.CreateBucketIfNotExists(adminSnapshotBucketName)
+		if err != nil {
+			return nil, err
+		}
+		height = best.height
+		progress = meta.Get(keySetBucketName)
+	} else if len(progress) >= 4 {
+		height = binary.BigEndian.Uint32(progress)
+		progress = progress[4:]
+	} else {
+		return nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt chain state upgrade progress",
+		}
+	}
+	state, err := adminstate.Deserialize(progress)
+	if err != nil {
+		return nil, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("unable to upgrade the admin "+
+				"state at height %d: %v", height, err),
+		}
+	}
+
+	for i := uint32(0); ; i++ {
+		if height%adminSnapshotInterval == 0 {
+			err := dbPutAdminSnapshot(dbTx, height, state)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if height == 0 {
+			return nil, nil
+		}
+		if i == adminSnapshotInterval {
+			break
+		}
+		block, err := dbFetchBlockByHeight(dbTx, params, height)
+		if err != nil {
+			return nil, err
+		}
+		disconnectBlockAdminTxs(state, block)
+		height--
+	}
+	next := adminSnapshotKey(height)
+	return append(next, state.Serialize()...), nil
+}
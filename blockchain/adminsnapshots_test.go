@@ -0,0 +1,117 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+)
+
+// describeKeySets returns a description of the passed admin key sets which
+// lists the sorted keys of each set which is not empty.
+func describeKeySets(keySets map[btcec.KeySetType]btcec.PublicKeySet) string {
+	types := make([]int, 0, len(keySets))
+	for keySetType, keySet := range keySets {
+		if len(keySet) > 0 {
+			types = append(types, int(keySetType))
+		}
+	}
+	sort.Ints(types)
+
+	var desc []string
+	for _, keySetType := range types {
+		keySet := keySets[btcec.KeySetType(keySetType)]
+		keys := make([]string, 0, len(keySet))
+		for i := range keySet {
+			keys = append(keys, fmt.Sprintf("%x",
+				keySet[i].SerializeCompressed()[1:5]))
+		}
+		sort.Strings(keys)
+		desc = append(desc, fmt.Sprintf("%v[%s]",
+			btcec.KeySetType(keySetType), strings.Join(keys, " ")))
+	}
+	return strings.Join(desc, " ")
+}
+
+// TestAdminKeySetsAtHeight ensures the admin key sets reconstructed as of each
+// height of the main chain match the ones AdminKeySets reported when the block
+// at that height was connected, including the blocks connected by
+// reorganizations, and that heights beyond the best block are rejected.
+func TestAdminKeySetsAtHeight(t *testing.T) {
+	// Take snapshots of the admin state often enough for the lookups to
+	// start from both earlier and later snapshots as well as from the best
+	// block.
+	defer blockchain.TstSetAdminSnapshotInterval(
+		blockchain.TstSetAdminSnapshotInterval(10))
+
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	chain, teardownFunc, err := chainSetup("adminkeysetsatheight",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Record the key sets reported as of each height when its block is
+	// connected, so the blocks connected last at each height, which are
+	// the ones of the main chain, determine the expected key sets.
+	want := map[uint32]string{0: describeKeySets(chain.AdminKeySets())}
+	chain.Subscribe(func(n *blockchain.Notification) {
+		if n.Type == blockchain.NTBlockConnected {
+			want[n.Height] = describeKeySets(chain.AdminKeySets())
+		}
+	})
+	for _, test := range tests {
+		for _, item := range test {
+			item, ok := item.(fullblocktests.AcceptedBlock)
+			if !ok {
+				continue
+			}
+			block := provautil.NewBlock(item.Block)
+			_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock %s: unexpected error: %v",
+					item.Name, err)
+			}
+		}
+	}
+
+	bestHeight := chain.BestSnapshot().Height
+	var changes int
+	for height := uint32(0); height <= bestHeight; height++ {
+		keySets, err := chain.AdminKeySetsAtHeight(height)
+		if err != nil {
+			t.Fatalf("AdminKeySetsAtHeight(%d): unexpected error: %v",
+				height, err)
+		}
+		if got := describeKeySets(keySets); got != want[height] {
+			t.Fatalf("AdminKeySetsAtHeight(%d): got key sets %s, "+
+				"want %s", height, got, want[height])
+		}
+		if height > 0 && want[height] != want[height-1] {
+			changes++
+		}
+	}
+	if changes < 4 {
+		t.Fatalf("the key sets only changed at %d heights", changes)
+	}
+
+	_, err = chain.AdminKeySetsAtHeight(bestHeight + 1)
+	if err == nil {
+		t.Fatalf("AdminKeySetsAtHeight(%d): height beyond the best "+
+			"block accepted", bestHeight+1)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bitgo/prova/blockchain/adminstate"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// AdminState returns a copy of the admin state of the best chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AdminState() *adminstate.State {
+	b.stateLock.RLock()
+	state := &adminstate.State{
+		ThreadTips:  b.threadTips,
+		LastKeyID:   b.lastKeyID,
+		TotalSupply: b.totalSupply,
+		KeySets:     b.adminKeySets,
+		KeyIDs:      b.aspKeyIdMap,
+		RevokedKeys: b.revokedKeys,
+	}
+	b.stateLock.RUnlock()
+	return state.Copy()
+}
+
+// DumpAdminState returns a snapshot of the admin state of the best chain,
+// serialized in the format the chain stores it in.  The snapshot can be loaded
+// with the Deserialize function of the adminstate package.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DumpAdminState() []byte {
+	return b.AdminState().Serialize()
+}
+
+// AdminTxSimulation houses the result of simulating a sequence of admin
+// transactions on top of the main chain.
+type AdminTxSimulation struct {
+	// Prev is the admin state of the main chain the transactions were
+	// validated against.
+	Prev *adminstate.State
+
+	// Next is the admin state which results from the accepted
+	// transactions.
+	Next *adminstate.State
+
+	// Accepted is the number of transactions, from the start of the
+	// sequence, which were accepted.
+	Accepted int
+}
+
+// SimulateAdminTxs validates the passed transactions in order as if they were
+// included in the next block of the main chain and returns the admin state
+// which results from them, without modifying the chain state.  Each
+// transaction is validated against the state left behind by the transactions
+// before it, so a transaction may spend the thread output of the one before.
+// As for the transactions of a block, the scripts are validated against the
+// admin state after all of the transactions.
+//
+// When one of the transactions is rejected, the simulation of the
+// transactions before it is returned along with the error, which is a
+// RuleError when the transaction violates a consensus rule.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SimulateAdminTxs(txns []*provautil.Tx) (*AdminTxSimulation, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	// The transactions are validated in the context of the block which
+	// would extend the main chain.
+	prevNode := b.bestNode
+	blockHeight := prevNode.height + 1
+	blockTime := b.timeSource.AdjustedTime()
+	utxoView := NewUtxoViewpoint()
+	utxoView.SetBestHash(prevNode.hash)
+	keyView := NewKeyViewpoint()
+	keyView.SetThreadTips(b.threadTips)
+	keyView.SetLastKeyID(b.lastKeyID)
+	keyView.SetTotalSupply(b.totalSupply)
+	keyView.SetKeys(b.adminKeySets)
+	keyView.SetKeyIDs(b.aspKeyIdMap)
+	keyView.SetRevokedKeys(b.revokedKeys)
+
+	// Perform the checks of block connection other than running the
+	// scripts and apply each transaction to the views, keeping the admin
+	// state after each of them.
+	states := make([]*adminstate.State, 0, len(txns)+1)
+	states = append(states, keyView.AdminState())
+	for i, tx := range txns {
+		err := b.checkSimulatedTx(tx, blockHeight, blockTime, utxoView,
+			keyView)
+		if err != nil {
+			return &AdminTxSimulation{Prev: states[0],
+				Next: states[i], Accepted: i}, err
+		}
+		states = append(states, keyView.AdminState())
+	}
+
+	// Run the scripts with the flags a block extending the main chain would
+	// enforce.
+	var scriptFlags txscript.ScriptFlags
+	if blockTime.Unix() >= txscript.Bip16Activation.Unix() {
+		scriptFlags |= txscript.ScriptBip16
+	}
+	if b.isMajorityVersion(3, prevNode,
+		b.chainParams.BlockEnforceNumRequired) {
+
+		scriptFlags |= txscript.ScriptVerifyDERSignatures
+	}
+	if b.isMajorityVersion(4, prevNode,
+		b.chainParams.BlockEnforceNumRequired) {
+
+		scriptFlags |= txscript.ScriptVerifyCheckLockTimeVerify
+	}
+	if b.chainParams.ScriptVersions {
+		scriptFlags |= txscript.ScriptVerifyScriptVersions
+	}
+	for i, tx := range txns {
+		block := provautil.NewBlock(&wire.MsgBlock{
+			Transactions: []*wire.MsgTx{tx.MsgTx()},
+		})
+		err := checkBlockScripts(block, utxoView, keyView, scriptFlags,
+			b.sigCache, b.hashCache, b.sigVerifyWorkers, nil)
+		if err != nil {
+			return &AdminTxSimulation{Prev: states[0],
+				Next: states[i], Accepted: i}, err
+		}
+	}
+
+	return &AdminTxSimulation{Prev: states[0], Next: states[len(txns)],
+		Accepted: len(txns)}, nil
+}
+
+// checkSimulatedTx performs the checks block connection performs on the passed
+// transaction, other than running its scripts, and updates the passed views to
+// include it.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) checkSimulatedTx(tx *provautil.Tx, blockHeight uint32,
+	blockTime time.Time, utxoView *UtxoViewpoint,
+	keyView *KeyViewpoint) error {
+
+	err := CheckTransactionSanity(tx)
+	if err != nil {
+		return err
+	}
+	if IsCoinBase(tx) {
+		str := fmt.Sprintf("transaction %v is a coinbase", tx.Hash())
+		return ruleError(ErrMultipleCoinbases, str)
+	}
+	if !IsFinalizedTransaction(tx, blockHeight, blockTime) {
+		str := fmt.Sprintf("transaction %v is unfinalized", tx.Hash())
+		return ruleError(ErrUnfinalizedTx, str)
+	}
+	if b.chainParams.TxExpiry && IsExpiredTx(tx, blockHeight) {
+		str := fmt.Sprintf("transaction %v expired at height %d",
+			tx.Hash(), tx.MsgTx().Expiry)
+		return ruleError(ErrTxExpired, str)
+	}
+
+	// Load the utxos referenced by the inputs which are not created by
+	// the transactions before this one.
+	txSet := make(map[chainhash.Hash]struct{})
+	for _, txIn := range tx.MsgTx().TxIn {
+		txSet[txIn.PreviousOutPoint.Hash] = struct{}{}
+	}
+	err = utxoView.fetchUtxos(b.db, txSet)
+	if err != nil {
+		return err
+	}
+
+	_, err = CheckTransactionInputs(tx, blockHeight, utxoView,
+		b.chainParams)
+	if err != nil {
+		return err
+	}
+	err = CheckTransactionOutputs(tx, keyView, b.chainParams)
+	if err != nil {
+		return err
+	}
+
+	err = utxoView.connectTransaction(tx, blockHeight, nil)
+	if err != nil {
+		return err
+	}
+	keyView.connectTransaction(tx, blockHeight)
+	return nil
+}
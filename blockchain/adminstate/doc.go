@@ -0,0 +1,41 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package adminstate implements the admin state of a Prova chain along with the
+rules admin transactions are validated against and the transitions they cause.
+
+The admin state consists of the tips of the admin threads, the admin key sets,
+the keyIDs of the ASP keys, and the total supply.  The blockchain package
+maintains the admin state of the chain with this package, but the package only
+depends on the transaction and script packages, so wallets and servers can
+evaluate whether an admin transaction is valid given an admin state without
+linking the chain and its database.
+
+Usage
+
+A snapshot of the admin state of the best chain, as returned by the
+DumpAdminState method of the chain, is loaded with Deserialize.  A transaction
+is validated against the state with CheckTransactionOutputs, and the state
+which results from it is returned by the Next method:
+
+	state, err := adminstate.Deserialize(snapshot)
+	if err != nil {
+		// Handle the truncated snapshot
+	}
+	if err := adminstate.CheckTransactionOutputs(tx, state); err != nil {
+		// The transaction violates the admin state rules
+	}
+	state = state.Next(tx)
+
+Note that CheckTransactionOutputs only covers the rules which depend on the
+admin state.  The sanity, input, and script checks of the blockchain package
+still apply to the transaction.
+
+Errors
+
+Rule violations are returned as a RuleError whose ErrorCode identifies the
+violated rule, and truncated serializations as a DeserializeError.
+*/
+package adminstate
@@ -0,0 +1,77 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package adminstate
+
+import (
+	"fmt"
+)
+
+// ErrorCode identifies a kind of error.
+type ErrorCode int
+
+// These constants are used to identify a specific RuleError.
+const (
+	// ErrInvalidTx indicates a transaction has an output which pays to an
+	// unknown keyID or is not an allowed Prova output.
+	ErrInvalidTx ErrorCode = iota
+
+	// ErrInvalidAdminOp indicates an admin transaction contains an invalid
+	// admin operation given the admin state.
+	ErrInvalidAdminOp
+
+	// ErrInvalidProof indicates a proof of the admin state fails
+	// verification.
+	ErrInvalidProof
+
+	// ErrKeyIDReuse indicates an admin transaction provisions a keyID
+	// which has been revoked to an ASP key other than the one it was bound
+	// to.
+	ErrKeyIDReuse
+)
+
+// Map of ErrorCode values back to their constant names for pretty printing.
+var errorCodeStrings = map[ErrorCode]string{
+	ErrInvalidTx:      "ErrInvalidTx",
+	ErrInvalidAdminOp: "ErrInvalidAdminOp",
+	ErrInvalidProof:   "ErrInvalidProof",
+	ErrKeyIDReuse:     "ErrKeyIDReuse",
+}
+
+// String returns the ErrorCode as a human-readable name.
+func (e ErrorCode) String() string {
+	if s := errorCodeStrings[e]; s != "" {
+		return s
+	}
+	return fmt.Sprintf("Unknown ErrorCode (%d)", int(e))
+}
+
+// RuleError identifies a violation of the admin state rules by a transaction,
+// or a proof of the admin state which fails verification.  The caller can use
+// type assertions to determine if a failure was specifically due to a rule
+// violation and access the ErrorCode field to ascertain the specific reason for
+// the rule violation.
+type RuleError struct {
+	ErrorCode   ErrorCode // Describes the kind of error
+	Description string    // Human readable description of the issue
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e RuleError) Error() string {
+	return e.Description
+}
+
+// ruleError creates an RuleError given a set of arguments.
+func ruleError(c ErrorCode, desc string) RuleError {
+	return RuleError{ErrorCode: c, Description: desc}
+}
+
+// DeserializeError describes a serialized admin state which could not be
+// deserialized because it is truncated.
+type DeserializeError string
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e DeserializeError) Error() string {
+	return string(e)
+}
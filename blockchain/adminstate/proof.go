@@ -0,0 +1,454 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package adminstate
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// MaxProofHeaders is the maximum number of block headers of a proof,
+	// which limits the distance between the checkpoint a proof starts
+	// from and the height it is for.
+	MaxProofHeaders = 10000
+
+	// MaxProofAdminTxs is the maximum number of admin transactions of a
+	// proof.
+	MaxProofAdminTxs = 1000
+
+	// maxProofStateLen is the maximum length of the serialized admin state
+	// of a proof, which bounds the memory allocated when deserializing a
+	// proof.
+	maxProofStateLen = 1 << 24
+
+	// maxMerkleBranchLen is the maximum length of a merkle branch of a
+	// proof, which is the depth of the merkle tree of a block.
+	maxMerkleBranchLen = 32
+)
+
+// ProofTx is an admin transaction of a proof along with the merkle branch
+// which proves it is included in the block at its height.
+type ProofTx struct {
+	// Tx is the admin transaction.
+	Tx *wire.MsgTx
+
+	// Height is the height of the block which includes the transaction.
+	Height uint32
+
+	// Index is the index of the transaction in the block.
+	Index uint32
+
+	// MerkleBranch is the hashes of the siblings of the nodes on the path
+	// from the transaction hash to the merkle root of the block, starting
+	// with the sibling of the transaction hash.  A node without a sibling
+	// is hashed with itself, so its sibling is the node itself.
+	MerkleBranch []chainhash.Hash
+}
+
+// Proof proves the admin state as of a block to a verifier which only trusts
+// the hash of a checkpoint block along with the hash of the admin state as of
+// that block.  It consists of the admin state as of the checkpoint, the headers
+// of the blocks after the checkpoint up to the block, and the admin
+// transactions of those blocks along with merkle branches proving they are
+// included in them.
+//
+// The proof can't show that no admin transaction follows the last admin
+// transaction of a thread it includes, since blocks don't commit to the admin
+// state.  It does show that no admin transaction is missing before it, since
+// each admin transaction spends the tip of its thread left behind by the one
+// before.
+type Proof struct {
+	// CheckpointHeight is the height of the checkpoint block.
+	CheckpointHeight uint32
+
+	// CheckpointState is the admin state as of the checkpoint block.
+	CheckpointState *State
+
+	// Headers is the headers of the blocks after the checkpoint up to the
+	// block the proof is for.
+	Headers []wire.BlockHeader
+
+	// AdminTxs is the admin transactions of the blocks of the headers in
+	// the order they are included in the chain.
+	AdminTxs []ProofTx
+}
+
+// Height returns the height of the block the proof is for.
+func (p *Proof) Height() uint32 {
+	return p.CheckpointHeight + uint32(len(p.Headers))
+}
+
+// proofError creates a RuleError which describes why a proof fails
+// verification.
+func proofError(format string, a ...interface{}) RuleError {
+	return ruleError(ErrInvalidProof, fmt.Sprintf(format, a...))
+}
+
+// merkleBranchRoot returns the merkle root which results from hashing the
+// passed leaf at the passed index with the passed merkle branch.
+func merkleBranchRoot(leaf *chainhash.Hash, index uint32, branch []chainhash.Hash) chainhash.Hash {
+	hash := *leaf
+	var buf [chainhash.HashSize * 2]byte
+	for i := range branch {
+		if index&1 == 0 {
+			copy(buf[:chainhash.HashSize], hash[:])
+			copy(buf[chainhash.HashSize:], branch[i][:])
+		} else {
+			copy(buf[:chainhash.HashSize], branch[i][:])
+			copy(buf[chainhash.HashSize:], hash[:])
+		}
+		hash = chainhash.DoubleHashH(buf[:])
+		index >>= 1
+	}
+	return hash
+}
+
+// connectProofTx checks the passed admin transaction of a proof is included in
+// the block of the passed header and continues its thread, validates it against
+// the passed admin state, and executes it on the state.
+func connectProofTx(state *State, header *wire.BlockHeader, ptx *ProofTx) error {
+	if ptx.Tx == nil {
+		return proofError("admin transaction at height %d is missing",
+			ptx.Height)
+	}
+	tx := provautil.NewTx(ptx.Tx)
+
+	// The transaction hashes are the first half of the leaves of the
+	// merkle tree of a block.
+	depth := len(ptx.MerkleBranch)
+	if depth == 0 || depth > maxMerkleBranchLen ||
+		uint64(ptx.Index) >= uint64(1)<<uint(depth-1) {
+
+		return proofError("admin transaction %v has a merkle branch of "+
+			"invalid length %d for index %d", tx.Hash(), depth,
+			ptx.Index)
+	}
+	root := merkleBranchRoot(tx.Hash(), ptx.Index, ptx.MerkleBranch)
+	if root != header.MerkleRoot {
+		return proofError("merkle branch of admin transaction %v does "+
+			"not match the block at height %d", tx.Hash(), ptx.Height)
+	}
+
+	threadInt, _ := txscript.GetAdminDetails(tx)
+	if threadInt < 0 {
+		return proofError("transaction %v is not an admin transaction",
+			tx.Hash())
+	}
+	threadID := provautil.ThreadID(threadInt)
+	tip := state.ThreadTips[threadID]
+	txIns := tx.MsgTx().TxIn
+	if tip == nil || len(txIns) == 0 || txIns[0].PreviousOutPoint != *tip {
+		return proofError("admin transaction %v does not spend the tip "+
+			"of the %v thread", tx.Hash(), threadID)
+	}
+
+	if err := CheckTransactionOutputs(tx, state); err != nil {
+		return err
+	}
+	state.ConnectTransaction(tx)
+	return nil
+}
+
+// checkProofHeaderSigner checks the passed header is signed by the validate
+// key it specifies and that the key is in the validate key set of the passed
+// admin state, which is the state after the admin transactions of the block.
+func checkProofHeaderSigner(state *State, header *wire.BlockHeader) error {
+	pubKey, err := btcec.ParsePubKey(header.ValidatingPubKey[:],
+		btcec.S256())
+	if err != nil {
+		return proofError("unable to parse validating public key of "+
+			"block at height %d: %v", header.Height, err)
+	}
+	if !header.Verify(pubKey) {
+		return proofError("block at height %d has an invalid signature",
+			header.Height)
+	}
+	validateKeys := state.KeySets[btcec.ValidateKeySet]
+	if len(validateKeys) > 0 && validateKeys.Pos(pubKey) == -1 {
+		return proofError("block at height %d is signed by key %x "+
+			"which is not a validate key", header.Height,
+			pubKey.SerializeCompressed())
+	}
+	return nil
+}
+
+// Verify replays the proof starting from the checkpoint block with the passed
+// hash and the admin state with the passed hash, and returns the admin state as
+// of the block the proof is for.  It checks that the headers connect to the
+// checkpoint and are signed by validate keys, that each admin transaction is
+// included in its block and spends the tip of its thread, and validates the
+// admin transactions against the admin state.  The proof of work of the headers
+// is not checked, since the signatures of the validate keys are what
+// authenticate them.  A RuleError is returned when the proof fails
+// verification.
+func (p *Proof) Verify(checkpointHash, stateHash *chainhash.Hash) (*State, error) {
+	if len(p.Headers) > MaxProofHeaders {
+		return nil, proofError("proof has %d headers, which exceeds "+
+			"the maximum of %d", len(p.Headers), MaxProofHeaders)
+	}
+	if len(p.AdminTxs) > MaxProofAdminTxs {
+		return nil, proofError("proof has %d admin transactions, which "+
+			"exceeds the maximum of %d", len(p.AdminTxs),
+			MaxProofAdminTxs)
+	}
+	if p.CheckpointState == nil {
+		return nil, proofError("proof has no checkpoint admin state")
+	}
+	if p.CheckpointState.Hash() != *stateHash {
+		return nil, proofError("checkpoint admin state does not match "+
+			"hash %v", stateHash)
+	}
+
+	state := p.CheckpointState.Copy()
+	prevHash := *checkpointHash
+	adminTxs := p.AdminTxs
+	for i := range p.Headers {
+		header := &p.Headers[i]
+		height := p.CheckpointHeight + uint32(i) + 1
+		if header.PrevBlock != prevHash {
+			return nil, proofError("block at height %d does not "+
+				"connect to block %v", height, prevHash)
+		}
+		if header.Height != height {
+			return nil, proofError("block at height %d has height "+
+				"%d", height, header.Height)
+		}
+
+		// Execute the admin transactions of the block in order.
+		var numTxs int
+		for ; numTxs < len(adminTxs); numTxs++ {
+			ptx := &adminTxs[numTxs]
+			if ptx.Height != height {
+				break
+			}
+			if numTxs > 0 && ptx.Index <= adminTxs[numTxs-1].Index {
+				return nil, proofError("admin transactions at "+
+					"height %d are out of order", height)
+			}
+			if err := connectProofTx(state, header, ptx); err != nil {
+				return nil, err
+			}
+		}
+		adminTxs = adminTxs[numTxs:]
+
+		if err := checkProofHeaderSigner(state, header); err != nil {
+			return nil, err
+		}
+		prevHash = header.BlockHash()
+	}
+	if len(adminTxs) > 0 {
+		return nil, proofError("admin transaction at height %d is not "+
+			"in a block of the proof", adminTxs[0].Height)
+	}
+
+	return state, nil
+}
+
+// VerifyValidateKey verifies the passed proof as described by Verify, starting
+// from the checkpoint block and the admin state with the passed hashes, and
+// returns whether the passed key is in the validate key set as of the block the
+// proof is for.
+func VerifyValidateKey(proof *Proof, checkpointHash, stateHash *chainhash.Hash,
+	pubKey *btcec.PublicKey) (bool, error) {
+
+	state, err := proof.Verify(checkpointHash, stateHash)
+	if err != nil {
+		return false, err
+	}
+	return state.KeySets[btcec.ValidateKeySet].Pos(pubKey) != -1, nil
+}
+
+// -----------------------------------------------------------------------------
+// The serialized format of a proof is:
+//
+//   Field                   Type         Size
+//   checkpoint height       uint32       4 bytes
+//   admin state length      uint32       4 bytes
+//   admin state             []byte       admin state length
+//   header count            uint32       4 bytes
+//   headers                 []header     header count * header size
+//   admin tx count          uint32       4 bytes
+//   admin txs               []ProofTx    variable
+//
+// Each admin transaction is serialized as:
+//
+//   Field                   Type         Size
+//   height                  uint32       4 bytes
+//   index                   uint32       4 bytes
+//   merkle branch length    uint8        1 byte
+//   merkle branch           []Hash       length * chainhash.HashSize
+//   transaction             MsgTx        variable
+// -----------------------------------------------------------------------------
+
+// writeUint32 writes the passed value to the passed writer.
+func writeUint32(w io.Writer, v uint32) error {
+	var buf [4]byte
+	byteOrder.PutUint32(buf[:], v)
+	_, err := w.Write(buf[:])
+	return err
+}
+
+// readUint32 reads a value from the passed reader.
+func readUint32(r io.Reader) (uint32, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+	return byteOrder.Uint32(buf[:]), nil
+}
+
+// Serialize writes the serialization of the proof to the passed writer.
+func (p *Proof) Serialize(w io.Writer) error {
+	if err := writeUint32(w, p.CheckpointHeight); err != nil {
+		return err
+	}
+	serializedState := p.CheckpointState.Serialize()
+	if err := writeUint32(w, uint32(len(serializedState))); err != nil {
+		return err
+	}
+	if _, err := w.Write(serializedState); err != nil {
+		return err
+	}
+
+	if err := writeUint32(w, uint32(len(p.Headers))); err != nil {
+		return err
+	}
+	for i := range p.Headers {
+		if err := p.Headers[i].Serialize(w); err != nil {
+			return err
+		}
+	}
+
+	if err := writeUint32(w, uint32(len(p.AdminTxs))); err != nil {
+		return err
+	}
+	for i := range p.AdminTxs {
+		ptx := &p.AdminTxs[i]
+		if err := writeUint32(w, ptx.Height); err != nil {
+			return err
+		}
+		if err := writeUint32(w, ptx.Index); err != nil {
+			return err
+		}
+		branchLen := []byte{byte(len(ptx.MerkleBranch))}
+		if _, err := w.Write(branchLen); err != nil {
+			return err
+		}
+		for j := range ptx.MerkleBranch {
+			if _, err := w.Write(ptx.MerkleBranch[j][:]); err != nil {
+				return err
+			}
+		}
+		if err := ptx.Tx.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deserialize decodes a proof from the passed reader into the receiver.  Proofs
+// which exceed the size limits of proofs are rejected with a RuleError, and
+// truncated ones with a DeserializeError.
+func (p *Proof) Deserialize(r io.Reader) error {
+	return p.DeserializeEncoding(r, 0)
+}
+
+// DeserializeEncoding decodes a proof like Deserialize, except the admin
+// transactions of the proof are decoded with the passed protocol version flags
+// of the network, such as wire.TxExpiryEncoding.
+func (p *Proof) DeserializeEncoding(r io.Reader, txEncoding uint32) error {
+	truncated := func(err error) error {
+		return DeserializeError(fmt.Sprintf("unable to deserialize "+
+			"proof: %v", err))
+	}
+
+	checkpointHeight, err := readUint32(r)
+	if err != nil {
+		return truncated(err)
+	}
+	stateLen, err := readUint32(r)
+	if err != nil {
+		return truncated(err)
+	}
+	if stateLen > maxProofStateLen {
+		return proofError("proof admin state of %d bytes exceeds the "+
+			"maximum of %d", stateLen, maxProofStateLen)
+	}
+	serializedState := make([]byte, stateLen)
+	if _, err := io.ReadFull(r, serializedState); err != nil {
+		return truncated(err)
+	}
+	state, err := Deserialize(serializedState)
+	if err != nil {
+		return err
+	}
+
+	numHeaders, err := readUint32(r)
+	if err != nil {
+		return truncated(err)
+	}
+	if numHeaders > MaxProofHeaders {
+		return proofError("proof has %d headers, which exceeds the "+
+			"maximum of %d", numHeaders, MaxProofHeaders)
+	}
+	headers := make([]wire.BlockHeader, numHeaders)
+	for i := range headers {
+		if err := headers[i].Deserialize(r); err != nil {
+			return truncated(err)
+		}
+	}
+
+	numTxs, err := readUint32(r)
+	if err != nil {
+		return truncated(err)
+	}
+	if numTxs > MaxProofAdminTxs {
+		return proofError("proof has %d admin transactions, which "+
+			"exceeds the maximum of %d", numTxs, MaxProofAdminTxs)
+	}
+	adminTxs := make([]ProofTx, numTxs)
+	for i := range adminTxs {
+		ptx := &adminTxs[i]
+		if ptx.Height, err = readUint32(r); err != nil {
+			return truncated(err)
+		}
+		if ptx.Index, err = readUint32(r); err != nil {
+			return truncated(err)
+		}
+		var branchLen [1]byte
+		if _, err := io.ReadFull(r, branchLen[:]); err != nil {
+			return truncated(err)
+		}
+		if branchLen[0] > maxMerkleBranchLen {
+			return proofError("merkle branch of length %d exceeds "+
+				"the maximum of %d", branchLen[0],
+				maxMerkleBranchLen)
+		}
+		ptx.MerkleBranch = make([]chainhash.Hash, branchLen[0])
+		for j := range ptx.MerkleBranch {
+			_, err := io.ReadFull(r, ptx.MerkleBranch[j][:])
+			if err != nil {
+				return truncated(err)
+			}
+		}
+		ptx.Tx = new(wire.MsgTx)
+		if err := ptx.Tx.BtcDecode(r, txEncoding); err != nil {
+			return truncated(err)
+		}
+	}
+
+	p.CheckpointHeight = checkpointHeight
+	p.CheckpointState = state
+	p.Headers = headers
+	p.AdminTxs = adminTxs
+	return nil
+}
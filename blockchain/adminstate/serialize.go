@@ -0,0 +1,267 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package adminstate
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// -----------------------------------------------------------------------------
+// The serialized admin state is the format the chain stores the admin state of
+// the best chain in, so the snapshot returned by the DumpAdminState method of
+// the chain can be loaded with Deserialize.
+//
+// The serialized format is:
+//
+//   Field                 Type        Size
+//   root thread tip       OutPoint    chainhash.HashSize + 4 bytes
+//   provision thread tip  OutPoint    chainhash.HashSize + 4 bytes
+//   issue thread tip      OutPoint    chainhash.HashSize + 4 bytes
+//   keyID counter         KeyID       4 bytes
+//   totalSupply           uint64      8 bytes
+//   root keys length      uint32      4 bytes
+//   root keys             []byte      root length * 33
+//   provision keys length uint32      4 bytes
+//   provision keys        []byte      provision key length * 33
+//   issue keys length     uint32      4 bytes
+//   issue keys            []byte      issue key length * 33
+//   validate keys length  uint32      4 bytes
+//   validate keys         []byte      Validate length * 33
+//   ASP keys length       uint32      4 bytes
+//   keyID / ASP keys      []pairs     Pair length * 37
+//   revoked keys length   uint32      4 bytes
+//   revoked keys          []entries   entries length * 41
+//
+// The revoked keys are only serialized when there are any, so the states of
+// chains which never revoked a keyID serialize, and hash, the same as before
+// they were added.  Each revoked key entry is the keyID, the compressed ASP
+// key it was bound to and the number of revocations as a uint32.
+// -----------------------------------------------------------------------------
+
+// byteOrder is the preferred byte order used for serializing the admin state.
+var byteOrder = binary.LittleEndian
+
+// revokedKeySize is the size of a serialized revoked key entry, which is the
+// keyID, the compressed ASP key and the number of revocations.
+const revokedKeySize = 4 + btcec.PubKeyBytesLenCompressed + 4
+
+// keySetOrder is a helper to iterate maps of key sets in order.
+var keySetOrder = []btcec.KeySetType{
+	btcec.RootKeySet,
+	btcec.ProvisionKeySet,
+	btcec.IssueKeySet,
+	btcec.ValidateKeySet,
+}
+
+// threadOrder is a helper to iterate maps of thread tips in order.
+var threadOrder = []provautil.ThreadID{
+	provautil.RootThread,
+	provautil.ProvisionThread,
+	provautil.IssueThread,
+}
+
+// Serialize returns the serialization of the admin state.  Missing thread tips
+// are serialized as zero outpoints.
+func (state *State) Serialize() []byte {
+	// Calculate the full size needed to serialize the admin state.
+	serializedLen := uint32(0)
+	// Add 3 thread tips + last keyID + total supply (uint64)
+	serializedLen += uint32(3*(chainhash.HashSize+4) + btcec.KeyIDSize + 8)
+	for _, keySet := range keySetOrder {
+		serializedLen += 4 //one uint32 for size of key set
+		serializedLen += uint32(len(state.KeySets[keySet]) * btcec.PubKeyBytesLenCompressed)
+	}
+	serializedLen += 4 + uint32(len(state.KeyIDs)*(4+btcec.PubKeyBytesLenCompressed))
+	if len(state.RevokedKeys) > 0 {
+		serializedLen += 4 + uint32(len(state.RevokedKeys)*revokedKeySize)
+	}
+	// Serialize the admin state.
+	serializedData := make([]byte, serializedLen)
+	offset := 0
+
+	// Add thread tips + counters
+	for _, threadId := range threadOrder {
+		if state.ThreadTips[threadId] != nil {
+			copy(serializedData[offset:], state.ThreadTips[threadId].Hash[:])
+		}
+		offset += chainhash.HashSize
+		if state.ThreadTips[threadId] != nil {
+			byteOrder.PutUint32(serializedData[offset:], state.ThreadTips[threadId].Index)
+		}
+		offset += 4
+	}
+	byteOrder.PutUint32(serializedData[offset:], uint32(state.LastKeyID))
+	offset += btcec.KeyIDSize
+	byteOrder.PutUint64(serializedData[offset:], state.TotalSupply)
+	offset += 8
+
+	// When iterating over a map with a range loop, the iteration order is not
+	// specified and is not guaranteed to be the same from one iteration to the
+	// next. So we use keySetOrder to do a sorted itteration.
+	for _, keySet := range keySetOrder {
+		setLength := len(state.KeySets[keySet])
+		byteOrder.PutUint32(serializedData[offset:], uint32(setLength))
+		offset += 4
+		for _, key := range state.KeySets[keySet] {
+			copy(serializedData[offset:], key.SerializeCompressed())
+			offset += btcec.PubKeyBytesLenCompressed
+		}
+	}
+	// Serialize keyID to ASP Key map
+	byteOrder.PutUint32(serializedData[offset:], uint32(len(state.KeyIDs)))
+	offset += 4
+
+	// To have a deterministic order of serialization of a map, we take all keys
+	// and sort them by keyID, then serialize in that order.
+	var keyIDs []int
+	for k := range state.KeyIDs {
+		keyIDs = append(keyIDs, int(k))
+	}
+	sort.Ints(keyIDs)
+	for _, keyID := range keyIDs {
+		pubKey := state.KeyIDs[btcec.KeyID(keyID)]
+		byteOrder.PutUint32(serializedData[offset:], uint32(keyID))
+		offset += 4
+		copy(serializedData[offset:], pubKey.SerializeCompressed())
+		offset += btcec.PubKeyBytesLenCompressed
+	}
+
+	// Serialize the revoked keys sorted by keyID as well.
+	if len(state.RevokedKeys) > 0 {
+		byteOrder.PutUint32(serializedData[offset:],
+			uint32(len(state.RevokedKeys)))
+		offset += 4
+		keyIDs = keyIDs[:0]
+		for k := range state.RevokedKeys {
+			keyIDs = append(keyIDs, int(k))
+		}
+		sort.Ints(keyIDs)
+		for _, keyID := range keyIDs {
+			revoked := state.RevokedKeys[btcec.KeyID(keyID)]
+			byteOrder.PutUint32(serializedData[offset:], uint32(keyID))
+			offset += 4
+			copy(serializedData[offset:], revoked.PubKey.SerializeCompressed())
+			offset += btcec.PubKeyBytesLenCompressed
+			byteOrder.PutUint32(serializedData[offset:], revoked.Revocations)
+			offset += 4
+		}
+	}
+	return serializedData[:]
+}
+
+// Hash returns the double sha256 hash of the serialization of the admin state,
+// which identifies the admin state the verifier of a proof trusts.
+func (state *State) Hash() chainhash.Hash {
+	return chainhash.DoubleHashH(state.Serialize())
+}
+
+// Deserialize returns the admin state of the passed serialization, such as the
+// one returned by Serialize.  A DeserializeError is returned when the passed
+// data is truncated.
+func Deserialize(serializedData []byte) (*State, error) {
+	offset := 0
+
+	// thread tips + counters length
+	lenNeeded := 3*(chainhash.HashSize+4) + btcec.KeyIDSize + 8
+	if len(serializedData[offset:]) < lenNeeded {
+		return nil, DeserializeError("corrupt admin state, thread tips " +
+			"can be read")
+	}
+
+	state := New()
+	for _, threadId := range threadOrder {
+
+		hash, _ := chainhash.NewHash(serializedData[offset : offset+chainhash.HashSize])
+		offset += chainhash.HashSize
+		index := byteOrder.Uint32(serializedData[offset : offset+4])
+		offset += 4
+		threadTip := wire.NewOutPoint(hash, index)
+		state.ThreadTips[threadId] = threadTip
+	}
+	state.LastKeyID = btcec.KeyID(byteOrder.Uint32(serializedData[offset : offset+btcec.KeyIDSize]))
+	offset += btcec.KeyIDSize
+	state.TotalSupply = byteOrder.Uint64(serializedData[offset : offset+8])
+	offset += 8
+
+	for _, keySet := range keySetOrder {
+		// Ensure the serialized data has enough bytes to read length of a set.
+		if len(serializedData[offset:]) < 4 {
+			return nil, DeserializeError("corrupt admin state, no keys " +
+				"can be read")
+		}
+		keySetLength := byteOrder.Uint32(serializedData[offset : offset+4])
+		offset += 4
+		// Ensure the serialized data has enough bytes to deserialize the keys.
+		if uint32(len(serializedData[offset:])) < keySetLength*btcec.PubKeyBytesLenCompressed {
+			return nil, DeserializeError("corrupt admin state, not all " +
+				"keys can be read")
+		}
+		state.KeySets[keySet] = make([]btcec.PublicKey, keySetLength)
+		for i := 0; i < int(keySetLength); i++ {
+			pubKey, _ := btcec.ParsePubKey(
+				serializedData[offset:offset+btcec.PubKeyBytesLenCompressed], btcec.S256())
+			state.KeySets[keySet][i] = *pubKey
+			offset += btcec.PubKeyBytesLenCompressed
+		}
+	}
+
+	// Ensure the serialized data has enough bytes to read length of the map.
+	if len(serializedData[offset:]) < 4 {
+		return nil, DeserializeError("corrupt admin state, no keyIDs can " +
+			"be read")
+	}
+	// Deserialize keyIDs
+	keyIdMapLen := byteOrder.Uint32(serializedData[offset : offset+4])
+	offset += 4
+	// Ensure the serialized data has enough bytes to deserialize the keys
+	if uint32(len(serializedData[offset:])) < keyIdMapLen*(4+btcec.PubKeyBytesLenCompressed) {
+		return nil, DeserializeError("corrupt admin state, not all keyIDs " +
+			"can be read")
+	}
+	for i := 0; i < int(keyIdMapLen); i++ {
+		keyID := btcec.KeyID(byteOrder.Uint32(serializedData[offset : offset+4]))
+		offset += 4
+		pubKey, _ := btcec.ParsePubKey(
+			serializedData[offset:offset+btcec.PubKeyBytesLenCompressed], btcec.S256())
+		offset += btcec.PubKeyBytesLenCompressed
+		state.KeyIDs[keyID] = pubKey
+	}
+
+	// The revoked keys are absent when there are none.
+	if len(serializedData[offset:]) == 0 {
+		return state, nil
+	}
+	if len(serializedData[offset:]) < 4 {
+		return nil, DeserializeError("corrupt admin state, no revoked " +
+			"keys can be read")
+	}
+	revokedLen := byteOrder.Uint32(serializedData[offset : offset+4])
+	offset += 4
+	if uint32(len(serializedData[offset:])) < revokedLen*revokedKeySize {
+		return nil, DeserializeError("corrupt admin state, not all " +
+			"revoked keys can be read")
+	}
+	for i := 0; i < int(revokedLen); i++ {
+		keyID := btcec.KeyID(byteOrder.Uint32(serializedData[offset : offset+4]))
+		offset += 4
+		pubKey, _ := btcec.ParsePubKey(
+			serializedData[offset:offset+btcec.PubKeyBytesLenCompressed], btcec.S256())
+		offset += btcec.PubKeyBytesLenCompressed
+		revocations := byteOrder.Uint32(serializedData[offset : offset+4])
+		offset += 4
+		state.RevokedKeys[keyID] = RevokedKey{
+			PubKey:      pubKey,
+			Revocations: revocations,
+		}
+	}
+
+	return state, nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package adminstate_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain/adminstate"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestSerialize ensures the admin state serializes and deserializes to the
+// same state and that truncated serializations are rejected.
+func TestSerialize(t *testing.T) {
+	pubKey := testPubKey()
+	state := adminstate.New()
+	state.ThreadTips[provautil.RootThread] = wire.NewOutPoint(
+		&chainhash.Hash{0x01}, 0)
+	state.ThreadTips[provautil.ProvisionThread] = wire.NewOutPoint(
+		&chainhash.Hash{0x02}, 1)
+	state.ThreadTips[provautil.IssueThread] = wire.NewOutPoint(
+		&chainhash.Hash{0x03}, 2)
+	state.LastKeyID = btcec.KeyID(7)
+	state.TotalSupply = 12345
+	state.KeySets[btcec.RootKeySet] = btcec.PublicKeySet{*pubKey}
+	state.KeySets[btcec.ProvisionKeySet] = btcec.PublicKeySet{}
+	state.KeySets[btcec.IssueKeySet] = btcec.PublicKeySet{}
+	state.KeySets[btcec.ValidateKeySet] = btcec.PublicKeySet{*pubKey}
+	state.KeyIDs[btcec.KeyID(7)] = pubKey
+
+	serialized := state.Serialize()
+	got, err := adminstate.Deserialize(serialized)
+	if err != nil {
+		t.Fatalf("Deserialize: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, state) {
+		t.Fatalf("got state %+v, want %+v", got, state)
+	}
+
+	for _, size := range []int{0, 40, len(serialized) - 1} {
+		_, err := adminstate.Deserialize(serialized[:size])
+		if _, ok := err.(adminstate.DeserializeError); !ok {
+			t.Errorf("Deserialize (%d bytes): got error %v, want "+
+				"DeserializeError", size, err)
+		}
+	}
+
+	// The revoked keys follow the keyIDs, so the serialization without
+	// them is the serialization of the state before a keyID was revoked.
+	legacy := state.Copy()
+	state.RevokedKeys[btcec.KeyID(3)] = adminstate.RevokedKey{
+		PubKey:      pubKey,
+		Revocations: 2,
+	}
+	withRevoked := state.Serialize()
+	got, err = adminstate.Deserialize(withRevoked)
+	if err != nil {
+		t.Fatalf("Deserialize: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, state) {
+		t.Fatalf("got state %+v, want %+v", got, state)
+	}
+	got, err = adminstate.Deserialize(withRevoked[:len(serialized)])
+	if err != nil {
+		t.Fatalf("Deserialize: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, legacy) {
+		t.Fatalf("got state %+v, want %+v", got, legacy)
+	}
+	for _, size := range []int{len(serialized) + 2, len(withRevoked) - 1} {
+		_, err := adminstate.Deserialize(withRevoked[:size])
+		if _, ok := err.(adminstate.DeserializeError); !ok {
+			t.Errorf("Deserialize (%d bytes): got error %v, want "+
+				"DeserializeError", size, err)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package adminstate
+
+import (
+	"bytes"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// RevokedKey is the ASP key a revoked keyID was bound to, along with the number
+// of times the keyID has been revoked.  The count tells whether undoing a
+// revocation also undoes the first one, after which the keyID was never
+// revoked.
+type RevokedKey struct {
+	PubKey      *btcec.PublicKey
+	Revocations uint32
+}
+
+// State houses the admin state of the chain at a specific point, which is the
+// tips of the admin threads, the admin key sets, the ASP keyIDs, the ASP keys
+// of the keyIDs which have been revoked and the total supply.
+type State struct {
+	ThreadTips  map[provautil.ThreadID]*wire.OutPoint
+	LastKeyID   btcec.KeyID
+	TotalSupply uint64
+	KeySets     map[btcec.KeySetType]btcec.PublicKeySet
+	KeyIDs      btcec.KeyIdMap
+	RevokedKeys map[btcec.KeyID]RevokedKey
+}
+
+// New returns a new empty admin state.
+func New() *State {
+	return &State{
+		ThreadTips:  make(map[provautil.ThreadID]*wire.OutPoint),
+		LastKeyID:   btcec.KeyID(0),
+		TotalSupply: uint64(0),
+		KeySets:     make(map[btcec.KeySetType]btcec.PublicKeySet),
+		KeyIDs:      make(map[btcec.KeyID]*btcec.PublicKey),
+		RevokedKeys: make(map[btcec.KeyID]RevokedKey),
+	}
+}
+
+// CopyRevokedKeys returns a copy of the passed revoked keys, which is empty
+// rather than nil when there are none.
+func CopyRevokedKeys(revokedKeys map[btcec.KeyID]RevokedKey) map[btcec.KeyID]RevokedKey {
+	revokedCopy := make(map[btcec.KeyID]RevokedKey, len(revokedKeys))
+	for keyID, revoked := range revokedKeys {
+		revokedCopy[keyID] = revoked
+	}
+	return revokedCopy
+}
+
+// Copy returns a deep copy of the admin state, so modification of the copy
+// does not affect the source state.
+func (state *State) Copy() *State {
+	return &State{
+		ThreadTips:  provautil.CopyThreadTips(state.ThreadTips),
+		LastKeyID:   state.LastKeyID,
+		TotalSupply: state.TotalSupply,
+		KeySets:     btcec.DeepCopy(state.KeySets),
+		KeyIDs:      state.KeyIDs.DeepCopy(),
+		RevokedKeys: CopyRevokedKeys(state.RevokedKeys),
+	}
+}
+
+// applyAdminOp takes a single admin op and applies it to the state.
+func (state *State) applyAdminOp(isAddOp bool,
+	keySetType btcec.KeySetType, pubKey *btcec.PublicKey, keyID btcec.KeyID) {
+	if keySetType == btcec.ASPKeySet {
+		if isAddOp {
+			// Provisioning a revoked keyID again leaves the keyID
+			// counter as it is.
+			state.KeyIDs[keyID] = pubKey
+			if keyID > state.LastKeyID {
+				state.LastKeyID = keyID
+			}
+		} else {
+			delete(state.KeyIDs, keyID)
+			if state.RevokedKeys == nil {
+				state.RevokedKeys = make(map[btcec.KeyID]RevokedKey)
+			}
+			revoked := state.RevokedKeys[keyID]
+			revoked.PubKey = pubKey
+			revoked.Revocations++
+			state.RevokedKeys[keyID] = revoked
+		}
+	} else {
+		if isAddOp {
+			state.KeySets[keySetType] = state.KeySets[keySetType].Add(pubKey)
+		} else {
+			pos := state.KeySets[keySetType].Pos(pubKey)
+			state.KeySets[keySetType] = state.KeySets[keySetType].Remove(pos)
+		}
+	}
+}
+
+// Next returns the admin state which results from executing the admin
+// operations of the passed transaction on the state.  The state is not
+// modified.  When the transaction is not an admin transaction, the state itself
+// is returned.
+//
+// NOTE: The transaction MUST have already been validated against the state
+// with the CheckTransactionOutputs function prior to calling this function.
+func (state *State) Next(tx *provautil.Tx) *State {
+	threadInt, _ := txscript.GetAdminDetails(tx)
+	if threadInt < 0 {
+		// not admin transaction
+		return state
+	}
+	next := state.Copy()
+	next.ConnectTransaction(tx)
+	return next
+}
+
+// ConnectTransaction executes the admin operations of the passed transaction
+// on the state.  Transactions which are not admin transactions leave the state
+// unchanged.
+//
+// NOTE: The transaction MUST have already been validated against the state
+// with the CheckTransactionOutputs function prior to calling this function.
+func (state *State) ConnectTransaction(tx *provautil.Tx) {
+	threadInt, adminOutputs := txscript.GetAdminDetails(tx)
+	if threadInt < 0 {
+		// not admin transaction
+		return
+	}
+	threadID := provautil.ThreadID(threadInt)
+	if threadID == provautil.IssueThread {
+		isDestruction := len(tx.MsgTx().TxIn) > 1
+		if isDestruction {
+			// if this is a destruction operation
+			// look over all non-prova outputs and sum them up.
+			for i := 0; i < len(adminOutputs); i++ {
+				// if this output pk script is a NullDataTy, then,
+				// according to previous validation, it must be
+				// admin operation (destruction)
+				scriptType := txscript.TypeOfScript(adminOutputs[i])
+				if scriptType == txscript.NullDataTy {
+					state.TotalSupply -= uint64(tx.MsgTx().TxOut[i+1].Value)
+				}
+			}
+		} else {
+			// if it is an issuance operation, look over all but first
+			// output and sum up values.
+			// remember that a issuing transaction is not allow to also
+			// destroy, as to previous validation.
+			for i := 1; i < len(tx.MsgTx().TxOut); i++ {
+				state.TotalSupply += uint64(tx.MsgTx().TxOut[i].Value)
+			}
+		}
+	} else {
+		for i := 0; i < len(adminOutputs); i++ {
+			// Ops reserved for later soft forks don't change the
+			// state.
+			if txscript.IsUpgradableAdminOp(adminOutputs[i]) {
+				continue
+			}
+			isAddOp, keySetType, pubKey,
+				keyID := txscript.ExtractAdminOpData(adminOutputs[i])
+			state.applyAdminOp(isAddOp, keySetType, pubKey, keyID)
+		}
+	}
+	// this becomes the new tip of the admin thread
+	state.ThreadTips[threadID] = wire.NewOutPoint(tx.Hash(), 0)
+}
+
+// DisconnectTransaction undoes the admin operations of the passed transaction
+// on the state, which must be the state the transaction was connected to last.
+// Transactions which are not admin transactions leave the state unchanged.
+func (state *State) DisconnectTransaction(tx *provautil.Tx) {
+	threadInt, adminOutputs := txscript.GetAdminDetails(tx)
+	if threadInt < int(provautil.RootThread) {
+		return
+	}
+	threadId := provautil.ThreadID(threadInt)
+	if threadId == provautil.IssueThread {
+		isDestruction := len(tx.MsgTx().TxIn) > 1
+		if isDestruction {
+			for i := 0; i < len(adminOutputs); i++ {
+				// if this output pk script is a NullDataTy, then,
+				// according to previous validation, it must be
+				// admin operation (destruction)
+				scriptType := txscript.TypeOfScript(adminOutputs[i])
+				if scriptType == txscript.NullDataTy {
+					state.TotalSupply += uint64(tx.MsgTx().TxOut[i+1].Value)
+				}
+			}
+		} else {
+			for i := 1; i < len(tx.MsgTx().TxOut); i++ {
+				state.TotalSupply -= uint64(tx.MsgTx().TxOut[i].Value)
+			}
+		}
+	} else {
+		for i := 0; i < len(adminOutputs); i++ {
+			if txscript.IsUpgradableAdminOp(adminOutputs[i]) {
+				continue
+			}
+			isAddOp, keySetType, pubKey,
+				keyID := txscript.ExtractAdminOpData(adminOutputs[i])
+			if keySetType == btcec.ASPKeySet {
+				if isAddOp {
+					delete(state.KeyIDs, keyID)
+					// decrease lastKeyID counter, if an Add OP is
+					// disconnected, unless it provisioned a revoked
+					// keyID again.
+					if _, ok := state.RevokedKeys[keyID]; !ok {
+						state.LastKeyID = keyID - 1
+					}
+				} else {
+					// do not increase lastKeyID if Revoke Op is disconnected.
+					// once used keyIds should stay used
+					state.KeyIDs[keyID] = pubKey
+					revoked, ok := state.RevokedKeys[keyID]
+					if ok && revoked.Revocations > 1 {
+						revoked.Revocations--
+						state.RevokedKeys[keyID] = revoked
+					} else {
+						delete(state.RevokedKeys, keyID)
+					}
+				}
+			} else {
+				// isAddOp is negatted, to revert the action
+				state.applyAdminOp(!isAddOp, keySetType, pubKey, keyID)
+			}
+		}
+	}
+	// when an admin thread transaction is disconnected
+	// we set the spent tx as new tip.
+	state.ThreadTips[threadId] = &tx.MsgTx().TxIn[0].PreviousOutPoint
+}
+
+// AdminKeyHashes returns the pubKeyHashes of the admin keys of the passed
+// thread.
+func (state *State) AdminKeyHashes(threadID provautil.ThreadID) [][]byte {
+	pubs := state.KeySets[btcec.KeySetType(threadID)]
+	hashes := make([][]byte, len(pubs))
+	for i, pubKey := range pubs {
+		hashes[i] = provautil.Hash160(pubKey.SerializeCompressed())
+	}
+	return hashes
+}
+
+// LookupKeyIDs returns the pubKeyHashes of the ASP keys of the passed keyIDs.
+// KeyIDs which are not provisioned map to a zero hash.
+func (state *State) LookupKeyIDs(keyIDs []btcec.KeyID) map[btcec.KeyID][]byte {
+	keyIdMap := make(map[btcec.KeyID][]byte)
+	for _, keyID := range keyIDs {
+		pubKey := state.KeyIDs[keyID]
+		if pubKey != nil {
+			keyIdMap[keyID] = provautil.Hash160(pubKey.SerializeCompressed())
+		} else {
+			keyIdMap[keyID] = bytes.Repeat([]byte{0x00}, 20)
+		}
+	}
+	return keyIdMap
+}
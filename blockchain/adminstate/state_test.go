@@ -0,0 +1,230 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package adminstate_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain/adminstate"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// testPubKey returns the public key of the private key
+// 2b8c52b77b327c755b9b375500d3f4b2da9b0a1ff65f6891d311fe94295bc26a.
+func testPubKey() *btcec.PublicKey {
+	_, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), []byte{
+		0x2b, 0x8c, 0x52, 0xb7, 0x7b, 0x32, 0x7c, 0x75,
+		0x5b, 0x9b, 0x37, 0x55, 0x00, 0xd3, 0xf4, 0xb2,
+		0xda, 0x9b, 0x0a, 0x1f, 0xf6, 0x5f, 0x68, 0x91,
+		0xd3, 0x11, 0xfe, 0x94, 0x29, 0x5b, 0xc2, 0x6a,
+	})
+	return pubKey
+}
+
+// adminOpTxOut returns an output performing the passed admin operation on the
+// passed key.  The keyID is only included for operations on ASP keys.
+func adminOpTxOut(t *testing.T, op byte, pubKey *btcec.PublicKey,
+	keyID btcec.KeyID) *wire.TxOut {
+
+	data := make([]byte, 1+btcec.PubKeyBytesLenCompressed)
+	data[0] = op
+	copy(data[1:], pubKey.SerializeCompressed())
+	if op == txscript.AdminOpASPKeyAdd || op == txscript.AdminOpASPKeyRevoke {
+		keyIDBytes := make([]byte, btcec.KeyIDSize)
+		keyID.ToAddressFormat(keyIDBytes)
+		data = append(data, keyIDBytes...)
+	}
+	pkScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_RETURN).
+		AddData(data).Script()
+	if err != nil {
+		t.Fatalf("NewScriptBuilder: unexpected error: %v", err)
+	}
+	return &wire.TxOut{Value: 0, PkScript: pkScript}
+}
+
+// rootTx returns a root thread transaction spending the passed thread tip
+// with the passed admin operation outputs.
+func rootTx(t *testing.T, tip *wire.OutPoint, ops ...*wire.TxOut) *provautil.Tx {
+	threadScript, err := txscript.ProvaThreadScript(provautil.RootThread)
+	if err != nil {
+		t.Fatalf("ProvaThreadScript: unexpected error: %v", err)
+	}
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(tip, nil))
+	msgTx.AddTxOut(wire.NewTxOut(0, threadScript))
+	for _, op := range ops {
+		msgTx.AddTxOut(op)
+	}
+	return provautil.NewTx(msgTx)
+}
+
+// TestStateTransitions ensures admin transactions are validated against the
+// admin state, that the next state reflects their admin operations without
+// modifying the source state, and that disconnecting them restores the source
+// state.
+func TestStateTransitions(t *testing.T) {
+	pubKey := testPubKey()
+	tip := wire.NewOutPoint(&chainhash.Hash{0x01}, 0)
+	state := adminstate.New()
+	state.ThreadTips[provautil.RootThread] = tip
+	state.LastKeyID = btcec.KeyID(1)
+	source := state.Copy()
+
+	tx := rootTx(t, tip,
+		adminOpTxOut(t, txscript.AdminOpProvisionKeyAdd, pubKey, 0),
+		adminOpTxOut(t, txscript.AdminOpASPKeyAdd, pubKey, 2))
+	if err := adminstate.CheckTransactionOutputs(tx, state); err != nil {
+		t.Fatalf("CheckTransactionOutputs: unexpected error: %v", err)
+	}
+
+	next := state.Next(tx)
+	if !reflect.DeepEqual(state, source) {
+		t.Fatalf("Next modified the source state")
+	}
+	provisionKeys := next.KeySets[btcec.ProvisionKeySet]
+	if len(provisionKeys) != 1 || !provisionKeys[0].IsEqual(pubKey) {
+		t.Fatalf("unexpected provision keys %v", provisionKeys)
+	}
+	if next.KeyIDs[2] == nil || !next.KeyIDs[2].IsEqual(pubKey) ||
+		next.LastKeyID != 2 {
+
+		t.Fatalf("unexpected keyIDs %v with last keyID %d", next.KeyIDs,
+			next.LastKeyID)
+	}
+	wantTip := wire.NewOutPoint(tx.Hash(), 0)
+	if *next.ThreadTips[provautil.RootThread] != *wantTip {
+		t.Fatalf("got root thread tip %v, want %v",
+			next.ThreadTips[provautil.RootThread], wantTip)
+	}
+
+	// Adding the same key again is rejected by the next state.
+	again := rootTx(t, wantTip,
+		adminOpTxOut(t, txscript.AdminOpProvisionKeyAdd, pubKey, 0))
+	err := adminstate.CheckTransactionOutputs(again, next)
+	rerr, ok := err.(adminstate.RuleError)
+	if !ok || rerr.ErrorCode != adminstate.ErrInvalidAdminOp {
+		t.Fatalf("CheckTransactionOutputs: got %v, want %v", err,
+			adminstate.ErrInvalidAdminOp)
+	}
+
+	// Transactions which are not admin transactions leave the state
+	// unchanged.
+	payTx := wire.NewMsgTx(wire.TxVersion)
+	payTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{0x02}, 0),
+		nil))
+	if got := next.Next(provautil.NewTx(payTx)); got != next {
+		t.Fatalf("Next returned a new state for a non-admin transaction")
+	}
+
+	// Disconnecting the transaction restores the source state.
+	next.DisconnectTransaction(tx)
+	next.KeySets[btcec.ProvisionKeySet] = nil
+	source.KeySets[btcec.ProvisionKeySet] = nil
+	if !reflect.DeepEqual(next, source) {
+		t.Fatalf("got state %+v after disconnect, want %+v", next,
+			source)
+	}
+}
+
+// TestKeyIDReuse ensures a revoked keyID can only be provisioned again to the
+// ASP key it was bound to, and that disconnecting the revocations and the
+// provisioning restores the states before them.
+func TestKeyIDReuse(t *testing.T) {
+	pubKey := testPubKey()
+	_, otherKey := btcec.PrivKeyFromBytes(btcec.S256(), []byte{0x01})
+	tip := wire.NewOutPoint(&chainhash.Hash{0x01}, 0)
+	state := adminstate.New()
+	state.ThreadTips[provautil.RootThread] = tip
+	state.LastKeyID = btcec.KeyID(2)
+	state.KeyIDs[2] = pubKey
+
+	// connect validates the passed transaction against the passed state
+	// and returns the next state.
+	connect := func(state *adminstate.State, tx *provautil.Tx) *adminstate.State {
+		if err := adminstate.CheckTransactionOutputs(tx, state); err != nil {
+			t.Fatalf("CheckTransactionOutputs: unexpected error: %v",
+				err)
+		}
+		return state.Next(tx)
+	}
+	// reject ensures the passed transaction is rejected by the passed
+	// state with the passed error code.
+	reject := func(state *adminstate.State, tx *provautil.Tx, code adminstate.ErrorCode) {
+		err := adminstate.CheckTransactionOutputs(tx, state)
+		rerr, ok := err.(adminstate.RuleError)
+		if !ok || rerr.ErrorCode != code {
+			t.Fatalf("CheckTransactionOutputs: got %v, want %v", err,
+				code)
+		}
+	}
+
+	revokeTx := rootTx(t, tip,
+		adminOpTxOut(t, txscript.AdminOpASPKeyRevoke, pubKey, 2))
+	revoked := connect(state, revokeTx)
+	want := adminstate.RevokedKey{PubKey: pubKey, Revocations: 1}
+	if revoked.KeyIDs[2] != nil || revoked.LastKeyID != 2 ||
+		!reflect.DeepEqual(revoked.RevokedKeys[2], want) {
+
+		t.Fatalf("unexpected keyIDs %v with last keyID %d and revoked "+
+			"keys %v", revoked.KeyIDs, revoked.LastKeyID,
+			revoked.RevokedKeys)
+	}
+
+	// The keyID can't be provisioned to another key, nor to its own key
+	// twice in one transaction.
+	tip = revoked.ThreadTips[provautil.RootThread]
+	reject(revoked, rootTx(t, tip,
+		adminOpTxOut(t, txscript.AdminOpASPKeyAdd, otherKey, 2)),
+		adminstate.ErrKeyIDReuse)
+	reject(revoked, rootTx(t, tip,
+		adminOpTxOut(t, txscript.AdminOpASPKeyAdd, pubKey, 2),
+		adminOpTxOut(t, txscript.AdminOpASPKeyAdd, pubKey, 2)),
+		adminstate.ErrInvalidAdminOp)
+
+	// Provisioning it to its own key again leaves the keyID counter as it
+	// is, so the next new keyID still follows the last one.
+	readdTx := rootTx(t, tip,
+		adminOpTxOut(t, txscript.AdminOpASPKeyAdd, pubKey, 2),
+		adminOpTxOut(t, txscript.AdminOpASPKeyAdd, otherKey, 3))
+	readded := connect(revoked, readdTx)
+	if !readded.KeyIDs[2].IsEqual(pubKey) ||
+		!readded.KeyIDs[3].IsEqual(otherKey) || readded.LastKeyID != 3 {
+
+		t.Fatalf("unexpected keyIDs %v with last keyID %d",
+			readded.KeyIDs, readded.LastKeyID)
+	}
+
+	// Revoking it again counts the second revocation.
+	tip = readded.ThreadTips[provautil.RootThread]
+	revokeAgainTx := rootTx(t, tip,
+		adminOpTxOut(t, txscript.AdminOpASPKeyRevoke, pubKey, 2))
+	revokedAgain := connect(readded, revokeAgainTx)
+	want.Revocations = 2
+	if !reflect.DeepEqual(revokedAgain.RevokedKeys[2], want) {
+		t.Fatalf("got revoked key %+v, want %+v",
+			revokedAgain.RevokedKeys[2], want)
+	}
+
+	// Disconnecting the transactions restores each state before them.
+	for _, test := range []struct {
+		tx   *provautil.Tx
+		want *adminstate.State
+	}{
+		{revokeAgainTx, readded},
+		{readdTx, revoked},
+		{revokeTx, state},
+	} {
+		revokedAgain.DisconnectTransaction(test.tx)
+		if !reflect.DeepEqual(revokedAgain, test.want) {
+			t.Fatalf("got state %+v after disconnect, want %+v",
+				revokedAgain, test.want)
+		}
+	}
+}
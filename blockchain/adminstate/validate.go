@@ -0,0 +1,218 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package adminstate
+
+import (
+	"fmt"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+)
+
+const (
+	// MaxKeySetSize sets a limit for the size of admin key sets.  When
+	// admin transactions are validated, the pubKeyScript is generated from
+	// all active keys of that thread.  The limit is needed to not exceed
+	// pubKeyScript size limits.
+	MaxKeySetSize = 42
+
+	// MinValidateKeySetSize is the least amount of validators needed to run
+	// the chain.  Rate Limiting for validators should not conflict with
+	// this.
+	MinValidateKeySetSize = 4
+)
+
+// CheckProvaOutput checks that all keyIDs in the pkScript are known in the
+// passed admin state.
+//
+// NOTE: The passed output MUST have already been sanity checked prior to
+// calling this function.
+func CheckProvaOutput(tx *provautil.Tx, txOutIndex int, keyIDs []btcec.KeyID,
+	state *State) error {
+	for _, keyID := range keyIDs {
+		if state.KeyIDs[keyID] == nil {
+			str := fmt.Sprintf("transaction %v output %v has unknown "+
+				"keyID %v.", tx.Hash(), txOutIndex, keyID)
+			return ruleError(ErrInvalidTx, str)
+		}
+	}
+	return nil
+}
+
+// CheckTransactionOutputs performs a series of checks on the outputs to ensure
+// that they are valid in the context of the passed admin state.  Admin
+// transactions are checked to only contain admin operations which are valid
+// given the state.  A revoked keyID may be provisioned again, but only to the
+// ASP key it was bound to, and whether that is allowed at all depends on the
+// chain parameters.  Outputs of other transactions which carry a script version
+// are not checked since they have no keyIDs, and whether they are allowed at all
+// depends on the chain parameters.  A RuleError is returned when a rule is
+// violated.
+//
+// NOTE: The transaction MUST have already been sanity checked prior to calling
+// this function.
+func CheckTransactionOutputs(tx *provautil.Tx, state *State) error {
+	threadInt, adminOutputs := txscript.GetAdminDetails(tx)
+	hasAdminOut := (threadInt >= 0)
+	if !hasAdminOut {
+		// When not an admin transaction, all outputs should be
+		// Prova type spending to active keyIDs. An exception is made
+		// for coinbase txs which may have null data outputs.
+		hasNullDataOutput := false
+		for i, txOut := range tx.MsgTx().TxOut {
+			output, err := txscript.ParseScript(txOut.PkScript)
+			if err != nil {
+				return ruleError(ErrInvalidTx, fmt.Sprintf("%v", err))
+			}
+			scriptClass := txscript.TypeOfScript(output)
+			if txOut.Value == 0 && scriptClass == txscript.NullDataTy {
+				if !hasNullDataOutput {
+					hasNullDataOutput = true
+				} else {
+					str := fmt.Sprintf("nullData output at index %d"+
+						" exceeds nulldata output count limit", i)
+					return ruleError(ErrInvalidTx, str)
+				}
+				continue
+			}
+			if txscript.ScriptVersion(txOut.PkScript) !=
+				txscript.DefaultScriptVersion {
+
+				continue
+			}
+			keyIDs, err := txscript.ExtractKeyIDs(output)
+			if err != nil {
+				return ruleError(ErrInvalidTx, fmt.Sprintf("%v", err))
+			}
+			err = CheckProvaOutput(tx, i, keyIDs, state)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	threadId := provautil.ThreadID(threadInt)
+	if threadId == provautil.IssueThread {
+		for i, output := range adminOutputs {
+			if len(output) > 2 {
+				keyIDs, err := txscript.ExtractKeyIDs(output)
+				if err != nil {
+					return ruleError(ErrInvalidTx, fmt.Sprintf("%v", err))
+				}
+				// +1 here, because first out was thread output,
+				// which is not contained in adminOutputs.
+				err = CheckProvaOutput(tx, i+1, keyIDs, state)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	// lastKeyId is a counter to validate intra-tx state changes
+	// lastKeyId verifies that add operations are strictly increasing
+	lastKeyId := state.LastKeyID
+	// revokedMap is holding intra-tx state changes
+	// revokedMap prevents 2 operations on the same keyID in one tx
+	revokedMap := make(map[btcec.KeyID]bool)
+	for i := 0; i < len(adminOutputs); i++ {
+		// Ops reserved for later soft forks don't change the state.
+		if txscript.IsUpgradableAdminOp(adminOutputs[i]) {
+			continue
+		}
+		isAddOp, keySetType, pubKey,
+			keyID := txscript.ExtractAdminOpData(adminOutputs[i])
+		if keySetType == btcec.ASPKeySet {
+			// TODO(prova): check pubKey collisions
+			if isAddOp {
+				if state.KeyIDs[keyID] != nil {
+					str := fmt.Sprintf("keyID %v added in transaction %v "+
+						"exists already in admin set. Operation "+
+						"rejected.", keyID, tx.Hash())
+					return ruleError(ErrInvalidAdminOp, str)
+				}
+				// A revoked keyID may only be provisioned again to
+				// the ASP key it was bound to, so outputs which
+				// referenced the keyID keep referring to that key.
+				if revoked, ok := state.RevokedKeys[keyID]; ok {
+					if !revoked.PubKey.IsEqual(pubKey) {
+						str := fmt.Sprintf("keyID %v added in "+
+							"transaction %v was revoked and can "+
+							"only be provisioned again to the "+
+							"key it was bound to.", keyID,
+							tx.Hash())
+						return ruleError(ErrKeyIDReuse, str)
+					}
+					if revokedMap[keyID] {
+						str := fmt.Sprintf("keyID %v is "+
+							"provisioned again more than once "+
+							"in transaction %v.", keyID,
+							tx.Hash())
+						return ruleError(ErrInvalidAdminOp, str)
+					}
+					revokedMap[keyID] = true
+					continue
+				}
+				lastKeyId++
+				if keyID != lastKeyId {
+					str := fmt.Sprintf("keyID %v added in transaction %v "+
+						"rejected. should be %v ", keyID, tx.Hash(), state.LastKeyID+1)
+					return ruleError(ErrInvalidAdminOp, str)
+				}
+			} else {
+				if state.KeyIDs[keyID] == nil || revokedMap[keyID] {
+					str := fmt.Sprintf("keyID %v can not be revoked in "+
+						"transaction %v. It does not exist in admin set.",
+						keyID, tx.Hash())
+					return ruleError(ErrInvalidAdminOp, str)
+				}
+				if !state.KeyIDs[keyID].IsEqual(pubKey) {
+					str := fmt.Sprintf("pubKey %v can not be revoked in "+
+						"transaction %v. It does not match admin state.",
+						pubKey.SerializeCompressed(), tx.Hash())
+					return ruleError(ErrInvalidAdminOp, str)
+				}
+				revokedMap[keyID] = true
+			}
+		} else {
+			keySet := state.KeySets[keySetType]
+			pos := keySet.Pos(pubKey)
+			if isAddOp {
+				if pos >= 0 {
+					str := fmt.Sprintf("key added in transaction %v "+
+						"exists already in admin set at position %v. "+
+						"Operation rejected.", tx.Hash(), pos)
+					return ruleError(ErrInvalidAdminOp, str)
+				}
+				if len(keySet) >= MaxKeySetSize {
+					str := fmt.Sprintf("admin transaction %v tries to add "+
+						"key to admin key set. Yet the set has reached max "+
+						"size %v.", tx.Hash(), len(keySet))
+					return ruleError(ErrInvalidAdminOp, str)
+				}
+			} else {
+				if pos == -1 {
+					str := fmt.Sprintf("admin transaction %v tries to remove "+
+						"non-existing key %v. ", tx.Hash(), pubKey)
+					return ruleError(ErrInvalidAdminOp, str)
+				}
+				// minLen describes the min amount of active admin keys
+				// to keep in a set. This seems only critical for root keys,
+				minLen := 0 // but root key set is fixed.
+				if keySetType == btcec.ValidateKeySet {
+					minLen = MinValidateKeySetSize
+				}
+				if len(keySet) <= minLen {
+					str := fmt.Sprintf("admin transaction %v tries to remove "+
+						"key from admin key set with length 2. At least 2 keys "+
+						"have to stay provisioned.", tx.Hash())
+					return ruleError(ErrInvalidAdminOp, str)
+				}
+			}
+		}
+	}
+	return nil
+}
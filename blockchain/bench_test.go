@@ -6,9 +6,13 @@
 package blockchain_test
 
 import (
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/chaingen"
+	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/provautil"
 )
 
@@ -31,3 +35,146 @@ func BenchmarkIsCoinBaseTx(b *testing.B) {
 		blockchain.IsCoinBaseTx(tx)
 	}
 }
+
+// benchGenParams are the chain parameters of the chains generated for the
+// benchmarks.  Coinbases mature right away so the blocks are full from the
+// start.
+var benchGenParams = func() chaincfg.Params {
+	params := chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	return params
+}()
+
+// benchGenChain is a chain generated by the chaingen package for a benchmark.
+// It is only generated once.
+type benchGenChain struct {
+	once   sync.Once
+	blocks []*chaingen.Block
+	err    error
+}
+
+// generate returns the blocks of the chain described by the passed config,
+// generating them on the first call.
+func (c *benchGenChain) generate(cfg *chaingen.Config) ([]*chaingen.Block, error) {
+	c.once.Do(func() {
+		c.err = chaingen.Generate(cfg, func(block *chaingen.Block) error {
+			c.blocks = append(c.blocks, block)
+			return nil
+		})
+	})
+	return c.blocks, c.err
+}
+
+// copyGenBlocks returns copies of the passed blocks so no results are cached
+// between iterations of a benchmark.
+func copyGenBlocks(blocks []*chaingen.Block) []*chaingen.Block {
+	blocksCopy := make([]*chaingen.Block, 0, len(blocks))
+	for _, block := range blocks {
+		msgBlockCopy := *block.MsgBlock()
+		blockCopy := *block
+		blockCopy.Block = provautil.NewBlock(&msgBlockCopy)
+		blocksCopy = append(blocksCopy, &blockCopy)
+	}
+	return blocksCopy
+}
+
+var (
+	// ibdChain is the chain processed by BenchmarkInitialBlockDownload.
+	ibdChain benchGenChain
+
+	// reorgChain is the chain processed by BenchmarkReorganize.
+	reorgChain benchGenChain
+)
+
+// BenchmarkInitialBlockDownload measures the number of blocks per second
+// processed when syncing a generated chain of 5000 blocks, or 200 blocks in
+// short mode, with transactions fanning out to multiple outputs and regular
+// admin transactions.
+func BenchmarkInitialBlockDownload(b *testing.B) {
+	numBlocks := uint32(5000)
+	if testing.Short() {
+		numBlocks = 200
+	}
+	blocks, err := ibdChain.generate(&chaingen.Config{
+		Params:        &benchGenParams,
+		NumBlocks:     numBlocks,
+		TxPerBlock:    20,
+		OutputsPerTx:  2,
+		AdminInterval: 50,
+	})
+	if err != nil {
+		b.Fatalf("Generate: unexpected error: %v", err)
+	}
+
+	var elapsed time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		chain, teardownFunc, err := chainSetup("benchibd",
+			&benchGenParams)
+		if err != nil {
+			b.Fatalf("Failed to setup chain instance: %v", err)
+		}
+		process := chaingen.ProcessBlocks(chain)
+		blocksCopy := copyGenBlocks(blocks)
+		b.StartTimer()
+
+		start := time.Now()
+		for _, block := range blocksCopy {
+			if err := process(block); err != nil {
+				b.Fatalf("ProcessBlock: unexpected error: %v", err)
+			}
+		}
+		elapsed += time.Since(start)
+
+		b.StopTimer()
+		teardownFunc()
+		b.StartTimer()
+	}
+	b.ReportMetric(float64(len(blocks)*b.N)/elapsed.Seconds(), "blocks/s")
+}
+
+// BenchmarkReorganize measures the time it takes to process the block which
+// reorganizes a generated chain 100 blocks deep.
+func BenchmarkReorganize(b *testing.B) {
+	txPerBlock := 20
+	if testing.Short() {
+		txPerBlock = 5
+	}
+	blocks, err := reorgChain.generate(&chaingen.Config{
+		Params:        &benchGenParams,
+		NumBlocks:     201,
+		TxPerBlock:    txPerBlock,
+		OutputsPerTx:  2,
+		AdminInterval: 50,
+		ReorgInterval: 200,
+		ReorgDepth:    100,
+	})
+	if err != nil {
+		b.Fatalf("Generate: unexpected error: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		chain, teardownFunc, err := chainSetup("benchreorg",
+			&benchGenParams)
+		if err != nil {
+			b.Fatalf("Failed to setup chain instance: %v", err)
+		}
+		process := chaingen.ProcessBlocks(chain)
+		for _, block := range copyGenBlocks(blocks) {
+			if block.IsReorg {
+				b.StartTimer()
+			}
+			if err := process(block); err != nil {
+				b.Fatalf("ProcessBlock: unexpected error: %v", err)
+			}
+			if block.IsReorg {
+				b.StopTimer()
+			}
+		}
+		teardownFunc()
+		b.StartTimer()
+	}
+}
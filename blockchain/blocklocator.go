@@ -39,7 +39,8 @@ type BlockLocator []*chainhash.Hash
 //  - If the passed hash is not currently known, the block locator will only
 //    consist of the passed hash
 //
-// This function MUST be called with the chain state lock held (for reads).
+// This function MUST be called with either the chain state lock or the index
+// lock held (for reads).
 func (b *BlockChain) blockLocatorFromHash(hash *chainhash.Hash) BlockLocator {
 	// The locator contains the requested hash at the very least.
 	locator := make(BlockLocator, 0, wire.MaxBlockLocatorsPerMsg)
@@ -162,9 +163,9 @@ func (b *BlockChain) blockLocatorFromHash(hash *chainhash.Hash) BlockLocator {
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) BlockLocatorFromHash(hash *chainhash.Hash) BlockLocator {
-	b.chainLock.RLock()
+	b.indexLock.RLock()
 	locator := b.blockLocatorFromHash(hash)
-	b.chainLock.RUnlock()
+	b.indexLock.RUnlock()
 	return locator
 }
 
@@ -173,8 +174,8 @@ func (b *BlockChain) BlockLocatorFromHash(hash *chainhash.Hash) BlockLocator {
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) LatestBlockLocator() (BlockLocator, error) {
-	b.chainLock.RLock()
+	b.indexLock.RLock()
 	locator := b.blockLocatorFromHash(b.bestNode.hash)
-	b.chainLock.RUnlock()
+	b.indexLock.RUnlock()
 	return locator, nil
 }
@@ -8,6 +8,7 @@ package blockchain
 import (
 	"container/list"
 	"fmt"
+	"github.com/bitgo/prova/blockchain/adminstate"
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
@@ -18,6 +19,7 @@ import (
 	"math/big"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,6 +27,11 @@ const (
 	// maxOrphanBlocks is the maximum number of orphan blocks that can be
 	// queued.
 	maxOrphanBlocks = 1000
+
+	// cancelCheckInterval is the number of items long running operations
+	// process between checks of whether or not their context has been
+	// cancelled.
+	cancelCheckInterval = 100
 )
 
 // blockNode represents a block within the block chain and is primarily used to
@@ -60,6 +67,13 @@ type blockNode struct {
 	// ancestor when switching chains.
 	inMainChain bool
 
+	// received is the order in which the block was accepted by this chain
+	// instance, starting at one, and zero for blocks accepted before it
+	// was created.  It breaks ties between chains with the same work in
+	// favor of the one which was received first when the best valid chain
+	// is selected again after blocks were invalidated or reconsidered.
+	received uint64
+
 	// Some fields from block headers to aid in best chain selection and
 	// reconstructing headers from memory.  These must be treated as
 	// immutable and are intentionally ordered to avoid padding on 64-bit
@@ -95,6 +109,8 @@ func newBlockNode(blockHeader *wire.BlockHeader, blockHash *chainhash.Hash) *blo
 		nonce:            blockHeader.Nonce,
 		timestamp:        blockHeader.Timestamp.Unix(),
 		merkleRoot:       blockHeader.MerkleRoot,
+		size:             blockHeader.Size,
+		signature:        blockHeader.Signature,
 		validatingPubKey: blockHeader.ValidatingPubKey,
 	}
 	return &node
@@ -130,10 +146,14 @@ type orphanBlock struct {
 // FetchHeader returns the block header identified by the given hash or an error
 // if it doesn't exist.
 func (b *BlockChain) FetchHeader(hash *chainhash.Hash) (wire.BlockHeader, error) {
-	// Reconstruct the header from the block index if possible.
-	b.chainLock.RLock()
+	// Reconstruct the header from the block index if possible, including
+	// its headers-only entries.
+	b.indexLock.RLock()
 	node, ok := b.index[*hash]
-	b.chainLock.RUnlock()
+	if !ok {
+		node, ok = b.headerNodes[*hash]
+	}
+	b.indexLock.RUnlock()
 	if ok {
 		return node.Header(), nil
 	}
@@ -185,18 +205,23 @@ func removeChildNode(children []*blockNode, node *blockNode) []*blockNode {
 // However, the returned snapshot must be treated as immutable since it is
 // shared by all callers.
 type BestState struct {
-	Hash       *chainhash.Hash // The hash of the block.
-	Height     uint32          // The height of the block.
-	Bits       uint32          // The difficulty bits of the block.
-	BlockSize  uint64          // The size of the block.
-	NumTxns    uint64          // The number of txns in the block.
-	TotalTxns  uint64          // The total number of txns in the chain.
-	MedianTime time.Time       // Median time as per CalcPastMedianTime.
+	Hash                *chainhash.Hash // The hash of the block.
+	Height              uint32          // The height of the block.
+	Bits                uint32          // The difficulty bits of the block.
+	BlockSize           uint64          // The size of the block.
+	NumTxns             uint64          // The number of txns in the block.
+	TotalTxns           uint64          // The total number of txns in the chain.
+	Timestamp           time.Time       // The timestamp of the block.
+	MedianTime          time.Time       // Median time as per CalcPastMedianTime.
+	MaxTime             time.Time       // Latest time as per calcPastMaxTime.
+	TotalSupply         uint64          // The atoms issued minus those destroyed.
+	TotalIssuanceTxs    uint64          // The total number of issuance txns.
+	TotalDestructionTxs uint64          // The total number of destruction txns.
 }
 
 // newBestState returns a new best stats instance for the given parameters.
 func newBestState(node *blockNode, blockSize, numTxns, totalTxns uint64,
-	medianTime time.Time) *BestState {
+	medianTime, maxTime time.Time) *BestState {
 	return &BestState{
 		Hash:       node.hash,
 		Height:     node.height,
@@ -204,7 +229,9 @@ func newBestState(node *blockNode, blockSize, numTxns, totalTxns uint64,
 		BlockSize:  blockSize,
 		NumTxns:    numTxns,
 		TotalTxns:  totalTxns,
+		Timestamp:  time.Unix(node.timestamp, 0),
 		MedianTime: medianTime,
+		MaxTime:    maxTime,
 	}
 }
 
@@ -225,6 +252,13 @@ type BlockChain struct {
 	sigCache            *txscript.SigCache
 	hashCache           *txscript.HashCache
 	indexManager        IndexManager
+	readOnly            bool
+	errorStats          *ErrorStats
+	spendingTxs         bool
+	pruneDepth          uint32
+	sigVerifyWorkers    int
+	validationCache     *validationCache
+	txFeeCache          *txFeeCache
 
 	// The following fields are calculated based upon the provided chain
 	// parameters.  They are also set when the instance is created and
@@ -241,21 +275,76 @@ type BlockChain struct {
 	minMemoryNodes    int32
 
 	// chainLock protects concurrent access to the vast majority of the
-	// fields in this struct below this point.
-	chainLock sync.RWMutex
+	// fields in this struct below this point, most notably the utxo set
+	// and admin state as seen by block validation, and serializes block
+	// processing.  It keeps contention statistics which are reported by
+	// ChainLockStats.
+	//
+	// The locks of the chain must be acquired in the following order to
+	// avoid deadlocks: the chain lock, then the index lock, then the state
+	// lock.  The orphan, preempt and subscription locks are never held
+	// while acquiring any of the other locks.  Queries which only need the
+	// memory block index take the index lock alone, so they don't wait for
+	// blocks being validated and connected, and the best state snapshot is
+	// loaded without taking any lock.
+	chainLock statsRWMutex
 
 	// These fields are configuration parameters that can be toggled at
 	// runtime.  They are protected by the chain lock.
 	noVerify bool
 
-	// These fields are related to the memory block index.  They are
-	// protected by the chain lock.
-	bestNode *blockNode
-	index    map[chainhash.Hash]*blockNode
-	depNodes map[chainhash.Hash][]*blockNode
+	// These fields are related to the memory block index, which includes
+	// the parent, children and main chain flag of the nodes in it.  They
+	// are protected by both the chain lock and the index lock, so they are
+	// only modified with both locks held for writes, while holding either
+	// of them for reads is enough to read them.
+	indexLock sync.RWMutex
+	bestNode  *blockNode
+	index     map[chainhash.Hash]*blockNode
+	depNodes  map[chainhash.Hash][]*blockNode
+
+	// failedBlocks tracks blocks which were stored in the database, but
+	// could not be connected due to a failure other than breaking a
+	// consensus rule, such as a database write error.  They are not
+	// treated as known blocks so they are processed again when they are
+	// seen next.  It is protected like the memory block index.
+	failedBlocks map[chainhash.Hash]struct{}
+
+	// headerNodes holds the headers-only entries of the memory block
+	// index, which are the nodes of the headers processed with
+	// ProcessBlockHeader whose blocks were not processed yet.  They are
+	// linked to their parents, but not the other way around, so they
+	// don't affect the block tree.  It is protected like the memory block
+	// index.
+	headerNodes map[chainhash.Hash]*blockNode
+
+	// invalidBlocks holds the blocks which were marked invalid with
+	// InvalidateBlock, along with all of their descendants, and
+	// blocksReceived is the number of blocks accepted by the chain
+	// instance, which orders the block nodes by when they were received.
+	// They are protected by the chain lock.
+	invalidBlocks  map[chainhash.Hash]struct{}
+	blocksReceived uint64
+
+	// doubleSigns detects validate keys which sign two different blocks
+	// at the same height and keeps the evidence.  It is protected by the
+	// chain lock.
+	doubleSigns *doubleSignDetector
+
+	// preemptTip is the node of the tip the block being processed would
+	// make while it may still be interrupted in favor of a better block,
+	// and nil otherwise.  It is protected by the chain lock.
+	preemptTip *blockNode
+
+	// preemptHeader is the header of the block of the pending request to
+	// interrupt the block being processed, if any.  It is set without
+	// holding the chain lock, so it is protected by the preempt lock.
+	preemptLock   sync.Mutex
+	preemptHeader *wire.BlockHeader
 
 	// These fields are related to the admin state of the chain. They are
-	// protected by the chain lock.
+	// protected by both the chain lock and the state lock, like the memory
+	// block index is by the index lock.
 
 	// threadTips hold latest transaction hash of the 3 admin threads.
 	threadTips map[provautil.ThreadID]*wire.OutPoint
@@ -269,6 +358,8 @@ type BlockChain struct {
 	adminKeySets map[btcec.KeySetType]btcec.PublicKeySet
 	// a mapping of all keyIDs and related ASP public keys.
 	aspKeyIdMap btcec.KeyIdMap
+	// the ASP public keys of the keyIDs which have been revoked.
+	revokedKeys map[btcec.KeyID]adminstate.RevokedKey
 
 	// These fields are related to handling of orphan blocks.  They are
 	// protected by a combination of the chain lock and the orphan lock.
@@ -279,8 +370,8 @@ type BlockChain struct {
 
 	// These fields are related to checkpoint handling.  They are protected
 	// by the chain lock.
-	nextCheckpoint  *chaincfg.Checkpoint
-	checkpointBlock *provautil.Block
+	nextCheckpoint   *chaincfg.Checkpoint
+	checkpointHeader *wire.BlockHeader
 
 	// The state is used as a fairly efficient way to cache information
 	// about the current best chain state that is returned to callers when
@@ -293,8 +384,25 @@ type BlockChain struct {
 	//
 	// In addition, some of the fields are stored in the database so the
 	// chain state can be quickly reconstructed on load.
+	//
+	// The snapshot holds a *BestState which is replaced atomically, so it
+	// is loaded without taking any lock.  The state lock protects the admin
+	// state of the chain as described above.
 	stateLock     sync.RWMutex
-	stateSnapshot *BestState
+	stateSnapshot atomic.Value
+	// subscriptions holds the active block subscriptions which are woken
+	// whenever the main chain changes.  It is protected by the
+	// subscription lock.
+	subscriptionLock sync.Mutex
+	subscriptions    map[*BlockSubscription]struct{}
+
+	// notificationSubscribers holds the notification callbacks registered
+	// with Subscribe in the order they were registered, and
+	// nextNotificationHandle is the handle of the next one.  They are
+	// protected by the notifications lock.
+	notificationsLock       sync.RWMutex
+	notificationSubscribers []notificationSubscriber
+	nextNotificationHandle  NotificationHandle
 }
 
 // DisableVerify provides a mechanism to disable transaction script validation
@@ -316,9 +424,9 @@ func (b *BlockChain) DisableVerify(disable bool) {
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) HaveBlock(hash *chainhash.Hash) (bool, error) {
-	b.chainLock.RLock()
+	b.indexLock.RLock()
 	exists, err := b.blockExists(hash)
-	b.chainLock.RUnlock()
+	b.indexLock.RUnlock()
 
 	if err != nil {
 		return false, err
@@ -462,8 +570,8 @@ func (b *BlockChain) addOrphanBlock(block *provautil.Block) {
 // It is used mainly to dynamically load previous blocks from the database as
 // they are needed to avoid needing to put the entire block chain in memory.
 //
-// This function MUST be called with the chain state lock held (for writes).
-// The database transaction may be read-only.
+// This function MUST be called with the chain state lock held (for writes) and
+// without the index lock held.  The database transaction may be read-only.
 func (b *BlockChain) loadBlockNode(dbTx database.Tx, hash *chainhash.Hash) (*blockNode, error) {
 	// Load the block header and height from the db.
 	blockHeader, err := dbFetchHeaderByHash(dbTx, hash)
@@ -482,6 +590,8 @@ func (b *BlockChain) loadBlockNode(dbTx database.Tx, hash *chainhash.Hash) (*blo
 	//  3) Neither 1 or 2 is true which implies it's an orphan block and
 	//     therefore is an error to insert into the chain
 	prevHash := &blockHeader.PrevBlock
+	b.indexLock.Lock()
+	defer b.indexLock.Unlock()
 	if parentNode, ok := b.index[*prevHash]; ok {
 		// Case 1 -- This node is a child of an existing block node.
 		// Update the node's work sum with the sum of the parent node's
@@ -508,7 +618,7 @@ func (b *BlockChain) loadBlockNode(dbTx database.Tx, hash *chainhash.Hash) (*blo
 		// parent of another node.  This means an arbitrary orphan block
 		// is trying to be loaded which is not allowed.
 		str := "loadBlockNode: attempt to insert orphan block %v"
-		return nil, AssertError(fmt.Sprintf(str, hash))
+		return nil, assertError(fmt.Sprintf(str, hash))
 	}
 
 	// Add the new node to the indices for faster lookups.
@@ -708,6 +818,40 @@ func (b *BlockChain) calcPastMedianTime(startNode *blockNode) (time.Time, error)
 	return time.Unix(medianTimestamp, 0), nil
 }
 
+// calcPastMaxTime calculates the latest timestamp of the blocks in the time
+// regression window of the chain ending with the passed block node.  Only the
+// passed block node is considered when the window is disabled.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) calcPastMaxTime(startNode *blockNode) (time.Time, error) {
+	// Genesis block.
+	if startNode == nil {
+		return b.chainParams.GenesisBlock.Header.Timestamp, nil
+	}
+
+	maxTimestamp := startNode.timestamp
+	iterNode := startNode
+	for i := 1; i < b.chainParams.TimeRegressionWindow; i++ {
+		// Get the previous block node.  This function is used over
+		// simply accessing iterNode.parent directly as it will
+		// dynamically create previous block nodes as needed.
+		var err error
+		iterNode, err = b.getPrevNodeFromNode(iterNode)
+		if err != nil {
+			log.Errorf("getPrevNodeFromNode: %v", err)
+			return time.Time{}, err
+		}
+		if iterNode == nil {
+			break
+		}
+		if iterNode.timestamp > maxTimestamp {
+			maxTimestamp = iterNode.timestamp
+		}
+	}
+
+	return time.Unix(maxTimestamp, 0), nil
+}
+
 // SequenceLock represents the converted relative lock-time in seconds, and
 // absolute block-height for a transaction input's relative lock-times.
 // According to SequenceLock, after the referenced input has been confirmed
@@ -771,10 +915,8 @@ func (b *BlockChain) calcSequenceLock(tx *provautil.Tx, utxoView *UtxoViewpoint,
 	for txInIndex, txIn := range mTx.TxIn {
 		utxo := utxoView.LookupEntry(&txIn.PreviousOutPoint.Hash)
 		if utxo == nil {
-			str := fmt.Sprintf("unable to find unspent output "+
-				"%v referenced from transaction %s:%d",
-				txIn.PreviousOutPoint, tx.Hash(), txInIndex)
-			return sequenceLock, ruleError(ErrMissingTx, str)
+			return sequenceLock, txInputError(ErrMissingTx, tx,
+				txInIndex, "unknown")
 		}
 
 		// If the input height is set to the mempool height, then we
@@ -942,31 +1084,49 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 	// Make sure it's extending the end of the best chain.
 	prevHash := &block.MsgBlock().Header.PrevBlock
 	if !prevHash.IsEqual(b.bestNode.hash) {
-		return AssertError("connectBlock must be called with a block " +
+		return assertError("connectBlock must be called with a block " +
 			"that extends the main chain")
 	}
 
 	// Sanity check the correct number of stxos are provided.
 	if len(stxos) != countSpentOutputs(block) {
-		return AssertError("connectBlock called with inconsistent " +
+		return assertError("connectBlock called with inconsistent " +
 			"spent transaction out information")
 	}
 
-	// Calculate the median time for the block.
+	// Calculate the median and latest times for the block.
 	medianTime, err := b.calcPastMedianTime(node)
 	if err != nil {
 		return err
 	}
+	maxTime, err := b.calcPastMaxTime(node)
+	if err != nil {
+		return err
+	}
 
 	// Generate a new best state snapshot that will be used to update the
 	// database and later memory if all database updates are successful.
-	b.stateLock.RLock()
-	curTotalTxns := b.stateSnapshot.TotalTxns
-	b.stateLock.RUnlock()
+	curState := b.BestSnapshot()
 	numTxns := uint64(len(block.MsgBlock().Transactions))
 	blockSize := uint64(block.MsgBlock().SerializeSize())
-	state := newBestState(node, blockSize, numTxns, curTotalTxns+numTxns,
-		medianTime)
+	state := newBestState(node, blockSize, numTxns,
+		curState.TotalTxns+numTxns, medianTime, maxTime)
+	issuances, destructions := blockIssueTxCounts(block)
+	state.TotalSupply = keyView.TotalSupply()
+	state.TotalIssuanceTxs = curState.TotalIssuanceTxs + issuances
+	state.TotalDestructionTxs = curState.TotalDestructionTxs + destructions
+
+	// Make sure the admin threads can still be advanced from their tips
+	// once the block is connected.
+	err = b.checkThreadTips(utxoView, keyView.ThreadTips())
+	if err != nil {
+		return err
+	}
+
+	// Find the double signs of the validate keys the block provisions to
+	// the validate key set again, which are cleared by the block.
+	clearedDoubleSigns := b.reprovisionedDoubleSigners(block)
+
 	// Atomically insert info into the database.
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
@@ -975,6 +1135,13 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 			return err
 		}
 
+		// Record the double signers which were provisioned again.
+		for _, ds := range clearedDoubleSigns {
+			if err := dbPutDoubleSign(dbTx, ds); err != nil {
+				return err
+			}
+		}
+
 		// Add the block hash and height to the block index which tracks
 		// the main chain.
 		err = dbPutBlockIndex(dbTx, block.Hash(), node.height)
@@ -992,11 +1159,22 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 
 		// Update the admin key set using the state of the key view.
 		err = dbPutKeySet(dbTx, keyView.Keys(), keyView.KeyIDs(),
-			keyView.ThreadTips(), keyView.LastKeyID(), keyView.TotalSupply())
+			keyView.RevokedKeys(), keyView.ThreadTips(),
+			keyView.LastKeyID(), keyView.TotalSupply())
 		if err != nil {
 			return err
 		}
 
+		// Take a snapshot of the admin state periodically so it can be
+		// reconstructed as of any height.
+		if node.height%adminSnapshotInterval == 0 {
+			err = dbPutAdminSnapshot(dbTx, node.height,
+				keyView.AdminState())
+			if err != nil {
+				return err
+			}
+		}
+
 		// Update the transaction spend journal by adding a record for
 		// the block that contains all txos spent by it.
 		err = dbPutSpendJournalEntry(dbTx, block.Hash(), stxos)
@@ -1004,6 +1182,15 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 			return err
 		}
 
+		// Record the transactions of the block as the spenders of the
+		// outputs they spend when requested.
+		if b.spendingTxs {
+			err = dbPutSpendingTxs(dbTx, block)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Allow the index manager to call each of the currently active
 		// optional indexes with the block being connected so they can
 		// update themselves accordingly.
@@ -1023,15 +1210,24 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
 	utxoView.commit()
+	b.clearDoubleSigners(clearedDoubleSigns)
+
+	// Keep the fees paid by the transactions of the block, which are known
+	// from the outputs they spent, for the notification of the block and
+	// for callers which look them up shortly after.
+	b.txFeeCache.add(block.Hash(), calcBlockTxFees(block,
+		stxoInputTotals(block, stxos)))
 
 	// Add the new node to the memory main chain indices for faster
 	// lookups.
+	b.indexLock.Lock()
 	node.inMainChain = true
 	b.index[*node.hash] = node
 	b.depNodes[*prevHash] = append(b.depNodes[*prevHash], node)
 
 	// This node is now the end of the best chain.
 	b.bestNode = node
+	b.indexLock.Unlock()
 
 	// This is now the admin state of the best chain.
 	b.stateLock.Lock()
@@ -1040,6 +1236,7 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 	b.lastKeyID = keyView.LastKeyID()
 	b.adminKeySets = keyView.Keys()
 	b.aspKeyIdMap = keyView.KeyIDs()
+	b.revokedKeys = keyView.RevokedKeys()
 	b.stateLock.Unlock()
 
 	// Update the state for the best block.  Notice how this replaces the
@@ -1047,15 +1244,17 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 	// allows the old version to act as a snapshot which callers can use
 	// freely without needing to hold a lock for the duration.  See the
 	// comments on the state variable for more details.
-	b.stateLock.Lock()
-	b.stateSnapshot = state
-	b.stateLock.Unlock()
+	b.stateSnapshot.Store(state)
 
-	// Notify the caller that the block was connected to the main chain.
-	// The caller would typically want to react with actions such as
-	// updating wallets.
+	// Notify the caller that the block was connected to the main chain,
+	// followed by the changes of the admin key sets it made.  The caller
+	// would typically want to react with actions such as updating wallets.
+	keyChanges := b.blockAdminKeyChanges(block, false)
 	b.chainLock.Unlock()
 	b.sendNotification(NTBlockConnected, block)
+	for _, change := range keyChanges {
+		b.sendNotification(NTAdminKeyChanged, change)
+	}
 	b.chainLock.Lock()
 
 	return nil
@@ -1068,7 +1267,7 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, utxoView *UtxoViewpoint, keyView *KeyViewpoint) error {
 	// Make sure the node being disconnected is the end of the best chain.
 	if !node.hash.IsEqual(b.bestNode.hash) {
-		return AssertError("disconnectBlock must be called with the " +
+		return assertError("disconnectBlock must be called with the " +
 			"block at the end of the main chain")
 	}
 
@@ -1081,17 +1280,22 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, ut
 		return err
 	}
 
-	// Calculate the median time for the previous block.
+	// Calculate the median and latest times for the previous block.
 	medianTime, err := b.calcPastMedianTime(prevNode)
 	if err != nil {
 		return err
 	}
+	maxTime, err := b.calcPastMaxTime(prevNode)
+	if err != nil {
+		return err
+	}
 
 	// Load the previous block since some details for it are needed below.
 	var prevBlock *provautil.Block
 	err = b.db.View(func(dbTx database.Tx) error {
 		var err error
-		prevBlock, err = dbFetchBlockByHash(dbTx, prevNode.hash)
+		prevBlock, err = dbFetchBlockByHash(dbTx,
+			b.chainParams, prevNode.hash)
 		return err
 	})
 	if err != nil {
@@ -1100,25 +1304,47 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, ut
 
 	// Generate a new best state snapshot that will be used to update the
 	// database and later memory if all database updates are successful.
-	b.stateLock.RLock()
-	curTotalTxns := b.stateSnapshot.TotalTxns
-	b.stateLock.RUnlock()
+	curState := b.BestSnapshot()
 	numTxns := uint64(len(prevBlock.MsgBlock().Transactions))
 	blockSize := uint64(prevBlock.MsgBlock().SerializeSize())
-	newTotalTxns := curTotalTxns - uint64(len(block.MsgBlock().Transactions))
+	newTotalTxns := curState.TotalTxns -
+		uint64(len(block.MsgBlock().Transactions))
 	state := newBestState(prevNode, blockSize, numTxns, newTotalTxns,
-		medianTime)
+		medianTime, maxTime)
+	issuances, destructions := blockIssueTxCounts(block)
+	state.TotalSupply = keyView.TotalSupply()
+	state.TotalIssuanceTxs = curState.TotalIssuanceTxs - issuances
+	state.TotalDestructionTxs = curState.TotalDestructionTxs - destructions
+
+	// Find the double signs which were cleared by the block, which are no
+	// longer cleared once it is disconnected.
+	restoredDoubleSigns := b.disconnectedDoubleSigners(node.height)
 
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
-		err := dbPutBestState(dbTx, state, node.workSum)
+		err := dbPutBestState(dbTx, state, prevNode.workSum)
 		if err != nil {
 			return err
 		}
 
+		// Record the double signs which are no longer cleared.
+		for _, ds := range restoredDoubleSigns {
+			if err := dbPutDoubleSign(dbTx, ds); err != nil {
+				return err
+			}
+		}
+
 		// Store the current admin key sets in the database.
 		err = dbPutKeySet(dbTx, keyView.Keys(), keyView.KeyIDs(),
-			keyView.ThreadTips(), keyView.LastKeyID(), keyView.TotalSupply())
+			keyView.RevokedKeys(), keyView.ThreadTips(),
+			keyView.LastKeyID(), keyView.TotalSupply())
+		if err != nil {
+			return err
+		}
+
+		// Remove the snapshot of the admin state as of the block, if
+		// any.
+		err = dbRemoveAdminSnapshot(dbTx, node.height)
 		if err != nil {
 			return err
 		}
@@ -1145,6 +1371,14 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, ut
 			return err
 		}
 
+		// Remove the spending transactions recorded for the block.
+		if b.spendingTxs {
+			err = dbRemoveSpendingTxs(dbTx, block)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Allow the index manager to call each of the currently active
 		// optional indexes with the block being disconnected so they
 		// can update themselves accordingly.
@@ -1164,27 +1398,43 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, ut
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
 	utxoView.commit()
+	b.restoreDoubleSigners(restoredDoubleSigns)
 
 	// Mark block as being in a side chain.
+	b.indexLock.Lock()
 	node.inMainChain = false
 
 	// This node's parent is now the end of the best chain.
 	b.bestNode = node.parent
+	b.indexLock.Unlock()
+
+	// This is now the admin state of the best chain.
+	b.stateLock.Lock()
+	b.threadTips = keyView.ThreadTips()
+	b.totalSupply = keyView.TotalSupply()
+	b.lastKeyID = keyView.LastKeyID()
+	b.adminKeySets = keyView.Keys()
+	b.aspKeyIdMap = keyView.KeyIDs()
+	b.revokedKeys = keyView.RevokedKeys()
+	b.stateLock.Unlock()
 
 	// Update the state for the best block.  Notice how this replaces the
 	// entire struct instead of updating the existing one.  This effectively
 	// allows the old version to act as a snapshot which callers can use
 	// freely without needing to hold a lock for the duration.  See the
 	// comments on the state variable for more details.
-	b.stateLock.Lock()
-	b.stateSnapshot = state
-	b.stateLock.Unlock()
+	b.stateSnapshot.Store(state)
 
 	// Notify the caller that the block was disconnected from the main
-	// chain.  The caller would typically want to react with actions such as
-	// updating wallets.
+	// chain, followed by the changes of the admin key sets which reverse
+	// the ones it made.  The caller would typically want to react with
+	// actions such as updating wallets.
+	keyChanges := b.blockAdminKeyChanges(block, true)
 	b.chainLock.Unlock()
 	b.sendNotification(NTBlockDisconnected, block)
+	for _, change := range keyChanges {
+		b.sendNotification(NTAdminKeyChanged, change)
+	}
 	b.chainLock.Lock()
 
 	return nil
@@ -1214,6 +1464,12 @@ func countSpentOutputs(block *provautil.Block) int {
 //
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags BehaviorFlags) error {
+	// Refuse to disconnect blocks deeper than the prune depth before
+	// anything is changed.
+	if err := b.checkReorgDepth(detachNodes.Len()); err != nil {
+		return err
+	}
+
 	// All of the blocks to detach and related spend journal entries needed
 	// to unspend transaction outputs in the blocks being disconnected must
 	// be loaded from the database during the reorg check phase below and
@@ -1238,12 +1494,14 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 	keyView.SetTotalSupply(b.totalSupply)
 	keyView.SetKeys(b.adminKeySets)
 	keyView.SetKeyIDs(b.aspKeyIdMap)
+	keyView.SetRevokedKeys(b.revokedKeys)
 	for e := detachNodes.Front(); e != nil; e = e.Next() {
 		n := e.Value.(*blockNode)
 		var block *provautil.Block
 		err := b.db.View(func(dbTx database.Tx) error {
 			var err error
-			block, err = dbFetchBlockByHash(dbTx, n.hash)
+			block, err = dbFetchBlockByHash(dbTx,
+				b.chainParams, n.hash)
 			return err
 		})
 		if err != nil {
@@ -1306,7 +1564,8 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 				return err
 			}
 
-			block, err = provautil.NewBlockFromBytes(blockBytes)
+			block, err = provautil.NewBlockFromBytesEncoding(
+				blockBytes, b.chainParams.TxEncoding())
 			if err != nil {
 				return err
 			}
@@ -1320,6 +1579,12 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 		// Store the loaded block for later.
 		attachBlocks = append(attachBlocks, block)
 
+		// The reorganization may be interrupted in favor of a better
+		// block before each block is checked.
+		if err := b.checkPreempt(); err != nil {
+			return err
+		}
+
 		// Notice the spent txout details are not requested here and
 		// thus will not be generated.  This is done because the state
 		// is not being immediately written to the database, so it is
@@ -1336,12 +1601,85 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 		return nil
 	}
 
-	// Reset the view for the actual connection code below.  This is
-	// required because the view was previously modified when checking if
-	// the reorg would be successful and the connection code requires the
-	// view to be valid from the viewpoint of each block being connected or
-	// disconnected.
-	utxoView = NewUtxoViewpoint()
+	// This is the last chance to interrupt the reorganization in favor of
+	// a better block since the chain is modified from here on.
+	if err := b.checkPreempt(); err != nil {
+		return err
+	}
+	b.preemptTip = nil
+
+	// Notify the caller the main chain is about to be reorganized, and
+	// once the reorganization finished.  The blocks are disconnected and
+	// connected in between, which leaves the main chain in between the old
+	// and new best blocks should the reorganization fail or the process
+	// crash.
+	firstDetachNode := detachNodes.Front().Value.(*blockNode)
+	lastAttachNode := attachNodes.Back().Value.(*blockNode)
+	ntfnsData := ReorganizationNtfnsData{
+		OldHash:   *firstDetachNode.hash,
+		OldHeight: firstDetachNode.height,
+		NewHash:   *lastAttachNode.hash,
+		NewHeight: lastAttachNode.height,
+	}
+	startedData := ntfnsData
+	b.chainLock.Unlock()
+	b.sendNotification(NTReorganizationStarted, &startedData)
+	b.chainLock.Lock()
+
+	err := b.applyReorganization(detachNodes, attachNodes, detachBlocks,
+		detachSpentTxOuts, attachBlocks)
+
+	ntfnsData.Err = err
+	b.chainLock.Unlock()
+	b.sendNotification(NTReorganizationFinished, &ntfnsData)
+	b.chainLock.Lock()
+	if err != nil {
+		return err
+	}
+
+	// Log the point where the chain forked.
+	firstAttachNode := attachNodes.Front().Value.(*blockNode)
+	forkNode, err := b.getPrevNodeFromNode(firstAttachNode)
+	if err == nil {
+		log.Infof("REORGANIZE: Chain forks at %v", forkNode.hash)
+	}
+
+	// Log the old and new best chain heads.
+	log.Infof("REORGANIZE: Old best chain head was %v", firstDetachNode.hash)
+	log.Infof("REORGANIZE: New best chain head is %v", lastAttachNode.hash)
+
+	return nil
+}
+
+// applyReorganization disconnects the passed detach nodes from the main chain
+// and connects the passed attach nodes to it using the blocks and spent txos
+// loaded while checking the reorganization.
+//
+// The blocks are disconnected and connected in separate database transactions,
+// so the reorganization state is stored before the first of them and removed
+// after the last one.  This allows recoverReorganization to repair the main
+// chain at startup when the process crashes in between.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) applyReorganization(detachNodes, attachNodes *list.List,
+	detachBlocks []*provautil.Block, detachSpentTxOuts [][]spentTxOut,
+	attachBlocks []*provautil.Block) error {
+
+	// Mark the beginning of the reorganization.
+	state := newReorgState(detachNodes, attachNodes)
+	err := b.db.Update(func(dbTx database.Tx) error {
+		return dbPutReorgState(dbTx, state)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Reset the views for the actual connection code below.  This is
+	// required because the views were previously modified when checking
+	// if the reorg would be successful and the connection code requires
+	// the views to be valid from the viewpoint of each block being
+	// connected or disconnected.
+	utxoView := NewUtxoViewpoint()
 	utxoView.SetBestHash(b.bestNode.hash)
 
 	// Disconnect blocks from the main chain.
@@ -1357,11 +1695,18 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 		}
 
 		// Update the view to unspend all of the spent txos and remove
-		// the utxos created by the block.
+		// the utxos created by the block, and undo its admin operations
+		// on the admin state of the main chain.
 		err = utxoView.disconnectTransactions(block, detachSpentTxOuts[i])
 		if err != nil {
 			return err
 		}
+		keyView := NewKeyViewpoint()
+		keyView.SetAdminState(b.AdminState())
+		err = keyView.disconnectTransactions(block)
+		if err != nil {
+			return err
+		}
 
 		// Update the database and chain state.
 		err = b.disconnectBlock(n, block, utxoView, keyView)
@@ -1371,6 +1716,8 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 	}
 
 	// Connect the new best chain blocks.
+	keyView := NewKeyViewpoint()
+	keyView.SetAdminState(b.AdminState())
 	for i, e := 0, attachNodes.Front(); e != nil; i, e = i+1, e.Next() {
 		n := e.Value.(*blockNode)
 		block := attachBlocks[i]
@@ -1400,20 +1747,19 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 		}
 	}
 
-	// Log the point where the chain forked.
-	firstAttachNode := attachNodes.Front().Value.(*blockNode)
-	forkNode, err := b.getPrevNodeFromNode(firstAttachNode)
-	if err == nil {
-		log.Infof("REORGANIZE: Chain forks at %v", forkNode.hash)
-	}
-
-	// Log the old and new best chain heads.
-	firstDetachNode := detachNodes.Front().Value.(*blockNode)
-	lastAttachNode := attachNodes.Back().Value.(*blockNode)
-	log.Infof("REORGANIZE: Old best chain head was %v", firstDetachNode.hash)
-	log.Infof("REORGANIZE: New best chain head is %v", lastAttachNode.hash)
+	// Mark the end of the reorganization.
+	return b.db.Update(dbRemoveReorgState)
+}
 
-	return nil
+// removeIndexNode removes the passed side chain node, which must not have any
+// children, from the memory block index and disconnects it from its parent.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) removeIndexNode(node *blockNode) {
+	b.indexLock.Lock()
+	node.parent.children = removeChildNode(node.parent.children, node)
+	delete(b.index, *node.hash)
+	b.indexLock.Unlock()
 }
 
 // connectBestChain handles connecting the passed block to the chain while
@@ -1431,12 +1777,24 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 //  - BFDryRun: Prevents the block from being connected and avoids modifying the
 //    state of the memory chain index.  Also, any log messages related to
 //    modifying the state are avoided.
+//  - BFPreemptible: Interrupts connecting the block, or the reorganization it
+//    causes, with errPreempted in favor of a better block requested with
+//    Preempt, which leaves the chain and the memory chain index as they were.
 //
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, flags BehaviorFlags) (bool, error) {
 	fastAdd := flags&BFFastAdd == BFFastAdd
 	dryRun := flags&BFDryRun == BFDryRun
 
+	// Connecting the block may be interrupted in favor of a better block
+	// until the chain is modified when the caller allows it.
+	if flags&BFPreemptible == BFPreemptible && !dryRun {
+		b.preemptTip = node
+		defer func() {
+			b.preemptTip = nil
+		}()
+	}
+
 	// We are extending the main (best) chain with a new block.  This is the
 	// most common case.
 	if node.parentHash.IsEqual(b.bestNode.hash) {
@@ -1456,6 +1814,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 		keyView.SetTotalSupply(b.totalSupply)
 		keyView.SetKeys(b.adminKeySets)
 		keyView.SetKeyIDs(b.aspKeyIdMap)
+		keyView.SetRevokedKeys(b.revokedKeys)
 		stxos := make([]spentTxOut, 0, countSpentOutputs(block))
 		if !fastAdd {
 			err := b.checkConnectBlock(node, block, utxoView, keyView, &stxos)
@@ -1469,6 +1828,14 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 			return true, nil
 		}
 
+		// This is the last chance to interrupt connecting the block in
+		// favor of a better block since the chain is modified from here
+		// on.
+		if err := b.checkPreempt(); err != nil {
+			return false, err
+		}
+		b.preemptTip = nil
+
 		// In the fast add case the code to check the block connection
 		// was skipped, so the utxo view needs to load the referenced
 		// utxos, spend them, and add the new utxos being created by
@@ -1485,15 +1852,19 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 			keyView.connectTransactions(block)
 		}
 
-		// Connect the block to the main chain.
+		// Connect the block to the main chain and prune the blocks
+		// which fall below the prune depth as a result.
 		err := b.connectBlock(node, block, utxoView, keyView, stxos)
 		if err != nil {
 			return false, err
 		}
+		b.maybePruneChain()
 
 		// Connect the parent node to this node.
 		if node.parent != nil {
+			b.indexLock.Lock()
 			node.parent.children = append(node.parent.children, node)
+			b.indexLock.Unlock()
 		}
 
 		return true, nil
@@ -1506,22 +1877,29 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 	// We're extending (or creating) a side chain which may or may not
 	// become the main chain, but in either case the entry is needed in the
 	// index for future processing.
+	b.indexLock.Lock()
 	b.index[*node.hash] = node
 
 	// Connect the parent node to this node.
 	node.inMainChain = false
 	node.parent.children = append(node.parent.children, node)
+	b.indexLock.Unlock()
 
 	// Disconnect it from the parent node when the function returns when
 	// running in dry run mode.
 	if dryRun {
-		defer func() {
-			children := node.parent.children
-			children = removeChildNode(children, node)
-			node.parent.children = children
+		defer b.removeIndexNode(node)
+	}
 
-			delete(b.index, *node.hash)
-		}()
+	// We're extending a side chain which descends from a block that was
+	// marked invalid, so it never becomes the main chain regardless of its
+	// work until the block is reconsidered.
+	if b.isInvalidChain(node, nil) {
+		if !dryRun {
+			log.Infof("Block %v extends a side chain which descends "+
+				"from an invalidated block", node.hash)
+		}
+		return false, nil
 	}
 
 	// We're extending (or creating) a side chain, but the cumulative
@@ -1569,9 +1947,17 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 			node.hash)
 	}
 	err := b.reorganizeChain(detachNodes, attachNodes, flags)
+	if err == errPreempted {
+		// Forget the node of an interrupted block so it is processed
+		// from scratch the next time.
+		b.removeIndexNode(node)
+	}
 	if err != nil {
 		return false, err
 	}
+	if !dryRun {
+		b.maybePruneChain()
+	}
 
 	return true, nil
 }
@@ -1584,8 +1970,8 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) IsCurrent() bool {
-	b.chainLock.RLock()
-	defer b.chainLock.RUnlock()
+	b.indexLock.RLock()
+	defer b.indexLock.RUnlock()
 
 	// Not current if the latest main (best) chain height is before the
 	// latest known good checkpoint (when checkpoints are enabled).
@@ -1609,10 +1995,25 @@ func (b *BlockChain) IsCurrent() bool {
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) BestSnapshot() *BestState {
-	b.stateLock.RLock()
-	snapshot := b.stateSnapshot
-	b.stateLock.RUnlock()
-	return snapshot
+	return b.stateSnapshot.Load().(*BestState)
+}
+
+// ChainLockStats returns the contention statistics of the chain lock, which
+// serializes block processing and most queries of the chain state.
+//
+// This function is safe for concurrent access and doesn't wait for the chain
+// lock.
+func (b *BlockChain) ChainLockStats() LockStats {
+	return b.chainLock.Stats()
+}
+
+// ValidationCacheStats returns the statistics of the cache of recent blocks
+// which were rejected for breaking a consensus rule.
+//
+// This function is safe for concurrent access and doesn't wait for the chain
+// lock.
+func (b *BlockChain) ValidationCacheStats() ValidationCacheStats {
+	return b.validationCache.Stats()
 }
 
 // ThreadTips returns information about the best chain block's unspent admin
@@ -1678,6 +2079,24 @@ func (b *BlockChain) KeyIDs() btcec.KeyIdMap {
 	return aspKeyIdMap
 }
 
+// SigVerifyWorkers returns the number of goroutines the chain was configured to
+// validate scripts with, where zero selects a number based on the number of
+// processor cores.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SigVerifyWorkers() int {
+	return b.sigVerifyWorkers
+}
+
+// TxEncoding returns the protocol version flags the blocks and transactions of
+// the chain are decoded with, as returned by the TxEncoding method of its chain
+// parameters.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) TxEncoding() uint32 {
+	return b.chainParams.TxEncoding()
+}
+
 // IndexManager provides a generic interface that the is called when blocks are
 // connected and disconnected to and from the tip of the main chain for the
 // purpose of supporting optional indexes.
@@ -1757,21 +2176,85 @@ type Config struct {
 	// chain and connecting and disconnecting blocks.
 	//
 	// This field can be nil if the caller does not wish to make use of an
-	// index manager.
+	// index manager.  It must be nil when ReadOnly is set since indexes
+	// can't be created or caught up without modifying the database.
 	IndexManager IndexManager
+
+	// ReadOnly specifies the chain is loaded from a database opened in
+	// read-only mode.  All of the chain state may be queried as usual, but
+	// blocks are refused by ProcessBlock and a database that doesn't
+	// already contain a chain state can't be initialized.
+	ReadOnly bool
+
+	// ErrorStats defines the error stats which count the blocks rejected
+	// by ProcessBlock by error code.
+	//
+	// This field can be nil if the caller is not interested in counting
+	// the rejected blocks.
+	ErrorStats *ErrorStats
+
+	// SpendingTxs specifies the chain records the transaction which spent
+	// each output of the main chain so FetchSpendingTx can look it up.  The
+	// records grow with the chain, so they are optional.  When enabled on a
+	// database which doesn't record them yet, or didn't while it was
+	// disabled, they are caught up with the main chain during New.
+	SpendingTxs bool
+
+	// PruneDepth specifies the chain removes the stored data of the blocks
+	// which are more than this many blocks below the best block once they
+	// are connected, which requires a database that implements
+	// database.Pruner.  The headers of the pruned blocks remain available
+	// along with everything needed to reorganize the chain within the
+	// prune depth, while deeper reorganizations are rejected with
+	// ErrReorgTooDeep.  The spend journal entries of the pruned blocks,
+	// which are only needed to disconnect them, are removed as well.  It
+	// can't be combined with an IndexManager since the indexes refer to
+	// the data of the blocks.
+	//
+	// Zero disables pruning.
+	PruneDepth uint32
+
+	// SigVerifyWorkers specifies the number of goroutines used to validate
+	// the scripts of the transaction inputs of a block.  The first input
+	// which fails validation stops all of them.
+	//
+	// Zero selects a number based on the number of processor cores.
+	SigVerifyWorkers int
 }
 
 // New returns a BlockChain instance using the provided configuration details.
 func New(config *Config) (*BlockChain, error) {
 	// Enforce required config fields.
 	if config.DB == nil {
-		return nil, AssertError("blockchain.New database is nil")
+		return nil, assertError("blockchain.New database is nil")
 	}
 	if config.ChainParams == nil {
-		return nil, AssertError("blockchain.New chain parameters nil")
+		return nil, assertError("blockchain.New chain parameters nil")
+	}
+	if config.ChainParams.PowOnly && config.ChainParams.Net == wire.MainNet {
+		return nil, assertError("blockchain.New proof of work only " +
+			"can't be used on the main network")
 	}
 	if config.TimeSource == nil {
-		return nil, AssertError("blockchain.New timesource is nil")
+		return nil, assertError("blockchain.New timesource is nil")
+	}
+	if config.ReadOnly && config.IndexManager != nil {
+		return nil, assertError("blockchain.New index manager can't " +
+			"be used with a read-only chain")
+	}
+	if config.SigVerifyWorkers < 0 {
+		return nil, assertError("blockchain.New number of signature " +
+			"verification workers is negative")
+	}
+	if config.PruneDepth != 0 {
+		if _, ok := config.DB.(database.Pruner); !ok {
+			return nil, assertError("blockchain.New database " +
+				"doesn't support pruning")
+		}
+		if config.IndexManager != nil {
+			return nil, assertError("blockchain.New index manager " +
+				"can't be used with a pruned chain")
+		}
 	}
 
 	// Generate a checkpoint by height map from the provided checkpoints
@@ -1783,7 +2266,7 @@ func New(config *Config) (*BlockChain, error) {
 		for i := range config.Checkpoints {
 			checkpoint := &config.Checkpoints[i]
 			if checkpoint.Height <= prevCheckpointHeight {
-				return nil, AssertError("blockchain.New " +
+				return nil, assertError("blockchain.New " +
 					"checkpoints are not sorted by height")
 			}
 			checkpointsByHeight[checkpoint.Height] = checkpoint
@@ -1797,10 +2280,16 @@ func New(config *Config) (*BlockChain, error) {
 		db:                  config.DB,
 		chainParams:         config.ChainParams,
 		timeSource:          config.TimeSource,
-		notifications:       config.Notifications,
 		sigCache:            config.SigCache,
 		hashCache:           config.HashCache,
 		indexManager:        config.IndexManager,
+		readOnly:            config.ReadOnly,
+		errorStats:          config.ErrorStats,
+		spendingTxs:         config.SpendingTxs,
+		pruneDepth:          config.PruneDepth,
+		sigVerifyWorkers:    config.SigVerifyWorkers,
+		validationCache:     newValidationCache(maxValidationCacheEntries),
+		txFeeCache:          newTxFeeCache(maxTxFeeCacheEntries),
 		blocksPerRetarget:   int32(config.ChainParams.PowAveragingWindow),
 		minMemoryNodes:      int32(config.ChainParams.PowAveragingWindow),
 		bestNode:            nil,
@@ -1809,10 +2298,21 @@ func New(config *Config) (*BlockChain, error) {
 		totalSupply:         uint64(0),
 		adminKeySets:        make(map[btcec.KeySetType]btcec.PublicKeySet),
 		aspKeyIdMap:         make(map[btcec.KeyID]*btcec.PublicKey),
+		revokedKeys:         make(map[btcec.KeyID]adminstate.RevokedKey),
 		index:               make(map[chainhash.Hash]*blockNode),
 		depNodes:            make(map[chainhash.Hash][]*blockNode),
+		failedBlocks:        make(map[chainhash.Hash]struct{}),
+		headerNodes:         make(map[chainhash.Hash]*blockNode),
+		invalidBlocks:       make(map[chainhash.Hash]struct{}),
 		orphans:             make(map[chainhash.Hash]*orphanBlock),
 		prevOrphans:         make(map[chainhash.Hash][]*orphanBlock),
+		subscriptions:       make(map[*BlockSubscription]struct{}),
+	}
+
+	// Upgrade the serialization of the chain state stored in the database
+	// to the current version before it is loaded.
+	if err := b.upgradeChainState(); err != nil {
+		return nil, err
 	}
 
 	// Initialize the chain state from the passed database.  When the db
@@ -1822,6 +2322,24 @@ func New(config *Config) (*BlockChain, error) {
 		return nil, err
 	}
 
+	// Load the double signs which were detected previously.
+	doubleSigns, err := loadDoubleSigns(b.db)
+	if err != nil {
+		return nil, err
+	}
+	b.doubleSigns = newDoubleSignDetector(doubleSigns)
+
+	// Load the blocks which were marked invalid.
+	if err := b.loadInvalidBlocks(); err != nil {
+		return nil, err
+	}
+
+	// Start recording the tips of the block tree when the database was
+	// created before they were recorded.
+	if err := b.initChainTips(); err != nil {
+		return nil, err
+	}
+
 	// Initialize and catch up all of the currently active optional indexes
 	// as needed.
 	if config.IndexManager != nil {
@@ -1830,8 +2348,43 @@ func New(config *Config) (*BlockChain, error) {
 		}
 	}
 
+	// Catch the recorded spending transactions up with the main chain as
+	// needed.
+	if err := b.initSpendingTxs(); err != nil {
+		return nil, err
+	}
+
+	// Repair the main chain when a reorganization was interrupted.  This
+	// happens before the notifications are enabled since the caller isn't
+	// ready to receive them until the chain instance is returned.
+	b.chainLock.Lock()
+	err = b.recoverReorganization()
+	b.chainLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Finish disconnecting the blocks which were marked invalid in case
+	// it was interrupted.
+	b.chainLock.Lock()
+	err = b.enforceInvalidBlocks()
+	b.chainLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Prune the blocks which fell below the prune depth while pruning was
+	// disabled.
+	b.chainLock.Lock()
+	err = b.pruneChain()
+	b.chainLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	b.notifications = config.Notifications
+
 	log.Infof("Chain state (height %d, hash %v, totaltx %d, work %v)",
-		b.bestNode.height, b.bestNode.hash, b.stateSnapshot.TotalTxns,
+		b.bestNode.height, b.bestNode.hash, b.BestSnapshot().TotalTxns,
 		b.bestNode.workSum)
 
 	return &b, nil
@@ -6,10 +6,14 @@
 package blockchain_test
 
 import (
+	"bytes"
+	"context"
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
 	"testing"
 )
 
@@ -107,3 +111,145 @@ func TestHaveBlock(t *testing.T) {
 		}
 	}
 }
+
+// TestContextCancellation ensures long running chain operations stop promptly
+// once their context is cancelled without leaving the chain locked.
+func TestContextCancellation(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("cancellation", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Extend the chain far enough that iterating the utxo set and the
+	// block hashes requires several cancellation checks.
+	const numBlocks = 3 * blockchain.TstCancelCheckInterval
+	prev := params.GenesisBlock
+	for i := 0; i < numBlocks; i++ {
+		block, err := multiChainBlock(&params, prev)
+		if err != nil {
+			t.Fatalf("Unable to create block: %v", err)
+		}
+		if _, _, err := chain.ProcessBlock(block, blockchain.BFNone); err != nil {
+			t.Fatalf("ProcessBlock at height %d: %v", i+1, err)
+		}
+		prev = block.MsgBlock()
+	}
+
+	// Ensure a full iteration visits every entry.
+	var numEntries int
+	err = chain.ForEachUtxoContext(context.Background(),
+		func(*chainhash.Hash, *blockchain.UtxoEntry) error {
+			numEntries++
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("ForEachUtxoContext: unexpected error: %v", err)
+	}
+	if numEntries != numBlocks+1 {
+		t.Fatalf("ForEachUtxoContext: got %d entries, want %d",
+			numEntries, numBlocks+1)
+	}
+
+	// Cancel the context part of the way through an iteration and ensure
+	// it stops by the next check with the context error.
+	ctx, cancel := context.WithCancel(context.Background())
+	numEntries = 0
+	err = chain.ForEachUtxoContext(ctx,
+		func(*chainhash.Hash, *blockchain.UtxoEntry) error {
+			numEntries++
+			if numEntries == 10 {
+				cancel()
+			}
+			return nil
+		})
+	if err != context.Canceled {
+		t.Fatalf("ForEachUtxoContext: got error %v, want %v", err,
+			context.Canceled)
+	}
+	if numEntries > blockchain.TstCancelCheckInterval {
+		t.Fatalf("ForEachUtxoContext: visited %d entries after "+
+			"cancellation, want at most %d", numEntries,
+			blockchain.TstCancelCheckInterval)
+	}
+
+	hashes, err := chain.HeightRangeContext(ctx, 0, numBlocks)
+	if err != context.Canceled || hashes != nil {
+		t.Fatalf("HeightRangeContext: got %d hashes and error %v, "+
+			"want none and %v", len(hashes), err, context.Canceled)
+	}
+
+	// Ensure the aborted operations did not leave the chain locked by
+	// connecting another block and fetching the hashes again.
+	block, err := multiChainBlock(&params, prev)
+	if err != nil {
+		t.Fatalf("Unable to create block: %v", err)
+	}
+	if _, _, err := chain.ProcessBlock(block, blockchain.BFNone); err != nil {
+		t.Fatalf("ProcessBlock after cancellation: %v", err)
+	}
+	hashes, err = chain.HeightRange(0, numBlocks+2)
+	if err != nil {
+		t.Fatalf("HeightRange: unexpected error: %v", err)
+	}
+	if len(hashes) != numBlocks+2 {
+		t.Fatalf("HeightRange: got %d hashes, want %d", len(hashes),
+			numBlocks+2)
+	}
+}
+
+// TestFetchSpentTxOuts ensures the outputs spent by a main chain block are
+// loaded from the spend journal, including outputs of transactions which still
+// have unspent outputs and thus do not encode their version.
+func TestFetchSpentTxOuts(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("fetchspenttxouts", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+
+	// The first block spends the root thread output of the genesis block
+	// while the other outputs of the genesis coinbase remain unspent.
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("Failed to create private key: %v", err)
+	}
+	if _, err := extendMultiChain(chain, &params, 2, privKey.PubKey()); err != nil {
+		t.Fatal(err)
+	}
+	block, err := chain.BlockByHeight(1)
+	if err != nil {
+		t.Fatalf("BlockByHeight: unexpected error: %v", err)
+	}
+	spent, err := chain.FetchSpentTxOuts(block)
+	if err != nil {
+		t.Fatalf("FetchSpentTxOuts: unexpected error: %v", err)
+	}
+	genesisTx := params.GenesisBlock.Transactions[0]
+	genesisTxHash := genesisTx.TxHash()
+	threadOutPoint := wire.NewOutPoint(&genesisTxHash,
+		uint32(provautil.RootThread))
+	want := genesisTx.TxOut[provautil.RootThread]
+	got, ok := spent[*threadOutPoint]
+	if len(spent) != 1 || !ok {
+		t.Fatalf("FetchSpentTxOuts: got %d outputs, want the root "+
+			"thread output", len(spent))
+	}
+	if got.Value != want.Value || !bytes.Equal(got.PkScript, want.PkScript) {
+		t.Fatalf("FetchSpentTxOuts: got output %v, want %v", got, want)
+	}
+
+	// Blocks which spend nothing have no spent outputs.
+	block, err = chain.BlockByHeight(2)
+	if err != nil {
+		t.Fatalf("BlockByHeight: unexpected error: %v", err)
+	}
+	spent, err = chain.FetchSpentTxOuts(block)
+	if err != nil || len(spent) != 0 {
+		t.Fatalf("FetchSpentTxOuts: got %d outputs, err %v, want none",
+			len(spent), err)
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// chainExportChunkSize is the number of blocks ExportChainData reads while
+// holding the chain state lock.  The lock is released between chunks so block
+// processing isn't stalled for the whole export.
+const chainExportChunkSize = 500
+
+// ChainDataRow houses the flat summary of a main chain block which is written
+// by ExportChainData.
+type ChainDataRow struct {
+	Height       uint32
+	Hash         chainhash.Hash
+	Time         time.Time
+	Size         int
+	TxCount      int
+	FeeTotal     int64
+	SignerKey    wire.BlockValidatingPubKey
+	AdminOpCount int
+}
+
+// ChainDataWriter is the interface implemented by the formats chain data can
+// be exported in.
+type ChainDataWriter interface {
+	// WriteRow writes the row of the next block.
+	WriteRow(row *ChainDataRow) error
+
+	// Flush writes any buffered rows.  It is called after each chunk of
+	// blocks, so the rows which were flushed are complete when the export
+	// stops early.
+	Flush() error
+}
+
+// chainDataCSVColumns are the names of the columns of chain data exported as
+// CSV, in the order of the fields of ChainDataRow.
+var chainDataCSVColumns = []string{"height", "hash", "time", "size",
+	"tx_count", "fee_total", "signer_key", "admin_op_count"}
+
+// csvChainDataWriter writes chain data as CSV with one line per block.  Times
+// are unix timestamps, fees are in atoms, and signer keys are hex-encoded.
+type csvChainDataWriter struct {
+	w           *csv.Writer
+	writeHeader bool
+}
+
+// Ensure csvChainDataWriter implements the ChainDataWriter interface.
+var _ ChainDataWriter = (*csvChainDataWriter)(nil)
+
+// WriteRow writes the passed row as a line of CSV, preceded by the header line
+// naming the columns for the first row when requested.
+//
+// This is part of the ChainDataWriter interface.
+func (c *csvChainDataWriter) WriteRow(row *ChainDataRow) error {
+	if c.writeHeader {
+		if err := c.w.Write(chainDataCSVColumns); err != nil {
+			return err
+		}
+		c.writeHeader = false
+	}
+	return c.w.Write([]string{
+		strconv.FormatUint(uint64(row.Height), 10),
+		row.Hash.String(),
+		strconv.FormatInt(row.Time.Unix(), 10),
+		strconv.Itoa(row.Size),
+		strconv.Itoa(row.TxCount),
+		strconv.FormatInt(row.FeeTotal, 10),
+		hex.EncodeToString(row.SignerKey[:]),
+		strconv.Itoa(row.AdminOpCount),
+	})
+}
+
+// Flush writes the buffered lines to the underlying writer.
+//
+// This is part of the ChainDataWriter interface.
+func (c *csvChainDataWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// NewCSVChainDataWriter returns a ChainDataWriter which writes chain data as
+// CSV to the passed writer.  The first line names the columns when the passed
+// flag is set, which is typically not the case when appending to an export
+// which is resumed.
+func NewCSVChainDataWriter(w io.Writer, writeHeader bool) ChainDataWriter {
+	return &csvChainDataWriter{
+		w:           csv.NewWriter(w),
+		writeHeader: writeHeader,
+	}
+}
+
+// spendJournalInputTotals returns the total amount of the inputs of each of
+// the passed transactions, which must be the transactions of a block other
+// than the coinbase, from the passed serialized spend journal entry of the
+// block.  Unlike deserializeSpendJournalEntry, it only decodes the amounts
+// of the spent outputs, so it doesn't need the utxos they were spent from.
+func spendJournalInputTotals(serialized []byte, txns []*wire.MsgTx) ([]int64, error) {
+	// The stxos are serialized in reverse order, so they are read from
+	// the last input of the last transaction on.
+	totals := make([]int64, len(txns))
+	var offset int
+	for txIdx := len(txns) - 1; txIdx > -1; txIdx-- {
+		for range txns[txIdx].TxIn {
+			if offset >= len(serialized) {
+				return nil, errDeserialize("unexpected end of " +
+					"spend journal entry")
+			}
+
+			// Skip the header code, and the version of the
+			// containing transaction when the header code is set.
+			code, bytesRead := deserializeVLQ(serialized[offset:])
+			offset += bytesRead
+			if code != 0 {
+				_, bytesRead = deserializeVLQ(serialized[offset:])
+				offset += bytesRead
+			}
+			if offset >= len(serialized) {
+				return nil, errDeserialize("unexpected end of " +
+					"data after header code")
+			}
+
+			// The size of the compressed script doesn't depend on
+			// the version of the containing transaction.
+			compAmount, scriptSize, bytesRead, err := decodeSpentAmount(
+				serialized[offset:])
+			if err != nil {
+				return nil, err
+			}
+			offset += bytesRead + scriptSize
+			totals[txIdx] += int64(decompressTxOutAmount(compAmount))
+		}
+	}
+	return totals, nil
+}
+
+// decodeSpentAmount decodes the compressed amount at the start of the passed
+// compressed txout and returns it along with the number of bytes it occupied
+// and the size of the compressed script which follows it.
+func decodeSpentAmount(serialized []byte) (uint64, int, int, error) {
+	compAmount, bytesRead := deserializeVLQ(serialized)
+	if bytesRead >= len(serialized) {
+		return 0, 0, bytesRead, errDeserialize("unexpected end of " +
+			"data after compressed amount")
+	}
+	scriptSize := decodeCompressedScriptSize(serialized[bytesRead:], 0)
+	if len(serialized[bytesRead:]) < scriptSize {
+		return 0, 0, bytesRead, errDeserialize("unexpected end of " +
+			"data after script size")
+	}
+	return compAmount, scriptSize, bytesRead, nil
+}
+
+// dbFetchBlockFees uses an existing database transaction to compute the total
+// fees paid by the transactions of the passed main chain block from its spend
+// journal entry.
+func dbFetchBlockFees(dbTx database.Tx, block *provautil.Block) (int64, error) {
+	txFees, err := dbFetchBlockTxFees(dbTx, block)
+	if err != nil {
+		return 0, err
+	}
+	var fees int64
+	for _, fee := range txFees {
+		fees += fee
+	}
+	return fees, nil
+}
+
+// blockAdminOpCount returns the number of admin operations performed by the
+// passed main chain block, which is the number of records AdminOpsInBlock
+// returns for it.
+func blockAdminOpCount(block *provautil.Block) int {
+	var count int
+	for _, tx := range blockAdminTxs(block) {
+		threadInt, adminOutputs := txscript.GetAdminDetails(tx)
+		threadID := provautil.ThreadID(threadInt)
+		if threadID == provautil.IssueThread {
+			count++
+			continue
+		}
+		for _, adminOutput := range adminOutputs {
+			if txscript.IsUpgradableAdminOp(adminOutput) ||
+				txscript.IsValidAdminOp(adminOutput, threadID) {
+
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// dbFetchChainDataRow uses an existing database transaction to build the row
+// of the passed main chain block at the passed height.
+func dbFetchChainDataRow(dbTx database.Tx, block *provautil.Block, height uint32) (*ChainDataRow, error) {
+	fees, err := dbFetchBlockFees(dbTx, block)
+	if err != nil {
+		return nil, err
+	}
+	header := &block.MsgBlock().Header
+	return &ChainDataRow{
+		Height:       height,
+		Hash:         *block.Hash(),
+		Time:         header.Timestamp,
+		Size:         block.MsgBlock().SerializeSize(),
+		TxCount:      len(block.MsgBlock().Transactions),
+		FeeTotal:     fees,
+		SignerKey:    header.ValidatingPubKey,
+		AdminOpCount: blockAdminOpCount(block),
+	}, nil
+}
+
+// ExportChainData writes a row summarizing each main chain block from the
+// passed start height to the best height as of when the export starts, in
+// height order, to the passed writer.  It returns the height of the last
+// block written.
+//
+// The blocks are read in chunks and the chain state lock is released between
+// them, so the main chain may be reorganized while exporting.  The export stops
+// with an error when a reorganization replaced any of the blocks which were
+// written.  The rows of the chunks which were written before an error, or
+// before the passed context was cancelled, are flushed, so the export can be
+// resumed from the height after the last row.  The passed progress function,
+// which may be nil, is called with the height of the last block written and
+// the height the export ends at after each chunk.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ExportChainData(ctx context.Context, w ChainDataWriter, startHeight uint32, progress func(height, endHeight uint32)) (uint32, error) {
+	endHeight := b.BestSnapshot().Height
+	if startHeight > endHeight {
+		return 0, fmt.Errorf("start height %d is beyond the best "+
+			"height %d", startHeight, endHeight)
+	}
+
+	var prevHash *chainhash.Hash
+	for height := startHeight; height <= endHeight; {
+		chunkEnd := height + chainExportChunkSize - 1
+		if chunkEnd > endHeight || chunkEnd < height {
+			chunkEnd = endHeight
+		}
+		rows, parentHash, err := b.fetchChainDataRows(ctx, height,
+			chunkEnd)
+		if err != nil {
+			return 0, err
+		}
+
+		// The first block of the chunk must extend the last block
+		// written, since a reorganization may have happened while the
+		// chain state lock was released.
+		if prevHash != nil && parentHash != *prevHash {
+			return 0, fmt.Errorf("the main chain was reorganized "+
+				"below height %d while exporting", height)
+		}
+		for _, row := range rows {
+			if err := w.WriteRow(row); err != nil {
+				return 0, err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return 0, err
+		}
+		if progress != nil {
+			progress(chunkEnd, endHeight)
+		}
+		if chunkEnd == endHeight {
+			break
+		}
+		prevHash = &rows[len(rows)-1].Hash
+		height = chunkEnd + 1
+	}
+	return endHeight, nil
+}
+
+// fetchChainDataRows returns the rows of the main chain blocks from the passed
+// start height to the passed end height along with the hash of the parent of
+// the first of them, so the caller can tell whether they extend the blocks it
+// fetched before.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) fetchChainDataRows(ctx context.Context, startHeight, endHeight uint32) ([]*ChainDataRow, chainhash.Hash, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	var parentHash chainhash.Hash
+	if endHeight > b.bestNode.height {
+		return nil, parentHash, fmt.Errorf("the main chain was "+
+			"reorganized below height %d while exporting", endHeight)
+	}
+
+	rows := make([]*ChainDataRow, 0, endHeight-startHeight+1)
+	err := b.db.View(func(dbTx database.Tx) error {
+		for height := startHeight; height <= endHeight; height++ {
+			if (height-startHeight)%cancelCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			block, err := dbFetchBlockByHeight(dbTx,
+				b.chainParams, height)
+			if err != nil {
+				return err
+			}
+			if height == startHeight {
+				parentHash = block.MsgBlock().Header.PrevBlock
+			}
+			row, err := dbFetchChainDataRow(dbTx, block, height)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, row)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, parentHash, err
+	}
+	return rows, parentHash, nil
+}
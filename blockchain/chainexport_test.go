@@ -0,0 +1,170 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+)
+
+// TestExportChainData ensures the rows exported for a regtest chain describe
+// every main chain block in height order, that exports resumed from a height
+// continue where the earlier ones stopped, and that cancelled exports stop.
+func TestExportChainData(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	params := &chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("exportchaindata", params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	for _, test := range tests {
+		for _, item := range test {
+			item, ok := item.(fullblocktests.AcceptedBlock)
+			if !ok {
+				continue
+			}
+			block := provautil.NewBlock(item.Block)
+			_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock %s: unexpected error: %v",
+					item.Name, err)
+			}
+		}
+	}
+	bestHeight := chain.BestSnapshot().Height
+
+	var buf bytes.Buffer
+	var lastProgress uint32
+	endHeight, err := chain.ExportChainData(context.Background(),
+		blockchain.NewCSVChainDataWriter(&buf, true), 0,
+		func(height, end uint32) {
+			if height <= lastProgress || end != bestHeight {
+				t.Errorf("unexpected progress %d of %d", height, end)
+			}
+			lastProgress = height
+		})
+	if err != nil {
+		t.Fatalf("ExportChainData: unexpected error: %v", err)
+	}
+	if endHeight != bestHeight || lastProgress != bestHeight {
+		t.Fatalf("export ended at height %d with progress %d, want %d",
+			endHeight, lastProgress, bestHeight)
+	}
+	records, err := csv.NewReader(bytes.NewReader(buf.Bytes())).ReadAll()
+	if err != nil {
+		t.Fatalf("unable to parse the export: %v", err)
+	}
+	if len(records) != int(bestHeight)+2 {
+		t.Fatalf("got %d lines, want a header and %d rows",
+			len(records), bestHeight+1)
+	}
+	header := "height,hash,time,size,tx_count,fee_total,signer_key," +
+		"admin_op_count"
+	if got := strings.Join(records[0], ","); got != header {
+		t.Fatalf("got header %q, want %q", got, header)
+	}
+
+	// Check the rows against the blocks.  Regtest doesn't burn fees,
+	// so the coinbase pays exactly the subsidy and the fees.
+	var numFees, numAdminOps int
+	for height := uint32(0); height <= bestHeight; height++ {
+		record := records[height+1]
+		block, err := chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockByHeight(%d): unexpected error: %v",
+				height, err)
+		}
+		msgBlock := block.MsgBlock()
+		var coinbaseOut int64
+		for _, txOut := range msgBlock.Transactions[0].TxOut {
+			coinbaseOut += txOut.Value
+		}
+		fees := coinbaseOut - blockchain.CalcBlockSubsidy(height, params)
+		if height == 0 {
+			fees = 0
+		}
+		ops, err := chain.AdminOpsInBlock(block.Hash())
+		if err != nil {
+			t.Fatalf("AdminOpsInBlock(%d): unexpected error: %v",
+				height, err)
+		}
+		want := []string{
+			strconv.Itoa(int(height)),
+			block.Hash().String(),
+			strconv.FormatInt(msgBlock.Header.Timestamp.Unix(), 10),
+			strconv.Itoa(msgBlock.SerializeSize()),
+			strconv.Itoa(len(msgBlock.Transactions)),
+			strconv.FormatInt(fees, 10),
+			hex.EncodeToString(msgBlock.Header.ValidatingPubKey[:]),
+			strconv.Itoa(len(ops)),
+		}
+		for i := range want {
+			if record[i] != want[i] {
+				t.Fatalf("height %d: got %s %s, want %s", height,
+					records[0][i], record[i], want[i])
+			}
+		}
+		if fees > 0 {
+			numFees++
+		}
+		if len(ops) > 0 {
+			numAdminOps++
+		}
+	}
+	if numFees == 0 || numAdminOps == 0 {
+		t.Fatalf("checked %d blocks with fees and %d with admin "+
+			"ops", numFees, numAdminOps)
+	}
+
+	// An export resumed from a height without a header continues the
+	// earlier export.
+	resumeHeight := bestHeight / 2
+	var resumed bytes.Buffer
+	_, err = chain.ExportChainData(context.Background(),
+		blockchain.NewCSVChainDataWriter(&resumed, false), resumeHeight,
+		nil)
+	if err != nil {
+		t.Fatalf("ExportChainData: unexpected error: %v", err)
+	}
+	prefix := records[:resumeHeight+1]
+	var want bytes.Buffer
+	w := csv.NewWriter(&want)
+	w.WriteAll(prefix)
+	want.Write(resumed.Bytes())
+	if !bytes.Equal(want.Bytes(), buf.Bytes()) {
+		t.Fatalf("resumed export doesn't continue the full export")
+	}
+
+	// Cancelled exports and exports beyond the best block stop with an
+	// error.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = chain.ExportChainData(ctx,
+		blockchain.NewCSVChainDataWriter(&bytes.Buffer{}, true), 0, nil)
+	if err != context.Canceled {
+		t.Fatalf("got error %v for a cancelled export, want %v", err,
+			context.Canceled)
+	}
+	_, err = chain.ExportChainData(context.Background(),
+		blockchain.NewCSVChainDataWriter(&bytes.Buffer{}, true),
+		bestHeight+1, nil)
+	if err == nil {
+		t.Fatalf("export beyond the best block succeeded")
+	}
+}
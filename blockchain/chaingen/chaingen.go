@@ -0,0 +1,522 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chaingen
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// privKeyFromHex returns the private key with the passed hex encoding.
+func privKeyFromHex(s string) *btcec.PrivateKey {
+	keyBytes, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
+	return privKey
+}
+
+var (
+	// validatePrivKey is the private key of one of the validate keys of the
+	// regression test network, which signs the generated blocks.
+	validatePrivKey = privKeyFromHex("4015289a228658047520f0d0abe7ad49" +
+		"abc77f6be0be63b36b94b83c2d1fd977")
+
+	// rootPrivKeys are the private keys of the root keys of the regression
+	// test network, which sign the admin transactions.
+	rootPrivKeys = []txscript.PrivateKey{
+		{privKeyFromHex("eaf02ca348c524e6392655ba4d29603cd1a7347d9d65" +
+			"cfe93ce1ebffdca22694"), true},
+		{privKeyFromHex("2b8c52b77b327c755b9b375500d3f4b2da9b0a1ff65f" +
+			"6891d311fe94295bc26a"), true},
+	}
+
+	// aspPrivKeys are the private keys of the ASP keys with the keyIDs 1
+	// and 2 of the regression test network, which sign the spends of the
+	// outputs the generated transactions pay to.
+	aspPrivKeys = []txscript.PrivateKey{rootPrivKeys[1], rootPrivKeys[0]}
+
+	// provisionPrivKey is the key the admin transactions alternately add to
+	// and revoke from the provision key set.
+	provisionPrivKey, _ = btcec.PrivKeyFromBytes(btcec.S256(),
+		chainhash.HashB([]byte("chaingen provision key")))
+)
+
+// Config describes the shape of a generated chain.
+type Config struct {
+	// Params are the parameters of the chain, which must be the regression
+	// test network parameters or a copy of them.  The coinbase outputs are
+	// only spent once they reach the coinbase maturity of the parameters.
+	Params *chaincfg.Params
+
+	// NumBlocks is the height of the best chain once all of the blocks
+	// are generated.
+	NumBlocks uint32
+
+	// TxPerBlock is the number of transactions other than the coinbase and
+	// the admin transaction in each block.  Each of them spends an output
+	// of a previous block, so blocks have fewer transactions while not
+	// enough outputs are spendable.
+	TxPerBlock int
+
+	// OutputsPerTx is the number of outputs of each transaction, which is
+	// how much the set of unspent outputs grows with each transaction.  It
+	// defaults to 1.
+	OutputsPerTx int
+
+	// AdminInterval is the number of blocks between blocks with an admin
+	// transaction, which alternately adds and revokes a provision key.
+	// Zero disables admin transactions.
+	AdminInterval uint32
+
+	// ReorgInterval is the number of blocks between reorganizations.  The
+	// best chain is reorganized ReorgDepth blocks deep after each block
+	// whose height is a multiple of the interval.  Zero disables
+	// reorganizations.
+	ReorgInterval uint32
+
+	// ReorgDepth is the number of blocks each reorganization disconnects.
+	// It must be at least 1 and less than ReorgInterval when
+	// reorganizations are enabled.
+	ReorgDepth uint32
+
+	// NumWorkers is the number of goroutines which sign the transactions of
+	// each block.  It defaults to the number of CPUs.
+	NumWorkers int
+}
+
+// Block is a generated block along with its role in the generated chain.
+type Block struct {
+	*provautil.Block
+
+	// IsSideChain is set for the blocks of a fork which do not have more
+	// work than the best chain yet, so they are not expected to extend the
+	// main chain when processed.
+	IsSideChain bool
+
+	// IsReorg is set for the block which gives a fork more work than the
+	// best chain, so processing it reorganizes the chain.
+	IsReorg bool
+}
+
+// BlockFunc is called with each generated block in the order the blocks are
+// meant to be processed.  Returning an error stops the generation.
+type BlockFunc func(block *Block) error
+
+// ProcessBlocks returns a BlockFunc which processes the generated blocks with
+// the passed chain instance and ensures they extend the main chain or a side
+// chain as expected.
+func ProcessBlocks(chain *blockchain.BlockChain) BlockFunc {
+	return func(block *Block) error {
+		isMainChain, isOrphan, err := chain.ProcessBlock(block.Block,
+			blockchain.BFNone)
+		if err != nil {
+			return err
+		}
+		if isOrphan || isMainChain == block.IsSideChain {
+			return fmt.Errorf("block %v (height %d) processed with "+
+				"main chain %v, orphan %v", block.Hash(),
+				block.MsgBlock().Header.Height, isMainChain,
+				isOrphan)
+		}
+		return nil
+	}
+}
+
+// spendableOut is an output of a generated transaction along with what is
+// needed to spend it.
+type spendableOut struct {
+	outPoint wire.OutPoint
+	amount   int64
+	pkScript []byte
+}
+
+// immatureOut is a coinbase output which can't be spent before it reaches the
+// coinbase maturity.
+type immatureOut struct {
+	spendableOut
+	height uint32
+}
+
+// chainState is the state of a generated chain at its tip.
+type chainState struct {
+	tip         *wire.MsgBlock
+	spendable   []spendableOut
+	immature    []immatureOut
+	rootThread  spendableOut
+	provisioned bool
+}
+
+// clone returns a copy of the chain state which doesn't share any slices with
+// it, so the copy is used to generate a fork.
+func (s *chainState) clone() *chainState {
+	clone := *s
+	clone.spendable = append([]spendableOut(nil), s.spendable...)
+	clone.immature = append([]immatureOut(nil), s.immature...)
+	return &clone
+}
+
+// generator generates the blocks of a chain described by a Config.
+type generator struct {
+	cfg        *Config
+	numWorkers int
+	branch     int
+}
+
+// payScript returns a script paying to an address which is unique to the
+// passed branch, height, transaction and output indexes, so the transactions
+// of forks are distinct.  The spends of the address are signed by the ASP keys.
+func (g *generator) payScript(height uint32, txIdx, outIdx int) ([]byte, error) {
+	pkHash := chainhash.HashB([]byte(fmt.Sprintf("chaingen-%d-%d-%d-%d",
+		g.branch, height, txIdx, outIdx)))[:20]
+	addr, err := provautil.NewAddressProva(pkHash, []btcec.KeyID{1, 2},
+		g.cfg.Params)
+	if err != nil {
+		return nil, err
+	}
+	return txscript.PayToAddrScript(addr)
+}
+
+// coinbaseTx returns the coinbase transaction of the block at the passed
+// height.
+func (g *generator) coinbaseTx(height uint32) (*wire.MsgTx, error) {
+	coinbaseScript, err := txscript.NewScriptBuilder().
+		AddData([]byte("/prova/")).Script()
+	if err != nil {
+		return nil, err
+	}
+	pkScript, err := g.payScript(height, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		Sequence:        wire.MaxTxInSequenceNum,
+		SignatureScript: coinbaseScript,
+	})
+	tx.AddTxOut(&wire.TxOut{
+		Value:    blockchain.CalcBlockSubsidy(height, g.cfg.Params),
+		PkScript: pkScript,
+	})
+	return tx, nil
+}
+
+// adminTx returns a signed admin transaction which spends the passed root
+// thread output in order to add the provision key, or to revoke it when it
+// was added.
+func (g *generator) adminTx(rootThread *spendableOut, revoke bool) (*wire.MsgTx, error) {
+	op := byte(txscript.AdminOpProvisionKeyAdd)
+	if revoke {
+		op = txscript.AdminOpProvisionKeyRevoke
+	}
+	data := make([]byte, 1+btcec.PubKeyBytesLenCompressed)
+	data[0] = op
+	copy(data[1:], provisionPrivKey.PubKey().SerializeCompressed())
+	opScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_RETURN).
+		AddData(data).Script()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: rootThread.outPoint,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxOut(wire.NewTxOut(rootThread.amount, rootThread.pkScript))
+	tx.AddTxOut(wire.NewTxOut(0, opScript))
+	lookupKey := func(provautil.Address) ([]txscript.PrivateKey, error) {
+		return rootPrivKeys, nil
+	}
+	sigScript, err := txscript.SignTxOutput(g.cfg.Params, tx, 0,
+		rootThread.amount, rootThread.pkScript, txscript.SigHashAll,
+		txscript.KeyClosure(lookupKey), nil)
+	if err != nil {
+		return nil, err
+	}
+	tx.TxIn[0].SignatureScript = sigScript
+	return tx, nil
+}
+
+// spendTx returns an unsigned transaction which spends the passed output to
+// OutputsPerTx new outputs for the transaction with the passed index in the
+// block at the passed height.  The amount of the output is split evenly
+// between the new outputs.
+func (g *generator) spendTx(spend *spendableOut, height uint32, txIdx int) (*wire.MsgTx, error) {
+	numOutputs := g.cfg.OutputsPerTx
+	if numOutputs < 1 {
+		numOutputs = 1
+	}
+
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: spend.outPoint,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	amount := spend.amount / int64(numOutputs)
+	for i := 0; i < numOutputs; i++ {
+		pkScript, err := g.payScript(height, txIdx, i)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			tx.AddTxOut(wire.NewTxOut(spend.amount-
+				amount*int64(numOutputs-1), pkScript))
+			continue
+		}
+		tx.AddTxOut(wire.NewTxOut(amount, pkScript))
+	}
+	return tx, nil
+}
+
+// signTxns signs the passed transactions, each of which spends the output at
+// the same index of the passed outputs, with NumWorkers goroutines.
+func (g *generator) signTxns(txns []*wire.MsgTx, spends []spendableOut) error {
+	lookupKey := func(provautil.Address) ([]txscript.PrivateKey, error) {
+		return aspPrivKeys, nil
+	}
+	errs := make([]error, len(txns))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < g.numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range work {
+				tx, spend := txns[idx], &spends[idx]
+				sigScript, err := txscript.SignTxOutput(
+					g.cfg.Params, tx, 0, spend.amount,
+					spend.pkScript, txscript.SigHashAll,
+					txscript.KeyClosure(lookupKey), nil)
+				tx.TxIn[0].SignatureScript = sigScript
+				errs[idx] = err
+			}
+		}()
+	}
+	for idx := range txns {
+		work <- idx
+	}
+	close(work)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextBlock returns a signed and solved block which extends the tip of the
+// passed chain state, and updates the state accordingly.
+func (g *generator) nextBlock(state *chainState) (*wire.MsgBlock, error) {
+	params := g.cfg.Params
+	height := state.tip.Header.Height + 1
+
+	// Coinbase outputs become spendable once they reach the coinbase
+	// maturity.
+	var numMature int
+	for _, out := range state.immature {
+		if height-out.height < uint32(params.CoinbaseMaturity) {
+			break
+		}
+		state.spendable = append(state.spendable, out.spendableOut)
+		numMature++
+	}
+	state.immature = state.immature[numMature:]
+
+	coinbase, err := g.coinbaseTx(height)
+	if err != nil {
+		return nil, err
+	}
+	txns := []*wire.MsgTx{coinbase}
+	if g.cfg.AdminInterval != 0 && height%g.cfg.AdminInterval == 0 {
+		adminTx, err := g.adminTx(&state.rootThread, state.provisioned)
+		if err != nil {
+			return nil, err
+		}
+		txns = append(txns, adminTx)
+		adminHash := adminTx.TxHash()
+		state.rootThread = spendableOut{
+			outPoint: *wire.NewOutPoint(&adminHash, 0),
+			amount:   adminTx.TxOut[0].Value,
+			pkScript: adminTx.TxOut[0].PkScript,
+		}
+		state.provisioned = !state.provisioned
+	}
+
+	// Spend the oldest spendable outputs.
+	numSpends := g.cfg.TxPerBlock
+	if numSpends > len(state.spendable) {
+		numSpends = len(state.spendable)
+	}
+	spends := state.spendable[:numSpends]
+	state.spendable = state.spendable[numSpends:]
+	spendTxns := make([]*wire.MsgTx, 0, numSpends)
+	for i := range spends {
+		tx, err := g.spendTx(&spends[i], height, i+1)
+		if err != nil {
+			return nil, err
+		}
+		spendTxns = append(spendTxns, tx)
+	}
+	if err := g.signTxns(spendTxns, spends); err != nil {
+		return nil, err
+	}
+	txns = append(txns, spendTxns...)
+
+	// Track the outputs of the new transactions.
+	coinbaseHash := coinbase.TxHash()
+	state.immature = append(state.immature, immatureOut{
+		spendableOut: spendableOut{
+			outPoint: *wire.NewOutPoint(&coinbaseHash, 0),
+			amount:   coinbase.TxOut[0].Value,
+			pkScript: coinbase.TxOut[0].PkScript,
+		},
+		height: height,
+	})
+	for _, tx := range spendTxns {
+		txHash := tx.TxHash()
+		for i, txOut := range tx.TxOut {
+			state.spendable = append(state.spendable, spendableOut{
+				outPoint: *wire.NewOutPoint(&txHash, uint32(i)),
+				amount:   txOut.Value,
+				pkScript: txOut.PkScript,
+			})
+		}
+	}
+
+	utilTxns := make([]*provautil.Tx, 0, len(txns))
+	for _, tx := range txns {
+		utilTxns = append(utilTxns, provautil.NewTx(tx))
+	}
+	merkles := blockchain.BuildMerkleTreeStore(utilTxns)
+
+	// Space the blocks out more than the target time so the required
+	// difficulty always remains at the proof of work limit.
+	block := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:    1,
+			PrevBlock:  state.tip.BlockHash(),
+			MerkleRoot: *merkles[len(merkles)-1],
+			Bits:       params.PowLimitBits,
+			Timestamp: state.tip.Header.Timestamp.Add(
+				2 * params.TargetTimePerBlock),
+			Height: height,
+		},
+		Transactions: txns,
+	}
+	block.Header.Size = uint32(block.SerializeSize())
+	if err := block.Header.Sign(validatePrivKey); err != nil {
+		return nil, err
+	}
+	target := blockchain.CompactToBig(params.PowLimitBits)
+	for nonce := uint64(1); ; nonce++ {
+		block.Header.Nonce = nonce
+		hash := block.Header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			break
+		}
+	}
+
+	state.tip = block
+	return block, nil
+}
+
+// Generate generates the chain described by the passed config on top of the
+// genesis block and calls the passed function with each of its blocks.  The
+// blocks which reorganize the chain are generated right after the block at each
+// multiple of ReorgInterval: a fork of ReorgDepth blocks from ReorgDepth blocks
+// below that block, followed by the block which makes the fork the best chain.
+// The best chain continues from the fork.  A reorganization which would make
+// the best chain longer than NumBlocks is skipped.
+func Generate(cfg *Config, fn BlockFunc) error {
+	if cfg.Params == nil {
+		return errors.New("no chain parameters")
+	}
+	if cfg.ReorgInterval != 0 &&
+		(cfg.ReorgDepth == 0 || cfg.ReorgDepth >= cfg.ReorgInterval) {
+
+		return fmt.Errorf("reorganization depth %d is not between 1 "+
+			"and the reorganization interval %d", cfg.ReorgDepth,
+			cfg.ReorgInterval)
+	}
+
+	g := &generator{cfg: cfg, numWorkers: cfg.NumWorkers}
+	if g.numWorkers <= 0 {
+		g.numWorkers = runtime.NumCPU()
+	}
+	genesis := cfg.Params.GenesisBlock
+	genesisHash := genesis.Transactions[0].TxHash()
+	rootOut := genesis.Transactions[0].TxOut[provautil.RootThread]
+	state := &chainState{
+		tip: genesis,
+		rootThread: spendableOut{
+			outPoint: *wire.NewOutPoint(&genesisHash,
+				uint32(provautil.RootThread)),
+			amount:   rootOut.Value,
+			pkScript: rootOut.PkScript,
+		},
+	}
+
+	var fork *chainState
+	for state.tip.Header.Height < cfg.NumBlocks {
+		block, err := g.nextBlock(state)
+		if err != nil {
+			return err
+		}
+		if err := fn(&Block{Block: provautil.NewBlock(block)}); err != nil {
+			return err
+		}
+		if cfg.ReorgInterval == 0 {
+			continue
+		}
+
+		// Remember the state at the fork point of the next
+		// reorganization, and generate the fork once the best chain
+		// reaches the height of the reorganization.
+		height := block.Header.Height
+		if (height+cfg.ReorgDepth)%cfg.ReorgInterval == 0 {
+			fork = state.clone()
+		}
+		if height%cfg.ReorgInterval != 0 || fork == nil ||
+			height+1 > cfg.NumBlocks {
+
+			continue
+		}
+		g.branch++
+		for i := uint32(0); i <= cfg.ReorgDepth; i++ {
+			block, err := g.nextBlock(fork)
+			if err != nil {
+				return err
+			}
+			err = fn(&Block{
+				Block:       provautil.NewBlock(block),
+				IsSideChain: i < cfg.ReorgDepth,
+				IsReorg:     i == cfg.ReorgDepth,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		state, fork = fork, nil
+	}
+	return nil
+}
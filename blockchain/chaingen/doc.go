@@ -0,0 +1,50 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package chaingen generates large synthetic chains for the regression test
+network which are used to benchmark the performance of the initial block
+download, reorganizations and index builds at a realistic scale.
+
+Unlike the fullblocktests package, which generates small chains exercising
+specific consensus rules, the chains generated by this package consist of
+thousands of valid blocks shaped by a Config: the number of transactions in each
+block, the number of outputs each transaction fans out to, how often the blocks
+contain admin transactions, and how often and how deep reorganizations are
+injected.  The transactions of a block are signed in parallel, so chains which
+are large enough for benchmarks are generated quickly, and a reduced size can be
+used in short test runs.
+
+Usage
+
+The blocks are streamed to a BlockFunc in the order they are meant to be
+processed.  ProcessBlocks returns a BlockFunc which processes them with a chain
+instance, which writes them to the database of the chain, such as the database
+in the data directory of a node:
+
+	params := chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  blockchain.NewMedianTime(),
+	})
+	if err != nil {
+		// Handle error
+	}
+	err = chaingen.Generate(&chaingen.Config{
+		Params:        &params,
+		NumBlocks:     5000,
+		TxPerBlock:    20,
+		OutputsPerTx:  2,
+		AdminInterval: 50,
+		ReorgInterval: 1000,
+		ReorgDepth:    10,
+	}, chaingen.ProcessBlocks(chain))
+
+The chain parameters must be the regression test network parameters, or a copy
+of them such as the one above, since the blocks and the admin transactions are
+signed with the keys of that network.  The generated chains are deterministic.
+*/
+package chaingen
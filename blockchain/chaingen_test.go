@@ -0,0 +1,96 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/blockchain/chaingen"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// TestChaingen ensures a chain generated by the chaingen package with
+// transactions, admin transactions and reorganizations is accepted by the
+// chain, ends at the configured height and is generated the same way every
+// time.
+func TestChaingen(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+
+	db, teardown := testChainDB(t, "chaingen", &params)
+	defer teardown()
+	chain := newTestChain(t, db, &params, nil)
+
+	cfg := &chaingen.Config{
+		Params:        &params,
+		NumBlocks:     60,
+		TxPerBlock:    8,
+		OutputsPerTx:  3,
+		AdminInterval: 7,
+		ReorgInterval: 20,
+		ReorgDepth:    5,
+		NumWorkers:    4,
+	}
+	process := chaingen.ProcessBlocks(chain)
+	var hashes []chainhash.Hash
+	var numTxns, numSideChain, numReorgs int
+	err := chaingen.Generate(cfg, func(block *chaingen.Block) error {
+		hashes = append(hashes, *block.Hash())
+		numTxns += len(block.Transactions())
+		if block.IsSideChain {
+			numSideChain++
+		}
+		if block.IsReorg {
+			numReorgs++
+		}
+		return process(block)
+	})
+	if err != nil {
+		t.Fatalf("Generate: unexpected error: %v", err)
+	}
+
+	// The reorganization after the last block is skipped since it would
+	// extend the chain past the configured height.
+	if numSideChain != 10 || numReorgs != 2 {
+		t.Fatalf("got %d side chain blocks and %d reorganizations, "+
+			"want 10 and 2", numSideChain, numReorgs)
+	}
+	if numTxns < len(hashes)*cfg.TxPerBlock/2 {
+		t.Fatalf("got %d transactions in %d blocks", numTxns,
+			len(hashes))
+	}
+	best := chain.BestSnapshot()
+	if best.Height != cfg.NumBlocks ||
+		!best.Hash.IsEqual(&hashes[len(hashes)-1]) {
+
+		t.Fatalf("got best block %v (height %d), want %v (height %d)",
+			best.Hash, best.Height, hashes[len(hashes)-1],
+			cfg.NumBlocks)
+	}
+
+	// Generating the chain again with a different number of workers yields
+	// the same blocks.
+	cfg.NumWorkers = 1
+	var i int
+	err = chaingen.Generate(cfg, func(block *chaingen.Block) error {
+		if i >= len(hashes) || !block.Hash().IsEqual(&hashes[i]) {
+			t.Fatalf("block #%d differs between generations", i)
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Generate: unexpected error: %v", err)
+	}
+
+	// Reorganizations must be shallower than their interval.
+	cfg.ReorgDepth = cfg.ReorgInterval
+	err = chaingen.Generate(cfg, func(*chaingen.Block) error { return nil })
+	if err == nil {
+		t.Fatalf("Generate: unexpected success with reorganization "+
+			"depth %d", cfg.ReorgDepth)
+	}
+}
@@ -7,13 +7,18 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
+	"github.com/bitgo/prova/blockchain/adminstate"
 	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
+	"math"
 	"math/big"
 	"sort"
 	"time"
@@ -44,6 +49,10 @@ var (
 	// admin key sets.
 	keySetBucketName = []byte("keyset")
 
+	// reorgStateKeyName is the name of the db key used to store the blocks
+	// of a reorganization of the main chain while it is in progress.
+	reorgStateKeyName = []byte("reorgstate")
+
 	// byteOrder is the preferred byte order used for serializing numeric
 	// fields for storage in the database.
 	byteOrder = binary.LittleEndian
@@ -117,6 +126,9 @@ func isDeserializeErr(err error) bool {
 //   bit 0 - containing transaction is a coinbase
 //   bits 1-x - height of the block that contains the spent txout
 //
+//   NOTE: The compressed txouts use the domain specific compression of the
+//   version of the chain state, just like the utxo set.
+//
 //   NOTE: The header code and version are only encoded when the spent txout was
 //   the final unspent output of the containing transaction.  Otherwise, the
 //   header code will be 0 and the version is not serialized at all.  This is
@@ -275,7 +287,7 @@ func decodeSpentTxOut(serialized []byte, stxo *spentTxOut, txVersion int32) (int
 		// corruption or this function is being called without the
 		// proper state.
 		if txVersion == 0 {
-			return offset, AssertError("decodeSpentTxOut called " +
+			return offset, assertError("decodeSpentTxOut called " +
 				"without a containing tx version when the " +
 				"serialized stxo that does not encode the " +
 				"version")
@@ -317,7 +329,7 @@ func deserializeSpendJournalEntry(serialized []byte, txns []*wire.MsgTx, view *U
 		// happen unless there is database corruption or an empty entry
 		// erroneously made its way into the database.
 		if numStxos != 0 {
-			return nil, AssertError(fmt.Sprintf("mismatched spend "+
+			return nil, assertError(fmt.Sprintf("mismatched spend "+
 				"journal serialization - no serialization for "+
 				"expected %d stxos", numStxos))
 		}
@@ -462,6 +474,7 @@ func dbRemoveSpendJournalEntry(dbTx database.Tx, blockHash *chainhash.Hash) erro
 // The serialized format is:
 //
 //   <version><height><header code><unspentness bitmap>[<compressed txouts>,...]
+//   [<num versioned><script versions>]
 //
 //   Field                Type     Size
 //   version              VLQ      variable
@@ -471,6 +484,20 @@ func dbRemoveSpendJournalEntry(dbTx database.Tx, blockHash *chainhash.Hash) erro
 //   compressed txouts
 //     compressed amount  VLQ      variable
 //     compressed script  []byte   variable
+//   num versioned        VLQ      variable
+//   script versions
+//     output index       VLQ      variable
+//     script version     VLQ      variable
+//
+// The compressed txouts use the domain specific compression of the version of
+// the chain state, so entries written by version 1 are only decoded to upgrade
+// the chain state.
+//
+// The script versions of the unspent outputs whose public key scripts carry a
+// script version other than the default one follow the compressed txouts,
+// ordered by output index.  They are omitted entirely when there are none, so
+// entries without such outputs are serialized as they were before script
+// versions were recorded.
 //
 // The serialized header code format is:
 //   bit 0 - containing transaction is a coinbase
@@ -577,7 +604,7 @@ func utxoEntryHeaderCode(entry *UtxoEntry, highestOutputIndex uint32) (uint64, i
 	var numBitmapBytesAdjustment int
 	if !output0Unspent && !output1Unspent {
 		if numBitmapBytes == 0 {
-			return 0, 0, AssertError("attempt to serialize utxo " +
+			return 0, 0, assertError("attempt to serialize utxo " +
 				"header for fully spent transaction")
 		}
 		numBitmapBytesAdjustment = 1
@@ -626,6 +653,7 @@ func serializeUtxoEntry(entry *UtxoEntry) ([]byte, error) {
 	size := serializeSizeVLQ(uint64(entry.version)) +
 		serializeSizeVLQ(uint64(entry.blockHeight)) +
 		serializeSizeVLQ(headerCode) + numBitmapBytes
+	var versioned []int
 	for _, outputIndex := range outputOrder {
 		out := entry.sparseOutputs[uint32(outputIndex)]
 		if out.spent {
@@ -633,6 +661,14 @@ func serializeUtxoEntry(entry *UtxoEntry) ([]byte, error) {
 		}
 		size += compressedTxOutSize(uint64(out.amount), out.pkScript,
 			entry.version, out.compressed)
+		if out.scriptVersion != txscript.DefaultScriptVersion {
+			versioned = append(versioned, outputIndex)
+			size += serializeSizeVLQ(uint64(outputIndex)) +
+				serializeSizeVLQ(uint64(out.scriptVersion))
+		}
+	}
+	if len(versioned) > 0 {
+		size += serializeSizeVLQ(uint64(len(versioned)))
 	}
 
 	// Serialize the version, block height of the containing transaction,
@@ -669,6 +705,17 @@ func serializeUtxoEntry(entry *UtxoEntry) ([]byte, error) {
 			out.compressed)
 	}
 
+	// Serialize the script versions of the unspent outputs which carry one.
+	if len(versioned) > 0 {
+		offset += putVLQ(serialized[offset:], uint64(len(versioned)))
+		for _, outputIndex := range versioned {
+			out := entry.sparseOutputs[uint32(outputIndex)]
+			offset += putVLQ(serialized[offset:], uint64(outputIndex))
+			offset += putVLQ(serialized[offset:],
+				uint64(out.scriptVersion))
+		}
+	}
+
 	return serialized, nil
 }
 
@@ -676,6 +723,20 @@ func serializeUtxoEntry(entry *UtxoEntry) ([]byte, error) {
 // slice into a new UtxoEntry using a format that is suitable for long-term
 // storage.  The format is described in detail above.
 func deserializeUtxoEntry(serialized []byte) (*UtxoEntry, error) {
+	return decodeUtxoEntry(serialized, currentChainStateVersion)
+}
+
+// deserializeUtxoEntryV1 decodes a utxo entry serialized by version 1 of the
+// chain state.  Unlike deserializeUtxoEntry, the outputs of the returned entry
+// are decompressed since they can only be compressed again with the current
+// version.
+func deserializeUtxoEntryV1(serialized []byte) (*UtxoEntry, error) {
+	return decodeUtxoEntry(serialized, chainStateVersion1)
+}
+
+// decodeUtxoEntry decodes a utxo entry serialized by the passed version of the
+// chain state.
+func decodeUtxoEntry(serialized []byte, chainStateVersion uint32) (*UtxoEntry, error) {
 	// Deserialize the version.
 	version, bytesRead := deserializeVLQ(serialized)
 	offset := bytesRead
@@ -752,6 +813,24 @@ func deserializeUtxoEntry(serialized []byte) (*UtxoEntry, error) {
 
 	// Decode and add all of the utxos.
 	for i, outputIndex := range outputIndexes {
+		// Outputs compressed by version 1 of the chain state are
+		// decompressed right away.
+		if chainStateVersion == chainStateVersion1 {
+			amount, pkScript, bytesRead, err := decodeCompressedTxOutV1(
+				serialized[offset:], int32(version))
+			if err != nil {
+				return nil, errDeserialize(fmt.Sprintf("unable "+
+					"to decode utxo at index %d: %v", i, err))
+			}
+			offset += bytesRead
+
+			entry.sparseOutputs[outputIndex] = &utxoOutput{
+				pkScript: pkScript,
+				amount:   int64(amount),
+			}
+			continue
+		}
+
 		// Decode the next utxo.  The script and amount fields of the
 		// utxo output are left compressed so decompression can be
 		// avoided on those that are not accessed.  This is done since
@@ -773,6 +852,41 @@ func deserializeUtxoEntry(serialized []byte) (*UtxoEntry, error) {
 		}
 	}
 
+	// Decode the script versions of the unspent outputs which carry one
+	// when there are any.
+	if offset == len(serialized) {
+		return entry, nil
+	}
+	numVersioned, bytesRead := deserializeVLQ(serialized[offset:])
+	offset += bytesRead
+	if numVersioned == 0 {
+		return nil, errDeserialize("empty script versions")
+	}
+	for i := uint64(0); i < numVersioned; i++ {
+		if offset >= len(serialized) {
+			return nil, errDeserialize("unexpected end of data " +
+				"for script versions")
+		}
+		outputIndex, bytesRead := deserializeVLQ(serialized[offset:])
+		offset += bytesRead
+		if offset >= len(serialized) {
+			return nil, errDeserialize("unexpected end of data " +
+				"after script version output index")
+		}
+		scriptVersion, bytesRead := deserializeVLQ(serialized[offset:])
+		offset += bytesRead
+
+		output, ok := entry.sparseOutputs[uint32(outputIndex)]
+		if !ok || scriptVersion == txscript.DefaultScriptVersion ||
+			scriptVersion > math.MaxUint16 {
+
+			return nil, errDeserialize(fmt.Sprintf("invalid script "+
+				"version %d for output %d", scriptVersion,
+				outputIndex))
+		}
+		output.scriptVersion = uint16(scriptVersion)
+	}
+
 	return entry, nil
 }
 
@@ -793,7 +907,7 @@ func dbFetchUtxoEntry(dbTx database.Tx, hash *chainhash.Hash) (*UtxoEntry, error
 	// A non-nil zero-length entry means there is an entry in the database
 	// for a fully spent transaction which should never be the case.
 	if len(serializedUtxo) == 0 {
-		return nil, AssertError(fmt.Sprintf("database contains entry "+
+		return nil, assertError(fmt.Sprintf("database contains entry "+
 			"for fully spent tx %v", hash))
 	}
 
@@ -953,199 +1067,48 @@ func dbFetchHashByHeight(dbTx database.Tx, height uint32) (*chainhash.Hash, erro
 // The key set consists of sets of keys that are used to administrate the chain.
 // The sets are ROOT, PROVISION, ISSUE, ASP, and VALIDATE keys.
 //
-//
-// The serialized format is:
-//
-//   Field                 Type        Size
-//   root thread tip       Hash        chainhash.HashSize
-//   provision thread tip  Hash        chainhash.HashSize
-//   issue thread tip      Hash        chainhash.HashSize
-//   keyID counter		   KeyID       4 bytes
-//   totalSupply           uint64      8 bytes
-//   root keys length      uint32      4 bytes
-//   root keys             []byte      root length * 33
-//   provision keys length uint32      4 bytes
-//   provision keys.       []byte      provision key length * 33
-//   issue keys length     uint32      4 bytes
-//   issue keys            []byte      issue key length * 33
-//   validate keys length  uint32      4 bytes
-//   validate keys         []byte      Validate length * 33
-//   ASP keys length       uint32      4 bytes
-//   keyID / ASP keys      []pairs     Pair length * 37
-
+// The key set is stored along with the thread tips, the keyID counter, the ASP
+// keys of the revoked keyIDs and the total supply as the serialized admin state
+// of the adminstate package.  See its Serialize function for the serialized
+// format.
 // -----------------------------------------------------------------------------
 
-// adminKeysOrder is a helper to itterate maps of key sets in order.
-var adminKeysOrder = []btcec.KeySetType{
-	btcec.RootKeySet,
-	btcec.ProvisionKeySet,
-	btcec.IssueKeySet,
-	btcec.ValidateKeySet,
-}
-
-// threadOrder is a helper to iterate maps of thread tips in order.
-var threadOrder = []provautil.ThreadID{
-	provautil.RootThread,
-	provautil.ProvisionThread,
-	provautil.IssueThread,
-}
-
-// serializeKeySet returns the serialization of the passed key sets.
-// This is data to be stored in the key bucket.
+// serializeKeySet returns the serialization of the passed admin state in the
+// format of the adminstate package.  This is data to be stored in the key
+// bucket.
 func serializeKeySet(adminKeySets map[btcec.KeySetType]btcec.PublicKeySet,
-	aspKeyIdMap btcec.KeyIdMap, threadTips map[provautil.ThreadID]*wire.OutPoint,
-	lastKeyID btcec.KeyID, totalSupply uint64) []byte {
-	// Calculate the full size needed to serialize the chain state.
-	serializedLen := uint32(0)
-	// Add 3 thread tips + last keyID + total supply (uint64)
-	serializedLen += uint32(3*(chainhash.HashSize+4) + btcec.KeyIDSize + 8)
-	for _, keySet := range adminKeysOrder {
-		serializedLen += 4 //one uint32 for size of key set
-		serializedLen += uint32(len(adminKeySets[keySet]) * btcec.PubKeyBytesLenCompressed)
-	}
-	serializedLen += 4 + uint32(len(aspKeyIdMap)*(4+btcec.PubKeyBytesLenCompressed))
-	// Serialize the chain state.
-	serializedData := make([]byte, serializedLen)
-	offset := 0
-
-	// Add thread tips + counters
-	for _, threadId := range threadOrder {
-		if threadTips[threadId] != nil {
-			copy(serializedData[offset:], threadTips[threadId].Hash[:])
-		}
-		offset += chainhash.HashSize
-		if threadTips[threadId] != nil {
-			byteOrder.PutUint32(serializedData[offset:], threadTips[threadId].Index)
-		}
-		offset += 4
-	}
-	byteOrder.PutUint32(serializedData[offset:], uint32(lastKeyID))
-	offset += btcec.KeyIDSize
-	byteOrder.PutUint64(serializedData[offset:], totalSupply)
-	offset += 8
-
-	// When iterating over a map with a range loop, the iteration order is not
-	// specified and is not guaranteed to be the same from one iteration to the
-	// next. So we use keySetOrder to do a sorted itteration.
-	for _, keySet := range adminKeysOrder {
-		setLength := len(adminKeySets[keySet])
-		byteOrder.PutUint32(serializedData[offset:], uint32(setLength))
-		offset += 4
-		for _, key := range adminKeySets[keySet] {
-			copy(serializedData[offset:], key.SerializeCompressed())
-			offset += btcec.PubKeyBytesLenCompressed
-		}
-	}
-	// Serialize keyID to ASP Key map
-	byteOrder.PutUint32(serializedData[offset:], uint32(len(aspKeyIdMap)))
-	offset += 4
-
-	// To have a deterministic order of serialization of a map, we take all keys
-	// and sort them by keyID, then serialize in that order.
-	var keyIDs []int
-	for k := range aspKeyIdMap {
-		keyIDs = append(keyIDs, int(k))
-	}
-	sort.Ints(keyIDs)
-	for _, keyID := range keyIDs {
-		pubKey := aspKeyIdMap[btcec.KeyID(keyID)]
-		byteOrder.PutUint32(serializedData[offset:], uint32(keyID))
-		offset += 4
-		copy(serializedData[offset:], pubKey.SerializeCompressed())
-		offset += btcec.PubKeyBytesLenCompressed
-	}
-	return serializedData[:]
+	aspKeyIdMap btcec.KeyIdMap, revokedKeys map[btcec.KeyID]adminstate.RevokedKey,
+	threadTips map[provautil.ThreadID]*wire.OutPoint, lastKeyID btcec.KeyID,
+	totalSupply uint64) []byte {
+
+	state := adminstate.State{
+		ThreadTips:  threadTips,
+		LastKeyID:   lastKeyID,
+		TotalSupply: totalSupply,
+		KeySets:     adminKeySets,
+		KeyIDs:      aspKeyIdMap,
+		RevokedKeys: revokedKeys,
+	}
+	return state.Serialize()
 }
 
-// deserializeKeySet deserializes the passed serialized best chain
-// state.  This is data stored in the chain state bucket and is updated after
-// every block is connected or disconnected form the main chain.
-// block.
+// deserializeKeySet deserializes the passed serialized admin state.  This is
+// data stored in the key bucket and is updated after every block is connected
+// or disconnected from the main chain.
 func deserializeKeySet(serializedData []byte) (
 	map[btcec.KeySetType]btcec.PublicKeySet, btcec.KeyIdMap,
+	map[btcec.KeyID]adminstate.RevokedKey,
 	map[provautil.ThreadID]*wire.OutPoint, btcec.KeyID, uint64, error) {
 
-	offset := 0
-
-	// thread tips + counters length
-	lenNeeded := 3*(chainhash.HashSize+4) + btcec.KeyIDSize + 8
-	if len(serializedData[offset:]) < lenNeeded {
-		return nil, nil, nil, 0, 0, database.Error{
-			ErrorCode:   database.ErrCorruption,
-			Description: "corrupt admin state, thread tips can be read",
-		}
-	}
-
-	threadTips := make(map[provautil.ThreadID]*wire.OutPoint)
-	for _, threadId := range threadOrder {
-
-		hash, _ := chainhash.NewHash(serializedData[offset : offset+chainhash.HashSize])
-		offset += chainhash.HashSize
-		index := byteOrder.Uint32(serializedData[offset : offset+4])
-		offset += 4
-		threadTip := wire.NewOutPoint(hash, index)
-		threadTips[threadId] = threadTip
-	}
-	lastKeyID := btcec.KeyID(byteOrder.Uint32(serializedData[offset : offset+btcec.KeyIDSize]))
-	offset += btcec.KeyIDSize
-	totalSupply := byteOrder.Uint64(serializedData[offset : offset+8])
-	offset += 8
-
-	adminKeys := make(map[btcec.KeySetType]btcec.PublicKeySet)
-	for _, keySet := range adminKeysOrder {
-		// Ensure the serialized data has enough bytes to read length of a set.
-		if len(serializedData[offset:]) < 4 {
-			return nil, nil, nil, 0, 0, database.Error{
-				ErrorCode:   database.ErrCorruption,
-				Description: "corrupt admin state, no keys can be read",
-			}
-		}
-		keySetLength := byteOrder.Uint32(serializedData[offset : offset+4])
-		offset += 4
-		// Ensure the serialized data has enough bytes to deserialize the keys.
-		if uint32(len(serializedData[offset:])) < keySetLength*btcec.PubKeyBytesLenCompressed {
-			return nil, nil, nil, 0, 0, database.Error{
-				ErrorCode:   database.ErrCorruption,
-				Description: "corrupt admin state, not all keys can be read",
-			}
-		}
-		adminKeys[keySet] = make([]btcec.PublicKey, keySetLength)
-		for i := 0; i < int(keySetLength); i++ {
-			pubKey, _ := btcec.ParsePubKey(
-				serializedData[offset:offset+btcec.PubKeyBytesLenCompressed], btcec.S256())
-			adminKeys[keySet][i] = *pubKey
-			offset += btcec.PubKeyBytesLenCompressed
-		}
-	}
-
-	// Ensure the serialized data has enough bytes to read length of the map.
-	if len(serializedData[offset:]) < 4 {
-		return nil, nil, nil, 0, 0, database.Error{
-			ErrorCode:   database.ErrCorruption,
-			Description: "corrupt admin state, no keyIDs can be read",
-		}
-	}
-	// Deserialize keyIDs
-	keyIdMapLen := byteOrder.Uint32(serializedData[offset : offset+4])
-	offset += 4
-	// Ensure the serialized data has enough bytes to deserialize the keys
-	if uint32(len(serializedData[offset:])) < keyIdMapLen*(4+btcec.PubKeyBytesLenCompressed) {
-		return nil, nil, nil, 0, 0, database.Error{
+	state, err := adminstate.Deserialize(serializedData)
+	if err != nil {
+		return nil, nil, nil, nil, 0, 0, database.Error{
 			ErrorCode:   database.ErrCorruption,
-			Description: "corrupt admin state, not all keyIDs can be read",
+			Description: err.Error(),
 		}
 	}
-	aspKeyIdMap := make(map[btcec.KeyID]*btcec.PublicKey)
-	for i := 0; i < int(keyIdMapLen); i++ {
-		keyID := btcec.KeyID(byteOrder.Uint32(serializedData[offset : offset+4]))
-		offset += 4
-		pubKey, _ := btcec.ParsePubKey(
-			serializedData[offset:offset+btcec.PubKeyBytesLenCompressed], btcec.S256())
-		offset += btcec.PubKeyBytesLenCompressed
-		aspKeyIdMap[keyID] = pubKey
-	}
-
-	return adminKeys, aspKeyIdMap, threadTips, lastKeyID, totalSupply, nil
+	return state.KeySets, state.KeyIDs, state.RevokedKeys, state.ThreadTips,
+		state.LastKeyID, state.TotalSupply, nil
 }
 
 // dbPutKeySet uses an existing database transaction to update the admin chain
@@ -1153,11 +1116,12 @@ func deserializeKeySet(serializedData []byte) (
 func dbPutKeySet(dbTx database.Tx,
 	adminKeys map[btcec.KeySetType]btcec.PublicKeySet,
 	keyIdMap map[btcec.KeyID]*btcec.PublicKey,
+	revokedKeys map[btcec.KeyID]adminstate.RevokedKey,
 	threadTips map[provautil.ThreadID]*wire.OutPoint,
 	lastKeyID btcec.KeyID, totalSupply uint64) error {
 	// Serialize the adminKeySets.
-	serializedData := serializeKeySet(adminKeys, keyIdMap, threadTips,
-		lastKeyID, totalSupply)
+	serializedData := serializeKeySet(adminKeys, keyIdMap, revokedKeys,
+		threadTips, lastKeyID, totalSupply)
 
 	// Store the adminKeySets into the database.
 	return dbTx.Metadata().Put(keySetBucketName, serializedData)
@@ -1175,22 +1139,31 @@ func dbPutKeySet(dbTx database.Tx,
 // The serialized format is:
 //
 //   <block hash><block height><total txns><work sum length><work sum>
+//   <total issuance txns><total destruction txns>
+//
+//   Field                    Type             Size
+//   block hash               chainhash.Hash   chainhash.HashSize
+//   block height             uint32           4 bytes
+//   total txns               uint64           8 bytes
+//   work sum length          uint32           4 bytes
+//   work sum                 big.Int          work sum length
+//   total issuance txns      uint64           8 bytes
+//   total destruction txns   uint64           8 bytes
 //
-//   Field             Type             Size
-//   block hash        chainhash.Hash   chainhash.HashSize
-//   block height      uint32           4 bytes
-//   total txns        uint64           8 bytes
-//   work sum length   uint32           4 bytes
-//   work sum          big.Int          work sum length
+// The issuance and destruction txn counts were added by version 4 of the chain
+// state.  They are missing from the chain states of earlier versions until
+// they are upgraded.
 // -----------------------------------------------------------------------------
 
 // bestChainState represents the data to be stored the database for the current
 // best chain state.
 type bestChainState struct {
-	hash      chainhash.Hash
-	height    uint32
-	totalTxns uint64
-	workSum   *big.Int
+	hash                 chainhash.Hash
+	height               uint32
+	totalTxns            uint64
+	workSum              *big.Int
+	totalIssuanceTxns    uint64
+	totalDestructionTxns uint64
 }
 
 // serializeBestChainState returns the serialization of the passed block best
@@ -1199,7 +1172,7 @@ func serializeBestChainState(state bestChainState) []byte {
 	// Calculate the full size needed to serialize the chain state.
 	workSumBytes := state.workSum.Bytes()
 	workSumBytesLen := uint32(len(workSumBytes))
-	serializedLen := chainhash.HashSize + 4 + 8 + 4 + workSumBytesLen
+	serializedLen := chainhash.HashSize + 4 + 8 + 4 + workSumBytesLen + 16
 	// Serialize the chain state.
 	serializedData := make([]byte, serializedLen)
 	copy(serializedData[0:chainhash.HashSize], state.hash[:])
@@ -1211,6 +1184,10 @@ func serializeBestChainState(state bestChainState) []byte {
 	byteOrder.PutUint32(serializedData[offset:], workSumBytesLen)
 	offset += 4
 	copy(serializedData[offset:], workSumBytes)
+	offset += workSumBytesLen
+	byteOrder.PutUint64(serializedData[offset:], state.totalIssuanceTxns)
+	offset += 8
+	byteOrder.PutUint64(serializedData[offset:], state.totalDestructionTxns)
 	return serializedData[:]
 }
 
@@ -1248,19 +1225,50 @@ func deserializeBestChainState(serializedData []byte) (bestChainState, error) {
 	}
 	workSumBytes := serializedData[offset : offset+workSumBytesLen]
 	state.workSum = new(big.Int).SetBytes(workSumBytes)
+	offset += workSumBytesLen
+
+	// The issuance and destruction counts are missing from chain states
+	// which were not upgraded to version 4 yet.
+	switch uint32(len(serializedData[offset:])) {
+	case 0:
+	case 16:
+		state.totalIssuanceTxns = byteOrder.Uint64(
+			serializedData[offset : offset+8])
+		offset += 8
+		state.totalDestructionTxns = byteOrder.Uint64(
+			serializedData[offset : offset+8])
+	default:
+		return bestChainState{}, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt best chain state",
+		}
+	}
 
 	return state, nil
 }
 
 // dbPutBestState uses an existing database transaction to update the best chain
-// state with the given parameters.
+// state with the given parameters.  The best block MUST already be stored, in
+// the same transaction or an earlier one, since the database only guarantees
+// block data is durable before the metadata which references it in that case.
 func dbPutBestState(dbTx database.Tx, snapshot *BestState, workSum *big.Int) error {
+	stored, err := dbTx.HasBlock(snapshot.Hash)
+	if err != nil {
+		return err
+	}
+	if !stored {
+		return assertError(fmt.Sprintf("best state references block %v "+
+			"which is not stored", snapshot.Hash))
+	}
+
 	// Serialize the current best chain state.
 	serializedData := serializeBestChainState(bestChainState{
-		hash:      *snapshot.Hash,
-		height:    uint32(snapshot.Height),
-		totalTxns: snapshot.TotalTxns,
-		workSum:   workSum,
+		hash:                 *snapshot.Hash,
+		height:               uint32(snapshot.Height),
+		totalTxns:            snapshot.TotalTxns,
+		workSum:              workSum,
+		totalIssuanceTxns:    snapshot.TotalIssuanceTxs,
+		totalDestructionTxns: snapshot.TotalDestructionTxs,
 	})
 
 	// Store the current best chain state into the database.
@@ -1282,14 +1290,18 @@ func (b *BlockChain) createChainState() error {
 	b.index[*node.hash] = node
 
 	// Initialize the state related to the best block.  Since it is the
-	// genesis block, use its timestamp for the median time.
+	// genesis block, use its timestamp for the median and latest times.
 	numTxns := uint64(len(genesisBlock.MsgBlock().Transactions))
 	blockSize := uint64(genesisBlock.MsgBlock().SerializeSize())
-	b.stateSnapshot = newBestState(b.bestNode, blockSize, numTxns, numTxns,
-		time.Unix(b.bestNode.timestamp, 0))
+	genesisTime := time.Unix(b.bestNode.timestamp, 0)
+	b.stateSnapshot.Store(newBestState(b.bestNode, blockSize, numTxns,
+		numTxns, genesisTime, genesisTime))
 
-	b.adminKeySets = b.chainParams.AdminKeySets
-	b.aspKeyIdMap = b.chainParams.ASPKeyIdMap
+	// Copy the initial admin state so that changes to it can never leak
+	// into the chain parameters, which may be shared with other chain
+	// instances.
+	b.adminKeySets = btcec.DeepCopy(b.chainParams.AdminKeySets)
+	b.aspKeyIdMap = b.chainParams.ASPKeyIdMap.DeepCopy()
 
 	// Initiate the utxo set with the admin thread tips from the genesis
 	// coinbase.
@@ -1357,20 +1369,39 @@ func (b *BlockChain) createChainState() error {
 			return err
 		}
 
+		// Store the genesis block into the database before the best
+		// chain state which references it.
+		if err := dbTx.StoreBlock(genesisBlock); err != nil {
+			return err
+		}
+
 		// Store the current best chain state into the database.
-		err = dbPutBestState(dbTx, b.stateSnapshot, b.bestNode.workSum)
+		err = dbPutBestState(dbTx, b.BestSnapshot(), b.bestNode.workSum)
 		if err != nil {
 			return err
 		}
 
 		// Store the current admin key sets in the database.
-		err = dbPutKeySet(dbTx, b.adminKeySets, b.aspKeyIdMap, b.threadTips, b.lastKeyID, 0)
+		err = dbPutKeySet(dbTx, b.adminKeySets, b.aspKeyIdMap,
+			b.revokedKeys, b.threadTips, b.lastKeyID, 0)
 		if err != nil {
 			return err
 		}
 
-		// Store the genesis block into the database.
-		return dbTx.StoreBlock(genesisBlock)
+		// Store the snapshot of the admin state as of the genesis
+		// block.
+		err = dbPutAdminSnapshot(dbTx, 0, &adminstate.State{
+			ThreadTips: b.threadTips,
+			LastKeyID:  b.lastKeyID,
+			KeySets:    b.adminKeySets,
+			KeyIDs:     b.aspKeyIdMap,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Store the version of the serialization of the chain state.
+		return dbPutChainStateVersion(dbTx, currentChainStateVersion)
 	})
 	return err
 }
@@ -1402,8 +1433,8 @@ func (b *BlockChain) initChainState() error {
 			return nil
 		}
 		log.Tracef("Serialized admin state: %x", serializedKeys)
-		adminKeySets, aspKeyIdMap, threadTips, lastKeyID, totalSupply,
-			err := deserializeKeySet(serializedKeys)
+		adminKeySets, aspKeyIdMap, revokedKeys, threadTips, lastKeyID,
+			totalSupply, err := deserializeKeySet(serializedKeys)
 		if err != nil {
 			return err
 		}
@@ -1414,7 +1445,8 @@ func (b *BlockChain) initChainState() error {
 			return err
 		}
 		var block wire.MsgBlock
-		err = block.Deserialize(bytes.NewReader(blockBytes))
+		err = block.BtcDecode(bytes.NewReader(blockBytes),
+			b.chainParams.TxEncoding())
 		if err != nil {
 			return err
 		}
@@ -1426,31 +1458,44 @@ func (b *BlockChain) initChainState() error {
 		node := newBlockNode(header, &state.hash)
 		node.inMainChain = true
 		node.workSum = state.workSum
-		b.bestNode = node
 
 		// Set the admin state of the chain
+		b.stateLock.Lock()
 		b.threadTips = threadTips
 		b.lastKeyID = lastKeyID
 		b.totalSupply = totalSupply
 		b.adminKeySets = adminKeySets
 		b.aspKeyIdMap = aspKeyIdMap
+		b.revokedKeys = revokedKeys
+		b.stateLock.Unlock()
 
 		// Add the new node to the indices for faster lookups.
 		prevHash := node.parentHash
+		b.indexLock.Lock()
+		b.bestNode = node
 		b.index[*node.hash] = node
 		b.depNodes[*prevHash] = append(b.depNodes[*prevHash], node)
+		b.indexLock.Unlock()
 
-		// Calculate the median time for the block.
+		// Calculate the median and latest times for the block.
 		medianTime, err := b.calcPastMedianTime(node)
 		if err != nil {
 			return err
 		}
+		maxTime, err := b.calcPastMaxTime(node)
+		if err != nil {
+			return err
+		}
 
 		// Initialize the state related to the best block.
 		blockSize := uint64(len(blockBytes))
 		numTxns := uint64(len(block.Transactions))
-		b.stateSnapshot = newBestState(b.bestNode, blockSize, numTxns,
-			state.totalTxns, medianTime)
+		snapshot := newBestState(b.bestNode, blockSize, numTxns,
+			state.totalTxns, medianTime, maxTime)
+		snapshot.TotalSupply = totalSupply
+		snapshot.TotalIssuanceTxs = state.totalIssuanceTxns
+		snapshot.TotalDestructionTxs = state.totalDestructionTxns
+		b.stateSnapshot.Store(snapshot)
 
 		isStateInitialized = true
 		return nil
@@ -1464,6 +1509,15 @@ func (b *BlockChain) initChainState() error {
 		return nil
 	}
 
+	// The chain state can't be initialized without modifying the database.
+	if b.readOnly {
+		return database.Error{
+			ErrorCode: database.ErrDbReadOnly,
+			Description: "the database does not contain a chain " +
+				"state and can't be initialized in read-only mode",
+		}
+	}
+
 	// At this point the database has not already been initialized, so
 	// initialize both it and the chain state to the genesis block.
 	return b.createChainState()
@@ -1498,17 +1552,20 @@ func dbFetchHeaderByHeight(dbTx database.Tx, height uint32) (*wire.BlockHeader,
 }
 
 // dbFetchBlockByHash uses an existing database transaction to retrieve the raw
-// block for the provided hash, deserialize it, retrieve the appropriate height
-// from the index, and return a provautil.Block with the height set.
-func dbFetchBlockByHash(dbTx database.Tx, hash *chainhash.Hash) (*provautil.Block, error) {
+// block for the provided hash, deserialize it with the transaction encoding of
+// the passed chain parameters, retrieve the appropriate height from the index,
+// and return a provautil.Block with the height set.  A
+// BlockPrunedError is returned when the data of the block was pruned.
+func dbFetchBlockByHash(dbTx database.Tx, params *chaincfg.Params, hash *chainhash.Hash) (*provautil.Block, error) {
 	// Load the raw block bytes from the database.
 	blockBytes, err := dbTx.FetchBlock(hash)
 	if err != nil {
-		return nil, err
+		return nil, convertPrunedErr(hash, err)
 	}
 
 	// Create the encapsulated block and set the height appropriately.
-	block, err := provautil.NewBlockFromBytes(blockBytes)
+	block, err := provautil.NewBlockFromBytesEncoding(blockBytes,
+		params.TxEncoding())
 	if err != nil {
 		return nil, err
 	}
@@ -1517,9 +1574,11 @@ func dbFetchBlockByHash(dbTx database.Tx, hash *chainhash.Hash) (*provautil.Bloc
 }
 
 // dbFetchBlockByHeight uses an existing database transaction to retrieve the
-// raw block for the provided height, deserialize it, and return a provautil.Block
-// with the height set.
-func dbFetchBlockByHeight(dbTx database.Tx, height uint32) (*provautil.Block, error) {
+// raw block for the provided height, deserialize it with the transaction
+// encoding of the passed chain parameters, and return a provautil.Block with
+// the height set.  A BlockPrunedError is returned when the data of the
+// block was pruned.
+func dbFetchBlockByHeight(dbTx database.Tx, params *chaincfg.Params, height uint32) (*provautil.Block, error) {
 	// First find the hash associated with the provided height in the index.
 	hash, err := dbFetchHashByHeight(dbTx, height)
 	if err != nil {
@@ -1529,11 +1588,12 @@ func dbFetchBlockByHeight(dbTx database.Tx, height uint32) (*provautil.Block, er
 	// Load the raw block bytes from the database.
 	blockBytes, err := dbTx.FetchBlock(hash)
 	if err != nil {
-		return nil, err
+		return nil, convertPrunedErr(hash, err)
 	}
 
 	// Create the encapsulated block and set the height appropriately.
-	block, err := provautil.NewBlockFromBytes(blockBytes)
+	block, err := provautil.NewBlockFromBytesEncoding(blockBytes,
+		params.TxEncoding())
 	if err != nil {
 		return nil, err
 	}
@@ -1589,39 +1649,148 @@ func (b *BlockChain) BlockHashByHeight(blockHeight uint32) (*chainhash.Hash, err
 	return hash, err
 }
 
-// BlockByHeight returns the block at the given height in the main chain.
+// BlockByHeight returns the block at the given height in the main chain.  A
+// BlockPrunedError is returned when the data of the block was pruned.
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) BlockByHeight(blockHeight uint32) (*provautil.Block, error) {
 	var block *provautil.Block
 	err := b.db.View(func(dbTx database.Tx) error {
 		var err error
-		block, err = dbFetchBlockByHeight(dbTx, blockHeight)
+		block, err = dbFetchBlockByHeight(dbTx,
+			b.chainParams, blockHeight)
 		return err
 	})
 	return block, err
 }
 
 // BlockByHash returns the block from the main chain with the given hash with
-// the appropriate chain height set.
+// the appropriate chain height set.  A BlockPrunedError is returned when the
+// data of the block was pruned.
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) BlockByHash(hash *chainhash.Hash) (*provautil.Block, error) {
 	var block *provautil.Block
 	err := b.db.View(func(dbTx database.Tx) error {
 		var err error
-		block, err = dbFetchBlockByHash(dbTx, hash)
+		block, err = dbFetchBlockByHash(dbTx, b.chainParams, hash)
 		return err
 	})
 	return block, err
 }
 
+// BlockRegion returns the location of the serialized bytes of the stored block
+// with the given hash on disk, which allows the raw block data to be read
+// without loading it through the database.  The database error is returned
+// when the block is unknown or its data was removed from the disk.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlockRegion(hash *chainhash.Hash) (*database.BlockLocation, error) {
+	var location *database.BlockLocation
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		location, err = dbTx.FetchBlockLocation(hash)
+		return err
+	})
+	return location, err
+}
+
+// FetchSpentTxOuts returns the transaction outputs spent by the transactions in
+// the passed main chain block keyed by the outpoints which reference them.  The
+// outputs are loaded from the spend journal, so unlike the transaction index it
+// works for outputs which have since been spent.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchSpentTxOuts(block *provautil.Block) (map[wire.OutPoint]wire.TxOut, error) {
+	spent := make(map[wire.OutPoint]wire.TxOut)
+	err := b.db.View(func(dbTx database.Tx) error {
+		if !dbMainChainHasBlock(dbTx, block.Hash()) {
+			str := fmt.Sprintf("block %s is not in the main chain",
+				block.Hash())
+			return errNotInMainChain(str)
+		}
+
+		// The spend journal stores the spent outputs of all of the
+		// transactions after the coinbase in reverse order.  The
+		// version of the transaction which created an output is not
+		// needed to decode its amount and script, so a placeholder is
+		// passed for the outputs which do not encode it.
+		spendBucket := dbTx.Metadata().Bucket(spendJournalBucketName)
+		serialized := spendBucket.Get(block.Hash()[:])
+		txns := block.MsgBlock().Transactions[1:]
+		offset := 0
+		for txIdx := len(txns) - 1; txIdx > -1; txIdx-- {
+			tx := txns[txIdx]
+			for txInIdx := len(tx.TxIn) - 1; txInIdx > -1; txInIdx-- {
+				var stxo spentTxOut
+				n, err := decodeSpentTxOut(serialized[offset:], &stxo, 1)
+				offset += n
+				if err != nil {
+					return database.Error{
+						ErrorCode: database.ErrCorruption,
+						Description: fmt.Sprintf("corrupt "+
+							"spend information for %v: %v",
+							block.Hash(), err),
+					}
+				}
+				spent[tx.TxIn[txInIdx].PreviousOutPoint] = wire.TxOut{
+					Value: int64(decompressTxOutAmount(
+						uint64(stxo.amount))),
+					PkScript: decompressScript(stxo.pkScript,
+						stxo.version),
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return spent, nil
+}
+
+// FetchSpendJournal returns the serialized spend journal entry of the main chain
+// block with the passed hash, which holds the outputs spent by the block and is
+// needed to disconnect it.  Blocks which don't spend any outputs have an empty
+// entry.  The entry is only meaningful to nodes with the same chain state
+// version.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchSpendJournal(hash *chainhash.Hash) ([]byte, error) {
+	var serialized []byte
+	err := b.db.View(func(dbTx database.Tx) error {
+		if !dbMainChainHasBlock(dbTx, hash) {
+			str := fmt.Sprintf("block %s is not in the main chain",
+				hash)
+			return errNotInMainChain(str)
+		}
+
+		// The returned slice is only valid during the transaction.
+		spendBucket := dbTx.Metadata().Bucket(spendJournalBucketName)
+		serialized = append([]byte{}, spendBucket.Get(hash[:])...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return serialized, nil
+}
+
 // HeightRange returns a range of block hashes for the given start and end
 // heights.  It is inclusive of the start height and exclusive of the end
 // height.  The end height will be limited to the current main chain height.
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) HeightRange(startHeight, endHeight uint32) ([]chainhash.Hash, error) {
+	return b.HeightRangeContext(context.Background(), startHeight, endHeight)
+}
+
+// HeightRangeContext is the same as HeightRange except the fetch is aborted
+// with the error of the passed context when it is cancelled before all of the
+// hashes have been loaded.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) HeightRangeContext(ctx context.Context, startHeight, endHeight uint32) ([]chainhash.Hash, error) {
 	// Ensure requested heights are sane.
 	if startHeight < 0 {
 		return nil, fmt.Errorf("start height of fetch range must not "+
@@ -1634,33 +1803,43 @@ func (b *BlockChain) HeightRange(startHeight, endHeight uint32) ([]chainhash.Has
 	}
 
 	// There is nothing to do when the start and end heights are the same,
-	// so return now to avoid the chain lock and a database transaction.
+	// so return now to avoid a database transaction.
 	if startHeight == endHeight {
 		return nil, nil
 	}
 
-	// Grab a lock on the chain to prevent it from changing due to a reorg
-	// while building the hashes.
-	b.chainLock.RLock()
-	defer b.chainLock.RUnlock()
+	// Fetch as many as are available within the specified range.  The
+	// best chain height is loaded in the same database transaction as the
+	// hashes, so they are consistent with each other even when the chain
+	// is reorganized meanwhile, without waiting for the chain lock.
+	var hashList []chainhash.Hash
+	err := b.db.View(func(dbTx database.Tx) error {
+		state, err := deserializeBestChainState(
+			dbTx.Metadata().Get(chainStateKeyName))
+		if err != nil {
+			return err
+		}
 
-	// When the requested start height is after the most recent best chain
-	// height, there is nothing to do.
-	latestHeight := b.bestNode.height
-	if startHeight > latestHeight {
-		return nil, nil
-	}
+		// When the requested start height is after the most recent
+		// best chain height, there is nothing to do.
+		latestHeight := state.height
+		if startHeight > latestHeight {
+			return nil
+		}
 
-	// Limit the ending height to the latest height of the chain.
-	if endHeight > latestHeight+1 {
-		endHeight = latestHeight + 1
-	}
+		// Limit the ending height to the latest height of the chain.
+		if endHeight > latestHeight+1 {
+			endHeight = latestHeight + 1
+		}
 
-	// Fetch as many as are available within the specified range.
-	var hashList []chainhash.Hash
-	err := b.db.View(func(dbTx database.Tx) error {
 		hashes := make([]chainhash.Hash, 0, endHeight-startHeight)
 		for i := startHeight; i < endHeight; i++ {
+			if (i-startHeight)%cancelCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+
 			hash, err := dbFetchHashByHeight(dbTx, i)
 			if err != nil {
 				return err
@@ -199,7 +199,7 @@ func TestStxoDecodeErrors(t *testing.T) {
 			name:       "no serialized tx version and passed 0",
 			stxo:       spentTxOut{},
 			serialized: hexToBytes("003205"),
-			errType:    AssertError(""),
+			errType:    AssertError{},
 			bytesRead:  1,
 		},
 		{
@@ -402,7 +402,7 @@ func TestSpendJournalSerialization(t *testing.T) {
 					},
 				},
 			}},
-			serialized: hexToBytes("0087bc3707510084c3d19a790751"),
+			serialized: hexToBytes("0087bc3708510084c3d19a790851"),
 		},
 	}
 
@@ -469,7 +469,7 @@ func TestSpendJournalErrors(t *testing.T) {
 			}},
 			utxoView:   NewUtxoViewpoint(),
 			serialized: hexToBytes(""),
-			errType:    AssertError(""),
+			errType:    AssertError{},
 		},
 		{
 			name: "Force deserialization error in stxos",
@@ -667,6 +667,28 @@ func TestUtxoSerialization(t *testing.T) {
 			},
 			serialized: hexToBytes("0185f90b0a011200e2ccd6ec7c6e2e581349c77e067385fa8236bf8a800900b8025be1b3efc63b0ad48e7f9f10e87544528d58"),
 		},
+		// Adapted from tx in main blockchain:
+		// 4a16969aa4764dd7507fc1de7f0baa4850a246de90c45e59a3207f9a26b5036f
+		{
+			name: "outputs 0 and 2, not coinbase, output 2 with script version",
+			entry: &UtxoEntry{
+				version:     1,
+				isCoinBase:  false,
+				blockHeight: 113931,
+				sparseOutputs: map[uint32]*utxoOutput{
+					0: {
+						amount:   20000000,
+						pkScript: hexToBytes("76a914e2ccd6ec7c6e2e581349c77e067385fa8236bf8a88ac"),
+					},
+					2: {
+						amount:        15000000,
+						pkScript:      hexToBytes("5114b8025be1b3efc63b0ad48e7f9f10e87544528d58"),
+						scriptVersion: 1,
+					},
+				},
+			},
+			serialized: hexToBytes("0185f90b0a011200e2ccd6ec7c6e2e581349c77e067385fa8236bf8a80091d5114b8025be1b3efc63b0ad48e7f9f10e87544528d58010201"),
+		},
 		// From tx in main blockchain:
 		// c8116af9fc0be25f6c720b88e675bf1de423286ab5e949f7d9fa735f26364cc0
 		{
@@ -812,6 +834,16 @@ func TestUtxoSerialization(t *testing.T) {
 					outputIndex, gotPkScript, wantPkScript)
 				continue
 			}
+
+			gotVersion := utxoEntry.ScriptVersionByIndex(outputIndex)
+			wantVersion := test.entry.ScriptVersionByIndex(outputIndex)
+			if gotVersion != wantVersion {
+				t.Errorf("deserializeUtxoEntry #%d (%s) "+
+					"output #%d mismatched script versions: "+
+					"got %d, want %d", i, test.name,
+					outputIndex, gotVersion, wantVersion)
+				continue
+			}
 		}
 	}
 }
@@ -831,7 +863,7 @@ func TestUtxoEntryHeaderCodeErrors(t *testing.T) {
 		{
 			name:      "Force assertion due to fully spent tx",
 			entry:     &UtxoEntry{},
-			errType:   AssertError(""),
+			errType:   AssertError{},
 			bytesRead: 0,
 		},
 	}
@@ -896,6 +928,16 @@ func TestUtxoEntryDeserializeErrors(t *testing.T) {
 			serialized: hexToBytes("01010232"),
 			errType:    errDeserialize(""),
 		},
+		{
+			name:       "incomplete script versions",
+			serialized: hexToBytes("0185f90b0a011200e2ccd6ec7c6e2e581349c77e067385fa8236bf8a80091d5114b8025be1b3efc63b0ad48e7f9f10e87544528d580102"),
+			errType:    errDeserialize(""),
+		},
+		{
+			name:       "script version of spent output",
+			serialized: hexToBytes("0185f90b0a011200e2ccd6ec7c6e2e581349c77e067385fa8236bf8a80091d5114b8025be1b3efc63b0ad48e7f9f10e87544528d58010101"),
+			errType:    errDeserialize(""),
+		},
 	}
 
 	for _, test := range tests {
@@ -938,7 +980,7 @@ func TestBestChainStateSerialization(t *testing.T) {
 					return new(big.Int).Set(workSum)
 				}(), // 0x0100010001
 			},
-			serialized: hexToBytes("6fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d6190000000000000000000100000000000000050000000100010001"),
+			serialized: hexToBytes("6fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d619000000000000000000010000000000000005000000010001000100000000000000000000000000000000"),
 		},
 		{
 			name: "block 1",
@@ -950,8 +992,10 @@ func TestBestChainStateSerialization(t *testing.T) {
 					workSum.Add(workSum, CalcWork(486604799))
 					return new(big.Int).Set(workSum)
 				}(), // 0x0200020002
+				totalIssuanceTxns:    3,
+				totalDestructionTxns: 1,
 			},
-			serialized: hexToBytes("4860eb18bf1b1620e37e9490fc8a427514416fd75159ab86688e9a8300000000010000000200000000000000050000000200020002"),
+			serialized: hexToBytes("4860eb18bf1b1620e37e9490fc8a427514416fd75159ab86688e9a830000000001000000020000000000000005000000020002000203000000000000000100000000000000"),
 		},
 	}
 
@@ -980,6 +1024,24 @@ func TestBestChainStateSerialization(t *testing.T) {
 			continue
 
 		}
+
+		// Ensure the state serialized before the issuance and
+		// destruction counts were added is decoded without them.
+		legacy := test.serialized[:len(test.serialized)-16]
+		state, err = deserializeBestChainState(legacy)
+		if err != nil {
+			t.Errorf("deserializeBestChainState #%d (%s) legacy "+
+				"unexpected error: %v", i, test.name, err)
+			continue
+		}
+		want := test.state
+		want.totalIssuanceTxns = 0
+		want.totalDestructionTxns = 0
+		if !reflect.DeepEqual(state, want) {
+			t.Errorf("deserializeBestChainState #%d (%s) legacy "+
+				"mismatched state - got %v, want %v", i,
+				test.name, state, want)
+		}
 	}
 }
 
@@ -1044,7 +1106,7 @@ func TestKeySetSerialization(t *testing.T) {
 	for i, test := range tests {
 		// Ensure the state serializes to the expected value.
 		gotBytes := serializeKeySet(test.adminKeySets, test.keyIdMap,
-			test.threadTips, test.lastKeyID, test.totalSupply)
+			nil, test.threadTips, test.lastKeyID, test.totalSupply)
 		if !bytes.Equal(gotBytes, test.serialized) {
 			t.Errorf("serializeKeySet #%d (%s): mismatched "+
 				"bytes - got %x, want %x", i, test.name,
@@ -1054,7 +1116,7 @@ func TestKeySetSerialization(t *testing.T) {
 
 		// Ensure the serialized bytes are decoded back to the expected
 		// state.
-		adminKeySets, keyIdMap, threadTips, lastKeyID, totalSupply,
+		adminKeySets, keyIdMap, _, threadTips, lastKeyID, totalSupply,
 			err := deserializeKeySet(test.serialized)
 		if err != nil {
 			t.Errorf("deserializeKeySet #%d (%s) "+
@@ -1124,6 +1186,11 @@ func TestBestChainStateDeserializeErrors(t *testing.T) {
 			serialized: hexToBytes("6fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d61900000000000000000001000000000000000500000001000100"),
 			errType:    database.Error{ErrorCode: database.ErrCorruption},
 		},
+		{
+			name:       "short data in issuance counts",
+			serialized: hexToBytes("6fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d6190000000000000000000100000000000000050000000100010001000000000000000000"),
+			errType:    database.Error{ErrorCode: database.ErrCorruption},
+		},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,206 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/wire"
+)
+
+// checkChainReads performs the queries of the chain which only need the block
+// index or the best state snapshot, along with a few which read the database
+// or the admin state, and reports any result which is inconsistent.
+func checkChainReads(t *testing.T, chain *blockchain.BlockChain, params *chaincfg.Params) {
+	genesisHash := params.GenesisBlock.BlockHash()
+	best := chain.BestSnapshot()
+	if best == nil || best.Hash == nil {
+		t.Errorf("BestSnapshot: got %+v", best)
+		return
+	}
+	if _, err := chain.FetchHeader(&genesisHash); err != nil {
+		t.Errorf("FetchHeader of genesis block: %v", err)
+	}
+	header, err := chain.FetchHeader(best.Hash)
+	if err != nil {
+		t.Errorf("FetchHeader of best block %v: %v", best.Hash, err)
+	} else if header.Height != best.Height {
+		t.Errorf("FetchHeader of best block %v: got height %d, want %d",
+			best.Hash, header.Height, best.Height)
+	}
+	have, err := chain.HaveBlock(best.Hash)
+	if err != nil || !have {
+		t.Errorf("HaveBlock of best block %v: got %v, %v", best.Hash,
+			have, err)
+	}
+
+	locator, err := chain.LatestBlockLocator()
+	if err != nil || len(locator) == 0 ||
+		*locator[len(locator)-1] != *params.GenesisHash {
+
+		t.Errorf("LatestBlockLocator: got %v, %v", locator, err)
+	}
+	locator = chain.BlockLocatorFromHash(best.Hash)
+	if len(locator) == 0 || *locator[0] != *best.Hash {
+		t.Errorf("BlockLocatorFromHash of best block %v: got %v",
+			best.Hash, locator)
+	}
+
+	hashes, err := chain.HeightRange(0, best.Height+1)
+	if err != nil {
+		t.Errorf("HeightRange up to height %d: %v", best.Height, err)
+	} else if len(hashes) == 0 || hashes[0] != genesisHash {
+		t.Errorf("HeightRange up to height %d: got %v", best.Height,
+			hashes)
+	}
+	if height, err := chain.BlockHeightByHash(&genesisHash); err != nil ||
+		height != 0 {
+
+		t.Errorf("BlockHeightByHash of genesis block: got %d, %v",
+			height, err)
+	}
+	if _, err := chain.BlockByHash(&genesisHash); err != nil {
+		t.Errorf("BlockByHash of genesis block: %v", err)
+	}
+
+	chain.IsCurrent()
+	chain.ThreadTips()
+	chain.AdminKeySets()
+	chain.LastKeyID()
+}
+
+// TestReadsDuringReorganizations ensures the queries of the chain return
+// consistent results while the chain is reorganized continuously between two
+// branches.  It is most useful when run with the race detector.
+func TestReadsDuringReorganizations(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("readsduringreorgs", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Query the chain from a few goroutines until the reorganizations are
+	// done.
+	const numReaders = 4
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	stopReaders := func() {
+		select {
+		case <-stop:
+		default:
+			close(stop)
+			wg.Wait()
+		}
+	}
+	defer stopReaders()
+	numReads := make([]int, numReaders)
+	for i := 0; i < numReaders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				checkChainReads(t, chain, &params)
+				numReads[i]++
+			}
+		}(i)
+	}
+
+	// Grow two branches off the genesis block in turns, where each turn
+	// extends the branch which is not the best chain until it is one block
+	// longer than the other one, so it has more work and the chain is
+	// reorganized to it.  The coinbases of the branches pay to different
+	// addresses so their blocks differ.
+	const numReorgs = 20
+	branchParams := [2]chaincfg.Params{params, params}
+	branchParams[0].Name = params.Name + "-a"
+	branchParams[1].Name = params.Name + "-b"
+	tips := [2]*wire.MsgBlock{params.GenesisBlock, params.GenesisBlock}
+	for i := 0; i <= numReorgs; i++ {
+		branch := i % 2
+		other := tips[1-branch].Header.Height
+		for tips[branch].Header.Height <= other {
+			block, err := multiChainBlock(&branchParams[branch],
+				tips[branch])
+			if err != nil {
+				t.Fatalf("Failed to create block: %v", err)
+			}
+			_, _, err = chain.ProcessBlock(block, blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock: %v", err)
+			}
+			tips[branch] = block.MsgBlock()
+		}
+		best := chain.BestSnapshot()
+		if tipHash := tips[branch].BlockHash(); *best.Hash != tipHash {
+			t.Fatalf("turn %d: got best block %v, want %v", i,
+				best.Hash, tipHash)
+		}
+	}
+	stopReaders()
+
+	for i, n := range numReads {
+		if n == 0 {
+			t.Errorf("reader %d never queried the chain", i)
+		}
+	}
+}
+
+// TestReadsDontWaitForChainLock ensures the queries of the chain which only
+// need the block index or the best state snapshot return while the chain lock
+// is held for writes, as it is while a block is processed.
+func TestReadsDontWaitForChainLock(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("readsdontwait", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	prev := params.GenesisBlock
+	for i := 0; i < 3; i++ {
+		block, err := multiChainBlock(&params, prev)
+		if err != nil {
+			t.Fatalf("Failed to create block: %v", err)
+		}
+		if _, _, err := chain.ProcessBlock(block, blockchain.BFNone); err != nil {
+			t.Fatalf("ProcessBlock: %v", err)
+		}
+		prev = block.MsgBlock()
+	}
+
+	unlock := chain.TstLockChain()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		best := chain.BestSnapshot()
+		if best.Height != prev.Header.Height {
+			t.Errorf("BestSnapshot: got height %d, want %d",
+				best.Height, prev.Header.Height)
+		}
+		chain.FetchHeader(best.Hash)
+		chain.HaveBlock(best.Hash)
+		chain.LatestBlockLocator()
+		chain.BlockLocatorFromHash(best.Hash)
+		chain.HeightRange(0, best.Height+1)
+		chain.IsCurrent()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("queries of the chain waited for the chain lock")
+	}
+	unlock()
+	<-done
+}
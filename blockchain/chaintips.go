@@ -0,0 +1,287 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+)
+
+// chainTipBucketName is the name of the db bucket used to house the hashes of
+// the stored blocks which no other stored block extends, which are the tips of
+// the branches of the block tree.  The values are empty.
+var chainTipBucketName = []byte("chaintips")
+
+// ChainTipStatus describes the state of the branch of the block tree which
+// ends at a chain tip.
+type ChainTipStatus int
+
+// These constants define the possible states of a chain tip.
+const (
+	// ChainTipActive is the status of the tip of the main chain.
+	ChainTipActive ChainTipStatus = iota
+
+	// ChainTipValidFork is the status of the tips of side chains which
+	// fork from the main chain and may become the main chain once they
+	// have more work.  The blocks of the side chain are only validated
+	// fully when it does.
+	ChainTipValidFork
+
+	// ChainTipInvalid is the status of the tips of side chains which
+	// contain a block that was marked invalid with InvalidateBlock.
+	ChainTipInvalid
+
+	// ChainTipOrphan is the status of the tips of the chains in the orphan
+	// pool, whose first block extends a block which is not known yet.
+	ChainTipOrphan
+)
+
+// chainTipStatusStrings is a map of chain tip statuses back to their constant
+// names for pretty printing.
+var chainTipStatusStrings = map[ChainTipStatus]string{
+	ChainTipActive:    "active",
+	ChainTipValidFork: "valid-fork",
+	ChainTipInvalid:   "invalid",
+	ChainTipOrphan:    "orphan",
+}
+
+// String returns the ChainTipStatus as a human-readable name.
+func (s ChainTipStatus) String() string {
+	if str, ok := chainTipStatusStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown ChainTipStatus (%d)", int(s))
+}
+
+// ChainTip describes the tip of a branch of the block tree.
+type ChainTip struct {
+	// Hash and Height identify the block at the tip of the branch.
+	Hash   chainhash.Hash
+	Height uint32
+
+	// BranchLen is the number of blocks of the branch after the main chain
+	// block it forks from, which is zero for the tip of the main chain.
+	// It is the number of blocks in the orphan pool which lead to the tip
+	// for orphan tips.
+	BranchLen uint32
+
+	// Status is the state of the branch.
+	Status ChainTipStatus
+}
+
+// chainTipSorter implements sort.Interface to allow a slice of chain tips to be
+// sorted by descending height and then by hash.
+type chainTipSorter []ChainTip
+
+// Len returns the number of chain tips in the slice.  It is part of the
+// sort.Interface implementation.
+func (s chainTipSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the chain tips at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s chainTipSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the chain tip with index i should sort before the chain
+// tip with index j.  It is part of the sort.Interface implementation.
+func (s chainTipSorter) Less(i, j int) bool {
+	if s[i].Height != s[j].Height {
+		return s[i].Height > s[j].Height
+	}
+	return s[i].Hash.String() < s[j].Hash.String()
+}
+
+// dbPutChainTip uses an existing database transaction to record the block with
+// the passed hash, which extends the passed parent, as a tip of the block tree
+// in place of its parent.  It returns whether the parent was a tip.
+func dbPutChainTip(dbTx database.Tx, hash, parent *chainhash.Hash) (bool, error) {
+	bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+		chainTipBucketName)
+	if err != nil {
+		return false, err
+	}
+
+	// The database may hold on to the keys until the transaction is
+	// committed, so they get their own copies.
+	parentKey := make([]byte, chainhash.HashSize)
+	copy(parentKey, parent[:])
+	parentWasTip := bucket.Get(parentKey) != nil
+	if err := bucket.Delete(parentKey); err != nil {
+		return false, err
+	}
+	key := make([]byte, chainhash.HashSize)
+	copy(key, hash[:])
+	return parentWasTip, bucket.Put(key, []byte{})
+}
+
+// dbRemoveChainTip uses an existing database transaction to undo recording the
+// block with the passed hash as a tip of the block tree in place of the passed
+// parent with dbPutChainTip, which returned whether the parent was a tip.
+func dbRemoveChainTip(dbTx database.Tx, hash, parent *chainhash.Hash, parentWasTip bool) error {
+	bucket := dbTx.Metadata().Bucket(chainTipBucketName)
+	if bucket == nil {
+		return nil
+	}
+	key := make([]byte, chainhash.HashSize)
+	copy(key, hash[:])
+	if err := bucket.Delete(key); err != nil {
+		return err
+	}
+	if !parentWasTip {
+		return nil
+	}
+	parentKey := make([]byte, chainhash.HashSize)
+	copy(parentKey, parent[:])
+	return bucket.Put(parentKey, []byte{})
+}
+
+// dbResetChainTips uses an existing database transaction to replace the
+// recorded tips of the block tree with the block with the passed hash.
+func dbResetChainTips(dbTx database.Tx, hash *chainhash.Hash) error {
+	meta := dbTx.Metadata()
+	if meta.Bucket(chainTipBucketName) != nil {
+		if err := meta.DeleteBucket(chainTipBucketName); err != nil {
+			return err
+		}
+	}
+	bucket, err := meta.CreateBucket(chainTipBucketName)
+	if err != nil {
+		return err
+	}
+	key := make([]byte, chainhash.HashSize)
+	copy(key, hash[:])
+	return bucket.Put(key, []byte{})
+}
+
+// initChainTips starts recording the tips of the block tree on databases which
+// were created before they were recorded.  Only the tip of the main chain is
+// known then, so the tips of side chains stored before are not reported until
+// they are extended.
+func (b *BlockChain) initChainTips() error {
+	if b.readOnly {
+		return nil
+	}
+	return b.db.Update(func(dbTx database.Tx) error {
+		if dbTx.Metadata().Bucket(chainTipBucketName) != nil {
+			return nil
+		}
+		log.Infof("Recording the tips of the block tree from block %v",
+			b.bestNode.hash)
+		return dbResetChainTips(dbTx, b.bestNode.hash)
+	})
+}
+
+// dbFetchChainTip uses an existing database transaction to describe the branch
+// of the block tree which ends at the stored block with the passed hash.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) dbFetchChainTip(dbTx database.Tx, hash *chainhash.Hash) (ChainTip, error) {
+	tip := ChainTip{Hash: *hash, Status: ChainTipValidFork}
+	if hash.IsEqual(b.bestNode.hash) {
+		tip.Height = b.bestNode.height
+		tip.Status = ChainTipActive
+		return tip, nil
+	}
+
+	header, err := dbFetchHeaderByHash(dbTx, hash)
+	if err != nil {
+		return ChainTip{}, err
+	}
+	tip.Height = header.Height
+
+	// Walk back to the main chain block the branch forks from, noting
+	// whether any of its blocks was marked invalid.
+	for h := hash; !dbMainChainHasBlock(dbTx, h); tip.BranchLen++ {
+		header, err := dbFetchHeaderByHash(dbTx, h)
+		if err != nil {
+			return ChainTip{}, err
+		}
+		if _, ok := b.invalidBlocks[*h]; ok {
+			tip.Status = ChainTipInvalid
+		}
+		h = &header.PrevBlock
+	}
+	return tip, nil
+}
+
+// ChainTips returns the tips of all branches of the block tree known to the
+// chain, sorted by descending height.  These are the tip of the main chain,
+// which is always included, the stored blocks which no other stored block
+// extends, whether they are in memory or not, and the blocks in the orphan
+// pool which no other orphan extends.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainTips() ([]ChainTip, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	var tips []ChainTip
+	err := b.db.View(func(dbTx database.Tx) error {
+		hashes := []chainhash.Hash{*b.bestNode.hash}
+		if bucket := dbTx.Metadata().Bucket(chainTipBucketName); bucket != nil {
+			err := bucket.ForEach(func(k, v []byte) error {
+				if len(k) != chainhash.HashSize {
+					return database.Error{
+						ErrorCode:   database.ErrCorruption,
+						Description: "corrupt chain tip entry",
+					}
+				}
+				// Main chain blocks are no longer tips once the
+				// main chain was extended, even when that wasn't
+				// recorded yet.
+				var hash chainhash.Hash
+				copy(hash[:], k)
+				if !dbMainChainHasBlock(dbTx, &hash) {
+					hashes = append(hashes, hash)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		tips = make([]ChainTip, 0, len(hashes))
+		for i := range hashes {
+			tip, err := b.dbFetchChainTip(dbTx, &hashes[i])
+			if err != nil {
+				return err
+			}
+			tips = append(tips, tip)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The orphans which no other orphan extends are the tips of the chains
+	// in the orphan pool.
+	b.orphanLock.RLock()
+	for hash, orphan := range b.orphans {
+		if len(b.prevOrphans[hash]) != 0 {
+			continue
+		}
+		tip := ChainTip{
+			Hash:   hash,
+			Height: orphan.block.MsgBlock().Header.Height,
+			Status: ChainTipOrphan,
+		}
+		for o := orphan; o != nil; tip.BranchLen++ {
+			o = b.orphans[o.block.MsgBlock().Header.PrevBlock]
+		}
+		tips = append(tips, tip)
+	}
+	b.orphanLock.RUnlock()
+
+	sort.Sort(chainTipSorter(tips))
+	return tips, nil
+}
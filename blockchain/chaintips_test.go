@@ -0,0 +1,143 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+)
+
+// TestChainTips ensures the tips of the main chain, of side chains of different
+// lengths and of chains in the orphan pool are reported with their branch
+// lengths and statuses as the chain reorganizes, and that the tips of side
+// chains which are not in memory after a restart are still reported.
+func TestChainTips(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+
+	db, teardown := testChainDB(t, "chaintips", &params)
+	defer teardown()
+
+	// The main chain a is four blocks long, side chain b forks after the
+	// first block and is two blocks long, and side chain c forks after the
+	// second block and is one block long.  The last two blocks of chain a
+	// are orphans since the block they extend is never processed.
+	a1 := forkBlock(t, &params, params.GenesisBlock, 'a')
+	a2 := forkBlock(t, &params, a1.MsgBlock(), 'a')
+	a3 := forkBlock(t, &params, a2.MsgBlock(), 'a')
+	a4 := forkBlock(t, &params, a3.MsgBlock(), 'a')
+	a5 := forkBlock(t, &params, a4.MsgBlock(), 'a')
+	a6 := forkBlock(t, &params, a5.MsgBlock(), 'a')
+	a7 := forkBlock(t, &params, a6.MsgBlock(), 'a')
+	b2 := forkBlock(t, &params, a1.MsgBlock(), 'b')
+	b3 := forkBlock(t, &params, b2.MsgBlock(), 'b')
+	c3 := forkBlock(t, &params, a2.MsgBlock(), 'c')
+
+	chain := newTestChain(t, db, &params, nil)
+	tips, err := chain.ChainTips()
+	if err != nil {
+		t.Fatalf("ChainTips: %v", err)
+	}
+	genesis := chain.BestSnapshot().Hash
+	if len(tips) != 1 || tips[0].Hash != *genesis ||
+		tips[0].Status != blockchain.ChainTipActive {
+
+		t.Fatalf("got tips %+v of a new chain, want the genesis block",
+			tips)
+	}
+
+	for _, block := range []*provautil.Block{a1, a2, a3, a4, b2, b3, c3,
+		a6, a7} {
+
+		_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock(%v): %v", block.Hash(), err)
+		}
+	}
+
+	// check ensures the passed chain reports the passed tips.
+	check := func(desc string, chain *blockchain.BlockChain, want []blockchain.ChainTip) {
+		tips, err := chain.ChainTips()
+		if err != nil {
+			t.Fatalf("%s: ChainTips: %v", desc, err)
+		}
+		if len(tips) != len(want) {
+			t.Fatalf("%s: got %d tips %+v, want %d tips %+v", desc,
+				len(tips), tips, len(want), want)
+		}
+		for i := range tips {
+			if i > 0 && tips[i].Height > tips[i-1].Height {
+				t.Fatalf("%s: tips %+v are not sorted by "+
+					"descending height", desc, tips)
+			}
+			found := false
+			for _, tip := range want {
+				if tip == tips[i] {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Fatalf("%s: got unexpected tip %+v (%v), want "+
+					"tips %+v", desc, tips[i], tips[i].Status,
+					want)
+			}
+		}
+	}
+	tip := func(block *provautil.Block, branchLen uint32, status blockchain.ChainTipStatus) blockchain.ChainTip {
+		return blockchain.ChainTip{
+			Hash:      *block.Hash(),
+			Height:    block.MsgBlock().Header.Height,
+			BranchLen: branchLen,
+			Status:    status,
+		}
+	}
+	check("processed", chain, []blockchain.ChainTip{
+		tip(a7, 2, blockchain.ChainTipOrphan),
+		tip(a4, 0, blockchain.ChainTipActive),
+		tip(b3, 2, blockchain.ChainTipValidFork),
+		tip(c3, 1, blockchain.ChainTipValidFork),
+	})
+
+	// A side chain which contains an invalidated block is reported as
+	// invalid.
+	if err := chain.InvalidateBlock(c3.Hash()); err != nil {
+		t.Fatalf("InvalidateBlock: %v", err)
+	}
+	check("invalidated", chain, []blockchain.ChainTip{
+		tip(a7, 2, blockchain.ChainTipOrphan),
+		tip(a4, 0, blockchain.ChainTipActive),
+		tip(b3, 2, blockchain.ChainTipValidFork),
+		tip(c3, 1, blockchain.ChainTipInvalid),
+	})
+
+	// Extending a side chain past the main chain makes the old main chain
+	// a side chain.
+	b4 := forkBlock(t, &params, b3.MsgBlock(), 'b')
+	b5 := forkBlock(t, &params, b4.MsgBlock(), 'b')
+	for _, block := range []*provautil.Block{b4, b5} {
+		_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock(%v): %v", block.Hash(), err)
+		}
+	}
+	check("reorganized", chain, []blockchain.ChainTip{
+		tip(a7, 2, blockchain.ChainTipOrphan),
+		tip(b5, 0, blockchain.ChainTipActive),
+		tip(a4, 3, blockchain.ChainTipValidFork),
+		tip(c3, 2, blockchain.ChainTipInvalid),
+	})
+
+	// The side chains are reported after a restart although they are not
+	// in memory, while the orphans are gone.
+	chain = newTestChain(t, db, &params, nil)
+	check("restarted", chain, []blockchain.ChainTip{
+		tip(b5, 0, blockchain.ChainTipActive),
+		tip(a4, 3, blockchain.ChainTipValidFork),
+		tip(c3, 2, blockchain.ChainTipInvalid),
+	})
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
 )
 
 // CheckpointConfirmations is the number of blocks before the end of the current
@@ -82,11 +83,13 @@ func (b *BlockChain) verifyCheckpoint(height uint32, hash *chainhash.Hash) bool
 
 // findPreviousCheckpoint finds the most recent checkpoint that is already
 // available in the downloaded portion of the block chain and returns the
-// associated block.  It returns nil if a checkpoint can't be found (this should
-// really only happen for blocks before the first checkpoint).
+// header of the associated block.  It returns nil if a checkpoint can't be
+// found (this should really only happen for blocks before the first
+// checkpoint).  Only the header is loaded, so the checkpoint is still found
+// once the data of the block was pruned.
 //
 // This function MUST be called with the chain lock held (for reads).
-func (b *BlockChain) findPreviousCheckpoint() (*provautil.Block, error) {
+func (b *BlockChain) findPreviousCheckpoint() (*wire.BlockHeader, error) {
 	if !b.HasCheckpoints() {
 		return nil, nil
 	}
@@ -101,7 +104,7 @@ func (b *BlockChain) findPreviousCheckpoint() (*provautil.Block, error) {
 	// Perform the initial search to find and cache the latest known
 	// checkpoint if the best chain is not known yet or we haven't already
 	// previously searched.
-	if b.checkpointBlock == nil && b.nextCheckpoint == nil {
+	if b.checkpointHeader == nil && b.nextCheckpoint == nil {
 		// Loop backwards through the available checkpoints to find one
 		// that is already available.
 		checkpointIndex := -1
@@ -127,14 +130,14 @@ func (b *BlockChain) findPreviousCheckpoint() (*provautil.Block, error) {
 			return nil, nil
 		}
 
-		// Cache the latest known checkpoint block for future lookups.
+		// Cache the latest known checkpoint header for future lookups.
 		checkpoint := checkpoints[checkpointIndex]
 		err = b.db.View(func(dbTx database.Tx) error {
-			block, err := dbFetchBlockByHash(dbTx, checkpoint.Hash)
+			header, err := dbFetchHeaderByHash(dbTx, checkpoint.Hash)
 			if err != nil {
 				return err
 			}
-			b.checkpointBlock = block
+			b.checkpointHeader = header
 
 			// Set the next expected checkpoint block accordingly.
 			b.nextCheckpoint = nil
@@ -148,21 +151,21 @@ func (b *BlockChain) findPreviousCheckpoint() (*provautil.Block, error) {
 			return nil, err
 		}
 
-		return b.checkpointBlock, nil
+		return b.checkpointHeader, nil
 	}
 
 	// At this point we've already searched for the latest known checkpoint,
 	// so when there is no next checkpoint, the current checkpoint lockin
 	// will always be the latest known checkpoint.
 	if b.nextCheckpoint == nil {
-		return b.checkpointBlock, nil
+		return b.checkpointHeader, nil
 	}
 
 	// When there is a next checkpoint and the height of the current best
 	// chain does not exceed it, the current checkpoint lockin is still
 	// the latest known checkpoint.
 	if b.bestNode.height < b.nextCheckpoint.Height {
-		return b.checkpointBlock, nil
+		return b.checkpointHeader, nil
 	}
 
 	// We've reached or exceeded the next checkpoint height.  Note that
@@ -170,16 +173,16 @@ func (b *BlockChain) findPreviousCheckpoint() (*provautil.Block, error) {
 	// any blocks before the checkpoint, so we don't have to worry about the
 	// checkpoint going away out from under us due to a chain reorganize.
 
-	// Cache the latest known checkpoint block for future lookups.  Note
+	// Cache the latest known checkpoint header for future lookups.  Note
 	// that if this lookup fails something is very wrong since the chain
 	// has already passed the checkpoint which was verified as accurate
 	// before inserting it.
 	err := b.db.View(func(tx database.Tx) error {
-		block, err := dbFetchBlockByHash(tx, b.nextCheckpoint.Hash)
+		header, err := dbFetchHeaderByHash(tx, b.nextCheckpoint.Hash)
 		if err != nil {
 			return err
 		}
-		b.checkpointBlock = block
+		b.checkpointHeader = header
 		return nil
 	})
 	if err != nil {
@@ -199,7 +202,7 @@ func (b *BlockChain) findPreviousCheckpoint() (*provautil.Block, error) {
 		b.nextCheckpoint = &checkpoints[checkpointIndex+1]
 	}
 
-	return b.checkpointBlock, nil
+	return b.checkpointHeader, nil
 }
 
 // isNonstandardTransaction determines whether a transaction contains any
@@ -10,15 +10,18 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"testing"
 
 	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/database"
 	_ "github.com/bitgo/prova/database/ffldb"
+	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
 )
@@ -105,7 +108,7 @@ func chainSetup(dbName string, params *chaincfg.Params) (*blockchain.BlockChain,
 		teardown = func() {
 			db.Close()
 			os.RemoveAll(dbPath)
-			os.RemoveAll(testDbRoot)
+			os.Remove(testDbRoot)
 		}
 	}
 
@@ -129,6 +132,82 @@ func chainSetup(dbName string, params *chaincfg.Params) (*blockchain.BlockChain,
 	return chain, teardown, nil
 }
 
+// testChainDB creates a database for the network of the passed chain
+// parameters in a new temporary directory with the passed name prefix.  Any
+// extra arguments are passed on to the database driver.  It also returns a
+// teardown function the caller should invoke when done testing which closes
+// the database and removes the directory.
+func testChainDB(t *testing.T, name string, params *chaincfg.Params, args ...interface{}) (database.DB, func()) {
+	tmpDir, err := ioutil.TempDir("", name)
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	dbArgs := append([]interface{}{filepath.Join(tmpDir, "db"),
+		params.Net}, args...)
+	db, err := database.Create(testDbType, dbArgs...)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatalf("unable to create db: %v", err)
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(tmpDir)
+	}
+	return db, teardown
+}
+
+// newTestChain returns a chain instance for the passed chain parameters which
+// is backed by the passed database.  The other options are taken from the
+// passed config when it is not nil, and a median time source is used unless
+// the config provides one.
+func newTestChain(t *testing.T, db database.DB, params *chaincfg.Params, config *blockchain.Config) *blockchain.BlockChain {
+	var chainConfig blockchain.Config
+	if config != nil {
+		chainConfig = *config
+	}
+	chainConfig.DB = db
+	chainConfig.ChainParams = params
+	if chainConfig.TimeSource == nil {
+		chainConfig.TimeSource = blockchain.NewMedianTime()
+	}
+	chain, err := blockchain.New(&chainConfig)
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	return chain
+}
+
+// solveBlock sets the nonce of the passed block header so its hash satisfies
+// its target difficulty.
+func solveBlock(header *wire.BlockHeader) {
+	target := blockchain.CompactToBig(header.Bits)
+	for nonce := uint64(0); ; nonce++ {
+		header.Nonce = nonce
+		hash := header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			return
+		}
+	}
+}
+
+// forkBlock returns a signed and solved block which extends the passed block
+// with a coinbase which is unique to the passed fork, followed by the passed
+// transactions.
+func forkBlock(t *testing.T, params *chaincfg.Params, prev *wire.MsgBlock, fork byte, txns ...*wire.MsgTx) *provautil.Block {
+	coinbase, err := multiChainCoinbase(params, prev.Header.Height+1)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	coinbase.TxIn[0].SignatureScript = append(
+		coinbase.TxIn[0].SignatureScript, fork)
+	block, err := multiChainSolveBlock(params, prev,
+		append([]*wire.MsgTx{coinbase}, txns...))
+	if err != nil {
+		t.Fatalf("unable to create block: %v", err)
+	}
+	return block
+}
+
 // loadUtxoView returns a utxo view loaded from a file.
 func loadUtxoView(filename string) (*blockchain.UtxoViewpoint, error) {
 	// The utxostore file format is:
@@ -6,6 +6,8 @@
 package blockchain
 
 import (
+	"bytes"
+
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/txscript"
 )
@@ -128,11 +130,18 @@ func deserializeVLQ(serialized []byte) (uint64, int) {
 //   2, 3 = compressed pubkey with bit 0 specifying the y coordinate to use
 //   4, 5 = uncompressed pubkey with bit 0 specifying the y coordinate to use
 //   ** Only valid public keys starting with 0x02, 0x03, and 0x04 are supported.
+// - Prova 2-of-3:       (23-31 bytes) - <6><20-byte pubkey hash><VLQ key id>
+//                                       <VLQ key id>
 //
 // Any scripts which are not recognized as one of the aforementioned standard
 // scripts are encoded using the general serialized format and encode the script
 // size as the sum of the actual size of the script and the number of special
 // cases.
+//
+// Version 1 of the chain state did not recognize Prova 2-of-3 scripts, so it
+// only has the first 6 special cases and encodes the size of other scripts as
+// the sum of their actual size and 6.  It is only decoded to upgrade the chain
+// state.
 // -----------------------------------------------------------------------------
 
 // The following constants specify the special constants used to identify a
@@ -167,9 +176,17 @@ const (
 	// to reconstruct the full uncompressed pubkey.
 	cstPayToPubKeyUncomp5 = 5
 
+	// cstPayToProva identifies a compressed Prova 2-of-3 script which pays
+	// to a pubkey hash and two key ids.
+	cstPayToProva = 6
+
 	// numSpecialScripts is the number of special scripts recognized by the
 	// domain-specific script compression algorithm.
-	numSpecialScripts = 6
+	numSpecialScripts = 7
+
+	// numSpecialScriptsV1 is the number of special scripts recognized by
+	// the script compression of version 1 of the chain state.
+	numSpecialScriptsV1 = 6
 )
 
 // isPubKeyHash returns whether or not the passed public key script is a
@@ -240,6 +257,85 @@ func isPubKey(script []byte) (bool, []byte) {
 	return false, nil
 }
 
+// decodeProvaKeyID decodes the key id pushed by the passed script, possibly
+// followed by other data, and returns it along with the number of bytes the
+// push occupies.  Whether the push is canonical is left to the caller.
+func decodeProvaKeyID(script []byte) (uint64, int, bool) {
+	if len(script) == 0 {
+		return 0, 0, false
+	}
+	opcode := script[0]
+	switch {
+	case opcode == txscript.OP_0:
+		return 0, 1, true
+
+	case opcode >= txscript.OP_1 && opcode <= txscript.OP_16:
+		return uint64(opcode - (txscript.OP_1 - 1)), 1, true
+
+	case opcode >= txscript.OP_DATA_1 && opcode <= txscript.OP_DATA_5:
+		dataLen := int(opcode)
+		if len(script) < 1+dataLen || script[dataLen]&0x80 != 0 {
+			return 0, 0, false
+		}
+		var keyID uint64
+		for i := dataLen; i > 0; i-- {
+			keyID = keyID<<8 | uint64(script[i])
+		}
+		return keyID, 1 + dataLen, true
+	}
+	return 0, 0, false
+}
+
+// provaScript returns the Prova 2-of-3 script which pays to the passed pubkey
+// hash and key ids.  It is built the same way as the scripts of Prova
+// addresses so templated scripts are restored byte for byte.
+func provaScript(pubKeyHash []byte, keyID1, keyID2 uint64) []byte {
+	pkScript, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_2).
+		AddData(pubKeyHash).
+		AddInt64(int64(keyID1)).
+		AddInt64(int64(keyID2)).
+		AddOp(txscript.OP_3).
+		AddOp(txscript.OP_CHECKSAFEMULTISIG).
+		Script()
+	if err != nil {
+		return nil
+	}
+	return pkScript
+}
+
+// isProva returns whether or not the passed public key script is a standard
+// Prova 2-of-3 script which pays to a pubkey hash and two key ids along with
+// the pubkey hash and key ids if it is.
+//
+// NOTE: Only scripts which are restored exactly from their pubkey hash and key
+// ids are recognized, so scripts pushing the key ids in a non-canonical way
+// are encoded as is.
+func isProva(script []byte) (bool, []byte, uint64, uint64) {
+	if len(script) < 26 || script[0] != txscript.OP_2 ||
+		script[1] != txscript.OP_DATA_20 ||
+		script[len(script)-2] != txscript.OP_3 ||
+		script[len(script)-1] != txscript.OP_CHECKSAFEMULTISIG {
+
+		return false, nil, 0, 0
+	}
+
+	pushes := script[22 : len(script)-2]
+	keyID1, n1, ok := decodeProvaKeyID(pushes)
+	if !ok {
+		return false, nil, 0, 0
+	}
+	keyID2, n2, ok := decodeProvaKeyID(pushes[n1:])
+	if !ok || n1+n2 != len(pushes) {
+		return false, nil, 0, 0
+	}
+	pubKeyHash := script[2:22]
+	if !bytes.Equal(provaScript(pubKeyHash, keyID1, keyID2), script) {
+		return false, nil, 0, 0
+	}
+	return true, pubKeyHash, keyID1, keyID2
+}
+
 // compressedScriptSize returns the number of bytes the passed script would take
 // when encoded with the domain specific compression algorithm described above.
 func compressedScriptSize(pkScript []byte, version int32) int {
@@ -258,6 +354,11 @@ func compressedScriptSize(pkScript []byte, version int32) int {
 		return 33
 	}
 
+	// Prova 2-of-3 script.
+	if valid, _, keyID1, keyID2 := isProva(pkScript); valid {
+		return 21 + serializeSizeVLQ(keyID1) + serializeSizeVLQ(keyID2)
+	}
+
 	// When none of the above special cases apply, encode the script as is
 	// preceded by the sum of its size and the number of special cases
 	// encoded as a variable length quantity.
@@ -285,6 +386,20 @@ func decodeCompressedScriptSize(serialized []byte, version int32) int {
 	case cstPayToPubKeyComp2, cstPayToPubKeyComp3, cstPayToPubKeyUncomp4,
 		cstPayToPubKeyUncomp5:
 		return 33
+
+	case cstPayToProva:
+		// The size depends on the key ids which follow the pubkey
+		// hash.  Report a size beyond the end of the data when they
+		// are missing so the caller detects it.
+		offset := 21
+		for i := 0; i < 2; i++ {
+			if offset >= len(serialized) {
+				return offset + 1
+			}
+			_, keyIDLen := deserializeVLQ(serialized[offset:])
+			offset += keyIDLen
+		}
+		return offset
 	}
 
 	scriptSize -= numSpecialScripts
@@ -292,6 +407,24 @@ func decodeCompressedScriptSize(serialized []byte, version int32) int {
 	return int(scriptSize)
 }
 
+// decodeCompressedScriptSizeV1 is the counterpart of decodeCompressedScriptSize
+// for scripts compressed by version 1 of the chain state.
+func decodeCompressedScriptSizeV1(serialized []byte, version int32) int {
+	scriptSize, bytesRead := deserializeVLQ(serialized)
+	if bytesRead == 0 {
+		return 0
+	}
+
+	// The special cases version 1 recognized are encoded the same way.
+	if scriptSize < numSpecialScriptsV1 {
+		return decodeCompressedScriptSize(serialized, version)
+	}
+
+	scriptSize -= numSpecialScriptsV1
+	scriptSize += uint64(bytesRead)
+	return int(scriptSize)
+}
+
 // putCompressedScript compresses the passed script according to the domain
 // specific compression algorithm described above directly into the passed
 // target byte slice.  The target byte slice must be at least large enough to
@@ -329,6 +462,14 @@ func putCompressedScript(target, pkScript []byte, version int32) int {
 		}
 	}
 
+	// Prova 2-of-3 script.
+	if valid, hash, keyID1, keyID2 := isProva(pkScript); valid {
+		target[0] = cstPayToProva
+		copy(target[1:21], hash)
+		offset := 21 + putVLQ(target[21:], keyID1)
+		return offset + putVLQ(target[offset:], keyID2)
+	}
+
 	// When none of the above special cases apply, encode the unmodified
 	// script preceded by the sum of its size and the number of special
 	// cases encoded as a variable length quantity.
@@ -410,6 +551,17 @@ func decompressScript(compressedPkScript []byte, version int32) []byte {
 		copy(pkScript[1:], key.SerializeUncompressed())
 		pkScript[66] = txscript.OP_CHECKSIG
 		return pkScript
+
+	// Prova 2-of-3 script.  The resulting script is:
+	// <OP_2><OP_DATA_20><20 byte pubkey hash><key id push><key id push>
+	// <OP_3><OP_CHECKSAFEMULTISIG>
+	case cstPayToProva:
+		offset := bytesRead + 20
+		keyID1, keyIDLen := deserializeVLQ(compressedPkScript[offset:])
+		offset += keyIDLen
+		keyID2, _ := deserializeVLQ(compressedPkScript[offset:])
+		return provaScript(compressedPkScript[bytesRead:bytesRead+20],
+			keyID1, keyID2)
 	}
 
 	// When none of the special cases apply, the script was encoded using
@@ -421,6 +573,29 @@ func decompressScript(compressedPkScript []byte, version int32) []byte {
 	return pkScript
 }
 
+// decompressScriptV1 is the counterpart of decompressScript for scripts
+// compressed by version 1 of the chain state.
+//
+// NOTE: The script parameter must already have been proven to be long enough
+// to contain the number of bytes returned by decodeCompressedScriptSizeV1 or
+// it will panic.
+func decompressScriptV1(compressedPkScript []byte, version int32) []byte {
+	if len(compressedPkScript) == 0 {
+		return nil
+	}
+
+	// The special cases version 1 recognized are encoded the same way.
+	encodedScriptSize, bytesRead := deserializeVLQ(compressedPkScript)
+	if encodedScriptSize < numSpecialScriptsV1 {
+		return decompressScript(compressedPkScript, version)
+	}
+
+	scriptSize := int(encodedScriptSize - numSpecialScriptsV1)
+	pkScript := make([]byte, scriptSize)
+	copy(pkScript, compressedPkScript[bytesRead:bytesRead+scriptSize])
+	return pkScript
+}
+
 // -----------------------------------------------------------------------------
 // In order to reduce the size of stored amounts, a domain specific compression
 // algorithm is used which relies on there typically being a lot of zeroes at
@@ -602,3 +777,30 @@ func decodeCompressedTxOut(serialized []byte, version int32) (uint64, []byte, in
 	copy(compressedScript, serialized[bytesRead:bytesRead+scriptSize])
 	return compressedAmount, compressedScript, bytesRead + scriptSize, nil
 }
+
+// decodeCompressedTxOutV1 decodes the passed txout compressed by version 1 of
+// the chain state, possibly followed by other data, and returns its
+// decompressed amount and script along with the number of bytes it occupied.
+func decodeCompressedTxOutV1(serialized []byte, version int32) (uint64, []byte, int, error) {
+	// Deserialize the compressed amount and ensure there are bytes
+	// remaining for the compressed script.
+	compressedAmount, bytesRead := deserializeVLQ(serialized)
+	if bytesRead >= len(serialized) {
+		return 0, nil, bytesRead, errDeserialize("unexpected end of " +
+			"data after compressed amount")
+	}
+
+	// Decode the compressed script size and ensure there are enough bytes
+	// left in the slice for it.
+	scriptSize := decodeCompressedScriptSizeV1(serialized[bytesRead:],
+		version)
+	if len(serialized[bytesRead:]) < scriptSize {
+		return 0, nil, bytesRead, errDeserialize("unexpected end of " +
+			"data after script size")
+	}
+
+	amount := decompressTxOutAmount(compressedAmount)
+	pkScript := decompressScriptV1(serialized[bytesRead:bytesRead+scriptSize],
+		version)
+	return amount, pkScript, bytesRead + scriptSize, nil
+}
@@ -118,7 +118,7 @@ func TestScriptCompression(t *testing.T) {
 			name:         "nil",
 			version:      1,
 			uncompressed: nil,
-			compressed:   hexToBytes("06"),
+			compressed:   hexToBytes("07"),
 		},
 		{
 			name:         "pay-to-pubkey-hash 1",
@@ -172,21 +172,39 @@ func TestScriptCompression(t *testing.T) {
 			name:         "pay-to-pubkey invalid pubkey",
 			version:      1,
 			uncompressed: hexToBytes("3302aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaac"),
-			compressed:   hexToBytes("293302aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaac"),
+			compressed:   hexToBytes("2a3302aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaac"),
 		},
 		{
 			name:         "null data",
 			version:      1,
 			uncompressed: hexToBytes("6a200102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"),
-			compressed:   hexToBytes("286a200102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"),
+			compressed:   hexToBytes("296a200102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"),
 		},
 		{
 			name:         "requires 2 size bytes - data push 200 bytes",
 			version:      1,
 			uncompressed: append(hexToBytes("4cc8"), bytes.Repeat([]byte{0x00}, 200)...),
-			// [0x80, 0x50] = 208 as a variable length quantity
+			// [0x80, 0x51] = 209 as a variable length quantity
 			// [0x4c, 0xc8] = OP_PUSHDATA1 200
-			compressed: append(hexToBytes("80504cc8"), bytes.Repeat([]byte{0x00}, 200)...),
+			compressed: append(hexToBytes("80514cc8"), bytes.Repeat([]byte{0x00}, 200)...),
+		},
+		{
+			name:         "prova 2-of-3 small key ids",
+			version:      1,
+			uncompressed: hexToBytes("52141018853670f9f3b0582c5b9ee8ce93764ac32b93515253ba"),
+			compressed:   hexToBytes("061018853670f9f3b0582c5b9ee8ce93764ac32b930102"),
+		},
+		{
+			name:         "prova 2-of-3 large key id",
+			version:      1,
+			uncompressed: hexToBytes("52141018853670f9f3b0582c5b9ee8ce93764ac32b93520300000153ba"),
+			compressed:   hexToBytes("061018853670f9f3b0582c5b9ee8ce93764ac32b930282ff00"),
+		},
+		{
+			name:         "prova 2-of-3 non-canonical key id push",
+			version:      1,
+			uncompressed: hexToBytes("52141018853670f9f3b0582c5b9ee8ce93764ac32b9301015253ba"),
+			compressed:   hexToBytes("2252141018853670f9f3b0582c5b9ee8ce93764ac32b9301015253ba"),
 		},
 	}
 
@@ -241,6 +259,81 @@ func TestScriptCompression(t *testing.T) {
 	}
 }
 
+// TestScriptDecompressionV1 ensures scripts compressed by version 1 of the
+// chain state, which did not recognize Prova 2-of-3 scripts, still decompress
+// as expected.
+func TestScriptDecompressionV1(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		version      int32
+		uncompressed []byte
+		compressed   []byte
+	}{
+		{
+			name:         "pay-to-pubkey-hash",
+			version:      1,
+			uncompressed: hexToBytes("76a9141018853670f9f3b0582c5b9ee8ce93764ac32b9388ac"),
+			compressed:   hexToBytes("001018853670f9f3b0582c5b9ee8ce93764ac32b93"),
+		},
+		{
+			name:         "null data",
+			version:      1,
+			uncompressed: hexToBytes("6a200102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"),
+			compressed:   hexToBytes("286a200102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"),
+		},
+		{
+			name:         "prova 2-of-3",
+			version:      1,
+			uncompressed: hexToBytes("52141018853670f9f3b0582c5b9ee8ce93764ac32b93515253ba"),
+			compressed:   hexToBytes("2052141018853670f9f3b0582c5b9ee8ce93764ac32b93515253ba"),
+		},
+		{
+			name:         "requires 2 size bytes - data push 200 bytes",
+			version:      1,
+			uncompressed: append(hexToBytes("4cc8"), bytes.Repeat([]byte{0x00}, 200)...),
+			compressed:   append(hexToBytes("80504cc8"), bytes.Repeat([]byte{0x00}, 200)...),
+		},
+	}
+
+	for _, test := range tests {
+		// Ensure the compressed script size is properly decoded from
+		// the compressed script.
+		gotDecodedSize := decodeCompressedScriptSizeV1(test.compressed,
+			test.version)
+		if gotDecodedSize != len(test.compressed) {
+			t.Errorf("decodeCompressedScriptSizeV1 (%s): did not "+
+				"get expected size - got %d, want %d", test.name,
+				gotDecodedSize, len(test.compressed))
+			continue
+		}
+
+		// Ensure the script decompresses to the expected bytes.
+		gotDecompressed := decompressScriptV1(test.compressed,
+			test.version)
+		if !bytes.Equal(gotDecompressed, test.uncompressed) {
+			t.Errorf("decompressScriptV1 (%s): did not get expected "+
+				"bytes - got %x, want %x", test.name,
+				gotDecompressed, test.uncompressed)
+			continue
+		}
+
+		// Ensure the script compresses differently in the current
+		// version unless it is one of the special cases of version 1.
+		gotCompressed := make([]byte, compressedScriptSize(
+			test.uncompressed, test.version))
+		putCompressedScript(gotCompressed, test.uncompressed,
+			test.version)
+		isSpecialV1 := test.compressed[0] < numSpecialScriptsV1
+		if bytes.Equal(gotCompressed, test.compressed) != isSpecialV1 {
+			t.Errorf("putCompressedScript (%s): unexpected "+
+				"compressed bytes %x", test.name, gotCompressed)
+			continue
+		}
+	}
+}
+
 // TestScriptCompressionErrors ensures calling various functions related to
 // script compression with incorrect data returns the expected results.
 func TestScriptCompressionErrors(t *testing.T) {
@@ -366,9 +459,9 @@ func TestCompressedTxOut(t *testing.T) {
 			amount:       0,
 			compAmount:   0,
 			pkScript:     hexToBytes("6a200102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"),
-			compPkScript: hexToBytes("286a200102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"),
+			compPkScript: hexToBytes("296a200102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"),
 			version:      1,
-			compressed:   hexToBytes("00286a200102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"),
+			compressed:   hexToBytes("00296a200102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"),
 		},
 		{
 			name:         "pay-to-pubkey-hash dust",
@@ -489,4 +582,14 @@ func TestTxOutCompressionErrors(t *testing.T) {
 			"did not return expected error type - got %T, want "+
 			"errDeserialize", err)
 	}
+
+	// A compressed txout with a Prova 2-of-3 script missing its key ids
+	// must error.
+	compressedTxOut = hexToBytes("00061018853670f9f3b0582c5b9ee8ce93764ac32b9301")
+	_, _, _, err = decodeCompressedTxOut(compressedTxOut, 1)
+	if !isDeserializeErr(err) {
+		t.Fatalf("decodeCompressedTxOut with short Prova script did "+
+			"not return expected error type - got %T, want "+
+			"errDeserialize", err)
+	}
 }
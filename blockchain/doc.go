@@ -67,9 +67,17 @@ Errors
 Errors returned by this package are either the raw errors provided by underlying
 calls or of type blockchain.RuleError.  This allows the caller to differentiate
 between unexpected errors, such as database errors, versus errors due to rule
-violations through type assertions.  In addition, callers can programmatically
+violations through errors.As.  In addition, callers can programmatically
 determine the specific rule violation by examining the ErrorCode field of the
-type asserted blockchain.RuleError.
+blockchain.RuleError, or check for one directly with errors.Is(err,
+blockchain.ErrDoubleSpend) or blockchain.IsErrorCode.  Rule violations caused by
+another error, such as a script engine error, keep it so it can be retrieved
+with errors.Unwrap.
+
+ProcessBlock wraps any failure that is not a rule violation, such as a database
+error, in a blockchain.DatabaseError (internal consistency issues are reported
+as a blockchain.AssertError).  A block which fails with either of these has not
+been found to be invalid and may be processed again.
 
 Bitcoin Improvement Proposals
 
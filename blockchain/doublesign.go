@@ -0,0 +1,466 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// doubleSignBucketName is the name of the db bucket used to house the evidence
+// of validate keys which signed two different blocks at the same height.
+var doubleSignBucketName = []byte("doublesigns")
+
+// doubleSignWindow is the number of heights below the best block for which the
+// headers of the accepted blocks are remembered in order to detect double
+// signs.  Blocks further below the best block are only compared against the
+// block of the main chain at their height.
+const doubleSignWindow = 1000
+
+// DoubleSign houses the evidence that a validate key signed two different
+// blocks at the same height.
+type DoubleSign struct {
+	// ValidatingPubKey is the validate key which signed both blocks.
+	ValidatingPubKey wire.BlockValidatingPubKey
+
+	// Height is the height of both blocks.
+	Height uint32
+
+	// First is the header of the block which was accepted first, and
+	// Second is the header of the block whose acceptance revealed the
+	// double sign.
+	First  wire.BlockHeader
+	Second wire.BlockHeader
+
+	// Detected is when the double sign was detected.
+	Detected time.Time
+
+	// ClearedHeight is the height of the main chain block which
+	// provisioned the key to the validate key set again after the double
+	// sign was detected, or zero when it was not provisioned again yet.
+	ClearedHeight uint32
+}
+
+// serializedDoubleSignKeyLen is the length of the database key of a double
+// sign, which is the validate key, the height, and the hash of the second
+// block.
+const serializedDoubleSignKeyLen = wire.BlockValidatingPubKeySize + 4 + 32
+
+// doubleSignKey returns the database key of the passed double sign.
+func doubleSignKey(ds *DoubleSign) []byte {
+	key := make([]byte, serializedDoubleSignKeyLen)
+	offset := copy(key, ds.ValidatingPubKey[:])
+	binary.BigEndian.PutUint32(key[offset:], ds.Height)
+	secondHash := ds.Second.BlockHash()
+	copy(key[offset+4:], secondHash[:])
+	return key
+}
+
+// serializeDoubleSign returns the database value of the passed double sign,
+// which is the detection time, the height the key was cleared at, and both
+// headers.
+func serializeDoubleSign(ds *DoubleSign) ([]byte, error) {
+	var buf bytes.Buffer
+	var scratch [12]byte
+	byteOrder.PutUint64(scratch[:8], uint64(ds.Detected.Unix()))
+	byteOrder.PutUint32(scratch[8:], ds.ClearedHeight)
+	buf.Write(scratch[:])
+	if err := ds.First.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	if err := ds.Second.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// deserializeDoubleSign decodes the double sign with the passed database key
+// and value.
+func deserializeDoubleSign(key, serialized []byte) (*DoubleSign, error) {
+	if len(key) != serializedDoubleSignKeyLen || len(serialized) < 12 {
+		return nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt double sign entry",
+		}
+	}
+	ds := &DoubleSign{
+		Height:        binary.BigEndian.Uint32(key[wire.BlockValidatingPubKeySize:]),
+		Detected:      time.Unix(int64(byteOrder.Uint64(serialized[:8])), 0),
+		ClearedHeight: byteOrder.Uint32(serialized[8:12]),
+	}
+	copy(ds.ValidatingPubKey[:], key)
+	r := bytes.NewReader(serialized[12:])
+	if err := ds.First.Deserialize(r); err != nil {
+		return nil, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("corrupt double sign entry: %v",
+				err),
+		}
+	}
+	if err := ds.Second.Deserialize(r); err != nil {
+		return nil, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("corrupt double sign entry: %v",
+				err),
+		}
+	}
+	return ds, nil
+}
+
+// dbPutDoubleSign stores the passed double sign.
+func dbPutDoubleSign(dbTx database.Tx, ds *DoubleSign) error {
+	bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+		doubleSignBucketName)
+	if err != nil {
+		return err
+	}
+	serialized, err := serializeDoubleSign(ds)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(doubleSignKey(ds), serialized)
+}
+
+// doubleSignDetector tracks the validate keys which signed the blocks accepted
+// recently at each height, along with the double signs detected so far.  It is
+// protected by the chain lock.
+type doubleSignDetector struct {
+	// signed holds the header of the first block accepted at each height
+	// within the window for each validate key.
+	signed map[uint32]map[wire.BlockValidatingPubKey]wire.BlockHeader
+
+	// records holds the double signs in the order they were detected, and
+	// flagged holds the first double sign of each validate key which was
+	// not provisioned again since.
+	records []*DoubleSign
+	flagged map[wire.BlockValidatingPubKey]*DoubleSign
+}
+
+// newDoubleSignDetector returns a detector which knows about the passed double
+// signs which were detected previously.
+func newDoubleSignDetector(records []*DoubleSign) *doubleSignDetector {
+	d := &doubleSignDetector{
+		signed:  make(map[uint32]map[wire.BlockValidatingPubKey]wire.BlockHeader),
+		records: records,
+		flagged: make(map[wire.BlockValidatingPubKey]*DoubleSign),
+	}
+	for _, ds := range records {
+		d.flag(ds)
+	}
+	return d
+}
+
+// flag marks the validate key of the passed double sign as a double signer
+// unless it was provisioned again since, or is already marked.
+func (d *doubleSignDetector) flag(ds *DoubleSign) {
+	if ds.ClearedHeight != 0 {
+		return
+	}
+	if _, ok := d.flagged[ds.ValidatingPubKey]; !ok {
+		d.flagged[ds.ValidatingPubKey] = ds
+	}
+}
+
+// remember records the passed header as the first block accepted at its height
+// for its validate key, and forgets the heights which fell out of the window
+// below the passed best height.
+func (d *doubleSignDetector) remember(header *wire.BlockHeader, bestHeight uint32) {
+	signers, ok := d.signed[header.Height]
+	if !ok {
+		signers = make(map[wire.BlockValidatingPubKey]wire.BlockHeader)
+		d.signed[header.Height] = signers
+	}
+	signers[header.ValidatingPubKey] = *header
+
+	// Prune once the map holds twice as many heights as needed so the
+	// cost is amortized over many blocks.
+	if len(d.signed) <= 2*doubleSignWindow {
+		return
+	}
+	for height := range d.signed {
+		if height+doubleSignWindow < bestHeight {
+			delete(d.signed, height)
+		}
+	}
+}
+
+// doubleSignSorter implements sort.Interface to allow a slice of double signs
+// to be sorted by the time they were detected.
+type doubleSignSorter []*DoubleSign
+
+// Len returns the number of double signs in the slice.  It is part of the
+// sort.Interface implementation.
+func (s doubleSignSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the double signs at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s doubleSignSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the double sign with index i was detected before the
+// double sign with index j.  It is part of the sort.Interface implementation.
+func (s doubleSignSorter) Less(i, j int) bool {
+	return s[i].Detected.Before(s[j].Detected)
+}
+
+// loadDoubleSigns returns the double signs stored in the database ordered by
+// the time they were detected.
+func loadDoubleSigns(db database.DB) ([]*DoubleSign, error) {
+	var records []*DoubleSign
+	err := db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(doubleSignBucketName)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			ds, err := deserializeDoubleSign(k, v)
+			if err != nil {
+				return err
+			}
+			records = append(records, ds)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Stable(doubleSignSorter(records))
+	return records, nil
+}
+
+// detectDoubleSign compares the passed header of a block which is being
+// accepted against the header of the block accepted first at the same height
+// with the same validate key, and stores the evidence with the passed database
+// transaction and returns it when they differ.  The blocks accepted before the
+// chain instance was created are only known through the main chain.  Nil is
+// returned when the block is not a double sign.
+//
+// The returned double sign is only known to the chain instance once it is
+// passed to recordDoubleSign after the transaction is committed.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) detectDoubleSign(dbTx database.Tx, header *wire.BlockHeader) (*DoubleSign, error) {
+	// Blocks aren't signed on proof of work only chains.
+	if b.chainParams.PowOnly {
+		return nil, nil
+	}
+
+	hash := header.BlockHash()
+	first, ok := b.doubleSigns.signed[header.Height][header.ValidatingPubKey]
+	if !ok && header.Height <= b.bestNode.height {
+		mainHeader, err := dbFetchHeaderByHeight(dbTx, header.Height)
+		if err != nil {
+			return nil, err
+		}
+		if mainHeader.ValidatingPubKey == header.ValidatingPubKey &&
+			mainHeader.BlockHash() != hash {
+
+			first, ok = *mainHeader, true
+		}
+	}
+	if !ok {
+		b.doubleSigns.remember(header, b.bestNode.height)
+		return nil, nil
+	}
+	if first.BlockHash() == hash {
+		return nil, nil
+	}
+
+	// A block which failed to connect for a reason other than breaking a
+	// rule is accepted again once it is processed again, and the double
+	// sign it revealed is already known then.
+	for _, ds := range b.doubleSigns.records {
+		if ds.ValidatingPubKey == header.ValidatingPubKey &&
+			ds.Height == header.Height && ds.Second.BlockHash() == hash {
+
+			return nil, nil
+		}
+	}
+
+	ds := &DoubleSign{
+		ValidatingPubKey: header.ValidatingPubKey,
+		Height:           header.Height,
+		First:            first,
+		Second:           *header,
+		Detected:         time.Unix(time.Now().Unix(), 0),
+	}
+	if err := dbPutDoubleSign(dbTx, ds); err != nil {
+		return nil, err
+	}
+	b.doubleSigns.remember(&first, b.bestNode.height)
+	return ds, nil
+}
+
+// recordDoubleSign adds the passed double sign, which was returned by
+// detectDoubleSign and stored, to the double signs known to the chain
+// instance.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) recordDoubleSign(ds *DoubleSign) {
+	b.doubleSigns.records = append(b.doubleSigns.records, ds)
+	b.doubleSigns.flag(ds)
+
+	log.Errorf("Validate key %v signed blocks %v and %v at height %d",
+		ds.ValidatingPubKey, ds.First.BlockHash(), ds.Second.BlockHash(),
+		ds.Height)
+}
+
+// checkDoubleSigner ensures the passed header is not signed by a validate key
+// which double signed and was not provisioned again since, when the chain
+// rejects the blocks of such keys.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) checkDoubleSigner(header *wire.BlockHeader) error {
+	if !b.chainParams.RejectDoubleSigners {
+		return nil
+	}
+	ds, ok := b.doubleSigns.flagged[header.ValidatingPubKey]
+	if !ok {
+		return nil
+	}
+	str := fmt.Sprintf("block is signed by validate key %v which signed "+
+		"blocks %v and %v at height %d", header.ValidatingPubKey,
+		ds.First.BlockHash(), ds.Second.BlockHash(), ds.Height)
+	return ruleError(ErrDoubleSigner, str)
+}
+
+// reprovisionedDoubleSigners returns copies of the double signs of the
+// validate keys which are marked as double signers and are provisioned to the
+// validate key set again by the passed block, with the height they are cleared
+// at set.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) reprovisionedDoubleSigners(block *provautil.Block) []*DoubleSign {
+	if len(b.doubleSigns.flagged) == 0 {
+		return nil
+	}
+	var cleared []*DoubleSign
+	for _, tx := range block.Transactions() {
+		threadInt, adminOutputs := txscript.GetAdminDetails(tx)
+		if threadInt != int(provautil.ProvisionThread) {
+			continue
+		}
+		for _, pops := range adminOutputs {
+			if txscript.IsUpgradableAdminOp(pops) {
+				continue
+			}
+			isAddOp, keySetType, pubKey, _ :=
+				txscript.ExtractAdminOpData(pops)
+			if !isAddOp || keySetType != btcec.ValidateKeySet {
+				continue
+			}
+			var key wire.BlockValidatingPubKey
+			copy(key[:], pubKey.SerializeCompressed())
+			for _, ds := range b.doubleSigns.records {
+				if ds.ValidatingPubKey != key ||
+					ds.ClearedHeight != 0 {
+
+					continue
+				}
+				clearedDS := *ds
+				clearedDS.ClearedHeight = block.Height()
+				cleared = append(cleared, &clearedDS)
+			}
+		}
+	}
+	return cleared
+}
+
+// clearDoubleSigners replaces the double signs with the passed cleared copies
+// and unmarks their validate keys as double signers.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) clearDoubleSigners(cleared []*DoubleSign) {
+	for _, clearedDS := range cleared {
+		for i, ds := range b.doubleSigns.records {
+			if ds.ValidatingPubKey == clearedDS.ValidatingPubKey &&
+				ds.Height == clearedDS.Height &&
+				ds.Second.BlockHash() == clearedDS.Second.BlockHash() {
+
+				b.doubleSigns.records[i] = clearedDS
+			}
+		}
+		delete(b.doubleSigns.flagged, clearedDS.ValidatingPubKey)
+		log.Infof("Validate key %v was provisioned again at height %d "+
+			"after double signing", clearedDS.ValidatingPubKey,
+			clearedDS.ClearedHeight)
+	}
+}
+
+// disconnectedDoubleSigners returns copies of the double signs which were
+// cleared by the main chain block at the passed height, with the height they
+// are cleared at reset, for when the block is disconnected.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) disconnectedDoubleSigners(height uint32) []*DoubleSign {
+	var restored []*DoubleSign
+	for _, ds := range b.doubleSigns.records {
+		if ds.ClearedHeight != height {
+			continue
+		}
+		restoredDS := *ds
+		restoredDS.ClearedHeight = 0
+		restored = append(restored, &restoredDS)
+	}
+	return restored
+}
+
+// restoreDoubleSigners replaces the double signs with the passed copies which
+// are no longer cleared and marks their validate keys as double signers again.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) restoreDoubleSigners(restored []*DoubleSign) {
+	if len(restored) == 0 {
+		return
+	}
+	for _, restoredDS := range restored {
+		for i, ds := range b.doubleSigns.records {
+			if ds.ValidatingPubKey == restoredDS.ValidatingPubKey &&
+				ds.Height == restoredDS.Height &&
+				ds.Second.BlockHash() == restoredDS.Second.BlockHash() {
+
+				b.doubleSigns.records[i] = restoredDS
+			}
+		}
+		log.Infof("Validate key %v is no longer provisioned again after "+
+			"double signing at height %d", restoredDS.ValidatingPubKey,
+			restoredDS.Height)
+	}
+
+	// The first double sign of each key in detection order is the one it
+	// is marked with, as when the double signs are loaded.
+	b.doubleSigns.flagged = make(map[wire.BlockValidatingPubKey]*DoubleSign)
+	for _, ds := range b.doubleSigns.records {
+		b.doubleSigns.flag(ds)
+	}
+}
+
+// DoubleSigns returns the evidence of the validate keys which signed two
+// different blocks at the same height, ordered by the time the double signs
+// were detected.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DoubleSigns() []DoubleSign {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	doubleSigns := make([]DoubleSign, 0, len(b.doubleSigns.records))
+	for _, ds := range b.doubleSigns.records {
+		doubleSigns = append(doubleSigns, *ds)
+	}
+	return doubleSigns
+}
@@ -0,0 +1,401 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/chaingen"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestDoubleSigns ensures a validate key which signs two different blocks at
+// the same height is detected regardless of the order the blocks arrive in,
+// that the later blocks of the key are only rejected when the chain parameters
+// ask for it, and that the evidence is persisted across restarts.
+func TestDoubleSigns(t *testing.T) {
+	// Generate a chain which is reorganized one block deep at height 2.
+	// All generated blocks are signed by the same validate key, so the
+	// two blocks at height 2 are a double sign.
+	var blocks []*chaingen.Block
+	err := chaingen.Generate(&chaingen.Config{
+		Params:        &chaincfg.RegressionNetParams,
+		NumBlocks:     3,
+		ReorgInterval: 2,
+		ReorgDepth:    1,
+	}, func(block *chaingen.Block) error {
+		blocks = append(blocks, block)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to generate blocks: %v", err)
+	}
+	if len(blocks) != 4 {
+		t.Fatalf("unexpected number of generated blocks %d", len(blocks))
+	}
+	mainTwo, forkTwo, forkThree := blocks[1], blocks[2], blocks[3]
+
+	tests := []struct {
+		name   string
+		reject bool
+		order  []*chaingen.Block
+	}{
+		{
+			name:  "main chain first",
+			order: []*chaingen.Block{blocks[0], mainTwo, forkTwo},
+		},
+		{
+			name:  "fork first",
+			order: []*chaingen.Block{blocks[0], forkTwo, mainTwo},
+		},
+		{
+			name:   "main chain first rejecting",
+			reject: true,
+			order:  []*chaingen.Block{blocks[0], mainTwo, forkTwo},
+		},
+		{
+			name:   "fork first rejecting",
+			reject: true,
+			order:  []*chaingen.Block{blocks[0], forkTwo, mainTwo},
+		},
+	}
+	for _, test := range tests {
+		params := chaincfg.RegressionNetParams
+		params.RejectDoubleSigners = test.reject
+		db, teardown := testChainDB(t, "doublesigns", &params)
+		defer teardown()
+
+		chain := newTestChain(t, db, &params, nil)
+		for _, block := range test.order {
+			_, isOrphan, err := chain.ProcessBlock(block.Block,
+				blockchain.BFNone)
+			if err != nil || isOrphan {
+				t.Fatalf("%s: block %v processed with orphan %v: "+
+					"%v", test.name, block.Hash(), isOrphan, err)
+			}
+		}
+
+		// checkDoubleSigns ensures the passed chain knows about the
+		// double sign of the blocks at height 2 in arrival order.
+		checkDoubleSigns := func(chain *blockchain.BlockChain) {
+			doubleSigns := chain.DoubleSigns()
+			if len(doubleSigns) != 1 {
+				t.Fatalf("%s: unexpected number of double signs %d",
+					test.name, len(doubleSigns))
+			}
+			ds := doubleSigns[0]
+			header := &test.order[1].MsgBlock().Header
+			if ds.ValidatingPubKey != header.ValidatingPubKey ||
+				ds.Height != 2 || ds.ClearedHeight != 0 ||
+				ds.First.BlockHash() != *test.order[1].Hash() ||
+				ds.Second.BlockHash() != *test.order[2].Hash() {
+
+				t.Fatalf("%s: unexpected double sign %+v",
+					test.name, ds)
+			}
+		}
+		checkDoubleSigns(chain)
+
+		// The block which extends the fork is signed by the same key,
+		// so it is rejected only when double signers are rejected.
+		checkForkThree := func(chain *blockchain.BlockChain) {
+			_, _, err := chain.ProcessBlock(forkThree.Block,
+				blockchain.BFNone)
+			if test.reject {
+				rerr, ok := err.(blockchain.RuleError)
+				if !ok || rerr.ErrorCode != blockchain.ErrDoubleSigner {
+					t.Fatalf("%s: unexpected error: %v",
+						test.name, err)
+				}
+			} else if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+		}
+		checkForkThree(chain)
+
+		// The double sign is known after a restart, and the key is
+		// still rejected when double signers are rejected.
+		chain = newTestChain(t, db, &params, nil)
+		checkDoubleSigns(chain)
+		if test.reject {
+			checkForkThree(chain)
+		}
+	}
+}
+
+// doubleSignAdminTx returns an admin transaction which continues the passed
+// admin thread from the passed tip with an output for each of the passed admin
+// ops applied to the passed key, signed by the passed keys.
+func doubleSignAdminTx(t *testing.T, params *chaincfg.Params, threadID provautil.ThreadID, tip *wire.OutPoint, keys []txscript.PrivateKey, pubKey *btcec.PublicKey, ops ...byte) *wire.MsgTx {
+	threadScript, err := txscript.ProvaThreadScript(threadID)
+	if err != nil {
+		t.Fatalf("unable to create thread script: %v", err)
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *tip,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxOut(wire.NewTxOut(0, threadScript))
+	for _, op := range ops {
+		data := make([]byte, 1+btcec.PubKeyBytesLenCompressed)
+		data[0] = op
+		copy(data[1:], pubKey.SerializeCompressed())
+		opScript, err := txscript.NewScriptBuilder().
+			AddOp(txscript.OP_RETURN).AddData(data).Script()
+		if err != nil {
+			t.Fatalf("unable to create admin op script: %v", err)
+		}
+		tx.AddTxOut(wire.NewTxOut(0, opScript))
+	}
+	lookupKey := func(provautil.Address) ([]txscript.PrivateKey, error) {
+		return keys, nil
+	}
+	sigScript, err := txscript.SignTxOutput(params, tx, 0, 0, threadScript,
+		txscript.SigHashAll, txscript.KeyClosure(lookupKey), nil)
+	if err != nil {
+		t.Fatalf("unable to sign transaction: %v", err)
+	}
+	tx.TxIn[0].SignatureScript = sigScript
+	return tx
+}
+
+// TestDoubleSignReorg ensures the double signs of a validate key are cleared
+// by a block which provisions the key to the validate key set again, and that
+// they are no longer cleared, both in memory and in the database, once the
+// block is disconnected by a reorganization, so they are cleared again when
+// the block is connected again.
+func TestDoubleSignReorg(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	db, teardown := testChainDB(t, "doublesignreorg", &params)
+	defer teardown()
+
+	// The provision keys are added through the root thread, and then
+	// provision a new validate key so the validate key which signs all of
+	// the blocks can be revoked and added again.
+	var provisionKeys []txscript.PrivateKey
+	for _, seed := range []string{"provision-1", "provision-2"} {
+		privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(),
+			chainhash.HashB([]byte(seed)))
+		provisionKeys = append(provisionKeys,
+			txscript.PrivateKey{Key: privKey, Compressed: true})
+	}
+	newValidateKey, _ := btcec.PrivKeyFromBytes(btcec.S256(),
+		chainhash.HashB([]byte("validate")))
+	validateKey := multiChainValidateKey.PubKey()
+
+	genesisHash := params.GenesisBlock.Transactions[0].TxHash()
+	rootTx := doubleSignAdminTx(t, &params, provautil.RootThread,
+		wire.NewOutPoint(&genesisHash, uint32(provautil.RootThread)),
+		multiChainRootKeys, provisionKeys[0].Key.PubKey(),
+		txscript.AdminOpProvisionKeyAdd)
+	rootHash := rootTx.TxHash()
+	provisionTx := doubleSignAdminTx(t, &params, provautil.RootThread,
+		wire.NewOutPoint(&rootHash, 0), multiChainRootKeys,
+		provisionKeys[1].Key.PubKey(), txscript.AdminOpProvisionKeyAdd)
+	addTx := doubleSignAdminTx(t, &params, provautil.ProvisionThread,
+		wire.NewOutPoint(&genesisHash, uint32(provautil.ProvisionThread)),
+		provisionKeys, newValidateKey.PubKey(),
+		txscript.AdminOpValidateKeyAdd)
+	addHash := addTx.TxHash()
+	revokeTx := doubleSignAdminTx(t, &params, provautil.ProvisionThread,
+		wire.NewOutPoint(&addHash, 0), provisionKeys, validateKey,
+		txscript.AdminOpValidateKeyRevoke)
+	revokeHash := revokeTx.TxHash()
+	reprovisionTx := doubleSignAdminTx(t, &params, provautil.ProvisionThread,
+		wire.NewOutPoint(&revokeHash, 0), provisionKeys, validateKey,
+		txscript.AdminOpValidateKeyAdd)
+
+	// Fork a double signs fork b at height 2, and provisions the key
+	// again at height 3.  Fork b then becomes the main chain, where the
+	// key double signs fork a at height 3, until fork a becomes the main
+	// chain again.
+	a1 := forkBlock(t, &params, params.GenesisBlock, 'a')
+	a2 := forkBlock(t, &params, a1.MsgBlock(), 'a')
+	b2 := forkBlock(t, &params, a1.MsgBlock(), 'b')
+	a3 := forkBlock(t, &params, a2.MsgBlock(), 'a', rootTx, provisionTx,
+		addTx, revokeTx, reprovisionTx)
+	b3 := forkBlock(t, &params, b2.MsgBlock(), 'b')
+	b4 := forkBlock(t, &params, b3.MsgBlock(), 'b')
+	a4 := forkBlock(t, &params, a3.MsgBlock(), 'a')
+	a5 := forkBlock(t, &params, a4.MsgBlock(), 'a')
+
+	chain := newTestChain(t, db, &params, nil)
+	process := func(block *provautil.Block, wantMainChain bool) {
+		isMainChain, isOrphan, err := chain.ProcessBlock(block,
+			blockchain.BFNone)
+		if err != nil || isOrphan || isMainChain != wantMainChain {
+			t.Fatalf("block %v at height %d processed with main "+
+				"chain %v, orphan %v: %v", block.Hash(),
+				block.Height(), isMainChain, isOrphan, err)
+		}
+	}
+
+	// checkDoubleSigns ensures the double signs known to the passed chain
+	// are at the passed heights and cleared at the passed heights, in the
+	// order they were detected.
+	type wantDoubleSign struct {
+		height        uint32
+		clearedHeight uint32
+	}
+	checkDoubleSigns := func(desc string, chain *blockchain.BlockChain, want []wantDoubleSign) {
+		doubleSigns := chain.DoubleSigns()
+		if len(doubleSigns) != len(want) {
+			t.Fatalf("%s: got %d double signs, want %d", desc,
+				len(doubleSigns), len(want))
+		}
+		for i, ds := range doubleSigns {
+			if ds.Height != want[i].height ||
+				ds.ClearedHeight != want[i].clearedHeight {
+
+				t.Fatalf("%s: double sign #%d at height %d "+
+					"cleared at height %d, want %d cleared at %d",
+					desc, i, ds.Height, ds.ClearedHeight,
+					want[i].height, want[i].clearedHeight)
+			}
+		}
+	}
+
+	process(a1, true)
+	process(a2, true)
+	process(b2, false)
+	checkDoubleSigns("double sign", chain, []wantDoubleSign{{2, 0}})
+	process(a3, true)
+	checkDoubleSigns("provisioned again", chain, []wantDoubleSign{{2, 3}})
+
+	// Disconnecting the block which provisioned the key again restores the
+	// double sign it cleared, which is kept across restarts.
+	process(b3, false)
+	process(b4, true)
+	want := []wantDoubleSign{{2, 0}, {3, 0}}
+	checkDoubleSigns("reorganized", chain, want)
+	restarted := newTestChain(t, db, &params, nil)
+	checkDoubleSigns("reorganized after restart", restarted, want)
+
+	// Connecting the block again clears all of the double signs of the
+	// key, including the one detected when the chain is reorganized.
+	process(a4, false)
+	process(a5, true)
+	want = []wantDoubleSign{{2, 3}, {3, 3}, {4, 3}}
+	checkDoubleSigns("reorganized back", chain, want)
+	chain = newTestChain(t, db, &params, nil)
+	checkDoubleSigns("reorganized back after restart", chain, want)
+}
+
+// TestRejectDoubleSigner ensures the blocks of a validate key which double
+// signed are rejected when the chain parameters ask for it until a block which
+// provisions the key to the validate key set again is connected, and that they
+// are rejected again, also after a restart, once the block is disconnected by a
+// reorganization.
+func TestRejectDoubleSigner(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	params.RejectDoubleSigners = true
+	db, teardown := testChainDB(t, "rejectdoublesigner", &params)
+	defer teardown()
+
+	// The provision keys are added through the root thread, and then
+	// provision a second validate key which signs the block which revokes
+	// the validate key that signs the other blocks and adds it again.
+	var provisionKeys []txscript.PrivateKey
+	for _, seed := range []string{"provision-1", "provision-2"} {
+		privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(),
+			chainhash.HashB([]byte(seed)))
+		provisionKeys = append(provisionKeys,
+			txscript.PrivateKey{Key: privKey, Compressed: true})
+	}
+	newValidateKey, _ := btcec.PrivKeyFromBytes(btcec.S256(),
+		chainhash.HashB([]byte("validate")))
+	validateKey := multiChainValidateKey.PubKey()
+
+	genesisHash := params.GenesisBlock.Transactions[0].TxHash()
+	rootTx := doubleSignAdminTx(t, &params, provautil.RootThread,
+		wire.NewOutPoint(&genesisHash, uint32(provautil.RootThread)),
+		multiChainRootKeys, provisionKeys[0].Key.PubKey(),
+		txscript.AdminOpProvisionKeyAdd)
+	rootHash := rootTx.TxHash()
+	provisionTx := doubleSignAdminTx(t, &params, provautil.RootThread,
+		wire.NewOutPoint(&rootHash, 0), multiChainRootKeys,
+		provisionKeys[1].Key.PubKey(), txscript.AdminOpProvisionKeyAdd)
+	addTx := doubleSignAdminTx(t, &params, provautil.ProvisionThread,
+		wire.NewOutPoint(&genesisHash, uint32(provautil.ProvisionThread)),
+		provisionKeys, newValidateKey.PubKey(),
+		txscript.AdminOpValidateKeyAdd)
+	addHash := addTx.TxHash()
+	revokeTx := doubleSignAdminTx(t, &params, provautil.ProvisionThread,
+		wire.NewOutPoint(&addHash, 0), provisionKeys, validateKey,
+		txscript.AdminOpValidateKeyRevoke)
+	revokeHash := revokeTx.TxHash()
+	reprovisionTx := doubleSignAdminTx(t, &params, provautil.ProvisionThread,
+		wire.NewOutPoint(&revokeHash, 0), provisionKeys, validateKey,
+		txscript.AdminOpValidateKeyAdd)
+
+	// The key double signs fork b at height 2, so its block a3 is rejected
+	// while a3 signed by the second key provisions it again.  Fork b then
+	// becomes the main chain, which disconnects the block again.
+	a1 := forkBlock(t, &params, params.GenesisBlock, 'a', rootTx,
+		provisionTx, addTx)
+	a2 := forkBlock(t, &params, a1.MsgBlock(), 'a')
+	b2 := forkBlock(t, &params, a1.MsgBlock(), 'b')
+	rejectedA3 := forkBlock(t, &params, a2.MsgBlock(), 'a')
+	a3 := resignBlock(t, forkBlock(t, &params, a2.MsgBlock(), 'a',
+		revokeTx, reprovisionTx), newValidateKey)
+	b3 := forkBlock(t, &params, b2.MsgBlock(), 'b')
+	b4 := forkBlock(t, &params, b3.MsgBlock(), 'b')
+	b5 := forkBlock(t, &params, b4.MsgBlock(), 'b')
+
+	chain := newTestChain(t, db, &params, nil)
+	process := func(block *provautil.Block, wantMainChain bool) {
+		isMainChain, isOrphan, err := chain.ProcessBlock(block,
+			blockchain.BFNone)
+		if err != nil || isOrphan || isMainChain != wantMainChain {
+			t.Fatalf("block %v at height %d processed with main "+
+				"chain %v, orphan %v: %v", block.Hash(),
+				block.Height(), isMainChain, isOrphan, err)
+		}
+	}
+	checkRejected := func(desc string, chain *blockchain.BlockChain, block *provautil.Block) {
+		_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+		rerr, ok := err.(blockchain.RuleError)
+		if !ok || rerr.ErrorCode != blockchain.ErrDoubleSigner {
+			t.Fatalf("%s: unexpected error: %v", desc, err)
+		}
+	}
+
+	process(a1, true)
+	process(a2, true)
+	process(b2, false)
+	checkRejected("double signer", chain, rejectedA3)
+
+	// The key is accepted again once the block which provisions it again
+	// is connected.
+	process(a3, true)
+	process(b3, false)
+
+	// Disconnecting the block rejects the key again, which is kept across
+	// restarts.
+	process(b4, true)
+	checkRejected("reorganized", chain, b5)
+	chain = newTestChain(t, db, &params, nil)
+	checkRejected("reorganized after restart", chain, b5)
+}
+
+// resignBlock returns a copy of the passed block which is signed by the passed
+// validate key and solved again.
+func resignBlock(t *testing.T, block *provautil.Block, key *btcec.PrivateKey) *provautil.Block {
+	msgBlock := *block.MsgBlock()
+	if err := msgBlock.Header.Sign(key); err != nil {
+		t.Fatalf("unable to sign block: %v", err)
+	}
+	solveBlock(&msgBlock.Header)
+	return provautil.NewBlock(&msgBlock)
+}
@@ -6,17 +6,44 @@
 package blockchain
 
 import (
+	"errors"
 	"fmt"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
 )
 
 // AssertError identifies an error that indicates an internal code consistency
-// issue and should be treated as a critical and unrecoverable error.
-type AssertError string
+// issue and should be treated as a critical and unrecoverable error.  Err holds
+// the underlying error which revealed the issue, if any, such as a failure to
+// parse data read from the database.
+type AssertError struct {
+	Description string // Human readable description of the issue
+	Err         error  // Underlying error, if any
+}
 
 // Error returns the assertion error as a huma-readable string and satisfies
 // the error interface.
 func (e AssertError) Error() string {
-	return "assertion failed: " + string(e)
+	return "assertion failed: " + e.Description
+}
+
+// Unwrap returns the underlying error of the assertion error, if any, so it can
+// be matched with errors.Is and errors.As.
+func (e AssertError) Unwrap() error {
+	return e.Err
+}
+
+// assertError creates an AssertError with the passed description.
+func assertError(desc string) AssertError {
+	return AssertError{Description: desc}
+}
+
+// assertErrorWrap creates an AssertError with the passed description for an
+// issue revealed by the passed underlying error.
+func assertErrorWrap(desc string, err error) AssertError {
+	return AssertError{Description: desc, Err: err}
 }
 
 // ErrorCode identifies a kind of error.
@@ -123,8 +150,9 @@ const (
 	// range or not referencing one at all.
 	ErrBadTxInput
 
-	// ErrMissingTx indicates a transaction referenced by an input is
-	// missing.
+	// ErrMissingTx indicates a transaction output referenced by an input is
+	// unknown.  Since transactions are pruned once all of their outputs are
+	// spent, this includes outputs of fully spent transactions.
 	ErrMissingTx
 
 	// ErrUnfinalizedTx indicates a transaction has not been finalized.
@@ -223,6 +251,44 @@ const (
 	// ErrFeeTooHigh indicates a transaction fee exceeds the limit for
 	// fee paid.
 	ErrFeeTooHigh
+
+	// ErrSpentTxOut indicates a transaction output referenced by an input
+	// exists, but has already been spent.
+	ErrSpentTxOut
+
+	// ErrNonMonotonicTime indicates the time in the passed block's header
+	// is not after the time of the previous block on a chain which requires
+	// strictly increasing block timestamps.
+	ErrNonMonotonicTime
+
+	// ErrTimestampRegression indicates the time in the passed block's
+	// header is further before the latest time of the last several blocks
+	// than the chain allows.
+	ErrTimestampRegression
+
+	// ErrDoubleSigner indicates the passed block is signed by a validate
+	// key which was seen signing two different blocks at the same height
+	// and was not provisioned again since, on a chain which rejects the
+	// blocks of such keys.
+	ErrDoubleSigner
+
+	// ErrTxExpired indicates a transaction is included in a block at or
+	// after its expiry height.
+	ErrTxExpired
+
+	// ErrKeyIDReuse indicates an admin transaction provisions a keyID
+	// which has been revoked to an ASP key other than the one it was bound
+	// to.
+	ErrKeyIDReuse
+
+	// ErrReorgTooDeep indicates a reorganization would disconnect more
+	// blocks than the prune depth of the chain, which may no longer have
+	// the data of the blocks needed to disconnect them.
+	ErrReorgTooDeep
+
+	// ErrMissingParent indicates a block header processed ahead of its
+	// block does not extend a known block or block header.
+	ErrMissingParent
 )
 
 // Map of ErrorCode values back to their constant names for pretty printing.
@@ -274,6 +340,14 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrInvalidAdminTx:       "ErrInvalidAdminTx",
 	ErrInvalidAdminOp:       "ErrInvalidAdminOp",
 	ErrFeeTooHigh:           "ErrFeeTooHigh",
+	ErrSpentTxOut:           "ErrSpentTxOut",
+	ErrNonMonotonicTime:     "ErrNonMonotonicTime",
+	ErrTimestampRegression:  "ErrTimestampRegression",
+	ErrDoubleSigner:         "ErrDoubleSigner",
+	ErrTxExpired:            "ErrTxExpired",
+	ErrKeyIDReuse:           "ErrKeyIDReuse",
+	ErrReorgTooDeep:         "ErrReorgTooDeep",
+	ErrMissingParent:        "ErrMissingParent",
 }
 
 // String returns the ErrorCode as a human-readable name.
@@ -284,14 +358,23 @@ func (e ErrorCode) String() string {
 	return fmt.Sprintf("Unknown ErrorCode (%d)", int(e))
 }
 
+// Error returns the ErrorCode as a human-readable name and satisfies the error
+// interface, which allows error codes to be used as targets of errors.Is.
+func (e ErrorCode) Error() string {
+	return e.String()
+}
+
 // RuleError identifies a rule violation.  It is used to indicate that
 // processing of a block or transaction failed due to one of the many validation
-// rules.  The caller can use type assertions to determine if a failure was
+// rules.  The caller can use errors.As to determine if a failure was
 // specifically due to a rule violation and access the ErrorCode field to
-// ascertain the specific reason for the rule violation.
+// ascertain the specific reason for the rule violation, or use IsErrorCode to
+// check for a specific reason directly.
 type RuleError struct {
-	ErrorCode   ErrorCode // Describes the kind of error
-	Description string    // Human readable description of the issue
+	ErrorCode   ErrorCode   // Describes the kind of error
+	Description string      // Human readable description of the issue
+	Input       *TxInputRef // Input which violated the rule, if any
+	Err         error       // Underlying error which caused the violation, if any
 }
 
 // Error satisfies the error interface and prints human-readable errors.
@@ -299,7 +382,188 @@ func (e RuleError) Error() string {
 	return e.Description
 }
 
+// Unwrap returns the underlying error of the rule violation, if any, such as
+// the script engine error which caused a script to fail validation.
+func (e RuleError) Unwrap() error {
+	return e.Err
+}
+
+// Is returns whether the rule violation matches the passed target, which is
+// the case for an ErrorCode or a RuleError with the same error code.  This
+// allows errors.Is(err, ErrDoubleSpend) to check for a specific rule violation.
+func (e RuleError) Is(target error) bool {
+	switch target := target.(type) {
+	case ErrorCode:
+		return e.ErrorCode == target
+	case RuleError:
+		return e.ErrorCode == target.ErrorCode
+	}
+	return false
+}
+
 // ruleError creates an RuleError given a set of arguments.
 func ruleError(c ErrorCode, desc string) RuleError {
 	return RuleError{ErrorCode: c, Description: desc}
 }
+
+// ruleErrorWrap creates a RuleError for a rule violation caused by the passed
+// underlying error, which is preserved so callers can inspect it.
+func ruleErrorWrap(c ErrorCode, desc string, err error) RuleError {
+	return RuleError{ErrorCode: c, Description: desc, Err: err}
+}
+
+// IsErrorCode returns whether the passed error is, or wraps, a RuleError with
+// the passed error code.
+func IsErrorCode(err error, c ErrorCode) bool {
+	return errors.Is(err, c)
+}
+
+// errorCodeRejectCodes maps each ErrorCode to the reject code sent to peers in
+// reject messages for blocks and transactions which violate the rule.  Every
+// ErrorCode MUST have an entry.
+var errorCodeRejectCodes = map[ErrorCode]wire.RejectCode{
+	// Rejected due to duplicate.
+	ErrDuplicateBlock: wire.RejectDuplicate,
+	ErrDoubleSpend:    wire.RejectDuplicate,
+
+	// Rejected due to obsolete version.
+	ErrBlockVersionTooOld: wire.RejectObsolete,
+
+	// Rejected due to checkpoint.
+	ErrDifficultyTooLow:     wire.RejectCheckpoint,
+	ErrBadCheckpoint:        wire.RejectCheckpoint,
+	ErrForkTooOld:           wire.RejectCheckpoint,
+	ErrCheckpointTimeTooOld: wire.RejectCheckpoint,
+	ErrReorgTooDeep:         wire.RejectCheckpoint,
+
+	// Rejected due to an admin transaction which is not allowed.
+	ErrInvalidAdminTx: wire.RejectInvalidAdmin,
+	ErrInvalidAdminOp: wire.RejectInvalidAdmin,
+	ErrKeyIDReuse:     wire.RejectInvalidAdmin,
+
+	// Everything else is due to the block or transaction being invalid.
+	ErrBlockTooBig:          wire.RejectInvalid,
+	ErrInvalidTime:          wire.RejectInvalid,
+	ErrTimeTooOld:           wire.RejectInvalid,
+	ErrTimeTooNew:           wire.RejectInvalid,
+	ErrUnexpectedDifficulty: wire.RejectInvalid,
+	ErrBadHeight:            wire.RejectInvalid,
+	ErrBadBlockSignature:    wire.RejectInvalid,
+	ErrHighHash:             wire.RejectInvalid,
+	ErrBadMerkleRoot:        wire.RejectInvalid,
+	ErrNoTransactions:       wire.RejectInvalid,
+	ErrTooManyTransactions:  wire.RejectInvalid,
+	ErrNoTxInputs:           wire.RejectInvalid,
+	ErrNoTxOutputs:          wire.RejectInvalid,
+	ErrTxTooBig:             wire.RejectInvalid,
+	ErrBadTxOutValue:        wire.RejectInvalid,
+	ErrDuplicateTxInputs:    wire.RejectInvalid,
+	ErrBadTxInput:           wire.RejectInvalid,
+	ErrMissingTx:            wire.RejectInvalid,
+	ErrUnfinalizedTx:        wire.RejectInvalid,
+	ErrDuplicateTx:          wire.RejectInvalid,
+	ErrOverwriteTx:          wire.RejectInvalid,
+	ErrImmatureSpend:        wire.RejectInvalid,
+	ErrSpendTooHigh:         wire.RejectInvalid,
+	ErrBadFees:              wire.RejectInvalid,
+	ErrTooManySigOps:        wire.RejectInvalid,
+	ErrFirstTxNotCoinbase:   wire.RejectInvalid,
+	ErrMultipleCoinbases:    wire.RejectInvalid,
+	ErrBadCoinbaseScriptLen: wire.RejectInvalid,
+	ErrBadCoinbaseValue:     wire.RejectInvalid,
+	ErrScriptMalformed:      wire.RejectInvalid,
+	ErrScriptValidation:     wire.RejectInvalid,
+	ErrExcessiveChainShare:  wire.RejectInvalid,
+	ErrExcessiveTrailing:    wire.RejectInvalid,
+	ErrInconsistentBlkSize:  wire.RejectInvalid,
+	ErrInvalidCoinbase:      wire.RejectInvalid,
+	ErrInvalidTx:            wire.RejectInvalid,
+	ErrInvalidValidateKey:   wire.RejectInvalid,
+	ErrFeeTooHigh:           wire.RejectInvalid,
+	ErrSpentTxOut:           wire.RejectInvalid,
+	ErrNonMonotonicTime:     wire.RejectInvalid,
+	ErrTimestampRegression:  wire.RejectInvalid,
+	ErrDoubleSigner:         wire.RejectInvalid,
+	ErrTxExpired:            wire.RejectInvalid,
+	ErrMissingParent:        wire.RejectInvalid,
+}
+
+// RejectCode returns the reject code sent to peers for blocks and transactions
+// which violate the rule the ErrorCode identifies.  Unknown error codes return
+// wire.RejectInvalid.
+func (e ErrorCode) RejectCode() wire.RejectCode {
+	if code, ok := errorCodeRejectCodes[e]; ok {
+		return code
+	}
+	return wire.RejectInvalid
+}
+
+// ErrToRejectErr returns a reject code and reason appropriate to be sent in a
+// wire.MsgReject message for the passed error.  Errors which are, or wrap, a
+// RuleError use the reject code of its ErrorCode along with the error text.
+// Any other error is reported as wire.RejectInvalid with the error text.
+func ErrToRejectErr(err error) (wire.RejectCode, string) {
+	if err == nil {
+		return wire.RejectInvalid, "rejected"
+	}
+	var rerr RuleError
+	if errors.As(err, &rerr) {
+		return rerr.ErrorCode.RejectCode(), err.Error()
+	}
+	return wire.RejectInvalid, err.Error()
+}
+
+// TxInputRef identifies a transaction input along with the previous output it
+// references.
+type TxInputRef struct {
+	TxHash    chainhash.Hash // Hash of the spending transaction
+	TxInIndex int            // Index of the input in the spending transaction
+	PrevOut   wire.OutPoint  // Previous output referenced by the input
+}
+
+// txInputError creates a RuleError for a rule violation by the passed input of
+// the passed transaction.  The description identifies the spending transaction,
+// the input index, and the previous output, which the passed adjective, such as
+// "unknown" or "spent", describes.
+func txInputError(c ErrorCode, tx *provautil.Tx, txInIndex int, adjective string) RuleError {
+	prevOut := tx.MsgTx().TxIn[txInIndex].PreviousOutPoint
+	desc := fmt.Sprintf("transaction %v input %d references %s output %v",
+		tx.Hash(), txInIndex, adjective, prevOut)
+	return RuleError{
+		ErrorCode:   c,
+		Description: desc,
+		Input: &TxInputRef{
+			TxHash:    *tx.Hash(),
+			TxInIndex: txInIndex,
+			PrevOut:   prevOut,
+		},
+	}
+}
+
+// DatabaseError identifies a failure that occurred while processing a block
+// which is unrelated to the validity of the block, such as a failure to read or
+// write the database.  Unlike a RuleError, it does not mean the block is
+// invalid, so the block may be processed again.
+type DatabaseError struct {
+	Err error // Underlying error
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e DatabaseError) Error() string {
+	return "database failure: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error of the database failure.
+func (e DatabaseError) Unwrap() error {
+	return e.Err
+}
+
+// wrapNonRuleError returns the passed error wrapped in a DatabaseError unless
+// it is a RuleError or AssertError, which are returned as is.
+func wrapNonRuleError(err error) error {
+	switch err.(type) {
+	case RuleError, AssertError, DatabaseError:
+		return err
+	}
+	return DatabaseError{Err: err}
+}
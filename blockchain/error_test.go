@@ -6,9 +6,12 @@
 package blockchain_test
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/wire"
 )
 
 // TestErrorCodeStringer tests the stringized output for the ErrorCode type.
@@ -61,6 +64,14 @@ func TestErrorCodeStringer(t *testing.T) {
 		{blockchain.ErrInconsistentBlkSize, "ErrInconsistentBlkSize"},
 		{blockchain.ErrInvalidValidateKey, "ErrInvalidValidateKey"},
 		{blockchain.ErrFeeTooHigh, "ErrFeeTooHigh"},
+		{blockchain.ErrSpentTxOut, "ErrSpentTxOut"},
+		{blockchain.ErrNonMonotonicTime, "ErrNonMonotonicTime"},
+		{blockchain.ErrTimestampRegression, "ErrTimestampRegression"},
+		{blockchain.ErrDoubleSigner, "ErrDoubleSigner"},
+		{blockchain.ErrTxExpired, "ErrTxExpired"},
+		{blockchain.ErrKeyIDReuse, "ErrKeyIDReuse"},
+		{blockchain.ErrReorgTooDeep, "ErrReorgTooDeep"},
+		{blockchain.ErrMissingParent, "ErrMissingParent"},
 		{0xffff, "Unknown ErrorCode (65535)"},
 	}
 
@@ -101,3 +112,158 @@ func TestRuleError(t *testing.T) {
 		}
 	}
 }
+
+// TestErrorWrapping ensures rule violations match their error code with
+// errors.Is and IsErrorCode, and that rule violations, assertion errors and
+// database failures can be told apart with errors.As while their underlying
+// errors remain available through errors.Unwrap.
+func TestErrorWrapping(t *testing.T) {
+	cause := errors.New("script engine failure")
+	ruleErr := blockchain.RuleError{
+		ErrorCode:   blockchain.ErrScriptValidation,
+		Description: "failed to validate input",
+		Err:         cause,
+	}
+	assertErr := blockchain.AssertError{
+		Description: "corrupt thread tip",
+		Err:         cause,
+	}
+	dbErr := blockchain.DatabaseError{Err: cause}
+
+	// Wrapping a rule violation again must not hide it.
+	wrapped := fmt.Errorf("processing block: %w", ruleErr)
+
+	// The description is reported unchanged.
+	if got := ruleErr.Error(); got != "failed to validate input" {
+		t.Errorf("unexpected rule error string %q", got)
+	}
+	if got := assertErr.Error(); got != "assertion failed: corrupt "+
+		"thread tip" {
+
+		t.Errorf("unexpected assertion error string %q", got)
+	}
+
+	// Rule violations match their own error code only.
+	for _, err := range []error{ruleErr, wrapped} {
+		if !errors.Is(err, blockchain.ErrScriptValidation) ||
+			!blockchain.IsErrorCode(err, blockchain.ErrScriptValidation) {
+
+			t.Errorf("%v does not match its error code", err)
+		}
+		if errors.Is(err, blockchain.ErrDoubleSpend) ||
+			blockchain.IsErrorCode(err, blockchain.ErrDoubleSpend) {
+
+			t.Errorf("%v matches another error code", err)
+		}
+		if !errors.Is(err, blockchain.RuleError{
+			ErrorCode: blockchain.ErrScriptValidation}) {
+
+			t.Errorf("%v does not match a rule error with its "+
+				"error code", err)
+		}
+		if !errors.Is(err, cause) {
+			t.Errorf("%v does not match its underlying error", err)
+		}
+	}
+
+	// Assertion errors and database failures don't match error codes.
+	for _, err := range []error{assertErr, dbErr} {
+		if blockchain.IsErrorCode(err, blockchain.ErrScriptValidation) {
+			t.Errorf("%v matches an error code", err)
+		}
+	}
+
+	// errors.As distinguishes the error types, also when wrapped.
+	var rerr blockchain.RuleError
+	if !errors.As(wrapped, &rerr) || rerr.ErrorCode != ruleErr.ErrorCode {
+		t.Errorf("unable to extract rule error from %v", wrapped)
+	}
+	var aerr blockchain.AssertError
+	if errors.As(dbErr, &aerr) || errors.As(wrapped, &aerr) {
+		t.Error("non-assertion error extracted as assertion error")
+	}
+	if !errors.As(fmt.Errorf("connecting block: %w", assertErr), &aerr) ||
+		aerr.Description != assertErr.Description {
+
+		t.Error("unable to extract wrapped assertion error")
+	}
+	var derr blockchain.DatabaseError
+	if errors.As(assertErr, &derr) || !errors.As(dbErr, &derr) {
+		t.Error("database failure not told apart from assertion error")
+	}
+
+	// The underlying errors are returned by errors.Unwrap.
+	for _, err := range []error{ruleErr, assertErr, dbErr} {
+		if got := errors.Unwrap(err); got != cause {
+			t.Errorf("errors.Unwrap(%v) = %v, want %v", err, got,
+				cause)
+		}
+	}
+	if got := errors.Unwrap(blockchain.RuleError{}); got != nil {
+		t.Errorf("unexpected underlying error %v", got)
+	}
+}
+
+// TestErrToRejectErr ensures rule errors are converted to the expected reject
+// codes, including when they are wrapped, that every error code has an explicit
+// mapping, and that other errors are rejected as invalid with their text.
+func TestErrToRejectErr(t *testing.T) {
+	tests := []struct {
+		code blockchain.ErrorCode
+		want wire.RejectCode
+	}{
+		{blockchain.ErrDuplicateBlock, wire.RejectDuplicate},
+		{blockchain.ErrDoubleSpend, wire.RejectDuplicate},
+		{blockchain.ErrBlockVersionTooOld, wire.RejectObsolete},
+		{blockchain.ErrDifficultyTooLow, wire.RejectCheckpoint},
+		{blockchain.ErrBadCheckpoint, wire.RejectCheckpoint},
+		{blockchain.ErrForkTooOld, wire.RejectCheckpoint},
+		{blockchain.ErrCheckpointTimeTooOld, wire.RejectCheckpoint},
+		{blockchain.ErrReorgTooDeep, wire.RejectCheckpoint},
+		{blockchain.ErrInvalidAdminTx, wire.RejectInvalidAdmin},
+		{blockchain.ErrInvalidAdminOp, wire.RejectInvalidAdmin},
+		{blockchain.ErrKeyIDReuse, wire.RejectInvalidAdmin},
+		{blockchain.ErrBadBlockSignature, wire.RejectInvalid},
+		{blockchain.ErrInvalidValidateKey, wire.RejectInvalid},
+		{blockchain.ErrFeeTooHigh, wire.RejectInvalid},
+		{blockchain.ErrScriptValidation, wire.RejectInvalid},
+		{blockchain.ErrTxExpired, wire.RejectInvalid},
+		{blockchain.ErrMissingParent, wire.RejectInvalid},
+		{0xffff, wire.RejectInvalid},
+	}
+
+	for i, test := range tests {
+		rerr := blockchain.RuleError{ErrorCode: test.code,
+			Description: "description"}
+		code, reason := blockchain.ErrToRejectErr(rerr)
+		if code != test.want || reason != "description" {
+			t.Errorf("ErrToRejectErr #%d (%v): got %v %q, want %v %q",
+				i, test.code, code, reason, test.want,
+				"description")
+		}
+
+		wrapped := fmt.Errorf("context: %w", rerr)
+		code, reason = blockchain.ErrToRejectErr(wrapped)
+		if code != test.want || reason != wrapped.Error() {
+			t.Errorf("ErrToRejectErr #%d (%v wrapped): got %v %q, "+
+				"want %v %q", i, test.code, code, reason,
+				test.want, wrapped.Error())
+		}
+	}
+
+	if unmapped := blockchain.TstUnmappedRejectCodes(); len(unmapped) != 0 {
+		t.Errorf("error codes without a reject code mapping: %v",
+			unmapped)
+	}
+
+	code, reason := blockchain.ErrToRejectErr(errors.New("other"))
+	if code != wire.RejectInvalid || reason != "other" {
+		t.Errorf("ErrToRejectErr (other error): got %v %q, want %v %q",
+			code, reason, wire.RejectInvalid, "other")
+	}
+	code, reason = blockchain.ErrToRejectErr(nil)
+	if code != wire.RejectInvalid || reason != "rejected" {
+		t.Errorf("ErrToRejectErr (nil): got %v %q, want %v %q", code,
+			reason, wire.RejectInvalid, "rejected")
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bitgo/prova/database"
+)
+
+// errorStatsBucketName is the name of the db bucket used to house the number
+// of rejections by level and error code.
+var errorStatsBucketName = []byte("errorstats")
+
+// ErrorLevel identifies where a rejection counted by ErrorStats happened.
+type ErrorLevel string
+
+// These constants define the levels of the rejections counted by ErrorStats.
+const (
+	// ErrorLevelBlock is the level of blocks rejected by the chain.
+	ErrorLevelBlock ErrorLevel = "block"
+
+	// ErrorLevelMempool is the level of transactions rejected by the
+	// memory pool.
+	ErrorLevelMempool ErrorLevel = "mempool"
+)
+
+// errorStatsKey identifies a counter of ErrorStats.
+type errorStatsKey struct {
+	level ErrorLevel
+	code  string
+}
+
+// ErrorCount is the number of rejections with an error code at a level.
+type ErrorCount struct {
+	Level ErrorLevel
+	Code  string
+	Count uint64
+}
+
+// errorCountSorter implements sort.Interface to allow a slice of error counts
+// to be sorted by level and error code.
+type errorCountSorter []ErrorCount
+
+// Len returns the number of error counts in the slice.  It is part of the
+// sort.Interface implementation.
+func (s errorCountSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the error counts at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s errorCountSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the error count with index i should sort before the
+// error count with index j.  It is part of the sort.Interface implementation.
+func (s errorCountSorter) Less(i, j int) bool {
+	if s[i].Level != s[j].Level {
+		return s[i].Level < s[j].Level
+	}
+	return s[i].Code < s[j].Code
+}
+
+// ErrorStats counts the rejections of blocks and transactions by error code.
+// The counts are kept in memory and written to the metadata of the database
+// with Flush, so they accumulate across restarts and can be used to spot
+// trends in the kinds of rejections over long periods of time.
+//
+// ErrorStats is safe for concurrent access.
+type ErrorStats struct {
+	mtx    sync.Mutex
+	db     database.DB
+	counts map[errorStatsKey]uint64
+	dirty  bool
+}
+
+// serializeErrorStatsKey returns the database key of the counter with the
+// passed level and error code.
+func serializeErrorStatsKey(key errorStatsKey) []byte {
+	return []byte(string(key.level) + "/" + key.code)
+}
+
+// deserializeErrorStatsKey returns the level and error code of the counter
+// with the passed database key.
+func deserializeErrorStatsKey(serialized []byte) (errorStatsKey, error) {
+	parts := strings.SplitN(string(serialized), "/", 2)
+	if len(parts) != 2 {
+		return errorStatsKey{}, fmt.Errorf("malformed error stats key "+
+			"%q", serialized)
+	}
+	return errorStatsKey{level: ErrorLevel(parts[0]), code: parts[1]}, nil
+}
+
+// NewErrorStats returns error stats which are persisted in the passed database
+// along with the counts which were previously written to it.
+func NewErrorStats(db database.DB) (*ErrorStats, error) {
+	es := &ErrorStats{
+		db:     db,
+		counts: make(map[errorStatsKey]uint64),
+	}
+	err := db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(errorStatsBucketName)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			key, err := deserializeErrorStatsKey(k)
+			if err != nil {
+				return err
+			}
+			if len(v) != 8 {
+				return fmt.Errorf("malformed count of error "+
+					"stats key %q", k)
+			}
+			es.counts[key] = byteOrder.Uint64(v)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return es, nil
+}
+
+// Add counts a rejection with the passed error code at the passed level.
+func (es *ErrorStats) Add(level ErrorLevel, code string) {
+	es.mtx.Lock()
+	es.counts[errorStatsKey{level: level, code: code}]++
+	es.dirty = true
+	es.mtx.Unlock()
+}
+
+// AddRuleError counts the rejection of a block with the error code of the
+// passed error when it is a RuleError.  Other errors are ignored since they
+// don't indicate the block is invalid.
+func (es *ErrorStats) AddRuleError(err error) {
+	if rerr, ok := err.(RuleError); ok {
+		es.Add(ErrorLevelBlock, rerr.ErrorCode.String())
+	}
+}
+
+// Counts returns the current counts sorted by level and error code.
+func (es *ErrorStats) Counts() []ErrorCount {
+	es.mtx.Lock()
+	defer es.mtx.Unlock()
+
+	counts := make([]ErrorCount, 0, len(es.counts))
+	for key, count := range es.counts {
+		counts = append(counts, ErrorCount{
+			Level: key.level,
+			Code:  key.code,
+			Count: count,
+		})
+	}
+	sort.Sort(errorCountSorter(counts))
+	return counts
+}
+
+// Flush writes the counts to the database when they changed since they were
+// last written.
+func (es *ErrorStats) Flush() error {
+	es.mtx.Lock()
+	defer es.mtx.Unlock()
+
+	if !es.dirty {
+		return nil
+	}
+	err := es.db.Update(func(dbTx database.Tx) error {
+		bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+			errorStatsBucketName)
+		if err != nil {
+			return err
+		}
+		for key, count := range es.counts {
+			var serialized [8]byte
+			byteOrder.PutUint64(serialized[:], count)
+			err := bucket.Put(serializeErrorStatsKey(key),
+				serialized[:])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	es.dirty = false
+	return nil
+}
+
+// Reset sets all of the counts to zero and removes them from the database.
+func (es *ErrorStats) Reset() error {
+	es.mtx.Lock()
+	defer es.mtx.Unlock()
+
+	err := es.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if meta.Bucket(errorStatsBucketName) == nil {
+			return nil
+		}
+		return meta.DeleteBucket(errorStatsBucketName)
+	})
+	if err != nil {
+		return err
+	}
+	es.counts = make(map[errorStatsKey]uint64)
+	es.dirty = false
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestErrorStats ensures the blocks rejected by the chain are counted by error
+// code and the counts are persisted across restarts until they are reset.
+func TestErrorStats(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	params := chaincfg.RegressionNetParams
+	db, teardown := testChainDB(t, "errorstats", &params)
+	defer teardown()
+
+	stats, err := blockchain.NewErrorStats(db)
+	if err != nil {
+		t.Fatalf("NewErrorStats: unexpected error: %v", err)
+	}
+	chain := newTestChain(t, db, &params, &blockchain.Config{
+		ErrorStats: stats,
+	})
+
+	// process processes the passed block and counts the rule error it is
+	// rejected with.
+	want := make(map[string]uint64)
+	process := func(msgBlock *wire.MsgBlock) {
+		_, _, err := chain.ProcessBlock(provautil.NewBlock(msgBlock),
+			blockchain.BFNone)
+		if rerr, ok := err.(blockchain.RuleError); ok {
+			want[rerr.ErrorCode.String()]++
+		}
+	}
+
+	// Process the generated blocks, which are rejected for a variety of
+	// reasons, then resubmit an accepted block and submit it with a
+	// corrupted signature, solving it again since the signature is part
+	// of the hash of the block.
+	var accepted *wire.MsgBlock
+	for _, test := range tests {
+		for _, item := range test {
+			switch item := item.(type) {
+			case fullblocktests.AcceptedBlock:
+				if accepted == nil {
+					accepted = item.Block
+				}
+				process(item.Block)
+			case fullblocktests.RejectedBlock:
+				process(item.Block)
+			case fullblocktests.OrphanOrRejectedBlock:
+				process(item.Block)
+			}
+		}
+	}
+	process(accepted)
+	badSig := *accepted
+	badSig.Header.Signature[0] ^= 0xff
+	solveBlock(&badSig.Header)
+	process(&badSig)
+	for _, code := range []blockchain.ErrorCode{
+		blockchain.ErrDuplicateBlock,
+		blockchain.ErrBadBlockSignature,
+		blockchain.ErrNonMonotonicTime,
+		blockchain.ErrBadCoinbaseValue,
+	} {
+		if want[code.String()] == 0 {
+			t.Fatalf("no blocks were rejected with %v", code)
+		}
+	}
+
+	// checkCounts ensures the passed error stats hold the expected counts.
+	checkCounts := func(stats *blockchain.ErrorStats, want map[string]uint64) {
+		got := make(map[string]uint64)
+		for _, count := range stats.Counts() {
+			if count.Level != blockchain.ErrorLevelBlock {
+				t.Fatalf("unexpected level %q of code %q",
+					count.Level, count.Code)
+			}
+			got[count.Code] = count.Count
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected counts -- got %v, want %v", got,
+				want)
+		}
+	}
+	checkCounts(stats, want)
+
+	// reload writes the counts to the database, and returns the counts
+	// loaded from the database as on a restart.
+	reload := func() *blockchain.ErrorStats {
+		if err := stats.Flush(); err != nil {
+			t.Fatalf("Flush: unexpected error: %v", err)
+		}
+		reloaded, err := blockchain.NewErrorStats(db)
+		if err != nil {
+			t.Fatalf("NewErrorStats: unexpected error: %v", err)
+		}
+		return reloaded
+	}
+
+	// The counts are persisted across restarts and keep accumulating.
+	stats = reload()
+	checkCounts(stats, want)
+	stats.AddRuleError(blockchain.RuleError{
+		ErrorCode: blockchain.ErrBadBlockSignature,
+	})
+	want[blockchain.ErrBadBlockSignature.String()]++
+	stats = reload()
+	checkCounts(stats, want)
+
+	// Resetting the counts removes them from the database.
+	if err := stats.Reset(); err != nil {
+		t.Fatalf("Reset: unexpected error: %v", err)
+	}
+	checkCounts(stats, map[string]uint64{})
+	stats = reload()
+	checkCounts(stats, map[string]uint64{})
+}
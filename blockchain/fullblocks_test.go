@@ -8,6 +8,11 @@ package blockchain_test
 
 import (
 	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
 	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/blockchain/fullblocktests"
 	"github.com/bitgo/prova/btcec"
@@ -15,33 +20,261 @@ import (
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
-	"testing"
 )
 
+// corpusFile is the golden corpus of the tests generated by the fullblocktests
+// package.
+var corpusFile = filepath.Join("fullblocktests", "testdata", "corpus.json")
+
 // TestFullBlocks ensures all tests generated by the fullblocktests package
 // have the expected result when processed via ProcessBlock.
 func TestFullBlocks(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	testFullBlocks(t, "fullblocktest", &chaincfg.RegressionNetParams, tests,
+		false)
+}
+
+// TestFullBlocksPipelined ensures all tests generated by the fullblocktests
+// package have the expected result when their blocks pass through a block
+// pipeline before they are processed via ProcessBlock.
+func TestFullBlocksPipelined(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	testFullBlocks(t, "fullblocktestpipelined",
+		&chaincfg.RegressionNetParams, tests, true)
+}
+
+// TestFullBlocksPowOnly ensures the tests generated by the fullblocktests
+// package for a chain which accepts blocks on proof of work alone have the
+// expected result, both when processed directly and through a block pipeline,
+// and that the main network can't accept blocks on proof of work alone.
+func TestFullBlocksPowOnly(t *testing.T) {
+	mainNetParams := chaincfg.MainNetParams
+	mainNetParams.PowOnly = true
+	_, teardownFunc, err := chainSetup("powonlymainnet", &mainNetParams)
+	if err == nil {
+		teardownFunc()
+		t.Fatalf("chain setup on the main network: unexpected success")
+	}
+
+	params := chaincfg.RegressionNetParams
+	params.PowOnly = true
+	tests, err := fullblocktests.GenerateWithParams(&params, false,
+		fullblocktests.DefaultSeed)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	testFullBlocks(t, "fullblocktestpowonly", &params, tests, false)
+	testFullBlocks(t, "fullblocktestpowonlypipelined", &params, tests, true)
+}
+
+// TestFullBlocksTimeRegression ensures the tests generated by the
+// fullblocktests package for a chain which limits how far block timestamps may
+// regress without requiring strictly increasing block timestamps have the
+// expected result.
+func TestFullBlocksTimeRegression(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.StrictMonotonicTime = false
+	tests, err := fullblocktests.GenerateWithParams(&params, false,
+		fullblocktests.DefaultSeed)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	testFullBlocks(t, "fullblocktesttimeregression", &params, tests, false)
+}
+
+// TestFullBlocksUpgradableAdminOpsDisabled ensures the tests generated by the
+// fullblocktests package for a chain which doesn't enable upgradable admin ops
+// have the expected result.
+func TestFullBlocksUpgradableAdminOpsDisabled(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.UpgradableAdminOps = false
+	tests, err := fullblocktests.GenerateWithParams(&params, false,
+		fullblocktests.DefaultSeed)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	testFullBlocks(t, "fullblocktestupgradableadminopsdisabled", &params,
+		tests, false)
+}
+
+// TestFullBlocksReprovisionKeyIDsDisabled ensures the tests generated by the
+// fullblocktests package for a chain which doesn't allow revoked keyIDs to be
+// provisioned again have the expected result.
+func TestFullBlocksReprovisionKeyIDsDisabled(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.ReprovisionKeyIDs = false
+	tests, err := fullblocktests.GenerateWithParams(&params, false,
+		fullblocktests.DefaultSeed)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	testFullBlocks(t, "fullblocktestreprovisionkeyidsdisabled", &params,
+		tests, false)
+}
+
+// TestFullBlocksBurnFees ensures the tests generated by the fullblocktests
+// package for a chain which allows the coinbase to burn part of the fees of its
+// block have the expected result.
+func TestFullBlocksBurnFees(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.BurnFees = true
+	tests, err := fullblocktests.GenerateWithParams(&params, false,
+		fullblocktests.DefaultSeed)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	testFullBlocks(t, "fullblocktestburnfees", &params, tests, false)
+}
 
+// TestFullBlocksTxExpiry ensures the tests generated by the fullblocktests
+// package for a chain which enables transaction expiry have the expected
+// result.
+func TestFullBlocksTxExpiry(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.TxExpiry = true
+	tests, err := fullblocktests.GenerateWithParams(&params, false,
+		fullblocktests.DefaultSeed)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	testFullBlocks(t, "fullblocktesttxexpiry", &params, tests, false)
+}
+
+// TestGenerateDeterministic ensures the tests generated by the fullblocktests
+// package with the same seed have identical serialized blocks, and that the
+// seed changes the blocks.
+func TestGenerateDeterministic(t *testing.T) {
+	corpus := func(seed int64) []byte {
+		tests, err := fullblocktests.GenerateWithSeed(false, seed)
+		if err != nil {
+			t.Fatalf("failed to generate tests with seed %d: %v", seed,
+				err)
+		}
+		var buf bytes.Buffer
+		if err := fullblocktests.WriteCorpus(&buf, tests); err != nil {
+			t.Fatalf("failed to write corpus: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	first := corpus(fullblocktests.DefaultSeed)
+	second := corpus(fullblocktests.DefaultSeed)
+	if !bytes.Equal(first, second) {
+		t.Fatalf("tests generated with the same seed differ")
+	}
+	if other := corpus(1); bytes.Equal(first, other) {
+		t.Fatalf("tests generated with different seeds are identical")
+	}
+}
+
+// TestFullBlocksCorpus ensures the golden corpus of the tests generated by the
+// fullblocktests package is up to date, round-trips, and that the tests read
+// back from it have the expected result when processed via ProcessBlock.
+func TestFullBlocksCorpus(t *testing.T) {
+	golden, err := ioutil.ReadFile(corpusFile)
+	if err != nil {
+		t.Fatalf("failed to read corpus: %v", err)
+	}
+
+	// Ensure the tests are generated deterministically and match the
+	// golden corpus.
 	tests, err := fullblocktests.Generate(false)
 	if err != nil {
 		t.Fatalf("failed to generate tests: %v", err)
 	}
+	var buf bytes.Buffer
+	if err := fullblocktests.WriteCorpus(&buf, tests); err != nil {
+		t.Fatalf("failed to write corpus: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), golden) {
+		t.Fatalf("generated tests do not match the corpus in %s, "+
+			"regenerate it with go generate", corpusFile)
+	}
+
+	// Ensure the tests read from the corpus are written back unchanged.
+	tests, err = fullblocktests.ReadCorpus(bytes.NewReader(golden))
+	if err != nil {
+		t.Fatalf("failed to read corpus: %v", err)
+	}
+	buf.Reset()
+	if err := fullblocktests.WriteCorpus(&buf, tests); err != nil {
+		t.Fatalf("failed to write corpus: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), golden) {
+		t.Fatalf("corpus does not round-trip")
+	}
 
+	testFullBlocks(t, "fullblocktestcorpus", &chaincfg.RegressionNetParams,
+		tests, false)
+}
+
+// testFullBlocks runs the passed tests, such as those generated by the
+// fullblocktests package, against a new chain instance with the passed name and
+// chain parameters.  When pipelined is set, all blocks are submitted to a block pipeline up front
+// and the blocks leaving the pipeline are processed instead.
+func testFullBlocks(t *testing.T, name string, params *chaincfg.Params, tests [][]fullblocktests.TestInstance, pipelined bool) {
 	// Create a new database and chain instance to run tests against.
-	chain, teardownFunc, err := chainSetup("fullblocktest",
-		&chaincfg.RegressionNetParams)
+	chain, teardownFunc, err := chainSetup(name, params)
 	if err != nil {
 		t.Errorf("Failed to setup chain instance: %v", err)
 		return
 	}
 	defer teardownFunc()
 
+	// newBlock returns the block to process for the passed block of a test
+	// instance.  Blocks must be requested in the order of the tests when
+	// they are pipelined.
+	newBlock := func(msgBlock *wire.MsgBlock) *provautil.Block {
+		return provautil.NewBlock(msgBlock)
+	}
+	if pipelined {
+		pipeline := blockchain.NewBlockPipeline(chain, 4, 16)
+		pipeline.Start()
+		defer pipeline.Stop()
+		go func() {
+			for _, test := range tests {
+				for _, item := range test {
+					var msgBlock *wire.MsgBlock
+					switch item := item.(type) {
+					case fullblocktests.AcceptedBlock:
+						msgBlock = item.Block
+					case fullblocktests.RejectedBlock:
+						msgBlock = item.Block
+					case fullblocktests.OrphanOrRejectedBlock:
+						msgBlock = item.Block
+					default:
+						continue
+					}
+					block := provautil.NewBlock(msgBlock)
+					if !pipeline.Submit(block, nil) {
+						return
+					}
+				}
+			}
+		}()
+		newBlock = func(msgBlock *wire.MsgBlock) *provautil.Block {
+			pb := <-pipeline.Blocks()
+			if *pb.Block.Hash() != msgBlock.BlockHash() {
+				t.Fatalf("pipelined block %s does not match "+
+					"expected block %s", pb.Block.Hash(),
+					msgBlock.BlockHash())
+			}
+			return pb.Block
+		}
+	}
+
 	// testAcceptedBlock attempts to process the block in the provided test
 	// instance and ensures that it was accepted according to the flags
 	// specified in the test.
 	testAcceptedBlock := func(item fullblocktests.AcceptedBlock) {
 		blockHeight := item.Height
-		block := provautil.NewBlock(item.Block)
+		block := newBlock(item.Block)
 		block.SetHeight(blockHeight)
 		t.Logf("Testing block %s (hash %s, height %d)",
 			item.Name, block.Hash(), blockHeight)
@@ -124,7 +357,7 @@ func TestFullBlocks(t *testing.T) {
 	// specified in the test.
 	testRejectedBlock := func(item fullblocktests.RejectedBlock) {
 		blockHeight := item.Height
-		block := provautil.NewBlock(item.Block)
+		block := newBlock(item.Block)
 		block.SetHeight(blockHeight)
 		t.Logf("Testing block %s (hash %s, height %d)",
 			item.Name, block.Hash(), blockHeight)
@@ -136,26 +369,20 @@ func TestFullBlocks(t *testing.T) {
 				blockHeight)
 		}
 
-		// Ensure the error code is of the expected type and the reject
-		// code matches the value specified in the test instance.
-		rerr, ok := err.(blockchain.RuleError)
-		if !ok {
-			t.Fatalf("block %q (hash %s, height %d) returned "+
-				"unexpected error type -- got %T, want "+
-				"blockchain.RuleError", item.Name, block.Hash(),
-				blockHeight, err)
-		}
-		if rerr.ErrorCode != item.RejectCode {
+		// Ensure the error is a rule violation with the reject code
+		// specified in the test instance.
+		if !blockchain.IsErrorCode(err, item.RejectCode) {
 			t.Fatalf("block %q (hash %s, height %d) does not have "+
-				"expected reject code -- got %v %v, want %v",
-				item.Name, block.Hash(), blockHeight,
-				rerr.ErrorCode, rerr, item.RejectCode)
+				"expected reject code -- got %T %v, want %v",
+				item.Name, block.Hash(), blockHeight, err, err,
+				item.RejectCode)
 		}
 	}
 
 	// testRejectedNonCanonicalBlock attempts to decode the block in the
-	// provided test instance and ensures that it failed to decode with a
-	// message error.
+	// provided test instance and ensures that it is reported as not
+	// canonical at the expected offset and field and that strict decoding
+	// rejects it.
 	testRejectedNonCanonicalBlock := func(item fullblocktests.RejectedNonCanonicalBlock) {
 		headerLen := len(item.RawBlock)
 		if headerLen > 80 {
@@ -166,10 +393,26 @@ func TestFullBlocks(t *testing.T) {
 		t.Logf("Testing block %s (hash %s, height %d)", item.Name,
 			blockHash, blockHeight)
 
-		// Ensure there is an error due to deserializing the block.
+		// Ensure the first non-canonical byte is reported at the
+		// expected offset and field.
+		err := wire.IsCanonicalBlock(item.RawBlock)
+		ncErr, ok := err.(*wire.NonCanonicalError)
+		if !ok {
+			t.Fatalf("block %q (hash %s, height %d) should have "+
+				"been reported as non-canonical -- got %v",
+				item.Name, blockHash, blockHeight, err)
+		}
+		if ncErr.Offset != item.Offset || ncErr.Field != item.Field {
+			t.Fatalf("block %q (hash %s, height %d) reported as "+
+				"non-canonical at unexpected location -- got %q "+
+				"at offset %d, want %q at offset %d", item.Name,
+				blockHash, blockHeight, ncErr.Field,
+				ncErr.Offset, item.Field, item.Offset)
+		}
+
+		// Ensure there is an error due to strictly decoding the block.
 		var msgBlock wire.MsgBlock
-		err := msgBlock.BtcDecode(bytes.NewReader(item.RawBlock), 0)
-		if _, ok := err.(*wire.MessageError); !ok {
+		if err := msgBlock.DecodeCanonical(item.RawBlock, 0); err == nil {
 			t.Fatalf("block %q (hash %s, height %d) should have "+
 				"failed to decode", item.Name, blockHash,
 				blockHeight)
@@ -181,7 +424,7 @@ func TestFullBlocks(t *testing.T) {
 	// orphan or rejected with a rule violation.
 	testOrphanOrRejectedBlock := func(item fullblocktests.OrphanOrRejectedBlock) {
 		blockHeight := item.Height
-		block := provautil.NewBlock(item.Block)
+		block := newBlock(item.Block)
 		block.SetHeight(blockHeight)
 		t.Logf("Testing block %s (hash %s, height %d)",
 			item.Name, block.Hash(), blockHeight)
@@ -189,7 +432,8 @@ func TestFullBlocks(t *testing.T) {
 		_, isOrphan, err := chain.ProcessBlock(block, blockchain.BFNone)
 		if err != nil {
 			// Ensure the error code is of the expected type.
-			if _, ok := err.(blockchain.RuleError); !ok {
+			var rerr blockchain.RuleError
+			if !errors.As(err, &rerr) {
 				t.Fatalf("block %q (hash %s, height %d) "+
 					"returned unexpected error type -- "+
 					"got %T, want blockchain.RuleError",
@@ -0,0 +1,338 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package fullblocktests
+
+//go:generate go run gencorpus.go
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// CorpusVersion is the version of the format of the corpus written by
+// WriteCorpus.  It must be increased whenever the format changes in a way
+// readers of older versions can't handle.
+const CorpusVersion = 1
+
+// These constants define the kinds of the entries of a corpus, one for each of
+// the test instance types.
+const (
+	corpusAccepted             = "accepted"
+	corpusRejected             = "rejected"
+	corpusOrphanOrRejected     = "orphanorrejected"
+	corpusExpectedTip          = "expectedtip"
+	corpusRejectedNonCanonical = "rejectednoncanonical"
+)
+
+// corpus is the JSON representation of the tests written by WriteCorpus.
+type corpus struct {
+	Version int             `json:"version"`
+	Network string          `json:"network"`
+	Tests   [][]corpusEntry `json:"tests"`
+}
+
+// corpusEntry is the JSON representation of a test instance.  The block is the
+// hex encoded serialized block, the reject code is the name of the
+// blockchain.ErrorCode the block is expected to be rejected with, and the offset
+// and field locate the first non-canonical byte of blocks which are not
+// serialized canonically.
+type corpusEntry struct {
+	Name        string            `json:"name"`
+	Kind        string            `json:"kind"`
+	Block       string            `json:"block"`
+	Height      uint32            `json:"height"`
+	IsMainChain bool              `json:"ismainchain,omitempty"`
+	IsOrphan    bool              `json:"isorphan,omitempty"`
+	RejectCode  string            `json:"rejectcode,omitempty"`
+	Offset      int               `json:"offset,omitempty"`
+	Field       string            `json:"field,omitempty"`
+	State       *corpusChainState `json:"state,omitempty"`
+}
+
+// corpusChainState is the JSON representation of the chain state expected
+// after a block is accepted.  The thread tips are keyed by thread ID, the admin
+// key sets by the name of the key set type and the ASP keys by key ID, and all
+// of the public keys are hex encoded compressed public keys.
+type corpusChainState struct {
+	ThreadTips   map[string]string   `json:"threadtips"`
+	TotalSupply  uint64              `json:"totalsupply"`
+	AdminKeySets map[string][]string `json:"adminkeysets"`
+	ASPKeys      map[string]string   `json:"aspkeys"`
+}
+
+// serializeBlockHex returns the hex encoded serialization of the passed block.
+func serializeBlockHex(block *wire.MsgBlock) (string, error) {
+	var buf bytes.Buffer
+	if err := block.Serialize(&buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
+
+// newCorpusChainState returns the JSON representation of the chain state
+// expected by the passed accepted block test instance.
+func newCorpusChainState(item *AcceptedBlock) *corpusChainState {
+	state := &corpusChainState{
+		ThreadTips:   make(map[string]string, len(item.ThreadTips)),
+		TotalSupply:  item.TotalSupply,
+		AdminKeySets: make(map[string][]string, len(item.AdminKeySets)),
+		ASPKeys:      make(map[string]string, len(item.ASPKeyIdMap)),
+	}
+	for threadID, outPoint := range item.ThreadTips {
+		state.ThreadTips[strconv.Itoa(int(threadID))] = outPoint.String()
+	}
+	for keySetType, keySet := range item.AdminKeySets {
+		state.AdminKeySets[keySetType.String()] = keySet.ToStringArray()
+	}
+	for keyID, pubKey := range item.ASPKeyIdMap {
+		state.ASPKeys[strconv.FormatUint(uint64(keyID), 10)] =
+			hex.EncodeToString(pubKey.SerializeCompressed())
+	}
+	return state
+}
+
+// newCorpusEntry returns the JSON representation of the passed test instance.
+func newCorpusEntry(item TestInstance) (*corpusEntry, error) {
+	var entry corpusEntry
+	var block *wire.MsgBlock
+	switch item := item.(type) {
+	case AcceptedBlock:
+		entry = corpusEntry{Name: item.Name, Kind: corpusAccepted,
+			Height: item.Height, IsMainChain: item.IsMainChain,
+			IsOrphan: item.IsOrphan, State: newCorpusChainState(&item)}
+		block = item.Block
+	case RejectedBlock:
+		entry = corpusEntry{Name: item.Name, Kind: corpusRejected,
+			Height: item.Height, RejectCode: item.RejectCode.String()}
+		block = item.Block
+	case OrphanOrRejectedBlock:
+		entry = corpusEntry{Name: item.Name, Kind: corpusOrphanOrRejected,
+			Height: item.Height}
+		block = item.Block
+	case ExpectedTip:
+		entry = corpusEntry{Name: item.Name, Kind: corpusExpectedTip,
+			Height: item.Height}
+		block = item.Block
+	case RejectedNonCanonicalBlock:
+		entry = corpusEntry{Name: item.Name,
+			Kind:   corpusRejectedNonCanonical,
+			Block:  hex.EncodeToString(item.RawBlock),
+			Height: item.Height,
+			Offset: item.Offset,
+			Field:  item.Field}
+		return &entry, nil
+	default:
+		return nil, fmt.Errorf("unsupported test instance type %T", item)
+	}
+
+	blockHex, err := serializeBlockHex(block)
+	if err != nil {
+		return nil, fmt.Errorf("unable to serialize block %q: %v",
+			entry.Name, err)
+	}
+	entry.Block = blockHex
+	return &entry, nil
+}
+
+// WriteCorpus writes the passed tests, such as those returned by Generate, to
+// the passed writer as a versioned JSON corpus.  The corpus holds the
+// serialized blocks along with their expected results, so the tests can be run
+// against other implementations of the consensus rules, and is read back with
+// ReadCorpus.  The same tests always produce the same corpus.
+func WriteCorpus(w io.Writer, tests [][]TestInstance) error {
+	c := corpus{
+		Version: CorpusVersion,
+		Network: chaincfg.RegressionNetParams.Name,
+		Tests:   make([][]corpusEntry, 0, len(tests)),
+	}
+	for _, test := range tests {
+		entries := make([]corpusEntry, 0, len(test))
+		for _, item := range test {
+			entry, err := newCorpusEntry(item)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, *entry)
+		}
+		c.Tests = append(c.Tests, entries)
+	}
+
+	serialized, err := json.MarshalIndent(&c, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(serialized, '\n'))
+	return err
+}
+
+// errorCodeByName returns the blockchain.ErrorCode with the passed name.
+func errorCodeByName(name string) (blockchain.ErrorCode, error) {
+	for code := blockchain.ErrorCode(0); ; code++ {
+		codeName := code.String()
+		if strings.HasPrefix(codeName, "Unknown ErrorCode") {
+			break
+		}
+		if codeName == name {
+			return code, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown reject code %q", name)
+}
+
+// parseOutPoint parses an outpoint in the format returned by the String method
+// of wire.OutPoint.
+func parseOutPoint(s string) (*wire.OutPoint, error) {
+	sep := strings.LastIndex(s, ":")
+	if sep < 0 {
+		return nil, fmt.Errorf("malformed outpoint %q", s)
+	}
+	hash, err := chainhash.NewHashFromStr(s[:sep])
+	if err != nil {
+		return nil, err
+	}
+	index, err := strconv.ParseUint(s[sep+1:], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return wire.NewOutPoint(hash, uint32(index)), nil
+}
+
+// parseCorpusChainState sets the expected chain state of the passed accepted
+// block test instance from its JSON representation.
+func parseCorpusChainState(state *corpusChainState, item *AcceptedBlock) error {
+	item.TotalSupply = state.TotalSupply
+	item.ThreadTips = make(map[provautil.ThreadID]*wire.OutPoint,
+		len(state.ThreadTips))
+	for threadID, outPoint := range state.ThreadTips {
+		id, err := strconv.ParseUint(threadID, 10, 8)
+		if err != nil {
+			return fmt.Errorf("malformed thread ID %q", threadID)
+		}
+		item.ThreadTips[provautil.ThreadID(id)], err =
+			parseOutPoint(outPoint)
+		if err != nil {
+			return err
+		}
+	}
+
+	item.AdminKeySets = make(map[btcec.KeySetType]btcec.PublicKeySet,
+		len(state.AdminKeySets))
+	for name, pubKeys := range state.AdminKeySets {
+		keySetType := btcec.RootKeySet
+		for keySetType.String() != name {
+			if keySetType == btcec.ASPKeySet {
+				return fmt.Errorf("unknown key set type %q", name)
+			}
+			keySetType++
+		}
+		keySet, err := btcec.ParsePubKeySet(btcec.S256(), pubKeys...)
+		if err != nil {
+			return err
+		}
+		item.AdminKeySets[keySetType] = keySet
+	}
+
+	item.ASPKeyIdMap = make(btcec.KeyIdMap, len(state.ASPKeys))
+	for keyID, pubKey := range state.ASPKeys {
+		id, err := strconv.ParseUint(keyID, 10, 32)
+		if err != nil {
+			return fmt.Errorf("malformed key ID %q", keyID)
+		}
+		keySet, err := btcec.ParsePubKeySet(btcec.S256(), pubKey)
+		if err != nil {
+			return err
+		}
+		item.ASPKeyIdMap[btcec.KeyID(id)] = &keySet[0]
+	}
+	return nil
+}
+
+// parseCorpusEntry returns the test instance represented by the passed JSON
+// entry.
+func parseCorpusEntry(entry *corpusEntry) (TestInstance, error) {
+	rawBlock, err := hex.DecodeString(entry.Block)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Kind == corpusRejectedNonCanonical {
+		return RejectedNonCanonicalBlock{entry.Name, rawBlock,
+			entry.Height, entry.Offset, entry.Field}, nil
+	}
+	var block wire.MsgBlock
+	if err := block.Deserialize(bytes.NewReader(rawBlock)); err != nil {
+		return nil, err
+	}
+
+	switch entry.Kind {
+	case corpusAccepted:
+		if entry.State == nil {
+			return nil, fmt.Errorf("missing expected chain state")
+		}
+		item := AcceptedBlock{Name: entry.Name, Block: &block,
+			Height: entry.Height, IsMainChain: entry.IsMainChain,
+			IsOrphan: entry.IsOrphan}
+		if err := parseCorpusChainState(entry.State, &item); err != nil {
+			return nil, err
+		}
+		return item, nil
+	case corpusRejected:
+		code, err := errorCodeByName(entry.RejectCode)
+		if err != nil {
+			return nil, err
+		}
+		return RejectedBlock{entry.Name, &block, entry.Height, code}, nil
+	case corpusOrphanOrRejected:
+		return OrphanOrRejectedBlock{entry.Name, &block, entry.Height}, nil
+	case corpusExpectedTip:
+		return ExpectedTip{entry.Name, &block, entry.Height}, nil
+	}
+	return nil, fmt.Errorf("unknown kind %q", entry.Kind)
+}
+
+// ReadCorpus reads a corpus written by WriteCorpus from the passed reader and
+// returns the tests it holds, which can be run the same way as those returned
+// by Generate.  An error is returned when the corpus has an unsupported
+// version or is malformed.
+func ReadCorpus(r io.Reader) ([][]TestInstance, error) {
+	var c corpus
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, err
+	}
+	if c.Version != CorpusVersion {
+		return nil, fmt.Errorf("unsupported corpus version %d", c.Version)
+	}
+	if c.Network != chaincfg.RegressionNetParams.Name {
+		return nil, fmt.Errorf("unsupported corpus network %q",
+			c.Network)
+	}
+
+	tests := make([][]TestInstance, 0, len(c.Tests))
+	for testNum, entries := range c.Tests {
+		test := make([]TestInstance, 0, len(entries))
+		for itemNum := range entries {
+			item, err := parseCorpusEntry(&entries[itemNum])
+			if err != nil {
+				return nil, fmt.Errorf("test #%d, item #%d (%s): "+
+					"%v", testNum, itemNum,
+					entries[itemNum].Name, err)
+			}
+			test = append(test, item)
+		}
+		tests = append(tests, test)
+	}
+	return tests, nil
+}
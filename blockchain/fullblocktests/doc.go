@@ -16,5 +16,24 @@ independent versions over the peer-to-peer network.
 This package has intentionally been designed so it can be used as a standalone
 package for any projects needing to test their implementation against a full set
 of blocks that excerise the consensus validation rules.
+
+Corpus
+
+The generated blocks are deterministic, since the generator only uses fixed
+keys, fixed timestamps, RFC6979 signatures and a seeded random source, so the
+tests can also be used by implementations which are not written in Go.
+GenerateWithSeed generates the same tests from another seed to produce
+alternate sets of blocks, and GenerateWithParams generates them for a chain
+with other rules enabled, such as one accepting blocks on proof of work alone,
+in which case the blocks are left unsigned and the tests of the block signature
+rules are skipped.  WriteCorpus writes the tests as a
+versioned JSON corpus holding the serialized blocks in hex along with their
+heights, expected results, the names of the expected reject codes, and the
+chain state expected after each accepted block.  ReadCorpus reads the tests back
+so they can be run against the blockchain code to ensure the corpus and the
+implementation agree.
+
+The golden corpus in testdata/corpus.json must be regenerated with go generate
+whenever the generated tests change.
 */
 package fullblocktests
@@ -0,0 +1,35 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// This file is ignored during the regular build due to the following build tag.
+// It is called by go generate and used to regenerate the golden corpus of the
+// tests, which must be done whenever the generated tests change.
+// +build ignore
+
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+)
+
+func main() {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fi, err := os.Create(filepath.Join("testdata", "corpus.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fi.Close()
+
+	if err := fullblocktests.WriteCorpus(fi, tests); err != nil {
+		log.Fatal(err)
+	}
+}
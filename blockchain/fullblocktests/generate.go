@@ -11,6 +11,7 @@
 package fullblocktests
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/bitgo/prova/blockchain"
@@ -20,12 +21,33 @@ import (
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
-	"math"
 	"math/rand"
-	"runtime"
+	"sync"
 	"time"
 )
 
+// DefaultSeed is the seed used by Generate for the source of the random values
+// in the generated blocks, such as the public key hashes of the outputs.  Along
+// with the fixed keys, the fixed timestamps and the deterministic RFC6979
+// signatures, it makes the generated blocks the same every time, which is
+// required to export them as a corpus.
+const DefaultSeed int64 = 0x70726f7661
+
+// maxTestBlockTransactions is the highest maximum number of transactions per
+// block of a network for which blocks at the limit are generated, which keeps
+// the generated blocks small.
+const maxTestBlockTransactions = 1000
+
+var (
+	// generateMtx serializes the generation of tests since they share the
+	// random source.
+	generateMtx sync.Mutex
+
+	// rng is the random source of the generator.  It is reset every time
+	// tests are generated.
+	rng *rand.Rand
+)
+
 var (
 	// Some keys to make tests easier.
 	privKey1, _ = btcec.PrivKeyFromBytes(btcec.S256(), []byte{
@@ -156,11 +178,16 @@ var _ TestInstance = ExpectedTip{}
 func (b ExpectedTip) FullBlockTestInstance() {}
 
 // RejectedNonCanonicalBlock defines a test instance that expects a serialized
-// block that is not canonical and therefore should be rejected.
+// block that is not canonical and therefore should be rejected.  Offset is the
+// offset of the first byte which differs from the canonical serialization of
+// the block and Field names the field of the canonical serialization it is in,
+// as reported by wire.IsCanonicalBlock.
 type RejectedNonCanonicalBlock struct {
 	Name     string
 	RawBlock []byte
 	Height   uint32
+	Offset   int
+	Field    string
 }
 
 // FullBlockTestInstance only exists to allow RejectedNonCanonicalBlock to be treated as
@@ -214,6 +241,18 @@ type testGenerator struct {
 
 	// Common key for any tests which require signed transactions.
 	privKey *btcec.PrivateKey
+
+	// sign signs the header of each generated block.  It is nil when the
+	// chain accepts blocks on proof of work alone, so the generated blocks
+	// are left unsigned.
+	sign func(header *wire.BlockHeader)
+}
+
+// signWith returns a function which signs a block header with the passed key.
+func signWith(key *btcec.PrivateKey) func(*wire.BlockHeader) {
+	return func(header *wire.BlockHeader) {
+		header.Sign(key)
+	}
 }
 
 // makeTestGenerator returns a test generator instance initialized with the
@@ -222,6 +261,10 @@ func makeTestGenerator(params *chaincfg.Params) (testGenerator, error) {
 	genesis := params.GenesisBlock
 	genesis.Header.Sign(validatePrivKey)
 	genesisHash := genesis.Header.BlockHash()
+	var sign func(*wire.BlockHeader)
+	if !params.PowOnly {
+		sign = signWith(validatePrivKey)
+	}
 	return testGenerator{
 		params:       params,
 		blocks:       map[chainhash.Hash]*wire.MsgBlock{genesisHash: genesis},
@@ -231,6 +274,7 @@ func makeTestGenerator(params *chaincfg.Params) (testGenerator, error) {
 		tipName:      "genesis",
 		tipHeight:    0,
 		privKey:      privKey2,
+		sign:         sign,
 	}, nil
 }
 
@@ -317,7 +361,7 @@ func (g *testGenerator) createCoinbaseTx(blockHeight uint32) *wire.MsgTx {
 	//   - has keyId1 and keyId2, so it can be spend by always the same
 	//      private keys defined for this test suite
 	pkHash := make([]byte, 20)
-	rand.Read(pkHash)
+	rng.Read(pkHash)
 	addr, _ := provautil.NewAddressProva(pkHash, []btcec.KeyID{keyId1, keyId2}, &chaincfg.RegressionNetParams)
 	scriptPkScript, _ := txscript.PayToAddrScript(addr)
 
@@ -348,57 +392,23 @@ func calcMerkleRoot(txns []*wire.MsgTx) chainhash.Hash {
 // found true is returned and the nonce field of the passed header is updated
 // with the solution.  False is returned if no solution exists.
 //
+// The nonces are tried in order so the same solution is always found, which
+// keeps the generated blocks deterministic.  This is fast enough since the
+// tests are generated with the minimum difficulty.
+//
 // NOTE: This function will never solve blocks with a nonce of 0.  This is done
 // so the 'nextBlock' function can properly detect when a nonce was modified by
 // a munge function.
 func solveBlock(header *wire.BlockHeader) bool {
-	// sbResult is used by the solver goroutines to send results.
-	type sbResult struct {
-		found bool
-		nonce uint32
-	}
-
-	// solver accepts a block header and a nonce range to test. It is
-	// intended to be run as a goroutine.
+	// We need to modify the nonce field of the header, so make sure we
+	// work with a copy of the original header.
+	hdr := *header
 	targetDifficulty := blockchain.CompactToBig(header.Bits)
-	quit := make(chan bool)
-	results := make(chan sbResult)
-	solver := func(hdr wire.BlockHeader, startNonce, stopNonce uint32) {
-		// We need to modify the nonce field of the header, so make sure
-		// we work with a copy of the original header.
-		for i := startNonce; i >= startNonce && i <= stopNonce; i++ {
-			select {
-			case <-quit:
-				return
-			default:
-				hdr.Nonce = uint64(i)
-				hash := hdr.BlockHash()
-				if blockchain.HashToBig(&hash).Cmp(targetDifficulty) <= 0 {
-					results <- sbResult{true, i}
-					return
-				}
-			}
-		}
-		results <- sbResult{false, 0}
-	}
-
-	startNonce := uint32(1)
-	stopNonce := uint32(math.MaxUint32)
-	numCores := uint32(runtime.NumCPU())
-	noncesPerCore := (stopNonce - startNonce) / numCores
-	for i := uint32(0); i < numCores; i++ {
-		rangeStart := startNonce + (noncesPerCore * i)
-		rangeStop := startNonce + (noncesPerCore * (i + 1)) - 1
-		if i == numCores-1 {
-			rangeStop = stopNonce
-		}
-		go solver(*header, rangeStart, rangeStop)
-	}
-	for i := uint32(0); i < numCores; i++ {
-		result := <-results
-		if result.found {
-			close(quit)
-			header.Nonce = uint64(result.nonce)
+	for i := uint32(1); i != 0; i++ {
+		hdr.Nonce = uint64(i)
+		hash := hdr.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(targetDifficulty) <= 0 {
+			header.Nonce = uint64(i)
 			return true
 		}
 	}
@@ -414,6 +424,22 @@ func additionalTx(tx *wire.MsgTx) func(*wire.MsgBlock) {
 	}
 }
 
+// chainedSpendTxs returns a function that itself takes a block and adds the
+// passed number of transactions to it.  The first one spends the provided
+// output and each of the others spends the output of the one before, all
+// without a fee, so the transactions are minimal.
+func chainedSpendTxs(spend *spendableOut, numTxs int) func(*wire.MsgBlock) {
+	return func(b *wire.MsgBlock) {
+		next := spend
+		for i := 0; i < numTxs; i++ {
+			tx := createSpendTx(next, 0)
+			b.AddTransaction(tx)
+			out := makeSpendableOutForTx(tx, 0)
+			next = &out
+		}
+	}
+}
+
 // changeCoinbaseValue returns a function that itself takes a block and changes
 // it to alter the claim of the coinbase reward.
 func changeCoinbaseValue(delta int64) func(*wire.MsgBlock) {
@@ -424,13 +450,22 @@ func changeCoinbaseValue(delta int64) func(*wire.MsgBlock) {
 	}
 }
 
+// changeTimestamp returns a function that itself takes a block and changes
+// its header timestamp to be offset from the timestamp of the provided parent
+// block.
+func changeTimestamp(parent *wire.MsgBlock, offset time.Duration) func(*wire.MsgBlock) {
+	return func(b *wire.MsgBlock) {
+		b.Header.Timestamp = parent.Header.Timestamp.Add(offset)
+	}
+}
+
 func makeAddr(priv *btcec.PrivateKey, kids *[2]uint) provautil.Address {
 	// Create an Prova address that has:
 	//   - a random pkHash address, so transaction hashes don't collide
 	//   - has keyId1 and keyId2, so it can be spend by always the same
 	//      private keys defined for this test suite
 	pkHash := make([]byte, 20)
-	rand.Read(pkHash)
+	rng.Read(pkHash)
 	if priv != nil {
 		pub := (*btcec.PublicKey)(&priv.PublicKey)
 		pkHash = provautil.Hash160(pub.SerializeCompressed())
@@ -510,6 +545,26 @@ func createSpendTx(spend *spendableOut, fee provautil.Amount) *wire.MsgTx {
 	return spendTx
 }
 
+// createExpiringSpendTx creates a transaction like createSpendTx, without a
+// fee, which can't be included in blocks at or after the provided expiry
+// height.  The expiry is only encoded when the provided chain parameters enable
+// transaction expiry.
+func createExpiringSpendTx(spend *spendableOut, expiry uint32, params *chaincfg.Params) *wire.MsgTx {
+	spendTx := createSpendTx(spend, 0)
+	spendTx.Version = wire.TxVersionExpiry
+	spendTx.Expiry = expiry
+	spendTx.ExpiryEncoding = params.TxExpiry
+
+	// The expiry is committed to by the signature, so sign again.
+	spendTx.TxIn[0].SignatureScript = nil
+	sigScript, _ := txscript.SignTxOutput(&chaincfg.RegressionNetParams, spendTx,
+		0, int64(spend.amount), spend.pkScript, txscript.SigHashAll, txscript.KeyClosure(lookupKey), nil)
+
+	spendTx.TxIn[0].SignatureScript = sigScript
+
+	return spendTx
+}
+
 // createAdminTx creates an admin tx.
 func createAdminTx(spend *spendableOut, threadID provautil.ThreadID, op byte, pubKey *btcec.PublicKey) *wire.MsgTx {
 	spendTx := wire.NewMsgTx(1)
@@ -619,6 +674,7 @@ func createIssueTx(thread *spendableOut, value int64, spend *spendableOut) *wire
 // In order to simply the logic in the munge functions, the following rules are
 // applied after all munge functions have been invoked:
 // - The merkle root will be recalculated unless it was manually changed
+// - The block will be signed unless blocks are accepted on proof of work alone
 // - The block will be solved unless the nonce was changed
 func (g *testGenerator) nextBlock(blockName string, spend *spendableOut, mungers ...func(*wire.MsgBlock)) *wire.MsgBlock {
 	// Create coinbase transaction for the block using any additional
@@ -633,14 +689,10 @@ func (g *testGenerator) nextBlock(blockName string, spend *spendableOut, mungers
 		txns = append(txns, createSpendTx(spend, 0))
 	}
 
-	// Use a timestamp that is two minutes after the previous block unless
-	// this is the first block in which case the current time is used.
-	var ts time.Time
-	if nextHeight == 1 {
-		ts = time.Unix(time.Now().Unix(), 0)
-	} else {
-		ts = g.tip.Header.Timestamp.Add(time.Minute * 2)
-	}
+	// Use a timestamp that is two minutes after the previous block, which
+	// starts from the fixed timestamp of the genesis block so the generated
+	// blocks don't depend on the current time.
+	ts := g.tip.Header.Timestamp.Add(time.Minute * 2)
 
 	block := wire.MsgBlock{
 		Header: wire.BlockHeader{
@@ -666,7 +718,9 @@ func (g *testGenerator) nextBlock(blockName string, spend *spendableOut, mungers
 		block.Header.MerkleRoot = calcMerkleRoot(block.Transactions)
 	}
 	block.Header.Size = uint32(block.SerializeSize())
-	block.Header.Sign(validatePrivKey)
+	if g.sign != nil {
+		g.sign(&block.Header)
+	}
 
 	// Only solve the block if the nonce wasn't manually changed by a munge
 	// function.
@@ -716,7 +770,35 @@ func (g *testGenerator) saveTipCoinbaseOut() {
 // contains additional information about the expected result, however that
 // information can be ignored when doing comparison tests between two
 // independent versions over the peer-to-peer network.
-func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
+//
+// The generated blocks are deterministic, so they are the same every time this
+// is called.  It is equivalent to GenerateWithSeed with DefaultSeed.
+func Generate(includeLargeReorg bool) ([][]TestInstance, error) {
+	return GenerateWithSeed(includeLargeReorg, DefaultSeed)
+}
+
+// GenerateWithSeed returns the same tests as Generate with the random values in
+// the generated blocks drawn from a source with the passed seed, which can be
+// used to produce alternate corpora.  The blocks generated with the same seed
+// are always the same.
+//
+// The keys used to sign the blocks and the admin transactions are not derived
+// from the seed since they must match the keys of the chain parameters.
+func GenerateWithSeed(includeLargeReorg bool, seed int64) ([][]TestInstance, error) {
+	return GenerateWithParams(&chaincfg.RegressionNetParams, includeLargeReorg,
+		seed)
+}
+
+// GenerateWithParams returns the same tests as GenerateWithSeed for a chain
+// with the passed parameters, which must be the regression test network
+// parameters or a copy of them with different rules enabled.  When the
+// parameters accept blocks on proof of work alone, the generated blocks are not
+// signed and the tests of the block signature rules are skipped.
+func GenerateWithParams(params *chaincfg.Params, includeLargeReorg bool, seed int64) (tests [][]TestInstance, err error) {
+	generateMtx.Lock()
+	defer generateMtx.Unlock()
+	rng = rand.New(rand.NewSource(seed))
+
 	// In order to simplify the generation code which really should never
 	// fail unless the test code itself is broken, panics are used
 	// internally.  This deferred func ensures any panics don't escape the
@@ -739,7 +821,7 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 
 	// Create a test generator instance initialized with the genesis block
 	// as the tip.
-	g, err := makeTestGenerator(&chaincfg.RegressionNetParams)
+	g, err := makeTestGenerator(params)
 	if err != nil {
 		return nil, err
 	}
@@ -755,8 +837,8 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 	//
 	// expectTipBlock creates a test instance that expects the provided
 	// block to be the current tip of the block chain.
-	lastAdminKeySets := chaincfg.RegressionNetParams.AdminKeySets
-	lastASPKeys := chaincfg.RegressionNetParams.ASPKeyIdMap
+	lastAdminKeySets := g.params.AdminKeySets
+	lastASPKeys := g.params.ASPKeyIdMap
 	lastTotalSupply := uint64(0)
 	lastThreadTips := make(map[provautil.ThreadID]*wire.OutPoint)
 	rootOut := makeSpendableOut(g.tip, 0, 0)
@@ -1141,15 +1223,581 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 	// ---------------------------------------------------------------------
 
 	// Attempt to progress the chain past b27 with bad coinbase fee blocks.
+	// A coinbase which claims less than the fees of its block is only
+	// invalid when the chain doesn't burn fees.
 	g.setTip("b27")
 	issuedCoinsSpend := makeSpendableOutForTx(spendTx, 1)
-	createSpendTx := createSpendTx(&issuedCoinsSpend, 1) // Fee: 1
-	g.nextBlock("b30", outs[12], additionalTx(createSpendTx), changeCoinbaseValue(0))
-	rejected(blockchain.ErrBadCoinbaseValue)
+	feeSpendTx := createSpendTx(&issuedCoinsSpend, 1) // Fee: 1
+	if !g.params.BurnFees {
+		g.nextBlock("b30", outs[12], additionalTx(feeSpendTx), changeCoinbaseValue(0))
+		rejected(blockchain.ErrBadCoinbaseValue)
+	}
 
 	g.setTip("b27")
 	g.nextBlock("b31", outs[12], changeCoinbaseValue(1))
 	rejected(blockchain.ErrBadCoinbaseValue)
 
+	// ---------------------------------------------------------------------
+	// Monotonic timestamp tests.
+	//
+	// These only apply when the chain requires each block timestamp to be
+	// strictly after the timestamp of its parent.
+	// ---------------------------------------------------------------------
+
+	mainTip := "b27"
+	if g.params.StrictMonotonicTime {
+		// Create blocks with timestamps that are after the median time
+		// of the last several blocks, but not after the parent block.
+		//
+		//   ... -> b27(11)
+		//                 \-> b32()
+		//                 \-> b33()
+		//
+		g.setTip("b27")
+		b27 := g.tip
+		g.nextBlock("b32", nil, changeTimestamp(b27, 0))
+		rejected(blockchain.ErrNonMonotonicTime)
+
+		g.setTip("b27")
+		g.nextBlock("b33", nil, changeTimestamp(b27, -time.Second))
+		rejected(blockchain.ErrNonMonotonicTime)
+
+		// Create a block with a timestamp one second after the parent
+		// block.
+		//
+		//   ... -> b27(11) -> b34(12)
+		//
+		g.setTip("b27")
+		g.nextBlock("b34", outs[12], changeTimestamp(b27, time.Second))
+		accepted()
+		mainTip = "b34"
+	}
+
+	// ---------------------------------------------------------------------
+	// Block signature tests.
+	//
+	// These only apply when blocks must be signed by an active validate
+	// key, since the signature is not checked when the chain accepts
+	// blocks on proof of work alone.
+	// ---------------------------------------------------------------------
+
+	if !g.params.PowOnly {
+		// Create a block correctly signed by a key which is not in the
+		// validate key set.
+		//
+		//   ... -> b34(12)
+		//                 \-> b35()
+		//
+		g.setTip(mainTip)
+		g.sign = signWith(privKey1)
+		g.nextBlock("b35", nil)
+		rejected(blockchain.ErrInvalidValidateKey)
+
+		// Create a block signed by a key which is not in the validate
+		// key set while claiming to be signed by the validate key.
+		//
+		//   ... -> b34(12)
+		//                 \-> b36()
+		//
+		g.setTip(mainTip)
+		g.sign = func(header *wire.BlockHeader) {
+			header.Sign(privKey1)
+			pubKey := validatePrivKey.PubKey().SerializeCompressed()
+			copy(header.ValidatingPubKey[:], pubKey)
+		}
+		g.nextBlock("b36", nil)
+		rejected(blockchain.ErrBadBlockSignature)
+		g.sign = signWith(validatePrivKey)
+	}
+
+	// ---------------------------------------------------------------------
+	// Proof of work tests.
+	//
+	// These apply whether or not blocks must be signed.
+	// ---------------------------------------------------------------------
+
+	// Create a block with a target above the proof of work limit.
+	//
+	//   ... -> b34(12)
+	//                 \-> b37()
+	//
+	g.setTip(mainTip)
+	g.nextBlock("b37", nil, func(b *wire.MsgBlock) {
+		b.Header.Bits = 0x207fffff
+	})
+	rejected(blockchain.ErrUnexpectedDifficulty)
+
+	// Create a block with a hash above its claimed target, which is left
+	// unsolved.
+	//
+	//   ... -> b34(12)
+	//                 \-> b38()
+	//
+	g.setTip(mainTip)
+	g.nextBlock("b38", nil, func(b *wire.MsgBlock) {
+		b.Header.Bits = 0x1d00ffff
+		b.Header.Nonce = 1
+	})
+	rejected(blockchain.ErrHighHash)
+
+	// Create a block which is solved at the expected difficulty.
+	//
+	//   ... -> b34(12) -> b39()
+	//
+	g.setTip(mainTip)
+	g.nextBlock("b39", nil)
+	accepted()
+	mainTip = "b39"
+
+	// ---------------------------------------------------------------------
+	// Timestamp regression tests.
+	//
+	// These only apply when the chain limits how far block timestamps may
+	// go back from the latest timestamp of the last several blocks without
+	// requiring strictly increasing block timestamps, which makes the limit
+	// unreachable.  The limit must be less than the lag of the median time
+	// behind the tip, which is 10 minutes with the blocks generated here.
+	// ---------------------------------------------------------------------
+
+	if g.params.TimeRegressionWindow > 0 && !g.params.StrictMonotonicTime {
+		maxRegression := g.params.MaxTimeRegression
+
+		// Create a block with a timestamp one second further before
+		// the parent block, which has the latest timestamp, than
+		// allowed.
+		//
+		//   ... -> b39()
+		//               \-> b40()
+		//
+		g.setTip("b39")
+		b39 := g.tip
+		g.nextBlock("b40", nil, changeTimestamp(b39,
+			-maxRegression-time.Second))
+		rejected(blockchain.ErrTimestampRegression)
+
+		// Create a block with a timestamp equal to the median time of
+		// the last several blocks, which is also too far before the
+		// latest timestamp, to ensure the median time rule is applied
+		// first.
+		//
+		//   ... -> b39()
+		//               \-> b41()
+		//
+		g.setTip("b39")
+		g.nextBlock("b41", nil, changeTimestamp(b39, -time.Minute*10))
+		rejected(blockchain.ErrTimeTooOld)
+
+		// Create a block with a timestamp exactly as far before the
+		// parent block as allowed.
+		//
+		//   ... -> b39() -> b42()
+		//
+		g.setTip("b39")
+		g.nextBlock("b42", nil, changeTimestamp(b39, -maxRegression))
+		accepted()
+
+		// Create blocks building on the regressed block with timestamps
+		// compared against b39, which is still the latest timestamp of
+		// the last several blocks although it is not the parent block.
+		//
+		//   ... -> b39() -> b42() -> b44()
+		//                         \-> b43()
+		//
+		g.nextBlock("b43", nil, changeTimestamp(b39,
+			-maxRegression-time.Second))
+		rejected(blockchain.ErrTimestampRegression)
+
+		g.setTip("b42")
+		g.nextBlock("b44", nil, changeTimestamp(b39, -maxRegression))
+		accepted()
+		mainTip = "b44"
+	}
+
+	// ---------------------------------------------------------------------
+	// Unknown admin op tests.
+	//
+	// Admin ops with an unknown op type below the reserved threshold are
+	// always invalid.  Admin ops at or above it are reserved for later
+	// soft forks and only accepted, without changing the admin state, when
+	// the chain enables upgradable admin ops.
+	// ---------------------------------------------------------------------
+
+	// Create a block with an admin op whose op type is unknown and below
+	// the reserved threshold.
+	//
+	//   ... -> mainTip
+	//                 \-> b45()
+	//
+	g.setTip(mainTip)
+	unknownOpTx := createAdminTx(&rootThreadOutFork, 0,
+		txscript.AdminOpUpgradableThreshold-1, pubKey1)
+	g.nextBlock("b45", nil, additionalTx(unknownOpTx))
+	rejected(blockchain.ErrInvalidAdminTx)
+
+	// Create a block with an admin op whose op type is reserved for later
+	// soft forks.
+	//
+	//   ... -> mainTip -> b46()
+	//
+	g.setTip(mainTip)
+	upgradableOpTx := createAdminTx(&rootThreadOutFork, 0,
+		txscript.AdminOpUpgradableThreshold, pubKey1)
+	g.nextBlock("b46", nil, additionalTx(upgradableOpTx))
+	if !g.params.UpgradableAdminOps {
+		rejected(blockchain.ErrInvalidAdminOp)
+	} else {
+		assertThreadTip(provautil.RootThread,
+			makeSpendableOutForTx(upgradableOpTx, 0))
+		accepted()
+
+		// Reorganize the block with the reserved admin op away, which
+		// only moves the root thread tip back, and include the admin
+		// op again.
+		//
+		//   ... -> mainTip -> b46()
+		//                 \-> b47() -> b48() -> b49()
+		//
+		g.setTip(mainTip)
+		g.nextBlock("b47", nil)
+		acceptedToSideChainWithExpectedTip("b46")
+
+		g.nextBlock("b48", nil)
+		assertThreadTip(provautil.RootThread, rootThreadOutFork)
+		accepted()
+
+		g.nextBlock("b49", nil, additionalTx(upgradableOpTx))
+		assertThreadTip(provautil.RootThread,
+			makeSpendableOutForTx(upgradableOpTx, 0))
+		accepted()
+		mainTip = "b49"
+	}
+
+	// ---------------------------------------------------------------------
+	// Expiry height tests.
+	//
+	// Transactions with an expiry height can only be included in blocks
+	// below it when the chain enables transaction expiry.  The height is
+	// the height of the block on its own branch, so a transaction valid on
+	// one branch can be expired on another.
+	// ---------------------------------------------------------------------
+
+	// Create a block with a transaction which expires at the height of
+	// the block, which is only rejected when the chain enables
+	// transaction expiry.  Otherwise the transaction doesn't carry the
+	// expiry height at all.
+	//
+	//   ... -> mainTip
+	//                 \-> b50(13)
+	//
+	g.setTip(mainTip)
+	expiry := g.tipHeight + 1
+	g.nextBlock("b50", nil,
+		additionalTx(createExpiringSpendTx(outs[13], expiry, g.params)))
+	if !g.params.TxExpiry {
+		accepted()
+
+		//   ... -> mainTip -> b50(13) -> b55()
+		//
+		g.nextBlock("b55", nil)
+		accepted()
+	} else {
+		rejected(blockchain.ErrTxExpired)
+
+		// Create a block with a transaction which expires at the
+		// height after the block.
+		//
+		//   ... -> mainTip -> b51(13)
+		//
+		g.setTip(mainTip)
+		expiringTx := createExpiringSpendTx(outs[13], expiry+1, g.params)
+		g.nextBlock("b51", nil, additionalTx(expiringTx))
+		accepted()
+
+		// Create a fork which includes the same transaction one block
+		// higher, where it is expired, and then reorganize to the fork
+		// without it.
+		//
+		//   ... -> mainTip -> b51(13)
+		//                 \-> b52() -> b54()
+		//                          \-> b53(13)
+		//
+		g.setTip(mainTip)
+		g.nextBlock("b52", nil)
+		acceptedToSideChainWithExpectedTip("b51")
+
+		g.nextBlock("b53", nil, additionalTx(expiringTx))
+		rejected(blockchain.ErrTxExpired)
+
+		g.setTip("b52")
+		g.nextBlock("b54", nil)
+		accepted()
+
+		// Create a block with a transaction of the expiry version
+		// which never expires.
+		//
+		//   ... -> b52() -> b54() -> b55(13)
+		//
+		g.nextBlock("b55", nil, additionalTx(createExpiringSpendTx(
+			outs[13], wire.NoExpiryValue, g.params)))
+		accepted()
+	}
+
+	// ---------------------------------------------------------------------
+	// Coinbase fee tests.
+	//
+	// The coinbase must claim exactly the fees of its block, or, when the
+	// chain burns fees, no more than them with the remainder burned.
+	// ---------------------------------------------------------------------
+
+	// Create a block whose coinbase claims more than the fees of the block.
+	//
+	//   ... -> b55()
+	//               \-> b56()
+	//
+	g.nextBlock("b56", nil, additionalTx(feeSpendTx), changeCoinbaseValue(2))
+	rejected(blockchain.ErrBadCoinbaseValue)
+
+	// Create a block whose coinbase claims exactly the fees of the block.
+	//
+	//   ... -> b55() -> b57()
+	//
+	g.setTip("b55")
+	g.nextBlock("b57", nil, additionalTx(feeSpendTx), changeCoinbaseValue(1))
+	accepted()
+
+	// Create a block whose coinbase claims part of the fees of the block and
+	// burns the rest.
+	//
+	//   ... -> b57() -> b58()
+	//
+	if g.params.BurnFees {
+		burnSpend := makeSpendableOutForTx(feeSpendTx, 0)
+		g.nextBlock("b58", nil, additionalTx(createSpendTx(&burnSpend, 2)),
+			changeCoinbaseValue(1))
+		accepted()
+	}
+
+	// ---------------------------------------------------------------------
+	// Non-canonical serialization tests.
+	//
+	// Blocks must be serialized canonically, which means every variable
+	// length integer is encoded in the fewest possible bytes and there is
+	// no data after the block.
+	// ---------------------------------------------------------------------
+
+	// nonCanonical creates a block on top of the passed tip and appends a
+	// test instance for its serialization with the single byte variable
+	// length integer at the passed offset re-encoded after the passed
+	// discriminant, or, for a negative offset, with a trailing byte.  The
+	// serialization is expected to first differ from the canonical one at
+	// the offset in the named field.
+	nonCanonical := func(blockName, tipName string, offset int, field string, discriminant byte) {
+		g.setTip(tipName)
+		block := g.nextBlock(blockName, nil)
+		var buf bytes.Buffer
+		if err := block.Serialize(&buf); err != nil {
+			panic(fmt.Sprintf("unable to serialize block %q: %v",
+				blockName, err))
+		}
+		canonical := buf.Bytes()
+
+		var raw []byte
+		if offset < 0 {
+			offset = len(canonical)
+			raw = append(raw, canonical...)
+			raw = append(raw, 0x00)
+		} else {
+			width := map[byte]int{0xfd: 2, 0xfe: 4, 0xff: 8}[discriminant]
+			raw = append(raw, canonical[:offset]...)
+			raw = append(raw, discriminant, canonical[offset])
+			raw = append(raw, make([]byte, width-1)...)
+			raw = append(raw, canonical[offset+1:]...)
+		}
+		tests = append(tests, []TestInstance{RejectedNonCanonicalBlock{
+			Name:     blockName,
+			RawBlock: raw,
+			Height:   g.blockHeights[blockName],
+			Offset:   offset,
+			Field:    field,
+		}})
+	}
+	canonicalTip := g.tipName
+
+	// Create a block whose transaction count is encoded in three bytes.
+	//
+	//   ... -> b57()
+	//               \-> b59()
+	//
+	txCountOffset := wire.MaxBlockHeaderPayload
+	nonCanonical("b59", canonicalTip, txCountOffset, "transaction count",
+		0xfd)
+
+	// Create a block whose coinbase signature script length is encoded in
+	// five bytes.  The length follows the transaction count, the version
+	// and input count of the coinbase and the previous outpoint of its
+	// input.
+	//
+	//   ... -> b57()
+	//               \-> b60()
+	//
+	sigScriptLenOffset := txCountOffset + 1 + 4 + 1 + chainhash.HashSize + 4
+	nonCanonical("b60", canonicalTip, sigScriptLenOffset,
+		"transaction 0 input 0 signature script length", 0xfe)
+
+	// Create a block followed by a trailing byte.
+	//
+	//   ... -> b57()
+	//               \-> b61()
+	//
+	nonCanonical("b61", canonicalTip, -1, "trailing data", 0)
+
+	// ---------------------------------------------------------------------
+	// Transaction count tests.
+	//
+	// A block may contain at most the maximum number of transactions of
+	// the network, including the coinbase.  These blocks are only generated
+	// for networks with a limit low enough to keep them small.
+	// ---------------------------------------------------------------------
+
+	maxTxs := g.params.MaxBlockTransactions
+	if maxTxs <= maxTestBlockTransactions {
+		// Create a block with one transaction more than the maximum.
+		//
+		//   ... -> b57()
+		//               \-> b62(14)
+		//
+		g.setTip(canonicalTip)
+		g.nextBlock("b62", nil, chainedSpendTxs(outs[14], maxTxs))
+		rejected(blockchain.ErrTooManyTransactions)
+
+		// Create a block with exactly the maximum number of
+		// transactions.
+		//
+		//   ... -> b57() -> b63(14)
+		//
+		g.setTip(canonicalTip)
+		g.nextBlock("b63", nil, chainedSpendTxs(outs[14], maxTxs-1))
+		accepted()
+	}
+
+	// ---------------------------------------------------------------------
+	// KeyID reuse tests.
+	//
+	// A keyID which has been revoked can never be provisioned to another
+	// ASP key.  Networks which allow reprovisioning keyIDs accept
+	// provisioning it to the key it was bound to again.
+	// ---------------------------------------------------------------------
+
+	// Try to provision keyID 4, which was revoked in b20, to another key.
+	//
+	//   ... -> keyIDTip
+	//                  \-> b64()
+	//
+	keyIDTip := canonicalTip
+	if maxTxs <= maxTestBlockTransactions {
+		keyIDTip = "b63"
+	}
+	g.setTip(keyIDTip)
+	provThreadOut = makeSpendableOutForTx(aspKeyIdTx, 0)
+	reuseTx := createASPAdminTx(&provThreadOut, []AspOp{
+		{txscript.AdminOpASPKeyAdd, pubKey1, btcec.KeyID(4)},
+	})
+	g.nextBlock("b64", nil, additionalTx(reuseTx))
+	rejected(blockchain.ErrKeyIDReuse)
+
+	// Provision keyID 4 to the key it was bound to again.
+	//
+	//   ... -> keyIDTip -> b65()
+	//
+	g.setTip(keyIDTip)
+	reprovisionTx := createASPAdminTx(&provThreadOut, []AspOp{
+		{txscript.AdminOpASPKeyAdd, pubKey2, btcec.KeyID(4)},
+	})
+	g.nextBlock("b65", nil, additionalTx(reprovisionTx))
+	if !g.params.ReprovisionKeyIDs {
+		rejected(blockchain.ErrInvalidAdminOp)
+	} else {
+		assertASPKey(pubKey2, btcec.KeyID(4))
+		accepted()
+
+		// Reorganize the reprovisioning away, after which keyID 4 is
+		// revoked again and still can't be provisioned to another key,
+		// and then reprovision it on the new chain.
+		//
+		//   ... -> keyIDTip -> b65()
+		//                  \-> b66() -> b67() -> b69()
+		//                                    \-> b68()
+		//
+		g.setTip(keyIDTip)
+		g.nextBlock("b66", nil)
+		acceptedToSideChainWithExpectedTip("b65")
+
+		g.nextBlock("b67", nil)
+		assertNotASPKey(pubKey2, btcec.KeyID(4))
+		accepted()
+
+		g.nextBlock("b68", nil, additionalTx(reuseTx))
+		rejected(blockchain.ErrKeyIDReuse)
+
+		g.setTip("b67")
+		g.nextBlock("b69", nil, additionalTx(reprovisionTx))
+		assertASPKey(pubKey2, btcec.KeyID(4))
+		accepted()
+
+		// Revoke keyID 4 a second time, after which it still can't be
+		// provisioned to another key.
+		//
+		//   ... -> b69() -> b70() -> b71()
+		//
+		provThreadOut = makeSpendableOutForTx(reprovisionTx, 0)
+		revokeAgainTx := createASPAdminTx(&provThreadOut, []AspOp{
+			{txscript.AdminOpASPKeyRevoke, pubKey2, btcec.KeyID(4)},
+		})
+		g.nextBlock("b70", nil, additionalTx(revokeAgainTx))
+		assertNotASPKey(pubKey2, btcec.KeyID(4))
+		accepted()
+
+		provThreadOut = makeSpendableOutForTx(revokeAgainTx, 0)
+		g.nextBlock("b71", nil, additionalTx(createASPAdminTx(
+			&provThreadOut, []AspOp{
+				{txscript.AdminOpASPKeyAdd, pubKey1, btcec.KeyID(4)},
+			})))
+		rejected(blockchain.ErrKeyIDReuse)
+	}
+
+	// ---------------------------------------------------------------------
+	// Transaction fee tests.
+	// ---------------------------------------------------------------------
+
+	// Create a block with transactions which pay different fees alongside
+	// one which pays none and an admin transaction, with a coinbase which
+	// claims the fees.
+	//
+	//   ... -> feeTip -> b72(15)
+	//
+	feeTip := keyIDTip
+	if g.params.ReprovisionKeyIDs {
+		feeTip = "b70"
+	}
+	rootThreadTip := rootThreadOutFork
+	if g.params.UpgradableAdminOps {
+		rootThreadTip = makeSpendableOutForTx(upgradableOpTx, 0)
+	}
+	g.setTip(feeTip)
+	coinsToSpend = makeSpendableOutForTx(reSpendTx, 0)
+	feeSpendTx1 := createSpendTx(&coinsToSpend, 2)
+	coinsToSpend = makeSpendableOutForTx(feeSpendTx1, 0)
+	feeSpendTx2 := createSpendTx(&coinsToSpend, 5)
+	feeAdminTx := createAdminTx(&rootThreadTip, 0,
+		txscript.AdminOpProvisionKeyAdd, pubKey3)
+	g.nextBlock("b72", outs[15], additionalTx(feeSpendTx1),
+		additionalTx(feeAdminTx), additionalTx(feeSpendTx2),
+		changeCoinbaseValue(7))
+	assertThreadTip(provautil.RootThread,
+		makeSpendableOutForTx(feeAdminTx, 0))
+	assertAdminKeys(btcec.ProvisionKeySet,
+		[]btcec.PublicKey{*pubKey1, *pubKey2, *pubKey3})
+	accepted()
+
 	return tests, nil
 }
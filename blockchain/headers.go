@@ -0,0 +1,230 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/wire"
+)
+
+// ProcessBlockHeader validates the passed block header ahead of its block, so a
+// block whose header is invalid is never downloaded.  The header must pass the
+// context free checks along with those which depend on its position within the
+// block chain, which cover the height, timestamp, difficulty and checkpoint
+// rules, and it must be signed by a key of the validate key set as of the
+// latest main chain block it descends from.  Valid headers are recorded in the
+// block index as headers-only until their block is processed with
+// ProcessBlock, which upgrades the entry.
+//
+// The parent of the header must be a known block or a header which was
+// processed before, otherwise the header is rejected with ErrMissingParent
+// rather than held as an orphan.  Headers which are already known are accepted
+// without being checked again.
+//
+// The flags modify the behavior of this function as follows:
+//  - BFFastAdd: The validate key which signed the header is not checked
+//    against the validate key set.
+//  - BFDryRun: The header is checked, but not recorded.
+//
+// The flags are also passed to checkBlockHeaderSanity, checkHeaderCheckpoint
+// and checkBlockHeaderContext.  See their documentation for how the flags
+// modify their behavior.
+//
+// A RuleError is returned when the header violates a consensus rule.  Other
+// errors are returned as described by ProcessBlock.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ProcessBlockHeader(header *wire.BlockHeader, flags BehaviorFlags) error {
+	// Headers are refused like blocks when the chain is read-only since
+	// their blocks could never be processed.
+	if b.readOnly {
+		return DatabaseError{
+			Err: database.Error{
+				ErrorCode:   database.ErrDbReadOnly,
+				Description: "block chain is read-only",
+			},
+		}
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	err := b.processBlockHeader(header, flags)
+	if err != nil {
+		err = wrapNonRuleError(err)
+		if _, ok := err.(RuleError); ok {
+			return b.countRuleError(err)
+		}
+	}
+	return err
+}
+
+// processBlockHeader performs the work of ProcessBlockHeader.  See its
+// documentation for details.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) processBlockHeader(header *wire.BlockHeader, flags BehaviorFlags) error {
+	fastAdd := flags&BFFastAdd == BFFastAdd
+	dryRun := flags&BFDryRun == BFDryRun
+
+	hash := header.BlockHash()
+	log.Tracef("Processing block header %v", hash)
+
+	// Headers which are known either as headers-only or along with their
+	// block are accepted right away.
+	if _, ok := b.headerNodes[hash]; ok {
+		return nil
+	}
+	exists, err := b.blockExists(&hash)
+	if err != nil || exists {
+		return err
+	}
+
+	err = checkBlockHeaderSanity(header, b.chainParams.PowLimit,
+		b.timeSource, flags)
+	if err != nil {
+		return err
+	}
+	if err := b.checkHeaderCheckpoint(header, flags); err != nil {
+		return err
+	}
+
+	prevNode, err := b.headerParentNode(&header.PrevBlock)
+	if err != nil {
+		return err
+	}
+	if prevNode == nil {
+		str := fmt.Sprintf("block header %v extends unknown block %v",
+			hash, header.PrevBlock)
+		return ruleError(ErrMissingParent, str)
+	}
+	err = b.checkBlockHeaderContext(header, prevNode, flags)
+	if err != nil {
+		return err
+	}
+	if !b.chainParams.PowOnly && !fastAdd {
+		if err := b.checkHeaderValidateKey(header, prevNode); err != nil {
+			return err
+		}
+	}
+	if dryRun {
+		return nil
+	}
+
+	node := newBlockNode(header, &hash)
+	node.parent = prevNode
+	node.workSum.Add(prevNode.workSum, node.workSum)
+	b.indexLock.Lock()
+	b.headerNodes[hash] = node
+	b.indexLock.Unlock()
+
+	log.Debugf("Accepted block header %v at height %d", hash,
+		header.Height)
+	return nil
+}
+
+// headerParentNode returns the node of the block with the passed hash, which is
+// either a headers-only entry of the block index or the node of a known block,
+// which is loaded into the memory block index when needed.  It returns nil when
+// the block is not known.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) headerParentNode(hash *chainhash.Hash) (*blockNode, error) {
+	if node, ok := b.headerNodes[*hash]; ok {
+		return node, nil
+	}
+	exists, err := b.blockExists(hash)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return b.indexNode(hash)
+}
+
+// checkHeaderValidateKey ensures the passed header, which extends the passed
+// node, is signed by a key of the validate key set as of the latest main chain
+// block the node descends from.  The admin transactions of the blocks which are
+// only known by their headers, or which are on a side chain, are not applied
+// yet, so a header signed by a key which is added by one of them is rejected
+// until its block is processed.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) checkHeaderValidateKey(header *wire.BlockHeader, prevNode *blockNode) error {
+	// Find the latest main chain block the node descends from.  Side chain
+	// nodes which were loaded from the database are flagged as main chain
+	// nodes, so the database is consulted.
+	node := prevNode
+	err := b.db.View(func(dbTx database.Tx) error {
+		for node != b.bestNode {
+			_, headerOnly := b.headerNodes[*node.hash]
+			if !headerOnly && dbMainChainHasBlock(dbTx, node.hash) {
+				return nil
+			}
+			if node.parent == nil {
+				str := fmt.Sprintf("block header %v does not "+
+					"descend from the main chain", node.hash)
+				return assertError(str)
+			}
+			node = node.parent
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	keySets := b.adminKeySets
+	if node != b.bestNode {
+		state, err := b.adminStateAtHeight(node.height)
+		if err != nil {
+			return err
+		}
+		keySets = state.KeySets
+	}
+
+	validateKeySet := keySets[btcec.ValidateKeySet]
+	pubKey, err := btcec.ParsePubKey(header.ValidatingPubKey[:],
+		btcec.S256())
+	if err != nil {
+		return ruleErrorWrap(ErrInvalidValidateKey, "unable to parse "+
+			"block validating public key", err)
+	}
+	if len(validateKeySet) > 0 && validateKeySet.Pos(pubKey) == -1 {
+		str := fmt.Sprintf("block header %v is signed by validate key "+
+			"%x which is not in the validate key set as of height %d",
+			header.BlockHash(), pubKey.SerializeCompressed(),
+			node.height)
+		return ruleError(ErrInvalidValidateKey, str)
+	}
+	return nil
+}
+
+// removeHeaderNode removes the headers-only entry of the block with the passed
+// hash from the block index, if there is one.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) removeHeaderNode(hash *chainhash.Hash) {
+	if _, ok := b.headerNodes[*hash]; !ok {
+		return
+	}
+	b.indexLock.Lock()
+	delete(b.headerNodes, *hash)
+	b.indexLock.Unlock()
+}
+
+// HeaderOnly returns whether the block with the passed hash is only known by
+// its header, which was processed with ProcessBlockHeader, while the block
+// itself was not processed yet.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) HeaderOnly(hash *chainhash.Hash) bool {
+	b.indexLock.RLock()
+	_, ok := b.headerNodes[*hash]
+	b.indexLock.RUnlock()
+	return ok
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+)
+
+// TestProcessBlockHeader ensures a chain of headers processed ahead of their
+// blocks is recorded as headers-only, that the blocks processed afterwards
+// upgrade those entries and become the main chain, and that headers with a bad
+// height, an unknown validate key or an unknown parent are rejected.
+func TestProcessBlockHeader(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("processblockheader", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Create a chain of blocks and process their headers.
+	const numBlocks = 5
+	blocks := make([]*provautil.Block, 0, numBlocks)
+	prev := params.GenesisBlock
+	for i := 0; i < numBlocks; i++ {
+		block, err := multiChainBlock(&params, prev)
+		if err != nil {
+			t.Fatalf("Unable to create block: %v", err)
+		}
+		blocks = append(blocks, block)
+		prev = block.MsgBlock()
+	}
+	for i, block := range blocks {
+		header := &block.MsgBlock().Header
+		if err := chain.ProcessBlockHeader(header, blockchain.BFNone); err != nil {
+			t.Fatalf("ProcessBlockHeader #%d: %v", i, err)
+		}
+		// Processing a known header again is not an error.
+		if err := chain.ProcessBlockHeader(header, blockchain.BFNone); err != nil {
+			t.Fatalf("ProcessBlockHeader #%d again: %v", i, err)
+		}
+		if !chain.HeaderOnly(block.Hash()) {
+			t.Fatalf("HeaderOnly #%d: got false, want true", i)
+		}
+		fetched, err := chain.FetchHeader(block.Hash())
+		if err != nil {
+			t.Fatalf("FetchHeader #%d: %v", i, err)
+		}
+		if fetched.BlockHash() != *block.Hash() {
+			t.Fatalf("FetchHeader #%d: got header %v, want %v", i,
+				fetched.BlockHash(), block.Hash())
+		}
+	}
+	if best := chain.BestSnapshot(); best.Height != 0 {
+		t.Fatalf("Best height after processing headers: got %d, "+
+			"want 0", best.Height)
+	}
+
+	// Create a header with a height which doesn't follow its parent.
+	badHeightMsg := *blocks[1].MsgBlock()
+	badHeightMsg.Header.Height++
+	if err := badHeightMsg.Header.Sign(multiChainValidateKey); err != nil {
+		t.Fatalf("Unable to sign block: %v", err)
+	}
+	solveBlock(&badHeightMsg.Header)
+	err = chain.ProcessBlockHeader(&badHeightMsg.Header, blockchain.BFNone)
+	if !blockchain.IsErrorCode(err, blockchain.ErrBadHeight) {
+		t.Fatalf("ProcessBlockHeader with a bad height: got error %v, "+
+			"want ErrBadHeight", err)
+	}
+
+	// Create a header signed by a key which is not a validate key.
+	unknownKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("Unable to create key: %v", err)
+	}
+	unknownKeyMsg := *blocks[1].MsgBlock()
+	if err := unknownKeyMsg.Header.Sign(unknownKey); err != nil {
+		t.Fatalf("Unable to sign block: %v", err)
+	}
+	solveBlock(&unknownKeyMsg.Header)
+	err = chain.ProcessBlockHeader(&unknownKeyMsg.Header, blockchain.BFNone)
+	if !blockchain.IsErrorCode(err, blockchain.ErrInvalidValidateKey) {
+		t.Fatalf("ProcessBlockHeader with an unknown validate key: got "+
+			"error %v, want ErrInvalidValidateKey", err)
+	}
+
+	// Create a header which extends a block that is not known.
+	orphan, err := multiChainBlock(&params, &unknownKeyMsg)
+	if err != nil {
+		t.Fatalf("Unable to create block: %v", err)
+	}
+	err = chain.ProcessBlockHeader(&orphan.MsgBlock().Header,
+		blockchain.BFNone)
+	if !blockchain.IsErrorCode(err, blockchain.ErrMissingParent) {
+		t.Fatalf("ProcessBlockHeader with an unknown parent: got error "+
+			"%v, want ErrMissingParent", err)
+	}
+	if chain.HeaderOnly(orphan.Hash()) {
+		t.Fatal("HeaderOnly of a rejected header: got true, want false")
+	}
+
+	// Process the blocks, which upgrade the headers-only entries and
+	// become the main chain.
+	for i, block := range blocks {
+		isMainChain, isOrphan, err := chain.ProcessBlock(block,
+			blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock #%d: %v", i, err)
+		}
+		if !isMainChain || isOrphan {
+			t.Fatalf("ProcessBlock #%d: got main chain %v, orphan %v, "+
+				"want main chain true, orphan false", i,
+				isMainChain, isOrphan)
+		}
+		if chain.HeaderOnly(block.Hash()) {
+			t.Fatalf("HeaderOnly #%d after ProcessBlock: got true, "+
+				"want false", i)
+		}
+	}
+	best := chain.BestSnapshot()
+	if *best.Hash != *blocks[numBlocks-1].Hash() {
+		t.Fatalf("Best block: got %v, want %v", best.Hash,
+			blocks[numBlocks-1].Hash())
+	}
+
+	// Headers of blocks which are already known are accepted.
+	err = chain.ProcessBlockHeader(&blocks[0].MsgBlock().Header,
+		blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("ProcessBlockHeader of a known block: %v", err)
+	}
+	if chain.HeaderOnly(blocks[0].Hash()) {
+		t.Fatal("HeaderOnly of a known block: got true, want false")
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	_ "github.com/bitgo/prova/database/ffldb"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// testIndexDB creates a database for the network of the passed chain
+// parameters in a new temporary directory with the passed name prefix.  It
+// also returns a teardown function the caller should invoke when done testing
+// which closes the database and removes the directory.
+func testIndexDB(tb testing.TB, name string, params *chaincfg.Params) (database.DB, func()) {
+	tmpDir, err := ioutil.TempDir("", name)
+	if err != nil {
+		tb.Fatalf("unable to create temp dir: %v", err)
+	}
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		params.Net)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		tb.Fatalf("unable to create db: %v", err)
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(tmpDir)
+	}
+	return db, teardown
+}
+
+// newTestIndexChain returns a chain instance for the passed chain parameters
+// which is backed by the passed database along with an index manager which
+// manages the passed indexes.  The chain has no index manager, and nil is
+// returned for it, when no indexes are passed.
+func newTestIndexChain(tb testing.TB, db database.DB, params *chaincfg.Params, indexes ...Indexer) (*blockchain.BlockChain, *Manager) {
+	config := blockchain.Config{
+		DB:          db,
+		ChainParams: params,
+		TimeSource:  blockchain.NewMedianTime(),
+	}
+	var manager *Manager
+	if len(indexes) > 0 {
+		manager = NewManager(db, indexes)
+		config.IndexManager = manager
+	}
+	chain, err := blockchain.New(&config)
+	if err != nil {
+		tb.Fatalf("unable to create chain: %v", err)
+	}
+	return chain, manager
+}
+
+// testPayAddr returns an address which is unique to the passed height and tag.
+func testPayAddr(params *chaincfg.Params, height uint32, tag string) (provautil.Address, error) {
+	pkHash := chainhash.HashB([]byte(fmt.Sprintf("%s-%d", tag, height)))[:20]
+	return provautil.NewAddressProva(pkHash, []btcec.KeyID{1, 2}, params)
+}
+
+// testBlock returns a signed and solved block which extends the passed block
+// with a coinbase that pays to the address returned by testPayAddr for the
+// passed tag, so competing blocks at the same height are distinct, followed by
+// the passed transactions.
+func testBlock(params *chaincfg.Params, prev *wire.MsgBlock, tag string, txns ...*wire.MsgTx) (*provautil.Block, error) {
+	height := prev.Header.Height + 1
+	coinbaseScript, err := txscript.NewScriptBuilder().
+		AddData([]byte("/prova/")).Script()
+	if err != nil {
+		return nil, err
+	}
+	payAddr, err := testPayAddr(params, height, tag)
+	if err != nil {
+		return nil, err
+	}
+	pkScript, err := txscript.PayToAddrScript(payAddr)
+	if err != nil {
+		return nil, err
+	}
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		Sequence:        wire.MaxTxInSequenceNum,
+		SignatureScript: coinbaseScript,
+	})
+	coinbase.AddTxOut(&wire.TxOut{
+		Value:    blockchain.CalcBlockSubsidy(height, params),
+		PkScript: pkScript,
+	})
+
+	txns = append([]*wire.MsgTx{coinbase}, txns...)
+	utilTxns := make([]*provautil.Tx, 0, len(txns))
+	for _, tx := range txns {
+		utilTxns = append(utilTxns, provautil.NewTx(tx))
+	}
+	merkles := blockchain.BuildMerkleTreeStore(utilTxns)
+	block := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:    1,
+			PrevBlock:  prev.BlockHash(),
+			MerkleRoot: *merkles[len(merkles)-1],
+			Bits:       params.PowLimitBits,
+			Timestamp:  prev.Header.Timestamp.Add(2 * params.TargetTimePerBlock),
+			Height:     height,
+		},
+		Transactions: txns,
+	}
+	block.Header.Size = uint32(block.SerializeSize())
+
+	// Sign the block with one of the regression test network validate
+	// keys and solve it.
+	keyBytes, _ := hex.DecodeString("4015289a228658047520f0d0abe7ad49abc" +
+		"77f6be0be63b36b94b83c2d1fd977")
+	validateKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
+	if err := block.Header.Sign(validateKey); err != nil {
+		return nil, err
+	}
+	target := blockchain.CompactToBig(params.PowLimitBits)
+	for nonce := uint64(1); ; nonce++ {
+		block.Header.Nonce = nonce
+		hash := block.Header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			break
+		}
+	}
+	return provautil.NewBlock(block), nil
+}
+
+// waitForSync waits until all of the indexes of the passed manager are synced.
+func waitForSync(t *testing.T, manager *Manager) {
+	deadline := time.Now().Add(time.Second * 10)
+	for _, indexer := range manager.enabledIndexes {
+		for !manager.IsSynced(indexer) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for the %s to sync",
+					indexer.Name())
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+}
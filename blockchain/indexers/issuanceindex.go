@@ -0,0 +1,368 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// issuanceIndexName is the human-readable name for the index.
+	issuanceIndexName = "issuance index"
+
+	// issuanceKeySize is the size of the keys of the issuance index.
+	issuanceKeySize = 4 + 4 + 1 + 4
+
+	// issuanceValueSize is the size of the values of the issuance index.
+	issuanceValueSize = chainhash.HashSize + chainhash.HashSize + 4 + 8 +
+		btcec.PubKeyBytesLenCompressed
+)
+
+var (
+	// issuanceIndexKey is the key of the issuance index and the db bucket
+	// used to house it.
+	issuanceIndexKey = []byte("issuanceidx")
+)
+
+// -----------------------------------------------------------------------------
+// The issuance index consists of an entry for every output created by an
+// issuance and for every input consumed by a destruction in the main chain.
+// Both are transactions of the issue thread.  The keys are ordered by height,
+// so the entries of a range of blocks are adjacent, and within a block by the
+// position of the transaction and then of the output or input.
+//
+// The serialized format for keys is:
+//
+//   <block height><tx index><kind><position>
+//
+//   Field           Type              Size
+//   block height    uint32            4 bytes (big endian)
+//   tx index        uint32            4 bytes (big endian)
+//   kind            byte              1 byte (0 issuance, 1 destruction)
+//   position        uint32            4 bytes (big endian)
+//   -----
+//   Total: 13 bytes
+//
+// The serialized format for values is:
+//
+//   <tx hash><outpoint hash><outpoint index><amount><issuing key>
+//
+//   Field           Type              Size
+//   tx hash         chainhash.Hash    32 bytes
+//   outpoint hash   chainhash.Hash    32 bytes
+//   outpoint index  uint32            4 bytes
+//   amount          int64             8 bytes
+//   issuing key     compressed pubkey 33 bytes
+//   -----
+//   Total: 109 bytes
+//
+// The outpoint is the output created by an issuance, or the output spent by
+// the input consumed by a destruction.
+// -----------------------------------------------------------------------------
+
+// IssuanceEntry describes an output created by an issuance or an input
+// consumed by a destruction in the main chain.
+type IssuanceEntry struct {
+	// Height is the height of the block of the transaction.
+	Height uint32
+
+	// TxHash is the hash of the issuance or destruction transaction.
+	TxHash chainhash.Hash
+
+	// IsDestruction is set for the inputs consumed by destructions.
+	IsDestruction bool
+
+	// OutPoint identifies the output which was issued or destroyed.  Its
+	// hash is the hash of the transaction for issuances.
+	OutPoint wire.OutPoint
+
+	// Amount is the number of atoms issued or destroyed.
+	Amount int64
+
+	// IssuingKey is the first of the ISSUE keys which signed the issue
+	// thread input of the transaction.  ISSUE keys are admin keys which,
+	// unlike ASP keys, have no key ID, so the key is identified by itself.
+	IssuingKey *btcec.PublicKey
+}
+
+// issuanceIndexEntryKey returns the key of the entry at the passed position of
+// the passed kind of the passed transaction of the block at the passed height.
+func issuanceIndexEntryKey(height, txIdx uint32, isDestruction bool, position uint32) []byte {
+	key := make([]byte, issuanceKeySize)
+	binary.BigEndian.PutUint32(key[0:4], height)
+	binary.BigEndian.PutUint32(key[4:8], txIdx)
+	if isDestruction {
+		key[8] = 1
+	}
+	binary.BigEndian.PutUint32(key[9:13], position)
+	return key
+}
+
+// serializeIssuanceIndexEntry returns the value of the passed entry.
+func serializeIssuanceIndexEntry(entry *IssuanceEntry) []byte {
+	serialized := make([]byte, issuanceValueSize)
+	offset := copy(serialized, entry.TxHash[:])
+	offset += copy(serialized[offset:], entry.OutPoint.Hash[:])
+	byteOrder.PutUint32(serialized[offset:], entry.OutPoint.Index)
+	offset += 4
+	byteOrder.PutUint64(serialized[offset:], uint64(entry.Amount))
+	offset += 8
+	copy(serialized[offset:], entry.IssuingKey.SerializeCompressed())
+	return serialized
+}
+
+// deserializeIssuanceIndexEntry decodes the entry of the passed key and value.
+func deserializeIssuanceIndexEntry(key, serialized []byte) (*IssuanceEntry, error) {
+	if len(key) != issuanceKeySize {
+		return nil, errDeserialize("unexpected issuance index key size")
+	}
+	if len(serialized) != issuanceValueSize {
+		return nil, errDeserialize("unexpected issuance index entry size")
+	}
+
+	entry := &IssuanceEntry{
+		Height:        binary.BigEndian.Uint32(key[0:4]),
+		IsDestruction: key[8] == 1,
+	}
+	offset := copy(entry.TxHash[:], serialized)
+	offset += copy(entry.OutPoint.Hash[:], serialized[offset:])
+	entry.OutPoint.Index = byteOrder.Uint32(serialized[offset:])
+	offset += 4
+	entry.Amount = int64(byteOrder.Uint64(serialized[offset:]))
+	offset += 8
+	issuingKey, err := btcec.ParsePubKey(serialized[offset:], btcec.S256())
+	if err != nil {
+		return nil, errDeserialize(fmt.Sprintf("invalid issuing key: %v",
+			err))
+	}
+	entry.IssuingKey = issuingKey
+	return entry, nil
+}
+
+// issuingKey returns the first key which signed the passed issue thread input.
+// The signature script of admin thread inputs consists of pairs of a public
+// key and a signature.
+func issuingKey(txIn *wire.TxIn) (*btcec.PublicKey, error) {
+	pushes, err := txscript.PushedData(txIn.SignatureScript)
+	if err != nil {
+		return nil, err
+	}
+	if len(pushes) == 0 {
+		return nil, fmt.Errorf("issue thread input spending %v is not "+
+			"signed", txIn.PreviousOutPoint)
+	}
+	return btcec.ParsePubKey(pushes[0], btcec.S256())
+}
+
+// IssuanceIndex implements an index of the outputs created by issuances and
+// the inputs consumed by destructions in the main chain along with the ISSUE
+// key which authorized them.
+type IssuanceIndex struct {
+	db database.DB
+}
+
+// Ensure the IssuanceIndex type implements the Indexer interface.
+var _ Indexer = (*IssuanceIndex)(nil)
+
+// Ensure the IssuanceIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*IssuanceIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to index the amounts destroyed.
+//
+// This implements the NeedsInputser interface.
+func (idx *IssuanceIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *IssuanceIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *IssuanceIndex) Key() []byte {
+	return issuanceIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *IssuanceIndex) Name() string {
+	return issuanceIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the issuance
+// index.
+//
+// This is part of the Indexer interface.
+func (idx *IssuanceIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(issuanceIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer adds an entry for each output
+// created by the issuances and each input consumed by the destructions in the
+// passed block.
+//
+// This is part of the Indexer interface.
+func (idx *IssuanceIndex) ConnectBlock(dbTx database.Tx, block *provautil.Block, view *blockchain.UtxoViewpoint) error {
+	bucket := dbTx.Metadata().Bucket(issuanceIndexKey)
+	height := uint32(block.Height())
+
+	// The coinbase can't be an admin transaction.
+	for txIdx, tx := range block.Transactions()[1:] {
+		threadInt, _ := txscript.GetAdminDetails(tx)
+		if threadInt < 0 ||
+			provautil.ThreadID(threadInt) != provautil.IssueThread {
+
+			continue
+		}
+		msgTx := tx.MsgTx()
+		key, err := issuingKey(msgTx.TxIn[0])
+		if err != nil {
+			return AssertError(fmt.Sprintf("issue transaction %v "+
+				"has no issuing key: %v", tx.Hash(), err))
+		}
+
+		// Transactions spending more than the issue thread tip are
+		// destructions, which consume their other inputs, while
+		// issuances create all of their outputs after the thread output.
+		var entries []*IssuanceEntry
+		isDestruction := len(msgTx.TxIn) > 1
+		if isDestruction {
+			for _, txIn := range msgTx.TxIn[1:] {
+				origin := txIn.PreviousOutPoint
+				utxo := view.LookupEntry(&origin.Hash)
+				if utxo == nil {
+					return AssertError(fmt.Sprintf("destroyed "+
+						"output %v is missing from the view",
+						origin))
+				}
+				entries = append(entries, &IssuanceEntry{
+					OutPoint: origin,
+					Amount:   utxo.AmountByIndex(origin.Index),
+				})
+			}
+		} else {
+			for i, txOut := range msgTx.TxOut[1:] {
+				entries = append(entries, &IssuanceEntry{
+					OutPoint: *wire.NewOutPoint(tx.Hash(),
+						uint32(i+1)),
+					Amount: txOut.Value,
+				})
+			}
+		}
+
+		// The position of the entries is the index of the output or
+		// input.
+		for i, entry := range entries {
+			entry.TxHash = *tx.Hash()
+			entry.IssuingKey = key
+			err := bucket.Put(issuanceIndexEntryKey(height,
+				uint32(txIdx+1), isDestruction, uint32(i+1)),
+				serializeIssuanceIndexEntry(entry))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes all of the entries of
+// the passed block.
+//
+// This is part of the Indexer interface.
+func (idx *IssuanceIndex) DisconnectBlock(dbTx database.Tx, block *provautil.Block, view *blockchain.UtxoViewpoint) error {
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], uint32(block.Height()))
+
+	// Collect the keys before removing them so the bucket is not modified
+	// while the cursor iterates it.
+	bucket := dbTx.Metadata().Bucket(issuanceIndexKey)
+	var keys [][]byte
+	cursor := bucket.Cursor()
+	for ok := cursor.Seek(prefix[:]); ok; ok = cursor.Next() {
+		if !bytes.HasPrefix(cursor.Key(), prefix[:]) {
+			break
+		}
+		keys = append(keys, append([]byte(nil), cursor.Key()...))
+	}
+	for _, key := range keys {
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchIssuanceEntries returns the entries of the blocks from the passed start
+// height to the passed end height, inclusive, in the order of the blocks and
+// of the transactions, outputs and inputs within them.
+//
+// This function is safe for concurrent access.
+func (idx *IssuanceIndex) FetchIssuanceEntries(startHeight, endHeight uint32) ([]*IssuanceEntry, error) {
+	var entries []*IssuanceEntry
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var start [4]byte
+		binary.BigEndian.PutUint32(start[:], startHeight)
+		cursor := dbTx.Metadata().Bucket(issuanceIndexKey).Cursor()
+		for ok := cursor.Seek(start[:]); ok; ok = cursor.Next() {
+			entry, err := deserializeIssuanceIndexEntry(cursor.Key(),
+				cursor.Value())
+			if err != nil {
+				return database.Error{
+					ErrorCode: database.ErrCorruption,
+					Description: fmt.Sprintf("corrupt issuance "+
+						"index entry %x: %v", cursor.Key(),
+						err),
+				}
+			}
+			if entry.Height > endHeight {
+				break
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// NewIssuanceIndex returns a new instance of an indexer that is used to create
+// a mapping of the heights of the blocks of the main chain to the issuances and
+// destructions in them.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewIssuanceIndex(db database.DB) *IssuanceIndex {
+	return &IssuanceIndex{db: db}
+}
+
+// DropIssuanceIndex drops the issuance index from the provided database if it
+// exists.
+func DropIssuanceIndex(db database.DB) error {
+	return dropIndex(db, issuanceIndexKey, issuanceIndexName)
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// testPrivKey returns the private key encoded by the passed hex string.
+func testPrivKey(t *testing.T, s string) *btcec.PrivateKey {
+	keyBytes, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("unable to decode private key: %v", err)
+	}
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
+	return key
+}
+
+// TestIssuanceIndex ensures the issuance index has an entry for each output
+// created by an issuance and each input consumed by a destruction of the main
+// chain, which are returned by height range, that the entries of blocks which
+// are disconnected by a reorganization are removed, and that the index is
+// dropped and caught up to an existing chain.
+func TestIssuanceIndex(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	db, teardown := testIndexDB(t, "issuanceindex", &params)
+	defer teardown()
+	newChain := func() (*blockchain.BlockChain, *Manager, *IssuanceIndex) {
+		issuanceIndex := NewIssuanceIndex(db)
+		chain, manager := newTestIndexChain(t, db, &params,
+			NewTxIndex(db), issuanceIndex)
+		manager.Start()
+		waitForSync(t, manager)
+		return chain, manager, issuanceIndex
+	}
+	chain, manager, issuanceIndex := newChain()
+
+	// The tokens are issued to an address of the owner key and the ASP
+	// keys of the regression test network.
+	rootKeys := []*btcec.PrivateKey{
+		testPrivKey(t, "eaf02ca348c524e6392655ba4d29603cd1a7347d9d65cfe93ce1ebffdca22694"),
+		testPrivKey(t, "2b8c52b77b327c755b9b375500d3f4b2da9b0a1ff65f6891d311fe94295bc26a"),
+	}
+	issueKeys := []*btcec.PrivateKey{
+		testPrivKey(t, "0000000000000000000000000000000000000000000000000000000000000003"),
+		testPrivKey(t, "0000000000000000000000000000000000000000000000000000000000000004"),
+	}
+	ownerKey := testPrivKey(t, "0000000000000000000000000000000000000000000000000000000000000005")
+	payAddr, err := provautil.NewAddressProva(provautil.Hash160(
+		ownerKey.PubKey().SerializeCompressed()), []btcec.KeyID{1, 2},
+		&params)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	payScript, err := txscript.PayToAddrScript(payAddr)
+	if err != nil {
+		t.Fatalf("unable to create pkScript: %v", err)
+	}
+	signInput := func(tx *wire.MsgTx, idx int, amount int64, pkScript []byte, keys ...*btcec.PrivateKey) {
+		lookupKey := func(provautil.Address) ([]txscript.PrivateKey, error) {
+			privKeys := make([]txscript.PrivateKey, 0, len(keys))
+			for _, key := range keys {
+				privKeys = append(privKeys,
+					txscript.PrivateKey{Key: key, Compressed: true})
+			}
+			return privKeys, nil
+		}
+		sigScript, err := txscript.SignTxOutput(&params, tx, idx, amount,
+			pkScript, txscript.SigHashAll,
+			txscript.KeyClosure(lookupKey), nil)
+		if err != nil {
+			t.Fatalf("unable to sign transaction: %v", err)
+		}
+		tx.TxIn[idx].SignatureScript = sigScript
+	}
+
+	// adminTx returns a transaction which continues the passed admin
+	// thread from the passed tip with the passed outputs, signed by the
+	// passed keys.  The outputs spent by the passed outpoints, which pay
+	// the passed amounts to the address of the owner, are destroyed.
+	adminTx := func(threadID provautil.ThreadID, tip wire.OutPoint, keys []*btcec.PrivateKey, txOuts []*wire.TxOut, destroyed []wire.OutPoint, amounts []int64) *wire.MsgTx {
+		threadScript, err := txscript.ProvaThreadScript(threadID)
+		if err != nil {
+			t.Fatalf("unable to create thread script: %v", err)
+		}
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: tip,
+			Sequence:         wire.MaxTxInSequenceNum,
+		})
+		tx.AddTxOut(wire.NewTxOut(0, threadScript))
+		var total int64
+		for i, outPoint := range destroyed {
+			tx.AddTxIn(&wire.TxIn{
+				PreviousOutPoint: outPoint,
+				Sequence:         wire.MaxTxInSequenceNum,
+			})
+			total += amounts[i]
+		}
+		if total > 0 {
+			tx.AddTxOut(wire.NewTxOut(total,
+				[]byte{txscript.OP_RETURN}))
+		}
+		for _, txOut := range txOuts {
+			tx.AddTxOut(txOut)
+		}
+		signInput(tx, 0, 0, threadScript, keys...)
+		for i := range destroyed {
+			signInput(tx, i+1, amounts[i], payScript, ownerKey,
+				rootKeys[0])
+		}
+		return tx
+	}
+	outPoint := func(tx *wire.MsgTx, index uint32) wire.OutPoint {
+		return wire.OutPoint{Hash: tx.TxHash(), Index: index}
+	}
+	processBlock := func(prev *wire.MsgBlock, tag string, txns ...*wire.MsgTx) *wire.MsgBlock {
+		block, err := testBlock(&params, prev, tag, txns...)
+		if err != nil {
+			t.Fatalf("unable to create block: %v", err)
+		}
+		_, _, err = chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+		return block.MsgBlock()
+	}
+
+	// Provision the issue keys, issue tokens twice, destroy some of them,
+	// and then destroy others and issue more in the same block.
+	tips := chain.ThreadTips()
+	var txOuts []*wire.TxOut
+	for _, key := range issueKeys {
+		data := append([]byte{txscript.AdminOpIssueKeyAdd},
+			key.PubKey().SerializeCompressed()...)
+		opScript, err := txscript.NewScriptBuilder().
+			AddOp(txscript.OP_RETURN).AddData(data).Script()
+		if err != nil {
+			t.Fatalf("unable to create admin op script: %v", err)
+		}
+		txOuts = append(txOuts, wire.NewTxOut(0, opScript))
+	}
+	rootTx := adminTx(provautil.RootThread, *tips[provautil.RootThread],
+		rootKeys, txOuts, nil, nil)
+	issueA := adminTx(provautil.IssueThread, *tips[provautil.IssueThread],
+		issueKeys, []*wire.TxOut{wire.NewTxOut(1000, payScript),
+			wire.NewTxOut(2000, payScript)}, nil, nil)
+	issueB := adminTx(provautil.IssueThread, outPoint(issueA, 0), issueKeys,
+		[]*wire.TxOut{wire.NewTxOut(500, payScript)}, nil, nil)
+	destroyC := adminTx(provautil.IssueThread, outPoint(issueB, 0),
+		issueKeys, nil, []wire.OutPoint{outPoint(issueA, 1)},
+		[]int64{1000})
+	destroyD := adminTx(provautil.IssueThread, outPoint(destroyC, 0),
+		issueKeys, nil, []wire.OutPoint{outPoint(issueA, 2),
+			outPoint(issueB, 1)}, []int64{2000, 500})
+	issueE := adminTx(provautil.IssueThread, outPoint(destroyD, 0),
+		issueKeys, []*wire.TxOut{wire.NewTxOut(700, payScript)}, nil, nil)
+
+	b1 := processBlock(params.GenesisBlock, "main", rootTx)
+	b2 := processBlock(b1, "main", issueA, issueB)
+	b3 := processBlock(b2, "main", destroyC)
+	processBlock(b3, "main", destroyD, issueE)
+
+	entry := func(height uint32, tx *wire.MsgTx, isDestruction bool, outPoint wire.OutPoint, amount int64) *IssuanceEntry {
+		return &IssuanceEntry{
+			Height:        height,
+			TxHash:        tx.TxHash(),
+			IsDestruction: isDestruction,
+			OutPoint:      outPoint,
+			Amount:        amount,
+			IssuingKey:    issueKeys[0].PubKey(),
+		}
+	}
+	entries := []*IssuanceEntry{
+		entry(2, issueA, false, outPoint(issueA, 1), 1000),
+		entry(2, issueA, false, outPoint(issueA, 2), 2000),
+		entry(2, issueB, false, outPoint(issueB, 1), 500),
+		entry(3, destroyC, true, outPoint(issueA, 1), 1000),
+		entry(4, destroyD, true, outPoint(issueA, 2), 2000),
+		entry(4, destroyD, true, outPoint(issueB, 1), 500),
+		entry(4, issueE, false, outPoint(issueE, 1), 700),
+	}
+	checkEntries := func(start, end uint32, want []*IssuanceEntry) {
+		got, err := issuanceIndex.FetchIssuanceEntries(start, end)
+		if err != nil {
+			t.Fatalf("FetchIssuanceEntries: unexpected error: %v",
+				err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("heights %d to %d: got %d entries, want %d",
+				start, end, len(got), len(want))
+		}
+		for i := range got {
+			g, w := got[i], want[i]
+			if g.Height != w.Height || g.TxHash != w.TxHash ||
+				g.IsDestruction != w.IsDestruction ||
+				g.OutPoint != w.OutPoint || g.Amount != w.Amount ||
+				!g.IssuingKey.IsEqual(w.IssuingKey) {
+
+				t.Fatalf("heights %d to %d: got entry %d %+v, "+
+					"want %+v", start, end, i, g, w)
+			}
+		}
+	}
+	checkEntries(0, 100, entries)
+	checkEntries(2, 2, entries[:3])
+	checkEntries(3, 3, entries[3:4])
+	checkEntries(3, 4, entries[3:])
+	checkEntries(5, 9, nil)
+	checkEntries(4, 3, nil)
+
+	// Reorganize the block with the second destruction and the last
+	// issuance out of the main chain.
+	fork := processBlock(b3, "fork")
+	processBlock(fork, "fork")
+	if best := chain.BestSnapshot(); best.Height != 5 {
+		t.Fatalf("got best height %d, want 5", best.Height)
+	}
+	checkEntries(0, 100, entries[:4])
+
+	// Drop the index and catch it up to the existing chain again.
+	manager.Stop()
+	if err := DropIssuanceIndex(db); err != nil {
+		t.Fatalf("DropIssuanceIndex: unexpected error: %v", err)
+	}
+	err = db.View(func(dbTx database.Tx) error {
+		if dbTx.Metadata().Bucket(issuanceIndexKey) != nil {
+			t.Fatalf("issuance index bucket exists after drop")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to view db: %v", err)
+	}
+	chain, manager, issuanceIndex = newChain()
+	defer manager.Stop()
+	checkEntries(0, 100, entries[:4])
+}
@@ -8,6 +8,7 @@ package indexers
 import (
 	"bytes"
 	"fmt"
+	"sync"
 
 	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/chaincfg/chainhash"
@@ -126,9 +127,32 @@ func dbIndexDisconnectBlock(dbTx database.Tx, indexer Indexer, block *provautil.
 // Manager defines an index manager that manages multiple optional indexes and
 // implements the blockchain.IndexManager interface so it can be seamlessly
 // plugged into normal chain processing.
+//
+// Indexes which are behind the main chain when the manager is initialized, such
+// as after a crash or after being enabled, are caught up in the background once
+// the manager is started.  Until an index reaches the main chain tip, it is
+// reported as not synced and the chain skips it when connecting and
+// disconnecting blocks which don't apply to its current tip.
 type Manager struct {
 	db             database.DB
 	enabledIndexes []Indexer
+	chain          *blockchain.BlockChain
+
+	// txEncoding is the protocol version flags the blocks and transactions
+	// of the chain are decoded with.
+	txEncoding uint32
+
+	// The following fields track which of the enabled indexes have caught
+	// up to the main chain along with the main chain tip as of the last
+	// block connected or disconnected by the chain.  They are protected by
+	// the mutex.
+	mtx        sync.Mutex
+	synced     []bool
+	bestHash   chainhash.Hash
+	bestHeight int32
+
+	wg   sync.WaitGroup
+	quit chan struct{}
 }
 
 // Ensure the Manager type implements the blockchain.IndexManager interface.
@@ -219,11 +243,12 @@ func (m *Manager) maybeCreateIndexes(dbTx database.Tx) error {
 }
 
 // Init initializes the enabled indexes.  This is called during chain
-// initialization and primarily consists of catching up all indexes to the
-// current best chain tip.  This is necessary since each index can be disabled
-// and re-enabled at any time and attempting to catch-up indexes at the same
-// time new blocks are being downloaded would lead to an overall longer time to
-// catch up due to the I/O contention.
+// initialization and primarily consists of rolling back indexes whose tip is no
+// longer in the main chain and determining which indexes are behind the current
+// best chain tip.  Indexes can fall behind since each index can be disabled and
+// re-enabled at any time, and since the node can crash between connecting a
+// block and persisting the index.  The indexes which are behind are caught up in
+// the background once the manager is started.
 //
 // This is part of the blockchain.IndexManager interface.
 func (m *Manager) Init(chain *blockchain.BlockChain) error {
@@ -232,6 +257,8 @@ func (m *Manager) Init(chain *blockchain.BlockChain) error {
 		return nil
 	}
 
+	m.txEncoding = chain.TxEncoding()
+
 	// Finish and drops that were previously interrupted.
 	if err := m.maybeFinishDrops(); err != nil {
 		return err
@@ -294,47 +321,16 @@ func (m *Manager) Init(chain *blockchain.BlockChain) error {
 				break
 			}
 
-			// At this point the index tip is orphaned, so load the
-			// orphaned block from the database directly and
-			// disconnect it from the index.  The block has to be
-			// loaded directly since it is no longer in the main
-			// chain and thus the chain.BlockByHash function would
-			// error.
-			err = m.db.Update(func(dbTx database.Tx) error {
-				blockBytes, err := dbTx.FetchBlock(hash)
-				if err != nil {
-					return err
-				}
-				block, err := provautil.NewBlockFromBytes(blockBytes)
-				if err != nil {
-					return err
-				}
-
-				// When the index requires all of the referenced
-				// txouts they need to be retrieved from the
-				// transaction index.
-				var view *blockchain.UtxoViewpoint
-				if indexNeedsInputs(indexer) {
-					var err error
-					view, err = makeUtxoView(dbTx, block)
-					if err != nil {
-						return err
-					}
-				}
-
-				// Remove all of the index entries associated
-				// with the block and update the indexer tip.
-				err = dbIndexDisconnectBlock(dbTx, indexer,
-					block, view)
-				if err != nil {
-					return err
-				}
-
-				// Update the tip to the previous block.
-				hash = &block.MsgBlock().Header.PrevBlock
-				height--
-
-				return nil
+			// At this point the index tip is orphaned, so disconnect
+			// it from the index and move on to the previous block.
+			err = m.disconnectOrphanedTip(i-1, hash)
+			if err != nil {
+				return err
+			}
+			err = m.db.View(func(dbTx database.Tx) error {
+				hash, height, err = dbFetchIndexerTip(dbTx,
+					indexer.Key())
+				return err
 			})
 			if err != nil {
 				return err
@@ -348,13 +344,13 @@ func (m *Manager) Init(chain *blockchain.BlockChain) error {
 		}
 	}
 
-	// Fetch the current tip heights for each index along with tracking the
-	// lowest one so the catchup code only needs to start at the earliest
-	// block and is able to skip connecting the block for the indexes that
-	// don't need it.
-	bestHeight := int32(chain.BestSnapshot().Height)
-	lowestHeight := bestHeight
-	indexerHeights := make([]int32, len(m.enabledIndexes))
+	// Determine which of the indexes are behind the current best chain tip.
+	// Their tips are all in the main chain at this point, so only the
+	// indexes which are already at the best chain tip are synced.
+	best := chain.BestSnapshot()
+	m.chain = chain
+	m.bestHash = *best.Hash
+	m.bestHeight = int32(best.Height)
 	err = m.db.View(func(dbTx database.Tx) error {
 		for i, indexer := range m.enabledIndexes {
 			idxKey := indexer.Key()
@@ -365,9 +361,12 @@ func (m *Manager) Init(chain *blockchain.BlockChain) error {
 
 			log.Debugf("Current %s tip (height %d, hash %v)",
 				indexer.Name(), height, hash)
-			indexerHeights[i] = height
-			if height < lowestHeight {
-				lowestHeight = height
+			m.synced[i] = hash.IsEqual(best.Hash)
+			if !m.synced[i] {
+				log.Infof("The %s is behind the main chain "+
+					"(height %d of %d) and will be caught up "+
+					"in the background", indexer.Name(), height,
+					best.Height)
 			}
 		}
 		return nil
@@ -376,63 +375,247 @@ func (m *Manager) Init(chain *blockchain.BlockChain) error {
 		return err
 	}
 
-	// Nothing to index if all of the indexes are caught up.
-	if lowestHeight == bestHeight {
-		return nil
+	return nil
+}
+
+// Start begins catching up the indexes which are behind the main chain in the
+// background.  Nothing is done when all of the indexes are already synced.
+func (m *Manager) Start() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	for _, synced := range m.synced {
+		if !synced {
+			m.wg.Add(1)
+			go m.catchUpHandler()
+			return
+		}
 	}
+}
+
+// Stop stops catching up the indexes which are behind the main chain and waits
+// for the background catch up to finish.  Any indexes which did not catch up
+// yet resume from their current tip the next time the manager is initialized.
+func (m *Manager) Stop() {
+	select {
+	case <-m.quit:
+	default:
+		close(m.quit)
+	}
+	m.wg.Wait()
+}
+
+// IsSynced returns whether or not the passed index has caught up to the main
+// chain.  Indexes which are not managed by the manager are never synced.
+//
+// This function is safe for concurrent access.
+func (m *Manager) IsSynced(indexer Indexer) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	for i, enabled := range m.enabledIndexes {
+		if bytes.Equal(enabled.Key(), indexer.Key()) {
+			return m.synced[i]
+		}
+	}
+	return false
+}
+
+// catchUpHandler connects the blocks of the main chain to the indexes which are
+// behind it one block at a time until all of them are synced or the manager is
+// stopped.
+//
+// This must be run as a goroutine.
+func (m *Manager) catchUpHandler() {
+	defer m.wg.Done()
 
-	// Create a progress logger for the indexing process below.
 	progressLogger := newBlockProgressLogger("Indexed", log)
+	for {
+		select {
+		case <-m.quit:
+			log.Infof("Index catch up stopped before completion")
+			return
+		default:
+		}
 
-	// At this point, one or more indexes are behind the current best chain
-	// tip and need to be caught up, so log the details and loop through
-	// each block that needs to be indexed.
-	log.Infof("Catching up indexes from height %d to %d", lowestHeight,
-		bestHeight)
-	for height := lowestHeight + 1; height <= bestHeight; height++ {
-		// Load the block for the height since it is required to index
-		// it.
-		block, err := chain.BlockByHeight(uint32(height))
+		done, err := m.catchUpBlock(progressLogger)
 		if err != nil {
-			return err
+			log.Errorf("Unable to catch up indexes: %v", err)
+			return
+		}
+		if done {
+			m.mtx.Lock()
+			log.Infof("Indexes caught up to height %d", m.bestHeight)
+			m.mtx.Unlock()
+			return
+		}
+	}
+}
+
+// catchUpBlock connects the main chain block which follows the lowest tip of the
+// indexes which are behind the main chain to all of the indexes it extends and
+// marks the indexes which reached the main chain tip as synced.  When the lowest
+// tip was orphaned by a reorganize since the manager was initialized, it is
+// disconnected from its index instead.  It returns whether or not all of the
+// indexes are synced.
+//
+// Since the chain skips indexes which are not synced, this relies on the chain
+// updating the indexes and the best chain tip tracked by the manager in the same
+// database transaction as the block it connects or disconnects.
+func (m *Manager) catchUpBlock(progressLogger *blockProgressLogger) (bool, error) {
+	m.mtx.Lock()
+	synced := append([]bool(nil), m.synced...)
+	bestHeight := m.bestHeight
+	m.mtx.Unlock()
+
+	// Find the lowest tip of the indexes which are not synced yet.
+	lowest := -1
+	var lowestHash *chainhash.Hash
+	var lowestHeight int32
+	err := m.db.View(func(dbTx database.Tx) error {
+		for i, indexer := range m.enabledIndexes {
+			if synced[i] {
+				continue
+			}
+
+			hash, height, err := dbFetchIndexerTip(dbTx, indexer.Key())
+			if err != nil {
+				return err
+			}
+			if lowest == -1 || height < lowestHeight {
+				lowest, lowestHash, lowestHeight = i, hash, height
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if lowest == -1 {
+		return true, nil
+	}
+
+	// Load the main chain block which follows the lowest tip and disconnect
+	// the tip instead when it no longer extends the main chain.
+	var block *provautil.Block
+	if lowestHeight < bestHeight {
+		block, err = m.chain.BlockByHeight(uint32(lowestHeight + 1))
+		if err != nil {
+			return false, err
+		}
+	}
+	if block == nil || !block.MsgBlock().Header.PrevBlock.IsEqual(lowestHash) {
+		exists, err := m.chain.MainChainHasBlock(lowestHash)
+		if err != nil {
+			return false, err
 		}
+		if !exists {
+			return false, m.disconnectOrphanedTip(lowest, lowestHash)
+		}
+	}
+
+	var caughtUp []int
+	err = m.db.Update(func(dbTx database.Tx) error {
+		m.mtx.Lock()
+		defer m.mtx.Unlock()
 
-		// Connect the block for all indexes that need it.
 		var view *blockchain.UtxoViewpoint
 		for i, indexer := range m.enabledIndexes {
-			// Skip indexes that don't need to be updated with this
-			// block.
-			if indexerHeights[i] >= height {
+			if m.synced[i] {
 				continue
 			}
 
-			err := m.db.Update(func(dbTx database.Tx) error {
+			// Connect the block to the index when it extends its
+			// tip.
+			hash, _, err := dbFetchIndexerTip(dbTx, indexer.Key())
+			if err != nil {
+				return err
+			}
+			if block != nil && hash.IsEqual(&block.MsgBlock().Header.PrevBlock) {
 				// When the index requires all of the referenced
 				// txouts and they haven't been loaded yet, they
 				// need to be retrieved from the transaction
 				// index.
 				if view == nil && indexNeedsInputs(indexer) {
 					var err error
-					view, err = makeUtxoView(dbTx, block)
+					view, err = makeUtxoView(dbTx, m.txEncoding, block)
 					if err != nil {
 						return err
 					}
 				}
-				return dbIndexConnectBlock(dbTx, indexer, block,
-					view)
-			})
-			if err != nil {
-				return err
+				err := dbIndexConnectBlock(dbTx, indexer, block, view)
+				if err != nil {
+					return err
+				}
+				hash = block.Hash()
 			}
-			indexerHeights[i] = height
-		}
 
-		// Log indexing progress.
+			if hash.IsEqual(&m.bestHash) {
+				caughtUp = append(caughtUp, i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if block != nil {
 		progressLogger.LogBlockHeight(block)
 	}
 
-	log.Infof("Indexes caught up to height %d", bestHeight)
-	return nil
+	// Mark the indexes which reached the main chain tip as synced.  This is
+	// done once the transaction is committed since the chain keeps synced
+	// indexes at its tip from here on.
+	m.mtx.Lock()
+	for _, i := range caughtUp {
+		m.synced[i] = true
+		log.Infof("The %s caught up to the main chain",
+			m.enabledIndexes[i].Name())
+	}
+	m.mtx.Unlock()
+	return false, nil
+}
+
+// disconnectOrphanedTip disconnects the passed block, which is no longer part of
+// the main chain, from the index at the passed position in the enabled indexes
+// unless the index moved on from it in the mean time.
+func (m *Manager) disconnectOrphanedTip(i int, hash *chainhash.Hash) error {
+	indexer := m.enabledIndexes[i]
+	return m.db.Update(func(dbTx database.Tx) error {
+		m.mtx.Lock()
+		defer m.mtx.Unlock()
+
+		curTipHash, _, err := dbFetchIndexerTip(dbTx, indexer.Key())
+		if err != nil {
+			return err
+		}
+		if m.synced[i] || !curTipHash.IsEqual(hash) {
+			return nil
+		}
+
+		// The block has to be loaded directly since it is no longer in
+		// the main chain.
+		blockBytes, err := dbTx.FetchBlock(hash)
+		if err != nil {
+			return err
+		}
+		block, err := provautil.NewBlockFromBytesEncoding(blockBytes,
+			m.txEncoding)
+		if err != nil {
+			return err
+		}
+		var view *blockchain.UtxoViewpoint
+		if indexNeedsInputs(indexer) {
+			view, err = makeUtxoView(dbTx, m.txEncoding, block)
+			if err != nil {
+				return err
+			}
+		}
+
+		log.Debugf("Removing orphaned block %v (height %d) from the %s",
+			hash, block.Height(), indexer.Name())
+		return dbIndexDisconnectBlock(dbTx, indexer, block, view)
+	})
 }
 
 // indexNeedsInputs returns whether or not the index needs access to the txouts
@@ -446,8 +629,9 @@ func indexNeedsInputs(index Indexer) bool {
 }
 
 // dbFetchTx looks up the passed transaction hash in the transaction index and
-// loads it from the database.
-func dbFetchTx(dbTx database.Tx, hash *chainhash.Hash) (*wire.MsgTx, error) {
+// loads it from the database, decoding it with the passed protocol version
+// flags.
+func dbFetchTx(dbTx database.Tx, txEncoding uint32, hash *chainhash.Hash) (*wire.MsgTx, error) {
 	// Look up the location of the transaction.
 	blockRegion, err := dbFetchTxIndexEntry(dbTx, hash)
 	if err != nil {
@@ -465,7 +649,7 @@ func dbFetchTx(dbTx database.Tx, hash *chainhash.Hash) (*wire.MsgTx, error) {
 
 	// Deserialize the transaction.
 	var msgTx wire.MsgTx
-	err = msgTx.Deserialize(bytes.NewReader(txBytes))
+	err = msgTx.BtcDecode(bytes.NewReader(txBytes), txEncoding)
 	if err != nil {
 		return nil, err
 	}
@@ -477,8 +661,9 @@ func dbFetchTx(dbTx database.Tx, hash *chainhash.Hash) (*wire.MsgTx, error) {
 // transaction index in order to look up all inputs referenced by the
 // transactions in the block.  This is sometimes needed when catching indexes up
 // because many of the txouts could actually already be spent however the
-// associated scripts are still required to index them.
-func makeUtxoView(dbTx database.Tx, block *provautil.Block) (*blockchain.UtxoViewpoint, error) {
+// associated scripts are still required to index them.  The transactions are
+// decoded with the passed protocol version flags.
+func makeUtxoView(dbTx database.Tx, txEncoding uint32, block *provautil.Block) (*blockchain.UtxoViewpoint, error) {
 	view := blockchain.NewUtxoViewpoint()
 	for txIdx, tx := range block.Transactions() {
 		// Coinbases do not reference any inputs.  Since the block is
@@ -493,7 +678,8 @@ func makeUtxoView(dbTx database.Tx, block *provautil.Block) (*blockchain.UtxoVie
 		// inputs and add their outputs to the view.
 		for _, txIn := range tx.MsgTx().TxIn {
 			originOut := &txIn.PreviousOutPoint
-			originTx, err := dbFetchTx(dbTx, &originOut.Hash)
+			originTx, err := dbFetchTx(dbTx, txEncoding,
+				&originOut.Hash)
 			if err != nil {
 				return nil, err
 			}
@@ -511,14 +697,36 @@ func makeUtxoView(dbTx database.Tx, block *provautil.Block) (*blockchain.UtxoVie
 //
 // This is part of the blockchain.IndexManager interface.
 func (m *Manager) ConnectBlock(dbTx database.Tx, block *provautil.Block, view *blockchain.UtxoViewpoint) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
 	// Call each of the currently active optional indexes with the block
-	// being connected so they can update accordingly.
-	for _, index := range m.enabledIndexes {
+	// being connected so they can update accordingly.  Indexes which are
+	// still catching up are skipped unless the block extends their tip, in
+	// which case they have reached the main chain tip.
+	for i, index := range m.enabledIndexes {
+		if !m.synced[i] {
+			curTipHash, _, err := dbFetchIndexerTip(dbTx, index.Key())
+			if err != nil {
+				return err
+			}
+			if !curTipHash.IsEqual(&block.MsgBlock().Header.PrevBlock) {
+				continue
+			}
+		}
+
 		err := dbIndexConnectBlock(dbTx, index, block, view)
 		if err != nil {
 			return err
 		}
+		if !m.synced[i] {
+			m.synced[i] = true
+			log.Infof("The %s caught up to the main chain",
+				index.Name())
+		}
 	}
+	m.bestHash = *block.Hash()
+	m.bestHeight = int32(block.Height())
 	return nil
 }
 
@@ -529,14 +737,30 @@ func (m *Manager) ConnectBlock(dbTx database.Tx, block *provautil.Block, view *b
 //
 // This is part of the blockchain.IndexManager interface.
 func (m *Manager) DisconnectBlock(dbTx database.Tx, block *provautil.Block, view *blockchain.UtxoViewpoint) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
 	// Call each of the currently active optional indexes with the block
-	// being disconnected so they can update accordingly.
-	for _, index := range m.enabledIndexes {
+	// being disconnected so they can update accordingly.  Indexes which are
+	// still catching up are skipped unless the block is their tip.
+	for i, index := range m.enabledIndexes {
+		if !m.synced[i] {
+			curTipHash, _, err := dbFetchIndexerTip(dbTx, index.Key())
+			if err != nil {
+				return err
+			}
+			if !curTipHash.IsEqual(block.Hash()) {
+				continue
+			}
+		}
+
 		err := dbIndexDisconnectBlock(dbTx, index, block, view)
 		if err != nil {
 			return err
 		}
 	}
+	m.bestHash = block.MsgBlock().Header.PrevBlock
+	m.bestHeight = int32(block.Height()) - 1
 	return nil
 }
 
@@ -548,6 +772,8 @@ func NewManager(db database.DB, enabledIndexes []Indexer) *Manager {
 	return &Manager{
 		db:             db,
 		enabledIndexes: enabledIndexes,
+		synced:         make([]bool, len(enabledIndexes)),
+		quit:           make(chan struct{}),
 	}
 }
 
@@ -0,0 +1,227 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/chaingen"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+)
+
+// TestManagerCatchUp ensures indexes which were left behind or on an orphaned
+// block by a crash are detected when the manager is initialized and are rolled
+// back and caught up to the main chain, including blocks connected while they
+// were catching up.
+func TestManagerCatchUp(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	db, teardown := testIndexDB(t, "indexers", &params)
+	defer teardown()
+
+	// New indexes start out behind the genesis block.
+	chain, manager := newTestIndexChain(t, db, &params, NewTxIndex(db),
+		NewAddrIndex(db, &params))
+	manager.Start()
+	waitForSync(t, manager)
+
+	// Extend the main chain and add a competing block at the tip which is
+	// stored as a side chain block.
+	var blocks []*provautil.Block
+	prev := params.GenesisBlock
+	for i := 0; i < 5; i++ {
+		block, err := testBlock(&params, prev, "main")
+		if err != nil {
+			t.Fatalf("unable to create block: %v", err)
+		}
+		isMainChain, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil || !isMainChain {
+			t.Fatalf("ProcessBlock: got main chain %v, err %v",
+				isMainChain, err)
+		}
+		blocks = append(blocks, block)
+		prev = block.MsgBlock()
+	}
+	fork, err := testBlock(&params, blocks[3].MsgBlock(), "fork")
+	if err != nil {
+		t.Fatalf("unable to create block: %v", err)
+	}
+	isMainChain, _, err := chain.ProcessBlock(fork, blockchain.BFNone)
+	if err != nil || isMainChain {
+		t.Fatalf("ProcessBlock: got main chain %v, err %v", isMainChain,
+			err)
+	}
+	manager.Stop()
+
+	// Simulate a crash which left the transaction index on the orphaned
+	// block and the address index a few blocks behind the main chain.
+	err = db.Update(func(dbTx database.Tx) error {
+		txIndex := manager.enabledIndexes[0]
+		addrIndex := manager.enabledIndexes[1]
+		err := dbIndexDisconnectBlock(dbTx, txIndex, blocks[4], nil)
+		if err != nil {
+			return err
+		}
+		err = dbIndexConnectBlock(dbTx, txIndex, fork, nil)
+		if err != nil {
+			return err
+		}
+		for i := 4; i >= 2; i-- {
+			err := dbIndexDisconnectBlock(dbTx, addrIndex, blocks[i],
+				nil)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to desync indexes: %v", err)
+	}
+
+	// The orphaned block is rolled back when the manager is initialized
+	// and both indexes are reported as not synced.
+	chain, manager = newTestIndexChain(t, db, &params, NewTxIndex(db),
+		NewAddrIndex(db, &params))
+	defer manager.Stop()
+	txIndex := manager.enabledIndexes[0].(*TxIndex)
+	addrIndex := manager.enabledIndexes[1].(*AddrIndex)
+	wantTips := []*chainhash.Hash{blocks[3].Hash(), blocks[1].Hash()}
+	err = db.View(func(dbTx database.Tx) error {
+		for i, indexer := range manager.enabledIndexes {
+			hash, _, err := dbFetchIndexerTip(dbTx, indexer.Key())
+			if err != nil {
+				return err
+			}
+			if !hash.IsEqual(wantTips[i]) {
+				t.Errorf("%s: got tip %v, want %v",
+					indexer.Name(), hash, wantTips[i])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to fetch index tips: %v", err)
+	}
+	for _, indexer := range manager.enabledIndexes {
+		if manager.IsSynced(indexer) {
+			t.Fatalf("%s: synced before catching up", indexer.Name())
+		}
+	}
+
+	// Blocks connected before the indexes caught up are indexed by the
+	// catch up.
+	block, err := testBlock(&params, blocks[4].MsgBlock(), "main")
+	if err != nil {
+		t.Fatalf("unable to create block: %v", err)
+	}
+	isMainChain, _, err = chain.ProcessBlock(block, blockchain.BFNone)
+	if err != nil || !isMainChain {
+		t.Fatalf("ProcessBlock: got main chain %v, err %v", isMainChain,
+			err)
+	}
+	blocks = append(blocks, block)
+	manager.Start()
+	waitForSync(t, manager)
+
+	// Ensure the coinbases of the main chain blocks are indexed exactly once
+	// by both indexes while the coinbase of the orphaned block is not.
+	for _, block := range blocks {
+		coinbaseHash := block.Transactions()[0].Hash()
+		region, err := txIndex.TxBlockRegion(coinbaseHash)
+		if err != nil || region == nil || !region.Hash.IsEqual(block.Hash()) {
+			t.Fatalf("coinbase %v of block %v not indexed: %v",
+				coinbaseHash, block.Hash(), err)
+		}
+	}
+	region, err := txIndex.TxBlockRegion(fork.Transactions()[0].Hash())
+	if err != nil || region != nil {
+		t.Fatalf("coinbase of orphaned block indexed: %v", err)
+	}
+	err = db.View(func(dbTx database.Tx) error {
+		for _, block := range append(blocks, fork) {
+			tag := "main"
+			if block == fork {
+				tag = "fork"
+			}
+			addr, err := testPayAddr(&params, block.MsgBlock().Header.Height,
+				tag)
+			if err != nil {
+				return err
+			}
+			regions, _, err := addrIndex.TxRegionsForAddress(dbTx, addr,
+				0, 100, false)
+			if err != nil {
+				return err
+			}
+			switch {
+			case block == fork && len(regions) != 0:
+				t.Errorf("got %d address index entries for the "+
+					"orphaned block, want 0", len(regions))
+			case block != fork && (len(regions) != 1 ||
+				!regions[0].Hash.IsEqual(block.Hash())):
+				t.Errorf("got address index entries %v for block "+
+					"%v, want one", regions, block.Hash())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to fetch address index entries: %v", err)
+	}
+}
+
+// BenchmarkAddrIndexCatchUp measures the time it takes the address index to
+// catch up to a generated chain of 2000 blocks, or 200 blocks in short mode,
+// when it is enabled after the chain was synced with the transaction index it
+// depends on.
+func BenchmarkAddrIndexCatchUp(b *testing.B) {
+	params := chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	numBlocks := uint32(2000)
+	if testing.Short() {
+		numBlocks = 200
+	}
+
+	db, teardown := testIndexDB(b, "indexers", &params)
+	defer teardown()
+
+	// Sync the chain with only the transaction index.
+	chain, _ := newTestIndexChain(b, db, &params, NewTxIndex(db))
+	err := chaingen.Generate(&chaingen.Config{
+		Params:        &params,
+		NumBlocks:     numBlocks,
+		TxPerBlock:    20,
+		OutputsPerTx:  2,
+		AdminInterval: 50,
+	}, chaingen.ProcessBlocks(chain))
+	if err != nil {
+		b.Fatalf("Generate: unexpected error: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		addrIndex := NewAddrIndex(db, &params)
+		_, manager := newTestIndexChain(b, db, &params, NewTxIndex(db),
+			addrIndex)
+		manager.Start()
+		for !manager.IsSynced(addrIndex) {
+			time.Sleep(time.Millisecond)
+		}
+		manager.Stop()
+
+		// Drop the index so the next iteration catches up from the
+		// genesis block again.
+		b.StopTimer()
+		if err := dropIndex(db, addrIndexKey, addrIndexName); err != nil {
+			b.Fatalf("unable to drop index: %v", err)
+		}
+		b.StartTimer()
+	}
+}
@@ -468,12 +468,16 @@ func dropBlockIDIndex(db database.DB) error {
 }
 
 // DropTxIndex drops the transaction index from the provided database if it
-// exists.  Since the address index relies on it, the address index will also be
-// dropped when it exists.
+// exists.  Since the address and issuance indexes rely on it, they will also be
+// dropped when they exist.
 func DropTxIndex(db database.DB) error {
 	if err := dropIndex(db, addrIndexKey, addrIndexName); err != nil {
 		return err
 	}
+	err := dropIndex(db, issuanceIndexKey, issuanceIndexName)
+	if err != nil {
+		return err
+	}
 
 	return dropIndex(db, txIndexKey, txIndexName)
 }
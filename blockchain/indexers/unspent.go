@@ -0,0 +1,222 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"context"
+	"sort"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// UnspentQuery describes the unspent transaction outputs returned by
+// FetchUnspentOutputs.
+type UnspentQuery struct {
+	// Addresses and KeyIDs are the addresses and key IDs to return the
+	// outputs of.  An output is returned when it pays to any of the
+	// addresses or when its script includes any of the key IDs.
+	Addresses []provautil.Address
+	KeyIDs    []btcec.KeyID
+
+	// MinConf and MaxConf are the inclusive bounds of the number of
+	// confirmations of the returned outputs.  A MaxConf of zero does not
+	// bound the number of confirmations.
+	MinConf int32
+	MaxConf int32
+
+	// Exclude, when set, is invoked with the outpoint of every output which
+	// matches the query and returns whether it should be excluded, such as
+	// when it is spent by a transaction in the memory pool.
+	Exclude func(outPoint *wire.OutPoint) bool
+
+	// Progress, when set, is invoked after every transaction of the utxo
+	// set is scanned with its hash and the outputs which matched so far.
+	// The utxo set is scanned in the byte order of the transaction hashes,
+	// so the hash indicates how far the scan got.
+	Progress func(txHash *chainhash.Hash, outputs []UnspentOutput)
+}
+
+// UnspentOutput describes an unspent transaction output of the main chain
+// which matches an UnspentQuery.
+type UnspentOutput struct {
+	OutPoint      wire.OutPoint
+	Amount        int64
+	PkScript      []byte
+	Address       string
+	KeyIDs        []btcec.KeyID
+	BlockHeight   uint32
+	Confirmations int32
+	IsCoinBase    bool
+}
+
+// unspentOutputSorter implements sort.Interface to allow a slice of unspent
+// outputs to be sorted by the number of confirmations in descending order and
+// then by outpoint.  When largestFirst is set, they are sorted by amount in
+// descending order first.
+type unspentOutputSorter struct {
+	outputs      []UnspentOutput
+	largestFirst bool
+}
+
+// Len returns the number of outputs in the slice.  It is part of the
+// sort.Interface implementation.
+func (s unspentOutputSorter) Len() int {
+	return len(s.outputs)
+}
+
+// Swap swaps the outputs at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s unspentOutputSorter) Swap(i, j int) {
+	s.outputs[i], s.outputs[j] = s.outputs[j], s.outputs[i]
+}
+
+// Less returns whether the output with index i should sort before the output
+// with index j.  It is part of the sort.Interface implementation.
+func (s unspentOutputSorter) Less(i, j int) bool {
+	a, b := &s.outputs[i], &s.outputs[j]
+	if s.largestFirst && a.Amount != b.Amount {
+		return a.Amount > b.Amount
+	}
+	if a.BlockHeight != b.BlockHeight {
+		return a.BlockHeight < b.BlockHeight
+	}
+	if a.OutPoint.Hash != b.OutPoint.Hash {
+		return bytes.Compare(a.OutPoint.Hash[:], b.OutPoint.Hash[:]) < 0
+	}
+	return a.OutPoint.Index < b.OutPoint.Index
+}
+
+// FetchUnspentOutputs scans the unspent transaction outputs of the main chain
+// of the passed chain for the outputs which match the passed query, using the
+// passed network parameters to decode their addresses.  The outputs are
+// returned in the order of their number of confirmations, oldest first, and
+// then by outpoint.
+//
+// The scan visits every entry of the utxo set and stops early with the error
+// of the passed context when it is cancelled.
+//
+// This function is safe for concurrent access.
+func FetchUnspentOutputs(ctx context.Context, chain *blockchain.BlockChain, params *chaincfg.Params, query *UnspentQuery) ([]UnspentOutput, error) {
+	addrs := make(map[string]struct{}, len(query.Addresses))
+	for _, addr := range query.Addresses {
+		addrs[addr.EncodeAddress()] = struct{}{}
+	}
+	keyIDs := make(map[btcec.KeyID]struct{}, len(query.KeyIDs))
+	for _, keyID := range query.KeyIDs {
+		keyIDs[keyID] = struct{}{}
+	}
+	if len(addrs) == 0 && len(keyIDs) == 0 {
+		return nil, nil
+	}
+
+	// The number of confirmations is relative to the best block at the
+	// time the scan starts.  Outputs of blocks connected while scanning
+	// have no confirmations from that point of view.
+	bestHeight := chain.BestSnapshot().Height
+	var outputs []UnspentOutput
+	err := chain.ForEachUtxoContext(ctx, func(txHash *chainhash.Hash, entry *blockchain.UtxoEntry) error {
+		confirmations := int32(bestHeight) - int32(entry.BlockHeight()) + 1
+		if confirmations < 0 {
+			confirmations = 0
+		}
+		if confirmations < query.MinConf ||
+			(query.MaxConf != 0 && confirmations > query.MaxConf) {
+
+			return nil
+		}
+
+		for _, index := range entry.UnspentOutputIndexes() {
+			pkScript := entry.PkScriptByIndex(index)
+			output, ok := matchUnspentOutput(pkScript, params, addrs,
+				keyIDs)
+			if !ok {
+				continue
+			}
+			output.OutPoint = wire.OutPoint{Hash: *txHash, Index: index}
+			if query.Exclude != nil && query.Exclude(&output.OutPoint) {
+				continue
+			}
+			output.Amount = entry.AmountByIndex(index)
+			output.BlockHeight = entry.BlockHeight()
+			output.Confirmations = confirmations
+			output.IsCoinBase = entry.IsCoinBase()
+			outputs = append(outputs, output)
+		}
+		if query.Progress != nil {
+			query.Progress(txHash, outputs)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(unspentOutputSorter{outputs: outputs})
+	return outputs, nil
+}
+
+// matchUnspentOutput returns the address and key IDs the passed public key
+// script pays to and whether it matches any of the passed addresses or key
+// IDs.
+func matchUnspentOutput(pkScript []byte, params *chaincfg.Params, addrs map[string]struct{}, keyIDs map[btcec.KeyID]struct{}) (UnspentOutput, bool) {
+	class, scriptAddrs, _, err := txscript.ExtractPkScriptAddrs(pkScript,
+		params)
+	if err != nil {
+		return UnspentOutput{}, false
+	}
+	output := UnspentOutput{PkScript: pkScript}
+	if len(scriptAddrs) != 0 {
+		output.Address = scriptAddrs[0].EncodeAddress()
+		if provaAddr, ok := scriptAddrs[0].(*provautil.AddressProva); ok {
+			output.KeyIDs = provaAddr.ScriptKeyIDs()
+		}
+	} else if class == txscript.GeneralProvaTy {
+		pops, err := txscript.ParseScript(pkScript)
+		if err == nil {
+			output.KeyIDs, _ = txscript.ExtractKeyIDs(pops)
+		}
+	}
+
+	if _, ok := addrs[output.Address]; output.Address != "" && ok {
+		return output, true
+	}
+	for _, keyID := range output.KeyIDs {
+		if _, ok := keyIDs[keyID]; ok {
+			return output, true
+		}
+	}
+	return UnspentOutput{}, false
+}
+
+// SelectUnspentOutputs selects outputs from the passed unspent outputs until
+// their total amount reaches the passed target and returns the selected outputs
+// along with their total amount.  The outputs are selected in the passed order,
+// or greedily in the order of their amount, largest first, when largestFirst is
+// set.  The returned flag is false when the total amount of all of the outputs
+// does not reach the target, in which case all of them are returned.
+func SelectUnspentOutputs(outputs []UnspentOutput, target int64, largestFirst bool) ([]UnspentOutput, int64, bool) {
+	candidates := make([]UnspentOutput, len(outputs))
+	copy(candidates, outputs)
+	if largestFirst {
+		sort.Sort(unspentOutputSorter{outputs: candidates,
+			largestFirst: true})
+	}
+
+	var total int64
+	for i, output := range candidates {
+		if total >= target {
+			return candidates[:i], total, true
+		}
+		total += output.Amount
+	}
+	return candidates, total, total >= target
+}
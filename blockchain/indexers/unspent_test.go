@@ -0,0 +1,228 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestFetchUnspentOutputs ensures the unspent outputs paying to addresses and
+// key IDs are found by the utxo scan, bounded by their number of confirmations
+// inclusively, and that excluded outputs are skipped.
+func TestFetchUnspentOutputs(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	db, teardown := testIndexDB(t, "indexers", &params)
+	defer teardown()
+	chain, _ := newTestIndexChain(t, db, &params)
+
+	// Extend the main chain with blocks whose coinbases pay to a distinct
+	// address at each height, all of which share the same key IDs.
+	const numBlocks = 5
+	var addrs []provautil.Address
+	coinbases := make(map[uint32]*chainhash.Hash)
+	prev := params.GenesisBlock
+	for i := 0; i < numBlocks; i++ {
+		block, err := testBlock(&params, prev, "unspent")
+		if err != nil {
+			t.Fatalf("unable to create block: %v", err)
+		}
+		isMainChain, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil || !isMainChain {
+			t.Fatalf("ProcessBlock: got main chain %v, err %v",
+				isMainChain, err)
+		}
+		height := block.MsgBlock().Header.Height
+		addr, err := testPayAddr(&params, height, "unspent")
+		if err != nil {
+			t.Fatalf("unable to create address: %v", err)
+		}
+		addrs = append(addrs, addr)
+		coinbases[height] = block.Transactions()[0].Hash()
+		prev = block.MsgBlock()
+	}
+
+	// fetch returns the heights of the outputs matching the passed query
+	// and ensures the details of the outputs are those of the coinbases.
+	fetch := func(query *UnspentQuery) []uint32 {
+		outputs, err := FetchUnspentOutputs(context.Background(), chain,
+			&params, query)
+		if err != nil {
+			t.Fatalf("FetchUnspentOutputs: unexpected error: %v", err)
+		}
+		var heights []uint32
+		for _, output := range outputs {
+			height := output.BlockHeight
+			wantConf := int32(numBlocks - height + 1)
+			if output.OutPoint.Hash != *coinbases[height] ||
+				output.OutPoint.Index != 0 || !output.IsCoinBase ||
+				output.Confirmations != wantConf {
+
+				t.Fatalf("unexpected output %+v at height %d",
+					output, height)
+			}
+			if output.Address != addrs[height-1].EncodeAddress() {
+				t.Fatalf("got address %s at height %d, want %s",
+					output.Address, height, addrs[height-1])
+			}
+			heights = append(heights, height)
+		}
+		return heights
+	}
+	checkHeights := func(name string, got []uint32, want ...uint32) {
+		if len(got) != len(want) {
+			t.Fatalf("%s: got heights %v, want %v", name, got, want)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("%s: got heights %v, want %v", name, got,
+					want)
+			}
+		}
+	}
+
+	// All of the outputs are returned oldest first without a maximum
+	// number of confirmations, and only the queried addresses match.
+	checkHeights("all", fetch(&UnspentQuery{Addresses: addrs, MinConf: 1}),
+		1, 2, 3, 4, 5)
+	checkHeights("subset", fetch(&UnspentQuery{
+		Addresses: []provautil.Address{addrs[1], addrs[3]}}), 2, 4)
+
+	// The confirmation bounds are inclusive.  The tip has one
+	// confirmation.
+	checkHeights("bounds", fetch(&UnspentQuery{Addresses: addrs,
+		MinConf: 2, MaxConf: 4}), 2, 3, 4)
+	checkHeights("tip", fetch(&UnspentQuery{Addresses: addrs, MinConf: 1,
+		MaxConf: 1}), 5)
+	checkHeights("none", fetch(&UnspentQuery{Addresses: addrs,
+		MinConf: numBlocks + 1}))
+
+	// Excluded outputs are skipped.
+	excluded := wire.OutPoint{Hash: *coinbases[3], Index: 0}
+	checkHeights("exclude", fetch(&UnspentQuery{Addresses: addrs,
+		MinConf: 2, MaxConf: 4, Exclude: func(op *wire.OutPoint) bool {
+			return *op == excluded
+		}}), 2, 4)
+
+	// Outputs are found by the key IDs they include.  Only the outputs of
+	// the blocks are considered since the genesis block may pay to the
+	// same key IDs.
+	outputs, err := FetchUnspentOutputs(context.Background(), chain, &params,
+		&UnspentQuery{KeyIDs: []btcec.KeyID{2, 99}, MinConf: 1,
+			MaxConf: numBlocks})
+	if err != nil {
+		t.Fatalf("FetchUnspentOutputs: unexpected error: %v", err)
+	}
+	if len(outputs) != numBlocks {
+		t.Fatalf("got %d outputs by key ID, want %d", len(outputs),
+			numBlocks)
+	}
+	if outputs, _ := FetchUnspentOutputs(context.Background(), chain,
+		&params, &UnspentQuery{KeyIDs: []btcec.KeyID{99}}); len(outputs) != 0 {
+
+		t.Fatalf("got %d outputs for unknown key ID", len(outputs))
+	}
+
+	// Progress is reported for every transaction of the utxo set in hash
+	// order along with the outputs which matched so far.
+	var scanned []chainhash.Hash
+	var matched int
+	outputs, err = FetchUnspentOutputs(context.Background(), chain, &params,
+		&UnspentQuery{Addresses: addrs, MinConf: 1,
+			Progress: func(txHash *chainhash.Hash, outputs []UnspentOutput) {
+				scanned = append(scanned, *txHash)
+				matched = len(outputs)
+			}})
+	if err != nil {
+		t.Fatalf("FetchUnspentOutputs: unexpected error: %v", err)
+	}
+	if len(scanned) < numBlocks || matched != len(outputs) ||
+		matched != numBlocks {
+
+		t.Fatalf("got progress for %d transactions with %d matched "+
+			"outputs, want at least %d with %d", len(scanned),
+			matched, numBlocks, numBlocks)
+	}
+	for i := 1; i < len(scanned); i++ {
+		if bytes.Compare(scanned[i-1][:], scanned[i][:]) >= 0 {
+			t.Fatalf("progress reported out of hash order")
+		}
+	}
+
+	// The scan stops when the context is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = FetchUnspentOutputs(ctx, chain, &params,
+		&UnspentQuery{Addresses: addrs})
+	if err != context.Canceled {
+		t.Fatalf("FetchUnspentOutputs: got error %v, want %v", err,
+			context.Canceled)
+	}
+}
+
+// TestSelectUnspentOutputs ensures outputs are selected in order, or largest
+// first, until the target amount is reached.
+func TestSelectUnspentOutputs(t *testing.T) {
+	outputs := []UnspentOutput{
+		{OutPoint: wire.OutPoint{Index: 0}, Amount: 10, BlockHeight: 1},
+		{OutPoint: wire.OutPoint{Index: 1}, Amount: 50, BlockHeight: 2},
+		{OutPoint: wire.OutPoint{Index: 2}, Amount: 20, BlockHeight: 3},
+		{OutPoint: wire.OutPoint{Index: 3}, Amount: 40, BlockHeight: 4},
+		{OutPoint: wire.OutPoint{Index: 4}, Amount: 40, BlockHeight: 5},
+	}
+
+	tests := []struct {
+		name         string
+		target       int64
+		largestFirst bool
+		indexes      []uint32
+		total        int64
+		sufficient   bool
+	}{
+		{"in order", 60, false, []uint32{0, 1}, 60, true},
+		{"in order exceeding", 61, false, []uint32{0, 1, 2}, 80, true},
+		{"largest first", 60, true, []uint32{1, 3}, 90, true},
+		{"largest first exact", 50, true, []uint32{1}, 50, true},
+		{"largest first ties", 130, true, []uint32{1, 3, 4}, 130, true},
+		{"insufficient", 161, false, []uint32{0, 1, 2, 3, 4}, 160, false},
+	}
+	for _, test := range tests {
+		selected, total, sufficient := SelectUnspentOutputs(outputs,
+			test.target, test.largestFirst)
+		if total != test.total || sufficient != test.sufficient ||
+			len(selected) != len(test.indexes) {
+
+			t.Errorf("%s: got %d outputs totaling %d (sufficient %v), "+
+				"want %d totaling %d (sufficient %v)", test.name,
+				len(selected), total, sufficient,
+				len(test.indexes), test.total, test.sufficient)
+			continue
+		}
+		for i, output := range selected {
+			if output.OutPoint.Index != test.indexes[i] {
+				t.Errorf("%s: got output %d at position %d, "+
+					"want %d", test.name,
+					output.OutPoint.Index, i,
+					test.indexes[i])
+			}
+		}
+	}
+
+	// The passed outputs are not reordered.
+	for i, output := range outputs {
+		if output.OutPoint.Index != uint32(i) {
+			t.Fatalf("SelectUnspentOutputs reordered the passed " +
+				"outputs")
+		}
+	}
+}
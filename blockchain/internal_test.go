@@ -14,7 +14,11 @@ run.
 package blockchain
 
 import (
+	"encoding/binary"
 	"sort"
+
+	"github.com/bitgo/prova/blockchain/adminstate"
+	"github.com/bitgo/prova/database"
 )
 
 // TstSetCoinbaseMaturity makes the ability to set the coinbase maturity
@@ -29,16 +33,258 @@ func TstTimeSorter(times []int64) sort.Interface {
 	return timeSorter(times)
 }
 
-// TstSetMaxMedianTimeEntries makes the ability to set the maximum number of
-// median time entries available to the test package.
-func TstSetMaxMedianTimeEntries(val int) {
-	maxMedianTimeEntries = val
+// TstNewMedianTime makes the ability to create a median time source with a
+// custom maximum number of entries available to the test package.
+func TstNewMedianTime(maxEntries int) MedianTimeSource {
+	return newMedianTime(maxEntries)
 }
 
+// TstCancelCheckInterval makes the number of items processed between checks
+// for cancellation available to the test package.
+const TstCancelCheckInterval = cancelCheckInterval
+
 // TstCheckBlockScripts makes the internal checkBlockScripts function available
 // to the test package.
 var TstCheckBlockScripts = checkBlockScripts
 
-// TstDeserializeUtxoEntry makes the internal deserializeUtxoEntry function
-// available to the test package.
-var TstDeserializeUtxoEntry = deserializeUtxoEntry
+// TstDeserializeUtxoEntry makes the internal deserializeUtxoEntryV1 function
+// available to the test package since the utxo sets in the test data were
+// serialized by version 1 of the chain state.
+var TstDeserializeUtxoEntry = deserializeUtxoEntryV1
+
+// TstChainStateVersion returns the version of the serialization of the chain
+// state stored in the passed database.
+func TstChainStateVersion(db database.DB) (uint32, error) {
+	var version uint32
+	err := db.View(func(dbTx database.Tx) error {
+		var err error
+		version, err = dbFetchChainStateVersion(dbTx)
+		return err
+	})
+	return version, err
+}
+
+// TstChainStateEntries returns the entries of the utxo set and the spend
+// journal stored in the passed database keyed by their bucket and key.
+func TstChainStateEntries(db database.DB) (map[string][]byte, error) {
+	entries := make(map[string][]byte)
+	err := db.View(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		for _, name := range [][]byte{utxoSetBucketName,
+			spendJournalBucketName} {
+
+			err := meta.Bucket(name).ForEach(func(k, v []byte) error {
+				key := string(name) + "/" + string(k)
+				entries[key] = append([]byte(nil), v...)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// compressedTxOutsV1 converts the passed number of txouts at the start of the
+// passed serialized data from the script compression of the current version
+// of the chain state to the one of version 1, and returns them along with the
+// number of bytes they occupied.
+func compressedTxOutsV1(serialized []byte, numTxOuts int) ([]byte, int, error) {
+	var converted []byte
+	offset := 0
+	for i := 0; i < numTxOuts; i++ {
+		compAmount, compScript, bytesRead, err := decodeCompressedTxOut(
+			serialized[offset:], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += bytesRead
+
+		amount := make([]byte, serializeSizeVLQ(compAmount))
+		putVLQ(amount, compAmount)
+		converted = append(converted, amount...)
+
+		// Special scripts which version 1 recognized are compressed the
+		// same way while all other scripts are stored as is.
+		scriptType, _ := deserializeVLQ(compScript)
+		if scriptType < numSpecialScriptsV1 {
+			converted = append(converted, compScript...)
+			continue
+		}
+		pkScript := decompressScript(compScript, 0)
+		scriptSize := uint64(len(pkScript)) + numSpecialScriptsV1
+		size := make([]byte, serializeSizeVLQ(scriptSize))
+		putVLQ(size, scriptSize)
+		converted = append(converted, size...)
+		converted = append(converted, pkScript...)
+	}
+	return converted, offset, nil
+}
+
+// downgradeUtxoEntryV1 converts the passed serialized utxo entry to the
+// serialization of version 1 of the chain state.
+func downgradeUtxoEntryV1(serialized []byte) ([]byte, error) {
+	entry, err := deserializeUtxoEntry(serialized)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the compressed txouts which follow the header and unspentness
+	// bitmap change, so locate them.
+	var highIndex uint32
+	numTxOuts := 0
+	for outputIndex, out := range entry.sparseOutputs {
+		if out.spent {
+			continue
+		}
+		numTxOuts++
+		if outputIndex > highIndex {
+			highIndex = outputIndex
+		}
+	}
+	headerCode, numBitmapBytes, err := utxoEntryHeaderCode(entry, highIndex)
+	if err != nil {
+		return nil, err
+	}
+	offset := serializeSizeVLQ(uint64(entry.version)) +
+		serializeSizeVLQ(uint64(entry.blockHeight)) +
+		serializeSizeVLQ(headerCode) + numBitmapBytes
+
+	txOuts, bytesRead, err := compressedTxOutsV1(serialized[offset:],
+		numTxOuts)
+	if err != nil {
+		return nil, err
+	}
+	downgraded := append([]byte(nil), serialized[:offset]...)
+	downgraded = append(downgraded, txOuts...)
+	return append(downgraded, serialized[offset+bytesRead:]...), nil
+}
+
+// downgradeSpendJournalEntryV1 converts the passed serialized spend journal
+// entry to the serialization of version 1 of the chain state.
+func downgradeSpendJournalEntryV1(serialized []byte) ([]byte, error) {
+	var downgraded []byte
+	for offset := 0; offset < len(serialized); {
+		start := offset
+		code, bytesRead := deserializeVLQ(serialized[offset:])
+		offset += bytesRead
+		if code != 0 {
+			_, bytesRead := deserializeVLQ(serialized[offset:])
+			offset += bytesRead
+		}
+		downgraded = append(downgraded, serialized[start:offset]...)
+
+		txOut, bytesRead, err := compressedTxOutsV1(serialized[offset:], 1)
+		if err != nil {
+			return nil, err
+		}
+		offset += bytesRead
+		downgraded = append(downgraded, txOut...)
+	}
+	return downgraded, nil
+}
+
+// TstDowngradeChainStateV1 converts the utxo set and spend journal stored in
+// the passed database to the serialization of version 1 of the chain state,
+// removes the snapshots of the admin state, which version 3 added, the
+// issuance and destruction counts of the best chain state, which version 4
+// added, the keys of the revoked keyIDs, which version 5 added, and removes
+// the version, as the chain states created before the version was stored did
+// not have it.
+func TstDowngradeChainStateV1(db database.DB) error {
+	return db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		buckets := []struct {
+			name      []byte
+			downgrade func([]byte) ([]byte, error)
+		}{
+			{utxoSetBucketName, downgradeUtxoEntryV1},
+			{spendJournalBucketName, downgradeSpendJournalEntryV1},
+		}
+		for _, b := range buckets {
+			bucket := meta.Bucket(b.name)
+			downgraded := make(map[string][]byte)
+			err := bucket.ForEach(func(k, v []byte) error {
+				if len(v) == 0 {
+					return nil
+				}
+				serialized, err := b.downgrade(v)
+				if err != nil {
+					return err
+				}
+				downgraded[string(k)] = serialized
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for k, v := range downgraded {
+				if err := bucket.Put([]byte(k), v); err != nil {
+					return err
+				}
+			}
+		}
+		if err := meta.DeleteBucket(adminSnapshotBucketName); err != nil {
+			return err
+		}
+		state, err := adminstate.Deserialize(meta.Get(keySetBucketName))
+		if err != nil {
+			return err
+		}
+		state.RevokedKeys = nil
+		if err := meta.Put(keySetBucketName, state.Serialize()); err != nil {
+			return err
+		}
+		serialized := meta.Get(chainStateKeyName)
+		err = meta.Put(chainStateKeyName, append([]byte(nil),
+			serialized[:len(serialized)-16]...))
+		if err != nil {
+			return err
+		}
+		return meta.Delete(chainStateVersionKeyName)
+	})
+}
+
+// TstSetAdminSnapshotInterval sets the number of blocks between the snapshots
+// of the admin state and returns the previous one.
+func TstSetAdminSnapshotInterval(interval uint32) uint32 {
+	prev := adminSnapshotInterval
+	adminSnapshotInterval = interval
+	return prev
+}
+
+// TstAdminSnapshots returns the serialized snapshots of the admin state stored
+// in the passed database keyed by their height.
+func TstAdminSnapshots(db database.DB) (map[uint32][]byte, error) {
+	snapshots := make(map[uint32][]byte)
+	err := db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(adminSnapshotBucketName)
+		return bucket.ForEach(func(k, v []byte) error {
+			height := binary.BigEndian.Uint32(k)
+			snapshots[height] = append([]byte(nil), v...)
+			return nil
+		})
+	})
+	return snapshots, err
+}
+
+// TstUnmappedRejectCodes returns the error codes which have a name but no
+// explicit reject code mapping, which must be none.
+func TstUnmappedRejectCodes() []ErrorCode {
+	var unmapped []ErrorCode
+	for code := range errorCodeStrings {
+		if _, ok := errorCodeRejectCodes[code]; !ok {
+			unmapped = append(unmapped, code)
+		}
+	}
+	return unmapped
+}
+
+// TstLockChain acquires the chain state lock for writes, like processing a
+// block does, and returns the function which releases it.
+func (b *BlockChain) TstLockChain() func() {
+	b.chainLock.Lock()
+	return b.chainLock.Unlock
+}
@@ -0,0 +1,434 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// invalidBlockBucketName is the name of the db bucket used to house the hashes
+// of the blocks which were marked invalid with InvalidateBlock.  The values are
+// empty.
+var invalidBlockBucketName = []byte("invalidblocks")
+
+// loadInvalidBlocks loads the blocks which were marked invalid from the
+// database.
+func (b *BlockChain) loadInvalidBlocks() error {
+	return b.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(invalidBlockBucketName)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			if len(k) != chainhash.HashSize {
+				return database.Error{
+					ErrorCode:   database.ErrCorruption,
+					Description: "corrupt invalid block entry",
+				}
+			}
+			var hash chainhash.Hash
+			copy(hash[:], k)
+			b.invalidBlocks[hash] = struct{}{}
+			return nil
+		})
+	})
+}
+
+// isInvalidChain returns whether the passed node, which may be nil, was marked
+// invalid or descends from a block which was, as far as its side chain goes.
+// The blocks in the passed set, which may be nil, are treated as marked
+// invalid as well.  The blocks of the main chain are never marked invalid.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) isInvalidChain(node *blockNode, failed map[chainhash.Hash]struct{}) bool {
+	if len(b.invalidBlocks) == 0 && len(failed) == 0 {
+		return false
+	}
+
+	// The hash is checked before the main chain flag since side chain
+	// blocks which are loaded from the database are flagged as main chain
+	// blocks.
+	for n := node; n != nil; n = n.parent {
+		if _, ok := b.invalidBlocks[*n.hash]; ok {
+			return true
+		}
+		if _, ok := failed[*n.hash]; ok {
+			return true
+		}
+		if n.inMainChain {
+			return false
+		}
+	}
+	return false
+}
+
+// indexNode returns the node of the stored block with the passed hash from the
+// memory block index.  When it isn't in memory yet, it is loaded along with its
+// ancestors back to the first one which either is in memory or is part of the
+// main chain.  Descendants of the block which are not in memory are not
+// loaded.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) indexNode(hash *chainhash.Hash) (*blockNode, error) {
+	if node, ok := b.index[*hash]; ok {
+		return node, nil
+	}
+
+	// Collect the headers of the side chain blocks which are not in memory
+	// yet, down to the block they fork from.
+	var headers []*wire.BlockHeader
+	var parent *blockNode
+	var forkHeight uint32
+	err := b.db.View(func(dbTx database.Tx) error {
+		for h := hash; ; {
+			if node, ok := b.index[*h]; ok {
+				parent = node
+				return nil
+			}
+			if dbMainChainHasBlock(dbTx, h) {
+				var err error
+				forkHeight, err = dbFetchHeightByHash(dbTx, h)
+				return err
+			}
+			header, err := dbFetchHeaderByHash(dbTx, h)
+			if err != nil {
+				return err
+			}
+			headers = append(headers, header)
+			h = &header.PrevBlock
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Main chain blocks are loaded by walking back from the best block so
+	// the memory main chain remains connected.
+	if parent == nil {
+		parent, err = b.relativeNode(b.bestNode,
+			b.bestNode.height-forkHeight)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b.indexLock.Lock()
+	defer b.indexLock.Unlock()
+	for i := len(headers) - 1; i >= 0; i-- {
+		hash := headers[i].BlockHash()
+		node := newBlockNode(headers[i], &hash)
+		node.parent = parent
+		node.workSum.Add(parent.workSum, node.workSum)
+		parent.children = append(parent.children, node)
+		b.index[hash] = node
+		parent = node
+	}
+	return parent, nil
+}
+
+// isBetterChain returns whether the chain ending at the passed node has more
+// work than the one ending at the other node, or the same work while its end
+// was received first.
+func isBetterChain(node, other *blockNode) bool {
+	if cmp := node.workSum.Cmp(other.workSum); cmp != 0 {
+		return cmp > 0
+	}
+	return node.received < other.received
+}
+
+// bestValidCandidate returns the end of the best side chain in the memory
+// block index which is better than the main chain and doesn't descend from a
+// block which was marked invalid or is in the passed set of blocks that failed
+// to connect.  Nil is returned when the main chain is the best valid chain.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) bestValidCandidate(failed map[chainhash.Hash]struct{}) *blockNode {
+	var candidate *blockNode
+	for _, node := range b.index {
+		if node.inMainChain || !isBetterChain(node, b.bestNode) {
+			continue
+		}
+		if candidate != nil && !isBetterChain(node, candidate) {
+			continue
+		}
+		if b.isInvalidChain(node, failed) {
+			continue
+		}
+		candidate = node
+	}
+	return candidate
+}
+
+// extendBestChain connects the blocks of the passed side chain nodes, which
+// extend the end of the main chain, to the main chain one after another.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) extendBestChain(attachNodes *list.List) error {
+	for e := attachNodes.Front(); e != nil; e = e.Next() {
+		n := e.Value.(*blockNode)
+		var block *provautil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByHash(dbTx,
+				b.chainParams, n.hash)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		block.SetHeight(n.height)
+
+		// The node is linked to its parent again once it is connected.
+		b.indexLock.Lock()
+		n.parent.children = removeChildNode(n.parent.children, n)
+		b.indexLock.Unlock()
+		_, err = b.connectBestChain(n, block, BFNone)
+		if err != nil {
+			b.indexLock.Lock()
+			n.parent.children = append(n.parent.children, n)
+			b.indexLock.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// activateBestValidChain makes the best valid chain in the memory block index
+// the main chain, which is needed after the main chain was cut back to before
+// an invalidated block or after a block was reconsidered.  Side chains which
+// turn out to break a consensus rule while they are connected are skipped in
+// favor of the next best one.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) activateBestValidChain() error {
+	failed := make(map[chainhash.Hash]struct{})
+	for {
+		node := b.bestValidCandidate(failed)
+		if node == nil {
+			return nil
+		}
+
+		detachNodes, attachNodes := b.getReorganizeNodes(node)
+		var err error
+		if detachNodes.Len() == 0 {
+			err = b.extendBestChain(attachNodes)
+		} else {
+			log.Infof("REORGANIZE: Block %v is the end of the best "+
+				"valid chain", node.hash)
+			err = b.reorganizeChain(detachNodes, attachNodes, BFNone)
+		}
+		if _, ok := err.(RuleError); ok {
+			log.Warnf("Unable to make block %v the end of the main "+
+				"chain: %v", node.hash, err)
+			failed[*node.hash] = struct{}{}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// disconnectBlocksFrom disconnects the blocks of the main chain from the best
+// block down to and including the block of the passed node, which must be
+// part of the main chain.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) disconnectBlocksFrom(node *blockNode) error {
+	numDetach := int(b.bestNode.height-node.height) + 1
+	if err := b.checkReorgDepth(numDetach); err != nil {
+		return err
+	}
+	for b.bestNode.height >= node.height {
+		tip := b.bestNode
+		if err := b.recoverDisconnectBlock(tip); err != nil {
+			return err
+		}
+		log.Infof("Disconnected block %v (height %d) of the invalidated "+
+			"chain", tip.hash, tip.height)
+	}
+	return nil
+}
+
+// enforceInvalidBlocks disconnects the lowest block of the main chain which
+// was marked invalid along with its descendants, and makes the best valid
+// chain the main chain.  The main chain only contains such a block when
+// InvalidateBlock was interrupted.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) enforceInvalidBlocks() error {
+	var lowest *chainhash.Hash
+	var lowestHeight uint32
+	err := b.db.View(func(dbTx database.Tx) error {
+		for hash := range b.invalidBlocks {
+			hash := hash
+			if !dbMainChainHasBlock(dbTx, &hash) {
+				continue
+			}
+			height, err := dbFetchHeightByHash(dbTx, &hash)
+			if err != nil {
+				return err
+			}
+			if lowest == nil || height < lowestHeight {
+				lowest, lowestHeight = &hash, height
+			}
+		}
+		return nil
+	})
+	if err != nil || lowest == nil {
+		return err
+	}
+
+	log.Warnf("The main chain contains block %v (height %d) which was "+
+		"marked invalid", lowest, lowestHeight)
+	if b.readOnly {
+		log.Warnf("Unable to disconnect the invalidated block in " +
+			"read-only mode")
+		return nil
+	}
+	node, err := b.indexNode(lowest)
+	if err != nil {
+		return err
+	}
+	if err := b.disconnectBlocksFrom(node); err != nil {
+		return err
+	}
+	return b.activateBestValidChain()
+}
+
+// checkInvalidateBlock returns an error when the marker of the block with the
+// passed hash can't be changed, which is the case for unknown blocks and the
+// genesis block, and when the chain is read-only.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) checkInvalidateBlock(hash *chainhash.Hash) error {
+	if b.readOnly {
+		return database.Error{
+			ErrorCode:   database.ErrDbReadOnly,
+			Description: "block chain is read-only",
+		}
+	}
+	if hash.IsEqual(b.chainParams.GenesisHash) {
+		return errors.New("the genesis block can't be invalidated")
+	}
+	if _, ok := b.index[*hash]; ok {
+		return nil
+	}
+	var exists bool
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		exists, err = dbTx.HasBlock(hash)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("block %v is not known", hash)
+	}
+	return nil
+}
+
+// InvalidateBlock marks the block with the passed hash, along with all of its
+// descendants, invalid regardless of whether it follows the consensus rules,
+// such as to force the node off a block signed with a validate key which had
+// to be revoked.  When the block is part of the main chain, it is disconnected
+// along with the blocks after it, and the best valid chain becomes the main
+// chain.  Side chains are only considered when they are in the memory block
+// index.  The marker is stored in the database, so the block remains invalid
+// after a restart until it is reconsidered with ReconsiderBlock.  Blocks which
+// descend from the block are still accepted as side chain blocks, but they
+// never become part of the main chain, and orphans which turn out to descend
+// from it are dropped.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) InvalidateBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if err := b.checkInvalidateBlock(hash); err != nil {
+		return err
+	}
+	node, err := b.indexNode(hash)
+	if err != nil {
+		return err
+	}
+
+	var onMainChain bool
+	err = b.db.Update(func(dbTx database.Tx) error {
+		// Blocks deeper than the prune depth can't be disconnected, so
+		// they aren't marked either.
+		onMainChain = dbMainChainHasBlock(dbTx, hash)
+		if onMainChain {
+			numDetach := int(b.bestNode.height-node.height) + 1
+			if err := b.checkReorgDepth(numDetach); err != nil {
+				return err
+			}
+		}
+		bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+			invalidBlockBucketName)
+		if err != nil {
+			return err
+		}
+		key := make([]byte, chainhash.HashSize)
+		copy(key, hash[:])
+		return bucket.Put(key, []byte{})
+	})
+	if err != nil {
+		return err
+	}
+	b.invalidBlocks[*hash] = struct{}{}
+	log.Infof("Marked block %v (height %d) invalid", hash, node.height)
+
+	if onMainChain {
+		if err := b.disconnectBlocksFrom(node); err != nil {
+			return err
+		}
+	}
+	return b.activateBestValidChain()
+}
+
+// ReconsiderBlock removes the marker which InvalidateBlock put on the block
+// with the passed hash, and makes the best valid chain the main chain, which
+// may be the chain of the block again.  Other blocks of the chain which were
+// marked invalid remain so.  Only the descendants of the block which are in
+// the memory block index are considered, so after a restart the chain can only
+// move to the block itself until its descendants are seen again.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReconsiderBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if err := b.checkInvalidateBlock(hash); err != nil {
+		return err
+	}
+	err := b.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(invalidBlockBucketName)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete(hash[:])
+	})
+	if err != nil {
+		return err
+	}
+	if _, ok := b.invalidBlocks[*hash]; ok {
+		delete(b.invalidBlocks, *hash)
+		log.Infof("Reconsidering block %v", hash)
+	}
+
+	if _, err := b.indexNode(hash); err != nil {
+		return err
+	}
+	return b.activateBestValidChain()
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+)
+
+// TestInvalidateBlock ensures invalidating the end of the main chain moves it
+// to a competing fork, that reconsidering the block moves it back, that blocks
+// and orphans which descend from an invalidated block are not connected, and
+// that the marker survives a restart.
+func TestInvalidateBlock(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+
+	db, teardown := testChainDB(t, "invalidateblock", &params)
+	defer teardown()
+
+	// The chain forks after the first block into fork a, which is received
+	// first, and fork b with the same work.
+	c1 := forkBlock(t, &params, params.GenesisBlock, 'c')
+	a2 := forkBlock(t, &params, c1.MsgBlock(), 'a')
+	a3 := forkBlock(t, &params, a2.MsgBlock(), 'a')
+	a4 := forkBlock(t, &params, a3.MsgBlock(), 'a')
+	a5 := forkBlock(t, &params, a4.MsgBlock(), 'a')
+	b2 := forkBlock(t, &params, c1.MsgBlock(), 'b')
+	b3 := forkBlock(t, &params, b2.MsgBlock(), 'b')
+
+	process := func(chain *blockchain.BlockChain, block *provautil.Block,
+		wantMainChain, wantOrphan bool) {
+
+		isMainChain, isOrphan, err := chain.ProcessBlock(block,
+			blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock(%v): %v", block.Hash(), err)
+		}
+		if isMainChain != wantMainChain || isOrphan != wantOrphan {
+			t.Fatalf("ProcessBlock(%v): got main chain %v, orphan "+
+				"%v, want %v, %v", block.Hash(), isMainChain,
+				isOrphan, wantMainChain, wantOrphan)
+		}
+	}
+	checkBest := func(desc string, chain *blockchain.BlockChain, want *provautil.Block) {
+		best := chain.BestSnapshot()
+		if !best.Hash.IsEqual(want.Hash()) {
+			t.Fatalf("%s: got best block %v (height %d), want %v "+
+				"(height %d)", desc, best.Hash, best.Height,
+				want.Hash(), want.MsgBlock().Header.Height)
+		}
+	}
+
+	chain := newTestChain(t, db, &params, nil)
+	process(chain, c1, true, false)
+	process(chain, a2, true, false)
+	process(chain, a3, true, false)
+	process(chain, b2, false, false)
+	process(chain, b3, false, false)
+	checkBest("before invalidating", chain, a3)
+
+	// Invalidating the end of the main chain moves it to the other fork,
+	// and reconsidering it moves it back since it was received first.
+	if err := chain.InvalidateBlock(a3.Hash()); err != nil {
+		t.Fatalf("InvalidateBlock: %v", err)
+	}
+	checkBest("invalidated", chain, b3)
+	if ok, _ := chain.MainChainHasBlock(a2.Hash()); ok {
+		t.Fatalf("block %v of the invalidated fork is still part of "+
+			"the main chain", a2.Hash())
+	}
+	if err := chain.ReconsiderBlock(a3.Hash()); err != nil {
+		t.Fatalf("ReconsiderBlock: %v", err)
+	}
+	checkBest("reconsidered", chain, a3)
+
+	// Blocks and orphans which descend from an invalidated block are not
+	// connected, even when their chain has more work.
+	if err := chain.InvalidateBlock(a3.Hash()); err != nil {
+		t.Fatalf("InvalidateBlock: %v", err)
+	}
+	checkBest("invalidated again", chain, b3)
+	process(chain, a5, false, true)
+	process(chain, a4, false, false)
+	checkBest("extended invalidated fork", chain, b3)
+	if ok, _ := chain.HaveBlock(a5.Hash()); ok {
+		t.Fatalf("orphan %v which descends from an invalidated block "+
+			"was kept", a5.Hash())
+	}
+
+	// The marker survives a restart, so reconsidering a descendant of the
+	// invalidated block doesn't move the main chain until the block itself
+	// is reconsidered.
+	chain = newTestChain(t, db, &params, nil)
+	checkBest("restarted", chain, b3)
+	if err := chain.ReconsiderBlock(a4.Hash()); err != nil {
+		t.Fatalf("ReconsiderBlock: %v", err)
+	}
+	checkBest("reconsidered descendant", chain, b3)
+	if err := chain.ReconsiderBlock(a3.Hash()); err != nil {
+		t.Fatalf("ReconsiderBlock: %v", err)
+	}
+	checkBest("reconsidered after restart", chain, a4)
+
+	// The genesis block and unknown blocks can't be invalidated.
+	if err := chain.InvalidateBlock(params.GenesisHash); err == nil {
+		t.Fatalf("InvalidateBlock of the genesis block succeeded")
+	}
+	if err := chain.InvalidateBlock(&chainhash.Hash{1}); err == nil {
+		t.Fatalf("InvalidateBlock of an unknown block succeeded")
+	}
+	checkBest("rejected invalidations", chain, a4)
+}
@@ -6,10 +6,9 @@
 package blockchain
 
 import (
-	"bytes"
+	"github.com/bitgo/prova/blockchain/adminstate"
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/provautil"
-	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
 )
 
@@ -17,16 +16,12 @@ import (
 // point of view in the chain. For example, it could be for the end of the main
 // chain, some point in the history of the main chain, or down a side chain.
 type KeyViewpoint struct {
-	threadTips   map[provautil.ThreadID]*wire.OutPoint
-	lastKeyID    btcec.KeyID
-	totalSupply  uint64
-	adminKeySets map[btcec.KeySetType]btcec.PublicKeySet
-	aspKeyIdMap  btcec.KeyIdMap
+	state adminstate.State
 }
 
 // ThreadTips returns
 func (view *KeyViewpoint) ThreadTips() map[provautil.ThreadID]*wire.OutPoint {
-	return view.threadTips
+	return view.state.ThreadTips
 }
 
 // SetThreadTips sets the tips of the admin threads.
@@ -34,142 +29,94 @@ func (view *KeyViewpoint) ThreadTips() map[provautil.ThreadID]*wire.OutPoint {
 // source data structures.
 func (view *KeyViewpoint) SetThreadTips(
 	threadTips map[provautil.ThreadID]*wire.OutPoint) {
-	view.threadTips = provautil.CopyThreadTips(threadTips)
+	view.state.ThreadTips = provautil.CopyThreadTips(threadTips)
 }
 
 // LastKeyID
 func (view *KeyViewpoint) LastKeyID() btcec.KeyID {
-	return view.lastKeyID
+	return view.state.LastKeyID
 }
 
 // SetLastKeyID
 func (view *KeyViewpoint) SetLastKeyID(lastKeyID btcec.KeyID) {
-	view.lastKeyID = lastKeyID
+	view.state.LastKeyID = lastKeyID
 }
 
 // TotalSupply
 func (view *KeyViewpoint) TotalSupply() uint64 {
-	return view.totalSupply
+	return view.state.TotalSupply
 }
 
 // SetTotalSupply
 func (view *KeyViewpoint) SetTotalSupply(totalSupply uint64) {
-	view.totalSupply = totalSupply
+	view.state.TotalSupply = totalSupply
 }
 
 // SetKeys sets the admin key sets at the position in the chain the view
 // curretly represents.
 func (view *KeyViewpoint) SetKeys(keys map[btcec.KeySetType]btcec.PublicKeySet) {
 	if keys != nil {
-		view.adminKeySets = btcec.DeepCopy(keys)
+		view.state.KeySets = btcec.DeepCopy(keys)
 	}
 }
 
 // Keys returns the set current admin key sets.
 func (view *KeyViewpoint) Keys() map[btcec.KeySetType]btcec.PublicKeySet {
-	return view.adminKeySets
+	return view.state.KeySets
 }
 
 // GetAdminKeyHashes returns pubKeyHashes according to the provided threadID.
 func (view *KeyViewpoint) GetAdminKeyHashes(threadID provautil.ThreadID) [][]byte {
-	pubs := view.adminKeySets[btcec.KeySetType(threadID)]
-	hashes := make([][]byte, len(pubs))
-	for i, pubKey := range pubs {
-		hashes[i] = provautil.Hash160(pubKey.SerializeCompressed())
-	}
-	return hashes
+	return view.state.AdminKeyHashes(threadID)
 }
 
 // SetKeyIDs sets the mapping of keyIDs to ASP keys.
 func (view *KeyViewpoint) SetKeyIDs(aspKeyIdMap btcec.KeyIdMap) {
 	if aspKeyIdMap != nil {
-		view.aspKeyIdMap = aspKeyIdMap.DeepCopy()
+		view.state.KeyIDs = aspKeyIdMap.DeepCopy()
 	}
 }
 
 // KeyIDs returns a mapping of keyIDs to ASP keys at the position in the chain
 // the view currently represents.
 func (view *KeyViewpoint) KeyIDs() btcec.KeyIdMap {
-	return view.aspKeyIdMap
+	return view.state.KeyIDs
+}
+
+// SetRevokedKeys sets the ASP keys of the keyIDs which have been revoked.
+func (view *KeyViewpoint) SetRevokedKeys(revokedKeys map[btcec.KeyID]adminstate.RevokedKey) {
+	view.state.RevokedKeys = adminstate.CopyRevokedKeys(revokedKeys)
+}
+
+// RevokedKeys returns the ASP keys of the keyIDs which have been revoked at the
+// position in the chain the view currently represents.
+func (view *KeyViewpoint) RevokedKeys() map[btcec.KeyID]adminstate.RevokedKey {
+	return view.state.RevokedKeys
+}
+
+// AdminState returns a copy of the admin state at the position in the chain
+// the view currently represents.
+func (view *KeyViewpoint) AdminState() *adminstate.State {
+	return view.state.Copy()
+}
+
+// SetAdminState sets the admin state of the view.
+// The passed reference is deep copied, so modification does not affect
+// source data structures.
+func (view *KeyViewpoint) SetAdminState(state *adminstate.State) {
+	view.state = *state.Copy()
 }
 
 // LookupKeyIDs returns pubKeyHashes for all registered KeyIDs
 func (view *KeyViewpoint) LookupKeyIDs(keyIDs []btcec.KeyID) map[btcec.KeyID][]byte {
-	keyIdMap := make(map[btcec.KeyID][]byte)
-	for _, keyID := range keyIDs {
-		pubKey := view.aspKeyIdMap[keyID]
-		if pubKey != nil {
-			keyIdMap[keyID] = provautil.Hash160(pubKey.SerializeCompressed())
-		} else {
-			keyIdMap[keyID] = bytes.Repeat([]byte{0x00}, 20)
-		}
-	}
-	return keyIdMap
+	return view.state.LookupKeyIDs(keyIDs)
 }
 
 // ProcessAdminOuts finds admin transactions and executes all ops in it.
 // This function is called after the validity of the transaction has been
 // verified.
 func (view *KeyViewpoint) ProcessAdminOuts(tx *provautil.Tx, blockHeight uint32) {
-	threadInt, adminOutputs := txscript.GetAdminDetails(tx)
-	if threadInt < 0 {
-		// not admin transaction
-		return // so we skip.
-	}
-	if provautil.ThreadID(threadInt) == provautil.IssueThread {
-		isDestruction := len(tx.MsgTx().TxIn) > 1
-		if isDestruction {
-			// if this is a destruction operation
-			// look over all non-prova outputs and sum them up.
-			for i := 0; i < len(adminOutputs); i++ {
-				// if this output pk script is a NullDataTy, then,
-				// according to previous validation, it must be
-				// admin operation (destruction)
-				scriptType := txscript.TypeOfScript(adminOutputs[i])
-				if scriptType == txscript.NullDataTy {
-					view.totalSupply -= uint64(tx.MsgTx().TxOut[i+1].Value)
-				}
-			}
-		} else {
-			// if it is an issuance operation, look over all but first
-			// output and sum up values.
-			// remember that a issuing transaction is not allow to also
-			// destroy, as to previous validation.
-			for i := 1; i < len(tx.MsgTx().TxOut); i++ {
-				view.totalSupply += uint64(tx.MsgTx().TxOut[i].Value)
-			}
-		}
-		view.threadTips[provautil.IssueThread] = wire.NewOutPoint(tx.Hash(), 0)
-		return
-	}
-	for i := 0; i < len(adminOutputs); i++ {
-		isAddOp, keySetType, pubKey,
-			keyID := txscript.ExtractAdminOpData(adminOutputs[i])
-		view.applyAdminOp(isAddOp, keySetType, pubKey, keyID)
-	}
-	// this becomes the new tip of the admin thread
-	threadId := provautil.ThreadID(threadInt)
-	view.threadTips[threadId] = wire.NewOutPoint(tx.Hash(), 0)
-}
-
-// applyAdminOp takes a single admin opp and applies it to the view.
-func (view *KeyViewpoint) applyAdminOp(isAddOp bool,
-	keySetType btcec.KeySetType, pubKey *btcec.PublicKey, keyID btcec.KeyID) {
-	if keySetType == btcec.ASPKeySet {
-		if isAddOp {
-			view.aspKeyIdMap[keyID] = pubKey
-			view.lastKeyID = keyID
-		} else {
-			delete(view.aspKeyIdMap, keyID)
-		}
-	} else {
-		if isAddOp {
-			view.adminKeySets[keySetType] = view.adminKeySets[keySetType].Add(pubKey)
-		} else {
-			pos := view.adminKeySets[keySetType].Pos(pubKey)
-			view.adminKeySets[keySetType] = view.adminKeySets[keySetType].Remove(pos)
-		}
-	}
+	view.state = *view.state.Next(tx)
 }
 
 // connectTransaction updates the view by processing all new admin operations in
@@ -196,53 +143,7 @@ func (view *KeyViewpoint) disconnectTransactions(block *provautil.Block) error {
 	// reverse order.
 	transactions := block.Transactions()
 	for txIdx := len(transactions) - 1; txIdx >= 0; txIdx-- {
-		tx := transactions[txIdx]
-
-		// If an admin transaction is disconnected, undo what it did to chain state.
-		threadInt, adminOutputs := txscript.GetAdminDetails(tx)
-		if threadInt >= int(provautil.RootThread) {
-			threadId := provautil.ThreadID(threadInt)
-			if threadId == provautil.IssueThread {
-				isDestruction := len(tx.MsgTx().TxIn) > 1
-				if isDestruction {
-					for i := 0; i < len(adminOutputs); i++ {
-						// if this output pk script is a NullDataTy, then,
-						// according to previous validation, it must be
-						// admin operation (destruction)
-						scriptType := txscript.TypeOfScript(adminOutputs[i])
-						if scriptType == txscript.NullDataTy {
-							view.totalSupply += uint64(tx.MsgTx().TxOut[i+1].Value)
-						}
-					}
-				} else {
-					for i := 1; i < len(tx.MsgTx().TxOut); i++ {
-						view.totalSupply -= uint64(tx.MsgTx().TxOut[i].Value)
-					}
-				}
-			} else {
-				for i := 0; i < len(adminOutputs); i++ {
-					isAddOp, keySetType, pubKey,
-						keyID := txscript.ExtractAdminOpData(adminOutputs[i])
-					if keySetType == btcec.ASPKeySet {
-						if isAddOp {
-							delete(view.aspKeyIdMap, keyID)
-							// decrease lastKeyID counter, if an Add OP is disconnected.
-							view.lastKeyID = keyID - 1
-						} else {
-							// do not increase lastKeyID if Revoke Op is disconnected.
-							// once used keyIds should stay used
-							view.aspKeyIdMap[keyID] = pubKey
-						}
-					} else {
-						// isAddOp is negatted, to revert the action
-						view.applyAdminOp(!isAddOp, keySetType, pubKey, keyID)
-					}
-				}
-			}
-			// when an admin thread transaction is disconnected
-			// we set the spent tx as new tip.
-			view.threadTips[threadId] = &tx.MsgTx().TxIn[0].PreviousOutPoint
-		}
+		view.state.DisconnectTransaction(transactions[txIdx])
 	}
 
 	return nil
@@ -251,10 +152,6 @@ func (view *KeyViewpoint) disconnectTransactions(block *provautil.Block) error {
 // NewKeyViewpoint returns a new empty key view.
 func NewKeyViewpoint() *KeyViewpoint {
 	return &KeyViewpoint{
-		threadTips:   make(map[provautil.ThreadID]*wire.OutPoint),
-		lastKeyID:    btcec.KeyID(0),
-		totalSupply:  uint64(0),
-		adminKeySets: make(map[btcec.KeySetType]btcec.PublicKeySet),
-		aspKeyIdMap:  make(map[btcec.KeyID]*btcec.PublicKey),
+		state: *adminstate.New(),
 	}
 }
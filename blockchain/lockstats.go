@@ -0,0 +1,87 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"sync"
+	"time"
+)
+
+// contendedLockWait is the amount of time past which waiting to acquire a lock
+// is counted as contention.  Shorter waits are the cost of acquiring a lock
+// nobody holds.
+const contendedLockWait = time.Microsecond * 50
+
+// LockStats houses contention statistics of a lock since the chain instance was
+// created.
+type LockStats struct {
+	// Acquisitions and SharedAcquisitions are the number of times the lock
+	// was acquired for writing and for reading respectively.
+	Acquisitions       uint64
+	SharedAcquisitions uint64
+
+	// Contended is the number of acquisitions, of either kind, which had
+	// to wait for the lock to be released.
+	Contended uint64
+
+	// TotalWait and MaxWait are the total and the longest amount of time
+	// spent waiting to acquire the lock.
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// statsRWMutex is a reader/writer mutual exclusion lock which keeps contention
+// statistics.  The statistics are protected by their own mutex, which is only
+// held briefly after the lock is acquired, so reading them never waits for the
+// lock itself.
+type statsRWMutex struct {
+	sync.RWMutex
+
+	statsMtx sync.Mutex
+	stats    LockStats
+}
+
+// record updates the statistics after the lock was acquired following the
+// passed wait.
+func (m *statsRWMutex) record(shared bool, wait time.Duration) {
+	m.statsMtx.Lock()
+	if shared {
+		m.stats.SharedAcquisitions++
+	} else {
+		m.stats.Acquisitions++
+	}
+	if wait > contendedLockWait {
+		m.stats.Contended++
+	}
+	m.stats.TotalWait += wait
+	if wait > m.stats.MaxWait {
+		m.stats.MaxWait = wait
+	}
+	m.statsMtx.Unlock()
+}
+
+// Lock locks the mutex for writing.
+func (m *statsRWMutex) Lock() {
+	start := time.Now()
+	m.RWMutex.Lock()
+	m.record(false, time.Since(start))
+}
+
+// RLock locks the mutex for reading.
+func (m *statsRWMutex) RLock() {
+	start := time.Now()
+	m.RWMutex.RLock()
+	m.record(true, time.Since(start))
+}
+
+// Stats returns a copy of the contention statistics of the mutex.
+//
+// This function is safe for concurrent access.
+func (m *statsRWMutex) Stats() LockStats {
+	m.statsMtx.Lock()
+	stats := m.stats
+	m.statsMtx.Unlock()
+	return stats
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLockStats ensures acquisitions of a lock are counted by kind, and that
+// waiting for the lock to be released is reported as contention.
+func TestLockStats(t *testing.T) {
+	var m statsRWMutex
+	m.RLock()
+	m.RUnlock()
+	if stats := m.Stats(); stats.SharedAcquisitions != 1 ||
+		stats.Acquisitions != 0 || stats.Contended != 0 {
+
+		t.Fatalf("unexpected stats of an uncontended lock: %+v", stats)
+	}
+
+	// Hold the lock for writing while a reader waits for it.
+	const hold = time.Millisecond * 20
+	m.Lock()
+	acquired := make(chan struct{})
+	go func() {
+		m.RLock()
+		m.RUnlock()
+		close(acquired)
+	}()
+	time.Sleep(hold)
+	m.Unlock()
+	<-acquired
+
+	stats := m.Stats()
+	if stats.Acquisitions != 1 || stats.SharedAcquisitions != 2 ||
+		stats.Contended != 1 {
+
+		t.Fatalf("unexpected acquisitions: %+v", stats)
+	}
+	if stats.MaxWait < hold/2 || stats.TotalWait < stats.MaxWait {
+		t.Fatalf("unexpected wait: %+v", stats)
+	}
+}
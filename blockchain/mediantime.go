@@ -22,12 +22,9 @@ const (
 	// local clock that is used to determine that it is likley wrong and
 	// hence to show a warning.
 	similarTimeSecs = 5 * 60 // 5 minutes
-)
 
-var (
 	// maxMedianTimeEntries is the maximum number of entries allowed in the
-	// median time data.  This is a variable as opposed to a constant so the
-	// test code can modify it.
+	// median time data.
 	maxMedianTimeEntries = 200
 )
 
@@ -72,13 +69,14 @@ func (s int64Sorter) Less(i, j int) bool {
 }
 
 // medianTime provides an implementation of the MedianTimeSource interface.
-// It is limited to maxMedianTimeEntries includes the same buggy behavior as
+// It is limited to maxEntries includes the same buggy behavior as
 // the time offset mechanism in Bitcoin Core.  This is necessary because it is
 // used in the consensus code.
 type medianTime struct {
 	mtx                sync.Mutex
 	knownIDs           map[string]struct{}
 	offsets            []int64
+	maxEntries         int
 	offsetSecs         int64
 	invalidTimeChecked bool
 }
@@ -122,7 +120,7 @@ func (m *medianTime) AddTimeSample(sourceID string, timeVal time.Time) {
 	now := time.Unix(time.Now().Unix(), 0)
 	offsetSecs := int64(timeVal.Sub(now).Seconds())
 	numOffsets := len(m.offsets)
-	if numOffsets == maxMedianTimeEntries && maxMedianTimeEntries > 0 {
+	if numOffsets == m.maxEntries && m.maxEntries > 0 {
 		m.offsets = m.offsets[1:]
 		numOffsets--
 	}
@@ -212,8 +210,15 @@ func (m *medianTime) Offset() time.Duration {
 // expects the time samples to be added from the timestamp field of the version
 // message received from remote peers that successfully connect and negotiate.
 func NewMedianTime() MedianTimeSource {
+	return newMedianTime(maxMedianTimeEntries)
+}
+
+// newMedianTime returns a new median time source which keeps at most the
+// passed number of time samples.
+func newMedianTime(maxEntries int) *medianTime {
 	return &medianTime{
-		knownIDs: make(map[string]struct{}),
-		offsets:  make([]int64, 0, maxMedianTimeEntries),
+		knownIDs:   make(map[string]struct{}),
+		offsets:    make([]int64, 0, maxEntries),
+		maxEntries: maxEntries,
 	}
 }
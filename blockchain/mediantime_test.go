@@ -55,12 +55,10 @@ func TestMedianTime(t *testing.T) {
 		{in: []int64{4201, 4202, 4203, 4204, -299}, wantOffset: 0},
 	}
 
-	// Modify the max number of allowed median time entries for these tests.
-	blockchain.TstSetMaxMedianTimeEntries(10)
-	defer blockchain.TstSetMaxMedianTimeEntries(200)
-
 	for i, test := range tests {
-		filter := blockchain.NewMedianTime()
+		// Limit the max number of allowed median time entries for these
+		// tests.
+		filter := blockchain.TstNewMedianTime(10)
 		for j, offset := range test.in {
 			id := strconv.Itoa(j)
 			now := time.Unix(time.Now().Unix(), 0)
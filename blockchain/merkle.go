@@ -110,3 +110,22 @@ func BuildMerkleTreeStore(transactions []*provautil.Tx) []*chainhash.Hash {
 
 	return merkles
 }
+
+// merkleBranch returns the hashes of the siblings of the nodes on the path from
+// the leaf at the passed index of the passed merkle tree store, as returned by
+// BuildMerkleTreeStore, to its root.  Nodes without a sibling are hashed with
+// themselves, so the node itself is returned as the sibling in that case.
+func merkleBranch(merkles []*chainhash.Hash, index int) []chainhash.Hash {
+	var branch []chainhash.Hash
+	offset := 0
+	for width := (len(merkles) + 1) / 2; width > 1; width /= 2 {
+		sibling := merkles[offset+(index^1)]
+		if sibling == nil {
+			sibling = merkles[offset+index]
+		}
+		branch = append(branch, *sibling)
+		offset += width
+		index /= 2
+	}
+	return branch
+}
@@ -0,0 +1,303 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+var (
+	// multiChainValidateKey is the private key of one of the validate keys
+	// in the regression test network parameters.
+	multiChainValidateKey, _ = btcec.PrivKeyFromBytes(btcec.S256(),
+		hexToBytes("4015289a228658047520f0d0abe7ad49abc77f6be0be63b36b94b83c2d1fd977"))
+
+	// multiChainRootKeys are the private keys of the root keys in the
+	// regression test network parameters.
+	multiChainRootKeys = func() []txscript.PrivateKey {
+		priv1, _ := btcec.PrivKeyFromBytes(btcec.S256(),
+			hexToBytes("eaf02ca348c524e6392655ba4d29603cd1a7347d9d65cfe93ce1ebffdca22694"))
+		priv2, _ := btcec.PrivKeyFromBytes(btcec.S256(),
+			hexToBytes("2b8c52b77b327c755b9b375500d3f4b2da9b0a1ff65f6891d311fe94295bc26a"))
+		return []txscript.PrivateKey{{priv1, true}, {priv2, true}}
+	}()
+)
+
+// multiChainCoinbase returns a coinbase transaction for the passed height that
+// pays to an address which is unique to the network of the passed parameters.
+func multiChainCoinbase(params *chaincfg.Params, height uint32) (*wire.MsgTx, error) {
+	coinbaseScript, err := txscript.NewScriptBuilder().
+		AddData([]byte("/prova/")).Script()
+	if err != nil {
+		return nil, err
+	}
+	pkHash := chainhash.HashB([]byte(fmt.Sprintf("%s-%d", params.Name,
+		height)))[:20]
+	addr, err := provautil.NewAddressProva(pkHash,
+		[]btcec.KeyID{1, 2}, params)
+	if err != nil {
+		return nil, err
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		Sequence:        wire.MaxTxInSequenceNum,
+		SignatureScript: coinbaseScript,
+	})
+	tx.AddTxOut(&wire.TxOut{
+		Value:    blockchain.CalcBlockSubsidy(height, params),
+		PkScript: pkScript,
+	})
+	return tx, nil
+}
+
+// multiChainAdminTx returns an admin transaction which spends the root thread
+// output of the genesis block of the passed parameters in order to add the
+// passed key to the provision key set.
+func multiChainAdminTx(params *chaincfg.Params, pubKey *btcec.PublicKey) (*wire.MsgTx, error) {
+	genesisTx := params.GenesisBlock.Transactions[0]
+	threadOut := genesisTx.TxOut[provautil.RootThread]
+	threadScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(provautil.RootThread)).
+		AddOp(txscript.OP_CHECKTHREAD).Script()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 1+btcec.PubKeyBytesLenCompressed)
+	data[0] = txscript.AdminOpProvisionKeyAdd
+	copy(data[1:], pubKey.SerializeCompressed())
+	opScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_RETURN).
+		AddData(data).Script()
+	if err != nil {
+		return nil, err
+	}
+
+	genesisTxHash := genesisTx.TxHash()
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&genesisTxHash,
+			uint32(provautil.RootThread)),
+		Sequence: wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxOut(wire.NewTxOut(0, threadScript))
+	tx.AddTxOut(wire.NewTxOut(0, opScript))
+	lookupKey := func(provautil.Address) ([]txscript.PrivateKey, error) {
+		return multiChainRootKeys, nil
+	}
+	sigScript, err := txscript.SignTxOutput(params, tx, 0, threadOut.Value,
+		threadOut.PkScript, txscript.SigHashAll,
+		txscript.KeyClosure(lookupKey), nil)
+	if err != nil {
+		return nil, err
+	}
+	tx.TxIn[0].SignatureScript = sigScript
+	return tx, nil
+}
+
+// multiChainBlock returns a signed and solved block which extends the passed
+// block with a coinbase and the passed transactions.
+func multiChainBlock(params *chaincfg.Params, prev *wire.MsgBlock,
+	txns ...*wire.MsgTx) (*provautil.Block, error) {
+
+	coinbase, err := multiChainCoinbase(params, prev.Header.Height+1)
+	if err != nil {
+		return nil, err
+	}
+	return multiChainSolveBlock(params, prev,
+		append([]*wire.MsgTx{coinbase}, txns...))
+}
+
+// multiChainSolveBlock returns a signed and solved block which extends the
+// passed block with the passed transactions, the first of which must be the
+// coinbase.
+func multiChainSolveBlock(params *chaincfg.Params, prev *wire.MsgBlock,
+	txns []*wire.MsgTx) (*provautil.Block, error) {
+
+	height := prev.Header.Height + 1
+	utilTxns := make([]*provautil.Tx, 0, len(txns))
+	for _, tx := range txns {
+		utilTxns = append(utilTxns, provautil.NewTx(tx))
+	}
+	merkles := blockchain.BuildMerkleTreeStore(utilTxns)
+
+	// Space the blocks out more than the target time so the required
+	// difficulty always remains at the proof of work limit.
+	ts := prev.Header.Timestamp.Add(2 * params.TargetTimePerBlock)
+	block := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:    1,
+			PrevBlock:  prev.BlockHash(),
+			MerkleRoot: *merkles[len(merkles)-1],
+			Bits:       params.PowLimitBits,
+			Timestamp:  ts,
+			Height:     height,
+		},
+		Transactions: txns,
+	}
+	block.Header.Size = uint32(block.SerializeSize())
+	if err := block.Header.Sign(multiChainValidateKey); err != nil {
+		return nil, err
+	}
+	solveBlock(&block.Header)
+	return provautil.NewBlock(block), nil
+}
+
+// extendMultiChain adds the passed provision key and then extends the passed
+// chain by the passed number of blocks in total.  It returns the coinbase
+// transactions of the new blocks.
+func extendMultiChain(chain *blockchain.BlockChain, params *chaincfg.Params,
+	numBlocks int, pubKey *btcec.PublicKey) ([]*wire.MsgTx, error) {
+
+	adminTx, err := multiChainAdminTx(params, pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	coinbases := make([]*wire.MsgTx, 0, numBlocks)
+	prev := params.GenesisBlock
+	for i := 0; i < numBlocks; i++ {
+		var txns []*wire.MsgTx
+		if i == 0 {
+			txns = append(txns, adminTx)
+		}
+		block, err := multiChainBlock(params, prev, txns...)
+		if err != nil {
+			return nil, err
+		}
+		isMainChain, isOrphan, err := chain.ProcessBlock(block,
+			blockchain.BFNone)
+		if err != nil {
+			return nil, fmt.Errorf("%s: ProcessBlock at height %d: %v",
+				params.Name, i+1, err)
+		}
+		if !isMainChain || isOrphan {
+			return nil, fmt.Errorf("%s: block at height %d main chain "+
+				"%v, orphan %v", params.Name, i+1, isMainChain,
+				isOrphan)
+		}
+		coinbases = append(coinbases, block.MsgBlock().Transactions[0])
+		prev = block.MsgBlock()
+	}
+	return coinbases, nil
+}
+
+// TestMultipleChains ensures two chain instances for different networks can be
+// run concurrently in the same process without any of their admin state or
+// utxos leaking into the other one or into the shared chain parameters.
+func TestMultipleChains(t *testing.T) {
+	// The simulation test network does not define any admin keys, so run
+	// it with the admin keys of the regression test network.
+	simParams := chaincfg.SimNetParams
+	simParams.AdminKeySets = chaincfg.RegressionNetParams.AdminKeySets
+	simParams.ASPKeyIdMap = chaincfg.RegressionNetParams.ASPKeyIdMap
+	simParams.ChainTrailingSigKeyLimit = 0
+	simParams.ChainWindowShareLimit = 0
+
+	netParams := []*chaincfg.Params{&chaincfg.RegressionNetParams, &simParams}
+
+	chains := make([]*blockchain.BlockChain, len(netParams))
+	pubKeys := make([]*btcec.PublicKey, len(netParams))
+	for i, params := range netParams {
+		chain, teardownFunc, err := chainSetup("multichain"+params.Name,
+			params)
+		if err != nil {
+			t.Fatalf("Failed to setup %s chain instance: %v",
+				params.Name, err)
+		}
+		defer teardownFunc()
+		chains[i] = chain
+
+		// Allow the admin threads of the genesis block to be spent
+		// right away.
+		chain.TstSetCoinbaseMaturity(1)
+
+		privKey, err := btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			t.Fatalf("Failed to create private key: %v", err)
+		}
+		pubKeys[i] = privKey.PubKey()
+	}
+
+	// Process blocks on both chains concurrently with each one adding a
+	// different provision key.
+	const numBlocks = 5
+	coinbases := make([][]*wire.MsgTx, len(netParams))
+	errs := make([]error, len(netParams))
+	var wg sync.WaitGroup
+	for i := range netParams {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			coinbases[i], errs[i] = extendMultiChain(chains[i],
+				netParams[i], numBlocks, pubKeys[i])
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, chain := range chains {
+		name := netParams[i].Name
+		other := (i + 1) % len(chains)
+
+		// Ensure each chain only knows about the key it added.
+		provisionKeys := chain.AdminKeySets()[btcec.ProvisionKeySet]
+		if len(provisionKeys) != 1 || provisionKeys.Pos(pubKeys[i]) != 0 {
+			t.Errorf("%s: got provision keys %v, want [%x]", name,
+				provisionKeys.ToStringArray(),
+				pubKeys[i].SerializeCompressed())
+		}
+		if height := chain.BestSnapshot().Height; height != numBlocks {
+			t.Errorf("%s: best height %d, want %d", name, height,
+				numBlocks)
+		}
+
+		// Ensure each chain has its own coinbase outputs and none of
+		// the outputs of the other chain.
+		for _, tx := range coinbases[i] {
+			txHash := tx.TxHash()
+			entry, err := chain.FetchUtxoEntry(&txHash)
+			if err != nil || entry == nil {
+				t.Errorf("%s: missing utxo for coinbase %v: %v",
+					name, txHash, err)
+			}
+		}
+		for _, tx := range coinbases[other] {
+			txHash := tx.TxHash()
+			entry, err := chain.FetchUtxoEntry(&txHash)
+			if err != nil || entry != nil {
+				t.Errorf("%s: unexpected utxo for coinbase %v "+
+					"of %s: %v", name, txHash,
+					netParams[other].Name, err)
+			}
+		}
+	}
+
+	// Ensure the shared chain parameters were not modified.
+	paramsKeys := chaincfg.RegressionNetParams.AdminKeySets[btcec.ProvisionKeySet]
+	if len(paramsKeys) != 0 {
+		t.Errorf("chain parameters provision keys modified: got %v",
+			paramsKeys.ToStringArray())
+	}
+}
@@ -7,6 +7,10 @@ package blockchain
 
 import (
 	"fmt"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
 )
 
 // NotificationType represents the type of a notification message.
@@ -30,14 +34,38 @@ const (
 	// NTBlockDisconnected indicates the associated block was disconnected
 	// from the main chain.
 	NTBlockDisconnected
+
+	// NTReorganizationStarted indicates the main chain is about to be
+	// reorganized.  It is sent once the reorganization passed its checks
+	// and before any blocks are disconnected.
+	NTReorganizationStarted
+
+	// NTReorganizationFinished indicates the reorganization of the main
+	// chain finished, successfully or not.
+	NTReorganizationFinished
+
+	// NTDoubleSign indicates a block signed by a validate key which signed
+	// a different block at the same height was accepted.  It is sent
+	// before the accepted notification of the block.
+	NTDoubleSign
+
+	// NTAdminKeyChanged indicates a key was added to or removed from an
+	// admin key set or the provisioned ASP keys by connecting a block to
+	// or disconnecting a block from the main chain.  It is sent after the
+	// connected or disconnected notification of the block.
+	NTAdminKeyChanged
 )
 
 // notificationTypeStrings is a map of notification types back to their constant
 // names for pretty printing.
 var notificationTypeStrings = map[NotificationType]string{
-	NTBlockAccepted:     "NTBlockAccepted",
-	NTBlockConnected:    "NTBlockConnected",
-	NTBlockDisconnected: "NTBlockDisconnected",
+	NTBlockAccepted:          "NTBlockAccepted",
+	NTBlockConnected:         "NTBlockConnected",
+	NTBlockDisconnected:      "NTBlockDisconnected",
+	NTReorganizationStarted:  "NTReorganizationStarted",
+	NTReorganizationFinished: "NTReorganizationFinished",
+	NTDoubleSign:             "NTDoubleSign",
+	NTAdminKeyChanged:        "NTAdminKeyChanged",
 }
 
 // String returns the NotificationType in human-readable form.
@@ -49,26 +77,170 @@ func (n NotificationType) String() string {
 }
 
 // Notification defines notification that is sent to the caller via the callback
-// function provided during the call to New and consists of a notification type
-// as well as associated data that depends on the type as follows:
-// 	- NTBlockAccepted:     *provautil.Block
-// 	- NTBlockConnected:    *provautil.Block
-// 	- NTBlockDisconnected: *provautil.Block
+// function provided during the call to New and to the callbacks registered with
+// Subscribe, and consists of a notification type as well as associated data
+// that depends on the type as follows:
+// 	- NTBlockAccepted:          *provautil.Block
+// 	- NTBlockConnected:         *provautil.Block
+// 	- NTBlockDisconnected:      *provautil.Block
+// 	- NTReorganizationStarted:  *ReorganizationNtfnsData
+// 	- NTReorganizationFinished: *ReorganizationNtfnsData
+// 	- NTDoubleSign:             *DoubleSign
+// 	- NTAdminKeyChanged:        *AdminKeyChange
+//
+// Notifications whose data is a block or an admin key change also carry the
+// height of the block in Height.
+//
+// The notifications are sent in the order the events take place, so a
+// reorganization is sent as NTReorganizationStarted, the NTBlockDisconnected
+// notifications of the blocks of the old main chain from the tip down, the
+// NTBlockConnected notifications of the blocks of the new main chain from the
+// fork point up, and NTReorganizationFinished.  The callbacks are invoked
+// without the chain lock held, but block the chain until they return.
 type Notification struct {
-	Type NotificationType
-	Data interface{}
+	Type   NotificationType
+	Data   interface{}
+	Height uint32
+}
+
+// AdminKeyChange is the data of an NTAdminKeyChanged notification.  It
+// describes a key added to or removed from an admin key set, or an ASP key
+// provisioned or revoked, by an admin operation of a block.  Disconnecting a
+// block reverses its operations, so each of them is reported as the inverse
+// change, in reverse order.
+type AdminKeyChange struct {
+	// KeySet is the key set of the key.  KeyID is only set for ASP keys.
+	KeySet btcec.KeySetType
+	PubKey *btcec.PublicKey
+	KeyID  btcec.KeyID
+
+	// Added is whether the key was added to the key set, as opposed to
+	// removed from it.
+	Added bool
+
+	// TxHash is the hash of the admin transaction performing the operation
+	// and Height is the height of its block.
+	TxHash chainhash.Hash
+	Height uint32
+}
+
+// NotificationHandle identifies a notification callback registered with
+// Subscribe so it can be removed with Unsubscribe.
+type NotificationHandle uint64
+
+// notificationSubscriber is a notification callback registered with Subscribe.
+type notificationSubscriber struct {
+	handle   NotificationHandle
+	callback NotificationCallback
 }
 
-// sendNotification sends a notification with the passed type and data if the
-// caller requested notifications by providing a callback function in the call
-// to New.
+// Subscribe registers the passed callback to receive all notifications sent
+// from then on, after the callback provided during the call to New and the
+// callbacks registered before it.  Each consumer may register its own
+// callback.  The returned handle removes the callback with Unsubscribe.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) Subscribe(callback NotificationCallback) NotificationHandle {
+	b.notificationsLock.Lock()
+	b.nextNotificationHandle++
+	handle := b.nextNotificationHandle
+	b.notificationSubscribers = append(b.notificationSubscribers,
+		notificationSubscriber{handle: handle, callback: callback})
+	b.notificationsLock.Unlock()
+	return handle
+}
+
+// Unsubscribe removes the notification callback registered with Subscribe
+// which the passed handle identifies, and returns whether it was registered.
+// A notification which is being sent while it is removed may still be
+// delivered to the callback.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) Unsubscribe(handle NotificationHandle) bool {
+	b.notificationsLock.Lock()
+	defer b.notificationsLock.Unlock()
+	for i, subscriber := range b.notificationSubscribers {
+		if subscriber.handle != handle {
+			continue
+		}
+
+		// Copy the remaining subscribers to a new slice so the slice
+		// being iterated by a notification in progress is unchanged.
+		subscribers := make([]notificationSubscriber, 0,
+			len(b.notificationSubscribers)-1)
+		subscribers = append(subscribers, b.notificationSubscribers[:i]...)
+		subscribers = append(subscribers, b.notificationSubscribers[i+1:]...)
+		b.notificationSubscribers = subscribers
+		return true
+	}
+	return false
+}
+
+// ReorganizationNtfnsData is the structure for data indicating information
+// about a reorganization of the main chain.
+type ReorganizationNtfnsData struct {
+	// OldHash and OldHeight identify the best block of the main chain
+	// before the reorganization.
+	OldHash   chainhash.Hash
+	OldHeight uint32
+
+	// NewHash and NewHeight identify the best block of the main chain
+	// once the reorganization completes.
+	NewHash   chainhash.Hash
+	NewHeight uint32
+
+	// Err is the error which caused the reorganization to fail.  It is
+	// only set for a failed reorganization, which leaves the main chain
+	// in between the old and new best blocks.
+	Err error
+}
+
+// hasNotificationReceivers returns whether a callback was provided in the call
+// to New or registered with Subscribe, so notifications which are expensive to
+// generate can be skipped otherwise.
+func (b *BlockChain) hasNotificationReceivers() bool {
+	if b.notifications != nil {
+		return true
+	}
+	b.notificationsLock.RLock()
+	numSubscribers := len(b.notificationSubscribers)
+	b.notificationsLock.RUnlock()
+	return numSubscribers > 0
+}
+
+// sendNotification sends a notification with the passed type and data to the
+// callback provided in the call to New, if any, and then to the callbacks
+// registered with Subscribe.  Block subscriptions are woken for changes to the
+// main chain either way.
 func (b *BlockChain) sendNotification(typ NotificationType, data interface{}) {
-	// Ignore it if the caller didn't request notifications.
-	if b.notifications == nil {
+	// Wake the block subscriptions so they catch up with the main chain.
+	if typ == NTBlockConnected || typ == NTBlockDisconnected {
+		b.wakeBlockSubscriptions()
+	}
+
+	// The slice of subscribers is replaced rather than modified when a
+	// subscriber is removed, so it can be iterated without the lock.
+	b.notificationsLock.RLock()
+	subscribers := b.notificationSubscribers
+	b.notificationsLock.RUnlock()
+
+	// Ignore it if nobody requested notifications.
+	if b.notifications == nil && len(subscribers) == 0 {
 		return
 	}
 
 	// Generate and send the notification.
 	n := Notification{Type: typ, Data: data}
-	b.notifications(&n)
+	switch data := data.(type) {
+	case *provautil.Block:
+		n.Height = data.MsgBlock().Header.Height
+	case *AdminKeyChange:
+		n.Height = data.Height
+	}
+	if b.notifications != nil {
+		b.notifications(&n)
+	}
+	for _, subscriber := range subscribers {
+		subscriber.callback(&n)
+	}
 }
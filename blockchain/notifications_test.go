@@ -0,0 +1,263 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+)
+
+// TestNotificationSubscribers ensures the callbacks registered with Subscribe
+// receive the notifications of a side chain taking over the main chain in the
+// order the blocks are disconnected and connected, and that callbacks removed
+// with Unsubscribe no longer receive notifications.
+func TestNotificationSubscribers(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	chain, teardownFunc, err := chainSetup("notificationsubscribers",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Collect the accepted blocks of the generated tests by name.
+	var accepted []fullblocktests.AcceptedBlock
+	byName := make(map[string]fullblocktests.AcceptedBlock)
+	for _, test := range tests {
+		for _, item := range test {
+			if item, ok := item.(fullblocktests.AcceptedBlock); ok {
+				accepted = append(accepted, item)
+				byName[item.Name] = item
+			}
+		}
+	}
+	process := func(items []fullblocktests.AcceptedBlock) {
+		for _, item := range items {
+			block := provautil.NewBlock(item.Block)
+			_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock %s: unexpected error: %v",
+					item.Name, err)
+			}
+		}
+	}
+
+	// describe returns a description of the passed notification which
+	// names the blocks of the generated tests.
+	names := make(map[string]string)
+	for _, item := range accepted {
+		names[item.Block.BlockHash().String()] = item.Name
+	}
+	describe := func(n *blockchain.Notification) string {
+		switch data := n.Data.(type) {
+		case *provautil.Block:
+			return fmt.Sprintf("%v %s %d", n.Type,
+				names[data.Hash().String()], n.Height)
+		case *blockchain.ReorganizationNtfnsData:
+			return fmt.Sprintf("%v %s -> %s err %v", n.Type,
+				names[data.OldHash.String()],
+				names[data.NewHash.String()], data.Err)
+		}
+		return n.Type.String()
+	}
+
+	// Process the blocks up to b23, which extends the main chain past the
+	// fork point of b24.
+	var b23 int
+	for i, item := range accepted {
+		if item.Name == "b23" {
+			b23 = i
+		}
+	}
+	process(accepted[:b23+1])
+
+	// Register two callbacks and a third one which is removed right away.
+	var first, second, removed []string
+	chain.Subscribe(func(n *blockchain.Notification) {
+		first = append(first, describe(n))
+	})
+	secondHandle := chain.Subscribe(func(n *blockchain.Notification) {
+		second = append(second, describe(n))
+	})
+	removedHandle := chain.Subscribe(func(n *blockchain.Notification) {
+		removed = append(removed, describe(n))
+	})
+	if secondHandle == removedHandle {
+		t.Fatalf("Subscribe returned the same handle twice")
+	}
+	if !chain.Unsubscribe(removedHandle) {
+		t.Fatalf("Unsubscribe: registered callback not found")
+	}
+	if chain.Unsubscribe(removedHandle) {
+		t.Fatalf("Unsubscribe: removed callback found again")
+	}
+
+	// Process b24 on a side chain and then b25, which makes the side chain
+	// the main chain.
+	//
+	//   ... -> b22 -> b23
+	//              \-> b24 -> b25
+	process([]fullblocktests.AcceptedBlock{byName["b24"], byName["b25"]})
+	height := byName["b23"].Height
+	// The validate key which signed b23 also signed b24 at the same height,
+	// and disconnecting b23 removes the issue key it added.
+	want := []string{
+		"NTDoubleSign",
+		fmt.Sprintf("NTBlockAccepted b24 %d", height),
+		"NTReorganizationStarted b23 -> b25 err <nil>",
+		fmt.Sprintf("NTBlockDisconnected b23 %d", height),
+		"NTAdminKeyChanged",
+		fmt.Sprintf("NTBlockConnected b24 %d", height),
+		fmt.Sprintf("NTBlockConnected b25 %d", height+1),
+		"NTReorganizationFinished b23 -> b25 err <nil>",
+		fmt.Sprintf("NTBlockAccepted b25 %d", height+1),
+	}
+	if !reflect.DeepEqual(first, want) {
+		t.Fatalf("first callback got notifications %q, want %q", first,
+			want)
+	}
+	if !reflect.DeepEqual(second, want) {
+		t.Fatalf("second callback got notifications %q, want %q",
+			second, want)
+	}
+	if len(removed) != 0 {
+		t.Fatalf("removed callback got notifications %q", removed)
+	}
+
+	// Once the second callback is removed, only the first one receives the
+	// notifications of the next block.
+	chain.Unsubscribe(secondHandle)
+	process([]fullblocktests.AcceptedBlock{byName["b26"]})
+	if len(first) == len(want) || len(second) != len(want) {
+		t.Fatalf("got %d and %d notifications after removing the "+
+			"second callback, want more than %d and %d", len(first),
+			len(second), len(want), len(want))
+	}
+}
+
+// TestAdminKeyChangeNotifications ensures an NTAdminKeyChanged notification is
+// sent for each key added to or removed from an admin key set by a block
+// connected to the main chain, and that the inverse changes are sent in reverse
+// order when reorganizations disconnect the block.
+func TestAdminKeyChangeNotifications(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	chain, teardownFunc, err := chainSetup("adminkeychangenotifications",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Collect the accepted blocks of the generated tests up to b27, which
+	// reorganizes the chain back to b23, and name the blocks of the admin
+	// transactions.
+	var accepted []fullblocktests.AcceptedBlock
+	byName := make(map[string]fullblocktests.AcceptedBlock)
+	txBlocks := make(map[chainhash.Hash]string)
+collect:
+	for _, test := range tests {
+		for _, item := range test {
+			item, ok := item.(fullblocktests.AcceptedBlock)
+			if !ok {
+				continue
+			}
+			accepted = append(accepted, item)
+			byName[item.Name] = item
+			for _, tx := range item.Block.Transactions {
+				txBlocks[tx.TxHash()] = item.Name
+			}
+			if item.Name == "b27" {
+				break collect
+			}
+		}
+	}
+
+	// describe returns a description of the passed key change which names
+	// the keys in the order they first appear and the block of its admin
+	// transaction.
+	keyNames := make(map[string]string)
+	describe := func(change *blockchain.AdminKeyChange) string {
+		pubKey := string(change.PubKey.SerializeCompressed())
+		if _, ok := keyNames[pubKey]; !ok {
+			keyNames[pubKey] = fmt.Sprintf("K%d", len(keyNames)+1)
+		}
+		sign := "-"
+		if change.Added {
+			sign = "+"
+		}
+		desc := fmt.Sprintf("%s%v %s", sign, change.KeySet,
+			keyNames[pubKey])
+		if change.KeySet == btcec.ASPKeySet {
+			desc += fmt.Sprintf(" #%d", change.KeyID)
+		}
+		return fmt.Sprintf("%s %s %d", desc, txBlocks[change.TxHash],
+			change.Height)
+	}
+
+	var got []string
+	chain.Subscribe(func(n *blockchain.Notification) {
+		if n.Type != blockchain.NTAdminKeyChanged {
+			return
+		}
+		change := n.Data.(*blockchain.AdminKeyChange)
+		if n.Height != change.Height {
+			t.Errorf("notification height %d, change height %d",
+				n.Height, change.Height)
+		}
+		got = append(got, describe(change))
+	})
+	for _, item := range accepted {
+		block := provautil.NewBlock(item.Block)
+		_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock %s: unexpected error: %v", item.Name,
+				err)
+		}
+	}
+
+	change := func(desc, name string) string {
+		return fmt.Sprintf("%s %s %d", desc, name, byName[name].Height)
+	}
+	want := []string{
+		change("+ISSUE K1", "b3"),
+		change("+ISSUE K2", "b4"),
+		change("+ISSUE K3", "b4"),
+		change("-ISSUE K1", "b10"),
+		change("+PROVISION K1", "b11"),
+		change("+PROVISION K2", "b11"),
+		change("+ASP K1 #3", "b12"),
+		change("-ASP K1 #3", "b13"),
+		change("+ASP K2 #4", "b13"),
+		// The reorganization to b15 disconnects b13.
+		change("-ASP K2 #4", "b13"),
+		change("+ASP K1 #3", "b13"),
+		change("+ASP K2 #4", "b16"),
+		change("+ASP K2 #5", "b18"),
+		change("+ASP K1 #6", "b18"),
+		change("-ASP K2 #4", "b20"),
+		change("+ISSUE K1", "b23"),
+		// The reorganization to b25 disconnects b23 and the one to b27
+		// connects it again.
+		change("-ISSUE K1", "b23"),
+		change("+ISSUE K1", "b23"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got admin key changes %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"sync"
+
+	"github.com/bitgo/prova/provautil"
+)
+
+// CheckBlockContextFree performs all of the validation checks on the passed
+// block which don't depend on its position in the block chain, namely the
+// sanity checks of the block and its transactions, which include the merkle
+// root, and the verification of the signature of the block header.  When the
+// checks pass, the block is marked so ProcessBlock doesn't repeat them.  Since
+// the block is marked as checked against the parameters of this chain instance,
+// it must not be processed by an instance with different parameters.
+//
+// This function is safe for concurrent access, however the passed block must
+// not be accessed concurrently.
+func (b *BlockChain) CheckBlockContextFree(block *provautil.Block) error {
+	if block.ContextFreeChecked() {
+		return nil
+	}
+
+	err := checkBlockSanity(block, b.chainParams, b.timeSource, BFNone)
+	if err != nil {
+		return err
+	}
+	if !b.chainParams.PowOnly {
+		err := checkBlockSignature(&block.MsgBlock().Header)
+		if err != nil {
+			return err
+		}
+	}
+
+	block.SetContextFreeChecked()
+	return nil
+}
+
+// PipelinedBlock is a block which passed through a BlockPipeline along with the
+// data it was submitted with.
+type PipelinedBlock struct {
+	Block *provautil.Block
+	Data  interface{}
+}
+
+// pipelineItem houses a block submitted to a BlockPipeline until its context
+// free checks are complete.
+type pipelineItem struct {
+	PipelinedBlock
+	done chan struct{}
+}
+
+// BlockPipeline performs the context free checks of blocks on a pool of worker
+// goroutines so they overlap with the processing of the blocks submitted before
+// them.  Blocks leave the pipeline in the order they were submitted once their
+// checks are complete, and blocks which passed the checks are marked so
+// ProcessBlock skips them.  Blocks which failed the checks leave the pipeline
+// unmarked, so processing them reports the failure as usual.
+//
+// The number of blocks in the pipeline is bounded, so submitting a block blocks
+// while the pipeline is full.
+type BlockPipeline struct {
+	chain   *BlockChain
+	workers int
+	work    chan *pipelineItem
+	ordered chan *pipelineItem
+	blocks  chan PipelinedBlock
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewBlockPipeline returns a new block pipeline which checks blocks against the
+// passed chain on the passed number of worker goroutines and holds at most
+// about the passed number of blocks.
+func NewBlockPipeline(chain *BlockChain, workers, depth int) *BlockPipeline {
+	if workers < 1 {
+		workers = 1
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	return &BlockPipeline{
+		chain:   chain,
+		workers: workers,
+		work:    make(chan *pipelineItem, depth),
+		ordered: make(chan *pipelineItem, depth),
+		blocks:  make(chan PipelinedBlock),
+		quit:    make(chan struct{}),
+	}
+}
+
+// worker performs the context free checks of the blocks submitted to the
+// pipeline.  It must be run as a goroutine.
+func (p *BlockPipeline) worker() {
+	defer p.wg.Done()
+	for {
+		select {
+		case item := <-p.work:
+			err := p.chain.CheckBlockContextFree(item.Block)
+			if err != nil {
+				log.Debugf("Block %v failed context free checks: "+
+					"%v", item.Block.Hash(), err)
+			}
+			close(item.done)
+
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// orderHandler passes the blocks submitted to the pipeline on in the order they
+// were submitted once their checks are complete.  It must be run as a
+// goroutine.
+func (p *BlockPipeline) orderHandler() {
+	defer p.wg.Done()
+	for {
+		var item *pipelineItem
+		select {
+		case item = <-p.ordered:
+		case <-p.quit:
+			return
+		}
+
+		select {
+		case <-item.done:
+		case <-p.quit:
+			return
+		}
+
+		select {
+		case p.blocks <- item.PipelinedBlock:
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// Start starts the worker goroutines of the pipeline.
+func (p *BlockPipeline) Start() {
+	p.wg.Add(p.workers + 1)
+	for i := 0; i < p.workers; i++ {
+		go p.worker()
+	}
+	go p.orderHandler()
+}
+
+// Stop stops the pipeline and waits for its goroutines to finish.  Blocks which
+// have not left the pipeline yet are dropped.
+func (p *BlockPipeline) Stop() {
+	close(p.quit)
+	p.wg.Wait()
+}
+
+// Submit adds the passed block to the pipeline along with the passed data,
+// which is returned with the block when it leaves the pipeline.  It blocks
+// while the pipeline is full and returns false when the pipeline was stopped
+// before the block could be added.
+//
+// This function is safe for concurrent access.
+func (p *BlockPipeline) Submit(block *provautil.Block, data interface{}) bool {
+	item := &pipelineItem{
+		PipelinedBlock: PipelinedBlock{Block: block, Data: data},
+		done:           make(chan struct{}),
+	}
+
+	// Check for a stopped pipeline first since the selects below choose
+	// randomly among the ready cases.
+	select {
+	case <-p.quit:
+		return false
+	default:
+	}
+
+	// The order channel has the same capacity as the work channel and
+	// blocks are added to it first, so adding the block to the work
+	// channel never blocks for long.
+	select {
+	case p.ordered <- item:
+	case <-p.quit:
+		return false
+	}
+	select {
+	case p.work <- item:
+	case <-p.quit:
+		return false
+	}
+	return true
+}
+
+// Blocks returns the channel the blocks leave the pipeline on in the order they
+// were submitted.
+func (p *BlockPipeline) Blocks() <-chan PipelinedBlock {
+	return p.blocks
+}
@@ -0,0 +1,270 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"encoding/binary"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// validatePrivKey is one of the validate keys of the regression test network.
+var validatePrivKey, _ = btcec.PrivKeyFromBytes(btcec.S256(), []byte{
+	0x40, 0x15, 0x28, 0x9a, 0x22, 0x86, 0x58, 0x04, 0x75, 0x20,
+	0xf0, 0xd0, 0xab, 0xe7, 0xad, 0x49, 0xab, 0xc7, 0x7f, 0x6b,
+	0xe0, 0xbe, 0x63, 0xb3, 0x6b, 0x94, 0xb8, 0x3c, 0x2d, 0x1f,
+	0xd9, 0x77,
+})
+
+// generateChain returns a chain of the passed number of blocks on top of the
+// regression test network genesis block.  Each block contains a coinbase which
+// pays to a distinct address and is signed by a validate key of the network.
+func generateChain(numBlocks int) ([]*wire.MsgBlock, error) {
+	params := &chaincfg.RegressionNetParams
+	coinbaseScript, err := txscript.NewScriptBuilder().
+		AddData([]byte("/prova/")).Script()
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]*wire.MsgBlock, 0, numBlocks)
+	// The genesis hash is calculated from the genesis block since the
+	// fullblocktests package modifies the block.
+	prevHash := params.GenesisBlock.BlockHash()
+	timestamp := time.Unix(time.Now().Unix(), 0)
+	for height := uint32(1); height <= uint32(numBlocks); height++ {
+		pkHash := make([]byte, 20)
+		binary.LittleEndian.PutUint32(pkHash, height)
+		addr, err := provautil.NewAddressProva(pkHash,
+			[]btcec.KeyID{1, 2}, params)
+		if err != nil {
+			return nil, err
+		}
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, err
+		}
+		coinbase := wire.NewMsgTx(1)
+		coinbase.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+				wire.MaxPrevOutIndex),
+			Sequence:        wire.MaxTxInSequenceNum,
+			SignatureScript: coinbaseScript,
+		})
+		coinbase.AddTxOut(&wire.TxOut{
+			Value:    blockchain.CalcBlockSubsidy(height, params),
+			PkScript: pkScript,
+		})
+
+		merkles := blockchain.BuildMerkleTreeStore(
+			[]*provautil.Tx{provautil.NewTx(coinbase)})
+		block := &wire.MsgBlock{
+			Header: wire.BlockHeader{
+				Version:    1,
+				PrevBlock:  prevHash,
+				MerkleRoot: *merkles[len(merkles)-1],
+				Bits:       params.PowLimitBits,
+				Timestamp:  timestamp.Add(time.Minute * 2 * time.Duration(height)),
+				Height:     height,
+			},
+			Transactions: []*wire.MsgTx{coinbase},
+		}
+		block.Header.Size = uint32(block.SerializeSize())
+		if err := block.Header.Sign(validatePrivKey); err != nil {
+			return nil, err
+		}
+		solveBlock(&block.Header)
+
+		blocks = append(blocks, block)
+		prevHash = block.BlockHash()
+	}
+	return blocks, nil
+}
+
+// TestBlockPipeline ensures blocks leave the pipeline in the order they were
+// submitted along with their data, that only the blocks which pass the context
+// free checks are marked as checked, and that processing a block reports the
+// failed checks of an unmarked block.
+func TestBlockPipeline(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("blockpipeline",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	msgBlocks, err := generateChain(20)
+	if err != nil {
+		t.Fatalf("generateChain: unexpected error: %v", err)
+	}
+
+	// Corrupt the merkle root of the last block and the signature of the
+	// one before it.
+	numBlocks := len(msgBlocks)
+	badMerkle := *msgBlocks[numBlocks-1]
+	badMerkle.Header.MerkleRoot[0] ^= 0xff
+	solveBlock(&badMerkle.Header)
+	msgBlocks[numBlocks-1] = &badMerkle
+	badSig := *msgBlocks[numBlocks-2]
+	otherKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("NewPrivateKey: unexpected error: %v", err)
+	}
+	err = badSig.Header.SignWith(validatePrivKey.PubKey(), otherKey.Sign)
+	if err != nil {
+		t.Fatalf("SignWith: unexpected error: %v", err)
+	}
+	solveBlock(&badSig.Header)
+	msgBlocks[numBlocks-2] = &badSig
+
+	pipeline := blockchain.NewBlockPipeline(chain, 4, 3)
+	pipeline.Start()
+	defer pipeline.Stop()
+
+	blocks := make([]*provautil.Block, 0, numBlocks)
+	for _, msgBlock := range msgBlocks {
+		blocks = append(blocks, provautil.NewBlock(msgBlock))
+	}
+	go func() {
+		for i, block := range blocks {
+			if !pipeline.Submit(block, i) {
+				return
+			}
+		}
+	}()
+
+	for i, block := range blocks {
+		pb := <-pipeline.Blocks()
+		if pb.Block != block || pb.Data.(int) != i {
+			t.Fatalf("block %d: got block %v with data %v", i,
+				pb.Block.Hash(), pb.Data)
+		}
+		wantChecked := i < numBlocks-2
+		if block.ContextFreeChecked() != wantChecked {
+			t.Fatalf("block %d: got checked %v, want %v", i,
+				block.ContextFreeChecked(), wantChecked)
+		}
+
+		var wantCode blockchain.ErrorCode
+		switch i {
+		case numBlocks - 2:
+			wantCode = blockchain.ErrBadBlockSignature
+		case numBlocks - 1:
+			// The block with the bad signature was not connected,
+			// so the last block is never checked beyond its sanity.
+			wantCode = blockchain.ErrBadMerkleRoot
+		}
+		_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+		if wantCode == 0 {
+			if err != nil {
+				t.Fatalf("block %d: unexpected error: %v", i, err)
+			}
+			continue
+		}
+		if rerr, ok := err.(blockchain.RuleError); !ok ||
+			rerr.ErrorCode != wantCode {
+
+			t.Fatalf("block %d: got error %v, want %v", i, err,
+				wantCode)
+		}
+	}
+
+	// Submitting a block to a stopped pipeline fails.
+	stopped := blockchain.NewBlockPipeline(chain, 1, 1)
+	stopped.Start()
+	stopped.Stop()
+	if stopped.Submit(blocks[0], nil) {
+		t.Fatal("Submit: succeeded on a stopped pipeline")
+	}
+}
+
+var (
+	// benchChain is the chain of blocks processed by the block processing
+	// benchmarks.  It is only generated once.
+	benchChain     []*wire.MsgBlock
+	benchChainErr  error
+	benchChainOnce sync.Once
+)
+
+// benchmarkProcessBlocks processes the benchmark chain of 5000 blocks into a
+// new chain instance for each iteration, either directly or by passing the
+// blocks through a block pipeline first as done during the initial sync.
+func benchmarkProcessBlocks(b *testing.B, pipelined bool) {
+	benchChainOnce.Do(func() {
+		benchChain, benchChainErr = generateChain(5000)
+	})
+	if benchChainErr != nil {
+		b.Fatalf("generateChain: unexpected error: %v", benchChainErr)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		chain, teardownFunc, err := chainSetup("benchprocessblocks",
+			&chaincfg.RegressionNetParams)
+		if err != nil {
+			b.Fatalf("Failed to setup chain instance: %v", err)
+		}
+		blocks := make([]*provautil.Block, 0, len(benchChain))
+		for _, msgBlock := range benchChain {
+			// Copy the blocks so no results are cached between
+			// iterations.
+			msgBlockCopy := *msgBlock
+			blocks = append(blocks, provautil.NewBlock(&msgBlockCopy))
+		}
+		b.StartTimer()
+
+		process := func(block *provautil.Block) {
+			_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+			if err != nil {
+				b.Fatalf("ProcessBlock: unexpected error: %v", err)
+			}
+		}
+		if pipelined {
+			pipeline := blockchain.NewBlockPipeline(chain,
+				runtime.NumCPU(), 16)
+			pipeline.Start()
+			go func() {
+				for _, block := range blocks {
+					pipeline.Submit(block, nil)
+				}
+			}()
+			for range blocks {
+				process((<-pipeline.Blocks()).Block)
+			}
+			pipeline.Stop()
+		} else {
+			for _, block := range blocks {
+				process(block)
+			}
+		}
+
+		b.StopTimer()
+		teardownFunc()
+		b.StartTimer()
+	}
+}
+
+// BenchmarkProcessBlocksSerial measures the throughput of processing a chain of
+// blocks without the block pipeline.
+func BenchmarkProcessBlocksSerial(b *testing.B) {
+	benchmarkProcessBlocks(b, false)
+}
+
+// BenchmarkProcessBlocksPipelined measures the throughput of processing a chain
+// of blocks which are passed through the block pipeline first.
+func BenchmarkProcessBlocksPipelined(b *testing.B) {
+	benchmarkProcessBlocks(b, true)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/bitgo/prova/wire"
+)
+
+// errPreempted is returned by the safe points of block processing when the
+// block is interrupted in favor of a better block.  ProcessBlockStatus reports
+// it as BlockStatusPreempted.
+var errPreempted = errors.New("block processing preempted by a better block")
+
+// Preempt requests the processing of the block which is in progress to be
+// interrupted in favor of the block with the passed header, which is typically
+// a block that was just received and is queued to be processed next.  The
+// request only interrupts blocks which are processed with the BFPreemptible
+// flag and only when the block with the passed header makes a tip with strictly
+// more work than the one the block being processed would make.  This is checked
+// at safe points before the chain state is modified, which are between the
+// batches of script validation and before the block is connected, so an
+// interrupted block leaves the chain as it was.
+//
+// Only the most recent request is kept.  It stays pending until the block with
+// the passed header has been processed, so a request made right before the
+// block it should interrupt is processed takes effect as well.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) Preempt(header *wire.BlockHeader) {
+	headerCopy := *header
+	b.preemptLock.Lock()
+	b.preemptHeader = &headerCopy
+	b.preemptLock.Unlock()
+}
+
+// donePreempt removes the pending request to preempt blocks in favor of the
+// passed block once it was processed.
+func (b *BlockChain) donePreempt(header *wire.BlockHeader) {
+	b.preemptLock.Lock()
+	if b.preemptHeader != nil &&
+		b.preemptHeader.BlockHash() == header.BlockHash() {
+
+		b.preemptHeader = nil
+	}
+	b.preemptLock.Unlock()
+}
+
+// checkPreempt returns errPreempted when the block being processed may be
+// preempted and the block of the pending request made with Preempt makes a tip
+// with strictly more work than the one the block being processed would make.
+// Blocks which are already known, whose parent is not in the memory block
+// index, or which extend the tip being made are never preferred, since their
+// work either can't be determined or they depend on the block being processed.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) checkPreempt() error {
+	tip := b.preemptTip
+	if tip == nil {
+		return nil
+	}
+	b.preemptLock.Lock()
+	header := b.preemptHeader
+	b.preemptLock.Unlock()
+	if header == nil {
+		return nil
+	}
+
+	hash := header.BlockHash()
+	if _, ok := b.index[hash]; ok {
+		return nil
+	}
+	parent, ok := b.index[header.PrevBlock]
+	if !ok || parent == tip {
+		return nil
+	}
+	workSum := new(big.Int).Add(parent.workSum, CalcWork(header.Bits))
+	if workSum.Cmp(tip.workSum) <= 0 {
+		return nil
+	}
+
+	log.Infof("Interrupting processing of block %v in favor of block %v "+
+		"which makes a better tip", tip.hash, hash)
+	return errPreempted
+}
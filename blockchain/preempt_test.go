@@ -0,0 +1,209 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// preemptTestBlock returns a signed and solved block which extends the passed
+// block with a coinbase paying to an address unique to the passed parameters
+// and with the passed difficulty and timestamp.
+func preemptTestBlock(params *chaincfg.Params, prev *wire.MsgBlock, bits uint32,
+	ts time.Time) (*provautil.Block, error) {
+
+	coinbase, err := multiChainCoinbase(params, prev.Header.Height+1)
+	if err != nil {
+		return nil, err
+	}
+	tx := provautil.NewTx(coinbase)
+	merkles := blockchain.BuildMerkleTreeStore([]*provautil.Tx{tx})
+	block := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:    1,
+			PrevBlock:  prev.BlockHash(),
+			MerkleRoot: *merkles[len(merkles)-1],
+			Bits:       bits,
+			Timestamp:  ts,
+			Height:     prev.Header.Height + 1,
+		},
+		Transactions: []*wire.MsgTx{coinbase},
+	}
+	block.Header.Size = uint32(block.SerializeSize())
+	if err := block.Header.Sign(multiChainValidateKey); err != nil {
+		return nil, err
+	}
+	solveBlock(&block.Header)
+	return provautil.NewBlock(block), nil
+}
+
+// TestPreemptBlock ensures a block which is processed while a block making a
+// tip with more work is queued is interrupted without modifying the chain when
+// it may be preempted, that the better block is then accepted as the new best
+// block, and that the interrupted block is accepted as a side chain block when
+// it is processed afterwards.  Requests for blocks which don't make a better
+// tip never interrupt processing.
+func TestPreemptBlock(t *testing.T) {
+	// Average the difficulty over few blocks so a branch of blocks with
+	// short intervals quickly requires more work per block.
+	params := chaincfg.RegressionNetParams
+	params.PowAveragingWindow = 4
+	fastParams := params
+	fastParams.Name = params.Name + "-fast"
+
+	// branch returns the passed number of blocks extending the passed
+	// prefix with the passed interval, with the difficulty required by a
+	// chain which only holds them.
+	branch := func(name string, coinbaseParams *chaincfg.Params, prefix []*provautil.Block, n int, interval time.Duration) []*provautil.Block {
+		chain, teardownFunc, err := chainSetup(name, &params)
+		if err != nil {
+			t.Fatalf("Failed to setup chain instance: %v", err)
+		}
+		defer teardownFunc()
+		prev := params.GenesisBlock
+		for _, block := range prefix {
+			if _, _, err := chain.ProcessBlock(block, blockchain.BFNone); err != nil {
+				t.Fatalf("%s: ProcessBlock: %v", name, err)
+			}
+			prev = block.MsgBlock()
+		}
+		var blocks []*provautil.Block
+		for i := 0; i < n; i++ {
+			bits, err := chain.CalcNextRequiredDifficulty()
+			if err != nil {
+				t.Fatalf("%s: CalcNextRequiredDifficulty: %v",
+					name, err)
+			}
+			block, err := preemptTestBlock(coinbaseParams, prev, bits,
+				prev.Header.Timestamp.Add(interval))
+			if err != nil {
+				t.Fatalf("%s: unable to create block: %v", name,
+					err)
+			}
+			if _, _, err := chain.ProcessBlock(block, blockchain.BFNone); err != nil {
+				t.Fatalf("%s: ProcessBlock at height %d: %v",
+					name, i+1, err)
+			}
+			blocks = append(blocks, block)
+			prev = block.MsgBlock()
+		}
+		return blocks
+	}
+	workSums := func(blocks []*provautil.Block) []*big.Int {
+		sums := []*big.Int{new(big.Int)}
+		for _, block := range blocks {
+			work := blockchain.CalcWork(block.MsgBlock().Header.Bits)
+			sums = append(sums, new(big.Int).Add(sums[len(sums)-1],
+				work))
+		}
+		return sums
+	}
+
+	// Fork a branch of slow blocks, which stay at the proof of work
+	// limit, and one of fast blocks, which require increasingly more
+	// work, off a common prefix.
+	slowInterval := 2 * params.TargetTimePerBlock
+	prefix := branch("preemptprefix", &params, nil, 8, slowInterval)
+	slow := branch("preemptslow", &params, prefix, 40, slowInterval)
+	fast := branch("preemptfast", &fastParams, prefix, 30, time.Second)
+	slowWork, fastWork := workSums(slow), workSums(fast)
+
+	// Find the fast blocks 1 to j which have no more work than the slow
+	// blocks 1 to m, while fast block j+1 makes a better tip than slow block
+	// m+1.  Block m+1 is then preempted by fast block j+1.
+	m, j := -1, -1
+	for fj := 1; fj+1 < len(fastWork) && m < 0; fj++ {
+		for sm := 1; sm+2 < len(slowWork); sm++ {
+			if fastWork[fj].Cmp(slowWork[sm]) > 0 {
+				continue
+			}
+			if fastWork[fj+1].Cmp(slowWork[sm+1]) > 0 &&
+				fastWork[fj+2].Cmp(slowWork[sm+2]) > 0 {
+
+				m, j = sm, fj
+			}
+			break
+		}
+	}
+	if m < 0 {
+		t.Fatalf("no fast block makes a better tip than a slow one")
+	}
+
+	chain, teardownFunc, err := chainSetup("preempt", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	process := func(block *provautil.Block, flags blockchain.BehaviorFlags, wantStatus blockchain.BlockStatus, wantMainChain bool) {
+		status, isMainChain, _, err := chain.ProcessBlockStatus(block,
+			flags)
+		if err != nil {
+			t.Fatalf("ProcessBlockStatus at height %d: %v",
+				block.MsgBlock().Header.Height, err)
+		}
+		if status != wantStatus || isMainChain != wantMainChain {
+			t.Fatalf("ProcessBlockStatus at height %d: got status %v "+
+				"and main chain %v, want %v and %v",
+				block.MsgBlock().Header.Height, status,
+				isMainChain, wantStatus, wantMainChain)
+		}
+	}
+	checkBest := func(block *provautil.Block) {
+		if best := chain.BestSnapshot(); *best.Hash != *block.Hash() {
+			t.Fatalf("got best block %v, want %v", best.Hash,
+				block.Hash())
+		}
+	}
+	for _, block := range prefix {
+		process(block, blockchain.BFNone, blockchain.BlockStatusNew, true)
+	}
+	for _, block := range slow[:m] {
+		process(block, blockchain.BFNone, blockchain.BlockStatusNew, true)
+	}
+	for _, block := range fast[:j] {
+		process(block, blockchain.BFNone, blockchain.BlockStatusNew, false)
+	}
+	checkBest(slow[m-1])
+
+	// The better fast block is queued while the slow block is processed,
+	// so the slow block is interrupted without changing the chain.
+	inferior, preferred := slow[m], fast[j]
+	chain.Preempt(&preferred.MsgBlock().Header)
+	process(inferior, blockchain.BFPreemptible,
+		blockchain.BlockStatusPreempted, false)
+	checkBest(slow[m-1])
+	if have, err := chain.HaveBlock(inferior.Hash()); err != nil || have {
+		t.Fatalf("HaveBlock of preempted block: got %v, %v", have, err)
+	}
+
+	// The better block reorganizes the chain, and the interrupted block is
+	// accepted on the side chain afterwards.
+	process(preferred, blockchain.BFPreemptible, blockchain.BlockStatusNew,
+		true)
+	checkBest(preferred)
+	process(inferior, blockchain.BFPreemptible, blockchain.BlockStatusNew,
+		false)
+	checkBest(preferred)
+	if have, err := chain.HaveBlock(inferior.Hash()); err != nil || !have {
+		t.Fatalf("HaveBlock of processed block: got %v, %v", have, err)
+	}
+
+	// A queued block which makes a worse tip doesn't interrupt processing,
+	// and neither does the block being processed itself.
+	chain.Preempt(&slow[m+1].MsgBlock().Header)
+	process(fast[j+1], blockchain.BFPreemptible, blockchain.BlockStatusNew,
+		true)
+	chain.Preempt(&fast[j+2].MsgBlock().Header)
+	process(fast[j+2], blockchain.BFPreemptible, blockchain.BlockStatusNew,
+		true)
+	checkBest(fast[j+2])
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
 )
 
 // BehaviorFlags is a bitmask defining tweaks to the normal behavior when
@@ -34,20 +35,97 @@ const (
 	// without modifying the current state.
 	BFDryRun
 
+	// BFPreemptible may be set to indicate the block may be interrupted in
+	// favor of a better block requested with Preempt.  It is only honored
+	// by ProcessBlockStatus, which reports interrupted blocks with
+	// BlockStatusPreempted.
+	BFPreemptible
+
+	// bfSignatureChecked indicates the signature of the block header was
+	// already verified by CheckBlockContextFree.  It is only set internally
+	// while checking the context of the block it applies to.
+	bfSignatureChecked
+
 	// BFNone is a convenience value to specifically indicate no flags.
 	BFNone BehaviorFlags = 0
 )
 
+// BlockStatus describes the outcome of processing a block with
+// ProcessBlockStatus, in particular whether the block was already known.
+type BlockStatus int
+
+const (
+	// BlockStatusNew indicates the block was not known before.  It was
+	// either accepted into the block chain or added as an orphan, unless
+	// an error other than a rule violation occurred while processing it.
+	BlockStatusNew BlockStatus = iota
+
+	// BlockStatusAlreadyHaveMainChain indicates the block is already part
+	// of the main chain.
+	BlockStatusAlreadyHaveMainChain
+
+	// BlockStatusAlreadyHaveSideChain indicates the block is already
+	// known as part of a side chain.
+	BlockStatusAlreadyHaveSideChain
+
+	// BlockStatusAlreadyHaveOrphan indicates the block is already known as
+	// an orphan.
+	BlockStatusAlreadyHaveOrphan
+
+	// BlockStatusInvalid indicates the block violates a consensus rule.
+	BlockStatusInvalid
+
+	// BlockStatusPreempted indicates processing the block was interrupted
+	// in favor of a better block before it modified the chain.  The block
+	// is not known to the chain and should be processed again once the
+	// better block was processed.
+	BlockStatusPreempted
+)
+
+// Map of BlockStatus values back to their constant names for pretty printing.
+var blockStatusStrings = map[BlockStatus]string{
+	BlockStatusNew:                  "BlockStatusNew",
+	BlockStatusAlreadyHaveMainChain: "BlockStatusAlreadyHaveMainChain",
+	BlockStatusAlreadyHaveSideChain: "BlockStatusAlreadyHaveSideChain",
+	BlockStatusAlreadyHaveOrphan:    "BlockStatusAlreadyHaveOrphan",
+	BlockStatusInvalid:              "BlockStatusInvalid",
+	BlockStatusPreempted:            "BlockStatusPreempted",
+}
+
+// String returns the BlockStatus as a human-readable name.
+func (s BlockStatus) String() string {
+	if str := blockStatusStrings[s]; str != "" {
+		return str
+	}
+	return fmt.Sprintf("Unknown BlockStatus (%d)", int(s))
+}
+
+// IsDuplicate returns whether the status indicates the block was already
+// known, either as part of the main chain, a side chain, or as an orphan.
+func (s BlockStatus) IsDuplicate() bool {
+	return s == BlockStatusAlreadyHaveMainChain ||
+		s == BlockStatusAlreadyHaveSideChain ||
+		s == BlockStatusAlreadyHaveOrphan
+}
+
 // blockExists determines whether a block with the given hash exists either in
 // the main chain or any side chains.
 //
-// This function MUST be called with the chain state lock held (for reads).
+// This function MUST be called with either the chain state lock or the index
+// lock held (for reads).
 func (b *BlockChain) blockExists(hash *chainhash.Hash) (bool, error) {
 	// Check memory chain first (could be main chain or side chain blocks).
 	if _, ok := b.index[*hash]; ok {
 		return true, nil
 	}
 
+	// Blocks which previously failed to connect due to something other
+	// than a rule violation are stored in the database, but need to be
+	// processed again.
+	if _, ok := b.failedBlocks[*hash]; ok {
+		return false, nil
+	}
+
 	// Check in the database.
 	var exists bool
 	err := b.db.View(func(dbTx database.Tx) error {
@@ -87,6 +165,10 @@ func (b *BlockChain) processOrphans(hash *chainhash.Hash, flags BehaviorFlags) e
 		// intentionally used over a range here as range does not
 		// reevaluate the slice on each iteration nor does it adjust the
 		// index for the modified slice.
+		//
+		// Orphans which descend from a block that was marked invalid
+		// are dropped instead.
+		invalidParent := b.isInvalidChain(b.index[*processHash], nil)
 		for i := 0; i < len(b.prevOrphans[*processHash]); i++ {
 			orphan := b.prevOrphans[*processHash][i]
 			if orphan == nil {
@@ -100,6 +182,12 @@ func (b *BlockChain) processOrphans(hash *chainhash.Hash, flags BehaviorFlags) e
 			orphanHash := orphan.block.Hash()
 			b.removeOrphanBlock(orphan)
 			i--
+			if invalidParent {
+				log.Infof("Dropping orphan block %v which "+
+					"descends from an invalidated block",
+					orphanHash)
+				continue
+			}
 
 			// Potentially accept the block into the block chain.
 			_, err := b.maybeAcceptBlock(orphan.block, flags)
@@ -125,85 +213,172 @@ func (b *BlockChain) processOrphans(hash *chainhash.Hash, flags BehaviorFlags) e
 // whether or not the block is on the main chain and the second indicates
 // whether or not the block is an orphan.
 //
+// A RuleError is returned when the block violates a consensus rule or, with
+// the ErrDuplicateBlock code, when the block is already known.  Callers which
+// need to tell duplicate blocks apart from invalid ones should use
+// ProcessBlockStatus instead.  Failures which say nothing about the validity
+// of the block, such as database errors, are returned as a DatabaseError (or
+// an AssertError for internal consistency issues) and the block may be
+// processed again later.  Every block is refused with a DatabaseError when the
+// chain is read-only.
+//
 // This function is safe for concurrent access.
 func (b *BlockChain) ProcessBlock(block *provautil.Block, flags BehaviorFlags) (bool, bool, error) {
+	status, isMainChain, isOrphan, err := b.ProcessBlockStatus(block,
+		flags&^BFPreemptible)
+	if err != nil {
+		return false, false, err
+	}
+	switch status {
+	case BlockStatusAlreadyHaveOrphan:
+		str := fmt.Sprintf("already have block (orphan) %v",
+			block.Hash())
+		return false, false, b.countRuleError(ruleError(
+			ErrDuplicateBlock, str))
+	case BlockStatusAlreadyHaveMainChain, BlockStatusAlreadyHaveSideChain:
+		str := fmt.Sprintf("already have block %v", block.Hash())
+		return false, false, b.countRuleError(ruleError(
+			ErrDuplicateBlock, str))
+	}
+	return isMainChain, isOrphan, nil
+}
+
+// ProcessBlockStatus processes the passed block like ProcessBlock, but reports
+// a block which is already known with a status rather than an error, so
+// submitting the same block more than once is not treated as a failure.
+//
+// The first return value is the status of the block.  For new blocks which
+// were processed without errors, the second return value indicates whether or
+// not the block is on the main chain and the third indicates whether or not
+// the block is an orphan.  A RuleError is only returned, along with
+// BlockStatusInvalid, when the block violates a consensus rule.  Other errors
+// are returned along with BlockStatusNew as described by ProcessBlock.  When
+// the BFPreemptible flag is set and processing is interrupted in favor of a
+// better block requested with Preempt, BlockStatusPreempted is returned without
+// an error.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ProcessBlockStatus(block *provautil.Block, flags BehaviorFlags) (BlockStatus, bool, bool, error) {
+	// Blocks can't be processed without modifying the database.  The
+	// error is not a rule error since the block itself might be valid.
+	if b.readOnly {
+		return BlockStatusNew, false, false, DatabaseError{
+			Err: database.Error{
+				ErrorCode:   database.ErrDbReadOnly,
+				Description: "block chain is read-only",
+			},
+		}
+	}
+
 	b.chainLock.Lock()
 	defer b.chainLock.Unlock()
 
-	fastAdd := flags&BFFastAdd == BFFastAdd
+	status, isMainChain, isOrphan, err := b.processBlock(block, flags)
+	b.donePreempt(&block.MsgBlock().Header)
+	if err == errPreempted {
+		return BlockStatusPreempted, false, false, nil
+	}
+	if err != nil {
+		err = wrapNonRuleError(err)
+		if _, ok := err.(RuleError); ok {
+			return BlockStatusInvalid, false, false,
+				b.countRuleError(err)
+		}
+		return BlockStatusNew, false, false, err
+	}
+	return status, isMainChain, isOrphan, nil
+}
+
+// countRuleError counts the passed rule error, which rejects a block, in the
+// error stats of the chain when it has any and returns it.
+func (b *BlockChain) countRuleError(err error) error {
+	if b.errorStats != nil {
+		b.errorStats.AddRuleError(err)
+	}
+	return err
+}
+
+// knownBlockStatus returns the status of the passed block hash, which MUST
+// already exist in the main chain or a side chain.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) knownBlockStatus(hash *chainhash.Hash) (BlockStatus, error) {
+	var isMainChain bool
+	err := b.db.View(func(dbTx database.Tx) error {
+		isMainChain = dbMainChainHasBlock(dbTx, hash)
+		return nil
+	})
+	if err != nil {
+		return BlockStatusNew, err
+	}
+	if isMainChain {
+		return BlockStatusAlreadyHaveMainChain, nil
+	}
+	return BlockStatusAlreadyHaveSideChain, nil
+}
+
+// processBlock performs the work of ProcessBlockStatus.  See its documentation
+// for details.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) processBlock(block *provautil.Block, flags BehaviorFlags) (BlockStatus, bool, bool, error) {
 	dryRun := flags&BFDryRun == BFDryRun
 
 	blockHash := block.Hash()
 	log.Tracef("Processing block %v", blockHash)
 
-	// The block must not already exist in the main chain or side chains.
+	// The block is reported as a duplicate when it already exists in the
+	// main chain or side chains.
 	exists, err := b.blockExists(blockHash)
 	if err != nil {
-		return false, false, err
+		return BlockStatusNew, false, false, err
 	}
 	if exists {
-		str := fmt.Sprintf("already have block %v", blockHash)
-		return false, false, ruleError(ErrDuplicateBlock, str)
+		status, err := b.knownBlockStatus(blockHash)
+		return status, false, false, err
 	}
 
-	// The block must not already exist as an orphan.
+	// The block is reported as a duplicate when it already exists as an
+	// orphan.
 	if _, exists := b.orphans[*blockHash]; exists {
-		str := fmt.Sprintf("already have block (orphan) %v", blockHash)
-		return false, false, ruleError(ErrDuplicateBlock, str)
+		return BlockStatusAlreadyHaveOrphan, false, false, nil
 	}
 
-	// Perform preliminary sanity checks on the block and its transactions.
-	err = checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource, flags)
-	if err != nil {
-		return false, false, err
+	// Reject the block right away when the same block was already found
+	// to break a consensus rule and the outcome still holds, so blocks
+	// which are submitted repeatedly are not validated over and over.
+	if err, ok := b.validationCache.lookup(block, flags, b.bestNode.hash); ok {
+		log.Debugf("Rejecting block %v with the cached outcome of a "+
+			"previous validation: %v", blockHash, err)
+		return BlockStatusNew, false, false, err
 	}
 
-	// Find the previous checkpoint and perform some additional checks based
-	// on the checkpoint.  This provides a few nice properties such as
-	// preventing old side chain blocks before the last checkpoint,
-	// rejecting easy to mine, but otherwise bogus, blocks that could be
-	// used to eat memory, and ensuring expected (versus claimed) proof of
-	// work requirements since the previous checkpoint are met.
-	blockHeader := &block.MsgBlock().Header
-	checkpointBlock, err := b.findPreviousCheckpoint()
-	if err != nil {
-		return false, false, err
-	}
-	if checkpointBlock != nil {
-		// Ensure the block timestamp is after the checkpoint timestamp.
-		checkpointHeader := &checkpointBlock.MsgBlock().Header
-		checkpointTime := checkpointHeader.Timestamp
-		if blockHeader.Timestamp.Before(checkpointTime) {
-			str := fmt.Sprintf("block %v has timestamp %v before "+
-				"last checkpoint timestamp %v", blockHash,
-				blockHeader.Timestamp, checkpointTime)
-			return false, false, ruleError(ErrCheckpointTimeTooOld, str)
+	// Perform preliminary sanity checks on the block and its transactions
+	// unless they were already performed by CheckBlockContextFree.
+	if !block.ContextFreeChecked() {
+		err = checkBlockSanity(block, b.chainParams, b.timeSource,
+			flags)
+		if err != nil {
+			b.validationCache.add(block, flags, err, false, nil)
+			return BlockStatusNew, false, false, err
 		}
-		if !fastAdd {
-			// Even though the checks prior to now have already ensured the
-			// proof of work exceeds the claimed amount, the claimed amount
-			// is a field in the block header which could be forged.  This
-			// check ensures the proof of work is at least the minimum
-			// expected based on elapsed time since the last checkpoint and
-			// maximum adjustment allowed by the retarget rules.
-			duration := blockHeader.Timestamp.Sub(checkpointTime)
-			requiredTarget := CompactToBig(b.calcEasiestDifficulty(
-				checkpointHeader.Bits, duration))
-			currentTarget := CompactToBig(blockHeader.Bits)
-			if currentTarget.Cmp(requiredTarget) > 0 {
-				str := fmt.Sprintf("block target difficulty of %064x "+
-					"is too low when compared to the previous "+
-					"checkpoint", currentTarget)
-				return false, false, ruleError(ErrDifficultyTooLow, str)
-			}
+	}
+
+	// Perform some additional checks based on the previous checkpoint.
+	blockHeader := &block.MsgBlock().Header
+	if err := b.checkHeaderCheckpoint(blockHeader, flags); err != nil {
+		if _, ok := err.(RuleError); ok {
+			b.validationCache.add(block, flags, err, true,
+				b.bestNode.hash)
 		}
+		return BlockStatusNew, false, false, err
 	}
 
 	// Handle orphan blocks.
 	prevHash := &blockHeader.PrevBlock
 	prevHashExists, err := b.blockExists(prevHash)
 	if err != nil {
-		return false, false, err
+		return BlockStatusNew, false, false, err
 	}
 	if !prevHashExists {
 		if !dryRun {
@@ -212,14 +387,14 @@ func (b *BlockChain) ProcessBlock(block *provautil.Block, flags BehaviorFlags) (
 			b.addOrphanBlock(block)
 		}
 
-		return false, true, nil
+		return BlockStatusNew, false, true, nil
 	}
 
 	// The block has passed all context independent checks and appears sane
 	// enough to potentially accept it into the block chain.
 	isMainChain, err := b.maybeAcceptBlock(block, flags)
 	if err != nil {
-		return false, false, err
+		return BlockStatusNew, false, false, err
 	}
 
 	// Don't process any orphans or log when the dry run flag is set.
@@ -227,13 +402,63 @@ func (b *BlockChain) ProcessBlock(block *provautil.Block, flags BehaviorFlags) (
 		// Accept any orphan blocks that depend on this block (they are
 		// no longer orphans) and repeat for those accepted blocks until
 		// there are no more.
-		err := b.processOrphans(blockHash, flags)
+		// Orphans are never interrupted since the block they depend
+		// on was already accepted.
+		err := b.processOrphans(blockHash, flags&^BFPreemptible)
 		if err != nil {
-			return false, false, err
+			return BlockStatusNew, false, false, err
 		}
 
 		log.Debugf("Accepted block %v", blockHash)
 	}
 
-	return isMainChain, false, nil
+	return BlockStatusNew, isMainChain, false, nil
+}
+
+// checkHeaderCheckpoint finds the previous checkpoint and performs some
+// additional checks on the passed block header based on it.  This provides a
+// few nice properties such as preventing old side chain blocks before the last
+// checkpoint, rejecting easy to mine, but otherwise bogus, blocks that could be
+// used to eat memory, and ensuring expected (versus claimed) proof of work
+// requirements since the previous checkpoint are met.
+//
+// The flags modify the behavior of this function as follows:
+//  - BFFastAdd: The proof of work is not checked against the minimum expected
+//    since the previous checkpoint.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) checkHeaderCheckpoint(header *wire.BlockHeader, flags BehaviorFlags) error {
+	checkpointHeader, err := b.findPreviousCheckpoint()
+	if err != nil || checkpointHeader == nil {
+		return err
+	}
+
+	// Ensure the block timestamp is after the checkpoint timestamp.
+	checkpointTime := checkpointHeader.Timestamp
+	if header.Timestamp.Before(checkpointTime) {
+		str := fmt.Sprintf("block %v has timestamp %v before last "+
+			"checkpoint timestamp %v", header.BlockHash(),
+			header.Timestamp, checkpointTime)
+		return ruleError(ErrCheckpointTimeTooOld, str)
+	}
+	if flags&BFFastAdd == BFFastAdd {
+		return nil
+	}
+
+	// Even though the checks prior to now have already ensured the proof of
+	// work exceeds the claimed amount, the claimed amount is a field in the
+	// block header which could be forged.  This check ensures the proof of
+	// work is at least the minimum expected based on elapsed time since the
+	// last checkpoint and maximum adjustment allowed by the retarget rules.
+	duration := header.Timestamp.Sub(checkpointTime)
+	requiredTarget := CompactToBig(b.calcEasiestDifficulty(
+		checkpointHeader.Bits, duration))
+	currentTarget := CompactToBig(header.Bits)
+	if currentTarget.Cmp(requiredTarget) > 0 {
+		str := fmt.Sprintf("block target difficulty of %064x is too "+
+			"low when compared to the previous checkpoint",
+			currentTarget)
+		return ruleError(ErrDifficultyTooLow, str)
+	}
+	return nil
 }
@@ -0,0 +1,327 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// failingDB wraps a database in order to inject a failure into a database
+// update.
+type failingDB struct {
+	database.DB
+
+	// failing indicates an update is to be failed.  failAfter is the
+	// number of updates to allow before failing the next one.
+	failing   bool
+	failAfter int
+}
+
+// Update fails the update with an injected error when the database has been
+// set to fail and the configured number of updates have already been allowed.
+// Otherwise, it invokes the update on the underlying database.
+func (db *failingDB) Update(fn func(tx database.Tx) error) error {
+	if db.failing {
+		if db.failAfter == 0 {
+			db.failing = false
+			return database.Error{
+				ErrorCode:   database.ErrDriverSpecific,
+				Description: "injected write failure",
+			}
+		}
+		db.failAfter--
+	}
+	return db.DB.Update(fn)
+}
+
+// TestProcessBlockDatabaseFailure ensures a block which fails to connect due
+// to a database failure is reported with a DatabaseError rather than a
+// RuleError, is not treated as a known block, and is accepted when it is
+// processed again.
+func TestProcessBlockDatabaseFailure(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	ndb, teardown := testChainDB(t, "processfailure", &params)
+	defer teardown()
+	db := &failingDB{DB: ndb}
+	chain := newTestChain(t, db, &params, &blockchain.Config{
+		SigCache: txscript.NewSigCache(1000),
+	})
+
+	block, err := multiChainBlock(&params, params.GenesisBlock)
+	if err != nil {
+		t.Fatalf("Unable to create block: %v", err)
+	}
+
+	// Allow the block to be stored, but fail the update which connects it
+	// to the main chain.
+	db.failing = true
+	db.failAfter = 1
+	_, _, err = chain.ProcessBlock(block, blockchain.BFNone)
+	if _, ok := err.(blockchain.RuleError); ok {
+		t.Fatalf("ProcessBlock: got rule error %v, want database "+
+			"failure", err)
+	}
+	dbErr, ok := err.(blockchain.DatabaseError)
+	if !ok {
+		t.Fatalf("ProcessBlock: got error %v (%T), want %T", err, err,
+			blockchain.DatabaseError{})
+	}
+	if cause, ok := dbErr.Err.(database.Error); !ok ||
+		cause.ErrorCode != database.ErrDriverSpecific {
+
+		t.Fatalf("ProcessBlock: unexpected underlying error %v", dbErr.Err)
+	}
+
+	// Ensure the block is neither connected nor treated as a known block
+	// now that it has been stored.
+	if height := chain.BestSnapshot().Height; height != 0 {
+		t.Fatalf("Best height after failure: got %d, want 0", height)
+	}
+	haveBlock, err := chain.HaveBlock(block.Hash())
+	if err != nil {
+		t.Fatalf("HaveBlock: unexpected error: %v", err)
+	}
+	if haveBlock {
+		t.Fatalf("HaveBlock: failed block %v is treated as known",
+			block.Hash())
+	}
+
+	// Ensure processing the block again succeeds.
+	isMainChain, isOrphan, err := chain.ProcessBlock(block, blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("ProcessBlock retry: unexpected error: %v", err)
+	}
+	if !isMainChain || isOrphan {
+		t.Fatalf("ProcessBlock retry: got main chain %v, orphan %v, "+
+			"want true, false", isMainChain, isOrphan)
+	}
+	if height := chain.BestSnapshot().Height; height != 1 {
+		t.Fatalf("Best height after retry: got %d, want 1", height)
+	}
+	haveBlock, err = chain.HaveBlock(block.Hash())
+	if err != nil || !haveBlock {
+		t.Fatalf("HaveBlock after retry: got %v, %v, want true",
+			haveBlock, err)
+	}
+}
+
+// TestProcessBlockStatus ensures blocks which are already known are reported
+// by ProcessBlockStatus with the status of the known block rather than an
+// error, while ProcessBlock keeps reporting them with ErrDuplicateBlock.
+func TestProcessBlockStatus(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("processblockstatus", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Create a main chain of two blocks, a side chain block which forks
+	// from the genesis block, and an orphan which builds on top of a
+	// block which is never processed.
+	//
+	// genesis -> main1 -> main2
+	//        \-> side1 -> (side2) -> orphan
+	main1, err := multiChainBlock(&params, params.GenesisBlock)
+	if err != nil {
+		t.Fatalf("Unable to create block: %v", err)
+	}
+	main2, err := multiChainBlock(&params, main1.MsgBlock())
+	if err != nil {
+		t.Fatalf("Unable to create block: %v", err)
+	}
+	sideMsg := *main1.MsgBlock()
+	sideMsg.Header.Timestamp = sideMsg.Header.Timestamp.Add(time.Second)
+	if err := sideMsg.Header.Sign(multiChainValidateKey); err != nil {
+		t.Fatalf("Unable to sign block: %v", err)
+	}
+	solveBlock(&sideMsg.Header)
+	side1 := provautil.NewBlock(&sideMsg)
+	side2, err := multiChainBlock(&params, side1.MsgBlock())
+	if err != nil {
+		t.Fatalf("Unable to create block: %v", err)
+	}
+	orphan, err := multiChainBlock(&params, side2.MsgBlock())
+	if err != nil {
+		t.Fatalf("Unable to create block: %v", err)
+	}
+
+	// Ensure each block is new the first time it is processed.
+	for _, block := range []*provautil.Block{main1, main2, side1, orphan} {
+		status, _, _, err := chain.ProcessBlockStatus(block,
+			blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlockStatus %v: unexpected error: %v",
+				block.Hash(), err)
+		}
+		if status != blockchain.BlockStatusNew {
+			t.Fatalf("ProcessBlockStatus %v: got status %v, want %v",
+				block.Hash(), status, blockchain.BlockStatusNew)
+		}
+	}
+
+	// Ensure processing the blocks again reports where they are known
+	// without an error and without modifying the chain.
+	tests := []struct {
+		name  string
+		block *provautil.Block
+		want  blockchain.BlockStatus
+	}{
+		{"main chain", main2, blockchain.BlockStatusAlreadyHaveMainChain},
+		{"side chain", side1, blockchain.BlockStatusAlreadyHaveSideChain},
+		{"orphan", orphan, blockchain.BlockStatusAlreadyHaveOrphan},
+	}
+	for _, test := range tests {
+		status, isMainChain, isOrphan, err := chain.ProcessBlockStatus(
+			test.block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("%s: ProcessBlockStatus: unexpected error: %v",
+				test.name, err)
+		}
+		if status != test.want || !status.IsDuplicate() {
+			t.Fatalf("%s: got status %v, want %v", test.name, status,
+				test.want)
+		}
+		if isMainChain || isOrphan {
+			t.Fatalf("%s: got main chain %v, orphan %v, want false, "+
+				"false", test.name, isMainChain, isOrphan)
+		}
+
+		_, _, err = chain.ProcessBlock(test.block, blockchain.BFNone)
+		rerr, ok := err.(blockchain.RuleError)
+		if !ok || rerr.ErrorCode != blockchain.ErrDuplicateBlock {
+			t.Fatalf("%s: ProcessBlock: got error %v, want %v",
+				test.name, err, blockchain.ErrDuplicateBlock)
+		}
+	}
+	if height := chain.BestSnapshot().Height; height != 2 {
+		t.Fatalf("Best height: got %d, want 2", height)
+	}
+
+	// Ensure a block which violates a consensus rule is reported as
+	// invalid with a rule error.
+	badMsg := *main2.MsgBlock()
+	badMsg.Header.PrevBlock = main2.MsgBlock().BlockHash()
+	badMsg.Header.Height = 3
+	badMsg.Header.MerkleRoot = wire.BlockHeader{}.MerkleRoot
+	solveBlock(&badMsg.Header)
+	status, _, _, err := chain.ProcessBlockStatus(
+		provautil.NewBlock(&badMsg), blockchain.BFNone)
+	if _, ok := err.(blockchain.RuleError); !ok {
+		t.Fatalf("ProcessBlockStatus invalid block: got error %v, want "+
+			"rule error", err)
+	}
+	if status != blockchain.BlockStatusInvalid {
+		t.Fatalf("ProcessBlockStatus invalid block: got status %v, want "+
+			"%v", status, blockchain.BlockStatusInvalid)
+	}
+}
+
+// TestProcessBlockValidationCache ensures a block which was rejected for
+// breaking a consensus rule is rejected with the cached outcome when it is
+// processed again, that a cached failure which depends on the state of the
+// chain only holds until the tip of the best chain changes, and that a valid
+// block which shares its hash with a cached invalid block is not rejected.
+func TestProcessBlockValidationCache(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("validationcache", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// processBad processes the passed block, which must be rejected with
+	// the passed error code, and ensures the number of cache hits and
+	// misses changed by the passed amounts.
+	processBad := func(name string, block *provautil.Block,
+		code blockchain.ErrorCode, hits, misses uint64) {
+
+		before := chain.ValidationCacheStats()
+		status, _, _, err := chain.ProcessBlockStatus(block,
+			blockchain.BFNone)
+		rerr, ok := err.(blockchain.RuleError)
+		if !ok || rerr.ErrorCode != code {
+			t.Fatalf("%s: got error %v, want %v", name, err, code)
+		}
+		if status != blockchain.BlockStatusInvalid {
+			t.Fatalf("%s: got status %v, want %v", name, status,
+				blockchain.BlockStatusInvalid)
+		}
+		after := chain.ValidationCacheStats()
+		if after.Hits-before.Hits != hits ||
+			after.Misses-before.Misses != misses {
+
+			t.Fatalf("%s: got %d hits and %d misses, want %d and %d",
+				name, after.Hits-before.Hits,
+				after.Misses-before.Misses, hits, misses)
+		}
+	}
+
+	// Create a block whose coinbase was tampered with, so it has the same
+	// hash as the valid block, but doesn't match its merkle root.
+	main1, err := multiChainBlock(&params, params.GenesisBlock)
+	if err != nil {
+		t.Fatalf("Unable to create block: %v", err)
+	}
+	badMerkleMsg := *main1.MsgBlock()
+	coinbase := badMerkleMsg.Transactions[0].Copy()
+	coinbase.TxOut[0].Value++
+	badMerkleMsg.Transactions = []*wire.MsgTx{coinbase}
+	badMerkle := provautil.NewBlock(&badMerkleMsg)
+	if *badMerkle.Hash() != *main1.Hash() {
+		t.Fatalf("Tampered block has hash %v, want %v", badMerkle.Hash(),
+			main1.Hash())
+	}
+
+	// Create a block whose timestamp is before the median time of the
+	// blocks it builds on.
+	tooOldMsg := *main1.MsgBlock()
+	tooOldMsg.Header.Timestamp = params.GenesisBlock.Header.Timestamp.Add(
+		-time.Second)
+	if err := tooOldMsg.Header.Sign(multiChainValidateKey); err != nil {
+		t.Fatalf("Unable to sign block: %v", err)
+	}
+	solveBlock(&tooOldMsg.Header)
+	tooOld := provautil.NewBlock(&tooOldMsg)
+
+	// Ensure both blocks are validated the first time they are processed
+	// and rejected with the cached outcome the second time.
+	processBad("bad merkle root", badMerkle, blockchain.ErrBadMerkleRoot,
+		0, 1)
+	processBad("bad merkle root again", badMerkle,
+		blockchain.ErrBadMerkleRoot, 1, 0)
+	processBad("too old", tooOld, blockchain.ErrTimeTooOld, 0, 1)
+	processBad("too old again", tooOld, blockchain.ErrTimeTooOld, 1, 0)
+	if entries := chain.ValidationCacheStats().Entries; entries != 2 {
+		t.Fatalf("Cache entries: got %d, want 2", entries)
+	}
+
+	// Ensure the valid block with the same hash as the tampered one is
+	// validated and accepted rather than rejected with the cached outcome.
+	_, isOrphan, err := chain.ProcessBlock(main1, blockchain.BFNone)
+	if err != nil || isOrphan {
+		t.Fatalf("ProcessBlock valid block: got orphan %v, error %v",
+			isOrphan, err)
+	}
+	if stats := chain.ValidationCacheStats(); stats.Hits != 2 {
+		t.Fatalf("Cache hits after valid block: got %d, want 2",
+			stats.Hits)
+	}
+
+	// Ensure the contextual failure is validated again now that the tip
+	// changed.
+	processBad("too old after tip change", tooOld,
+		blockchain.ErrTimeTooOld, 0, 1)
+	processBad("too old after tip change again", tooOld,
+		blockchain.ErrTimeTooOld, 1, 0)
+}
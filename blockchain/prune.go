@@ -0,0 +1,154 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+)
+
+// pruneHeightKeyName is the name of the db key used to store the height of the
+// lowest main chain block whose spend journal entry was not removed by pruning.
+var pruneHeightKeyName = []byte("pruneheight")
+
+// BlockPrunedError identifies a request for the data of a block which was
+// pruned.  The header of the block remains available.
+type BlockPrunedError struct {
+	Hash chainhash.Hash // Hash of the pruned block
+	Err  error          // Underlying database error
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e BlockPrunedError) Error() string {
+	return fmt.Sprintf("the data of block %v was pruned", e.Hash)
+}
+
+// Unwrap returns the underlying database error.
+func (e BlockPrunedError) Unwrap() error {
+	return e.Err
+}
+
+// convertPrunedErr returns a BlockPrunedError for the block with the passed
+// hash when the passed error reports the data of the block is no longer
+// stored, and the passed error otherwise.
+func convertPrunedErr(hash *chainhash.Hash, err error) error {
+	if dbErr, ok := err.(database.Error); ok &&
+		dbErr.ErrorCode == database.ErrBlockPruned {
+
+		return BlockPrunedError{Hash: *hash, Err: err}
+	}
+	return err
+}
+
+// checkReorgDepth returns a rule error when the passed number of blocks can't
+// be disconnected from the end of the main chain since they reach deeper than
+// the prune depth, below which the data of the blocks needed to disconnect them
+// may no longer be stored.  It is checked before anything is disconnected so a
+// reorganization which can't be completed leaves the chain untouched.
+func (b *BlockChain) checkReorgDepth(numDetach int) error {
+	if b.pruneDepth == 0 || numDetach <= int(b.pruneDepth) {
+		return nil
+	}
+	str := fmt.Sprintf("reorganization would disconnect %d blocks, which "+
+		"is deeper than the prune depth of %d blocks", numDetach,
+		b.pruneDepth)
+	return ruleError(ErrReorgTooDeep, str)
+}
+
+// dbFetchPruneHeight uses an existing database transaction to load the height
+// of the lowest main chain block whose spend journal entry may still exist
+// since the chain was pruned below it.  It is zero for chains which were never
+// pruned.
+func dbFetchPruneHeight(dbTx database.Tx) (uint32, error) {
+	serialized := dbTx.Metadata().Get(pruneHeightKeyName)
+	if serialized == nil {
+		return 0, nil
+	}
+	if len(serialized) != 4 {
+		return 0, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt prune height",
+		}
+	}
+	return byteOrder.Uint32(serialized), nil
+}
+
+// dbPutPruneHeight uses an existing database transaction to record the passed
+// prune height.
+func dbPutPruneHeight(dbTx database.Tx, height uint32) error {
+	serialized := make([]byte, 4)
+	byteOrder.PutUint32(serialized, height)
+	return dbTx.Metadata().Put(pruneHeightKeyName, serialized)
+}
+
+// pruneChain removes the spend journal entries and the stored data of the main
+// chain blocks which are deeper than the prune depth below the best block.
+//
+// The spend journal entries are only needed to disconnect their blocks, which
+// is never done below the prune depth.  They are removed from the recorded
+// prune height on, so the entries of blocks which were connected while pruning
+// was disabled are removed as well.
+//
+// The data of the blocks which were stored before the main chain block at the
+// prune depth is removed.  Every block which may be disconnected or connected
+// by a reorganization within the prune depth descends from that block, so it
+// was stored after it and is kept.
+//
+// It must not be called while a reorganization is in progress since the
+// blocks it disconnected must remain available until it is completed.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) pruneChain() error {
+	if b.pruneDepth == 0 || b.readOnly || b.bestNode.height <= b.pruneDepth {
+		return nil
+	}
+	keepHeight := b.bestNode.height - b.pruneDepth
+
+	var keepHash *chainhash.Hash
+	err := b.db.Update(func(dbTx database.Tx) error {
+		pruneHeight, err := dbFetchPruneHeight(dbTx)
+		if err != nil {
+			return err
+		}
+		for height := pruneHeight; height < keepHeight; height++ {
+			hash, err := dbFetchHashByHeight(dbTx, height)
+			if isNotInMainChainErr(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := dbRemoveSpendJournalEntry(dbTx, hash); err != nil {
+				return err
+			}
+		}
+		if pruneHeight < keepHeight {
+			if err := dbPutPruneHeight(dbTx, keepHeight); err != nil {
+				return err
+			}
+		}
+
+		keepHash, err = dbFetchHashByHeight(dbTx, keepHeight)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return b.db.(database.Pruner).PruneBlocks(keepHash)
+}
+
+// maybePruneChain prunes the chain after the best block changed when pruning
+// is enabled.  Failing to prune doesn't affect the chain, so errors are only
+// logged and pruning is attempted again once the next block is connected.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) maybePruneChain() {
+	if err := b.pruneChain(); err != nil {
+		log.Warnf("Unable to prune the chain below height %d: %v",
+			b.bestNode.height, err)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+)
+
+// TestPruneDepth ensures a chain which prunes aggressively reports the blocks
+// deeper than the prune depth as pruned while keeping their headers, keeps
+// extending and reorganizing within the prune depth, and rejects deeper
+// reorganizations without changing the main chain.
+func TestPruneDepth(t *testing.T) {
+	const pruneDepth = 4
+	params := chaincfg.RegressionNetParams
+
+	// Store the blocks in tiny block files so the files are pruned after a
+	// few blocks.
+	db, teardown := testChainDB(t, "prunedepth", &params, uint32(1024))
+	defer teardown()
+	chain := newTestChain(t, db, &params, &blockchain.Config{PruneDepth: pruneDepth})
+	extend := func(prev *provautil.Block, fork byte, n int) []*provautil.Block {
+		blocks := make([]*provautil.Block, 0, n)
+		for i := 0; i < n; i++ {
+			block := forkBlock(t, &params, prev.MsgBlock(), fork)
+			_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock(%v): %v", block.Hash(), err)
+			}
+			blocks = append(blocks, block)
+			prev = block
+		}
+		return blocks
+	}
+
+	// checkPruned ensures the main chain blocks deeper than the prune depth
+	// are reported as pruned from the oldest block on while the headers of
+	// all blocks remain available, and that the blocks within the prune
+	// depth are available.
+	checkPruned := func(desc string, minPruned uint32) {
+		best := chain.BestSnapshot()
+		for height := uint32(1); height <= best.Height; height++ {
+			hash, err := chain.BlockHashByHeight(height)
+			if err != nil {
+				t.Fatalf("%s: BlockHashByHeight(%d): %v", desc,
+					height, err)
+			}
+			if _, err := chain.FetchHeader(hash); err != nil {
+				t.Fatalf("%s: FetchHeader(%d): %v", desc, height,
+					err)
+			}
+			_, err = chain.BlockByHeight(height)
+			if height+pruneDepth >= best.Height {
+				if err != nil {
+					t.Fatalf("%s: BlockByHeight(%d) within the "+
+						"prune depth: %v", desc, height, err)
+				}
+				continue
+			}
+			var pruneErr blockchain.BlockPrunedError
+			if height <= minPruned && (!errors.As(err, &pruneErr) ||
+				pruneErr.Hash != *hash) {
+
+				t.Fatalf("%s: BlockByHeight(%d): got error %v, "+
+					"want BlockPrunedError", desc, height, err)
+			}
+			_, err = chain.BlockByHash(hash)
+			if height <= minPruned && !errors.As(err, &pruneErr) {
+				t.Fatalf("%s: BlockByHash(%d): got error %v, "+
+					"want BlockPrunedError", desc, height, err)
+			}
+		}
+	}
+
+	// Build a main chain a which is long enough to prune its first blocks.
+	genesis := provautil.NewBlock(params.GenesisBlock)
+	a := extend(genesis, 'a', 20)
+	checkPruned("extended", 10)
+
+	// A side chain b which forks within the prune depth becomes the main
+	// chain once it has more work.
+	b := extend(a[17], 'b', 3)
+	if best := chain.BestSnapshot(); *best.Hash != *b[2].Hash() {
+		t.Fatalf("got best block %v after a shallow reorganization, "+
+			"want %v", best.Hash, b[2].Hash())
+	}
+	b = append(b, extend(b[2], 'b', 4)...)
+	checkPruned("reorganized", 15)
+
+	// A side chain c which forks deeper than the prune depth is stored, but
+	// making it the main chain is rejected.
+	c := extend(a[15], 'c', 9)
+	tip := forkBlock(t, &params, c[8].MsgBlock(), 'c')
+	_, _, err := chain.ProcessBlock(tip, blockchain.BFNone)
+	if !blockchain.IsErrorCode(err, blockchain.ErrReorgTooDeep) {
+		t.Fatalf("ProcessBlock of a deep reorganization: got error %v, "+
+			"want ErrReorgTooDeep", err)
+	}
+	if best := chain.BestSnapshot(); *best.Hash != *b[6].Hash() {
+		t.Fatalf("got best block %v after a rejected reorganization, "+
+			"want %v", best.Hash, b[6].Hash())
+	}
+	err = chain.InvalidateBlock(a[15].Hash())
+	if !blockchain.IsErrorCode(err, blockchain.ErrReorgTooDeep) {
+		t.Fatalf("InvalidateBlock of a deep block: got error %v, want "+
+			"ErrReorgTooDeep", err)
+	}
+
+	// The main chain keeps extending after a restart.
+	chain = newTestChain(t, db, &params, &blockchain.Config{PruneDepth: pruneDepth})
+	extend(b[6], 'b', 3)
+	checkPruned("restarted", 20)
+}
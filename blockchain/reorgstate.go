@@ -0,0 +1,348 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"container/list"
+	"fmt"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+)
+
+// -----------------------------------------------------------------------------
+// The reorganization state records the blocks of a reorganization of the main
+// chain while it is in progress.  A reorganization disconnects and connects its
+// blocks in separate database transactions, so a crash in between leaves the
+// main chain on a block between the old and the new best block.  The state is
+// stored before the first block is disconnected, marking the beginning of the
+// reorganization, and removed once the last block is connected, marking its
+// end.  Finding it at startup means the reorganization was interrupted.
+//
+// The serialized format is:
+//
+//   <fork hash><num detach><detach hashes><num attach><attach hashes>
+//
+//   Field             Type             Size
+//   fork hash         chainhash.Hash   chainhash.HashSize
+//   num detach        uint32           4 bytes
+//   detach hashes     chainhash.Hash   num detach * chainhash.HashSize
+//   num attach        uint32           4 bytes
+//   attach hashes     chainhash.Hash   num attach * chainhash.HashSize
+//
+// The detached blocks are ordered from the old best block down to the fork
+// point, and the attached blocks from the fork point up to the new best block.
+// -----------------------------------------------------------------------------
+
+// reorgState represents the blocks of a reorganization of the main chain which
+// is stored in the database while the reorganization is in progress.
+type reorgState struct {
+	fork   chainhash.Hash
+	detach []chainhash.Hash
+	attach []chainhash.Hash
+}
+
+// newReorgState returns the reorganization state for the passed lists of
+// nodes to detach and attach, which must be in the order expected by
+// reorganizeChain.
+func newReorgState(detachNodes, attachNodes *list.List) *reorgState {
+	state := &reorgState{
+		fork:   *attachNodes.Front().Value.(*blockNode).parentHash,
+		detach: make([]chainhash.Hash, 0, detachNodes.Len()),
+		attach: make([]chainhash.Hash, 0, attachNodes.Len()),
+	}
+	for e := detachNodes.Front(); e != nil; e = e.Next() {
+		state.detach = append(state.detach, *e.Value.(*blockNode).hash)
+	}
+	for e := attachNodes.Front(); e != nil; e = e.Next() {
+		state.attach = append(state.attach, *e.Value.(*blockNode).hash)
+	}
+	return state
+}
+
+// serializeReorgState returns the serialization of the passed reorganization
+// state.
+func serializeReorgState(state *reorgState) []byte {
+	numHashes := 1 + len(state.detach) + len(state.attach)
+	serialized := make([]byte, numHashes*chainhash.HashSize+8)
+	offset := copy(serialized, state.fork[:])
+	for _, hashes := range [][]chainhash.Hash{state.detach, state.attach} {
+		byteOrder.PutUint32(serialized[offset:], uint32(len(hashes)))
+		offset += 4
+		for i := range hashes {
+			offset += copy(serialized[offset:], hashes[i][:])
+		}
+	}
+	return serialized
+}
+
+// deserializeReorgState deserializes the passed serialized reorganization
+// state.
+func deserializeReorgState(serialized []byte) (*reorgState, error) {
+	corruptErr := database.Error{
+		ErrorCode:   database.ErrCorruption,
+		Description: "corrupt reorganization state",
+	}
+	if len(serialized) < chainhash.HashSize {
+		return nil, corruptErr
+	}
+	state := &reorgState{}
+	offset := copy(state.fork[:], serialized)
+	for _, hashes := range []*[]chainhash.Hash{&state.detach, &state.attach} {
+		if len(serialized[offset:]) < 4 {
+			return nil, corruptErr
+		}
+		numHashes := int(byteOrder.Uint32(serialized[offset:]))
+		offset += 4
+		if numHashes == 0 ||
+			len(serialized[offset:]) < numHashes*chainhash.HashSize {
+
+			return nil, corruptErr
+		}
+		*hashes = make([]chainhash.Hash, numHashes)
+		for i := range *hashes {
+			offset += copy((*hashes)[i][:], serialized[offset:])
+		}
+	}
+	if offset != len(serialized) {
+		return nil, corruptErr
+	}
+	return state, nil
+}
+
+// dbPutReorgState uses an existing database transaction to store the passed
+// reorganization state, marking the beginning of the reorganization.
+func dbPutReorgState(dbTx database.Tx, state *reorgState) error {
+	return dbTx.Metadata().Put(reorgStateKeyName, serializeReorgState(state))
+}
+
+// dbRemoveReorgState uses an existing database transaction to remove the
+// reorganization state, marking the end of the reorganization.
+func dbRemoveReorgState(dbTx database.Tx) error {
+	return dbTx.Metadata().Delete(reorgStateKeyName)
+}
+
+// dbFetchReorgState uses an existing database transaction to fetch the state
+// of the reorganization in progress.  It returns nil when there is none.
+func dbFetchReorgState(dbTx database.Tx) (*reorgState, error) {
+	serialized := dbTx.Metadata().Get(reorgStateKeyName)
+	if serialized == nil {
+		return nil, nil
+	}
+	return deserializeReorgState(serialized)
+}
+
+// recoverReorganization repairs the main chain when the database holds the
+// state of a reorganization which was interrupted, such as by a power loss
+// between the database transactions which disconnect and connect its blocks.
+// When all of the blocks were connected and only the end of the reorganization
+// wasn't recorded, the reorganization is completed.  Otherwise, the blocks of
+// the new chain which were connected are disconnected using their spend journal
+// entries and the blocks of the old chain which were disconnected are connected
+// again, rolling the main chain back to the best block before the
+// reorganization.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) recoverReorganization() error {
+	var state *reorgState
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		state, err = dbFetchReorgState(dbTx)
+		return err
+	})
+	if err != nil || state == nil {
+		return err
+	}
+
+	oldBest := &state.detach[0]
+	newBest := &state.attach[len(state.attach)-1]
+	log.Warnf("The reorganization of the main chain from %v to %v was "+
+		"interrupted with the best block at %v (height %d)", oldBest,
+		newBest, b.bestNode.hash, b.bestNode.height)
+	if b.readOnly {
+		log.Warnf("Unable to repair the interrupted reorganization in " +
+			"read-only mode")
+		return nil
+	}
+
+	// Only the end of the reorganization is missing when the main chain
+	// ends at the new best block.
+	if b.bestNode.hash.IsEqual(newBest) {
+		err := b.db.Update(dbRemoveReorgState)
+		if err != nil {
+			return err
+		}
+		log.Infof("All of the blocks of the interrupted reorganization "+
+			"were connected, completed it at %v", newBest)
+		return nil
+	}
+
+	// Disconnect the blocks of the new chain which were connected, from
+	// the best block down to the fork point.
+	attached := make(map[chainhash.Hash]struct{}, len(state.attach))
+	for _, hash := range state.attach {
+		attached[hash] = struct{}{}
+	}
+	var numDisconnected int
+	for {
+		if _, ok := attached[*b.bestNode.hash]; !ok {
+			break
+		}
+		node := b.bestNode
+		if err := b.recoverDisconnectBlock(node); err != nil {
+			return err
+		}
+		log.Infof("Disconnected block %v (height %d) of the new chain",
+			node.hash, node.height)
+		numDisconnected++
+	}
+
+	// Find the blocks of the old chain which were disconnected.  They are
+	// the blocks after the best block up to the old best block.
+	oldChain := make([]chainhash.Hash, 0, len(state.detach))
+	for i := len(state.detach) - 1; i >= 0; i-- {
+		oldChain = append(oldChain, state.detach[i])
+	}
+	reconnect := -1
+	if b.bestNode.hash.IsEqual(&state.fork) {
+		reconnect = 0
+	}
+	for i := range oldChain {
+		if b.bestNode.hash.IsEqual(&oldChain[i]) {
+			reconnect = i + 1
+		}
+	}
+	if reconnect < 0 {
+		if numDisconnected != 0 {
+			str := fmt.Sprintf("best block %v after disconnecting "+
+				"the new chain is not part of the old chain",
+				b.bestNode.hash)
+			return assertError(str)
+		}
+
+		// The main chain moved on since the reorganization was
+		// interrupted, so there is nothing left to repair.
+		log.Warnf("The best block is not part of the interrupted " +
+			"reorganization, leaving the main chain as is")
+		return b.db.Update(dbRemoveReorgState)
+	}
+
+	// Connect the blocks of the old chain again.
+	for i := range oldChain[reconnect:] {
+		hash := &oldChain[reconnect+i]
+		if err := b.recoverConnectBlock(hash); err != nil {
+			return err
+		}
+		log.Infof("Reconnected block %v (height %d) of the old chain",
+			hash, b.bestNode.height)
+	}
+
+	err = b.db.Update(dbRemoveReorgState)
+	if err != nil {
+		return err
+	}
+	log.Infof("Rolled back the interrupted reorganization by "+
+		"disconnecting %d blocks and reconnecting %d blocks, the best "+
+		"block is %v (height %d)", numDisconnected,
+		len(oldChain)-reconnect, b.bestNode.hash, b.bestNode.height)
+	return nil
+}
+
+// recoverDisconnectBlock disconnects the passed node, which must be the end of
+// the main chain, using the spend journal entry of its block.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) recoverDisconnectBlock(node *blockNode) error {
+	var block *provautil.Block
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		block, err = dbFetchBlockByHash(dbTx, b.chainParams, node.hash)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	utxoView := NewUtxoViewpoint()
+	utxoView.SetBestHash(node.hash)
+	err = utxoView.fetchInputUtxos(b.db, block)
+	if err != nil {
+		return err
+	}
+	var stxos []spentTxOut
+	err = b.db.View(func(dbTx database.Tx) error {
+		stxos, err = dbFetchSpendJournalEntry(dbTx, block, utxoView)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = utxoView.disconnectTransactions(block, stxos)
+	if err != nil {
+		return err
+	}
+	keyView := NewKeyViewpoint()
+	keyView.SetAdminState(b.AdminState())
+	err = keyView.disconnectTransactions(block)
+	if err != nil {
+		return err
+	}
+
+	return b.disconnectBlock(node, block, utxoView, keyView)
+}
+
+// recoverConnectBlock connects the stored block with the passed hash, which
+// must extend the main chain, to the main chain.  The block is not validated
+// since it was part of the main chain before.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) recoverConnectBlock(hash *chainhash.Hash) error {
+	var block *provautil.Block
+	err := b.db.View(func(dbTx database.Tx) error {
+		blockBytes, err := dbTx.FetchBlock(hash)
+		if err != nil {
+			return err
+		}
+		block, err = provautil.NewBlockFromBytesEncoding(blockBytes,
+			b.chainParams.TxEncoding())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	header := &block.MsgBlock().Header
+	block.SetHeight(header.Height)
+
+	prevNode := b.bestNode
+	node := newBlockNode(header, hash)
+	node.parent = prevNode
+	node.height = header.Height
+	node.workSum.Add(prevNode.workSum, node.workSum)
+
+	utxoView := NewUtxoViewpoint()
+	utxoView.SetBestHash(prevNode.hash)
+	err = utxoView.fetchInputUtxos(b.db, block)
+	if err != nil {
+		return err
+	}
+	stxos := make([]spentTxOut, 0, countSpentOutputs(block))
+	err = utxoView.connectTransactions(block, &stxos)
+	if err != nil {
+		return err
+	}
+	keyView := NewKeyViewpoint()
+	keyView.SetAdminState(b.AdminState())
+	keyView.connectTransactions(block)
+
+	err = b.connectBlock(node, block, utxoView, keyView, stxos)
+	if err != nil {
+		return err
+	}
+	b.indexLock.Lock()
+	prevNode.children = append(prevNode.children, node)
+	b.indexLock.Unlock()
+	return nil
+}
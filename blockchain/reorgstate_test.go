@@ -0,0 +1,222 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// errInjectedCrash is the error returned by a crashingDB in place of the commit
+// it fails.
+var errInjectedCrash = errors.New("injected crash")
+
+// crashingDB wraps a database to simulate a crash after a number of commits.
+// Once armed, it counts the managed read-write transactions and fails the one
+// after the allowed number of commits without running it, as if the process
+// was killed before it was committed.
+type crashingDB struct {
+	database.DB
+	armed   bool
+	allowed int
+	commits int
+}
+
+// Update counts the commits once the database is armed and fails the commit
+// after the allowed number of commits.  It is part of the database.DB interface
+// implementation.
+func (db *crashingDB) Update(fn func(tx database.Tx) error) error {
+	if !db.armed {
+		return db.DB.Update(fn)
+	}
+	if db.allowed >= 0 && db.commits == db.allowed {
+		return errInjectedCrash
+	}
+	err := db.DB.Update(fn)
+	if err == nil {
+		db.commits++
+	}
+	return err
+}
+
+// chainStateDump returns a description of the best block, admin state and utxo
+// set of the passed chain which is used to compare chain states.
+func chainStateDump(chain *blockchain.BlockChain) (string, error) {
+	var utxos []string
+	err := chain.ForEachUtxoContext(context.Background(),
+		func(txHash *chainhash.Hash, entry *blockchain.UtxoEntry) error {
+			for _, index := range entry.UnspentOutputIndexes() {
+				utxos = append(utxos, fmt.Sprintf("%v:%d:%d:%d:%x",
+					txHash, index, entry.BlockHeight(),
+					entry.AmountByIndex(index),
+					entry.PkScriptByIndex(index)))
+			}
+			return nil
+		})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(utxos)
+
+	var buf bytes.Buffer
+	best := chain.BestSnapshot()
+	fmt.Fprintf(&buf, "best %v height %d txns %d\n", best.Hash, best.Height,
+		best.TotalTxns)
+	fmt.Fprintf(&buf, "admin %x\n", chain.DumpAdminState())
+	for _, utxo := range utxos {
+		fmt.Fprintf(&buf, "utxo %s\n", utxo)
+	}
+	return buf.String(), nil
+}
+
+// TestReorganizationRecovery ensures a reorganization which is interrupted
+// after any number of its database commits is repaired when the chain is
+// loaded again, rolling back to the old best chain unless all of the blocks of
+// the new best chain were connected.
+func TestReorganizationRecovery(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+
+	// Create a main chain of 3 blocks and a side chain of 4 blocks from the
+	// genesis block, each of which adds a different provision key in its
+	// first block, so the reorganization detaches 3 blocks and attaches 4.
+	// The chains are different forks so none of the transactions of the
+	// side chain are shared with the main chain.
+	buildChain := func(fork byte, numBlocks int) []*provautil.Block {
+		privKey, err := btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			t.Fatalf("Failed to create private key: %v", err)
+		}
+		adminTx, err := multiChainAdminTx(&params, privKey.PubKey())
+		if err != nil {
+			t.Fatalf("Failed to create admin tx: %v", err)
+		}
+		var blocks []*provautil.Block
+		prev := params.GenesisBlock
+		for i := 0; i < numBlocks; i++ {
+			var txns []*wire.MsgTx
+			if i == 0 {
+				txns = append(txns, adminTx)
+			}
+			block := forkBlock(t, &params, prev, fork, txns...)
+			blocks = append(blocks, block)
+			prev = block.MsgBlock()
+		}
+		return blocks
+	}
+	mainBlocks := buildChain('m', 3)
+	sideBlocks := buildChain('s', 4)
+
+	// run processes the blocks up to the reorganization on a new database
+	// and then the block which triggers it with the database crashing after
+	// the passed number of commits, or not at all when it is negative.  It
+	// returns the chain states before and after the reorganization, the
+	// number of commits, and the database along with its teardown function.
+	run := func(name string, allowed int) (string, string, int, database.DB, func()) {
+		db, teardown := testChainDB(t, "reorgrecovery", &params)
+		crashDB := &crashingDB{DB: db, allowed: allowed}
+		chain := newTestChain(t, crashDB, &params, nil)
+		chain.TstSetCoinbaseMaturity(1)
+
+		blocks := append(mainBlocks, sideBlocks[:len(sideBlocks)-1]...)
+		for i, block := range blocks {
+			_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+			if err != nil {
+				teardown()
+				t.Fatalf("%s: ProcessBlock #%d: %v", name, i, err)
+			}
+		}
+		oldState, err := chainStateDump(chain)
+		if err != nil {
+			teardown()
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		crashDB.armed = true
+		isMainChain, _, err := chain.ProcessBlock(sideBlocks[len(sideBlocks)-1],
+			blockchain.BFNone)
+		crashDB.armed = false
+		if allowed < 0 {
+			if err != nil || !isMainChain {
+				teardown()
+				t.Fatalf("%s: reorganization: got main chain %v, "+
+					"err %v", name, isMainChain, err)
+			}
+			newState, err := chainStateDump(chain)
+			if err != nil {
+				teardown()
+				t.Fatalf("%s: %v", name, err)
+			}
+			return oldState, newState, crashDB.commits, db, teardown
+		}
+		if err == nil {
+			teardown()
+			t.Fatalf("%s: reorganization: unexpected success", name)
+		}
+		return oldState, "", crashDB.commits, db, teardown
+	}
+
+	// restart loads the chain from the passed database and returns its
+	// state.
+	restart := func(name string, db database.DB) string {
+		chain := newTestChain(t, db, &params, nil)
+		state, err := chainStateDump(chain)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return state
+	}
+
+	// Run the reorganization without crashing to find the chain states
+	// before and after it and the number of commits it takes.
+	oldState, newState, numCommits, db, teardown := run("reference", -1)
+	if got := restart("reference", db); got != newState {
+		t.Errorf("reference: got state after restart\n%s\nwant\n%s",
+			got, newState)
+	}
+	teardown()
+	if oldState == newState {
+		t.Fatalf("reference: reorganization did not change the state")
+	}
+
+	// Crash after every number of commits.  Only a crash of the last
+	// commit, which marks the end of the reorganization, leaves all of the
+	// blocks of the new best chain connected.
+	for allowed := 0; allowed < numCommits; allowed++ {
+		name := fmt.Sprintf("crash after %d commits", allowed)
+		gotOldState, _, _, db, teardown := run(
+			fmt.Sprintf("crash%d", allowed), allowed)
+		if gotOldState != oldState {
+			t.Errorf("%s: got state before reorganization\n%s\n"+
+				"want\n%s", name, gotOldState, oldState)
+		}
+		want := oldState
+		if allowed == numCommits-1 {
+			want = newState
+		}
+		if got := restart(name, db); got != want {
+			t.Errorf("%s: got state after recovery\n%s\nwant\n%s",
+				name, got, want)
+		}
+
+		// The chain is loaded as is once it was repaired.
+		if got := restart(name, db); got != want {
+			t.Errorf("%s: got state after second restart\n%s\n"+
+				"want\n%s", name, got, want)
+		}
+		teardown()
+	}
+}
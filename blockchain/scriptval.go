@@ -7,13 +7,21 @@ package blockchain
 
 import (
 	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
-	"math"
-	"runtime"
 )
 
+// scriptValBatchSize is the number of transaction inputs of a block whose
+// scripts are validated between the points at which validation may be
+// interrupted.
+const scriptValBatchSize = 2000
+
 // txValidateItem holds a transaction along with which input to validate.
 type txValidateItem struct {
 	txInIndex int                   // the index of the input to be validated
@@ -23,235 +31,215 @@ type txValidateItem struct {
 }
 
 // txValidator provides a type which asynchronously validates transaction
-// inputs.  It provides several channels for communication and a processing
-// function that is intended to be in run multiple goroutines.
+// inputs.  It provides a processing function that is intended to be run in
+// multiple goroutines and a quit channel which is closed to stop them when an
+// input fails validation.
 type txValidator struct {
-	validateChan chan *txValidateItem
-	quitChan     chan struct{}
-	resultChan   chan error
-	utxoView     *UtxoViewpoint
-	keyView      *KeyViewpoint
-	flags        txscript.ScriptFlags
-	sigCache     *txscript.SigCache
-	hashCache    *txscript.HashCache
+	quitChan  chan struct{}
+	utxoView  *UtxoViewpoint
+	keyView   *KeyViewpoint
+	flags     txscript.ScriptFlags
+	sigCache  *txscript.SigCache
+	hashCache *txscript.HashCache
+	workers   int
 }
 
-// sendResult sends the result of a script pair validation on the internal
-// result channel while respecting the quit channel.  The allows orderly
-// shutdown when the validation process is aborted early due to a validation
-// error in one of the other goroutines.
-func (v *txValidator) sendResult(result error) {
-	select {
-	case v.resultChan <- result:
-	case <-v.quitChan:
+// scriptInputError creates a RuleError for the passed input which failed
+// script validation.  The description is prefixed with the spending
+// transaction and the input index so the failed input is identified.
+func scriptInputError(c ErrorCode, txVI *txValidateItem, desc string, err error) RuleError {
+	txIn := txVI.txIn
+	str := fmt.Sprintf("transaction %v input %d: %s", txVI.tx.Hash(),
+		txVI.txInIndex, desc)
+	return RuleError{
+		ErrorCode:   c,
+		Description: str,
+		Input: &TxInputRef{
+			TxHash:    *txVI.tx.Hash(),
+			TxInIndex: txVI.txInIndex,
+			PrevOut:   txIn.PreviousOutPoint,
+		},
+		Err: err,
 	}
 }
 
-// validateHandler consumes items to validate from the internal validate channel
-// and returns the result of the validation on the internal result channel. It
-// must be run as a goroutine.
-func (v *txValidator) validateHandler() {
-out:
-	for {
-		select {
-		case txVI := <-v.validateChan:
-			// Ensure the referenced input transaction is available.
-			txIn := txVI.txIn
-			originTxHash := &txIn.PreviousOutPoint.Hash
-			originTxIndex := txIn.PreviousOutPoint.Index
-			txEntry := v.utxoView.LookupEntry(originTxHash)
-			if txEntry == nil {
-				str := fmt.Sprintf("unable to find input "+
-					"transaction %v referenced from "+
-					"transaction %v", originTxHash,
-					txVI.tx.Hash())
-				err := ruleError(ErrMissingTx, str)
-				v.sendResult(err)
-				break out
-			}
-
-			// Ensure the referenced input transaction public key
-			// script is available.
-			pkScript := txEntry.PkScriptByIndex(originTxIndex)
-			if pkScript == nil {
-				str := fmt.Sprintf("unable to find unspent "+
-					"output %v script referenced from "+
-					"transaction %s:%d",
-					txIn.PreviousOutPoint, txVI.tx.Hash(),
-					txVI.txInIndex)
-				err := ruleError(ErrBadTxInput, str)
-				v.sendResult(err)
-				break out
-			}
-
-			// Before passing the script to the VM, we check whether it is an Prova script.
-			pops, err := txscript.ParseScript(pkScript)
-			if err != nil {
-				str := fmt.Sprintf("failed to parse script %s: %v", originTxHash, err)
-				err := ruleError(ErrScriptMalformed, str)
-				v.sendResult(err)
-				break out
-			}
-			// If script is Prova script, we replace all keyIDs with pubKeyHashes.
-			if txscript.TypeOfScript(pops) == txscript.ProvaTy {
-				keyIDs, err := txscript.ExtractKeyIDs(pops)
-				if err != nil {
-					str := fmt.Sprintf("failed to extract keyIDs %s: %v", originTxHash, err)
-					err := ruleError(ErrScriptMalformed, str)
-					v.sendResult(err)
-					break out
-				}
-				keyIdMap := v.keyView.LookupKeyIDs(keyIDs)
-				err = txscript.ReplaceKeyIDs(pops, keyIdMap)
-				if err != nil {
-					str := fmt.Sprintf("failed to replace keyIDs %v, %v in %s", keyIDs[0], keyIDs[1], originTxHash)
-					err := ruleError(ErrScriptMalformed, str)
-					v.sendResult(err)
-					break out
-				}
-				pkScript, err = txscript.UnparseScript(pops)
-				if err != nil {
-					str := fmt.Sprintf("failed to unparse script %s: %v", originTxHash, err)
-					err := ruleError(ErrScriptMalformed, str)
-					v.sendResult(err)
-					break out
-				}
-			}
+// validateItem validates the scripts of the passed transaction input.
+func (v *txValidator) validateItem(txVI *txValidateItem) error {
+	// Ensure the referenced input transaction is available.
+	txIn := txVI.txIn
+	originTxHash := &txIn.PreviousOutPoint.Hash
+	originTxIndex := txIn.PreviousOutPoint.Index
+	txEntry := v.utxoView.LookupEntry(originTxHash)
+	if txEntry == nil {
+		return txInputError(ErrMissingTx, txVI.tx, txVI.txInIndex,
+			"unknown")
+	}
 
-			// If script is Prova admin script, we replace the threadID with pubKeyHashes.
-			if txscript.TypeOfScript(pops) == txscript.ProvaAdminTy {
-				threadID, err := txscript.ExtractThreadID(pops)
-				if err != nil {
-					str := fmt.Sprintf("failed to extract threadID %s: %v", originTxHash, err)
-					err := ruleError(ErrScriptMalformed, str)
-					v.sendResult(err)
-					break out
-				}
-				keyHashes := v.keyView.GetAdminKeyHashes(threadID)
-				pkScript, err = txscript.ThreadPkScript(keyHashes)
-				if err != nil {
-					str := fmt.Sprintf("failed to replace threadID %s: %v", originTxHash, err)
-					err := ruleError(ErrScriptMalformed, str)
-					v.sendResult(err)
-					break out
-				}
-			}
+	// Ensure the referenced input transaction public key script is
+	// available.
+	pkScript := txEntry.PkScriptByIndex(originTxIndex)
+	if pkScript == nil {
+		return txInputError(ErrBadTxInput, txVI.tx, txVI.txInIndex,
+			"nonexistent")
+	}
 
-			// Create a new script engine for the script pair.
-			sigScript := txIn.SignatureScript
-			inputAmount := txEntry.AmountByIndex(originTxIndex)
-			vm, err := txscript.NewEngine(pkScript, txVI.tx.MsgTx(),
-				txVI.txInIndex, v.flags, v.sigCache, txVI.sigHashes, inputAmount)
-			if err != nil {
-				str := fmt.Sprintf("failed to parse input "+
-					"%s:%d which references output %s:%d - "+
-					"%v (input script bytes %x, prev output "+
-					"script bytes %x)", txVI.tx.Hash(),
-					txVI.txInIndex, originTxHash,
-					originTxIndex, err, sigScript, pkScript)
-				err := ruleError(ErrScriptMalformed, str)
-				v.sendResult(err)
-				break out
-			}
+	// Before passing the script to the VM, we check whether it is an Prova script.
+	pops, err := txscript.ParseScript(pkScript)
+	if err != nil {
+		str := fmt.Sprintf("failed to parse script %s: %v", originTxHash, err)
+		return scriptInputError(ErrScriptMalformed, txVI, str, err)
+	}
+	// If script is Prova script, we replace all keyIDs with pubKeyHashes.
+	if txscript.TypeOfScript(pops) == txscript.ProvaTy {
+		keyIDs, err := txscript.ExtractKeyIDs(pops)
+		if err != nil {
+			str := fmt.Sprintf("failed to extract keyIDs %s: %v", originTxHash, err)
+			return scriptInputError(ErrScriptMalformed, txVI, str, err)
+		}
+		keyIdMap := v.keyView.LookupKeyIDs(keyIDs)
+		err = txscript.ReplaceKeyIDs(pops, keyIdMap)
+		if err != nil {
+			str := fmt.Sprintf("failed to replace keyIDs %v, %v in %s", keyIDs[0], keyIDs[1], originTxHash)
+			return scriptInputError(ErrScriptMalformed, txVI, str, err)
+		}
+		pkScript, err = txscript.UnparseScript(pops)
+		if err != nil {
+			str := fmt.Sprintf("failed to unparse script %s: %v", originTxHash, err)
+			return scriptInputError(ErrScriptMalformed, txVI, str, err)
+		}
+	}
 
-			// Execute the script pair.
-			if err := vm.Execute(); err != nil {
-				str := fmt.Sprintf("failed to validate input "+
-					"%s:%d which references output %s:%d - "+
-					"%v (input script bytes %x, prev output "+
-					"script bytes %x)", txVI.tx.Hash(),
-					txVI.txInIndex, originTxHash,
-					originTxIndex, err, sigScript, pkScript)
-				err := ruleError(ErrScriptValidation, str)
-				v.sendResult(err)
-				break out
-			}
+	// If script is Prova admin script, we replace the threadID with pubKeyHashes.
+	if txscript.TypeOfScript(pops) == txscript.ProvaAdminTy {
+		threadID, err := txscript.ExtractThreadID(pops)
+		if err != nil {
+			str := fmt.Sprintf("failed to extract threadID %s: %v", originTxHash, err)
+			return scriptInputError(ErrScriptMalformed, txVI, str, err)
+		}
+		keyHashes := v.keyView.GetAdminKeyHashes(threadID)
+		pkScript, err = txscript.ThreadPkScript(keyHashes)
+		if err != nil {
+			str := fmt.Sprintf("failed to replace threadID %s: %v", originTxHash, err)
+			return scriptInputError(ErrScriptMalformed, txVI, str, err)
+		}
+	}
 
-			// Validation succeeded.
-			v.sendResult(nil)
+	// Create a new script engine for the script pair.
+	sigScript := txIn.SignatureScript
+	inputAmount := txEntry.AmountByIndex(originTxIndex)
+	version := txEntry.ScriptVersionByIndex(originTxIndex)
+	vm, err := txscript.NewVersionedEngine(version, pkScript,
+		txVI.tx.MsgTx(), txVI.txInIndex, v.flags, v.sigCache,
+		txVI.sigHashes, inputAmount)
+	if err != nil {
+		str := fmt.Sprintf("failed to parse input which references "+
+			"output %s:%d - %v (input script bytes %x, prev output "+
+			"script bytes %x)", originTxHash, originTxIndex, err,
+			sigScript, pkScript)
+		return scriptInputError(ErrScriptMalformed, txVI, str, err)
+	}
 
-		case <-v.quitChan:
-			break out
-		}
+	// Execute the script pair.
+	if err := vm.Execute(); err != nil {
+		str := fmt.Sprintf("failed to validate input which references "+
+			"output %s:%d - %v (input script bytes %x, prev output "+
+			"script bytes %x)", originTxHash, originTxIndex, err,
+			sigScript, pkScript)
+		return scriptInputError(ErrScriptValidation, txVI, str, err)
 	}
+
+	return nil
 }
 
-// Validate validates the scripts for all of the passed transaction inputs using
-// multiple goroutines.
-func (v *txValidator) Validate(items []*txValidateItem) error {
-	if len(items) == 0 {
-		return nil
+// sigVerifyWorkers returns the number of goroutines to validate scripts with
+// for the passed configured number, where zero selects a number based on the
+// number of processor cores.
+func sigVerifyWorkers(workers int) int {
+	if workers > 0 {
+		return workers
 	}
 
 	// Limit the number of goroutines to do script validation based on the
 	// number of processor cores.  This help ensure the system stays
 	// reasonably responsive under heavy load.
-	maxGoRoutines := runtime.NumCPU() * 3
-	if maxGoRoutines <= 0 {
-		maxGoRoutines = 1
-	}
-	if maxGoRoutines > len(items) {
-		maxGoRoutines = len(items)
+	workers = runtime.NumCPU() * 3
+	if workers <= 0 {
+		workers = 1
 	}
+	return workers
+}
 
-	// Start up validation handlers that are used to asynchronously
-	// validate each transaction input.
-	for i := 0; i < maxGoRoutines; i++ {
-		go v.validateHandler()
+// Validate validates the scripts for all of the passed transaction inputs using
+// multiple goroutines.  The first input to fail validation stops all of the
+// goroutines, so the inputs which haven't been started yet are skipped, and
+// its error is returned.
+func (v *txValidator) Validate(items []*txValidateItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	workers := sigVerifyWorkers(v.workers)
+	if workers > len(items) {
+		workers = len(items)
 	}
 
-	// Validate each of the inputs.  The quit channel is closed when any
-	// errors occur so all processing goroutines exit regardless of which
-	// input had the validation error.
-	numInputs := len(items)
-	currentItem := 0
-	processedItems := 0
-	for processedItems < numInputs {
-		// Only send items while there are still items that need to
-		// be processed.  The select statement will never select a nil
-		// channel.
-		var validateChan chan *txValidateItem
-		var item *txValidateItem
-		if currentItem < numInputs {
-			validateChan = v.validateChan
-			item = items[currentItem]
-		}
-
-		select {
-		case validateChan <- item:
-			currentItem++
-
-		case err := <-v.resultChan:
-			processedItems++
-			if err != nil {
-				close(v.quitChan)
-				return err
+	// Each goroutine takes the next input which hasn't been taken yet
+	// until there are none left or the quit channel is closed due to a
+	// failed input.
+	var (
+		next     int64 = -1
+		firstErr error
+		failOnce sync.Once
+		wg       sync.WaitGroup
+	)
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-v.quitChan:
+					return
+				default:
+				}
+				idx := atomic.AddInt64(&next, 1)
+				if idx >= int64(len(items)) {
+					return
+				}
+				if err := v.validateItem(items[idx]); err != nil {
+					failOnce.Do(func() {
+						firstErr = err
+						close(v.quitChan)
+					})
+					return
+				}
 			}
-		}
+		}()
 	}
+	wg.Wait()
 
-	close(v.quitChan)
-	return nil
+	return firstErr
 }
 
 // newTxValidator returns a new instance of txValidator to be used for
-// validating transaction scripts asynchronously.
-func newTxValidator(utxoView *UtxoViewpoint, keyView *KeyViewpoint, flags txscript.ScriptFlags, sigCache *txscript.SigCache, hashCache *txscript.HashCache) *txValidator {
+// validating transaction scripts asynchronously with the passed number of
+// goroutines, where zero selects a number based on the number of processor
+// cores.
+func newTxValidator(utxoView *UtxoViewpoint, keyView *KeyViewpoint, flags txscript.ScriptFlags, sigCache *txscript.SigCache, hashCache *txscript.HashCache, workers int) *txValidator {
 	return &txValidator{
-		validateChan: make(chan *txValidateItem),
-		quitChan:     make(chan struct{}),
-		resultChan:   make(chan error),
-		utxoView:     utxoView,
-		keyView:      keyView,
-		sigCache:     sigCache,
-		hashCache:    hashCache,
-		flags:        flags,
+		quitChan:  make(chan struct{}),
+		utxoView:  utxoView,
+		keyView:   keyView,
+		sigCache:  sigCache,
+		hashCache: hashCache,
+		flags:     flags,
+		workers:   workers,
 	}
 }
 
 // ValidateTransactionScripts validates the scripts for the passed transaction
-// using multiple goroutines.
-func ValidateTransactionScripts(tx *provautil.Tx, utxoView *UtxoViewpoint, keyView *KeyViewpoint, flags txscript.ScriptFlags, sigCache *txscript.SigCache, hashCache *txscript.HashCache) error {
+// using the passed number of goroutines, where zero selects a number based on
+// the number of processor cores.
+func ValidateTransactionScripts(tx *provautil.Tx, utxoView *UtxoViewpoint, keyView *KeyViewpoint, flags txscript.ScriptFlags, sigCache *txscript.SigCache, hashCache *txscript.HashCache, workers int) error {
 
 	// If the hashcache doesn't yet has the sighash midstate for this
 	// transaction, then we'll compute them now so we can re-use them
@@ -286,13 +274,17 @@ func ValidateTransactionScripts(tx *provautil.Tx, utxoView *UtxoViewpoint, keyVi
 	}
 
 	// Validate all of the inputs.
-	validator := newTxValidator(utxoView, keyView, flags, sigCache, hashCache)
+	validator := newTxValidator(utxoView, keyView, flags, sigCache,
+		hashCache, workers)
 	return validator.Validate(txValItems)
 }
 
 // checkBlockScripts executes and validates the scripts for all transactions in
-// the passed block using multiple goroutines.
-func checkBlockScripts(block *provautil.Block, utxoView *UtxoViewpoint, keyView *KeyViewpoint, scriptFlags txscript.ScriptFlags, sigCache *txscript.SigCache, hashCache *txscript.HashCache) error {
+// the passed block using the passed number of goroutines, where zero selects a
+// number based on the number of processor cores.  The passed interrupt function
+// is called before each batch of inputs is validated, when it is not nil, and
+// validation stops with the error it returns, if any.
+func checkBlockScripts(block *provautil.Block, utxoView *UtxoViewpoint, keyView *KeyViewpoint, scriptFlags txscript.ScriptFlags, sigCache *txscript.SigCache, hashCache *txscript.HashCache, workers int, interrupt func() error) error {
 	// Collect all of the transaction inputs and required information for
 	// validation for all transactions in the block into a single slice.
 	numInputs := 0
@@ -334,7 +326,23 @@ func checkBlockScripts(block *provautil.Block, utxoView *UtxoViewpoint, keyView
 		}
 	}
 
-	// Validate all of the inputs.
-	validator := newTxValidator(utxoView, keyView, scriptFlags, sigCache, hashCache)
-	return validator.Validate(txValItems)
+	// Validate the inputs in batches so the passed interrupt function, when
+	// not nil, can stop validation in between them.
+	for start := 0; start < len(txValItems); start += scriptValBatchSize {
+		if interrupt != nil {
+			if err := interrupt(); err != nil {
+				return err
+			}
+		}
+		end := start + scriptValBatchSize
+		if end > len(txValItems) {
+			end = len(txValItems)
+		}
+		validator := newTxValidator(utxoView, keyView, scriptFlags,
+			sigCache, hashCache, workers)
+		if err := validator.Validate(txValItems[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
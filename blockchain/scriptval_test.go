@@ -8,10 +8,18 @@ package blockchain_test
 import (
 	"fmt"
 	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
 )
 
 // TestCheckBlockScripts ensures that validating the all of the scripts in a
@@ -46,9 +54,289 @@ func CheckBlockScripts(t *testing.T) {
 
 	scriptFlags := txscript.ScriptBip16
 	err = blockchain.TstCheckBlockScripts(blocks[0], utxoView, nil, scriptFlags,
-		nil, nil)
+		nil, nil, 0, nil)
 	if err != nil {
 		t.Errorf("Transaction script validation failed: %v\n", err)
 		return
 	}
 }
+
+// scriptValBlockTxns is the number of transactions of the block created by
+// newScriptValBlock.
+const scriptValBlockTxns = 400
+
+// scriptValBlock is a block full of transactions which each spend a Prova
+// multisig output, along with the views the outputs and their ASP keys are
+// looked up in.
+type scriptValBlock struct {
+	block    *provautil.Block
+	utxoView *blockchain.UtxoViewpoint
+	keyView  *blockchain.KeyViewpoint
+}
+
+// scriptValBlockOnce holds the block created by newScriptValBlock so it is only
+// signed once.
+var scriptValBlockOnce struct {
+	once  sync.Once
+	block *scriptValBlock
+	err   error
+}
+
+// newScriptValBlock returns a block with scriptValBlockTxns transactions which
+// each spend an output paying to a Prova address with the ASP keys of the
+// regression test network.  The block is created on the first call and the
+// same block is returned afterwards.
+func newScriptValBlock() (*scriptValBlock, error) {
+	c := &scriptValBlockOnce
+	c.once.Do(func() {
+		params := &chaincfg.RegressionNetParams
+		pkHash := chainhash.HashB([]byte("scriptval"))[:20]
+		addr, err := provautil.NewAddressProva(pkHash,
+			[]btcec.KeyID{1, 2}, params)
+		if err != nil {
+			c.err = err
+			return
+		}
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			c.err = err
+			return
+		}
+
+		// Create a transaction with an output for each transaction of
+		// the block to spend.
+		const value = 1000
+		prevTx := wire.NewMsgTx(1)
+		for i := 0; i < scriptValBlockTxns; i++ {
+			prevTx.AddTxOut(wire.NewTxOut(value, pkScript))
+		}
+		prevTxHash := prevTx.TxHash()
+
+		lookupKey := func(provautil.Address) ([]txscript.PrivateKey, error) {
+			return multiChainRootKeys, nil
+		}
+		txns := make([]*wire.MsgTx, 0, scriptValBlockTxns)
+		for i := 0; i < scriptValBlockTxns; i++ {
+			tx := wire.NewMsgTx(1)
+			tx.AddTxIn(&wire.TxIn{
+				PreviousOutPoint: *wire.NewOutPoint(&prevTxHash,
+					uint32(i)),
+				Sequence: wire.MaxTxInSequenceNum,
+			})
+			tx.AddTxOut(wire.NewTxOut(value, pkScript))
+			sigScript, err := txscript.SignTxOutput(params, tx, 0,
+				value, pkScript, txscript.SigHashAll,
+				txscript.KeyClosure(lookupKey), nil)
+			if err != nil {
+				c.err = err
+				return
+			}
+			tx.TxIn[0].SignatureScript = sigScript
+			txns = append(txns, tx)
+		}
+
+		utxoView := blockchain.NewUtxoViewpoint()
+		utxoView.AddTxOuts(provautil.NewTx(prevTx), 1)
+		keyView := blockchain.NewKeyViewpoint()
+		keyView.SetKeyIDs(params.ASPKeyIdMap)
+		c.block = &scriptValBlock{
+			block: provautil.NewBlock(&wire.MsgBlock{
+				Transactions: txns,
+			}),
+			utxoView: utxoView,
+			keyView:  keyView,
+		}
+	})
+	return c.block, c.err
+}
+
+// TestCheckBlockScriptsFailure ensures an input which fails script validation
+// in the middle of a block is reported along with the input, and that the
+// remaining inputs of the block are skipped instead of validated.
+func TestCheckBlockScriptsFailure(t *testing.T) {
+	b, err := newScriptValBlock()
+	if err != nil {
+		t.Fatalf("Unable to create block: %v", err)
+	}
+	const workers = 4
+	flags := txscript.StandardVerifyFlags
+
+	// Validate the block of valid transactions for reference.
+	start := time.Now()
+	err = blockchain.TstCheckBlockScripts(b.block, b.utxoView, b.keyView,
+		flags, nil, nil, workers, nil)
+	if err != nil {
+		t.Fatalf("checkBlockScripts: unexpected error: %v", err)
+	}
+	validated := time.Since(start)
+
+	// Invalidate a transaction near the start of the block by replacing its
+	// signature script with the one of the next transaction.
+	badIndex := scriptValBlockTxns / 10
+	txns := make([]*wire.MsgTx, 0, scriptValBlockTxns)
+	for _, tx := range b.block.MsgBlock().Transactions {
+		txns = append(txns, tx)
+	}
+	badTx := txns[badIndex].Copy()
+	badTx.TxIn[0].SignatureScript = txns[badIndex+1].TxIn[0].SignatureScript
+	txns[badIndex] = badTx
+	badBlock := provautil.NewBlock(&wire.MsgBlock{Transactions: txns})
+
+	start = time.Now()
+	err = blockchain.TstCheckBlockScripts(badBlock, b.utxoView, b.keyView,
+		flags, nil, nil, workers, nil)
+	aborted := time.Since(start)
+	rerr, ok := err.(blockchain.RuleError)
+	if !ok || rerr.ErrorCode != blockchain.ErrScriptValidation {
+		t.Fatalf("checkBlockScripts: got error %v, want %v", err,
+			blockchain.ErrScriptValidation)
+	}
+	badTxHash := badTx.TxHash()
+	if rerr.Input == nil || rerr.Input.TxHash != badTxHash ||
+		rerr.Input.TxInIndex != 0 {
+
+		t.Fatalf("checkBlockScripts: got failed input %+v, want input "+
+			"0 of %v", rerr.Input, badTxHash)
+	}
+	wantDesc := fmt.Sprintf("transaction %v input 0", badTxHash)
+	if !strings.HasPrefix(rerr.Description, wantDesc) {
+		t.Fatalf("checkBlockScripts: got description %q, want it to "+
+			"start with %q", rerr.Description, wantDesc)
+	}
+
+	// Validation stops at the failed input a tenth of the way through the
+	// block, so it takes a fraction of the time of validating all of it.
+	if aborted > validated/2 {
+		t.Fatalf("checkBlockScripts took %v to fail at transaction %d "+
+			"of %d, while validating all of them took %v", aborted,
+			badIndex, scriptValBlockTxns, validated)
+	}
+}
+
+// BenchmarkCheckBlockScripts benchmarks validating the scripts of a block full
+// of Prova multisig spends with different numbers of goroutines.
+func BenchmarkCheckBlockScripts(b *testing.B) {
+	block, err := newScriptValBlock()
+	if err != nil {
+		b.Fatalf("Unable to create block: %v", err)
+	}
+	benches := []struct {
+		name    string
+		workers int
+	}{
+		{"1 worker", 1},
+		{"4 workers", 4},
+		{"NumCPU workers", runtime.NumCPU()},
+	}
+	for _, bench := range benches {
+		workers := bench.workers
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				err := blockchain.TstCheckBlockScripts(block.block,
+					block.utxoView, block.keyView,
+					txscript.StandardVerifyFlags, nil, nil,
+					workers, nil)
+				if err != nil {
+					b.Fatalf("checkBlockScripts: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// preVerifyScripts validates the scripts of the transactions of the passed
+// block one at a time with the passed signature cache, like the memory pool
+// does when the transactions are accepted, and returns the cache.
+func preVerifyScripts(b *scriptValBlock) (*txscript.SigCache, error) {
+	sigCache := txscript.NewSigCache(2 * scriptValBlockTxns)
+	hashCache := txscript.NewHashCache(scriptValBlockTxns)
+	for _, tx := range b.block.Transactions() {
+		err := blockchain.ValidateTransactionScripts(tx, b.utxoView,
+			b.keyView, txscript.StandardVerifyFlags, sigCache,
+			hashCache, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sigCache, nil
+}
+
+// TestCheckBlockScriptsSigCache ensures the scripts of a block whose
+// transactions were already verified with a signature cache validate with the
+// cache, and that the cached signatures don't make a signature over another
+// sigHash valid.
+func TestCheckBlockScriptsSigCache(t *testing.T) {
+	b, err := newScriptValBlock()
+	if err != nil {
+		t.Fatalf("Unable to create block: %v", err)
+	}
+	sigCache, err := preVerifyScripts(b)
+	if err != nil {
+		t.Fatalf("ValidateTransactionScripts: unexpected error: %v", err)
+	}
+	flags := txscript.StandardVerifyFlags
+	err = blockchain.TstCheckBlockScripts(b.block, b.utxoView, b.keyView,
+		flags, sigCache, nil, 0, nil)
+	if err != nil {
+		t.Fatalf("checkBlockScripts: unexpected error: %v", err)
+	}
+
+	// Change the output of a verified transaction, which changes its
+	// sigHash, while keeping its cached signatures.
+	const badIndex = 1
+	txns := make([]*wire.MsgTx, 0, scriptValBlockTxns)
+	for _, tx := range b.block.MsgBlock().Transactions {
+		txns = append(txns, tx)
+	}
+	badTx := txns[badIndex].Copy()
+	badTx.TxOut[0].Value--
+	txns[badIndex] = badTx
+	badBlock := provautil.NewBlock(&wire.MsgBlock{Transactions: txns})
+	err = blockchain.TstCheckBlockScripts(badBlock, b.utxoView, b.keyView,
+		flags, sigCache, nil, 0, nil)
+	rerr, ok := err.(blockchain.RuleError)
+	if !ok || rerr.ErrorCode != blockchain.ErrScriptValidation {
+		t.Fatalf("checkBlockScripts: got error %v, want %v", err,
+			blockchain.ErrScriptValidation)
+	}
+	if rerr.Input == nil || rerr.Input.TxHash != badTx.TxHash() {
+		t.Fatalf("checkBlockScripts: got failed input %+v, want input "+
+			"of %v", rerr.Input, badTx.TxHash())
+	}
+}
+
+// BenchmarkCheckBlockScriptsSigCache benchmarks validating the scripts of a
+// block full of Prova multisig spends without a signature cache and with one
+// which holds the signatures of the transactions, like the one shared with the
+// memory pool after it accepted them.
+func BenchmarkCheckBlockScriptsSigCache(b *testing.B) {
+	block, err := newScriptValBlock()
+	if err != nil {
+		b.Fatalf("Unable to create block: %v", err)
+	}
+	sigCache, err := preVerifyScripts(block)
+	if err != nil {
+		b.Fatalf("ValidateTransactionScripts: %v", err)
+	}
+	benches := []struct {
+		name     string
+		sigCache *txscript.SigCache
+	}{
+		{"not verified", nil},
+		{"pre-verified", sigCache},
+	}
+	for _, bench := range benches {
+		sigCache := bench.sigCache
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				err := blockchain.TstCheckBlockScripts(block.block,
+					block.utxoView, block.keyView,
+					txscript.StandardVerifyFlags, sigCache,
+					nil, 0, nil)
+				if err != nil {
+					b.Fatalf("checkBlockScripts: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestScriptVersions ensures outputs with a script version reserved for future
+// upgrades are only allowed when the chain parameters enable script versions,
+// and that such outputs are anyone-can-spend in blocks.
+func TestScriptVersions(t *testing.T) {
+	// The output carries script version 1 and a program which evaluates to
+	// false, so it can only be spent without executing it.  There is no
+	// subsidy on the regression test network, so the outputs have no
+	// value.
+	versionedScript := append([]byte{txscript.OP_1, txscript.OP_DATA_20},
+		make([]byte, 20)...)
+
+	// versionedBlocks returns a block following the genesis block and a
+	// block with a transaction which spends its coinbase to the versioned
+	// output.
+	versionedBlocks := func(params *chaincfg.Params) (*provautil.Block, *provautil.Block) {
+		block, err := multiChainBlock(params, params.GenesisBlock)
+		if err != nil {
+			t.Fatalf("Failed to create block: %v", err)
+		}
+		coinbase := block.MsgBlock().Transactions[0]
+		coinbaseHash := coinbase.TxHash()
+		tx := wire.NewMsgTx(1)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(&coinbaseHash, 0),
+			Sequence:         wire.MaxTxInSequenceNum,
+		})
+		tx.AddTxOut(wire.NewTxOut(0, versionedScript))
+		lookupKey := func(provautil.Address) ([]txscript.PrivateKey, error) {
+			return multiChainRootKeys, nil
+		}
+		sigScript, err := txscript.SignTxOutput(params, tx, 0,
+			coinbase.TxOut[0].Value, coinbase.TxOut[0].PkScript,
+			txscript.SigHashAll, txscript.KeyClosure(lookupKey), nil)
+		if err != nil {
+			t.Fatalf("Failed to sign transaction: %v", err)
+		}
+		tx.TxIn[0].SignatureScript = sigScript
+		versionedBlock, err := multiChainBlock(params, block.MsgBlock(), tx)
+		if err != nil {
+			t.Fatalf("Failed to create block: %v", err)
+		}
+		return block, versionedBlock
+	}
+
+	// Outputs with a script version are invalid when the chain parameters
+	// don't enable script versions.
+	disabledParams := chaincfg.RegressionNetParams
+	disabledParams.ScriptVersions = false
+	chain, teardownFunc, err := chainSetup("scriptversionsdisabled",
+		&disabledParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+	block, versionedBlock := versionedBlocks(&disabledParams)
+	_, _, err = chain.ProcessBlock(block, blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("ProcessBlock: %v", err)
+	}
+	_, _, err = chain.ProcessBlock(versionedBlock, blockchain.BFNone)
+	if rerr, ok := err.(blockchain.RuleError); !ok ||
+		rerr.ErrorCode != blockchain.ErrInvalidTx {
+
+		t.Fatalf("ProcessBlock with script versions disabled: got "+
+			"error %v, want %v", err, blockchain.ErrInvalidTx)
+	}
+
+	params := chaincfg.RegressionNetParams
+	if !params.ScriptVersions {
+		t.Fatalf("script versions are not enabled on %s", params.Name)
+	}
+	chain, teardownFunc, err = chainSetup("scriptversions", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+	block, versionedBlock = versionedBlocks(&params)
+	for _, block := range []*provautil.Block{block, versionedBlock} {
+		_, _, err = chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: %v", err)
+		}
+	}
+
+	// The script version is recorded in the utxo set.
+	versionedTx := versionedBlock.MsgBlock().Transactions[1]
+	versionedHash := versionedTx.TxHash()
+	entry, err := chain.FetchUtxoEntry(&versionedHash)
+	if err != nil || entry == nil {
+		t.Fatalf("Failed to fetch utxo entry of versioned output: %v",
+			err)
+	}
+	if version := entry.ScriptVersionByIndex(0); version != 1 {
+		t.Fatalf("got script version %d of versioned output, want 1",
+			version)
+	}
+
+	// Spend the versioned output without a signature script.
+	spendTx := wire.NewMsgTx(1)
+	spendTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&versionedHash, 0),
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	spendTx.AddTxOut(wire.NewTxOut(0,
+		block.MsgBlock().Transactions[0].TxOut[0].PkScript))
+	spendBlock, err := multiChainBlock(&params, versionedBlock.MsgBlock(),
+		spendTx)
+	if err != nil {
+		t.Fatalf("Failed to create block: %v", err)
+	}
+	isMainChain, _, err := chain.ProcessBlock(spendBlock, blockchain.BFNone)
+	if err != nil || !isMainChain {
+		t.Fatalf("ProcessBlock spending versioned output: got main "+
+			"chain %v, err %v", isMainChain, err)
+	}
+	entry, err = chain.FetchUtxoEntry(&versionedHash)
+	if err != nil || entry != nil {
+		t.Fatalf("versioned output was not spent: %v", err)
+	}
+}
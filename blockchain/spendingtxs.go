@@ -0,0 +1,272 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+var (
+	// spendingTxBucketName is the name of the db bucket used to house the
+	// transaction of the main chain which spent each output, keyed by the
+	// serialized outpoint.  It is only maintained when the chain is
+	// configured to record the spending transactions.
+	spendingTxBucketName = []byte("spendingtxs")
+
+	// spendingTxTipKeyName is the name of the db key used to store the hash
+	// and height of the block up to which the spending transactions are
+	// recorded, which lags behind the main chain while they are not
+	// recorded.
+	spendingTxTipKeyName = []byte("spendingtxtip")
+)
+
+// spendingTxCatchUpBatch is the number of blocks the spending transactions are
+// recorded or removed for in a single database transaction while catching up
+// with the main chain.
+const spendingTxCatchUpBatch = 500
+
+// ErrSpendingTxNotFound is returned by FetchSpendingTx for outpoints which no
+// transaction of the main chain spent, either because they are unspent or
+// because they don't exist.
+var ErrSpendingTxNotFound = errors.New("no transaction of the main chain " +
+	"spent the output")
+
+// spendingTxKey returns the database key of the spending transaction of the
+// passed outpoint, which is the hash of its transaction followed by its index.
+func spendingTxKey(outpoint *wire.OutPoint) []byte {
+	key := make([]byte, chainhash.HashSize+4)
+	copy(key, outpoint.Hash[:])
+	byteOrder.PutUint32(key[chainhash.HashSize:], outpoint.Index)
+	return key
+}
+
+// dbPutSpendingTxTip uses an existing database transaction to store the passed
+// block as the block up to which the spending transactions are recorded.
+func dbPutSpendingTxTip(dbTx database.Tx, hash *chainhash.Hash, height uint32) error {
+	serialized := make([]byte, chainhash.HashSize+4)
+	copy(serialized, hash[:])
+	byteOrder.PutUint32(serialized[chainhash.HashSize:], height)
+	return dbTx.Metadata().Put(spendingTxTipKeyName, serialized)
+}
+
+// dbFetchSpendingTxTip uses an existing database transaction to fetch the hash
+// and height of the block up to which the spending transactions are recorded.
+// It returns a nil hash when they were never recorded.
+func dbFetchSpendingTxTip(dbTx database.Tx) (*chainhash.Hash, uint32, error) {
+	serialized := dbTx.Metadata().Get(spendingTxTipKeyName)
+	if serialized == nil {
+		return nil, 0, nil
+	}
+	if len(serialized) != chainhash.HashSize+4 {
+		return nil, 0, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt spending transaction tip",
+		}
+	}
+	var hash chainhash.Hash
+	copy(hash[:], serialized)
+	return &hash, byteOrder.Uint32(serialized[chainhash.HashSize:]), nil
+}
+
+// dbPutSpendingTxs uses an existing database transaction to record the
+// transactions of the passed block as the spenders of the outputs they spend,
+// and to advance the tip of the spending transactions to the block.
+func dbPutSpendingTxs(dbTx database.Tx, block *provautil.Block) error {
+	bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+		spendingTxBucketName)
+	if err != nil {
+		return err
+	}
+
+	// The database may hold on to the values until the transaction is
+	// committed, so each transaction gets its own.
+	height := block.MsgBlock().Header.Height
+	for _, tx := range block.Transactions() {
+		if IsCoinBase(tx) {
+			continue
+		}
+		value := make([]byte, chainhash.HashSize+4)
+		copy(value, tx.Hash()[:])
+		byteOrder.PutUint32(value[chainhash.HashSize:], height)
+		for _, txIn := range tx.MsgTx().TxIn {
+			key := spendingTxKey(&txIn.PreviousOutPoint)
+			if err := bucket.Put(key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return dbPutSpendingTxTip(dbTx, block.Hash(), height)
+}
+
+// dbRemoveSpendingTxs uses an existing database transaction to remove the
+// spending transactions recorded for the passed block, and to step the tip of
+// the spending transactions back to its parent.
+func dbRemoveSpendingTxs(dbTx database.Tx, block *provautil.Block) error {
+	bucket := dbTx.Metadata().Bucket(spendingTxBucketName)
+	if bucket != nil {
+		for _, tx := range block.Transactions() {
+			if IsCoinBase(tx) {
+				continue
+			}
+			for _, txIn := range tx.MsgTx().TxIn {
+				key := spendingTxKey(&txIn.PreviousOutPoint)
+				if err := bucket.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	header := &block.MsgBlock().Header
+	return dbPutSpendingTxTip(dbTx, &header.PrevBlock, header.Height-1)
+}
+
+// initSpendingTxs catches the recorded spending transactions up with the main
+// chain when the chain is configured to record them.  The transactions of the
+// blocks which left the main chain since they were last recorded are removed
+// first, and then those of the main chain blocks after the tip are recorded,
+// so enabling the option on an existing database records the whole main chain
+// once.  The progress is stored along with each batch, so an interrupted catch
+// up resumes where it left off.
+func (b *BlockChain) initSpendingTxs() error {
+	if !b.spendingTxs {
+		return nil
+	}
+
+	var tipHash *chainhash.Hash
+	var tipHeight uint32
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		tipHash, tipHeight, err = dbFetchSpendingTxTip(dbTx)
+		if err != nil || tipHash != nil {
+			return err
+		}
+		tipHash, err = dbFetchHashByHeight(dbTx, 0)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	best := b.BestSnapshot()
+	if tipHash.IsEqual(best.Hash) {
+		return nil
+	}
+	if b.readOnly {
+		return database.Error{
+			ErrorCode: database.ErrDbReadOnly,
+			Description: fmt.Sprintf("the spending transactions are "+
+				"recorded up to height %d and can't be caught up "+
+				"with the main chain at height %d in read-only "+
+				"mode", tipHeight, best.Height),
+		}
+	}
+
+	// Remove the spending transactions of the blocks which are no longer
+	// part of the main chain.
+	for done := false; !done; {
+		err := b.db.Update(func(dbTx database.Tx) error {
+			for i := 0; i < spendingTxCatchUpBatch; i++ {
+				if dbMainChainHasBlock(dbTx, tipHash) {
+					done = true
+					break
+				}
+				block, err := dbFetchBlockByHash(dbTx,
+					b.chainParams, tipHash)
+				if err != nil {
+					return err
+				}
+				if err := dbRemoveSpendingTxs(dbTx, block); err != nil {
+					return err
+				}
+				header := &block.MsgBlock().Header
+				tipHash, tipHeight = &header.PrevBlock, header.Height-1
+			}
+			return dbPutSpendingTxTip(dbTx, tipHash, tipHeight)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Record the spending transactions of the main chain blocks after the
+	// tip.
+	if tipHeight < best.Height {
+		log.Infof("Recording the spending transactions from height %d "+
+			"to %d.  This might take a while...", tipHeight+1,
+			best.Height)
+	}
+	for tipHeight < best.Height {
+		err := b.db.Update(func(dbTx database.Tx) error {
+			for i := 0; i < spendingTxCatchUpBatch &&
+				tipHeight < best.Height; i++ {
+
+				block, err := dbFetchBlockByHeight(dbTx,
+					b.chainParams, tipHeight+1)
+				if err != nil {
+					return err
+				}
+				if err := dbPutSpendingTxs(dbTx, block); err != nil {
+					return err
+				}
+				tipHeight++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		log.Infof("Recorded the spending transactions up to height %d",
+			tipHeight)
+	}
+	return nil
+}
+
+// FetchSpendingTx returns the hash of the transaction of the main chain which
+// spent the passed outpoint along with the height of its block, such as to find
+// out which transaction a double spend conflicts with.  ErrSpendingTxNotFound
+// is returned for outpoints which are unspent or don't exist.  An error is
+// returned when the chain is not configured to record the spending
+// transactions.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchSpendingTx(outpoint wire.OutPoint) (*chainhash.Hash, int32, error) {
+	if !b.spendingTxs {
+		return nil, 0, errors.New("the spending transactions are not " +
+			"recorded")
+	}
+
+	var txHash chainhash.Hash
+	var height uint32
+	err := b.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(spendingTxBucketName)
+		if bucket == nil {
+			return ErrSpendingTxNotFound
+		}
+		serialized := bucket.Get(spendingTxKey(&outpoint))
+		if serialized == nil {
+			return ErrSpendingTxNotFound
+		}
+		if len(serialized) != chainhash.HashSize+4 {
+			return database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("corrupt spending "+
+					"transaction of %v", outpoint),
+			}
+		}
+		copy(txHash[:], serialized)
+		height = byteOrder.Uint32(serialized[chainhash.HashSize:])
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return &txHash, int32(height), nil
+}
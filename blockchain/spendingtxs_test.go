@@ -0,0 +1,189 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// spendingTx is the transaction which spent an output and the height of its
+// block.
+type spendingTx struct {
+	hash   chainhash.Hash
+	height int32
+}
+
+// TestSpendingTxs ensures the transactions which spent the outputs of the main
+// chain are recorded while the tests generated by the fullblocktests package,
+// which include reorganizations, are processed, and that they are caught up
+// when they are enabled on a database which didn't record them, or didn't
+// while the chain reorganized.
+func TestSpendingTxs(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	tests, err := fullblocktests.GenerateWithParams(&params, false,
+		fullblocktests.DefaultSeed)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	// Each scenario uses its own database, and the chains only record the
+	// spending transactions when created with the recording config.
+	recording := &blockchain.Config{SpendingTxs: true}
+	fullDB, teardown := testChainDB(t, "spendingtxs", &params)
+	defer teardown()
+	catchupDB, teardown := testChainDB(t, "spendingtxs", &params)
+	defer teardown()
+	reorgDB, teardown := testChainDB(t, "spendingtxs", &params)
+	defer teardown()
+
+	// process processes the blocks of the passed tests with the passed
+	// chain.
+	process := func(chain *blockchain.BlockChain, tests [][]fullblocktests.TestInstance) {
+		for _, test := range tests {
+			for _, item := range test {
+				var block *wire.MsgBlock
+				switch item := item.(type) {
+				case fullblocktests.AcceptedBlock:
+					block = item.Block
+				case fullblocktests.RejectedBlock:
+					block = item.Block
+				case fullblocktests.OrphanOrRejectedBlock:
+					block = item.Block
+				default:
+					continue
+				}
+				chain.ProcessBlock(provautil.NewBlock(block),
+					blockchain.BFNone)
+			}
+		}
+	}
+
+	// Process all tests with a chain which records the spending
+	// transactions, noting the first test whose best block is not part of
+	// the resulting main chain.
+	chain := newTestChain(t, fullDB, &params, recording)
+	var bestHashes []*chainhash.Hash
+	for i := range tests {
+		process(chain, tests[i:i+1])
+		bestHashes = append(bestHashes, chain.BestSnapshot().Hash)
+	}
+	reorgTest := -1
+	for i, hash := range bestHashes {
+		if ok, _ := chain.MainChainHasBlock(hash); !ok {
+			reorgTest = i
+			break
+		}
+	}
+	if reorgTest == -1 {
+		t.Fatalf("the tests don't reorganize the chain")
+	}
+
+	// collect returns the transactions which spent the outputs of the main
+	// chain of the passed chain, and the outputs which are unspent,
+	// including those the blocks which were disconnected spent, along
+	// with one which doesn't exist.
+	collect := func(chain *blockchain.BlockChain) (map[wire.OutPoint]spendingTx, []wire.OutPoint) {
+		want := make(map[wire.OutPoint]spendingTx)
+		best := chain.BestSnapshot()
+		for height := uint32(1); height <= best.Height; height++ {
+			block, err := chain.BlockByHeight(height)
+			if err != nil {
+				t.Fatalf("BlockByHeight(%d): %v", height, err)
+			}
+			for _, tx := range block.Transactions() {
+				if blockchain.IsCoinBase(tx) {
+					continue
+				}
+				for _, txIn := range tx.MsgTx().TxIn {
+					want[txIn.PreviousOutPoint] = spendingTx{
+						hash:   *tx.Hash(),
+						height: int32(height),
+					}
+				}
+			}
+		}
+		var unspent []wire.OutPoint
+		err := chain.ForEachUtxo(func(outpoint wire.OutPoint, entry *blockchain.UtxoEntry) error {
+			unspent = append(unspent, outpoint)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ForEachUtxo: %v", err)
+		}
+		if len(want) == 0 || len(unspent) == 0 {
+			t.Fatalf("got %d spent and %d unspent outputs",
+				len(want), len(unspent))
+		}
+		return want, append(unspent, wire.OutPoint{Index: 1})
+	}
+
+	// check ensures the passed chain records the transactions which spent
+	// the outputs of its main chain.
+	check := func(name string, chain *blockchain.BlockChain) {
+		want, unspent := collect(chain)
+		for outpoint, spender := range want {
+			hash, height, err := chain.FetchSpendingTx(outpoint)
+			if err != nil {
+				t.Fatalf("%s: FetchSpendingTx(%v): %v", name,
+					outpoint, err)
+			}
+			if *hash != spender.hash || height != spender.height {
+				t.Fatalf("%s: FetchSpendingTx(%v): got %v at "+
+					"height %d, want %v at height %d", name,
+					outpoint, hash, height, spender.hash,
+					spender.height)
+			}
+		}
+		for _, outpoint := range unspent {
+			_, _, err := chain.FetchSpendingTx(outpoint)
+			if err != blockchain.ErrSpendingTxNotFound {
+				t.Fatalf("%s: FetchSpendingTx(%v) of an unspent "+
+					"output: got %v, want %v", name, outpoint,
+					err, blockchain.ErrSpendingTxNotFound)
+			}
+		}
+	}
+	check("full", chain)
+
+	// The spending transactions are only available when recorded.
+	chain = newTestChain(t, fullDB, &params, nil)
+	_, _, err = chain.FetchSpendingTx(wire.OutPoint{})
+	if err == nil || err == blockchain.ErrSpendingTxNotFound {
+		t.Fatalf("FetchSpendingTx without recording the spending "+
+			"transactions: got %v", err)
+	}
+
+	// Enabling the option on an existing database records the whole main
+	// chain.
+	chain = newTestChain(t, catchupDB, &params, nil)
+	process(chain, tests)
+	best := chain.BestSnapshot()
+	chain = newTestChain(t, catchupDB, &params, recording)
+	if got := chain.BestSnapshot(); *got.Hash != *best.Hash {
+		t.Fatalf("catchup: got best block %v, want %v", got.Hash,
+			best.Hash)
+	}
+	check("catchup", chain)
+
+	// Enabling it again after the chain reorganized away from the blocks
+	// whose spending transactions were recorded while it was disabled
+	// removes those of the disconnected blocks.
+	chain = newTestChain(t, reorgDB, &params, recording)
+	process(chain, tests[:reorgTest+1])
+	recorded := chain.BestSnapshot().Hash
+	chain = newTestChain(t, reorgDB, &params, nil)
+	process(chain, tests[reorgTest+1:])
+	if ok, _ := chain.MainChainHasBlock(recorded); ok {
+		t.Fatalf("reorg: block %v was not disconnected", recorded)
+	}
+	check("reorg", newTestChain(t, reorgDB, &params, recording))
+}
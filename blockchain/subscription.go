@@ -0,0 +1,256 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/bitgo/prova/provautil"
+)
+
+// BlockEvent is a change to the main chain delivered by a BlockSubscription.
+// The type is either NTBlockConnected or NTBlockDisconnected.
+type BlockEvent struct {
+	Type  NotificationType
+	Block *provautil.Block
+}
+
+// BlockSubscription delivers the blocks of the main chain from a start height
+// onward in order, first replaying the blocks already in the chain and then
+// following the blocks connected to it.  Whenever blocks which were delivered
+// are no longer part of the main chain, for example due to a reorganization
+// while the historical blocks are being replayed, their disconnection is
+// delivered before the blocks which replace them, so the delivered events
+// always describe a consistent chain.
+//
+// The subscription never blocks the chain.  Instead it tracks the last block it
+// delivered and catches up with the main chain at the pace the events are
+// received, so a slow receiver only sees the events later, and a receiver which
+// falls behind a reorganization only sees the net change to the main chain.
+type BlockSubscription struct {
+	chain       *BlockChain
+	startHeight uint32
+	events      chan *BlockEvent
+	wake        chan struct{}
+	quit        chan struct{}
+	stopOnce    sync.Once
+	wg          sync.WaitGroup
+
+	// err is the error which stopped the subscription, if any.  It is
+	// protected by errLock.
+	errLock sync.Mutex
+	err     error
+}
+
+// SubscribeBlocks returns a new started subscription to the blocks of the main
+// chain from the passed start height onward.  The events are delivered on a
+// channel which buffers at most the passed number of events.  The start height
+// may be above the current best height, in which case the first event is
+// delivered once the main chain reaches it.  The subscription must be stopped
+// with Stop once it is no longer needed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SubscribeBlocks(startHeight uint32, queueSize int) *BlockSubscription {
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	s := &BlockSubscription{
+		chain:       b,
+		startHeight: startHeight,
+		events:      make(chan *BlockEvent, queueSize),
+		wake:        make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+	}
+
+	b.subscriptionLock.Lock()
+	b.subscriptions[s] = struct{}{}
+	b.subscriptionLock.Unlock()
+
+	s.wg.Add(1)
+	go s.eventHandler()
+	return s
+}
+
+// wakeBlockSubscriptions signals all block subscriptions that the main chain
+// changed.  It never blocks.
+func (b *BlockChain) wakeBlockSubscriptions() {
+	b.subscriptionLock.Lock()
+	for s := range b.subscriptions {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	b.subscriptionLock.Unlock()
+}
+
+// Events returns the channel the events of the subscription are delivered on.
+// The channel is closed once the subscription stops.
+func (s *BlockSubscription) Events() <-chan *BlockEvent {
+	return s.events
+}
+
+// Err returns the error which stopped the subscription, or nil when it is
+// running or was stopped with Stop.
+func (s *BlockSubscription) Err() error {
+	s.errLock.Lock()
+	err := s.err
+	s.errLock.Unlock()
+	return err
+}
+
+// Stop stops the subscription and waits for it to finish.  Events which were
+// not received yet are dropped.  It is safe to call Stop more than once.
+func (s *BlockSubscription) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.quit)
+	})
+	s.wg.Wait()
+}
+
+// send delivers an event for the passed block.  It returns false when the
+// subscription was stopped before the event could be delivered.
+func (s *BlockSubscription) send(typ NotificationType, block *provautil.Block) bool {
+	// The hash of the block is cached on first use, so calculate it
+	// before the block is shared with the receiver.
+	block.Hash()
+
+	select {
+	case s.events <- &BlockEvent{Type: typ, Block: block}:
+		return true
+	case <-s.quit:
+		return false
+	}
+}
+
+// nextEvent delivers the next event needed to bring the passed last delivered
+// block in line with the main chain and returns the new last delivered block.
+// A nil block means no block was delivered since the start height.  It returns
+// false for caughtUp when an event was delivered or the chain changed while it
+// was examined, and true when the last delivered block is the best block or
+// the main chain has not reached the start height yet.
+func (s *BlockSubscription) nextEvent(last *provautil.Block) (*provautil.Block, bool, error) {
+	chain := s.chain
+	best := chain.BestSnapshot()
+
+	// Start with the block at the start height once the main chain
+	// reaches it.
+	if last == nil {
+		if best.Height < s.startHeight {
+			return nil, true, nil
+		}
+		block, err := chain.BlockByHeight(s.startHeight)
+		if err != nil {
+			return nil, false, s.changedSince(best, err)
+		}
+		if !s.send(NTBlockConnected, block) {
+			return nil, false, errSubscriptionStopped
+		}
+		return block, false, nil
+	}
+
+	// Disconnect the last delivered block when it is no longer part of the
+	// main chain.  The delivered blocks are then traced back through its
+	// parent, unless it was the first one delivered.
+	onMainChain, err := chain.MainChainHasBlock(last.Hash())
+	if err != nil {
+		return last, false, err
+	}
+	if !onMainChain {
+		if !s.send(NTBlockDisconnected, last) {
+			return last, false, errSubscriptionStopped
+		}
+		header := &last.MsgBlock().Header
+		if header.Height <= s.startHeight {
+			return nil, false, nil
+		}
+		parent, err := chain.BlockByHash(&header.PrevBlock)
+		if err != nil {
+			return last, false, err
+		}
+		return parent, false, nil
+	}
+
+	// Deliver the block which extends the last delivered block on the main
+	// chain.  The main chain may have changed since it was examined above,
+	// in which case the block fetched at the next height does not build on
+	// the last delivered block and it is examined again.
+	height := last.MsgBlock().Header.Height
+	if height >= best.Height {
+		return last, true, nil
+	}
+	block, err := chain.BlockByHeight(height + 1)
+	if err != nil {
+		return last, false, s.changedSince(best, err)
+	}
+	if block.MsgBlock().Header.PrevBlock != *last.Hash() {
+		return last, false, nil
+	}
+	if !s.send(NTBlockConnected, block) {
+		return last, false, errSubscriptionStopped
+	}
+	return block, false, nil
+}
+
+// changedSince returns nil when the best block changed since the passed best
+// state, so the passed error fetching a block may be the result of a
+// reorganization and the lookup is retried, and the passed error otherwise.
+func (s *BlockSubscription) changedSince(best *BestState, err error) error {
+	if !s.chain.BestSnapshot().Hash.IsEqual(best.Hash) {
+		return nil
+	}
+	return err
+}
+
+// errSubscriptionStopped is used internally to stop the event handler once the
+// subscription is stopped.
+var errSubscriptionStopped = errors.New("block subscription stopped")
+
+// eventHandler delivers the events of the subscription until it is stopped or
+// fails.  It must be run as a goroutine.
+func (s *BlockSubscription) eventHandler() {
+	defer func() {
+		s.chain.subscriptionLock.Lock()
+		delete(s.chain.subscriptions, s)
+		s.chain.subscriptionLock.Unlock()
+		close(s.events)
+		s.wg.Done()
+	}()
+
+	var last *provautil.Block
+	for {
+		select {
+		case <-s.quit:
+			return
+		default:
+		}
+
+		var caughtUp bool
+		var err error
+		last, caughtUp, err = s.nextEvent(last)
+		if err == errSubscriptionStopped {
+			return
+		}
+		if err != nil {
+			log.Errorf("Block subscription from height %d failed: %v",
+				s.startHeight, err)
+			s.errLock.Lock()
+			s.err = err
+			s.errLock.Unlock()
+			return
+		}
+		if !caughtUp {
+			continue
+		}
+
+		// Wait for the main chain to change.
+		select {
+		case <-s.wake:
+		case <-s.quit:
+			return
+		}
+	}
+}
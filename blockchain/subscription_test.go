@@ -0,0 +1,193 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+)
+
+// TestBlockSubscription ensures a block subscription replays the main chain
+// from its start height and follows it afterwards, delivering the disconnection
+// of replayed blocks which are orphaned by a reorganization during the replay.
+func TestBlockSubscription(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	chain, teardownFunc, err := chainSetup("blocksubscription",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Collect the accepted blocks of the generated tests in order.
+	var accepted []fullblocktests.AcceptedBlock
+	for _, test := range tests {
+		for _, item := range test {
+			if item, ok := item.(fullblocktests.AcceptedBlock); ok {
+				accepted = append(accepted, item)
+			}
+		}
+	}
+	process := func(items []fullblocktests.AcceptedBlock) {
+		for _, item := range items {
+			block := provautil.NewBlock(item.Block)
+			_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock %s: unexpected error: %v",
+					item.Name, err)
+			}
+		}
+	}
+
+	// Process the blocks up to b25, which makes the side chain of b24 the
+	// main chain.
+	//
+	//   ... -> b22 -> b23
+	//              \-> b24 -> b25
+	var b24, b25 int
+	for i, item := range accepted {
+		switch item.Name {
+		case "b24":
+			b24 = i
+		case "b25":
+			b25 = i
+		}
+	}
+	process(accepted[:b25+1])
+	best := chain.BestSnapshot()
+	if *best.Hash != accepted[b25].Block.BlockHash() {
+		t.Fatalf("best block is %v, want b25", best.Hash)
+	}
+
+	// Subscribe from a few blocks before the fork without buffering, so the
+	// replay can be held at b24 while the chain reorganizes.
+	startHeight := accepted[b24].Height - 3
+	sub := chain.SubscribeBlocks(startHeight, 0)
+	defer sub.Stop()
+
+	// delivered tracks the chain described by the received events.
+	var delivered []chainhash.Hash
+	var disconnected []chainhash.Hash
+	receive := func() *blockchain.BlockEvent {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				t.Fatalf("subscription stopped: %v", sub.Err())
+			}
+			hash := event.Block.Hash()
+			height := event.Block.MsgBlock().Header.Height
+			switch event.Type {
+			case blockchain.NTBlockConnected:
+				wantHeight := startHeight + uint32(len(delivered))
+				if height != wantHeight {
+					t.Fatalf("connected block %v at height %d, "+
+						"want height %d", hash, height,
+						wantHeight)
+				}
+				if len(delivered) != 0 {
+					prev := event.Block.MsgBlock().Header.PrevBlock
+					if prev != delivered[len(delivered)-1] {
+						t.Fatalf("connected block %v does not "+
+							"extend %v", hash,
+							delivered[len(delivered)-1])
+					}
+				}
+				delivered = append(delivered, *hash)
+
+			case blockchain.NTBlockDisconnected:
+				if len(delivered) == 0 ||
+					delivered[len(delivered)-1] != *hash {
+					t.Fatalf("disconnected block %v is not the "+
+						"last delivered block", hash)
+				}
+				delivered = delivered[:len(delivered)-1]
+				disconnected = append(disconnected, *hash)
+
+			default:
+				t.Fatalf("unexpected event type %v", event.Type)
+			}
+			return event
+
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timeout waiting for block event")
+		}
+		return nil
+	}
+
+	// Replay up to b24.
+	b24Hash := accepted[b24].Block.BlockHash()
+	for {
+		event := receive()
+		if *event.Block.Hash() == b24Hash {
+			break
+		}
+	}
+
+	// Reorganize back to b23 by processing the remaining blocks while the
+	// replay is held, then receive events until the subscription caught up
+	// with the main chain.
+	//
+	//   ... -> b22 -> b23 -> b26 -> b27 -> ...
+	//              \-> b24 -> b25
+	last := len(accepted) - 1
+	process(accepted[b25+1 : last])
+	best = chain.BestSnapshot()
+	for len(delivered) == 0 || delivered[len(delivered)-1] != *best.Hash {
+		receive()
+	}
+
+	// The delivered chain must match the main chain and the replayed b24
+	// must have been disconnected.
+	if len(delivered) != int(best.Height-startHeight+1) {
+		t.Fatalf("delivered %d blocks, want %d", len(delivered),
+			best.Height-startHeight+1)
+	}
+	for i, hash := range delivered {
+		mainHash, err := chain.BlockHashByHeight(startHeight + uint32(i))
+		if err != nil {
+			t.Fatalf("BlockHashByHeight: unexpected error: %v", err)
+		}
+		if hash != *mainHash {
+			t.Fatalf("delivered block %v at height %d, main chain "+
+				"has %v", hash, startHeight+uint32(i), mainHash)
+		}
+	}
+	found := false
+	for _, hash := range disconnected {
+		if hash == b24Hash {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("replayed block b24 was not disconnected")
+	}
+
+	// Once caught up, the subscription follows the blocks connected to the
+	// main chain.
+	process(accepted[last:])
+	event := receive()
+	if *event.Block.Hash() != accepted[last].Block.BlockHash() ||
+		event.Type != blockchain.NTBlockConnected {
+		t.Fatalf("got %v for block %v, want %s connected", event.Type,
+			event.Block.Hash(), accepted[last].Name)
+	}
+
+	sub.Stop()
+	if _, ok := <-sub.Events(); ok {
+		t.Fatalf("events delivered after the subscription stopped")
+	}
+	if err := sub.Err(); err != nil {
+		t.Fatalf("Err: unexpected error: %v", err)
+	}
+}
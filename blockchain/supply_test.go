@@ -0,0 +1,114 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+)
+
+// TestBestSnapshotSupply ensures the total supply and the issuance and
+// destruction counts of the best state track the issuances and destructions of
+// the main chain exactly, including when a reorganization drops a block which
+// issued and destroyed tokens, and that they are restored when the chain is
+// loaded again, also after upgrading a chain state which didn't store them.
+func TestBestSnapshotSupply(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	params := chaincfg.RegressionNetParams
+
+	db, teardown := testChainDB(t, "bestsnapshotsupply", &params)
+	defer teardown()
+	checkSupply := func(name string, best *blockchain.BestState, supply, issuances, destructions uint64) {
+		if best.TotalSupply != supply ||
+			best.TotalIssuanceTxs != issuances ||
+			best.TotalDestructionTxs != destructions {
+
+			t.Fatalf("%s: got supply %d of %d issuances and %d "+
+				"destructions, want %d of %d and %d", name,
+				best.TotalSupply, best.TotalIssuanceTxs,
+				best.TotalDestructionTxs, supply, issuances,
+				destructions)
+		}
+	}
+
+	// b5 issues tokens, b6 destroys them and issues others, and b8 makes
+	// the chain without b6 the main chain again.
+	want := map[string][3]uint64{
+		"b5": {8000000000, 1, 0},
+		"b6": {4000000000, 2, 1},
+		"b8": {8000000000, 1, 0},
+	}
+	chain := newTestChain(t, db, &params, nil)
+	for _, test := range tests {
+		for _, item := range test {
+			item, ok := item.(fullblocktests.AcceptedBlock)
+			if !ok {
+				continue
+			}
+			block := provautil.NewBlock(item.Block)
+			_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock %s: unexpected error: %v",
+					item.Name, err)
+			}
+			best := chain.BestSnapshot()
+			if best.TotalSupply != chain.AdminState().TotalSupply {
+				t.Fatalf("%s: got supply %d, want %d", item.Name,
+					best.TotalSupply,
+					chain.AdminState().TotalSupply)
+			}
+			if w, ok := want[item.Name]; ok {
+				checkSupply(item.Name, best, w[0], w[1], w[2])
+				delete(want, item.Name)
+			}
+		}
+	}
+	if len(want) != 0 {
+		t.Fatalf("blocks %v were not processed", want)
+	}
+
+	// Count the issuances and destructions of the main chain.
+	best := chain.BestSnapshot()
+	var issuances, destructions uint64
+	for height := uint32(0); height <= best.Height; height++ {
+		hash, err := chain.BlockHashByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockHashByHeight(%d): unexpected error: %v",
+				height, err)
+		}
+		ops, err := chain.AdminOpsInBlock(hash)
+		if err != nil {
+			t.Fatalf("AdminOpsInBlock(%d): unexpected error: %v",
+				height, err)
+		}
+		for _, op := range ops {
+			switch op.Op {
+			case blockchain.AdminOpIssue:
+				issuances++
+			case blockchain.AdminOpDestroy:
+				destructions++
+			}
+		}
+	}
+	checkSupply("best", best, chain.AdminState().TotalSupply, issuances,
+		destructions)
+
+	// Loading the chain again restores the counts from the chain state,
+	// and so does upgrading a chain state which didn't store them.
+	checkSupply("reloaded", newTestChain(t, db, &params, nil).BestSnapshot(), best.TotalSupply,
+		issuances, destructions)
+	if err := blockchain.TstDowngradeChainStateV1(db); err != nil {
+		t.Fatalf("unable to downgrade chain state: %v", err)
+	}
+	checkSupply("upgraded", newTestChain(t, db, &params, nil).BestSnapshot(), best.TotalSupply,
+		issuances, destructions)
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// ThreadTipInfo houses the tip of an admin thread of the main chain along with
+// the height of the block which contains it, which is the height at which the
+// thread was last advanced.
+type ThreadTipInfo struct {
+	ThreadID provautil.ThreadID
+	Tip      wire.OutPoint
+	Height   uint32
+}
+
+// checkThreadTips ensures the passed tip of each admin thread is an unspent
+// output, as of the passed view of the block being connected, which pays to
+// the thread itself, so it can be spent by the key set of the thread to
+// advance it.  A tip which is not would stall all further admin operations of
+// its thread.  This is impossible when the admin transactions were validated
+// correctly, so an AssertError is returned for it.
+//
+// The outputs of tips which are not in the view, since the block neither
+// spends nor creates them, are loaded from the database.
+func (b *BlockChain) checkThreadTips(utxoView *UtxoViewpoint, threadTips map[provautil.ThreadID]*wire.OutPoint) error {
+	txNeededSet := make(map[chainhash.Hash]struct{})
+	for _, tip := range threadTips {
+		if _, ok := utxoView.entries[tip.Hash]; !ok {
+			txNeededSet[tip.Hash] = struct{}{}
+		}
+	}
+	mainView := NewUtxoViewpoint()
+	if err := mainView.fetchUtxosMain(b.db, txNeededSet); err != nil {
+		return err
+	}
+
+	for threadID := provautil.RootThread; threadID <= provautil.IssueThread; threadID++ {
+		tip, ok := threadTips[threadID]
+		if !ok {
+			str := fmt.Sprintf("admin thread %d has no tip", threadID)
+			return assertError(str)
+		}
+		entry, ok := utxoView.entries[tip.Hash]
+		if !ok {
+			entry = mainView.LookupEntry(&tip.Hash)
+		}
+		if entry == nil || entry.IsOutputSpent(tip.Index) {
+			str := fmt.Sprintf("tip %v of admin thread %d is not an "+
+				"unspent output", tip, threadID)
+			return assertError(str)
+		}
+
+		pkScript := entry.PkScriptByIndex(tip.Index)
+		pops, err := txscript.ParseScript(pkScript)
+		if err != nil || txscript.TypeOfScript(pops) != txscript.ProvaAdminTy {
+			str := fmt.Sprintf("tip %v of admin thread %d is not a "+
+				"thread output", tip, threadID)
+			return assertErrorWrap(str, err)
+		}
+		scriptThreadID, err := txscript.ExtractThreadID(pops)
+		if err != nil || scriptThreadID != threadID {
+			str := fmt.Sprintf("tip %v of admin thread %d pays to "+
+				"another thread", tip, threadID)
+			return assertErrorWrap(str, err)
+		}
+	}
+	return nil
+}
+
+// ThreadTipInfos returns the tip of each admin thread of the main chain along
+// with the height at which it was last advanced, ordered by thread ID.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ThreadTipInfos() ([]ThreadTipInfo, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	threadTips := b.ThreadTips()
+	infos := make([]ThreadTipInfo, 0, len(threadTips))
+	err := b.db.View(func(dbTx database.Tx) error {
+		for threadID := provautil.RootThread; threadID <= provautil.IssueThread; threadID++ {
+			tip, ok := threadTips[threadID]
+			if !ok {
+				continue
+			}
+			entry, err := dbFetchUtxoEntry(dbTx, &tip.Hash)
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				str := fmt.Sprintf("tip %v of admin thread %d is "+
+					"not an unspent output", tip, threadID)
+				return assertError(str)
+			}
+			infos = append(infos, ThreadTipInfo{
+				ThreadID: threadID,
+				Tip:      *tip,
+				Height:   entry.BlockHeight(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
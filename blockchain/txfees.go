@@ -0,0 +1,195 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+)
+
+// maxTxFeeCacheEntries is the maximum number of blocks whose transaction fees
+// are kept by the transaction fee cache of a chain instance.
+const maxTxFeeCacheEntries = 100
+
+// txFeeCacheEntry houses the fees paid by the transactions of a block.
+type txFeeCacheEntry struct {
+	hash chainhash.Hash
+	fees []int64
+}
+
+// txFeeCache is a bounded cache of the fees paid by the transactions of recent
+// main chain blocks, so they are reported for the blocks which are requested
+// most without decoding their spend journal entries each time.  The fees are
+// added when the blocks are connected.  They only depend on the block, so they
+// remain valid when it is disconnected again.  The least recently used entry
+// is evicted when the cache is full.
+type txFeeCache struct {
+	mtx     sync.Mutex
+	entries map[chainhash.Hash]*list.Element
+	order   *list.List
+	limit   int
+}
+
+// newTxFeeCache returns a new transaction fee cache which holds the fees of at
+// most the passed number of blocks.
+func newTxFeeCache(limit int) *txFeeCache {
+	return &txFeeCache{
+		entries: make(map[chainhash.Hash]*list.Element),
+		order:   list.New(),
+		limit:   limit,
+	}
+}
+
+// lookup returns the fees of the transactions of the block with the passed
+// hash when they are cached.
+//
+// This function is safe for concurrent access.
+func (c *txFeeCache) lookup(hash *chainhash.Hash) ([]int64, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.entries[*hash]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*txFeeCacheEntry).fees, true
+}
+
+// add records the passed fees of the transactions of the block with the passed
+// hash.
+//
+// This function is safe for concurrent access.
+func (c *txFeeCache) add(hash *chainhash.Hash, fees []int64) {
+	if c.limit <= 0 {
+		return
+	}
+	entry := &txFeeCacheEntry{hash: *hash, fees: fees}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if elem, ok := c.entries[entry.hash]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	// Evict the least recently used entry when the cache is full and reuse
+	// its list element for the new entry.
+	if len(c.entries) >= c.limit {
+		elem := c.order.Back()
+		delete(c.entries, elem.Value.(*txFeeCacheEntry).hash)
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		c.entries[entry.hash] = elem
+		return
+	}
+	c.entries[entry.hash] = c.order.PushFront(entry)
+}
+
+// calcBlockTxFees returns the fee paid by each of the transactions of the
+// passed block given the total amount of the inputs of each of its transactions
+// other than the coinbase.
+//
+// The coinbase collects the fees rather than paying one, and admin
+// transactions, whose outputs may exceed their inputs when they issue tokens,
+// pay no fees, so their fees are zero.
+func calcBlockTxFees(block *provautil.Block, inputTotals []int64) []int64 {
+	txns := block.Transactions()
+	fees := make([]int64, len(txns))
+	for i, tx := range txns[1:] {
+		if threadInt, _ := txscript.GetAdminDetails(tx); threadInt >= 0 {
+			continue
+		}
+		fee := inputTotals[i]
+		for _, txOut := range tx.MsgTx().TxOut {
+			fee -= txOut.Value
+		}
+		fees[i+1] = fee
+	}
+	return fees
+}
+
+// stxoInputTotals returns the total amount of the inputs of each of the
+// transactions of the passed block other than the coinbase from the passed
+// spent txouts, which must be in the order the transactions spent them, such
+// as the spent txouts collected by connectTransactions.
+func stxoInputTotals(block *provautil.Block, stxos []spentTxOut) []int64 {
+	txns := block.MsgBlock().Transactions[1:]
+	totals := make([]int64, len(txns))
+	var stxoIdx int
+	for txIdx, tx := range txns {
+		for range tx.TxIn {
+			totals[txIdx] += stxos[stxoIdx].amount
+			stxoIdx++
+		}
+	}
+	return totals
+}
+
+// dbFetchBlockTxFees uses an existing database transaction to compute the fee
+// paid by each of the transactions of the passed main chain block from its
+// spend journal entry.  See calcBlockTxFees for the fees of the coinbase and
+// admin transactions.
+func dbFetchBlockTxFees(dbTx database.Tx, block *provautil.Block) ([]int64, error) {
+	serialized := dbTx.Metadata().Bucket(spendJournalBucketName).Get(
+		block.Hash()[:])
+	totals, err := spendJournalInputTotals(serialized,
+		block.MsgBlock().Transactions[1:])
+	if err != nil {
+		if isDeserializeErr(err) {
+			return nil, database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("corrupt spend "+
+					"information for %v: %v", block.Hash(),
+					err),
+			}
+		}
+		return nil, err
+	}
+	return calcBlockTxFees(block, totals), nil
+}
+
+// BlockTxFees returns the fee paid by each of the transactions of the passed
+// block, in the order of the transactions of the block.  The fees are computed
+// when the block is connected and kept for recent blocks.  The fees of other
+// blocks are computed from the outputs they spent, which are only recorded for
+// the blocks of the main chain.
+//
+// The coinbase collects the fees of the block rather than paying one, and
+// admin transactions pay no fees, so their fees are zero.  The returned slice
+// MUST NOT be modified.
+//
+// This function is safe for concurrent access, and it does not acquire the
+// chain state lock, so it may be called while handling notifications.
+func (b *BlockChain) BlockTxFees(block *provautil.Block) ([]int64, error) {
+	if fees, ok := b.txFeeCache.lookup(block.Hash()); ok {
+		return fees, nil
+	}
+
+	var fees []int64
+	err := b.db.View(func(dbTx database.Tx) error {
+		if !dbMainChainHasBlock(dbTx, block.Hash()) {
+			str := fmt.Sprintf("block %s is not in the main chain",
+				block.Hash())
+			return errNotInMainChain(str)
+		}
+		var err error
+		fees, err = dbFetchBlockTxFees(dbTx, block)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.txFeeCache.add(block.Hash(), fees)
+	return fees, nil
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestBlockTxFees ensures the fees reported for the transactions of the main
+// chain blocks of a regtest chain match the fees computed from the outputs
+// they spend, that the coinbase and admin transactions report none, and that
+// the fees of recent blocks, which are cached, match those of older blocks,
+// which are computed from the spend journal.
+func TestBlockTxFees(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	params := &chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("blocktxfees", params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	for _, test := range tests {
+		for _, item := range test {
+			item, ok := item.(fullblocktests.AcceptedBlock)
+			if !ok {
+				continue
+			}
+			block := provautil.NewBlock(item.Block)
+			_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock %s: unexpected error: %v",
+					item.Name, err)
+			}
+		}
+	}
+	bestHeight := chain.BestSnapshot().Height
+
+	// Check the fees of the blocks from the oldest on, tracking the value
+	// of every output created by the main chain so far to compute them.
+	values := make(map[wire.OutPoint]int64)
+	var numMixed int
+	for height := uint32(0); height <= bestHeight; height++ {
+		block, err := chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockByHeight(%d): unexpected error: %v",
+				height, err)
+		}
+		fees, err := chain.BlockTxFees(block)
+		if err != nil {
+			t.Fatalf("BlockTxFees(%d): unexpected error: %v", height,
+				err)
+		}
+		txns := block.Transactions()
+		if len(fees) != len(txns) {
+			t.Fatalf("height %d: got %d fees for %d transactions",
+				height, len(fees), len(txns))
+		}
+
+		var numPaid, numAdmin int
+		var total int64
+		for i, tx := range txns {
+			var want int64
+			threadInt, _ := txscript.GetAdminDetails(tx)
+			if i > 0 && threadInt < 0 {
+				for _, txIn := range tx.MsgTx().TxIn {
+					value, ok := values[txIn.PreviousOutPoint]
+					if !ok {
+						t.Fatalf("height %d: transaction %v "+
+							"spends unknown output %v",
+							height, tx.Hash(),
+							txIn.PreviousOutPoint)
+					}
+					want += value
+				}
+				for _, txOut := range tx.MsgTx().TxOut {
+					want -= txOut.Value
+				}
+			}
+			if fees[i] != want {
+				t.Fatalf("height %d: got fee %d for transaction "+
+					"%d, want %d", height, fees[i], i, want)
+			}
+			if threadInt >= 0 {
+				numAdmin++
+			} else if want > 0 {
+				numPaid++
+			}
+			total += fees[i]
+
+			for _, txIn := range tx.MsgTx().TxIn {
+				delete(values, txIn.PreviousOutPoint)
+			}
+			for idx, txOut := range tx.MsgTx().TxOut {
+				op := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(idx)}
+				values[op] = txOut.Value
+			}
+		}
+		if numPaid > 0 && numAdmin > 0 {
+			numMixed++
+		}
+
+		// Regtest doesn't burn fees, so the coinbase pays exactly the
+		// subsidy and the fees.
+		var coinbaseOut int64
+		for _, txOut := range txns[0].MsgTx().TxOut {
+			coinbaseOut += txOut.Value
+		}
+		if height > 0 && coinbaseOut != blockchain.CalcBlockSubsidy(
+			height, params)+total {
+
+			t.Fatalf("height %d: fees %d don't add up to the "+
+				"coinbase output %d", height, total, coinbaseOut)
+		}
+	}
+	if numMixed == 0 {
+		t.Fatalf("checked no block with both fee paying and admin " +
+			"transactions")
+	}
+}
@@ -0,0 +1,495 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/bitgo/prova/blockchain/adminstate"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+)
+
+var (
+	// chainStateVersionKeyName is the name of the db key used to store the
+	// version of the serialization of the chain state.
+	chainStateVersionKeyName = []byte("chainstateversion")
+
+	// chainStateUpgradeKeyName is the name of the db key used to store the
+	// progress of a chain state upgrade which was interrupted.
+	chainStateUpgradeKeyName = []byte("chainstateupgrade")
+)
+
+// These constants identify the versions of the serialization of the chain
+// state.
+const (
+	// chainStateVersion1 is the version of the chain states which were
+	// created before the version was stored.
+	chainStateVersion1 = 1
+
+	// chainStateVersion2 compresses the Prova 2-of-3 scripts of the utxo
+	// set and the spend journal to their pubkey hash and key ids.
+	chainStateVersion2 = 2
+
+	// chainStateVersion3 adds periodic snapshots of the admin state of the
+	// main chain.
+	chainStateVersion3 = 3
+
+	// chainStateVersion4 adds the total number of issuance and destruction
+	// transactions of the main chain to the best chain state.
+	chainStateVersion4 = 4
+
+	// chainStateVersion5 adds the ASP keys of the revoked keyIDs to the
+	// admin state of the best chain.
+	chainStateVersion5 = 5
+
+	// currentChainStateVersion is the version of the serialization of the
+	// chain state written by this code.
+	currentChainStateVersion = chainStateVersion5
+)
+
+// upgradeBatchSize is the maximum number of entries a chain state upgrade
+// converts in a single database transaction, which bounds the memory the
+// upgrade uses and the work which is repeated when it is interrupted.
+const upgradeBatchSize = 20000
+
+// chainStateUpgrade describes the upgrade of the chain state to a version.
+type chainStateUpgrade struct {
+	// version is the version the chain state is upgraded to.
+	version uint32
+
+	// description describes what the upgrade does for the log.
+	description string
+
+	// upgradeBatch converts the next batch of entries after the passed
+	// progress, which is nil when the upgrade starts, and returns the
+	// progress after the batch, or nil once the upgrade is complete.  The
+	// blocks of the chain are decoded with the passed chain parameters.
+	upgradeBatch func(dbTx database.Tx, params *chaincfg.Params, progress []byte) ([]byte, error)
+}
+
+// chainStateUpgrades are the upgrades of the chain state ordered by the version
+// they upgrade to.
+var chainStateUpgrades = []chainStateUpgrade{
+	{
+		version:      chainStateVersion2,
+		description:  "compress the Prova scripts of the utxo set",
+		upgradeBatch: upgradeToV2Batch,
+	},
+	{
+		version:      chainStateVersion3,
+		description:  "store snapshots of the admin state",
+		upgradeBatch: upgradeToV3Batch,
+	},
+	{
+		version:      chainStateVersion4,
+		description:  "count the issuance and destruction transactions",
+		upgradeBatch: upgradeToV4Batch,
+	},
+	{
+		version:      chainStateVersion5,
+		description:  "record the keys of the revoked keyIDs",
+		upgradeBatch: upgradeToV5Batch,
+	},
+}
+
+// dbFetchChainStateVersion uses an existing database transaction to fetch the
+// version of the serialization of the chain state.  Chain states which don't
+// store a version are version 1.
+func dbFetchChainStateVersion(dbTx database.Tx) (uint32, error) {
+	serialized := dbTx.Metadata().Get(chainStateVersionKeyName)
+	if serialized == nil {
+		return chainStateVersion1, nil
+	}
+	if len(serialized) != 4 {
+		return 0, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt chain state version",
+		}
+	}
+	return byteOrder.Uint32(serialized), nil
+}
+
+// dbPutChainStateVersion uses an existing database transaction to store the
+// passed version of the serialization of the chain state.
+func dbPutChainStateVersion(dbTx database.Tx, version uint32) error {
+	var serialized [4]byte
+	byteOrder.PutUint32(serialized[:], version)
+	return dbTx.Metadata().Put(chainStateVersionKeyName, serialized[:])
+}
+
+// upgradeChainState upgrades the chain state stored in the database to the
+// current version one upgrade at a time.  Each upgrade converts the entries
+// in batches and stores its progress along with each batch, so an interrupted
+// upgrade resumes where it left off the next time the chain is loaded.
+func (b *BlockChain) upgradeChainState() error {
+	var version uint32
+	var progress []byte
+	err := b.db.View(func(dbTx database.Tx) error {
+		// There is nothing to upgrade when the database doesn't
+		// contain a chain state yet.
+		meta := dbTx.Metadata()
+		if meta.Get(chainStateKeyName) == nil {
+			version = currentChainStateVersion
+			return nil
+		}
+
+		var err error
+		version, err = dbFetchChainStateVersion(dbTx)
+		if err != nil {
+			return err
+		}
+		if serialized := meta.Get(chainStateUpgradeKeyName); serialized != nil {
+			progress = make([]byte, len(serialized))
+			copy(progress, serialized)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if version > currentChainStateVersion {
+		return fmt.Errorf("the chain state version %d is newer than the "+
+			"supported version %d", version, currentChainStateVersion)
+	}
+	if version == currentChainStateVersion {
+		return nil
+	}
+	if b.readOnly {
+		return database.Error{
+			ErrorCode: database.ErrDbReadOnly,
+			Description: fmt.Sprintf("the chain state must be "+
+				"upgraded from version %d to %d and can't be "+
+				"in read-only mode", version,
+				currentChainStateVersion),
+		}
+	}
+
+	for _, upgrade := range chainStateUpgrades {
+		if upgrade.version <= version {
+			continue
+		}
+
+		// Resume the upgrade from the stored progress when it was
+		// interrupted.  The progress is prefixed by the version of the
+		// upgrade it belongs to.
+		var next []byte
+		if len(progress) >= 4 && byteOrder.Uint32(progress) == upgrade.version {
+			next = progress[4:]
+			log.Infof("Resuming the upgrade of the chain state to "+
+				"version %d to %s", upgrade.version,
+				upgrade.description)
+		} else {
+			log.Infof("Upgrading the chain state to version %d to "+
+				"%s.  This might take a while...", upgrade.version,
+				upgrade.description)
+		}
+
+		for done := false; !done; {
+			err := b.db.Update(func(dbTx database.Tx) error {
+				var err error
+				next, err = upgrade.upgradeBatch(dbTx,
+					b.chainParams, next)
+				if err != nil {
+					return err
+				}
+
+				meta := dbTx.Metadata()
+				if next == nil {
+					done = true
+					err := meta.Delete(chainStateUpgradeKeyName)
+					if err != nil {
+						return err
+					}
+					return dbPutChainStateVersion(dbTx,
+						upgrade.version)
+				}
+				serialized := make([]byte, 4+len(next))
+				byteOrder.PutUint32(serialized, upgrade.version)
+				copy(serialized[4:], next)
+				return meta.Put(chainStateUpgradeKeyName, serialized)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		log.Infof("Upgraded the chain state to version %d",
+			upgrade.version)
+		progress = nil
+	}
+	return nil
+}
+
+// upgradeBucketBatch converts the values of the next batch of at most
+// upgradeBatchSize entries after the passed key of the passed bucket with the
+// passed function, and returns the key of the last entry of the batch, or nil
+// when there are no entries left.  Empty values are left as they are.
+func upgradeBucketBatch(bucket database.Bucket, lastKey []byte, convert func([]byte) ([]byte, error)) ([]byte, error) {
+	cursor := bucket.Cursor()
+	ok := cursor.First()
+	if len(lastKey) > 0 {
+		ok = cursor.Seek(lastKey)
+		if ok && bytes.Equal(cursor.Key(), lastKey) {
+			ok = cursor.Next()
+		}
+	}
+
+	// Collect the converted values before storing them so the bucket is
+	// not modified while the cursor iterates it.
+	var keys, values [][]byte
+	for ; ok && len(keys) < upgradeBatchSize; ok = cursor.Next() {
+		key := make([]byte, len(cursor.Key()))
+		copy(key, cursor.Key())
+		lastKey = key
+
+		serialized := cursor.Value()
+		if len(serialized) == 0 {
+			continue
+		}
+		converted, err := convert(serialized)
+		if err != nil {
+			return nil, database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("unable to upgrade "+
+					"entry %x: %v", key, err),
+			}
+		}
+		keys = append(keys, key)
+		values = append(values, converted)
+	}
+	if !ok && len(keys) == 0 {
+		return nil, nil
+	}
+
+	for i, key := range keys {
+		if err := bucket.Put(key, values[i]); err != nil {
+			return nil, err
+		}
+	}
+	return lastKey, nil
+}
+
+// upgradeToV2Batch converts the next batch of utxo entries, and then of spend
+// journal entries, from version 1 to version 2 of the chain state.  The
+// progress is the bucket being converted, 0 for the utxo set and 1 for the
+// spend journal, followed by the last key converted.
+func upgradeToV2Batch(dbTx database.Tx, params *chaincfg.Params, progress []byte) ([]byte, error) {
+	phase := byte(0)
+	var lastKey []byte
+	if len(progress) > 0 {
+		phase, lastKey = progress[0], progress[1:]
+	}
+
+	meta := dbTx.Metadata()
+	var nextKey []byte
+	var err error
+	switch phase {
+	case 0:
+		nextKey, err = upgradeBucketBatch(meta.Bucket(utxoSetBucketName),
+			lastKey, convertUtxoEntryV1)
+	case 1:
+		nextKey, err = upgradeBucketBatch(
+			meta.Bucket(spendJournalBucketName), lastKey,
+			convertSpendJournalEntryV1)
+	default:
+		return nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt chain state upgrade progress",
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Move on to the spend journal once the utxo set is converted.
+	if nextKey == nil {
+		if phase == 0 {
+			return []byte{1}, nil
+		}
+		return nil, nil
+	}
+	return append([]byte{phase}, nextKey...), nil
+}
+
+// convertUtxoEntryV1 converts the passed utxo entry serialized by version 1 of
+// the chain state to the current version.
+func convertUtxoEntryV1(serialized []byte) ([]byte, error) {
+	entry, err := deserializeUtxoEntryV1(serialized)
+	if err != nil {
+		return nil, err
+	}
+	return serializeUtxoEntry(entry)
+}
+
+// convertSpendJournalEntryV1 converts the passed spend journal entry serialized
+// by version 1 of the chain state to the current version.  The spent txouts
+// are self delimiting, so unlike when they are deserialized, the transactions
+// of the block aren't needed to convert them.  Only the compressed txouts
+// change, so the header codes and versions are copied as they are.
+func convertSpendJournalEntryV1(serialized []byte) ([]byte, error) {
+	converted := make([]byte, 0, len(serialized))
+	for offset := 0; offset < len(serialized); {
+		start := offset
+		code, bytesRead := deserializeVLQ(serialized[offset:])
+		offset += bytesRead
+		if code != 0 {
+			_, bytesRead := deserializeVLQ(serialized[offset:])
+			offset += bytesRead
+		}
+		if offset >= len(serialized) {
+			return nil, errDeserialize("unexpected end of data " +
+				"after header code")
+		}
+		converted = append(converted, serialized[start:offset]...)
+
+		amount, pkScript, bytesRead, err := decodeCompressedTxOutV1(
+			serialized[offset:], 0)
+		if err != nil {
+			return nil, err
+		}
+		offset += bytesRead
+
+		size := compressedTxOutSize(amount, pkScript, 0, false)
+		txOut := make([]byte, size)
+		putCompressedTxOut(txOut, amount, pkScript, 0, false)
+		converted = append(converted, txOut...)
+	}
+	return converted, nil
+}
+
+// upgradeToV4Batch counts the issuance and destruction transactions of the next
+// batch of main chain blocks, and stores the counts of the whole main chain in
+// the best chain state, which version 4 of the chain state adds, once all of
+// the blocks are counted.  The progress is the height of the next block to
+// count followed by the issuance and destruction counts of the blocks before
+// it.
+func upgradeToV4Batch(dbTx database.Tx, params *chaincfg.Params, progress []byte) ([]byte, error) {
+	meta := dbTx.Metadata()
+	best, err := deserializeBestChainState(meta.Get(chainStateKeyName))
+	if err != nil {
+		return nil, err
+	}
+
+	// The genesis block has no admin transactions, so counting starts
+	// after it.
+	height := uint32(1)
+	var issuances, destructions uint64
+	switch len(progress) {
+	case 0:
+	case 20:
+		height = byteOrder.Uint32(progress[0:4])
+		issuances = byteOrder.Uint64(progress[4:12])
+		destructions = byteOrder.Uint64(progress[12:20])
+	default:
+		return nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt chain state upgrade progress",
+		}
+	}
+
+	for i := 0; i < upgradeBatchSize && height <= best.height; i++ {
+		block, err := dbFetchBlockByHeight(dbTx, params, height)
+		if err != nil {
+			return nil, err
+		}
+		blockIssuances, blockDestructions := blockIssueTxCounts(block)
+		issuances += blockIssuances
+		destructions += blockDestructions
+		height++
+	}
+
+	if height <= best.height {
+		next := make([]byte, 20)
+		byteOrder.PutUint32(next[0:4], height)
+		byteOrder.PutUint64(next[4:12], issuances)
+		byteOrder.PutUint64(next[12:20], destructions)
+		return next, nil
+	}
+	best.totalIssuanceTxns = issuances
+	best.totalDestructionTxns = destructions
+	return nil, meta.Put(chainStateKeyName, serializeBestChainState(best))
+}
+
+// upgradeToV5Batch records the ASP keys of the keyIDs revoked by the next batch
+// of main chain blocks in the admin state of the best chain, which version 5
+// of the chain state adds.  The admin state is stored after each batch, so the
+// progress is just the height of the next block to scan.  Revoked keyIDs could
+// never be provisioned again before version 5, so each of them was revoked
+// exactly once.  The admin snapshots are left as they are, since only their key
+// sets are used.
+func upgradeToV5Batch(dbTx database.Tx, params *chaincfg.Params, progress []byte) ([]byte, error) {
+	meta := dbTx.Metadata()
+	best, err := deserializeBestChainState(meta.Get(chainStateKeyName))
+	if err != nil {
+		return nil, err
+	}
+
+	// The genesis block has no admin transactions, so scanning starts
+	// after it.
+	height := uint32(1)
+	switch len(progress) {
+	case 0:
+	case 4:
+		height = byteOrder.Uint32(progress)
+	default:
+		return nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt chain state upgrade progress",
+		}
+	}
+	state, err := adminstate.Deserialize(meta.Get(keySetBucketName))
+	if err != nil {
+		return nil, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("unable to upgrade the admin "+
+				"state: %v", err),
+		}
+	}
+
+	for i := 0; i < upgradeBatchSize && height <= best.height; i++ {
+		block, err := dbFetchBlockByHeight(dbTx, params, height)
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range blockAdminTxs(block) {
+			threadInt, adminOutputs := txscript.GetAdminDetails(tx)
+			if provautil.ThreadID(threadInt) == provautil.IssueThread {
+				continue
+			}
+			for _, adminOutput := range adminOutputs {
+				if txscript.IsUpgradableAdminOp(adminOutput) {
+					continue
+				}
+				isAddOp, keySetType, pubKey,
+					keyID := txscript.ExtractAdminOpData(adminOutput)
+				if isAddOp || keySetType != btcec.ASPKeySet {
+					continue
+				}
+				state.RevokedKeys[keyID] = adminstate.RevokedKey{
+					PubKey:      pubKey,
+					Revocations: 1,
+				}
+			}
+		}
+		height++
+	}
+
+	err = meta.Put(keySetBucketName, state.Serialize())
+	if err != nil {
+		return nil, err
+	}
+	if height <= best.height {
+		next := make([]byte, 4)
+		byteOrder.PutUint32(next, height)
+		return next, nil
+	}
+	return nil, nil
+}
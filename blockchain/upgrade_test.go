@@ -0,0 +1,208 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/chaingen"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/database"
+)
+
+// chainStateSize returns the total size of the passed chain state entries.
+func chainStateSize(entries map[string][]byte) int {
+	size := 0
+	for key, value := range entries {
+		size += len(key) + len(value)
+	}
+	return size
+}
+
+// TestUpgradeChainState ensures a chain state serialized by version 1 is
+// upgraded to the current version when the chain is loaded, that the upgraded
+// chain state, including the snapshots of the admin state, is identical to one
+// created by the current version, and that the chain keeps validating blocks,
+// including reorganizations, identically on top of it.
+func TestUpgradeChainState(t *testing.T) {
+	// Take snapshots of the admin state often enough for the upgrade to
+	// store several of them.
+	defer blockchain.TstSetAdminSnapshotInterval(
+		blockchain.TstSetAdminSnapshotInterval(50))
+
+	// Generate a chain paying to Prova 2-of-3 scripts which is reorganized
+	// regularly so the spend journal is used as well.
+	params := chaincfg.RegressionNetParams
+	var blocks []*chaingen.Block
+	err := chaingen.Generate(&chaingen.Config{
+		Params:        &params,
+		NumBlocks:     300,
+		TxPerBlock:    8,
+		OutputsPerTx:  3,
+		AdminInterval: 120,
+		ReorgInterval: 40,
+		ReorgDepth:    2,
+	}, func(block *chaingen.Block) error {
+		blocks = append(blocks, block)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to generate blocks: %v", err)
+	}
+
+	processBlocks := func(chain *blockchain.BlockChain, blocks []*chaingen.Block) {
+		process := chaingen.ProcessBlocks(chain)
+		for _, block := range blocks {
+			if err := process(block); err != nil {
+				t.Fatalf("unable to process block: %v", err)
+			}
+		}
+	}
+	checkSnapshots := func(db database.DB, want map[uint32][]byte) {
+		snapshots, err := blockchain.TstAdminSnapshots(db)
+		if err != nil {
+			t.Fatalf("unable to fetch admin snapshots: %v", err)
+		}
+		if !reflect.DeepEqual(snapshots, want) {
+			t.Fatalf("unexpected admin snapshots at %d heights, "+
+				"want %d", len(snapshots), len(want))
+		}
+	}
+	checkBestSupply := func(best, want *blockchain.BestState) {
+		if best.TotalSupply != want.TotalSupply ||
+			best.TotalIssuanceTxs != want.TotalIssuanceTxs ||
+			best.TotalDestructionTxs != want.TotalDestructionTxs {
+
+			t.Fatalf("got supply %d of %d issuances and %d "+
+				"destructions, want %d of %d and %d",
+				best.TotalSupply, best.TotalIssuanceTxs,
+				best.TotalDestructionTxs, want.TotalSupply,
+				want.TotalIssuanceTxs, want.TotalDestructionTxs)
+		}
+	}
+	checkVersion := func(db database.DB, want uint32) {
+		version, err := blockchain.TstChainStateVersion(db)
+		if err != nil {
+			t.Fatalf("unable to fetch chain state version: %v", err)
+		}
+		if version != want {
+			t.Fatalf("unexpected chain state version %d, want %d",
+				version, want)
+		}
+	}
+
+	// Create the chain state with the current version.
+	currentDB, teardown := testChainDB(t, "upgradechainstate", &params)
+	defer teardown()
+	currentChain := newTestChain(t, currentDB, &params, nil)
+	processBlocks(currentChain, blocks)
+	checkVersion(currentDB, 5)
+	current, err := blockchain.TstChainStateEntries(currentDB)
+	if err != nil {
+		t.Fatalf("unable to fetch chain state: %v", err)
+	}
+	currentSnapshots, err := blockchain.TstAdminSnapshots(currentDB)
+	if err != nil {
+		t.Fatalf("unable to fetch admin snapshots: %v", err)
+	}
+	if len(currentSnapshots) != int(currentChain.BestSnapshot().Height/50+1) {
+		t.Fatalf("unexpected number of admin snapshots %d",
+			len(currentSnapshots))
+	}
+
+	// Measure the size of the chain state when serialized by version 1.
+	if err := blockchain.TstDowngradeChainStateV1(currentDB); err != nil {
+		t.Fatalf("unable to downgrade chain state: %v", err)
+	}
+	checkVersion(currentDB, 1)
+	downgraded, err := blockchain.TstChainStateEntries(currentDB)
+	if err != nil {
+		t.Fatalf("unable to fetch chain state: %v", err)
+	}
+	sizeV1, sizeV2 := chainStateSize(downgraded), chainStateSize(current)
+	t.Logf("chain state of %d entries: version 1 %d bytes, version 2 %d "+
+		"bytes (%.1f%% smaller)", len(current), sizeV1, sizeV2,
+		100*float64(sizeV1-sizeV2)/float64(sizeV1))
+	if sizeV2 >= sizeV1 {
+		t.Fatalf("version 2 chain state is not smaller than version 1")
+	}
+
+	// A chain state which must be upgraded can't be loaded in read-only
+	// mode.
+	_, err = blockchain.New(&blockchain.Config{
+		DB:          currentDB,
+		ChainParams: &params,
+		TimeSource:  blockchain.NewMedianTime(),
+		ReadOnly:    true,
+	})
+	if dbErr, ok := err.(database.Error); !ok ||
+		dbErr.ErrorCode != database.ErrDbReadOnly {
+
+		t.Fatalf("unexpected error loading a version 1 chain state "+
+			"read-only: %v", err)
+	}
+
+	// Loading the chain upgrades the chain state back to exactly the one
+	// created by the current version.
+	reloadedChain := newTestChain(t, currentDB, &params, nil)
+	checkVersion(currentDB, 5)
+	checkBestSupply(reloadedChain.BestSnapshot(),
+		currentChain.BestSnapshot())
+	upgraded, err := blockchain.TstChainStateEntries(currentDB)
+	if err != nil {
+		t.Fatalf("unable to fetch chain state: %v", err)
+	}
+	if len(upgraded) != len(current) {
+		t.Fatalf("unexpected number of upgraded entries %d, want %d",
+			len(upgraded), len(current))
+	}
+	for key, value := range current {
+		if !bytes.Equal(upgraded[key], value) {
+			t.Fatalf("upgraded entry %x is %x, want %x", key,
+				upgraded[key], value)
+		}
+	}
+	checkSnapshots(currentDB, currentSnapshots)
+
+	// Upgrade a chain state half way through the blocks and ensure the
+	// rest of the blocks, including the reorganizations which restore
+	// spent outputs from the upgraded spend journal, are validated the
+	// same way and result in the same chain state.
+	half := len(blocks) / 2
+	upgradedDB, teardown := testChainDB(t, "upgradechainstate", &params)
+	defer teardown()
+	processBlocks(newTestChain(t, upgradedDB, &params, nil), blocks[:half])
+	if err := blockchain.TstDowngradeChainStateV1(upgradedDB); err != nil {
+		t.Fatalf("unable to downgrade chain state: %v", err)
+	}
+	upgradedChain := newTestChain(t, upgradedDB, &params, nil)
+	checkVersion(upgradedDB, 5)
+	processBlocks(upgradedChain, blocks[half:])
+
+	best, wantBest := upgradedChain.BestSnapshot(), currentChain.BestSnapshot()
+	if *best.Hash != *wantBest.Hash || best.TotalTxns != wantBest.TotalTxns {
+		t.Fatalf("unexpected best chain %v, want %v", best.Hash,
+			wantBest.Hash)
+	}
+	checkBestSupply(best, wantBest)
+	upgraded, err = blockchain.TstChainStateEntries(upgradedDB)
+	if err != nil {
+		t.Fatalf("unable to fetch chain state: %v", err)
+	}
+	if len(upgraded) != len(current) {
+		t.Fatalf("unexpected number of entries %d, want %d",
+			len(upgraded), len(current))
+	}
+	for key, value := range current {
+		if !bytes.Equal(upgraded[key], value) {
+			t.Fatalf("entry %x is %x, want %x", key,
+				upgraded[key], value)
+		}
+	}
+	checkSnapshots(upgradedDB, currentSnapshots)
+}
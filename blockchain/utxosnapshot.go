@@ -0,0 +1,464 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/blockchain/adminstate"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// -----------------------------------------------------------------------------
+// A utxo snapshot houses the chain state of the main chain as of its tip, so a
+// new node can start from it instead of validating every block since genesis.
+//
+// The serialized format is:
+//
+//   <magic><version><net><chain state version><tip hash>
+//   <best chain state><admin state>
+//   <num blocks>[<block><spend journal entry>,...]
+//   <num utxo entries>[<tx hash><utxo entry>,...]
+//   <commitment>
+//
+//   Field                 Type        Size
+//   magic                 [4]byte     4
+//   version               uint32      4
+//   net                   uint32      4
+//   chain state version   uint32      4
+//   tip hash              [32]byte    32
+//   best chain state      []byte      variable (varint length prefixed)
+//   admin state           []byte      variable (varint length prefixed)
+//   num blocks            VLQ         variable
+//   block                 []byte      variable (varint length prefixed)
+//   spend journal entry   []byte      variable (varint length prefixed)
+//   num utxo entries      VLQ         variable
+//   tx hash               [32]byte    32
+//   utxo entry            []byte      variable (varint length prefixed)
+//   commitment            [32]byte    32
+//
+// The fixed size fields are little endian.  The best chain state, admin state,
+// spend journal entries and utxo entries are serialized exactly as they are
+// stored in the database for the chain state version, so a snapshot can only
+// be imported by a node with the same chain state version.
+//
+// The blocks are the most recent blocks of the main chain up to and including
+// the tip, oldest first, which are needed to check the blocks which extend the
+// tip against their predecessors, such as for the difficulty and median time.
+// Their spend journal entries allow them to be disconnected in a
+// reorganization.  The commitment is the sha256 hash of everything before it.
+// -----------------------------------------------------------------------------
+
+const (
+	// utxoSnapshotVersion is the version of the serialization of the utxo
+	// snapshots written by ExportUtxoSnapshot.
+	utxoSnapshotVersion = 1
+
+	// maxUtxoSnapshotField is the maximum size of the variable length
+	// fields of a utxo snapshot, which keeps a corrupt length prefix from
+	// causing an excessive allocation.
+	maxUtxoSnapshotField = wire.MaxBlockPayload
+)
+
+// utxoSnapshotMagic identifies a utxo snapshot.
+var utxoSnapshotMagic = [4]byte{'p', 'u', 't', 'x'}
+
+// errUtxoSnapshot signifies that a utxo snapshot could not be imported since it
+// is malformed or doesn't match the chain.
+type errUtxoSnapshot string
+
+// Error implements the error interface.
+func (e errUtxoSnapshot) Error() string {
+	return string(e)
+}
+
+// utxoSnapshotBlocks returns the number of most recent main chain blocks a utxo
+// snapshot includes for the passed chain parameters.  This covers the blocks
+// the difficulty, median time, time regression and block version checks of
+// the next block look back on, along with the block before the oldest of them
+// whose node is loaded while walking back.
+func utxoSnapshotBlocks(params *chaincfg.Params) uint32 {
+	n := uint64(params.PowAveragingWindow + medianTimeBlocks)
+	if uint64(params.TimeRegressionWindow) > n {
+		n = uint64(params.TimeRegressionWindow)
+	}
+	if params.BlockUpgradeNumToCheck > n {
+		n = params.BlockUpgradeNumToCheck
+	}
+	return uint32(n + 1)
+}
+
+// ExportUtxoSnapshot writes a snapshot of the chain state as of the current tip
+// of the main chain to the passed writer, which a new node can import with
+// ImportUtxoSnapshot instead of validating all blocks since genesis.  The
+// snapshot includes the utxo set, the admin state, the best chain state and
+// the most recent blocks of the main chain.  It is read in a single database
+// transaction, so it is consistent even when blocks are connected meanwhile.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ExportUtxoSnapshot(w io.Writer) error {
+	hasher := sha256.New()
+	hw := io.MultiWriter(w, hasher)
+	err := b.db.View(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		serializedState := meta.Get(chainStateKeyName)
+		state, err := deserializeBestChainState(serializedState)
+		if err != nil {
+			return err
+		}
+		serializedKeySet := meta.Get(keySetBucketName)
+		if serializedKeySet == nil {
+			return assertError("chain state has no admin state")
+		}
+		version, err := dbFetchChainStateVersion(dbTx)
+		if err != nil {
+			return err
+		}
+
+		var header [4 + 4 + 4 + 4 + chainhash.HashSize]byte
+		copy(header[0:4], utxoSnapshotMagic[:])
+		byteOrder.PutUint32(header[4:8], utxoSnapshotVersion)
+		byteOrder.PutUint32(header[8:12], uint32(b.chainParams.Net))
+		byteOrder.PutUint32(header[12:16], version)
+		copy(header[16:], state.hash[:])
+		if _, err := hw.Write(header[:]); err != nil {
+			return err
+		}
+		if err := wire.WriteVarBytes(hw, 0, serializedState); err != nil {
+			return err
+		}
+		if err := wire.WriteVarBytes(hw, 0, serializedKeySet); err != nil {
+			return err
+		}
+
+		// Write the most recent blocks, oldest first.  The genesis
+		// block is known to every node, so it is never included.
+		firstHeight := uint32(1)
+		if n := utxoSnapshotBlocks(b.chainParams); state.height >= n {
+			firstHeight = state.height - n + 1
+		}
+		numBlocks := uint64(0)
+		if state.height >= firstHeight {
+			numBlocks = uint64(state.height - firstHeight + 1)
+		}
+		if err := wire.WriteVarInt(hw, 0, numBlocks); err != nil {
+			return err
+		}
+		spendBucket := meta.Bucket(spendJournalBucketName)
+		for height := firstHeight; height <= state.height; height++ {
+			hash, err := dbFetchHashByHeight(dbTx, height)
+			if err != nil {
+				return err
+			}
+			blockBytes, err := dbTx.FetchBlock(hash)
+			if err != nil {
+				return err
+			}
+			if err := wire.WriteVarBytes(hw, 0, blockBytes); err != nil {
+				return err
+			}
+			err = wire.WriteVarBytes(hw, 0, spendBucket.Get(hash[:]))
+			if err != nil {
+				return err
+			}
+		}
+
+		// Write the utxo set, counting the entries first since the
+		// count precedes them.
+		utxoBucket := meta.Bucket(utxoSetBucketName)
+		var numEntries uint64
+		err = utxoBucket.ForEach(func(k, v []byte) error {
+			numEntries++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := wire.WriteVarInt(hw, 0, numEntries); err != nil {
+			return err
+		}
+		return utxoBucket.ForEach(func(k, v []byte) error {
+			if _, err := hw.Write(k); err != nil {
+				return err
+			}
+			return wire.WriteVarBytes(hw, 0, v)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// Commit to everything written before.
+	_, err = w.Write(hasher.Sum(nil))
+	return err
+}
+
+// ImportUtxoSnapshot initializes the chain state from the utxo snapshot read
+// from the passed reader, which must have been written by ExportUtxoSnapshot
+// for the same network at the block with the passed hash.  The snapshot is
+// verified against its commitment before any of it is committed to the
+// database, and the blocks after the tip of the snapshot are then processed
+// as usual.
+//
+// The chain must not contain any blocks besides the genesis block and must not
+// maintain any optional indexes or record the spending transactions, since they
+// would have to be built from the blocks before the snapshot.  Those blocks are not available to the chain,
+// so it can neither serve them to peers nor reorganize to a side chain which
+// forks before the oldest block of the snapshot.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ImportUtxoSnapshot(r io.Reader, expectedTipHash chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if b.readOnly {
+		return errUtxoSnapshot("a utxo snapshot can't be imported " +
+			"into a read-only chain")
+	}
+	if b.indexManager != nil {
+		return errUtxoSnapshot("a utxo snapshot can't be imported " +
+			"while optional indexes are enabled")
+	}
+	if b.spendingTxs {
+		return errUtxoSnapshot("a utxo snapshot can't be imported " +
+			"while the spending transactions are recorded")
+	}
+	if b.bestNode.height != 0 || len(b.index) > 1 {
+		return errUtxoSnapshot("a utxo snapshot can only be imported " +
+			"into a chain which contains no blocks besides the " +
+			"genesis block")
+	}
+
+	// Read the header and the chain and admin state, which are checked
+	// against the chain before the database is touched.
+	hasher := sha256.New()
+	hr := io.TeeReader(r, hasher)
+	var header [4 + 4 + 4 + 4 + chainhash.HashSize]byte
+	if _, err := io.ReadFull(hr, header[:]); err != nil {
+		return err
+	}
+	if !bytes.Equal(header[0:4], utxoSnapshotMagic[:]) {
+		return errUtxoSnapshot("the data is not a utxo snapshot")
+	}
+	if version := byteOrder.Uint32(header[4:8]); version != utxoSnapshotVersion {
+		return errUtxoSnapshot(fmt.Sprintf("unsupported utxo snapshot "+
+			"version %d", version))
+	}
+	if net := wire.BitcoinNet(byteOrder.Uint32(header[8:12])); net != b.chainParams.Net {
+		return errUtxoSnapshot(fmt.Sprintf("the utxo snapshot is for "+
+			"network %v instead of %v", net, b.chainParams.Net))
+	}
+	version := byteOrder.Uint32(header[12:16])
+	if version != currentChainStateVersion {
+		return errUtxoSnapshot(fmt.Sprintf("the utxo snapshot has chain "+
+			"state version %d instead of %d", version,
+			currentChainStateVersion))
+	}
+	var tipHash chainhash.Hash
+	copy(tipHash[:], header[16:])
+	if tipHash != expectedTipHash {
+		return errUtxoSnapshot(fmt.Sprintf("the utxo snapshot is at "+
+			"block %v instead of the expected block %v", tipHash,
+			expectedTipHash))
+	}
+
+	serializedState, err := wire.ReadVarBytes(hr, 0, maxUtxoSnapshotField,
+		"best chain state")
+	if err != nil {
+		return err
+	}
+	state, err := deserializeBestChainState(serializedState)
+	if err != nil {
+		return err
+	}
+	if state.hash != tipHash {
+		return errUtxoSnapshot(fmt.Sprintf("the best chain state of "+
+			"the utxo snapshot is at block %v instead of its tip %v",
+			state.hash, tipHash))
+	}
+	serializedKeySet, err := wire.ReadVarBytes(hr, 0, maxUtxoSnapshotField,
+		"admin state")
+	if err != nil {
+		return err
+	}
+	adminState, err := adminstate.Deserialize(serializedKeySet)
+	if err != nil {
+		return errUtxoSnapshot(fmt.Sprintf("the admin state of the utxo "+
+			"snapshot is malformed: %v", err))
+	}
+
+	err = b.db.Update(func(dbTx database.Tx) error {
+		err := b.importSnapshotBlocks(dbTx, hr, &state)
+		if err != nil {
+			return err
+		}
+		if err := dbResetChainTips(dbTx, &state.hash); err != nil {
+			return err
+		}
+
+		// Replace the utxo set of the genesis block with the one of
+		// the snapshot.
+		meta := dbTx.Metadata()
+		utxoBucket := meta.Bucket(utxoSetBucketName)
+		var genesisKeys [][]byte
+		err = utxoBucket.ForEach(func(k, v []byte) error {
+			genesisKeys = append(genesisKeys, k)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range genesisKeys {
+			if err := utxoBucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		numEntries, err := wire.ReadVarInt(hr, 0)
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < numEntries; i++ {
+			var txHash chainhash.Hash
+			if _, err := io.ReadFull(hr, txHash[:]); err != nil {
+				return err
+			}
+			serialized, err := wire.ReadVarBytes(hr, 0,
+				maxUtxoSnapshotField, "utxo entry")
+			if err != nil {
+				return err
+			}
+			if _, err := deserializeUtxoEntry(serialized); err != nil {
+				return errUtxoSnapshot(fmt.Sprintf("the utxo "+
+					"entry for %v is malformed: %v", txHash,
+					err))
+			}
+			if err := utxoBucket.Put(txHash[:], serialized); err != nil {
+				return err
+			}
+		}
+
+		// Verify the commitment before anything is committed.
+		var commitment [sha256.Size]byte
+		if _, err := io.ReadFull(r, commitment[:]); err != nil {
+			return err
+		}
+		if !bytes.Equal(commitment[:], hasher.Sum(nil)) {
+			return errUtxoSnapshot("the utxo snapshot does not match " +
+				"its commitment")
+		}
+
+		if err := meta.Put(chainStateKeyName, serializedState); err != nil {
+			return err
+		}
+		if err := meta.Put(keySetBucketName, serializedKeySet); err != nil {
+			return err
+		}
+
+		// The admin state as of the genesis block is replaced by the
+		// one as of the tip, since the blocks in between are missing.
+		if err := dbRemoveAdminSnapshot(dbTx, 0); err != nil {
+			return err
+		}
+		return dbPutAdminSnapshot(dbTx, state.height, adminState)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Load the imported chain state, starting over with an empty memory
+	// block index.
+	b.indexLock.Lock()
+	b.index = make(map[chainhash.Hash]*blockNode)
+	b.depNodes = make(map[chainhash.Hash][]*blockNode)
+	b.failedBlocks = make(map[chainhash.Hash]struct{})
+	b.indexLock.Unlock()
+	b.nextCheckpoint = nil
+	b.checkpointHeader = nil
+	if err := b.initChainState(); err != nil {
+		return err
+	}
+
+	log.Infof("Imported utxo snapshot at block %v (height %d)", tipHash,
+		state.height)
+	return nil
+}
+
+// importSnapshotBlocks reads the blocks of a utxo snapshot from the passed
+// reader and stores them, along with their spend journal entries, as the main
+// chain blocks preceding the tip of the passed best chain state.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) importSnapshotBlocks(dbTx database.Tx, r io.Reader, state *bestChainState) error {
+	numBlocks, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return err
+	}
+	if numBlocks == 0 || numBlocks > uint64(state.height) ||
+		numBlocks > uint64(utxoSnapshotBlocks(b.chainParams)) {
+
+		return errUtxoSnapshot(fmt.Sprintf("the utxo snapshot has %d "+
+			"blocks for a tip at height %d", numBlocks,
+			state.height))
+	}
+
+	spendBucket := dbTx.Metadata().Bucket(spendJournalBucketName)
+	height := state.height - uint32(numBlocks) + 1
+	var prevHash *chainhash.Hash
+	for i := uint64(0); i < numBlocks; i, height = i+1, height+1 {
+		blockBytes, err := wire.ReadVarBytes(r, 0, maxUtxoSnapshotField,
+			"block")
+		if err != nil {
+			return err
+		}
+		block, err := provautil.NewBlockFromBytesEncoding(blockBytes,
+			b.chainParams.TxEncoding())
+		if err != nil {
+			return errUtxoSnapshot(fmt.Sprintf("the block at height "+
+				"%d of the utxo snapshot is malformed: %v",
+				height, err))
+		}
+		header := &block.MsgBlock().Header
+		if header.Height != height ||
+			(prevHash != nil && header.PrevBlock != *prevHash) {
+
+			return errUtxoSnapshot(fmt.Sprintf("block %v of the "+
+				"utxo snapshot does not extend the preceding "+
+				"block at height %d", block.Hash(), height))
+		}
+		if height == state.height && *block.Hash() != state.hash {
+			return errUtxoSnapshot(fmt.Sprintf("the last block of "+
+				"the utxo snapshot is %v instead of its tip %v",
+				block.Hash(), state.hash))
+		}
+		block.SetHeight(height)
+		prevHash = block.Hash()
+
+		serializedStxos, err := wire.ReadVarBytes(r, 0,
+			maxUtxoSnapshotField, "spend journal entry")
+		if err != nil {
+			return err
+		}
+		if err := dbTx.StoreBlock(block); err != nil {
+			return err
+		}
+		if err := dbPutBlockIndex(dbTx, block.Hash(), height); err != nil {
+			return err
+		}
+		if len(serializedStxos) > 0 {
+			err := spendBucket.Put(block.Hash()[:], serializedStxos)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// utxoSet returns the amounts and public key scripts of the unspent outputs of
+// the passed chain keyed by their outpoints.
+func utxoSet(t *testing.T, chain *blockchain.BlockChain) map[wire.OutPoint]string {
+	utxos := make(map[wire.OutPoint]string)
+	err := chain.ForEachUtxo(func(outpoint wire.OutPoint, entry *blockchain.UtxoEntry) error {
+		utxos[outpoint] = fmt.Sprintf("%d %x %d %v",
+			entry.AmountByIndex(outpoint.Index),
+			entry.PkScriptByIndex(outpoint.Index),
+			entry.BlockHeight(), entry.IsCoinBase())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachUtxo: %v", err)
+	}
+	return utxos
+}
+
+// TestUtxoSnapshot ensures a utxo snapshot exported at a block of the main
+// chain of the tests generated by the fullblocktests package can be imported
+// into a new chain, which then accepts the following blocks and ends up with
+// the same chain state as the chain which processed all of them.
+func TestUtxoSnapshot(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	tests, err := fullblocktests.GenerateWithParams(&params, false,
+		fullblocktests.DefaultSeed)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	// Process all blocks of the tests and collect the blocks of the
+	// resulting main chain.
+	full, teardownFunc, err := chainSetup("utxosnapshotfull", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	for _, test := range tests {
+		for _, item := range test {
+			var block *wire.MsgBlock
+			switch item := item.(type) {
+			case fullblocktests.AcceptedBlock:
+				block = item.Block
+			case fullblocktests.RejectedBlock:
+				block = item.Block
+			case fullblocktests.OrphanOrRejectedBlock:
+				block = item.Block
+			default:
+				continue
+			}
+			full.ProcessBlock(provautil.NewBlock(block), blockchain.BFNone)
+		}
+	}
+	best := full.BestSnapshot()
+	var mainChain []*provautil.Block
+	for height := uint32(1); height <= best.Height; height++ {
+		block, err := full.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockByHeight(%d): %v", height, err)
+		}
+		mainChain = append(mainChain, block)
+	}
+	wantUtxos := utxoSet(t, full)
+
+	// Export the snapshots at the first block, in the middle of the main
+	// chain, and right before its tip, which is past the number of blocks
+	// the snapshots include.
+	for _, height := range []int{1, len(mainChain) / 2, len(mainChain) - 1} {
+		name := fmt.Sprintf("utxosnapshot%d", height)
+		source, teardownSource, err := chainSetup(name+"source", &params)
+		if err != nil {
+			t.Fatalf("Failed to setup chain instance: %v", err)
+		}
+		defer teardownSource()
+		for _, block := range mainChain[:height] {
+			_, _, err := source.ProcessBlock(block, blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("%s: ProcessBlock: %v", name, err)
+			}
+		}
+		var snapshot bytes.Buffer
+		if err := source.ExportUtxoSnapshot(&snapshot); err != nil {
+			t.Fatalf("%s: ExportUtxoSnapshot: %v", name, err)
+		}
+		tipHash := *mainChain[height-1].Hash()
+
+		// The snapshot can't be imported into a chain with blocks.
+		err = source.ImportUtxoSnapshot(bytes.NewReader(snapshot.Bytes()),
+			tipHash)
+		if err == nil {
+			t.Fatalf("%s: ImportUtxoSnapshot into a chain with "+
+				"blocks: unexpected success", name)
+		}
+
+		chain, teardownChain, err := chainSetup(name, &params)
+		if err != nil {
+			t.Fatalf("Failed to setup chain instance: %v", err)
+		}
+		defer teardownChain()
+
+		// Snapshots of other blocks and snapshots which don't match
+		// their commitment are rejected without changing the chain.
+		err = chain.ImportUtxoSnapshot(bytes.NewReader(snapshot.Bytes()),
+			*params.GenesisHash)
+		if err == nil {
+			t.Fatalf("%s: ImportUtxoSnapshot of another block: "+
+				"unexpected success", name)
+		}
+		corrupt := append([]byte(nil), snapshot.Bytes()...)
+		corrupt[len(corrupt)-1] ^= 0x01
+		err = chain.ImportUtxoSnapshot(bytes.NewReader(corrupt), tipHash)
+		if err == nil {
+			t.Fatalf("%s: ImportUtxoSnapshot with a wrong commitment: "+
+				"unexpected success", name)
+		}
+		if chain.BestSnapshot().Height != 0 {
+			t.Fatalf("%s: rejected snapshot changed the chain", name)
+		}
+
+		err = chain.ImportUtxoSnapshot(bytes.NewReader(snapshot.Bytes()),
+			tipHash)
+		if err != nil {
+			t.Fatalf("%s: ImportUtxoSnapshot: %v", name, err)
+		}
+		imported := chain.BestSnapshot()
+		if *imported.Hash != tipHash || !reflect.DeepEqual(imported,
+			source.BestSnapshot()) {
+
+			t.Fatalf("%s: got best state %+v, want %+v", name,
+				imported, source.BestSnapshot())
+		}
+
+		// The chain accepts the following blocks of the main chain and
+		// ends up with the same chain state.
+		for _, block := range mainChain[height:] {
+			_, isOrphan, err := chain.ProcessBlock(block,
+				blockchain.BFNone)
+			if err != nil || isOrphan {
+				t.Fatalf("%s: ProcessBlock at height %d: got "+
+					"orphan %v, %v", name,
+					block.MsgBlock().Header.Height, isOrphan,
+					err)
+			}
+		}
+		if got := chain.BestSnapshot(); !reflect.DeepEqual(got, best) {
+			t.Fatalf("%s: got best state %+v, want %+v", name, got,
+				best)
+		}
+		if !reflect.DeepEqual(chain.ThreadTips(), full.ThreadTips()) {
+			t.Errorf("%s: got thread tips %v, want %v", name,
+				chain.ThreadTips(), full.ThreadTips())
+		}
+		if !reflect.DeepEqual(chain.AdminKeySets(), full.AdminKeySets()) {
+			t.Errorf("%s: got admin key sets %v, want %v", name,
+				chain.AdminKeySets(), full.AdminKeySets())
+		}
+		if !reflect.DeepEqual(chain.KeyIDs(), full.KeyIDs()) {
+			t.Errorf("%s: got keyIDs %v, want %v", name,
+				chain.KeyIDs(), full.KeyIDs())
+		}
+		if chain.LastKeyID() != full.LastKeyID() {
+			t.Errorf("%s: got last keyID %v, want %v", name,
+				chain.LastKeyID(), full.LastKeyID())
+		}
+		if got := utxoSet(t, chain); !reflect.DeepEqual(got, wantUtxos) {
+			t.Errorf("%s: got %d unspent outputs, want %d", name,
+				len(got), len(wantUtxos))
+		}
+	}
+}
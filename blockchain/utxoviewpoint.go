@@ -6,11 +6,15 @@
 package blockchain
 
 import (
+	"context"
 	"fmt"
+	"sort"
+
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
 )
 
 // utxoOutput houses details about an individual unspent transaction output such
@@ -27,10 +31,11 @@ import (
 // provides a mechanism to avoid the overhead of needlessly uncompressing all
 // outputs for a given utxo entry at the time of load.
 type utxoOutput struct {
-	spent      bool   // Output is spent.
-	compressed bool   // The amount and public key script are compressed.
-	amount     int64  // The amount of the output.
-	pkScript   []byte // The public key script for the output.
+	spent         bool   // Output is spent.
+	compressed    bool   // The amount and public key script are compressed.
+	amount        int64  // The amount of the output.
+	pkScript      []byte // The public key script for the output.
+	scriptVersion uint16 // The script version of the public key script.
 }
 
 // maybeDecompress decompresses the amount and public key script fields of the
@@ -121,6 +126,24 @@ func (entry *UtxoEntry) IsFullySpent() bool {
 	return true
 }
 
+// UnspentOutputIndexes returns the indexes of the unspent outputs of the
+// transaction the utxo entry represents in ascending order.
+func (entry *UtxoEntry) UnspentOutputIndexes() []uint32 {
+	outputOrder := make([]int, 0, len(entry.sparseOutputs))
+	for outputIndex, output := range entry.sparseOutputs {
+		if !output.spent {
+			outputOrder = append(outputOrder, int(outputIndex))
+		}
+	}
+	sort.Ints(outputOrder)
+
+	indexes := make([]uint32, 0, len(outputOrder))
+	for _, outputIndex := range outputOrder {
+		indexes = append(indexes, uint32(outputIndex))
+	}
+	return indexes
+}
+
 // AmountByIndex returns the amount of the provided output index.
 //
 // Returns 0 if the output index references an output that does not exist
@@ -153,6 +176,20 @@ func (entry *UtxoEntry) PkScriptByIndex(outputIndex uint32) []byte {
 	return output.pkScript
 }
 
+// ScriptVersionByIndex returns the script version of the public key script for
+// the provided output index.
+//
+// Returns the default script version if the output index references an output
+// that does not exist either due to it being invalid or because the output is
+// not part of the view due to previously being spent/pruned.
+func (entry *UtxoEntry) ScriptVersionByIndex(outputIndex uint32) uint16 {
+	output, ok := entry.sparseOutputs[outputIndex]
+	if !ok {
+		return txscript.DefaultScriptVersion
+	}
+	return output.scriptVersion
+}
+
 // Clone returns a deep copy of the utxo entry.
 func (entry *UtxoEntry) Clone() *UtxoEntry {
 	if entry == nil {
@@ -167,10 +204,11 @@ func (entry *UtxoEntry) Clone() *UtxoEntry {
 	}
 	for outputIndex, output := range entry.sparseOutputs {
 		newEntry.sparseOutputs[outputIndex] = &utxoOutput{
-			spent:      output.spent,
-			compressed: output.compressed,
-			amount:     output.amount,
-			pkScript:   output.pkScript,
+			spent:         output.spent,
+			compressed:    output.compressed,
+			amount:        output.amount,
+			pkScript:      output.pkScript,
+			scriptVersion: output.scriptVersion,
 		}
 	}
 	return newEntry
@@ -247,6 +285,7 @@ func (view *UtxoViewpoint) AddTxOuts(tx *provautil.Tx, blockHeight uint32) {
 		if txscript.IsUnspendable(txOut.PkScript) {
 			continue
 		}
+		scriptVersion := txscript.ScriptVersion(txOut.PkScript)
 
 		// Update existing entries.  All fields are updated because it's
 		// possible (although extremely unlikely) that the existing
@@ -258,15 +297,17 @@ func (view *UtxoViewpoint) AddTxOuts(tx *provautil.Tx, blockHeight uint32) {
 			output.compressed = false
 			output.amount = txOut.Value
 			output.pkScript = txOut.PkScript
+			output.scriptVersion = scriptVersion
 			continue
 		}
 
 		// Add the unspent transaction output.
 		entry.sparseOutputs[uint32(txOutIdx)] = &utxoOutput{
-			spent:      false,
-			compressed: false,
-			amount:     txOut.Value,
-			pkScript:   txOut.PkScript,
+			spent:         false,
+			compressed:    false,
+			amount:        txOut.Value,
+			pkScript:      txOut.PkScript,
+			scriptVersion: scriptVersion,
 		}
 	}
 	return
@@ -295,7 +336,7 @@ func (view *UtxoViewpoint) connectTransaction(tx *provautil.Tx, blockHeight uint
 		// Ensure the referenced utxo exists in the view.  This should
 		// never happen unless there is a bug is introduced in the code.
 		if entry == nil {
-			return AssertError(fmt.Sprintf("view missing input %v",
+			return assertError(fmt.Sprintf("view missing input %v",
 				txIn.PreviousOutPoint))
 		}
 		entry.SpendOutput(originIndex)
@@ -355,7 +396,7 @@ func (view *UtxoViewpoint) connectTransactions(block *provautil.Block, stxos *[]
 func (view *UtxoViewpoint) disconnectTransactions(block *provautil.Block, stxos []spentTxOut) error {
 	// Sanity check the correct number of stxos are provided.
 	if len(stxos) != countSpentOutputs(block) {
-		return AssertError("disconnectTransactions called with bad " +
+		return assertError("disconnectTransactions called with bad " +
 			"spent transaction out information")
 	}
 
@@ -417,12 +458,20 @@ func (view *UtxoViewpoint) disconnectTransactions(block *provautil.Block, stxos
 			// view.
 			output, ok := entry.sparseOutputs[originIndex]
 			if !ok {
-				// Add the unspent transaction output.
+				// Add the unspent transaction output.  The
+				// script version isn't part of the spend
+				// journal, so it is determined from the script.
+				pkScript := stxo.pkScript
+				if stxo.compressed {
+					pkScript = decompressScript(pkScript,
+						stxo.version)
+				}
 				entry.sparseOutputs[originIndex] = &utxoOutput{
-					spent:      false,
-					compressed: stxo.compressed,
-					amount:     stxo.amount,
-					pkScript:   stxo.pkScript,
+					spent:         false,
+					compressed:    stxo.compressed,
+					amount:        stxo.amount,
+					pkScript:      stxo.pkScript,
+					scriptVersion: txscript.ScriptVersion(pkScript),
 				}
 				continue
 			}
@@ -633,3 +682,93 @@ func (b *BlockChain) FetchUtxoEntry(txHash *chainhash.Hash) (*UtxoEntry, error)
 
 	return entry, nil
 }
+
+// FetchUtxoEntryByOutPoint loads and returns the unspent transaction output
+// entry of the transaction the passed outpoint references from the point of
+// view of the end of the main chain when the referenced output is unspent.
+// The amount and public key script of the output are available from the entry
+// by the index of the outpoint.
+//
+// NOTE: Requesting an outpoint which is spent or does not exist will NOT return
+// an error.  Instead both the entry and the error will be nil.
+//
+// This function is safe for concurrent access however the returned entry (if
+// any) is NOT.
+func (b *BlockChain) FetchUtxoEntryByOutPoint(outpoint wire.OutPoint) (*UtxoEntry, error) {
+	entry, err := b.FetchUtxoEntry(&outpoint.Hash)
+	if err != nil || entry == nil || entry.IsOutputSpent(outpoint.Index) {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ForEachUtxo invokes the passed function with the outpoint of every unspent
+// transaction output in the utxo set from the point of view of the end of the
+// main chain along with the unspent transaction output entry of its
+// transaction, which provides the amount and public key script of the output
+// by the index of the outpoint, and the height and coinbase flag of the
+// transaction.  The outputs of a transaction are visited in ascending index
+// order.  All entries are loaded from a single database snapshot, so blocks
+// that are connected while iterating do not affect the results.
+//
+// Iteration stops early when the passed function returns an error, in which
+// case that error is returned.
+//
+// This function is safe for concurrent access however the entries passed to
+// the function are NOT.
+func (b *BlockChain) ForEachUtxo(fn func(outpoint wire.OutPoint, entry *UtxoEntry) error) error {
+	return b.ForEachUtxoContext(context.Background(),
+		func(txHash *chainhash.Hash, entry *UtxoEntry) error {
+			for _, index := range entry.UnspentOutputIndexes() {
+				outpoint := wire.OutPoint{Hash: *txHash, Index: index}
+				if err := fn(outpoint, entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+}
+
+// ForEachUtxoContext invokes the passed function with the transaction hash and
+// unspent transaction output entry of every transaction in the utxo set from
+// the point of view of the end of the main chain.  All entries are loaded from
+// a single database snapshot, so blocks that are connected while iterating do
+// not affect the results.
+//
+// Iteration stops early when the passed function returns an error, in which
+// case that error is returned, or when the passed context is cancelled, in
+// which case the error of the context is returned.
+//
+// This function is safe for concurrent access however the entries passed to
+// the function are NOT.
+func (b *BlockChain) ForEachUtxoContext(ctx context.Context, fn func(txHash *chainhash.Hash, entry *UtxoEntry) error) error {
+	return b.db.View(func(dbTx database.Tx) error {
+		var numEntries int
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		return utxoBucket.ForEach(func(k, v []byte) error {
+			if numEntries%cancelCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			numEntries++
+
+			var txHash chainhash.Hash
+			copy(txHash[:], k)
+			entry, err := deserializeUtxoEntry(v)
+			if err != nil {
+				// Ensure any deserialization errors are returned
+				// as database corruption errors.
+				if isDeserializeErr(err) {
+					return database.Error{
+						ErrorCode: database.ErrCorruption,
+						Description: fmt.Sprintf("corrupt utxo "+
+							"entry for %v: %v", txHash, err),
+					}
+				}
+				return err
+			}
+			return fn(&txHash, entry)
+		})
+	})
+}
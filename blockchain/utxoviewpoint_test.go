@@ -0,0 +1,215 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// expectedUtxo describes an unspent transaction output which is expected to be
+// in the utxo set.
+type expectedUtxo struct {
+	amount     int64
+	pkScript   []byte
+	height     uint32
+	isCoinBase bool
+}
+
+// TestForEachUtxo ensures iterating the utxo set visits exactly the unspent
+// outputs of the main chain with their amount, public key script, height and
+// coinbase flag, also after some of them were spent, that the iteration is not
+// affected by blocks connected while it runs, that it stops early when the
+// passed function returns an error, and that single outputs are fetched by
+// their outpoint.
+func TestForEachUtxo(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("foreachutxo", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+
+	// The expected utxo set starts with the outputs of the genesis block
+	// and is updated as blocks are connected.
+	expected := make(map[wire.OutPoint]expectedUtxo)
+	addTxOuts := func(tx *wire.MsgTx, height uint32, isCoinBase bool) {
+		txHash := tx.TxHash()
+		for i, txOut := range tx.TxOut {
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+			expected[*wire.NewOutPoint(&txHash, uint32(i))] = expectedUtxo{
+				amount:     txOut.Value,
+				pkScript:   txOut.PkScript,
+				height:     height,
+				isCoinBase: isCoinBase,
+			}
+		}
+	}
+	connectBlock := func(prev *wire.MsgBlock, txns ...*wire.MsgTx) *wire.MsgBlock {
+		block, err := multiChainBlock(&params, prev, txns...)
+		if err != nil {
+			t.Fatalf("Failed to create block: %v", err)
+		}
+		_, _, err = chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: %v", err)
+		}
+		msgBlock := block.MsgBlock()
+		for i, tx := range msgBlock.Transactions {
+			for _, txIn := range tx.TxIn {
+				delete(expected, txIn.PreviousOutPoint)
+			}
+			addTxOuts(tx, msgBlock.Header.Height, i == 0)
+		}
+		return msgBlock
+	}
+	checkUtxoSet := func(want map[wire.OutPoint]expectedUtxo) {
+		got := make(map[wire.OutPoint]expectedUtxo)
+		err := chain.ForEachUtxo(func(outpoint wire.OutPoint, entry *blockchain.UtxoEntry) error {
+			if _, ok := got[outpoint]; ok {
+				t.Fatalf("ForEachUtxo: visited %v twice", outpoint)
+			}
+			got[outpoint] = expectedUtxo{
+				amount:     entry.AmountByIndex(outpoint.Index),
+				pkScript:   entry.PkScriptByIndex(outpoint.Index),
+				height:     entry.BlockHeight(),
+				isCoinBase: entry.IsCoinBase(),
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ForEachUtxo: unexpected error: %v", err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("ForEachUtxo: got %d outputs, want %d", len(got),
+				len(want))
+		}
+		for outpoint, w := range want {
+			g, ok := got[outpoint]
+			if !ok {
+				t.Fatalf("ForEachUtxo: missing output %v", outpoint)
+			}
+			if g.amount != w.amount || !bytes.Equal(g.pkScript, w.pkScript) ||
+				g.height != w.height || g.isCoinBase != w.isCoinBase {
+
+				t.Fatalf("ForEachUtxo: got output %v %+v, want %+v",
+					outpoint, g, w)
+			}
+		}
+	}
+
+	// Connect a handful of blocks with nothing but their coinbases.
+	for _, tx := range params.GenesisBlock.Transactions {
+		addTxOuts(tx, 0, blockchain.IsCoinBaseTx(tx))
+	}
+	var blocks []*wire.MsgBlock
+	prev := params.GenesisBlock
+	for i := 0; i < 4; i++ {
+		prev = connectBlock(prev)
+		blocks = append(blocks, prev)
+	}
+	checkUtxoSet(expected)
+
+	// Spend the coinbase of the first block to two outputs and the one of
+	// the second block to a single output.
+	spendTx := func(coinbase *wire.MsgTx, numTxOuts int) *wire.MsgTx {
+		coinbaseHash := coinbase.TxHash()
+		tx := wire.NewMsgTx(1)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(&coinbaseHash, 0),
+			Sequence:         wire.MaxTxInSequenceNum,
+		})
+		for i := 0; i < numTxOuts; i++ {
+			tx.AddTxOut(wire.NewTxOut(coinbase.TxOut[0].Value,
+				coinbase.TxOut[0].PkScript))
+		}
+		lookupKey := func(provautil.Address) ([]txscript.PrivateKey, error) {
+			return multiChainRootKeys, nil
+		}
+		sigScript, err := txscript.SignTxOutput(&params, tx, 0,
+			coinbase.TxOut[0].Value, coinbase.TxOut[0].PkScript,
+			txscript.SigHashAll, txscript.KeyClosure(lookupKey), nil)
+		if err != nil {
+			t.Fatalf("Failed to sign transaction: %v", err)
+		}
+		tx.TxIn[0].SignatureScript = sigScript
+		return tx
+	}
+	spent := blocks[0].Transactions[0]
+	prev = connectBlock(prev, spendTx(spent, 2),
+		spendTx(blocks[1].Transactions[0], 1))
+	checkUtxoSet(expected)
+
+	// Fetch a spent and an unspent output by their outpoints.
+	spentHash := spent.TxHash()
+	entry, err := chain.FetchUtxoEntryByOutPoint(*wire.NewOutPoint(&spentHash, 0))
+	if err != nil || entry != nil {
+		t.Fatalf("FetchUtxoEntryByOutPoint: got entry %v and error %v "+
+			"for spent output", entry, err)
+	}
+	unspentHash := prev.Transactions[1].TxHash()
+	entry, err = chain.FetchUtxoEntryByOutPoint(*wire.NewOutPoint(&unspentHash, 1))
+	if err != nil || entry == nil {
+		t.Fatalf("FetchUtxoEntryByOutPoint: got entry %v and error %v "+
+			"for unspent output", entry, err)
+	}
+	if entry.BlockHeight() != prev.Header.Height || entry.IsCoinBase() {
+		t.Fatalf("FetchUtxoEntryByOutPoint: got height %d and coinbase "+
+			"%v, want %d and false", entry.BlockHeight(),
+			entry.IsCoinBase(), prev.Header.Height)
+	}
+	entry, err = chain.FetchUtxoEntryByOutPoint(*wire.NewOutPoint(&unspentHash, 2))
+	if err != nil || entry != nil {
+		t.Fatalf("FetchUtxoEntryByOutPoint: got entry %v and error %v "+
+			"for nonexistent output", entry, err)
+	}
+
+	// A block connected while iterating is not visible to the iteration.
+	before := make(map[wire.OutPoint]expectedUtxo, len(expected))
+	for outpoint, utxo := range expected {
+		before[outpoint] = utxo
+	}
+	var numVisited int
+	err = chain.ForEachUtxo(func(wire.OutPoint, *blockchain.UtxoEntry) error {
+		if numVisited == 0 {
+			prev = connectBlock(prev)
+		}
+		numVisited++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachUtxo: unexpected error: %v", err)
+	}
+	if numVisited != len(before) {
+		t.Fatalf("ForEachUtxo: visited %d outputs while connecting a "+
+			"block, want %d", numVisited, len(before))
+	}
+	checkUtxoSet(expected)
+
+	// Iteration stops with the error returned by the passed function.
+	errStop := errors.New("stop")
+	numVisited = 0
+	err = chain.ForEachUtxo(func(wire.OutPoint, *blockchain.UtxoEntry) error {
+		numVisited++
+		if numVisited == 3 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop || numVisited != 3 {
+		t.Fatalf("ForEachUtxo: got error %v after %d outputs, want %v "+
+			"after 3", err, numVisited, errStop)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"math/big"
 	"time"
 
+	"github.com/bitgo/prova/blockchain/adminstate"
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
@@ -51,11 +52,11 @@ const (
 	// When admin transactions are validated, the pubKeyScript is generated
 	// from all active keys of that thread. The limit is needed to not exceed
 	// pubKeyScript size limits.
-	MaxAdminKeySetSize = 42
+	MaxAdminKeySetSize = adminstate.MaxKeySetSize
 
 	// MinValidateKeySetSize is the least amount of validators needed to run
 	// the chain. Rate Limiting for validators should not conflict with this.
-	MinValidateKeySetSize = 4
+	MinValidateKeySetSize = adminstate.MinValidateKeySetSize
 )
 
 var (
@@ -162,6 +163,34 @@ func IsFinalizedTransaction(tx *provautil.Tx, blockHeight uint32, blockTime time
 	return true
 }
 
+// IsExpiredTx returns whether the passed transaction carries an expiry height
+// and can't be included in a block at the passed height because the height is
+// at or after its expiry height.
+func IsExpiredTx(tx *provautil.Tx, blockHeight uint32) bool {
+	msgTx := tx.MsgTx()
+	return msgTx.HasExpiry() && msgTx.Expiry != wire.NoExpiryValue &&
+		blockHeight >= msgTx.Expiry
+}
+
+// CheckTransactionEncoding returns an error when the passed transaction is of
+// the version which carries an expiry height on the networks which enable it,
+// but its ExpiryEncoding doesn't match the TxExpiry chain parameter.  Such a
+// transaction is encoded, and hashed, differently than on the network, so it
+// couldn't be decoded again once stored.
+func CheckTransactionEncoding(tx *provautil.Tx, chainParams *chaincfg.Params) error {
+	msgTx := tx.MsgTx()
+	if msgTx.Version == wire.TxVersionExpiry &&
+		msgTx.ExpiryEncoding != chainParams.TxExpiry {
+
+		str := fmt.Sprintf("transaction %v of version %d uses expiry "+
+			"encoding %v on a network with transaction expiry %v",
+			tx.Hash(), msgTx.Version, msgTx.ExpiryEncoding,
+			chainParams.TxExpiry)
+		return ruleError(ErrInvalidTx, str)
+	}
+	return nil
+}
+
 // CalcBlockSubsidy returns the subsidy amount a block at the provided height
 // should have. This is mainly used for determining how much the coinbase for
 // newly generated blocks awards as well as validating the coinbase for blocks
@@ -181,6 +210,47 @@ func CalcBlockSubsidy(height uint32, chainParams *chaincfg.Params) int64 {
 	return baseSubsidy >> uint(height/chainParams.SubsidyReductionInterval)
 }
 
+// checkCoinbaseValue ensures the outputs of the passed coinbase transaction pay
+// exactly the passed subsidy plus the total fees of its block, or, when the
+// chain burns fees, no more than that with the remainder burned.  A block
+// without a subsidy or fees has nothing to pay, so its coinbase outputs must
+// all be zero-value outputs.
+//
+// It is safe to ignore overflow and out of range errors here because those
+// error conditions would have already been caught by CheckTransactionSanity.
+func checkCoinbaseValue(coinbase *provautil.Tx, subsidy, totalFees int64, chainParams *chaincfg.Params) error {
+	expectedAtomsOut := subsidy + totalFees
+	var totalAtomsOut int64
+	for i, txOut := range coinbase.MsgTx().TxOut {
+		if expectedAtomsOut == 0 && txOut.Value != 0 {
+			str := fmt.Sprintf("coinbase transaction for block "+
+				"without subsidy or fees pays %v in output %d "+
+				"instead of a zero-value output", txOut.Value, i)
+			return ruleError(ErrBadCoinbaseValue, str)
+		}
+		totalAtomsOut += txOut.Value
+	}
+
+	if chainParams.BurnFees {
+		if totalAtomsOut > expectedAtomsOut {
+			str := fmt.Sprintf("coinbase transaction for block pays "+
+				"%v which is more than the expected value of %v "+
+				"(subsidy %v, fees %v)", totalAtomsOut,
+				expectedAtomsOut, subsidy, totalFees)
+			return ruleError(ErrBadCoinbaseValue, str)
+		}
+		return nil
+	}
+	if totalAtomsOut != expectedAtomsOut {
+		str := fmt.Sprintf("coinbase transaction for block pays %v "+
+			"which is not the expected value of %v (subsidy %v, "+
+			"fees %v)", totalAtomsOut, expectedAtomsOut, subsidy,
+			totalFees)
+		return ruleError(ErrBadCoinbaseValue, str)
+	}
+	return nil
+}
+
 // CheckTransactionSanity performs some preliminary checks on a transaction to
 // ensure it is sane.  These checks are context free.
 // TODO(prova): Notice that this code is a dupclicate of transaction
@@ -355,7 +425,10 @@ func CheckTransactionSanity(tx *provautil.Tx) error {
 				// - Key in nulldata script must be valid
 				// - Data in nulldata scripts must match proper form expected for
 				//   the thread
-				if !txscript.IsValidAdminOp(adminOpOut, threadId) {
+				// Ops reserved for later soft forks are checked against the
+				// chain parameters by CheckTransactionOutputs.
+				if !txscript.IsValidAdminOp(adminOpOut, threadId) &&
+					!txscript.IsUpgradableAdminOp(adminOpOut) {
 					str := fmt.Sprintf("admin transaction with invalid admin " +
 						"operation found.")
 					return ruleError(ErrInvalidAdminTx, str)
@@ -371,12 +444,10 @@ func CheckTransactionSanity(tx *provautil.Tx) error {
 
 	// Previous transaction outputs referenced by the inputs to this
 	// transaction must not be null.
-	for _, txIn := range msgTx.TxIn {
+	for txInIndex, txIn := range msgTx.TxIn {
 		prevOut := &txIn.PreviousOutPoint
 		if isNullOutpoint(prevOut) {
-			return ruleError(ErrBadTxInput, "transaction "+
-				"input refers to previous output that "+
-				"is null")
+			return txInputError(ErrBadTxInput, tx, txInIndex, "null")
 		}
 	}
 
@@ -454,6 +525,23 @@ func CountSigOps(tx *provautil.Tx) int {
 	return totalSigOps
 }
 
+// CheckTxInputAvailable returns an error when the previous output referenced by
+// the passed input of the passed transaction is not available to be spent in
+// the passed view.  The error is a RuleError with ErrSpentTxOut when the output
+// exists, but has been spent, and ErrMissingTx when it is unknown.  The Input
+// field of the error identifies the input and the previous output.
+func CheckTxInputAvailable(tx *provautil.Tx, txInIndex int, utxoView *UtxoViewpoint) error {
+	prevOut := &tx.MsgTx().TxIn[txInIndex].PreviousOutPoint
+	entry := utxoView.LookupEntry(&prevOut.Hash)
+	if entry == nil {
+		return txInputError(ErrMissingTx, tx, txInIndex, "unknown")
+	}
+	if entry.IsOutputSpent(prevOut.Index) {
+		return txInputError(ErrSpentTxOut, tx, txInIndex, "spent")
+	}
+	return nil
+}
+
 // CountP2SHSigOps returns the number of signature operations for all input
 // transactions which are of the pay-to-script-hash type.  This uses the
 // precise, signature operation counting mechanism from the script engine which
@@ -470,15 +558,11 @@ func CountP2SHSigOps(tx *provautil.Tx, isCoinBaseTx bool, utxoView *UtxoViewpoin
 	totalSigOps := 0
 	for txInIndex, txIn := range msgTx.TxIn {
 		// Ensure the referenced input transaction is available.
-		originTxHash := &txIn.PreviousOutPoint.Hash
-		originTxIndex := txIn.PreviousOutPoint.Index
-		txEntry := utxoView.LookupEntry(originTxHash)
-		if txEntry == nil || txEntry.IsOutputSpent(originTxIndex) {
-			str := fmt.Sprintf("unable to find unspent output "+
-				"%v referenced from transaction %s:%d",
-				txIn.PreviousOutPoint, tx.Hash(), txInIndex)
-			return 0, ruleError(ErrMissingTx, str)
+		if err := CheckTxInputAvailable(tx, txInIndex, utxoView); err != nil {
+			return 0, err
 		}
+		originTxIndex := txIn.PreviousOutPoint.Index
+		txEntry := utxoView.LookupEntry(&txIn.PreviousOutPoint.Hash)
 
 		// We're only interested in pay-to-script-hash types, so skip
 		// this input if it's not one.
@@ -548,14 +632,17 @@ func checkBlockHeaderSanity(header *wire.BlockHeader, powLimit *big.Int, timeSou
 }
 
 // checkBlockSanity performs some preliminary checks on a block to ensure it is
-// sane before continuing with block processing.  These checks are context free.
+// sane before continuing with block processing.  These checks are context free
+// apart from the proof of work and transaction count limits of the passed
+// network parameters.
 //
 // The flags do not modify the behavior of this function directly, however they
 // are needed to pass along to checkBlockHeaderSanity.
-func checkBlockSanity(block *provautil.Block, powLimit *big.Int, timeSource MedianTimeSource, flags BehaviorFlags) error {
+func checkBlockSanity(block *provautil.Block, chainParams *chaincfg.Params, timeSource MedianTimeSource, flags BehaviorFlags) error {
 	msgBlock := block.MsgBlock()
 	header := &msgBlock.Header
-	err := checkBlockHeaderSanity(header, powLimit, timeSource, flags)
+	err := checkBlockHeaderSanity(header, chainParams.PowLimit, timeSource,
+		flags)
 	if err != nil {
 		return err
 	}
@@ -567,10 +654,11 @@ func checkBlockSanity(block *provautil.Block, powLimit *big.Int, timeSource Medi
 			"any transactions")
 	}
 
-	// A block must not have more transactions than the max block payload.
-	if numTx > wire.MaxBlockPayload {
+	// A block must not have more transactions than the maximum of the
+	// network.
+	if numTx > chainParams.MaxBlockTransactions {
 		str := fmt.Sprintf("block contains too many transactions - "+
-			"got %d, max %d", numTx, wire.MaxBlockPayload)
+			"got %d, max %d", numTx, chainParams.MaxBlockTransactions)
 		return ruleError(ErrTooManyTransactions, str)
 	}
 
@@ -605,12 +693,16 @@ func checkBlockSanity(block *provautil.Block, powLimit *big.Int, timeSource Medi
 	}
 
 	// Do some preliminary checks on each transaction to ensure they are
-	// sane before continuing.
+	// sane and encoded for the network before continuing.
 	for _, tx := range transactions {
 		err := CheckTransactionSanity(tx)
 		if err != nil {
 			return err
 		}
+		err = CheckTransactionEncoding(tx, chainParams)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Build merkle tree and ensure the calculated merkle root matches the
@@ -662,9 +754,25 @@ func checkBlockSanity(block *provautil.Block, powLimit *big.Int, timeSource Medi
 }
 
 // CheckBlockSanity performs some preliminary checks on a block to ensure it is
-// sane before continuing with block processing.  These checks are context free.
-func CheckBlockSanity(block *provautil.Block, powLimit *big.Int, timeSource MedianTimeSource) error {
-	return checkBlockSanity(block, powLimit, timeSource, BFNone)
+// sane before continuing with block processing.  These checks are context free
+// apart from the proof of work and transaction count limits of the passed
+// network parameters.
+func CheckBlockSanity(block *provautil.Block, chainParams *chaincfg.Params, timeSource MedianTimeSource) error {
+	return checkBlockSanity(block, chainParams, timeSource, BFNone)
+}
+
+// checkBlockSignature ensures the block header is signed by the validate key it
+// specifies.  Whether the validate key is active is checked separately.
+func checkBlockSignature(header *wire.BlockHeader) error {
+	pubKey, err := btcec.ParsePubKey(header.ValidatingPubKey[:], btcec.S256())
+	if err != nil {
+		return ruleErrorWrap(ErrBadBlockSignature, "unable to parse "+
+			"block validating public key", err)
+	}
+	if !header.Verify(pubKey) {
+		return ruleError(ErrBadBlockSignature, "unable to validate block signature")
+	}
+	return nil
 }
 
 // checkBlockHeaderContext peforms several validation checks on the block header
@@ -710,14 +818,50 @@ func (b *BlockChain) checkBlockHeaderContext(header *wire.BlockHeader, prevNode
 			return ruleError(ErrTimeTooOld, str)
 		}
 
-		// Verify the block's signature by an active validate key.
-		// TODO(prova): confirm that the validating pubkey is valid
-		pubKey, err := btcec.ParsePubKey(header.ValidatingPubKey[:], btcec.S256())
-		if err != nil {
-			return err
+		// Ensure the timestamp for the block header is after the
+		// timestamp of the previous block when the chain requires
+		// strictly increasing block times.
+		if b.chainParams.StrictMonotonicTime {
+			prevTime := time.Unix(prevNode.timestamp, 0)
+			if !header.Timestamp.After(prevTime) {
+				str := "block timestamp of %v is not after the " +
+					"previous block timestamp of %v"
+				str = fmt.Sprintf(str, header.Timestamp, prevTime)
+				return ruleError(ErrNonMonotonicTime, str)
+			}
+		}
+
+		// Ensure the timestamp for the block header is not further
+		// before the latest time of the last several blocks than the
+		// chain allows, so block times can't be walked backward while
+		// staying after the median time.
+		if b.chainParams.TimeRegressionWindow > 0 {
+			maxTime, err := b.calcPastMaxTime(prevNode)
+			if err != nil {
+				log.Errorf("calcPastMaxTime: %v", err)
+				return err
+			}
+			minTime := maxTime.Add(-b.chainParams.MaxTimeRegression)
+			if header.Timestamp.Before(minTime) {
+				str := "block timestamp of %v is more than %v " +
+					"before the latest timestamp of %v of the " +
+					"last %d blocks"
+				str = fmt.Sprintf(str, header.Timestamp,
+					b.chainParams.MaxTimeRegression, maxTime,
+					b.chainParams.TimeRegressionWindow)
+				return ruleError(ErrTimestampRegression, str)
+			}
 		}
-		if !header.Verify(pubKey) {
-			return ruleError(ErrBadBlockSignature, "unable to validate block signature")
+
+		// Verify the block's signature by an active validate key unless
+		// it was already verified or the chain accepts blocks on proof
+		// of work alone.
+		// TODO(prova): confirm that the validating pubkey is valid
+		if !b.chainParams.PowOnly &&
+			flags&bfSignatureChecked != bfSignatureChecked {
+			if err := checkBlockSignature(header); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -742,14 +886,14 @@ func (b *BlockChain) checkBlockHeaderContext(header *wire.BlockHeader, prevNode
 	// chain before it.  This prevents storage of new, otherwise valid,
 	// blocks which build off of old blocks that are likely at a much easier
 	// difficulty and therefore could be used to waste cache and disk space.
-	checkpointBlock, err := b.findPreviousCheckpoint()
+	checkpointHeader, err := b.findPreviousCheckpoint()
 	if err != nil {
 		return err
 	}
-	if checkpointBlock != nil && blockHeight < checkpointBlock.Height() {
+	if checkpointHeader != nil && blockHeight < checkpointHeader.Height {
 		str := fmt.Sprintf("block at height %d forks the main chain "+
 			"before the previous checkpoint at height %d",
-			blockHeight, checkpointBlock.Height())
+			blockHeight, checkpointHeader.Height)
 		return ruleError(ErrForkTooOld, str)
 	}
 
@@ -806,20 +950,36 @@ func (b *BlockChain) checkBlockContext(block *provautil.Block, prevNode *blockNo
 		return nil
 	}
 
-	// Perform all block header related validation checks.
+	// Perform all block header related validation checks.  The signature
+	// of the header doesn't need to be verified again when the context free
+	// checks of the block were already performed.
 	header := &block.MsgBlock().Header
-	err := b.checkBlockHeaderContext(header, prevNode, flags)
+	headerFlags := flags
+	if block.ContextFreeChecked() {
+		headerFlags |= bfSignatureChecked
+	}
+	err := b.checkBlockHeaderContext(header, prevNode, headerFlags)
 	if err != nil {
 		return err
 	}
 
+	// Ensure the block isn't signed by a validate key which double signed
+	// when the chain rejects the blocks of such keys.
+	if err := b.checkDoubleSigner(header); err != nil {
+		return err
+	}
+
 	fastAdd := flags&BFFastAdd == BFFastAdd
 	if !fastAdd {
 		// The height of this block is one more than the referenced
 		// previous block.
 		blockHeight := prevNode.height + 1
 
-		// Ensure all transactions in the block are finalized.
+		// Ensure all transactions in the block are finalized and, when
+		// the chain enables transaction expiry, none of them expired.
+		// The expiry is checked against the height of the block on its
+		// own branch, so a transaction which is valid on one branch may
+		// be expired on another.
 		for _, tx := range block.Transactions() {
 			if !IsFinalizedTransaction(tx, blockHeight,
 				header.Timestamp) {
@@ -828,6 +988,14 @@ func (b *BlockChain) checkBlockContext(block *provautil.Block, prevNode *blockNo
 					"transaction %v", tx.Hash())
 				return ruleError(ErrUnfinalizedTx, str)
 			}
+			if b.chainParams.TxExpiry &&
+				IsExpiredTx(tx, blockHeight) {
+
+				str := fmt.Sprintf("block at height %d contains "+
+					"transaction %v which expired at height %d",
+					blockHeight, tx.Hash(), tx.MsgTx().Expiry)
+				return ruleError(ErrTxExpired, str)
+			}
 		}
 	}
 
@@ -898,10 +1066,8 @@ func CheckTransactionInputs(tx *provautil.Tx, txHeight uint32, utxoView *UtxoVie
 		originTxHash := &txIn.PreviousOutPoint.Hash
 		utxoEntry := utxoView.LookupEntry(originTxHash)
 		if utxoEntry == nil {
-			str := fmt.Sprintf("unable to find unspent output "+
-				"%v referenced from transaction %s:%d",
-				txIn.PreviousOutPoint, tx.Hash(), txInIndex)
-			return 0, ruleError(ErrMissingTx, str)
+			return 0, txInputError(ErrMissingTx, tx, txInIndex,
+				"unknown")
 		}
 
 		// Ensure admin thread tips are only spendable by same type admin
@@ -1048,155 +1214,95 @@ func CheckTransactionInputs(tx *provautil.Tx, txHeight uint32, utxoView *UtxoVie
 	return txFeeInAtoms, nil
 }
 
-// CheckProvaOutput checks that all keyIDs in the pkScript are known in
-// the chain state.
-//
-// NOTE: The passed output MUST have already been sanity checked with the
-// CheckTransactionSanity function prior to calling this function.
-func CheckProvaOutput(tx *provautil.Tx, txOutIndex int, keyIDs []btcec.KeyID,
-	keyView *KeyViewpoint) error {
-	for _, keyID := range keyIDs {
-		if keyView.aspKeyIdMap[keyID] == nil {
-			str := fmt.Sprintf("transaction %v output %v has unknown "+
-				"keyID %v.", tx.Hash(), txOutIndex, keyID)
-			return ruleError(ErrInvalidTx, str)
-		}
-	}
-	return nil
+// adminErrorCodes maps the error codes of the admin state rules to the error
+// codes of the chain rules.
+var adminErrorCodes = map[adminstate.ErrorCode]ErrorCode{
+	adminstate.ErrInvalidTx:      ErrInvalidTx,
+	adminstate.ErrInvalidAdminOp: ErrInvalidAdminOp,
+	adminstate.ErrKeyIDReuse:     ErrKeyIDReuse,
 }
 
 // CheckTransactionOutputs performs a series of checks on the outputs to ensure
-// that they are valid in the context of the chain state.
+// that they are valid in the context of the chain state.  The checks are
+// performed by the adminstate package against the admin state of the passed
+// view, and violations are returned as a RuleError.  Outputs which carry a
+// script version are only allowed when the chain parameters enable script
+// versions, admin ops reserved for later soft forks are only allowed when
+// they enable upgradable admin ops, and revoked keyIDs are only provisioned
+// again when they enable reprovisioning keyIDs.
 //
 // NOTE: The transaction MUST have already been sanity checked with the
 // CheckTransactionSanity function prior to calling this function.
-func CheckTransactionOutputs(tx *provautil.Tx, keyView *KeyViewpoint) error {
-	threadInt, adminOutputs := txscript.GetAdminDetails(tx)
-	hasAdminOut := (threadInt >= 0)
-	if !hasAdminOut {
-		// When not an admin transaction, all outputs should be
-		// Prova type spending to active keyIDs. An exception is made
-		// for coinbase txs which may have null data outputs.
-		hasNullDataOutput := false
-		for i, txOut := range tx.MsgTx().TxOut {
-			output, err := txscript.ParseScript(txOut.PkScript)
-			if err != nil {
-				return ruleError(ErrInvalidTx, fmt.Sprintf("%v", err))
-			}
-			scriptClass := txscript.TypeOfScript(output)
-			if txOut.Value == 0 && scriptClass == txscript.NullDataTy {
-				if !hasNullDataOutput {
-					hasNullDataOutput = true
-				} else {
-					str := fmt.Sprintf("nullData output at index %d"+
-						" exceeds nulldata output count limit", i)
-					return ruleError(ErrInvalidTx, str)
+func CheckTransactionOutputs(tx *provautil.Tx, keyView *KeyViewpoint, chainParams *chaincfg.Params) error {
+	if !chainParams.UpgradableAdminOps {
+		threadInt, adminOutputs := txscript.GetAdminDetails(tx)
+		if threadInt >= 0 && provautil.ThreadID(threadInt) !=
+			provautil.IssueThread {
+
+			for i, adminOutput := range adminOutputs {
+				if !txscript.IsUpgradableAdminOp(adminOutput) {
+					continue
 				}
-				continue
-			}
-			keyIDs, err := txscript.ExtractKeyIDs(output)
-			if err != nil {
-				return ruleError(ErrInvalidTx, fmt.Sprintf("%v", err))
-			}
-			err = CheckProvaOutput(tx, i, keyIDs, keyView)
-			if err != nil {
-				return err
+				str := fmt.Sprintf("admin transaction output %d has "+
+					"an admin op reserved for later soft forks "+
+					"while upgradable admin ops are not enabled",
+					i+1)
+				return ruleError(ErrInvalidAdminOp, str)
 			}
 		}
-		return nil
 	}
-	threadId := provautil.ThreadID(threadInt)
-	if threadId == provautil.IssueThread {
-		for i, output := range adminOutputs {
-			if len(output) > 2 {
-				keyIDs, err := txscript.ExtractKeyIDs(output)
-				if err != nil {
-					return ruleError(ErrInvalidTx, fmt.Sprintf("%v", err))
-				}
-				// +1 here, because first out was thread output,
-				// which is not contained in adminOutputs.
-				err = CheckProvaOutput(tx, i+1, keyIDs, keyView)
-				if err != nil {
-					return err
-				}
+
+	if !chainParams.ReprovisionKeyIDs {
+		err := checkNoKeyIDReprovisioning(tx, &keyView.state)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !chainParams.ScriptVersions {
+		for i, txOut := range tx.MsgTx().TxOut {
+			version := txscript.ScriptVersion(txOut.PkScript)
+			if version != txscript.DefaultScriptVersion {
+				str := fmt.Sprintf("transaction output %d has "+
+					"script version %d while script versions "+
+					"are not enabled", i, version)
+				return ruleError(ErrInvalidTx, str)
 			}
 		}
+	}
+
+	err := adminstate.CheckTransactionOutputs(tx, &keyView.state)
+	if rerr, ok := err.(adminstate.RuleError); ok {
+		return ruleError(adminErrorCodes[rerr.ErrorCode], rerr.Description)
+	}
+	return err
+}
+
+// checkNoKeyIDReprovisioning ensures the passed admin transaction does not
+// provision a revoked keyID again to the ASP key it was bound to, which the
+// admin state rules allow, for chains which don't allow revoked keyIDs to be
+// used again at all.  Provisioning a revoked keyID to another key is left to
+// the admin state rules, which reject it with ErrKeyIDReuse.
+func checkNoKeyIDReprovisioning(tx *provautil.Tx, state *adminstate.State) error {
+	threadInt, adminOutputs := txscript.GetAdminDetails(tx)
+	if threadInt < 0 || provautil.ThreadID(threadInt) == provautil.IssueThread {
 		return nil
 	}
-	// lastKeyId is a counter to validate intra-tx state changes
-	// lastKeyId verifies that add operations are strictly increasing
-	lastKeyId := keyView.LastKeyID()
-	// revokedMap is holding intra-tx state changes
-	// revokedMap prevents 2 operations on the same keyID in one tx
-	revokedMap := make(map[btcec.KeyID]bool)
-	for i := 0; i < len(adminOutputs); i++ {
+	for _, adminOutput := range adminOutputs {
+		if txscript.IsUpgradableAdminOp(adminOutput) {
+			continue
+		}
 		isAddOp, keySetType, pubKey,
-			keyID := txscript.ExtractAdminOpData(adminOutputs[i])
-		if keySetType == btcec.ASPKeySet {
-			// TODO(prova): check pubKey collisions
-			if isAddOp {
-				lastKeyId++
-				if keyView.aspKeyIdMap[keyID] != nil {
-					str := fmt.Sprintf("keyID %v added in transaction %v "+
-						"exists already in admin set. Operation "+
-						"rejected.", keyID, tx.Hash())
-					return ruleError(ErrInvalidAdminOp, str)
-				}
-				if keyID != lastKeyId {
-					str := fmt.Sprintf("keyID %v added in transaction %v "+
-						"rejected. should be %v ", keyID, tx.Hash(), keyView.LastKeyID()+1)
-					return ruleError(ErrInvalidAdminOp, str)
-				}
-			} else {
-				if keyView.aspKeyIdMap[keyID] == nil || revokedMap[keyID] {
-					str := fmt.Sprintf("keyID %v can not be revoked in "+
-						"transaction %v. It does not exist in admin set.",
-						keyID, tx.Hash())
-					return ruleError(ErrInvalidAdminOp, str)
-				}
-				if !keyView.aspKeyIdMap[keyID].IsEqual(pubKey) {
-					str := fmt.Sprintf("pubKey %v can not be revoked in "+
-						"transaction %v. It does not match admin state.",
-						pubKey.SerializeCompressed(), tx.Hash())
-					return ruleError(ErrInvalidAdminOp, str)
-				}
-				revokedMap[keyID] = true
-			}
-		} else {
-			keySet := keyView.adminKeySets[keySetType]
-			pos := keySet.Pos(pubKey)
-			if isAddOp {
-				if pos >= 0 {
-					str := fmt.Sprintf("key added in transaction %v "+
-						"exists already in admin set at position %v. "+
-						"Operation rejected.", tx.Hash(), pos)
-					return ruleError(ErrInvalidAdminOp, str)
-				}
-				if len(keySet) >= MaxAdminKeySetSize {
-					str := fmt.Sprintf("admin transaction %v tries to add "+
-						"key to admin key set. Yet the set has reached max "+
-						"size %v.", tx.Hash(), len(keySet))
-					return ruleError(ErrInvalidAdminOp, str)
-				}
-			} else {
-				if pos == -1 {
-					str := fmt.Sprintf("admin transaction %v tries to remove "+
-						"non-existing key %v. ", tx.Hash(), pubKey)
-					return ruleError(ErrInvalidAdminOp, str)
-				}
-				// minLen describes the min amount of active admin keys
-				// to keep in a set. This seems only critical for root keys,
-				minLen := 0 // but root key set is fixed.
-				if keySetType == btcec.ValidateKeySet {
-					minLen = MinValidateKeySetSize
-				}
-				if len(keySet) <= minLen {
-					str := fmt.Sprintf("admin transaction %v tries to remove "+
-						"key from admin key set with length 2. At least 2 keys "+
-						"have to stay provisioned.", tx.Hash())
-					return ruleError(ErrInvalidAdminOp, str)
-				}
-			}
+			keyID := txscript.ExtractAdminOpData(adminOutput)
+		if !isAddOp || keySetType != btcec.ASPKeySet {
+			continue
+		}
+		revoked, ok := state.RevokedKeys[keyID]
+		if ok && revoked.PubKey.IsEqual(pubKey) {
+			str := fmt.Sprintf("keyID %v added in transaction %v "+
+				"was revoked and revoked keyIDs can not be "+
+				"provisioned again", keyID, tx.Hash())
+			return ruleError(ErrInvalidAdminOp, str)
 		}
 	}
 	return nil
@@ -1276,7 +1382,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 
 	// Ensure the view is for the node being checked.
 	if !utxoView.BestHash().IsEqual(node.parentHash) {
-		return AssertError(fmt.Sprintf("inconsistent view when "+
+		return assertError(fmt.Sprintf("inconsistent view when "+
 			"checking block connection: best hash is %v instead "+
 			"of expected %v", utxoView.BestHash(), node.hash))
 	}
@@ -1366,7 +1472,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 		}
 
 		// CheckTransactionOutputs checks outputs for state violations.
-		err = CheckTransactionOutputs(tx, keyView)
+		err = CheckTransactionOutputs(tx, keyView, b.chainParams)
 		if err != nil {
 			return err
 		}
@@ -1385,22 +1491,13 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 		keyView.connectTransaction(tx, node.height)
 	}
 
-	// The total output values of the coinbase transaction must not exceed
-	// the expected subsidy value plus total transaction fees gained from
-	// mining the block.  It is safe to ignore overflow and out of range
-	// errors here because those error conditions would have already been
-	// caught by checkTransactionSanity.
-	var totalAtomsOut int64
-	for _, txOut := range transactions[0].MsgTx().TxOut {
-		totalAtomsOut += txOut.Value
-	}
-	expectedAtomsOut := CalcBlockSubsidy(node.height, b.chainParams) +
-		totalFees
-	if totalAtomsOut != expectedAtomsOut {
-		str := fmt.Sprintf("coinbase transaction for block pays %v "+
-			"which is not the expected value of %v",
-			totalAtomsOut, expectedAtomsOut)
-		return ruleError(ErrBadCoinbaseValue, str)
+	// The coinbase transaction must pay the expected subsidy value plus
+	// total transaction fees gained from mining the block.
+	err = checkCoinbaseValue(transactions[0],
+		CalcBlockSubsidy(node.height, b.chainParams), totalFees,
+		b.chainParams)
+	if err != nil {
+		return err
 	}
 
 	// Don't run scripts if this node is before the latest known good
@@ -1443,15 +1540,19 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 	}
 
 	// Check that the validate key used to sign the block is represented in
-	// the current admin keyset state.
-	validateKeySet := keyView.Keys()[btcec.ValidateKeySet]
-	pubKey, err := btcec.ParsePubKey(blockHeader.ValidatingPubKey[:], btcec.S256())
-	if err != nil {
-		return err
-	}
-	if len(validateKeySet) > 0 && validateKeySet.Pos(pubKey) == -1 {
-		str := fmt.Sprintf("invalid validate key %v", pubKey.SerializeCompressed())
-		return ruleError(ErrInvalidValidateKey, str)
+	// the current admin keyset state.  Blocks are not signed when the chain
+	// accepts them on proof of work alone.
+	if !b.chainParams.PowOnly {
+		validateKeySet := keyView.Keys()[btcec.ValidateKeySet]
+		pubKey, err := btcec.ParsePubKey(blockHeader.ValidatingPubKey[:], btcec.S256())
+		if err != nil {
+			return ruleErrorWrap(ErrInvalidValidateKey, "unable to "+
+				"parse block validating public key", err)
+		}
+		if len(validateKeySet) > 0 && validateKeySet.Pos(pubKey) == -1 {
+			str := fmt.Sprintf("invalid validate key %v", pubKey.SerializeCompressed())
+			return ruleError(ErrInvalidValidateKey, str)
+		}
 	}
 
 	// Enforce CHECKLOCKTIMEVERIFY for block versions 4+ once the majority
@@ -1463,14 +1564,22 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 		scriptFlags |= txscript.ScriptVerifyCheckLockTimeVerify
 	}
 
-	// Check to see if there is a validate key rate limit breach.
-	isRateLimited, err := b.isValidateKeyRateLimited(node, blockHeader.ValidatingPubKey, false)
-	if err != nil {
-		return err
+	// Treat outputs with an unknown script version as anyone-can-spend
+	// when the chain parameters enable script versions.
+	if b.chainParams.ScriptVersions {
+		scriptFlags |= txscript.ScriptVerifyScriptVersions
 	}
-	if isRateLimited {
-		str := fmt.Sprintf("Validate key rate limited %v", blockHeader.ValidatingPubKey)
-		return ruleError(ErrExcessiveTrailing, str)
+
+	// Check to see if there is a validate key rate limit breach.
+	if !b.chainParams.PowOnly {
+		isRateLimited, err := b.isValidateKeyRateLimited(node, blockHeader.ValidatingPubKey, false)
+		if err != nil {
+			return err
+		}
+		if isRateLimited {
+			str := fmt.Sprintf("Validate key rate limited %v", blockHeader.ValidatingPubKey)
+			return ruleError(ErrExcessiveTrailing, str)
+		}
 	}
 
 	// Now that the inexpensive checks are done and have passed, verify the
@@ -1478,7 +1587,9 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 	// expensive ECDSA signature check scripts.  Doing this last helps
 	// prevent CPU exhaustion attacks.
 	if runScripts {
-		err := checkBlockScripts(block, utxoView, keyView, scriptFlags, b.sigCache, b.hashCache)
+		err := checkBlockScripts(block, utxoView, keyView, scriptFlags,
+			b.sigCache, b.hashCache, b.sigVerifyWorkers,
+			b.checkPreempt)
 		if err != nil {
 			return err
 		}
@@ -1526,5 +1637,6 @@ func (b *BlockChain) CheckConnectBlock(block *provautil.Block) error {
 	keyView.SetTotalSupply(b.totalSupply)
 	keyView.SetKeys(b.adminKeySets)
 	keyView.SetKeyIDs(b.aspKeyIdMap)
+	keyView.SetRevokedKeys(b.revokedKeys)
 	return b.checkConnectBlock(newNode, block, utxoView, keyView, nil)
 }
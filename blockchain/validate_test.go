@@ -8,6 +8,7 @@ package blockchain_test
 import (
 	"bytes"
 	"encoding/hex"
+	"fmt"
 	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
@@ -100,10 +101,10 @@ func TestCheckConnectBlock(t *testing.T) {
 // TestCheckBlockSanity tests the CheckBlockSanity function to ensure it works
 // as expected.
 func TestCheckBlockSanity(t *testing.T) {
-	powLimit := chaincfg.MainNetParams.PowLimit
+	params := &chaincfg.MainNetParams
 	block := provautil.NewBlock(&SomeBlock)
 	timeSource := blockchain.NewMedianTime()
-	err := blockchain.CheckBlockSanity(block, powLimit, timeSource)
+	err := blockchain.CheckBlockSanity(block, params, timeSource)
 	if err != nil {
 		t.Errorf("CheckBlockSanity: %v", err)
 	}
@@ -112,7 +113,7 @@ func TestCheckBlockSanity(t *testing.T) {
 	// second fails.
 	timestamp := block.MsgBlock().Header.Timestamp
 	block.MsgBlock().Header.Timestamp = timestamp.Add(time.Nanosecond)
-	err = blockchain.CheckBlockSanity(block, powLimit, timeSource)
+	err = blockchain.CheckBlockSanity(block, params, timeSource)
 	if err == nil {
 		t.Errorf("CheckBlockSanity: error is nil when it shouldn't be")
 	}
@@ -862,7 +863,8 @@ func TestCheckTransactionOutputs(t *testing.T) {
 		if test.isCoinbase {
 			tx.SetIndex(0)
 		}
-		err := blockchain.CheckTransactionOutputs(tx, keyView)
+		err := blockchain.CheckTransactionOutputs(tx, keyView,
+			&chaincfg.MainNetParams)
 		if err == nil && test.isValid {
 			// Test passes since function returned valid for a
 			// transaction which is intended to be valid.
@@ -1062,3 +1064,77 @@ func TestCheckTransactionInputs(t *testing.T) {
 		}
 	}
 }
+
+// TestCheckTxInputAvailable ensures inputs which reference unknown and spent
+// outputs are reported with distinct error codes along with the spending
+// transaction, the input index, and the previous output.
+func TestCheckTxInputAvailable(t *testing.T) {
+	prevTx := provautil.NewTx(&wire.MsgTx{
+		Version: 1,
+		TxOut: []*wire.TxOut{
+			{Value: 1000, PkScript: []byte{txscript.OP_TRUE}},
+			{Value: 2000, PkScript: []byte{txscript.OP_TRUE}},
+		},
+	})
+	utxoView := blockchain.NewUtxoViewpoint()
+	utxoView.AddTxOuts(prevTx, 100)
+	utxoView.LookupEntry(prevTx.Hash()).SpendOutput(1)
+
+	unknownHash := chainhash.Hash{0x01}
+	tx := provautil.NewTx(&wire.MsgTx{
+		Version: 1,
+		TxIn: []*wire.TxIn{
+			{PreviousOutPoint: wire.OutPoint{Hash: *prevTx.Hash(), Index: 0}},
+			{PreviousOutPoint: wire.OutPoint{Hash: *prevTx.Hash(), Index: 1}},
+			{PreviousOutPoint: wire.OutPoint{Hash: unknownHash, Index: 2}},
+		},
+		TxOut: []*wire.TxOut{{Value: 500, PkScript: []byte{txscript.OP_TRUE}}},
+	})
+
+	tests := []struct {
+		txInIndex int
+		code      blockchain.ErrorCode
+		adjective string
+	}{
+		{txInIndex: 0},
+		{txInIndex: 1, code: blockchain.ErrSpentTxOut, adjective: "spent"},
+		{txInIndex: 2, code: blockchain.ErrMissingTx, adjective: "unknown"},
+	}
+
+	for _, test := range tests {
+		err := blockchain.CheckTxInputAvailable(tx, test.txInIndex,
+			utxoView)
+		if test.adjective == "" {
+			if err != nil {
+				t.Errorf("input %d: unexpected error: %v",
+					test.txInIndex, err)
+			}
+			continue
+		}
+
+		rerr, ok := err.(blockchain.RuleError)
+		if !ok {
+			t.Errorf("input %d: unexpected error type - got %T",
+				test.txInIndex, err)
+			continue
+		}
+		prevOut := tx.MsgTx().TxIn[test.txInIndex].PreviousOutPoint
+		wantDesc := fmt.Sprintf("transaction %s input %d references "+
+			"%s output %s:%d", tx.Hash(), test.txInIndex,
+			test.adjective, prevOut.Hash, prevOut.Index)
+		if rerr.ErrorCode != test.code || rerr.Description != wantDesc {
+			t.Errorf("input %d: got %v %q, want %v %q",
+				test.txInIndex, rerr.ErrorCode, rerr.Description,
+				test.code, wantDesc)
+		}
+		wantInput := blockchain.TxInputRef{
+			TxHash:    *tx.Hash(),
+			TxInIndex: test.txInIndex,
+			PrevOut:   prevOut,
+		}
+		if rerr.Input == nil || *rerr.Input != wantInput {
+			t.Errorf("input %d: got input %+v, want %+v",
+				test.txInIndex, rerr.Input, wantInput)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+)
+
+// maxValidationCacheEntries is the maximum number of validation outcomes kept
+// by the validation cache of a chain instance.
+const maxValidationCacheEntries = 1000
+
+// ValidationCacheStats houses the statistics of the cache of recent validation
+// failures since the chain instance was created.
+type ValidationCacheStats struct {
+	// Hits is the number of blocks which were rejected with a cached
+	// outcome rather than being validated again.
+	Hits uint64
+
+	// Misses is the number of blocks which were not found in the cache,
+	// or whose cached outcome no longer held, and so were validated.
+	Misses uint64
+
+	// Entries is the number of outcomes currently in the cache.
+	Entries int
+}
+
+// validationOutcome houses the rule error a block was rejected with along with
+// what it depends on.
+type validationOutcome struct {
+	hash chainhash.Hash
+
+	// contentHash is the hash of the entire serialized block.  The header,
+	// and so the block hash, doesn't commit to the transactions of a block
+	// whose merkle root doesn't match them, so an invalid block may share
+	// its hash with a valid one.  The outcome only applies to the exact
+	// same block.
+	contentHash chainhash.Hash
+
+	// flags are the behavior flags the block was validated with, since
+	// they change which checks are performed.  BFPreemptible is left out
+	// since it doesn't.
+	flags BehaviorFlags
+
+	// contextual indicates the failure depends on the state of the chain,
+	// in which case the outcome only holds while tip is the tip of the
+	// best chain.
+	contextual bool
+	tip        chainhash.Hash
+
+	err RuleError
+}
+
+// validationCache is a bounded cache of the rule errors recent blocks were
+// rejected with, so a block which is submitted again, such as when a peer or
+// a signer retries, is rejected without being validated again.  Blocks which
+// were accepted aren't cached since they are known to the block index from
+// then on.  The least recently used outcome is evicted when the cache is full.
+//
+// The outcomes are only added and looked up with the chain lock held, while
+// the statistics are protected by the mutex of the cache so they can be read
+// at any time.
+type validationCache struct {
+	mtx      sync.Mutex
+	outcomes map[chainhash.Hash]*list.Element
+	order    *list.List
+	limit    int
+	hits     uint64
+	misses   uint64
+}
+
+// newValidationCache returns a new validation cache which holds at most the
+// passed number of outcomes.
+func newValidationCache(limit int) *validationCache {
+	return &validationCache{
+		outcomes: make(map[chainhash.Hash]*list.Element),
+		order:    list.New(),
+		limit:    limit,
+	}
+}
+
+// blockContentHash returns the hash of the entire serialized block.
+func blockContentHash(block *provautil.Block) (chainhash.Hash, error) {
+	serialized, err := block.Bytes()
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	return chainhash.DoubleHashH(serialized), nil
+}
+
+// lookup returns the rule error the passed block was rejected with when it was
+// validated with the same flags before and the outcome still holds with the
+// passed tip of the best chain.  A cached contextual failure is removed once
+// the tip changed.
+//
+// This function is safe for concurrent access.
+func (c *validationCache) lookup(block *provautil.Block, flags BehaviorFlags, tip *chainhash.Hash) (RuleError, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.outcomes[*block.Hash()]
+	if !ok {
+		c.misses++
+		return RuleError{}, false
+	}
+	outcome := elem.Value.(*validationOutcome)
+	if outcome.flags != flags&^BFPreemptible {
+		c.misses++
+		return RuleError{}, false
+	}
+	if outcome.contextual && outcome.tip != *tip {
+		c.order.Remove(elem)
+		delete(c.outcomes, outcome.hash)
+		c.misses++
+		return RuleError{}, false
+	}
+	contentHash, err := blockContentHash(block)
+	if err != nil || contentHash != outcome.contentHash {
+		c.misses++
+		return RuleError{}, false
+	}
+
+	c.order.MoveToFront(elem)
+	c.hits++
+	return outcome.err, true
+}
+
+// add records that the passed block was rejected with the passed error when
+// validated with the passed flags.  Contextual failures are recorded along
+// with the passed tip of the best chain.  Errors other than rule errors are
+// not recorded since they say nothing about the validity of the block, and
+// neither are errors which depend on the current time.
+//
+// This function is safe for concurrent access.
+func (c *validationCache) add(block *provautil.Block, flags BehaviorFlags, err error, contextual bool, tip *chainhash.Hash) {
+	rerr, ok := err.(RuleError)
+	if !ok || rerr.ErrorCode == ErrTimeTooNew || c.limit <= 0 {
+		return
+	}
+	contentHash, err := blockContentHash(block)
+	if err != nil {
+		return
+	}
+	outcome := &validationOutcome{
+		hash:        *block.Hash(),
+		contentHash: contentHash,
+		flags:       flags &^ BFPreemptible,
+		contextual:  contextual,
+		err:         rerr,
+	}
+	if contextual {
+		outcome.tip = *tip
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// Replace the outcome of the block when it was already recorded, such
+	// as for a different version of the block with the same hash.
+	if elem, ok := c.outcomes[outcome.hash]; ok {
+		elem.Value = outcome
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	// Evict the least recently used outcome when the cache is full and
+	// reuse its list element for the new outcome.
+	if len(c.outcomes) >= c.limit {
+		elem := c.order.Back()
+		delete(c.outcomes, elem.Value.(*validationOutcome).hash)
+		elem.Value = outcome
+		c.order.MoveToFront(elem)
+		c.outcomes[outcome.hash] = elem
+		return
+	}
+	c.outcomes[outcome.hash] = c.order.PushFront(outcome)
+}
+
+// Stats returns the statistics of the cache.
+//
+// This function is safe for concurrent access.
+func (c *validationCache) Stats() ValidationCacheStats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return ValidationCacheStats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Entries: len(c.outcomes),
+	}
+}
@@ -7,14 +7,18 @@ package main
 
 import (
 	"container/list"
+	"fmt"
 	"net"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcjson"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/database"
@@ -40,6 +44,44 @@ const (
 	// maxRequestedTxns is the maximum number of requested transactions
 	// hashes to store in memory.
 	maxRequestedTxns = wire.MaxInvPerMsg
+
+	// blockRequestTimeout is the duration a peer is given to deliver a
+	// requested block before the block is requested from another peer.
+	blockRequestTimeout = time.Minute
+
+	// blockRequestCheckInterval is the interval at which in-flight block
+	// requests are checked for having passed their deadline.
+	blockRequestCheckInterval = time.Second * 5
+
+	// maxBlockTimeouts is the number of consecutive block requests a peer
+	// may fail to deliver in time before it is penalized.
+	maxBlockTimeouts = 3
+
+	// blockTimeoutBanScore is the transient ban score a peer is penalized
+	// with each time its block requests are found to have timed out once
+	// it has reached maxBlockTimeouts.
+	blockTimeoutBanScore = 25
+
+	// limitedPeerSyncMargin is the number of blocks the tip of a peer which
+	// only serves a limited block history may advance by while blocks are
+	// downloaded from it.  Such peers are only synced from when the blocks
+	// needed are within its most recent wire.NodeNetworkLimitedMinBlocks
+	// blocks less this margin.
+	limitedPeerSyncMargin = 2
+
+	// blockPipelineDepth is the maximum number of blocks received from
+	// peers which are queued in the validation pipeline at once.
+	blockPipelineDepth = 16
+
+	// maxBlockPreemptions is the maximum number of times processing a
+	// block received from a peer is interrupted in favor of a better block
+	// queued after it.  The block is processed to completion afterwards,
+	// so it can't be put off indefinitely.
+	maxBlockPreemptions = 2
+
+	// errorStatsFlushInterval is the interval at which the counts of the
+	// rejected blocks and transactions are written to the database.
+	errorStatsFlushInterval = time.Minute * 5
 )
 
 // zeroHash is the zero value hash (all zeros).  It is defined as a convenience.
@@ -55,6 +97,15 @@ type newPeerMsg struct {
 type blockMsg struct {
 	block *provautil.Block
 	peer  *serverPeer
+
+	// pipelined indicates the block passed through the validation
+	// pipeline, in which case the peer was already signalled once the
+	// block was queued.
+	pipelined bool
+
+	// preemptions is the number of times processing the block was
+	// interrupted in favor of a better block.
+	preemptions int
 }
 
 // invMsg packages a bitcoin inv message and the peer it came from together
@@ -64,11 +115,26 @@ type invMsg struct {
 	peer *serverPeer
 }
 
+// headersMsg packages a bitcoin headers message and the peer it came from
+// together so the block handler has access to that information.
+type headersMsg struct {
+	headers *wire.MsgHeaders
+	peer    *serverPeer
+}
+
 // donePeerMsg signifies a newly disconnected peer to the block handler.
 type donePeerMsg struct {
 	peer *serverPeer
 }
 
+// blockRejectMsg signifies a peer rejected a block to the block handler, such
+// as a peer which only serves a limited block history rejecting the request
+// for an older block.
+type blockRejectMsg struct {
+	hash chainhash.Hash
+	peer *serverPeer
+}
+
 // txMsg packages a bitcoin tx message and the peer it came from together
 // so the block handler has access to that information.
 type txMsg struct {
@@ -82,9 +148,29 @@ type getSyncPeerMsg struct {
 	reply chan *serverPeer
 }
 
+// getChainSplitInfoMsg is a message type to be sent across the message channel
+// for comparing the best blocks of the peers against the best chain.
+type getChainSplitInfoMsg struct {
+	reply chan *btcjson.GetChainSplitInfoResult
+}
+
+// getThreadInfoMsg is a message type to be sent across the message channel for
+// checking the admin threads of the best chain.
+type getThreadInfoMsg struct {
+	reply chan threadInfoResponse
+}
+
+// threadInfoResponse is a response sent to the reply channel of a
+// getThreadInfoMsg.
+type threadInfoResponse struct {
+	result *btcjson.GetThreadInfoResult
+	err    error
+}
+
 // processBlockResponse is a response sent to the reply channel of a
 // processBlockMsg.
 type processBlockResponse struct {
+	status   blockchain.BlockStatus
 	isOrphan bool
 	err      error
 }
@@ -98,6 +184,23 @@ type processBlockMsg struct {
 	block *provautil.Block
 	flags blockchain.BehaviorFlags
 	reply chan processBlockResponse
+
+	// replicated indicates the block was received through the
+	// replication stream of a primary node rather than produced by this
+	// node.
+	replicated bool
+}
+
+// fallBackToSyncMsg is a message type to be sent across the message channel
+// for syncing the chain from peers after following a primary node through its
+// replication stream stopped.
+type fallBackToSyncMsg struct{}
+
+// repairBlockMsg is a message type to be sent across the message channel for
+// requesting a good copy of a block whose stored data is corrupt from the
+// connected peers.
+type repairBlockMsg struct {
+	hash *chainhash.Hash
 }
 
 // isCurrentMsg is a message type to be sent across the message channel for
@@ -115,6 +218,34 @@ type pauseMsg struct {
 	unpause <-chan struct{}
 }
 
+// beginBackupResponse is a response sent to the reply channel of a
+// beginBackupMsg.
+type beginBackupResponse struct {
+	backup database.Backup
+	best   *blockchain.BestState
+	pause  time.Duration
+	err    error
+}
+
+// beginBackupMsg is a message type to be sent across the message channel for
+// beginning a backup of the block database.  Since the backup is begun by the
+// block handler, no blocks are processed while the state of the database is
+// captured.
+type beginBackupMsg struct {
+	reply chan beginBackupResponse
+}
+
+// blockRequest houses the state of an in-flight block request.  Requests which
+// are not delivered by their deadline are retried with another peer, and the
+// peers which failed to deliver the block are tracked so they are not asked
+// for it again while other candidates remain.
+type blockRequest struct {
+	peer     *serverPeer
+	deadline time.Time
+	attempts int
+	failed   map[*serverPeer]struct{}
+}
+
 // blockManager provides a concurrency safe block manager for handling all
 // incoming blocks.
 type blockManager struct {
@@ -124,12 +255,38 @@ type blockManager struct {
 	chain           *blockchain.BlockChain
 	rejectedTxns    map[chainhash.Hash]struct{}
 	requestedTxns   map[chainhash.Hash]struct{}
-	requestedBlocks map[chainhash.Hash]struct{}
+	requestedBlocks map[chainhash.Hash]*blockRequest
+	repairBlocks    map[chainhash.Hash]struct{}
 	progressLogger  *blockProgressLogger
 	syncPeer        *serverPeer
 	msgChan         chan interface{}
+	pipeline        *blockchain.BlockPipeline
+	journal         *processingJournal
+	errorStats      *blockchain.ErrorStats
+	chainSplit      *chainSplitMonitor
+	threadWatch     *threadWatchdog
 	wg              sync.WaitGroup
 	quit            chan struct{}
+
+	// The following fields track the transactions of the blocks which are
+	// disconnected and connected during a reorganization of the main chain
+	// so the disconnected transactions can be returned to the mempool once
+	// it finished.  They are only accessed by the chain notification
+	// handler.
+	reorging     bool
+	reorgTxns    []*provautil.Tx
+	reorgMinedTx map[chainhash.Hash]struct{}
+
+	// ownBlock is the hash of the block produced by this node which is
+	// being processed, so it is passed on to the block broadcaster once it
+	// is connected to the main chain.  It is only accessed by the block
+	// handler.
+	ownBlock *chainhash.Hash
+
+	// replicating indicates the chain follows a primary node through its
+	// replication stream, so it is not synced from peers until that stops.
+	// It is only accessed by the block handler.
+	replicating bool
 }
 
 // startSync will choose the best peer among the available candidate peers to
@@ -137,13 +294,13 @@ type blockManager struct {
 // simply returns.  It also examines the candidates for any which are no longer
 // candidates and removes them as needed.
 func (b *blockManager) startSync(peers *list.List) {
-	// Return now if we're already syncing.
-	if b.syncPeer != nil {
+	// Return now if we're already syncing or following a primary node.
+	if b.syncPeer != nil || b.replicating {
 		return
 	}
 
 	best := b.chain.BestSnapshot()
-	var bestPeer *serverPeer
+	var bestPeer, limitedPeer *serverPeer
 	var enext *list.Element
 	for e := peers.Front(); e != nil; e = enext {
 		enext = e.Next()
@@ -160,18 +317,31 @@ func (b *blockManager) startSync(peers *list.List) {
 			continue
 		}
 
+		// Peers which only serve a limited block history are only
+		// synced from when no full history peer is available, such as
+		// during the initial block download, and the blocks needed are
+		// among the ones they serve.
+		if isLimitedPeer(sp) {
+			window := uint32(wire.NodeNetworkLimitedMinBlocks -
+				limitedPeerSyncMargin)
+			if limitedPeer == nil && sp.LastBlock()-best.Height <= window {
+				limitedPeer = sp
+			}
+			continue
+		}
+
 		// TODO(davec): Use a better algorithm to choose the best peer.
 		// For now, just pick the first available candidate.
 		bestPeer = sp
 	}
+	if bestPeer == nil {
+		bestPeer = limitedPeer
+	}
 
-	// Start syncing from the best peer if one was selected.
+	// Start syncing from the best peer if one was selected.  Blocks still
+	// in flight from other peers are not requested again since they are
+	// retried from another peer if they aren't delivered in time.
 	if bestPeer != nil {
-		// Clear the requestedBlocks if the sync peer changes, otherwise
-		// we may ignore blocks we need that the last sync peer failed
-		// to send.
-		b.requestedBlocks = make(map[chainhash.Hash]struct{})
-
 		locator, err := b.chain.LatestBlockLocator()
 		if err != nil {
 			bmgrLog.Errorf("Failed to get block locator for the "+
@@ -206,8 +376,11 @@ func (b *blockManager) isSyncCandidate(sp *serverPeer) bool {
 			return false
 		}
 	} else {
-		// The peer is not a candidate for sync if it's not a full node.
-		if sp.Services()&wire.SFNodeNetwork != wire.SFNodeNetwork {
+		// The peer is not a candidate for sync if it's not a full node,
+		// either with the full block history or a limited one.
+		if sp.Services()&wire.SFNodeNetwork != wire.SFNodeNetwork &&
+			!isLimitedPeer(sp) {
+
 			return false
 		}
 	}
@@ -216,6 +389,14 @@ func (b *blockManager) isSyncCandidate(sp *serverPeer) bool {
 	return true
 }
 
+// isLimitedPeer returns whether or not the passed peer only serves a limited
+// block history rather than the full one.
+func isLimitedPeer(sp *serverPeer) bool {
+	services := sp.Services()
+	return services&wire.SFNodeNetwork != wire.SFNodeNetwork &&
+		services&wire.SFNodeNetworkLimited == wire.SFNodeNetworkLimited
+}
+
 // handleNewPeerMsg deals with new peers that have signalled they may
 // be considered as a sync peer (they have already successfully negotiated).  It
 // also starts syncing if needed.  It is invoked from the syncHandler goroutine.
@@ -227,6 +408,11 @@ func (b *blockManager) handleNewPeerMsg(peers *list.List, sp *serverPeer) {
 
 	bmgrLog.Infof("New valid peer %s (%s)", sp, sp.UserAgent())
 
+	// Track the best block of the peer to detect chain splits.
+	if b.chainSplit != nil {
+		b.chainSplit.AddPeer(sp)
+	}
+
 	// Ignore the peer if it's not a sync candidate.
 	if !b.isSyncCandidate(sp) {
 		return
@@ -237,6 +423,10 @@ func (b *blockManager) handleNewPeerMsg(peers *list.List, sp *serverPeer) {
 
 	// Start syncing by choosing the best candidate if needed.
 	b.startSync(peers)
+
+	// Request any blocks that are waiting to be repaired now that there is
+	// a peer to fetch them from.
+	b.requestRepairBlocks(peers)
 }
 
 // handleDonePeerMsg deals with peers that have signalled they are done.  It
@@ -253,6 +443,9 @@ func (b *blockManager) handleDonePeerMsg(peers *list.List, sp *serverPeer) {
 	}
 
 	bmgrLog.Infof("Lost peer %s", sp)
+	if b.chainSplit != nil {
+		b.chainSplit.RemovePeer(sp)
+	}
 
 	// Remove requested transactions from the global map so that they will
 	// be fetched from elsewhere next time we get an inv.
@@ -260,13 +453,20 @@ func (b *blockManager) handleDonePeerMsg(peers *list.List, sp *serverPeer) {
 		delete(b.requestedTxns, k)
 	}
 
-	// Remove requested blocks from the global map so that they will be
-	// fetched from elsewhere next time we get an inv.
-	// TODO: we could possibly here check which peers have these blocks
-	// and request them now to speed things up a little.
-	for k := range sp.requestedBlocks {
-		delete(b.requestedBlocks, k)
+	// Request the blocks which were in flight from the peer from the
+	// remaining candidates right away rather than waiting for them to
+	// time out.  Blocks which are in flight from another peer because
+	// the request to this peer already timed out are left alone.
+	getDataMsgs := make(map[*serverPeer]*wire.MsgGetData)
+	for hash := range sp.requestedBlocks {
+		req, exists := b.requestedBlocks[hash]
+		if !exists || req.peer != sp {
+			continue
+		}
+		hash := hash
+		b.retryBlockRequest(peers, &hash, req, getDataMsgs)
 	}
+	sendGetDataMsgs(getDataMsgs)
 
 	// Attempt to find a new peer to sync from if the quitting peer is the
 	// sync peer.
@@ -274,6 +474,87 @@ func (b *blockManager) handleDonePeerMsg(peers *list.List, sp *serverPeer) {
 		b.syncPeer = nil
 		b.startSync(peers)
 	}
+
+	// Request any blocks waiting to be repaired which were outstanding with
+	// the quitting peer from another one.
+	b.requestRepairBlocks(peers)
+}
+
+// requestRepairBlocks requests all blocks waiting to be repaired that are not
+// already in flight from the sync peer, or the first candidate peer when there
+// is no sync peer.  The requests are retried as peers connect and disconnect
+// until a good copy of each block has been stored.
+func (b *blockManager) requestRepairBlocks(peers *list.List) {
+	if len(b.repairBlocks) == 0 {
+		return
+	}
+
+	sp := b.syncPeer
+	if sp == nil && peers.Front() != nil {
+		sp = peers.Front().Value.(*serverPeer)
+	}
+	if sp == nil {
+		numBlocks := uint64(len(b.repairBlocks))
+		bmgrLog.Debugf("No peers available to repair %d corrupt %s",
+			numBlocks, pickNoun(numBlocks, "block", "blocks"))
+		return
+	}
+
+	gdmsg := wire.NewMsgGetData()
+	for hash := range b.repairBlocks {
+		if _, exists := b.requestedBlocks[hash]; exists {
+			continue
+		}
+
+		hash := hash
+		b.requestBlock(sp, &hash, nil)
+		gdmsg.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &hash))
+	}
+	if len(gdmsg.InvList) > 0 {
+		numBlocks := uint64(len(gdmsg.InvList))
+		bmgrLog.Infof("Requesting %d corrupt %s from %s", numBlocks,
+			pickNoun(numBlocks, "block", "blocks"), sp)
+		sp.QueueMessage(gdmsg, nil)
+	}
+}
+
+// handleRepairBlock stores the passed block, which was requested because the
+// stored data for it is corrupt, in place of the corrupt data.  The block is
+// only stored when its transactions match the merkle root committed to by the
+// header so a misbehaving peer can't replace the data with a block that has the
+// same header but different transactions.
+func (b *blockManager) handleRepairBlock(bmsg *blockMsg) {
+	blockHash := bmsg.block.Hash()
+	transactions := bmsg.block.Transactions()
+	if len(transactions) == 0 {
+		bmgrLog.Warnf("Rejected repair of block %v from %s: no "+
+			"transactions", blockHash, bmsg.peer)
+		bmsg.peer.PushRejectMsg(wire.CmdBlock, wire.RejectInvalid,
+			"block has no transactions", blockHash, false)
+		return
+	}
+	merkles := blockchain.BuildMerkleTreeStore(transactions)
+	merkleRoot := &bmsg.block.MsgBlock().Header.MerkleRoot
+	if !merkleRoot.IsEqual(merkles[len(merkles)-1]) {
+		bmgrLog.Warnf("Rejected repair of block %v from %s: merkle "+
+			"root mismatch", blockHash, bmsg.peer)
+		bmsg.peer.PushRejectMsg(wire.CmdBlock, wire.RejectInvalid,
+			"block merkle root is invalid", blockHash, false)
+		return
+	}
+
+	err := b.server.db.Update(func(dbTx database.Tx) error {
+		return dbTx.RepairBlock(bmsg.block)
+	})
+	if err != nil {
+		bmgrLog.Errorf("Failed to repair block %v: %v", blockHash, err)
+		return
+	}
+
+	delete(b.repairBlocks, *blockHash)
+	b.server.blockScrubber.BlockRepaired(blockHash)
+	bmgrLog.Infof("Repaired corrupt block %v with data from %s", blockHash,
+		bmsg.peer)
 }
 
 // handleTxMsg handles transaction messages from all peers.
@@ -312,9 +593,15 @@ func (b *blockManager) handleTxMsg(tmsg *txMsg) {
 
 	if err != nil {
 		// Do not request this transaction again until a new block
-		// has been processed.
-		b.rejectedTxns[*txHash] = struct{}{}
-		b.limitMap(b.rejectedTxns, maxRejectedTxns)
+		// has been processed.  Transactions paying too little fee
+		// are exempt since the memory pool holds them for a while, and
+		// peers deliver them again along with a child which may pay
+		// for them.
+		code, reason := mempool.ErrToRejectErr(err)
+		if code != wire.RejectInsufficientFee {
+			b.rejectedTxns[*txHash] = struct{}{}
+			b.limitMap(b.rejectedTxns, maxRejectedTxns)
+		}
 
 		// When the error is a rule error, it means the transaction was
 		// simply rejected as opposed to something actually going wrong,
@@ -328,9 +615,7 @@ func (b *blockManager) handleTxMsg(tmsg *txMsg) {
 				txHash, err)
 		}
 
-		// Convert the error into an appropriate reject message and
-		// send it.
-		code, reason := mempool.ErrToRejectErr(err)
+		// Send the error as an appropriate reject message.
 		tmsg.peer.PushRejectMsg(wire.CmdTx, code, reason, txHash,
 			false)
 		return
@@ -360,8 +645,9 @@ func (b *blockManager) current() bool {
 	return true
 }
 
-// handleBlockMsg handles block messages from all peers.
-func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
+// receiveBlockMsg removes the block of the passed block message from the block
+// requests and returns whether the block should be processed.
+func (b *blockManager) receiveBlockMsg(bmsg *blockMsg) bool {
 	// If we didn't ask for this block then the peer is misbehaving.
 	blockHash := bmsg.block.Hash()
 	if _, exists := bmsg.peer.requestedBlocks[*blockHash]; !exists {
@@ -374,46 +660,125 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 			bmgrLog.Warnf("Got unrequested block %v from %s -- "+
 				"disconnecting", blockHash, bmsg.peer.Addr())
 			bmsg.peer.Disconnect()
-			return
+			return false
 		}
 	}
 
-	behaviorFlags := blockchain.BFNone
+	// The block is the best block known of the peer when it is higher
+	// than the ones it announced before, even if it turns out to be
+	// invalid.
+	if b.chainSplit != nil {
+		b.chainSplit.UpdatePeerTip(bmsg.peer, blockHash,
+			bmsg.block.MsgBlock().Header.Height)
+	}
 
 	// Remove block from request maps. Either chain will know about it and
 	// so we shouldn't have any more instances of trying to fetch it, or we
 	// will fail the insert and thus we'll retry next time we get an inv.
+	// The request may be in flight from another peer when the request to
+	// this peer timed out, in which case the copy from the other peer is
+	// ignored once it arrives.
+	_, wasRequested := bmsg.peer.requestedBlocks[*blockHash]
+	_, inFlight := b.requestedBlocks[*blockHash]
 	delete(bmsg.peer.requestedBlocks, *blockHash)
 	delete(b.requestedBlocks, *blockHash)
+	if wasRequested {
+		bmsg.peer.blockTimeouts = 0
+	}
+
+	// Blocks that were requested to replace corrupt stored data are
+	// already part of the chain, so store them directly rather than
+	// processing them.
+	if _, exists := b.repairBlocks[*blockHash]; exists {
+		b.handleRepairBlock(bmsg)
+		return false
+	}
+
+	// Ignore copies of blocks that were delivered late after the request
+	// timed out and was retried when another copy was already received.
+	if wasRequested && !inFlight {
+		haveBlock, err := b.chain.HaveBlock(blockHash)
+		if err == nil && haveBlock {
+			bmgrLog.Debugf("Ignoring late copy of block %v from %s",
+				blockHash, bmsg.peer)
+			return false
+		}
+	}
+	return true
+}
+
+// handleBlockMsg handles block messages from all peers.
+func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
+	// Blocks which are processed again after they were preempted were
+	// already removed from the block requests when they were received.
+	if bmsg.preemptions == 0 && !b.receiveBlockMsg(bmsg) {
+		return
+	}
+
+	// Blocks which passed through the validation pipeline may be
+	// interrupted in favor of better blocks queued after them a limited
+	// number of times.
+	blockHash := bmsg.block.Hash()
+	behaviorFlags := blockchain.BFNone
+	if bmsg.pipelined && bmsg.preemptions < maxBlockPreemptions {
+		behaviorFlags |= blockchain.BFPreemptible
+	}
 
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
-	_, isOrphan, err := b.chain.ProcessBlock(bmsg.block, behaviorFlags)
+	status, _, isOrphan, err := b.chain.ProcessBlockStatus(bmsg.block,
+		behaviorFlags)
 	if err != nil {
-		// When the error is a rule error, it means the block was simply
-		// rejected as opposed to something actually going wrong, so log
-		// it as such.  Otherwise, something really did go wrong, so log
-		// it as an actual error.
-		if _, ok := err.(blockchain.RuleError); ok {
-			bmgrLog.Infof("Rejected block %v from %s: %v", blockHash,
-				bmsg.peer, err)
-		} else {
+		if b.journal != nil {
+			b.journal.RecordRejected(bmsg.block, err)
+		}
+
+		// When the error is not a rule error, something really did go
+		// wrong locally, so log it as an actual error.  The block itself
+		// is not known to be invalid in this case, so don't hold it
+		// against the peer.  The chain does not treat the block as known
+		// either, so it will be requested again the next time it is
+		// announced.
+		if _, ok := err.(blockchain.RuleError); !ok {
 			bmgrLog.Errorf("Failed to process block %v: %v",
 				blockHash, err)
-		}
-		if dbErr, ok := err.(database.Error); ok && dbErr.ErrorCode ==
-			database.ErrCorruption {
-			panic(dbErr)
+			if dbErr, ok := err.(blockchain.DatabaseError); ok {
+				if cause, ok := dbErr.Err.(database.Error); ok &&
+					cause.ErrorCode == database.ErrCorruption {
+					panic(cause)
+				}
+			}
+			return
 		}
 
-		// Convert the error into an appropriate reject message and
-		// send it.
-		code, reason := mempool.ErrToRejectErr(err)
+		// The error is a rule error, which means the block was simply
+		// rejected as opposed to something actually going wrong, so log
+		// it as such, then convert the error into an appropriate reject
+		// message and send it.
+		bmgrLog.Infof("Rejected block %v from %s: %v", blockHash,
+			bmsg.peer, err)
+		code, reason := blockchain.ErrToRejectErr(err)
 		bmsg.peer.PushRejectMsg(wire.CmdBlock, code, reason,
 			blockHash, false)
 		return
 	}
 
+	// Blocks which were interrupted in favor of a better block are
+	// processed again after it.
+	if status == blockchain.BlockStatusPreempted {
+		b.requeuePreemptedBlock(bmsg)
+		return
+	}
+
+	// Blocks which are already known, such as ones announced and sent by
+	// several peers at the same time, are not a fault of the peer, so
+	// they are ignored without rejecting them.
+	if status.IsDuplicate() {
+		bmgrLog.Debugf("Ignoring duplicate block %v from %s (%v)",
+			blockHash, bmsg.peer, status)
+		return
+	}
+
 	// Meta-data about the new block this peer is reporting. We use this
 	// below to update this peer's lastest block height and the heights of
 	// other peers based on their last announced block hash. This allows us
@@ -480,6 +845,26 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 	}
 }
 
+// requeuePreemptedBlock queues the passed block message, whose processing was
+// interrupted in favor of a better block, to be handled again.  The better
+// block was queued before the request to interrupt was made, so the block is
+// handled again after it.
+func (b *blockManager) requeuePreemptedBlock(bmsg *blockMsg) {
+	bmsg.preemptions++
+	bmgrLog.Debugf("Processing block %v from %s was preempted by a better "+
+		"block (%d times)", bmsg.block.Hash(), bmsg.peer,
+		bmsg.preemptions)
+
+	// The block handler reads the queue, so it must not block on adding
+	// to it.
+	go func() {
+		select {
+		case b.msgChan <- bmsg:
+		case <-b.quit:
+		}
+	}()
+}
+
 // haveInventory returns whether or not the inventory represented by the passed
 // inventory vector is known.  This includes checking all of the various places
 // inventory can be when it is in different states such as blocks that are part
@@ -536,6 +921,18 @@ func (b *blockManager) handleInvMsg(imsg *invMsg) {
 		imsg.peer.UpdateLastAnnouncedBlock(&invVects[lastBlock].Hash)
 	}
 
+	// Track the final announced block as the best block of the peer.  The
+	// height of blocks which are not known yet is assumed to extend the
+	// best block known of the peer until the block is received.
+	if lastBlock != -1 && b.chainSplit != nil {
+		hash := invVects[lastBlock].Hash
+		height := imsg.peer.chainTip.height + 1
+		if header, err := b.chain.FetchHeader(&hash); err == nil {
+			height = header.Height
+		}
+		b.chainSplit.UpdatePeerTip(imsg.peer, &hash, height)
+	}
+
 	// Ignore invs from peers that aren't the sync if we are not current.
 	// Helps prevent fetching a mass of orphans.
 	if imsg.peer != b.syncPeer && !b.current() {
@@ -643,9 +1040,7 @@ func (b *blockManager) handleInvMsg(imsg *invMsg) {
 			// Request the block if there is not already a pending
 			// request.
 			if _, exists := b.requestedBlocks[iv.Hash]; !exists {
-				b.requestedBlocks[iv.Hash] = struct{}{}
-				b.limitMap(b.requestedBlocks, maxRequestedBlocks)
-				imsg.peer.requestedBlocks[iv.Hash] = struct{}{}
+				b.requestBlock(imsg.peer, &iv.Hash, nil)
 				gdmsg.AddInvVect(iv)
 				numRequested++
 			}
@@ -672,6 +1067,56 @@ func (b *blockManager) handleInvMsg(imsg *invMsg) {
 	}
 }
 
+// handleHeadersMsg handles headers messages from all peers.  Headers are only
+// used to track the best block known of the peer, which is the final header of
+// the message.
+func (b *blockManager) handleHeadersMsg(hmsg *headersMsg) {
+	headers := hmsg.headers.Headers
+	if len(headers) == 0 || b.chainSplit == nil {
+		return
+	}
+	header := headers[len(headers)-1]
+	hash := header.BlockHash()
+	b.chainSplit.UpdatePeerTip(hmsg.peer, &hash, header.Height)
+}
+
+// checkChainSplit compares the best blocks of the peers against the best chain
+// as of the passed time and returns a summary of the tips the peers are on.  A
+// chain split which is detected is delivered to the webhooks.
+func (b *blockManager) checkChainSplit(now time.Time) *btcjson.GetChainSplitInfoResult {
+	if b.chainSplit == nil {
+		return nil
+	}
+	info, warn := b.chainSplit.Check(now, b.current())
+	if warn {
+		if n := b.server.webhookNotifier; n != nil {
+			n.NotifyChainSplit(info)
+		}
+	}
+	return info
+}
+
+// checkAdminThreads compares the tips of the admin threads of the best chain
+// against the admin transactions pending in the mempool and returns the state
+// of the threads.  The threads which are detected to be stuck are delivered to
+// the webhooks.
+func (b *blockManager) checkAdminThreads() (*btcjson.GetThreadInfoResult, error) {
+	if b.threadWatch == nil {
+		return nil, fmt.Errorf("admin threads are not watched")
+	}
+	pending := pendingAdminTxs(b.server.txMemPool.TxDescs())
+	result, stuck, err := b.threadWatch.Check(pending)
+	if err != nil {
+		return nil, err
+	}
+	if n := b.server.webhookNotifier; n != nil {
+		for _, thread := range stuck {
+			n.NotifyThreadStuck(thread, result.Hash, result.Height)
+		}
+	}
+	return result, nil
+}
+
 // limitMap is a helper function for maps that require a maximum limit by
 // evicting a random transaction if adding a new value would cause it to
 // overflow the maximum allowed.
@@ -690,6 +1135,193 @@ func (b *blockManager) limitMap(m map[chainhash.Hash]struct{}, limit int) {
 	}
 }
 
+// requestBlock records the passed request for the block with the passed hash
+// as in flight from the passed peer with a new deadline.  A new request is
+// created when the passed request is nil.  The caller is responsible for
+// sending the getdata message for the block to the peer.
+func (b *blockManager) requestBlock(sp *serverPeer, hash *chainhash.Hash, req *blockRequest) {
+	if req == nil {
+		// Evict a random request if adding a new one would cause the
+		// map to overflow the maximum allowed.  See limitMap.
+		if len(b.requestedBlocks)+1 > maxRequestedBlocks {
+			for evictHash := range b.requestedBlocks {
+				delete(b.requestedBlocks, evictHash)
+				break
+			}
+		}
+		req = &blockRequest{failed: make(map[*serverPeer]struct{})}
+	}
+	req.peer = sp
+	req.deadline = time.Now().Add(blockRequestTimeout)
+	b.requestedBlocks[*hash] = req
+	sp.requestedBlocks[*hash] = struct{}{}
+}
+
+// blockRequestCandidate returns the peer to retry the passed block request
+// with, or nil when every candidate already failed to deliver the block.
+//
+// The candidates are ordered by the number of consecutive block requests they
+// failed to deliver in time, and the least loaded of the first 2^attempts of
+// them which hasn't failed the request is chosen.  This keeps the first retries
+// with the most reliable peers while widening the set to spread the load across
+// more peers the more often the request fails.
+func (b *blockManager) blockRequestCandidate(peers *list.List, req *blockRequest) *serverPeer {
+	candidates := make([]*serverPeer, 0, peers.Len())
+	for e := peers.Front(); e != nil; e = e.Next() {
+		candidates = append(candidates, e.Value.(*serverPeer))
+	}
+	sort.Stable(blockTimeoutSorter(candidates))
+
+	width := len(candidates)
+	if req.attempts < 16 && 1<<uint(req.attempts) < width {
+		width = 1 << uint(req.attempts)
+	}
+	for {
+		var best *serverPeer
+		for _, sp := range candidates[:width] {
+			if _, failed := req.failed[sp]; failed {
+				continue
+			}
+			if best == nil || len(sp.requestedBlocks) <
+				len(best.requestedBlocks) {
+
+				best = sp
+			}
+		}
+		if best != nil || width == len(candidates) {
+			return best
+		}
+
+		// Widen the set further when all of the peers in it have
+		// already failed the request.
+		width *= 2
+		if width > len(candidates) {
+			width = len(candidates)
+		}
+	}
+}
+
+// retryBlockRequest moves the passed request for the block with the passed
+// hash to a different candidate peer and adds the block to the getdata message
+// for the peer in the passed map.  When every candidate already failed to
+// deliver the block, the failures are forgotten so the candidates are tried
+// again, and the request is dropped when there are no candidates at all so the
+// block is requested again the next time it is announced.
+func (b *blockManager) retryBlockRequest(peers *list.List, hash *chainhash.Hash, req *blockRequest, getDataMsgs map[*serverPeer]*wire.MsgGetData) {
+	sp := b.blockRequestCandidate(peers, req)
+	if sp == nil && len(req.failed) > 0 {
+		req.failed = make(map[*serverPeer]struct{})
+		sp = b.blockRequestCandidate(peers, req)
+	}
+	if sp == nil {
+		bmgrLog.Debugf("No peers available to request block %v from",
+			hash)
+		delete(b.requestedBlocks, *hash)
+		return
+	}
+
+	b.requestBlock(sp, hash, req)
+	gdmsg, exists := getDataMsgs[sp]
+	if !exists {
+		gdmsg = wire.NewMsgGetData()
+		getDataMsgs[sp] = gdmsg
+	}
+	gdmsg.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, hash))
+}
+
+// handleBlockRejectMsg handles a peer rejecting a block.  When the block is in
+// flight from the peer, it is requested from another candidate peer right away
+// rather than waiting for the request to time out.  The request is dropped when
+// every candidate already failed to deliver the block, so the block is
+// requested again the next time it is announced.  It is invoked from the
+// blockHandler goroutine.
+func (b *blockManager) handleBlockRejectMsg(peers *list.List, bmsg *blockRejectMsg) {
+	hash := bmsg.hash
+	req, exists := b.requestedBlocks[hash]
+	if !exists || req.peer != bmsg.peer {
+		return
+	}
+
+	bmgrLog.Debugf("Request for block %v rejected by %s", &hash, bmsg.peer)
+	delete(bmsg.peer.requestedBlocks, hash)
+	req.failed[bmsg.peer] = struct{}{}
+	req.attempts++
+	sp := b.blockRequestCandidate(peers, req)
+	if sp == nil {
+		bmgrLog.Debugf("No peers left to request block %v from", &hash)
+		delete(b.requestedBlocks, hash)
+		return
+	}
+
+	b.requestBlock(sp, &hash, req)
+	gdmsg := wire.NewMsgGetData()
+	gdmsg.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &hash))
+	sp.QueueMessage(gdmsg, nil)
+}
+
+// sendGetDataMsgs sends the passed getdata messages to their peers.
+func sendGetDataMsgs(getDataMsgs map[*serverPeer]*wire.MsgGetData) {
+	for sp, gdmsg := range getDataMsgs {
+		sp.QueueMessage(gdmsg, nil)
+	}
+}
+
+// handleStalledRequests requests the blocks whose requests passed their
+// deadline as of the passed time from other candidate peers.  Peers which
+// repeatedly fail to deliver requested blocks in time are penalized.  It is
+// invoked from the blockHandler goroutine.
+func (b *blockManager) handleStalledRequests(peers *list.List, now time.Time) {
+	getDataMsgs := make(map[*serverPeer]*wire.MsgGetData)
+	penalized := make(map[*serverPeer]struct{})
+	for hash, req := range b.requestedBlocks {
+		if now.Before(req.deadline) {
+			continue
+		}
+
+		// Keep the block in the set of blocks requested from the peer
+		// so a late copy of it isn't treated as unrequested.
+		sp := req.peer
+		req.failed[sp] = struct{}{}
+		req.attempts++
+		sp.blockTimeouts++
+		bmgrLog.Debugf("Request for block %v from %s timed out "+
+			"(attempt %d)", hash, sp, req.attempts)
+
+		if _, ok := penalized[sp]; !ok && sp.blockTimeouts >= maxBlockTimeouts {
+			penalized[sp] = struct{}{}
+			sp.addBanScore(0, blockTimeoutBanScore, "block request "+
+				"timeouts")
+		}
+
+		hash := hash
+		b.retryBlockRequest(peers, &hash, req, getDataMsgs)
+	}
+	sendGetDataMsgs(getDataMsgs)
+}
+
+// blockTimeoutSorter implements sort.Interface to allow a slice of peers to be
+// sorted by the number of consecutive block requests they failed to deliver in
+// time.
+type blockTimeoutSorter []*serverPeer
+
+// Len returns the number of peers in the slice.  It is part of the
+// sort.Interface implementation.
+func (s blockTimeoutSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the peers at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s blockTimeoutSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the peer with index i should sort before the peer with
+// index j.  It is part of the sort.Interface implementation.
+func (s blockTimeoutSorter) Less(i, j int) bool {
+	return s[i].blockTimeouts < s[j].blockTimeouts
+}
+
 // blockHandler is the main handler for the block manager.  It must be run
 // as a goroutine.  It processes block and inv messages in a separate goroutine
 // from the peer handlers so the block (MsgBlock) messages are handled by a
@@ -698,6 +1330,12 @@ func (b *blockManager) limitMap(m map[chainhash.Hash]struct{}, limit int) {
 // the fetching should proceed.
 func (b *blockManager) blockHandler() {
 	candidatePeers := list.New()
+	stallTicker := time.NewTicker(blockRequestCheckInterval)
+	defer stallTicker.Stop()
+	errorStatsTicker := time.NewTicker(errorStatsFlushInterval)
+	defer errorStatsTicker.Stop()
+	chainSplitTicker := time.NewTicker(chainSplitCheckInterval)
+	defer chainSplitTicker.Stop()
 out:
 	for {
 		select {
@@ -712,25 +1350,53 @@ out:
 
 			case *blockMsg:
 				b.handleBlockMsg(msg)
-				msg.peer.blockProcessed <- struct{}{}
+				b.flushJournal()
+				if !msg.pipelined {
+					msg.peer.blockProcessed <- struct{}{}
+				}
 
 			case *invMsg:
 				b.handleInvMsg(msg)
 
+			case *headersMsg:
+				b.handleHeadersMsg(msg)
+
 			case *donePeerMsg:
 				b.handleDonePeerMsg(candidatePeers, msg.peer)
 
+			case *blockRejectMsg:
+				b.handleBlockRejectMsg(candidatePeers, msg)
+
 			case getSyncPeerMsg:
 				msg.reply <- b.syncPeer
 
+			case getChainSplitInfoMsg:
+				msg.reply <- b.checkChainSplit(time.Now())
+
+			case getThreadInfoMsg:
+				result, err := b.checkAdminThreads()
+				msg.reply <- threadInfoResponse{result: result, err: err}
+
 			case processBlockMsg:
-				_, isOrphan, err := b.chain.ProcessBlock(
+				ownBlock := !msg.replicated &&
+					msg.flags&blockchain.BFDryRun != blockchain.BFDryRun
+				if ownBlock {
+					b.ownBlock = msg.block.Hash()
+				}
+				status, _, isOrphan, err := b.chain.ProcessBlockStatus(
 					msg.block, msg.flags)
-				if err != nil {
+				b.ownBlock = nil
+				if err != nil && b.journal != nil {
+					b.journal.RecordRejected(msg.block, err)
+				}
+				b.flushJournal()
+				if err != nil || status.IsDuplicate() {
 					msg.reply <- processBlockResponse{
+						status:   status,
 						isOrphan: false,
 						err:      err,
 					}
+					continue
 				}
 
 				// Allow any clients performing long polling via the
@@ -741,23 +1407,52 @@ out:
 					rpcServer.gbtWorkState.NotifyBlockConnected(msg.block.Hash())
 				}
 
+				// Track the peers rejecting the blocks produced by
+				// this node, which are the blocks processed through
+				// here other than block proposals and replicated
+				// blocks.
+				if ownBlock {
+					b.server.rejectStats.AddOwnBlock(msg.block.Hash())
+				}
+
 				msg.reply <- processBlockResponse{
+					status:   status,
 					isOrphan: isOrphan,
 					err:      nil,
 				}
 
+			case repairBlockMsg:
+				b.repairBlocks[*msg.hash] = struct{}{}
+				b.requestRepairBlocks(candidatePeers)
+
 			case isCurrentMsg:
 				msg.reply <- b.current()
 
+			case fallBackToSyncMsg:
+				b.replicating = false
+				b.startSync(candidatePeers)
+
 			case pauseMsg:
 				// Wait until the sender unpauses the manager.
 				<-msg.unpause
 
+			case beginBackupMsg:
+				msg.reply <- b.beginBackup()
+
 			default:
 				bmgrLog.Warnf("Invalid message type in block "+
 					"handler: %T", msg)
 			}
 
+		case <-stallTicker.C:
+			b.handleStalledRequests(candidatePeers, time.Now())
+
+		case <-errorStatsTicker.C:
+			b.flushErrorStats()
+
+		case <-chainSplitTicker.C:
+			b.checkChainSplit(time.Now())
+
 		case <-b.quit:
 			break out
 		}
@@ -767,16 +1462,46 @@ out:
 	bmgrLog.Trace("Block handler done")
 }
 
+// flushJournal writes the buffered entries of the block processing journal to
+// disk.  It is called at safe points between processing blocks.
+func (b *blockManager) flushJournal() {
+	if b.journal == nil {
+		return
+	}
+	if err := b.journal.Flush(); err != nil {
+		bmgrLog.Errorf("Unable to write block processing journal: %v",
+			err)
+	}
+}
+
+// flushErrorStats writes the counts of the rejected blocks and transactions to
+// the database.
+func (b *blockManager) flushErrorStats() {
+	if b.errorStats == nil {
+		return
+	}
+	if err := b.errorStats.Flush(); err != nil {
+		bmgrLog.Errorf("Unable to write error stats: %v", err)
+	}
+}
+
 // handleNotifyMsg handles notifications from blockchain.  It does things such
 // as request orphan block parents and relay accepted blocks to connected peers.
 func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
+	// Record changes of the main chain in the block processing journal.
+	if b.journal != nil {
+		b.journal.RecordNotification(notification)
+	}
+
 	switch notification.Type {
 	// A block has been accepted into the block chain.  Relay it to other
 	// peers.
 	case blockchain.NTBlockAccepted:
 		// Don't relay if we are not current. Other peers that are
-		// current should already know about it.
-		if !b.current() {
+		// current should already know about it.  The connect peers
+		// are the only route to the network in outbound-only mode, so
+		// blocks are always relayed to them.
+		if !b.current() && !cfg.OutboundOnly {
 			return
 		}
 
@@ -798,6 +1523,28 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			break
 		}
 
+		// Submit the blocks produced by this node to the broadcast
+		// endpoints alongside relaying them to peers.
+		bb := b.server.blockBroadcaster
+		if bb != nil && b.ownBlock != nil && block.Hash().IsEqual(b.ownBlock) {
+			bb.NotifyBlockConnected(block)
+		}
+
+		if r := b.server.rpcServer; r != nil {
+			// Now that this block is in the blockchain we can mark
+			// all the transactions (except the coinbase) as no
+			// longer needing rebroadcasting.
+			for _, tx := range block.Transactions()[1:] {
+				iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
+				b.server.RemoveRebroadcastInventory(iv)
+			}
+
+			// Notify registered websocket clients of incoming block
+			// before the notifications caused by updating the
+			// transaction pool below.
+			r.ntfnMgr.NotifyBlockConnected(block)
+		}
+
 		// Remove all of the transactions (except the coinbase) in the
 		// connected block from the transaction pool.  Secondly, remove any
 		// transactions which are now double spends as a result of these
@@ -806,6 +1553,9 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 		// transaction are NOT removed recursively because they are still
 		// valid.
 		for _, tx := range block.Transactions()[1:] {
+			if b.reorging {
+				b.reorgMinedTx[*tx.Hash()] = struct{}{}
+			}
 			b.server.txMemPool.RemoveTransaction(tx, false)
 			b.server.txMemPool.RemoveDoubleSpends(tx)
 			b.server.txMemPool.RemoveOrphan(tx)
@@ -813,17 +1563,35 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			b.server.AnnounceNewTransactions(acceptedTxs)
 		}
 
-		if r := b.server.rpcServer; r != nil {
-			// Now that this block is in the blockchain we can mark
-			// all the transactions (except the coinbase) as no
-			// longer needing rebroadcasting.
-			for _, tx := range block.Transactions()[1:] {
-				iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
-				b.server.RemoveRebroadcastInventory(iv)
-			}
+		// Remove the transactions which are no longer valid because
+		// they depend on keys revoked by the block.  They would never
+		// be mined, yet would still be selected for block templates.
+		removedTxs := b.server.txMemPool.RemoveRevokedKeyDependents(block)
+		b.server.notifyRemovedTxns(removedTxs, mempool.RemovalKeyRevoked)
+
+		// Remove the transactions which expire too soon after the block
+		// to be mined.
+		removedTxs = b.server.txMemPool.RemoveExpiringTransactions(
+			block.Height())
+		b.server.notifyRemovedTxns(removedTxs,
+			mempool.RemovalExpiryHeight)
+
+		// Notify webhook endpoints now that the block is committed.
+		if n := b.server.webhookNotifier; n != nil {
+			n.NotifyBlockConnected(block, b.chain)
+		}
 
-			// Notify registered websocket clients of incoming block.
-			r.ntfnMgr.NotifyBlockConnected(block)
+		// Flag spends of outputs on the watchlist.
+		b.server.checkWatchedBlock(block, b.chain, true)
+
+		// Check whether the admin threads advance now that the
+		// mempool is updated.  This is done once the reorganization
+		// finished when the block is connected by one.
+		if !b.reorging && b.threadWatch != nil {
+			if _, err := b.checkAdminThreads(); err != nil {
+				bmgrLog.Errorf("Unable to check the admin "+
+					"threads: %v", err)
+			}
 		}
 
 	// A block has been disconnected from the main block chain.
@@ -834,24 +1602,122 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			break
 		}
 
-		// Reinsert all of the transactions (except the coinbase) into
-		// the transaction pool.
-		for _, tx := range block.Transactions()[1:] {
-			_, _, err := b.server.txMemPool.MaybeAcceptTransaction(tx,
-				false, false)
-			if err != nil {
-				// Remove the transaction and all transactions
-				// that depend on it if it wasn't accepted into
-				// the transaction pool.
-				b.server.txMemPool.RemoveTransaction(tx, true)
-			}
+		// Keep the transactions (except the coinbase) so they are
+		// returned to the transaction pool once the reorganization
+		// finished.  They are validated against the new main chain
+		// rather than the intermediate chain, which lacks the admin
+		// state of the blocks which are about to be connected.  The
+		// blocks are disconnected starting with the tip, so the
+		// transactions of each block go before the ones kept so far.
+		if b.reorging {
+			txns := block.Transactions()[1:]
+			b.reorgTxns = append(txns[:len(txns):len(txns)],
+				b.reorgTxns...)
+		} else {
+			b.resurrectTxns(block.Transactions()[1:])
 		}
 
 		// Notify registered websocket clients.
 		if r := b.server.rpcServer; r != nil {
 			r.ntfnMgr.NotifyBlockDisconnected(block)
 		}
+
+		// Notify webhook endpoints.
+		if n := b.server.webhookNotifier; n != nil {
+			n.NotifyBlockDisconnected(block, b.chain)
+		}
+
+		// Flag the spends of outputs on the watchlist which were
+		// reversed by disconnecting the block.
+		b.server.checkWatchedBlock(block, b.chain, false)
+
+	// A validate key signed two different blocks at the same height.
+	// Report it loudly and deliver the evidence to the webhooks.
+	case blockchain.NTDoubleSign:
+		ds, ok := notification.Data.(*blockchain.DoubleSign)
+		if !ok {
+			bmgrLog.Warnf("Chain double sign notification is not a " +
+				"double sign.")
+			break
+		}
+		bmgrLog.Criticalf("Validate key %v signed two different blocks "+
+			"%v and %v at height %d", ds.ValidatingPubKey,
+			ds.First.BlockHash(), ds.Second.BlockHash(), ds.Height)
+		if b.server.webhookNotifier == nil {
+			break
+		}
+		result, err := newDoubleSignResult(ds,
+			b.server.chainParams.RejectDoubleSigners)
+		if err != nil {
+			bmgrLog.Errorf("Unable to encode double sign: %v", err)
+			break
+		}
+		b.server.webhookNotifier.NotifyDoubleSign(result)
+
+	// A key was added to or removed from an admin key set.
+	case blockchain.NTAdminKeyChanged:
+		change, ok := notification.Data.(*blockchain.AdminKeyChange)
+		if !ok {
+			bmgrLog.Warnf("Chain admin key changed notification is " +
+				"not an admin key change.")
+			break
+		}
+		action := "Removed"
+		if change.Added {
+			action = "Added"
+		}
+		bmgrLog.Infof("%s %v key %x (keyID %d) by admin transaction %v "+
+			"at height %d", action, change.KeySet,
+			change.PubKey.SerializeCompressed(), change.KeyID,
+			change.TxHash, change.Height)
+
+	// The main chain is about to be reorganized.  Start keeping the
+	// transactions of the blocks which are disconnected.
+	case blockchain.NTReorganizationStarted:
+		b.reorging = true
+		b.reorgTxns = nil
+		b.reorgMinedTx = make(map[chainhash.Hash]struct{})
+
+	// The reorganization of the main chain finished.  Return the
+	// transactions of the disconnected blocks which were not mined again
+	// to the transaction pool.
+	case blockchain.NTReorganizationFinished:
+		if !b.reorging {
+			break
+		}
+		txns := make([]*provautil.Tx, 0, len(b.reorgTxns))
+		for _, tx := range b.reorgTxns {
+			if _, ok := b.reorgMinedTx[*tx.Hash()]; !ok {
+				txns = append(txns, tx)
+			}
+		}
+		b.reorging = false
+		b.reorgTxns = nil
+		b.reorgMinedTx = nil
+		b.resurrectTxns(txns)
+		if b.threadWatch != nil {
+			if _, err := b.checkAdminThreads(); err != nil {
+				bmgrLog.Errorf("Unable to check the admin "+
+					"threads: %v", err)
+			}
+		}
+	}
+}
+
+// resurrectTxns returns the passed transactions of disconnected blocks to the
+// transaction pool, relays and notifies the ones which are accepted, and
+// notifies the ones which are no longer valid on the main chain along with the
+// transactions in the pool which depend on them.
+func (b *blockManager) resurrectTxns(txns []*provautil.Tx) {
+	if len(txns) == 0 {
+		return
 	}
+	accepted, removed := b.server.txMemPool.ResurrectTransactions(txns)
+	bmgrLog.Debugf("Accepted %d transactions into the mempool and "+
+		"removed %d after returning %d transactions of disconnected "+
+		"blocks", len(accepted), len(removed), len(txns))
+	b.server.AnnounceNewTransactions(accepted)
+	b.server.notifyRemovedTxns(removed, mempool.RemovalReorg)
 }
 
 // NewPeer informs the block manager of a newly active peer.
@@ -876,6 +1742,10 @@ func (b *blockManager) QueueTx(tx *provautil.Tx, sp *serverPeer) {
 }
 
 // QueueBlock adds the passed block message and peer to the block handling queue.
+// Outside of regression test mode, the block first passes through the
+// validation pipeline, which performs its context free checks while the blocks
+// queued before it are processed, and the peer is signalled as soon as the block
+// is queued in the pipeline rather than once it has been processed.
 func (b *blockManager) QueueBlock(block *provautil.Block, sp *serverPeer) {
 	// Don't accept more blocks if we're shutting down.
 	if atomic.LoadInt32(&b.shutdown) != 0 {
@@ -883,7 +1753,49 @@ func (b *blockManager) QueueBlock(block *provautil.Block, sp *serverPeer) {
 		return
 	}
 
-	b.msgChan <- &blockMsg{block: block, peer: sp}
+	// The block acceptance test tool relies on blocks being fully
+	// processed before the peer is signalled.
+	if cfg.RegressionTest {
+		b.msgChan <- &blockMsg{block: block, peer: sp}
+		return
+	}
+
+	b.pipeline.Submit(block, sp)
+	sp.blockProcessed <- struct{}{}
+}
+
+// pipelineHandler passes the blocks leaving the validation pipeline on to the
+// block handler in the order they were queued.  It must be run as a goroutine.
+func (b *blockManager) pipelineHandler() {
+out:
+	for {
+		select {
+		case pb := <-b.pipeline.Blocks():
+			msg := &blockMsg{
+				block:     pb.Block,
+				peer:      pb.Data.(*serverPeer),
+				pipelined: true,
+			}
+			select {
+			case b.msgChan <- msg:
+			case <-b.quit:
+				break out
+			}
+
+			// The blocks queued before this one may be interrupted
+			// in favor of it when it makes a better tip.  It is
+			// queued first, so they are queued again after it.
+			if pb.Block.ContextFreeChecked() {
+				b.chain.Preempt(&pb.Block.MsgBlock().Header)
+			}
+
+		case <-b.quit:
+			break out
+		}
+	}
+
+	b.wg.Done()
+	bmgrLog.Trace("Block pipeline handler done")
 }
 
 // QueueInv adds the passed inv message and peer to the block handling queue.
@@ -897,6 +1809,30 @@ func (b *blockManager) QueueInv(inv *wire.MsgInv, sp *serverPeer) {
 	b.msgChan <- &invMsg{inv: inv, peer: sp}
 }
 
+// QueueHeaders adds the passed headers message and peer to the block handling
+// queue.
+func (b *blockManager) QueueHeaders(headers *wire.MsgHeaders, sp *serverPeer) {
+	// No channel handling here because peers do not need to block on
+	// headers messages.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		return
+	}
+
+	b.msgChan <- &headersMsg{headers: headers, peer: sp}
+}
+
+// QueueBlockReject adds the passed rejection of the block with the passed hash
+// by the passed peer to the block handling queue.
+func (b *blockManager) QueueBlockReject(hash *chainhash.Hash, sp *serverPeer) {
+	// No channel handling here because peers do not need to block on
+	// reject messages.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		return
+	}
+
+	b.msgChan <- &blockRejectMsg{hash: *hash, peer: sp}
+}
+
 // DonePeer informs the blockmanager that a peer has disconnected.
 func (b *blockManager) DonePeer(sp *serverPeer) {
 	// Ignore if we are shutting down.
@@ -915,8 +1851,10 @@ func (b *blockManager) Start() {
 	}
 
 	bmgrLog.Trace("Starting block manager")
-	b.wg.Add(1)
+	b.pipeline.Start()
+	b.wg.Add(2)
 	go b.blockHandler()
+	go b.pipelineHandler()
 }
 
 // Stop gracefully shuts down the block manager by stopping all asynchronous
@@ -930,7 +1868,18 @@ func (b *blockManager) Stop() error {
 
 	bmgrLog.Infof("Block manager shutting down")
 	close(b.quit)
+	b.pipeline.Stop()
 	b.wg.Wait()
+
+	// Mark the block processing journal as closed cleanly now that no more
+	// blocks are processed.
+	if b.journal != nil {
+		if err := b.journal.Close(); err != nil {
+			bmgrLog.Errorf("Unable to close block processing "+
+				"journal: %v", err)
+		}
+	}
+	b.flushErrorStats()
 	return nil
 }
 
@@ -941,14 +1890,72 @@ func (b *blockManager) SyncPeer() *serverPeer {
 	return <-reply
 }
 
-// ProcessBlock makes use of ProcessBlock on an internal instance of a block
-// chain.  It is funneled through the block manager since btcchain is not safe
-// for concurrent access.
-func (b *blockManager) ProcessBlock(block *provautil.Block, flags blockchain.BehaviorFlags) (bool, error) {
+// ChainSplitInfo compares the best blocks of the peers against the best chain
+// and returns a summary of the tips the peers are on.
+func (b *blockManager) ChainSplitInfo() *btcjson.GetChainSplitInfoResult {
+	reply := make(chan *btcjson.GetChainSplitInfoResult)
+	b.msgChan <- getChainSplitInfoMsg{reply: reply}
+	return <-reply
+}
+
+// ThreadInfo compares the tips of the admin threads of the best chain against
+// the admin transactions pending in the mempool and returns the state of the
+// threads.
+func (b *blockManager) ThreadInfo() (*btcjson.GetThreadInfoResult, error) {
+	reply := make(chan threadInfoResponse)
+	b.msgChan <- getThreadInfoMsg{reply: reply}
+	response := <-reply
+	return response.result, response.err
+}
+
+// ProcessBlock makes use of ProcessBlockStatus on an internal instance of a
+// block chain.  It is funneled through the block manager since btcchain is not
+// safe for concurrent access.  The status reports whether the block was
+// already known, in which case it was not processed again and the returned
+// error is nil.
+func (b *blockManager) ProcessBlock(block *provautil.Block, flags blockchain.BehaviorFlags) (blockchain.BlockStatus, bool, error) {
 	reply := make(chan processBlockResponse, 1)
 	b.msgChan <- processBlockMsg{block: block, flags: flags, reply: reply}
 	response := <-reply
-	return response.isOrphan, response.err
+	return response.status, response.isOrphan, response.err
+}
+
+// ProcessReplicatedBlock processes a block received through the replication
+// stream of a primary node like ProcessBlock, except that the block is not
+// treated as a block produced by this node.
+func (b *blockManager) ProcessReplicatedBlock(block *provautil.Block, flags blockchain.BehaviorFlags) (blockchain.BlockStatus, error) {
+	reply := make(chan processBlockResponse, 1)
+	b.msgChan <- processBlockMsg{
+		block:      block,
+		flags:      flags,
+		reply:      reply,
+		replicated: true,
+	}
+	response := <-reply
+	return response.status, response.err
+}
+
+// FallBackToSync starts syncing the chain from peers once following a primary
+// node through its replication stream stopped.
+func (b *blockManager) FallBackToSync() {
+	// Ignore if we are shutting down.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		return
+	}
+
+	b.msgChan <- fallBackToSyncMsg{}
+}
+
+// RequestBlockRepair requests a good copy of the block with the passed hash,
+// whose stored data is corrupt, from the connected peers.  The request is
+// retried as peers become available until the block has been repaired.
+func (b *blockManager) RequestBlockRepair(hash *chainhash.Hash) {
+	// Ignore if we are shutting down.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		return
+	}
+
+	b.msgChan <- repairBlockMsg{hash: hash}
 }
 
 // IsCurrent returns whether or not the block manager believes it is synced with
@@ -969,6 +1976,40 @@ func (b *blockManager) Pause() chan<- struct{} {
 	return c
 }
 
+// beginBackup begins a backup of the block database and returns it along with
+// the best chain state it contains and how long beginning it took.  It MUST be
+// called from the block handler so the best chain state can't change while the
+// backup is begun.
+func (b *blockManager) beginBackup() beginBackupResponse {
+	backuper, ok := b.server.db.(database.Backuper)
+	if !ok {
+		err := fmt.Errorf("the %s block database does not support "+
+			"online backups", b.server.db.Type())
+		return beginBackupResponse{err: err}
+	}
+
+	start := time.Now()
+	best := b.chain.BestSnapshot()
+	backup, err := backuper.BeginBackup()
+	return beginBackupResponse{
+		backup: backup,
+		best:   best,
+		pause:  time.Since(start),
+		err:    err,
+	}
+}
+
+// BeginBackup begins a backup of the block database which matches the returned
+// best chain state.  Block processing is paused while the state of the
+// database is captured, and the duration of the pause is returned.  The backup
+// must be released once it has been written.
+func (b *blockManager) BeginBackup() (database.Backup, *blockchain.BestState, time.Duration, error) {
+	reply := make(chan beginBackupResponse, 1)
+	b.msgChan <- beginBackupMsg{reply: reply}
+	response := <-reply
+	return response.backup, response.best, response.pause, response.err
+}
+
 // checkpointSorter implements sort.Interface to allow a slice of checkpoints to
 // be sorted.
 type checkpointSorter []chaincfg.Checkpoint
@@ -1029,10 +2070,36 @@ func newBlockManager(s *server, indexManager blockchain.IndexManager) (*blockMan
 		server:          s,
 		rejectedTxns:    make(map[chainhash.Hash]struct{}),
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
-		requestedBlocks: make(map[chainhash.Hash]struct{}),
+		requestedBlocks: make(map[chainhash.Hash]*blockRequest),
+		repairBlocks:    make(map[chainhash.Hash]struct{}),
 		progressLogger:  newBlockProgressLogger("Processed", bmgrLog),
 		msgChan:         make(chan interface{}, cfg.MaxPeers*3),
 		quit:            make(chan struct{}),
+		replicating:     cfg.ReplicateFrom != "",
+	}
+
+	// Open the block processing journal and load the error stats unless
+	// running in read-only mode, where no blocks are processed, and log
+	// the most recent journal entries when the previous shutdown was
+	// unclean.
+	if !cfg.ReadOnly {
+		journalPath := filepath.Join(cfg.DataDir, processingJournalFilename)
+		journal, err := openProcessingJournal(journalPath,
+			defaultProcessingJournalEntries)
+		if err != nil {
+			return nil, err
+		}
+		if journal.Unclean() {
+			logUncleanShutdown(journal)
+		}
+		bm.journal = journal
+
+		errorStats, err := blockchain.NewErrorStats(s.db)
+		if err != nil {
+			journal.Close()
+			return nil, err
+		}
+		bm.errorStats = errorStats
 	}
 
 	// Merge given checkpoints with the default ones unless they are disabled.
@@ -1042,21 +2109,50 @@ func newBlockManager(s *server, indexManager blockchain.IndexManager) (*blockMan
 	// Create a new block chain instance with the appropriate configuration.
 	var err error
 	bm.chain, err = blockchain.New(&blockchain.Config{
-		DB:            s.db,
-		ChainParams:   s.chainParams,
-		Checkpoints:   checkpoints,
-		TimeSource:    s.timeSource,
-		Notifications: bm.handleNotifyMsg,
-		SigCache:      s.sigCache,
-		IndexManager:  indexManager,
+		DB:               s.db,
+		ChainParams:      s.chainParams,
+		Checkpoints:      checkpoints,
+		TimeSource:       s.timeSource,
+		Notifications:    bm.handleNotifyMsg,
+		SigCache:         s.sigCache,
+		IndexManager:     indexManager,
+		ReadOnly:         cfg.ReadOnly,
+		ErrorStats:       bm.errorStats,
+		SigVerifyWorkers: cfg.SigVerifyWorkers,
 	})
 	if err != nil {
+		if bm.journal != nil {
+			bm.journal.Close()
+		}
 		return nil, err
 	}
+	bm.pipeline = blockchain.NewBlockPipeline(bm.chain, runtime.NumCPU(),
+		blockPipelineDepth)
+	bm.chainSplit = newChainSplitMonitor(bm.chain, cfg.ChainSplitFraction,
+		cfg.ChainSplitDepth, cfg.ChainSplitDuration)
+	bm.threadWatch = newThreadWatchdog(bm.chain, cfg.ThreadStuckBlocks)
 
 	return &bm, nil
 }
 
+// logUncleanShutdown logs the most recent entries of the passed block
+// processing journal after an unclean shutdown of the node.
+func logUncleanShutdown(journal *processingJournal) {
+	entries, err := journal.Entries(processingJournalLogEntries)
+	if err != nil {
+		bmgrLog.Errorf("Unable to read block processing journal: %v", err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+	bmgrLog.Warnf("The previous shutdown was unclean -- the last %d block "+
+		"processing journal entries follow", len(entries))
+	for i := range entries {
+		bmgrLog.Warnf("  %v", &entries[i])
+	}
+}
+
 // removeRegressionDB removes the existing regression test database if running
 // in regression test mode and it already exists.
 func removeRegressionDB(dbPath string) error {
@@ -1133,7 +2229,8 @@ func warnMultipleDBs() {
 // account the selected database backend and returns a handle to it.  It also
 // contains additional logic such warning the user if there are multiple
 // databases which consume space on the file system and ensuring the regression
-// test database is clean when in regression test mode.
+// test database is clean when in regression test mode.  In read-only mode, the
+// existing database is opened without the ability to modify it.
 func loadBlockDB() (database.DB, error) {
 	// The memdb backend does not have a file path associated with it, so
 	// handle it uniquely.  We also don't want to worry about the multiple
@@ -1152,6 +2249,22 @@ func loadBlockDB() (database.DB, error) {
 	// The database name is based on the database type.
 	dbPath := blockDbPath(cfg.DbType)
 
+	// Open the existing database without modifying it in read-only mode.
+	// This means the regression test database is not removed and a missing
+	// database is not created.
+	if cfg.ReadOnly {
+		btcdLog.Infof("Loading block database from '%s' in read-only "+
+			"mode", dbPath)
+		db, err := database.OpenReadOnly(cfg.DbType, dbPath,
+			activeNetParams.Net)
+		if err != nil {
+			return nil, err
+		}
+
+		btcdLog.Info("Block database loaded")
+		return db, nil
+	}
+
 	// The regression test is special in that it needs a clean database for
 	// each run, so remove it now if it already exists.
 	removeRegressionDB(dbPath)
@@ -0,0 +1,616 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"container/list"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/peer"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// blockDelivery is a block a mock peer agreed to deliver in response to a
+// getdata request.
+type blockDelivery struct {
+	peer *serverPeer
+	hash chainhash.Hash
+}
+
+// mockBlockPeer is a remote peer connected to a server peer which records the
+// blocks requested from it and delivers all of them except the ones it is
+// configured to drop.  The remote end speaks the wire protocol directly since
+// two peers in the same process would detect a self connection.
+type mockBlockPeer struct {
+	sp   *serverPeer
+	conn net.Conn
+	done chan struct{}
+
+	mtx       sync.Mutex
+	requested map[chainhash.Hash]int
+}
+
+// newMockBlockPeer connects a new server peer for the passed server to a remote
+// peer which sends the blocks requested from it that are not in the passed set
+// of blocks to drop to the passed channel.
+func newMockBlockPeer(t *testing.T, s *server, drop map[chainhash.Hash]struct{}, deliveries chan<- blockDelivery) *mockBlockPeer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+	remoteConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	localConn, ok := <-accepted
+	if !ok {
+		t.Fatalf("unable to accept connection")
+	}
+
+	mp := &mockBlockPeer{
+		sp:        newServerPeer(s, false),
+		conn:      remoteConn,
+		done:      make(chan struct{}),
+		requested: make(map[chainhash.Hash]int),
+	}
+	mp.sp.Peer = peer.NewInboundPeer(&peer.Config{ChainParams: s.chainParams})
+	mp.sp.AssociateConnection(localConn)
+
+	// Negotiate the protocol by sending a version message, followed by a
+	// verack once the version message of the server peer has been read.
+	pver := peer.MaxProtocolVersion
+	btcnet := s.chainParams.Net
+	addr := wire.NewNetAddressIPPort(net.ParseIP("127.0.0.1"), 0, 0)
+	version := wire.NewMsgVersion(addr, addr, 1, 0)
+	if err := wire.WriteMessage(remoteConn, version, pver, btcnet); err != nil {
+		t.Fatalf("unable to send version: %v", err)
+	}
+	go func() {
+		defer close(mp.done)
+		for {
+			msg, _, err := wire.ReadMessage(remoteConn, pver, btcnet)
+			if err != nil {
+				return
+			}
+			switch msg := msg.(type) {
+			case *wire.MsgVersion:
+				wire.WriteMessage(remoteConn, wire.NewMsgVerAck(),
+					pver, btcnet)
+
+			case *wire.MsgGetData:
+				mp.mtx.Lock()
+				for _, iv := range msg.InvList {
+					mp.requested[iv.Hash]++
+					if _, ok := drop[iv.Hash]; ok {
+						continue
+					}
+					deliveries <- blockDelivery{mp.sp, iv.Hash}
+				}
+				mp.mtx.Unlock()
+			}
+		}
+	}()
+
+	deadline := time.Now().Add(time.Second * 10)
+	for !mp.sp.VerAckReceived() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for peer negotiation")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	return mp
+}
+
+// timesRequested returns the number of times the block with the passed hash was
+// requested from the peer.
+func (mp *mockBlockPeer) timesRequested(hash *chainhash.Hash) int {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+	return mp.requested[*hash]
+}
+
+// disconnect disconnects both ends of the connection.
+func (mp *mockBlockPeer) disconnect() {
+	mp.sp.Disconnect()
+	mp.conn.Close()
+	mp.sp.WaitForDisconnect()
+	<-mp.done
+}
+
+// TestBlockRequestTimeout ensures block requests which peers never respond to
+// are retried from other peers once they time out, that a block is never in
+// flight from more than one peer unless the earlier requests for it timed out,
+// that peers which repeatedly time out are penalized, and that the chain is
+// eventually downloaded completely.
+func TestBlockRequestTimeout(t *testing.T) {
+	defer func(c *config) {
+		cfg = c
+	}(cfg)
+	cfg = &config{BanThreshold: defaultBanThreshold}
+
+	// Mine the chain to download with one harness and download it into the
+	// chain of another one.
+	const numBlocks = 6
+	source := newTestRPCHarness(t, nil)
+	defer source.teardown()
+	hashes := make([]*chainhash.Hash, 0, numBlocks)
+	for i := 0; i < numBlocks; i++ {
+		hashes = append(hashes, source.mineBlock(t))
+	}
+	dest := newTestRPCHarness(t, nil)
+	defer dest.teardown()
+	s := dest.rpcServer.server
+	s.peerHeightsUpdate = make(chan updatePeerHeightsMsg, numBlocks*2)
+	bm := &blockManager{
+		server:          s,
+		chain:           dest.chain,
+		rejectedTxns:    make(map[chainhash.Hash]struct{}),
+		requestedTxns:   make(map[chainhash.Hash]struct{}),
+		requestedBlocks: make(map[chainhash.Hash]*blockRequest),
+		repairBlocks:    make(map[chainhash.Hash]struct{}),
+		progressLogger:  newBlockProgressLogger("Processed", bmgrLog),
+	}
+	s.blockManager = bm
+
+	// The first peer drops the requests for three of the blocks, the second
+	// one for one of those, and the third one delivers everything.
+	deliveries := make(chan blockDelivery, numBlocks*3)
+	drops := []map[chainhash.Hash]struct{}{
+		{*hashes[1]: {}, *hashes[2]: {}, *hashes[3]: {}},
+		{*hashes[3]: {}},
+		{},
+	}
+	peers := list.New()
+	mockPeers := make([]*mockBlockPeer, 0, len(drops))
+	for _, drop := range drops {
+		mp := newMockBlockPeer(t, s, drop, deliveries)
+		defer mp.disconnect()
+		mockPeers = append(mockPeers, mp)
+		peers.PushBack(mp.sp)
+	}
+
+	// checkInFlight ensures every block is only in flight from the peer its
+	// request is assigned to, or peers whose requests for it timed out.
+	checkInFlight := func() {
+		for _, mp := range mockPeers {
+			for hash := range mp.sp.requestedBlocks {
+				req, ok := bm.requestedBlocks[hash]
+				if !ok || req.peer == mp.sp {
+					continue
+				}
+				if _, failed := req.failed[mp.sp]; !failed {
+					t.Fatalf("block %v in flight from %s and %s",
+						hash, mp.sp, req.peer)
+				}
+			}
+		}
+	}
+
+	// Announce the blocks from the sync peer so they are requested from it,
+	// then deliver the blocks as the peers send them and expire the
+	// outstanding requests whenever the peers stop sending.
+	syncPeer := mockPeers[0].sp
+	bm.syncPeer = syncPeer
+	inv := wire.NewMsgInv()
+	for _, hash := range hashes {
+		inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, hash))
+	}
+	bm.handleInvMsg(&invMsg{inv: inv, peer: syncPeer})
+	checkInFlight()
+	deadline := time.Now().Add(time.Second * 30)
+	for dest.chain.BestSnapshot().Height != numBlocks {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out downloading the chain: height %d, "+
+				"want %d", dest.chain.BestSnapshot().Height,
+				numBlocks)
+		}
+
+		select {
+		case delivery := <-deliveries:
+			block, err := source.chain.BlockByHash(&delivery.hash)
+			if err != nil {
+				t.Fatalf("BlockByHash: unexpected error: %v", err)
+			}
+			bm.handleBlockMsg(&blockMsg{block: block,
+				peer: delivery.peer})
+
+		case <-time.After(time.Millisecond * 100):
+			bm.handleStalledRequests(peers,
+				time.Now().Add(blockRequestTimeout))
+		}
+		checkInFlight()
+	}
+
+	// The dropped blocks are requested once from each peer which dropped
+	// them before being delivered, and the delivered blocks are never
+	// requested again.
+	for i, hash := range hashes {
+		for j, mp := range mockPeers {
+			got := mp.timesRequested(hash)
+			switch {
+			case j == 0 && got != 1:
+				t.Errorf("block %d: requested %d times from the "+
+					"sync peer, want 1", i, got)
+			case got > 1:
+				t.Errorf("block %d: requested %d times from peer "+
+					"%d, want at most 1", i, got, j)
+			}
+		}
+	}
+	if got := mockPeers[1].timesRequested(hashes[3]) +
+		mockPeers[2].timesRequested(hashes[3]); got == 0 {
+		t.Errorf("block 3 was never requested from another peer")
+	}
+	if len(bm.requestedBlocks) != 0 {
+		t.Errorf("%d blocks still in flight", len(bm.requestedBlocks))
+	}
+
+	// The sync peer timed out three times in a row and is penalized for it
+	// while the peer which delivered everything is not.
+	if got := syncPeer.blockTimeouts; got != 3 {
+		t.Errorf("sync peer timeouts: got %d, want 3", got)
+	}
+	if syncPeer.banScore.Int() == 0 {
+		t.Errorf("sync peer was not penalized for timing out")
+	}
+	if got := mockPeers[2].sp.banScore.Int(); got != 0 {
+		t.Errorf("reliable peer ban score: got %d, want 0", got)
+	}
+
+	// Requests in flight from a peer which disconnects are moved to the
+	// remaining peers right away.
+	hash := chaincfg.RegressionNetParams.GenesisHash
+	bm.requestBlock(syncPeer, hash, nil)
+	bm.handleDonePeerMsg(peers, syncPeer)
+	req, ok := bm.requestedBlocks[*hash]
+	if !ok || req.peer == syncPeer {
+		t.Fatalf("request was not moved off the disconnected peer")
+	}
+}
+
+// TestReorgResurrectTxns ensures the transactions of blocks disconnected by a
+// reorganization are returned to the mempool once it finished when they are
+// still valid on the new main chain and were not mined again on it.
+func TestReorgResurrectTxns(t *testing.T) {
+	defer func(c *config, p *params) {
+		cfg = c
+		activeNetParams = p
+	}(cfg, activeNetParams)
+	activeNetParams = &regressionNetParams
+	chainParams := activeNetParams.Params
+
+	tmpDir, err := ioutil.TempDir("", "reorgresurrect")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cfg = newTestConfig(tmpDir)
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		chainParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+	s, err := newServer(nil, db, chainParams)
+	if err != nil {
+		t.Fatalf("newServer: unexpected error: %v", err)
+	}
+	s.Start()
+	defer func() {
+		s.Stop()
+		s.WaitForShutdown()
+	}()
+
+	// Generate blocks on top of the chain of the node until the admin
+	// thread outputs of the genesis coinbase matured.
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	chain := s.blockManager.chain
+	h.generator = h.newGenerator(chain)
+	processBlock := func(msgBlock *wire.MsgBlock) {
+		block := provautil.NewBlock(msgBlock)
+		_, _, err := s.blockManager.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+	}
+	for i := uint16(0); i < chainParams.CoinbaseMaturity; i++ {
+		processBlock(h.generateBlock(t))
+	}
+
+	// Mine a root transaction which provisions the provision and issue
+	// keys, along with a provision and an issue transaction, so the admin
+	// threads continue from outputs of transactions which aren't coinbases.
+	provisionKeys := []*btcec.PrivateKey{
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000001"),
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000002"),
+	}
+	issueKeys := []*btcec.PrivateKey{
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000003"),
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000004"),
+	}
+	aspKey := privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000005")
+	payScript, err := txscript.PayToAddrScript(h.payAddr)
+	if err != nil {
+		t.Fatalf("unable to create pkScript: %v", err)
+	}
+	tips := chain.ThreadTips()
+	rootTx := testAdminTx(t, chainParams, provautil.RootThread,
+		tips[provautil.RootThread], regressionRootKeys(t),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpProvisionKeyAdd, provisionKeys[0].PubKey(), 0)),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpProvisionKeyAdd, provisionKeys[1].PubKey(), 0)),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpIssueKeyAdd, issueKeys[0].PubKey(), 0)),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpIssueKeyAdd, issueKeys[1].PubKey(), 0)))
+	provisionTx := testAdminTx(t, chainParams, provautil.ProvisionThread,
+		tips[provautil.ProvisionThread], provisionKeys,
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpASPKeyAdd, aspKey.PubKey(),
+			chain.LastKeyID()+1)))
+	issueTx := testAdminTx(t, chainParams, provautil.IssueThread,
+		tips[provautil.IssueThread], issueKeys,
+		wire.NewTxOut(1000, payScript))
+	forkMsg := h.generateBlock(t)
+	forkMsg.Transactions = append(forkMsg.Transactions, rootTx,
+		provisionTx, issueTx)
+	h.finishModifiedBlock(t, forkMsg)
+	processBlock(forkMsg)
+
+	// Create a root transaction which provisions another issue key, an
+	// issue transaction signed by the new issue key, a provision
+	// transaction signed by both provision keys, and a root transaction
+	// which revokes one of them.
+	threadTip := func(tx *wire.MsgTx) *wire.OutPoint {
+		hash := tx.TxHash()
+		return wire.NewOutPoint(&hash, 0)
+	}
+	newIssueKey := privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000006")
+	bothTx := testAdminTx(t, chainParams, provautil.RootThread,
+		threadTip(rootTx), regressionRootKeys(t),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpIssueKeyAdd, newIssueKey.PubKey(), 0)))
+	oldTx := testAdminTx(t, chainParams, provautil.IssueThread,
+		threadTip(issueTx), []*btcec.PrivateKey{issueKeys[0],
+			newIssueKey}, wire.NewTxOut(2000, payScript))
+	revokedTx := testAdminTx(t, chainParams, provautil.ProvisionThread,
+		threadTip(provisionTx), provisionKeys,
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpASPKeyRevoke, aspKey.PubKey(),
+			chain.LastKeyID())))
+	revokeTx := testAdminTx(t, chainParams, provautil.RootThread,
+		threadTip(bothTx), regressionRootKeys(t),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpProvisionKeyRevoke,
+			provisionKeys[1].PubKey(), 0)))
+
+	// Mine the root transaction which provisions the issue key on both
+	// branches, the issue and provision transactions only on the old
+	// branch, and the revocation only on the new, longer branch.  The
+	// issue transaction is only valid once the blocks of the new branch
+	// are connected.
+	//
+	// fork -> old1 (both, old, revoked)
+	//     \-> new1 (both, revoke) -> new2
+	newMsg1 := h.generateBlock(t)
+	newMsg1.Transactions = append(newMsg1.Transactions, bothTx, revokeTx)
+	h.finishModifiedBlock(t, newMsg1)
+	oldMsg1 := h.generateBlock(t)
+	oldMsg1.Transactions = append(oldMsg1.Transactions, bothTx, oldTx,
+		revokedTx)
+	h.finishModifiedBlock(t, oldMsg1)
+	processBlock(oldMsg1)
+	processBlock(newMsg1)
+	newMsg2 := h.generateBlock(t)
+	newMsg2.Header.PrevBlock = newMsg1.BlockHash()
+	h.finishModifiedBlock(t, newMsg2)
+	processBlock(newMsg2)
+	if best := chain.BestSnapshot(); *best.Hash != newMsg2.BlockHash() {
+		t.Fatalf("best block is %v, want %v", best.Hash,
+			newMsg2.BlockHash())
+	}
+
+	// The issue transaction is still valid and was returned to the
+	// mempool, while the root transaction was mined on both branches and
+	// the provision transaction is signed by the revoked key.
+	tests := []struct {
+		name   string
+		tx     *wire.MsgTx
+		inPool bool
+	}{
+		{"mined on both branches", bothTx, false},
+		{"mined on the old branch", oldTx, true},
+		{"signed by a revoked key", revokedTx, false},
+		{"mined on the new branch", revokeTx, false},
+	}
+	for _, test := range tests {
+		hash := test.tx.TxHash()
+		inPool := s.txMemPool.IsTransactionInPool(&hash)
+		if inPool != test.inPool {
+			t.Errorf("%s transaction in mempool %v, want %v",
+				test.name, inPool, test.inPool)
+		}
+	}
+}
+
+// newServicePeer returns a server peer for the passed server which is not
+// connected and reports the passed services and latest block height.
+func newServicePeer(s *server, services wire.ServiceFlag, lastBlock uint32) *serverPeer {
+	sp := newServerPeer(s, false)
+	sp.Peer = peer.NewInboundPeer(&peer.Config{
+		ChainParams: s.chainParams,
+		Services:    services,
+	})
+	sp.UpdateLastBlockHeight(lastBlock)
+	return sp
+}
+
+// TestSyncPeerSelection ensures peers which only serve a limited block history
+// are sync candidates, that peers with the full block history are preferred
+// over them, and that they are only synced from when the blocks needed are
+// among the ones they serve.
+func TestSyncPeerSelection(t *testing.T) {
+	defer func(c *config) {
+		cfg = c
+	}(cfg)
+	cfg = &config{BanThreshold: defaultBanThreshold}
+
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	s := h.rpcServer.server
+
+	type testPeer struct {
+		services  wire.ServiceFlag
+		lastBlock uint32
+	}
+	full := wire.SFNodeNetwork | wire.SFNodeNetworkLimited
+	limited := wire.SFNodeNetworkLimited
+	window := uint32(wire.NodeNetworkLimitedMinBlocks -
+		limitedPeerSyncMargin)
+	tests := []struct {
+		name  string
+		peers []testPeer
+		want  int
+	}{
+		{
+			name:  "full history preferred during initial download",
+			peers: []testPeer{{limited, 1000}, {full, 1000}},
+			want:  1,
+		},
+		{
+			name:  "full history preferred near the tip",
+			peers: []testPeer{{limited, 10}, {full, 10}},
+			want:  1,
+		},
+		{
+			name:  "limited history near the tip",
+			peers: []testPeer{{limited, 1000}, {limited, window}},
+			want:  1,
+		},
+		{
+			name:  "limited history only during initial download",
+			peers: []testPeer{{limited, window + 1}},
+			want:  -1,
+		},
+		{
+			name:  "no block history",
+			peers: []testPeer{{wire.SFNodeBloom, 10}},
+			want:  -1,
+		},
+	}
+	for _, test := range tests {
+		bm := &blockManager{server: s, chain: h.chain}
+		s.blockManager = bm
+		peers := list.New()
+		sps := make([]*serverPeer, 0, len(test.peers))
+		for _, tp := range test.peers {
+			sp := newServicePeer(s, tp.services, tp.lastBlock)
+			sps = append(sps, sp)
+			if bm.isSyncCandidate(sp) {
+				peers.PushBack(sp)
+			}
+		}
+		bm.startSync(peers)
+
+		var want *serverPeer
+		if test.want >= 0 {
+			want = sps[test.want]
+		}
+		if bm.syncPeer != want {
+			t.Errorf("%s: got sync peer %v, want %v", test.name,
+				bm.syncPeer, want)
+		}
+	}
+}
+
+// TestBlockRequestReject ensures a block whose request is rejected by the peer
+// it is in flight from is requested from another peer right away, and that the
+// request is dropped once every peer rejected it.
+func TestBlockRequestReject(t *testing.T) {
+	defer func(c *config) {
+		cfg = c
+	}(cfg)
+	cfg = &config{BanThreshold: defaultBanThreshold}
+
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	s := h.rpcServer.server
+	bm := &blockManager{
+		server:          s,
+		chain:           h.chain,
+		requestedBlocks: make(map[chainhash.Hash]*blockRequest),
+	}
+	s.blockManager = bm
+
+	// Neither peer delivers the block.
+	hash := *chaincfg.RegressionNetParams.GenesisHash
+	drop := map[chainhash.Hash]struct{}{hash: {}}
+	deliveries := make(chan blockDelivery)
+	peers := list.New()
+	mockPeers := make([]*mockBlockPeer, 0, 2)
+	for i := 0; i < 2; i++ {
+		mp := newMockBlockPeer(t, s, drop, deliveries)
+		defer mp.disconnect()
+		mockPeers = append(mockPeers, mp)
+		peers.PushBack(mp.sp)
+	}
+	first, second := mockPeers[0].sp, mockPeers[1].sp
+
+	// Rejects from peers the block isn't in flight from are ignored.
+	bm.requestBlock(first, &hash, nil)
+	bm.handleBlockRejectMsg(peers, &blockRejectMsg{hash: hash, peer: second})
+	if req := bm.requestedBlocks[hash]; req == nil || req.peer != first {
+		t.Fatalf("request moved after a reject from another peer")
+	}
+
+	// The block is requested from the other peer once the peer it is in
+	// flight from rejects it.
+	bm.handleBlockRejectMsg(peers, &blockRejectMsg{hash: hash, peer: first})
+	req := bm.requestedBlocks[hash]
+	if req == nil || req.peer != second {
+		t.Fatalf("request was not moved off the rejecting peer")
+	}
+	if _, ok := first.requestedBlocks[hash]; ok {
+		t.Fatalf("block still in flight from the rejecting peer")
+	}
+	deadline := time.Now().Add(time.Second * 10)
+	for mockPeers[1].timesRequested(&hash) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("block was not requested from the other peer")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// The request is dropped once every peer rejected it.
+	bm.handleBlockRejectMsg(peers, &blockRejectMsg{hash: hash, peer: second})
+	if _, ok := bm.requestedBlocks[hash]; ok {
+		t.Fatalf("request not dropped after every peer rejected it")
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/wire"
+)
+
+// defaultBlockProductionWindow is the default number of most recent blocks of
+// the main chain the block production statistics are computed over.  It is the
+// window used for the metrics endpoint.
+const defaultBlockProductionWindow = 120
+
+// blockProductionKeySorter implements sort.Interface to allow a slice of block
+// production key results to be sorted by the number of blocks in descending
+// order and then by public key.
+type blockProductionKeySorter []btcjson.BlockProductionKeyResult
+
+// Len returns the number of keys in the slice.  It is part of the
+// sort.Interface implementation.
+func (s blockProductionKeySorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the keys at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s blockProductionKeySorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the key with index i should sort before the key with
+// index j.  It is part of the sort.Interface implementation.
+func (s blockProductionKeySorter) Less(i, j int) bool {
+	if s[i].Blocks != s[j].Blocks {
+		return s[i].Blocks > s[j].Blocks
+	}
+	return s[i].PubKey < s[j].PubKey
+}
+
+// blockIntervalSorter implements sort.Interface to allow a slice of block
+// intervals to be sorted in ascending order.
+type blockIntervalSorter []int64
+
+// Len returns the number of intervals in the slice.  It is part of the
+// sort.Interface implementation.
+func (s blockIntervalSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the intervals at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s blockIntervalSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the interval with index i should sort before the
+// interval with index j.  It is part of the sort.Interface implementation.
+func (s blockIntervalSorter) Less(i, j int) bool {
+	return s[i] < s[j]
+}
+
+// blockProductionInfo computes the block production statistics over the passed
+// number of most recent blocks of the main chain from their headers.  The
+// intervals are the differences between the timestamps of the blocks in the
+// window and the timestamps of their parents, so the genesis block, which has
+// no parent, only counts towards the blocks signed by its validate key.  A
+// window larger than the chain covers the whole chain.
+func blockProductionInfo(chain *blockchain.BlockChain, params *chaincfg.Params, window int) (*btcjson.GetBlockProductionInfoResult, error) {
+	best := chain.BestSnapshot()
+	result := &btcjson.GetBlockProductionInfoResult{
+		Height:         best.Height,
+		TargetInterval: params.TargetTimePerBlock.Seconds(),
+		ValidateKeys:   make([]btcjson.BlockProductionKeyResult, 0),
+	}
+
+	// Walk back from the best block through the parents of the blocks so
+	// the headers are all part of the same chain even when the main chain
+	// is reorganized in the meantime.
+	var intervals []int64
+	keyBlocks := make(map[wire.BlockValidatingPubKey]int)
+	header, err := chain.FetchHeader(best.Hash)
+	if err != nil {
+		return nil, err
+	}
+	for result.Blocks < window {
+		result.Blocks++
+		keyBlocks[header.ValidatingPubKey]++
+		if header.Height == 0 {
+			break
+		}
+		parent, err := chain.FetchHeader(&header.PrevBlock)
+		if err != nil {
+			return nil, err
+		}
+		interval := header.Timestamp.Sub(parent.Timestamp) / time.Second
+		intervals = append(intervals, int64(interval))
+		header = parent
+	}
+
+	for pubKey, blocks := range keyBlocks {
+		result.ValidateKeys = append(result.ValidateKeys,
+			btcjson.BlockProductionKeyResult{
+				PubKey: pubKey.String(),
+				Blocks: blocks,
+			})
+	}
+	sort.Sort(blockProductionKeySorter(result.ValidateKeys))
+
+	// The interval statistics are left at zero when the window only covers
+	// the genesis block.
+	result.Intervals = len(intervals)
+	if len(intervals) == 0 {
+		return result, nil
+	}
+	sort.Sort(blockIntervalSorter(intervals))
+	var total int64
+	for _, interval := range intervals {
+		total += interval
+	}
+	n := len(intervals)
+	result.MeanInterval = float64(total) / float64(n)
+	if n%2 == 1 {
+		result.MedianInterval = float64(intervals[n/2])
+	} else {
+		result.MedianInterval = float64(intervals[n/2-1]+
+			intervals[n/2]) / 2
+	}
+	p95Rank := int(math.Ceil(float64(n) * 0.95))
+	result.P95Interval = float64(intervals[p95Rank-1])
+	result.Deviation = result.MeanInterval - result.TargetInterval
+	if result.TargetInterval != 0 {
+		result.DeviationPercent = result.Deviation /
+			result.TargetInterval * 100
+	}
+	return result, nil
+}
+
+// writeBlockProductionMetrics writes the passed block production statistics to
+// the passed writer in the Prometheus text exposition format.
+func writeBlockProductionMetrics(w io.Writer, info *btcjson.GetBlockProductionInfoResult) error {
+	var buf bytes.Buffer
+	buf.WriteString("# HELP prova_block_production_blocks Number of most " +
+		"recent blocks of the main chain the block production " +
+		"statistics are computed over.\n")
+	buf.WriteString("# TYPE prova_block_production_blocks gauge\n")
+	fmt.Fprintf(&buf, "prova_block_production_blocks %d\n", info.Blocks)
+
+	buf.WriteString("# HELP prova_block_interval_seconds Interval " +
+		"between the most recent blocks of the main chain and their " +
+		"parents, along with the target interval.\n")
+	buf.WriteString("# TYPE prova_block_interval_seconds gauge\n")
+	for _, stat := range []struct {
+		name  string
+		value float64
+	}{
+		{"mean", info.MeanInterval},
+		{"median", info.MedianInterval},
+		{"p95", info.P95Interval},
+		{"target", info.TargetInterval},
+	} {
+		fmt.Fprintf(&buf, "prova_block_interval_seconds{statistic=%q} "+
+			"%g\n", stat.name, stat.value)
+	}
+
+	buf.WriteString("# HELP prova_block_interval_deviation_seconds " +
+		"Deviation of the mean block interval from the target " +
+		"interval.\n")
+	buf.WriteString("# TYPE prova_block_interval_deviation_seconds gauge\n")
+	fmt.Fprintf(&buf, "prova_block_interval_deviation_seconds %g\n",
+		info.Deviation)
+
+	buf.WriteString("# HELP prova_blocks_by_validate_key Number of the " +
+		"most recent blocks of the main chain signed by each validate " +
+		"key.\n")
+	buf.WriteString("# TYPE prova_blocks_by_validate_key gauge\n")
+	for _, key := range info.ValidateKeys {
+		fmt.Fprintf(&buf, "prova_blocks_by_validate_key{pubkey=%q} %d\n",
+			key.PubKey, key.Blocks)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+)
+
+// TestGetBlockProductionInfo ensures the getblockproductioninfo command
+// computes the interval statistics and the blocks signed by each validate key
+// over a chain with irregular block timestamps, both for a window within the
+// chain and for windows which reach or exceed the genesis block, and that the
+// statistics are exposed by the metrics.
+func TestGetBlockProductionInfo(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+
+	// Extend the chain with blocks whose timestamps are the given number of
+	// seconds after their parents.
+	offsets := []int64{60, 30, 90, 60, 600, 45, 75, 60, 20, 120}
+	genesis := h.rpcServer.server.chainParams.GenesisBlock
+	timestamp := genesis.Header.Timestamp
+	for _, offset := range offsets {
+		msgBlock := h.generateBlock(t)
+		timestamp = timestamp.Add(time.Duration(offset) * time.Second)
+		msgBlock.Header.Timestamp = timestamp
+		h.processModifiedBlock(t, msgBlock)
+	}
+
+	info := func(blocks *int) *btcjson.GetBlockProductionInfoResult {
+		cmd := btcjson.NewGetBlockProductionInfoCmd(blocks)
+		result, err := handleGetBlockProductionInfo(h.rpcServer, cmd,
+			nil)
+		if err != nil {
+			t.Fatalf("getblockproductioninfo: unexpected error: %v",
+				err)
+		}
+		return result.(*btcjson.GetBlockProductionInfoResult)
+	}
+	signerKey := hex.EncodeToString(h.signer.PubKey().SerializeCompressed())
+	genesisKey := genesis.Header.ValidatingPubKey.String()
+
+	// A window of the 5 most recent blocks covers the intervals 45, 75,
+	// 60, 20, and 120 seconds.
+	blocks := 5
+	result := info(&blocks)
+	if result.Height != uint32(len(offsets)) || result.Blocks != 5 ||
+		result.Intervals != 5 {
+
+		t.Fatalf("got height %d, blocks %d, intervals %d, want %d, 5 "+
+			"and 5", result.Height, result.Blocks, result.Intervals,
+			len(offsets))
+	}
+	if result.TargetInterval != 60 || result.MeanInterval != 64 ||
+		result.MedianInterval != 60 || result.P95Interval != 120 ||
+		result.Deviation != 4 ||
+		math.Abs(result.DeviationPercent-20.0/3) > 1e-9 {
+
+		t.Fatalf("unexpected interval statistics %+v", result)
+	}
+	if len(result.ValidateKeys) != 1 ||
+		result.ValidateKeys[0].PubKey != signerKey ||
+		result.ValidateKeys[0].Blocks != 5 {
+
+		t.Fatalf("unexpected validate keys %+v", result.ValidateKeys)
+	}
+
+	// The default window is larger than the chain, so it covers all of the
+	// blocks, while the genesis block has no interval and was signed by
+	// its own key.
+	result = info(nil)
+	if result.Blocks != len(offsets)+1 || result.Intervals != len(offsets) {
+		t.Fatalf("got blocks %d, intervals %d, want %d and %d",
+			result.Blocks, result.Intervals, len(offsets)+1,
+			len(offsets))
+	}
+	if result.MeanInterval != 116 || result.MedianInterval != 60 ||
+		result.P95Interval != 600 || result.Deviation != 56 {
+
+		t.Fatalf("unexpected interval statistics %+v", result)
+	}
+	want := []btcjson.BlockProductionKeyResult{
+		{PubKey: signerKey, Blocks: len(offsets)},
+		{PubKey: genesisKey, Blocks: 1},
+	}
+	if genesisKey == signerKey {
+		want = want[:1]
+		want[0].Blocks++
+	}
+	if len(result.ValidateKeys) != len(want) {
+		t.Fatalf("got validate keys %+v, want %+v", result.ValidateKeys,
+			want)
+	}
+	for i := range want {
+		if result.ValidateKeys[i] != want[i] {
+			t.Fatalf("got validate keys %+v, want %+v",
+				result.ValidateKeys, want)
+		}
+	}
+
+	// A window which ends at the genesis block is the same as the whole
+	// chain.
+	blocks = len(offsets) + 1
+	if got := info(&blocks); got.Blocks != result.Blocks ||
+		got.MeanInterval != result.MeanInterval {
+
+		t.Fatalf("got %+v for the whole chain, want %+v", got, result)
+	}
+
+	// The number of blocks must be positive.
+	blocks = 0
+	_, err := handleGetBlockProductionInfo(h.rpcServer,
+		btcjson.NewGetBlockProductionInfoCmd(&blocks), nil)
+	if jerr, ok := err.(*btcjson.RPCError); !ok ||
+		jerr.Code != btcjson.ErrRPCInvalidParameter {
+
+		t.Fatalf("got error %v for zero blocks, want invalid parameter",
+			err)
+	}
+
+	// The metrics contain the statistics.
+	var buf bytes.Buffer
+	if err := writeBlockProductionMetrics(&buf, result); err != nil {
+		t.Fatalf("writeBlockProductionMetrics: unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"prova_block_production_blocks 11",
+		`prova_block_interval_seconds{statistic="mean"} 116`,
+		`prova_block_interval_seconds{statistic="median"} 60`,
+		`prova_block_interval_seconds{statistic="p95"} 600`,
+		`prova_block_interval_seconds{statistic="target"} 60`,
+		"prova_block_interval_deviation_seconds 56",
+		`prova_blocks_by_validate_key{pubkey="` + signerKey + `"} 10`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+)
+
+// scrubBatchSize is the number of block hashes that are loaded from the main
+// chain at a time while scrubbing.
+const scrubBatchSize = 500
+
+// isCorruptBlockErr returns whether or not the passed error indicates the stored
+// data for a block failed its integrity checksum.
+func isCorruptBlockErr(err error) bool {
+	dbErr, ok := err.(database.Error)
+	return ok && dbErr.ErrorCode == database.ErrBlockCorrupt
+}
+
+// corruptBlock houses information about a block whose stored data was found to
+// be corrupt and has not been repaired yet.
+type corruptBlock struct {
+	hash     chainhash.Hash
+	height   uint32
+	detected time.Time
+}
+
+// corruptBlocksByHeight implements sort.Interface to allow a slice of corrupt
+// blocks to be sorted by height.
+type corruptBlocksByHeight []corruptBlock
+
+// Len returns the number of corrupt blocks in the slice.  It is part of the
+// sort.Interface implementation.
+func (s corruptBlocksByHeight) Len() int {
+	return len(s)
+}
+
+// Swap swaps the corrupt blocks at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s corruptBlocksByHeight) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the corrupt block with index i should sort before the
+// corrupt block with index j.  It is part of the sort.Interface
+// implementation.
+func (s corruptBlocksByHeight) Less(i, j int) bool {
+	return s[i].height < s[j].height
+}
+
+// scrubStatus is a snapshot of the state of the block scrubber.
+type scrubStatus struct {
+	enabled         bool
+	scanning        bool
+	scanHeight      uint32
+	passes          uint32
+	lastPassStart   time.Time
+	lastPassEnd     time.Time
+	blocksChecked   uint64
+	corruptDetected uint64
+	repaired        uint64
+	corruptBlocks   []corruptBlock
+}
+
+// blockScrubber tracks blocks whose stored data is corrupt and requests good
+// copies of them from the network.  When enabled, it also walks the blocks of
+// the main chain in the background at a limited rate verifying the integrity
+// checksum of each one so corruption is found before the data is needed.
+type blockScrubber struct {
+	started  int32
+	shutdown int32
+
+	db            database.DB
+	chain         *blockchain.BlockChain
+	rate          uint32
+	interval      time.Duration
+	requestRepair func(hash *chainhash.Hash)
+
+	statusLock sync.Mutex
+	status     scrubStatus
+	corrupt    map[chainhash.Hash]*corruptBlock
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// ReportCorrupt records the block with the passed hash as corrupt when the
+// passed error, which was returned while reading the block, indicates its
+// stored data failed checksum verification.  A repair is requested the first
+// time a given block is reported.  It returns whether or not the error was a
+// block corruption error.
+//
+// This function is safe for concurrent access.
+func (s *blockScrubber) ReportCorrupt(hash *chainhash.Hash, err error) bool {
+	if !isCorruptBlockErr(err) {
+		return false
+	}
+
+	s.statusLock.Lock()
+	if _, exists := s.corrupt[*hash]; exists {
+		s.statusLock.Unlock()
+		return true
+	}
+	height, _ := s.chain.BlockHeightByHash(hash)
+	s.corrupt[*hash] = &corruptBlock{
+		hash:     *hash,
+		height:   height,
+		detected: time.Now(),
+	}
+	s.status.corruptDetected++
+	s.statusLock.Unlock()
+
+	srvrLog.Errorf("Stored data for block %v (height %d) is corrupt: %v",
+		hash, height, err)
+	if s.requestRepair != nil {
+		s.requestRepair(hash)
+	}
+	return true
+}
+
+// BlockRepaired removes the block with the passed hash from the set of corrupt
+// blocks once a good copy has been stored.
+//
+// This function is safe for concurrent access.
+func (s *blockScrubber) BlockRepaired(hash *chainhash.Hash) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+
+	if _, exists := s.corrupt[*hash]; !exists {
+		return
+	}
+	delete(s.corrupt, *hash)
+	s.status.repaired++
+}
+
+// Status returns a snapshot of the current state of the scrubber.  The corrupt
+// blocks are sorted by height.
+//
+// This function is safe for concurrent access.
+func (s *blockScrubber) Status() *scrubStatus {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+
+	status := s.status
+	status.corruptBlocks = make([]corruptBlock, 0, len(s.corrupt))
+	for _, cb := range s.corrupt {
+		status.corruptBlocks = append(status.corruptBlocks, *cb)
+	}
+	sort.Sort(corruptBlocksByHeight(status.corruptBlocks))
+	return &status
+}
+
+// checkBlock reads the stored data for the block with the passed hash, which
+// verifies its checksum, and reports the block as corrupt as needed.  It
+// returns whether or not the block is corrupt.  Errors other than corruption
+// are returned.
+func (s *blockScrubber) checkBlock(hash *chainhash.Hash) (bool, error) {
+	err := s.db.View(func(dbTx database.Tx) error {
+		_, err := dbTx.FetchBlock(hash)
+		return err
+	})
+	isCorrupt := err != nil && s.ReportCorrupt(hash, err)
+	if err != nil && !isCorrupt {
+		return false, err
+	}
+
+	s.statusLock.Lock()
+	s.status.blocksChecked++
+	s.statusLock.Unlock()
+	return isCorrupt, nil
+}
+
+// scrubPass verifies every block in the main chain, waiting on the passed
+// channel before each block in order to limit the rate.  A nil channel
+// disables rate limiting.  It returns false if the scrubber is shutting down
+// before the pass completes.
+func (s *blockScrubber) scrubPass(limiter <-chan time.Time) bool {
+	s.statusLock.Lock()
+	s.status.scanning = true
+	s.status.scanHeight = 0
+	s.status.lastPassStart = time.Now()
+	s.statusLock.Unlock()
+	defer func() {
+		s.statusLock.Lock()
+		s.status.scanning = false
+		s.statusLock.Unlock()
+	}()
+
+	srvrLog.Debugf("Starting block scrub pass")
+	var checked, corrupt uint64
+	for height := uint32(0); ; height += scrubBatchSize {
+		// The main chain may change while scrubbing, so load the
+		// hashes in batches and stop once the end of the chain is
+		// reached.
+		if height > s.chain.BestSnapshot().Height {
+			break
+		}
+		hashes, err := s.chain.HeightRange(height, height+scrubBatchSize)
+		if err != nil {
+			srvrLog.Errorf("Unable to load block hashes to scrub: %v",
+				err)
+			return true
+		}
+		if len(hashes) == 0 {
+			break
+		}
+
+		for i := range hashes {
+			if limiter != nil {
+				select {
+				case <-limiter:
+				case <-s.quit:
+					return false
+				}
+			}
+			if atomic.LoadInt32(&s.shutdown) != 0 {
+				return false
+			}
+
+			s.statusLock.Lock()
+			s.status.scanHeight = height + uint32(i)
+			s.statusLock.Unlock()
+
+			isCorrupt, err := s.checkBlock(&hashes[i])
+			if err != nil {
+				srvrLog.Warnf("Unable to scrub block %v: %v",
+					&hashes[i], err)
+				continue
+			}
+			checked++
+			if isCorrupt {
+				corrupt++
+			}
+		}
+	}
+
+	s.statusLock.Lock()
+	s.status.passes++
+	s.status.lastPassEnd = time.Now()
+	s.statusLock.Unlock()
+
+	srvrLog.Infof("Block scrub pass complete: checked %d blocks, found %d "+
+		"corrupt", checked, corrupt)
+	return true
+}
+
+// scrubHandler repeatedly scrubs the main chain until the scrubber is stopped.
+// It must be run as a goroutine.
+func (s *blockScrubber) scrubHandler() {
+	tick := time.Second / time.Duration(s.rate)
+	if tick <= 0 {
+		tick = 1
+	}
+	limiter := time.NewTicker(tick)
+	defer limiter.Stop()
+
+out:
+	for {
+		if !s.scrubPass(limiter.C) {
+			break out
+		}
+
+		select {
+		case <-time.After(s.interval):
+		case <-s.quit:
+			break out
+		}
+	}
+
+	s.wg.Done()
+	srvrLog.Trace("Block scrubber done")
+}
+
+// Start begins background scrubbing when it is enabled.
+func (s *blockScrubber) Start() {
+	// Already started?
+	if atomic.AddInt32(&s.started, 1) != 1 {
+		return
+	}
+	if s.rate == 0 {
+		return
+	}
+
+	srvrLog.Trace("Starting block scrubber")
+	s.wg.Add(1)
+	go s.scrubHandler()
+}
+
+// Stop gracefully shuts down the background scrubbing and waits for it to
+// finish.
+func (s *blockScrubber) Stop() {
+	if atomic.AddInt32(&s.shutdown, 1) != 1 {
+		return
+	}
+
+	close(s.quit)
+	s.wg.Wait()
+}
+
+// newBlockScrubber returns a new block scrubber which verifies blocks of the
+// passed chain at no more than rate blocks per second, waiting interval
+// between passes, and invokes requestRepair for each corrupt block it finds.
+// A rate of zero disables background scrubbing, however corrupt blocks that
+// are reported are still tracked and repaired.
+func newBlockScrubber(db database.DB, chain *blockchain.BlockChain, rate uint32,
+	interval time.Duration, requestRepair func(hash *chainhash.Hash)) *blockScrubber {
+
+	return &blockScrubber{
+		db:            db,
+		chain:         chain,
+		rate:          rate,
+		interval:      interval,
+		requestRepair: requestRepair,
+		status:        scrubStatus{enabled: rate != 0},
+		corrupt:       make(map[chainhash.Hash]*corruptBlock),
+		quit:          make(chan struct{}),
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	_ "github.com/bitgo/prova/database/ffldb"
+	"github.com/bitgo/prova/peer"
+	"github.com/bitgo/prova/provautil"
+)
+
+// flipStoredBlockByte corrupts a single byte of the first block stored in the
+// flat files of the database at the passed path.
+func flipStoredBlockByte(t *testing.T, dbPath string, offset int64) {
+	f, err := os.OpenFile(filepath.Join(dbPath, "000000000.fdb"),
+		os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("unable to open block file: %v", err)
+	}
+	defer f.Close()
+
+	var b [1]byte
+	if _, err := f.ReadAt(b[:], offset); err != nil {
+		t.Fatalf("unable to read block file: %v", err)
+	}
+	b[0] ^= 0x10
+	if _, err := f.WriteAt(b[:], offset); err != nil {
+		t.Fatalf("unable to write block file: %v", err)
+	}
+}
+
+// TestBlockScrubber ensures the block scrubber detects a block whose stored
+// data has been corrupted, requests a repair of it through the block manager,
+// and clears the block once the block manager receives a good copy.
+func TestBlockScrubber(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	tmpDir, err := ioutil.TempDir("", "scrubber")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	dbPath := filepath.Join(tmpDir, "ffldb")
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+
+	timeSource := blockchain.NewMedianTime()
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  timeSource,
+	})
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+
+	// Wire a block manager up to the scrubber with only the state needed
+	// for handling repairs.
+	s := &server{
+		chainParams: &params,
+		db:          db,
+		timeSource:  timeSource,
+	}
+	bm := &blockManager{
+		server:          s,
+		chain:           chain,
+		requestedBlocks: make(map[chainhash.Hash]*blockRequest),
+		repairBlocks:    make(map[chainhash.Hash]struct{}),
+	}
+	s.blockManager = bm
+	var repairRequests []chainhash.Hash
+	s.blockScrubber = newBlockScrubber(db, chain, 0, time.Second,
+		func(hash *chainhash.Hash) {
+			repairRequests = append(repairRequests, *hash)
+		})
+	scrubber := s.blockScrubber
+
+	// A scrub of the intact chain must not find anything.
+	if !scrubber.scrubPass(nil) {
+		t.Fatalf("scrubPass: unexpected shutdown")
+	}
+	status := scrubber.Status()
+	if status.blocksChecked != 1 || status.corruptDetected != 0 ||
+		len(repairRequests) != 0 {
+
+		t.Fatalf("scrub of intact chain: checked %d, corrupt %d, "+
+			"repairs %d", status.blocksChecked,
+			status.corruptDetected, len(repairRequests))
+	}
+
+	// Flip a byte in the middle of the stored genesis block and ensure the
+	// corruption is detected and a repair is requested exactly once even
+	// though the block is read repeatedly.
+	genesisHash := params.GenesisHash
+	flipStoredBlockByte(t, dbPath, 100)
+	scrubber.scrubPass(nil)
+	scrubber.scrubPass(nil)
+	status = scrubber.Status()
+	if status.corruptDetected != 1 || len(status.corruptBlocks) != 1 {
+		t.Fatalf("scrub of corrupt chain: corrupt %d, pending %d, "+
+			"want 1 and 1", status.corruptDetected,
+			len(status.corruptBlocks))
+	}
+	if status.corruptBlocks[0].hash != *genesisHash {
+		t.Fatalf("corrupt block: got %v, want %v",
+			status.corruptBlocks[0].hash, genesisHash)
+	}
+	if len(repairRequests) != 1 || repairRequests[0] != *genesisHash {
+		t.Fatalf("repair requests: got %v, want [%v]", repairRequests,
+			genesisHash)
+	}
+
+	// Ensure the block manager requests the block from a peer once one is
+	// available.
+	peers := list.New()
+	bm.repairBlocks[*genesisHash] = struct{}{}
+	bm.requestRepairBlocks(peers)
+	if len(bm.requestedBlocks) != 0 {
+		t.Fatalf("repair requested without any peers")
+	}
+	sp := newServerPeer(s, false)
+	sp.Peer = peer.NewInboundPeer(&peer.Config{ChainParams: &params})
+	peers.PushBack(sp)
+	bm.requestRepairBlocks(peers)
+	if _, ok := sp.requestedBlocks[*genesisHash]; !ok {
+		t.Fatalf("corrupt block was not requested from peer")
+	}
+
+	// Deliver a good copy of the block from the peer and ensure the stored
+	// data is repaired.
+	genesis := provautil.NewBlock(params.GenesisBlock)
+	bm.handleBlockMsg(&blockMsg{block: genesis, peer: sp})
+	if _, ok := bm.repairBlocks[*genesisHash]; ok {
+		t.Fatalf("block still pending repair after receiving it")
+	}
+	status = scrubber.Status()
+	if status.repaired != 1 || len(status.corruptBlocks) != 0 {
+		t.Fatalf("after repair: repaired %d, pending %d, want 1 and 0",
+			status.repaired, len(status.corruptBlocks))
+	}
+	err = db.View(func(dbTx database.Tx) error {
+		_, err := dbTx.FetchBlock(genesisHash)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("FetchBlock after repair: unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,380 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+)
+
+const (
+	// broadcastHashHeader is the HTTP header which carries the hash of the
+	// submitted block.
+	broadcastHashHeader = "X-Prova-Block-Hash"
+
+	// broadcastHeightHeader is the HTTP header which carries the height of
+	// the submitted block.
+	broadcastHeightHeader = "X-Prova-Block-Height"
+
+	// broadcastMaxAttempts is the number of times submission of a block to
+	// an endpoint is attempted before it is reported as failed.
+	broadcastMaxAttempts = 5
+
+	// broadcastRetryDelay is the delay before the first retry of a failed
+	// submission.  It doubles with each further attempt up to
+	// broadcastMaxRetryDelay.
+	broadcastRetryDelay = time.Second
+
+	// broadcastMaxRetryDelay is the maximum delay between submission
+	// attempts.
+	broadcastMaxRetryDelay = time.Second * 30
+
+	// broadcastTimeout is the maximum amount of time a single submission
+	// attempt may take.
+	broadcastTimeout = time.Second * 30
+
+	// broadcastQueueSize is the maximum number of submissions waiting for a
+	// free worker.  Submissions which don't fit are reported as failed.
+	broadcastQueueSize = 100
+
+	// maxTrackedBroadcasts is the number of most recent blocks the status
+	// of the submissions is kept for.
+	maxTrackedBroadcasts = 100
+)
+
+// Broadcast submission statuses.
+const (
+	broadcastPending   = "pending"
+	broadcastSucceeded = "succeeded"
+	broadcastFailed    = "failed"
+)
+
+// broadcastSubmission houses the status of the submission of a block to a
+// single endpoint.
+type broadcastSubmission struct {
+	url         string
+	status      string
+	attempts    int
+	lastErr     string
+	lastAttempt time.Time
+}
+
+// broadcastBlock houses the status of the submissions of a block to all of the
+// endpoints.
+type broadcastBlock struct {
+	height      uint32
+	submissions []*broadcastSubmission
+}
+
+// broadcastJob is a submission of a serialized block waiting for a worker.
+type broadcastJob struct {
+	hash       chainhash.Hash
+	height     uint32
+	block      []byte
+	submission *broadcastSubmission
+}
+
+// blockBroadcaster submits the blocks produced by this node, either by the CPU
+// miner or through the submitblock RPC, to HTTP endpoints such as the block
+// submission APIs of relay networks.  It complements the P2P relay rather than
+// replacing it, so submissions never hold up block processing: they are queued
+// without blocking and performed by a bounded number of workers, with failed
+// submissions retried with exponential backoff.  The outcome of the
+// submissions of the most recent blocks is kept for the getbroadcaststatus
+// RPC.
+type blockBroadcaster struct {
+	started  int32
+	shutdown int32
+
+	endpoints     []string
+	client        *http.Client
+	workers       int
+	maxAttempts   int
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+	jobs          chan *broadcastJob
+
+	mtx    sync.Mutex
+	blocks map[chainhash.Hash]*broadcastBlock
+	order  []chainhash.Hash
+
+	// ctx is canceled when the broadcaster is stopped in order to abort
+	// submissions which are in progress.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// setStatus updates the status of the passed submission after an attempt.
+//
+// This function is safe for concurrent access.
+func (bb *blockBroadcaster) setStatus(s *broadcastSubmission, status string, err error) {
+	bb.mtx.Lock()
+	s.status = status
+	if err != nil {
+		s.lastErr = err.Error()
+	} else {
+		s.lastErr = ""
+	}
+	bb.mtx.Unlock()
+}
+
+// trackBlock starts tracking the submissions of the passed block to each
+// endpoint and returns them.  Only the most recent maxTrackedBroadcasts blocks
+// are tracked.
+//
+// This function is safe for concurrent access.
+func (bb *blockBroadcaster) trackBlock(hash *chainhash.Hash, height uint32) []*broadcastSubmission {
+	bb.mtx.Lock()
+	defer bb.mtx.Unlock()
+
+	if _, ok := bb.blocks[*hash]; ok {
+		return nil
+	}
+	if len(bb.order) == maxTrackedBroadcasts {
+		delete(bb.blocks, bb.order[0])
+		copy(bb.order, bb.order[1:])
+		bb.order = bb.order[:len(bb.order)-1]
+	}
+	b := &broadcastBlock{height: height}
+	for _, url := range bb.endpoints {
+		b.submissions = append(b.submissions, &broadcastSubmission{
+			url:    url,
+			status: broadcastPending,
+		})
+	}
+	bb.blocks[*hash] = b
+	bb.order = append(bb.order, *hash)
+	return b.submissions
+}
+
+// NotifyBlockConnected queues the submission of the passed block to each
+// endpoint.  It must only be called for blocks produced by this node once they
+// are committed to the main chain.
+func (bb *blockBroadcaster) NotifyBlockConnected(block *provautil.Block) {
+	if len(bb.endpoints) == 0 || atomic.LoadInt32(&bb.shutdown) != 0 {
+		return
+	}
+
+	blockBytes, err := block.Bytes()
+	if err != nil {
+		bmgrLog.Errorf("Unable to serialize block %v for broadcast: %v",
+			block.Hash(), err)
+		return
+	}
+	height := block.MsgBlock().Header.Height
+	for _, s := range bb.trackBlock(block.Hash(), height) {
+		job := &broadcastJob{
+			hash:       *block.Hash(),
+			height:     height,
+			block:      blockBytes,
+			submission: s,
+		}
+		select {
+		case bb.jobs <- job:
+		default:
+			bmgrLog.Errorf("Unable to broadcast block %v to %s: "+
+				"broadcast queue is full", block.Hash(), s.url)
+			bb.setStatus(s, broadcastFailed,
+				fmt.Errorf("broadcast queue is full"))
+		}
+	}
+}
+
+// post makes a single attempt to submit the block of the passed job to its
+// endpoint.
+func (bb *blockBroadcaster) post(job *broadcastJob) error {
+	req, err := http.NewRequest("POST", job.submission.url,
+		bytes.NewReader(job.block))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(bb.ctx)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(broadcastHashHeader, job.hash.String())
+	req.Header.Set(broadcastHeightHeader,
+		strconv.FormatUint(uint64(job.height), 10))
+
+	resp, err := bb.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint responded with status %s",
+			resp.Status)
+	}
+	return nil
+}
+
+// submit attempts to submit the block of the passed job to its endpoint,
+// retrying with exponential backoff, and records the outcome.  It returns
+// false if the broadcaster is shutting down before the submission completes.
+func (bb *blockBroadcaster) submit(job *broadcastJob) bool {
+	s := job.submission
+	delay := bb.retryDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		bb.mtx.Lock()
+		s.attempts = attempt
+		s.lastAttempt = time.Now()
+		bb.mtx.Unlock()
+
+		err = bb.post(job)
+		if err == nil {
+			bmgrLog.Debugf("Broadcast block %v to %s", &job.hash, s.url)
+			bb.setStatus(s, broadcastSucceeded, nil)
+			return true
+		}
+		if attempt >= bb.maxAttempts {
+			break
+		}
+
+		bmgrLog.Debugf("Broadcast attempt %d of block %v to %s failed: "+
+			"%v", attempt, &job.hash, s.url, err)
+		bb.setStatus(s, broadcastPending, err)
+		select {
+		case <-time.After(delay):
+		case <-bb.quit:
+			bb.setStatus(s, broadcastFailed, err)
+			return false
+		}
+		delay *= 2
+		if delay > bb.maxRetryDelay {
+			delay = bb.maxRetryDelay
+		}
+	}
+
+	bmgrLog.Errorf("Unable to broadcast block %v to %s after %d attempts: "+
+		"%v", &job.hash, s.url, bb.maxAttempts, err)
+	bb.setStatus(s, broadcastFailed, err)
+	return true
+}
+
+// worker performs the queued submissions until the broadcaster is stopped.
+// It must be run as a goroutine.
+func (bb *blockBroadcaster) worker() {
+out:
+	for {
+		select {
+		case job := <-bb.jobs:
+			if !bb.submit(job) {
+				break out
+			}
+
+		case <-bb.quit:
+			break out
+		}
+	}
+
+	bb.wg.Done()
+}
+
+// Status returns the status of the submissions of the block with the passed
+// hash, or nil when the block is not among the most recent blocks which were
+// broadcast.
+func (bb *blockBroadcaster) Status(hash *chainhash.Hash) *btcjson.GetBroadcastStatusResult {
+	bb.mtx.Lock()
+	defer bb.mtx.Unlock()
+
+	b, ok := bb.blocks[*hash]
+	if !ok {
+		return nil
+	}
+	result := &btcjson.GetBroadcastStatusResult{
+		Hash:      hash.String(),
+		Height:    b.height,
+		Endpoints: make([]btcjson.BroadcastEndpointResult, 0, len(b.submissions)),
+	}
+	for _, s := range b.submissions {
+		var lastAttempt int64
+		if !s.lastAttempt.IsZero() {
+			lastAttempt = s.lastAttempt.Unix()
+		}
+		result.Endpoints = append(result.Endpoints,
+			btcjson.BroadcastEndpointResult{
+				URL:         s.url,
+				Status:      s.status,
+				Attempts:    s.attempts,
+				Error:       s.lastErr,
+				LastAttempt: lastAttempt,
+			})
+	}
+	return result
+}
+
+// Start begins submitting blocks to the configured endpoints.
+func (bb *blockBroadcaster) Start() {
+	// Already started?
+	if atomic.AddInt32(&bb.started, 1) != 1 {
+		return
+	}
+	if len(bb.endpoints) == 0 {
+		return
+	}
+
+	bmgrLog.Trace("Starting block broadcaster")
+	for i := 0; i < bb.workers; i++ {
+		bb.wg.Add(1)
+		go bb.worker()
+	}
+}
+
+// Stop gracefully shuts down the block broadcaster and waits for the workers
+// to finish.  Submissions which are still queued are reported as failed.
+func (bb *blockBroadcaster) Stop() {
+	if atomic.AddInt32(&bb.shutdown, 1) != 1 {
+		return
+	}
+
+	close(bb.quit)
+	bb.cancel()
+	bb.wg.Wait()
+
+	for {
+		select {
+		case job := <-bb.jobs:
+			bb.setStatus(job.submission, broadcastFailed,
+				fmt.Errorf("shutting down"))
+		default:
+			return
+		}
+	}
+}
+
+// newBlockBroadcaster returns a new block broadcaster which submits blocks to
+// the passed endpoints with at most the passed number of submissions in
+// progress at once.
+func newBlockBroadcaster(endpoints []string, workers int) *blockBroadcaster {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &blockBroadcaster{
+		endpoints:     endpoints,
+		client:        &http.Client{Timeout: broadcastTimeout},
+		workers:       workers,
+		maxAttempts:   broadcastMaxAttempts,
+		retryDelay:    broadcastRetryDelay,
+		maxRetryDelay: broadcastMaxRetryDelay,
+		jobs:          make(chan *broadcastJob, broadcastQueueSize),
+		blocks:        make(map[chainhash.Hash]*broadcastBlock),
+		ctx:           ctx,
+		cancel:        cancel,
+		quit:          make(chan struct{}),
+	}
+}
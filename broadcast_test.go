@@ -0,0 +1,207 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+)
+
+// broadcastRecorder is a test broadcast endpoint which records the blocks it
+// receives and fails the first configured number of requests.
+type broadcastRecorder struct {
+	sync.Mutex
+	failures int
+	requests int
+	blocks   [][]byte
+	headers  []http.Header
+}
+
+// ServeHTTP records the request and responds with an error until the
+// configured number of failures is reached.
+func (r *broadcastRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	block, _ := ioutil.ReadAll(req.Body)
+
+	r.Lock()
+	defer r.Unlock()
+	r.requests++
+	if r.requests <= r.failures {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	r.blocks = append(r.blocks, block)
+	r.headers = append(r.headers, req.Header)
+}
+
+// newTestBlockBroadcaster returns a block broadcaster for the passed endpoints
+// which retries quickly.
+func newTestBlockBroadcaster(endpoints ...string) *blockBroadcaster {
+	bb := newBlockBroadcaster(endpoints, 2)
+	bb.maxAttempts = 3
+	bb.retryDelay = time.Millisecond
+	bb.maxRetryDelay = time.Millisecond * 4
+	return bb
+}
+
+// waitBroadcast waits for the submissions of the block with the passed hash to
+// complete and returns their status.
+func waitBroadcast(t *testing.T, bb *blockBroadcaster, hash *chainhash.Hash) *btcjson.GetBroadcastStatusResult {
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		status := bb.Status(hash)
+		if status == nil {
+			t.Fatalf("no broadcast status for block %v", hash)
+		}
+		pending := false
+		for _, endpoint := range status.Endpoints {
+			if endpoint.Status == broadcastPending {
+				pending = true
+			}
+		}
+		if !pending {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for broadcast of block %v: %+v",
+				hash, status)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// TestBlockBroadcast ensures blocks are submitted to each endpoint, that failed
+// submissions are retried, and that the outcome is reported by endpoint.
+func TestBlockBroadcast(t *testing.T) {
+	succeeding := &broadcastRecorder{}
+	succeedingServer := httptest.NewServer(succeeding)
+	defer succeedingServer.Close()
+	retrying := &broadcastRecorder{failures: 2}
+	retryingServer := httptest.NewServer(retrying)
+	defer retryingServer.Close()
+	failing := &broadcastRecorder{failures: 100}
+	failingServer := httptest.NewServer(failing)
+	defer failingServer.Close()
+
+	endpoints := []string{succeedingServer.URL, retryingServer.URL,
+		failingServer.URL}
+	bb := newTestBlockBroadcaster(endpoints...)
+	bb.Start()
+	defer bb.Stop()
+
+	block := provautil.NewBlock(chaincfg.RegressionNetParams.GenesisBlock)
+	blockBytes, err := block.Bytes()
+	if err != nil {
+		t.Fatalf("unable to serialize block: %v", err)
+	}
+	bb.NotifyBlockConnected(block)
+
+	// The first endpoint accepts the block right away, the second after
+	// being retried, and the third never does.
+	status := waitBroadcast(t, bb, block.Hash())
+	if status.Hash != block.Hash().String() || status.Height != 0 ||
+		len(status.Endpoints) != len(endpoints) {
+
+		t.Fatalf("unexpected broadcast status: %+v", status)
+	}
+	tests := []struct {
+		status   string
+		attempts int
+	}{
+		{broadcastSucceeded, 1},
+		{broadcastSucceeded, 3},
+		{broadcastFailed, 3},
+	}
+	for i, test := range tests {
+		endpoint := status.Endpoints[i]
+		if endpoint.URL != endpoints[i] || endpoint.Status != test.status ||
+			endpoint.Attempts != test.attempts ||
+			endpoint.LastAttempt == 0 {
+
+			t.Fatalf("endpoint %d: got %+v, want status %s after %d "+
+				"attempts", i, endpoint, test.status, test.attempts)
+		}
+		if (test.status == broadcastFailed) != (endpoint.Error != "") {
+			t.Fatalf("endpoint %d: unexpected error %q", i,
+				endpoint.Error)
+		}
+	}
+	if !strings.Contains(status.Endpoints[2].Error, "503") {
+		t.Fatalf("unexpected error of the failing endpoint: %q",
+			status.Endpoints[2].Error)
+	}
+
+	// The raw block is submitted along with its hash and height.
+	for _, r := range []*broadcastRecorder{succeeding, retrying} {
+		r.Lock()
+		if len(r.blocks) != 1 || !bytes.Equal(r.blocks[0], blockBytes) {
+			t.Fatalf("unexpected submitted blocks: %x", r.blocks)
+		}
+		header := r.headers[0]
+		if header.Get("Content-Type") != "application/octet-stream" ||
+			header.Get(broadcastHashHeader) != block.Hash().String() ||
+			header.Get(broadcastHeightHeader) != "0" {
+
+			t.Fatalf("unexpected submission headers: %v", header)
+		}
+		r.Unlock()
+	}
+	failing.Lock()
+	if failing.requests != 3 {
+		t.Fatalf("failing endpoint received %d requests, want 3",
+			failing.requests)
+	}
+	failing.Unlock()
+
+	// Blocks which were not broadcast have no status, and connecting the
+	// same block again doesn't submit it again.
+	if status := bb.Status(&chainhash.Hash{}); status != nil {
+		t.Fatalf("unexpected status of unknown block: %+v", status)
+	}
+	bb.NotifyBlockConnected(block)
+	if status := waitBroadcast(t, bb, block.Hash()); status.Endpoints[0].Attempts != 1 {
+		t.Fatalf("block was submitted again: %+v", status)
+	}
+}
+
+// TestBlockBroadcastStop ensures submissions which are pending when the
+// broadcaster is stopped are reported as failed.
+func TestBlockBroadcastStop(t *testing.T) {
+	failing := &broadcastRecorder{failures: 100}
+	server := httptest.NewServer(failing)
+	defer server.Close()
+
+	bb := newTestBlockBroadcaster(server.URL)
+	bb.maxAttempts = 100
+	bb.retryDelay = time.Hour
+	bb.maxRetryDelay = time.Hour
+	bb.Start()
+
+	block := provautil.NewBlock(chaincfg.RegressionNetParams.GenesisBlock)
+	bb.NotifyBlockConnected(block)
+	deadline := time.Now().Add(time.Second * 5)
+	for bb.Status(block.Hash()).Endpoints[0].Attempts == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for the first attempt")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	bb.Stop()
+
+	endpoint := bb.Status(block.Hash()).Endpoints[0]
+	if endpoint.Status != broadcastFailed || endpoint.Attempts != 1 {
+		t.Fatalf("unexpected status after stop: %+v", endpoint)
+	}
+}
@@ -100,7 +100,7 @@ func btcdMain(serverChan chan<- *server) error {
 	// Drop indexes and exit if requested.
 	//
 	// NOTE: The order is important here because dropping the tx index also
-	// drops the address index since it relies on it.
+	// drops the address and issuance indexes since they rely on it.
 	if cfg.DropAddrIndex {
 		if err := indexers.DropAddrIndex(db); err != nil {
 			btcdLog.Errorf("%v", err)
@@ -109,6 +109,14 @@ func btcdMain(serverChan chan<- *server) error {
 
 		return nil
 	}
+	if cfg.DropIssuanceIndex {
+		if err := indexers.DropIssuanceIndex(db); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
 	if cfg.DropTxIndex {
 		if err := indexers.DropTxIndex(db); err != nil {
 			btcdLog.Errorf("%v", err)
@@ -96,18 +96,23 @@ func NewGetCurrentNetCmd() *GetCurrentNetCmd {
 // github.com/decred/dcrd/dcrjson.
 type GetHeadersCmd struct {
 	BlockLocators []string `json:"blocklocators"`
-	HashStop      string   `json:"hashstop"`
+	HashStop      *string  `json:"hashstop"`
+	Verbose       *bool    `json:"verbose" jsonrpcdefault:"false"`
 }
 
 // NewGetHeadersCmd returns a new instance which can be used to issue a
 // getheaders JSON-RPC command.
 //
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+//
 // NOTE: This is a btcsuite extension ported from
 // github.com/decred/dcrd/dcrjson.
-func NewGetHeadersCmd(blockLocators []string, hashStop string) *GetHeadersCmd {
+func NewGetHeadersCmd(blockLocators []string, hashStop *string, verbose *bool) *GetHeadersCmd {
 	return &GetHeadersCmd{
 		BlockLocators: blockLocators,
 		HashStop:      hashStop,
+		Verbose:       verbose,
 	}
 }
 
@@ -139,24 +139,25 @@ func TestBtcdExtCmds(t *testing.T) {
 		{
 			name: "getheaders",
 			newCmd: func() (interface{}, error) {
-				return btcjson.NewCmd("getheaders", []string{}, "")
+				return btcjson.NewCmd("getheaders", []string{})
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewGetHeadersCmd(
 					[]string{},
-					"",
+					nil,
+					nil,
 				)
 			},
-			marshalled: `{"jsonrpc":"1.0","method":"getheaders","params":[[],""],"id":1}`,
+			marshalled: `{"jsonrpc":"1.0","method":"getheaders","params":[[]],"id":1}`,
 			unmarshalled: &btcjson.GetHeadersCmd{
 				BlockLocators: []string{},
-				HashStop:      "",
+				Verbose:       btcjson.Bool(false),
 			},
 		},
 		{
 			name: "getheaders - with arguments",
 			newCmd: func() (interface{}, error) {
-				return btcjson.NewCmd("getheaders", []string{"000000000000000001f1739002418e2f9a84c47a4fd2a0eb7a787a6b7dc12f16", "0000000000000000026f4b7f56eef057b32167eb5ad9ff62006f1807b7336d10"}, "000000000000000000ba33b33e1fad70b69e234fc24414dd47113bff38f523f7")
+				return btcjson.NewCmd("getheaders", []string{"000000000000000001f1739002418e2f9a84c47a4fd2a0eb7a787a6b7dc12f16", "0000000000000000026f4b7f56eef057b32167eb5ad9ff62006f1807b7336d10"}, "000000000000000000ba33b33e1fad70b69e234fc24414dd47113bff38f523f7", true)
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewGetHeadersCmd(
@@ -164,16 +165,18 @@ func TestBtcdExtCmds(t *testing.T) {
 						"000000000000000001f1739002418e2f9a84c47a4fd2a0eb7a787a6b7dc12f16",
 						"0000000000000000026f4b7f56eef057b32167eb5ad9ff62006f1807b7336d10",
 					},
-					"000000000000000000ba33b33e1fad70b69e234fc24414dd47113bff38f523f7",
+					btcjson.String("000000000000000000ba33b33e1fad70b69e234fc24414dd47113bff38f523f7"),
+					btcjson.Bool(true),
 				)
 			},
-			marshalled: `{"jsonrpc":"1.0","method":"getheaders","params":[["000000000000000001f1739002418e2f9a84c47a4fd2a0eb7a787a6b7dc12f16","0000000000000000026f4b7f56eef057b32167eb5ad9ff62006f1807b7336d10"],"000000000000000000ba33b33e1fad70b69e234fc24414dd47113bff38f523f7"],"id":1}`,
+			marshalled: `{"jsonrpc":"1.0","method":"getheaders","params":[["000000000000000001f1739002418e2f9a84c47a4fd2a0eb7a787a6b7dc12f16","0000000000000000026f4b7f56eef057b32167eb5ad9ff62006f1807b7336d10"],"000000000000000000ba33b33e1fad70b69e234fc24414dd47113bff38f523f7",true],"id":1}`,
 			unmarshalled: &btcjson.GetHeadersCmd{
 				BlockLocators: []string{
 					"000000000000000001f1739002418e2f9a84c47a4fd2a0eb7a787a6b7dc12f16",
 					"0000000000000000026f4b7f56eef057b32167eb5ad9ff62006f1807b7336d10",
 				},
-				HashStop: "000000000000000000ba33b33e1fad70b69e234fc24414dd47113bff38f523f7",
+				HashStop: btcjson.String("000000000000000000ba33b33e1fad70b69e234fc24414dd47113bff38f523f7"),
+				Verbose:  btcjson.Bool(true),
 			},
 		},
 	}
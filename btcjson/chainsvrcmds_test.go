@@ -245,6 +245,36 @@ func TestChainSvrCmds(t *testing.T) {
 				Verbose: btcjson.Bool(true),
 			},
 		},
+		{
+			name: "getblockraw",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockraw", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockRawCmd("123", nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockraw","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.GetBlockRawCmd{
+				Hash:   "123",
+				Offset: btcjson.Uint32(0),
+			},
+		},
+		{
+			name: "getblockraw optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockraw", "123", 81, 100)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockRawCmd("123",
+					btcjson.Uint32(81), btcjson.Uint32(100))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockraw","params":["123",81,100],"id":1}`,
+			unmarshalled: &btcjson.GetBlockRawCmd{
+				Hash:   "123",
+				Offset: btcjson.Uint32(81),
+				Length: btcjson.Uint32(100),
+			},
+		},
 		{
 			name: "getblocktemplate",
 			newCmd: func() (interface{}, error) {
@@ -718,6 +748,21 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "0123",
 			},
 		},
+		{
+			name: "prioritisetransaction",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("prioritisetransaction", "123", 0.0, 1000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewPrioritiseTransactionCmd("123", 0, 1000)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"prioritisetransaction","params":["123",0,1000],"id":1}`,
+			unmarshalled: &btcjson.PrioritiseTransactionCmd{
+				TxID:          "123",
+				PriorityDelta: 0,
+				FeeDelta:      1000,
+			},
+		},
 		{
 			name: "reconsiderblock",
 			newCmd: func() (interface{}, error) {
@@ -737,17 +782,18 @@ func TestChainSvrCmds(t *testing.T) {
 				return btcjson.NewCmd("searchrawtransactions", "1Address")
 			},
 			staticCmd: func() interface{} {
-				return btcjson.NewSearchRawTransactionsCmd("1Address", nil, nil, nil, nil, nil, nil)
+				return btcjson.NewSearchRawTransactionsCmd("1Address", nil, nil, nil, nil, nil, nil, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address"],"id":1}`,
 			unmarshalled: &btcjson.SearchRawTransactionsCmd{
-				Address:     "1Address",
-				Verbose:     btcjson.Int(1),
-				Skip:        btcjson.Int(0),
-				Count:       btcjson.Int(100),
-				VinExtra:    btcjson.Int(0),
-				Reverse:     btcjson.Bool(false),
-				FilterAddrs: nil,
+				Address:        "1Address",
+				Verbose:        btcjson.Int(1),
+				Skip:           btcjson.Int(0),
+				Count:          btcjson.Int(100),
+				VinExtra:       btcjson.Int(0),
+				Reverse:        btcjson.Bool(false),
+				FilterAddrs:    nil,
+				IncludeMempool: btcjson.Bool(true),
 			},
 		},
 		{
@@ -757,17 +803,18 @@ func TestChainSvrCmds(t *testing.T) {
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewSearchRawTransactionsCmd("1Address",
-					btcjson.Int(0), nil, nil, nil, nil, nil)
+					btcjson.Int(0), nil, nil, nil, nil, nil, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address",0],"id":1}`,
 			unmarshalled: &btcjson.SearchRawTransactionsCmd{
-				Address:     "1Address",
-				Verbose:     btcjson.Int(0),
-				Skip:        btcjson.Int(0),
-				Count:       btcjson.Int(100),
-				VinExtra:    btcjson.Int(0),
-				Reverse:     btcjson.Bool(false),
-				FilterAddrs: nil,
+				Address:        "1Address",
+				Verbose:        btcjson.Int(0),
+				Skip:           btcjson.Int(0),
+				Count:          btcjson.Int(100),
+				VinExtra:       btcjson.Int(0),
+				Reverse:        btcjson.Bool(false),
+				FilterAddrs:    nil,
+				IncludeMempool: btcjson.Bool(true),
 			},
 		},
 		{
@@ -777,17 +824,18 @@ func TestChainSvrCmds(t *testing.T) {
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewSearchRawTransactionsCmd("1Address",
-					btcjson.Int(0), btcjson.Int(5), nil, nil, nil, nil)
+					btcjson.Int(0), btcjson.Int(5), nil, nil, nil, nil, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address",0,5],"id":1}`,
 			unmarshalled: &btcjson.SearchRawTransactionsCmd{
-				Address:     "1Address",
-				Verbose:     btcjson.Int(0),
-				Skip:        btcjson.Int(5),
-				Count:       btcjson.Int(100),
-				VinExtra:    btcjson.Int(0),
-				Reverse:     btcjson.Bool(false),
-				FilterAddrs: nil,
+				Address:        "1Address",
+				Verbose:        btcjson.Int(0),
+				Skip:           btcjson.Int(5),
+				Count:          btcjson.Int(100),
+				VinExtra:       btcjson.Int(0),
+				Reverse:        btcjson.Bool(false),
+				FilterAddrs:    nil,
+				IncludeMempool: btcjson.Bool(true),
 			},
 		},
 		{
@@ -797,17 +845,18 @@ func TestChainSvrCmds(t *testing.T) {
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewSearchRawTransactionsCmd("1Address",
-					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), nil, nil, nil)
+					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), nil, nil, nil, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address",0,5,10],"id":1}`,
 			unmarshalled: &btcjson.SearchRawTransactionsCmd{
-				Address:     "1Address",
-				Verbose:     btcjson.Int(0),
-				Skip:        btcjson.Int(5),
-				Count:       btcjson.Int(10),
-				VinExtra:    btcjson.Int(0),
-				Reverse:     btcjson.Bool(false),
-				FilterAddrs: nil,
+				Address:        "1Address",
+				Verbose:        btcjson.Int(0),
+				Skip:           btcjson.Int(5),
+				Count:          btcjson.Int(10),
+				VinExtra:       btcjson.Int(0),
+				Reverse:        btcjson.Bool(false),
+				FilterAddrs:    nil,
+				IncludeMempool: btcjson.Bool(true),
 			},
 		},
 		{
@@ -817,17 +866,18 @@ func TestChainSvrCmds(t *testing.T) {
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewSearchRawTransactionsCmd("1Address",
-					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), btcjson.Int(1), nil, nil)
+					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), btcjson.Int(1), nil, nil, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address",0,5,10,1],"id":1}`,
 			unmarshalled: &btcjson.SearchRawTransactionsCmd{
-				Address:     "1Address",
-				Verbose:     btcjson.Int(0),
-				Skip:        btcjson.Int(5),
-				Count:       btcjson.Int(10),
-				VinExtra:    btcjson.Int(1),
-				Reverse:     btcjson.Bool(false),
-				FilterAddrs: nil,
+				Address:        "1Address",
+				Verbose:        btcjson.Int(0),
+				Skip:           btcjson.Int(5),
+				Count:          btcjson.Int(10),
+				VinExtra:       btcjson.Int(1),
+				Reverse:        btcjson.Bool(false),
+				FilterAddrs:    nil,
+				IncludeMempool: btcjson.Bool(true),
 			},
 		},
 		{
@@ -837,17 +887,18 @@ func TestChainSvrCmds(t *testing.T) {
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewSearchRawTransactionsCmd("1Address",
-					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), btcjson.Int(1), btcjson.Bool(true), nil)
+					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), btcjson.Int(1), btcjson.Bool(true), nil, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address",0,5,10,1,true],"id":1}`,
 			unmarshalled: &btcjson.SearchRawTransactionsCmd{
-				Address:     "1Address",
-				Verbose:     btcjson.Int(0),
-				Skip:        btcjson.Int(5),
-				Count:       btcjson.Int(10),
-				VinExtra:    btcjson.Int(1),
-				Reverse:     btcjson.Bool(true),
-				FilterAddrs: nil,
+				Address:        "1Address",
+				Verbose:        btcjson.Int(0),
+				Skip:           btcjson.Int(5),
+				Count:          btcjson.Int(10),
+				VinExtra:       btcjson.Int(1),
+				Reverse:        btcjson.Bool(true),
+				FilterAddrs:    nil,
+				IncludeMempool: btcjson.Bool(true),
 			},
 		},
 		{
@@ -857,17 +908,41 @@ func TestChainSvrCmds(t *testing.T) {
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewSearchRawTransactionsCmd("1Address",
-					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), btcjson.Int(1), btcjson.Bool(true), &[]string{"1Address"})
+					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), btcjson.Int(1), btcjson.Bool(true), &[]string{"1Address"}, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address",0,5,10,1,true,["1Address"]],"id":1}`,
 			unmarshalled: &btcjson.SearchRawTransactionsCmd{
-				Address:     "1Address",
-				Verbose:     btcjson.Int(0),
-				Skip:        btcjson.Int(5),
-				Count:       btcjson.Int(10),
-				VinExtra:    btcjson.Int(1),
-				Reverse:     btcjson.Bool(true),
-				FilterAddrs: &[]string{"1Address"},
+				Address:        "1Address",
+				Verbose:        btcjson.Int(0),
+				Skip:           btcjson.Int(5),
+				Count:          btcjson.Int(10),
+				VinExtra:       btcjson.Int(1),
+				Reverse:        btcjson.Bool(true),
+				FilterAddrs:    &[]string{"1Address"},
+				IncludeMempool: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "searchrawtransactions",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("searchrawtransactions", "1Address", 0, 5, 10, 1, true, []string{"1Address"}, false, 100)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSearchRawTransactionsCmd("1Address",
+					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), btcjson.Int(1), btcjson.Bool(true), &[]string{"1Address"},
+					btcjson.Bool(false), btcjson.Int32(100))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address",0,5,10,1,true,["1Address"],false,100],"id":1}`,
+			unmarshalled: &btcjson.SearchRawTransactionsCmd{
+				Address:        "1Address",
+				Verbose:        btcjson.Int(0),
+				Skip:           btcjson.Int(5),
+				Count:          btcjson.Int(10),
+				VinExtra:       btcjson.Int(1),
+				Reverse:        btcjson.Bool(true),
+				FilterAddrs:    &[]string{"1Address"},
+				IncludeMempool: btcjson.Bool(false),
+				MaxHeight:      btcjson.Int32(100),
 			},
 		},
 		{
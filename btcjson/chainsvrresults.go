@@ -71,6 +71,18 @@ type GetAddedNodeInfoResultAddr struct {
 	Connected string `json:"connected"`
 }
 
+// BackupChainStateResult models the data from the backupchainstate command.
+type BackupChainStateResult struct {
+	Destination  string  `json:"destination"`
+	Manifest     string  `json:"manifest"`
+	Hash         string  `json:"hash"`
+	Height       uint32  `json:"height"`
+	Files        int     `json:"files"`
+	Bytes        int64   `json:"bytes"`
+	PauseSeconds float64 `json:"pauseseconds"`
+	Seconds      float64 `json:"seconds"`
+}
+
 // GetAddedNodeInfoResult models the data from the getaddednodeinfo command.
 type GetAddedNodeInfoResult struct {
 	AddedNode string                        `json:"addednode"`
@@ -106,6 +118,524 @@ type GetAdminInfoResult struct {
 	ASPKeys       []ASPKeyIdResult  `json:"aspkeys,omitempty"`
 }
 
+// DecodeBlockResult models the data from the decodeblock command.
+type DecodeBlockResult struct {
+	Block          GetBlockVerboseResult `json:"block"`
+	Sane           bool                  `json:"sane"`
+	SanityError    string                `json:"sanityerror,omitempty"`
+	Canonical      *bool                 `json:"canonical,omitempty"`
+	CanonicalError string                `json:"canonicalerror,omitempty"`
+}
+
+// AdminOpResult models an admin operation of the getblockadminops command.
+type AdminOpResult struct {
+	TxID        string  `json:"txid"`
+	Thread      string  `json:"thread"`
+	Op          string  `json:"op"`
+	KeySet      string  `json:"keyset,omitempty"`
+	PubKey      string  `json:"pubkey,omitempty"`
+	KeyID       uint32  `json:"keyid,omitempty"`
+	Amount      int64   `json:"amount,omitempty"`
+	SetSize     *int    `json:"setsize,omitempty"`
+	TotalSupply *uint64 `json:"totalsupply,omitempty"`
+}
+
+// TxFeeResult models the fee paid by a transaction of a block in the block
+// connected webhook event.  The fee of the coinbase, which pays no fee, is
+// null.
+type TxFeeResult struct {
+	TxID string   `json:"txid"`
+	Fee  *float64 `json:"fee"`
+}
+
+// ExportChainDataResult models the data from the exportchaindata command.
+type ExportChainDataResult struct {
+	Destination string  `json:"destination"`
+	StartHeight uint32  `json:"startheight"`
+	EndHeight   uint32  `json:"endheight"`
+	Rows        uint32  `json:"rows"`
+	Bytes       int64   `json:"bytes"`
+	Seconds     float64 `json:"seconds"`
+}
+
+// GetAddrManInfoResult models the data from the getaddrmaninfo command.
+type GetAddrManInfoResult struct {
+	Addresses            int    `json:"addresses"`
+	New                  int    `json:"new"`
+	Tried                int    `json:"tried"`
+	SuppressedUnroutable uint64 `json:"suppressedunroutable"`
+	SuppressedPrivate    uint64 `json:"suppressedprivate"`
+	SuppressedSelf       uint64 `json:"suppressedself"`
+}
+
+// GetAdminProofResult models the data from the getadminproof command.
+type GetAdminProofResult struct {
+	Height           uint32 `json:"height"`
+	Hash             string `json:"hash"`
+	CheckpointHeight uint32 `json:"checkpointheight"`
+	CheckpointHash   string `json:"checkpointhash"`
+	StateHash        string `json:"statehash"`
+	NumHeaders       int    `json:"numheaders"`
+	NumAdminTxs      int    `json:"numadmintxs"`
+	Proof            string `json:"proof"`
+}
+
+// GetBlockAdminOpsResult models the data from the getblockadminops command.
+type GetBlockAdminOpsResult struct {
+	Hash      string          `json:"hash"`
+	Height    uint32          `json:"height"`
+	MainChain bool            `json:"mainchain"`
+	Ops       []AdminOpResult `json:"ops"`
+}
+
+// GetBlockCommitmentResult models the data from the getblockcommitment
+// command.
+type GetBlockCommitmentResult struct {
+	Hash       string `json:"hash"`
+	Height     uint32 `json:"height"`
+	Commitment string `json:"commitment,omitempty"`
+}
+
+// PeerBanScoreResult models a misbehavior score in the BanScores portion of
+// the GetPeerStatsResult command.
+type PeerBanScoreResult struct {
+	Time  int64  `json:"time"`
+	Score uint32 `json:"score"`
+}
+
+// GetPeerStatsResult models the data returned from the getpeerstats command.
+type GetPeerStatsResult struct {
+	Addr           string               `json:"addr"`
+	BytesSent      uint64               `json:"bytessent"`
+	BytesRecv      uint64               `json:"bytesrecv"`
+	BlocksServed   uint64               `json:"blocksserved"`
+	BlocksReceived uint64               `json:"blocksreceived"`
+	Connections    uint64               `json:"connections"`
+	LastConnected  int64                `json:"lastconnected"`
+	BanScores      []PeerBanScoreResult `json:"banscores"`
+}
+
+// ListWatchResult models the data returned from the listwatch command.
+type ListWatchResult struct {
+	Addresses []string `json:"addresses"`
+	KeyIDs    []uint32 `json:"keyids"`
+}
+
+// WSTokenResult models a websocket authentication token returned by the
+// issuewstoken and listwstokens commands.  The token itself is only returned
+// when it is issued.
+type WSTokenResult struct {
+	Token         string   `json:"token,omitempty"`
+	ID            string   `json:"id"`
+	Notifications []string `json:"notifications"`
+	Methods       []string `json:"methods"`
+	Created       int64    `json:"created"`
+	Expires       int64    `json:"expires,omitempty"`
+}
+
+// BlockProductionKeyResult models the blocks signed by a single validate key in
+// the ValidateKeys portion of the GetBlockProductionInfoResult command.
+type BlockProductionKeyResult struct {
+	PubKey string `json:"pubkey"`
+	Blocks int    `json:"blocks"`
+}
+
+// GetBlockProductionInfoResult models the data returned from the
+// getblockproductioninfo command.
+type GetBlockProductionInfoResult struct {
+	Height           uint32                     `json:"height"`
+	Blocks           int                        `json:"blocks"`
+	Intervals        int                        `json:"intervals"`
+	TargetInterval   float64                    `json:"targetinterval"`
+	MeanInterval     float64                    `json:"meaninterval"`
+	MedianInterval   float64                    `json:"medianinterval"`
+	P95Interval      float64                    `json:"p95interval"`
+	Deviation        float64                    `json:"deviation"`
+	DeviationPercent float64                    `json:"deviationpercent"`
+	ValidateKeys     []BlockProductionKeyResult `json:"validatekeys"`
+}
+
+// UnspentOutputResult models an unspent transaction output in the Outputs
+// portion of the ListUnspentByAddressResult command.
+type UnspentOutputResult struct {
+	TxID          string   `json:"txid"`
+	Vout          uint32   `json:"vout"`
+	Address       string   `json:"address,omitempty"`
+	KeyIDs        []uint32 `json:"keyids,omitempty"`
+	ScriptPubKey  string   `json:"scriptPubKey"`
+	Amount        float64  `json:"amount"`
+	Confirmations int32    `json:"confirmations"`
+	Coinbase      bool     `json:"coinbase"`
+}
+
+// ListUnspentByAddressResult models the data returned from the
+// listunspentbyaddress command.
+type ListUnspentByAddressResult struct {
+	Height  uint32                `json:"height"`
+	Total   float64               `json:"total"`
+	Outputs []UnspentOutputResult `json:"outputs"`
+}
+
+// JobStatusResult models the data returned from the getjobstatus and canceljob
+// commands.
+type JobStatusResult struct {
+	ID       string      `json:"id"`
+	Method   string      `json:"method"`
+	State    string      `json:"state"`
+	Progress float64     `json:"progress"`
+	Started  int64       `json:"started"`
+	Finished int64       `json:"finished,omitempty"`
+	ETA      int64       `json:"eta,omitempty"`
+	Result   interface{} `json:"result,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// UnspentScanProgressResult models the partial result of a listunspentbyaddress
+// job which is still scanning the utxo set.
+type UnspentScanProgressResult struct {
+	Matched int     `json:"matched"`
+	Total   float64 `json:"total"`
+}
+
+// ProcessingJournalEntryResult models an entry in the Entries portion of the
+// GetProcessingJournalResult command.
+type ProcessingJournalEntryResult struct {
+	Seq       uint64 `json:"seq"`
+	Time      int64  `json:"time"`
+	Hash      string `json:"hash"`
+	Height    uint32 `json:"height"`
+	Action    string `json:"action"`
+	Outcome   string `json:"outcome"`
+	ErrorCode string `json:"errorcode,omitempty"`
+}
+
+// GetProcessingJournalResult models the data returned from the
+// getprocessingjournal command.
+type GetProcessingJournalResult struct {
+	Capacity     int                            `json:"capacity"`
+	UncleanStart bool                           `json:"uncleanstart"`
+	Entries      []ProcessingJournalEntryResult `json:"entries"`
+}
+
+// RPCLatencyBucketResult models a latency histogram bucket in the Latency
+// portion of the RPCMethodInfoResult.
+type RPCLatencyBucketResult struct {
+	UpperBound float64 `json:"upperbound"`
+	Count      uint64  `json:"count"`
+}
+
+// RPCMethodInfoResult models the statistics of a single method in the Methods
+// portion of the GetRPCInfoResult command.
+type RPCMethodInfoResult struct {
+	Method       string                   `json:"method"`
+	Calls        uint64                   `json:"calls"`
+	Errors       uint64                   `json:"errors"`
+	ErrorCodes   map[string]uint64        `json:"errorcodes"`
+	TotalSeconds float64                  `json:"totalseconds"`
+	Latency      []RPCLatencyBucketResult `json:"latency"`
+}
+
+// RPCSlowCallResult models a call in the SlowCalls portion of the
+// GetRPCInfoResult command.
+type RPCSlowCallResult struct {
+	Method  string  `json:"method"`
+	Params  string  `json:"params"`
+	Time    int64   `json:"time"`
+	Seconds float64 `json:"seconds"`
+}
+
+// GetRPCInfoResult models the data returned from the getrpcinfo command.
+type GetRPCInfoResult struct {
+	SlowThreshold float64               `json:"slowthreshold"`
+	Methods       []RPCMethodInfoResult `json:"methods"`
+	SlowCalls     []RPCSlowCallResult   `json:"slowcalls"`
+}
+
+// GetPolicyInfoResult models the data returned from the getpolicyinfo command.
+type GetPolicyInfoResult struct {
+	AcceptNonStd          bool    `json:"acceptnonstd"`
+	RequireCanonicalOrder bool    `json:"requirecanonicalorder"`
+	RelayPriority         bool    `json:"relaypriority"`
+	MinRelayTxFee         float64 `json:"minrelaytxfee"`
+	FreeTxRelayLimit      float64 `json:"freetxrelaylimit"`
+	MaxOrphanTxs          int     `json:"maxorphantxs"`
+	MaxTxVersion          int32   `json:"maxtxversion"`
+	MempoolExpiry         int64   `json:"mempoolexpiry"`
+}
+
+// RejectBucketResult models the rejects received for a single command and
+// reject code in the Rejects portion of the GetRejectSummaryResult command.
+type RejectBucketResult struct {
+	Command    string `json:"command"`
+	Code       uint8  `json:"code"`
+	CodeName   string `json:"codename"`
+	Count      uint64 `json:"count"`
+	LastHash   string `json:"lasthash,omitempty"`
+	LastReason string `json:"lastreason"`
+	LastPeer   string `json:"lastpeer"`
+	LastTime   int64  `json:"lasttime"`
+}
+
+// RejectedOwnBlockResult models a block produced by this node in the OwnBlocks
+// portion of the GetRejectSummaryResult command.
+type RejectedOwnBlockResult struct {
+	Hash  string `json:"hash"`
+	Peers uint32 `json:"peers"`
+}
+
+// GetRejectSummaryResult models the data returned from the getrejectsummary
+// command.
+type GetRejectSummaryResult struct {
+	WarnPeers         uint32                   `json:"warnpeers"`
+	OwnBlocksRejected uint64                   `json:"ownblocksrejected"`
+	Rejects           []RejectBucketResult     `json:"rejects"`
+	OwnBlocks         []RejectedOwnBlockResult `json:"ownblocks"`
+}
+
+// ChainSplitPeerResult models a peer in the Peers portion of a
+// ChainSplitTipResult.
+type ChainSplitPeerResult struct {
+	ID   int32  `json:"id"`
+	Addr string `json:"addr"`
+}
+
+// ChainSplitTipResult models the best block shared by one or more peers in the
+// Tips portion of the GetChainSplitInfoResult command.
+type ChainSplitTipResult struct {
+	Hash       string                 `json:"hash,omitempty"`
+	Height     uint32                 `json:"height"`
+	Status     string                 `json:"status"`
+	Divergence uint32                 `json:"divergence"`
+	Peers      []ChainSplitPeerResult `json:"peers"`
+}
+
+// GetChainSplitInfoResult models the data returned from the getchainsplitinfo
+// command.
+type GetChainSplitInfoResult struct {
+	Hash           string                `json:"hash"`
+	Height         uint32                `json:"height"`
+	Fraction       float64               `json:"fraction"`
+	Depth          uint32                `json:"depth"`
+	Duration       int64                 `json:"duration"`
+	Current        bool                  `json:"current"`
+	Peers          int                   `json:"peers"`
+	KnownPeers     int                   `json:"knownpeers"`
+	DivergedPeers  int                   `json:"divergedpeers"`
+	Split          bool                  `json:"split"`
+	DivergingSince int64                 `json:"divergingsince,omitempty"`
+	Warned         bool                  `json:"warned"`
+	Warnings       uint64                `json:"warnings"`
+	Tips           []ChainSplitTipResult `json:"tips"`
+}
+
+// ThreadInfoResult models an admin thread in the Threads portion of the
+// GetThreadInfoResult command.
+type ThreadInfoResult struct {
+	ID             uint32 `json:"id"`
+	Name           string `json:"name"`
+	OutPoint       string `json:"outpoint"`
+	AdvancedHeight uint32 `json:"advancedheight"`
+	PendingTxs     int    `json:"pendingtxs"`
+	PendingSince   uint32 `json:"pendingsince,omitempty"`
+	StalledBlocks  uint32 `json:"stalledblocks"`
+	Stuck          bool   `json:"stuck"`
+}
+
+// GetThreadInfoResult models the data returned from the getthreadinfo command.
+type GetThreadInfoResult struct {
+	Hash        string             `json:"hash"`
+	Height      uint32             `json:"height"`
+	StuckBlocks uint32             `json:"stuckblocks"`
+	Warnings    uint64             `json:"warnings"`
+	Threads     []ThreadInfoResult `json:"threads"`
+}
+
+// DoubleSignResult models the evidence that a validate key signed two
+// different blocks at the same height in the DoubleSigns portion of the
+// GetDoubleSignsResult command.
+type DoubleSignResult struct {
+	ValidatingPubKey string `json:"validatingpubkey"`
+	Height           uint32 `json:"height"`
+	FirstHash        string `json:"firsthash"`
+	FirstHeader      string `json:"firstheader"`
+	SecondHash       string `json:"secondhash"`
+	SecondHeader     string `json:"secondheader"`
+	Detected         int64  `json:"detected"`
+	ClearedHeight    uint32 `json:"clearedheight,omitempty"`
+	Rejected         bool   `json:"rejected"`
+}
+
+// GetDoubleSignsResult models the data returned from the getdoublesigns
+// command.
+type GetDoubleSignsResult struct {
+	RejectDoubleSigners bool               `json:"rejectdoublesigners"`
+	DoubleSigns         []DoubleSignResult `json:"doublesigns"`
+}
+
+// BroadcastEndpointResult models the submission of a block to a single
+// endpoint in the Endpoints portion of the GetBroadcastStatusResult command.
+type BroadcastEndpointResult struct {
+	URL         string `json:"url"`
+	Status      string `json:"status"`
+	Attempts    int    `json:"attempts"`
+	Error       string `json:"error,omitempty"`
+	LastAttempt int64  `json:"lastattempt"`
+}
+
+// GetBroadcastStatusResult models the data returned from the
+// getbroadcaststatus command.
+type GetBroadcastStatusResult struct {
+	Hash      string                    `json:"hash"`
+	Height    uint32                    `json:"height"`
+	Endpoints []BroadcastEndpointResult `json:"endpoints"`
+}
+
+// SetPeerTraceResult models the data returned from the setpeertrace command.
+type SetPeerTraceResult struct {
+	ID      int32  `json:"id"`
+	Enabled bool   `json:"enabled"`
+	Prefix  string `json:"prefix,omitempty"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// ErrorCountResult models the rejections with a single error code in the
+// Errors portion of the GetErrorStatsResult command.
+type ErrorCountResult struct {
+	Level string `json:"level"`
+	Code  string `json:"code"`
+	Count uint64 `json:"count"`
+}
+
+// GetErrorStatsResult models the data returned from the geterrorstats command.
+type GetErrorStatsResult struct {
+	Errors []ErrorCountResult `json:"errors"`
+}
+
+// SimulateAdminTxResult models the data returned from the simulateadmintx
+// command.
+type SimulateAdminTxResult struct {
+	Accepted      bool              `json:"accepted"`
+	Applied       int               `json:"applied"`
+	RejectedTxID  string            `json:"rejectedtxid,omitempty"`
+	RejectCode    string            `json:"rejectcode,omitempty"`
+	RejectReason  string            `json:"rejectreason,omitempty"`
+	ThreadTips    []ThreadTipResult `json:"threadtips"`
+	TotalSupply   uint64            `json:"totalsupply"`
+	SupplyDelta   int64             `json:"supplydelta"`
+	LastKeyID     uint32            `json:"lastkeyid"`
+	RootKeys      []string          `json:"rootkeys,omitempty"`
+	ProvisionKeys []string          `json:"provisionkeys,omitempty"`
+	IssueKeys     []string          `json:"issuekeys,omitempty"`
+	ValidateKeys  []string          `json:"validatekeys,omitempty"`
+	ASPKeys       []ASPKeyIdResult  `json:"aspkeys,omitempty"`
+}
+
+// ScrubCorruptBlockResult models a corrupt block in the CorruptBlocks portion
+// of the GetScrubStatusResult command.
+type ScrubCorruptBlockResult struct {
+	Hash     string `json:"hash"`
+	Height   uint32 `json:"height"`
+	Detected int64  `json:"detected"`
+}
+
+// GetScrubStatusResult models the data from the getscrubstatus command.
+type GetScrubStatusResult struct {
+	Enabled         bool                      `json:"enabled"`
+	Scanning        bool                      `json:"scanning"`
+	ScanHeight      uint32                    `json:"scanheight"`
+	Passes          uint32                    `json:"passes"`
+	LastPassStart   int64                     `json:"lastpassstart"`
+	LastPassEnd     int64                     `json:"lastpassend"`
+	BlocksChecked   uint64                    `json:"blockschecked"`
+	CorruptDetected uint64                    `json:"corruptdetected"`
+	Repaired        uint64                    `json:"repaired"`
+	CorruptBlocks   []ScrubCorruptBlockResult `json:"corruptblocks"`
+}
+
+// StatsSampleResult models a sample of the node statistics in the Samples
+// portion of the GetStatsHistoryResult command.  When the history is
+// downsampled, each sample averages the recorded samples within its step.
+type StatsSampleResult struct {
+	Time               int64     `json:"time"`
+	Samples            int       `json:"samples"`
+	MempoolTxs         float64   `json:"mempooltxs"`
+	MempoolBytes       float64   `json:"mempoolbytes"`
+	FeeRatePercentiles []float64 `json:"feeratepercentiles"`
+	Orphans            float64   `json:"orphans"`
+	UtxoCacheSize      float64   `json:"utxocachesize"`
+	UtxoCacheMaxSize   float64   `json:"utxocachemaxsize"`
+	InboundPeers       float64   `json:"inboundpeers"`
+	OutboundPeers      float64   `json:"outboundpeers"`
+}
+
+// GetStatsHistoryResult models the data from the getstatshistory command.
+type GetStatsHistoryResult struct {
+	Interval    int64               `json:"interval"`
+	Retention   int64               `json:"retention"`
+	Percentiles []int               `json:"percentiles"`
+	Samples     []StatsSampleResult `json:"samples"`
+}
+
+// ChainParamsDNSSeedResult models a DNS seed in the DNSSeeds portion of the
+// GetChainParamsResult command.
+type ChainParamsDNSSeedResult struct {
+	Host         string `json:"host"`
+	HasFiltering bool   `json:"hasfiltering"`
+}
+
+// ChainParamsCheckpointResult models a checkpoint in the Checkpoints portion
+// of the GetChainParamsResult command.
+type ChainParamsCheckpointResult struct {
+	Height uint32 `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// GetChainParamsResult models the data from the getchainparams command.  It
+// matches the JSON encoding of chaincfg.Params.
+type GetChainParamsResult struct {
+	Name                     string                        `json:"name"`
+	Net                      uint32                        `json:"net"`
+	DefaultPort              string                        `json:"defaultport"`
+	DNSSeeds                 []ChainParamsDNSSeedResult    `json:"dnsseeds"`
+	GenesisBlock             string                        `json:"genesisblock"`
+	GenesisHash              string                        `json:"genesishash"`
+	AdminKeySets             map[string][]string           `json:"adminkeysets"`
+	ASPKeyIDs                map[string]string             `json:"aspkeyids"`
+	PowLimit                 string                        `json:"powlimit"`
+	PowLimitBits             uint32                        `json:"powlimitbits"`
+	CoinbaseMaturity         uint16                        `json:"coinbasematurity"`
+	SubsidyReductionInterval uint32                        `json:"subsidyreductioninterval"`
+	TargetTimePerBlock       string                        `json:"targettimeperblock"`
+	GenerateSupported        bool                          `json:"generatesupported"`
+	Checkpoints              []ChainParamsCheckpointResult `json:"checkpoints"`
+	BlockEnforceNumRequired  uint64                        `json:"blockenforcenumrequired"`
+	BlockRejectNumRequired   uint64                        `json:"blockrejectnumrequired"`
+	BlockUpgradeNumToCheck   uint64                        `json:"blockupgradenumtocheck"`
+	RelayNonStdTxs           bool                          `json:"relaynonstdtxs"`
+	ProvaAddrID              byte                          `json:"provaaddrid"`
+	PrivateKeyID             byte                          `json:"privatekeyid"`
+	HDPrivateKeyID           string                        `json:"hdprivatekeyid"`
+	HDPublicKeyID            string                        `json:"hdpublickeyid"`
+	HDCoinType               uint32                        `json:"hdcointype"`
+	PowAveragingWindow       int                           `json:"powaveragingwindow"`
+	PowMaxAdjustDown         int64                         `json:"powmaxadjustdown"`
+	PowMaxAdjustUp           int64                         `json:"powmaxadjustup"`
+	ChainTrailingSigKeyLimit int                           `json:"chaintrailingsigkeylimit"`
+	ChainWindowShareLimit    int                           `json:"chainwindowsharelimit"`
+	MaximumFeeAmount         int64                         `json:"maximumfeeamount"`
+	MaxBlockTransactions     int                           `json:"maxblocktransactions"`
+	StrictMonotonicTime      bool                          `json:"strictmonotonictime"`
+	TimeRegressionWindow     int                           `json:"timeregressionwindow"`
+	MaxTimeRegression        string                        `json:"maxtimeregression"`
+	ScriptVersions           bool                          `json:"scriptversions"`
+	RejectDoubleSigners      bool                          `json:"rejectdoublesigners"`
+	PowOnly                  bool                          `json:"powonly"`
+	UpgradableAdminOps       bool                          `json:"upgradableadminops"`
+	BurnFees                 bool                          `json:"burnfees"`
+	ReprovisionKeyIDs        bool                          `json:"reprovisionkeyids"`
+	TxExpiry                 bool                          `json:"txexpiry"`
+}
+
 // GetBlockChainInfoResult models the data returned from the getblockchaininfo
 // command.
 type GetBlockChainInfoResult struct {
@@ -189,6 +719,7 @@ type GetMempoolEntryResult struct {
 	AncestorSize     int64    `json:"ancestorsize"`
 	AncestorFees     float64  `json:"ancestorfees"`
 	Depends          []string `json:"depends"`
+	ExpiryTime       int64    `json:"expirytime,omitempty"`
 }
 
 // GetMempoolInfoResult models the data returned from the getmempoolinfo
@@ -198,6 +729,27 @@ type GetMempoolInfoResult struct {
 	Bytes int64 `json:"bytes"`
 }
 
+// MempoolSnapshotEntry models a transaction of the data returned from the
+// getmempoolsnapshot command.
+type MempoolSnapshotEntry struct {
+	TxID        string   `json:"txid"`
+	Size        int32    `json:"size"`
+	Fee         float64  `json:"fee"`
+	ModifiedFee float64  `json:"modifiedfee"`
+	Time        int64    `json:"time"`
+	Height      int64    `json:"height"`
+	Depends     []string `json:"depends"`
+	SpentBy     []string `json:"spentby"`
+	Hex         string   `json:"hex,omitempty"`
+}
+
+// GetMempoolSnapshotResult models the data returned from the
+// getmempoolsnapshot command.
+type GetMempoolSnapshotResult struct {
+	Sequence uint64                 `json:"sequence"`
+	Entries  []MempoolSnapshotEntry `json:"entries"`
+}
+
 // GetNetworkInfoResult models the data returned from the getnetworkinfo
 // command.
 type GetNetworkInfoResult struct {
@@ -205,6 +757,8 @@ type GetNetworkInfoResult struct {
 	ProtocolVersion int32                  `json:"protocolversion"`
 	TimeOffset      int64                  `json:"timeoffset"`
 	Connections     int32                  `json:"connections"`
+	Listening       bool                   `json:"listening"`
+	OutboundOnly    bool                   `json:"outboundonly"`
 	Networks        []NetworksResult       `json:"networks"`
 	RelayFee        float64                `json:"relayfee"`
 	LocalAddresses  []LocalAddressesResult `json:"localaddresses"`
@@ -212,27 +766,29 @@ type GetNetworkInfoResult struct {
 
 // GetPeerInfoResult models the data returned from the getpeerinfo command.
 type GetPeerInfoResult struct {
-	ID             int32   `json:"id"`
-	Addr           string  `json:"addr"`
-	AddrLocal      string  `json:"addrlocal,omitempty"`
-	Services       string  `json:"services"`
-	RelayTxes      bool    `json:"relaytxes"`
-	LastSend       int64   `json:"lastsend"`
-	LastRecv       int64   `json:"lastrecv"`
-	BytesSent      uint64  `json:"bytessent"`
-	BytesRecv      uint64  `json:"bytesrecv"`
-	ConnTime       int64   `json:"conntime"`
-	TimeOffset     int64   `json:"timeoffset"`
-	PingTime       float64 `json:"pingtime"`
-	PingWait       float64 `json:"pingwait,omitempty"`
-	Version        uint32  `json:"version"`
-	SubVer         string  `json:"subver"`
-	Inbound        bool    `json:"inbound"`
-	StartingHeight uint32  `json:"startingheight"`
-	CurrentHeight  uint32  `json:"currentheight,omitempty"`
-	BanScore       int32   `json:"banscore"`
-	FeeFilter      int64   `json:"feefilter"`
-	SyncNode       bool    `json:"syncnode"`
+	ID              int32   `json:"id"`
+	Addr            string  `json:"addr"`
+	AddrLocal       string  `json:"addrlocal,omitempty"`
+	Services        string  `json:"services"`
+	RelayTxes       bool    `json:"relaytxes"`
+	LastSend        int64   `json:"lastsend"`
+	LastRecv        int64   `json:"lastrecv"`
+	BytesSent       uint64  `json:"bytessent"`
+	BytesRecv       uint64  `json:"bytesrecv"`
+	ConnTime        int64   `json:"conntime"`
+	TimeOffset      int64   `json:"timeoffset"`
+	PingTime        float64 `json:"pingtime"`
+	PingWait        float64 `json:"pingwait,omitempty"`
+	Version         uint32  `json:"version"`
+	ProtocolVersion uint32  `json:"protocolversion"`
+	SubVer          string  `json:"subver"`
+	Inbound         bool    `json:"inbound"`
+	StartingHeight  uint32  `json:"startingheight"`
+	CurrentHeight   uint32  `json:"currentheight,omitempty"`
+	BanScore        int32   `json:"banscore"`
+	FeeFilter       int64   `json:"feefilter"`
+	SyncNode        bool    `json:"syncnode"`
+	Deprioritized   bool    `json:"deprioritized"`
 }
 
 // GetRawMempoolVerboseResult models the data returned from the getrawmempool
@@ -330,6 +886,7 @@ func (v *Vin) MarshalJSON() ([]byte, error) {
 // PrevOut represents previous output for an input Vin.
 type PrevOut struct {
 	Addresses []string `json:"addresses,omitempty"`
+	KeyIDs    []uint32 `json:"keyids,omitempty"`
 	Value     float64  `json:"value"`
 }
 
@@ -387,17 +944,19 @@ type Vout struct {
 
 // GetMiningInfoResult models the data from the getmininginfo command.
 type GetMiningInfoResult struct {
-	Blocks           int64   `json:"blocks"`
-	CurrentBlockSize uint64  `json:"currentblocksize"`
-	CurrentBlockTx   uint64  `json:"currentblocktx"`
-	Difficulty       float64 `json:"difficulty"`
-	Errors           string  `json:"errors"`
-	Generate         bool    `json:"generate"`
-	GenProcLimit     int32   `json:"genproclimit"`
-	HashesPerSec     int64   `json:"hashespersec"`
-	NetworkHashPS    int64   `json:"networkhashps"`
-	PooledTx         uint64  `json:"pooledtx"`
-	TestNet          bool    `json:"testnet"`
+	BlockMaxSize          uint32  `json:"blockmaxsize"`
+	Blocks                int64   `json:"blocks"`
+	ConsensusMaxBlockSize uint32  `json:"consensusmaxblocksize"`
+	CurrentBlockSize      uint64  `json:"currentblocksize"`
+	CurrentBlockTx        uint64  `json:"currentblocktx"`
+	Difficulty            float64 `json:"difficulty"`
+	Errors                string  `json:"errors"`
+	Generate              bool    `json:"generate"`
+	GenProcLimit          int32   `json:"genproclimit"`
+	HashesPerSec          int64   `json:"hashespersec"`
+	NetworkHashPS         int64   `json:"networkhashps"`
+	PooledTx              uint64  `json:"pooledtx"`
+	TestNet               bool    `json:"testnet"`
 }
 
 // GetWorkResult models the data from the getwork command.
@@ -450,6 +1009,10 @@ type TxRawResult struct {
 	Confirmations uint64 `json:"confirmations,omitempty"`
 	Time          int64  `json:"time,omitempty"`
 	Blocktime     int64  `json:"blocktime,omitempty"`
+
+	// Fee is only set for the transactions of blocks returned by getblock,
+	// except for the coinbase, which pays no fee.
+	Fee *float64 `json:"fee,omitempty"`
 }
 
 // SearchRawTransactionsResult models the data from the searchrawtransaction
@@ -465,6 +1028,7 @@ type SearchRawTransactionsResult struct {
 	Confirmations uint64       `json:"confirmations,omitempty"`
 	Time          int64        `json:"time,omitempty"`
 	Blocktime     int64        `json:"blocktime,omitempty"`
+	Unconfirmed   bool         `json:"unconfirmed,omitempty"`
 }
 
 // TxRawDecodeResult models the data from the decoderawtransaction command.
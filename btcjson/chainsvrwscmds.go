@@ -57,6 +57,15 @@ func NewNotifyNewTransactionsCmd(verbose *bool) *NotifyNewTransactionsCmd {
 	}
 }
 
+// NotifyWatchedSpendsCmd defines the notifywatchedspends JSON-RPC command.
+type NotifyWatchedSpendsCmd struct{}
+
+// NewNotifyWatchedSpendsCmd returns a new instance which can be used to issue
+// a notifywatchedspends JSON-RPC command.
+func NewNotifyWatchedSpendsCmd() *NotifyWatchedSpendsCmd {
+	return &NotifyWatchedSpendsCmd{}
+}
+
 // SessionCmd defines the session JSON-RPC command.
 type SessionCmd struct{}
 
@@ -212,6 +221,36 @@ type RescanBlocksCmd struct {
 	BlockHashes []string
 }
 
+// StopNotifyWatchedSpendsCmd defines the stopnotifywatchedspends JSON-RPC
+// command.
+type StopNotifyWatchedSpendsCmd struct{}
+
+// NewStopNotifyWatchedSpendsCmd returns a new instance which can be used to
+// issue a stopnotifywatchedspends JSON-RPC command.
+func NewStopNotifyWatchedSpendsCmd() *StopNotifyWatchedSpendsCmd {
+	return &StopNotifyWatchedSpendsCmd{}
+}
+
+// SubscribeBlocksCmd defines the subscribeblocks JSON-RPC command.
+type SubscribeBlocksCmd struct {
+	StartHeight uint32
+}
+
+// NewSubscribeBlocksCmd returns a new instance which can be used to issue a
+// subscribeblocks JSON-RPC command.
+func NewSubscribeBlocksCmd(startHeight uint32) *SubscribeBlocksCmd {
+	return &SubscribeBlocksCmd{StartHeight: startHeight}
+}
+
+// UnsubscribeBlocksCmd defines the unsubscribeblocks JSON-RPC command.
+type UnsubscribeBlocksCmd struct{}
+
+// NewUnsubscribeBlocksCmd returns a new instance which can be used to issue an
+// unsubscribeblocks JSON-RPC command.
+func NewUnsubscribeBlocksCmd() *UnsubscribeBlocksCmd {
+	return &UnsubscribeBlocksCmd{}
+}
+
 // NewRescanBlocksCmd returns a new instance which can be used to issue a rescan
 // JSON-RPC command.
 //
@@ -231,11 +270,15 @@ func init() {
 	MustRegisterCmd("notifynewtransactions", (*NotifyNewTransactionsCmd)(nil), flags)
 	MustRegisterCmd("notifyreceived", (*NotifyReceivedCmd)(nil), flags)
 	MustRegisterCmd("notifyspent", (*NotifySpentCmd)(nil), flags)
+	MustRegisterCmd("notifywatchedspends", (*NotifyWatchedSpendsCmd)(nil), flags)
 	MustRegisterCmd("session", (*SessionCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyblocks", (*StopNotifyBlocksCmd)(nil), flags)
 	MustRegisterCmd("stopnotifynewtransactions", (*StopNotifyNewTransactionsCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyspent", (*StopNotifySpentCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyreceived", (*StopNotifyReceivedCmd)(nil), flags)
+	MustRegisterCmd("stopnotifywatchedspends", (*StopNotifyWatchedSpendsCmd)(nil), flags)
+	MustRegisterCmd("subscribeblocks", (*SubscribeBlocksCmd)(nil), flags)
+	MustRegisterCmd("unsubscribeblocks", (*UnsubscribeBlocksCmd)(nil), flags)
 	MustRegisterCmd("rescan", (*RescanCmd)(nil), flags)
 	MustRegisterCmd("rescanblocks", (*RescanBlocksCmd)(nil), flags)
 }
@@ -100,6 +100,50 @@ func TestChainSvrWsCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifynewtransactions","params":[],"id":1}`,
 			unmarshalled: &btcjson.StopNotifyNewTransactionsCmd{},
 		},
+		{
+			name: "notifywatchedspends",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifywatchedspends")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyWatchedSpendsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"notifywatchedspends","params":[],"id":1}`,
+			unmarshalled: &btcjson.NotifyWatchedSpendsCmd{},
+		},
+		{
+			name: "stopnotifywatchedspends",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("stopnotifywatchedspends")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStopNotifyWatchedSpendsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifywatchedspends","params":[],"id":1}`,
+			unmarshalled: &btcjson.StopNotifyWatchedSpendsCmd{},
+		},
+		{
+			name: "subscribeblocks",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("subscribeblocks", 100)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSubscribeBlocksCmd(100)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"subscribeblocks","params":[100],"id":1}`,
+			unmarshalled: &btcjson.SubscribeBlocksCmd{StartHeight: 100},
+		},
+		{
+			name: "unsubscribeblocks",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("unsubscribeblocks")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewUnsubscribeBlocksCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"unsubscribeblocks","params":[],"id":1}`,
+			unmarshalled: &btcjson.UnsubscribeBlocksCmd{},
+		},
 		{
 			name: "notifyreceived",
 			newCmd: func() (interface{}, error) {
@@ -75,6 +75,35 @@ const (
 	// from the chain server that inform a client that a transaction that
 	// matches the loaded filter was accepted by the mempool.
 	RelevantTxAcceptedNtfnMethod = "relevanttxaccepted"
+
+	// WatchedSpendNtfnMethod is the method used for notifications from the
+	// chain server that an output paying to an address or key ID on the
+	// watchlist has been spent, or that such a spend has been reversed.
+	WatchedSpendNtfnMethod = "watchedspend"
+
+	// TxExpiredNtfnMethod is the method used for notifications from the
+	// chain server that a transaction has been evicted from the mempool
+	// because it, or a transaction it depends on, expired.
+	TxExpiredNtfnMethod = "txexpired"
+
+	// TxRemovedNtfnMethod is the method used for notifications from the
+	// chain server that a transaction which was valid when it was
+	// accepted has been removed from the mempool without being mined,
+	// along with the reason it was removed.
+	TxRemovedNtfnMethod = "txremoved"
+
+	// SubscribedBlockConnectedNtfnMethod is the method used for
+	// notifications from the chain server that a block has been connected
+	// to the main chain as seen by the block subscription of the client,
+	// either while replaying the blocks from the start height or once the
+	// subscription follows the main chain.
+	SubscribedBlockConnectedNtfnMethod = "subscribedblockconnected"
+
+	// SubscribedBlockDisconnectedNtfnMethod is the method used for
+	// notifications from the chain server that a block previously sent
+	// with a subscribedblockconnected notification is no longer part of
+	// the main chain.
+	SubscribedBlockDisconnectedNtfnMethod = "subscribedblockdisconnected"
 )
 
 // BlockConnectedNtfn defines the blockconnected JSON-RPC notification.
@@ -285,6 +314,87 @@ func NewRelevantTxAcceptedNtfn(txHex string) *RelevantTxAcceptedNtfn {
 	return &RelevantTxAcceptedNtfn{Transaction: txHex}
 }
 
+// WatchedSpendNtfn defines the watchedspend JSON-RPC notification.
+type WatchedSpendNtfn struct {
+	Spend WatchedSpendResult
+}
+
+// NewWatchedSpendNtfn returns a new instance which can be used to issue a
+// watchedspend JSON-RPC notification.
+func NewWatchedSpendNtfn(spend WatchedSpendResult) *WatchedSpendNtfn {
+	return &WatchedSpendNtfn{Spend: spend}
+}
+
+// TxExpiredNtfn defines the txexpired JSON-RPC notification.
+type TxExpiredNtfn struct {
+	TxID  string
+	HexTx string
+}
+
+// NewTxExpiredNtfn returns a new instance which can be used to issue a
+// txexpired JSON-RPC notification.
+func NewTxExpiredNtfn(txHash string, hexTx string) *TxExpiredNtfn {
+	return &TxExpiredNtfn{
+		TxID:  txHash,
+		HexTx: hexTx,
+	}
+}
+
+// TxRemovedNtfn defines the txremoved JSON-RPC notification.
+type TxRemovedNtfn struct {
+	TxID   string
+	HexTx  string
+	Reason string
+}
+
+// NewTxRemovedNtfn returns a new instance which can be used to issue a
+// txremoved JSON-RPC notification.
+func NewTxRemovedNtfn(txHash string, hexTx string, reason string) *TxRemovedNtfn {
+	return &TxRemovedNtfn{
+		TxID:   txHash,
+		HexTx:  hexTx,
+		Reason: reason,
+	}
+}
+
+// SubscribedBlockConnectedNtfn defines the subscribedblockconnected JSON-RPC
+// notification.
+type SubscribedBlockConnectedNtfn struct {
+	Hash   string
+	Height int32
+	Time   int64
+	Block  string
+}
+
+// NewSubscribedBlockConnectedNtfn returns a new instance which can be used to
+// issue a subscribedblockconnected JSON-RPC notification.
+func NewSubscribedBlockConnectedNtfn(hash string, height int32, time int64, block string) *SubscribedBlockConnectedNtfn {
+	return &SubscribedBlockConnectedNtfn{
+		Hash:   hash,
+		Height: height,
+		Time:   time,
+		Block:  block,
+	}
+}
+
+// SubscribedBlockDisconnectedNtfn defines the subscribedblockdisconnected
+// JSON-RPC notification.
+type SubscribedBlockDisconnectedNtfn struct {
+	Hash   string
+	Height int32
+	Time   int64
+}
+
+// NewSubscribedBlockDisconnectedNtfn returns a new instance which can be used
+// to issue a subscribedblockdisconnected JSON-RPC notification.
+func NewSubscribedBlockDisconnectedNtfn(hash string, height int32, time int64) *SubscribedBlockDisconnectedNtfn {
+	return &SubscribedBlockDisconnectedNtfn{
+		Hash:   hash,
+		Height: height,
+		Time:   time,
+	}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets and are
 	// notifications.
@@ -301,4 +411,9 @@ func init() {
 	MustRegisterCmd(TxAcceptedNtfnMethod, (*TxAcceptedNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedVerboseNtfnMethod, (*TxAcceptedVerboseNtfn)(nil), flags)
 	MustRegisterCmd(RelevantTxAcceptedNtfnMethod, (*RelevantTxAcceptedNtfn)(nil), flags)
+	MustRegisterCmd(WatchedSpendNtfnMethod, (*WatchedSpendNtfn)(nil), flags)
+	MustRegisterCmd(TxExpiredNtfnMethod, (*TxExpiredNtfn)(nil), flags)
+	MustRegisterCmd(TxRemovedNtfnMethod, (*TxRemovedNtfn)(nil), flags)
+	MustRegisterCmd(SubscribedBlockConnectedNtfnMethod, (*SubscribedBlockConnectedNtfn)(nil), flags)
+	MustRegisterCmd(SubscribedBlockDisconnectedNtfnMethod, (*SubscribedBlockDisconnectedNtfn)(nil), flags)
 }
@@ -225,6 +225,97 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Transaction: "001122",
 			},
 		},
+		{
+			name: "watchedspend",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("watchedspend", `{"status":"connected","txid":"123","vin":1,"address":"1Address","keyid":2,"amount":1.5,"blockhash":"456","height":100}`)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewWatchedSpendNtfn(btcjson.WatchedSpendResult{
+					Status:    "connected",
+					TxID:      "123",
+					Vin:       1,
+					Address:   "1Address",
+					KeyID:     btcjson.Uint32(2),
+					Amount:    1.5,
+					BlockHash: "456",
+					Height:    100,
+				})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"watchedspend","params":[{"status":"connected","txid":"123","vin":1,"address":"1Address","keyid":2,"amount":1.5,"blockhash":"456","height":100}],"id":null}`,
+			unmarshalled: &btcjson.WatchedSpendNtfn{
+				Spend: btcjson.WatchedSpendResult{
+					Status:    "connected",
+					TxID:      "123",
+					Vin:       1,
+					Address:   "1Address",
+					KeyID:     btcjson.Uint32(2),
+					Amount:    1.5,
+					BlockHash: "456",
+					Height:    100,
+				},
+			},
+		},
+		{
+			name: "txexpired",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("txexpired", "123", "001122")
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewTxExpiredNtfn("123", "001122")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"txexpired","params":["123","001122"],"id":null}`,
+			unmarshalled: &btcjson.TxExpiredNtfn{
+				TxID:  "123",
+				HexTx: "001122",
+			},
+		},
+		{
+			name: "txremoved",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("txremoved", "123", "001122", "keyrevoked")
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewTxRemovedNtfn("123", "001122", "keyrevoked")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"txremoved","params":["123","001122","keyrevoked"],"id":null}`,
+			unmarshalled: &btcjson.TxRemovedNtfn{
+				TxID:   "123",
+				HexTx:  "001122",
+				Reason: "keyrevoked",
+			},
+		},
+		{
+			name: "subscribedblockconnected",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("subscribedblockconnected", "123", 100000, 123456789, "001122")
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewSubscribedBlockConnectedNtfn("123", 100000, 123456789, "001122")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"subscribedblockconnected","params":["123",100000,123456789,"001122"],"id":null}`,
+			unmarshalled: &btcjson.SubscribedBlockConnectedNtfn{
+				Hash:   "123",
+				Height: 100000,
+				Time:   123456789,
+				Block:  "001122",
+			},
+		},
+		{
+			name: "subscribedblockdisconnected",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("subscribedblockdisconnected", "123", 100000, 123456789)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewSubscribedBlockDisconnectedNtfn("123", 100000, 123456789)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"subscribedblockdisconnected","params":["123",100000,123456789],"id":null}`,
+			unmarshalled: &btcjson.SubscribedBlockDisconnectedNtfn{
+				Hash:   "123",
+				Height: 100000,
+				Time:   123456789,
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -20,3 +20,20 @@ type RescannedBlock struct {
 	Hash         string   `json:"hash"`
 	Transactions []string `json:"transactions"`
 }
+
+// WatchedSpendResult models the spend of an output paying to an address or key
+// ID on the watchlist of the server which is sent with watchedspend
+// notifications.  The status is mempool for spends accepted into the memory
+// pool, connected for spends in a block connected to the main chain, and
+// disconnected for spends reversed by the block being disconnected.  KeyID is
+// only set when the spend matched a watched key ID.
+type WatchedSpendResult struct {
+	Status    string  `json:"status"`
+	TxID      string  `json:"txid"`
+	Vin       uint32  `json:"vin"`
+	Address   string  `json:"address"`
+	KeyID     *uint32 `json:"keyid,omitempty"`
+	Amount    float64 `json:"amount"`
+	BlockHash string  `json:"blockhash,omitempty"`
+	Height    uint32  `json:"height,omitempty"`
+}
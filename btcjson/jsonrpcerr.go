@@ -83,3 +83,18 @@ const (
 	ErrRPCNoWallet      RPCErrorCode = -1
 	ErrRPCUnimplemented RPCErrorCode = -1
 )
+
+// Errors that are specific to Prova.  They are the negated HTTP status codes
+// with the same meaning.
+const (
+	ErrRPCRequestTimeout  RPCErrorCode = -408
+	ErrRPCRequestTooLarge RPCErrorCode = -413
+	ErrRPCTooManyRequests RPCErrorCode = -429
+)
+
+// Errors that are specific to Prova address handling.
+const (
+	// ErrRPCWrongNetworkAddress indicates an address is valid, but for a
+	// different network than the one the server is on.
+	ErrRPCWrongNetworkAddress RPCErrorCode = -50
+)
@@ -24,9 +24,712 @@ func NewSetValidateKeysCmd(privKeys []string) *SetValidateKeysCmd {
 	}
 }
 
+// AddWatchCmd defines the addwatch JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type AddWatchCmd struct {
+	Addresses []string
+	KeyIDs    *[]uint32
+}
+
+// NewAddWatchCmd returns a new AddWatchCmd which can be used to issue an
+// addwatch JSON-RPC command.  This command is not a standard command. It is an
+// extension for prova.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewAddWatchCmd(addresses []string, keyIDs *[]uint32) *AddWatchCmd {
+	return &AddWatchCmd{
+		Addresses: addresses,
+		KeyIDs:    keyIDs,
+	}
+}
+
+// BackupChainStateCmd defines the backupchainstate JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type BackupChainStateCmd struct {
+	Destination string
+}
+
+// NewBackupChainStateCmd returns a new BackupChainStateCmd which can be used
+// to issue a backupchainstate JSON-RPC command.  This command is not a standard
+// command. It is an extension for prova.
+func NewBackupChainStateCmd(destination string) *BackupChainStateCmd {
+	return &BackupChainStateCmd{
+		Destination: destination,
+	}
+}
+
+// CancelJobCmd defines the canceljob JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type CancelJobCmd struct {
+	ID string
+}
+
+// NewCancelJobCmd returns a new CancelJobCmd which can be used to issue a
+// canceljob JSON-RPC command.  This command is not a standard command. It is an
+// extension for prova.
+func NewCancelJobCmd(id string) *CancelJobCmd {
+	return &CancelJobCmd{
+		ID: id,
+	}
+}
+
+// DecodeBlockCmd defines the decodeblock JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type DecodeBlockCmd struct {
+	HexBlock string
+	Strict   *bool `jsonrpcdefault:"false"`
+}
+
+// NewDecodeBlockCmd returns a new DecodeBlockCmd which can be used to issue a
+// decodeblock JSON-RPC command.  This command is not a standard command. It is
+// an extension for prova.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewDecodeBlockCmd(hexBlock string, strict *bool) *DecodeBlockCmd {
+	return &DecodeBlockCmd{
+		HexBlock: hexBlock,
+		Strict:   strict,
+	}
+}
+
+// ExportBanListCmd defines the exportbanlist JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type ExportBanListCmd struct{}
+
+// NewExportBanListCmd returns a new ExportBanListCmd which can be used to issue
+// an exportbanlist JSON-RPC command.  This command is not a standard command.
+// It is an extension for prova.
+func NewExportBanListCmd() *ExportBanListCmd {
+	return &ExportBanListCmd{}
+}
+
+// ExportChainDataCmd defines the exportchaindata JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type ExportChainDataCmd struct {
+	Destination string
+	StartHeight *uint32 `jsonrpcdefault:"0"`
+}
+
+// NewExportChainDataCmd returns a new ExportChainDataCmd which can be used to
+// issue an exportchaindata JSON-RPC command.  This command is not a standard
+// command. It is an extension for prova.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewExportChainDataCmd(destination string, startHeight *uint32) *ExportChainDataCmd {
+	return &ExportChainDataCmd{
+		Destination: destination,
+		StartHeight: startHeight,
+	}
+}
+
+// GetAddrManInfoCmd defines the getaddrmaninfo JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetAddrManInfoCmd struct{}
+
+// NewGetAddrManInfoCmd returns a new GetAddrManInfoCmd which can be used to
+// issue a getaddrmaninfo JSON-RPC command.  This command is not a standard
+// command. It is an extension for prova.
+func NewGetAddrManInfoCmd() *GetAddrManInfoCmd {
+	return &GetAddrManInfoCmd{}
+}
+
+// GetAdminProofCmd defines the getadminproof JSON-RPC command.  This command
+// is not a standard command, it is an extension for operating prova.
+type GetAdminProofCmd struct {
+	Height uint32
+}
+
+// NewGetAdminProofCmd returns a new GetAdminProofCmd which can be used to
+// issue a getadminproof JSON-RPC command.  This command is not a standard
+// command. It is an extension for prova.
+func NewGetAdminProofCmd(height uint32) *GetAdminProofCmd {
+	return &GetAdminProofCmd{
+		Height: height,
+	}
+}
+
+// GetBlockAdminOpsCmd defines the getblockadminops JSON-RPC command.  This
+// command is not a standard command, it is an extension for operating prova.
+type GetBlockAdminOpsCmd struct {
+	Hash string
+}
+
+// NewGetBlockAdminOpsCmd returns a new GetBlockAdminOpsCmd which can be used
+// to issue a getblockadminops JSON-RPC command.  This command is not a
+// standard command. It is an extension for prova.
+func NewGetBlockAdminOpsCmd(hash string) *GetBlockAdminOpsCmd {
+	return &GetBlockAdminOpsCmd{
+		Hash: hash,
+	}
+}
+
+// GetBlockCommitmentCmd defines the getblockcommitment JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetBlockCommitmentCmd struct {
+	Hash string
+}
+
+// NewGetBlockCommitmentCmd returns a new GetBlockCommitmentCmd which can be
+// used to issue a getblockcommitment JSON-RPC command.  This command is not a
+// standard command. It is an extension for prova.
+func NewGetBlockCommitmentCmd(hash string) *GetBlockCommitmentCmd {
+	return &GetBlockCommitmentCmd{
+		Hash: hash,
+	}
+}
+
+// GetBlockProductionInfoCmd defines the getblockproductioninfo JSON-RPC
+// command.  This command is not a standard command, it is an extension for
+// operating prova.
+type GetBlockProductionInfoCmd struct {
+	Blocks *int `jsonrpcdefault:"120"`
+}
+
+// NewGetBlockProductionInfoCmd returns a new GetBlockProductionInfoCmd which
+// can be used to issue a getblockproductioninfo JSON-RPC command.  This command
+// is not a standard command. It is an extension for prova.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetBlockProductionInfoCmd(blocks *int) *GetBlockProductionInfoCmd {
+	return &GetBlockProductionInfoCmd{
+		Blocks: blocks,
+	}
+}
+
+// GetBroadcastStatusCmd defines the getbroadcaststatus JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetBroadcastStatusCmd struct {
+	Hash string
+}
+
+// NewGetBroadcastStatusCmd returns a new GetBroadcastStatusCmd which can be
+// used to issue a getbroadcaststatus JSON-RPC command.  This command is not a
+// standard command. It is an extension for prova.
+func NewGetBroadcastStatusCmd(hash string) *GetBroadcastStatusCmd {
+	return &GetBroadcastStatusCmd{
+		Hash: hash,
+	}
+}
+
+// GetChainParamsCmd defines the getchainparams JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetChainParamsCmd struct{}
+
+// NewGetChainParamsCmd returns a new GetChainParamsCmd which can be used to
+// issue a getchainparams JSON-RPC command.  This command is not a standard
+// command. It is an extension for prova.
+func NewGetChainParamsCmd() *GetChainParamsCmd {
+	return &GetChainParamsCmd{}
+}
+
+// GetChainSplitInfoCmd defines the getchainsplitinfo JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetChainSplitInfoCmd struct{}
+
+// NewGetChainSplitInfoCmd returns a new GetChainSplitInfoCmd which can be used
+// to issue a getchainsplitinfo JSON-RPC command.  This command is not a
+// standard command. It is an extension for prova.
+func NewGetChainSplitInfoCmd() *GetChainSplitInfoCmd {
+	return &GetChainSplitInfoCmd{}
+}
+
+// GetDoubleSignsCmd defines the getdoublesigns JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetDoubleSignsCmd struct{}
+
+// NewGetDoubleSignsCmd returns a new GetDoubleSignsCmd which can be used to
+// issue a getdoublesigns JSON-RPC command.  This command is not a standard
+// command. It is an extension for prova.
+func NewGetDoubleSignsCmd() *GetDoubleSignsCmd {
+	return &GetDoubleSignsCmd{}
+}
+
+// GetErrorStatsCmd defines the geterrorstats JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetErrorStatsCmd struct{}
+
+// NewGetErrorStatsCmd returns a new GetErrorStatsCmd which can be used to issue
+// a geterrorstats JSON-RPC command.  This command is not a standard command. It
+// is an extension for prova.
+func NewGetErrorStatsCmd() *GetErrorStatsCmd {
+	return &GetErrorStatsCmd{}
+}
+
+// GetJobStatusCmd defines the getjobstatus JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetJobStatusCmd struct {
+	ID string
+}
+
+// NewGetJobStatusCmd returns a new GetJobStatusCmd which can be used to issue a
+// getjobstatus JSON-RPC command.  This command is not a standard command. It is
+// an extension for prova.
+func NewGetJobStatusCmd(id string) *GetJobStatusCmd {
+	return &GetJobStatusCmd{
+		ID: id,
+	}
+}
+
+// GetMempoolSnapshotCmd defines the getmempoolsnapshot JSON-RPC command.  This
+// command is not a standard command, it is an extension for operating prova.
+type GetMempoolSnapshotCmd struct {
+	IncludeRawTx *bool `jsonrpcdefault:"false"`
+}
+
+// NewGetMempoolSnapshotCmd returns a new GetMempoolSnapshotCmd which can be
+// used to issue a getmempoolsnapshot JSON-RPC command.  This command is not a
+// standard command. It is an extension for prova.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetMempoolSnapshotCmd(includeRawTx *bool) *GetMempoolSnapshotCmd {
+	return &GetMempoolSnapshotCmd{
+		IncludeRawTx: includeRawTx,
+	}
+}
+
+// GetNextKeyIDCmd defines the getnextkeyid JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetNextKeyIDCmd struct{}
+
+// NewGetNextKeyIDCmd returns a new GetNextKeyIDCmd which can be used to issue
+// a getnextkeyid JSON-RPC command.  This command is not a standard command. It
+// is an extension for prova.
+func NewGetNextKeyIDCmd() *GetNextKeyIDCmd {
+	return &GetNextKeyIDCmd{}
+}
+
+// GetPeerStatsCmd defines the getpeerstats JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetPeerStatsCmd struct {
+	SortBy *string `jsonrpcdefault:"\"lastconnected\""`
+	Count  *int
+}
+
+// NewGetPeerStatsCmd returns a new GetPeerStatsCmd which can be used to issue a
+// getpeerstats JSON-RPC command.  This command is not a standard command. It
+// is an extension for prova.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetPeerStatsCmd(sortBy *string, count *int) *GetPeerStatsCmd {
+	return &GetPeerStatsCmd{
+		SortBy: sortBy,
+		Count:  count,
+	}
+}
+
+// GetPolicyInfoCmd defines the getpolicyinfo JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetPolicyInfoCmd struct{}
+
+// NewGetPolicyInfoCmd returns a new GetPolicyInfoCmd which can be used to issue
+// a getpolicyinfo JSON-RPC command.  This command is not a standard command. It
+// is an extension for prova.
+func NewGetPolicyInfoCmd() *GetPolicyInfoCmd {
+	return &GetPolicyInfoCmd{}
+}
+
+// GetProcessingJournalCmd defines the getprocessingjournal JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetProcessingJournalCmd struct {
+	Count *int
+}
+
+// NewGetProcessingJournalCmd returns a new GetProcessingJournalCmd which can be
+// used to issue a getprocessingjournal JSON-RPC command.  This command is not a
+// standard command. It is an extension for prova.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetProcessingJournalCmd(count *int) *GetProcessingJournalCmd {
+	return &GetProcessingJournalCmd{
+		Count: count,
+	}
+}
+
+// GetRejectSummaryCmd defines the getrejectsummary JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetRejectSummaryCmd struct{}
+
+// NewGetRejectSummaryCmd returns a new GetRejectSummaryCmd which can be used to
+// issue a getrejectsummary JSON-RPC command.  This command is not a standard
+// command. It is an extension for prova.
+func NewGetRejectSummaryCmd() *GetRejectSummaryCmd {
+	return &GetRejectSummaryCmd{}
+}
+
+// GetRPCInfoCmd defines the getrpcinfo JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetRPCInfoCmd struct{}
+
+// NewGetRPCInfoCmd returns a new GetRPCInfoCmd which can be used to issue a
+// getrpcinfo JSON-RPC command.  This command is not a standard command. It is
+// an extension for prova.
+func NewGetRPCInfoCmd() *GetRPCInfoCmd {
+	return &GetRPCInfoCmd{}
+}
+
+// GetScrubStatusCmd defines the getscrubstatus JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetScrubStatusCmd struct{}
+
+// NewGetScrubStatusCmd returns a new GetScrubStatusCmd which can be used to
+// issue a getscrubstatus JSON-RPC command.  This command is not a standard
+// command. It is an extension for prova.
+func NewGetScrubStatusCmd() *GetScrubStatusCmd {
+	return &GetScrubStatusCmd{}
+}
+
+// GetStatsHistoryCmd defines the getstatshistory JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetStatsHistoryCmd struct {
+	Start *int64
+	End   *int64
+	Step  *int64
+}
+
+// NewGetStatsHistoryCmd returns a new GetStatsHistoryCmd which can be used to
+// issue a getstatshistory JSON-RPC command.  This command is not a standard
+// command. It is an extension for prova.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetStatsHistoryCmd(start, end, step *int64) *GetStatsHistoryCmd {
+	return &GetStatsHistoryCmd{
+		Start: start,
+		End:   end,
+		Step:  step,
+	}
+}
+
+// GetThreadInfoCmd defines the getthreadinfo JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type GetThreadInfoCmd struct{}
+
+// NewGetThreadInfoCmd returns a new GetThreadInfoCmd which can be used to
+// issue a getthreadinfo JSON-RPC command.  This command is not a standard
+// command. It is an extension for prova.
+func NewGetThreadInfoCmd() *GetThreadInfoCmd {
+	return &GetThreadInfoCmd{}
+}
+
+// BanListEntry describes a banned subnet in the ban list returned by the
+// exportbanlist command and passed to the importbanlist command.  The times
+// are Unix timestamps.
+type BanListEntry struct {
+	Subnet  string `json:"subnet"`
+	Reason  string `json:"reason,omitempty"`
+	Created int64  `json:"created"`
+	Expires int64  `json:"expires"`
+}
+
+// ImportBanListCmd defines the importbanlist JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type ImportBanListCmd struct {
+	Entries []BanListEntry
+}
+
+// NewImportBanListCmd returns a new ImportBanListCmd which can be used to issue
+// an importbanlist JSON-RPC command.  This command is not a standard command.
+// It is an extension for prova.
+func NewImportBanListCmd(entries []BanListEntry) *ImportBanListCmd {
+	return &ImportBanListCmd{
+		Entries: entries,
+	}
+}
+
+// IssueWSTokenCmd defines the issuewstoken JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type IssueWSTokenCmd struct {
+	Notifications []string
+	Methods       *[]string
+	Expires       *int64
+}
+
+// NewIssueWSTokenCmd returns a new IssueWSTokenCmd which can be used to issue
+// an issuewstoken JSON-RPC command.  This command is not a standard command.
+// It is an extension for prova.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewIssueWSTokenCmd(notifications []string, methods *[]string, expires *int64) *IssueWSTokenCmd {
+	return &IssueWSTokenCmd{
+		Notifications: notifications,
+		Methods:       methods,
+		Expires:       expires,
+	}
+}
+
+// ListWatchCmd defines the listwatch JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type ListWatchCmd struct{}
+
+// NewListWatchCmd returns a new ListWatchCmd which can be used to issue a
+// listwatch JSON-RPC command.  This command is not a standard command. It is
+// an extension for prova.
+func NewListWatchCmd() *ListWatchCmd {
+	return &ListWatchCmd{}
+}
+
+// ListWSTokensCmd defines the listwstokens JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type ListWSTokensCmd struct{}
+
+// NewListWSTokensCmd returns a new ListWSTokensCmd which can be used to issue a
+// listwstokens JSON-RPC command.  This command is not a standard command. It
+// is an extension for prova.
+func NewListWSTokensCmd() *ListWSTokensCmd {
+	return &ListWSTokensCmd{}
+}
+
+// ListUnspentByAddressCmd defines the listunspentbyaddress JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type ListUnspentByAddressCmd struct {
+	Addresses           []string
+	KeyIDs              *[]uint32
+	MinConf             *int `jsonrpcdefault:"1"`
+	MaxConf             *int `jsonrpcdefault:"9999999"`
+	Amount              *float64
+	LargestFirst        *bool `jsonrpcdefault:"false"`
+	ExcludeMempoolSpent *bool `jsonrpcdefault:"false"`
+}
+
+// NewListUnspentByAddressCmd returns a new ListUnspentByAddressCmd which can be
+// used to issue a listunspentbyaddress JSON-RPC command.  This command is not a
+// standard command. It is an extension for prova.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewListUnspentByAddressCmd(addresses []string, keyIDs *[]uint32, minConf, maxConf *int, amount *float64, largestFirst, excludeMempoolSpent *bool) *ListUnspentByAddressCmd {
+	return &ListUnspentByAddressCmd{
+		Addresses:           addresses,
+		KeyIDs:              keyIDs,
+		MinConf:             minConf,
+		MaxConf:             maxConf,
+		Amount:              amount,
+		LargestFirst:        largestFirst,
+		ExcludeMempoolSpent: excludeMempoolSpent,
+	}
+}
+
+// RemoveWatchCmd defines the removewatch JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type RemoveWatchCmd struct {
+	Addresses []string
+	KeyIDs    *[]uint32
+}
+
+// NewRemoveWatchCmd returns a new RemoveWatchCmd which can be used to issue a
+// removewatch JSON-RPC command.  This command is not a standard command. It is
+// an extension for prova.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewRemoveWatchCmd(addresses []string, keyIDs *[]uint32) *RemoveWatchCmd {
+	return &RemoveWatchCmd{
+		Addresses: addresses,
+		KeyIDs:    keyIDs,
+	}
+}
+
+// ResetErrorStatsCmd defines the reseterrorstats JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type ResetErrorStatsCmd struct{}
+
+// NewResetErrorStatsCmd returns a new ResetErrorStatsCmd which can be used to
+// issue a reseterrorstats JSON-RPC command.  This command is not a standard
+// command. It is an extension for prova.
+func NewResetErrorStatsCmd() *ResetErrorStatsCmd {
+	return &ResetErrorStatsCmd{}
+}
+
+// RevokeWSTokenCmd defines the revokewstoken JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type RevokeWSTokenCmd struct {
+	ID string
+}
+
+// NewRevokeWSTokenCmd returns a new RevokeWSTokenCmd which can be used to issue
+// a revokewstoken JSON-RPC command.  This command is not a standard command.
+// It is an extension for prova.
+func NewRevokeWSTokenCmd(id string) *RevokeWSTokenCmd {
+	return &RevokeWSTokenCmd{
+		ID: id,
+	}
+}
+
+// SetBanSubCmd defines the type used in the setban JSON-RPC command for the
+// sub command field.
+type SetBanSubCmd string
+
+const (
+	// SBAdd indicates the specified subnet should be banned.
+	SBAdd SetBanSubCmd = "add"
+
+	// SBRemove indicates the ban of the specified subnet should be lifted.
+	SBRemove SetBanSubCmd = "remove"
+)
+
+// SetBanCmd defines the setban JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type SetBanCmd struct {
+	Subnet   string
+	SubCmd   SetBanSubCmd `jsonrpcusage:"\"add|remove\""`
+	BanTime  *int64       `jsonrpcdefault:"0"`
+	Absolute *bool        `jsonrpcdefault:"false"`
+	Reason   *string
+}
+
+// NewSetBanCmd returns a new SetBanCmd which can be used to issue a setban
+// JSON-RPC command.  This command is not a standard command. It is an
+// extension for prova.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewSetBanCmd(subnet string, subCmd SetBanSubCmd, banTime *int64, absolute *bool, reason *string) *SetBanCmd {
+	return &SetBanCmd{
+		Subnet:   subnet,
+		SubCmd:   subCmd,
+		BanTime:  banTime,
+		Absolute: absolute,
+		Reason:   reason,
+	}
+}
+
+// SetPeerTraceCmd defines the setpeertrace JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type SetPeerTraceCmd struct {
+	ID     int32
+	Enable bool
+}
+
+// NewSetPeerTraceCmd returns a new SetPeerTraceCmd which can be used to issue a
+// setpeertrace JSON-RPC command.  This command is not a standard command. It is
+// an extension for prova.
+func NewSetPeerTraceCmd(id int32, enable bool) *SetPeerTraceCmd {
+	return &SetPeerTraceCmd{
+		ID:     id,
+		Enable: enable,
+	}
+}
+
+// SimulateAdminTxCmd defines the simulateadmintx JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type SimulateAdminTxCmd struct {
+	HexTxs []string
+}
+
+// NewSimulateAdminTxCmd returns a new SimulateAdminTxCmd which can be used to
+// issue a simulateadmintx JSON-RPC command.  This command is not a standard
+// command. It is an extension for prova.
+func NewSimulateAdminTxCmd(hexTxs []string) *SimulateAdminTxCmd {
+	return &SimulateAdminTxCmd{
+		HexTxs: hexTxs,
+	}
+}
+
+// StartJobCmd defines the startjob JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type StartJobCmd struct {
+	Method string
+	Params *[]interface{}
+}
+
+// NewStartJobCmd returns a new StartJobCmd which can be used to issue a
+// startjob JSON-RPC command.  This command is not a standard command. It is an
+// extension for prova.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewStartJobCmd(method string, params *[]interface{}) *StartJobCmd {
+	return &StartJobCmd{
+		Method: method,
+		Params: params,
+	}
+}
+
 func init() {
 	// No special flags for commands in this file.
 	flags := UsageFlag(0)
 
+	MustRegisterCmd("addwatch", (*AddWatchCmd)(nil), flags)
+	MustRegisterCmd("backupchainstate", (*BackupChainStateCmd)(nil), flags)
+	MustRegisterCmd("canceljob", (*CancelJobCmd)(nil), flags)
+	MustRegisterCmd("decodeblock", (*DecodeBlockCmd)(nil), flags)
+	MustRegisterCmd("exportbanlist", (*ExportBanListCmd)(nil), flags)
+	MustRegisterCmd("exportchaindata", (*ExportChainDataCmd)(nil), flags)
+	MustRegisterCmd("getaddrmaninfo", (*GetAddrManInfoCmd)(nil), flags)
+	MustRegisterCmd("getadminproof", (*GetAdminProofCmd)(nil), flags)
+	MustRegisterCmd("getblockadminops", (*GetBlockAdminOpsCmd)(nil), flags)
+	MustRegisterCmd("getblockcommitment", (*GetBlockCommitmentCmd)(nil), flags)
+	MustRegisterCmd("getblockproductioninfo", (*GetBlockProductionInfoCmd)(nil), flags)
+	MustRegisterCmd("getbroadcaststatus", (*GetBroadcastStatusCmd)(nil), flags)
+	MustRegisterCmd("getchainparams", (*GetChainParamsCmd)(nil), flags)
+	MustRegisterCmd("getchainsplitinfo", (*GetChainSplitInfoCmd)(nil), flags)
+	MustRegisterCmd("getdoublesigns", (*GetDoubleSignsCmd)(nil), flags)
+	MustRegisterCmd("geterrorstats", (*GetErrorStatsCmd)(nil), flags)
+	MustRegisterCmd("getjobstatus", (*GetJobStatusCmd)(nil), flags)
+	MustRegisterCmd("getmempoolsnapshot", (*GetMempoolSnapshotCmd)(nil), flags)
+	MustRegisterCmd("getnextkeyid", (*GetNextKeyIDCmd)(nil), flags)
+	MustRegisterCmd("getpeerstats", (*GetPeerStatsCmd)(nil), flags)
+	MustRegisterCmd("getpolicyinfo", (*GetPolicyInfoCmd)(nil), flags)
+	MustRegisterCmd("getprocessingjournal", (*GetProcessingJournalCmd)(nil), flags)
+	MustRegisterCmd("getrejectsummary", (*GetRejectSummaryCmd)(nil), flags)
+	MustRegisterCmd("getrpcinfo", (*GetRPCInfoCmd)(nil), flags)
+	MustRegisterCmd("getscrubstatus", (*GetScrubStatusCmd)(nil), flags)
+	MustRegisterCmd("getstatshistory", (*GetStatsHistoryCmd)(nil), flags)
+	MustRegisterCmd("getthreadinfo", (*GetThreadInfoCmd)(nil), flags)
+	MustRegisterCmd("importbanlist", (*ImportBanListCmd)(nil), flags)
+	MustRegisterCmd("issuewstoken", (*IssueWSTokenCmd)(nil), flags)
+	MustRegisterCmd("listunspentbyaddress", (*ListUnspentByAddressCmd)(nil), flags)
+	MustRegisterCmd("listwatch", (*ListWatchCmd)(nil), flags)
+	MustRegisterCmd("listwstokens", (*ListWSTokensCmd)(nil), flags)
+	MustRegisterCmd("removewatch", (*RemoveWatchCmd)(nil), flags)
+	MustRegisterCmd("reseterrorstats", (*ResetErrorStatsCmd)(nil), flags)
+	MustRegisterCmd("revokewstoken", (*RevokeWSTokenCmd)(nil), flags)
+	MustRegisterCmd("setban", (*SetBanCmd)(nil), flags)
+	MustRegisterCmd("setpeertrace", (*SetPeerTraceCmd)(nil), flags)
 	MustRegisterCmd("setvalidatekeys", (*SetValidateKeysCmd)(nil), flags)
+	MustRegisterCmd("simulateadmintx", (*SimulateAdminTxCmd)(nil), flags)
+	MustRegisterCmd("startjob", (*StartJobCmd)(nil), flags)
 }
@@ -30,6 +30,584 @@ func TestRmgdExtCmds(t *testing.T) {
 		marshalled   string
 		unmarshalled interface{}
 	}{
+		{
+			name: "addwatch",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("addwatch", []string{"1Address"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewAddWatchCmd([]string{"1Address"}, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"addwatch","params":[["1Address"]],"id":1}`,
+			unmarshalled: &btcjson.AddWatchCmd{
+				Addresses: []string{"1Address"},
+			},
+		},
+		{
+			name: "addwatch optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("addwatch", []string{}, []uint32{1, 2})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewAddWatchCmd([]string{}, &[]uint32{1, 2})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"addwatch","params":[[],[1,2]],"id":1}`,
+			unmarshalled: &btcjson.AddWatchCmd{
+				Addresses: []string{},
+				KeyIDs:    &[]uint32{1, 2},
+			},
+		},
+		{
+			name: "backupchainstate",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("backupchainstate", "backup")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewBackupChainStateCmd("backup")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"backupchainstate","params":["backup"],"id":1}`,
+			unmarshalled: &btcjson.BackupChainStateCmd{
+				Destination: "backup",
+			},
+		},
+		{
+			name: "canceljob",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("canceljob", "abc")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewCancelJobCmd("abc")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"canceljob","params":["abc"],"id":1}`,
+			unmarshalled: &btcjson.CancelJobCmd{
+				ID: "abc",
+			},
+		},
+		{
+			name: "decodeblock",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("decodeblock", "00")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewDecodeBlockCmd("00", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"decodeblock","params":["00"],"id":1}`,
+			unmarshalled: &btcjson.DecodeBlockCmd{
+				HexBlock: "00",
+				Strict:   btcjson.Bool(false),
+			},
+		},
+		{
+			name: "decodeblock strict",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("decodeblock", "00", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewDecodeBlockCmd("00", btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"decodeblock","params":["00",true],"id":1}`,
+			unmarshalled: &btcjson.DecodeBlockCmd{
+				HexBlock: "00",
+				Strict:   btcjson.Bool(true),
+			},
+		},
+		{
+			name: "exportbanlist",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("exportbanlist")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewExportBanListCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"exportbanlist","params":[],"id":1}`,
+			unmarshalled: &btcjson.ExportBanListCmd{},
+		},
+		{
+			name: "exportchaindata",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("exportchaindata", "blocks.csv")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewExportChainDataCmd("blocks.csv", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"exportchaindata","params":["blocks.csv"],"id":1}`,
+			unmarshalled: &btcjson.ExportChainDataCmd{
+				Destination: "blocks.csv",
+				StartHeight: btcjson.Uint32(0),
+			},
+		},
+		{
+			name: "exportchaindata optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("exportchaindata", "blocks.csv", 1000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewExportChainDataCmd("blocks.csv",
+					btcjson.Uint32(1000))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"exportchaindata","params":["blocks.csv",1000],"id":1}`,
+			unmarshalled: &btcjson.ExportChainDataCmd{
+				Destination: "blocks.csv",
+				StartHeight: btcjson.Uint32(1000),
+			},
+		},
+		{
+			name: "getaddrmaninfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddrmaninfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddrManInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getaddrmaninfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetAddrManInfoCmd{},
+		},
+		{
+			name: "getadminproof",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getadminproof", 123)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAdminProofCmd(123)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getadminproof","params":[123],"id":1}`,
+			unmarshalled: &btcjson.GetAdminProofCmd{
+				Height: 123,
+			},
+		},
+		{
+			name: "getblockadminops",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockadminops", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockAdminOpsCmd("123")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockadminops","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.GetBlockAdminOpsCmd{
+				Hash: "123",
+			},
+		},
+		{
+			name: "getblockcommitment",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockcommitment", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockCommitmentCmd("123")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockcommitment","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.GetBlockCommitmentCmd{
+				Hash: "123",
+			},
+		},
+		{
+			name: "getblockproductioninfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockproductioninfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockProductionInfoCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockproductioninfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetBlockProductionInfoCmd{
+				Blocks: btcjson.Int(120),
+			},
+		},
+		{
+			name: "getblockproductioninfo optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockproductioninfo", 500)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockProductionInfoCmd(btcjson.Int(500))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockproductioninfo","params":[500],"id":1}`,
+			unmarshalled: &btcjson.GetBlockProductionInfoCmd{
+				Blocks: btcjson.Int(500),
+			},
+		},
+		{
+			name: "getbroadcaststatus",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getbroadcaststatus", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBroadcastStatusCmd("123")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getbroadcaststatus","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.GetBroadcastStatusCmd{
+				Hash: "123",
+			},
+		},
+		{
+			name: "getchainparams",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getchainparams")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetChainParamsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getchainparams","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetChainParamsCmd{},
+		},
+		{
+			name: "getchainsplitinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getchainsplitinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetChainSplitInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getchainsplitinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetChainSplitInfoCmd{},
+		},
+		{
+			name: "getdoublesigns",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getdoublesigns")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetDoubleSignsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getdoublesigns","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetDoubleSignsCmd{},
+		},
+		{
+			name: "geterrorstats",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("geterrorstats")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetErrorStatsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"geterrorstats","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetErrorStatsCmd{},
+		},
+		{
+			name: "getjobstatus",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getjobstatus", "abc")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetJobStatusCmd("abc")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getjobstatus","params":["abc"],"id":1}`,
+			unmarshalled: &btcjson.GetJobStatusCmd{
+				ID: "abc",
+			},
+		},
+		{
+			name: "getmempoolsnapshot",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempoolsnapshot")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolSnapshotCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolsnapshot","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolSnapshotCmd{
+				IncludeRawTx: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "getmempoolsnapshot optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempoolsnapshot", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolSnapshotCmd(btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolsnapshot","params":[true],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolSnapshotCmd{
+				IncludeRawTx: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "getnextkeyid",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getnextkeyid")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetNextKeyIDCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getnextkeyid","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetNextKeyIDCmd{},
+		},
+		{
+			name: "getpeerstats",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getpeerstats")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetPeerStatsCmd(nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getpeerstats","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetPeerStatsCmd{
+				SortBy: btcjson.String("lastconnected"),
+			},
+		},
+		{
+			name: "getpeerstats optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getpeerstats", "bytesrecv", 10)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetPeerStatsCmd(
+					btcjson.String("bytesrecv"), btcjson.Int(10))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getpeerstats","params":["bytesrecv",10],"id":1}`,
+			unmarshalled: &btcjson.GetPeerStatsCmd{
+				SortBy: btcjson.String("bytesrecv"),
+				Count:  btcjson.Int(10),
+			},
+		},
+		{
+			name: "getpolicyinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getpolicyinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetPolicyInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getpolicyinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetPolicyInfoCmd{},
+		},
+		{
+			name: "getprocessingjournal",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getprocessingjournal")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetProcessingJournalCmd(nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getprocessingjournal","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetProcessingJournalCmd{},
+		},
+		{
+			name: "getprocessingjournal optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getprocessingjournal", 20)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetProcessingJournalCmd(btcjson.Int(20))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getprocessingjournal","params":[20],"id":1}`,
+			unmarshalled: &btcjson.GetProcessingJournalCmd{
+				Count: btcjson.Int(20),
+			},
+		},
+		{
+			name: "getrejectsummary",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getrejectsummary")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetRejectSummaryCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getrejectsummary","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetRejectSummaryCmd{},
+		},
+		{
+			name: "getrpcinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getrpcinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetRPCInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getrpcinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetRPCInfoCmd{},
+		},
+		{
+			name: "getscrubstatus",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getscrubstatus")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetScrubStatusCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getscrubstatus","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetScrubStatusCmd{},
+		},
+		{
+			name: "getstatshistory",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getstatshistory")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetStatsHistoryCmd(nil, nil, nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getstatshistory","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetStatsHistoryCmd{},
+		},
+		{
+			name: "getstatshistory optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getstatshistory", 1500000000,
+					1500086400, 3600)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetStatsHistoryCmd(
+					btcjson.Int64(1500000000),
+					btcjson.Int64(1500086400), btcjson.Int64(3600))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getstatshistory","params":[1500000000,1500086400,3600],"id":1}`,
+			unmarshalled: &btcjson.GetStatsHistoryCmd{
+				Start: btcjson.Int64(1500000000),
+				End:   btcjson.Int64(1500086400),
+				Step:  btcjson.Int64(3600),
+			},
+		},
+		{
+			name: "getthreadinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getthreadinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetThreadInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getthreadinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetThreadInfoCmd{},
+		},
+		{
+			name: "listunspentbyaddress",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listunspentbyaddress",
+					[]string{"1Address"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListUnspentByAddressCmd(
+					[]string{"1Address"}, nil, nil, nil, nil, nil,
+					nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"listunspentbyaddress","params":[["1Address"]],"id":1}`,
+			unmarshalled: &btcjson.ListUnspentByAddressCmd{
+				Addresses:           []string{"1Address"},
+				MinConf:             btcjson.Int(1),
+				MaxConf:             btcjson.Int(9999999),
+				LargestFirst:        btcjson.Bool(false),
+				ExcludeMempoolSpent: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "listunspentbyaddress optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listunspentbyaddress",
+					[]string{}, []uint32{1, 2}, 6, 100, 1.5, true,
+					true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListUnspentByAddressCmd([]string{},
+					&[]uint32{1, 2}, btcjson.Int(6),
+					btcjson.Int(100), btcjson.Float64(1.5),
+					btcjson.Bool(true), btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"listunspentbyaddress","params":[[],[1,2],6,100,1.5,true,true],"id":1}`,
+			unmarshalled: &btcjson.ListUnspentByAddressCmd{
+				Addresses:           []string{},
+				KeyIDs:              &[]uint32{1, 2},
+				MinConf:             btcjson.Int(6),
+				MaxConf:             btcjson.Int(100),
+				Amount:              btcjson.Float64(1.5),
+				LargestFirst:        btcjson.Bool(true),
+				ExcludeMempoolSpent: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "importbanlist",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("importbanlist",
+					`[{"subnet":"10.0.0.0/8","reason":"abuse","created":1500000000,"expires":1600000000}]`)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewImportBanListCmd([]btcjson.BanListEntry{{
+					Subnet:  "10.0.0.0/8",
+					Reason:  "abuse",
+					Created: 1500000000,
+					Expires: 1600000000,
+				}})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"importbanlist","params":[[{"subnet":"10.0.0.0/8","reason":"abuse","created":1500000000,"expires":1600000000}]],"id":1}`,
+			unmarshalled: &btcjson.ImportBanListCmd{
+				Entries: []btcjson.BanListEntry{{
+					Subnet:  "10.0.0.0/8",
+					Reason:  "abuse",
+					Created: 1500000000,
+					Expires: 1600000000,
+				}},
+			},
+		},
+		{
+			name: "issuewstoken",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("issuewstoken", []string{"blocks"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewIssueWSTokenCmd([]string{"blocks"},
+					nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"issuewstoken","params":[["blocks"]],"id":1}`,
+			unmarshalled: &btcjson.IssueWSTokenCmd{
+				Notifications: []string{"blocks"},
+			},
+		},
+		{
+			name: "issuewstoken optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("issuewstoken",
+					[]string{"blocks", "spent"},
+					[]string{"getbestblock"}, 1500000000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewIssueWSTokenCmd(
+					[]string{"blocks", "spent"},
+					&[]string{"getbestblock"},
+					btcjson.Int64(1500000000))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"issuewstoken","params":[["blocks","spent"],["getbestblock"],1500000000],"id":1}`,
+			unmarshalled: &btcjson.IssueWSTokenCmd{
+				Notifications: []string{"blocks", "spent"},
+				Methods:       &[]string{"getbestblock"},
+				Expires:       btcjson.Int64(1500000000),
+			},
+		},
+		{
+			name: "listwatch",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listwatch")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListWatchCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"listwatch","params":[],"id":1}`,
+			unmarshalled: &btcjson.ListWatchCmd{},
+		},
+		{
+			name: "listwstokens",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listwstokens")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListWSTokensCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"listwstokens","params":[],"id":1}`,
+			unmarshalled: &btcjson.ListWSTokensCmd{},
+		},
+		{
+			name: "removewatch",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("removewatch", []string{"1Address"}, []uint32{3})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewRemoveWatchCmd([]string{"1Address"}, &[]uint32{3})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"removewatch","params":[["1Address"],[3]],"id":1}`,
+			unmarshalled: &btcjson.RemoveWatchCmd{
+				Addresses: []string{"1Address"},
+				KeyIDs:    &[]uint32{3},
+			},
+		},
 		{
 			name: "setvalidatekeys",
 			newCmd: func() (interface{}, error) {
@@ -43,6 +621,125 @@ func TestRmgdExtCmds(t *testing.T) {
 				PrivKeys: []string{"1234"},
 			},
 		},
+		{
+			name: "setban",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setban", "10.0.0.0/8", "add")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetBanCmd("10.0.0.0/8", btcjson.SBAdd,
+					nil, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setban","params":["10.0.0.0/8","add"],"id":1}`,
+			unmarshalled: &btcjson.SetBanCmd{
+				Subnet:   "10.0.0.0/8",
+				SubCmd:   btcjson.SBAdd,
+				BanTime:  btcjson.Int64(0),
+				Absolute: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "setban optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setban", "2001:db8::/32", "add",
+					1600000000, true, "abuse")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetBanCmd("2001:db8::/32", btcjson.SBAdd,
+					btcjson.Int64(1600000000), btcjson.Bool(true),
+					btcjson.String("abuse"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setban","params":["2001:db8::/32","add",1600000000,true,"abuse"],"id":1}`,
+			unmarshalled: &btcjson.SetBanCmd{
+				Subnet:   "2001:db8::/32",
+				SubCmd:   btcjson.SBAdd,
+				BanTime:  btcjson.Int64(1600000000),
+				Absolute: btcjson.Bool(true),
+				Reason:   btcjson.String("abuse"),
+			},
+		},
+		{
+			name: "setpeertrace",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setpeertrace", 3, true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetPeerTraceCmd(3, true)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setpeertrace","params":[3,true],"id":1}`,
+			unmarshalled: &btcjson.SetPeerTraceCmd{
+				ID:     3,
+				Enable: true,
+			},
+		},
+		{
+			name: "revokewstoken",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("revokewstoken", "0123456789abcdef")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewRevokeWSTokenCmd("0123456789abcdef")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"revokewstoken","params":["0123456789abcdef"],"id":1}`,
+			unmarshalled: &btcjson.RevokeWSTokenCmd{
+				ID: "0123456789abcdef",
+			},
+		},
+		{
+			name: "reseterrorstats",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("reseterrorstats")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewResetErrorStatsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"reseterrorstats","params":[],"id":1}`,
+			unmarshalled: &btcjson.ResetErrorStatsCmd{},
+		},
+		{
+			name: "simulateadmintx",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("simulateadmintx",
+					[]string{"0100", "0200"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSimulateAdminTxCmd(
+					[]string{"0100", "0200"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"simulateadmintx","params":[["0100","0200"]],"id":1}`,
+			unmarshalled: &btcjson.SimulateAdminTxCmd{
+				HexTxs: []string{"0100", "0200"},
+			},
+		},
+		{
+			name: "startjob",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("startjob", "verifychain")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStartJobCmd("verifychain", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"startjob","params":["verifychain"],"id":1}`,
+			unmarshalled: &btcjson.StartJobCmd{
+				Method: "verifychain",
+			},
+		},
+		{
+			name: "startjob optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("startjob", "verifychain",
+					[]interface{}{1, 100})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStartJobCmd("verifychain",
+					&[]interface{}{1, 100})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"startjob","params":["verifychain",[1,100]],"id":1}`,
+			unmarshalled: &btcjson.StartJobCmd{
+				Method: "verifychain",
+				Params: &[]interface{}{float64(1), float64(100)},
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -0,0 +1,134 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+)
+
+const (
+	// backupManifestName is the name of the manifest file written to the
+	// destination directory of a chain state backup.
+	backupManifestName = "manifest.json"
+
+	// backupManifestVersion is the current version of the manifest of a
+	// chain state backup.
+	backupManifestVersion = 1
+)
+
+// backupManifestFile describes a single file of a chain state backup.
+type backupManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// backupManifest describes a chain state backup.  It is written to the
+// destination directory once all of the database files have been written, so
+// a backup without a manifest is incomplete.
+type backupManifest struct {
+	Version int                  `json:"version"`
+	Network string               `json:"network"`
+	DbType  string               `json:"dbtype"`
+	Time    int64                `json:"time"`
+	Hash    string               `json:"hash"`
+	Height  uint32               `json:"height"`
+	Files   []backupManifestFile `json:"files"`
+}
+
+// errBackupDestination describes an error due to an invalid chain state backup
+// destination, as opposed to a failure of the backup itself.
+type errBackupDestination string
+
+// Error implements the error interface.
+func (e errBackupDestination) Error() string {
+	return string(e)
+}
+
+// backupChainState writes a backup of the block database as of the current
+// best chain state to the passed destination directory, which must not exist.
+// Relative destinations are relative to the data directory.  The database is
+// written to a subdirectory named the same as the database directory in the
+// data directory, and a manifest listing the best chain state and the
+// checksums of all files is written alongside it.
+func backupChainState(bm *blockManager, dest string) (*btcjson.BackupChainStateResult, error) {
+	if dest == "" {
+		return nil, errBackupDestination("backup destination must be " +
+			"specified")
+	}
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(cfg.DataDir, dest)
+	}
+	dest = filepath.Clean(dest)
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		str := fmt.Sprintf("backup destination %q already exists", dest)
+		return nil, errBackupDestination(str)
+	}
+
+	start := time.Now()
+	backup, best, pause, err := bm.BeginBackup()
+	if err != nil {
+		return nil, err
+	}
+	defer backup.Release()
+	bmgrLog.Infof("Backing up chain state at height %d (hash %s) to %s, "+
+		"block processing was paused for %v", best.Height, best.Hash,
+		dest, pause)
+
+	dbDir := filepath.Base(blockDbPath(cfg.DbType))
+	files, err := backup.Write(filepath.Join(dest, dbDir))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := backupManifest{
+		Version: backupManifestVersion,
+		Network: activeNetParams.Name,
+		DbType:  cfg.DbType,
+		Time:    start.Unix(),
+		Hash:    best.Hash.String(),
+		Height:  best.Height,
+		Files:   make([]backupManifestFile, 0, len(files)),
+	}
+	var totalBytes int64
+	for _, file := range files {
+		manifest.Files = append(manifest.Files, backupManifestFile{
+			Path:   filepath.ToSlash(filepath.Join(dbDir, file.Path)),
+			Size:   file.Size,
+			SHA256: hex.EncodeToString(file.SHA256[:]),
+		})
+		totalBytes += file.Size
+	}
+	serialized, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	manifestPath := filepath.Join(dest, backupManifestName)
+	if err := ioutil.WriteFile(manifestPath, serialized, 0600); err != nil {
+		return nil, err
+	}
+
+	elapsed := time.Since(start)
+	bmgrLog.Infof("Backed up %d files (%d bytes) to %s in %v", len(files),
+		totalBytes, dest, elapsed)
+	return &btcjson.BackupChainStateResult{
+		Destination:  dest,
+		Manifest:     manifestPath,
+		Hash:         manifest.Hash,
+		Height:       best.Height,
+		Files:        len(files),
+		Bytes:        totalBytes,
+		PauseSeconds: pause.Seconds(),
+		Seconds:      elapsed.Seconds(),
+	}, nil
+}
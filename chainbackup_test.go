@@ -0,0 +1,173 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+)
+
+// TestBackupChainState ensures a backup of the chain state of a node which is
+// processing blocks contains the best chain state reported by the
+// backupchainstate command along with a manifest whose checksums match the
+// backup, and that the backup can be opened as a block database.
+func TestBackupChainState(t *testing.T) {
+	defer func(c *config, p *params) {
+		cfg = c
+		activeNetParams = p
+	}(cfg, activeNetParams)
+	activeNetParams = &regressionNetParams
+	chainParams := activeNetParams.Params
+
+	tmpDir, err := ioutil.TempDir("", "chainbackup")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cfg = newTestConfig(tmpDir)
+	db, err := database.Create("ffldb", blockDbPath(cfg.DbType),
+		chainParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+	s, err := newServer(nil, db, chainParams)
+	if err != nil {
+		t.Fatalf("newServer: unexpected error: %v", err)
+	}
+	s.blockManager.Start()
+	defer s.blockManager.Stop()
+	rpcServer := &rpcServer{server: s}
+
+	// Generate blocks on top of the chain of the node.
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	h.generator = h.newGenerator(s.blockManager.chain)
+	processBlocks := func(n int) {
+		for i := 0; i < n; i++ {
+			block := provautil.NewBlock(h.generateBlock(t))
+			_, _, err := s.blockManager.ProcessBlock(block,
+				blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock: unexpected error: %v", err)
+			}
+		}
+	}
+	processBlocks(5)
+
+	// Back up the chain state while more blocks are processed.
+	type backupResult struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan backupResult, 1)
+	go func() {
+		result, err := handleBackupChainState(rpcServer,
+			btcjson.NewBackupChainStateCmd("backup"), nil)
+		done <- backupResult{result, err}
+	}()
+	processBlocks(5)
+	backup := <-done
+	if backup.err != nil {
+		t.Fatalf("handleBackupChainState: unexpected error: %v",
+			backup.err)
+	}
+	result := backup.result.(*btcjson.BackupChainStateResult)
+	if result.Destination != filepath.Join(tmpDir, "backup") {
+		t.Errorf("got destination %q, want %q", result.Destination,
+			filepath.Join(tmpDir, "backup"))
+	}
+	if result.Height < 5 || result.Height > 10 {
+		t.Errorf("got height %d, want between 5 and 10", result.Height)
+	}
+	if result.PauseSeconds <= 0 || result.PauseSeconds > result.Seconds {
+		t.Errorf("got pause of %vs for a backup of %vs",
+			result.PauseSeconds, result.Seconds)
+	}
+
+	// The manifest describes the best chain state and the checksum of
+	// every file of the backup.
+	serialized, err := ioutil.ReadFile(result.Manifest)
+	if err != nil {
+		t.Fatalf("unable to read manifest: %v", err)
+	}
+	var manifest backupManifest
+	if err := json.Unmarshal(serialized, &manifest); err != nil {
+		t.Fatalf("unable to parse manifest: %v", err)
+	}
+	if manifest.Network != "regtest" || manifest.DbType != "ffldb" ||
+		manifest.Hash != result.Hash || manifest.Height != result.Height {
+
+		t.Errorf("unexpected manifest %+v for result %+v", manifest,
+			result)
+	}
+	if len(manifest.Files) != result.Files || result.Files == 0 {
+		t.Fatalf("got %d manifest files for %d result files",
+			len(manifest.Files), result.Files)
+	}
+	var totalBytes int64
+	for _, file := range manifest.Files {
+		contents, err := ioutil.ReadFile(filepath.Join(result.Destination,
+			filepath.FromSlash(file.Path)))
+		if err != nil {
+			t.Fatalf("unable to read backup file: %v", err)
+		}
+		sum := sha256.Sum256(contents)
+		if int64(len(contents)) != file.Size ||
+			hex.EncodeToString(sum[:]) != file.SHA256 {
+
+			t.Errorf("backup file %s does not match its manifest "+
+				"entry", file.Path)
+		}
+		totalBytes += file.Size
+	}
+	if totalBytes != result.Bytes {
+		t.Errorf("got %d bytes in manifest, want %d", totalBytes,
+			result.Bytes)
+	}
+
+	// The backup can't overwrite an existing backup.
+	_, err = handleBackupChainState(rpcServer,
+		btcjson.NewBackupChainStateCmd("backup"), nil)
+	if jErr, ok := err.(*btcjson.RPCError); !ok ||
+		jErr.Code != btcjson.ErrRPCInvalidParameter {
+
+		t.Errorf("got error %v for an existing destination, want an "+
+			"invalid parameter error", err)
+	}
+
+	// The backup opens as a block database whose best chain state is the
+	// one reported for the backup.
+	backupDb, err := database.Open("ffldb", filepath.Join(
+		result.Destination, filepath.Base(blockDbPath(cfg.DbType))),
+		chainParams.Net)
+	if err != nil {
+		t.Fatalf("unable to open backup: %v", err)
+	}
+	defer backupDb.Close()
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          backupDb,
+		ChainParams: chainParams,
+		TimeSource:  blockchain.NewMedianTime(),
+	})
+	if err != nil {
+		t.Fatalf("unable to load backup chain: %v", err)
+	}
+	best := chain.BestSnapshot()
+	if best.Hash.String() != result.Hash || best.Height != result.Height {
+		t.Errorf("got backup tip %s at height %d, want %s at height %d",
+			best.Hash, best.Height, result.Hash, result.Height)
+	}
+}
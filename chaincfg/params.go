@@ -160,6 +160,92 @@ type Params struct {
 
 	// Maximum fee allowed in a single transaction, in atoms.
 	MaximumFeeAmount int64
+
+	// MaxBlockTransactions is the maximum number of transactions a block
+	// may contain, including the coinbase.  Blocks are limited to
+	// wire.MaxBlockPayload bytes as well, so a limit of that many
+	// transactions leaves the block size as the only limit.
+	MaxBlockTransactions int
+
+	// StrictMonotonicTime requires each block's timestamp to be strictly
+	// after the timestamp of its parent in addition to the median time
+	// rule.  This keeps block times usable for ordering on signed chains.
+	StrictMonotonicTime bool
+
+	// TimeRegressionWindow is the number of most recent blocks whose
+	// latest timestamp limits how far back the timestamp of the next block
+	// may go.  Signed chains don't have difficulty retargeting pressure
+	// keeping block times honest, so without it a validator could slowly
+	// walk block times backward while staying above the median time.  The
+	// rule is disabled when it is zero.
+	TimeRegressionWindow int
+
+	// MaxTimeRegression is how much earlier than the latest timestamp of
+	// the blocks in the time regression window the timestamp of the next
+	// block may be.
+	MaxTimeRegression time.Duration
+
+	// ScriptVersions allows transaction outputs to carry a script version
+	// and treats outputs with a script version higher than the highest
+	// version with defined semantics as anyone-can-spend, so semantics can
+	// be assigned to the versions by later soft forks.  Such outputs are
+	// not standard and so are never relayed.
+	ScriptVersions bool
+
+	// RejectDoubleSigners treats blocks signed by a validate key which was
+	// seen signing two different blocks at the same height as invalid
+	// until the key is provisioned to the validate key set again.  The
+	// double signs are detected among the blocks each node has seen, so
+	// nodes which saw different blocks may disagree about which blocks are
+	// valid until the key is provisioned again.
+	RejectDoubleSigners bool
+
+	// PowOnly accepts blocks on proof of work alone, without requiring
+	// them to be signed by a validate key, so test networks can be mined
+	// on a CPU.  The block signature, validate key set and validate key
+	// rate limiting rules are skipped entirely.  It must never be set for
+	// the main network.
+	PowOnly bool
+
+	// UpgradableAdminOps accepts admin operations with an op type at or
+	// above txscript.AdminOpUpgradableThreshold which have no defined
+	// semantics, and ignores them when applying admin transactions to the
+	// admin state, so new op types can be assigned by later soft forks.
+	// Unknown op types below the threshold remain invalid.  Such
+	// operations are not standard and so are never relayed.
+	UpgradableAdminOps bool
+
+	// BurnFees allows the coinbase transaction of a block to pay less than
+	// the subsidy and fees of the block, burning the remainder, instead of
+	// requiring it to pay exactly that much.  The burned fees are not
+	// subtracted from the total supply, which only tracks the issue thread.
+	BurnFees bool
+
+	// ReprovisionKeyIDs allows a keyID which has been revoked to be
+	// provisioned again to the ASP key it was bound to.  Otherwise keyIDs
+	// are provisioned in strictly increasing order only, so a revoked keyID
+	// is never used again.  Either way a revoked keyID can never be bound
+	// to a different ASP key, which would change the meaning of the
+	// outputs which referenced it.
+	ReprovisionKeyIDs bool
+
+	// TxExpiry makes transactions of version wire.TxVersionExpiry carry an
+	// expiry height and rejects blocks which include them at or after it.
+	// Since it changes the encoding, and so the hash, of such
+	// transactions, they must be decoded with the protocol version flags
+	// returned by TxEncoding, and it remains disabled on all networks until
+	// its activation is coordinated.
+	TxExpiry bool
+}
+
+// TxEncoding returns the protocol version flags transactions, and blocks, of
+// the network must be decoded with, which is wire.TxExpiryEncoding when the
+// network enables transaction expiry.
+func (p Params) TxEncoding() uint32 {
+	if p.TxExpiry {
+		return wire.TxExpiryEncoding
+	}
+	return 0
 }
 
 // MaxActualTimespan returns a timespan with the down-dampening factor applied.
@@ -279,6 +365,10 @@ var MainNetParams = Params{
 
 	// Maximum fee allowed in a single transaction, in atoms.
 	MaximumFeeAmount: 5000000,
+
+	// Leave the block size as the only limit on the number of
+	// transactions per block.
+	MaxBlockTransactions: wire.MaxBlockPayload,
 }
 
 // RegressionNetParams defines the network parameters for the regression test
@@ -359,6 +449,27 @@ var RegressionNetParams = Params{
 
 	// Maximum fee allowed in a single transaction, in atoms.
 	MaximumFeeAmount: 5000000,
+
+	// Use a low maximum number of transactions per block so the limit
+	// can be tested cheaply.
+	MaxBlockTransactions: 25,
+
+	// Require strictly increasing block timestamps.
+	StrictMonotonicTime: true,
+
+	// Limit block timestamps to at most 5 minutes before the latest
+	// timestamp of the last 11 blocks.
+	TimeRegressionWindow: 11,
+	MaxTimeRegression:    time.Minute * 5,
+
+	// Allow outputs with a script version.
+	ScriptVersions: true,
+
+	// Accept admin operations with op types reserved for later soft forks.
+	UpgradableAdminOps: true,
+
+	// Allow revoked keyIDs to be provisioned again to their ASP keys.
+	ReprovisionKeyIDs: true,
 }
 
 // TestNetParams defines the network parameters for the test network.
@@ -451,6 +562,10 @@ var TestNetParams = Params{
 
 	// Maximum fee allowed in a single transaction, in atoms.
 	MaximumFeeAmount: 5000000,
+
+	// Leave the block size as the only limit on the number of
+	// transactions per block.
+	MaxBlockTransactions: wire.MaxBlockPayload,
 }
 
 // SimNetParams defines the network parameters for the simulation test Bitcoin
@@ -520,6 +635,10 @@ var SimNetParams = Params{
 
 	// Maximum fee allowed in a single transaction, in atoms.
 	MaximumFeeAmount: 5000000,
+
+	// Leave the block size as the only limit on the number of
+	// transactions per block.
+	MaxBlockTransactions: wire.MaxBlockPayload,
 }
 
 var (
@@ -536,6 +655,7 @@ var (
 
 var (
 	registeredNets    = make(map[wire.BitcoinNet]struct{})
+	registeredParams  []*Params
 	pubKeyHashAddrIDs = make(map[byte]struct{})
 	scriptHashAddrIDs = make(map[byte]struct{})
 	provaAddrIDs      = make(map[byte]struct{})
@@ -561,6 +681,7 @@ func Register(params *Params) error {
 		return ErrDuplicateNet
 	}
 	registeredNets[params.Net] = struct{}{}
+	registeredParams = append(registeredParams, params)
 	if params.ProvaAddrID != 0 {
 		provaAddrIDs[params.ProvaAddrID] = struct{}{}
 	}
@@ -576,6 +697,16 @@ func mustRegister(params *Params) {
 	}
 }
 
+// RegisteredNets returns the parameters of the default and registered networks
+// in the order they were registered.  This is used to find the networks an
+// encoded address or key is valid for when it is not valid for the expected
+// one.
+func RegisteredNets() []*Params {
+	nets := make([]*Params, len(registeredParams))
+	copy(nets, registeredParams)
+	return nets
+}
+
 // IsPubKeyHashAddrID returns whether the id is an identifier known to prefix a
 // pay-to-pubkey-hash address on any default or registered network.  This is
 // used when decoding an address string into a specific address type.  It is up
@@ -0,0 +1,353 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chaincfg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/wire"
+)
+
+// dnsSeedJSON is the JSON representation of a DNSSeed.
+type dnsSeedJSON struct {
+	Host         string `json:"host"`
+	HasFiltering bool   `json:"hasfiltering"`
+}
+
+// checkpointJSON is the JSON representation of a Checkpoint.
+type checkpointJSON struct {
+	Height uint32 `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// paramsJSON is the JSON representation of Params.  The fields are serialized
+// in the order they are declared in and the maps are serialized with sorted
+// keys, so the JSON for the same parameters is always identical and can be
+// diffed.
+type paramsJSON struct {
+	Name                     string              `json:"name"`
+	Net                      uint32              `json:"net"`
+	DefaultPort              string              `json:"defaultport"`
+	DNSSeeds                 []dnsSeedJSON       `json:"dnsseeds"`
+	GenesisBlock             string              `json:"genesisblock"`
+	GenesisHash              string              `json:"genesishash"`
+	AdminKeySets             map[string][]string `json:"adminkeysets"`
+	ASPKeyIDs                map[string]string   `json:"aspkeyids"`
+	PowLimit                 string              `json:"powlimit"`
+	PowLimitBits             uint32              `json:"powlimitbits"`
+	CoinbaseMaturity         uint16              `json:"coinbasematurity"`
+	SubsidyReductionInterval uint32              `json:"subsidyreductioninterval"`
+	TargetTimePerBlock       string              `json:"targettimeperblock"`
+	GenerateSupported        bool                `json:"generatesupported"`
+	Checkpoints              []checkpointJSON    `json:"checkpoints"`
+	BlockEnforceNumRequired  uint64              `json:"blockenforcenumrequired"`
+	BlockRejectNumRequired   uint64              `json:"blockrejectnumrequired"`
+	BlockUpgradeNumToCheck   uint64              `json:"blockupgradenumtocheck"`
+	RelayNonStdTxs           bool                `json:"relaynonstdtxs"`
+	ProvaAddrID              byte                `json:"provaaddrid"`
+	PrivateKeyID             byte                `json:"privatekeyid"`
+	HDPrivateKeyID           string              `json:"hdprivatekeyid"`
+	HDPublicKeyID            string              `json:"hdpublickeyid"`
+	HDCoinType               uint32              `json:"hdcointype"`
+	PowAveragingWindow       int                 `json:"powaveragingwindow"`
+	PowMaxAdjustDown         int64               `json:"powmaxadjustdown"`
+	PowMaxAdjustUp           int64               `json:"powmaxadjustup"`
+	ChainTrailingSigKeyLimit int                 `json:"chaintrailingsigkeylimit"`
+	ChainWindowShareLimit    int                 `json:"chainwindowsharelimit"`
+	MaximumFeeAmount         int64               `json:"maximumfeeamount"`
+	MaxBlockTransactions     int                 `json:"maxblocktransactions"`
+	StrictMonotonicTime      bool                `json:"strictmonotonictime"`
+	TimeRegressionWindow     int                 `json:"timeregressionwindow"`
+	MaxTimeRegression        string              `json:"maxtimeregression"`
+	ScriptVersions           bool                `json:"scriptversions"`
+	RejectDoubleSigners      bool                `json:"rejectdoublesigners"`
+	PowOnly                  bool                `json:"powonly"`
+	UpgradableAdminOps       bool                `json:"upgradableadminops"`
+	BurnFees                 bool                `json:"burnfees"`
+	ReprovisionKeyIDs        bool                `json:"reprovisionkeyids"`
+	TxExpiry                 bool                `json:"txexpiry"`
+}
+
+// keySetTypes is the list of admin key set types which may be present in the
+// JSON representation of Params.
+var keySetTypes = []btcec.KeySetType{btcec.RootKeySet, btcec.ProvisionKeySet,
+	btcec.IssueKeySet, btcec.ValidateKeySet, btcec.ASPKeySet}
+
+// MarshalJSON returns the JSON encoding of the network parameters so they can
+// be shared with clients instead of hard-coding them.  Public keys, hashes, the
+// genesis block and the key ids of extended keys are hex-encoded, the admin key
+// sets are keyed by the name of their type, and the target time per block is
+// encoded as a duration string such as "2m30s".
+//
+// This is part of the json.Marshaler interface implementation.
+func (p Params) MarshalJSON() ([]byte, error) {
+	pj := paramsJSON{
+		Name:                     p.Name,
+		Net:                      uint32(p.Net),
+		DefaultPort:              p.DefaultPort,
+		DNSSeeds:                 make([]dnsSeedJSON, 0, len(p.DNSSeeds)),
+		AdminKeySets:             make(map[string][]string),
+		ASPKeyIDs:                make(map[string]string),
+		PowLimitBits:             p.PowLimitBits,
+		CoinbaseMaturity:         p.CoinbaseMaturity,
+		SubsidyReductionInterval: p.SubsidyReductionInterval,
+		TargetTimePerBlock:       p.TargetTimePerBlock.String(),
+		GenerateSupported:        p.GenerateSupported,
+		Checkpoints:              make([]checkpointJSON, 0, len(p.Checkpoints)),
+		BlockEnforceNumRequired:  p.BlockEnforceNumRequired,
+		BlockRejectNumRequired:   p.BlockRejectNumRequired,
+		BlockUpgradeNumToCheck:   p.BlockUpgradeNumToCheck,
+		RelayNonStdTxs:           p.RelayNonStdTxs,
+		ProvaAddrID:              p.ProvaAddrID,
+		PrivateKeyID:             p.PrivateKeyID,
+		HDPrivateKeyID:           hex.EncodeToString(p.HDPrivateKeyID[:]),
+		HDPublicKeyID:            hex.EncodeToString(p.HDPublicKeyID[:]),
+		HDCoinType:               p.HDCoinType,
+		PowAveragingWindow:       p.PowAveragingWindow,
+		PowMaxAdjustDown:         p.PowMaxAdjustDown,
+		PowMaxAdjustUp:           p.PowMaxAdjustUp,
+		ChainTrailingSigKeyLimit: p.ChainTrailingSigKeyLimit,
+		ChainWindowShareLimit:    p.ChainWindowShareLimit,
+		MaximumFeeAmount:         p.MaximumFeeAmount,
+		MaxBlockTransactions:     p.MaxBlockTransactions,
+		StrictMonotonicTime:      p.StrictMonotonicTime,
+		TimeRegressionWindow:     p.TimeRegressionWindow,
+		MaxTimeRegression:        p.MaxTimeRegression.String(),
+		ScriptVersions:           p.ScriptVersions,
+		RejectDoubleSigners:      p.RejectDoubleSigners,
+		PowOnly:                  p.PowOnly,
+		UpgradableAdminOps:       p.UpgradableAdminOps,
+		BurnFees:                 p.BurnFees,
+		ReprovisionKeyIDs:        p.ReprovisionKeyIDs,
+		TxExpiry:                 p.TxExpiry,
+	}
+	for _, seed := range p.DNSSeeds {
+		pj.DNSSeeds = append(pj.DNSSeeds, dnsSeedJSON{
+			Host:         seed.Host,
+			HasFiltering: seed.HasFiltering,
+		})
+	}
+	if p.GenesisBlock != nil {
+		var buf bytes.Buffer
+		if err := p.GenesisBlock.Serialize(&buf); err != nil {
+			return nil, err
+		}
+		pj.GenesisBlock = hex.EncodeToString(buf.Bytes())
+	}
+	if p.GenesisHash != nil {
+		pj.GenesisHash = p.GenesisHash.String()
+	}
+	for keySetType, keySet := range p.AdminKeySets {
+		name := keySetType.String()
+		if name == "" {
+			return nil, fmt.Errorf("unknown admin key set type %d",
+				keySetType)
+		}
+		pj.AdminKeySets[name] = keySet.ToStringArray()
+	}
+	for keyID, pubKey := range p.ASPKeyIdMap {
+		pj.ASPKeyIDs[strconv.FormatUint(uint64(keyID), 10)] =
+			hex.EncodeToString(pubKey.SerializeCompressed())
+	}
+	if p.PowLimit != nil {
+		pj.PowLimit = p.PowLimit.Text(16)
+	}
+	for _, checkpoint := range p.Checkpoints {
+		pj.Checkpoints = append(pj.Checkpoints, checkpointJSON{
+			Height: checkpoint.Height,
+			Hash:   checkpoint.Hash.String(),
+		})
+	}
+
+	return json.Marshal(&pj)
+}
+
+// UnmarshalJSON sets the network parameters from their JSON encoding as
+// returned by MarshalJSON.  It allows the parameters of a private network to be
+// loaded from a file.  Lists and maps which are empty in the JSON are left nil.
+// A missing maximum number of transactions per block leaves the block size as
+// the only limit.
+//
+// This is part of the json.Unmarshaler interface implementation.
+func (p *Params) UnmarshalJSON(data []byte) error {
+	var pj paramsJSON
+	if err := json.Unmarshal(data, &pj); err != nil {
+		return err
+	}
+
+	params := Params{
+		Name:                     pj.Name,
+		Net:                      wire.BitcoinNet(pj.Net),
+		DefaultPort:              pj.DefaultPort,
+		PowLimitBits:             pj.PowLimitBits,
+		CoinbaseMaturity:         pj.CoinbaseMaturity,
+		SubsidyReductionInterval: pj.SubsidyReductionInterval,
+		GenerateSupported:        pj.GenerateSupported,
+		BlockEnforceNumRequired:  pj.BlockEnforceNumRequired,
+		BlockRejectNumRequired:   pj.BlockRejectNumRequired,
+		BlockUpgradeNumToCheck:   pj.BlockUpgradeNumToCheck,
+		RelayNonStdTxs:           pj.RelayNonStdTxs,
+		ProvaAddrID:              pj.ProvaAddrID,
+		PrivateKeyID:             pj.PrivateKeyID,
+		HDCoinType:               pj.HDCoinType,
+		PowAveragingWindow:       pj.PowAveragingWindow,
+		PowMaxAdjustDown:         pj.PowMaxAdjustDown,
+		PowMaxAdjustUp:           pj.PowMaxAdjustUp,
+		ChainTrailingSigKeyLimit: pj.ChainTrailingSigKeyLimit,
+		ChainWindowShareLimit:    pj.ChainWindowShareLimit,
+		MaximumFeeAmount:         pj.MaximumFeeAmount,
+		MaxBlockTransactions:     pj.MaxBlockTransactions,
+		StrictMonotonicTime:      pj.StrictMonotonicTime,
+		TimeRegressionWindow:     pj.TimeRegressionWindow,
+		ScriptVersions:           pj.ScriptVersions,
+		RejectDoubleSigners:      pj.RejectDoubleSigners,
+		PowOnly:                  pj.PowOnly,
+		UpgradableAdminOps:       pj.UpgradableAdminOps,
+		BurnFees:                 pj.BurnFees,
+		ReprovisionKeyIDs:        pj.ReprovisionKeyIDs,
+		TxExpiry:                 pj.TxExpiry,
+	}
+	for _, seed := range pj.DNSSeeds {
+		params.DNSSeeds = append(params.DNSSeeds, DNSSeed{
+			Host:         seed.Host,
+			HasFiltering: seed.HasFiltering,
+		})
+	}
+	if pj.GenesisBlock != "" {
+		blockBytes, err := hex.DecodeString(pj.GenesisBlock)
+		if err != nil {
+			return fmt.Errorf("invalid genesis block: %v", err)
+		}
+		var block wire.MsgBlock
+		r := bytes.NewReader(blockBytes)
+		if err := block.Deserialize(r); err != nil {
+			return fmt.Errorf("invalid genesis block: %v", err)
+		}
+		if r.Len() != 0 {
+			return fmt.Errorf("invalid genesis block: %d trailing "+
+				"bytes", r.Len())
+		}
+		params.GenesisBlock = &block
+	}
+	if pj.GenesisHash != "" {
+		hash, err := chainhash.NewHashFromStr(pj.GenesisHash)
+		if err != nil {
+			return fmt.Errorf("invalid genesis hash: %v", err)
+		}
+		params.GenesisHash = hash
+	}
+	if len(pj.AdminKeySets) > 0 {
+		params.AdminKeySets = make(map[btcec.KeySetType]btcec.PublicKeySet)
+	}
+	for name, pubKeys := range pj.AdminKeySets {
+		keySetType, ok := keySetTypeFromString(name)
+		if !ok {
+			return fmt.Errorf("unknown admin key set type %q", name)
+		}
+		keySet, err := btcec.ParsePubKeySet(btcec.S256(), pubKeys...)
+		if err != nil {
+			return fmt.Errorf("invalid %s key set: %v", name, err)
+		}
+		params.AdminKeySets[keySetType] = keySet
+	}
+	if len(pj.ASPKeyIDs) > 0 {
+		params.ASPKeyIdMap = make(btcec.KeyIdMap)
+	}
+	for keyIDStr, pubKeyStr := range pj.ASPKeyIDs {
+		keyID, err := strconv.ParseUint(keyIDStr, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid ASP key id %q: %v", keyIDStr, err)
+		}
+		pubKeyBytes, err := hex.DecodeString(pubKeyStr)
+		if err != nil {
+			return fmt.Errorf("invalid ASP key %d: %v", keyID, err)
+		}
+		pubKey, err := btcec.ParsePubKey(pubKeyBytes, btcec.S256())
+		if err != nil {
+			return fmt.Errorf("invalid ASP key %d: %v", keyID, err)
+		}
+		params.ASPKeyIdMap[btcec.KeyID(keyID)] = pubKey
+	}
+	if pj.PowLimit != "" {
+		powLimit, ok := new(big.Int).SetString(pj.PowLimit, 16)
+		if !ok {
+			return fmt.Errorf("invalid pow limit %q", pj.PowLimit)
+		}
+		params.PowLimit = powLimit
+	}
+	// Parameters which predate the maximum number of transactions per block
+	// leave the block size as the only limit.
+	if pj.MaxBlockTransactions == 0 {
+		params.MaxBlockTransactions = wire.MaxBlockPayload
+	}
+	if params.MaxBlockTransactions < 1 {
+		return fmt.Errorf("invalid max block transactions %d",
+			pj.MaxBlockTransactions)
+	}
+	targetTimePerBlock, err := time.ParseDuration(pj.TargetTimePerBlock)
+	if err != nil {
+		return fmt.Errorf("invalid target time per block: %v", err)
+	}
+	params.TargetTimePerBlock = targetTimePerBlock
+	if pj.MaxTimeRegression != "" {
+		maxTimeRegression, err := time.ParseDuration(pj.MaxTimeRegression)
+		if err != nil {
+			return fmt.Errorf("invalid max time regression: %v", err)
+		}
+		params.MaxTimeRegression = maxTimeRegression
+	}
+	for _, checkpoint := range pj.Checkpoints {
+		hash, err := chainhash.NewHashFromStr(checkpoint.Hash)
+		if err != nil {
+			return fmt.Errorf("invalid checkpoint hash: %v", err)
+		}
+		params.Checkpoints = append(params.Checkpoints, Checkpoint{
+			Height: checkpoint.Height,
+			Hash:   hash,
+		})
+	}
+	if err := decodeHDKeyID(pj.HDPrivateKeyID, &params.HDPrivateKeyID); err != nil {
+		return fmt.Errorf("invalid HD private key id: %v", err)
+	}
+	if err := decodeHDKeyID(pj.HDPublicKeyID, &params.HDPublicKeyID); err != nil {
+		return fmt.Errorf("invalid HD public key id: %v", err)
+	}
+
+	*p = params
+	return nil
+}
+
+// keySetTypeFromString returns the admin key set type with the passed name as
+// returned by its String method.
+func keySetTypeFromString(name string) (btcec.KeySetType, bool) {
+	for _, keySetType := range keySetTypes {
+		if keySetType.String() == name {
+			return keySetType, true
+		}
+	}
+	return 0, false
+}
+
+// decodeHDKeyID decodes the passed hex-encoded extended key id into the passed
+// array.
+func decodeHDKeyID(hexStr string, id *[4]byte) error {
+	b, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return err
+	}
+	if len(b) != len(id) {
+		return fmt.Errorf("got %d bytes, want %d", len(b), len(id))
+	}
+	copy(id[:], b)
+	return nil
+}
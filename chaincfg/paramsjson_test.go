@@ -0,0 +1,186 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chaincfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParamsJSONRoundTrip ensures the parameters of all of the default networks
+// are unchanged after being encoded to JSON and decoded again, and that the
+// encoding is deterministic.
+func TestParamsJSONRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, params := range []*Params{&MainNetParams, &TestNetParams,
+		&RegressionNetParams, &SimNetParams} {
+
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			t.Errorf("%s: unable to marshal params: %v", params.Name, err)
+			continue
+		}
+		for i := 0; i < 5; i++ {
+			again, err := json.Marshal(params)
+			if err != nil || !bytes.Equal(again, encoded) {
+				t.Errorf("%s: encoding is not deterministic",
+					params.Name)
+				break
+			}
+		}
+
+		var decoded Params
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Errorf("%s: unable to unmarshal params: %v", params.Name,
+				err)
+			continue
+		}
+		reencoded, err := json.Marshal(&decoded)
+		if err != nil {
+			t.Errorf("%s: unable to marshal decoded params: %v",
+				params.Name, err)
+			continue
+		}
+		if !bytes.Equal(reencoded, encoded) {
+			t.Errorf("%s: round trip mismatch\ngot:  %s\nwant: %s",
+				params.Name, reencoded, encoded)
+			continue
+		}
+
+		// Compare the fields which are not simple values individually
+		// and all of the remaining fields at once.
+		if params.GenesisBlock.BlockHash() !=
+			decoded.GenesisBlock.BlockHash() ||
+			*decoded.GenesisHash != *params.GenesisHash {
+
+			t.Errorf("%s: genesis block mismatch", params.Name)
+		}
+		if len(decoded.AdminKeySets) != len(params.AdminKeySets) {
+			t.Errorf("%s: got %d admin key sets, want %d", params.Name,
+				len(decoded.AdminKeySets), len(params.AdminKeySets))
+		}
+		for keySetType, keySet := range params.AdminKeySets {
+			if !decoded.AdminKeySets[keySetType].Equal(keySet) {
+				t.Errorf("%s: %s key set mismatch", params.Name,
+					keySetType)
+			}
+		}
+		if !decoded.ASPKeyIdMap.Equal(params.ASPKeyIdMap) {
+			t.Errorf("%s: ASP key id map mismatch", params.Name)
+		}
+		if decoded.PowLimit.Cmp(params.PowLimit) != 0 {
+			t.Errorf("%s: got pow limit %x, want %x", params.Name,
+				decoded.PowLimit, params.PowLimit)
+		}
+		if len(decoded.DNSSeeds) != len(params.DNSSeeds) ||
+			len(decoded.Checkpoints) != len(params.Checkpoints) {
+
+			t.Errorf("%s: got %d seeds and %d checkpoints, want %d "+
+				"and %d", params.Name, len(decoded.DNSSeeds),
+				len(decoded.Checkpoints), len(params.DNSSeeds),
+				len(params.Checkpoints))
+		}
+		for i := range params.DNSSeeds {
+			if decoded.DNSSeeds[i] != params.DNSSeeds[i] {
+				t.Errorf("%s: seed %d mismatch", params.Name, i)
+			}
+		}
+		for i, checkpoint := range params.Checkpoints {
+			got := decoded.Checkpoints[i]
+			if got.Height != checkpoint.Height ||
+				*got.Hash != *checkpoint.Hash {
+
+				t.Errorf("%s: checkpoint %d mismatch", params.Name, i)
+			}
+		}
+
+		want := *params
+		want.DNSSeeds, decoded.DNSSeeds = nil, nil
+		want.GenesisBlock, decoded.GenesisBlock = nil, nil
+		want.GenesisHash, decoded.GenesisHash = nil, nil
+		want.AdminKeySets, decoded.AdminKeySets = nil, nil
+		want.ASPKeyIdMap, decoded.ASPKeyIdMap = nil, nil
+		want.PowLimit, decoded.PowLimit = nil, nil
+		want.Checkpoints, decoded.Checkpoints = nil, nil
+		if !reflect.DeepEqual(decoded, want) {
+			t.Errorf("%s: round trip mismatch\ngot:  %+v\nwant: %+v",
+				params.Name, decoded, want)
+		}
+	}
+}
+
+// TestParamsJSONInvalid ensures invalid JSON encodings of parameters are
+// rejected.
+func TestParamsJSONInvalid(t *testing.T) {
+	t.Parallel()
+
+	encoded, err := json.Marshal(&RegressionNetParams)
+	if err != nil {
+		t.Fatalf("unable to marshal params: %v", err)
+	}
+	tests := []struct {
+		name string
+		old  string
+		new  string
+	}{
+		{
+			name: "unknown key set type",
+			old:  `"ROOT":`,
+			new:  `"OWNER":`,
+		},
+		{
+			name: "invalid public key",
+			old:  `"025ceeba`,
+			new:  `"055ceeba`,
+		},
+		{
+			name: "invalid ASP key id",
+			old:  `"aspkeyids":{"1":`,
+			new:  `"aspkeyids":{"one":`,
+		},
+		{
+			name: "invalid target time per block",
+			old:  `"targettimeperblock":"1m0s"`,
+			new:  `"targettimeperblock":"1 minute"`,
+		},
+		{
+			name: "invalid max time regression",
+			old:  `"maxtimeregression":"5m0s"`,
+			new:  `"maxtimeregression":"5 minutes"`,
+		},
+		{
+			name: "negative max block transactions",
+			old:  `"maxblocktransactions":25`,
+			new:  `"maxblocktransactions":-1`,
+		},
+		{
+			name: "short HD key id",
+			old:  `"hdprivatekeyid":"04358394"`,
+			new:  `"hdprivatekeyid":"043583"`,
+		},
+		{
+			name: "malformed genesis block",
+			old:  `"genesisblock":"`,
+			new:  `"genesisblock":"00`,
+		},
+	}
+
+	for _, test := range tests {
+		if !strings.Contains(string(encoded), test.old) {
+			t.Errorf("%s: encoding does not contain %s", test.name,
+				test.old)
+			continue
+		}
+		invalid := strings.Replace(string(encoded), test.old, test.new, 1)
+		var params Params
+		if err := json.Unmarshal([]byte(invalid), &params); err == nil {
+			t.Errorf("%s: unmarshal did not fail", test.name)
+		}
+	}
+}
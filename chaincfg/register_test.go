@@ -40,6 +40,7 @@ func TestRegister(t *testing.T) {
 		p2pkhMagics []magicTest
 		p2shMagics  []magicTest
 		hdMagics    []hdTest
+		nets        []*Params
 	}{
 		{
 			name: "default networks",
@@ -99,6 +100,8 @@ func TestRegister(t *testing.T) {
 					err:  ErrUnknownHDKeyID,
 				},
 			},
+			nets: []*Params{&MainNetParams, &TestNetParams,
+				&RegressionNetParams, &SimNetParams},
 		},
 		{
 			name: "register mocknet",
@@ -116,6 +119,8 @@ func TestRegister(t *testing.T) {
 					err:  nil,
 				},
 			},
+			nets: []*Params{&MainNetParams, &TestNetParams,
+				&RegressionNetParams, &SimNetParams, &mockNetParams},
 		},
 		{
 			name: "more duplicates",
@@ -181,6 +186,8 @@ func TestRegister(t *testing.T) {
 					err:  ErrUnknownHDKeyID,
 				},
 			},
+			nets: []*Params{&MainNetParams, &TestNetParams,
+				&RegressionNetParams, &SimNetParams, &mockNetParams},
 		},
 	}
 
@@ -192,6 +199,10 @@ func TestRegister(t *testing.T) {
 					test.name, regTest.name, err, regTest.err)
 			}
 		}
+		if nets := RegisteredNets(); !reflect.DeepEqual(nets, test.nets) {
+			t.Errorf("%s: RegisteredNets mismatch: got %d networks "+
+				"expected %d", test.name, len(nets), len(test.nets))
+		}
 		for i, magTest := range test.p2pkhMagics {
 			valid := IsPubKeyHashAddrID(magTest.magic)
 			if valid != magTest.valid {
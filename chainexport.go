@@ -0,0 +1,123 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcjson"
+)
+
+// errExportDestination describes an error due to an invalid chain data export
+// destination, as opposed to a failure of the export itself.
+type errExportDestination string
+
+// Error implements the error interface.
+func (e errExportDestination) Error() string {
+	return string(e)
+}
+
+// chainExportPath returns the absolute path of the passed chain data export
+// destination once it is checked to be safe to write to.  Relative
+// destinations are relative to the data directory.  Exports from the genesis
+// block are written to a new file, while exports resumed from a later height
+// are appended to an existing regular file.  Destinations in the block
+// database directory are never written to.
+func chainExportPath(dest string, startHeight uint32) (string, error) {
+	if dest == "" {
+		return "", errExportDestination("export destination must be " +
+			"specified")
+	}
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(cfg.DataDir, dest)
+	}
+	dest = filepath.Clean(dest)
+
+	dbPath := filepath.Clean(blockDbPath(cfg.DbType))
+	if dest == dbPath ||
+		strings.HasPrefix(dest, dbPath+string(filepath.Separator)) {
+
+		str := fmt.Sprintf("export destination %q is in the block "+
+			"database directory", dest)
+		return "", errExportDestination(str)
+	}
+	dir, err := os.Stat(filepath.Dir(dest))
+	if err != nil || !dir.IsDir() {
+		str := fmt.Sprintf("directory of export destination %q does "+
+			"not exist", dest)
+		return "", errExportDestination(str)
+	}
+
+	fi, err := os.Lstat(dest)
+	switch {
+	case startHeight == 0 && !os.IsNotExist(err):
+		str := fmt.Sprintf("export destination %q already exists",
+			dest)
+		return "", errExportDestination(str)
+	case startHeight > 0 && (err != nil || !fi.Mode().IsRegular()):
+		str := fmt.Sprintf("export destination %q must be an existing "+
+			"file to resume an export", dest)
+		return "", errExportDestination(str)
+	}
+	return dest, nil
+}
+
+// exportChainData writes a CSV row summarizing each main chain block from the
+// passed start height to the best block to the passed destination, which MUST
+// have been checked by chainExportPath, reporting its progress through the
+// passed job, which may be nil.  The header line naming the columns is only
+// written when exporting from the genesis block, so an export which stopped
+// early can be resumed by appending the rows from the height after its last
+// row.
+func exportChainData(ctx context.Context, chain *blockchain.BlockChain, dest string, startHeight uint32, job *rpcJob) (*btcjson.ExportChainDataResult, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if startHeight > 0 {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(dest, flags, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	start := time.Now()
+	result := &btcjson.ExportChainDataResult{
+		Destination: dest,
+		StartHeight: startHeight,
+	}
+	w := blockchain.NewCSVChainDataWriter(file, startHeight == 0)
+	endHeight, err := chain.ExportChainData(ctx, w, startHeight,
+		func(height, endHeight uint32) {
+			partial := *result
+			partial.EndHeight = height
+			partial.Rows = height - startHeight + 1
+			job.report(float64(partial.Rows)/
+				float64(endHeight-startHeight+1), &partial)
+		})
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Sync(); err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	result.EndHeight = endHeight
+	result.Rows = endHeight - startHeight + 1
+	result.Bytes = fi.Size()
+	result.Seconds = time.Since(start).Seconds()
+	rpcsLog.Infof("Exported chain data of blocks %d to %d to %s",
+		startHeight, endHeight, dest)
+	return result, nil
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+)
+
+// TestExportChainData ensures the exportchaindata command run as a job writes
+// a row for each main chain block to a new file, resumes exports by appending
+// to an existing file, and rejects unsafe destinations before starting.
+func TestExportChainData(t *testing.T) {
+	defer func(c *config, p *params) {
+		cfg = c
+		activeNetParams = p
+	}(cfg, activeNetParams)
+	activeNetParams = &regressionNetParams
+	chainParams := activeNetParams.Params
+
+	tmpDir, err := ioutil.TempDir("", "chainexport")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cfg = newTestConfig(tmpDir)
+	db, err := database.Create("ffldb", blockDbPath(cfg.DbType),
+		chainParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+	s, err := newServer(nil, db, chainParams)
+	if err != nil {
+		t.Fatalf("newServer: unexpected error: %v", err)
+	}
+	rpcServer := &rpcServer{
+		server: s,
+		chain:  s.blockManager.chain,
+		jobs:   newRPCJobManager(time.Minute),
+	}
+	defer rpcServer.jobs.stop()
+
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	h.generator = h.newGenerator(s.blockManager.chain)
+	processBlocks := func(n int) {
+		for i := 0; i < n; i++ {
+			block := provautil.NewBlock(h.generateBlock(t))
+			_, _, err := s.blockManager.chain.ProcessBlock(block,
+				blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock: unexpected error: %v", err)
+			}
+		}
+	}
+
+	// export runs the exportchaindata command with the passed parameters
+	// as a job and returns its result once it completes.
+	export := func(params ...interface{}) *btcjson.ExportChainDataResult {
+		id, err := handleStartJob(rpcServer, btcjson.NewStartJobCmd(
+			"exportchaindata", &params), nil)
+		if err != nil {
+			t.Fatalf("startjob: unexpected error: %v", err)
+		}
+		job, ok := rpcServer.jobs.lookup(id.(string))
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		<-job.done
+		status := job.status(time.Now())
+		if status.State != "completed" {
+			t.Fatalf("job %s: %s", status.State, status.Error)
+		}
+		return status.Result.(*btcjson.ExportChainDataResult)
+	}
+
+	// checkRows ensures the export at the passed path has a header and a
+	// row for each main chain block in height order.
+	dest := filepath.Join(cfg.DataDir, "blocks.csv")
+	checkRows := func() {
+		f, err := os.Open(dest)
+		if err != nil {
+			t.Fatalf("unable to open export: %v", err)
+		}
+		defer f.Close()
+		records, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			t.Fatalf("unable to parse export: %v", err)
+		}
+		best := s.blockManager.chain.BestSnapshot()
+		if len(records) != int(best.Height)+2 || records[0][0] != "height" {
+			t.Fatalf("got %d lines, want a header and %d rows",
+				len(records), best.Height+1)
+		}
+		for i, record := range records[1:] {
+			hash, err := s.blockManager.chain.BlockHashByHeight(
+				uint32(i))
+			if err != nil {
+				t.Fatalf("BlockHashByHeight: unexpected error: %v",
+					err)
+			}
+			if record[0] != strconv.Itoa(i) || record[1] != hash.String() {
+				t.Fatalf("row %d is block %s %s, want %d %s", i,
+					record[0], record[1], i, hash)
+			}
+		}
+	}
+
+	processBlocks(5)
+	result := export("blocks.csv")
+	if result.Destination != dest || result.StartHeight != 0 ||
+		result.EndHeight != 5 || result.Rows != 6 || result.Bytes == 0 {
+
+		t.Fatalf("unexpected result %+v", result)
+	}
+	checkRows()
+
+	// Resuming the export appends the rows of the new blocks.
+	processBlocks(3)
+	result = export(dest, 6)
+	if result.StartHeight != 6 || result.EndHeight != 8 || result.Rows != 3 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	checkRows()
+
+	// Unsafe destinations and heights beyond the best block are rejected
+	// before a job is started.
+	numJobs := rpcServer.jobs.numJobs()
+	tests := []struct {
+		name   string
+		params []interface{}
+		code   btcjson.RPCErrorCode
+	}{
+		{"existing file", []interface{}{"blocks.csv"},
+			btcjson.ErrRPCInvalidParameter},
+		{"missing file to resume", []interface{}{"other.csv", 3},
+			btcjson.ErrRPCInvalidParameter},
+		{"missing directory", []interface{}{"missing/blocks.csv"},
+			btcjson.ErrRPCInvalidParameter},
+		{"database directory", []interface{}{filepath.Join(
+			blockDbPath(cfg.DbType), "blocks.csv")},
+			btcjson.ErrRPCInvalidParameter},
+		{"directory to resume", []interface{}{".", 3},
+			btcjson.ErrRPCInvalidParameter},
+		{"height beyond best block", []interface{}{dest, 9},
+			btcjson.ErrRPCOutOfRange},
+	}
+	for _, test := range tests {
+		_, err := handleStartJob(rpcServer, btcjson.NewStartJobCmd(
+			"exportchaindata", &test.params), nil)
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != test.code {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+	if n := rpcServer.jobs.numJobs(); n != numJobs {
+		t.Fatalf("started %d jobs for invalid parameters", n-numJobs)
+	}
+}
@@ -0,0 +1,423 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+const (
+	// chainSplitCheckInterval is the interval at which the best blocks of
+	// the peers are compared against the best chain to detect chain splits.
+	chainSplitCheckInterval = time.Second * 10
+
+	// maxChainSplitWalk is the maximum number of side chain blocks walked
+	// back from the best block of a peer to find where it forks from the
+	// best chain.
+	maxChainSplitWalk = 1000
+
+	// maxChainSplitLogTips is the maximum number of tips listed in the
+	// chain split warning.
+	maxChainSplitLogTips = 4
+)
+
+// Statuses of the best block of a peer relative to the best chain.
+const (
+	// chainTipActive is the status of peers whose best block is the tip
+	// of the best chain.
+	chainTipActive = "active"
+
+	// chainTipBehind is the status of peers whose best block is an
+	// ancestor of the tip of the best chain.
+	chainTipBehind = "behind"
+
+	// chainTipFork is the status of peers whose best block is a known
+	// block of a side chain.
+	chainTipFork = "fork"
+
+	// chainTipUnknown is the status of peers whose best block is not known,
+	// such as a block which was not downloaded yet or which is invalid.
+	chainTipUnknown = "unknown"
+
+	// chainTipHeightOnly is the status of peers for which only the height
+	// advertised in their version message is known.
+	chainTipHeightOnly = "heightonly"
+)
+
+// peerTip houses the best block known of a peer as learned from its version
+// message and the blocks it announces and sends, along with the height of the
+// most recent block of the best chain it is known to share.
+type peerTip struct {
+	hash         *chainhash.Hash
+	height       uint32
+	commonHeight uint32
+	hasCommon    bool
+}
+
+// chainSplitMonitor compares the best blocks of the connected peers against
+// the best chain and warns when more than a fraction of the peers whose best
+// block is known have diverged from it by more than a number of blocks for
+// longer than a duration.  The peers and their best blocks are only accessed
+// by the block handler, while the counts served as metrics are safe for
+// concurrent access.
+type chainSplitMonitor struct {
+	chain    *blockchain.BlockChain
+	fraction float64
+	depth    uint32
+	duration time.Duration
+
+	// The following fields are only accessed by the block handler.
+	peers          map[*serverPeer]struct{}
+	divergingSince time.Time
+	warned         bool
+
+	// The following fields are protected by mtx.
+	mtx           sync.Mutex
+	warnings      uint64
+	active        bool
+	knownPeers    int
+	divergedPeers int
+}
+
+// newChainSplitMonitor returns a new chain split monitor for the passed chain
+// which warns when more than the passed fraction of the peers diverge from the
+// best chain by more than depth blocks for the passed duration.
+func newChainSplitMonitor(chain *blockchain.BlockChain, fraction float64, depth uint32, duration time.Duration) *chainSplitMonitor {
+	return &chainSplitMonitor{
+		chain:    chain,
+		fraction: fraction,
+		depth:    depth,
+		duration: duration,
+		peers:    make(map[*serverPeer]struct{}),
+	}
+}
+
+// AddPeer starts tracking the best block of the passed peer, starting out with
+// the height it advertised in its version message.
+//
+// This function MUST be called from the block handler.
+func (m *chainSplitMonitor) AddPeer(sp *serverPeer) {
+	sp.chainTip.height = sp.StartingHeight()
+	m.peers[sp] = struct{}{}
+}
+
+// RemovePeer stops tracking the best block of the passed peer.
+//
+// This function MUST be called from the block handler.
+func (m *chainSplitMonitor) RemovePeer(sp *serverPeer) {
+	delete(m.peers, sp)
+}
+
+// UpdatePeerTip records the block with the passed hash and height as the best
+// block of the passed peer, unless it is lower than the best block already
+// recorded for the peer.
+//
+// This function MUST be called from the block handler.
+func (m *chainSplitMonitor) UpdatePeerTip(sp *serverPeer, hash *chainhash.Hash, height uint32) {
+	tip := &sp.chainTip
+	if tip.hash != nil && height < tip.height {
+		return
+	}
+	tip.hash = hash
+	tip.height = height
+}
+
+// forkHeight walks back from the side chain block with the passed hash and
+// returns the height of the block of the best chain it forks from.  False is
+// returned when the block or one of its ancestors is not known, or the fork
+// point is more than maxChainSplitWalk blocks back.
+func (m *chainSplitMonitor) forkHeight(hash *chainhash.Hash) (uint32, bool) {
+	for i := 0; i < maxChainSplitWalk; i++ {
+		header, err := m.chain.FetchHeader(hash)
+		if err != nil {
+			return 0, false
+		}
+		prevHash := header.PrevBlock
+		onMainChain, err := m.chain.MainChainHasBlock(&prevHash)
+		if err != nil {
+			return 0, false
+		}
+		if onMainChain {
+			return header.Height - 1, true
+		}
+		hash = &prevHash
+	}
+	return 0, false
+}
+
+// peerDivergence returns the status of the passed best block of a peer along
+// with the number of blocks it diverges from the passed best chain state by,
+// which is the number of blocks of the higher of both tips past the most
+// recent block they share.  The block of the best chain shared with the peer
+// is updated along the way.
+func (m *chainSplitMonitor) peerDivergence(tip *peerTip, best *blockchain.BestState) (string, uint32) {
+	if tip.hash == nil {
+		return chainTipHeightOnly, 0
+	}
+
+	onMainChain, err := m.chain.MainChainHasBlock(tip.hash)
+	if err == nil && onMainChain {
+		tip.commonHeight = tip.height
+		tip.hasCommon = true
+		if *tip.hash == *best.Hash {
+			return chainTipActive, 0
+		}
+		return chainTipBehind, 0
+	}
+
+	top := best.Height
+	if tip.height > top {
+		top = tip.height
+	}
+	if forkHeight, ok := m.forkHeight(tip.hash); ok {
+		tip.commonHeight = forkHeight
+		tip.hasCommon = true
+		return chainTipFork, top - forkHeight
+	}
+
+	// The block is not known, so fall back to the most recent block of
+	// the best chain the peer was known to share, or the difference in
+	// height when there is none.
+	if tip.hasCommon && tip.commonHeight <= top {
+		return chainTipUnknown, top - tip.commonHeight
+	}
+	if tip.height < best.Height {
+		return chainTipUnknown, best.Height - tip.height
+	}
+	return chainTipUnknown, tip.height - best.Height
+}
+
+// serverPeersByID implements sort.Interface to allow a slice of peers to be
+// sorted by their id.
+type serverPeersByID []*serverPeer
+
+// Len returns the number of peers in the slice.  It is part of the
+// sort.Interface implementation.
+func (s serverPeersByID) Len() int {
+	return len(s)
+}
+
+// Swap swaps the peers at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s serverPeersByID) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the peer with index i should sort before the peer with
+// index j.  It is part of the sort.Interface implementation.
+func (s serverPeersByID) Less(i, j int) bool {
+	return s[i].ID() < s[j].ID()
+}
+
+// chainSplitTipSorter implements sort.Interface to allow the tips of a chain
+// split summary to be sorted by descending number of peers, then by descending
+// height, and then by hash.
+type chainSplitTipSorter []btcjson.ChainSplitTipResult
+
+// Len returns the number of tips in the slice.  It is part of the
+// sort.Interface implementation.
+func (s chainSplitTipSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the tips at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s chainSplitTipSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the tip with index i should sort before the tip with
+// index j.  It is part of the sort.Interface implementation.
+func (s chainSplitTipSorter) Less(i, j int) bool {
+	if len(s[i].Peers) != len(s[j].Peers) {
+		return len(s[i].Peers) > len(s[j].Peers)
+	}
+	if s[i].Height != s[j].Height {
+		return s[i].Height > s[j].Height
+	}
+	return s[i].Hash < s[j].Hash
+}
+
+// Check compares the best blocks of the peers against the best chain and
+// returns a summary of the tips the peers are on.  A chain split is only
+// detected while the passed current flag indicates the chain is synced with
+// the peers.  The returned flag is true when the split condition has held for
+// the configured duration as of the passed time and was not reported yet, in
+// which case the warning is logged and counted, and should be delivered to the
+// webhooks by the caller.
+//
+// This function MUST be called from the block handler.
+func (m *chainSplitMonitor) Check(now time.Time, current bool) (*btcjson.GetChainSplitInfoResult, bool) {
+	best := m.chain.BestSnapshot()
+	result := &btcjson.GetChainSplitInfoResult{
+		Hash:     best.Hash.String(),
+		Height:   best.Height,
+		Fraction: m.fraction,
+		Depth:    m.depth,
+		Duration: int64(m.duration / time.Second),
+		Current:  current,
+		Peers:    len(m.peers),
+		Tips:     make([]btcjson.ChainSplitTipResult, 0),
+	}
+
+	// Group the peers by their best block.  Peers for which only the
+	// height is known are grouped by height.
+	peers := make([]*serverPeer, 0, len(m.peers))
+	for sp := range m.peers {
+		peers = append(peers, sp)
+	}
+	sort.Sort(serverPeersByID(peers))
+	tips := make(map[string]int)
+	for _, sp := range peers {
+		status, divergence := m.peerDivergence(&sp.chainTip, best)
+		if status != chainTipHeightOnly {
+			result.KnownPeers++
+			if divergence > m.depth {
+				result.DivergedPeers++
+			}
+		}
+
+		key := fmt.Sprintf("%s/%d", status, sp.chainTip.height)
+		if sp.chainTip.hash != nil {
+			key = sp.chainTip.hash.String()
+		}
+		i, ok := tips[key]
+		if !ok {
+			tip := btcjson.ChainSplitTipResult{
+				Height:     sp.chainTip.height,
+				Status:     status,
+				Divergence: divergence,
+			}
+			if sp.chainTip.hash != nil {
+				tip.Hash = sp.chainTip.hash.String()
+			}
+			i = len(result.Tips)
+			tips[key] = i
+			result.Tips = append(result.Tips, tip)
+		}
+		result.Tips[i].Peers = append(result.Tips[i].Peers,
+			btcjson.ChainSplitPeerResult{ID: sp.ID(), Addr: sp.Addr()})
+	}
+	sort.Sort(chainSplitTipSorter(result.Tips))
+
+	// Track how long more than the fraction of the peers have diverged
+	// and warn once it has lasted for the configured duration.
+	result.Split = current && result.KnownPeers > 0 &&
+		float64(result.DivergedPeers) > m.fraction*float64(result.KnownPeers)
+	warn := false
+	switch {
+	case !result.Split:
+		if m.warned {
+			bmgrLog.Infof("Chain split resolved: %d of %d peers "+
+				"diverge from the best chain at height %d",
+				result.DivergedPeers, result.KnownPeers, best.Height)
+		}
+		m.divergingSince = time.Time{}
+		m.warned = false
+
+	case m.divergingSince.IsZero():
+		m.divergingSince = now
+		fallthrough
+
+	default:
+		if !m.warned && now.Sub(m.divergingSince) >= m.duration {
+			m.warned = true
+			warn = true
+		}
+	}
+	if !m.divergingSince.IsZero() {
+		result.DivergingSince = m.divergingSince.Unix()
+	}
+	result.Warned = m.warned
+
+	m.mtx.Lock()
+	if warn {
+		m.warnings++
+	}
+	m.active = m.warned
+	m.knownPeers = result.KnownPeers
+	m.divergedPeers = result.DivergedPeers
+	result.Warnings = m.warnings
+	m.mtx.Unlock()
+
+	if warn {
+		bmgrLog.Warnf("Chain split detected: %d of %d peers have "+
+			"diverged from the best chain at height %d by more than "+
+			"%d blocks since %v -- tips: %s", result.DivergedPeers,
+			result.KnownPeers, best.Height, m.depth,
+			m.divergingSince.Format(time.RFC3339),
+			chainSplitTipsString(result.Tips))
+	}
+	return result, warn
+}
+
+// chainSplitTipsString returns a description of the passed tips for the chain
+// split warning, listing at most maxChainSplitLogTips of them.
+func chainSplitTipsString(tips []btcjson.ChainSplitTipResult) string {
+	descs := make([]string, 0, len(tips))
+	for i, tip := range tips {
+		if i == maxChainSplitLogTips {
+			descs = append(descs, fmt.Sprintf("and %d more",
+				len(tips)-i))
+			break
+		}
+		hash := tip.Hash
+		if hash == "" {
+			hash = "?"
+		}
+		descs = append(descs, fmt.Sprintf("%s at height %d (%s, %d "+
+			"peers)", hash, tip.Height, tip.Status, len(tip.Peers)))
+	}
+	return strings.Join(descs, ", ")
+}
+
+// WriteMetrics writes the number of chain split warnings, whether a reported
+// chain split is in progress, and the number of peers whose best block is known and which
+// diverge from the best chain as of the most recent check to the passed writer
+// in the Prometheus text exposition format.
+func (m *chainSplitMonitor) WriteMetrics(w io.Writer) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteString("# HELP prova_chain_split_warnings_total Number of " +
+		"chain splits detected among the connected peers.\n")
+	buf.WriteString("# TYPE prova_chain_split_warnings_total counter\n")
+	fmt.Fprintf(&buf, "prova_chain_split_warnings_total %d\n", m.warnings)
+
+	active := 0
+	if m.active {
+		active = 1
+	}
+	buf.WriteString("# HELP prova_chain_split_active Whether a chain split " +
+		"which was warned about is in progress.\n")
+	buf.WriteString("# TYPE prova_chain_split_active gauge\n")
+	fmt.Fprintf(&buf, "prova_chain_split_active %d\n", active)
+
+	buf.WriteString("# HELP prova_chain_split_peers Number of connected " +
+		"peers whose best block is known.\n")
+	buf.WriteString("# TYPE prova_chain_split_peers gauge\n")
+	fmt.Fprintf(&buf, "prova_chain_split_peers %d\n", m.knownPeers)
+
+	buf.WriteString("# HELP prova_chain_split_diverged_peers Number of " +
+		"connected peers whose best block diverges from the best " +
+		"chain by more than the chain split depth.\n")
+	buf.WriteString("# TYPE prova_chain_split_diverged_peers gauge\n")
+	fmt.Fprintf(&buf, "prova_chain_split_diverged_peers %d\n",
+		m.divergedPeers)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
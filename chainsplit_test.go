@@ -0,0 +1,325 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/peer"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// chainSplitTip returns the tip of the passed chain split summary the passed
+// peer is on.
+func chainSplitTip(t *testing.T, info *btcjson.GetChainSplitInfoResult, sp *serverPeer) *btcjson.ChainSplitTipResult {
+	for i := range info.Tips {
+		for _, p := range info.Tips[i].Peers {
+			if p.Addr == sp.Addr() {
+				return &info.Tips[i]
+			}
+		}
+	}
+	t.Fatalf("peer %s is not on any tip: %+v", sp.Addr(), info.Tips)
+	return nil
+}
+
+// TestChainSplit ensures the best blocks of peers learned from headers, inv and
+// version messages are compared against a forked fixture chain, and that a
+// chain split is only reported once more than the fraction of the peers have
+// diverged for the configured duration, through the log, the metrics, the
+// webhooks and the getchainsplitinfo RPC.
+func TestChainSplit(t *testing.T) {
+	defer func(c *config) {
+		cfg = c
+	}(cfg)
+	cfg = &config{BanThreshold: defaultBanThreshold}
+
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	s := h.rpcServer.server
+
+	// Build a main chain of 7 blocks with a side chain of 2 blocks which
+	// forks from it at height 2.  The blocks at the same height of both
+	// branches are generated from the same template and told apart by
+	// their coinbase script.
+	newBlock := func(prevHash *chainhash.Hash, variant byte) *wire.MsgBlock {
+		msgBlock := h.generateBlock(t)
+		coinbase := msgBlock.Transactions[0]
+		coinbase.TxIn[0].SignatureScript = append(
+			coinbase.TxIn[0].SignatureScript, variant)
+		if prevHash != nil {
+			msgBlock.Header.PrevBlock = *prevHash
+		}
+		h.finishModifiedBlock(t, msgBlock)
+		return msgBlock
+	}
+	processBlock := func(msgBlock *wire.MsgBlock) *chainhash.Hash {
+		block := provautil.NewBlock(msgBlock)
+		_, _, err := h.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+		return block.Hash()
+	}
+	mainHeaders := []wire.BlockHeader{s.chainParams.GenesisBlock.Header}
+	var sideBlocks []*wire.MsgBlock
+	var sidePrev *chainhash.Hash
+	for height := 1; height <= 7; height++ {
+		if height == 3 || height == 4 {
+			side := newBlock(sidePrev, 1)
+			hash := side.BlockHash()
+			sidePrev = &hash
+			sideBlocks = append(sideBlocks, side)
+		}
+		msgBlock := newBlock(nil, 0)
+		processBlock(msgBlock)
+		mainHeaders = append(mainHeaders, msgBlock.Header)
+	}
+	for _, side := range sideBlocks {
+		processBlock(side)
+	}
+	sideTip := sideBlocks[len(sideBlocks)-1].Header
+	if best := h.chain.BestSnapshot(); best.Height != 7 {
+		t.Fatalf("unexpected best height %d", best.Height)
+	}
+
+	// Deliver chain split events to a test webhook endpoint.
+	recorder := &webhookRecorder{delivered: make(chan struct{}, 10)}
+	hookServer := httptest.NewServer(recorder)
+	defer hookServer.Close()
+	n, _ := newTestWebhookNotifier(hookServer.URL, 10)
+	n.Start()
+	defer n.Stop()
+	s.webhookNotifier = n
+
+	m := newChainSplitMonitor(h.chain, 0.5, 3, time.Minute)
+	bm := &blockManager{
+		server:          s,
+		chain:           h.chain,
+		chainSplit:      m,
+		requestedTxns:   make(map[chainhash.Hash]struct{}),
+		requestedBlocks: make(map[chainhash.Hash]*blockRequest),
+		rejectedTxns:    make(map[chainhash.Hash]struct{}),
+	}
+	s.blockManager = bm
+
+	// The peers are told apart by their address, since they are not
+	// connected and all have the same id.
+	sps := make([]*serverPeer, 5)
+	for i := range sps {
+		sp := newServerPeer(s, false)
+		p, err := peer.NewOutboundPeer(&peer.Config{
+			ChainParams: s.chainParams,
+			Services:    wire.SFNodeNetwork,
+		}, fmt.Sprintf("10.0.0.%d:7979", i+1))
+		if err != nil {
+			t.Fatalf("unable to create peer: %v", err)
+		}
+		sp.Peer = p
+		sps[i] = sp
+		m.AddPeer(sp)
+	}
+	headers := func(sp *serverPeer, header wire.BlockHeader) {
+		msg := wire.NewMsgHeaders()
+		msg.AddBlockHeader(&header)
+		bm.handleHeadersMsg(&headersMsg{headers: msg, peer: sp})
+	}
+	inv := func(sp *serverPeer, hash chainhash.Hash) {
+		msg := wire.NewMsgInv()
+		msg.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &hash))
+		bm.handleInvMsg(&invMsg{inv: msg, peer: sp})
+	}
+	unknownHeader := func(height uint32) wire.BlockHeader {
+		return wire.BlockHeader{
+			PrevBlock: chainhash.Hash{byte(height)},
+			Height:    height,
+			Timestamp: time.Unix(time.Now().Unix(), 0),
+		}
+	}
+	check := func(now time.Time, current bool) (*btcjson.GetChainSplitInfoResult, bool) {
+		info, warn := m.Check(now, current)
+		if warn {
+			n.NotifyChainSplit(info)
+		}
+		return info, warn
+	}
+
+	// Peer 0 is on the tip, peer 1 is behind it, peer 2 is on the side
+	// chain, peer 3 is on an older block of the main chain, and only the
+	// starting height of peer 4 is known.
+	headers(sps[0], mainHeaders[7])
+	inv(sps[1], mainHeaders[5].BlockHash())
+	headers(sps[2], sideTip)
+	headers(sps[3], mainHeaders[6])
+	t0 := time.Now()
+	info, warn := check(t0, true)
+	if warn || info.Split || info.Peers != 5 || info.KnownPeers != 4 ||
+		info.DivergedPeers != 1 || info.Height != 7 ||
+		info.Hash != mainHeaders[7].BlockHash().String() {
+
+		t.Fatalf("unexpected summary: %+v", info)
+	}
+	tests := []struct {
+		sp         *serverPeer
+		status     string
+		height     uint32
+		divergence uint32
+	}{
+		{sps[0], chainTipActive, 7, 0},
+		{sps[1], chainTipBehind, 5, 0},
+		{sps[2], chainTipFork, 4, 5},
+		{sps[3], chainTipBehind, 6, 0},
+		{sps[4], chainTipHeightOnly, 0, 0},
+	}
+	for i, test := range tests {
+		tip := chainSplitTip(t, info, test.sp)
+		if tip.Status != test.status || tip.Height != test.height ||
+			tip.Divergence != test.divergence {
+
+			t.Errorf("peer %d: got tip %+v, want status %s, height "+
+				"%d, divergence %d", i, tip, test.status,
+				test.height, test.divergence)
+		}
+	}
+
+	// A block announced by peer 3 which is not known yet is assumed to
+	// extend the block it was on, so it does not diverge by much.
+	announced := unknownHeader(100)
+	inv(sps[3], announced.BlockHash())
+	info, _ = check(t0, true)
+	tip := chainSplitTip(t, info, sps[3])
+	if tip.Status != chainTipUnknown || tip.Height != 7 ||
+		tip.Divergence != 1 || info.DivergedPeers != 1 {
+
+		t.Fatalf("unexpected tip of peer 3: %+v", tip)
+	}
+
+	// Blocks lower than the best block of a peer are ignored.
+	headers(sps[1], sideTip)
+	if tip := sps[1].chainTip; tip.height != 5 {
+		t.Fatalf("unexpected tip of peer 1: %+v", tip)
+	}
+
+	// Once peers 1 and 3 move on to unknown blocks far past the blocks
+	// they shared with the best chain, 3 out of 4 peers diverge, but the
+	// split is only reported once it lasted for the configured duration.
+	headers(sps[1], unknownHeader(13))
+	headers(sps[3], unknownHeader(12))
+	info, warn = check(t0, true)
+	if warn || !info.Split || info.DivergedPeers != 3 || info.Warned ||
+		info.DivergingSince != t0.Unix() {
+
+		t.Fatalf("unexpected summary when split: %+v", info)
+	}
+	if tip := chainSplitTip(t, info, sps[1]); tip.Divergence != 8 {
+		t.Fatalf("unexpected tip of peer 1: %+v", tip)
+	}
+	info, warn = check(t0.Add(time.Second*30), true)
+	if warn || info.Warned || info.Warnings != 0 {
+		t.Fatalf("split reported before the duration: %+v", info)
+	}
+	info, warn = check(t0.Add(time.Minute), true)
+	if !warn || !info.Warned || info.Warnings != 1 ||
+		info.DivergingSince != t0.Unix() {
+
+		t.Fatalf("split not reported after the duration: %+v", info)
+	}
+	info, warn = check(t0.Add(time.Minute*2), true)
+	if warn || !info.Warned || info.Warnings != 1 {
+		t.Fatalf("split reported twice: %+v", info)
+	}
+
+	// The split is delivered to the webhooks and counted in the metrics.
+	recorder.waitDelivered(t, 1)
+	recorder.Lock()
+	payload := recorder.payloads[0]
+	recorder.Unlock()
+	var event webhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		t.Fatalf("unable to decode payload: %v", err)
+	}
+	if event.Type != webhookChainSplit || event.Height != 7 ||
+		event.ChainSplit == nil || !event.ChainSplit.Split ||
+		event.ChainSplit.DivergedPeers != 3 ||
+		len(event.ChainSplit.Tips) != 5 {
+
+		t.Fatalf("unexpected payload: %s", payload)
+	}
+	var buf bytes.Buffer
+	if err := m.WriteMetrics(&buf); err != nil {
+		t.Fatalf("WriteMetrics: unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"prova_chain_split_warnings_total 1\n",
+		"prova_chain_split_active 1\n",
+		"prova_chain_split_peers 4\n",
+		"prova_chain_split_diverged_peers 3\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("metrics missing %q:\n%s", want, buf.String())
+		}
+	}
+
+	// Splits are not detected while the chain is not synced with the
+	// peers, and the episode starts over once it is.
+	info, _ = check(t0.Add(time.Minute*3), false)
+	if info.Split || info.Warned || info.DivergingSince != 0 {
+		t.Fatalf("split detected while not current: %+v", info)
+	}
+	info, warn = check(t0.Add(time.Minute*4), true)
+	if warn || !info.Split || info.Warned ||
+		info.DivergingSince != t0.Add(time.Minute*4).Unix() {
+
+		t.Fatalf("unexpected summary after catching up: %+v", info)
+	}
+
+	// The split is resolved once the diverging peers disconnect.
+	m.RemovePeer(sps[1])
+	m.RemovePeer(sps[3])
+	info, _ = check(t0.Add(time.Minute*5), true)
+	if info.Split || info.Peers != 3 || info.KnownPeers != 2 ||
+		info.DivergedPeers != 1 {
+
+		t.Fatalf("unexpected summary once resolved: %+v", info)
+	}
+	buf.Reset()
+	if err := m.WriteMetrics(&buf); err != nil {
+		t.Fatalf("WriteMetrics: unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "prova_chain_split_active 0\n") {
+		t.Fatalf("split still active in metrics:\n%s", buf.String())
+	}
+
+	// The getchainsplitinfo RPC compares the peers through the block
+	// handler.
+	bm.msgChan = make(chan interface{})
+	bm.quit = make(chan struct{})
+	bm.wg.Add(1)
+	go bm.blockHandler()
+	result, err := handleGetChainSplitInfo(h.rpcServer,
+		&btcjson.GetChainSplitInfoCmd{}, nil)
+	close(bm.quit)
+	bm.wg.Wait()
+	if err != nil {
+		t.Fatalf("handleGetChainSplitInfo: unexpected error: %v", err)
+	}
+	info = result.(*btcjson.GetChainSplitInfoResult)
+	if !info.Current || info.Split || info.Peers != 3 ||
+		len(info.Tips) != 3 || info.Tips[0].Status != chainTipActive ||
+		info.Warnings != 1 {
+
+		t.Fatalf("unexpected getchainsplitinfo result: %+v", info)
+	}
+}
@@ -95,7 +95,8 @@ func (bi *blockImporter) readBlock() ([]byte, error) {
 // with any potential errors.
 func (bi *blockImporter) processBlock(serializedBlock []byte) (bool, error) {
 	// Deserialize the block which includes checks for malformed blocks.
-	block, err := provautil.NewBlockFromBytes(serializedBlock)
+	block, err := provautil.NewBlockFromBytesEncoding(serializedBlock,
+		activeNetParams.TxEncoding())
 	if err != nil {
 		return false, err
 	}
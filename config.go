@@ -9,24 +9,30 @@ import (
 	"bufio"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/bitgo/prova/addrmgr"
+	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/connmgr"
 	"github.com/bitgo/prova/database"
 	_ "github.com/bitgo/prova/database/ffldb"
 	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/mining"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
 	flags "github.com/btcsuite/go-flags"
@@ -42,23 +48,52 @@ const (
 	defaultMaxPeers              = 125
 	defaultBanDuration           = time.Hour * 24
 	defaultBanThreshold          = 100
+	defaultRejectWarnPeers       = 2
+	defaultChainSplitFraction    = 0.5
+	defaultChainSplitDepth       = 3
+	defaultChainSplitDuration    = time.Minute * 2
+	defaultThreadStuckBlocks     = 6
+	defaultMaxInvBatch           = 1000
+	defaultPeerQueueSize         = 50
+	defaultPeerTraceDirname      = "peertrace"
+	defaultPeerTraceMaxSize      = 16
+	defaultPeerTraceMaxFiles     = 8
+	defaultPeerEventLogDirname   = "peerevents"
+	defaultPeerEventLogMaxSize   = 64
+	defaultMinProtocolVersion    = wire.MultipleAddressVersion
 	defaultConnectTimeout        = time.Second * 30
 	defaultMaxRPCClients         = 10
 	defaultMaxRPCWebsockets      = 25
 	defaultMaxRPCConcurrentReqs  = 20
+	defaultRPCSlowThreshold      = time.Second * 10
+	defaultRPCMaxQuerySize       = 1024 * 1024
+	defaultRPCMaxSubmitSize      = wire.MaxBlockPayload*2 + 64*1024
+	defaultRPCRequestTimeout     = time.Minute
+	defaultRPCMaxRequests        = 64
+	defaultRPCMaxClientRequests  = 16
+	defaultRPCJobTTL             = time.Minute * 10
 	defaultDbType                = "ffldb"
 	defaultFreeTxRelayLimit      = 150.0
 	defaultBlockMinSize          = 500000
-	defaultBlockMaxSize          = 750000
+	defaultBlockMaxSize          = mining.DefaultBlockMaxSize
 	blockMaxSizeMin              = 1000
 	blockMaxSizeMax              = wire.MaxBlockPayload - 1000
 	defaultGenerate              = false
 	defaultMaxOrphanTransactions = 100
 	defaultMaxOrphanTxSize       = mempool.MaxStandardTxSize
+	defaultMempoolExpiry         = time.Hour * 336
 	defaultSigCacheMaxSize       = 100000
+	defaultScrubRate             = 100
+	defaultScrubInterval         = time.Hour * 24
+	defaultStatsInterval         = time.Minute * 5
+	defaultStatsRetention        = time.Hour * 72
+	defaultWebhookQueueSize      = 1000
+	webhookDeadLetterFilename    = "webhook-deadletter.log"
+	defaultBroadcastWorkers      = 4
 	sampleConfigFilename         = "sample-prova.conf"
 	defaultTxIndex               = false
 	defaultAddrIndex             = false
+	defaultIssuanceIndex         = false
 )
 
 var (
@@ -71,6 +106,15 @@ var (
 	defaultLogDir      = filepath.Join(defaultHomeDir, defaultLogDirname)
 )
 
+// serviceFlagsByName maps the service names accepted by the requireservice
+// option to the flags they represent.
+var serviceFlagsByName = map[string]wire.ServiceFlag{
+	"network":        wire.SFNodeNetwork,
+	"networklimited": wire.SFNodeNetworkLimited,
+	"getutxo":        wire.SFNodeGetUTXO,
+	"bloom":          wire.SFNodeBloom,
+}
+
 // runServiceCommand is only set to a real function on Windows.  It is used
 // to parse and execute service commands specified via the -s flag.
 var runServiceCommand func(string) error
@@ -95,11 +139,35 @@ type config struct {
 	AddPeers             []string      `short:"a" long:"addpeer" description:"Add a peer to connect with at startup"`
 	ConnectPeers         []string      `long:"connect" description:"Connect only to the specified peers at startup"`
 	DisableListen        bool          `long:"nolisten" description:"Disable listening for incoming connections -- NOTE: Listening is automatically disabled if the --connect or --proxy options are used without also specifying listen interfaces via --listen"`
+	OutboundOnly         bool          `long:"outboundonly" description:"Only connect to the peers specified with --connect and aggressively reconnect to them.  Listening, address advertisement, and answering address requests are disabled"`
+	NoAdvertise          bool          `long:"noadvertise" description:"Never announce the addresses this node listens on to peers, such as when it only accepts connections from known peers"`
+	PrivateNets          []string      `long:"privatenet" description:"Add a network in CIDR notation whose addresses are never relayed to peers, such as the internal network of a validator (eg. 10.1.0.0/16) -- Unroutable addresses are never relayed either"`
 	Listeners            []string      `long:"listen" description:"Add an interface/port to listen for connections (default all interfaces port: 8333, testnet: 18333)"`
 	MaxPeers             int           `long:"maxpeers" description:"Max number of inbound and outbound peers"`
 	DisableBanning       bool          `long:"nobanning" description:"Disable banning of misbehaving peers"`
 	BanDuration          time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	BanThreshold         uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
+	MinProtocolVersion   uint32        `long:"minprotocolversion" description:"Reject peers which advertise a lower protocol version"`
+	RequiredServices     []string      `long:"requireservice" description:"Reject outbound peers which do not advertise the given service and don't add them to the address manager {network, networklimited, getutxo, bloom}"`
+	RejectUserAgents     []string      `long:"rejectuseragent" description:"Reject peers whose user agent matches the given regular expression"`
+	DeprioritizeAgents   []string      `long:"deprioritizeuseragent" description:"Try peers whose user agent matched the given regular expression last when choosing outbound peers"`
+	MaxPayloads          []string      `long:"maxpayload" description:"Override the maximum payload size in bytes of messages with a command received from peers.  Format: '<command>:<bytes>'"`
+	StrictBlockDecoding  bool          `long:"strictblockdecoding" description:"Reject blocks received from peers which are not serialized canonically, such as blocks followed by trailing data"`
+	RejectWarnPeers      uint32        `long:"rejectwarnpeers" description:"Warn when a block produced by this node is rejected by more than this many peers"`
+	ChainSplitFraction   float64       `long:"chainsplitfraction" description:"Warn of a chain split when more than this fraction of the peers with a known best block diverge from the best chain"`
+	ChainSplitDepth      uint32        `long:"chainsplitdepth" description:"Number of blocks the best block of a peer must diverge from the best chain by for the peer to count towards a chain split"`
+	ChainSplitDuration   time.Duration `long:"chainsplitduration" description:"How long the peers must diverge from the best chain before a chain split is reported.  Valid time units are {s, m, h}"`
+	ThreadStuckBlocks    uint32        `long:"threadstuckblocks" description:"Warn when an admin thread has not advanced for more than this many blocks while admin transactions for it are pending in the mempool"`
+	TrickleInterval      time.Duration `long:"trickleinterval" description:"How long to wait between announcing batches of transaction inventory to each peer (default: the target time per block of the network / 300, between 100ms and 2s).  Valid time units are {ms, s, m}"`
+	MaxInvBatch          int           `long:"maxinvbatch" description:"Maximum number of inventory vectors announced to a peer in a single batch"`
+	PeerQueueSize        int           `long:"peerqueuesize" description:"Maximum number of messages and inventory vectors waiting to be sent to each peer before the queueing blocks"`
+	PeerTraceDir         string        `long:"peertracedir" description:"Directory to write the message captures of peers traced with the setpeertrace RPC to (default: peertrace in the data directory)"`
+	PeerTraceMaxSize     int64         `long:"peertracemaxsize" description:"Maximum size in MiB of each message capture file before moving on to a new one"`
+	PeerTraceMaxFiles    int           `long:"peertracemaxfiles" description:"Maximum number of message capture files kept for each traced peer -- 0 keeps all of them"`
+	PeerEventLog         bool          `long:"peereventlog" description:"Write the peer, direction, command, size, and time of the messages exchanged with all peers to a compact binary event log for offline analysis"`
+	PeerEventLogDir      string        `long:"peereventlogdir" description:"Directory to write the peer event log to (default: peerevents in the data directory)"`
+	PeerEventLogMaxSize  int64         `long:"peereventlogmaxsize" description:"Maximum size in MiB of all of the peer event log files -- the oldest files are removed to stay within it"`
+	RetainBlocks         uint32        `long:"retainblocks" description:"Only serve the specified number of most recent blocks to peers and advertise limited block history instead of full history (minimum: 288) -- 0 serves all blocks"`
 	RPCUser              string        `short:"u" long:"rpcuser" description:"Username for RPC connections"`
 	RPCPass              string        `short:"P" long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
 	RPCLimitUser         string        `long:"rpclimituser" description:"Username for limited RPC connections"`
@@ -110,9 +178,25 @@ type config struct {
 	RPCMaxClients        int           `long:"rpcmaxclients" description:"Max number of RPC clients for standard connections"`
 	RPCMaxWebsockets     int           `long:"rpcmaxwebsockets" description:"Max number of RPC websocket connections"`
 	RPCMaxConcurrentReqs int           `long:"rpcmaxconcurrentreqs" description:"Max number of concurrent RPC requests that may be processed concurrently"`
+	RPCSlowThreshold     time.Duration `long:"rpcslowthreshold" description:"Log RPC calls which take longer than this to complete, 0 to disable.  Valid time units are {ms, s, m, h}"`
+	RPCMaxQuerySize      int64         `long:"rpcmaxquerysize" description:"Max size in bytes of RPC requests other than those carrying serialized blocks or transactions"`
+	RPCMaxSubmitSize     int64         `long:"rpcmaxsubmitsize" description:"Max size in bytes of RPC requests carrying serialized blocks or transactions, such as submitblock and sendrawtransaction"`
+	RPCRequestTimeout    time.Duration `long:"rpcrequesttimeout" description:"Abort RPC requests which take longer than this to complete, except getblocktemplate, generate and verifychain, 0 to disable.  Valid time units are {ms, s, m, h}"`
+	RPCMaxRequests       int           `long:"rpcmaxrequests" description:"Max number of RPC requests serviced at once across all clients, 0 for no limit"`
+	RPCMaxClientRequests int           `long:"rpcmaxclientrequests" description:"Max number of RPC requests serviced at once for each client address, 0 for no limit"`
+	RPCJobTTL            time.Duration `long:"rpcjobttl" description:"Keep the results of RPC jobs started with startjob for this long after they finish.  Valid time units are {ms, s, m, h}"`
 	RPCQuirks            bool          `long:"rpcquirks" description:"Mirror some JSON-RPC quirks of Bitcoin Core -- NOTE: Discouraged unless interoperability issues need to be worked around"`
 	DisableRPC           bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass or rpclimituser/rpclimitpass is specified"`
-	DisableTLS           bool          `long:"notls" description:"Disable TLS for the RPC server -- NOTE: This is only allowed if the RPC server is bound to localhost"`
+	DisableTLS           bool          `long:"notls" description:"Disable TLS for the RPC and gRPC servers -- NOTE: This is only allowed if the servers are bound to localhost"`
+	GRPCListeners        []string      `long:"grpclisten" description:"Add an interface/port to listen for gRPC connections (default port: 8335, testnet: 18335) -- NOTE: The gRPC server is disabled unless at least one interface is specified"`
+	GRPCToken            string        `long:"grpctoken" default-mask:"-" description:"Bearer token for gRPC connections"`
+	GRPCLimitToken       string        `long:"grpclimittoken" default-mask:"-" description:"Bearer token for limited gRPC connections"`
+	ReplicateFrom        string        `long:"replicatefrom" description:"Run as a hot standby which follows the main chain of the primary node with the gRPC server at this interface/port instead of syncing from peers, until the standby diverges from it (default port: 8335, testnet: 18335)"`
+	ReplicationToken     string        `long:"replicationtoken" default-mask:"-" description:"Admin bearer token for the gRPC server of the --replicatefrom primary"`
+	ReplicationCert      string        `long:"replicationcert" description:"File containing the certificate of the gRPC server of the --replicatefrom primary -- NOTE: Required unless the primary is on localhost"`
+	ReplicationValidate  bool          `long:"replicationvalidate" description:"Fully validate the blocks of the --replicatefrom primary instead of trusting its validation"`
+	DebugListeners       []string      `long:"debuglisten" description:"Add an interface/port to serve pprof and read-only chain, mempool, peer and admin state snapshots over HTTP (default port: 8336, testnet: 18336) -- NOTE: The debug server is disabled unless at least one interface is specified"`
+	DebugAllowRemote     bool          `long:"debugallowremote" description:"Allow the debug server to listen on interfaces other than localhost -- NOTE: The debug server has no authentication"`
 	DisableDNSSeed       bool          `long:"nodnsseed" description:"Disable DNS seeding for peers"`
 	ExternalIPs          []string      `long:"externalip" description:"Add an ip to the list of local addresses we claim to listen on to peers"`
 	Proxy                string        `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
@@ -122,12 +206,16 @@ type config struct {
 	OnionProxyUser       string        `long:"onionuser" description:"Username for onion proxy server"`
 	OnionProxyPass       string        `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
 	NoOnion              bool          `long:"noonion" description:"Disable connecting to tor hidden services"`
+	OnlyNets             []string      `long:"onlynet" description:"Only connect to peers on this network (ipv4, ipv6, or onion) -- may be specified multiple times"`
+	PreferNet            string        `long:"prefernet" description:"Connect to peers on this network (ipv4, ipv6, or onion) more often than to peers on other networks"`
 	TorIsolation         bool          `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
 	TestNet              bool          `long:"testnet" description:"Use the test network"`
 	RegressionTest       bool          `long:"regtest" description:"Use the regression test network"`
 	SimNet               bool          `long:"simnet" description:"Use the simulation test network"`
+	PowOnly              bool          `long:"powonly" description:"Accept blocks on proof of work alone without requiring validate key signatures, so blocks can be mined with the CPU -- Only valid with regtest or simnet"`
 	AddCheckpoints       []string      `long:"addcheckpoint" description:"Add a custom checkpoint.  Format: '<height>:<hash>'"`
 	DbType               string        `long:"dbtype" description:"Database backend to use for the Block Chain"`
+	ReadOnly             bool          `long:"readonly" description:"Open the existing block database without modifying it, such as to inspect a copy of a data directory -- Disables peer-to-peer networking, the memory pool, mining, and RPCs which modify the chain"`
 	Profile              string        `long:"profile" description:"Enable HTTP profiling on given port -- NOTE port must be between 1024 and 65536"`
 	CPUProfile           string        `long:"cpuprofile" description:"Write CPU profile to the specified file"`
 	DebugLevel           string        `short:"d" long:"debuglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
@@ -136,26 +224,51 @@ type config struct {
 	FreeTxRelayLimit     float64       `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
 	RelayPriority        bool          `long:"relaypriority" description:"Require free or low-fee transactions to have high priority for relaying"`
 	MaxOrphanTxs         int           `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
+	MempoolExpiry        time.Duration `long:"mempoolexpiry" description:"How long an unconfirmed transaction may stay in the mempool before it is evicted along with the transactions which depend on it -- Admin and prioritised transactions never expire.  Valid time units are {s, m, h}.  0 disables expiry"`
 	Generate             bool          `long:"generate" description:"Generate (mine) blocks using the CPU"`
 	MiningAddrs          []string      `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
+	BlockSignerURL       string        `long:"blocksignerurl" description:"URL of a remote signing service, such as one backed by an HSM, to request signatures of generated blocks from instead of using local validate keys"`
+	BlockSignerPubKeys   []string      `long:"blocksignerpubkey" description:"Add the hex-encoded compressed public key of a validate key held by the remote block signer -- At least one is required if the blocksignerurl option is set"`
+	BlockSignerTimeout   time.Duration `long:"blocksignertimeout" description:"How long to wait for the remote block signer to sign a block.  Valid time units are {s, m, h}"`
 	BlockMinSize         uint32        `long:"blockminsize" description:"Mininum block size in bytes to be used when creating a block"`
 	BlockMaxSize         uint32        `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
 	BlockPrioritySize    uint32        `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
 	NoPeerBloomFilters   bool          `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
 	SigCacheMaxSize      uint          `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
+	SigVerifyWorkers     int           `long:"sigverifyworkers" description:"Number of goroutines used to verify the scripts of blocks and transactions -- 0 selects a number based on the number of processor cores"`
+	ScrubRate            uint32        `long:"scrubrate" description:"Maximum number of stored blocks per second to verify against their checksums in the background -- 0 disables background scrubbing"`
+	ScrubInterval        time.Duration `long:"scrubinterval" description:"How long to wait between background scrubs of the stored blocks.  Valid time units are {s, m, h}.  Minimum 1 second"`
+	StatsInterval        time.Duration `long:"statsinterval" description:"How often to record the mempool, cache and peer statistics returned by the getstatshistory RPC.  Valid time units are {s, m, h} -- 0 disables recording"`
+	StatsRetention       time.Duration `long:"statsretention" description:"How long to keep the recorded mempool, cache and peer statistics.  Valid time units are {s, m, h}.  May not be less than statsinterval"`
+	Webhooks             []string      `long:"webhook" description:"Add an HTTP endpoint to deliver block connected, block disconnected, admin key change, watched spend, chain split, stuck admin thread, and double sign notifications to"`
+	WebhookSecret        string        `long:"webhooksecret" description:"Secret used to sign webhook payloads with HMAC-SHA256 -- Required when any webhooks are configured"`
+	WebhookQueueSize     int           `long:"webhookqueuesize" description:"Maximum number of notifications waiting to be delivered to each webhook endpoint"`
+	BroadcastURLs        []string      `long:"broadcasturl" description:"Add an HTTP endpoint to submit the raw blocks produced by this node to, in addition to relaying them to peers"`
+	BroadcastWorkers     int           `long:"broadcastworkers" description:"Maximum number of block submissions to broadcast endpoints in progress at once"`
 	BlocksOnly           bool          `long:"blocksonly" description:"Do not accept transactions from remote peers."`
 	TxIndex              bool          `long:"txindex" description:"Maintain a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
 	DropTxIndex          bool          `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
 	AddrIndex            bool          `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
 	DropAddrIndex        bool          `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
+	IssuanceIndex        bool          `long:"issuanceindex" description:"Maintain an index of the outputs created by issuances and the inputs consumed by destructions along with the ISSUE keys which authorized them"`
+	DropIssuanceIndex    bool          `long:"dropissuanceindex" description:"Deletes the issuance index from the database on start up and then exits."`
 	RelayNonStd          bool          `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
 	RejectNonStd         bool          `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
+	RejectNonCanonical   bool          `long:"rejectnoncanonical" description:"Reject transactions whose inputs and outputs are not in the canonical BIP 69 order -- Admin transactions are exempt"`
 	lookup               func(string) ([]net.IP, error)
 	oniondial            func(string, string, time.Duration) (net.Conn, error)
 	dial                 func(string, string, time.Duration) (net.Conn, error)
 	addCheckpoints       []chaincfg.Checkpoint
 	miningAddrs          []provautil.Address
+	blockSignerPubKeys   []*btcec.PublicKey
 	minRelayTxFee        provautil.Amount
+	requiredServices     wire.ServiceFlag
+	rejectUserAgents     []*regexp.Regexp
+	deprioritizeAgents   []*regexp.Regexp
+	privateNets          []*net.IPNet
+	onlyNets             []addrmgr.Network
+	preferNet            addrmgr.Network
+	maxPayloadOverrides  map[string]uint32
 }
 
 // serviceOptions defines the configuration options for the daemon as a service on
@@ -297,6 +410,20 @@ func normalizeAddress(addr, defaultPort string) string {
 	return addr
 }
 
+// allowsNet returns whether the --onlynet options allow connecting to peers on
+// the passed network, which is the case for every network when none are given.
+func (c *config) allowsNet(n addrmgr.Network) bool {
+	if len(c.onlyNets) == 0 {
+		return true
+	}
+	for _, onlyNet := range c.onlyNets {
+		if onlyNet == n {
+			return true
+		}
+	}
+	return false
+}
+
 // normalizeAddresses returns a new slice with all the passed peer addresses
 // normalized with the given default port, and all duplicates removed.
 func normalizeAddresses(addrs []string, defaultPort string) []string {
@@ -355,6 +482,37 @@ func parseCheckpoints(checkpointStrings []string) ([]chaincfg.Checkpoint, error)
 	return checkpoints, nil
 }
 
+// parseMaxPayloadOverrides checks the maximum payload override strings for
+// valid syntax ('<command>:<bytes>') and parses them to a map of the maximum
+// payload sizes by command.  The commands must be supported by the wire package
+// and the sizes may not exceed the maximum message payload.
+func parseMaxPayloadOverrides(overrideStrings []string) (map[string]uint32, error) {
+	if len(overrideStrings) == 0 {
+		return nil, nil
+	}
+	overrides := make(map[string]uint32, len(overrideStrings))
+	for _, override := range overrideStrings {
+		parts := strings.Split(override, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("unable to parse maximum payload "+
+				"%q -- use the syntax <command>:<bytes>", override)
+		}
+		command := parts[0]
+		if _, err := wire.MaxCommandPayload(command, 0); err != nil {
+			return nil, fmt.Errorf("unable to parse maximum payload "+
+				"%q due to unsupported command", override)
+		}
+		size, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil || size > wire.MaxMessagePayload {
+			return nil, fmt.Errorf("unable to parse maximum payload "+
+				"%q due to malformed size -- the maximum is %d",
+				override, wire.MaxMessagePayload)
+		}
+		overrides[command] = uint32(size)
+	}
+	return overrides, nil
+}
+
 // filesExists reports whether the named file or directory exists.
 func fileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
@@ -394,9 +552,27 @@ func loadConfig() (*config, []string, error) {
 		MaxPeers:             defaultMaxPeers,
 		BanDuration:          defaultBanDuration,
 		BanThreshold:         defaultBanThreshold,
+		RejectWarnPeers:      defaultRejectWarnPeers,
+		ChainSplitFraction:   defaultChainSplitFraction,
+		ChainSplitDepth:      defaultChainSplitDepth,
+		ChainSplitDuration:   defaultChainSplitDuration,
+		ThreadStuckBlocks:    defaultThreadStuckBlocks,
+		MaxInvBatch:          defaultMaxInvBatch,
+		PeerQueueSize:        defaultPeerQueueSize,
+		PeerTraceMaxSize:     defaultPeerTraceMaxSize,
+		PeerTraceMaxFiles:    defaultPeerTraceMaxFiles,
+		PeerEventLogMaxSize:  defaultPeerEventLogMaxSize,
+		MinProtocolVersion:   defaultMinProtocolVersion,
 		RPCMaxClients:        defaultMaxRPCClients,
 		RPCMaxWebsockets:     defaultMaxRPCWebsockets,
 		RPCMaxConcurrentReqs: defaultMaxRPCConcurrentReqs,
+		RPCSlowThreshold:     defaultRPCSlowThreshold,
+		RPCMaxQuerySize:      defaultRPCMaxQuerySize,
+		RPCMaxSubmitSize:     defaultRPCMaxSubmitSize,
+		RPCRequestTimeout:    defaultRPCRequestTimeout,
+		RPCMaxRequests:       defaultRPCMaxRequests,
+		RPCMaxClientRequests: defaultRPCMaxClientRequests,
+		RPCJobTTL:            defaultRPCJobTTL,
 		DataDir:              defaultDataDir,
 		LogDir:               defaultLogDir,
 		DbType:               defaultDbType,
@@ -408,10 +584,19 @@ func loadConfig() (*config, []string, error) {
 		BlockMaxSize:         defaultBlockMaxSize,
 		BlockPrioritySize:    mempool.DefaultBlockPrioritySize,
 		MaxOrphanTxs:         defaultMaxOrphanTransactions,
+		MempoolExpiry:        defaultMempoolExpiry,
 		SigCacheMaxSize:      defaultSigCacheMaxSize,
+		ScrubRate:            defaultScrubRate,
+		ScrubInterval:        defaultScrubInterval,
+		StatsInterval:        defaultStatsInterval,
+		StatsRetention:       defaultStatsRetention,
+		WebhookQueueSize:     defaultWebhookQueueSize,
+		BroadcastWorkers:     defaultBroadcastWorkers,
+		BlockSignerTimeout:   mining.DefaultRemoteSignerTimeout,
 		Generate:             defaultGenerate,
 		TxIndex:              defaultTxIndex,
 		AddrIndex:            defaultAddrIndex,
+		IssuanceIndex:        defaultIssuanceIndex,
 	}
 
 	// Service options which are only added on Windows.
@@ -538,6 +723,25 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Accept blocks on proof of work alone when requested.  This is only
+	// allowed on the regression and simulation test networks, and the
+	// shared network parameters are copied rather than modified.
+	if cfg.PowOnly {
+		if !(cfg.RegressionTest || cfg.SimNet) {
+			str := "%s: The powonly option is only allowed with " +
+				"the regtest and simnet networks"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		chainParams := *activeNetParams.Params
+		chainParams.PowOnly = true
+		netParams := *activeNetParams
+		netParams.Params = &chainParams
+		activeNetParams = &netParams
+	}
+
 	// Set the default policy for relaying non-standard transactions
 	// according to the default of the active network. The set
 	// configuration value takes precedence over the default value for the
@@ -572,6 +776,24 @@ func loadConfig() (*config, []string, error) {
 	cfg.LogDir = cleanAndExpandPath(cfg.LogDir)
 	cfg.LogDir = filepath.Join(cfg.LogDir, activeNetParams.Name)
 
+	// Write peer message captures to the data directory unless another
+	// directory is specified.
+	if cfg.PeerTraceDir == "" {
+		cfg.PeerTraceDir = filepath.Join(cfg.DataDir,
+			defaultPeerTraceDirname)
+	} else {
+		cfg.PeerTraceDir = cleanAndExpandPath(cfg.PeerTraceDir)
+	}
+
+	// Write the peer event log to the data directory unless another
+	// directory is specified.
+	if cfg.PeerEventLogDir == "" {
+		cfg.PeerEventLogDir = filepath.Join(cfg.DataDir,
+			defaultPeerEventLogDirname)
+	} else {
+		cfg.PeerEventLogDir = cleanAndExpandPath(cfg.PeerEventLogDir)
+	}
+
 	// Special show command to list supported subsystems and exit.
 	if cfg.DebugLevel == "show" {
 		fmt.Println("Supported subsystems", supportedSubsystems())
@@ -621,6 +843,300 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// The chain split fraction is a fraction of the peers.
+	if cfg.ChainSplitFraction <= 0 || cfg.ChainSplitFraction > 1 {
+		str := "%s: The chainsplitfraction option must be greater than 0 " +
+			"and at most 1 -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.ChainSplitFraction)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.ChainSplitDuration < 0 {
+		str := "%s: The chainsplitduration option may not be negative " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.ChainSplitDuration)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// An admin thread must have had the chance to advance in at least one
+	// block before it is considered stuck.
+	if cfg.ThreadStuckBlocks < 1 {
+		str := "%s: The threadstuckblocks option may not be less than 1 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.ThreadStuckBlocks)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Don't allow negative trickle intervals.  Zero selects the default
+	// of the network.
+	if cfg.TrickleInterval < 0 {
+		str := "%s: The trickleinterval option may not be negative -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.TrickleInterval)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The inventory batches must fit in a single inv message.
+	if cfg.MaxInvBatch < 1 || cfg.MaxInvBatch > wire.MaxInvPerMsg {
+		str := "%s: The maxinvbatch option must be in range [1, %d] " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, wire.MaxInvPerMsg,
+			cfg.MaxInvBatch)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.PeerQueueSize < 1 {
+		str := "%s: The peerqueuesize option may not be less than 1 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.PeerQueueSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.PeerTraceMaxSize < 1 {
+		str := "%s: The peertracemaxsize option may not be less than 1 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.PeerTraceMaxSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.PeerTraceMaxFiles < 0 {
+		str := "%s: The peertracemaxfiles option may not be negative " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.PeerTraceMaxFiles)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.PeerEventLogMaxSize < 1 {
+		str := "%s: The peereventlogmaxsize option may not be less " +
+			"than 1 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.PeerEventLogMaxSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Peers which advertise limited block history are expected to serve at
+	// least the minimum number of recent blocks.
+	if cfg.RetainBlocks != 0 &&
+		cfg.RetainBlocks < wire.NodeNetworkLimitedMinBlocks {
+
+		str := "%s: The retainblocks option may not be less than %d " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, wire.NodeNetworkLimitedMinBlocks,
+			cfg.RetainBlocks)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Don't allow scrub intervals that are too short.
+	if cfg.ScrubInterval < time.Second {
+		str := "%s: The scrubinterval option may not be less than 1s -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.ScrubInterval)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Don't allow negative stats intervals or retention periods which are
+	// shorter than the interval since no samples would be kept.
+	if cfg.StatsInterval < 0 {
+		str := "%s: The statsinterval option may not be negative -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.StatsInterval)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.StatsInterval != 0 && cfg.StatsRetention < cfg.StatsInterval {
+		str := "%s: The statsretention option may not be less than " +
+			"the statsinterval option -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.StatsRetention)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Don't allow minimum protocol versions which are higher than the
+	// protocol version used by the server since it could not connect to
+	// any peers.
+	if cfg.MinProtocolVersion > wire.FeeFilterVersion {
+		str := "%s: The minprotocolversion option may not be higher " +
+			"than %d -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, wire.FeeFilterVersion,
+			cfg.MinProtocolVersion)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Check the required services are known and save the combined flags.
+	for _, name := range cfg.RequiredServices {
+		flag, ok := serviceFlagsByName[name]
+		if !ok {
+			str := "%s: The requireservice option must be one of " +
+				"network, networklimited, getutxo, or bloom -- " +
+				"parsed [%s]"
+			err := fmt.Errorf(str, funcName, name)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.requiredServices |= flag
+	}
+
+	// Check the user agent patterns are valid regular expressions and save
+	// the compiled versions.
+	for _, pattern := range cfg.RejectUserAgents {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			str := "%s: The rejectuseragent option '%s' is not a " +
+				"valid regular expression: %v"
+			err := fmt.Errorf(str, funcName, pattern, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.rejectUserAgents = append(cfg.rejectUserAgents, re)
+	}
+	for _, pattern := range cfg.DeprioritizeAgents {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			str := "%s: The deprioritizeuseragent option '%s' is not " +
+				"a valid regular expression: %v"
+			err := fmt.Errorf(str, funcName, pattern, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.deprioritizeAgents = append(cfg.deprioritizeAgents, re)
+	}
+
+	// Check the private networks are valid and save the parsed versions.
+	for _, cidr := range cfg.PrivateNets {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			str := "%s: The privatenet option '%s' is not a valid " +
+				"network in CIDR notation: %v"
+			err := fmt.Errorf(str, funcName, cidr, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.privateNets = append(cfg.privateNets, ipNet)
+	}
+
+	// Don't allow negative slow RPC call thresholds.
+	if cfg.RPCSlowThreshold < 0 {
+		str := "%s: The rpcslowthreshold option may not be negative -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.RPCSlowThreshold)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Don't allow negative RPC job result lifetimes.
+	if cfg.RPCJobTTL < 0 {
+		str := "%s: The rpcjobttl option may not be negative -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.RPCJobTTL)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The RPC request size limits must allow some requests, and the
+	// request timeout and limits on concurrent requests may not be
+	// negative.
+	if cfg.RPCMaxQuerySize <= 0 || cfg.RPCMaxSubmitSize <= 0 {
+		str := "%s: The rpcmaxquerysize and rpcmaxsubmitsize options " +
+			"must be positive -- parsed [%d] and [%d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCMaxQuerySize,
+			cfg.RPCMaxSubmitSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.RPCRequestTimeout < 0 {
+		str := "%s: The rpcrequesttimeout option may not be negative -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.RPCRequestTimeout)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.RPCMaxRequests < 0 || cfg.RPCMaxClientRequests < 0 {
+		str := "%s: The rpcmaxrequests and rpcmaxclientrequests " +
+			"options may not be negative -- parsed [%d] and [%d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCMaxRequests,
+			cfg.RPCMaxClientRequests)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Webhook payloads must be signed and delivered to valid HTTP
+	// endpoints.
+	if len(cfg.Webhooks) > 0 && cfg.WebhookSecret == "" {
+		str := "%s: the --webhooksecret option is required when webhooks " +
+			"are configured"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	for _, webhook := range cfg.Webhooks {
+		u, err := url.Parse(webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+			u.Host == "" {
+
+			str := "%s: The webhook option must be an http or https " +
+				"URL -- parsed [%s]"
+			err := fmt.Errorf(str, funcName, webhook)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+	if cfg.WebhookQueueSize < 1 {
+		str := "%s: The webhookqueuesize option may not be less than 1 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.WebhookQueueSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Blocks may only be broadcast to valid HTTP endpoints.
+	for _, broadcastURL := range cfg.BroadcastURLs {
+		u, err := url.Parse(broadcastURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+			u.Host == "" {
+
+			str := "%s: The broadcasturl option must be an http or " +
+				"https URL -- parsed [%s]"
+			err := fmt.Errorf(str, funcName, broadcastURL)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+	if cfg.BroadcastWorkers < 1 {
+		str := "%s: The broadcastworkers option may not be less than 1 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.BroadcastWorkers)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// --addPeer and --connect do not mix.
 	if len(cfg.AddPeers) > 0 && len(cfg.ConnectPeers) > 0 {
 		str := "%s: the --addpeer and --connect options can not be " +
@@ -631,6 +1147,53 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --readonly does not mix with options which require modifying the
+	// database or connecting to peers.
+	if cfg.ReadOnly && (cfg.Generate || cfg.DropTxIndex ||
+		cfg.DropAddrIndex || cfg.DropIssuanceIndex ||
+		len(cfg.AddPeers) > 0 || len(cfg.ConnectPeers) > 0) {
+
+		str := "%s: the --readonly option may not be used with the " +
+			"--generate, --droptxindex, --dropaddrindex, " +
+			"--dropissuanceindex, --addpeer, or --connect options"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Read-only mode disables peer-to-peer networking since the blocks and
+	// transactions received from peers can't be processed.
+	if cfg.ReadOnly {
+		cfg.DisableListen = true
+		cfg.DisableDNSSeed = true
+	}
+
+	// --outboundonly only ever dials the --connect peers and is never
+	// reachable by other peers, so it requires --connect and does not mix
+	// with options which make the node reachable.
+	if cfg.OutboundOnly && len(cfg.ConnectPeers) == 0 {
+		str := "%s: the --outboundonly option requires the --connect " +
+			"option"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.OutboundOnly && (len(cfg.Listeners) > 0 || cfg.Upnp ||
+		len(cfg.ExternalIPs) > 0) {
+
+		str := "%s: the --outboundonly option may not be used with the " +
+			"--listen, --upnp, or --externalip options"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.OutboundOnly {
+		cfg.DisableListen = true
+	}
+
 	// --proxy or --connect without --listen disables listening.
 	if (cfg.Proxy != "" || len(cfg.ConnectPeers) > 0) &&
 		len(cfg.Listeners) == 0 {
@@ -690,6 +1253,46 @@ func loadConfig() (*config, []string, error) {
 		}
 	}
 
+	// The gRPC server serves the same commands as the RPC server, so it
+	// can only be enabled along with it, and it requires a token.
+	if len(cfg.GRPCListeners) > 0 {
+		if cfg.DisableRPC {
+			str := "%s: the --grpclisten option requires the RPC " +
+				"server to be enabled"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.GRPCToken == "" && cfg.GRPCLimitToken == "" {
+			str := "%s: the --grpclisten option requires " +
+				"--grpctoken or --grpclimittoken"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.GRPCToken == cfg.GRPCLimitToken {
+			str := "%s: --grpctoken and --grpclimittoken must not " +
+				"specify the same token"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// The debug server is built from the same snapshots as the RPC server,
+	// so it can only be enabled along with it.
+	if len(cfg.DebugListeners) > 0 && cfg.DisableRPC {
+		str := "%s: the --debuglisten option requires the RPC server " +
+			"to be enabled"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Validate the the minrelaytxfee.
 	cfg.minRelayTxFee, err = provautil.NewAmount(cfg.MinRelayTxFee)
 	if err != nil {
@@ -723,6 +1326,26 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Don't allow a negative number of signature verification workers.
+	if cfg.SigVerifyWorkers < 0 {
+		str := "%s: The sigverifyworkers option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.SigVerifyWorkers)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Don't allow negative mempool expiry times.
+	if cfg.MempoolExpiry < 0 {
+		str := "%s: The mempoolexpiry option may not be less than 0 " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.MempoolExpiry)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the block priority and minimum block sizes to max block size.
 	cfg.BlockPrioritySize = minUint32(cfg.BlockPrioritySize, cfg.BlockMaxSize)
 	cfg.BlockMinSize = minUint32(cfg.BlockMinSize, cfg.BlockMaxSize)
@@ -759,6 +1382,27 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --issuanceindex and --dropissuanceindex do not mix.
+	if cfg.IssuanceIndex && cfg.DropIssuanceIndex {
+		err := fmt.Errorf("%s: the --issuanceindex and "+
+			"--dropissuanceindex options may not be activated at "+
+			"the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --issuanceindex and --droptxindex do not mix.
+	if cfg.IssuanceIndex && cfg.DropTxIndex {
+		err := fmt.Errorf("%s: the --issuanceindex and --droptxindex "+
+			"options may not be activated at the same time "+
+			"because the issuance index relies on the transaction "+
+			"index", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	cfg.miningAddrs = make([]provautil.Address, 0, len(cfg.MiningAddrs))
 	for _, strAddr := range cfg.MiningAddrs {
@@ -791,6 +1435,61 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Check the remote block signer is a valid HTTP endpoint with at least
+	// one valid public key and save the parsed keys.
+	if cfg.BlockSignerURL != "" {
+		u, err := url.Parse(cfg.BlockSignerURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+			u.Host == "" {
+
+			str := "%s: The blocksignerurl option must be an http or " +
+				"https URL -- parsed [%s]"
+			err := fmt.Errorf(str, funcName, cfg.BlockSignerURL)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if len(cfg.BlockSignerPubKeys) == 0 {
+			str := "%s: the blocksignerurl option is set, but there " +
+				"are no block signer public keys specified"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	} else if len(cfg.BlockSignerPubKeys) > 0 {
+		str := "%s: the blocksignerpubkey option requires the " +
+			"blocksignerurl option"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	for _, strPubKey := range cfg.BlockSignerPubKeys {
+		pubKeyBytes, err := hex.DecodeString(strPubKey)
+		var pubKey *btcec.PublicKey
+		if err == nil {
+			pubKey, err = btcec.ParsePubKey(pubKeyBytes, btcec.S256())
+		}
+		if err != nil {
+			str := "%s: block signer public key '%s' failed to " +
+				"decode: %v"
+			err := fmt.Errorf(str, funcName, strPubKey, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.blockSignerPubKeys = append(cfg.blockSignerPubKeys, pubKey)
+	}
+	if cfg.BlockSignerTimeout <= 0 {
+		str := "%s: The blocksignertimeout option must be positive " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.BlockSignerTimeout)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Add default port to all listener addresses if needed and remove
 	// duplicate addresses.
 	cfg.Listeners = normalizeAddresses(cfg.Listeners,
@@ -801,15 +1500,57 @@ func loadConfig() (*config, []string, error) {
 	cfg.RPCListeners = normalizeAddresses(cfg.RPCListeners,
 		activeNetParams.rpcPort)
 
-	// Only allow TLS to be disabled if the RPC is bound to localhost
-	// addresses.
+	// Add default port to all grpc listener addresses if needed and remove
+	// duplicate addresses.
+	cfg.GRPCListeners = normalizeAddresses(cfg.GRPCListeners,
+		activeNetParams.grpcPort)
+
+	// Add default port to all debug listener addresses if needed and remove
+	// duplicate addresses.  The debug server has no authentication, so it
+	// only listens on localhost unless explicitly allowed otherwise.
+	cfg.DebugListeners = normalizeAddresses(cfg.DebugListeners,
+		activeNetParams.debugPort)
+	if !cfg.DebugAllowRemote {
+		localhostListeners := map[string]struct{}{
+			"localhost": {},
+			"127.0.0.1": {},
+			"::1":       {},
+		}
+		for _, addr := range cfg.DebugListeners {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				str := "%s: debug listen interface '%s' is " +
+					"invalid: %v"
+				err := fmt.Errorf(str, funcName, addr, err)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+			if _, ok := localhostListeners[host]; !ok {
+				str := "%s: the debug server may only listen on " +
+					"localhost unless --debugallowremote is " +
+					"specified, got '%s'"
+				err := fmt.Errorf(str, funcName, addr)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+		}
+	}
+
+	// Only allow TLS to be disabled if the RPC and gRPC servers are bound
+	// to localhost addresses.
 	if !cfg.DisableRPC && cfg.DisableTLS {
 		allowedTLSListeners := map[string]struct{}{
 			"localhost": {},
 			"127.0.0.1": {},
 			"::1":       {},
 		}
-		for _, addr := range cfg.RPCListeners {
+		listeners := make([]string, 0, len(cfg.RPCListeners)+
+			len(cfg.GRPCListeners))
+		listeners = append(listeners, cfg.RPCListeners...)
+		listeners = append(listeners, cfg.GRPCListeners...)
+		for _, addr := range listeners {
 			host, _, err := net.SplitHostPort(addr)
 			if err != nil {
 				str := "%s: RPC listen interface '%s' is " +
@@ -831,6 +1572,55 @@ func loadConfig() (*config, []string, error) {
 		}
 	}
 
+	// A hot standby follows the primary with an admin token since the
+	// replication stream is admin-only.  The stream carries the chain the
+	// standby adds without validating, so it requires TLS unless the
+	// primary is on localhost.  Read-only mode can't add blocks at all.
+	if cfg.ReplicateFrom != "" {
+		if cfg.ReadOnly {
+			str := "%s: the --replicatefrom option may not be used " +
+				"with the --readonly option"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.ReplicationToken == "" {
+			str := "%s: the --replicatefrom option requires " +
+				"--replicationtoken"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.ReplicateFrom = normalizeAddress(cfg.ReplicateFrom,
+			activeNetParams.grpcPort)
+		host, _, err := net.SplitHostPort(cfg.ReplicateFrom)
+		if err != nil {
+			str := "%s: replication address '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, cfg.ReplicateFrom, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		switch host {
+		case "localhost", "127.0.0.1", "::1":
+		default:
+			if cfg.ReplicationCert == "" {
+				str := "%s: the --replicatefrom option requires " +
+					"--replicationcert unless the primary is " +
+					"on localhost"
+				err := fmt.Errorf(str, funcName)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+		}
+		if cfg.ReplicationCert != "" {
+			cfg.ReplicationCert = cleanAndExpandPath(cfg.ReplicationCert)
+		}
+	}
+
 	// Add default port to all added peer addresses if needed and remove
 	// duplicate addresses.
 	cfg.AddPeers = normalizeAddresses(cfg.AddPeers,
@@ -847,6 +1637,38 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Parse the networks to only connect to and the network to prefer,
+	// which must be one of them.
+	for _, name := range cfg.OnlyNets {
+		n, err := addrmgr.ParseNetwork(name)
+		if err != nil {
+			str := "%s: Error parsing onlynet option: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.onlyNets = append(cfg.onlyNets, n)
+	}
+	if cfg.PreferNet != "" {
+		cfg.preferNet, err = addrmgr.ParseNetwork(cfg.PreferNet)
+		if err != nil {
+			str := "%s: Error parsing prefernet option: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if !cfg.allowsNet(cfg.preferNet) {
+			str := "%s: the --prefernet network %s is not one of " +
+				"the --onlynet networks"
+			err := fmt.Errorf(str, funcName, cfg.preferNet)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Check the checkpoints for syntax errors.
 	cfg.addCheckpoints, err = parseCheckpoints(cfg.AddCheckpoints)
 	if err != nil {
@@ -857,6 +1679,16 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Parse the maximum payload overrides.
+	cfg.maxPayloadOverrides, err = parseMaxPayloadOverrides(cfg.MaxPayloads)
+	if err != nil {
+		str := "%s: Error parsing maxpayload option: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Tor stream isolation requires either proxy or onion proxy to be set.
 	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
 		str := "%s: Tor stream isolation requires either proxy or " +
@@ -70,3 +70,33 @@ func TestCreateDefaultConfigFile(t *testing.T) {
 		t.Error("Could not find rpcpass in generated default config file.")
 	}
 }
+
+// TestParseMaxPayloadOverrides ensures the maximum payload overrides are parsed
+// by command and that malformed overrides, unsupported commands, and sizes over
+// the maximum message payload are rejected.
+func TestParseMaxPayloadOverrides(t *testing.T) {
+	overrides, err := parseMaxPayloadOverrides([]string{"headers:100",
+		"addr:0", "headers:200"})
+	if err != nil {
+		t.Fatalf("parseMaxPayloadOverrides: unexpected error: %v", err)
+	}
+	if len(overrides) != 2 || overrides["headers"] != 200 ||
+		overrides["addr"] != 0 {
+
+		t.Fatalf("unexpected overrides %v", overrides)
+	}
+
+	for _, override := range []string{
+		"headers",
+		"headers:100:1",
+		"bogus:100",
+		"headers:-1",
+		"headers:33554433",
+	} {
+		_, err := parseMaxPayloadOverrides([]string{override})
+		if err == nil {
+			t.Errorf("parseMaxPayloadOverrides(%q): unexpected success",
+				override)
+		}
+	}
+}
@@ -127,6 +127,11 @@ type Config struct {
 	// requests. Defaults to 5s.
 	RetryDuration time.Duration
 
+	// MaxRetryDuration is the duration the wait before retrying permanent
+	// connection requests is allowed to grow to with each failed attempt.
+	// Defaults to 5m.
+	MaxRetryDuration time.Duration
+
 	// OnConnection is a callback that is fired when a new outbound
 	// connection is established.
 	OnConnection func(*ConnReq, net.Conn)
@@ -187,8 +192,8 @@ func (cm *ConnManager) handleFailedConn(c *ConnReq) {
 	if c.Permanent {
 		c.retryCount++
 		d := time.Duration(c.retryCount) * cm.cfg.RetryDuration
-		if d > maxRetryDuration {
-			d = maxRetryDuration
+		if d > cm.cfg.MaxRetryDuration {
+			d = cm.cfg.MaxRetryDuration
 		}
 		log.Debugf("Retrying connection to %v in %v", c, d)
 		time.AfterFunc(d, func() {
@@ -412,6 +417,9 @@ func New(cfg *Config) (*ConnManager, error) {
 	if cfg.RetryDuration <= 0 {
 		cfg.RetryDuration = defaultRetryDuration
 	}
+	if cfg.MaxRetryDuration <= 0 {
+		cfg.MaxRetryDuration = maxRetryDuration
+	}
 	if cfg.TargetOutbound == 0 {
 		cfg.TargetOutbound = defaultTargetOutbound
 	}
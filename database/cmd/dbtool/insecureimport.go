@@ -109,7 +109,8 @@ func (bi *blockImporter) readBlock() ([]byte, error) {
 // NOTE: This is not a safe import as it does not verify chain rules.
 func (bi *blockImporter) processBlock(serializedBlock []byte) (bool, error) {
 	// Deserialize the block which includes checks for malformed blocks.
-	block, err := provautil.NewBlockFromBytes(serializedBlock)
+	block, err := provautil.NewBlockFromBytesEncoding(serializedBlock,
+		activeNetParams.TxEncoding())
 	if err != nil {
 		return false, err
 	}
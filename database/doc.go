@@ -33,7 +33,9 @@ The main entry point is the DB interface.  It exposes functionality for
 transactional-based access and storage of metadata and block data.  It is
 obtained via the Create and Open functions which take a database type string
 that identifies the specific database driver (backend) to use as well as
-arguments specific to the specified driver.
+arguments specific to the specified driver.  Drivers which support it may also
+open an existing database without the ability to modify it via the OpenReadOnly
+function.
 
 Namespaces
 
@@ -28,6 +28,13 @@ type Driver struct {
 	// ErrDbDoesNotExist if the database has not already been created.
 	Open func(args ...interface{}) (DB, error)
 
+	// OpenReadOnly is the function that will be invoked with all
+	// user-specified arguments to open the database without the ability
+	// to modify it.  This function must return ErrDbDoesNotExist if the
+	// database has not already been created.  It may be nil when the
+	// driver does not support read-only access.
+	OpenReadOnly func(args ...interface{}) (DB, error)
+
 	// UseLogger uses a specified Logger to output package logging info.
 	UseLogger func(logger btclog.Logger)
 }
@@ -88,3 +95,27 @@ func Open(dbType string, args ...interface{}) (DB, error) {
 
 	return drv.Open(args...)
 }
+
+// OpenReadOnly opens an existing database for the specified type without the
+// ability to modify it.  Attempts to begin writable transactions against the
+// returned database fail with ErrDbReadOnly.  The arguments are specific to the
+// database type driver.  See the documentation for the database driver for
+// further details.
+//
+// ErrDbUnknownType will be returned if the the database type is not registered
+// and ErrDbReadOnly will be returned if the driver does not support read-only
+// access.
+func OpenReadOnly(dbType string, args ...interface{}) (DB, error) {
+	drv, exists := drivers[dbType]
+	if !exists {
+		str := fmt.Sprintf("driver %q is not registered", dbType)
+		return nil, makeError(ErrDbUnknownType, str, nil)
+	}
+	if drv.OpenReadOnly == nil {
+		str := fmt.Sprintf("driver %q does not support read-only "+
+			"access", dbType)
+		return nil, makeError(ErrDbReadOnly, str, nil)
+	}
+
+	return drv.OpenReadOnly(args...)
+}
@@ -51,6 +51,11 @@ const (
 	// means the database is corrupt.
 	ErrCorruption
 
+	// ErrDbReadOnly indicates an attempt to modify a database that was
+	// opened in read-only mode or to open a database in read-only mode
+	// with a driver which does not support it.
+	ErrDbReadOnly
+
 	// ****************************************
 	// Errors related to database transactions.
 	// ****************************************
@@ -118,6 +123,16 @@ const (
 	// ErrBlockNotFound instead.
 	ErrBlockRegionInvalid
 
+	// ErrBlockCorrupt indicates the stored data for a block failed its
+	// integrity checksum when it was read.  Unlike ErrCorruption, the
+	// damage is confined to the data of a single block which may be
+	// re-fetched from the network and repaired with RepairBlock.
+	ErrBlockCorrupt
+
+	// ErrBlockPruned indicates the block with the provided hash is known to
+	// the database, but its stored data is no longer available.
+	ErrBlockPruned
+
 	// ***********************************
 	// Support for driver-specific errors.
 	// ***********************************
@@ -142,6 +157,7 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrDbAlreadyOpen:      "ErrDbAlreadyOpen",
 	ErrInvalid:            "ErrInvalid",
 	ErrCorruption:         "ErrCorruption",
+	ErrDbReadOnly:         "ErrDbReadOnly",
 	ErrTxClosed:           "ErrTxClosed",
 	ErrTxNotWritable:      "ErrTxNotWritable",
 	ErrBucketNotFound:     "ErrBucketNotFound",
@@ -154,6 +170,8 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrBlockNotFound:      "ErrBlockNotFound",
 	ErrBlockExists:        "ErrBlockExists",
 	ErrBlockRegionInvalid: "ErrBlockRegionInvalid",
+	ErrBlockCorrupt:       "ErrBlockCorrupt",
+	ErrBlockPruned:        "ErrBlockPruned",
 	ErrDriverSpecific:     "ErrDriverSpecific",
 }
 
@@ -26,6 +26,7 @@ func TestErrorCodeStringer(t *testing.T) {
 		{database.ErrDbAlreadyOpen, "ErrDbAlreadyOpen"},
 		{database.ErrInvalid, "ErrInvalid"},
 		{database.ErrCorruption, "ErrCorruption"},
+		{database.ErrDbReadOnly, "ErrDbReadOnly"},
 		{database.ErrTxClosed, "ErrTxClosed"},
 		{database.ErrTxNotWritable, "ErrTxNotWritable"},
 		{database.ErrBucketNotFound, "ErrBucketNotFound"},
@@ -38,6 +39,8 @@ func TestErrorCodeStringer(t *testing.T) {
 		{database.ErrBlockNotFound, "ErrBlockNotFound"},
 		{database.ErrBlockExists, "ErrBlockExists"},
 		{database.ErrBlockRegionInvalid, "ErrBlockRegionInvalid"},
+		{database.ErrBlockCorrupt, "ErrBlockCorrupt"},
+		{database.ErrBlockPruned, "ErrBlockPruned"},
 		{database.ErrDriverSpecific, "ErrDriverSpecific"},
 
 		{0xffff, "Unknown ErrorCode (65535)"},
@@ -0,0 +1,283 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bitgo/prova/database"
+	"github.com/btcsuite/goleveldb/leveldb"
+	"github.com/btcsuite/goleveldb/leveldb/filter"
+	"github.com/btcsuite/goleveldb/leveldb/opt"
+)
+
+// backupBatchSize is the approximate number of bytes of keys and values which
+// are written to the metadata database of a backup at a time.
+const backupBatchSize = 4 * 1024 * 1024
+
+// backup implements the database.Backup interface.  It holds a snapshot of the
+// metadata database taken right after the database cache was flushed.  Block
+// files are only ever appended to, so the block data referenced by the snapshot
+// remains unchanged while the database continues to be used, and a backup only
+// needs to copy the block files up to the write cursor of the snapshot.
+type backup struct {
+	db       *db
+	snapshot *leveldb.Snapshot
+
+	// writeFileNum and writeOffset are the position of the block write
+	// cursor according to the snapshot.  All block data referenced by the
+	// snapshot is located before it.
+	writeFileNum uint32
+	writeOffset  uint32
+
+	releaseOnce sync.Once
+}
+
+// Enforce backup implements the database.Backup interface.
+var _ database.Backup = (*backup)(nil)
+
+// Enforce db implements the database.Backuper interface.
+var _ database.Backuper = (*db)(nil)
+
+// BeginBackup flushes the database cache to persistent storage and takes a
+// snapshot of the metadata database.  Write transactions are blocked until the
+// snapshot has been taken, which is bounded by the time it takes to flush the
+// cache.  The database can't be closed until the returned backup is released.
+//
+// This function is part of the database.Backuper interface implementation.
+func (db *db) BeginBackup() (database.Backup, error) {
+	// Hold the write lock while the cache is flushed and the snapshot is
+	// taken so no write transaction can commit in between.  The read lock
+	// against the database is held until the backup is released so the
+	// database can't be closed out from under it.
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+	db.closeLock.RLock()
+	if db.closed {
+		db.closeLock.RUnlock()
+		return nil, makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr,
+			nil)
+	}
+
+	if err := db.cache.flush(); err != nil {
+		db.closeLock.RUnlock()
+		return nil, err
+	}
+	snapshot, err := db.cache.ldb.GetSnapshot()
+	if err != nil {
+		db.closeLock.RUnlock()
+		return nil, convertErr("failed to take metadata snapshot", err)
+	}
+
+	// Load the write cursor from the snapshot rather than the block store
+	// so it matches the metadata of the backup exactly.
+	writeRow, err := snapshot.Get(bucketizedKey(metadataBucketID,
+		writeLocKeyName), nil)
+	if err != nil {
+		snapshot.Release()
+		db.closeLock.RUnlock()
+		return nil, convertErr("failed to load write cursor", err)
+	}
+	fileNum, fileOffset, err := deserializeWriteRow(writeRow)
+	if err != nil {
+		snapshot.Release()
+		db.closeLock.RUnlock()
+		return nil, err
+	}
+
+	log.Debugf("Began backup at block file %d, offset %d", fileNum,
+		fileOffset)
+	return &backup{
+		db:           db,
+		snapshot:     snapshot,
+		writeFileNum: fileNum,
+		writeOffset:  fileOffset,
+	}, nil
+}
+
+// linkOrCopyFile hard links the passed source file to the passed destination,
+// falling back to copying it when it can't be linked, such as when the paths
+// are on different file systems.
+func linkOrCopyFile(src, dest string) error {
+	if err := os.Link(src, dest); err == nil {
+		return nil
+	}
+
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	return copyFilePrefix(src, dest, fi.Size())
+}
+
+// copyFilePrefix copies the passed number of bytes from the start of the passed
+// source file to a new file at the passed destination and syncs it to disk.
+func copyFilePrefix(src, dest string, size int64) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	destFile, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_EXCL,
+		0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(destFile, srcFile, size); err != nil {
+		destFile.Close()
+		return err
+	}
+	if err := destFile.Sync(); err != nil {
+		destFile.Close()
+		return err
+	}
+	return destFile.Close()
+}
+
+// writeMetadata writes the contents of the metadata snapshot to a new metadata
+// database at the passed path.
+func (b *backup) writeMetadata(dbPath string) error {
+	opts := opt.Options{
+		ErrorIfExist: true,
+		Strict:       opt.DefaultStrict,
+		Compression:  opt.NoCompression,
+		Filter:       filter.NewBloomFilter(10),
+	}
+	ldb, err := leveldb.OpenFile(dbPath, &opts)
+	if err != nil {
+		return convertErr(err.Error(), err)
+	}
+
+	iter := b.snapshot.NewIterator(nil, nil)
+	defer iter.Release()
+	batch := new(leveldb.Batch)
+	var batchBytes int
+	for iter.Next() {
+		batch.Put(iter.Key(), iter.Value())
+		batchBytes += len(iter.Key()) + len(iter.Value())
+		if batchBytes < backupBatchSize {
+			continue
+		}
+		if err := ldb.Write(batch, nil); err != nil {
+			ldb.Close()
+			return convertErr("failed to write backup metadata", err)
+		}
+		batch.Reset()
+		batchBytes = 0
+	}
+	if err := iter.Error(); err != nil {
+		ldb.Close()
+		return convertErr("failed to read metadata snapshot", err)
+	}
+	if err := ldb.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		ldb.Close()
+		return convertErr("failed to write backup metadata", err)
+	}
+	if err := ldb.Close(); err != nil {
+		return convertErr("failed to close backup metadata", err)
+	}
+	return nil
+}
+
+// backupFiles returns a description of every file in the passed backup
+// directory in lexical order.
+func backupFiles(destPath string) ([]database.BackupFile, error) {
+	var files []database.BackupFile
+	err := filepath.Walk(destPath, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+		relPath, err := filepath.Rel(destPath, path)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		hasher := sha256.New()
+		size, err := io.Copy(hasher, f)
+		if err != nil {
+			return err
+		}
+		file := database.BackupFile{Path: relPath, Size: size}
+		copy(file.SHA256[:], hasher.Sum(nil))
+		files = append(files, file)
+		return nil
+	})
+	return files, err
+}
+
+// Write writes a copy of the database as of the time the backup was started to
+// the passed directory.  Block files which are no longer written to are hard
+// linked when possible, while the referenced part of the current block file and
+// the metadata are always copied.
+//
+// This function is part of the database.Backup interface implementation.
+func (b *backup) Write(destPath string) ([]database.BackupFile, error) {
+	if fileExists(destPath) {
+		str := fmt.Sprintf("backup destination %q already exists",
+			destPath)
+		return nil, makeDbErr(database.ErrDbExists, str, nil)
+	}
+	if err := os.MkdirAll(destPath, 0700); err != nil {
+		str := fmt.Sprintf("failed to create backup destination %q",
+			destPath)
+		return nil, makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+
+	// The current block file doesn't exist yet when nothing has been
+	// written to it, and the oldest block files no longer exist once they
+	// were pruned.
+	for fileNum := uint32(0); fileNum <= b.writeFileNum; fileNum++ {
+		src := blockFilePath(b.db.store.basePath, fileNum)
+		dest := blockFilePath(destPath, fileNum)
+		var err error
+		switch {
+		case fileNum < b.writeFileNum && !fileExists(src):
+			continue
+		case fileNum < b.writeFileNum:
+			err = linkOrCopyFile(src, dest)
+		case b.writeOffset > 0:
+			err = copyFilePrefix(src, dest, int64(b.writeOffset))
+		}
+		if err != nil {
+			str := fmt.Sprintf("failed to back up block file %d",
+				fileNum)
+			return nil, makeDbErr(database.ErrDriverSpecific, str, err)
+		}
+	}
+
+	metadataPath := filepath.Join(destPath, metadataDbName)
+	if err := b.writeMetadata(metadataPath); err != nil {
+		return nil, err
+	}
+
+	files, err := backupFiles(destPath)
+	if err != nil {
+		str := "failed to checksum backup files"
+		return nil, makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+	return files, nil
+}
+
+// Release releases the metadata snapshot and allows the database to be closed.
+// It is safe to call more than once.
+//
+// This function is part of the database.Backup interface implementation.
+func (b *backup) Release() {
+	b.releaseOnce.Do(func() {
+		b.snapshot.Release()
+		b.db.closeLock.RUnlock()
+	})
+}
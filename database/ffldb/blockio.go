@@ -14,8 +14,12 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/bitgo/prova/chaincfg/chainhash"
@@ -169,12 +173,13 @@ type blockStore struct {
 	// new blocks are written to.
 	writeCursor *writeCursor
 
-	// These functions are set to openFile, openWriteFile, and deleteFile by
-	// default, but are exposed here to allow the whitebox tests to replace
-	// them when working with mock files.
+	// These functions are set to openFile, openWriteFile, deleteFile, and
+	// syncDir by default, but are exposed here to allow the whitebox tests
+	// to replace them when working with mock files.
 	openFileFunc      func(fileNum uint32) (*lockableFile, error)
 	openWriteFileFunc func(fileNum uint32) (filer, error)
 	deleteFileFunc    func(fileNum uint32) error
+	syncDirFunc       func() error
 }
 
 // blockLocation identifies a particular block file and location.
@@ -229,20 +234,58 @@ func blockFilePath(dbPath string, fileNum uint32) string {
 // for the current file that will have all new data appended.  Unlike openFile,
 // this function does not keep track of the open file and it is not subject to
 // the maxOpenFiles limit.
+//
+// When the file is created, the directory is synced before returning so the
+// file itself survives an unclean shutdown once its data is synced.  Otherwise
+// the metadata could reference a block file which no longer exists.
 func (s *blockStore) openWriteFile(fileNum uint32) (filer, error) {
 	// The current block file needs to be read-write so it is possible to
 	// append to it.  Also, it shouldn't be part of the least recently used
 	// file.
 	filePath := blockFilePath(s.basePath, fileNum)
+	_, statErr := os.Stat(filePath)
 	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		str := fmt.Sprintf("failed to open file %q: %v", filePath, err)
 		return nil, makeDbErr(database.ErrDriverSpecific, str, err)
 	}
 
+	if os.IsNotExist(statErr) {
+		if err := s.syncDirFunc(); err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+	}
+
 	return file, nil
 }
 
+// syncDir performs a file system sync on the directory which houses the flat
+// block files so the creation of new files is durable.
+func (s *blockStore) syncDir() error {
+	// Directories can't be opened for syncing on Windows, where the
+	// creation of a file is durable along with its data anyways.
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	dir, err := os.Open(s.basePath)
+	if err != nil {
+		str := fmt.Sprintf("failed to open directory %q: %v",
+			s.basePath, err)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+	err = dir.Sync()
+	_ = dir.Close()
+	if err != nil {
+		str := fmt.Sprintf("failed to sync directory %q: %v",
+			s.basePath, err)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+
+	return nil
+}
+
 // openFile returns a read-only file handle for the passed flat file number.
 // The function also keeps track of the open files, performs least recently
 // used tracking, and limits the number of open files to maxOpenFiles by closing
@@ -255,6 +298,13 @@ func (s *blockStore) openFile(fileNum uint32) (*lockableFile, error) {
 	filePath := blockFilePath(s.basePath, fileNum)
 	file, err := os.Open(filePath)
 	if err != nil {
+		// A missing file means the data of the blocks it held was
+		// removed from the disk.
+		if os.IsNotExist(err) {
+			str := fmt.Sprintf("block file %d is no longer "+
+				"available: %v", fileNum, err)
+			return nil, makeDbErr(database.ErrBlockPruned, str, err)
+		}
 		return nil, makeDbErr(database.ErrDriverSpecific, err.Error(),
 			err)
 	}
@@ -308,6 +358,54 @@ func (s *blockStore) deleteFile(fileNum uint32) error {
 	return nil
 }
 
+// closeFile closes the read-only file handle for the passed flat file number
+// when it is open and stops tracking it, so the file can be deleted.
+func (s *blockStore) closeFile(fileNum uint32) {
+	s.obfMutex.Lock()
+	defer s.obfMutex.Unlock()
+
+	blockFile, ok := s.openBlockFiles[fileNum]
+	if !ok {
+		return
+	}
+	s.lruMutex.Lock()
+	s.openBlocksLRU.Remove(s.fileNumToLRUElem[fileNum])
+	delete(s.fileNumToLRUElem, fileNum)
+	s.lruMutex.Unlock()
+
+	// Close the file under the write lock for the file in case any readers
+	// are currently reading from it so it's not closed out from under them.
+	blockFile.Lock()
+	_ = blockFile.file.Close()
+	blockFile.Unlock()
+	delete(s.openBlockFiles, fileNum)
+}
+
+// pruneFilesBefore deletes the block files which precede the passed flat file
+// number and returns how many files it deleted.  The files are deleted from the
+// oldest one on, so the files which were already pruned are always the first
+// ones even when pruning is interrupted.  The passed file number must not be
+// after the current write file.
+//
+// This function MUST be called during a write transaction so no block files
+// are written or removed by a rollback concurrently.
+func (s *blockStore) pruneFilesBefore(fileNum uint32) (int, error) {
+	firstFile := fileNum
+	for firstFile > 0 && fileExists(blockFilePath(s.basePath, firstFile-1)) {
+		firstFile--
+	}
+
+	var numDeleted int
+	for n := firstFile; n < fileNum; n++ {
+		s.closeFile(n)
+		if err := s.deleteFileFunc(n); err != nil {
+			return numDeleted, err
+		}
+		numDeleted++
+	}
+	return numDeleted, nil
+}
+
 // blockFile attempts to return an existing file handle for the passed flat file
 // number if it is already open as well as marking it as most recently used.  It
 // will also open the file when it's not already open subject to the rules
@@ -422,6 +520,11 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 		// This is done under the write cursor lock since the curFileNum
 		// field is accessed elsewhere by readers.
 		//
+		// Sync the current write file before closing it since syncBlocks
+		// only syncs the file the write cursor is in when the metadata
+		// is flushed, which would otherwise allow the metadata to
+		// reference blocks in this file which never made it to disk.
+		//
 		// Close the current write file to force a read-only reopen
 		// with LRU tracking.  The close is done under the write lock
 		// for the file to prevent it from being closed out from under
@@ -429,6 +532,14 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 		wc.Lock()
 		wc.curFile.Lock()
 		if wc.curFile.file != nil {
+			if err := wc.curFile.file.Sync(); err != nil {
+				wc.curFile.Unlock()
+				wc.Unlock()
+				str := fmt.Sprintf("failed to sync file %d: %v",
+					wc.curFileNum, err)
+				return blockLocation{}, makeDbErr(
+					database.ErrDriverSpecific, str, err)
+			}
 			_ = wc.curFile.file.Close()
 			wc.curFile.file = nil
 		}
@@ -502,7 +613,7 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 // limit.
 //
 // Returns ErrDriverSpecific if the data fails to read for any reason and
-// ErrCorruption if the checksum of the read data doesn't match the checksum
+// ErrBlockCorrupt if the checksum of the read data doesn't match the checksum
 // read from the file.
 //
 // Format: <network><block length><serialized block><checksum>
@@ -535,7 +646,7 @@ func (s *blockStore) readBlock(hash *chainhash.Hash, loc blockLocation) ([]byte,
 		str := fmt.Sprintf("block data for block %s checksum "+
 			"does not match - got %x, want %x", hash,
 			calculatedChecksum, serializedChecksum)
-		return nil, makeDbErr(database.ErrCorruption, str, nil)
+		return nil, makeDbErr(database.ErrBlockCorrupt, str, nil)
 	}
 
 	// The network associated with the block must match the current active
@@ -590,7 +701,9 @@ func (s *blockStore) readBlockRegion(loc blockLocation, offset, numBytes uint32)
 
 // syncBlocks performs a file system sync on the flat file associated with the
 // store's current write cursor.  It is safe to call even when there is not a
-// current write file in which case it will have no effect.
+// current write file in which case it will have no effect.  Previous files
+// don't need to be synced since writeBlock syncs each file before moving on to
+// the next one.
 //
 // This is used when flushing cached metadata updates to disk to ensure all the
 // block data is fully written before updating the metadata.  This ensures the
@@ -719,10 +832,33 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 // current write cursor which is also stored in the metadata.  Thus, it is used
 // to detect unexpected shutdowns in the middle of writes so the block files
 // can be reconciled.
+//
+// The files are numbered consecutively, but the oldest files no longer exist
+// once they were pruned, so the scan starts at the oldest remaining file.
 func scanBlockFiles(dbPath string) (int, uint32) {
+	firstFile := -1
+	if entries, err := ioutil.ReadDir(dbPath); err == nil {
+		for _, entry := range entries {
+			name := entry.Name()
+			fileNum, err := strconv.ParseUint(strings.TrimSuffix(
+				name, filepath.Ext(name)), 10, 32)
+			if err != nil || name != fmt.Sprintf(
+				blockFilenameTemplate, fileNum) {
+
+				continue
+			}
+			if firstFile == -1 || int(fileNum) < firstFile {
+				firstFile = int(fileNum)
+			}
+		}
+	}
+	if firstFile == -1 {
+		firstFile = 0
+	}
+
 	lastFile := -1
 	fileLen := uint32(0)
-	for i := 0; ; i++ {
+	for i := firstFile; ; i++ {
 		filePath := blockFilePath(dbPath, uint32(i))
 		st, err := os.Stat(filePath)
 		if err != nil {
@@ -767,5 +903,6 @@ func newBlockStore(basePath string, network wire.BitcoinNet) *blockStore {
 	store.openFileFunc = store.openFile
 	store.openWriteFileFunc = store.openWriteFile
 	store.deleteFileFunc = store.deleteFile
+	store.syncDirFunc = store.syncDir
 	return store
 }
@@ -86,6 +86,10 @@ const (
 	// errTxClosedStr is the text to use for the database.ErrTxClosed error
 	// code.
 	errTxClosedStr = "database tx is closed"
+
+	// errDbReadOnlyStr is the text to use for the database.ErrDbReadOnly
+	// error code.
+	errDbReadOnlyStr = "database is read-only"
 )
 
 // bulkFetchData is allows a block location to be specified along with the
@@ -1190,6 +1194,63 @@ func (tx *transaction) StoreBlock(block *provautil.Block) error {
 	return nil
 }
 
+// RepairBlock replaces the stored data for an existing block with the provided
+// block.  The replacement data is written to the end of the flat files on
+// commit and the block index is updated to point at it, so the damaged copy is
+// simply abandoned in place.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if the block hash does not already exist
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) RepairBlock(block *provautil.Block) error {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "repair block requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Only blocks which have already been stored can be repaired.
+	blockHash := block.Hash()
+	if !tx.hasBlock(blockHash) {
+		str := fmt.Sprintf("block %s does not exist", blockHash)
+		return makeDbErr(database.ErrBlockNotFound, str, nil)
+	}
+
+	blockBytes, err := block.Bytes()
+	if err != nil {
+		str := fmt.Sprintf("failed to get serialized bytes for block %s",
+			blockHash)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+
+	// Replace the data when the block is still pending, otherwise queue it
+	// to be written on commit like a new block.  Writing the block index
+	// entry on commit overwrites the location of the damaged data.
+	if idx, exists := tx.pendingBlocks[*blockHash]; exists {
+		tx.pendingBlockData[idx].bytes = blockBytes
+		return nil
+	}
+	if tx.pendingBlocks == nil {
+		tx.pendingBlocks = make(map[chainhash.Hash]int)
+	}
+	tx.pendingBlocks[*blockHash] = len(tx.pendingBlockData)
+	tx.pendingBlockData = append(tx.pendingBlockData, pendingBlock{
+		hash:  blockHash,
+		bytes: blockBytes,
+	})
+	log.Tracef("Added block %s to pending blocks for repair", blockHash)
+
+	return nil
+}
+
 // HasBlock returns whether or not a block with the given hash exists in the
 // database.
 //
@@ -1340,6 +1401,8 @@ func (tx *transaction) FetchBlockHeaders(hashes []chainhash.Hash) ([][]byte, err
 //   - ErrBlockNotFound if the requested block hash does not exist
 //   - ErrTxClosed if the transaction has already been closed
 //   - ErrCorruption if the database has somehow become corrupted
+//   - ErrBlockCorrupt if the stored data for a requested block fails
+//     checksum verification
 //
 // In addition, returns ErrDriverSpecific if any failures occur when reading the
 // block files.
@@ -1387,6 +1450,8 @@ func (tx *transaction) FetchBlock(hash *chainhash.Hash) ([]byte, error) {
 //   - ErrBlockNotFound if any of the requested block hashed do not exist
 //   - ErrTxClosed if the transaction has already been closed
 //   - ErrCorruption if the database has somehow become corrupted
+//   - ErrBlockCorrupt if the stored data for a requested block fails
+//     checksum verification
 //
 // In addition, returns ErrDriverSpecific if any failures occur when reading the
 // block files.
@@ -1628,6 +1693,63 @@ func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]by
 	return blockRegions, nil
 }
 
+// FetchBlockLocation returns the location of the serialized bytes of the block
+// identified by the given hash in the flat block files.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if the requested block hash does not exist or the block
+//     has not been written to the block files yet
+//   - ErrBlockPruned if the block file which held the block no longer exists
+//   - ErrTxClosed if the transaction has already been closed
+//   - ErrCorruption if the database has somehow become corrupted
+//
+// In addition, returns ErrDriverSpecific if the block file can't be examined.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockLocation(hash *chainhash.Hash) (*database.BlockLocation, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	// Blocks which are pending to be written on commit do not have a
+	// location in the block files yet.
+	if _, exists := tx.pendingBlocks[*hash]; exists {
+		str := fmt.Sprintf("block %s has not been written yet", hash)
+		return nil, makeDbErr(database.ErrBlockNotFound, str, nil)
+	}
+
+	// Lookup the location of the block in the files from the block index.
+	blockRow, err := tx.fetchBlockRow(hash)
+	if err != nil {
+		return nil, err
+	}
+	location := deserializeBlockLoc(blockRow)
+
+	// Ensure the block file still exists.
+	filePath := blockFilePath(tx.db.store.basePath, location.blockFileNum)
+	if _, err := os.Stat(filePath); err != nil {
+		if os.IsNotExist(err) {
+			str := fmt.Sprintf("block file %d which held block %s "+
+				"is no longer available", location.blockFileNum,
+				hash)
+			return nil, makeDbErr(database.ErrBlockPruned, str, err)
+		}
+		str := fmt.Sprintf("failed to examine block file %q: %v",
+			filePath, err)
+		return nil, makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+
+	// The serialized data for a block in the files includes an initial 4
+	// bytes for network + 4 bytes for block length ahead of the block and
+	// a 4 byte checksum after it.
+	return &database.BlockLocation{
+		File:   filePath,
+		Offset: location.fileOffset + 8,
+		Len:    location.blockLen - 12,
+	}, nil
+}
+
 // close marks the transaction closed then releases any pending data, the
 // underlying snapshot, the transaction read lock, and the write lock when the
 // transaction is writable.
@@ -1791,6 +1913,7 @@ type db struct {
 	closed    bool         // Is the database closed?
 	store     *blockStore  // Handles read/writing blocks to flat files.
 	cache     *dbCache     // Cache layer which wraps underlying leveldb DB.
+	readOnly  bool         // Is the database opened read-only?
 }
 
 // Enforce db implements the database.DB interface.
@@ -1811,6 +1934,13 @@ func (db *db) Type() string {
 // which is used by the managed transaction code while the database method
 // returns the interface.
 func (db *db) begin(writable bool) (*transaction, error) {
+	// Writable transactions are not allowed when the database was opened
+	// in read-only mode.
+	if writable && db.readOnly {
+		return nil, makeDbErr(database.ErrDbReadOnly, errDbReadOnlyStr,
+			nil)
+	}
+
 	// Whenever a new writable transaction is started, grab the write lock
 	// to ensure only a single write transaction can be active at the same
 	// time.  This lock will not be released until the transaction is
@@ -1957,6 +2087,19 @@ func (db *db) Update(fn func(database.Tx) error) error {
 	return tx.Commit()
 }
 
+// Enforce db implements the database.CacheReporter interface.
+var _ database.CacheReporter = (*db)(nil)
+
+// CacheStats returns the current occupancy of the database cache, which holds
+// the metadata writes, such as the changes to the UTXO set, until they are
+// flushed to the underlying leveldb database.
+//
+// This function is part of the database.CacheReporter interface
+// implementation.
+func (db *db) CacheStats() database.CacheStats {
+	return db.cache.Stats()
+}
+
 // Close cleanly shuts down the database and syncs all data.  It will block
 // until all database transactions have been finalized (rolled back or
 // committed).
@@ -2041,7 +2184,9 @@ func initDB(ldb *leveldb.DB) error {
 
 // openDB opens the database at the provided path.  database.ErrDbDoesNotExist
 // is returned if the database doesn't exist and the create flag is not set.
-func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, error) {
+// When the read-only flag is set, the database is opened without the ability to
+// modify it, which also means nothing on disk is repaired during the open.
+func openDB(dbPath string, network wire.BitcoinNet, create, readOnly bool) (database.DB, error) {
 	// Error if the database doesn't exist and the create flag is not set.
 	metadataDbPath := filepath.Join(dbPath, metadataDbName)
 	dbExists := fileExists(metadataDbPath)
@@ -2058,12 +2203,16 @@ func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, e
 		_ = os.MkdirAll(dbPath, 0700)
 	}
 
-	// Open the metadata database (will create it if needed).
+	// Open the metadata database (will create it if needed).  In read-only
+	// mode, leveldb only takes a shared lock on the database and replays
+	// its journal in memory rather than compacting it to disk, so the same
+	// database may be opened read-only by multiple processes at once.
 	opts := opt.Options{
 		ErrorIfExist: create,
 		Strict:       opt.DefaultStrict,
 		Compression:  opt.NoCompression,
 		Filter:       filter.NewBloomFilter(10),
+		ReadOnly:     readOnly,
 	}
 	ldb, err := leveldb.OpenFile(metadataDbPath, &opts)
 	if err != nil {
@@ -2077,7 +2226,7 @@ func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, e
 	// write caching.
 	store := newBlockStore(dbPath, network)
 	cache := newDbCache(ldb, store, defaultCacheSize, defaultFlushSecs)
-	pdb := &db{store: store, cache: cache}
+	pdb := &db{store: store, cache: cache, readOnly: readOnly}
 
 	// Perform any reconciliation needed between the block and metadata as
 	// well as database initialization, if needed.
@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/database/internal/treap"
 	"github.com/btcsuite/goleveldb/leveldb"
 	"github.com/btcsuite/goleveldb/leveldb/iterator"
@@ -392,6 +393,15 @@ type dbCache struct {
 	cachedRemove *treap.Immutable
 }
 
+// Stats returns the total size of the pending writes held in the cache along
+// with the size it is flushed at.
+func (c *dbCache) Stats() database.CacheStats {
+	c.cacheLock.RLock()
+	size := c.cachedKeys.Size() + c.cachedRemove.Size()
+	c.cacheLock.RUnlock()
+	return database.CacheStats{Size: size, MaxSize: c.maxSize}
+}
+
 // Snapshot returns a snapshot of the database cache and underlying database at
 // a particular point in time.
 //
@@ -14,8 +14,8 @@ ensure data integrity.
 Usage
 
 This package is a driver to the database package and provides the database type
-of "ffldb".  The parameters the Open and Create functions take are the
-database path as a string and the block network:
+of "ffldb".  The parameters the Open, OpenReadOnly, and Create functions take
+are the database path as a string and the block network:
 
 	db, err := database.Open("ffldb", "path/to/database", wire.MainNet)
 	if err != nil {
@@ -26,5 +26,19 @@ database path as a string and the block network:
 	if err != nil {
 		// Handle error
 	}
+
+The block network may be followed by the maximum size of the flat block files
+in bytes as a uint32 to override the default of 512 MiB.  Small block files are
+mostly useful to exercise pruning, which removes whole block files, in tests.
+
+Databases opened with OpenReadOnly only take a shared lock on the database, so
+the same database may be opened read-only by multiple processes at once.
+
+Pruning
+
+The database implements the database.Pruner interface.  Pruning removes the
+flat block files which only hold blocks stored before a given block while the
+block index, and so the headers of the pruned blocks, remain in the metadata.
+Fetching the data of a pruned block returns database.ErrBlockPruned.
 */
 package ffldb
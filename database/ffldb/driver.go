@@ -19,49 +19,84 @@ const (
 	dbType = "ffldb"
 )
 
-// parseArgs parses the arguments from the database Open/Create methods.
-func parseArgs(funcName string, args ...interface{}) (string, wire.BitcoinNet, error) {
+// parseArgs parses the arguments from the database Open/Create methods.  The
+// database path and block network may be followed by the maximum size of the
+// block files, which is zero when it was not specified.
+func parseArgs(funcName string, args ...interface{}) (string, wire.BitcoinNet, uint32, error) {
+	var maxFileSize uint32
+	if len(args) == 3 {
+		size, ok := args[2].(uint32)
+		if ok && size != 0 {
+			maxFileSize = size
+			args = args[:2]
+		}
+	}
 	if len(args) != 2 {
-		return "", 0, fmt.Errorf("invalid arguments to %s.%s -- "+
+		return "", 0, 0, fmt.Errorf("invalid arguments to %s.%s -- "+
 			"expected database path and block network", dbType,
 			funcName)
 	}
 
 	dbPath, ok := args[0].(string)
 	if !ok {
-		return "", 0, fmt.Errorf("first argument to %s.%s is invalid -- "+
-			"expected database path string", dbType, funcName)
+		return "", 0, 0, fmt.Errorf("first argument to %s.%s is "+
+			"invalid -- expected database path string", dbType,
+			funcName)
 	}
 
 	network, ok := args[1].(wire.BitcoinNet)
 	if !ok {
-		return "", 0, fmt.Errorf("second argument to %s.%s is invalid -- "+
-			"expected block network", dbType, funcName)
+		return "", 0, 0, fmt.Errorf("second argument to %s.%s is "+
+			"invalid -- expected block network", dbType, funcName)
 	}
 
-	return dbPath, network, nil
+	return dbPath, network, maxFileSize, nil
+}
+
+// openDBWithArgs opens the database with the parsed arguments, overriding the
+// maximum size of the block files when one was specified.
+func openDBWithArgs(dbPath string, network wire.BitcoinNet, maxFileSize uint32, create, readOnly bool) (database.DB, error) {
+	pdb, err := openDB(dbPath, network, create, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	if maxFileSize != 0 {
+		pdb.(*db).store.maxBlockFileSize = maxFileSize
+	}
+	return pdb, nil
 }
 
 // openDBDriver is the callback provided during driver registration that opens
 // an existing database for use.
 func openDBDriver(args ...interface{}) (database.DB, error) {
-	dbPath, network, err := parseArgs("Open", args...)
+	dbPath, network, maxFileSize, err := parseArgs("Open", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return openDBWithArgs(dbPath, network, maxFileSize, false, false)
+}
+
+// openReadOnlyDBDriver is the callback provided during driver registration that
+// opens an existing database for read-only use.
+func openReadOnlyDBDriver(args ...interface{}) (database.DB, error) {
+	dbPath, network, maxFileSize, err := parseArgs("OpenReadOnly", args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return openDB(dbPath, network, false)
+	return openDBWithArgs(dbPath, network, maxFileSize, false, true)
 }
 
 // createDBDriver is the callback provided during driver registration that
 // creates, initializes, and opens a database for use.
 func createDBDriver(args ...interface{}) (database.DB, error) {
-	dbPath, network, err := parseArgs("Create", args...)
+	dbPath, network, maxFileSize, err := parseArgs("Create", args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return openDB(dbPath, network, true)
+	return openDBWithArgs(dbPath, network, maxFileSize, true, false)
 }
 
 // useLogger is the callback provided during driver registration that sets the
@@ -73,10 +108,11 @@ func useLogger(logger btclog.Logger) {
 func init() {
 	// Register the driver.
 	driver := database.Driver{
-		DbType:    dbType,
-		Create:    createDBDriver,
-		Open:      openDBDriver,
-		UseLogger: useLogger,
+		DbType:       dbType,
+		Create:       createDBDriver,
+		Open:         openDBDriver,
+		OpenReadOnly: openReadOnlyDBDriver,
+		UseLogger:    useLogger,
 	}
 	if err := database.RegisterDriver(driver); err != nil {
 		panic(fmt.Sprintf("Failed to regiser database driver '%s': %v",
@@ -6,7 +6,9 @@
 package ffldb_test
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -14,6 +16,7 @@ import (
 	"testing"
 
 	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/database/ffldb"
 	"github.com/bitgo/prova/provautil"
@@ -255,6 +258,458 @@ func TestPersistence(t *testing.T) {
 	}
 }
 
+// TestBlockLocation ensures the location of a stored block describes where its
+// serialized bytes reside in the block files and that blocks whose file was
+// removed are reported as pruned.
+func TestBlockLocation(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database to run tests against.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-blocklocationtest")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	// Ensure the location of a block is not available until the block was
+	// written to the block files.
+	genesisBlock := provautil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	genesisHash := chaincfg.MainNetParams.GenesisHash
+	err = db.Update(func(tx database.Tx) error {
+		if err := tx.StoreBlock(genesisBlock); err != nil {
+			return fmt.Errorf("StoreBlock: unexpected error: %v",
+				err)
+		}
+		_, err := tx.FetchBlockLocation(genesisHash)
+		if !checkDbError(t, "FetchBlockLocation pending block", err,
+			database.ErrBlockNotFound) {
+			return fmt.Errorf("unexpected pending block location")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Update: unexpected error: %v", err)
+		return
+	}
+
+	// Ensure the bytes at the location of the stored block are the
+	// serialized block.
+	var location *database.BlockLocation
+	err = db.View(func(tx database.Tx) error {
+		var err error
+		location, err = tx.FetchBlockLocation(genesisHash)
+		return err
+	})
+	if err != nil {
+		t.Errorf("FetchBlockLocation: unexpected error: %v", err)
+		return
+	}
+	fileBytes, err := ioutil.ReadFile(location.File)
+	if err != nil {
+		t.Errorf("ReadFile: unexpected error: %v", err)
+		return
+	}
+	end := int(location.Offset + location.Len)
+	if end > len(fileBytes) {
+		t.Errorf("FetchBlockLocation: location offset %d, length %d "+
+			"exceeds file length %d", location.Offset,
+			location.Len, len(fileBytes))
+		return
+	}
+	genesisBlockBytes, _ := genesisBlock.Bytes()
+	gotBytes := fileBytes[location.Offset:end]
+	if !reflect.DeepEqual(gotBytes, genesisBlockBytes) {
+		t.Errorf("FetchBlockLocation: stored block mismatch - got %x, "+
+			"want %x", gotBytes, genesisBlockBytes)
+		return
+	}
+
+	// Ensure unknown blocks return the expected error.
+	err = db.View(func(tx database.Tx) error {
+		_, err := tx.FetchBlockLocation(&chainhash.Hash{})
+		return err
+	})
+	if !checkDbError(t, "FetchBlockLocation unknown block", err,
+		database.ErrBlockNotFound) {
+		return
+	}
+
+	// Ensure the block is reported as pruned once its block file is gone.
+	if err := os.Remove(location.File); err != nil {
+		t.Errorf("Remove: unexpected error: %v", err)
+		return
+	}
+	err = db.View(func(tx database.Tx) error {
+		_, err := tx.FetchBlockLocation(genesisHash)
+		return err
+	})
+	if !checkDbError(t, "FetchBlockLocation pruned block", err,
+		database.ErrBlockPruned) {
+		return
+	}
+}
+
+// TestReadOnly ensures that a database opened in read-only mode can be opened
+// multiple times at once, serves the stored data, and rejects modifications.
+func TestReadOnly(t *testing.T) {
+	t.Parallel()
+
+	// Ensure that attempting to open a database that doesn't exist returns
+	// the expected error.
+	_, err := database.OpenReadOnly(dbType, "noexist", blockDataNet)
+	if !checkDbError(t, "OpenReadOnly", err, database.ErrDbDoesNotExist) {
+		return
+	}
+
+	// Create a new database with a stored block and close it.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-readonlytest")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer os.RemoveAll(dbPath)
+	genesisBlock := provautil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	genesisHash := chaincfg.MainNetParams.GenesisHash
+	err = db.Update(func(tx database.Tx) error {
+		return tx.StoreBlock(genesisBlock)
+	})
+	if err != nil {
+		t.Errorf("Update: unexpected error: %v", err)
+		return
+	}
+	db.Close()
+
+	// Open the database read-only twice at the same time.
+	db1, err := database.OpenReadOnly(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to open test database read-only (%s) %v",
+			dbType, err)
+		return
+	}
+	defer db1.Close()
+	db2, err := database.OpenReadOnly(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to open test database read-only again (%s) %v",
+			dbType, err)
+		return
+	}
+	defer db2.Close()
+
+	genesisBlockBytes, _ := genesisBlock.Bytes()
+	for i, db := range []database.DB{db1, db2} {
+		// Ensure the stored block can be read.
+		err = db.View(func(tx database.Tx) error {
+			gotBytes, err := tx.FetchBlock(genesisHash)
+			if err != nil {
+				return fmt.Errorf("FetchBlock: unexpected "+
+					"error: %v", err)
+			}
+			if !reflect.DeepEqual(gotBytes, genesisBlockBytes) {
+				return fmt.Errorf("FetchBlock: stored block " +
+					"mismatch")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("View #%d: unexpected error: %v", i, err)
+			return
+		}
+
+		// Ensure writable transactions are rejected.
+		_, err = db.Begin(true)
+		testName := fmt.Sprintf("Begin #%d", i)
+		if !checkDbError(t, testName, err, database.ErrDbReadOnly) {
+			return
+		}
+		err = db.Update(func(tx database.Tx) error {
+			return nil
+		})
+		testName = fmt.Sprintf("Update #%d", i)
+		if !checkDbError(t, testName, err, database.ErrDbReadOnly) {
+			return
+		}
+	}
+}
+
+// TestBackup ensures a backup taken while the database is in use contains
+// exactly the blocks and metadata committed before it was started, including
+// those not yet flushed from the cache, and can be opened as a database.
+func TestBackup(t *testing.T) {
+	t.Parallel()
+
+	// Create distinct blocks by varying the nonce of the genesis block.
+	const numBlocks, numBackedUp = 150, 100
+	blocks := make([]*provautil.Block, 0, numBlocks)
+	for i := 0; i < numBlocks; i++ {
+		msgBlock := *chaincfg.MainNetParams.GenesisBlock
+		msgBlock.Header.Nonce = uint64(i)
+		block := provautil.NewBlock(&msgBlock)
+		block.SetHeight(uint32(i))
+		blocks = append(blocks, block)
+	}
+
+	dbPath := filepath.Join(os.TempDir(), "ffldb-backuptest")
+	backupPath := filepath.Join(os.TempDir(), "ffldb-backuptest-backup")
+	_ = os.RemoveAll(dbPath)
+	_ = os.RemoveAll(backupPath)
+	db, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer os.RemoveAll(dbPath)
+	defer os.RemoveAll(backupPath)
+	defer db.Close()
+
+	// storeBlocks stores the passed blocks along with the number of blocks
+	// stored so far under a metadata key, one block per transaction.
+	key := []byte("numblocks")
+	storeBlocks := func(blocks []*provautil.Block) error {
+		for _, block := range blocks {
+			err := db.Update(func(tx database.Tx) error {
+				if err := tx.StoreBlock(block); err != nil {
+					return err
+				}
+				num := []byte{byte(block.Height())}
+				return tx.Metadata().Put(key, num)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Store the blocks in small block files so the backup spans several of
+	// them, and keep storing blocks after the backup is started.
+	var backup database.Backup
+	ffldb.TstRunWithMaxBlockFileSize(db, 4096, func() {
+		if err = storeBlocks(blocks[:numBackedUp]); err != nil {
+			return
+		}
+		backup, err = db.(database.Backuper).BeginBackup()
+		if err != nil {
+			return
+		}
+		err = storeBlocks(blocks[numBackedUp:])
+	})
+	if err != nil {
+		t.Errorf("Unable to store blocks and begin backup: %v", err)
+		return
+	}
+	defer backup.Release()
+
+	files, err := backup.Write(backupPath)
+	if err != nil {
+		t.Errorf("Write: unexpected error: %v", err)
+		return
+	}
+	_, err = backup.Write(backupPath)
+	if !checkDbError(t, "Write existing", err, database.ErrDbExists) {
+		return
+	}
+	backup.Release()
+
+	// Ensure every file of the backup is described with its checksum.
+	var numBlockFiles int
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(filepath.Join(backupPath,
+			file.Path))
+		if err != nil {
+			t.Errorf("Unable to read backup file %s: %v", file.Path,
+				err)
+			return
+		}
+		if int64(len(contents)) != file.Size ||
+			sha256.Sum256(contents) != file.SHA256 {
+
+			t.Errorf("Backup file %s does not match its description",
+				file.Path)
+		}
+		if filepath.Ext(file.Path) == ".fdb" {
+			numBlockFiles++
+		}
+	}
+	if numBlockFiles < 2 {
+		t.Errorf("Backup has %d block files, want at least 2",
+			numBlockFiles)
+	}
+
+	// Ensure the backup contains the blocks and metadata as of the time it
+	// was started.
+	backupDB, err := database.Open(dbType, backupPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to open backup (%s) %v", dbType, err)
+		return
+	}
+	defer backupDB.Close()
+	err = backupDB.View(func(tx database.Tx) error {
+		for i, block := range blocks {
+			gotBytes, err := tx.FetchBlock(block.Hash())
+			if i >= numBackedUp {
+				if err == nil {
+					return fmt.Errorf("block %d stored after "+
+						"the backup was started is in it", i)
+				}
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("FetchBlock #%d: unexpected "+
+					"error: %v", i, err)
+			}
+			wantBytes, _ := block.Bytes()
+			if !reflect.DeepEqual(gotBytes, wantBytes) {
+				return fmt.Errorf("FetchBlock #%d: stored block "+
+					"mismatch", i)
+			}
+		}
+		got := tx.Metadata().Get(key)
+		if len(got) != 1 || got[0] != numBackedUp-1 {
+			return fmt.Errorf("got metadata value %v, want %d", got,
+				numBackedUp-1)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("View: %v", err)
+	}
+}
+
+// TestPruneBlocks ensures pruning removes the block files which only hold
+// blocks stored before a given block, that the data of the pruned blocks is
+// reported as pruned while their headers remain available, and that the
+// database can be reopened and written to after pruning.
+func TestPruneBlocks(t *testing.T) {
+	t.Parallel()
+
+	// Create distinct blocks by varying the nonce of the genesis block.
+	const numBlocks, pruneIdx = 150, 100
+	blocks := make([]*provautil.Block, 0, numBlocks+1)
+	for i := 0; i <= numBlocks; i++ {
+		msgBlock := *chaincfg.MainNetParams.GenesisBlock
+		msgBlock.Header.Nonce = uint64(i)
+		blocks = append(blocks, provautil.NewBlock(&msgBlock))
+	}
+
+	// Store the blocks in small block files so they span many of them.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-prunetest")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(dbType, dbPath, blockDataNet, uint32(4096))
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer os.RemoveAll(dbPath)
+	defer func() {
+		db.Close()
+	}()
+	files := make([]string, numBlocks)
+	err = db.Update(func(tx database.Tx) error {
+		for _, block := range blocks[:numBlocks] {
+			if err := tx.StoreBlock(block); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = db.View(func(tx database.Tx) error {
+			for i, block := range blocks[:numBlocks] {
+				loc, err := tx.FetchBlockLocation(block.Hash())
+				if err != nil {
+					return err
+				}
+				files[i] = loc.File
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		t.Errorf("Unable to store blocks: %v", err)
+		return
+	}
+	if files[0] == files[pruneIdx] {
+		t.Errorf("Block %d is stored in the first block file", pruneIdx)
+		return
+	}
+
+	pruner := db.(database.Pruner)
+	err = pruner.PruneBlocks(&chainhash.Hash{})
+	if !checkDbError(t, "PruneBlocks unknown block", err,
+		database.ErrBlockNotFound) {
+		return
+	}
+	for i := 0; i < 2; i++ {
+		if err := pruner.PruneBlocks(blocks[pruneIdx].Hash()); err != nil {
+			t.Errorf("PruneBlocks #%d: unexpected error: %v", i, err)
+			return
+		}
+	}
+
+	// checkBlocks ensures the blocks which only share a block file with
+	// blocks stored before the block pruned to are pruned while the others
+	// are available, and that the headers of all of them are available.
+	checkBlocks := func(desc string, stored []*provautil.Block) bool {
+		err := db.View(func(tx database.Tx) error {
+			for i, block := range stored {
+				_, err := tx.FetchBlockHeader(block.Hash())
+				if err != nil {
+					return fmt.Errorf("FetchBlockHeader #%d: "+
+						"unexpected error: %v", i, err)
+				}
+				_, err = tx.FetchBlock(block.Hash())
+				pruned := i < pruneIdx && files[i] != files[pruneIdx]
+				if !pruned {
+					if err != nil {
+						return fmt.Errorf("FetchBlock #%d: "+
+							"unexpected error: %v", i, err)
+					}
+					continue
+				}
+				if dbErr, ok := err.(database.Error); !ok ||
+					dbErr.ErrorCode != database.ErrBlockPruned {
+
+					return fmt.Errorf("FetchBlock #%d: got "+
+						"error %v, want ErrBlockPruned", i, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: %v", desc, err)
+			return false
+		}
+		return true
+	}
+	if !checkBlocks("pruned", blocks[:numBlocks]) {
+		return
+	}
+
+	// Ensure the database still finds the end of the block files after it
+	// is reopened and stores new blocks after the existing ones.
+	db.Close()
+	db, err = database.Open(dbType, dbPath, blockDataNet, uint32(4096))
+	if err != nil {
+		t.Errorf("Failed to reopen test database (%s) %v", dbType, err)
+		return
+	}
+	err = db.Update(func(tx database.Tx) error {
+		return tx.StoreBlock(blocks[numBlocks])
+	})
+	if err != nil {
+		t.Errorf("StoreBlock after reopening: unexpected error: %v", err)
+		return
+	}
+	files = append(files, "")
+	checkBlocks("reopened", blocks)
+}
+
 // TestInterface performs all interfaces tests for this database driver.
 func TestInterface(t *testing.T) {
 	t.Parallel()
@@ -287,3 +742,49 @@ func TestInterface(t *testing.T) {
 		testInterface(t, db)
 	})
 }
+
+// TestCacheStats ensures the database reports the size of the metadata writes
+// held in its cache along with the size the cache is flushed at.
+func TestCacheStats(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(os.TempDir(), "ffldb-cachestatstest")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	reporter, ok := db.(database.CacheReporter)
+	if !ok {
+		t.Errorf("Database does not implement database.CacheReporter")
+		return
+	}
+	before := reporter.CacheStats()
+	if before.MaxSize == 0 {
+		t.Errorf("CacheStats: got a max size of zero")
+	}
+
+	key := []byte("cachestatskey")
+	value := make([]byte, 1024)
+	err = db.Update(func(tx database.Tx) error {
+		return tx.Metadata().Put(key, value)
+	})
+	if err != nil {
+		t.Errorf("Update: unexpected error: %v", err)
+		return
+	}
+	after := reporter.CacheStats()
+	if after.Size < before.Size+uint64(len(key)+len(value)) {
+		t.Errorf("CacheStats: got size %d after writing %d bytes, "+
+			"want at least %d", after.Size, len(key)+len(value),
+			before.Size+uint64(len(key)+len(value)))
+	}
+	if after.MaxSize != before.MaxSize {
+		t.Errorf("CacheStats: got max size %d, want %d", after.MaxSize,
+			before.MaxSize)
+	}
+}
@@ -1159,6 +1159,14 @@ func testFetchBlockIOMissing(tc *testContext, tx database.Tx) bool {
 			return false
 		}
 
+		// Ensure FetchBlockLocation returns expected error.
+		testName = fmt.Sprintf("FetchBlockLocation #%d on missing "+
+			"block", i)
+		_, err = tx.FetchBlockLocation(blockHash)
+		if !checkDbError(tc.t, testName, err, wantErrCode) {
+			return false
+		}
+
 		// Ensure HasBlock returns false.
 		hasBlock, err := tx.HasBlock(blockHash)
 		if err != nil {
@@ -1518,6 +1526,12 @@ func testBlockIOTxInterface(tc *testContext) bool {
 			if !checkDbError(tc.t, testName, err, wantErrCode) {
 				return errSubTestFail
 			}
+
+			testName = fmt.Sprintf("RepairBlock(%d) on ro tx", i)
+			err = tx.RepairBlock(block)
+			if !checkDbError(tc.t, testName, err, wantErrCode) {
+				return errSubTestFail
+			}
 		}
 
 		return nil
@@ -1857,6 +1871,13 @@ func testClosedTxInterface(tc *testContext, tx database.Tx) bool {
 			return false
 		}
 
+		// Ensure RepairBlock returns expected error.
+		testName = "RepairBlock on closed tx"
+		err = tx.RepairBlock(block)
+		if !checkDbError(tc.t, testName, err, wantErrCode) {
+			return false
+		}
+
 		// Ensure FetchBlock returns expected error.
 		testName = fmt.Sprintf("FetchBlock #%d on closed tx", i)
 		_, err = tx.FetchBlock(blockHash)
@@ -1884,6 +1905,13 @@ func testClosedTxInterface(tc *testContext, tx database.Tx) bool {
 			return false
 		}
 
+		// Ensure FetchBlockLocation returns expected error.
+		testName = fmt.Sprintf("FetchBlockLocation #%d on closed tx", i)
+		_, err = tx.FetchBlockLocation(blockHash)
+		if !checkDbError(tc.t, testName, err, wantErrCode) {
+			return false
+		}
+
 		// Ensure HasBlock returns expected error.
 		testName = fmt.Sprintf("HasBlock #%d on closed tx", i)
 		_, err = tx.HasBlock(blockHash)
@@ -0,0 +1,44 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+)
+
+// Enforce db implements the database.Pruner interface.
+var _ database.Pruner = (*db)(nil)
+
+// PruneBlocks removes the flat block files which precede the file that holds
+// the block with the passed hash.  Blocks are appended to the files in the order
+// they are stored, so those files only hold blocks which were stored before it.
+// The data of the blocks stored before it in its own file is kept until the
+// whole file can be removed.  The block index, and so the headers of the pruned
+// blocks, is left untouched.
+//
+// This function is part of the database.Pruner interface implementation.
+func (db *db) PruneBlocks(hash *chainhash.Hash) error {
+	// A write transaction is held while the files are removed so no blocks
+	// are written and no writes are rolled back concurrently.
+	tx, err := db.begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	blockRow, err := tx.fetchBlockRow(hash)
+	if err != nil {
+		return err
+	}
+	location := deserializeBlockLoc(blockRow)
+
+	numDeleted, err := db.store.pruneFilesBefore(location.blockFileNum)
+	if numDeleted > 0 {
+		log.Debugf("Pruned %d block files preceding block file %d",
+			numDeleted, location.blockFileNum)
+	}
+	return err
+}
@@ -83,10 +83,20 @@ func reconcileDB(pdb *db, create bool) (database.DB, error) {
 	// the middle of being written.  Since the metadata isn't updated until
 	// after the block data is written, this is effectively just a rollback
 	// to the known good point before the unclean shutdown.
+	//
+	// The files are left untouched when the database is read-only since
+	// the metadata never references the data past its position anyways.
 	wc := pdb.store.writeCursor
 	if wc.curFileNum > curFileNum || (wc.curFileNum == curFileNum &&
 		wc.curOffset > curOffset) {
 
+		if pdb.readOnly {
+			log.Infof("Detected unclean shutdown - Ignoring block "+
+				"data past file %d, offset %d in read-only mode",
+				curFileNum, curOffset)
+			return pdb, nil
+		}
+
 		log.Info("Detected unclean shutdown - Repairing...")
 		log.Debugf("Metadata claims file %d, offset %d. Block data is "+
 			"at file %d, offset %d", curFileNum, curOffset,
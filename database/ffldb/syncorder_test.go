@@ -0,0 +1,369 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// This file is part of the ffldb package rather than the ffldb_test package as
+// it is part of the whitebox testing.
+
+package ffldb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+	"github.com/btcsuite/goleveldb/leveldb"
+)
+
+// syncOrderTipKey is the metadata key the sync order tests store the hash of
+// the most recently stored block under, in the same transaction as the block,
+// much like the chain stores its best state.
+var syncOrderTipKey = []byte("syncordertip")
+
+// crashImage is the state of a database which survives an unclean shutdown at
+// a given point in time.
+type crashImage struct {
+	// files houses the synced data of each flat block file whose creation
+	// was made durable by a directory sync.
+	files map[uint32][]byte
+
+	// meta houses every key/value pair committed to the metadata database.
+	meta map[string][]byte
+}
+
+// syncTracker tracks the data of a database which would survive an unclean
+// shutdown and captures a crash image of it after each sync point, which is
+// every sync of a flat block file or of the directory which houses them.  The
+// metadata committed to leveldb is treated as durable since leveldb syncs its
+// own commits.
+type syncTracker struct {
+	t      *testing.T
+	store  *blockStore
+	ldb    *leveldb.DB
+	synced map[uint32][]byte // Synced data of each block file
+	exists map[uint32]bool   // Block files whose creation is durable
+	images []crashImage
+}
+
+// syncTrackedFile wraps a flat block file opened for writes to notify the sync
+// tracker about each sync.
+type syncTrackedFile struct {
+	filer
+	fileNum uint32
+	tracker *syncTracker
+}
+
+// Sync syncs the underlying file and captures a crash image.
+//
+// This is part of the filer implementation.
+func (f *syncTrackedFile) Sync() error {
+	if err := f.filer.Sync(); err != nil {
+		return err
+	}
+	f.tracker.fileSynced(f.fileNum)
+	return nil
+}
+
+// fileSynced records the current data of the passed block file as durable and
+// captures a crash image.
+func (st *syncTracker) fileSynced(fileNum uint32) {
+	data, err := os.ReadFile(blockFilePath(st.store.basePath, fileNum))
+	if err != nil {
+		st.t.Fatalf("failed to read block file %d: %v", fileNum, err)
+	}
+	st.synced[fileNum] = data
+	st.capture()
+}
+
+// dirSynced records the creation of every block file which currently exists as
+// durable and captures a crash image.
+func (st *syncTracker) dirSynced() {
+	for fileNum := uint32(0); ; fileNum++ {
+		_, err := os.Stat(blockFilePath(st.store.basePath, fileNum))
+		if err != nil {
+			break
+		}
+		st.exists[fileNum] = true
+	}
+	st.capture()
+}
+
+// capture adds a crash image of the current durable state of the database.
+func (st *syncTracker) capture() {
+	st.images = append(st.images, st.image(ldbContents(st.t, st.ldb)))
+}
+
+// image returns a crash image made of the durable block file data and the
+// passed metadata.
+func (st *syncTracker) image(meta map[string][]byte) crashImage {
+	files := make(map[uint32][]byte, len(st.exists))
+	for fileNum := range st.exists {
+		files[fileNum] = st.synced[fileNum]
+	}
+	return crashImage{files: files, meta: meta}
+}
+
+// ldbContents returns every key/value pair in the passed leveldb database.
+func ldbContents(t *testing.T, ldb *leveldb.DB) map[string][]byte {
+	contents := make(map[string][]byte)
+	iter := ldb.NewIterator(nil, nil)
+	for iter.Next() {
+		contents[string(iter.Key())] = append([]byte{}, iter.Value()...)
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		t.Fatalf("failed to iterate metadata: %v", err)
+	}
+	return contents
+}
+
+// syncOrderBlocks returns the passed number of chained blocks which are large
+// enough for a few of them to fill a small flat block file.
+func syncOrderBlocks(numBlocks int) []*provautil.Block {
+	blocks := make([]*provautil.Block, 0, numBlocks)
+	var prevHash chainhash.Hash
+	for i := 0; i < numBlocks; i++ {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		prevOut := wire.NewOutPoint(&chainhash.Hash{}, uint32(i))
+		msgTx.AddTxIn(wire.NewTxIn(prevOut, []byte{byte(i)}))
+		msgTx.AddTxOut(wire.NewTxOut(int64(i), bytes.Repeat([]byte{0x51},
+			200)))
+
+		msgBlock := wire.NewMsgBlock(&wire.BlockHeader{
+			PrevBlock: prevHash,
+			Timestamp: time.Unix(int64(1500000000+i), 0),
+			Height:    uint32(i + 1),
+		})
+		msgBlock.AddTransaction(msgTx)
+		msgBlock.Header.MerkleRoot = msgTx.TxHash()
+
+		block := provautil.NewBlock(msgBlock)
+		blocks = append(blocks, block)
+		prevHash = *block.Hash()
+	}
+	return blocks
+}
+
+// runSyncOrderWorkload stores the passed blocks in a new database at the passed
+// path, the passed number per transaction, and returns a crash image captured
+// after each sync point as well as after the database is closed.
+func runSyncOrderWorkload(t *testing.T, dbPath string, blocks []*provautil.Block,
+	perTx int, flushInterval time.Duration) []crashImage {
+
+	idb, err := openDB(dbPath, blockDataNet, true, false)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	pdb := idb.(*db)
+	store := pdb.store
+	tracker := &syncTracker{
+		t:      t,
+		store:  store,
+		ldb:    pdb.cache.ldb,
+		synced: make(map[uint32][]byte),
+		exists: make(map[uint32]bool),
+	}
+
+	// Use small flat block files so several blocks move the write cursor to
+	// the next file, and track every sync of the files and the directory.
+	store.maxBlockFileSize = 1024
+	store.openWriteFileFunc = func(fileNum uint32) (filer, error) {
+		file, err := store.openWriteFile(fileNum)
+		if err != nil {
+			return nil, err
+		}
+		return &syncTrackedFile{file, fileNum, tracker}, nil
+	}
+	store.syncDirFunc = func() error {
+		if err := store.syncDir(); err != nil {
+			return err
+		}
+		tracker.dirSynced()
+		return nil
+	}
+	pdb.cache.flushInterval = flushInterval
+
+	for i := 0; i < len(blocks); i += perTx {
+		end := i + perTx
+		if end > len(blocks) {
+			end = len(blocks)
+		}
+		err := idb.Update(func(tx database.Tx) error {
+			for _, block := range blocks[i:end] {
+				if err := tx.StoreBlock(block); err != nil {
+					return err
+				}
+			}
+			tip := blocks[end-1].Hash()
+			return tx.Metadata().Put(syncOrderTipKey, tip[:])
+		})
+		if err != nil {
+			t.Fatalf("failed to store blocks %d-%d: %v", i, end-1,
+				err)
+		}
+	}
+
+	// Capture the state after a clean shutdown as well.
+	if err := idb.Close(); err != nil {
+		t.Fatalf("failed to close database: %v", err)
+	}
+	ldb, err := leveldb.OpenFile(filepath.Join(dbPath, metadataDbName), nil)
+	if err != nil {
+		t.Fatalf("failed to open metadata: %v", err)
+	}
+	tracker.images = append(tracker.images,
+		tracker.image(ldbContents(t, ldb)))
+	ldb.Close()
+
+	return tracker.images
+}
+
+// checkCrashImage writes the passed crash image to a new database at the passed
+// path, reopens it, and ensures it is consistent.  That is, the stored blocks
+// are a prefix of the passed blocks which can all be fetched, the tip is the
+// last of them, and the next block can be stored.
+func checkCrashImage(t *testing.T, dbPath string, image crashImage,
+	blocks []*provautil.Block) error {
+
+	_ = os.RemoveAll(dbPath)
+	if err := os.MkdirAll(dbPath, 0700); err != nil {
+		return err
+	}
+	defer os.RemoveAll(dbPath)
+	for fileNum, data := range image.files {
+		err := os.WriteFile(blockFilePath(dbPath, fileNum), data, 0666)
+		if err != nil {
+			return err
+		}
+	}
+	ldb, err := leveldb.OpenFile(filepath.Join(dbPath, metadataDbName), nil)
+	if err != nil {
+		return err
+	}
+	batch := new(leveldb.Batch)
+	for k, v := range image.meta {
+		batch.Put([]byte(k), v)
+	}
+	err = ldb.Write(batch, nil)
+	ldb.Close()
+	if err != nil {
+		return err
+	}
+
+	idb, err := openDB(dbPath, blockDataNet, false, false)
+	if err != nil {
+		return fmt.Errorf("failed to reopen: %v", err)
+	}
+	defer idb.Close()
+
+	var numStored int
+	err = idb.View(func(tx database.Tx) error {
+		for i, block := range blocks {
+			stored, err := tx.HasBlock(block.Hash())
+			if err != nil {
+				return err
+			}
+			if !stored {
+				break
+			}
+			numStored = i + 1
+
+			blockBytes, err := tx.FetchBlock(block.Hash())
+			if err != nil {
+				return fmt.Errorf("block %d: %v", i, err)
+			}
+			wantBytes, _ := block.Bytes()
+			if !bytes.Equal(blockBytes, wantBytes) {
+				return fmt.Errorf("block %d: fetched bytes "+
+					"differ", i)
+			}
+		}
+		for i := numStored; i < len(blocks); i++ {
+			stored, err := tx.HasBlock(blocks[i].Hash())
+			if err != nil {
+				return err
+			}
+			if stored {
+				return fmt.Errorf("block %d is stored without "+
+					"block %d", i, numStored)
+			}
+		}
+
+		tip := tx.Metadata().Get(syncOrderTipKey)
+		switch {
+		case numStored == 0 && tip != nil:
+			return fmt.Errorf("tip %x without stored blocks", tip)
+		case numStored > 0 && !bytes.Equal(tip,
+			blocks[numStored-1].Hash()[:]):
+			return fmt.Errorf("tip %x is not block %d", tip,
+				numStored-1)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if numStored == len(blocks) {
+		return nil
+	}
+
+	// The database must keep working from the older tip.
+	next := blocks[numStored]
+	err = idb.Update(func(tx database.Tx) error {
+		return tx.StoreBlock(next)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store block %d: %v", numStored, err)
+	}
+	return idb.View(func(tx database.Tx) error {
+		_, err := tx.FetchBlock(next.Hash())
+		return err
+	})
+}
+
+// TestSyncOrder ensures the block data and the creation of the flat block files
+// are always durable before the metadata which references them by simulating
+// an unclean shutdown after each sync point, and that the database reopens to a
+// consistent, possibly older, tip in every case.
+func TestSyncOrder(t *testing.T) {
+	blocks := syncOrderBlocks(20)
+	tests := []struct {
+		name          string
+		perTx         int
+		flushInterval time.Duration
+	}{
+		{"flush every commit", 1, 0},
+		{"flush every commit, several blocks", 3, 0},
+		{"flush on close", 1, time.Hour},
+		{"flush on close, several blocks", 3, time.Hour},
+	}
+
+	basePath := filepath.Join(os.TempDir(), "ffldb-syncorder")
+	defer os.RemoveAll(basePath)
+	for _, test := range tests {
+		_ = os.RemoveAll(basePath)
+		dbPath := filepath.Join(basePath, "workload")
+		images := runSyncOrderWorkload(t, dbPath, blocks, test.perTx,
+			test.flushInterval)
+		if len(images) < 2 {
+			t.Fatalf("%s: only %d crash images captured", test.name,
+				len(images))
+		}
+
+		imagePath := filepath.Join(basePath, "image")
+		for i, image := range images {
+			err := checkCrashImage(t, imagePath, image, blocks)
+			if err != nil {
+				t.Errorf("%s: crash image %d of %d: %v",
+					test.name, i, len(images), err)
+			}
+		}
+	}
+}
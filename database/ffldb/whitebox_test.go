@@ -9,6 +9,7 @@
 package ffldb
 
 import (
+	"bytes"
 	"compress/bzip2"
 	"encoding/binary"
 	"fmt"
@@ -180,7 +181,7 @@ func TestCornerCases(t *testing.T) {
 	// directory is needed.
 	testName := "openDB: fail due to file at target location"
 	wantErrCode := database.ErrDriverSpecific
-	idb, err := openDB(dbPath, blockDataNet, true)
+	idb, err := openDB(dbPath, blockDataNet, true, false)
 	if !checkDbError(t, testName, err, wantErrCode) {
 		if err == nil {
 			idb.Close()
@@ -192,7 +193,7 @@ func TestCornerCases(t *testing.T) {
 	// Remove the file and create the database to run tests against.  It
 	// should be successful this time.
 	_ = os.RemoveAll(dbPath)
-	idb, err = openDB(dbPath, blockDataNet, true)
+	idb, err = openDB(dbPath, blockDataNet, true, false)
 	if err != nil {
 		t.Errorf("openDB: unexpected error: %v", err)
 		return
@@ -543,19 +544,19 @@ func testCorruption(tc *testContext) bool {
 
 		// The same network byte, but this time don't fix the checksum
 		// to ensure the corruption is detected.
-		{2, false, database.ErrCorruption},
+		{2, false, database.ErrBlockCorrupt},
 
 		// One of the block length bytes.
-		{6, false, database.ErrCorruption},
+		{6, false, database.ErrBlockCorrupt},
 
 		// Random header byte.
-		{17, false, database.ErrCorruption},
+		{17, false, database.ErrBlockCorrupt},
 
 		// Random transaction byte.
-		{90, false, database.ErrCorruption},
+		{90, false, database.ErrBlockCorrupt},
 
 		// Random checksum byte.
-		{uint32(len(block0Bytes)) + 10, false, database.ErrCorruption},
+		{uint32(len(block0Bytes)) + 10, false, database.ErrBlockCorrupt},
 	}
 	err = tc.db.View(func(tx database.Tx) error {
 		data := tc.files[0].file.(*mockFile).data
@@ -596,6 +597,60 @@ func testCorruption(tc *testContext) bool {
 		return false
 	}
 
+	// Ensure a block whose stored data fails checksum verification can be
+	// repaired with a good copy and is readable again afterwards.
+	data := tc.files[0].file.(*mockFile).data
+	data[90] ^= 0x10
+	err = tc.db.View(func(tx database.Tx) error {
+		_, err := tx.FetchBlock(block0Hash)
+		if !checkDbError(tc.t, "FetchBlock before repair", err,
+			database.ErrBlockCorrupt) {
+			return errSubTestFail
+		}
+		return nil
+	})
+	if err != nil {
+		if err != errSubTestFail {
+			tc.t.Errorf("View: unexpected error: %v", err)
+		}
+		return false
+	}
+	err = tc.db.Update(func(tx database.Tx) error {
+		return tx.RepairBlock(tc.blocks[0])
+	})
+	if err != nil {
+		tc.t.Errorf("RepairBlock: unexpected error: %v", err)
+		return false
+	}
+	err = tc.db.View(func(tx database.Tx) error {
+		gotBytes, err := tx.FetchBlock(block0Hash)
+		if err != nil {
+			tc.t.Errorf("FetchBlock after repair: unexpected "+
+				"error: %v", err)
+			return errSubTestFail
+		}
+		if !bytes.Equal(gotBytes, block0Bytes) {
+			tc.t.Errorf("FetchBlock after repair: bytes mismatch "+
+				"- got %x, want %x", gotBytes, block0Bytes)
+			return errSubTestFail
+		}
+		return nil
+	})
+	if err != nil {
+		if err != errSubTestFail {
+			tc.t.Errorf("View: unexpected error: %v", err)
+		}
+		return false
+	}
+
+	// Ensure repairing a block which was never stored fails.
+	err = tc.db.Update(func(tx database.Tx) error {
+		return tx.RepairBlock(tc.blocks[1])
+	})
+	if !checkDbError(tc.t, "RepairBlock unknown block", err,
+		database.ErrBlockNotFound) {
+		return false
+	}
 	return true
 }
 
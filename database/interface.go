@@ -204,6 +204,16 @@ type BlockRegion struct {
 	Len    uint32
 }
 
+// BlockLocation describes where the serialized bytes of a stored block reside
+// on disk.  The serialized block occupies Len bytes of the file at the path
+// File starting at Offset, in the format returned by Serialize on a
+// wire.MsgBlock.
+type BlockLocation struct {
+	File   string
+	Offset uint32
+	Len    uint32
+}
+
 // Tx represents a database transaction.  It can either by read-only or
 // read-write.  The transaction provides a metadata bucket against which all
 // read and writes occur.
@@ -230,6 +240,21 @@ type Tx interface {
 	// Other errors are possible depending on the implementation.
 	StoreBlock(block *provautil.Block) error
 
+	// RepairBlock replaces the stored data for an existing block with the
+	// provided block.  It is intended to be used to restore a block whose
+	// stored data failed checksum verification with a good copy obtained
+	// elsewhere, such as from the network.  The provided block must hash
+	// to the same value as the block being replaced.
+	//
+	// The interface contract guarantees at least the following errors will
+	// be returned (other implementation-specific errors are possible):
+	//   - ErrBlockNotFound if the block hash does not already exist
+	//   - ErrTxNotWritable if attempted against a read-only transaction
+	//   - ErrTxClosed if the transaction has already been closed
+	//
+	// Other errors are possible depending on the implementation.
+	RepairBlock(block *provautil.Block) error
+
 	// HasBlock returns whether or not a block with the given hash exists
 	// in the database.
 	//
@@ -309,6 +334,8 @@ type Tx interface {
 	//   - ErrBlockNotFound if the requested block hash does not exist
 	//   - ErrTxClosed if the transaction has already been closed
 	//   - ErrCorruption if the database has somehow become corrupted
+	//   - ErrBlockCorrupt if the stored data for a requested block fails
+	//     checksum verification
 	//
 	// NOTE: The data returned by this function is only valid during a
 	// database transaction.  Attempting to access it after a transaction
@@ -327,6 +354,8 @@ type Tx interface {
 	//     exist
 	//   - ErrTxClosed if the transaction has already been closed
 	//   - ErrCorruption if the database has somehow become corrupted
+	//   - ErrBlockCorrupt if the stored data for a requested block fails
+	//     checksum verification
 	//
 	// NOTE: The data returned by this function is only valid during a
 	// database transaction.  Attempting to access it after a transaction
@@ -390,6 +419,21 @@ type Tx interface {
 	// implementations.
 	FetchBlockRegions(regions []BlockRegion) ([][]byte, error)
 
+	// FetchBlockLocation returns the location of the serialized bytes of
+	// the block identified by the given hash in the underlying block
+	// storage.  This allows the raw block data to be read directly without
+	// going through the database.
+	//
+	// The interface contract guarantees at least the following errors will
+	// be returned (other implementation-specific errors are possible):
+	//   - ErrBlockNotFound if the requested block hash does not exist or
+	//     the block has not been written to the block storage yet
+	//   - ErrBlockPruned if the data of the requested block is no longer
+	//     available
+	//   - ErrTxClosed if the transaction has already been closed
+	//   - ErrCorruption if the database has somehow become corrupted
+	FetchBlockLocation(hash *chainhash.Hash) (*BlockLocation, error)
+
 	// ******************************************************************
 	// Methods related to both atomic metadata storage and block storage.
 	// ******************************************************************
@@ -465,3 +509,83 @@ type DB interface {
 	// back or committed).
 	Close() error
 }
+
+// BackupFile describes a file written by a database backup.
+type BackupFile struct {
+	// Path is the path of the file relative to the directory the backup
+	// was written to.
+	Path string
+
+	// Size is the size of the file in bytes.
+	Size int64
+
+	// SHA256 is the SHA-256 checksum of the contents of the file.
+	SHA256 [32]byte
+}
+
+// Backup is a consistent point-in-time view of a database which can be written
+// out as a complete copy of the database while the database remains in use.
+type Backup interface {
+	// Write writes a copy of the database as of the time the backup was
+	// started to the passed directory and returns a description of every
+	// file it wrote.  The directory must not already exist.  The copy may
+	// be opened with the same driver once it has been written.
+	Write(destPath string) ([]BackupFile, error)
+
+	// Release releases the resources held by the backup.  It must be
+	// called once the backup is no longer needed since the database can't
+	// be closed until all of its backups have been released.
+	Release()
+}
+
+// Backuper is implemented by databases which support taking consistent backups
+// while they are open.
+type Backuper interface {
+	// BeginBackup flushes all pending writes to persistent storage and
+	// captures the current state of the database.  Write transactions are
+	// blocked while the state is captured, but may resume as soon as the
+	// function returns, long before the backup is written.
+	BeginBackup() (Backup, error)
+}
+
+// Pruner is implemented by databases which support removing the stored data of
+// old blocks to reclaim disk space.
+type Pruner interface {
+	// PruneBlocks removes the stored data of blocks which were stored
+	// before the block identified by the given hash.  Blocks stored after
+	// it, which include all of its descendants, are never pruned.  The
+	// headers of the pruned blocks and all metadata remain available,
+	// while attempting to fetch the data of a pruned block returns
+	// ErrBlockPruned.
+	//
+	// Implementations may keep the data of some of the blocks stored
+	// before the given block, such as blocks which share storage with
+	// later blocks, so callers must not rely on their data being removed.
+	//
+	// The interface contract guarantees at least the following errors will
+	// be returned (other implementation-specific errors are possible):
+	//   - ErrBlockNotFound if the requested block hash does not exist
+	//   - ErrDbReadOnly if the database was opened read-only
+	//   - ErrDbNotOpen if the database is not open
+	PruneBlocks(hash *chainhash.Hash) error
+}
+
+// CacheStats describes the occupancy of the write cache of a database.
+type CacheStats struct {
+	// Size is the total size in bytes of the pending writes held in the
+	// cache, such as the changes to the UTXO set since the cache was last
+	// flushed.
+	Size uint64
+
+	// MaxSize is the size in bytes the cache is flushed at.
+	MaxSize uint64
+}
+
+// CacheReporter is implemented by databases which cache writes before they are
+// flushed to persistent storage.
+type CacheReporter interface {
+	// CacheStats returns the current occupancy of the write cache.  It
+	// only takes a snapshot of the cache, so it is cheap enough to be
+	// called periodically.
+	CacheStats() CacheStats
+}
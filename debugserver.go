@@ -0,0 +1,311 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/provautil"
+)
+
+// defaultDebugMempoolEntries is the number of mempool entries with the highest
+// fee rate returned by the /debug/mempool endpoint unless the count parameter
+// is specified.
+const defaultDebugMempoolEntries = 20
+
+// debugBestState describes the best block of the main chain in the result of
+// the /debug/chain endpoint.
+type debugBestState struct {
+	Hash       string `json:"hash"`
+	Height     uint32 `json:"height"`
+	Bits       uint32 `json:"bits"`
+	BlockSize  uint64 `json:"blocksize"`
+	NumTxns    uint64 `json:"numtxns"`
+	TotalTxns  uint64 `json:"totaltxns"`
+	Time       int64  `json:"time"`
+	MedianTime int64  `json:"mediantime"`
+}
+
+// debugLockStats describes the contention of the chain lock in the result of
+// the /debug/chain endpoint.  The durations are in microseconds.
+type debugLockStats struct {
+	Acquisitions       uint64 `json:"acquisitions"`
+	SharedAcquisitions uint64 `json:"sharedacquisitions"`
+	Contended          uint64 `json:"contended"`
+	TotalWait          int64  `json:"totalwait"`
+	MaxWait            int64  `json:"maxwait"`
+}
+
+// debugChainResult is the result of the /debug/chain endpoint.
+type debugChainResult struct {
+	Best      debugBestState `json:"best"`
+	ChainLock debugLockStats `json:"chainlock"`
+}
+
+// debugMempoolEntry describes a transaction of the memory pool in the result of
+// the /debug/mempool endpoint.
+type debugMempoolEntry struct {
+	TxID     string  `json:"txid"`
+	Size     int     `json:"size"`
+	Fee      float64 `json:"fee"`
+	FeePerKB int64   `json:"feeperkb"`
+	FeeDelta int64   `json:"feedelta,omitempty"`
+	Time     int64   `json:"time"`
+	Height   uint32  `json:"height"`
+}
+
+// debugMempoolResult is the result of the /debug/mempool endpoint.
+type debugMempoolResult struct {
+	Size        int64               `json:"size"`
+	Bytes       int64               `json:"bytes"`
+	LastUpdated int64               `json:"lastupdated"`
+	TopFeeRate  []debugMempoolEntry `json:"topfeerate"`
+}
+
+// txDescsByFeeRate sorts memory pool entries by descending fee rate.
+type txDescsByFeeRate []*mempool.TxDesc
+
+func (s txDescsByFeeRate) Len() int      { return len(s) }
+func (s txDescsByFeeRate) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s txDescsByFeeRate) Less(i, j int) bool {
+	return s[i].FeePerKB > s[j].FeePerKB
+}
+
+// debugServer serves read-only introspection endpoints, along with the pprof
+// profiles, over plain HTTP.  The endpoints are built with the handlers of the
+// corresponding RPC commands, which work from snapshots of the chain, memory
+// pool and peer state, so serving them never waits for the chain lock.  The
+// server has no authentication, which is why it only listens on localhost
+// unless the configuration explicitly allows otherwise.
+type debugServer struct {
+	started   int32
+	shutdown  int32
+	rpc       *rpcServer
+	handler   http.Handler
+	server    *http.Server
+	listeners []net.Listener
+	wg        sync.WaitGroup
+}
+
+// writeJSON writes the passed value as the JSON body of the response.
+func (s *debugServer) writeJSON(w http.ResponseWriter, v interface{}) {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+	w.Write([]byte{'\n'})
+}
+
+// writeResult writes the passed result of an RPC handler as the JSON body of
+// the response, or the error it returned.
+func (s *debugServer) writeResult(w http.ResponseWriter, result interface{}, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, result)
+}
+
+// handleChain serves the /debug/chain endpoint, which describes the best block
+// of the main chain along with the contention of the chain lock.
+func (s *debugServer) handleChain(w http.ResponseWriter, r *http.Request) {
+	best := s.rpc.chain.BestSnapshot()
+	lockStats := s.rpc.chain.ChainLockStats()
+	s.writeJSON(w, &debugChainResult{
+		Best: debugBestState{
+			Hash:       best.Hash.String(),
+			Height:     best.Height,
+			Bits:       best.Bits,
+			BlockSize:  best.BlockSize,
+			NumTxns:    best.NumTxns,
+			TotalTxns:  best.TotalTxns,
+			Time:       best.Timestamp.Unix(),
+			MedianTime: best.MedianTime.Unix(),
+		},
+		ChainLock: debugLockStats{
+			Acquisitions:       lockStats.Acquisitions,
+			SharedAcquisitions: lockStats.SharedAcquisitions,
+			Contended:          lockStats.Contended,
+			TotalWait:          int64(lockStats.TotalWait / time.Microsecond),
+			MaxWait:            int64(lockStats.MaxWait / time.Microsecond),
+		},
+	})
+}
+
+// handleMempool serves the /debug/mempool endpoint, which summarizes the memory
+// pool and lists the entries with the highest fee rate.  The number of entries
+// is set by the count parameter.
+func (s *debugServer) handleMempool(w http.ResponseWriter, r *http.Request) {
+	count := defaultDebugMempoolEntries
+	if param := r.URL.Query().Get("count"); param != "" {
+		var err error
+		count, err = strconv.Atoi(param)
+		if err != nil || count < 0 {
+			http.Error(w, "invalid count "+param,
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := handleGetMempoolInfo(s.rpc, &btcjson.GetMempoolInfoCmd{},
+		r.Context().Done())
+	if err != nil {
+		s.writeResult(w, nil, err)
+		return
+	}
+	info := result.(*btcjson.GetMempoolInfoResult)
+
+	txPool := s.rpc.server.txMemPool
+	descs := txPool.TxDescs()
+	sort.Sort(txDescsByFeeRate(descs))
+	if count < len(descs) {
+		descs = descs[:count]
+	}
+	entries := make([]debugMempoolEntry, 0, len(descs))
+	for _, desc := range descs {
+		entries = append(entries, debugMempoolEntry{
+			TxID:     desc.Tx.Hash().String(),
+			Size:     desc.Tx.MsgTx().SerializeSize(),
+			Fee:      provautil.Amount(desc.Fee).ToRMG(),
+			FeePerKB: desc.FeePerKB,
+			FeeDelta: desc.FeeDelta,
+			Time:     desc.Added.Unix(),
+			Height:   desc.Height,
+		})
+	}
+	s.writeJSON(w, &debugMempoolResult{
+		Size:        info.Size,
+		Bytes:       info.Bytes,
+		LastUpdated: txPool.LastUpdated().Unix(),
+		TopFeeRate:  entries,
+	})
+}
+
+// handlePeers serves the /debug/peers endpoint, which describes the connected
+// peers the same way as the getpeerinfo RPC.
+func (s *debugServer) handlePeers(w http.ResponseWriter, r *http.Request) {
+	result, err := handleGetPeerInfo(s.rpc, &btcjson.GetPeerInfoCmd{},
+		r.Context().Done())
+	s.writeResult(w, result, err)
+}
+
+// handleAdminState serves the /debug/adminstate endpoint, which describes the
+// admin state of the best block the same way as the getadmininfo RPC.
+func (s *debugServer) handleAdminState(w http.ResponseWriter, r *http.Request) {
+	result, err := handleGetAdminInfo(s.rpc, &btcjson.GetAdminInfoCmd{},
+		r.Context().Done())
+	s.writeResult(w, result, err)
+}
+
+// readOnly wraps the passed handler so it only serves GET and HEAD requests.
+func readOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed",
+				http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// Start is used by server.go to start the debug listeners.
+func (s *debugServer) Start() {
+	if atomic.AddInt32(&s.started, 1) != 1 {
+		return
+	}
+
+	rpcsLog.Trace("Starting debug server")
+	for _, listener := range s.listeners {
+		s.wg.Add(1)
+		go func(listener net.Listener) {
+			rpcsLog.Infof("Debug server listening on %s",
+				listener.Addr())
+			s.server.Serve(listener)
+			rpcsLog.Tracef("Debug listener done for %s",
+				listener.Addr())
+			s.wg.Done()
+		}(listener)
+	}
+}
+
+// Stop is used by server.go to stop the debug listeners.  Requests which are
+// still in progress, such as CPU profiles, are aborted.
+func (s *debugServer) Stop() {
+	if atomic.AddInt32(&s.shutdown, 1) != 1 {
+		rpcsLog.Infof("Debug server is already in the process of " +
+			"shutting down")
+		return
+	}
+	rpcsLog.Warnf("Debug server shutting down")
+	s.server.Close()
+	s.wg.Wait()
+	rpcsLog.Infof("Debug server shutdown complete")
+}
+
+// newDebugServer returns a debug server which listens on the passed addresses
+// and builds its endpoints with the handlers of the passed RPC server.
+func newDebugServer(listenAddrs []string, rpc *rpcServer) (*debugServer, error) {
+	s := debugServer{
+		rpc: rpc,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/chain", readOnly(s.handleChain))
+	mux.HandleFunc("/debug/mempool", readOnly(s.handleMempool))
+	mux.HandleFunc("/debug/peers", readOnly(s.handlePeers))
+	mux.HandleFunc("/debug/adminstate", readOnly(s.handleAdminState))
+	s.handler = mux
+	s.server = &http.Server{Handler: mux}
+
+	ipv4ListenAddrs, ipv6ListenAddrs, _, err := parseListeners(listenAddrs)
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]net.Listener, 0,
+		len(ipv6ListenAddrs)+len(ipv4ListenAddrs))
+	for _, addr := range ipv4ListenAddrs {
+		listener, err := net.Listen("tcp4", addr)
+		if err != nil {
+			rpcsLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	for _, addr := range ipv6ListenAddrs {
+		listener, err := net.Listen("tcp6", addr)
+		if err != nil {
+			rpcsLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		return nil, errors.New("debug: No valid listen address")
+	}
+	s.listeners = listeners
+
+	return &s, nil
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+)
+
+// getDebugJSON requests the passed URL of a debug server and unmarshals the
+// JSON response into the passed value.
+func getDebugJSON(t *testing.T, url string, v interface{}) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: unexpected error: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("GET %s: unable to read response: %v", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: got status %s: %s", url, resp.Status, body)
+	}
+	if resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("GET %s: unexpected content type %q", url,
+			resp.Header.Get("Content-Type"))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatalf("GET %s: invalid JSON response %s: %v", url, body, err)
+	}
+}
+
+// TestDebugServer ensures each debug endpoint returns valid JSON while blocks
+// are being processed, and that the endpoints describe the chain once the
+// blocks are processed.
+func TestDebugServer(t *testing.T) {
+	defer func(c *config, p *params) {
+		cfg = c
+		activeNetParams = p
+	}(cfg, activeNetParams)
+	activeNetParams = &regressionNetParams
+	chainParams := activeNetParams.Params
+
+	tmpDir, err := ioutil.TempDir("", "debugserver")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cfg = newTestConfig(tmpDir)
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		chainParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+	s, err := newServer(cfg.Listeners, db, chainParams)
+	if err != nil {
+		t.Fatalf("newServer: unexpected error: %v", err)
+	}
+	s.Start()
+	defer func() {
+		s.Stop()
+		s.WaitForShutdown()
+	}()
+
+	rpc := &rpcServer{server: s, chain: s.blockManager.chain}
+	ds, err := newDebugServer([]string{"127.0.0.1:0"}, rpc)
+	if err != nil {
+		t.Fatalf("newDebugServer: unexpected error: %v", err)
+	}
+	ds.Start()
+	defer ds.Stop()
+	baseURL := "http://" + ds.listeners[0].Addr().String()
+
+	// Generate blocks with a separate chain and process them with the
+	// server while the endpoints are requested.
+	const numBlocks = 20
+	source := newTestRPCHarness(t, nil)
+	defer source.teardown()
+	blocks := make([]*provautil.Block, 0, numBlocks)
+	for i := 0; i < numBlocks; i++ {
+		block := provautil.NewBlock(source.generateBlock(t))
+		_, _, err := source.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+	done := make(chan error)
+	go func() {
+		for _, block := range blocks {
+			_, _, err := s.blockManager.ProcessBlock(block,
+				blockchain.BFNone)
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+		close(done)
+	}()
+
+	var (
+		chainResult   debugChainResult
+		mempoolResult debugMempoolResult
+		peersResult   []btcjson.GetPeerInfoResult
+		adminResult   btcjson.GetAdminInfoResult
+	)
+	getAll := func() {
+		getDebugJSON(t, baseURL+"/debug/chain", &chainResult)
+		getDebugJSON(t, baseURL+"/debug/mempool?count=5", &mempoolResult)
+		getDebugJSON(t, baseURL+"/debug/peers", &peersResult)
+		getDebugJSON(t, baseURL+"/debug/adminstate", &adminResult)
+	}
+	for processing := true; processing; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("ProcessBlock: unexpected error: %v", err)
+			}
+			processing = false
+		default:
+		}
+		getAll()
+	}
+
+	// Once the blocks are processed, the endpoints describe the tip of the
+	// chain.
+	getAll()
+	best := s.blockManager.chain.BestSnapshot()
+	if chainResult.Best.Hash != best.Hash.String() ||
+		chainResult.Best.Height != numBlocks ||
+		chainResult.ChainLock.Acquisitions == 0 {
+
+		t.Fatalf("unexpected chain result: %+v", chainResult)
+	}
+	if adminResult.Hash != best.Hash.String() ||
+		adminResult.Height != numBlocks || len(adminResult.RootKeys) == 0 {
+
+		t.Fatalf("unexpected admin state result: %+v", adminResult)
+	}
+	if mempoolResult.Size != 0 || mempoolResult.TopFeeRate == nil ||
+		len(mempoolResult.TopFeeRate) != 0 {
+
+		t.Fatalf("unexpected mempool result: %+v", mempoolResult)
+	}
+	if peersResult == nil || len(peersResult) != 0 {
+		t.Fatalf("unexpected peers result: %+v", peersResult)
+	}
+
+	// The endpoints are read-only, invalid parameters are refused, and the
+	// profiles are served alongside them.
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"POST", "/debug/chain", http.StatusMethodNotAllowed},
+		{"GET", "/debug/mempool?count=-1", http.StatusBadRequest},
+		{"GET", "/debug/pprof/", http.StatusOK},
+		{"GET", "/debug/pprof/goroutine?debug=1", http.StatusOK},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, baseURL+test.path, nil)
+		if err != nil {
+			t.Fatalf("unable to create request: %v", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: unexpected error: %v", test.method,
+				test.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Fatalf("%s %s: got status %d, want %d", test.method,
+				test.path, resp.StatusCode, test.status)
+		}
+	}
+}
@@ -32,6 +32,17 @@ Application Options:
                             Listening is automatically disabled if the --connect
                             or --proxy options are used without also specifying
                             listen interfaces via --listen
+      --outboundonly        Only connect to the peers specified with --connect
+                            and aggressively reconnect to them.  Listening,
+                            address advertisement, and answering address
+                            requests are disabled
+      --noadvertise         Never announce the addresses this node listens on to
+                            peers, such as when it only accepts connections from
+                            known peers
+      --privatenet=         Add a network in CIDR notation whose addresses are
+                            never relayed to peers, such as the internal network
+                            of a validator (eg. 10.1.0.0/16) -- Unroutable
+                            addresses are never relayed either
       --listen=             Add an interface/port to listen for connections
                             (default all interfaces port: 8333, testnet: 18333)
       --maxpeers=           Max number of inbound and outbound peers (125)
@@ -40,6 +51,66 @@ Application Options:
                             banning misbehaving peers.
       --banduration=        How long to ban misbehaving peers.  Valid time units
                             are {s, m, h}.  Minimum 1 second (24h0m0s)
+      --minprotocolversion= Reject peers which advertise a lower protocol version
+                            (209)
+      --requireservice=     Reject outbound peers which do not advertise the
+                            given service and don't add them to the address
+                            manager {network, networklimited, getutxo,
+                            bloom}
+      --rejectuseragent=    Reject peers whose user agent matches the given
+                            regular expression
+      --deprioritizeuseragent= Try peers whose user agent matched the given
+                            regular expression last when choosing outbound
+                            peers
+      --maxpayload=         Override the maximum payload size in bytes of
+                            messages with a command received from peers.
+                            Format: '<command>:<bytes>'
+      --strictblockdecoding Reject blocks received from peers which are not
+                            serialized canonically, such as blocks followed by
+                            trailing data
+      --rejectwarnpeers=    Warn when a block produced by this node is rejected
+                            by more than this many peers (2)
+      --chainsplitfraction= Warn of a chain split when more than this fraction
+                            of the peers with a known best block diverge from
+                            the best chain (0.5)
+      --chainsplitdepth=    Number of blocks the best block of a peer must
+                            diverge from the best chain by for the peer to
+                            count towards a chain split (3)
+      --chainsplitduration= How long the peers must diverge from the best
+                            chain before a chain split is reported.  Valid time
+                            units are {s, m, h} (2m0s)
+      --threadstuckblocks=  Warn when an admin thread has not advanced for more
+                            than this many blocks while admin transactions for
+                            it are pending in the mempool (6)
+      --trickleinterval=    How long to wait between announcing batches of
+                            transaction inventory to each peer (default: the
+                            target time per block of the network / 300,
+                            between 100ms and 2s).  Valid time units are
+                            {ms, s, m}
+      --maxinvbatch=        Maximum number of inventory vectors announced to a
+                            peer in a single batch (1000)
+      --peerqueuesize=      Maximum number of messages and inventory vectors
+                            waiting to be sent to each peer before the queueing
+                            blocks (50)
+      --peertracedir=       Directory to write the message captures of peers
+                            traced with the setpeertrace RPC to (default:
+                            peertrace in the data directory)
+      --peertracemaxsize=   Maximum size in MiB of each message capture file
+                            before moving on to a new one (16)
+      --peertracemaxfiles=  Maximum number of message capture files kept for
+                            each traced peer -- 0 keeps all of them (8)
+      --peereventlog        Write the peer, direction, command, size, and time
+                            of the messages exchanged with all peers to a
+                            compact binary event log for offline analysis
+      --peereventlogdir=    Directory to write the peer event log to (default:
+                            peerevents in the data directory)
+      --peereventlogmaxsize= Maximum size in MiB of all of the peer event log
+                            files -- the oldest files are removed to stay
+                            within it (64)
+      --retainblocks=       Only serve the specified number of most recent
+                            blocks to peers and advertise limited block history
+                            instead of full history (minimum: 288) -- 0 serves
+                            all blocks
   -u, --rpcuser=            Username for RPC connections
   -P, --rpcpass=            Password for RPC connections
       --rpclimituser=       Username for limited RPC connections
@@ -51,14 +122,49 @@ Application Options:
       --rpcmaxclients=      Max number of RPC clients for standard connections
                             (10)
       --rpcmaxwebsockets=   Max number of RPC websocket connections (25)
+      --rpcslowthreshold=   Log RPC calls which take longer than this to
+                            complete, 0 to disable.  Valid time units are {ms,
+                            s, m, h} (10s)
+      --rpcmaxquerysize=    Max size in bytes of RPC requests other than those
+                            carrying serialized blocks or transactions
+                            (1048576)
+      --rpcmaxsubmitsize=   Max size in bytes of RPC requests carrying
+                            serialized blocks or transactions, such as
+                            submitblock and sendrawtransaction (5065536)
+      --rpcrequesttimeout=  Abort RPC requests which take longer than this to
+                            complete, except getblocktemplate, generate and
+                            verifychain, 0 to disable.  Valid time units are
+                            {ms, s, m, h} (1m0s)
+      --rpcmaxrequests=     Max number of RPC requests serviced at once across
+                            all clients, 0 for no limit (64)
+      --rpcmaxclientrequests= Max number of RPC requests serviced at once for
+                            each client address, 0 for no limit (16)
+      --rpcjobttl=          Keep the results of RPC jobs started with startjob
+                            for this long after they finish.  Valid time units
+                            are {ms, s, m, h} (10m0s)
       --rpcquirks           Mirror some JSON-RPC quirks of Bitcoin Core -- NOTE:
                             Discouraged unless interoperability issues need to
                             be worked around
       --norpc               Disable built-in RPC server -- NOTE: The RPC server
                             is disabled by default if no rpcuser/rpcpass or
                             rpclimituser/rpclimitpass is specified
-      --notls               Disable TLS for the RPC server -- NOTE: This is only
-                            allowed if the RPC server is bound to localhost
+      --notls               Disable TLS for the RPC and gRPC servers -- NOTE:
+                            This is only allowed if the servers are bound to
+                            localhost
+      --grpclisten=         Add an interface/port to listen for gRPC
+                            connections (default port: 8335, testnet: 18335)
+                            -- NOTE: The gRPC server is disabled unless at
+                            least one interface is specified
+      --grpctoken=          Bearer token for gRPC connections
+      --grpclimittoken=     Bearer token for limited gRPC connections
+      --debuglisten=        Add an interface/port to serve pprof and read-only
+                            chain, mempool, peer and admin state snapshots over
+                            HTTP (default port: 8336, testnet: 18336) -- NOTE:
+                            The debug server is disabled unless at least one
+                            interface is specified
+      --debugallowremote    Allow the debug server to listen on interfaces
+                            other than localhost -- NOTE: The debug server has
+                            no authentication
       --nodnsseed           Disable DNS seeding for peers
       --externalip=         Add an ip to the list of local addresses we claim to
                             listen on to peers
@@ -70,15 +176,27 @@ Application Options:
       --onionuser=          Username for onion proxy server
       --onionpass=          Password for onion proxy server
       --noonion             Disable connecting to tor hidden services
+      --onlynet=            Only connect to peers on this network (ipv4, ipv6,
+                            or onion) -- may be specified multiple times
+      --prefernet=          Connect to peers on this network (ipv4, ipv6, or
+                            onion) more often than to peers on other networks
       --torisolation        Enable Tor stream isolation by randomizing user
                             credentials for each connection.
       --testnet             Use the test network
       --regtest             Use the regression test network
       --simnet              Use the simulation test network
+      --powonly             Accept blocks on proof of work alone without
+                            requiring validate key signatures, so blocks can
+                            be mined with the CPU -- Only valid with regtest
+                            or simnet
       --addcheckpoint=      Add a custom checkpoint.  Format: '<height>:<hash>'
       --nocheckpoints       Disable built-in checkpoints.  Don't do this unless
                             you know what you're doing.
       --dbtype=             Database backend to use for the Block Chain (ffldb)
+      --readonly            Open the existing block database without modifying
+                            it, such as to inspect a copy of a data directory
+                            -- Disables peer-to-peer networking, the memory
+                            pool, mining, and RPCs which modify the chain
       --profile=            Enable HTTP profiling on given port -- NOTE port
                             must be between 1024 and 65536
       --cpuprofile=         Write CPU profile to the specified file
@@ -97,11 +215,26 @@ Application Options:
                             high priority for relaying
       --maxorphantx=        Max number of orphan transactions to keep in memory
                             (100)
+      --mempoolexpiry=      How long an unconfirmed transaction may stay in the
+                            mempool before it is evicted along with the
+                            transactions which depend on it -- Admin and
+                            prioritised transactions never expire.  Valid time
+                            units are {s, m, h}.  0 disables expiry (336h0m0s)
       --generate            Generate (mine) blocks using the CPU
       --miningaddr=         Add the specified payment address to the list of
                             addresses to use for generated blocks -- At least
                             one address is required if the generate option is
                             set
+      --blocksignerurl=     URL of a remote signing service, such as one backed
+                            by an HSM, to request signatures of generated blocks
+                            from instead of using local validate keys
+      --blocksignerpubkey=  Add the hex-encoded compressed public key of a
+                            validate key held by the remote block signer -- At
+                            least one is required if the blocksignerurl option
+                            is set
+      --blocksignertimeout= How long to wait for the remote block signer to
+                            sign a block.  Valid time units are {s, m, h}
+                            (10s)
       --blockminsize=       Mininum block size in bytes to be used when creating
                             a block
       --blockmaxsize=       Maximum block size in bytes to be used when creating
@@ -111,11 +244,44 @@ Application Options:
       --nopeerbloomfilters  Disable bloom filtering support.
       --sigcachemaxsize=    The maximum number of entries in the signature
                             verification cache.
+      --sigverifyworkers=   Number of goroutines used to verify the scripts of
+                            blocks and transactions -- 0 selects a number based
+                            on the number of processor cores (0)
+      --scrubrate=          Maximum number of stored blocks per second to
+                            verify against their checksums in the background
+                            -- 0 disables background scrubbing (100)
+      --scrubinterval=      How long to wait between background scrubs of the
+                            stored blocks.  Valid time units are {s, m, h}.
+                            Minimum 1 second (24h0m0s)
+      --statsinterval=      How often to record the mempool, cache and peer
+                            statistics returned by the getstatshistory RPC.
+                            Valid time units are {s, m, h} -- 0 disables
+                            recording (5m0s)
+      --statsretention=     How long to keep the recorded mempool, cache and
+                            peer statistics.  Valid time units are {s, m, h}.
+                            May not be less than statsinterval (72h0m0s)
+      --webhook=            Add an HTTP endpoint to deliver block connected,
+                            block disconnected, admin key change, watched
+                            spend, chain split, stuck admin thread, and
+                            double sign notifications to
+      --webhooksecret=      Secret used to sign webhook payloads with
+                            HMAC-SHA256 -- Required when any webhooks are
+                            configured
+      --webhookqueuesize=   Maximum number of notifications waiting to be
+                            delivered to each webhook endpoint (1000)
+      --broadcasturl=       Add an HTTP endpoint to submit the raw blocks
+                            produced by this node to, in addition to relaying
+                            them to peers
+      --broadcastworkers=   Maximum number of block submissions to broadcast
+                            endpoints in progress at once (4)
       --blocksonly          Do not accept transactions from remote peers.
       --relaynonstd         Relay non-standard transactions regardless of the
                             default settings for the active network.
       --rejectnonstd        Reject non-standard transactions regardless of the
                             default settings for the active network.
+      --rejectnoncanonical  Reject transactions whose inputs and outputs are not
+                            in the canonical BIP 69 order -- Admin transactions
+                            are exempt
 
 Help Options:
   -h, --help           Show this help message
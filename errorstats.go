@@ -0,0 +1,50 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcjson"
+)
+
+// errorStatsResult returns the result of the geterrorstats command for the
+// passed error stats, which may be nil when no rejections are counted.
+func errorStatsResult(stats *blockchain.ErrorStats) *btcjson.GetErrorStatsResult {
+	result := &btcjson.GetErrorStatsResult{
+		Errors: make([]btcjson.ErrorCountResult, 0),
+	}
+	if stats == nil {
+		return result
+	}
+	for _, count := range stats.Counts() {
+		result.Errors = append(result.Errors, btcjson.ErrorCountResult{
+			Level: string(count.Level),
+			Code:  count.Code,
+			Count: count.Count,
+		})
+	}
+	return result
+}
+
+// writeErrorStatsMetrics writes the number of rejected blocks and transactions
+// by level and error code to the passed writer in the Prometheus text
+// exposition format.
+func writeErrorStatsMetrics(w io.Writer, stats *blockchain.ErrorStats) error {
+	var buf bytes.Buffer
+	buf.WriteString("# HELP prova_rule_errors_total Number of blocks and " +
+		"transactions rejected by level and error code.\n")
+	buf.WriteString("# TYPE prova_rule_errors_total counter\n")
+	for _, count := range stats.Counts() {
+		fmt.Fprintf(&buf, "prova_rule_errors_total{level=%q,code=%q} %d\n",
+			string(count.Level), count.Code, count.Count)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,564 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/provarpc"
+	"github.com/bitgo/prova/provautil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcAuthMetadataKey is the key of the metadata which carries the bearer
+// token of gRPC calls.
+const grpcAuthMetadataKey = "authorization"
+
+// grpcReplicationCommand is the name the permissions of the StreamReplication
+// method are looked up by.  The method has no RPC command, and since the name
+// is not among the commands available to the limited RPC user, it may only be
+// called by admin clients.
+const grpcReplicationCommand = "replicate"
+
+// grpcMethodCommands maps the methods of the gRPC service to the RPC commands
+// they correspond to.  The permissions of a method are those of its command,
+// so limited clients and read-only mode restrict both APIs the same way.
+var grpcMethodCommands = map[string]string{
+	provarpc.Prova_GetBestBlock_FullMethodName:             "getbestblock",
+	provarpc.Prova_GetBlock_FullMethodName:                 "getblock",
+	provarpc.Prova_SubmitBlock_FullMethodName:              "submitblock",
+	provarpc.Prova_SubmitTransaction_FullMethodName:        "sendrawtransaction",
+	provarpc.Prova_GetMempoolEntry_FullMethodName:          "getmempoolentry",
+	provarpc.Prova_StreamBlockNotifications_FullMethodName: "subscribeblocks",
+	provarpc.Prova_GetAdminState_FullMethodName:            "getadmininfo",
+	provarpc.Prova_StreamReplication_FullMethodName:        grpcReplicationCommand,
+}
+
+// grpcServer provides a gRPC API alongside the RPC server.  Its methods are
+// implemented with the handlers of the corresponding RPC commands, so both
+// APIs always return the same data.
+type grpcServer struct {
+	provarpc.UnimplementedProvaServer
+
+	started      int32
+	shutdown     int32
+	rpc          *rpcServer
+	server       *grpc.Server
+	listeners    []net.Listener
+	authsha      [sha256.Size]byte
+	limitauthsha [sha256.Size]byte
+	wg           sync.WaitGroup
+}
+
+// grpcAuthSHA returns the hash of the authorization metadata which carries the
+// passed bearer token.
+func grpcAuthSHA(token string) [sha256.Size]byte {
+	return sha256.Sum256([]byte("Bearer " + token))
+}
+
+// checkAuth checks the bearer token in the metadata of the passed context of a
+// gRPC call.  It returns whether the client is an admin, or an error with the
+// Unauthenticated code when the token doesn't match either token.
+//
+// This check is time-constant.
+func (s *grpcServer) checkAuth(ctx context.Context) (bool, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md[grpcAuthMetadataKey]) == 0 {
+		return false, status.Error(codes.Unauthenticated,
+			"missing bearer token")
+	}
+	authsha := sha256.Sum256([]byte(md[grpcAuthMetadataKey][0]))
+
+	// Check for limited auth first as in environments with limited users,
+	// those are probably expected to have a higher volume of calls.
+	limitcmp := subtle.ConstantTimeCompare(authsha[:], s.limitauthsha[:])
+	if limitcmp == 1 {
+		return false, nil
+	}
+	cmp := subtle.ConstantTimeCompare(authsha[:], s.authsha[:])
+	if cmp == 1 {
+		return true, nil
+	}
+	return false, status.Error(codes.Unauthenticated, "invalid bearer token")
+}
+
+// authorize ensures the client of the gRPC call with the passed context may
+// call the passed method.  Limited clients may only call the methods whose
+// commands are available to the limited RPC user, and the methods whose
+// commands modify the chain are disabled in read-only mode.
+func (s *grpcServer) authorize(ctx context.Context, method string) error {
+	isAdmin, err := s.checkAuth(ctx)
+	if err != nil {
+		rpcsLog.Warnf("gRPC authentication failure for %s: %v", method,
+			err)
+		return err
+	}
+	cmd, ok := grpcMethodCommands[method]
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "unknown method %s",
+			method)
+	}
+	if !isAdmin {
+		if _, ok := rpcLimited[cmd]; !ok {
+			return status.Errorf(codes.PermissionDenied, "limited "+
+				"user not authorized for method %s", method)
+		}
+	}
+	if s.rpc.server.readOnly {
+		if _, ok := rpcReadOnlyDisabled[cmd]; ok {
+			return status.Error(codes.FailedPrecondition,
+				ErrRPCReadOnly.Message)
+		}
+	}
+	return nil
+}
+
+// unaryInterceptor authorizes unary gRPC calls before they are handled.
+func (s *grpcServer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamInterceptor authorizes streaming gRPC calls before they are handled.
+func (s *grpcServer) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// grpcError converts an error returned by an RPC handler to a gRPC status
+// error with the code matching the RPC error code.  Note that some RPC error
+// codes share a value, such as those of missing blocks and transactions, and
+// those of malformed hex strings and serializations.
+func grpcError(err error) error {
+	rpcErr, ok := err.(*btcjson.RPCError)
+	if !ok {
+		return status.Error(codes.Internal, err.Error())
+	}
+	code := codes.Unknown
+	switch rpcErr.Code {
+	case btcjson.ErrRPCBlockNotFound:
+		code = codes.NotFound
+	case btcjson.ErrRPCDeserialization, btcjson.ErrRPCInvalidParameter:
+		code = codes.InvalidArgument
+	case btcjson.ErrRPCDatabase, btcjson.ErrRPCInternal.Code:
+		code = codes.Internal
+	}
+	return status.Error(code, rpcErr.Message)
+}
+
+// GetBestBlock returns the hash and height of the best block of the main chain.
+// It is part of the provarpc.ProvaServer interface.
+func (s *grpcServer) GetBestBlock(ctx context.Context, req *provarpc.GetBestBlockRequest) (*provarpc.GetBestBlockResponse, error) {
+	result, err := handleGetBestBlock(s.rpc, &btcjson.GetBestBlockCmd{},
+		ctx.Done())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	best := result.(*btcjson.GetBestBlockResult)
+	return &provarpc.GetBestBlockResponse{
+		Hash:   best.Hash,
+		Height: best.Height,
+	}, nil
+}
+
+// GetBlock returns the serialized block with the requested hash, or the block
+// of the main chain at the requested height.  It is part of the
+// provarpc.ProvaServer interface.
+func (s *grpcServer) GetBlock(ctx context.Context, req *provarpc.GetBlockRequest) (*provarpc.GetBlockResponse, error) {
+	var hash string
+	switch block := req.Block.(type) {
+	case *provarpc.GetBlockRequest_Hash:
+		hash = block.Hash
+	case *provarpc.GetBlockRequest_Height:
+		blockHash, err := s.rpc.chain.BlockHashByHeight(block.Height)
+		if err != nil {
+			return nil, status.Error(codes.NotFound,
+				"Block number out of range")
+		}
+		hash = blockHash.String()
+	default:
+		return nil, status.Error(codes.InvalidArgument,
+			"either the hash or the height of the block is required")
+	}
+
+	verbose := false
+	result, err := handleGetBlock(s.rpc, &btcjson.GetBlockCmd{
+		Hash:    hash,
+		Verbose: &verbose,
+	}, ctx.Done())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	blockBytes, err := hex.DecodeString(result.(string))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	block, err := provautil.NewBlockFromBytesEncoding(blockBytes,
+		s.rpc.server.chainParams.TxEncoding())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &provarpc.GetBlockResponse{
+		Hash:   block.Hash().String(),
+		Height: block.MsgBlock().Header.Height,
+		Block:  blockBytes,
+	}, nil
+}
+
+// SubmitBlock submits a serialized block to the node.  It is part of the
+// provarpc.ProvaServer interface.
+func (s *grpcServer) SubmitBlock(ctx context.Context, req *provarpc.SubmitBlockRequest) (*provarpc.SubmitBlockResponse, error) {
+	result, err := handleSubmitBlock(s.rpc, &btcjson.SubmitBlockCmd{
+		HexBlock: hex.EncodeToString(req.Block),
+	}, ctx.Done())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	// The submitblock command returns the reason a block was rejected,
+	// and nothing when it was accepted.
+	if reason, ok := result.(string); ok {
+		return &provarpc.SubmitBlockResponse{
+			RejectReason: strings.TrimPrefix(reason, "rejected: "),
+		}, nil
+	}
+	return &provarpc.SubmitBlockResponse{Accepted: true}, nil
+}
+
+// SubmitTransaction submits a serialized transaction to the memory pool of the
+// node.  It is part of the provarpc.ProvaServer interface.
+func (s *grpcServer) SubmitTransaction(ctx context.Context, req *provarpc.SubmitTransactionRequest) (*provarpc.SubmitTransactionResponse, error) {
+	result, err := handleSendRawTransaction(s.rpc,
+		&btcjson.SendRawTransactionCmd{
+			HexTx: hex.EncodeToString(req.Transaction),
+		}, ctx.Done())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &provarpc.SubmitTransactionResponse{
+		Txid: result.(string),
+	}, nil
+}
+
+// GetMempoolEntry returns the memory pool entry of the requested transaction.
+// It is part of the provarpc.ProvaServer interface.
+func (s *grpcServer) GetMempoolEntry(ctx context.Context, req *provarpc.GetMempoolEntryRequest) (*provarpc.GetMempoolEntryResponse, error) {
+	result, err := handleGetMempoolEntry(s.rpc, &btcjson.GetMempoolEntryCmd{
+		TxID: req.Txid,
+	}, ctx.Done())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	entry := result.(*btcjson.GetMempoolEntryResult)
+	return &provarpc.GetMempoolEntryResponse{
+		Size:             entry.Size,
+		Fee:              entry.Fee,
+		ModifiedFee:      entry.ModifiedFee,
+		Time:             entry.Time,
+		Height:           entry.Height,
+		StartingPriority: entry.StartingPriority,
+		CurrentPriority:  entry.CurrentPriority,
+		DescendantCount:  entry.DescendantCount,
+		DescendantSize:   entry.DescendantSize,
+		DescendantFees:   entry.DescendantFees,
+		AncestorCount:    entry.AncestorCount,
+		AncestorSize:     entry.AncestorSize,
+		AncestorFees:     entry.AncestorFees,
+		Depends:          entry.Depends,
+		ExpiryTime:       entry.ExpiryTime,
+	}, nil
+}
+
+// StreamBlockNotifications streams the blocks of the main chain from the
+// requested start height onward.  Like the subscribeblocks command, the
+// notifications are sent as fast as the client receives them: the events of the
+// block subscription are buffered in a bounded queue, and a notification is
+// only taken from it once the previous one was accepted by the flow control of
+// the stream.  It is part of the provarpc.ProvaServer interface.
+func (s *grpcServer) StreamBlockNotifications(req *provarpc.StreamBlockNotificationsRequest, stream provarpc.Prova_StreamBlockNotificationsServer) error {
+	sub := s.rpc.chain.SubscribeBlocks(req.StartHeight,
+		blockSubscriptionQueueSize)
+	defer sub.Stop()
+
+	ctx := stream.Context()
+	for {
+		var event *blockchain.BlockEvent
+		var ok bool
+		select {
+		case event, ok = <-sub.Events():
+		case <-ctx.Done():
+			return nil
+		}
+		if !ok {
+			if err := sub.Err(); err != nil {
+				rpcsLog.Errorf("Block subscription of gRPC client "+
+					"failed: %v", err)
+				return status.Error(codes.Internal, err.Error())
+			}
+			return nil
+		}
+
+		block := event.Block
+		header := &block.MsgBlock().Header
+		ntfn := &provarpc.BlockNotification{
+			Hash:   block.Hash().String(),
+			Height: header.Height,
+			Time:   header.Timestamp.Unix(),
+		}
+		switch event.Type {
+		case blockchain.NTBlockConnected:
+			blockBytes, err := block.Bytes()
+			if err != nil {
+				rpcsLog.Errorf("Failed to serialize block %v for "+
+					"block subscription: %v", block.Hash(), err)
+				return status.Error(codes.Internal, err.Error())
+			}
+			ntfn.Type = provarpc.BlockNotification_CONNECTED
+			ntfn.Block = blockBytes
+
+		case blockchain.NTBlockDisconnected:
+			ntfn.Type = provarpc.BlockNotification_DISCONNECTED
+
+		default:
+			continue
+		}
+		if err := stream.Send(ntfn); err != nil {
+			return err
+		}
+	}
+}
+
+// StreamReplication streams the changes to the main chain from the requested
+// start height onward for a hot standby node to follow.  The events are taken
+// from a block subscription like those of StreamBlockNotifications and are
+// numbered consecutively.  Connected blocks come with their spend journal
+// entry and admin operations, which are only available while the block is in
+// the main chain, so the stream is aborted when the block is disconnected
+// before they are fetched, and the standby resumes it.  It is part of the
+// provarpc.ProvaServer interface.
+func (s *grpcServer) StreamReplication(req *provarpc.StreamReplicationRequest, stream provarpc.Prova_StreamReplicationServer) error {
+	chain := s.rpc.chain
+	sub := chain.SubscribeBlocks(req.StartHeight, blockSubscriptionQueueSize)
+	defer sub.Stop()
+
+	ctx := stream.Context()
+	var sequence uint64
+	for {
+		var event *blockchain.BlockEvent
+		var ok bool
+		select {
+		case event, ok = <-sub.Events():
+		case <-ctx.Done():
+			return nil
+		}
+		if !ok {
+			if err := sub.Err(); err != nil {
+				rpcsLog.Errorf("Block subscription of replication "+
+					"stream failed: %v", err)
+				return status.Error(codes.Internal, err.Error())
+			}
+			return nil
+		}
+
+		block := event.Block
+		ev := &provarpc.ReplicationEvent{
+			Hash:   block.Hash().String(),
+			Height: block.MsgBlock().Header.Height,
+		}
+		switch event.Type {
+		case blockchain.NTBlockConnected:
+			blockBytes, err := block.Bytes()
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			journal, err := chain.FetchSpendJournal(block.Hash())
+			if err != nil {
+				return status.Errorf(codes.Aborted, "unable to "+
+					"fetch the spend journal entry of block "+
+					"%v: %v", block.Hash(), err)
+			}
+			records, err := chain.AdminOpsInBlock(block.Hash())
+			if err != nil {
+				return status.Errorf(codes.Aborted, "unable to "+
+					"fetch the admin operations of block %v: %v",
+					block.Hash(), err)
+			}
+			ev.Type = provarpc.ReplicationEvent_CONNECTED
+			ev.Block = blockBytes
+			ev.SpendJournal = journal
+			ev.AdminOps = replicationAdminOps(records)
+
+		case blockchain.NTBlockDisconnected:
+			ev.Type = provarpc.ReplicationEvent_DISCONNECTED
+
+		default:
+			continue
+		}
+		sequence++
+		ev.Sequence = sequence
+		if err := stream.Send(ev); err != nil {
+			return err
+		}
+	}
+}
+
+// GetAdminState returns the admin state of the best block of the main chain.
+// It is part of the provarpc.ProvaServer interface.
+func (s *grpcServer) GetAdminState(ctx context.Context, req *provarpc.GetAdminStateRequest) (*provarpc.GetAdminStateResponse, error) {
+	result, err := handleGetAdminInfo(s.rpc, &btcjson.GetAdminInfoCmd{},
+		ctx.Done())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	info := result.(*btcjson.GetAdminInfoResult)
+	resp := &provarpc.GetAdminStateResponse{
+		Hash:          info.Hash,
+		Height:        info.Height,
+		ThreadTips:    make([]*provarpc.ThreadTip, 0, len(info.ThreadTips)),
+		TotalSupply:   info.TotalSupply,
+		LastKeyId:     info.LastKeyID,
+		RootKeys:      info.RootKeys,
+		ProvisionKeys: info.ProvisionKeys,
+		IssueKeys:     info.IssueKeys,
+		ValidateKeys:  info.ValidateKeys,
+		AspKeys:       make([]*provarpc.ASPKey, 0, len(info.ASPKeys)),
+	}
+	for _, tip := range info.ThreadTips {
+		resp.ThreadTips = append(resp.ThreadTips, &provarpc.ThreadTip{
+			Id:       tip.ID,
+			Name:     tip.Name,
+			Outpoint: tip.OutPoint,
+		})
+	}
+	for _, key := range info.ASPKeys {
+		resp.AspKeys = append(resp.AspKeys, &provarpc.ASPKey{
+			KeyId:  key.KeyID,
+			PubKey: key.PubKey,
+		})
+	}
+	return resp, nil
+}
+
+// newServer returns a gRPC server with the passed options which authorizes the
+// calls it receives and serves the Prova service.
+func (s *grpcServer) newServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.UnaryInterceptor(s.unaryInterceptor),
+		grpc.StreamInterceptor(s.streamInterceptor))
+	server := grpc.NewServer(opts...)
+	provarpc.RegisterProvaServer(server, s)
+	return server
+}
+
+// Start is used by server.go to start the gRPC listeners.
+func (s *grpcServer) Start() {
+	if atomic.AddInt32(&s.started, 1) != 1 {
+		return
+	}
+
+	rpcsLog.Trace("Starting gRPC server")
+	for _, listener := range s.listeners {
+		s.wg.Add(1)
+		go func(listener net.Listener) {
+			rpcsLog.Infof("gRPC server listening on %s",
+				listener.Addr())
+			s.server.Serve(listener)
+			rpcsLog.Tracef("gRPC listener done for %s",
+				listener.Addr())
+			s.wg.Done()
+		}(listener)
+	}
+}
+
+// Stop is used by server.go to stop the gRPC listeners.  Any streams which are
+// still open are closed.
+func (s *grpcServer) Stop() {
+	if atomic.AddInt32(&s.shutdown, 1) != 1 {
+		rpcsLog.Infof("gRPC server is already in the process of " +
+			"shutting down")
+		return
+	}
+	rpcsLog.Warnf("gRPC server shutting down")
+	s.server.Stop()
+	s.wg.Wait()
+	rpcsLog.Infof("gRPC server shutdown complete")
+}
+
+// newGRPCServer returns a gRPC server which listens on the passed addresses
+// and serves its calls with the handlers of the passed RPC server.  It uses
+// the TLS certificate of the RPC server unless TLS is disabled.
+func newGRPCServer(listenAddrs []string, rpc *rpcServer) (*grpcServer, error) {
+	s := grpcServer{
+		rpc: rpc,
+	}
+	if cfg.GRPCToken != "" {
+		s.authsha = grpcAuthSHA(cfg.GRPCToken)
+	}
+	if cfg.GRPCLimitToken != "" {
+		s.limitauthsha = grpcAuthSHA(cfg.GRPCLimitToken)
+	}
+
+	// Setup TLS if not disabled.  The certificate was generated by the
+	// RPC server if it didn't exist.
+	var opts []grpc.ServerOption
+	if !cfg.DisableTLS {
+		keypair, err := tls.LoadX509KeyPair(cfg.RPCCert, cfg.RPCKey)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{keypair},
+			MinVersion:   tls.VersionTLS12,
+		})))
+	}
+
+	ipv4ListenAddrs, ipv6ListenAddrs, _, err := parseListeners(listenAddrs)
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]net.Listener, 0,
+		len(ipv6ListenAddrs)+len(ipv4ListenAddrs))
+	for _, addr := range ipv4ListenAddrs {
+		listener, err := net.Listen("tcp4", addr)
+		if err != nil {
+			rpcsLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	for _, addr := range ipv6ListenAddrs {
+		listener, err := net.Listen("tcp6", addr)
+		if err != nil {
+			rpcsLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		return nil, errors.New("gRPC: No valid listen address")
+	}
+
+	s.listeners = listeners
+	s.server = s.newServer(opts...)
+	return &s, nil
+}
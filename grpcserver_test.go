@@ -0,0 +1,252 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provarpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TestGRPCServer ensures the methods of the gRPC server return the same data as
+// the corresponding RPC commands, that block notifications are streamed, and
+// that calls are authorized like the commands they correspond to.
+func TestGRPCServer(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+
+	var hashes []*chainhash.Hash
+	for i := 0; i < 3; i++ {
+		hashes = append(hashes, h.mineBlock(t))
+	}
+
+	gs := &grpcServer{
+		rpc:          h.rpcServer,
+		authsha:      grpcAuthSHA("admin"),
+		limitauthsha: grpcAuthSHA("limited"),
+	}
+	server := gs.newServer()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("unable to dial gRPC server: %v", err)
+	}
+	defer conn.Close()
+	client := provarpc.NewProvaClient(conn)
+	authCtx := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(),
+			grpcAuthMetadataKey, "Bearer "+token)
+	}
+	adminCtx := authCtx("admin")
+	limitCtx := authCtx("limited")
+
+	// checkCode ensures the passed error has the passed gRPC status code.
+	checkCode := func(method string, err error, want codes.Code) {
+		if got := status.Code(err); got != want {
+			t.Fatalf("%s: got code %v (err %v), want %v", method, got,
+				err, want)
+		}
+	}
+
+	// The best block matches the getbestblock command.
+	best, err := client.GetBestBlock(limitCtx, &provarpc.GetBestBlockRequest{})
+	if err != nil {
+		t.Fatalf("GetBestBlock: unexpected error: %v", err)
+	}
+	result, _ := handleGetBestBlock(h.rpcServer, &btcjson.GetBestBlockCmd{},
+		nil)
+	wantBest := result.(*btcjson.GetBestBlockResult)
+	if best.Hash != wantBest.Hash || best.Height != wantBest.Height {
+		t.Fatalf("GetBestBlock: got %v (height %d), want %v (height %d)",
+			best.Hash, best.Height, wantBest.Hash, wantBest.Height)
+	}
+
+	// Blocks are returned by hash and by height and match the serialized
+	// blocks returned by the getblock command.
+	verbose := false
+	for i, hash := range hashes {
+		result, err := handleGetBlock(h.rpcServer,
+			btcjson.NewGetBlockCmd(hash.String(), &verbose, nil), nil)
+		if err != nil {
+			t.Fatalf("getblock %v: unexpected error: %v", hash, err)
+		}
+		want, _ := hex.DecodeString(result.(string))
+		for _, req := range []*provarpc.GetBlockRequest{
+			{Block: &provarpc.GetBlockRequest_Hash{Hash: hash.String()}},
+			{Block: &provarpc.GetBlockRequest_Height{Height: uint32(i + 1)}},
+		} {
+			block, err := client.GetBlock(limitCtx, req)
+			if err != nil {
+				t.Fatalf("GetBlock %v: unexpected error: %v", req,
+					err)
+			}
+			if block.Hash != hash.String() ||
+				block.Height != uint32(i+1) ||
+				!bytes.Equal(block.Block, want) {
+
+				t.Fatalf("GetBlock %v: got block %v (height %d), "+
+					"want %v (height %d)", req, block.Hash,
+					block.Height, hash, i+1)
+			}
+		}
+	}
+	_, err = client.GetBlock(limitCtx, &provarpc.GetBlockRequest{
+		Block: &provarpc.GetBlockRequest_Height{Height: 4},
+	})
+	checkCode("GetBlock", err, codes.NotFound)
+	_, err = client.GetBlock(limitCtx, &provarpc.GetBlockRequest{
+		Block: &provarpc.GetBlockRequest_Hash{
+			Hash: chainhash.Hash{}.String(),
+		},
+	})
+	checkCode("GetBlock", err, codes.NotFound)
+	_, err = client.GetBlock(limitCtx, &provarpc.GetBlockRequest{})
+	checkCode("GetBlock", err, codes.InvalidArgument)
+
+	// The admin state matches the getadmininfo command.
+	state, err := client.GetAdminState(limitCtx,
+		&provarpc.GetAdminStateRequest{})
+	if err != nil {
+		t.Fatalf("GetAdminState: unexpected error: %v", err)
+	}
+	result, _ = handleGetAdminInfo(h.rpcServer, &btcjson.GetAdminInfoCmd{},
+		nil)
+	info := result.(*btcjson.GetAdminInfoResult)
+	var tips []btcjson.ThreadTipResult
+	for _, tip := range state.ThreadTips {
+		tips = append(tips, btcjson.ThreadTipResult{
+			ID:       tip.Id,
+			Name:     tip.Name,
+			OutPoint: tip.Outpoint,
+		})
+	}
+	var aspKeys []btcjson.ASPKeyIdResult
+	for _, key := range state.AspKeys {
+		aspKeys = append(aspKeys, btcjson.ASPKeyIdResult{
+			KeyID:  key.KeyId,
+			PubKey: key.PubKey,
+		})
+	}
+	got := fmt.Sprint(state.Hash, state.Height, tips, state.TotalSupply,
+		state.LastKeyId, state.RootKeys, state.ProvisionKeys,
+		state.IssueKeys, state.ValidateKeys, aspKeys)
+	want := fmt.Sprint(info.Hash, info.Height, info.ThreadTips,
+		info.TotalSupply, info.LastKeyID, info.RootKeys,
+		info.ProvisionKeys, info.IssueKeys, info.ValidateKeys,
+		info.ASPKeys)
+	if got != want || len(info.ValidateKeys) == 0 {
+		t.Fatalf("GetAdminState: got %v, want %v", got, want)
+	}
+
+	// The blocks of the main chain are streamed from the start height,
+	// followed by the blocks connected later.
+	ctx, cancel := context.WithCancel(adminCtx)
+	defer cancel()
+	stream, err := client.StreamBlockNotifications(ctx,
+		&provarpc.StreamBlockNotificationsRequest{StartHeight: 2})
+	if err != nil {
+		t.Fatalf("StreamBlockNotifications: unexpected error: %v", err)
+	}
+	checkNtfn := func(hash *chainhash.Hash, height uint32) {
+		ntfn, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv: unexpected error: %v", err)
+		}
+		block, err := h.chain.BlockByHash(hash)
+		if err != nil {
+			t.Fatalf("BlockByHash: unexpected error: %v", err)
+		}
+		blockBytes, _ := block.Bytes()
+		if ntfn.Type != provarpc.BlockNotification_CONNECTED ||
+			ntfn.Hash != hash.String() || ntfn.Height != height ||
+			ntfn.Time != block.MsgBlock().Header.Timestamp.Unix() ||
+			!bytes.Equal(ntfn.Block, blockBytes) {
+
+			t.Fatalf("Recv: got %v notification of %v (height %d), "+
+				"want connected %v (height %d)", ntfn.Type,
+				ntfn.Hash, ntfn.Height, hash, height)
+		}
+	}
+	checkNtfn(hashes[1], 2)
+	checkNtfn(hashes[2], 3)
+	checkNtfn(h.mineBlock(t), 4)
+	cancel()
+
+	// Calls without a valid token are refused, and limited clients may
+	// only call the methods whose commands limited users may call.
+	_, err = client.GetBestBlock(context.Background(),
+		&provarpc.GetBestBlockRequest{})
+	checkCode("GetBestBlock", err, codes.Unauthenticated)
+	_, err = client.GetBestBlock(authCtx("invalid"),
+		&provarpc.GetBestBlockRequest{})
+	checkCode("GetBestBlock", err, codes.Unauthenticated)
+	limitStream, err := client.StreamBlockNotifications(limitCtx,
+		&provarpc.StreamBlockNotificationsRequest{})
+	if err == nil {
+		_, err = limitStream.Recv()
+	}
+	checkCode("StreamBlockNotifications", err, codes.PermissionDenied)
+
+	// Methods which modify the chain are disabled in read-only mode.
+	h.rpcServer.server.readOnly = true
+	_, err = client.SubmitBlock(adminCtx, &provarpc.SubmitBlockRequest{})
+	checkCode("SubmitBlock", err, codes.FailedPrecondition)
+	_, err = client.SubmitTransaction(limitCtx,
+		&provarpc.SubmitTransactionRequest{})
+	checkCode("SubmitTransaction", err, codes.FailedPrecondition)
+	if _, err := client.GetBestBlock(adminCtx,
+		&provarpc.GetBestBlockRequest{}); err != nil {
+
+		t.Fatalf("GetBestBlock: unexpected error: %v", err)
+	}
+	h.rpcServer.server.readOnly = false
+
+	// Malformed blocks are refused like by the submitblock command.
+	_, err = client.SubmitBlock(adminCtx, &provarpc.SubmitBlockRequest{
+		Block: []byte{0x01},
+	})
+	checkCode("SubmitBlock", err, codes.InvalidArgument)
+
+	// Stopping the server ends the streams.
+	stream, err = client.StreamBlockNotifications(adminCtx,
+		&provarpc.StreamBlockNotificationsRequest{StartHeight: 10})
+	if err != nil {
+		t.Fatalf("StreamBlockNotifications: unexpected error: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := stream.Recv()
+		done <- err
+	}()
+	server.Stop()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("Recv: unexpected notification after stop")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("timed out waiting for the stream to end")
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// This file is ignored during the regular tests due to the following build tag.
+// +build rpctest
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provarpc"
+	"github.com/bitgo/prova/rpctest"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// rawRequest issues the passed JSON-RPC command to the node of the passed
+// harness and unmarshals its result into the passed value.
+func rawRequest(t *testing.T, r *rpctest.Harness, result interface{}, method string, params ...interface{}) {
+	rawParams := make([]json.RawMessage, 0, len(params))
+	for _, param := range params {
+		rawParam, err := json.Marshal(param)
+		if err != nil {
+			t.Fatalf("unable to marshal %s parameter: %v", method, err)
+		}
+		rawParams = append(rawParams, rawParam)
+	}
+	rawResult, err := r.Node.RawRequest(method, rawParams)
+	if err != nil {
+		t.Fatalf("Call to `%s` failed: %v", method, err)
+	}
+	if err := json.Unmarshal(rawResult, result); err != nil {
+		t.Fatalf("unable to unmarshal %s result: %v", method, err)
+	}
+}
+
+// TestGRPCServer ensures the gRPC API of a node returns the same data as its
+// JSON-RPC API, and that it mirrors the permissions of the JSON-RPC commands.
+func TestGRPCServer(t *testing.T) {
+	// Find a free port for the gRPC server of the node.
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to find a free port: %v", err)
+	}
+	grpcAddr := listener.Addr().String()
+	listener.Close()
+
+	r, err := rpctest.New(&chaincfg.SimNetParams, nil, []string{
+		"--grpclisten=" + grpcAddr,
+		"--grpctoken=admin",
+		"--grpclimittoken=limited",
+	})
+	if err != nil {
+		t.Fatalf("unable to create harness: %v", err)
+	}
+	if err := r.SetUp(true, 25); err != nil {
+		r.TearDown()
+		t.Fatalf("unable to setup test chain: %v", err)
+	}
+	defer r.TearDown()
+
+	// Connect to the gRPC server with the certificate of the RPC server.
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(r.RPCConfig().Certificates) {
+		t.Fatalf("unable to load the RPC certificate")
+	}
+	creds := credentials.NewClientTLSFromCert(certPool, "")
+	conn, err := grpc.Dial(grpcAddr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatalf("unable to dial gRPC server: %v", err)
+	}
+	defer conn.Close()
+	client := provarpc.NewProvaClient(conn)
+	adminCtx := metadata.AppendToOutgoingContext(context.Background(),
+		"authorization", "Bearer admin")
+	limitCtx := metadata.AppendToOutgoingContext(context.Background(),
+		"authorization", "Bearer limited")
+
+	// The best block and the blocks of the main chain match.
+	best, err := client.GetBestBlock(limitCtx, &provarpc.GetBestBlockRequest{})
+	if err != nil {
+		t.Fatalf("GetBestBlock: unexpected error: %v", err)
+	}
+	var bestResult struct {
+		Hash   string `json:"hash"`
+		Height uint32 `json:"height"`
+	}
+	rawRequest(t, r, &bestResult, "getbestblock")
+	if best.Hash != bestResult.Hash || best.Height != bestResult.Height {
+		t.Fatalf("GetBestBlock: got %v (height %d), want %v (height %d)",
+			best.Hash, best.Height, bestResult.Hash, bestResult.Height)
+	}
+	block, err := client.GetBlock(limitCtx, &provarpc.GetBlockRequest{
+		Block: &provarpc.GetBlockRequest_Height{Height: best.Height},
+	})
+	if err != nil {
+		t.Fatalf("GetBlock: unexpected error: %v", err)
+	}
+	var blockHex string
+	rawRequest(t, r, &blockHex, "getblock", best.Hash, false)
+	if block.Hash != best.Hash || hex.EncodeToString(block.Block) != blockHex {
+		t.Fatalf("GetBlock: got block %v, want %v", block.Hash, best.Hash)
+	}
+
+	// Resubmitting a known block succeeds.
+	submitted, err := client.SubmitBlock(adminCtx,
+		&provarpc.SubmitBlockRequest{Block: block.Block})
+	if err != nil || !submitted.Accepted {
+		t.Fatalf("SubmitBlock: got %v, err %v", submitted, err)
+	}
+
+	// A transaction submitted with the gRPC API is in the memory pool
+	// with the same entry as the one returned by the JSON-RPC API.
+	addr, err := r.NewAddress()
+	if err != nil {
+		t.Fatalf("unable to generate address: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("unable to create pkScript: %v", err)
+	}
+	tx, err := r.CreateTransaction([]*wire.TxOut{
+		wire.NewTxOut(5e8, pkScript),
+	}, 10)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	var txBuf bytes.Buffer
+	if err := tx.Serialize(&txBuf); err != nil {
+		t.Fatalf("unable to serialize transaction: %v", err)
+	}
+	sent, err := client.SubmitTransaction(limitCtx,
+		&provarpc.SubmitTransactionRequest{Transaction: txBuf.Bytes()})
+	if err != nil {
+		t.Fatalf("SubmitTransaction: unexpected error: %v", err)
+	}
+	if sent.Txid != tx.TxHash().String() {
+		t.Fatalf("SubmitTransaction: got txid %v, want %v", sent.Txid,
+			tx.TxHash())
+	}
+	entry, err := client.GetMempoolEntry(limitCtx,
+		&provarpc.GetMempoolEntryRequest{Txid: sent.Txid})
+	if err != nil {
+		t.Fatalf("GetMempoolEntry: unexpected error: %v", err)
+	}
+	var entryResult struct {
+		Size   int32   `json:"size"`
+		Fee    float64 `json:"fee"`
+		Time   int64   `json:"time"`
+		Height int64   `json:"height"`
+	}
+	rawRequest(t, r, &entryResult, "getmempoolentry", sent.Txid)
+	if entry.Size != entryResult.Size || entry.Fee != entryResult.Fee ||
+		entry.Time != entryResult.Time ||
+		entry.Height != entryResult.Height {
+
+		t.Fatalf("GetMempoolEntry: got %v, want %+v", entry, entryResult)
+	}
+
+	// The admin state matches.
+	state, err := client.GetAdminState(limitCtx,
+		&provarpc.GetAdminStateRequest{})
+	if err != nil {
+		t.Fatalf("GetAdminState: unexpected error: %v", err)
+	}
+	var adminResult struct {
+		Hash         string   `json:"hash"`
+		TotalSupply  uint64   `json:"totalsupply"`
+		LastKeyID    uint32   `json:"lastkeyid"`
+		ValidateKeys []string `json:"validatekeys"`
+	}
+	rawRequest(t, r, &adminResult, "getadmininfo")
+	if state.Hash != adminResult.Hash ||
+		state.TotalSupply != adminResult.TotalSupply ||
+		state.LastKeyId != adminResult.LastKeyID ||
+		len(state.ValidateKeys) != len(adminResult.ValidateKeys) {
+
+		t.Fatalf("GetAdminState: got %v, want %+v", state, adminResult)
+	}
+
+	// Blocks generated through the JSON-RPC API are streamed, starting
+	// with the block which confirms the submitted transaction.
+	ctx, cancel := context.WithTimeout(adminCtx, time.Minute)
+	defer cancel()
+	stream, err := client.StreamBlockNotifications(ctx,
+		&provarpc.StreamBlockNotificationsRequest{
+			StartHeight: best.Height + 1,
+		})
+	if err != nil {
+		t.Fatalf("StreamBlockNotifications: unexpected error: %v", err)
+	}
+	hashes, err := r.Node.Generate(2)
+	if err != nil {
+		t.Fatalf("Unable to generate blocks: %v", err)
+	}
+	for i, hash := range hashes {
+		ntfn, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv: unexpected error: %v", err)
+		}
+		if ntfn.Type != provarpc.BlockNotification_CONNECTED ||
+			ntfn.Hash != hash.String() ||
+			ntfn.Height != best.Height+uint32(i)+1 {
+
+			t.Fatalf("Recv: got %v notification of %v (height %d), "+
+				"want connected %v", ntfn.Type, ntfn.Hash,
+				ntfn.Height, hash)
+		}
+	}
+
+	// Limited clients can't stream notifications, just like limited
+	// users can't subscribe to blocks.
+	limitStream, err := client.StreamBlockNotifications(limitCtx,
+		&provarpc.StreamBlockNotificationsRequest{})
+	if err == nil {
+		_, err = limitStream.Recv()
+	}
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("StreamBlockNotifications: got err %v, want %v", err,
+			codes.PermissionDenied)
+	}
+}
@@ -37,9 +37,11 @@ var (
 	btcdLog    = btclog.Disabled
 	chanLog    = btclog.Disabled
 	discLog    = btclog.Disabled
+	hookLog    = btclog.Disabled
 	indxLog    = btclog.Disabled
 	minrLog    = btclog.Disabled
 	peerLog    = btclog.Disabled
+	replLog    = btclog.Disabled
 	rpcsLog    = btclog.Disabled
 	scrpLog    = btclog.Disabled
 	srvrLog    = btclog.Disabled
@@ -55,10 +57,12 @@ var subsystemLoggers = map[string]btclog.Logger{
 	"BMGR": bmgrLog,
 	"CHAN": chanLog,
 	"DISC": discLog,
+	"HOOK": hookLog,
 	"INDX": indxLog,
 	"MINR": minrLog,
 	"PEER": peerLog,
 	"PRVA": btcdLog,
+	"REPL": replLog,
 	"RPCS": rpcsLog,
 	"SCRP": scrpLog,
 	"SRVR": srvrLog,
@@ -99,6 +103,9 @@ func useLogger(subsystemID string, logger btclog.Logger) {
 	case "DISC":
 		discLog = logger
 
+	case "HOOK":
+		hookLog = logger
+
 	case "INDX":
 		indxLog = logger
 		indexers.UseLogger(logger)
@@ -115,6 +122,9 @@ func useLogger(subsystemID string, logger btclog.Logger) {
 	case "PRVA":
 		btcdLog = logger
 
+	case "REPL":
+		replLog = logger
+
 	case "RPCS":
 		rpcsLog = logger
 
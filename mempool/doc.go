@@ -47,6 +47,8 @@ be an exhaustive list.
    - Configurable limits (see transaction acceptance policy)
    - Automatic addition of orphan transactions that are no longer orphans as new
      transactions are added to the pool
+   - Package acceptance of low-fee transactions along with orphans which spend
+     them and pay enough fee for both, in either order of arrival
    - Individual orphan transaction query support
  - Configurable transaction acceptance policy
    - Option to accept or reject standard transactions
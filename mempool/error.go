@@ -59,6 +59,23 @@ func chainRuleError(chainErr blockchain.RuleError) RuleError {
 	}
 }
 
+// ruleErrorCode returns the name of the error code of the passed error when it
+// is a RuleError, which is the name of the blockchain.ErrorCode for rule errors
+// of the chain and the name of the reject code for transaction rule errors.
+func ruleErrorCode(err error) (string, bool) {
+	rerr, ok := err.(RuleError)
+	if !ok {
+		return "", false
+	}
+	switch err := rerr.Err.(type) {
+	case blockchain.RuleError:
+		return err.ErrorCode.String(), true
+	case TxRuleError:
+		return err.RejectCode.String(), true
+	}
+	return "", false
+}
+
 // extractRejectCode attempts to return a relevant reject code for a given error
 // by examining the error for known types.  It will return true if a code
 // was successfully extracted.
@@ -71,34 +88,7 @@ func extractRejectCode(err error) (wire.RejectCode, bool) {
 	switch err := err.(type) {
 	case blockchain.RuleError:
 		// Convert the chain error to a reject code.
-		var code wire.RejectCode
-		switch err.ErrorCode {
-		// Rejected due to duplicate.
-		case blockchain.ErrDuplicateBlock:
-			fallthrough
-		case blockchain.ErrDoubleSpend:
-			code = wire.RejectDuplicate
-
-		// Rejected due to obsolete version.
-		case blockchain.ErrBlockVersionTooOld:
-			code = wire.RejectObsolete
-
-		// Rejected due to checkpoint.
-		case blockchain.ErrCheckpointTimeTooOld:
-			fallthrough
-		case blockchain.ErrDifficultyTooLow:
-			fallthrough
-		case blockchain.ErrBadCheckpoint:
-			fallthrough
-		case blockchain.ErrForkTooOld:
-			code = wire.RejectCheckpoint
-
-		// Everything else is due to the block or transaction being invalid.
-		default:
-			code = wire.RejectInvalid
-		}
-
-		return code, true
+		return err.ErrorCode.RejectCode(), true
 
 	case TxRuleError:
 		return err.RejectCode, true
@@ -6,9 +6,11 @@
 package mempool
 
 import (
+	"bytes"
 	"container/list"
 	"fmt"
 	"math"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -21,6 +23,7 @@ import (
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/mining"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/txsort"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
 )
@@ -38,8 +41,21 @@ const (
 	orphanTTL = time.Minute * 15
 
 	// orphanExpireScanInterval is the minimum amount of time in between
-	// scans of the orphan pool to evict expired transactions.
+	// scans of the orphan pool and the main pool to evict expired
+	// transactions.
 	orphanExpireScanInterval = time.Minute * 5
+
+	// packageParentTTL is the maximum amount of time a transaction rejected
+	// for paying too little fee is held, awaiting an orphan which spends it
+	// and pays enough fee for both, before it expires.
+	packageParentTTL = time.Minute * 2
+
+	// txExpiryMargin is the number of blocks before their expiry height
+	// transactions are no longer accepted to the main pool, and are evicted
+	// from it.  Such transactions are unlikely to be mined before they
+	// expire, and a reorganization to a longer chain could expire them
+	// before they are mined.
+	txExpiryMargin = 2
 )
 
 // Tag represents an identifier to use for tagging orphan transactions.  The
@@ -96,6 +112,11 @@ type Config struct {
 	// HashCache defines the transaction hash mid-state cache to use.
 	HashCache *txscript.HashCache
 
+	// SigVerifyWorkers defines the number of goroutines used to validate
+	// the scripts of the inputs of a transaction.  Zero selects a number
+	// based on the number of processor cores.
+	SigVerifyWorkers int
+
 	// TimeSource defines the timesource to use.
 	TimeSource blockchain.MedianTimeSource
 
@@ -103,6 +124,18 @@ type Config struct {
 	// indexing the unconfirmed transactions in the memory pool.
 	// This can be nil if the address index is not enabled.
 	AddrIndex *indexers.AddrIndex
+
+	// TxExpired defines the function to call with the transactions which
+	// were evicted from the main pool because they, or a transaction they
+	// depend on, expired.  Transactions are passed before the transactions
+	// which depend on them so they can be rebroadcast in order.  It is
+	// called with the mempool lock held, so it must not call back into
+	// the pool.  This can be nil.
+	TxExpired func(txns []*provautil.Tx)
+
+	// ErrorStats defines the error stats which count the transactions
+	// rejected by the pool by error code.  This can be nil.
+	ErrorStats *blockchain.ErrorStats
 }
 
 // Policy houses the policy (configuration parameters) which is used to
@@ -143,6 +176,20 @@ type Policy struct {
 	// MinRelayTxFee defines the minimum transaction fee in RMG/kB to be
 	// considered a non-zero fee.
 	MinRelayTxFee provautil.Amount
+
+	// TxExpiry is the maximum amount of time a transaction is allowed to
+	// stay in the main pool before it expires and is evicted, along with
+	// the transactions which depend on it, during the next scan.  Admin
+	// transactions and transactions prioritised with PrioritiseTransaction
+	// never expire.  Zero disables expiry.
+	TxExpiry time.Duration
+
+	// RequireCanonicalOrder defines whether to reject transactions whose
+	// inputs and outputs are not in the canonical order described by
+	// BIP 69.  Admin transactions are exempt since the order of their
+	// inputs and outputs is meaningful.  This is a relay policy only and
+	// has no effect on the validity of blocks.
+	RequireCanonicalOrder bool
 }
 
 // TxDesc is a descriptor containing a transaction in the mempool along with
@@ -153,6 +200,60 @@ type TxDesc struct {
 	// StartingPriority is the priority of the transaction when it was added
 	// to the pool.
 	StartingPriority float64
+
+	// FeeDelta is the amount the fee of the transaction is adjusted by
+	// with PrioritiseTransaction.  The fee per kilobyte used to select
+	// the transaction for block templates includes the adjustment.
+	FeeDelta int64
+
+	// keyIDs are the ASP key IDs the outputs of the transaction, and the
+	// outputs it spends, pay to.
+	keyIDs []btcec.KeyID
+
+	// paidByOrphans indicates the transaction paid too little fee on its
+	// own and was accepted because orphans spending it pay enough fee for
+	// the package of the transaction and the orphans.
+	paidByOrphans bool
+}
+
+// RemovalReason identifies why transactions which were valid when they were
+// accepted were removed from the main pool without being mined, or why
+// transactions of disconnected blocks could not be returned to it.
+type RemovalReason int
+
+// Constants for the reasons transactions are removed from the main pool.
+const (
+	// RemovalKeyRevoked indicates the transactions, or transactions they
+	// depend on, became invalid because a block revoked an ASP key their
+	// outputs or the outputs they spend pay to, or an admin key of the
+	// key set which signs them.
+	RemovalKeyRevoked RemovalReason = iota
+
+	// RemovalReorg indicates the transactions, or transactions they
+	// depend on, were mined in blocks disconnected from the main chain by
+	// a reorganization and are not valid on the new main chain.
+	RemovalReorg
+
+	// RemovalExpiryHeight indicates the transactions, or transactions they
+	// depend on, expire within a few blocks of the main chain tip and are
+	// unlikely to be mined before they expire.
+	RemovalExpiryHeight
+)
+
+// removalReasonStrings is a map of removal reasons back to their names as
+// used in notifications.
+var removalReasonStrings = map[RemovalReason]string{
+	RemovalKeyRevoked:   "keyrevoked",
+	RemovalReorg:        "reorg",
+	RemovalExpiryHeight: "expiryheight",
+}
+
+// String returns the RemovalReason in human-readable form.
+func (r RemovalReason) String() string {
+	if s, ok := removalReasonStrings[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown RemovalReason (%d)", int(r))
 }
 
 // orphanTx is normal transaction that references an ancestor transaction
@@ -171,6 +272,11 @@ type TxPool struct {
 	// The following variables must only be used atomically.
 	lastUpdated int64 // last time pool was updated
 
+	// sequence is incremented each time a transaction is added to,
+	// removed from or prioritised in the main pool.  It is protected by
+	// the mempool lock.
+	sequence uint64
+
 	mtx           sync.RWMutex
 	cfg           Config
 	pool          map[chainhash.Hash]*TxDesc
@@ -180,11 +286,32 @@ type TxPool struct {
 	pennyTotal    float64 // exponentially decaying total for penny spends.
 	lastPennyUnix int64   // unix time of last ``penny spend''
 
-	// nextExpireScan is the time after which the orphan pool will be
-	// scanned in order to evict orphans.  This is NOT a hard deadline as
-	// the scan will only run when an orphan is added to the pool as opposed
-	// to on an unconditional timer.
+	// packageParents holds the transactions recently rejected for paying
+	// too little fee so an orphan spending one of them which arrives
+	// shortly after can still pay for it.  They are held along with the
+	// tag of the peer which relayed them and expire after packageParentTTL.
+	packageParents map[chainhash.Hash]*orphanTx
+
+	// feeDeltas holds the fee adjustments of the transactions prioritised
+	// with PrioritiseTransaction, including those not in the pool yet.
+	feeDeltas map[chainhash.Hash]int64
+
+	// keyIDIndex indexes the transactions in the main pool by the ASP key
+	// IDs their outputs, and the outputs they spend, pay to, while
+	// keySetIndex indexes the admin transactions in the main pool by the
+	// admin key set which signs them.  They are used to find the
+	// transactions to re-validate when a block revokes keys.
+	keyIDIndex  map[btcec.KeyID]map[chainhash.Hash]*provautil.Tx
+	keySetIndex map[btcec.KeySetType]map[chainhash.Hash]*provautil.Tx
+
+	// nextExpireScan is the time after which the orphan pool and the main
+	// pool will be scanned in order to evict expired transactions.  This
+	// is NOT a hard deadline as the scan will only run when a transaction
+	// is processed as opposed to on an unconditional timer.
 	nextExpireScan time.Time
+
+	// now returns the current time.  It is only replaced by tests.
+	now func() time.Time
 }
 
 // Ensure the TxPool type implements the mining.TxSource interface.
@@ -258,37 +385,212 @@ func (mp *TxPool) RemoveOrphansByTag(tag Tag) uint64 {
 	return numEvicted
 }
 
-// limitNumOrphans limits the number of orphan transactions by evicting a random
-// orphan if adding a new one would cause it to overflow the max allowed.
+// isExpiryExempt returns whether or not the passed transaction never expires
+// from the main pool, which is the case for admin transactions and
+// transactions prioritised with PrioritiseTransaction.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) isExpiryExempt(tx *provautil.Tx) bool {
+	if _, prioritised := mp.feeDeltas[*tx.Hash()]; prioritised {
+		return true
+	}
+	return mining.IsAdminTx(tx.MsgTx())
+}
+
+// expiryTime returns the time the passed transaction expires from the main
+// pool, or the zero time when it never expires.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) expiryTime(txD *TxDesc) time.Time {
+	if mp.cfg.Policy.TxExpiry <= 0 || mp.isExpiryExempt(txD.Tx) {
+		return time.Time{}
+	}
+	return txD.Added.Add(mp.cfg.Policy.TxExpiry)
+}
+
+// descendants returns the passed transaction followed by all transactions in
+// the main pool which depend on it, directly or indirectly.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) descendants(tx *provautil.Tx) []*provautil.Tx {
+	txns := []*provautil.Tx{tx}
+	seen := map[chainhash.Hash]struct{}{*tx.Hash(): {}}
+	for i := 0; i < len(txns); i++ {
+		prevOut := wire.OutPoint{Hash: *txns[i].Hash()}
+		for txOutIdx := range txns[i].MsgTx().TxOut {
+			prevOut.Index = uint32(txOutIdx)
+			redeemer, exists := mp.outpoints[prevOut]
+			if !exists {
+				continue
+			}
+			if _, ok := seen[*redeemer.Hash()]; ok {
+				continue
+			}
+			seen[*redeemer.Hash()] = struct{}{}
+			txns = append(txns, redeemer)
+		}
+	}
+	return txns
+}
+
+// txDescsByAdded implements sort.Interface to allow a slice of transaction
+// descriptors to be sorted by the time they were added to the pool.
+type txDescsByAdded []*TxDesc
+
+// Len returns the number of descriptors in the slice.  It is part of the
+// sort.Interface implementation.
+func (s txDescsByAdded) Len() int {
+	return len(s)
+}
+
+// Swap swaps the descriptors at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s txDescsByAdded) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the descriptor with index i was added before the
+// descriptor with index j.  It is part of the sort.Interface implementation.
+func (s txDescsByAdded) Less(i, j int) bool {
+	return s[i].Added.Before(s[j].Added)
+}
+
+// expireTransactions evicts the transactions which expired as of the passed
+// time from the main pool along with the transactions which depend on them,
+// and passes the evicted transactions to the TxExpired callback.  Expired
+// transactions which an exempt transaction depends on are kept since evicting
+// them would evict the exempt transaction too.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) limitNumOrphans() error {
-	// Scan through the orphan pool and remove any expired orphans when it's
-	// time.  This is done for efficiency so the scan only happens
-	// periodically instead of on every orphan added to the pool.
-	if now := time.Now(); now.After(mp.nextExpireScan) {
-		origNumOrphans := len(mp.orphans)
-		for _, otx := range mp.orphans {
-			if now.After(otx.expiration) {
-				// Remove redeemers too because the missing
-				// parents are very unlikely to ever materialize
-				// since the orphan has already been around more
-				// than long enough for them to be delivered.
-				mp.removeOrphan(otx.tx, true)
+func (mp *TxPool) expireTransactions(now time.Time) {
+	if mp.cfg.Policy.TxExpiry <= 0 {
+		return
+	}
+
+	var expired []*TxDesc
+	for _, txD := range mp.pool {
+		expiry := mp.expiryTime(txD)
+		if !expiry.IsZero() && !now.Before(expiry) {
+			expired = append(expired, txD)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	sort.Sort(txDescsByAdded(expired))
+
+	// Gather the expired transactions and their descendants, oldest
+	// first, skipping those which an exempt transaction depends on.
+	var candidates []*provautil.Tx
+	evict := make(map[chainhash.Hash]*provautil.Tx)
+	for _, txD := range expired {
+		if _, ok := evict[*txD.Tx.Hash()]; ok {
+			continue
+		}
+		descendants := mp.descendants(txD.Tx)
+		keep := false
+		for _, tx := range descendants[1:] {
+			if mp.isExpiryExempt(tx) {
+				keep = true
+				break
+			}
+		}
+		if keep {
+			continue
+		}
+		for _, tx := range descendants {
+			if _, ok := evict[*tx.Hash()]; !ok {
+				evict[*tx.Hash()] = tx
+				candidates = append(candidates, tx)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	// Order the evicted transactions so every transaction comes after
+	// the evicted transactions it depends on.
+	evicted := make([]*provautil.Tx, 0, len(candidates))
+	visited := make(map[chainhash.Hash]struct{}, len(candidates))
+	var visit func(tx *provautil.Tx)
+	visit = func(tx *provautil.Tx) {
+		if _, ok := visited[*tx.Hash()]; ok {
+			return
+		}
+		visited[*tx.Hash()] = struct{}{}
+		for _, txIn := range tx.MsgTx().TxIn {
+			if parent, ok := evict[txIn.PreviousOutPoint.Hash]; ok {
+				visit(parent)
 			}
 		}
+		evicted = append(evicted, tx)
+	}
+	for _, tx := range candidates {
+		visit(tx)
+	}
+
+	for _, tx := range evicted {
+		mp.removeTransaction(tx, false)
+	}
+	log.Debugf("Expired %d %s (remaining: %d)", len(evicted),
+		pickNoun(len(evicted), "transaction", "transactions"),
+		len(mp.pool))
 
-		// Set next expiration scan to occur after the scan interval.
-		mp.nextExpireScan = now.Add(orphanExpireScanInterval)
+	if mp.cfg.TxExpired != nil {
+		mp.cfg.TxExpired(evicted)
+	}
+}
 
-		numOrphans := len(mp.orphans)
-		if numExpired := origNumOrphans - numOrphans; numExpired > 0 {
-			log.Debugf("Expired %d %s (remaining: %d)", numExpired,
-				pickNoun(numExpired, "orphan", "orphans"),
-				numOrphans)
+// maybeExpire evicts expired orphans from the orphan pool and expired
+// transactions from the main pool when it's time.  This is done for efficiency
+// so the scan only happens periodically instead of on every transaction
+// processed.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) maybeExpire() {
+	now := mp.now()
+	if !now.After(mp.nextExpireScan) {
+		return
+	}
+
+	origNumOrphans := len(mp.orphans)
+	for _, otx := range mp.orphans {
+		if now.After(otx.expiration) {
+			// Remove redeemers too because the missing parents are
+			// very unlikely to ever materialize since the orphan
+			// has already been around more than long enough for
+			// them to be delivered.
+			mp.removeOrphan(otx.tx, true)
+		}
+	}
+	numOrphans := len(mp.orphans)
+	if numExpired := origNumOrphans - numOrphans; numExpired > 0 {
+		log.Debugf("Expired %d %s (remaining: %d)", numExpired,
+			pickNoun(numExpired, "orphan", "orphans"), numOrphans)
+	}
+
+	for hash, otx := range mp.packageParents {
+		if now.After(otx.expiration) {
+			delete(mp.packageParents, hash)
 		}
 	}
 
+	mp.expireTransactions(now)
+
+	// Set next expiration scan to occur after the scan interval.
+	mp.nextExpireScan = now.Add(orphanExpireScanInterval)
+}
+
+// limitNumOrphans limits the number of orphan transactions by evicting a random
+// orphan if adding a new one would cause it to overflow the max allowed.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) limitNumOrphans() error {
+	// Scan through the pools and remove any expired transactions when
+	// it's time.
+	mp.maybeExpire()
+
 	// Nothing to do if adding another orphan will not cause the pool to
 	// exceed the limit.
 	if len(mp.orphans)+1 <= mp.cfg.Policy.MaxOrphanTxs {
@@ -328,7 +630,7 @@ func (mp *TxPool) addOrphan(tx *provautil.Tx, tag Tag) {
 	mp.orphans[*tx.Hash()] = &orphanTx{
 		tx:         tx,
 		tag:        tag,
-		expiration: time.Now().Add(orphanTTL),
+		expiration: mp.now().Add(orphanTTL),
 	}
 	for _, txIn := range tx.MsgTx().TxIn {
 		if _, exists := mp.orphansByPrev[txIn.PreviousOutPoint]; !exists {
@@ -370,6 +672,96 @@ func (mp *TxPool) maybeAddOrphan(tx *provautil.Tx, tag Tag) error {
 	return nil
 }
 
+// addPackageParent holds the passed transaction, which was rejected for paying
+// too little fee, for a while so an orphan spending it which pays enough fee
+// for both can still be accepted along with it.  Transactions which are too
+// large to be orphans are not held, and a random held transaction is evicted
+// when as many are held as orphans are allowed.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) addPackageParent(tx *provautil.Tx, tag Tag) {
+	if mp.cfg.Policy.MaxOrphanTxs <= 0 ||
+		tx.MsgTx().SerializeSize() > mp.cfg.Policy.MaxOrphanTxSize {
+
+		return
+	}
+	if _, exists := mp.packageParents[*tx.Hash()]; !exists &&
+		len(mp.packageParents) >= mp.cfg.Policy.MaxOrphanTxs {
+
+		for hash := range mp.packageParents {
+			delete(mp.packageParents, hash)
+			break
+		}
+	}
+	mp.packageParents[*tx.Hash()] = &orphanTx{
+		tx:         tx,
+		tag:        tag,
+		expiration: mp.now().Add(packageParentTTL),
+	}
+	log.Debugf("Holding transaction %v awaiting a child to pay for it",
+		tx.Hash())
+}
+
+// orphanFee returns the fee paid by the passed orphan once the passed parent is
+// in the main pool, and whether all of the inputs of the orphan are available
+// then so its fee is known.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) orphanFee(orphan, parent *provautil.Tx) (int64, bool) {
+	utxoView, err := mp.fetchInputUtxos(orphan)
+	if err != nil {
+		return 0, false
+	}
+	utxoView.AddTxOuts(parent, mining.UnminedHeight)
+
+	var totalIn, totalOut int64
+	for _, txIn := range orphan.MsgTx().TxIn {
+		prevOut := &txIn.PreviousOutPoint
+		entry := utxoView.LookupEntry(&prevOut.Hash)
+		if entry == nil || entry.IsOutputSpent(prevOut.Index) {
+			return 0, false
+		}
+		totalIn += entry.AmountByIndex(prevOut.Index)
+	}
+	for _, txOut := range orphan.MsgTx().TxOut {
+		totalOut += txOut.Value
+	}
+	if totalIn < totalOut {
+		return 0, false
+	}
+	return totalIn - totalOut, true
+}
+
+// orphanPackageFees returns the total fee and serialized size of the orphans
+// which spend outputs of the passed transaction and would no longer be orphans
+// once it is in the main pool.  They are used to evaluate the fee rate of the
+// package of the transaction and its orphans, so a child paying enough fee can
+// pay for a parent paying too little.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) orphanPackageFees(tx *provautil.Tx) (int64, int64) {
+	var totalFee, totalSize int64
+	seen := make(map[chainhash.Hash]struct{})
+	prevOut := wire.OutPoint{Hash: *tx.Hash()}
+	for txOutIdx := range tx.MsgTx().TxOut {
+		prevOut.Index = uint32(txOutIdx)
+		for orphanHash, orphan := range mp.orphansByPrev[prevOut] {
+			if _, ok := seen[orphanHash]; ok {
+				continue
+			}
+			seen[orphanHash] = struct{}{}
+
+			fee, ok := mp.orphanFee(orphan, tx)
+			if !ok {
+				continue
+			}
+			totalFee += fee
+			totalSize += int64(orphan.MsgTx().SerializeSize())
+		}
+	}
+	return totalFee, totalSize
+}
+
 // removeOrphanDoubleSpends removes all orphans which spend outputs spent by the
 // passed transaction from the orphan pool.  Removing those orphans then leads
 // to removing all orphans which rely on them, recursively.  This is necessary
@@ -457,6 +849,19 @@ func (mp *TxPool) HaveTransaction(hash *chainhash.Hash) bool {
 	return haveTx
 }
 
+// CheckSpend returns the transaction in the main pool which spends the passed
+// outpoint, or nil if no transaction in the pool spends it.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) CheckSpend(op wire.OutPoint) *provautil.Tx {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	txR := mp.outpoints[op]
+	mp.mtx.RUnlock()
+
+	return txR
+}
+
 // removeTransaction is the internal function which implements the public
 // RemoveTransaction.  See the comment for RemoveTransaction for more details.
 //
@@ -485,7 +890,10 @@ func (mp *TxPool) removeTransaction(tx *provautil.Tx, removeRedeemers bool) {
 		for _, txIn := range txDesc.Tx.MsgTx().TxIn {
 			delete(mp.outpoints, txIn.PreviousOutPoint)
 		}
+		mp.removeKeyDependencies(txDesc)
 		delete(mp.pool, *txHash)
+		delete(mp.feeDeltas, *txHash)
+		mp.sequence++
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 	}
 }
@@ -531,22 +939,28 @@ func (mp *TxPool) RemoveDoubleSpends(tx *provautil.Tx) {
 // This function MUST be called with the mempool lock held (for writes).
 func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *provautil.Tx, height uint32, fee int64) *TxDesc {
 	// Add the transaction to the pool and mark the referenced outpoints
-	// as spent by the pool.
+	// as spent by the pool.  The fee per kilobyte includes the adjustment
+	// of a transaction prioritised before it was added.
+	feeDelta := mp.feeDeltas[*tx.Hash()]
 	txD := &TxDesc{
 		TxDesc: mining.TxDesc{
 			Tx:       tx,
-			Added:    time.Now(),
+			Added:    mp.now(),
 			Height:   height,
 			Fee:      fee,
-			FeePerKB: fee * 1000 / int64(tx.MsgTx().SerializeSize()),
+			FeePerKB: (fee + feeDelta) * 1000 / int64(tx.MsgTx().SerializeSize()),
 		},
 		StartingPriority: mining.CalcPriority(tx.MsgTx(), utxoView, height),
+		FeeDelta:         feeDelta,
+		keyIDs:           txKeyIDs(tx, utxoView),
 	}
 	mp.pool[*tx.Hash()] = txD
+	mp.addKeyDependencies(txD)
 
 	for _, txIn := range tx.MsgTx().TxIn {
 		mp.outpoints[txIn.PreviousOutPoint] = tx
 	}
+	mp.sequence++
 	atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 
 	// Add unconfirmed address index entries associated with the transaction
@@ -558,6 +972,120 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *provaut
 	return txD
 }
 
+// txKeyIDs returns the ASP key IDs the outputs of the passed transaction, and
+// the outputs it spends which are in the passed view, pay to.
+func txKeyIDs(tx *provautil.Tx, utxoView *blockchain.UtxoViewpoint) []btcec.KeyID {
+	var keyIDs []btcec.KeyID
+	seen := make(map[btcec.KeyID]struct{})
+	addKeyIDs := func(pkScript []byte) {
+		pops, err := txscript.ParseScript(pkScript)
+		if err != nil || txscript.TypeOfScript(pops) != txscript.ProvaTy {
+			return
+		}
+		scriptKeyIDs, err := txscript.ExtractKeyIDs(pops)
+		if err != nil {
+			return
+		}
+		for _, keyID := range scriptKeyIDs {
+			if _, ok := seen[keyID]; ok {
+				continue
+			}
+			seen[keyID] = struct{}{}
+			keyIDs = append(keyIDs, keyID)
+		}
+	}
+	for _, txOut := range tx.MsgTx().TxOut {
+		addKeyIDs(txOut.PkScript)
+	}
+	for _, txIn := range tx.MsgTx().TxIn {
+		prevOut := &txIn.PreviousOutPoint
+		entry := utxoView.LookupEntry(&prevOut.Hash)
+		if entry == nil {
+			continue
+		}
+		addKeyIDs(entry.PkScriptByIndex(prevOut.Index))
+	}
+	return keyIDs
+}
+
+// adminKeySet returns the admin key set which signs the passed transaction and
+// true when it is an admin transaction, or false otherwise.
+func adminKeySet(tx *provautil.Tx) (btcec.KeySetType, bool) {
+	threadInt, _ := txscript.GetAdminDetails(tx)
+	if threadInt < 0 {
+		return 0, false
+	}
+	return btcec.KeySetType(threadInt), true
+}
+
+// addKeyDependencies adds the passed transaction descriptor to the indexes of
+// the keys it depends on.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) addKeyDependencies(txD *TxDesc) {
+	txHash := *txD.Tx.Hash()
+	for _, keyID := range txD.keyIDs {
+		txns, exists := mp.keyIDIndex[keyID]
+		if !exists {
+			txns = make(map[chainhash.Hash]*provautil.Tx)
+			mp.keyIDIndex[keyID] = txns
+		}
+		txns[txHash] = txD.Tx
+	}
+	if keySet, ok := adminKeySet(txD.Tx); ok {
+		txns, exists := mp.keySetIndex[keySet]
+		if !exists {
+			txns = make(map[chainhash.Hash]*provautil.Tx)
+			mp.keySetIndex[keySet] = txns
+		}
+		txns[txHash] = txD.Tx
+	}
+}
+
+// removeKeyDependencies removes the passed transaction descriptor from the
+// indexes of the keys it depends on.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) removeKeyDependencies(txD *TxDesc) {
+	txHash := *txD.Tx.Hash()
+	for _, keyID := range txD.keyIDs {
+		delete(mp.keyIDIndex[keyID], txHash)
+		if len(mp.keyIDIndex[keyID]) == 0 {
+			delete(mp.keyIDIndex, keyID)
+		}
+	}
+	if keySet, ok := adminKeySet(txD.Tx); ok {
+		delete(mp.keySetIndex[keySet], txHash)
+		if len(mp.keySetIndex[keySet]) == 0 {
+			delete(mp.keySetIndex, keySet)
+		}
+	}
+}
+
+// chainKeyView returns a key view of the admin state of the current best
+// chain.
+func (mp *TxPool) chainKeyView() *blockchain.KeyViewpoint {
+	keyView := blockchain.NewKeyViewpoint()
+	keyView.SetThreadTips(mp.cfg.ThreadTips())
+	keyView.SetTotalSupply(mp.cfg.TotalSupply())
+	keyView.SetLastKeyID(mp.cfg.LastKeyID())
+	keyView.SetKeyIDs(mp.cfg.GetKeyIDs())
+	keyView.SetKeys(mp.cfg.GetAdminKeySets())
+	return keyView
+}
+
+// countRuleError counts the passed error in the error stats of the pool when
+// it is a rule error and the pool has error stats, and returns it.
+func (mp *TxPool) countRuleError(err error) error {
+	if mp.cfg.ErrorStats == nil {
+		return err
+	}
+	if code, ok := ruleErrorCode(err); ok {
+		mp.cfg.ErrorStats.Add(blockchain.ErrorLevelMempool, code)
+	}
+	return err
+}
+
 // checkPoolDoubleSpend checks whether or not the passed transaction is
 // attempting to spend coins already spent by other transactions in the pool.
 // Note it does not check for double spends against transactions already in the
@@ -622,10 +1150,21 @@ func (mp *TxPool) FetchTransaction(txHash *chainhash.Hash) (*provautil.Tx, error
 
 // maybeAcceptTransaction is the internal function which implements the public
 // MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
-// more details.
+// more details.  The rule errors the transaction is rejected with are counted
+// in the error stats of the pool.
 //
 // This function MUST be called with the mempool lock held (for writes).
 func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool, rejectDupOrphans bool) ([]*chainhash.Hash, *TxDesc, error) {
+	missingParents, txD, err := mp.acceptTransaction(tx, isNew, rateLimit,
+		rejectDupOrphans)
+	return missingParents, txD, mp.countRuleError(err)
+}
+
+// acceptTransaction performs the work of maybeAcceptTransaction.  See its
+// documentation for details.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) acceptTransaction(tx *provautil.Tx, isNew, rateLimit bool, rejectDupOrphans bool) ([]*chainhash.Hash, *TxDesc, error) {
 	txHash := tx.Hash()
 
 	// Don't accept the transaction if it already exists in the pool.  This
@@ -639,10 +1178,15 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 		return nil, nil, txRuleError(wire.RejectDuplicate, str)
 	}
 
-	// Perform preliminary sanity checks on the transaction.  This makes
-	// use of blockchain which contains the invariant rules for what
-	// transactions are allowed into blocks.
+	// Perform preliminary sanity checks on the transaction, and ensure it
+	// is encoded for the network.  This makes use of blockchain which
+	// contains the invariant rules for what transactions are allowed into
+	// blocks.
 	err := blockchain.CheckTransactionSanity(tx)
+	if err == nil {
+		err = blockchain.CheckTransactionEncoding(tx,
+			mp.cfg.ChainParams)
+	}
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
 			return nil, nil, chainRuleError(cerr)
@@ -673,6 +1217,24 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	bestHeight := mp.cfg.BestHeight()
 	nextBlockHeight := bestHeight + 1
 
+	// Don't accept transactions which can't be mined in the next block
+	// because they expired, or which expire within the expiry margin and
+	// so would be evicted again shortly.
+	if blockchain.IsExpiredTx(tx, nextBlockHeight) {
+		str := fmt.Sprintf("transaction %v expired at height %d",
+			txHash, tx.MsgTx().Expiry)
+		return nil, nil, chainRuleError(blockchain.RuleError{
+			ErrorCode:   blockchain.ErrTxExpired,
+			Description: str,
+		})
+	}
+	if blockchain.IsExpiredTx(tx, nextBlockHeight+txExpiryMargin) {
+		str := fmt.Sprintf("transaction %v expires at height %d, "+
+			"within %d blocks of the next block", txHash,
+			tx.MsgTx().Expiry, txExpiryMargin)
+		return nil, nil, txRuleError(wire.RejectNonstandard, str)
+	}
+
 	medianTimePast := mp.cfg.MedianTimePast()
 
 	// Don't allow non-standard transactions if the network parameters
@@ -695,6 +1257,17 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 		}
 	}
 
+	// Don't allow transactions whose inputs and outputs are not in the
+	// canonical order when the policy requires it.  Admin transactions are
+	// exempt since the order of their inputs and outputs is meaningful.
+	if mp.cfg.Policy.RequireCanonicalOrder && !mining.IsAdminTx(tx.MsgTx()) &&
+		!txsort.IsSorted(tx.MsgTx()) {
+
+		str := fmt.Sprintf("transaction %v inputs and outputs are not "+
+			"in canonical order", txHash)
+		return nil, nil, txRuleError(wire.RejectNonstandard, str)
+	}
+
 	// The transaction may not use any of the same outputs as other
 	// transactions already in the pool as that would ultimately result in a
 	// double spend.  This check is intended to be quick and therefore only
@@ -721,12 +1294,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	}
 
 	// Set the data for the keyview from chain
-	keyView := blockchain.NewKeyViewpoint()
-	keyView.SetThreadTips(mp.cfg.ThreadTips())
-	keyView.SetTotalSupply(mp.cfg.TotalSupply())
-	keyView.SetLastKeyID(mp.cfg.LastKeyID())
-	keyView.SetKeyIDs(mp.cfg.GetKeyIDs())
-	keyView.SetKeys(mp.cfg.GetAdminKeySets())
+	keyView := mp.chainKeyView()
 
 	// Don't allow the transaction if it exists in the main chain and is not
 	// not already fully spent.
@@ -738,19 +1306,25 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	delete(utxoView.Entries(), *txHash)
 
 	// Transaction is an orphan if any of the referenced input transactions
-	// don't exist.  Adding orphans to the orphan pool is not handled by
-	// this function, and the caller should use maybeAddOrphan if this
-	// behavior is desired.
+	// don't exist.  Inputs which reference spent outputs of transactions
+	// which do exist are double spends rather than orphans, so they are
+	// left to be rejected by the input checks below.  Adding orphans to
+	// the orphan pool is not handled by this function, and the caller
+	// should use maybeAddOrphan if this behavior is desired.
 	var missingParents []*chainhash.Hash
-	for originHash, entry := range utxoView.Entries() {
-		if entry == nil || entry.IsFullySpent() {
-			// Must make a copy of the hash here since the iterator
-			// is replaced and taking its address directly would
-			// result in all of the entries pointing to the same
-			// memory location and thus all be the final hash.
-			hashCopy := originHash
-			missingParents = append(missingParents, &hashCopy)
+	seenParents := make(map[chainhash.Hash]struct{})
+	for txInIndex := range tx.MsgTx().TxIn {
+		err := blockchain.CheckTxInputAvailable(tx, txInIndex, utxoView)
+		cerr, ok := err.(blockchain.RuleError)
+		if !ok || cerr.ErrorCode != blockchain.ErrMissingTx {
+			continue
+		}
+		parentHash := cerr.Input.PrevOut.Hash
+		if _, ok := seenParents[parentHash]; ok {
+			continue
 		}
+		seenParents[parentHash] = struct{}{}
+		missingParents = append(missingParents, &parentHash)
 	}
 	if len(missingParents) > 0 {
 		return missingParents, nil, nil
@@ -786,7 +1360,8 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	}
 
 	// CheckTransactionOutputs checks outputs for state violations.
-	err = blockchain.CheckTransactionOutputs(tx, keyView)
+	err = blockchain.CheckTransactionOutputs(tx, keyView,
+		mp.cfg.ChainParams)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -848,7 +1423,24 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	serializedSize := int64(tx.MsgTx().SerializeSize())
 	minFee := calcMinRequiredTxRelayFee(serializedSize,
 		mp.cfg.Policy.MinRelayTxFee)
-	if serializedSize >= (DefaultBlockPrioritySize-1000) && txFee < minFee {
+
+	// A transaction paying less than the minimum fee on its own is treated
+	// as paying it when the orphans spending it pay enough fee for the
+	// whole package, meaning the fee rate of the transaction along with the
+	// orphans is at least the minimum relay fee rate.  The orphans are
+	// accepted right after it by the caller.
+	paysMinFee := txFee >= minFee
+	var paidByOrphans bool
+	if !paysMinFee {
+		orphanFee, orphanSize := mp.orphanPackageFees(tx)
+		packageMinFee := calcMinRequiredTxRelayFee(
+			serializedSize+orphanSize, mp.cfg.Policy.MinRelayTxFee)
+		if orphanSize > 0 && txFee+orphanFee >= packageMinFee {
+			paysMinFee = true
+			paidByOrphans = true
+		}
+	}
+	if serializedSize >= (DefaultBlockPrioritySize-1000) && !paysMinFee {
 		str := fmt.Sprintf("transaction %v has %d fees which is under "+
 			"the required amount of %d", txHash, txFee,
 			minFee)
@@ -859,7 +1451,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	// in the next block.  Transactions which are being added back to the
 	// memory pool from blocks that have been disconnected during a reorg
 	// are exempted.
-	if isNew && !mp.cfg.Policy.DisableRelayPriority && txFee < minFee {
+	if isNew && !mp.cfg.Policy.DisableRelayPriority && !paysMinFee {
 		currentPriority := mining.CalcPriority(tx.MsgTx(), utxoView,
 			nextBlockHeight)
 		if currentPriority <= mining.MinHighPriority {
@@ -872,7 +1464,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 
 	// Free-to-relay transactions are rate limited here to prevent
 	// penny-flooding with tiny transactions as a form of attack.
-	if rateLimit && txFee < minFee {
+	if rateLimit && !paysMinFee {
 		nowUnix := time.Now().Unix()
 		// Decay passed data with an exponentially decaying ~10 minute
 		// window - matches bitcoind handling.
@@ -897,7 +1489,8 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	// Verify crypto signatures for each input and reject the transaction if
 	// any don't verify.
 	err = blockchain.ValidateTransactionScripts(tx, utxoView, keyView,
-		txscript.StandardVerifyFlags, mp.cfg.SigCache, mp.cfg.HashCache)
+		txscript.StandardVerifyFlags, mp.cfg.SigCache, mp.cfg.HashCache,
+		mp.cfg.SigVerifyWorkers)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
 			return nil, nil, chainRuleError(cerr)
@@ -907,6 +1500,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 
 	// Add to transaction pool.
 	txD := mp.addTransaction(utxoView, tx, bestHeight, txFee)
+	txD.paidByOrphans = paidByOrphans
 
 	log.Debugf("Accepted transaction %v (pool size: %v)", txHash,
 		len(mp.pool))
@@ -1035,30 +1629,43 @@ func (mp *TxPool) ProcessOrphans(acceptedTx *provautil.Tx) []*TxDesc {
 	return acceptedTxns
 }
 
-// ProcessTransaction is the main workhorse for handling insertion of new
-// free-standing transactions into the memory pool.  It includes functionality
-// such as rejecting duplicate transactions, ensuring transactions follow all
-// rules, orphan transaction handling, and insertion into the memory pool.
-//
-// It returns a slice of transactions added to the mempool.  When the
-// error is nil, the list will include the passed transaction itself along
-// with any additional orphan transaactions that were added as a result of
-// the passed one being accepted.
-//
-// This function is safe for concurrent access.
-func (mp *TxPool) ProcessTransaction(tx *provautil.Tx, allowOrphan, rateLimit bool, tag Tag) ([]*TxDesc, error) {
-	log.Tracef("Processing transaction %v", tx.Hash())
+// isInsufficientFee returns whether the passed error rejects a transaction for
+// paying too little fee or having too little priority.
+func isInsufficientFee(err error) bool {
+	code, found := extractRejectCode(err)
+	return found && code == wire.RejectInsufficientFee
+}
 
-	// Protect concurrent access.
-	mp.mtx.Lock()
-	defer mp.mtx.Unlock()
+// spendsOutputOf returns whether any of the passed transactions spends an
+// output of the passed parent.
+func spendsOutputOf(txDescs []*TxDesc, parent *provautil.Tx) bool {
+	for _, txD := range txDescs {
+		for _, txIn := range txD.Tx.MsgTx().TxIn {
+			if txIn.PreviousOutPoint.Hash == *parent.Hash() {
+				return true
+			}
+		}
+	}
+	return false
+}
 
+// processTransaction is the internal function which implements the public
+// ProcessTransaction.  See the comment for ProcessTransaction for more details.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) processTransaction(tx *provautil.Tx, allowOrphan, rateLimit bool, tag Tag) ([]*TxDesc, error) {
 	// Potentially accept the transaction to the memory pool.
 	missingParents, txD, err := mp.maybeAcceptTransaction(tx, true, rateLimit,
 		true)
 	if err != nil {
+		// Hold transactions relayed by peers which pay too little fee
+		// for a while since a child paying for them may follow.
+		if allowOrphan && isInsufficientFee(err) {
+			mp.addPackageParent(tx, tag)
+		}
 		return nil, err
 	}
+	delete(mp.packageParents, *tx.Hash())
 
 	if len(missingParents) == 0 {
 		// Accept any orphan transactions that depend on this
@@ -1066,6 +1673,19 @@ func (mp *TxPool) ProcessTransaction(tx *provautil.Tx, allowOrphan, rateLimit bo
 		// are now available) and repeat for those accepted
 		// transactions until there are no more.
 		newTxs := mp.processOrphans(tx)
+
+		// The transaction was only accepted because orphans spending
+		// it paid for it, so it is removed again when none of them
+		// were accepted after all.
+		if txD.paidByOrphans && !spendsOutputOf(newTxs, tx) {
+			mp.removeTransaction(tx, true)
+			str := fmt.Sprintf("transaction %v pays too little fee "+
+				"and none of the orphans paying for it are "+
+				"valid", tx.Hash())
+			return nil, mp.countRuleError(txRuleError(
+				wire.RejectInsufficientFee, str))
+		}
+
 		acceptedTxs := make([]*TxDesc, len(newTxs)+1)
 
 		// Add the parent transaction first so remote nodes
@@ -1091,12 +1711,73 @@ func (mp *TxPool) ProcessTransaction(tx *provautil.Tx, allowOrphan, rateLimit bo
 		str := fmt.Sprintf("orphan transaction %v references "+
 			"outputs of unknown or fully-spent "+
 			"transaction %v", tx.Hash(), missingParents[0])
-		return nil, txRuleError(wire.RejectDuplicate, str)
+		return nil, mp.countRuleError(txRuleError(wire.RejectDuplicate,
+			str))
 	}
 
 	// Potentially add the orphan transaction to the orphan pool.
 	err = mp.maybeAddOrphan(tx, tag)
-	return nil, err
+	if err != nil {
+		return nil, mp.countRuleError(err)
+	}
+
+	// The orphan may spend a held transaction which was rejected for
+	// paying too little fee, so evaluate the held transaction again now
+	// that the orphan can pay for it.  Accepting it accepts the orphan as
+	// well.
+	now := mp.now()
+	for _, parentHash := range missingParents {
+		otx, exists := mp.packageParents[*parentHash]
+		if !exists {
+			continue
+		}
+		delete(mp.packageParents, *parentHash)
+		if now.After(otx.expiration) {
+			continue
+		}
+		acceptedTxs, err := mp.processTransaction(otx.tx, true,
+			rateLimit, otx.tag)
+		if err != nil {
+			log.Debugf("Transaction %v is still rejected with "+
+				"orphan %v: %v", parentHash, tx.Hash(), err)
+			continue
+		}
+		return acceptedTxs, nil
+	}
+	return nil, nil
+}
+
+// ProcessTransaction is the main workhorse for handling insertion of new
+// free-standing transactions into the memory pool.  It includes functionality
+// such as rejecting duplicate transactions, ensuring transactions follow all
+// rules, orphan transaction handling, and insertion into the memory pool.
+//
+// Transactions paying too little fee are accepted along with the orphans which
+// spend them when the orphans pay enough fee for the whole package.  When
+// orphans are allowed, transactions rejected for paying too little fee are
+// held for a while so an orphan paying for them which arrives afterwards is
+// evaluated along with them.
+//
+// It returns a slice of transactions added to the mempool.  When the
+// error is nil, the list will include the passed transaction itself along
+// with any additional orphan transaactions that were added as a result of
+// the passed one being accepted.  When the passed transaction is an orphan
+// which pays for a held transaction, the list includes the held transaction
+// first, followed by the passed one and any other orphans.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ProcessTransaction(tx *provautil.Tx, allowOrphan, rateLimit bool, tag Tag) ([]*TxDesc, error) {
+	log.Tracef("Processing transaction %v", tx.Hash())
+
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	// Scan through the pools and remove any expired transactions when
+	// it's time.
+	mp.maybeExpire()
+
+	return mp.processTransaction(tx, allowOrphan, rateLimit, tag)
 }
 
 // Count returns the number of transactions in the main pool.  It does not
@@ -1111,6 +1792,17 @@ func (mp *TxPool) Count() int {
 	return count
 }
 
+// OrphanCount returns the number of transactions in the orphan pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) OrphanCount() int {
+	mp.mtx.RLock()
+	count := len(mp.orphans)
+	mp.mtx.RUnlock()
+
+	return count
+}
+
 // TxHashes returns a slice of hashes for all of the transactions in the memory
 // pool.
 //
@@ -1211,6 +1903,459 @@ func (mp *TxPool) RawMempoolVerbose() map[string]*btcjson.GetRawMempoolVerboseRe
 	return result
 }
 
+// SnapshotEntry describes a transaction in the main pool as of a Snapshot.
+type SnapshotEntry struct {
+	// Hash is the hash of the transaction.
+	Hash chainhash.Hash
+
+	// Size is the serialized size of the transaction in bytes.
+	Size int
+
+	// Fee is the fee paid by the transaction and FeeDelta the adjustment
+	// made to it with PrioritiseTransaction.
+	Fee      int64
+	FeeDelta int64
+
+	// Added and Height are the time and the best block height when the
+	// transaction was added to the pool.
+	Added  time.Time
+	Height uint32
+
+	// Depends holds the hashes of the transactions in the pool the
+	// transaction spends outputs of, and SpentBy those of the transactions
+	// in the pool which spend its outputs.
+	Depends []chainhash.Hash
+	SpentBy []chainhash.Hash
+
+	// RawTx is the serialized transaction.  It is only set when requested.
+	RawTx []byte
+}
+
+// Snapshot is a consistent view of the transactions in the main pool at a
+// given sequence number.
+type Snapshot struct {
+	// Sequence is the sequence number of the pool when the snapshot was
+	// taken.  It is incremented each time a transaction is added to,
+	// removed from or prioritised in the main pool, so two snapshots with
+	// the same sequence number hold the same entries.
+	Sequence uint64
+
+	// Entries holds an entry for each transaction in the pool, ordered by
+	// the time they were added to the pool and then by hash.
+	Entries []SnapshotEntry
+}
+
+// Sequence returns the current sequence number of the main pool, which is
+// incremented each time a transaction is added to, removed from or prioritised
+// in it.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Sequence() uint64 {
+	mp.mtx.RLock()
+	sequence := mp.sequence
+	mp.mtx.RUnlock()
+	return sequence
+}
+
+// Snapshot returns the transactions in the main pool along with their fees,
+// sizes and relations to each other, and the sequence number of the pool, all
+// taken under a single acquisition of the mempool lock so they are consistent
+// with each other.  The transactions themselves are only serialized into the
+// snapshot when includeRawTx is set.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Snapshot(includeRawTx bool) *Snapshot {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	snapshot := &Snapshot{
+		Sequence: mp.sequence,
+		Entries:  make([]SnapshotEntry, 0, len(mp.pool)),
+	}
+	for hash, desc := range mp.pool {
+		msgTx := desc.Tx.MsgTx()
+		entry := SnapshotEntry{
+			Hash:     hash,
+			Size:     msgTx.SerializeSize(),
+			Fee:      desc.Fee,
+			FeeDelta: desc.FeeDelta,
+			Added:    desc.Added,
+			Height:   desc.Height,
+		}
+		seen := make(map[chainhash.Hash]struct{})
+		for _, txIn := range msgTx.TxIn {
+			parentHash := txIn.PreviousOutPoint.Hash
+			if _, ok := mp.pool[parentHash]; !ok {
+				continue
+			}
+			if _, ok := seen[parentHash]; ok {
+				continue
+			}
+			seen[parentHash] = struct{}{}
+			entry.Depends = append(entry.Depends, parentHash)
+		}
+		seen = make(map[chainhash.Hash]struct{})
+		for i := range msgTx.TxOut {
+			prevOut := wire.OutPoint{Hash: hash, Index: uint32(i)}
+			child, ok := mp.outpoints[prevOut]
+			if !ok {
+				continue
+			}
+			if _, ok := seen[*child.Hash()]; ok {
+				continue
+			}
+			seen[*child.Hash()] = struct{}{}
+			entry.SpentBy = append(entry.SpentBy, *child.Hash())
+		}
+		if includeRawTx {
+			var buf bytes.Buffer
+			buf.Grow(entry.Size)
+			if err := msgTx.Serialize(&buf); err == nil {
+				entry.RawTx = buf.Bytes()
+			}
+		}
+		snapshot.Entries = append(snapshot.Entries, entry)
+	}
+
+	sort.Sort(snapshotEntriesByAdded(snapshot.Entries))
+	return snapshot
+}
+
+// snapshotEntriesByAdded sorts snapshot entries by the time their transactions
+// were added to the pool and then by hash.
+type snapshotEntriesByAdded []SnapshotEntry
+
+// Len returns the number of entries in the slice.  It is part of the
+// sort.Interface implementation.
+func (s snapshotEntriesByAdded) Len() int {
+	return len(s)
+}
+
+// Swap swaps the entries at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s snapshotEntriesByAdded) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the entry with index i sorts before the entry with index
+// j.  It is part of the sort.Interface implementation.
+func (s snapshotEntriesByAdded) Less(i, j int) bool {
+	if !s[i].Added.Equal(s[j].Added) {
+		return s[i].Added.Before(s[j].Added)
+	}
+	return bytes.Compare(s[i].Hash[:], s[j].Hash[:]) < 0
+}
+
+// MempoolEntry returns the entry of the transaction with the passed hash in the
+// main pool as a fully populated btcjson result.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MempoolEntry(hash *chainhash.Hash) (*btcjson.GetMempoolEntryResult, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	desc, exists := mp.pool[*hash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+
+	// Calculate the current priority based on the inputs to the
+	// transaction.  Use zero if one or more of the input transactions
+	// can't be found for some reason.
+	tx := desc.Tx
+	var currentPriority float64
+	utxos, err := mp.fetchInputUtxos(tx)
+	if err == nil {
+		currentPriority = mining.CalcPriority(tx.MsgTx(), utxos,
+			mp.cfg.BestHeight()+1)
+	}
+
+	result := &btcjson.GetMempoolEntryResult{
+		Size:             int32(tx.MsgTx().SerializeSize()),
+		Fee:              provautil.Amount(desc.Fee).ToRMG(),
+		ModifiedFee:      provautil.Amount(desc.Fee + desc.FeeDelta).ToRMG(),
+		Time:             desc.Added.Unix(),
+		Height:           int64(desc.Height),
+		StartingPriority: desc.StartingPriority,
+		CurrentPriority:  currentPriority,
+		Depends:          make([]string, 0),
+	}
+	if expiry := mp.expiryTime(desc); !expiry.IsZero() {
+		result.ExpiryTime = expiry.Unix()
+	}
+
+	// Both the ancestor and descendant statistics include the transaction
+	// itself.
+	var descendantFees int64
+	for _, descendant := range mp.descendants(tx) {
+		descendantDesc := mp.pool[*descendant.Hash()]
+		result.DescendantCount++
+		result.DescendantSize += int64(descendant.MsgTx().SerializeSize())
+		descendantFees += descendantDesc.Fee + descendantDesc.FeeDelta
+	}
+	result.DescendantFees = provautil.Amount(descendantFees).ToRMG()
+
+	ancestors := []*TxDesc{desc}
+	seen := map[chainhash.Hash]struct{}{*hash: {}}
+	var ancestorFees int64
+	for i := 0; i < len(ancestors); i++ {
+		ancestor := ancestors[i]
+		result.AncestorCount++
+		result.AncestorSize += int64(ancestor.Tx.MsgTx().SerializeSize())
+		ancestorFees += ancestor.Fee + ancestor.FeeDelta
+		for _, txIn := range ancestor.Tx.MsgTx().TxIn {
+			parentHash := txIn.PreviousOutPoint.Hash
+			parent, exists := mp.pool[parentHash]
+			if !exists {
+				continue
+			}
+			if _, ok := seen[parentHash]; ok {
+				continue
+			}
+			seen[parentHash] = struct{}{}
+			ancestors = append(ancestors, parent)
+			if i == 0 {
+				result.Depends = append(result.Depends,
+					parentHash.String())
+			}
+		}
+	}
+	result.AncestorFees = provautil.Amount(ancestorFees).ToRMG()
+
+	return result, nil
+}
+
+// PrioritiseTransaction adjusts the fee of the transaction with the passed
+// hash by the passed amount when selecting transactions for block templates,
+// and exempts the transaction from expiry.  The transaction does not need to
+// be in the pool yet, in which case the adjustment applies once it is added.
+// Adjustments accumulate and are discarded when the transaction is removed
+// from the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) PrioritiseTransaction(hash *chainhash.Hash, feeDelta int64) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	mp.feeDeltas[*hash] += feeDelta
+	desc, exists := mp.pool[*hash]
+	if !exists {
+		return
+	}
+
+	// Replace the descriptor rather than modifying it since the
+	// descriptors handed out by the pool are treated as read only.
+	newDesc := *desc
+	newDesc.FeeDelta = mp.feeDeltas[*hash]
+	newDesc.FeePerKB = (desc.Fee + newDesc.FeeDelta) * 1000 /
+		int64(desc.Tx.MsgTx().SerializeSize())
+	mp.pool[*hash] = &newDesc
+	mp.sequence++
+	atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
+}
+
+// revokedKeys returns the ASP key IDs revoked by the admin transactions in the
+// passed block along with the admin key sets they revoke keys of.
+func revokedKeys(block *provautil.Block) (map[btcec.KeyID]struct{}, map[btcec.KeySetType]struct{}) {
+	keyIDs := make(map[btcec.KeyID]struct{})
+	keySets := make(map[btcec.KeySetType]struct{})
+	for _, tx := range block.Transactions() {
+		threadInt, adminOutputs := txscript.GetAdminDetails(tx)
+		if threadInt < 0 || provautil.ThreadID(threadInt) ==
+			provautil.IssueThread {
+
+			continue
+		}
+		for _, adminOutput := range adminOutputs {
+			if txscript.IsUpgradableAdminOp(adminOutput) {
+				continue
+			}
+			isAddOp, keySetType, _, keyID :=
+				txscript.ExtractAdminOpData(adminOutput)
+			switch {
+			case isAddOp:
+				continue
+			case keySetType == btcec.ASPKeySet:
+				keyIDs[keyID] = struct{}{}
+			default:
+				keySets[keySetType] = struct{}{}
+			}
+		}
+	}
+	return keyIDs, keySets
+}
+
+// checkKeyDependencies re-validates the outputs and the signatures of the
+// passed transaction against the passed key view.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) checkKeyDependencies(tx *provautil.Tx, keyView *blockchain.KeyViewpoint) error {
+	utxoView, err := mp.fetchInputUtxos(tx)
+	if err != nil {
+		return err
+	}
+	err = blockchain.CheckTransactionOutputs(tx, keyView,
+		mp.cfg.ChainParams)
+	if err != nil {
+		return err
+	}
+	return blockchain.ValidateTransactionScripts(tx, utxoView, keyView,
+		txscript.StandardVerifyFlags, mp.cfg.SigCache, mp.cfg.HashCache,
+		mp.cfg.SigVerifyWorkers)
+}
+
+// RemoveRevokedKeyDependents re-validates the transactions in the main pool
+// which depend on the ASP keys and admin keys revoked by the passed block
+// against the admin state of the best chain, and removes the ones which are no
+// longer valid along with the transactions which depend on them.  Otherwise
+// they would never be mined while still being selected for block templates.
+// The block must already be connected to the main chain.
+//
+// The removed transactions are returned with each transaction before the
+// transactions which depend on it, and are removed for RemovalKeyRevoked.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) RemoveRevokedKeyDependents(block *provautil.Block) []*provautil.Tx {
+	revokedKeyIDs, revokedKeySets := revokedKeys(block)
+	if len(revokedKeyIDs) == 0 && len(revokedKeySets) == 0 {
+		return nil
+	}
+
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	// Gather the transactions which depend on the revoked keys and check
+	// them in the order they were added so a transaction is checked before
+	// the transactions which spend its outputs.
+	affected := make(map[chainhash.Hash]*TxDesc)
+	for keyID := range revokedKeyIDs {
+		for txHash := range mp.keyIDIndex[keyID] {
+			affected[txHash] = mp.pool[txHash]
+		}
+	}
+	for keySet := range revokedKeySets {
+		for txHash := range mp.keySetIndex[keySet] {
+			affected[txHash] = mp.pool[txHash]
+		}
+	}
+	txDescs := make([]*TxDesc, 0, len(affected))
+	for _, txD := range affected {
+		txDescs = append(txDescs, txD)
+	}
+	sort.Sort(txDescsByAdded(txDescs))
+
+	keyView := mp.chainKeyView()
+	var removed []*provautil.Tx
+	for _, txD := range txDescs {
+		// Skip transactions which were already removed because they
+		// depend on a transaction which is no longer valid.
+		tx := txD.Tx
+		if !mp.isTransactionInPool(tx.Hash()) {
+			continue
+		}
+		err := mp.checkKeyDependencies(tx, keyView)
+		if err == nil {
+			continue
+		}
+
+		log.Debugf("Removing transaction %v which depends on a "+
+			"revoked key: %v", tx.Hash(), err)
+		removed = append(removed, mp.descendants(tx)...)
+		mp.removeTransaction(tx, true)
+	}
+	return removed
+}
+
+// RemoveExpiringTransactions removes the transactions which expire within the
+// expiry margin of the block after the passed main chain height from the main
+// pool, along with the transactions which depend on them.  It is called with
+// the height of each block connected to the main chain, which also evicts the
+// transactions a reorganization to a longer chain brought closer to their
+// expiry.
+//
+// The removed transactions are returned with each transaction before the
+// transactions which depend on it, and are removed for RemovalExpiryHeight.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) RemoveExpiringTransactions(height uint32) []*provautil.Tx {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	// Check the expiring transactions in the order they were added so a
+	// transaction is removed before the transactions which spend its
+	// outputs.
+	var expiring []*TxDesc
+	for _, txD := range mp.pool {
+		if blockchain.IsExpiredTx(txD.Tx, height+1+txExpiryMargin) {
+			expiring = append(expiring, txD)
+		}
+	}
+	sort.Sort(txDescsByAdded(expiring))
+
+	var removed []*provautil.Tx
+	for _, txD := range expiring {
+		// Skip transactions which were already removed because they
+		// depend on an expiring transaction.
+		tx := txD.Tx
+		if !mp.isTransactionInPool(tx.Hash()) {
+			continue
+		}
+
+		log.Debugf("Removing transaction %v which expires at height %d",
+			tx.Hash(), tx.MsgTx().Expiry)
+		removed = append(removed, mp.descendants(tx)...)
+		mp.removeTransaction(tx, true)
+	}
+	return removed
+}
+
+// ResurrectTransactions attempts to return the passed transactions of blocks
+// which were disconnected from the main chain to the main pool by validating
+// them against the current best chain.  The transactions must be ordered so
+// each transaction comes after the transactions it depends on, which is the
+// case for the transactions of the disconnected blocks in the order they were
+// mined.  Transactions which were mined again on the new main chain must not be
+// passed.
+//
+// The transactions which were accepted are returned along with the orphans
+// accepted because of them.  The transactions which are no longer valid, due
+// to spent inputs or changes of the admin state, are returned along with the
+// transactions in the main pool which depend on them, with each transaction
+// before the transactions which depend on it.  The latter are removed from the
+// main pool for RemovalReorg.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ResurrectTransactions(txns []*provautil.Tx) ([]*TxDesc, []*provautil.Tx) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	var accepted []*TxDesc
+	var removed []*provautil.Tx
+	for _, tx := range txns {
+		missingParents, txD, err := mp.maybeAcceptTransaction(tx, false,
+			false, true)
+		if err == nil && len(missingParents) == 0 {
+			accepted = append(accepted, txD)
+			accepted = append(accepted, mp.processOrphans(tx)...)
+			continue
+		}
+
+		// Inputs which are neither in the main chain nor in the pool
+		// were spent on the new main chain, so the transaction can't
+		// become valid again.
+		if err == nil {
+			err = fmt.Errorf("orphan transaction references "+
+				"missing outputs from transaction %v",
+				missingParents[0])
+		}
+		log.Debugf("Unable to resurrect transaction %v from a "+
+			"disconnected block: %v", tx.Hash(), err)
+		removed = append(removed, mp.descendants(tx)...)
+		mp.removeTransaction(tx, true)
+	}
+	return accepted, removed
+}
+
 // LastUpdated returns the last time a transaction was added to or removed from
 // the main pool.  It does not include the orphan pool.
 //
@@ -1219,6 +2364,13 @@ func (mp *TxPool) LastUpdated() time.Time {
 	return time.Unix(atomic.LoadInt64(&mp.lastUpdated), 0)
 }
 
+// Policy returns the policy the mempool was configured with.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Policy() Policy {
+	return mp.cfg.Policy
+}
+
 // New returns a new memory pool for validating and storing standalone
 // transactions until they are mined into a block.
 func New(cfg *Config) *TxPool {
@@ -1227,7 +2379,12 @@ func New(cfg *Config) *TxPool {
 		pool:           make(map[chainhash.Hash]*TxDesc),
 		orphans:        make(map[chainhash.Hash]*orphanTx),
 		orphansByPrev:  make(map[wire.OutPoint]map[chainhash.Hash]*provautil.Tx),
+		packageParents: make(map[chainhash.Hash]*orphanTx),
 		nextExpireScan: time.Now().Add(orphanExpireScanInterval),
 		outpoints:      make(map[wire.OutPoint]*provautil.Tx),
+		feeDeltas:      make(map[chainhash.Hash]int64),
+		keyIDIndex:     make(map[btcec.KeyID]map[chainhash.Hash]*provautil.Tx),
+		keySetIndex:    make(map[btcec.KeySetType]map[chainhash.Hash]*provautil.Tx),
+		now:            time.Now,
 	}
 }
@@ -6,16 +6,25 @@
 package mempool
 
 import (
+	"bytes"
 	"encoding/hex"
 	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	_ "github.com/bitgo/prova/database/ffldb"
+	"github.com/bitgo/prova/mining"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/txsort"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -29,6 +38,9 @@ type fakeChain struct {
 	utxos          *blockchain.UtxoViewpoint
 	currentHeight  uint32
 	medianTimePast time.Time
+	lastKeyID      btcec.KeyID
+	keyIDs         btcec.KeyIdMap
+	adminKeySets   map[btcec.KeySetType]btcec.PublicKeySet
 }
 
 // FetchUtxoView loads utxo details about the input transactions referenced by
@@ -78,7 +90,10 @@ func (s *fakeChain) ThreadTips() map[provautil.ThreadID]*wire.OutPoint {
 
 // LastKeyID returns the last issued keyID on the the fake chain instance.
 func (s *fakeChain) LastKeyID() btcec.KeyID {
-	return btcec.KeyID(0)
+	s.RLock()
+	lastKeyID := s.lastKeyID
+	s.RUnlock()
+	return lastKeyID
 }
 
 // TotalSupply returns the total supply on the fake chain instance.
@@ -88,16 +103,42 @@ func (s *fakeChain) TotalSupply() uint64 {
 
 // AdminKeySets returns the set of admin keys on the fake chain instance.
 func (s *fakeChain) AdminKeySets() map[btcec.KeySetType]btcec.PublicKeySet {
-	return make(map[btcec.KeySetType]btcec.PublicKeySet)
+	s.RLock()
+	adminKeySets := btcec.DeepCopy(s.adminKeySets)
+	s.RUnlock()
+	return adminKeySets
+}
+
+// SetAdminKeySet sets the keys of the passed admin key set on the fake chain
+// instance.
+func (s *fakeChain) SetAdminKeySet(keySetType btcec.KeySetType, keySet btcec.PublicKeySet) {
+	s.Lock()
+	s.adminKeySets[keySetType] = keySet
+	s.Unlock()
 }
 
 // KeyIDs returns all keyID to pub key mapping set on the fake chain instance.
 func (s *fakeChain) KeyIDs() btcec.KeyIdMap {
-	keyId1 := btcec.KeyIDFromAddressBuffer([]byte{0, 0, 1, 0})
-	pubKey1, _ := btcec.ParsePubKey(hexToBytes("025ceeba2ab4a635df2c0301a3d773da06ac5a18a7c3e0d09a795d7e57d233edf1"), btcec.S256())
-	keyId2 := btcec.KeyIDFromAddressBuffer([]byte{1, 0, 0, 0})
-	pubKey2, _ := btcec.ParsePubKey(hexToBytes("038ef4a121bcaf1b1f175557a12896f8bc93b095e84817f90e9a901cd2113a8202"), btcec.S256())
-	return map[btcec.KeyID]*btcec.PublicKey{keyId1: pubKey1, keyId2: pubKey2}
+	s.RLock()
+	keyIDs := s.keyIDs.DeepCopy()
+	s.RUnlock()
+	return keyIDs
+}
+
+// AddKeyID provisions the passed keyID for the passed pub key on the fake
+// chain instance.
+func (s *fakeChain) AddKeyID(keyID btcec.KeyID, pubKey *btcec.PublicKey) {
+	s.Lock()
+	s.keyIDs[keyID] = pubKey
+	s.lastKeyID = keyID
+	s.Unlock()
+}
+
+// RevokeKeyID revokes the passed keyID on the fake chain instance.
+func (s *fakeChain) RevokeKeyID(keyID btcec.KeyID) {
+	s.Lock()
+	delete(s.keyIDs, keyID)
+	s.Unlock()
 }
 
 // BestHeight returns the current height associated with the fake chain
@@ -226,9 +267,16 @@ func (p *poolHarness) CreateCoinbaseTx(blockHeight uint32, numOutputs uint32) (*
 // total input amount.  All outputs will be to the payment script associated
 // with the harness and all inputs are assumed to do the same.
 func (p *poolHarness) CreateSignedTx(inputs []spendableOutput, numOutputs uint32) (*provautil.Tx, error) {
-	// Calculate the total input amount and split it amongst the requested
-	// number of outputs.
-	var totalInput provautil.Amount
+	return p.CreateSignedTxWithFee(inputs, numOutputs, 0)
+}
+
+// CreateSignedTxWithFee creates a new signed transaction like CreateSignedTx
+// which pays the passed fee and splits the rest of the total input amount
+// amongst the outputs.
+func (p *poolHarness) CreateSignedTxWithFee(inputs []spendableOutput, numOutputs uint32, fee provautil.Amount) (*provautil.Tx, error) {
+	// Calculate the total input amount less the fee and split it amongst
+	// the requested number of outputs.
+	totalInput := -fee
 	for _, input := range inputs {
 		totalInput += input.amount
 	}
@@ -355,8 +403,20 @@ func newPoolHarness(chainParams *chaincfg.Params) (*poolHarness, []spendableOutp
 		return nil, nil, err
 	}
 
-	// Create a new fake chain and harness bound to it.
-	chain := &fakeChain{utxos: blockchain.NewUtxoViewpoint()}
+	// Create a new fake chain and harness bound to it.  The keyIDs of the
+	// payment address are provisioned for the keys they are signed with.
+	aspKeyId1 := btcec.KeyIDFromAddressBuffer([]byte{0, 0, 1, 0})
+	aspPubKey1, _ := btcec.ParsePubKey(hexToBytes("025ceeba2ab4a635df2c0301a3d773da06ac5a18a7c3e0d09a795d7e57d233edf1"), btcec.S256())
+	aspKeyId2 := btcec.KeyIDFromAddressBuffer([]byte{1, 0, 0, 0})
+	aspPubKey2, _ := btcec.ParsePubKey(hexToBytes("038ef4a121bcaf1b1f175557a12896f8bc93b095e84817f90e9a901cd2113a8202"), btcec.S256())
+	chain := &fakeChain{
+		utxos: blockchain.NewUtxoViewpoint(),
+		keyIDs: btcec.KeyIdMap{
+			aspKeyId1: aspPubKey1,
+			aspKeyId2: aspPubKey2,
+		},
+		adminKeySets: make(map[btcec.KeySetType]btcec.PublicKeySet),
+	}
 	harness := poolHarness{
 		privKey1:    privKey1,
 		privKey2:    privKey2,
@@ -862,3 +922,1119 @@ func TestMultiInputOrphanDoubleSpend(t *testing.T) {
 	// was not moved to the transaction pool.
 	testPoolMembership(tc, doubleSpendTx, false, false)
 }
+
+// TestCheckSpend ensures the transaction in the pool which spends an outpoint
+// is returned by CheckSpend, and that orphans and removed transactions are not.
+func TestCheckSpend(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 2)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	op := outputs[0].outPoint
+	orphanOp := chainedTxns[1].MsgTx().TxIn[0].PreviousOutPoint
+	if tx := harness.txPool.CheckSpend(op); tx != nil {
+		t.Fatalf("CheckSpend: got %v for unspent outpoint", tx.Hash())
+	}
+
+	// Orphans don't spend outpoints of the main pool.
+	_, err = harness.txPool.ProcessTransaction(chainedTxns[1], true, false,
+		0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid orphan %v",
+			err)
+	}
+	if tx := harness.txPool.CheckSpend(orphanOp); tx != nil {
+		t.Fatalf("CheckSpend: got orphan %v", tx.Hash())
+	}
+
+	_, err = harness.txPool.ProcessTransaction(chainedTxns[0], false,
+		false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid tx %v", err)
+	}
+	for i, op := range []wire.OutPoint{op, orphanOp} {
+		tx := harness.txPool.CheckSpend(op)
+		if tx == nil || *tx.Hash() != *chainedTxns[i].Hash() {
+			t.Fatalf("CheckSpend: got %v, want %v", tx,
+				chainedTxns[i].Hash())
+		}
+	}
+
+	harness.txPool.RemoveTransaction(chainedTxns[0], true)
+	if tx := harness.txPool.CheckSpend(op); tx != nil {
+		t.Fatalf("CheckSpend: got removed transaction %v", tx.Hash())
+	}
+}
+
+// TestTxExpiry ensures transactions which have been in the pool longer than the
+// expiry age are evicted along with their descendants, parents first, while
+// admin transactions, prioritised transactions, and the transactions they
+// depend on are kept.
+func TestTxExpiry(t *testing.T) {
+	t.Parallel()
+
+	harness, spendableOuts, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	// Add mature coinbases to the fake chain to provide more spendable
+	// outputs.  Transaction hashes don't commit to signature scripts, so
+	// the lock time is set to make the coinbases unique.
+	harness.chain.SetHeight(harness.chain.BestHeight() + 10)
+	for height := uint32(2); height <= 4; height++ {
+		coinbase, err := harness.CreateCoinbaseTx(height, 1)
+		if err != nil {
+			t.Fatalf("unable to create coinbase: %v", err)
+		}
+		coinbase.MsgTx().LockTime = height
+		coinbase = provautil.NewTx(coinbase.MsgTx())
+		harness.chain.utxos.AddTxOuts(coinbase, height)
+		spendableOuts = append(spendableOuts,
+			txOutToSpendableOut(coinbase, 0))
+	}
+
+	// Use a mocked clock and record the expired transactions.
+	const expiry = time.Hour
+	start := time.Now()
+	now := start
+	var expired []*provautil.Tx
+	mp := harness.txPool
+	mp.now = func() time.Time { return now }
+	mp.cfg.Policy.TxExpiry = expiry
+	mp.cfg.TxExpired = func(txns []*provautil.Tx) {
+		expired = append(expired, txns...)
+	}
+
+	createTxChain := func(out spendableOutput, numTxns uint32) []*provautil.Tx {
+		txns, err := harness.CreateTxChain(out, numTxns)
+		if err != nil {
+			t.Fatalf("unable to create transaction chain: %v", err)
+		}
+		return txns
+	}
+	processTx := func(tx *provautil.Tx) {
+		_, err := mp.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+		}
+	}
+
+	// Add a chain of three transactions a few minutes apart, a chain
+	// whose second transaction is prioritised, a transaction prioritised
+	// before it is added, and an admin transaction.
+	chainA := createTxChain(spendableOuts[0], 3)
+	for _, tx := range chainA {
+		processTx(tx)
+		now = now.Add(time.Minute * 10)
+	}
+	chainB := createTxChain(spendableOuts[1], 2)
+	processTx(chainB[0])
+	processTx(chainB[1])
+	mp.PrioritiseTransaction(chainB[1].Hash(), 0)
+	chainC := createTxChain(spendableOuts[2], 1)
+	mp.PrioritiseTransaction(chainC[0].Hash(), 1000)
+	processTx(chainC[0])
+	adminScript, err := txscript.ProvaThreadScript(provautil.RootThread)
+	if err != nil {
+		t.Fatalf("unable to create admin script: %v", err)
+	}
+	adminMsgTx := wire.NewMsgTx(wire.TxVersion)
+	adminMsgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil))
+	adminMsgTx.AddTxOut(wire.NewTxOut(0, adminScript))
+	adminTx := provautil.NewTx(adminMsgTx)
+	mp.mtx.Lock()
+	mp.pool[*adminTx.Hash()] = &TxDesc{
+		TxDesc: mining.TxDesc{Tx: adminTx, Added: now},
+	}
+	mp.mtx.Unlock()
+
+	// The expiry time of each entry is reported unless it is exempt, and
+	// the fee adjustment of a transaction prioritised before it was added
+	// is applied.
+	entry, err := mp.MempoolEntry(chainA[0].Hash())
+	if err != nil {
+		t.Fatalf("MempoolEntry: unexpected error: %v", err)
+	}
+	if want := start.Add(expiry).Unix(); entry.ExpiryTime != want {
+		t.Fatalf("got expiry time %d, want %d", entry.ExpiryTime, want)
+	}
+	if entry.DescendantCount != 3 || entry.AncestorCount != 1 {
+		t.Fatalf("got %d descendants and %d ancestors, want 3 and 1",
+			entry.DescendantCount, entry.AncestorCount)
+	}
+	for _, tx := range []*provautil.Tx{chainB[1], chainC[0], adminTx} {
+		entry, err := mp.MempoolEntry(tx.Hash())
+		if err != nil {
+			t.Fatalf("MempoolEntry: unexpected error: %v", err)
+		}
+		if entry.ExpiryTime != 0 {
+			t.Fatalf("exempt transaction %v has expiry time %d",
+				tx.Hash(), entry.ExpiryTime)
+		}
+	}
+	entry, err = mp.MempoolEntry(chainC[0].Hash())
+	if err != nil {
+		t.Fatalf("MempoolEntry: unexpected error: %v", err)
+	}
+	if want := provautil.Amount(1000).ToRMG(); entry.ModifiedFee != want {
+		t.Fatalf("got modified fee %v, want %v", entry.ModifiedFee, want)
+	}
+
+	// Process a transaction once only the first transaction of the first
+	// chain expired.  The scan evicts it along with its descendants in
+	// order, and keeps the other transactions.
+	now = start.Add(expiry + time.Minute*5)
+	chainD := createTxChain(spendableOuts[3], 1)
+	processTx(chainD[0])
+	if len(expired) != len(chainA) {
+		t.Fatalf("got %d expired transactions, want %d", len(expired),
+			len(chainA))
+	}
+	for i, tx := range chainA {
+		if *expired[i].Hash() != *tx.Hash() {
+			t.Fatalf("expired transaction %d: got %v, want %v", i,
+				expired[i].Hash(), tx.Hash())
+		}
+		testPoolMembership(tc, tx, false, false)
+	}
+	for _, tx := range []*provautil.Tx{chainB[0], chainB[1], chainC[0],
+		adminTx, chainD[0]} {
+
+		testPoolMembership(tc, tx, false, true)
+	}
+
+	// Once the rest expire, only the transactions which are not exempt
+	// and no exempt transaction depends on are evicted.
+	expired = nil
+	now = now.Add(expiry)
+	chainE := createTxChain(txOutToSpendableOut(chainC[0], 0), 1)
+	processTx(chainE[0])
+	if len(expired) != 1 || *expired[0].Hash() != *chainD[0].Hash() {
+		t.Fatalf("got expired transactions %v, want %v", expired,
+			chainD[0].Hash())
+	}
+	for _, tx := range []*provautil.Tx{chainB[0], chainB[1], chainC[0],
+		adminTx, chainE[0]} {
+
+		testPoolMembership(tc, tx, false, true)
+	}
+}
+
+// TestRevokedKeyDependents ensures that once a block revokes keys, the
+// transactions in the pool which depend on them are re-validated, and the ones
+// which are no longer valid are removed along with their descendants, parents
+// first, while the transactions which remain valid are kept.
+func TestRevokedKeyDependents(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.MainNetParams
+	harness, spendableOuts, err := newPoolHarness(params)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+	mp := harness.txPool
+
+	// Add another mature coinbase to the fake chain to provide another
+	// spendable output.  Transaction hashes don't commit to signature
+	// scripts, so the lock time is set to make the coinbase unique.
+	coinbase, err := harness.CreateCoinbaseTx(2, 1)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	coinbase.MsgTx().LockTime = 2
+	coinbase = provautil.NewTx(coinbase.MsgTx())
+	harness.chain.utxos.AddTxOuts(coinbase, 2)
+	harness.chain.SetHeight(harness.chain.BestHeight() + 1)
+	spendableOuts = append(spendableOuts, txOutToSpendableOut(coinbase, 0))
+
+	// Provision a new ASP key and create an address which depends on it.
+	aspPrivKey, aspPubKey := btcec.PrivKeyFromBytes(btcec.S256(),
+		[]byte{0x01, 0x02, 0x03, 0x04})
+	aspKeyID := btcec.KeyID(3)
+	harness.chain.AddKeyID(aspKeyID, aspPubKey)
+	pkHash := provautil.Hash160(harness.privKey1.PubKey().SerializeCompressed())
+	aspAddr, err := provautil.NewAddressProva(pkHash, []btcec.KeyID{aspKeyID,
+		btcec.KeyIDFromAddressBuffer([]byte{0, 0, 1, 0})}, params)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	aspScript, err := txscript.PayToAddrScript(aspAddr)
+	if err != nil {
+		t.Fatalf("unable to create script: %v", err)
+	}
+
+	// Provision two provision keys which sign admin transactions.
+	provPrivKey1, provPubKey1 := btcec.PrivKeyFromBytes(btcec.S256(),
+		[]byte{0x05, 0x06, 0x07, 0x08})
+	provPrivKey2, provPubKey2 := btcec.PrivKeyFromBytes(btcec.S256(),
+		[]byte{0x09, 0x0a, 0x0b, 0x0c})
+	harness.chain.SetAdminKeySet(btcec.ProvisionKeySet,
+		btcec.PublicKeySet{*provPubKey1, *provPubKey2})
+
+	// createTx returns a transaction which spends the passed output with
+	// the passed previous script using the passed keys, pays its full
+	// amount to the first passed script, and has zero value outputs for
+	// the remaining scripts.
+	createTx := func(input spendableOutput, prevScript []byte, keys []*btcec.PrivateKey, pkScripts ...[]byte) *provautil.Tx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: input.outPoint,
+			Sequence:         wire.MaxTxInSequenceNum,
+		})
+		tx.AddTxOut(wire.NewTxOut(int64(input.amount), pkScripts[0]))
+		for _, pkScript := range pkScripts[1:] {
+			tx.AddTxOut(wire.NewTxOut(0, pkScript))
+		}
+		lookupKey := func(a provautil.Address) ([]txscript.PrivateKey, error) {
+			privKeys := make([]txscript.PrivateKey, 0, len(keys))
+			for _, key := range keys {
+				privKeys = append(privKeys,
+					txscript.PrivateKey{key, true})
+			}
+			return privKeys, nil
+		}
+		sigScript, err := txscript.SignTxOutput(params, tx, 0,
+			int64(input.amount), prevScript, txscript.SigHashAll,
+			txscript.KeyClosure(lookupKey), nil)
+		if err != nil {
+			t.Fatalf("unable to sign transaction: %v", err)
+		}
+		tx.TxIn[0].SignatureScript = sigScript
+		return provautil.NewTx(tx)
+	}
+	processTx := func(tx *provautil.Tx) {
+		_, err := mp.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+		}
+	}
+
+	// Add a transaction which pays to the ASP key, a transaction which
+	// spends its output with a signature by the ASP key, a transaction
+	// which spends that one, and an unrelated transaction.
+	harnessKeys := []*btcec.PrivateKey{harness.privKey1, harness.privKey2}
+	aspKeys := []*btcec.PrivateKey{harness.privKey1, aspPrivKey}
+	payTx := createTx(spendableOuts[0], harness.payScript, harnessKeys,
+		aspScript)
+	spendTx := createTx(txOutToSpendableOut(payTx, 0), aspScript, aspKeys,
+		harness.payScript)
+	childTx := createTx(txOutToSpendableOut(spendTx, 0), harness.payScript,
+		harnessKeys, harness.payScript)
+	unrelatedTx := createTx(spendableOuts[1], harness.payScript,
+		harnessKeys, harness.payScript)
+	for _, tx := range []*provautil.Tx{payTx, spendTx, childTx, unrelatedTx} {
+		processTx(tx)
+	}
+
+	// Add an admin transaction signed by the provision keys which
+	// provisions another ASP key.
+	threadScript, err := txscript.ProvaThreadScript(provautil.ProvisionThread)
+	if err != nil {
+		t.Fatalf("unable to create thread script: %v", err)
+	}
+	threadMsgTx := wire.NewMsgTx(wire.TxVersion)
+	threadMsgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil))
+	threadMsgTx.AddTxOut(wire.NewTxOut(0, threadScript))
+	threadTx := provautil.NewTx(threadMsgTx)
+	harness.chain.utxos.AddTxOuts(threadTx, 1)
+	adminOpScript := func(op byte, pubKey *btcec.PublicKey, keyID btcec.KeyID) []byte {
+		data := make([]byte, 1+btcec.PubKeyBytesLenCompressed)
+		data[0] = op
+		copy(data[1:], pubKey.SerializeCompressed())
+		if op == txscript.AdminOpASPKeyAdd ||
+			op == txscript.AdminOpASPKeyRevoke {
+
+			keyIDBuf := make([]byte, btcec.KeyIDSize)
+			keyID.ToAddressFormat(keyIDBuf)
+			data = append(data, keyIDBuf...)
+		}
+		script, err := txscript.NewScriptBuilder().
+			AddOp(txscript.OP_RETURN).AddData(data).Script()
+		if err != nil {
+			t.Fatalf("unable to create admin op script: %v", err)
+		}
+		return script
+	}
+	adminTx := createTx(txOutToSpendableOut(threadTx, 0), threadScript,
+		[]*btcec.PrivateKey{provPrivKey1, provPrivKey2}, threadScript,
+		adminOpScript(txscript.AdminOpASPKeyAdd, aspPubKey, aspKeyID+1))
+	processTx(adminTx)
+
+	// newBlock returns a block whose admin transaction on the passed thread
+	// carries the passed admin op.
+	newBlock := func(threadID provautil.ThreadID, opScript []byte) *provautil.Block {
+		threadScript, err := txscript.ProvaThreadScript(threadID)
+		if err != nil {
+			t.Fatalf("unable to create thread script: %v", err)
+		}
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 2}, nil))
+		msgTx.AddTxOut(wire.NewTxOut(0, threadScript))
+		msgTx.AddTxOut(wire.NewTxOut(0, opScript))
+		return provautil.NewBlock(&wire.MsgBlock{
+			Transactions: []*wire.MsgTx{coinbase.MsgTx(), msgTx},
+		})
+	}
+	// removeRevoked removes the transactions which depend on the keys
+	// revoked by the passed block and ensures exactly the passed
+	// transactions were removed, in order.
+	allTxns := []*provautil.Tx{payTx, spendTx, childTx, unrelatedTx,
+		adminTx}
+	inPool := make(map[chainhash.Hash]bool)
+	for _, tx := range allTxns {
+		inPool[*tx.Hash()] = true
+	}
+	removeRevoked := func(block *provautil.Block, want []*provautil.Tx) {
+		removed := mp.RemoveRevokedKeyDependents(block)
+		if len(removed) != len(want) {
+			t.Fatalf("removed %d transactions, want %d", len(removed),
+				len(want))
+		}
+		for i, tx := range removed {
+			if *tx.Hash() != *want[i].Hash() {
+				t.Fatalf("removed transaction %d is %v, want %v",
+					i, tx.Hash(), want[i].Hash())
+			}
+			inPool[*tx.Hash()] = false
+		}
+		for _, tx := range allTxns {
+			testPoolMembership(tc, tx, false, inPool[*tx.Hash()])
+		}
+	}
+
+	// Blocks which only add keys don't affect the pool.
+	removeRevoked(newBlock(provautil.ProvisionThread, adminOpScript(
+		txscript.AdminOpASPKeyAdd, aspPubKey, aspKeyID+2)), nil)
+
+	// Revoking a provision key removes the admin transaction signed by it
+	// while the transactions which don't depend on it are kept.
+	harness.chain.SetAdminKeySet(btcec.ProvisionKeySet,
+		btcec.PublicKeySet{*provPubKey1})
+	removeRevoked(newBlock(provautil.RootThread, adminOpScript(
+		txscript.AdminOpProvisionKeyRevoke, provPubKey2, 0)),
+		[]*provautil.Tx{adminTx})
+	if _, ok := mp.keySetIndex[btcec.ProvisionKeySet]; ok {
+		t.Fatal("removed admin transaction is still indexed")
+	}
+
+	// Revoking the ASP key removes the transaction paying to it, the
+	// transaction signed by it, and the transaction which depends on
+	// them, parents first, while the unrelated transaction is kept.
+	harness.chain.RevokeKeyID(aspKeyID)
+	removeRevoked(newBlock(provautil.ProvisionThread, adminOpScript(
+		txscript.AdminOpASPKeyRevoke, aspPubKey, aspKeyID)),
+		[]*provautil.Tx{payTx, spendTx, childTx})
+	testPoolMembership(tc, unrelatedTx, false, true)
+	if _, ok := mp.keyIDIndex[aspKeyID]; ok {
+		t.Fatal("removed transactions are still indexed")
+	}
+	if got := RemovalKeyRevoked.String(); got != "keyrevoked" {
+		t.Fatalf("got removal reason %q, want %q", got, "keyrevoked")
+	}
+}
+
+// TestCanonicalOrderPolicy ensures that when the policy requires the canonical
+// order, transactions whose inputs and outputs are not in that order are
+// rejected as non-standard while sorted transactions and admin transactions,
+// whose order is meaningful, are accepted.
+func TestCanonicalOrderPolicy(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.MainNetParams
+	harness, _, err := newPoolHarness(params)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+	mp := harness.txPool
+	mp.cfg.Policy.RequireCanonicalOrder = true
+	if !mp.Policy().RequireCanonicalOrder {
+		t.Fatal("Policy: canonical order is not required")
+	}
+
+	// signTx signs the single input of the passed transaction, which spends
+	// an output paying to the passed script, with the passed keys.
+	signTx := func(msgTx *wire.MsgTx, amount provautil.Amount, prevScript []byte, keys ...*btcec.PrivateKey) *provautil.Tx {
+		lookupKey := func(a provautil.Address) ([]txscript.PrivateKey, error) {
+			privKeys := make([]txscript.PrivateKey, 0, len(keys))
+			for _, key := range keys {
+				privKeys = append(privKeys,
+					txscript.PrivateKey{key, true})
+			}
+			return privKeys, nil
+		}
+		sigScript, err := txscript.SignTxOutput(params, msgTx, 0,
+			int64(amount), prevScript, txscript.SigHashAll,
+			txscript.KeyClosure(lookupKey), nil)
+		if err != nil {
+			t.Fatalf("unable to sign transaction: %v", err)
+		}
+		msgTx.TxIn[0].SignatureScript = sigScript
+		return provautil.NewTx(msgTx)
+	}
+
+	// A transaction whose outputs are not sorted by amount is rejected as
+	// non-standard.  It spends an output large enough for neither of its
+	// outputs to be dust.
+	fundingMsgTx := wire.NewMsgTx(wire.TxVersion)
+	fundingMsgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 2}, nil))
+	fundingMsgTx.AddTxOut(wire.NewTxOut(1e8, harness.payScript))
+	fundingTx := provautil.NewTx(fundingMsgTx)
+	harness.chain.utxos.AddTxOuts(fundingTx, 1)
+	input := txOutToSpendableOut(fundingTx, 0)
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: input.outPoint,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	smallAmount := int64(input.amount) / 4
+	msgTx.AddTxOut(wire.NewTxOut(int64(input.amount)-smallAmount,
+		harness.payScript))
+	msgTx.AddTxOut(wire.NewTxOut(smallAmount, harness.payScript))
+	unsortedTx := signTx(msgTx.Copy(), input.amount, harness.payScript,
+		harness.privKey1, harness.privKey2)
+	_, err = mp.ProcessTransaction(unsortedTx, false, false, 0)
+	if code, ok := extractRejectCode(err); !ok ||
+		code != wire.RejectNonstandard {
+
+		t.Fatalf("ProcessTransaction: got error %v, want %v", err,
+			wire.RejectNonstandard)
+	}
+	testPoolMembership(tc, unsortedTx, false, false)
+
+	// The same transaction is accepted once it is sorted.
+	provautil.SortTxInputsOutputs(msgTx)
+	sortedTx := signTx(msgTx, input.amount, harness.payScript,
+		harness.privKey1, harness.privKey2)
+	_, err = mp.ProcessTransaction(sortedTx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	testPoolMembership(tc, sortedTx, false, true)
+
+	// An admin transaction which provisions two ASP keys is accepted even
+	// though its admin op outputs are not sorted, since the key IDs they
+	// add have to be in order.
+	provPrivKey1, provPubKey1 := btcec.PrivKeyFromBytes(btcec.S256(),
+		[]byte{0x05, 0x06, 0x07, 0x08})
+	provPrivKey2, provPubKey2 := btcec.PrivKeyFromBytes(btcec.S256(),
+		[]byte{0x09, 0x0a, 0x0b, 0x0c})
+	harness.chain.SetAdminKeySet(btcec.ProvisionKeySet,
+		btcec.PublicKeySet{*provPubKey1, *provPubKey2})
+	_, aspPubKey := btcec.PrivKeyFromBytes(btcec.S256(),
+		[]byte{0x01, 0x02, 0x03, 0x04})
+	harness.chain.AddKeyID(3, aspPubKey)
+	threadScript, err := txscript.ProvaThreadScript(provautil.ProvisionThread)
+	if err != nil {
+		t.Fatalf("unable to create thread script: %v", err)
+	}
+	threadMsgTx := wire.NewMsgTx(wire.TxVersion)
+	threadMsgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil))
+	threadMsgTx.AddTxOut(wire.NewTxOut(0, threadScript))
+	threadTx := provautil.NewTx(threadMsgTx)
+	harness.chain.utxos.AddTxOuts(threadTx, 1)
+	var opScripts [][]byte
+	for i, seed := range []byte{0x0d, 0x0e} {
+		_, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), []byte{seed})
+		data := make([]byte, 1+btcec.PubKeyBytesLenCompressed+
+			btcec.KeyIDSize)
+		data[0] = txscript.AdminOpASPKeyAdd
+		copy(data[1:], pubKey.SerializeCompressed())
+		keyID := harness.chain.LastKeyID() + btcec.KeyID(i+1)
+		keyID.ToAddressFormat(data[1+btcec.PubKeyBytesLenCompressed:])
+		script, err := txscript.NewScriptBuilder().
+			AddOp(txscript.OP_RETURN).AddData(data).Script()
+		if err != nil {
+			t.Fatalf("unable to create admin op script: %v", err)
+		}
+		opScripts = append(opScripts, script)
+	}
+	if bytes.Compare(opScripts[0], opScripts[1]) < 0 {
+		t.Fatal("admin op scripts are unexpectedly sorted")
+	}
+	adminMsgTx := wire.NewMsgTx(wire.TxVersion)
+	adminMsgTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: *threadTx.Hash()},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	adminMsgTx.AddTxOut(wire.NewTxOut(0, threadScript))
+	for _, script := range opScripts {
+		adminMsgTx.AddTxOut(wire.NewTxOut(0, script))
+	}
+	if txsort.IsSorted(adminMsgTx) {
+		t.Fatal("admin transaction is unexpectedly sorted")
+	}
+	adminTx := signTx(adminMsgTx, 0, threadScript, provPrivKey1,
+		provPrivKey2)
+	_, err = mp.ProcessTransaction(adminTx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	testPoolMembership(tc, adminTx, false, true)
+}
+
+// TestScriptVersionPolicy ensures spending an output with a script version
+// reserved for future upgrades is rejected as non-standard even though it is
+// anyone-can-spend in blocks.
+func TestScriptVersionPolicy(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.RegressionNetParams
+	harness, _, err := newPoolHarness(params)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	versionedScript := append([]byte{txscript.OP_1, txscript.OP_DATA_20},
+		make([]byte, 20)...)
+	fundingMsgTx := wire.NewMsgTx(wire.TxVersion)
+	fundingMsgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 3}, nil))
+	fundingMsgTx.AddTxOut(wire.NewTxOut(1e8, versionedScript))
+	fundingTx := provautil.NewTx(fundingMsgTx)
+	harness.chain.utxos.AddTxOuts(fundingTx, 1)
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: *fundingTx.Hash()},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	msgTx.AddTxOut(wire.NewTxOut(1e8-1e5, harness.payScript))
+	tx := provautil.NewTx(msgTx)
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if code, ok := extractRejectCode(err); !ok ||
+		code != wire.RejectNonstandard ||
+		!strings.Contains(err.Error(), "script version") {
+
+		t.Fatalf("ProcessTransaction: got error %v, want %v for the "+
+			"script version", err, wire.RejectNonstandard)
+	}
+	testPoolMembership(tc, tx, false, false)
+}
+
+// TestErrorStats ensures the transactions rejected by the pool are counted by
+// the name of the error code of the chain rule or the reject code of the pool
+// policy they violate.
+func TestErrorStats(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tmpDir, err := ioutil.TempDir("", "mempoolerrorstats")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		harness.chainParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+	stats, err := blockchain.NewErrorStats(db)
+	if err != nil {
+		t.Fatalf("NewErrorStats: unexpected error: %v", err)
+	}
+	harness.txPool.cfg.ErrorStats = stats
+
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 3)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	doubleSpend := chainedTxns[0].MsgTx().Copy()
+	doubleSpend.LockTime++
+	noInputs := wire.NewMsgTx(wire.TxVersion)
+	noInputs.AddTxOut(wire.NewTxOut(1e8, harness.payScript))
+	badVersion := chainedTxns[1].MsgTx().Copy()
+	badVersion.Version = harness.txPool.cfg.Policy.MaxTxVersion + 1
+
+	// Submit an orphan while orphans aren't allowed, a transaction twice,
+	// a double spend of it, a transaction without inputs, and a transaction
+	// with an unsupported version.
+	for _, test := range []struct {
+		tx       *provautil.Tx
+		accepted bool
+	}{
+		{chainedTxns[2], false},
+		{chainedTxns[0], true},
+		{chainedTxns[0], false},
+		{provautil.NewTx(doubleSpend), false},
+		{provautil.NewTx(noInputs), false},
+		{provautil.NewTx(badVersion), false},
+	} {
+		_, err := harness.txPool.ProcessTransaction(test.tx, false, false,
+			0)
+		if (err == nil) != test.accepted {
+			t.Fatalf("ProcessTransaction: unexpected result for "+
+				"transaction %v: %v", test.tx.Hash(), err)
+		}
+	}
+
+	want := []blockchain.ErrorCount{
+		{Level: blockchain.ErrorLevelMempool, Code: "ErrNoTxInputs",
+			Count: 1},
+		{Level: blockchain.ErrorLevelMempool, Code: "REJECT_DUPLICATE",
+			Count: 3},
+		{Level: blockchain.ErrorLevelMempool, Code: "REJECT_NONSTANDARD",
+			Count: 1},
+	}
+	if got := stats.Counts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected counts -- got %v, want %v", got, want)
+	}
+}
+
+// TestExpiryHeight ensures transactions which expire at the next block, or
+// within the expiry margin of it, are not accepted to the pool, and that
+// expiring transactions are removed from the pool along with the transactions
+// which depend on them as blocks are connected.
+func TestExpiryHeight(t *testing.T) {
+	t.Parallel()
+
+	params := chaincfg.RegressionNetParams
+	params.TxExpiry = true
+	harness, _, err := newPoolHarness(&params)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+	mp := harness.txPool
+	mp.cfg.Policy.MaxTxVersion = wire.TxVersionExpiry
+
+	// Fund the transactions from the outputs of a transaction paying to
+	// the harness.
+	const numOutputs = 5
+	fundingMsgTx := wire.NewMsgTx(wire.TxVersion)
+	fundingMsgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 4}, nil))
+	for i := 0; i < numOutputs; i++ {
+		fundingMsgTx.AddTxOut(wire.NewTxOut(1e8, harness.payScript))
+	}
+	fundingTx := provautil.NewTx(fundingMsgTx)
+	harness.chain.utxos.AddTxOuts(fundingTx, 1)
+
+	// createTx returns a signed transaction with the passed version and
+	// expiry which spends the passed output to the harness.
+	createTx := func(input spendableOutput, version int32, expiry uint32) *provautil.Tx {
+		msgTx := wire.NewMsgTx(version)
+		msgTx.Expiry = expiry
+		msgTx.ExpiryEncoding = params.TxExpiry
+		msgTx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: input.outPoint,
+			Sequence:         wire.MaxTxInSequenceNum,
+		})
+		msgTx.AddTxOut(wire.NewTxOut(int64(input.amount),
+			harness.payScript))
+		lookupKey := func(a provautil.Address) ([]txscript.PrivateKey, error) {
+			return []txscript.PrivateKey{
+				txscript.PrivateKey{harness.privKey1, true},
+				txscript.PrivateKey{harness.privKey2, true},
+			}, nil
+		}
+		sigScript, err := txscript.SignTxOutput(&params, msgTx, 0,
+			int64(input.amount), harness.payScript,
+			txscript.SigHashAll, txscript.KeyClosure(lookupKey), nil)
+		if err != nil {
+			t.Fatalf("unable to sign transaction: %v", err)
+		}
+		msgTx.TxIn[0].SignatureScript = sigScript
+		return provautil.NewTx(msgTx)
+	}
+
+	bestHeight := harness.chain.BestHeight()
+	nextHeight := bestHeight + 1
+	tests := []struct {
+		name    string
+		expiry  uint32
+		code    wire.RejectCode
+		chain   bool
+		success bool
+	}{
+		{
+			name:   "expires at next block",
+			expiry: nextHeight,
+			code:   wire.RejectInvalid,
+			chain:  true,
+		},
+		{
+			name:   "expires within margin",
+			expiry: nextHeight + txExpiryMargin,
+			code:   wire.RejectNonstandard,
+		},
+		{
+			name:    "expires after margin",
+			expiry:  nextHeight + txExpiryMargin + 1,
+			success: true,
+		},
+		{
+			name:    "no expiry",
+			expiry:  wire.NoExpiryValue,
+			success: true,
+		},
+	}
+	accepted := make([]*provautil.Tx, 0, len(tests))
+	for i, test := range tests {
+		tx := createTx(txOutToSpendableOut(fundingTx, uint32(i)),
+			wire.TxVersionExpiry, test.expiry)
+		_, err := mp.ProcessTransaction(tx, false, false, 0)
+		if test.success {
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+			testPoolMembership(tc, tx, false, true)
+			accepted = append(accepted, tx)
+			continue
+		}
+
+		code, ok := extractRejectCode(err)
+		if !ok || code != test.code {
+			t.Fatalf("%s: got error %v, want %v", test.name, err,
+				test.code)
+		}
+		if test.chain {
+			rerr, ok := err.(RuleError).Err.(blockchain.RuleError)
+			if !ok || rerr.ErrorCode != blockchain.ErrTxExpired {
+				t.Fatalf("%s: got error %v, want %v", test.name,
+					err, blockchain.ErrTxExpired)
+			}
+		}
+		testPoolMembership(tc, tx, false, false)
+	}
+	expiringTx, noExpiryTx := accepted[0], accepted[1]
+
+	// A transaction of the expiry version which doesn't use the expiry
+	// encoding of the network is rejected.
+	plainTx := createTx(txOutToSpendableOut(fundingTx, 0),
+		wire.TxVersionExpiry, wire.NoExpiryValue)
+	plainTx.MsgTx().ExpiryEncoding = false
+	_, err = mp.ProcessTransaction(plainTx, false, false, 0)
+	cerr, ok := err.(RuleError)
+	if !ok || !blockchain.IsErrorCode(cerr.Err, blockchain.ErrInvalidTx) {
+		t.Fatalf("ProcessTransaction: got error %v, want %v", err,
+			blockchain.ErrInvalidTx)
+	}
+	testPoolMembership(tc, plainTx, false, false)
+
+	// Expiry heights are only serialized by expiry versions, so a
+	// transaction of an earlier version never expires.
+	versionOneTx := createTx(txOutToSpendableOut(fundingTx, numOutputs-1),
+		wire.TxVersion, nextHeight)
+	if versionOneTx.MsgTx().HasExpiry() {
+		t.Fatal("version 1 transaction has an expiry")
+	}
+	_, err = mp.ProcessTransaction(versionOneTx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	testPoolMembership(tc, versionOneTx, false, true)
+
+	// Spend the expiring transaction so its eviction also evicts the
+	// transaction which depends on it.
+	childTx := createTx(txOutToSpendableOut(expiringTx, 0), wire.TxVersion,
+		wire.NoExpiryValue)
+	_, err = mp.ProcessTransaction(childTx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	testPoolMembership(tc, childTx, false, true)
+
+	// Nothing expires within the margin of the block after the best
+	// block.
+	if removed := mp.RemoveExpiringTransactions(bestHeight); len(removed) != 0 {
+		t.Fatalf("RemoveExpiringTransactions: unexpected removed "+
+			"transactions %v", removed)
+	}
+
+	// The expiring transaction is within the margin once the next block is
+	// connected, so it's removed before the transaction spending it.
+	removed := mp.RemoveExpiringTransactions(nextHeight)
+	if len(removed) != 2 || removed[0] != expiringTx ||
+		removed[1] != childTx {
+
+		t.Fatalf("RemoveExpiringTransactions: got removed %v, want "+
+			"%v", removed, []*provautil.Tx{expiringTx, childTx})
+	}
+	testPoolMembership(tc, expiringTx, false, false)
+	testPoolMembership(tc, childTx, false, false)
+	testPoolMembership(tc, noExpiryTx, false, true)
+	testPoolMembership(tc, versionOneTx, false, true)
+}
+
+// TestPackageAcceptance ensures a transaction paying too little fee is accepted
+// along with an orphan spending it which pays enough fee for both, whether the
+// orphan arrives before or after it, and that it is rejected again when the
+// orphan paying for it turns out to be invalid.
+func TestPackageAcceptance(t *testing.T) {
+	t.Parallel()
+
+	// newPackage returns a harness which doesn't relay any transactions
+	// paying too little fee, a parent which spends the spendable output of
+	// the harness without paying a fee, and a child which spends the
+	// output of the parent paying the passed fee.
+	newPackage := func(childFee provautil.Amount) (*poolHarness, *provautil.Tx, *provautil.Tx) {
+		harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("unable to create test pool: %v", err)
+		}
+		harness.txPool.cfg.Policy.FreeTxRelayLimit = 0
+		harness.txPool.cfg.Policy.MinRelayTxFee = 100
+		parent, err := harness.CreateSignedTx(outputs[0:1], 1)
+		if err != nil {
+			t.Fatalf("unable to create parent: %v", err)
+		}
+		child, err := harness.CreateSignedTxWithFee([]spendableOutput{
+			txOutToSpendableOut(parent, 0)}, 1, childFee)
+		if err != nil {
+			t.Fatalf("unable to create child: %v", err)
+		}
+		return harness, parent, child
+	}
+
+	// processTx processes the passed transaction as relayed by a peer and
+	// ensures the hashes of the transactions reported as accepted match
+	// the passed ones and the error has the passed reject code, or is nil
+	// when the code is zero.
+	processTx := func(harness *poolHarness, tx *provautil.Tx, code wire.RejectCode, want ...*provautil.Tx) {
+		_, file, line, _ := runtime.Caller(1)
+		acceptedTxns, err := harness.txPool.ProcessTransaction(tx, true,
+			true, 1)
+		if code == 0 && err != nil {
+			t.Fatalf("%s:%d -- ProcessTransaction: unexpected error: "+
+				"%v", file, line, err)
+		}
+		if code != 0 {
+			gotCode, _ := extractRejectCode(err)
+			if gotCode != code {
+				t.Fatalf("%s:%d -- ProcessTransaction: got error "+
+					"%v, want reject code %v", file, line, err,
+					code)
+			}
+		}
+		if len(acceptedTxns) != len(want) {
+			t.Fatalf("%s:%d -- ProcessTransaction: accepted %d "+
+				"transactions, want %d", file, line,
+				len(acceptedTxns), len(want))
+		}
+		for i, txD := range acceptedTxns {
+			if *txD.Tx.Hash() != *want[i].Hash() {
+				t.Fatalf("%s:%d -- ProcessTransaction: accepted "+
+					"transaction %d is %v, want %v", file, line,
+					i, txD.Tx.Hash(), want[i].Hash())
+			}
+		}
+	}
+
+	// The parent pays too little fee to be accepted on its own.
+	harness, parent, child := newPackage(100)
+	tc := &testContext{t, harness}
+	processTx(harness, parent, wire.RejectInsufficientFee)
+	testPoolMembership(tc, parent, false, false)
+
+	// The held parent is accepted along with a child paying for it which
+	// arrives afterwards.
+	processTx(harness, child, 0, parent, child)
+	testPoolMembership(tc, parent, false, true)
+	testPoolMembership(tc, child, false, true)
+
+	// The parent is accepted along with an orphan child paying for it
+	// which arrived before it.
+	harness, parent, child = newPackage(100)
+	tc = &testContext{t, harness}
+	processTx(harness, child, 0)
+	testPoolMembership(tc, child, true, false)
+	processTx(harness, parent, 0, parent, child)
+	testPoolMembership(tc, parent, false, true)
+	testPoolMembership(tc, child, false, true)
+
+	// A child which pays too little fee for both stays an orphan.
+	harness, parent, child = newPackage(1)
+	tc = &testContext{t, harness}
+	processTx(harness, parent, wire.RejectInsufficientFee)
+	processTx(harness, child, 0)
+	testPoolMembership(tc, parent, false, false)
+	testPoolMembership(tc, child, true, false)
+
+	// The parent is rejected when the orphan child paying for it has an
+	// invalid signature, and the child is removed.
+	harness, parent, child = newPackage(100)
+	tc = &testContext{t, harness}
+	sigScript := child.MsgTx().TxIn[0].SignatureScript
+	sigScript[len(sigScript)-1] ^= 0x01
+	child = provautil.NewTx(child.MsgTx())
+	processTx(harness, child, 0)
+	processTx(harness, parent, wire.RejectInsufficientFee)
+	testPoolMembership(tc, parent, false, false)
+	testPoolMembership(tc, child, false, false)
+}
+
+// TestMempoolSnapshot ensures the sequence number of the pool is incremented
+// each time a transaction is added, removed or prioritised, that snapshots
+// report the relations between the transactions in the pool, and that
+// snapshots taken while transactions are added are consistent with their
+// sequence number.
+func TestMempoolSnapshot(t *testing.T) {
+	t.Parallel()
+
+	harness, spendableOuts, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	txPool := harness.txPool
+
+	const numTxns = 50
+	chainedTxns, err := harness.CreateTxChain(spendableOuts[0], numTxns)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+
+	// Each transaction added increments the sequence number.
+	sequence := txPool.Sequence()
+	for _, tx := range chainedTxns[:3] {
+		_, err := txPool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: unable to accept %v: %v",
+				tx.Hash(), err)
+		}
+		sequence++
+		if got := txPool.Sequence(); got != sequence {
+			t.Fatalf("unexpected sequence %d, want %d", got,
+				sequence)
+		}
+	}
+
+	// The snapshot reports the relations of the chained transactions and
+	// only includes them serialized when requested.
+	snapshot := txPool.Snapshot(false)
+	if snapshot.Sequence != sequence || len(snapshot.Entries) != 3 {
+		t.Fatalf("unexpected snapshot with sequence %d and %d entries",
+			snapshot.Sequence, len(snapshot.Entries))
+	}
+	entries := make(map[chainhash.Hash]SnapshotEntry)
+	for _, entry := range snapshot.Entries {
+		entries[entry.Hash] = entry
+		if entry.RawTx != nil {
+			t.Fatalf("snapshot entry %v includes raw transaction",
+				entry.Hash)
+		}
+	}
+	for i, tx := range chainedTxns[:3] {
+		entry, ok := entries[*tx.Hash()]
+		if !ok {
+			t.Fatalf("transaction %d missing from snapshot", i)
+		}
+		var wantDepends, wantSpentBy []chainhash.Hash
+		if i > 0 {
+			wantDepends = []chainhash.Hash{*chainedTxns[i-1].Hash()}
+		}
+		if i < 2 {
+			wantSpentBy = []chainhash.Hash{*chainedTxns[i+1].Hash()}
+		}
+		if !reflect.DeepEqual(entry.Depends, wantDepends) ||
+			!reflect.DeepEqual(entry.SpentBy, wantSpentBy) {
+
+			t.Fatalf("transaction %d has unexpected relations -- "+
+				"depends %v, spent by %v", i, entry.Depends,
+				entry.SpentBy)
+		}
+		if entry.Size != tx.MsgTx().SerializeSize() {
+			t.Fatalf("transaction %d has unexpected size %d", i,
+				entry.Size)
+		}
+	}
+	for _, entry := range txPool.Snapshot(true).Entries {
+		var buf bytes.Buffer
+		tx, _ := txPool.FetchTransaction(&entry.Hash)
+		if err := tx.MsgTx().Serialize(&buf); err != nil {
+			t.Fatalf("unable to serialize transaction: %v", err)
+		}
+		if !bytes.Equal(entry.RawTx, buf.Bytes()) {
+			t.Fatalf("snapshot entry %v has unexpected raw "+
+				"transaction", entry.Hash)
+		}
+	}
+
+	// Prioritising and removing transactions increment the sequence
+	// number.
+	txPool.PrioritiseTransaction(chainedTxns[2].Hash(), 1000)
+	sequence++
+	if got := txPool.Sequence(); got != sequence {
+		t.Fatalf("unexpected sequence %d after prioritising, want %d",
+			got, sequence)
+	}
+	txPool.RemoveTransaction(chainedTxns[2], true)
+	sequence++
+	if got := txPool.Sequence(); got != sequence {
+		t.Fatalf("unexpected sequence %d after removal, want %d", got,
+			sequence)
+	}
+	_, err = txPool.ProcessTransaction(chainedTxns[2], false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unable to accept %v: %v",
+			chainedTxns[2].Hash(), err)
+	}
+	sequence++
+
+	// Take snapshots while the rest of the chain is added concurrently.
+	// Since transactions are only added, every snapshot must hold one more
+	// transaction per increment of the sequence number, the sequence number
+	// must never decrease, and each snapshot must be a prefix of the chain.
+	baseSequence, baseCount := sequence, 3
+	done := make(chan error)
+	go func() {
+		for _, tx := range chainedTxns[3:] {
+			_, err := txPool.ProcessTransaction(tx, false, false, 0)
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	var lastSequence uint64
+	for finished := false; !finished; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("ProcessTransaction: %v", err)
+			}
+			finished = true
+		default:
+		}
+
+		snapshot := txPool.Snapshot(false)
+		if snapshot.Sequence < lastSequence {
+			t.Fatalf("sequence decreased from %d to %d",
+				lastSequence, snapshot.Sequence)
+		}
+		lastSequence = snapshot.Sequence
+		want := baseCount + int(snapshot.Sequence-baseSequence)
+		if len(snapshot.Entries) != want {
+			t.Fatalf("snapshot with sequence %d has %d entries, "+
+				"want %d", snapshot.Sequence,
+				len(snapshot.Entries), want)
+		}
+		inSnapshot := make(map[chainhash.Hash]struct{})
+		for _, entry := range snapshot.Entries {
+			inSnapshot[entry.Hash] = struct{}{}
+		}
+		for i, tx := range chainedTxns[:want] {
+			if _, ok := inSnapshot[*tx.Hash()]; !ok {
+				t.Fatalf("snapshot with sequence %d misses "+
+					"transaction %d", snapshot.Sequence, i)
+			}
+		}
+	}
+	if lastSequence != baseSequence+numTxns-3 {
+		t.Fatalf("unexpected final sequence %d, want %d", lastSequence,
+			baseSequence+numTxns-3)
+	}
+}
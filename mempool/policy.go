@@ -101,6 +101,18 @@ func checkInputsStandard(tx *provautil.Tx, utxoView *blockchain.UtxoViewpoint) e
 		prevOut := txIn.PreviousOutPoint
 		entry := utxoView.LookupEntry(&prevOut.Hash)
 		originPkScript := entry.PkScriptByIndex(prevOut.Index)
+
+		// Outputs with a script version reserved for future upgrades
+		// are anyone-can-spend until the version is assigned semantics,
+		// so spending them is not standard.
+		version := entry.ScriptVersionByIndex(prevOut.Index)
+		if version > txscript.MaxScriptVersion {
+			str := fmt.Sprintf("transaction input #%d spends an "+
+				"output with unknown script version %d",
+				txInIndex, version)
+			return txRuleError(wire.RejectNonstandard, str)
+		}
+
 		switch txscript.GetScriptClass(originPkScript) {
 		case txscript.ProvaTy:
 			fallthrough
@@ -163,8 +175,16 @@ func checkInputsStandard(tx *provautil.Tx, utxoView *blockchain.UtxoViewpoint) e
 
 // checkPkScriptStandard performs a series of checks on a transaction output
 // script (public key script) to ensure it is a "standard" public key script.
-// A standard public key script is one that is a recognized form.
-func checkPkScriptStandard(pkScript []byte, scriptClass txscript.ScriptClass) error {
+// A standard public key script is one that is a recognized form with a script
+// version which has defined semantics.
+func checkPkScriptStandard(pkScript []byte, version uint16,
+	scriptClass txscript.ScriptClass) error {
+
+	if version > txscript.MaxScriptVersion {
+		str := fmt.Sprintf("unknown script version %d", version)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+
 	switch scriptClass {
 	case txscript.ProvaTy:
 		fallthrough
@@ -173,6 +193,10 @@ func checkPkScriptStandard(pkScript []byte, scriptClass txscript.ScriptClass) er
 	case txscript.ProvaAdminTy:
 		// TODO(prova): apply validation rules here
 		break
+	case txscript.NullDataTy:
+		// Null data outputs, which includes block commitment outputs,
+		// are limited in number by checkTransactionStandard.
+		break
 	case txscript.NonStandardTy:
 		return txRuleError(wire.RejectNonstandard,
 			"non-standard script form")
@@ -320,7 +344,9 @@ func checkTransactionStandard(tx *provautil.Tx, height uint32,
 	hasAdminOut := (threadInt >= 0)
 	for txInIndex, txOut := range msgTx.TxOut {
 		scriptClass := txscript.GetScriptClass(txOut.PkScript)
-		err := checkPkScriptStandard(txOut.PkScript, scriptClass)
+		version := txscript.ScriptVersion(txOut.PkScript)
+		err := checkPkScriptStandard(txOut.PkScript, version,
+			scriptClass)
 		if err != nil {
 			// Attempt to extract a reject code from the error so
 			// it can be retained.  When not possible, fall back to
@@ -396,6 +422,12 @@ func checkTransactionStandard(tx *provautil.Tx, height uint32,
 				// - Key in nulldata script must be valid
 				// - Data in nulldata scripts must match proper form expected for
 				//   the thread
+				// - Ops reserved for later soft forks are not relayed
+				if txscript.IsUpgradableAdminOp(adminOpOut) {
+					str := fmt.Sprintf("admin transaction with admin " +
+						"operation reserved for later soft forks.")
+					return txRuleError(wire.RejectNonstandard, str)
+				}
 				if !txscript.IsValidAdminOp(adminOpOut, threadId) {
 					str := fmt.Sprintf("admin transaction with invalid admin " +
 						"operation found.")
@@ -187,6 +187,12 @@ func TestCheckPkScriptStandard(t *testing.T) {
 				AddData(pubKeys[0]).AddData(pubKeys[1]),
 			false,
 		},
+		{
+			"unknown script version",
+			txscript.NewScriptBuilder().AddOp(txscript.OP_1).
+				AddData(pubKeyHashes[0]),
+			false,
+		},
 	}
 
 	for _, test := range tests {
@@ -197,7 +203,8 @@ func TestCheckPkScriptStandard(t *testing.T) {
 			continue
 		}
 		scriptClass := txscript.GetScriptClass(script)
-		got := checkPkScriptStandard(script, scriptClass)
+		version := txscript.ScriptVersion(script)
+		got := checkPkScriptStandard(script, version, scriptClass)
 		if (test.isStandard && got != nil) ||
 			(!test.isStandard && got == nil) {
 
@@ -312,6 +319,17 @@ func TestCheckTransactionStandard(t *testing.T) {
 		PkScript: dummyPkScript,
 	}
 
+	// Create a block commitment output.
+	commitmentPkScript, err := txscript.BlockCommitmentScript(
+		bytes.Repeat([]byte{0x01}, txscript.BlockCommitmentSize))
+	if err != nil {
+		t.Fatalf("BlockCommitmentScript: unexpected error: %v", err)
+	}
+	commitmentTxOut := wire.TxOut{
+		Value:    0,
+		PkScript: commitmentPkScript,
+	}
+
 	// Create some dummy admin op output.
 	_, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), []byte{
 		0x2b, 0x8c, 0x52, 0xb7, 0x7b, 0x32, 0x7c, 0x75,
@@ -328,6 +346,14 @@ func TestCheckTransactionStandard(t *testing.T) {
 		Value:    0,
 		PkScript: adminOpPkScript,
 	}
+	upgradableData := append([]byte{txscript.AdminOpUpgradableThreshold},
+		data[1:]...)
+	upgradableOpPkScript, _ := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_RETURN).AddData(upgradableData).Script()
+	unknownData := append([]byte{txscript.AdminOpUpgradableThreshold - 1},
+		data[1:]...)
+	unknownOpPkScript, _ := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_RETURN).AddData(unknownData).Script()
 	// create root tx out
 	rootPkScript, _ := txscript.ProvaThreadScript(provautil.RootThread)
 	rootTxOut := wire.TxOut{
@@ -498,6 +524,32 @@ func TestCheckTransactionStandard(t *testing.T) {
 			height:     300000,
 			isStandard: true,
 		},
+		{
+			name: "Block commitment output (standard)",
+			tx: wire.MsgTx{
+				Version:  1,
+				TxIn:     []*wire.TxIn{&dummyTxIn},
+				TxOut:    []*wire.TxOut{&dummyTxOut, &commitmentTxOut},
+				LockTime: 0,
+			},
+			height:     300000,
+			isStandard: true,
+		},
+		{
+			name: "Block commitment and another nulldata output",
+			tx: wire.MsgTx{
+				Version: 1,
+				TxIn:    []*wire.TxIn{&dummyTxIn},
+				TxOut: []*wire.TxOut{&commitmentTxOut, {
+					Value:    0,
+					PkScript: []byte{txscript.OP_RETURN},
+				}},
+				LockTime: 0,
+			},
+			height:     300000,
+			isStandard: false,
+			code:       wire.RejectNonstandard,
+		},
 		{
 			name: "Typical admin transaction",
 			tx: wire.MsgTx{
@@ -587,6 +639,36 @@ func TestCheckTransactionStandard(t *testing.T) {
 			isStandard: false,
 			code:       wire.RejectInvalid,
 		},
+		{
+			name: "Admin transaction with unknown operation",
+			tx: wire.MsgTx{
+				Version: 1,
+				TxIn:    []*wire.TxIn{&dummyTxIn},
+				TxOut: []*wire.TxOut{&rootTxOut, {
+					Value:    0,
+					PkScript: unknownOpPkScript,
+				}},
+				LockTime: 0,
+			},
+			height:     300000,
+			isStandard: false,
+			code:       wire.RejectInvalid,
+		},
+		{
+			name: "Admin transaction with operation reserved for soft forks",
+			tx: wire.MsgTx{
+				Version: 1,
+				TxIn:    []*wire.TxIn{&dummyTxIn},
+				TxOut: []*wire.TxOut{&rootTxOut, {
+					Value:    0,
+					PkScript: upgradableOpPkScript,
+				}},
+				LockTime: 0,
+			},
+			height:     300000,
+			isStandard: false,
+			code:       wire.RejectNonstandard,
+		},
 	}
 
 	pastMedianTime := time.Now()
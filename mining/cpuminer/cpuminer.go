@@ -68,8 +68,9 @@ type Config struct {
 
 	// ProcessBlock defines the function to call with any solved blocks.
 	// It typically must run the provided block through the same set of
-	// rules and handling as any other block coming from the network.
-	ProcessBlock func(*provautil.Block, blockchain.BehaviorFlags) (bool, error)
+	// rules and handling as any other block coming from the network and
+	// report whether the block was already known with its status.
+	ProcessBlock func(*provautil.Block, blockchain.BehaviorFlags) (blockchain.BlockStatus, bool, error)
 
 	// ConnectedCount defines the function to use to obtain how many other
 	// peers the server is connected to.  This is used by the automatic
@@ -107,7 +108,7 @@ type CPUMiner struct {
 	g                 *mining.BlkTmplGenerator
 	cfg               Config
 	numWorkers        uint32
-	validateKeys      []*btcec.PrivateKey
+	signers           []mining.BlockSigner
 	started           bool
 	discreteMining    bool
 	submitBlockLock   sync.Mutex
@@ -184,7 +185,7 @@ func (m *CPUMiner) submitBlock(block *provautil.Block) bool {
 
 	// Process this block using the same rules as blocks coming from other
 	// nodes.  This will in turn relay it to the network like normal.
-	isOrphan, err := m.cfg.ProcessBlock(block, blockchain.BFNone)
+	status, isOrphan, err := m.cfg.ProcessBlock(block, blockchain.BFNone)
 	if err != nil {
 		// Anything other than a rule violation is an unexpected error,
 		// so log that error as an internal error.
@@ -197,6 +198,11 @@ func (m *CPUMiner) submitBlock(block *provautil.Block) bool {
 		log.Debugf("Block submitted via CPU miner rejected: %v", err)
 		return false
 	}
+	if status.IsDuplicate() {
+		log.Debugf("Block submitted via CPU miner is already known "+
+			"(%v)", status)
+		return false
+	}
 	if isOrphan {
 		log.Debugf("Block submitted via CPU miner is an orphan")
 		return false
@@ -219,7 +225,7 @@ func (m *CPUMiner) submitBlock(block *provautil.Block) bool {
 // stale block such as a new block showing up or periodically when there are
 // new transactions and enough time has elapsed without finding a solution.
 func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight uint32,
-	ticker *time.Ticker, validateKey *btcec.PrivateKey,
+	ticker *time.Ticker, signer mining.BlockSigner,
 	quit chan struct{}) bool {
 
 	// Create some convenience variables.
@@ -260,7 +266,14 @@ func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight uint32,
 				return false
 			}
 
-			m.g.UpdateBlockTime(msgBlock, validateKey)
+			// Treat the block as stale when it can't be signed
+			// again so a new template is generated.
+			err := m.g.UpdateBlockTime(msgBlock, signer)
+			if err != nil {
+				log.Errorf("Failed to update block time: %v",
+					err)
+				return false
+			}
 
 		default:
 			// Non-blocking select to fall through
@@ -332,61 +345,68 @@ out:
 		rand.Seed(time.Now().UnixNano())
 		payToAddr := m.cfg.MiningAddrs[rand.Intn(len(m.cfg.MiningAddrs))]
 
-		// Confirm that validate keys are present.
-		if len(m.validateKeys) == 0 {
-			errStr := fmt.Sprintf("Missing validate keys, set via"+
-				" setvalidatekeys or env var %s", validateKeysEnvironmentKey)
-			log.Errorf(errStr)
-			continue
-		}
+		// Blocks are left unsigned when they are accepted on proof of
+		// work alone.
+		var signer mining.BlockSigner
+		if !m.cfg.ChainParams.PowOnly {
+			// Confirm that validate keys are present.
+			signers := m.BlockSigners()
+			if len(signers) == 0 {
+				errStr := fmt.Sprintf("Missing validate keys, set via"+
+					" setvalidatekeys or env var %s", validateKeysEnvironmentKey)
+				log.Errorf(errStr)
+				m.submitBlockLock.Unlock()
+				time.Sleep(time.Second)
+				continue
+			}
 
-		// Check for invalid validate keys and stop generating if there
-		// are any invalid keys detected.
-		invalidValidateKey := m.detectInvalidValidateKey()
-		if invalidValidateKey != nil {
-			str := fmt.Sprintf("invalid validate key %v",
-				invalidValidateKey.SerializeCompressed())
-			log.Errorf(str)
-			m.submitBlockLock.Unlock()
-			time.Sleep(2 * time.Second)
-			continue
-		}
+			// Check for invalid validate keys and stop generating if there
+			// are any invalid keys detected.
+			invalidValidateKey := m.detectInvalidValidateKey()
+			if invalidValidateKey != nil {
+				str := fmt.Sprintf("invalid validate key %v",
+					invalidValidateKey.SerializeCompressed())
+				log.Errorf(str)
+				m.submitBlockLock.Unlock()
+				time.Sleep(2 * time.Second)
+				continue
+			}
 
-		// Pick a validate key to use, absent rate-limited keys.
-		var nonRateLimitedValidateKeys []*btcec.PrivateKey
-		var validateKey *btcec.PrivateKey
-		var validateKeyErr error
-		for _, privKey := range m.validateKeys {
-			var validatePubKey wire.BlockValidatingPubKey
-			copy(validatePubKey[:wire.BlockValidatingPubKeySize], privKey.PubKey().SerializeCompressed()[:wire.BlockValidatingPubKeySize])
-			isRateLimited, validateKeyErr := m.cfg.IsValidateKeyRateLimited(validatePubKey)
-			if validateKeyErr != nil || isRateLimited {
+			// Pick a validate key to use, absent rate-limited keys.
+			var nonRateLimitedSigners []mining.BlockSigner
+			var validateKeyErr error
+			for _, s := range signers {
+				var validatePubKey wire.BlockValidatingPubKey
+				copy(validatePubKey[:wire.BlockValidatingPubKeySize], s.PubKey().SerializeCompressed()[:wire.BlockValidatingPubKeySize])
+				isRateLimited, validateKeyErr := m.cfg.IsValidateKeyRateLimited(validatePubKey)
+				if validateKeyErr != nil || isRateLimited {
+					continue
+				}
+				nonRateLimitedSigners = append(nonRateLimitedSigners, s)
+			}
+			if validateKeyErr != nil {
+				m.submitBlockLock.Unlock()
+				errStr := fmt.Sprintf("Failed checking validate key %v", validateKeyErr)
+				log.Errorf(errStr)
+				time.Sleep(time.Second)
+				continue
+			}
+			if keysCount := len(nonRateLimitedSigners); keysCount > 0 {
+				// Choose a signing key at random.
+				signer = nonRateLimitedSigners[rand.Intn(keysCount)]
+			} else {
+				m.submitBlockLock.Unlock()
+				errStr := fmt.Sprintf("Block generation rate limited.")
+				log.Errorf(errStr)
+				time.Sleep(5 * time.Second)
 				continue
 			}
-			nonRateLimitedValidateKeys = append(nonRateLimitedValidateKeys, privKey)
-		}
-		if validateKeyErr != nil {
-			m.submitBlockLock.Unlock()
-			errStr := fmt.Sprintf("Failed checking validate key %v", validateKeyErr)
-			log.Errorf(errStr)
-			time.Sleep(time.Second)
-			continue
-		}
-		if keysCount := len(nonRateLimitedValidateKeys); keysCount > 0 {
-			// Choose a signing key at random.
-			validateKey = nonRateLimitedValidateKeys[rand.Intn(keysCount)]
-		} else {
-			m.submitBlockLock.Unlock()
-			errStr := fmt.Sprintf("Block generation rate limited.")
-			log.Errorf(errStr)
-			time.Sleep(5 * time.Second)
-			continue
 		}
 
 		// Create a new block template using the available transactions
 		// in the memory pool as a source of transactions to potentially
 		// include in the block.
-		template, err := m.g.NewBlockTemplate(payToAddr, validateKey)
+		template, err := m.g.NewBlockTemplate(payToAddr, signer)
 		m.submitBlockLock.Unlock()
 		if err != nil {
 			errStr := fmt.Sprintf("Failed to create new block "+
@@ -400,7 +420,7 @@ out:
 		// with false when conditions that trigger a stale block, so
 		// a new block template can be generated.  When the return is
 		// true a solution was found, so submit the solved block.
-		if m.solveBlock(template.Block, curHeight+1, ticker, validateKey, quit) {
+		if m.solveBlock(template.Block, curHeight+1, ticker, signer, quit) {
 			block := provautil.NewBlock(template.Block)
 			m.submitBlock(block)
 		}
@@ -415,9 +435,9 @@ out:
 func (m *CPUMiner) detectInvalidValidateKey() *btcec.PublicKey {
 	adminKeySets := m.cfg.AdminKeySets()
 	validateKeySet := adminKeySets[btcec.ValidateKeySet]
-	for _, validateKey := range m.validateKeys {
-		if validateKeySet.Pos(validateKey.PubKey()) == -1 {
-			return validateKey.PubKey()
+	for _, signer := range m.BlockSigners() {
+		if validateKeySet.Pos(signer.PubKey()) == -1 {
+			return signer.PubKey()
 		}
 	}
 	return nil
@@ -493,7 +513,7 @@ func (m *CPUMiner) EstablishValidateKeys() {
 		return
 	}
 	validateKeys := strings.Split(validateKeyValue, ",")
-	validatePrivKeys := make([]*btcec.PrivateKey, len(validateKeys))
+	signers := make([]mining.BlockSigner, len(validateKeys))
 	for i, privKeyStr := range validateKeys {
 		privKeyBytes, err := hex.DecodeString(privKeyStr)
 		if err != nil {
@@ -503,9 +523,9 @@ func (m *CPUMiner) EstablishValidateKeys() {
 			return
 		}
 		privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), privKeyBytes)
-		validatePrivKeys[i] = privKey
+		signers[i] = mining.NewLocalSigner(privKey)
 	}
-	m.validateKeys = validatePrivKeys
+	m.signers = signers
 }
 
 // Start begins the CPU mining process as well as the speed monitor used to
@@ -523,7 +543,7 @@ func (m *CPUMiner) Start() {
 		return
 	}
 
-	if len(m.validateKeys) == 0 {
+	if len(m.signers) == 0 {
 		m.EstablishValidateKeys()
 	}
 
@@ -629,18 +649,30 @@ func (m *CPUMiner) NumWorkers() int32 {
 //
 // This function is safe for concurrent access.
 func (m *CPUMiner) SetValidateKeys(validateKeys []*btcec.PrivateKey) {
+	signers := make([]mining.BlockSigner, len(validateKeys))
+	for i, key := range validateKeys {
+		signers[i] = mining.NewLocalSigner(key)
+	}
+	m.SetBlockSigners(signers)
+}
+
+// SetBlockSigners updates the signers used for signing.  This allows the
+// validate keys to be held outside of the process.
+//
+// This function is safe for concurrent access.
+func (m *CPUMiner) SetBlockSigners(signers []mining.BlockSigner) {
 	m.Lock()
 	defer m.Unlock()
-	m.validateKeys = validateKeys
+	m.signers = signers
 }
 
-// ValidateKeys returns the validate keys set to sign blocks.
+// BlockSigners returns the signers set to sign blocks.
 //
 // This function is safe for concurrent access.
-func (m *CPUMiner) ValidateKeys() []*btcec.PrivateKey {
+func (m *CPUMiner) BlockSigners() []mining.BlockSigner {
 	m.Lock()
 	defer m.Unlock()
-	return m.validateKeys
+	return m.signers
 }
 
 // GenerateNBlocks generates the requested number of blocks. It is self
@@ -696,15 +728,25 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 		rand.Seed(time.Now().UnixNano())
 		payToAddr := m.cfg.MiningAddrs[rand.Intn(len(m.cfg.MiningAddrs))]
 
-		// Choose a validate key at random.
-		validateKeys := m.ValidateKeys()
-		validateKey := validateKeys[rand.Intn(len(validateKeys))]
+		// Choose a validate key at random unless blocks are accepted on
+		// proof of work alone, in which case they are left unsigned.
+		var signer mining.BlockSigner
+		if !m.cfg.ChainParams.PowOnly {
+			signers := m.BlockSigners()
+			signer = signers[rand.Intn(len(signers))]
+		}
 
 		// Create a new block template using the available transactions
 		// in the memory pool as a source of transactions to potentially
-		// include in the block.
-		template, err := m.g.NewBlockTemplate(payToAddr, validateKey)
+		// include in the block.  Give up when the block can't be signed
+		// since retrying would not help.
+		template, err := m.g.NewBlockTemplate(payToAddr, signer)
 		m.submitBlockLock.Unlock()
+		if _, ok := err.(mining.SignError); ok {
+			log.Errorf("Failed to sign new block template: %v", err)
+			m.stopDiscreteMining()
+			return nil, err
+		}
 		if err != nil {
 			errStr := fmt.Sprintf("Failed to create new block "+
 				"template: %v", err)
@@ -716,25 +758,31 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 		// with false when conditions that trigger a stale block, so
 		// a new block template can be generated.  When the return is
 		// true a solution was found, so submit the solved block.
-		if m.solveBlock(template.Block, curHeight+1, ticker, validateKey, nil) {
+		if m.solveBlock(template.Block, curHeight+1, ticker, signer, nil) {
 			block := provautil.NewBlock(template.Block)
 			m.submitBlock(block)
 			blockHashes[i] = block.Hash()
 			i++
 			if i == n {
 				log.Tracef("Generated %d blocks", i)
-				m.Lock()
-				close(m.speedMonitorQuit)
-				m.wg.Wait()
-				m.started = false
-				m.discreteMining = false
-				m.Unlock()
+				m.stopDiscreteMining()
 				return blockHashes, nil
 			}
 		}
 	}
 }
 
+// stopDiscreteMining stops the speed monitor started by GenerateNBlocks and
+// marks the miner as no longer mining.
+func (m *CPUMiner) stopDiscreteMining() {
+	m.Lock()
+	close(m.speedMonitorQuit)
+	m.wg.Wait()
+	m.started = false
+	m.discreteMining = false
+	m.Unlock()
+}
+
 // New returns a new instance of a CPU miner for the provided configuration.
 // Use Start to begin the mining process.  See the documentation for CPUMiner
 // type for more details.
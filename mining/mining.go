@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"container/heap"
 	"encoding/hex"
+	"fmt"
 	"time"
 
 	"github.com/bitgo/prova/blockchain"
@@ -33,10 +34,6 @@ const (
 	// for the updated version.
 	generatedBlockVersion = 4
 
-	// blockHeaderOverhead is the max number of bytes it takes to serialize
-	// a block header and max possible transaction count.
-	blockHeaderOverhead = wire.MaxBlockHeaderPayload + wire.MaxVarIntPayload
-
 	// coinbaseFlags is added to the coinbase script of a generated block
 	// and is used to monitor BIP16 support as well as blocks that are
 	// generated via btcd.
@@ -91,6 +88,7 @@ type txPrioItem struct {
 	priority float64
 	feePerKB int64
 	isAdmin  bool
+	size     uint32
 
 	// dependsOn holds a map of transaction hashes which this one depends
 	// on.  It will only be set when the transaction references other
@@ -99,9 +97,47 @@ type txPrioItem struct {
 	dependsOn map[chainhash.Hash]struct{}
 }
 
-// isAdmin returns whether or not this transaction has an admin txout
+// blockSizer tracks the exact serialized size of a block as transactions are
+// added to it, including the growth of the transaction count varint, without
+// having to serialize the block.
+type blockSizer struct {
+	numTxns  uint64
+	txnsSize uint64
+}
+
+// blockSerializeSize returns the serialized size of a block with the passed
+// number of transactions whose serialized sizes add up to the passed size.
+func blockSerializeSize(numTxns, txnsSize uint64) uint64 {
+	return wire.MaxBlockHeaderPayload +
+		uint64(wire.VarIntSerializeSize(numTxns)) + txnsSize
+}
+
+// size returns the serialized size of the block.
+func (s *blockSizer) size() uint64 {
+	return blockSerializeSize(s.numTxns, s.txnsSize)
+}
+
+// sizeWith returns the serialized size the block would have with an
+// additional transaction of the passed serialized size.
+func (s *blockSizer) sizeWith(txSize uint32) uint64 {
+	return blockSerializeSize(s.numTxns+1, s.txnsSize+uint64(txSize))
+}
+
+// add accounts for an additional transaction of the passed serialized size.
+func (s *blockSizer) add(txSize uint32) {
+	s.numTxns++
+	s.txnsSize += uint64(txSize)
+}
+
+// resize accounts for a transaction already in the block changing its
+// serialized size.
+func (s *blockSizer) resize(oldSize, newSize uint32) {
+	s.txnsSize = s.txnsSize - uint64(oldSize) + uint64(newSize)
+}
+
+// IsAdminTx returns whether or not this transaction has an admin txout
 // scriptpub.
-func isAdmin(msgTx *wire.MsgTx) bool {
+func IsAdminTx(msgTx *wire.MsgTx) bool {
 	for _, txOut := range msgTx.TxOut {
 		pops, err := txscript.ParseScript(txOut.PkScript)
 		if err != nil {
@@ -368,18 +404,46 @@ func MinimumMedianTime(chainState *blockchain.BestState) time.Time {
 	return chainState.MedianTime.Add(time.Second)
 }
 
+// MinimumBlockTime returns the minimum allowed timestamp for a block building
+// on the end of the current best chain.  It is the same as MinimumMedianTime
+// unless the chain requires strictly increasing block timestamps, in which
+// case it is also at least one second after the timestamp of the current best
+// block, or limits how far block timestamps may regress, in which case it is
+// also no further before the latest timestamp of the last several blocks than
+// allowed.
+func MinimumBlockTime(chainState *blockchain.BestState, chainParams *chaincfg.Params) time.Time {
+	minTimestamp := MinimumMedianTime(chainState)
+	if chainParams.StrictMonotonicTime {
+		prevTimestamp := chainState.Timestamp.Add(time.Second)
+		if minTimestamp.Before(prevTimestamp) {
+			minTimestamp = prevTimestamp
+		}
+	}
+	if chainParams.TimeRegressionWindow > 0 {
+		regressionTimestamp := chainState.MaxTime.Add(
+			-chainParams.MaxTimeRegression)
+		if minTimestamp.Before(regressionTimestamp) {
+			minTimestamp = regressionTimestamp
+		}
+	}
+
+	return minTimestamp
+}
+
 // medianAdjustedTime returns the current time adjusted to ensure it is at least
-// one second after the median timestamp of the last several blocks per the
-// chain consensus rules.
-func medianAdjustedTime(chainState *blockchain.BestState, timeSource blockchain.MedianTimeSource) time.Time {
+// the minimum allowed timestamp for a block building on the end of the current
+// best chain per the chain consensus rules.
+func medianAdjustedTime(chainState *blockchain.BestState, chainParams *chaincfg.Params, timeSource blockchain.MedianTimeSource) time.Time {
 	// The timestamp for the block must not be before the median timestamp
-	// of the last several blocks.  Thus, choose the maximum between the
-	// current time and one second after the past median time.  The current
+	// of the last several blocks, nor, when the chain requires it, before
+	// the timestamp of the previous block or too far before the latest
+	// timestamp of the last several blocks.  Thus, choose the maximum
+	// between the current time and the minimum allowed time.  The current
 	// timestamp is truncated to a second boundary before comparison since a
 	// block timestamp does not supported a precision greater than one
 	// second.
 	newTimestamp := timeSource.AdjustedTime()
-	minTimestamp := MinimumMedianTime(chainState)
+	minTimestamp := MinimumBlockTime(chainState, chainParams)
 	if newTimestamp.Before(minTimestamp) {
 		newTimestamp = minTimestamp
 	}
@@ -387,6 +451,12 @@ func medianAdjustedTime(chainState *blockchain.BestState, timeSource blockchain.
 	return newTimestamp
 }
 
+// CommitmentProvider returns the commitment to anchor in the coinbase of a new
+// block template which extends the block with the passed hash at the passed
+// height.  The commitment must be txscript.BlockCommitmentSize bytes.  A nil
+// commitment means the template does not commit to anything.
+type CommitmentProvider func(prevHash *chainhash.Hash, height uint32) ([]byte, error)
+
 // BlkTmplGenerator provides a type that can be used to generate block templates
 // based on a given mining policy and source of transactions to choose from.
 // It also houses additional state required in order to ensure the templates
@@ -402,6 +472,8 @@ type BlkTmplGenerator struct {
 	timeSource  blockchain.MedianTimeSource
 	sigCache    *txscript.SigCache
 	hashCache   *txscript.HashCache
+
+	commitmentProvider CommitmentProvider
 }
 
 // NewBlkTmplGenerator returns a new block template generator for the given
@@ -410,19 +482,24 @@ type BlkTmplGenerator struct {
 // The additional state-related fields are required in order to ensure the
 // templates are built on top of the current best chain and adhere to the
 // consensus rules.
+//
+// The commitment provider is invoked for each new template to obtain the
+// commitment to anchor in its coinbase and may be nil.
 func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 	txSource TxSource, chain *blockchain.BlockChain,
 	timeSource blockchain.MedianTimeSource, sigCache *txscript.SigCache,
-	hashCache *txscript.HashCache) *BlkTmplGenerator {
+	hashCache *txscript.HashCache,
+	commitmentProvider CommitmentProvider) *BlkTmplGenerator {
 
 	return &BlkTmplGenerator{
-		policy:      policy,
-		chainParams: params,
-		txSource:    txSource,
-		chain:       chain,
-		timeSource:  timeSource,
-		sigCache:    sigCache,
-		hashCache:   hashCache,
+		policy:             policy,
+		chainParams:        params,
+		txSource:           txSource,
+		chain:              chain,
+		timeSource:         timeSource,
+		sigCache:           sigCache,
+		hashCache:          hashCache,
+		commitmentProvider: commitmentProvider,
 	}
 }
 
@@ -435,6 +512,10 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 // coinbase which will replace the one generated for the block template.  Thus
 // the need to have configured address can be avoided.
 //
+// The block is signed with the passed signer, which must hold one of the
+// current validate keys, when it is not nil.  Otherwise the block is left
+// unsigned for the caller to sign.
+//
 // The transactions selected and included are prioritized according to several
 // factors.  First, each transaction has a priority calculated based on its
 // value, age of inputs, and size.  Transactions which consist of larger
@@ -464,7 +545,12 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 //
 // Any transactions which would cause the block to exceed the BlockMaxSize
 // policy setting, exceed the maximum allowed signature operations per block, or
-// otherwise cause the block to be invalid are skipped.
+// otherwise cause the block to be invalid are skipped, and no transactions are
+// selected once the block holds the maximum number of transactions of the
+// network.  Since BlockMaxSize is only a soft cap, admin transactions, which
+// are always selected first and can't pay fees, are neither skipped for
+// exceeding it nor for being free, as long as the block stays within the
+// consensus limit.
 //
 // Given the above, a block generated by this function is of the following form:
 //
@@ -488,7 +574,20 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 //  |  transactions (while block size   |   |
 //  |  <= policy.BlockMinSize)          |   |
 //   -----------------------------------  --
-func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress provautil.Address, validateKey *btcec.PrivateKey) (*BlockTemplate, error) {
+func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress provautil.Address, signer BlockSigner) (*BlockTemplate, error) {
+	// Refuse to create a template which would be signed with a key that is
+	// not one of the current validate keys since the resulting block would
+	// be rejected.
+	if signer != nil {
+		validateKeySet := g.chain.AdminKeySets()[btcec.ValidateKeySet]
+		if validateKeySet.Pos(signer.PubKey()) == -1 {
+			return nil, SignError{
+				PubKey:      signer.PubKey(),
+				Description: "public key is not a validate key",
+			}
+		}
+	}
+
 	// Extend the most recently known best block.
 	best := g.chain.BestSnapshot()
 	prevHash := best.Hash
@@ -511,6 +610,22 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress provautil.Address, vali
 	if err != nil {
 		return nil, err
 	}
+
+	// Anchor the commitment from the commitment provider, if any, in an
+	// additional output of the coinbase.
+	if g.commitmentProvider != nil {
+		commitment, err := g.commitmentProvider(prevHash, nextBlockHeight)
+		if err != nil {
+			return nil, err
+		}
+		if commitment != nil {
+			pkScript, err := txscript.BlockCommitmentScript(commitment)
+			if err != nil {
+				return nil, err
+			}
+			coinbaseTx.MsgTx().AddTxOut(wire.NewTxOut(0, pkScript))
+		}
+	}
 	numCoinbaseSigOps := int64(blockchain.CountSigOps(coinbaseTx))
 
 	// Get the current source transactions and create a priority queue to
@@ -559,7 +674,7 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress provautil.Address, vali
 mempoolLoop:
 	for _, txDesc := range sourceTxns {
 		// A block can't have more than one coinbase or contain
-		// non-finalized transactions.
+		// non-finalized or expired transactions.
 		tx := txDesc.Tx
 		if blockchain.IsCoinBase(tx) {
 			log.Tracef("Skipping coinbase tx %s", tx.Hash())
@@ -570,6 +685,10 @@ mempoolLoop:
 			log.Tracef("Skipping non-finalized tx %s", tx.Hash())
 			continue
 		}
+		if blockchain.IsExpiredTx(tx, nextBlockHeight) {
+			log.Tracef("Skipping expired tx %s", tx.Hash())
+			continue
+		}
 
 		// Fetch all of the utxos referenced by the this transaction.
 		// NOTE: This intentionally does not fetch inputs from the
@@ -586,7 +705,10 @@ mempoolLoop:
 		// Setup dependencies for any transactions which reference
 		// other transactions in the mempool so they can be properly
 		// ordered below.
-		prioItem := &txPrioItem{tx: tx}
+		prioItem := &txPrioItem{
+			tx:   tx,
+			size: uint32(tx.MsgTx().SerializeSize()),
+		}
 		for _, txIn := range tx.MsgTx().TxIn {
 			originHash := &txIn.PreviousOutPoint.Hash
 			originIndex := txIn.PreviousOutPoint.Index
@@ -630,7 +752,7 @@ mempoolLoop:
 		// Calculate the fee in Atoms/kB.
 		prioItem.feePerKB = txDesc.FeePerKB
 		prioItem.fee = txDesc.Fee
-		prioItem.isAdmin = isAdmin(tx.MsgTx())
+		prioItem.isAdmin = IsAdminTx(tx.MsgTx())
 
 		// Add the transaction to the priority queue to mark it ready
 		// for inclusion in the block unless it has dependencies.
@@ -647,10 +769,12 @@ mempoolLoop:
 	log.Tracef("Priority queue len %d, dependers len %d",
 		priorityQueue.Len(), len(dependers))
 
-	// The starting block size is the size of the block header plus the max
-	// possible transaction count size, plus the size of the coinbase
-	// transaction.
-	blockSize := blockHeaderOverhead + uint32(coinbaseTx.MsgTx().SerializeSize())
+	// The block starts out with the coinbase transaction.  Its size is
+	// updated as the transactions are added so it always matches the
+	// exact serialized size of the block.
+	var sizer blockSizer
+	coinbaseSize := uint32(coinbaseTx.MsgTx().SerializeSize())
+	sizer.add(coinbaseSize)
 	blockSigOps := numCoinbaseSigOps
 	totalFees := int64(0)
 
@@ -664,12 +788,24 @@ mempoolLoop:
 		// Grab the list of transactions which depend on this one (if any).
 		deps := dependers[*tx.Hash()]
 
-		// Enforce maximum block size.  Also check for overflow.
-		txSize := uint32(tx.MsgTx().SerializeSize())
-		blockPlusTxSize := blockSize + txSize
-		if blockPlusTxSize < blockSize ||
-			blockPlusTxSize >= g.policy.BlockMaxSize {
+		// Stop once the block holds the maximum number of transactions
+		// of the network, since no other transaction fits either.
+		if len(blockTxns) >= g.chainParams.MaxBlockTransactions {
+			log.Tracef("Skipping tx %s and the remaining %d "+
+				"transactions because the block holds the max "+
+				"number of transactions", tx.Hash(),
+				priorityQueue.Len())
+			break
+		}
 
+		// Enforce maximum block size.  Admin transactions may exceed
+		// the soft cap of the policy up to the consensus limit.
+		blockPlusTxSize := sizer.sizeWith(prioItem.size)
+		maxBlockSize := uint64(g.policy.BlockMaxSize)
+		if prioItem.isAdmin {
+			maxBlockSize = wire.MaxBlockPayload
+		}
+		if blockPlusTxSize > maxBlockSize {
 			log.Tracef("Skipping tx %s because it would exceed "+
 				"the max block size", tx.Hash())
 			logSkippedDeps(tx, deps)
@@ -705,10 +841,11 @@ mempoolLoop:
 		}
 
 		// Skip free transactions once the block is larger than the
-		// minimum block size.
-		if sortedByFee &&
+		// minimum block size.  Admin transactions can't pay fees, so
+		// they are never skipped as free.
+		if sortedByFee && !prioItem.isAdmin &&
 			prioItem.feePerKB < int64(g.policy.TxMinFreeFee) &&
-			blockPlusTxSize >= g.policy.BlockMinSize {
+			blockPlusTxSize >= uint64(g.policy.BlockMinSize) {
 
 			log.Tracef("Skipping tx %s with feePerKB %d "+
 				"< TxMinFreeFee %d and block size %d >= "+
@@ -722,7 +859,7 @@ mempoolLoop:
 		// Prioritize by fee per kilobyte once the block is larger than
 		// the priority size or there are no more high-priority
 		// transactions.
-		if !sortedByFee && (blockPlusTxSize >= g.policy.BlockPrioritySize ||
+		if !sortedByFee && (blockPlusTxSize >= uint64(g.policy.BlockPrioritySize) ||
 			prioItem.priority <= MinHighPriority) {
 
 			log.Tracef("Switching to sort by fees per "+
@@ -740,7 +877,7 @@ mempoolLoop:
 			// too low.  Otherwise this transaction will be the
 			// final one in the high-priority section, so just fall
 			// though to the code below so it is added now.
-			if blockPlusTxSize > g.policy.BlockPrioritySize ||
+			if blockPlusTxSize > uint64(g.policy.BlockPrioritySize) ||
 				prioItem.priority < MinHighPriority {
 
 				heap.Push(priorityQueue, prioItem)
@@ -760,7 +897,8 @@ mempoolLoop:
 		}
 
 		// CheckTransactionOutputs checks outputs for state violations.
-		err = blockchain.CheckTransactionOutputs(tx, keyView)
+		err = blockchain.CheckTransactionOutputs(tx, keyView,
+			g.chainParams)
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"CheckTransactionOutputs: %v", tx.Hash(), err)
@@ -769,7 +907,8 @@ mempoolLoop:
 		}
 
 		err = blockchain.ValidateTransactionScripts(tx, blockUtxos, keyView,
-			txscript.StandardVerifyFlags, g.sigCache, g.hashCache)
+			txscript.StandardVerifyFlags, g.sigCache, g.hashCache,
+			g.chain.SigVerifyWorkers())
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"ValidateTransactionScripts: %v", tx.Hash(), err)
@@ -787,7 +926,7 @@ mempoolLoop:
 		// save the fees and signature operation counts to the block
 		// template.
 		blockTxns = append(blockTxns, tx)
-		blockSize += txSize
+		sizer.add(prioItem.size)
 		blockSigOps += numSigOps
 		totalFees += prioItem.fee
 		txFees = append(txFees, prioItem.fee)
@@ -810,31 +949,35 @@ mempoolLoop:
 	}
 
 	// Now that the actual transactions have been selected, update the
-	// block size for the real transaction count and coinbase value with
-	// the total fees accordingly.
-	blockSize -= wire.MaxVarIntPayload -
-		uint32(wire.VarIntSerializeSize(uint64(len(blockTxns))))
+	// coinbase value with the total fees accordingly.  The value is a
+	// fixed size field, so the block size is not affected.
 	coinbaseTx.MsgTx().TxOut[0].Value += totalFees
 	txFees[0] = -totalFees
 
 	// Coinbase transactions that pay out zero value can avoid making new
-	// UTXOs by spending to a nullDataTy.  The header block size must be
-	// updated accordingly.
-	if coinbaseTx.MsgTx().TxOut[0].Value == 0 {
-		cbScriptByteLen := len(coinbaseTx.MsgTx().TxOut[0].PkScript)
-		nullScript, err := txscript.NewScriptBuilder().
-			AddOp(txscript.OP_RETURN).Script()
-		if err != nil {
-			return nil, err
+	// UTXOs by spending to a nullDataTy.  Since only a single null data
+	// output is allowed in the coinbase, the commitment output takes the
+	// place of the payment output when there is one.  The block size must
+	// be updated accordingly.
+	if coinbaseMsgTx := coinbaseTx.MsgTx(); coinbaseMsgTx.TxOut[0].Value == 0 {
+		if len(coinbaseMsgTx.TxOut) > 1 {
+			coinbaseMsgTx.TxOut = coinbaseMsgTx.TxOut[1:]
+		} else {
+			nullScript, err := txscript.NewScriptBuilder().
+				AddOp(txscript.OP_RETURN).Script()
+			if err != nil {
+				return nil, err
+			}
+			coinbaseMsgTx.TxOut[0].PkScript = nullScript
 		}
-		blockSize -= uint32(cbScriptByteLen - len(nullScript))
-		coinbaseTx.MsgTx().TxOut[0].PkScript = nullScript
+		sizer.resize(coinbaseSize, uint32(coinbaseMsgTx.SerializeSize()))
 	}
 
 	// Calculate the required difficulty for the block.  The timestamp
 	// is potentially adjusted to ensure it comes after the median time of
-	// the last several blocks per the chain consensus rules.
-	ts := medianAdjustedTime(best, g.timeSource)
+	// the last several blocks, and the previous block when required, per
+	// the chain consensus rules.
+	ts := medianAdjustedTime(best, g.chainParams, g.timeSource)
 	reqDifficulty, err := g.chain.CalcNextRequiredDifficulty()
 	if err != nil {
 		return nil, err
@@ -850,11 +993,15 @@ mempoolLoop:
 		Timestamp:  ts,
 		Bits:       reqDifficulty,
 		Height:     uint32(nextBlockHeight),
-		Size:       blockSize,
+		Size:       uint32(sizer.size()),
 	}
 
-	// Sign the block
-	msgBlock.Header.Sign(validateKey)
+	// Sign the block when a signer is provided.
+	if signer != nil {
+		if err := signBlockHeader(&msgBlock.Header, signer); err != nil {
+			return nil, err
+		}
+	}
 
 	for _, tx := range blockTxns {
 		if err := msgBlock.AddTransaction(tx.MsgTx()); err != nil {
@@ -862,6 +1009,15 @@ mempoolLoop:
 		}
 	}
 
+	// Ensure the size attested to in the header matches the block since it
+	// would otherwise be rejected.
+	serializedSize := msgBlock.SerializeSize()
+	if uint64(serializedSize) != sizer.size() {
+		return nil, fmt.Errorf("block template size accounting is "+
+			"inconsistent -- serialized size %d, computed size %d",
+			serializedSize, sizer.size())
+	}
+
 	// Finally, perform a full check on the created block against the chain
 	// consensus rules to ensure it properly connects to the current best
 	// chain with no issues.
@@ -873,7 +1029,7 @@ mempoolLoop:
 	log.Debugf("Created new block template (%d transactions, %d in "+
 		"fees, %d signature operations, %d bytes, target difficulty "+
 		"%064x)", len(msgBlock.Transactions), totalFees, blockSigOps,
-		blockSize, blockchain.CompactToBig(msgBlock.Header.Bits))
+		sizer.size(), blockchain.CompactToBig(msgBlock.Header.Bits))
 
 	return &BlockTemplate{
 		Block:           &msgBlock,
@@ -886,21 +1042,26 @@ mempoolLoop:
 
 // UpdateBlockTime updates the timestamp in the header of the passed block to
 // the current time while taking into account the median time of the last
-// several blocks to ensure the new time is after that time per the chain
-// consensus rules.  Finally, it will update the target difficulty if needed
-// based on the new time for the test networks since their target difficulty can
-// change based upon time.
+// several blocks, and the previous block when the chain requires strictly
+// increasing timestamps, to ensure the new time is after those times per the
+// chain consensus rules.  Finally, it will update the target difficulty if
+// needed based on the new time for the test networks since their target
+// difficulty can change based upon time.  The block is signed again with the
+// passed signer when it is not nil.
 func (g *BlkTmplGenerator) UpdateBlockTime(msgBlock *wire.MsgBlock,
-	validateKey *btcec.PrivateKey) error {
+	signer BlockSigner) error {
 
 	// The new timestamp is potentially adjusted to ensure it comes after
-	// the median time of the last several blocks per the chain consensus
-	// rules.
-	newTime := medianAdjustedTime(g.chain.BestSnapshot(), g.timeSource)
+	// the median time of the last several blocks, and the previous block
+	// when required, per the chain consensus rules.
+	newTime := medianAdjustedTime(g.chain.BestSnapshot(), g.chainParams,
+		g.timeSource)
 	msgBlock.Header.Timestamp = newTime
 
 	// Re-sign the block, since we updated the block time
-	msgBlock.Header.Sign(validateKey)
+	if signer != nil {
+		return signBlockHeader(&msgBlock.Header, signer)
+	}
 
 	return nil
 }
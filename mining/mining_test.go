@@ -9,8 +9,13 @@ import (
 	"container/heap"
 	"math/rand"
 	"testing"
+	"time"
 
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
 )
 
 // TestTxFeePrioHeap ensures the priority queue for transaction fees and
@@ -109,3 +114,140 @@ func TestTxFeePrioHeap(t *testing.T) {
 		highest = prioItem
 	}
 }
+
+// sizerTestTx returns a transaction whose signature script is the passed
+// number of bytes.
+func sizerTestTx(scriptLen int) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{}, 0),
+		SignatureScript:  make([]byte, scriptLen),
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxOut(wire.NewTxOut(0, []byte{0x6a}))
+	return tx
+}
+
+// TestBlockSizer ensures the block size accounting used when assembling block
+// templates always matches the serialized size of the block, including when
+// the transaction count varint grows, and that a transaction which brings the
+// block exactly to the maximum size is allowed while one which is a single
+// byte larger is not.
+func TestBlockSizer(t *testing.T) {
+	var msgBlock wire.MsgBlock
+	var sizer blockSizer
+	if size := sizer.size(); size != uint64(msgBlock.SerializeSize()) {
+		t.Fatalf("empty block: got size %d, want %d", size,
+			msgBlock.SerializeSize())
+	}
+
+	// Add enough transactions of varying size to cross the boundaries
+	// where the transaction count varint grows.
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		tx := sizerTestTx(rng.Intn(300))
+		txSize := uint32(tx.SerializeSize())
+		predicted := sizer.sizeWith(txSize)
+		sizer.add(txSize)
+		msgBlock.AddTransaction(tx)
+		want := uint64(msgBlock.SerializeSize())
+		if predicted != want || sizer.size() != want {
+			t.Fatalf("%d transactions: predicted size %d, size %d, "+
+				"want %d", i+1, predicted, sizer.size(), want)
+		}
+	}
+
+	// Resizing the first transaction is reflected in the size.
+	coinbase := msgBlock.Transactions[0]
+	oldSize := uint32(coinbase.SerializeSize())
+	coinbase.TxIn[0].SignatureScript = make([]byte, 1000)
+	sizer.resize(oldSize, uint32(coinbase.SerializeSize()))
+	if size := sizer.size(); size != uint64(msgBlock.SerializeSize()) {
+		t.Fatalf("after resize: got size %d, want %d", size,
+			msgBlock.SerializeSize())
+	}
+
+	// Build a transaction which brings the block exactly to a maximum
+	// block size boundary and ensure it fits while a transaction which is
+	// one byte larger does not.
+	// The signature scripts are long enough that their length varints
+	// don't grow, so the transaction size grows byte for byte with them.
+	maxSize := sizer.size() + 5000
+	base := sizerTestTx(300)
+	fitsLen := 300 + int(maxSize-sizer.sizeWith(uint32(base.SerializeSize())))
+	fits := sizerTestTx(fitsLen)
+	if size := sizer.sizeWith(uint32(fits.SerializeSize())); size != maxSize {
+		t.Fatalf("boundary tx: got size %d, want %d", size, maxSize)
+	}
+	tooBig := sizerTestTx(fitsLen + 1)
+	if size := sizer.sizeWith(uint32(tooBig.SerializeSize())); size <= maxSize {
+		t.Fatalf("oversized tx: got size %d, want > %d", size, maxSize)
+	}
+	sizer.add(uint32(fits.SerializeSize()))
+	msgBlock.AddTransaction(fits)
+	if got := msgBlock.SerializeSize(); uint64(got) != maxSize ||
+		sizer.size() != maxSize {
+
+		t.Fatalf("block at boundary: got size %d, computed %d, want %d",
+			got, sizer.size(), maxSize)
+	}
+}
+
+// TestMinimumBlockTime ensures the minimum timestamp of a block building on the
+// best chain honors the median time, strictly increasing timestamp and time
+// regression rules of the chain.
+func TestMinimumBlockTime(t *testing.T) {
+	base := time.Unix(1490000000, 0)
+	state := &blockchain.BestState{
+		Timestamp:  base.Add(-time.Minute * 3),
+		MedianTime: base.Add(-time.Minute * 10),
+		MaxTime:    base,
+	}
+	tests := []struct {
+		name   string
+		strict bool
+		window int
+		max    time.Duration
+		want   time.Time
+	}{
+		{
+			name: "median time only",
+			want: base.Add(-time.Minute*10 + time.Second),
+		},
+		{
+			name:   "strictly increasing",
+			strict: true,
+			want:   base.Add(-time.Minute*3 + time.Second),
+		},
+		{
+			name:   "time regression",
+			window: 11,
+			max:    time.Minute * 5,
+			want:   base.Add(-time.Minute * 5),
+		},
+		{
+			name:   "time regression below median time",
+			window: 11,
+			max:    time.Minute * 15,
+			want:   base.Add(-time.Minute*10 + time.Second),
+		},
+		{
+			name:   "time regression below previous block",
+			strict: true,
+			window: 11,
+			max:    time.Minute * 5,
+			want:   base.Add(-time.Minute*3 + time.Second),
+		},
+	}
+
+	for _, test := range tests {
+		params := chaincfg.RegressionNetParams
+		params.StrictMonotonicTime = test.strict
+		params.TimeRegressionWindow = test.window
+		params.MaxTimeRegression = test.max
+		got := MinimumBlockTime(state, &params)
+		if !got.Equal(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -16,6 +16,12 @@ const (
 	// contextual transaction information provided in a transaction store
 	// when it has not yet been mined into a block.
 	UnminedHeight = 0x7fffffff
+
+	// DefaultBlockMaxSize is the default maximum size in bytes of generated
+	// block templates.  It is 30% of the consensus limit so the blocks
+	// produced during normal operation propagate quickly, while blocks up
+	// to the consensus limit are still accepted from others.
+	DefaultBlockMaxSize = wire.MaxBlockPayload * 3 / 10
 )
 
 // Policy houses the policy (configuration parameters) which is used to control
@@ -27,7 +33,10 @@ type Policy struct {
 	BlockMinSize uint32
 
 	// BlockMaxSize is the maximum block size in bytes to be used when
-	// generating a block template.
+	// generating a block template.  It is a soft cap below the consensus
+	// limit which is only consulted by the template generation.  Admin
+	// transactions are never excluded by it and may grow the block up to
+	// the consensus limit.
 	BlockMaxSize uint32
 
 	// BlockPrioritySize is the size in bytes for high-priority / low-fee
@@ -0,0 +1,184 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mining
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// DefaultRemoteSignerTimeout is the default amount of time to wait for
+	// a remote signer to sign a block before giving up.
+	DefaultRemoteSignerTimeout = time.Second * 10
+
+	// maxRemoteSignerResponse is the maximum size of a response accepted
+	// from a remote signer.
+	maxRemoteSignerResponse = 4096
+)
+
+// BlockSigner signs blocks with a validate key.  It allows the private key of
+// the validate key to be held outside of the process, such as in a hardware
+// security module.
+type BlockSigner interface {
+	// PubKey returns the public key of the validate key the signer signs
+	// with.
+	PubKey() *btcec.PublicKey
+
+	// SignHeader returns the signature of the passed signing-hash of a
+	// block header.
+	SignHeader(hash []byte) (*btcec.Signature, error)
+}
+
+// SignError identifies a failure to sign a block with a block signer.  It is
+// returned when the public key of the signer is not one of the current
+// validate keys or the signer is unable to produce a valid signature.
+type SignError struct {
+	PubKey      *btcec.PublicKey
+	Description string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e SignError) Error() string {
+	return fmt.Sprintf("block signer %x: %s", e.PubKey.SerializeCompressed(),
+		e.Description)
+}
+
+// signBlockHeader signs the passed block header with the passed signer and
+// ensures the resulting signature is valid for the public key of the signer.
+func signBlockHeader(header *wire.BlockHeader, signer BlockSigner) error {
+	pubKey := signer.PubKey()
+	err := header.SignWith(pubKey, signer.SignHeader)
+	if err != nil {
+		return SignError{PubKey: pubKey, Description: err.Error()}
+	}
+	if !header.Verify(pubKey) {
+		return SignError{
+			PubKey:      pubKey,
+			Description: "signature does not verify",
+		}
+	}
+	return nil
+}
+
+// localSigner is a BlockSigner which signs with a private key held in memory.
+type localSigner struct {
+	key *btcec.PrivateKey
+}
+
+// PubKey returns the public key of the private key the signer signs with.  It
+// is part of the BlockSigner interface implementation.
+func (s *localSigner) PubKey() *btcec.PublicKey {
+	return s.key.PubKey()
+}
+
+// SignHeader signs the passed hash with the private key of the signer.  It is
+// part of the BlockSigner interface implementation.
+func (s *localSigner) SignHeader(hash []byte) (*btcec.Signature, error) {
+	return s.key.Sign(hash)
+}
+
+// NewLocalSigner returns a block signer which signs with the passed private
+// key.
+func NewLocalSigner(key *btcec.PrivateKey) BlockSigner {
+	return &localSigner{key: key}
+}
+
+// remoteSignRequest is the JSON request sent to a remote signer.  The public
+// key identifies the validate key to sign with since a remote signer may hold
+// more than one.
+type remoteSignRequest struct {
+	PubKey string `json:"pubkey"`
+	Hash   string `json:"hash"`
+}
+
+// remoteSignResponse is the JSON response returned by a remote signer.  The
+// signature is hex-encoded in DER format.
+type remoteSignResponse struct {
+	Signature string `json:"signature"`
+}
+
+// RemoteSigner is a BlockSigner which requests signatures from a remote signing
+// service over HTTP.  Each signature is requested by POSTing a JSON object with
+// the hex-encoded compressed public key of the validate key and the hash to
+// sign to the URL of the service, which responds with a JSON object containing
+// the hex-encoded DER signature.
+type RemoteSigner struct {
+	url    string
+	pubKey *btcec.PublicKey
+	client *http.Client
+}
+
+// Ensure RemoteSigner implements the BlockSigner interface.
+var _ BlockSigner = (*RemoteSigner)(nil)
+
+// NewRemoteSigner returns a block signer which requests signatures with the
+// validate key for the passed public key from the signing service at the
+// passed URL.  Requests which do not complete within the passed timeout fail.
+func NewRemoteSigner(url string, pubKey *btcec.PublicKey, timeout time.Duration) *RemoteSigner {
+	return &RemoteSigner{
+		url:    url,
+		pubKey: pubKey,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// PubKey returns the public key of the validate key the signer signs with.  It
+// is part of the BlockSigner interface implementation.
+func (s *RemoteSigner) PubKey() *btcec.PublicKey {
+	return s.pubKey
+}
+
+// SignHeader requests the signature of the passed hash from the remote signing
+// service.  It is part of the BlockSigner interface implementation.
+func (s *RemoteSigner) SignHeader(hash []byte) (*btcec.Signature, error) {
+	reqBody, err := json.Marshal(&remoteSignRequest{
+		PubKey: hex.EncodeToString(s.pubKey.SerializeCompressed()),
+		Hash:   hex.EncodeToString(hash),
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Post(s.url, "application/json",
+		bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body,
+		maxRemoteSignerResponse))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("remote signer responded with status %s",
+			resp.Status)
+	}
+
+	var signResp remoteSignResponse
+	if err := json.Unmarshal(respBody, &signResp); err != nil {
+		return nil, fmt.Errorf("malformed remote signer response: %v",
+			err)
+	}
+	sigBytes, err := hex.DecodeString(signResp.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("malformed remote signer signature: %v",
+			err)
+	}
+	if len(sigBytes) > wire.BlockSignatureSize {
+		return nil, errors.New("remote signer signature is too long")
+	}
+	return btcec.ParseDERSignature(sigBytes, btcec.S256())
+}
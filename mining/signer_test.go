@@ -0,0 +1,166 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mining
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/wire"
+)
+
+// mockSigner is a BlockSigner which claims the public key of one private key
+// while signing with another, and optionally fails to sign.
+type mockSigner struct {
+	pubKey  *btcec.PublicKey
+	signKey *btcec.PrivateKey
+	err     error
+}
+
+// PubKey returns the public key the signer claims to sign with.  It is part of
+// the BlockSigner interface implementation.
+func (s *mockSigner) PubKey() *btcec.PublicKey {
+	return s.pubKey
+}
+
+// SignHeader signs the passed hash with the signing key of the signer unless it
+// is configured to fail.  It is part of the BlockSigner interface
+// implementation.
+func (s *mockSigner) SignHeader(hash []byte) (*btcec.Signature, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.signKey.Sign(hash)
+}
+
+// newTestKey returns a new private key or fails the test.
+func newTestKey(t *testing.T) *btcec.PrivateKey {
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to create key: %v", err)
+	}
+	return key
+}
+
+// TestSignBlockHeader ensures block headers are signed with block signers and
+// that signatures which don't match the public key of the signer are rejected.
+func TestSignBlockHeader(t *testing.T) {
+	key := newTestKey(t)
+	otherKey := newTestKey(t)
+
+	tests := []struct {
+		name    string
+		signer  BlockSigner
+		wantErr bool
+	}{
+		{
+			name:   "local signer",
+			signer: NewLocalSigner(key),
+		},
+		{
+			name:   "mock signer",
+			signer: &mockSigner{pubKey: key.PubKey(), signKey: key},
+		},
+		{
+			name:    "wrong key",
+			signer:  &mockSigner{pubKey: key.PubKey(), signKey: otherKey},
+			wantErr: true,
+		},
+		{
+			name: "signer failure",
+			signer: &mockSigner{pubKey: key.PubKey(), signKey: key,
+				err: errors.New("device unavailable")},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		var header wire.BlockHeader
+		err := signBlockHeader(&header, test.signer)
+		if test.wantErr {
+			if _, ok := err.(SignError); !ok {
+				t.Errorf("%s: got error %v, want SignError",
+					test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !header.Verify(key.PubKey()) {
+			t.Errorf("%s: signature does not verify", test.name)
+		}
+	}
+}
+
+// TestRemoteSigner ensures the remote signer requests signatures from the
+// signing service and gives up on services which don't respond in time.
+func TestRemoteSigner(t *testing.T) {
+	key := newTestKey(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+
+		var req remoteSignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch req.PubKey {
+		case hex.EncodeToString(key.PubKey().SerializeCompressed()):
+		case "":
+			http.Error(w, "missing pubkey", http.StatusBadRequest)
+			return
+		default:
+			// Hang on requests for other keys to simulate an
+			// unresponsive signer.
+			<-r.Context().Done()
+			return
+		}
+		hash, err := hex.DecodeString(req.Hash)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sig, err := key.Sign(hash)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&remoteSignResponse{
+			Signature: hex.EncodeToString(sig.Serialize()),
+		})
+	}))
+	defer server.Close()
+
+	// Signatures are obtained from the service.
+	var header wire.BlockHeader
+	signer := NewRemoteSigner(server.URL, key.PubKey(), time.Second*5)
+	if err := signBlockHeader(&header, signer); err != nil {
+		t.Fatalf("signBlockHeader: unexpected error: %v", err)
+	}
+	if !header.Verify(key.PubKey()) {
+		t.Fatalf("signBlockHeader: signature does not verify")
+	}
+
+	// Requests time out when the service does not respond.
+	otherKey := newTestKey(t)
+	signer = NewRemoteSigner(server.URL, otherKey.PubKey(),
+		time.Millisecond*100)
+	start := time.Now()
+	err := signBlockHeader(&header, signer)
+	if _, ok := err.(SignError); !ok {
+		t.Fatalf("signBlockHeader: got error %v, want SignError", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second*5 {
+		t.Fatalf("signBlockHeader: took %v to time out", elapsed)
+	}
+}
@@ -17,7 +17,9 @@ var activeNetParams = &mainNetParams
 // network and test networks.
 type params struct {
 	*chaincfg.Params
-	rpcPort string
+	rpcPort   string
+	grpcPort  string
+	debugPort string
 }
 
 // mainNetParams contains parameters specific to the main network
@@ -27,8 +29,10 @@ type params struct {
 // it does not handle on to btcd.  This approach allows the wallet process
 // to emulate the full reference implementation RPC API.
 var mainNetParams = params{
-	Params:  &chaincfg.MainNetParams,
-	rpcPort: "8334",
+	Params:    &chaincfg.MainNetParams,
+	rpcPort:   "8334",
+	grpcPort:  "8335",
+	debugPort: "8336",
 }
 
 // regressionNetParams contains parameters specific to the regression test
@@ -36,20 +40,26 @@ var mainNetParams = params{
 // than the reference implementation - see the mainNetParams comment for
 // details.
 var regressionNetParams = params{
-	Params:  &chaincfg.RegressionNetParams,
-	rpcPort: "18334",
+	Params:    &chaincfg.RegressionNetParams,
+	rpcPort:   "18334",
+	grpcPort:  "18335",
+	debugPort: "18336",
 }
 
 // testNetParams contains parameters specific to the test network
 // (wire.TestNet).
 var testNetParams = params{
-	Params:  &chaincfg.TestNetParams,
-	rpcPort: "18334",
+	Params:    &chaincfg.TestNetParams,
+	rpcPort:   "18334",
+	grpcPort:  "18335",
+	debugPort: "18336",
 }
 
 // simNetParams contains parameters specific to the simulation test network
 // (wire.SimNet).
 var simNetParams = params{
-	Params:  &chaincfg.SimNetParams,
-	rpcPort: "18556",
+	Params:    &chaincfg.SimNetParams,
+	rpcPort:   "18556",
+	grpcPort:  "18557",
+	debugPort: "18558",
 }
@@ -0,0 +1,430 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// captureVersion is the version of the capture file format.
+	captureVersion = 1
+
+	// captureFileHeaderSize is the size of the header at the start of each
+	// capture file: the magic, the format version, and the network.
+	captureFileHeaderSize = 12
+
+	// captureRecordHeaderSize is the size of the header of each captured
+	// message: the timestamp, the direction, the protocol version, and the
+	// length of the raw message.
+	captureRecordHeaderSize = 17
+
+	// DefaultCaptureQueueSize is the default number of messages waiting to
+	// be written to a capture file before further messages are dropped.
+	DefaultCaptureQueueSize = 1000
+)
+
+// captureMagic identifies capture files.
+var captureMagic = [4]byte{'P', 'R', 'V', 'C'}
+
+// CaptureDirection indicates whether a captured message was received from or
+// sent to the peer.
+type CaptureDirection uint8
+
+// These constants define the directions of captured messages.
+const (
+	// CaptureInbound indicates the message was received from the peer.
+	CaptureInbound CaptureDirection = 1
+
+	// CaptureOutbound indicates the message was sent to the peer.
+	CaptureOutbound CaptureDirection = 2
+)
+
+// String returns the CaptureDirection in human-readable form.
+func (d CaptureDirection) String() string {
+	switch d {
+	case CaptureInbound:
+		return "inbound"
+	case CaptureOutbound:
+		return "outbound"
+	}
+	return fmt.Sprintf("Unknown CaptureDirection (%d)", uint8(d))
+}
+
+// CaptureConfig is the configuration of a MessageCapture.
+type CaptureConfig struct {
+	// Dir is the directory the capture files are written to.  It is
+	// created when it doesn't exist.
+	Dir string
+
+	// Prefix is the prefix of the names of the capture files.  The files
+	// are named by appending a sequence number and the .cap extension to
+	// it.
+	Prefix string
+
+	// MaxFileSize is the size in bytes after which the capture moves on to
+	// a new file.  Zero means the capture is written to a single file.
+	MaxFileSize int64
+
+	// MaxFiles is the number of most recent capture files which are kept.
+	// Older files are removed when the capture moves on to a new file.
+	// Zero means all of the files are kept.
+	MaxFiles int
+
+	// QueueSize is the number of messages waiting to be written before
+	// further messages are dropped.  DefaultCaptureQueueSize is used when
+	// it is zero.
+	QueueSize int
+
+	// Net is the network the captured messages belong to.
+	Net wire.BitcoinNet
+}
+
+// captureRecord is a message waiting to be written to a capture file.
+type captureRecord struct {
+	time      time.Time
+	direction CaptureDirection
+	pver      uint32
+	raw       []byte
+}
+
+// MessageCapture writes the raw wire messages exchanged with a peer to
+// size-capped, rotating capture files along with the time and direction of
+// each message.  Messages are queued and written by a separate goroutine so
+// capturing never blocks the peer.  Messages which don't fit in the queue are
+// dropped and counted instead.
+//
+// A capture is attached to a peer with SetCapture.  The capture files can be
+// read back with ReadCapture and ReadCaptureFile.
+type MessageCapture struct {
+	dropped uint64 // atomic
+	closed  int32  // atomic
+
+	cfg   CaptureConfig
+	queue chan *captureRecord
+
+	// The following fields are only accessed by the writer goroutine after
+	// the capture is created.
+	seq  int
+	file *os.File
+	w    *bufio.Writer
+	size int64
+	err  error
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// NewMessageCapture returns a new message capture which writes to the capture
+// files described by the passed configuration.  The first capture file is
+// created right away so configuration errors are reported to the caller.
+func NewMessageCapture(cfg *CaptureConfig) (*MessageCapture, error) {
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, err
+	}
+	queueSize := cfg.QueueSize
+	if queueSize == 0 {
+		queueSize = DefaultCaptureQueueSize
+	}
+	c := &MessageCapture{
+		cfg:   *cfg,
+		queue: make(chan *captureRecord, queueSize),
+		quit:  make(chan struct{}),
+	}
+	if err := c.rotate(); err != nil {
+		return nil, err
+	}
+
+	c.wg.Add(1)
+	go c.writeHandler()
+	return c, nil
+}
+
+// capturePath returns the path of the capture file with the passed sequence
+// number.
+func (c *MessageCapture) capturePath(seq int) string {
+	name := fmt.Sprintf("%s-%d.cap", c.cfg.Prefix, seq)
+	return filepath.Join(c.cfg.Dir, name)
+}
+
+// Prefix returns the path prefix of the capture files.  The capture files are
+// named by appending a sequence number and the .cap extension to it.
+//
+// This function is safe for concurrent access.
+func (c *MessageCapture) Prefix() string {
+	return filepath.Join(c.cfg.Dir, c.cfg.Prefix)
+}
+
+// rotate closes the current capture file, when any, and moves on to a new one,
+// removing the capture files beyond the configured number of files.
+func (c *MessageCapture) rotate() error {
+	if c.file != nil {
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+		if err := c.file.Close(); err != nil {
+			return err
+		}
+		c.file = nil
+	}
+
+	c.seq++
+	if c.cfg.MaxFiles > 0 && c.seq > c.cfg.MaxFiles {
+		os.Remove(c.capturePath(c.seq - c.cfg.MaxFiles))
+	}
+	f, err := os.OpenFile(c.capturePath(c.seq),
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	var header [captureFileHeaderSize]byte
+	copy(header[:4], captureMagic[:])
+	binary.LittleEndian.PutUint32(header[4:8], captureVersion)
+	binary.LittleEndian.PutUint32(header[8:12], uint32(c.cfg.Net))
+	if _, err := f.Write(header[:]); err != nil {
+		f.Close()
+		return err
+	}
+	c.file = f
+	c.w = bufio.NewWriter(f)
+	c.size = captureFileHeaderSize
+	return nil
+}
+
+// write writes the passed record to the current capture file, moving on to a
+// new file first when the record doesn't fit in the current one.
+func (c *MessageCapture) write(r *captureRecord) error {
+	recordSize := int64(captureRecordHeaderSize + len(r.raw))
+	if c.cfg.MaxFileSize > 0 && c.size > captureFileHeaderSize &&
+		c.size+recordSize > c.cfg.MaxFileSize {
+
+		if err := c.rotate(); err != nil {
+			return err
+		}
+	}
+
+	var header [captureRecordHeaderSize]byte
+	binary.LittleEndian.PutUint64(header[0:8], uint64(r.time.UnixNano()))
+	header[8] = byte(r.direction)
+	binary.LittleEndian.PutUint32(header[9:13], r.pver)
+	binary.LittleEndian.PutUint32(header[13:17], uint32(len(r.raw)))
+	if _, err := c.w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := c.w.Write(r.raw); err != nil {
+		return err
+	}
+	c.size += recordSize
+	return nil
+}
+
+// writeHandler writes the queued messages to the capture files until the
+// capture is closed.  The file is flushed whenever the queue is empty so the
+// capture can be read while it is still being written.  It must be run as a
+// goroutine.
+func (c *MessageCapture) writeHandler() {
+	// handle writes the passed record unless writing already failed, in
+	// which case the remaining messages are dropped.
+	handle := func(r *captureRecord) {
+		if c.err == nil {
+			c.err = c.write(r)
+		}
+		if c.err != nil {
+			atomic.AddUint64(&c.dropped, 1)
+			return
+		}
+		if len(c.queue) == 0 {
+			c.err = c.w.Flush()
+		}
+	}
+
+out:
+	for {
+		select {
+		case r := <-c.queue:
+			handle(r)
+
+		case <-c.quit:
+			break out
+		}
+	}
+
+	// Write the messages which were queued before the capture was closed.
+cleanup:
+	for {
+		select {
+		case r := <-c.queue:
+			handle(r)
+		default:
+			break cleanup
+		}
+	}
+
+	if c.err == nil {
+		c.err = c.w.Flush()
+	}
+	if err := c.file.Close(); c.err == nil {
+		c.err = err
+	}
+	c.wg.Done()
+}
+
+// Record queues the passed raw message for writing to the capture file.  The
+// message is dropped when the queue is full or the capture is closed.
+//
+// This function is safe for concurrent access.
+func (c *MessageCapture) Record(direction CaptureDirection, pver uint32, raw []byte) {
+	if atomic.LoadInt32(&c.closed) != 0 {
+		atomic.AddUint64(&c.dropped, 1)
+		return
+	}
+
+	r := &captureRecord{
+		time:      time.Now(),
+		direction: direction,
+		pver:      pver,
+		raw:       raw,
+	}
+	select {
+	case c.queue <- r:
+	default:
+		atomic.AddUint64(&c.dropped, 1)
+	}
+}
+
+// Dropped returns the number of messages which were dropped rather than
+// written to the capture files.
+//
+// This function is safe for concurrent access.
+func (c *MessageCapture) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// Close writes the queued messages and closes the capture file.  It returns
+// the first error writing the capture files, if any.
+func (c *MessageCapture) Close() error {
+	if atomic.AddInt32(&c.closed, 1) != 1 {
+		return nil
+	}
+
+	close(c.quit)
+	c.wg.Wait()
+	return c.err
+}
+
+// CapturedMessage is a message read from a capture file.
+type CapturedMessage struct {
+	// Time is the time the message was received or sent.
+	Time time.Time
+
+	// Direction indicates whether the message was received from or sent
+	// to the peer.
+	Direction CaptureDirection
+
+	// ProtocolVersion is the protocol version negotiated with the peer
+	// when the message was captured, along with the transaction encoding
+	// flags of the chain, such as wire.TxExpiryEncoding, so the message is
+	// decoded the same way it was read or written.
+	ProtocolVersion uint32
+
+	// Raw is the raw wire message, including its header.  Messages which
+	// failed to be read from the peer are captured as far as they were
+	// read.
+	Raw []byte
+
+	// Msg is the decoded message.  It is nil when the raw message could
+	// not be decoded.
+	Msg wire.Message
+
+	// Err is the error decoding the raw message, if any.
+	Err error
+}
+
+// ErrMalformedCapture is returned when reading a capture file which is not in
+// the capture file format.
+var ErrMalformedCapture = errors.New("malformed capture file")
+
+// ReadCapture reads the captured messages from the passed reader, which holds
+// the contents of a capture file, and invokes the passed function with each of
+// them in order.  Reading stops when the function returns an error, which is
+// then returned.  Messages which can't be decoded are passed to the function
+// with their decoding error rather than stopping the reading.
+func ReadCapture(r io.Reader, fn func(*CapturedMessage) error) error {
+	var header [captureFileHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return ErrMalformedCapture
+	}
+	if !bytes.Equal(header[:4], captureMagic[:]) ||
+		binary.LittleEndian.Uint32(header[4:8]) != captureVersion {
+
+		return ErrMalformedCapture
+	}
+	net := wire.BitcoinNet(binary.LittleEndian.Uint32(header[8:12]))
+
+	br := bufio.NewReader(r)
+	for {
+		var recordHeader [captureRecordHeaderSize]byte
+		_, err := io.ReadFull(br, recordHeader[:])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return ErrMalformedCapture
+		}
+		length := binary.LittleEndian.Uint32(recordHeader[13:17])
+		if length > wire.MessageHeaderSize+wire.MaxMessagePayload {
+			return ErrMalformedCapture
+		}
+		raw := make([]byte, length)
+		if _, err := io.ReadFull(br, raw); err != nil {
+			return ErrMalformedCapture
+		}
+
+		m := &CapturedMessage{
+			Time: time.Unix(0, int64(binary.LittleEndian.Uint64(
+				recordHeader[0:8]))),
+			Direction:       CaptureDirection(recordHeader[8]),
+			ProtocolVersion: binary.LittleEndian.Uint32(recordHeader[9:13]),
+			Raw:             raw,
+		}
+
+		// The peer may have allowed larger payloads than the default
+		// limit of the command, so only the overall limit is applied.
+		var limits map[string]uint32
+		if len(raw) >= wire.MessageHeaderSize {
+			command := string(bytes.TrimRight(raw[4:4+wire.CommandSize],
+				"\x00"))
+			limits = map[string]uint32{command: wire.MaxMessagePayload}
+		}
+		_, m.Msg, _, m.Err = wire.ReadMessageWithLimitsN(
+			bytes.NewReader(raw), m.ProtocolVersion, net, limits)
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadCaptureFile reads the captured messages from the capture file at the
+// passed path the same as ReadCapture.
+func ReadCaptureFile(path string, fn func(*CapturedMessage) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return ReadCapture(f, fn)
+}
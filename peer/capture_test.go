@@ -0,0 +1,218 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/peer"
+	"github.com/bitgo/prova/wire"
+)
+
+// readCapture returns the messages of the capture file at the passed path.
+func readCapture(t *testing.T, path string) []*peer.CapturedMessage {
+	var msgs []*peer.CapturedMessage
+	err := peer.ReadCaptureFile(path, func(m *peer.CapturedMessage) error {
+		msgs = append(msgs, m)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadCaptureFile %s: unexpected error: %v", path, err)
+	}
+	return msgs
+}
+
+// TestPeerCapture ensures the messages exchanged with a peer are captured in
+// both directions while the capture is set.
+func TestPeerCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peercapture")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Wait for the inbound peer to receive and write a verack, which
+	// happens after the messages are captured.
+	verack := make(chan struct{}, 2)
+	peerCfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				if p.Inbound() {
+					verack <- struct{}{}
+				}
+			},
+			OnWrite: func(p *peer.Peer, bytesWritten int, msg wire.Message, err error) {
+				if p.Inbound() && msg.Command() == wire.CmdVerAck {
+					verack <- struct{}{}
+				}
+			},
+		},
+		UserAgentName:    "peer",
+		UserAgentVersion: "1.0",
+		ChainParams:      &chaincfg.MainNetParams,
+		Services:         0,
+	}
+	inConn, outConn := pipe(
+		&conn{raddr: "10.0.0.1:8333"},
+		&conn{raddr: "10.0.0.2:8333"},
+	)
+	inPeer := peer.NewInboundPeer(peerCfg)
+	capture, err := peer.NewMessageCapture(&peer.CaptureConfig{
+		Dir:    dir,
+		Prefix: "peer",
+		Net:    chaincfg.MainNetParams.Net,
+	})
+	if err != nil {
+		t.Fatalf("NewMessageCapture: unexpected error: %v", err)
+	}
+	if prev := inPeer.SetCapture(capture); prev != nil {
+		t.Fatalf("SetCapture: unexpected previous capture")
+	}
+	inPeer.AssociateConnection(inConn)
+	defer inPeer.Disconnect()
+
+	outPeer, err := peer.NewOutboundPeer(peerCfg, "10.0.0.1:8333")
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected err %v", err)
+	}
+	outPeer.AssociateConnection(outConn)
+	defer outPeer.Disconnect()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-verack:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("verack timeout")
+		}
+	}
+
+	// Stop capturing once the handshake completed.
+	if inPeer.SetCapture(nil) != capture || inPeer.Capture() != nil {
+		t.Fatalf("SetCapture: unexpected previous capture")
+	}
+	if err := capture.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	if capture.Dropped() != 0 {
+		t.Fatalf("%d messages were dropped", capture.Dropped())
+	}
+
+	// The inbound peer received the version and verack of the outbound
+	// peer and sent its own.
+	want := map[string]bool{
+		peer.CaptureInbound.String() + " " + wire.CmdVersion:  true,
+		peer.CaptureOutbound.String() + " " + wire.CmdVersion: true,
+		peer.CaptureInbound.String() + " " + wire.CmdVerAck:   true,
+		peer.CaptureOutbound.String() + " " + wire.CmdVerAck:  true,
+	}
+	got := make(map[string]bool)
+	for _, m := range readCapture(t, filepath.Join(dir, "peer-1.cap")) {
+		if m.Err != nil {
+			t.Fatalf("unable to decode captured %v message: %v",
+				m.Direction, m.Err)
+		}
+		if m.ProtocolVersion == 0 || m.Time.IsZero() {
+			t.Fatalf("unexpected captured message %+v", m)
+		}
+		var buf bytes.Buffer
+		err := wire.WriteMessage(&buf, m.Msg, m.ProtocolVersion,
+			chaincfg.MainNetParams.Net)
+		if err != nil || !bytes.Equal(buf.Bytes(), m.Raw) {
+			t.Fatalf("decoded %s message doesn't match the raw "+
+				"message", m.Msg.Command())
+		}
+		got[m.Direction.String()+" "+m.Msg.Command()] = true
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected captured messages: got %v, want %v", got,
+			want)
+	}
+}
+
+// TestCaptureRotation ensures capture files are rotated once they reach their
+// maximum size, that only the most recent files are kept, and that malformed
+// messages are read back with their decoding error.
+func TestCaptureRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capturerotation")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Each ping is 32 bytes on the wire and 49 bytes once captured, so each
+	// file holds two pings.
+	net := chaincfg.MainNetParams.Net
+	capture, err := peer.NewMessageCapture(&peer.CaptureConfig{
+		Dir:         dir,
+		Prefix:      "rotate",
+		MaxFileSize: 12 + 49*2,
+		MaxFiles:    2,
+		Net:         net,
+	})
+	if err != nil {
+		t.Fatalf("NewMessageCapture: unexpected error: %v", err)
+	}
+	for nonce := uint64(0); nonce < 5; nonce++ {
+		var buf bytes.Buffer
+		err := wire.WriteMessage(&buf, wire.NewMsgPing(nonce),
+			wire.ProtocolVersion, net)
+		if err != nil {
+			t.Fatalf("unable to encode ping: %v", err)
+		}
+		capture.Record(peer.CaptureOutbound, wire.ProtocolVersion,
+			buf.Bytes())
+	}
+	capture.Record(peer.CaptureInbound, wire.ProtocolVersion, []byte{0x01})
+	if err := capture.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	capture.Record(peer.CaptureInbound, wire.ProtocolVersion, []byte{0x01})
+	if capture.Dropped() != 1 {
+		t.Fatalf("Dropped: got %d, want 1", capture.Dropped())
+	}
+
+	// The first file was removed, the second one holds the third and
+	// fourth pings, and the last one the fifth ping along with the
+	// malformed message.
+	if _, err := os.Stat(filepath.Join(dir, "rotate-1.cap")); !os.IsNotExist(err) {
+		t.Fatalf("the oldest capture file was not removed: %v", err)
+	}
+	msgs := readCapture(t, filepath.Join(dir, "rotate-2.cap"))
+	msgs = append(msgs, readCapture(t, filepath.Join(dir, "rotate-3.cap"))...)
+	if len(msgs) != 4 {
+		t.Fatalf("got %d captured messages, want 4", len(msgs))
+	}
+	for i, m := range msgs[:3] {
+		ping, ok := m.Msg.(*wire.MsgPing)
+		if !ok || ping.Nonce != uint64(i+2) ||
+			m.Direction != peer.CaptureOutbound {
+
+			t.Fatalf("message %d: unexpected %v message %v (err %v)",
+				i, m.Direction, m.Msg, m.Err)
+		}
+	}
+	last := msgs[3]
+	if last.Msg != nil || last.Err == nil ||
+		last.Direction != peer.CaptureInbound ||
+		!bytes.Equal(last.Raw, []byte{0x01}) {
+
+		t.Fatalf("unexpected malformed message %+v", last)
+	}
+
+	// Files which aren't captures are refused.
+	err = peer.ReadCapture(bytes.NewReader([]byte("not a capture")),
+		func(*peer.CapturedMessage) error { return nil })
+	if err != peer.ErrMalformedCapture {
+		t.Fatalf("ReadCapture: got err %v, want %v", err,
+			peer.ErrMalformedCapture)
+	}
+}
@@ -32,6 +32,8 @@ A quick overview of the major features peer provides are as follows:
    - Bitcoin network
    - Service support signalling (full nodes, bloom filters, etc)
    - Maximum supported protocol version
+   - Admission rules such as the minimum protocol version, required services,
+     and rejected user agents of remote peers
    - Ability to register callbacks for handling bitcoin protocol messages
  - Inventory message batching and send trickling with known inventory detection
    and avoidance
@@ -105,7 +107,12 @@ Of special interest are inventory messages.  Rather than manually sending MsgInv
 messages via Queuemessage, the inventory vectors should be queued using the
 QueueInventory function.  It employs batching and trickling along with
 intelligent known remote peer inventory detection and avoidance through the use
-of a most-recently used algorithm.
+of a most-recently used algorithm.  The trickle interval and the size of the
+batches are set by the TrickleInterval and MaxInvTrickleSize fields of the
+peer configuration, and the trickle interval defaults to a fraction of the
+target time per block of the chain parameters.  Inventory which should not wait
+for the next batch, such as new blocks, can be sent right away with the
+QueueInventoryImmediate function.
 
 Message Sending Helper Functions
 
@@ -135,6 +142,17 @@ A snapshot of the current peer statistics can be obtained with the StatsSnapshot
 function.  This includes statistics such as the total number of bytes read and
 written, the remote address, user agent, and negotiated protocol version.
 
+Message Capture
+
+The raw messages exchanged with a peer can be captured to files with a
+MessageCapture attached with the SetCapture function.  Each message is written
+along with the time it was received or sent and its direction.  The capture
+files are size-capped and rotated, and capturing never blocks the peer: messages
+which can't be written fast enough are dropped and counted instead.  The
+ReadCaptureFile function reads a capture file back as decoded messages, which is
+useful to debug interoperability with other implementations when the traffic
+can't be captured on the network.
+
 Logging
 
 This package provides extensive logging capabilities through the UseLogger
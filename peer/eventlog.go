@@ -0,0 +1,602 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// eventLogVersion is the version of the event log file format.
+	eventLogVersion = 1
+
+	// eventLogFileHeaderSize is the size of the header at the start of
+	// each event log file: the magic and the format version.
+	eventLogFileHeaderSize = 8
+
+	// eventRecordHeaderSize is the size of the fixed part of each event:
+	// the timestamp, the peer id, the direction, the size of the message,
+	// and the length of the command which follows it.
+	eventRecordHeaderSize = 18
+
+	// DefaultEventLogQueueSize is the default number of events waiting to
+	// be written to the event log before further events are dropped.
+	DefaultEventLogQueueSize = 10000
+
+	// otherCommand is the command the messages with a command which is not
+	// known to the wire package are counted under by EventLog.Totals.
+	otherCommand = "other"
+)
+
+// eventLogMagic identifies event log files.
+var eventLogMagic = [4]byte{'P', 'R', 'V', 'E'}
+
+// eventCommands is the list of commands whose messages are counted separately
+// by the counters of an event log.
+var eventCommands = []string{
+	wire.CmdVersion, wire.CmdVerAck, wire.CmdGetAddr, wire.CmdAddr,
+	wire.CmdGetBlocks, wire.CmdInv, wire.CmdGetData, wire.CmdNotFound,
+	wire.CmdBlock, wire.CmdTx, wire.CmdGetHeaders, wire.CmdHeaders,
+	wire.CmdPing, wire.CmdPong, wire.CmdAlert, wire.CmdMemPool,
+	wire.CmdFilterAdd, wire.CmdFilterClear, wire.CmdFilterLoad,
+	wire.CmdMerkleBlock, wire.CmdReject, wire.CmdSendHeaders,
+	wire.CmdFeeFilter,
+}
+
+// EventLogConfig is the configuration of the files an EventLog writes to.
+type EventLogConfig struct {
+	// Dir is the directory the event log files are written to.  It is
+	// created when it doesn't exist.
+	Dir string
+
+	// Prefix is the prefix of the names of the event log files.  The files
+	// are named by appending a sequence number and the .evt extension to
+	// it.
+	Prefix string
+
+	// MaxFileSize is the size in bytes after which the event log moves on
+	// to a new file.
+	MaxFileSize int64
+
+	// MaxTotalSize is the disk budget of the event log in bytes.  The
+	// oldest files are removed when the event log moves on to a new file
+	// so the files never take up more than this much space.  It must not
+	// be less than MaxFileSize.
+	MaxTotalSize int64
+
+	// QueueSize is the number of events waiting to be written before
+	// further events are dropped.  DefaultEventLogQueueSize is used when
+	// it is zero.
+	QueueSize int
+}
+
+// PeerEvent is a message exchanged with a peer as recorded by an EventLog.
+type PeerEvent struct {
+	// Time is the time the message was received or sent.
+	Time time.Time
+
+	// PeerID is the id of the peer the message was exchanged with.
+	PeerID int32
+
+	// Direction indicates whether the message was received from or sent
+	// to the peer.
+	Direction CaptureDirection
+
+	// Command is the command of the message.
+	Command string
+
+	// Size is the size of the message in bytes, including its header.
+	Size uint32
+}
+
+// CommandTotals is the number of messages with a command and their total size
+// in bytes in both directions.
+type CommandTotals struct {
+	Command       string
+	MsgsReceived  uint64
+	BytesReceived uint64
+	MsgsSent      uint64
+	BytesSent     uint64
+}
+
+// commandTotalsSorter implements sort.Interface to allow a slice of command
+// totals to be sorted by command.
+type commandTotalsSorter []CommandTotals
+
+// Len returns the number of command totals in the slice.  It is part of the
+// sort.Interface implementation.
+func (s commandTotalsSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the command totals at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s commandTotalsSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the command totals with index i should sort before the
+// command totals with index j.  It is part of the sort.Interface
+// implementation.
+func (s commandTotalsSorter) Less(i, j int) bool {
+	return s[i].Command < s[j].Command
+}
+
+// eventCounters houses the number of messages with a command and their total
+// size in bytes in both directions.  The counters are updated atomically.
+type eventCounters struct {
+	msgsReceived  uint64
+	bytesReceived uint64
+	msgsSent      uint64
+	bytesSent     uint64
+}
+
+// eventLogFile is an event log file which is kept on disk.
+type eventLogFile struct {
+	seq  int
+	size int64
+}
+
+// EventLog counts the messages exchanged with all peers by command and
+// direction and, when configured to, writes a compact record of each message
+// to size-capped, rotating event log files for offline analysis of the message
+// timing.  Events are queued and written by a separate goroutine so logging
+// never blocks the peers.  Events which don't fit in the queue are dropped
+// and counted instead, though they are still counted by command.
+//
+// An event log is attached to peers through the EventLog field of their
+// Config.  The event log files can be read back with ReadEventLog and
+// ReadEventLogFile, and summarized with SummarizeEventLogFiles.
+type EventLog struct {
+	dropped uint64 // atomic
+	closed  int32  // atomic
+
+	// counters is only populated when the event log is created, so the
+	// map itself is safe for concurrent reads.
+	counters map[string]*eventCounters
+
+	cfg   *EventLogConfig
+	queue chan *PeerEvent
+
+	// The following fields are only accessed by the writer goroutine after
+	// the event log is created.
+	files []eventLogFile
+	file  *os.File
+	w     *bufio.Writer
+	size  int64
+	err   error
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// NewEventLog returns a new event log which writes to the files described by
+// the passed configuration.  The existing event log files are kept, subject to
+// the disk budget, and a new file is created right away so configuration
+// errors are reported to the caller.  When the configuration is nil, the event
+// log only counts the messages.
+func NewEventLog(cfg *EventLogConfig) (*EventLog, error) {
+	l := &EventLog{
+		counters: make(map[string]*eventCounters, len(eventCommands)+1),
+		quit:     make(chan struct{}),
+	}
+	for _, command := range eventCommands {
+		l.counters[command] = new(eventCounters)
+	}
+	l.counters[otherCommand] = new(eventCounters)
+	if cfg == nil {
+		return l, nil
+	}
+
+	if cfg.MaxFileSize <= eventLogFileHeaderSize {
+		return nil, fmt.Errorf("maximum event log file size of %d bytes "+
+			"is too small", cfg.MaxFileSize)
+	}
+	if cfg.MaxTotalSize < cfg.MaxFileSize {
+		return nil, fmt.Errorf("event log disk budget of %d bytes is "+
+			"less than the maximum file size of %d bytes",
+			cfg.MaxTotalSize, cfg.MaxFileSize)
+	}
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, err
+	}
+	files, err := existingEventLogFiles(cfg)
+	if err != nil {
+		return nil, err
+	}
+	queueSize := cfg.QueueSize
+	if queueSize == 0 {
+		queueSize = DefaultEventLogQueueSize
+	}
+	logCfg := *cfg
+	l.cfg = &logCfg
+	l.files = files
+	l.queue = make(chan *PeerEvent, queueSize)
+	if err := l.rotate(); err != nil {
+		return nil, err
+	}
+
+	l.wg.Add(1)
+	go l.writeHandler()
+	return l, nil
+}
+
+// existingEventLogFiles returns the event log files already in the directory
+// of the passed configuration sorted by sequence number.
+func existingEventLogFiles(cfg *EventLogConfig) ([]eventLogFile, error) {
+	pattern := filepath.Join(cfg.Dir, cfg.Prefix+"-*.evt")
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	seqs := make([]int, 0, len(paths))
+	sizes := make(map[int]int64, len(paths))
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".evt")
+		seq, err := strconv.Atoi(strings.TrimPrefix(name, cfg.Prefix+"-"))
+		if err != nil || seq < 1 {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		seqs = append(seqs, seq)
+		sizes[seq] = info.Size()
+	}
+	sort.Ints(seqs)
+	files := make([]eventLogFile, 0, len(seqs))
+	for _, seq := range seqs {
+		files = append(files, eventLogFile{seq: seq, size: sizes[seq]})
+	}
+	return files, nil
+}
+
+// eventLogPath returns the path of the event log file with the passed sequence
+// number.
+func (l *EventLog) eventLogPath(seq int) string {
+	name := fmt.Sprintf("%s-%d.evt", l.cfg.Prefix, seq)
+	return filepath.Join(l.cfg.Dir, name)
+}
+
+// Prefix returns the path prefix of the event log files, or an empty string
+// when the event log only counts the messages.  The event log files are named
+// by appending a sequence number and the .evt extension to it.
+//
+// This function is safe for concurrent access.
+func (l *EventLog) Prefix() string {
+	if l.cfg == nil {
+		return ""
+	}
+	return filepath.Join(l.cfg.Dir, l.cfg.Prefix)
+}
+
+// rotate closes the current event log file, when any, and moves on to a new
+// one, removing the oldest files which no longer fit in the disk budget along
+// with a full new file.
+func (l *EventLog) rotate() error {
+	if l.file != nil {
+		if err := l.w.Flush(); err != nil {
+			return err
+		}
+		if err := l.file.Close(); err != nil {
+			return err
+		}
+		l.file = nil
+		l.files[len(l.files)-1].size = l.size
+	}
+
+	var total int64
+	for _, f := range l.files {
+		total += f.size
+	}
+	for len(l.files) > 0 && total+l.cfg.MaxFileSize > l.cfg.MaxTotalSize {
+		os.Remove(l.eventLogPath(l.files[0].seq))
+		total -= l.files[0].size
+		l.files = l.files[1:]
+	}
+
+	seq := 1
+	if len(l.files) > 0 {
+		seq = l.files[len(l.files)-1].seq + 1
+	}
+	f, err := os.OpenFile(l.eventLogPath(seq),
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	var header [eventLogFileHeaderSize]byte
+	copy(header[:4], eventLogMagic[:])
+	binary.LittleEndian.PutUint32(header[4:8], eventLogVersion)
+	if _, err := f.Write(header[:]); err != nil {
+		f.Close()
+		return err
+	}
+	l.files = append(l.files, eventLogFile{seq: seq})
+	l.file = f
+	l.w = bufio.NewWriter(f)
+	l.size = eventLogFileHeaderSize
+	return nil
+}
+
+// write writes the passed event to the current event log file, moving on to a
+// new file first when the event doesn't fit in the current one.
+func (l *EventLog) write(e *PeerEvent) error {
+	command := e.Command
+	if len(command) > wire.CommandSize {
+		command = command[:wire.CommandSize]
+	}
+	recordSize := int64(eventRecordHeaderSize + len(command))
+	if l.size+recordSize > l.cfg.MaxFileSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	var header [eventRecordHeaderSize]byte
+	binary.LittleEndian.PutUint64(header[0:8], uint64(e.Time.UnixNano()))
+	binary.LittleEndian.PutUint32(header[8:12], uint32(e.PeerID))
+	header[12] = byte(e.Direction)
+	binary.LittleEndian.PutUint32(header[13:17], e.Size)
+	header[17] = byte(len(command))
+	if _, err := l.w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := l.w.WriteString(command); err != nil {
+		return err
+	}
+	l.size += recordSize
+	return nil
+}
+
+// writeHandler writes the queued events to the event log files until the
+// event log is closed.  The file is flushed whenever the queue is empty so the
+// event log can be read while it is still being written.  It must be run as a
+// goroutine.
+func (l *EventLog) writeHandler() {
+	// handle writes the passed event unless writing already failed, in
+	// which case the remaining events are dropped.
+	handle := func(e *PeerEvent) {
+		if l.err == nil {
+			l.err = l.write(e)
+		}
+		if l.err != nil {
+			atomic.AddUint64(&l.dropped, 1)
+			return
+		}
+		if len(l.queue) == 0 {
+			l.err = l.w.Flush()
+		}
+	}
+
+out:
+	for {
+		select {
+		case e := <-l.queue:
+			handle(e)
+
+		case <-l.quit:
+			break out
+		}
+	}
+
+	// Write the events which were queued before the event log was closed.
+cleanup:
+	for {
+		select {
+		case e := <-l.queue:
+			handle(e)
+		default:
+			break cleanup
+		}
+	}
+
+	if l.err == nil {
+		l.err = l.w.Flush()
+	}
+	if err := l.file.Close(); l.err == nil {
+		l.err = err
+	}
+	l.wg.Done()
+}
+
+// Record counts a message with the passed command and size in bytes which was
+// exchanged with the peer with the passed id in the passed direction and
+// queues an event for it when the event log writes to files.  The event is
+// dropped when the queue is full or the event log is closed, but the message
+// is counted regardless.
+//
+// This function is safe for concurrent access.
+func (l *EventLog) Record(peerID int32, direction CaptureDirection, command string, size int) {
+	counters, ok := l.counters[command]
+	if !ok {
+		counters = l.counters[otherCommand]
+	}
+	if direction == CaptureInbound {
+		atomic.AddUint64(&counters.msgsReceived, 1)
+		atomic.AddUint64(&counters.bytesReceived, uint64(size))
+	} else {
+		atomic.AddUint64(&counters.msgsSent, 1)
+		atomic.AddUint64(&counters.bytesSent, uint64(size))
+	}
+
+	if l.cfg == nil {
+		return
+	}
+	if atomic.LoadInt32(&l.closed) != 0 {
+		atomic.AddUint64(&l.dropped, 1)
+		return
+	}
+	e := &PeerEvent{
+		Time:      time.Now(),
+		PeerID:    peerID,
+		Direction: direction,
+		Command:   command,
+		Size:      uint32(size),
+	}
+	select {
+	case l.queue <- e:
+	default:
+		atomic.AddUint64(&l.dropped, 1)
+	}
+}
+
+// Totals returns the number of messages recorded and their total size in bytes
+// by command, sorted by command.  Only the commands with messages are
+// included.  Messages with a command which is not known to the wire package
+// are counted under the "other" command.
+//
+// This function is safe for concurrent access.
+func (l *EventLog) Totals() []CommandTotals {
+	totals := make([]CommandTotals, 0, len(l.counters))
+	for command, counters := range l.counters {
+		t := CommandTotals{
+			Command:       command,
+			MsgsReceived:  atomic.LoadUint64(&counters.msgsReceived),
+			BytesReceived: atomic.LoadUint64(&counters.bytesReceived),
+			MsgsSent:      atomic.LoadUint64(&counters.msgsSent),
+			BytesSent:     atomic.LoadUint64(&counters.bytesSent),
+		}
+		if t.MsgsReceived == 0 && t.MsgsSent == 0 {
+			continue
+		}
+		totals = append(totals, t)
+	}
+	sort.Sort(commandTotalsSorter(totals))
+	return totals
+}
+
+// Dropped returns the number of events which were dropped rather than written
+// to the event log files.
+//
+// This function is safe for concurrent access.
+func (l *EventLog) Dropped() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
+// Close writes the queued events and closes the event log file.  It returns
+// the first error writing the event log files, if any.
+func (l *EventLog) Close() error {
+	if atomic.AddInt32(&l.closed, 1) != 1 || l.cfg == nil {
+		return nil
+	}
+
+	close(l.quit)
+	l.wg.Wait()
+	return l.err
+}
+
+// ErrMalformedEventLog is returned when reading an event log file which is not
+// in the event log file format.
+var ErrMalformedEventLog = errors.New("malformed event log file")
+
+// ReadEventLog reads the events from the passed reader, which holds the
+// contents of an event log file, and invokes the passed function with each of
+// them in order.  Reading stops when the function returns an error, which is
+// then returned.
+func ReadEventLog(r io.Reader, fn func(*PeerEvent) error) error {
+	var header [eventLogFileHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return ErrMalformedEventLog
+	}
+	if !bytes.Equal(header[:4], eventLogMagic[:]) ||
+		binary.LittleEndian.Uint32(header[4:8]) != eventLogVersion {
+
+		return ErrMalformedEventLog
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		var recordHeader [eventRecordHeaderSize]byte
+		_, err := io.ReadFull(br, recordHeader[:])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return ErrMalformedEventLog
+		}
+		length := int(recordHeader[17])
+		if length > wire.CommandSize {
+			return ErrMalformedEventLog
+		}
+		command := make([]byte, length)
+		if _, err := io.ReadFull(br, command); err != nil {
+			return ErrMalformedEventLog
+		}
+
+		e := &PeerEvent{
+			Time: time.Unix(0, int64(binary.LittleEndian.Uint64(
+				recordHeader[0:8]))),
+			PeerID:    int32(binary.LittleEndian.Uint32(recordHeader[8:12])),
+			Direction: CaptureDirection(recordHeader[12]),
+			Size:      binary.LittleEndian.Uint32(recordHeader[13:17]),
+			Command:   string(command),
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadEventLogFile reads the events from the event log file at the passed path
+// the same as ReadEventLog.
+func ReadEventLogFile(path string, fn func(*PeerEvent) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return ReadEventLog(f, fn)
+}
+
+// SummarizeEventLogFiles returns the number of messages and their total size
+// in bytes by command of the events in the event log files at the passed
+// paths, sorted by command.
+func SummarizeEventLogFiles(paths ...string) ([]CommandTotals, error) {
+	byCommand := make(map[string]*CommandTotals)
+	for _, path := range paths {
+		err := ReadEventLogFile(path, func(e *PeerEvent) error {
+			t, ok := byCommand[e.Command]
+			if !ok {
+				t = &CommandTotals{Command: e.Command}
+				byCommand[e.Command] = t
+			}
+			switch e.Direction {
+			case CaptureInbound:
+				t.MsgsReceived++
+				t.BytesReceived += uint64(e.Size)
+			case CaptureOutbound:
+				t.MsgsSent++
+				t.BytesSent += uint64(e.Size)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	totals := make([]CommandTotals, 0, len(byCommand))
+	for _, t := range byCommand {
+		totals = append(totals, *t)
+	}
+	sort.Sort(commandTotalsSorter(totals))
+	return totals, nil
+}
@@ -0,0 +1,323 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/peer"
+	"github.com/bitgo/prova/wire"
+)
+
+// eventLogFiles returns the paths of the event log files with the passed
+// prefix in the passed directory, oldest first.
+func eventLogFiles(t *testing.T, dir, prefix string) []string {
+	paths, err := filepath.Glob(filepath.Join(dir, prefix+"-*.evt"))
+	if err != nil {
+		t.Fatalf("unable to list event log files: %v", err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// TestEventLogSummary ensures the events of simulated traffic with several
+// peers are written to the event log, read back as they were recorded, and
+// summarized to the totals of the injected traffic by command, and that the
+// counters of the event log agree.
+func TestEventLogSummary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventlogsummary")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Simulate traffic with three peers where each peer exchanges a
+	// different mix of messages in both directions.
+	type traffic struct {
+		peerID    int32
+		direction peer.CaptureDirection
+		command   string
+		size      int
+	}
+	var injected []traffic
+	commands := []string{wire.CmdInv, wire.CmdGetData, wire.CmdTx,
+		wire.CmdBlock, wire.CmdPing}
+	for i := 0; i < 300; i++ {
+		direction := peer.CaptureInbound
+		if i%3 == 0 {
+			direction = peer.CaptureOutbound
+		}
+		injected = append(injected, traffic{
+			peerID:    int32(i%3 + 1),
+			direction: direction,
+			command:   commands[i%len(commands)],
+			size:      wire.MessageHeaderSize + (i*37)%5000,
+		})
+	}
+	want := make(map[string]*peer.CommandTotals)
+	for _, tr := range injected {
+		totals, ok := want[tr.command]
+		if !ok {
+			totals = &peer.CommandTotals{Command: tr.command}
+			want[tr.command] = totals
+		}
+		if tr.direction == peer.CaptureInbound {
+			totals.MsgsReceived++
+			totals.BytesReceived += uint64(tr.size)
+		} else {
+			totals.MsgsSent++
+			totals.BytesSent += uint64(tr.size)
+		}
+	}
+
+	// Each event takes at most 30 bytes, so the traffic spans a few files
+	// which all fit in the disk budget.
+	eventLog, err := peer.NewEventLog(&peer.EventLogConfig{
+		Dir:          dir,
+		Prefix:       "events",
+		MaxFileSize:  4096,
+		MaxTotalSize: 4096 * 8,
+		QueueSize:    len(injected),
+	})
+	if err != nil {
+		t.Fatalf("NewEventLog: unexpected error: %v", err)
+	}
+	start := time.Now()
+	for _, tr := range injected {
+		eventLog.Record(tr.peerID, tr.direction, tr.command, tr.size)
+	}
+	if err := eventLog.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	if eventLog.Dropped() != 0 {
+		t.Fatalf("%d events were dropped", eventLog.Dropped())
+	}
+
+	// The events are read back in order as they were recorded.
+	paths := eventLogFiles(t, dir, "events")
+	if len(paths) < 2 {
+		t.Fatalf("got %d event log files, want at least 2", len(paths))
+	}
+	var events []*peer.PeerEvent
+	for _, path := range paths {
+		err := peer.ReadEventLogFile(path, func(e *peer.PeerEvent) error {
+			events = append(events, e)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ReadEventLogFile %s: unexpected error: %v", path,
+				err)
+		}
+	}
+	if len(events) != len(injected) {
+		t.Fatalf("got %d events, want %d", len(events), len(injected))
+	}
+	for i, e := range events {
+		tr := injected[i]
+		if e.PeerID != tr.peerID || e.Direction != tr.direction ||
+			e.Command != tr.command || e.Size != uint32(tr.size) ||
+			e.Time.Before(start.Add(-time.Second)) {
+
+			t.Fatalf("event %d: got %+v, want %+v", i, e, tr)
+		}
+	}
+
+	// The summary of the files and the counters match the injected
+	// traffic.
+	var wantTotals []peer.CommandTotals
+	for _, command := range []string{wire.CmdBlock, wire.CmdGetData,
+		wire.CmdInv, wire.CmdPing, wire.CmdTx} {
+
+		wantTotals = append(wantTotals, *want[command])
+	}
+	summary, err := peer.SummarizeEventLogFiles(paths...)
+	if err != nil {
+		t.Fatalf("SummarizeEventLogFiles: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(summary, wantTotals) {
+		t.Fatalf("SummarizeEventLogFiles: got %+v, want %+v", summary,
+			wantTotals)
+	}
+	if totals := eventLog.Totals(); !reflect.DeepEqual(totals, wantTotals) {
+		t.Fatalf("Totals: got %+v, want %+v", totals, wantTotals)
+	}
+
+	// Files which aren't event logs are refused.
+	err = peer.ReadEventLog(bytes.NewReader([]byte("not an event log")),
+		func(*peer.PeerEvent) error { return nil })
+	if err != peer.ErrMalformedEventLog {
+		t.Fatalf("ReadEventLog: got err %v, want %v", err,
+			peer.ErrMalformedEventLog)
+	}
+}
+
+// TestEventLogBudget ensures the event log files are rotated once they reach
+// their maximum size, that the oldest files are removed so the files never
+// exceed the disk budget, including the files left by a previous event log,
+// and that an event log without files only counts the messages.
+func TestEventLogBudget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventlogbudget")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Each ping event is 18 + 4 bytes, so each file holds four events
+	// after its 8 byte header and the budget holds three files.
+	cfg := &peer.EventLogConfig{
+		Dir:          dir,
+		Prefix:       "budget",
+		MaxFileSize:  8 + 22*4,
+		MaxTotalSize: (8 + 22*4) * 3,
+	}
+	for run := 0; run < 2; run++ {
+		eventLog, err := peer.NewEventLog(cfg)
+		if err != nil {
+			t.Fatalf("NewEventLog: unexpected error: %v", err)
+		}
+		for i := 0; i < 10; i++ {
+			eventLog.Record(1, peer.CaptureOutbound, wire.CmdPing, 32)
+		}
+		if err := eventLog.Close(); err != nil {
+			t.Fatalf("Close: unexpected error: %v", err)
+		}
+		eventLog.Record(1, peer.CaptureOutbound, wire.CmdPing, 32)
+		if eventLog.Dropped() != 1 {
+			t.Fatalf("Dropped: got %d, want 1", eventLog.Dropped())
+		}
+
+		var total int64
+		for _, path := range eventLogFiles(t, dir, "budget") {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("unable to stat %s: %v", path, err)
+			}
+			total += info.Size()
+		}
+		if total > cfg.MaxTotalSize {
+			t.Fatalf("run %d: event log files take up %d bytes, more "+
+				"than the budget of %d bytes", run, total,
+				cfg.MaxTotalSize)
+		}
+	}
+
+	// The first run wrote files 1 through 3 and the second one continued
+	// with files 4 through 6, removing all of the older files.
+	paths := eventLogFiles(t, dir, "budget")
+	wantPaths := []string{
+		filepath.Join(dir, "budget-4.evt"),
+		filepath.Join(dir, "budget-5.evt"),
+		filepath.Join(dir, "budget-6.evt"),
+	}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Fatalf("got event log files %v, want %v", paths, wantPaths)
+	}
+	summary, err := peer.SummarizeEventLogFiles(paths...)
+	if err != nil {
+		t.Fatalf("SummarizeEventLogFiles: unexpected error: %v", err)
+	}
+	want := []peer.CommandTotals{
+		{Command: wire.CmdPing, MsgsSent: 10, BytesSent: 320},
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Fatalf("SummarizeEventLogFiles: got %+v, want %+v", summary,
+			want)
+	}
+
+	// An event log without files counts the messages, including those
+	// with a command unknown to the wire package.
+	eventLog, err := peer.NewEventLog(nil)
+	if err != nil {
+		t.Fatalf("NewEventLog: unexpected error: %v", err)
+	}
+	eventLog.Record(1, peer.CaptureInbound, wire.CmdTx, 100)
+	eventLog.Record(2, peer.CaptureInbound, "custom", 50)
+	if err := eventLog.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	want = []peer.CommandTotals{
+		{Command: "other", MsgsReceived: 1, BytesReceived: 50},
+		{Command: wire.CmdTx, MsgsReceived: 1, BytesReceived: 100},
+	}
+	if totals := eventLog.Totals(); !reflect.DeepEqual(totals, want) {
+		t.Fatalf("Totals: got %+v, want %+v", totals, want)
+	}
+	if eventLog.Prefix() != "" || eventLog.Dropped() != 0 {
+		t.Fatalf("unexpected prefix %q or dropped events %d",
+			eventLog.Prefix(), eventLog.Dropped())
+	}
+}
+
+// TestPeerEventLog ensures the messages exchanged by peers are recorded to
+// their event log in both directions.
+func TestPeerEventLog(t *testing.T) {
+	eventLog, err := peer.NewEventLog(nil)
+	if err != nil {
+		t.Fatalf("NewEventLog: unexpected error: %v", err)
+	}
+
+	// Wait for both peers to write a verack, which happens after the
+	// version messages are recorded.
+	verack := make(chan struct{}, 2)
+	peerCfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnWrite: func(p *peer.Peer, bytesWritten int, msg wire.Message, err error) {
+				if msg.Command() == wire.CmdVerAck {
+					verack <- struct{}{}
+				}
+			},
+		},
+		UserAgentName:    "peer",
+		UserAgentVersion: "1.0",
+		ChainParams:      &chaincfg.MainNetParams,
+		Services:         0,
+		EventLog:         eventLog,
+	}
+	inConn, outConn := pipe(
+		&conn{raddr: "10.0.0.1:8333"},
+		&conn{raddr: "10.0.0.2:8333"},
+	)
+	inPeer := peer.NewInboundPeer(peerCfg)
+	inPeer.AssociateConnection(inConn)
+	defer inPeer.Disconnect()
+
+	outPeer, err := peer.NewOutboundPeer(peerCfg, "10.0.0.1:8333")
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected err %v", err)
+	}
+	outPeer.AssociateConnection(outConn)
+	defer outPeer.Disconnect()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-verack:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("verack timeout")
+		}
+	}
+
+	// Both peers sent their version message and the other peer received
+	// it, so the same number of bytes were sent and received.
+	for _, totals := range eventLog.Totals() {
+		if totals.Command != wire.CmdVersion {
+			continue
+		}
+		if totals.MsgsSent != 2 || totals.MsgsReceived != 2 ||
+			totals.BytesSent != totals.BytesReceived {
+
+			t.Fatalf("unexpected version totals %+v", totals)
+		}
+		return
+	}
+	t.Fatalf("no version messages were recorded")
+}
@@ -13,6 +13,7 @@ import (
 	"io"
 	"math/rand"
 	"net"
+	"regexp"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -30,11 +31,12 @@ const (
 	// MaxProtocolVersion is the max protocol version the peer supports.
 	MaxProtocolVersion = wire.FeeFilterVersion
 
-	// outputBufferSize is the number of elements the output channels use.
+	// outputBufferSize is the default number of elements the output
+	// channels use.
 	outputBufferSize = 50
 
-	// invTrickleSize is the maximum amount of inventory to send in a single
-	// message when trickling inventory to remote peers.
+	// maxInvTrickleSize is the default maximum amount of inventory to send
+	// in a single message when trickling inventory to remote peers.
 	maxInvTrickleSize = 1000
 
 	// maxKnownInventory is the maximum number of items to keep in the known
@@ -62,9 +64,18 @@ const (
 	// only checked on each stall tick interval.
 	stallResponseTimeout = 30 * time.Second
 
-	// trickleTimeout is the duration of the ticker which trickles down the
-	// inventory to a peer.
+	// trickleTimeout is the maximum duration of the ticker which trickles
+	// down the inventory to a peer.
 	trickleTimeout = 2 * time.Second
+
+	// minTrickleTimeout is the minimum duration of the ticker which
+	// trickles down the inventory to a peer.
+	minTrickleTimeout = 100 * time.Millisecond
+
+	// tricklesPerBlock is the number of times the inventory is trickled
+	// down to a peer during the target time per block by default.  It
+	// matches the trickle timeout with the 10 minute blocks of bitcoin.
+	tricklesPerBlock = 300
 )
 
 var (
@@ -86,6 +97,14 @@ var (
 	allowSelfConns bool
 )
 
+// AllowSelfConns disables the detection of connections to self, which relies on
+// the nonces sent by all peers of the process and so also detects connections
+// between several nodes running in the same process.  It is only intended for
+// tests which connect such nodes to each other.
+func AllowSelfConns() {
+	allowSelfConns = true
+}
+
 // MessageListeners defines callback function pointers to invoke with message
 // listeners for a peer. Any listener which is not set to a concrete callback
 // during peer initialization is ignored. Execution of multiple message
@@ -234,11 +253,91 @@ type Config struct {
 	// not send inv messages for transactions.
 	DisableRelayTx bool
 
+	// MinProtocolVersion specifies the minimum protocol version remote
+	// peers must advertise.  This field can be omitted in which case
+	// wire.MultipleAddressVersion will be used.
+	MinProtocolVersion uint32
+
+	// RequiredServices specifies the services outbound remote peers must
+	// advertise.  Inbound peers are not required to advertise any services
+	// since they are commonly clients which don't provide them.
+	RequiredServices wire.ServiceFlag
+
+	// RejectUserAgents specifies patterns of user agents which are not
+	// allowed to connect.  Remote peers whose user agent matches any of
+	// the patterns are rejected.
+	RejectUserAgents []*regexp.Regexp
+
+	// MaxPayloadOverrides specifies maximum payload sizes for messages with
+	// the given commands which override the limits of the wire package.
+	// Messages from the remote peer whose header indicates a larger payload
+	// are rejected without reading the payload.
+	MaxPayloadOverrides map[string]uint32
+
+	// StrictBlockDecoding specifies that blocks from the remote peer which
+	// are not serialized canonically, such as blocks followed by trailing
+	// data, are rejected as malformed messages.  Variable length integers
+	// which are not minimally encoded are rejected regardless.
+	StrictBlockDecoding bool
+
+	// TrickleInterval specifies the interval at which the queued inventory
+	// is trickled to the remote peer in batches.  This field can be
+	// omitted in which case DefaultTrickleInterval of the chain parameters
+	// will be used.
+	TrickleInterval time.Duration
+
+	// MaxInvTrickleSize specifies the maximum number of inventory vectors
+	// sent in a single inv message when trickling inventory to the remote
+	// peer.  This field can be omitted in which case 1000 will be used.
+	MaxInvTrickleSize int
+
+	// OutputQueueSize specifies the number of messages and the number of
+	// inventory vectors the output queues of the peer buffer before
+	// callers queueing them block.  This field can be omitted in which
+	// case 50 will be used.
+	OutputQueueSize int
+
+	// EventLog specifies the event log which counts, and possibly logs,
+	// the messages exchanged with the remote peer.  It is typically shared
+	// by all peers.  This field can be nil in which case the messages are
+	// not recorded.
+	EventLog *EventLog
+
 	// Listeners houses callback functions to be invoked on receiving peer
 	// messages.
 	Listeners MessageListeners
 }
 
+// AdmissionError describes a remote peer which was rejected during the version
+// handshake because it does not satisfy the admission rules of the local peer.
+// A reject message with the code and reason is sent to the remote peer before
+// it is disconnected.  Rejections are a matter of local policy rather than
+// misbehavior, so callers should not penalize the remote peer for them.
+type AdmissionError struct {
+	Code   wire.RejectCode
+	Reason string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e *AdmissionError) Error() string {
+	return fmt.Sprintf("peer rejected: %s", e.Reason)
+}
+
+// DefaultTrickleInterval returns the default interval at which inventory is
+// trickled to peers for the passed chain parameters.  It is proportional to the
+// target time per block so networks with shorter blocks announce transactions
+// with less latency, and bounded by the trickle interval used for bitcoin.
+func DefaultTrickleInterval(params *chaincfg.Params) time.Duration {
+	interval := params.TargetTimePerBlock / tricklesPerBlock
+	if interval < minTrickleTimeout {
+		return minTrickleTimeout
+	}
+	if interval > trickleTimeout {
+		return trickleTimeout
+	}
+	return interval
+}
+
 // minUint32 is a helper function to return the minimum of two uint32s.
 // This avoids a math import and the need to cast to floats.
 func minUint32(a, b uint32) uint32 {
@@ -429,6 +528,11 @@ type Peer struct {
 	lastPingTime       time.Time // Time we sent last ping.
 	lastPingMicros     int64     // Time for last ping to return.
 
+	// capture, when set, receives the raw messages exchanged with the
+	// peer.  It is protected by the captureMtx mutex.
+	captureMtx sync.Mutex
+	capture    *MessageCapture
+
 	stallControl  chan stallControlMsg
 	outputQueue   chan outMsg
 	sendQueue     chan outMsg
@@ -556,6 +660,32 @@ func (p *Peer) Inbound() bool {
 	return p.inbound
 }
 
+// Capture returns the message capture the raw messages exchanged with the peer
+// are written to, or nil when they are not captured.
+//
+// This function is safe for concurrent access.
+func (p *Peer) Capture() *MessageCapture {
+	p.captureMtx.Lock()
+	capture := p.capture
+	p.captureMtx.Unlock()
+
+	return capture
+}
+
+// SetCapture sets the message capture the raw messages exchanged with the peer
+// are written to and returns the previous one so the caller can close it.
+// Passing nil stops capturing the messages.
+//
+// This function is safe for concurrent access.
+func (p *Peer) SetCapture(capture *MessageCapture) *MessageCapture {
+	p.captureMtx.Lock()
+	prev := p.capture
+	p.capture = capture
+	p.captureMtx.Unlock()
+
+	return prev
+}
+
 // Services returns the services flag of the remote peer.
 //
 // This function is safe for concurrent access.
@@ -657,6 +787,16 @@ func (p *Peer) ProtocolVersion() uint32 {
 	return protocolVersion
 }
 
+// messageProtocolVersion returns the protocol version messages are read from
+// and written to the peer with, which is the negotiated protocol version along
+// with the transaction encoding flags of the chain, such as
+// wire.TxExpiryEncoding.
+//
+// This function is safe for concurrent access.
+func (p *Peer) messageProtocolVersion() uint32 {
+	return p.ProtocolVersion() | p.cfg.ChainParams.TxEncoding()
+}
+
 // LastBlock returns the last block of the peer.
 //
 // This function is safe for concurrent access.
@@ -996,6 +1136,51 @@ func (p *Peer) PushRejectMsg(command string, code wire.RejectCode, reason string
 	<-doneChan
 }
 
+// checkAdmission returns an admission error describing why the remote peer
+// which sent the passed version message is not allowed to connect, or nil if
+// it satisfies the admission rules.
+func (p *Peer) checkAdmission(msg *wire.MsgVersion) *AdmissionError {
+	// Reject peers with a protocol version that is too old.
+	if int64(msg.ProtocolVersion) < int64(p.cfg.MinProtocolVersion) {
+		reason := fmt.Sprintf("protocol version must be %d or greater",
+			p.cfg.MinProtocolVersion)
+		return &AdmissionError{Code: wire.RejectObsolete, Reason: reason}
+	}
+
+	// Reject peers running software known to misbehave.
+	for _, pattern := range p.cfg.RejectUserAgents {
+		if pattern.MatchString(msg.UserAgent) {
+			reason := fmt.Sprintf("user agent %s is not allowed",
+				msg.UserAgent)
+			return &AdmissionError{Code: wire.RejectNonstandard,
+				Reason: reason}
+		}
+	}
+
+	// Reject outbound peers which don't provide the required services.
+	required := p.cfg.RequiredServices
+	if !p.inbound && msg.Services&required != required {
+		reason := fmt.Sprintf("services must include %v, got %v",
+			required, msg.Services)
+		return &AdmissionError{Code: wire.RejectNonstandard,
+			Reason: reason}
+	}
+
+	return nil
+}
+
+// rejectHandshake sends a reject message for the passed command with the code
+// and reason of the passed admission error to the remote peer and waits for it
+// to be sent.  It returns the admission error so the handshake fails.
+func (p *Peer) rejectHandshake(command string, err *AdmissionError) error {
+	log.Debugf("Rejecting peer %s: %s", p, err.Reason)
+	rejectMsg := wire.NewMsgReject(command, err.Code, err.Reason)
+	if writeErr := p.writeMessage(rejectMsg); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
 // handleRemoteVersionMsg is invoked when a version bitcoin message is received
 // from the remote peer.  It will return an error if the remote peer's version
 // is not compatible with ours.
@@ -1005,17 +1190,10 @@ func (p *Peer) handleRemoteVersionMsg(msg *wire.MsgVersion) error {
 		return errors.New("disconnecting peer connected to self")
 	}
 
-	// Notify and disconnect clients that have a protocol version that is
-	// too old.
-	if msg.ProtocolVersion < int32(wire.MultipleAddressVersion) {
-		// Send a reject message indicating the protocol version is
-		// obsolete and wait for the message to be sent before
-		// disconnecting.
-		reason := fmt.Sprintf("protocol version must be %d or greater",
-			wire.MultipleAddressVersion)
-		rejectMsg := wire.NewMsgReject(msg.Command(), wire.RejectObsolete,
-			reason)
-		return p.writeMessage(rejectMsg)
+	// Notify and disconnect peers which do not satisfy the admission
+	// rules.
+	if err := p.checkAdmission(msg); err != nil {
+		return p.rejectHandshake(msg.Command(), err)
 	}
 
 	// Updating a bunch of stats.
@@ -1081,9 +1259,33 @@ func (p *Peer) handlePongMsg(msg *wire.MsgPong) {
 
 // readMessage reads the next bitcoin message from the peer with logging.
 func (p *Peer) readMessage() (wire.Message, []byte, error) {
-	n, msg, buf, err := wire.ReadMessageN(p.conn, p.ProtocolVersion(),
-		p.cfg.ChainParams.Net)
+	// Keep a copy of the raw bytes of the message when it is captured.
+	r := io.Reader(p.conn)
+	capture := p.Capture()
+	var raw bytes.Buffer
+	if capture != nil {
+		r = io.TeeReader(p.conn, &raw)
+	}
+
+	pver := p.messageProtocolVersion()
+	n, msg, buf, err := wire.ReadMessageWithLimitsN(r, pver,
+		p.cfg.ChainParams.Net, p.cfg.MaxPayloadOverrides)
 	atomic.AddUint64(&p.bytesReceived, uint64(n))
+	if capture != nil && raw.Len() > 0 {
+		capture.Record(CaptureInbound, pver, raw.Bytes())
+	}
+	if p.cfg.EventLog != nil && msg != nil {
+		p.cfg.EventLog.Record(p.ID(), CaptureInbound, msg.Command(), n)
+	}
+	if msgBlock, ok := msg.(*wire.MsgBlock); ok && p.cfg.StrictBlockDecoding {
+		if cerr := wire.CheckCanonicalBlock(msgBlock, buf); cerr != nil {
+			msg, buf = nil, nil
+			err = &wire.MessageError{
+				Func:        "readMessage",
+				Description: cerr.Error(),
+			}
+		}
+	}
 	if p.cfg.Listeners.OnRead != nil {
 		p.cfg.Listeners.OnRead(p, n, msg, err)
 	}
@@ -1143,10 +1345,23 @@ func (p *Peer) writeMessage(msg wire.Message) error {
 		return spew.Sdump(buf.Bytes())
 	}))
 
-	// Write the message to the peer.
-	n, err := wire.WriteMessageN(p.conn, msg, p.ProtocolVersion(),
-		p.cfg.ChainParams.Net)
+	// Write the message to the peer, keeping a copy of the raw bytes of
+	// the message when it is captured.
+	w := io.Writer(p.conn)
+	capture := p.Capture()
+	var raw bytes.Buffer
+	if capture != nil {
+		w = io.MultiWriter(p.conn, &raw)
+	}
+	pver := p.messageProtocolVersion()
+	n, err := wire.WriteMessageN(w, msg, pver, p.cfg.ChainParams.Net)
 	atomic.AddUint64(&p.bytesSent, uint64(n))
+	if capture != nil && raw.Len() > 0 {
+		capture.Record(CaptureOutbound, pver, raw.Bytes())
+	}
+	if p.cfg.EventLog != nil && err == nil {
+		p.cfg.EventLog.Record(p.ID(), CaptureOutbound, msg.Command(), n)
+	}
 	if p.cfg.Listeners.OnWrite != nil {
 		p.cfg.Listeners.OnWrite(p, n, msg, err)
 	}
@@ -1432,10 +1647,16 @@ out:
 				// the message to be sent before disconnecting.
 				//
 				// NOTE: Ideally this would include the command in the header if
-				// at least that much of the message was valid, but that is not
-				// currently exposed by wire, so just used malformed for the
-				// command.
-				p.PushRejectMsg("malformed", wire.RejectMalformed, errMsg, nil,
+				// at least that much of the message was valid, but that is only
+				// exposed by wire for oversized messages, so just use malformed
+				// for the command otherwise.
+				command := "malformed"
+				if msgErr, ok := err.(*wire.MessageError); ok &&
+					msgErr.PayloadSize != 0 {
+
+					command = msgErr.Command
+				}
+				p.PushRejectMsg(command, wire.RejectMalformed, errMsg, nil,
 					true)
 			}
 			break out
@@ -1606,7 +1827,7 @@ out:
 func (p *Peer) queueHandler() {
 	pendingMsgs := list.New()
 	invSendQueue := list.New()
-	trickleTicker := time.NewTicker(trickleTimeout)
+	trickleTicker := time.NewTicker(p.cfg.TrickleInterval)
 	defer trickleTicker.Stop()
 
 	// We keep the waiting flag so that we know if we have a message queued
@@ -1678,7 +1899,7 @@ out:
 				}
 
 				invMsg.AddInvVect(iv)
-				if len(invMsg.InvList) >= maxInvTrickleSize {
+				if len(invMsg.InvList) >= p.cfg.MaxInvTrickleSize {
 					waiting = queuePacket(
 						outMsg{msg: invMsg},
 						pendingMsgs, waiting)
@@ -1879,6 +2100,29 @@ func (p *Peer) QueueInventory(invVect *wire.InvVect) {
 	p.outputInvChan <- invVect
 }
 
+// QueueInventoryImmediate adds the passed inventory to the send queue to be
+// sent right away in an inventory message of its own rather than trickled to
+// the peer in batches.  Inventory that the peer is already known to have is
+// ignored.
+//
+// This function is safe for concurrent access.
+func (p *Peer) QueueInventoryImmediate(invVect *wire.InvVect) {
+	// Don't send the inventory if the peer is already known to have it.
+	if p.knownInventory.Exists(invVect) {
+		return
+	}
+
+	// Avoid risk of deadlock if goroutine already exited.
+	if !p.Connected() {
+		return
+	}
+
+	p.AddKnownInventory(invVect)
+	invMsg := wire.NewMsgInvSizeHint(1)
+	invMsg.AddInvVect(invVect)
+	p.QueueMessage(invMsg, nil)
+}
+
 // AssociateConnection associates the given conn to the peer.   Calling this
 // function when the peer is already connected will have no effect.
 func (p *Peer) AssociateConnection(conn net.Conn) {
@@ -1985,9 +2229,16 @@ func (p *Peer) WaitForDisconnect() {
 // peer.  If the next message is not a version message or the version is not
 // acceptable then return an error.
 func (p *Peer) readRemoteVersionMsg() error {
-	// Read their version message.
+	// Read their version message.  Peers which send messages for another
+	// network or which are malformed are told why they are rejected.
 	msg, _, err := p.readMessage()
 	if err != nil {
+		if msgErr, ok := err.(*wire.MessageError); ok {
+			return p.rejectHandshake(wire.CmdVersion, &AdmissionError{
+				Code:   wire.RejectMalformed,
+				Reason: msgErr.Description,
+			})
+		}
 		return err
 	}
 
@@ -1996,9 +2247,10 @@ func (p *Peer) readRemoteVersionMsg() error {
 		errStr := "A version message must precede all others"
 		log.Errorf(errStr)
 
-		rejectMsg := wire.NewMsgReject(msg.Command(), wire.RejectMalformed,
-			errStr)
-		return p.writeMessage(rejectMsg)
+		return p.rejectHandshake(msg.Command(), &AdmissionError{
+			Code:   wire.RejectMalformed,
+			Reason: errStr,
+		})
 	}
 
 	if err := p.handleRemoteVersionMsg(remoteVerMsg); err != nil {
@@ -2061,19 +2313,37 @@ func newPeerBase(origCfg *Config, inbound bool) *Peer {
 		cfg.ProtocolVersion = MaxProtocolVersion
 	}
 
+	// Default to rejecting peers which don't support multiple addresses per
+	// message if the caller did not specify a minimum protocol version.
+	if cfg.MinProtocolVersion == 0 {
+		cfg.MinProtocolVersion = wire.MultipleAddressVersion
+	}
+
 	// Set the chain parameters to testnet if the caller did not specify any.
 	if cfg.ChainParams == nil {
 		cfg.ChainParams = &chaincfg.TestNetParams
 	}
 
+	// Default the inventory trickling and the output queues if the caller
+	// did not specify them.
+	if cfg.TrickleInterval <= 0 {
+		cfg.TrickleInterval = DefaultTrickleInterval(cfg.ChainParams)
+	}
+	if cfg.MaxInvTrickleSize <= 0 {
+		cfg.MaxInvTrickleSize = maxInvTrickleSize
+	}
+	if cfg.OutputQueueSize <= 0 {
+		cfg.OutputQueueSize = outputBufferSize
+	}
+
 	p := Peer{
 		inbound:         inbound,
 		knownInventory:  newMruInventoryMap(maxKnownInventory),
 		stallControl:    make(chan stallControlMsg, 1), // nonblocking sync
-		outputQueue:     make(chan outMsg, outputBufferSize),
+		outputQueue:     make(chan outMsg, cfg.OutputQueueSize),
 		sendQueue:       make(chan outMsg, 1),   // nonblocking sync
 		sendDoneQueue:   make(chan struct{}, 1), // nonblocking sync
-		outputInvChan:   make(chan *wire.InvVect, outputBufferSize),
+		outputInvChan:   make(chan *wire.InvVect, cfg.OutputQueueSize),
 		inQuit:          make(chan struct{}),
 		queueQuit:       make(chan struct{}),
 		outQuit:         make(chan struct{}),
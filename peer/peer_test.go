@@ -9,7 +9,9 @@ import (
 	"errors"
 	"io"
 	"net"
+	"regexp"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -578,6 +580,7 @@ func TestOutboundPeer(t *testing.T) {
 	p.QueueInventory(fakeInv)
 	p.AddKnownInventory(fakeInv)
 	p.QueueInventory(fakeInv)
+	p.QueueInventoryImmediate(fakeInv)
 
 	fakeMsg := wire.NewMsgVerAck()
 	p.QueueMessage(fakeMsg, nil)
@@ -622,6 +625,7 @@ func TestOutboundPeer(t *testing.T) {
 
 	// Test Queue Inv after connection
 	p1.QueueInventory(fakeInv)
+	p1.QueueInventoryImmediate(fakeInv)
 	p1.Disconnect()
 
 	// Test regression
@@ -669,6 +673,353 @@ func TestOutboundPeer(t *testing.T) {
 	p2.Disconnect()
 }
 
+// TestPeerAdmission ensures remote peers which advertise a protocol version
+// that is too old, a rejected user agent, or lack the required services, and
+// remote peers on another network, are sent a reject message with the reason
+// and disconnected during the version handshake without their version being
+// negotiated, while peers satisfying the admission rules connect.
+func TestPeerAdmission(t *testing.T) {
+	peerCfg := &peer.Config{
+		UserAgentName:      "peer",
+		UserAgentVersion:   "1.0",
+		ChainParams:        &chaincfg.MainNetParams,
+		MinProtocolVersion: wire.SendHeadersVersion,
+		RequiredServices:   wire.SFNodeNetwork,
+		RejectUserAgents: []*regexp.Regexp{
+			regexp.MustCompile(`^/buggyfork:0\.1\.`),
+		},
+	}
+	tests := []struct {
+		name       string
+		inbound    bool
+		pver       uint32
+		services   wire.ServiceFlag
+		userAgent  string
+		btcnet     wire.BitcoinNet
+		wantReject bool
+		wantCode   wire.RejectCode
+		wantReason string
+	}{
+		{
+			name:      "admitted outbound",
+			pver:      wire.SendHeadersVersion,
+			services:  wire.SFNodeNetwork,
+			userAgent: "/buggyfork:0.2.0/",
+			btcnet:    wire.MainNet,
+		},
+		{
+			name:      "admitted inbound without services",
+			inbound:   true,
+			pver:      peer.MaxProtocolVersion,
+			userAgent: "/prova:0.1.0/",
+			btcnet:    wire.MainNet,
+		},
+		{
+			name:       "obsolete protocol version",
+			pver:       wire.BIP0111Version,
+			services:   wire.SFNodeNetwork,
+			userAgent:  "/prova:0.1.0/",
+			btcnet:     wire.MainNet,
+			wantReject: true,
+			wantCode:   wire.RejectObsolete,
+			wantReason: "protocol version must be 70012 or greater",
+		},
+		{
+			name:       "rejected user agent",
+			inbound:    true,
+			pver:       peer.MaxProtocolVersion,
+			userAgent:  "/buggyfork:0.1.3/",
+			btcnet:     wire.MainNet,
+			wantReject: true,
+			wantCode:   wire.RejectNonstandard,
+			wantReason: "user agent /buggyfork:0.1.3/ is not allowed",
+		},
+		{
+			name:       "missing required services",
+			pver:       peer.MaxProtocolVersion,
+			services:   wire.SFNodeBloom,
+			userAgent:  "/prova:0.1.0/",
+			btcnet:     wire.MainNet,
+			wantReject: true,
+			wantCode:   wire.RejectNonstandard,
+			wantReason: "services must include SFNodeNetwork, got SFNodeBloom",
+		},
+		{
+			name:       "other network",
+			inbound:    true,
+			pver:       peer.MaxProtocolVersion,
+			userAgent:  "/prova:0.1.0/",
+			btcnet:     wire.TestNet,
+			wantReject: true,
+			wantCode:   wire.RejectMalformed,
+			wantReason: "message from other network",
+		},
+	}
+
+	for _, test := range tests {
+		localConn, remoteConn := pipe(
+			&conn{raddr: "10.0.0.2:8333"},
+			&conn{raddr: "10.0.0.1:8333"},
+		)
+		var p *peer.Peer
+		if test.inbound {
+			p = peer.NewInboundPeer(peerCfg)
+		} else {
+			var err error
+			p, err = peer.NewOutboundPeer(peerCfg, "10.0.0.2:8333")
+			if err != nil {
+				t.Fatalf("%s: NewOutboundPeer: unexpected err %v",
+					test.name, err)
+			}
+		}
+		p.AssociateConnection(localConn)
+
+		// Act as the remote peer by reading the version message of
+		// outbound peers, which send theirs first, then sending ours
+		// and collecting the replies until the handshake completes or
+		// is rejected.
+		replies := make(chan wire.Message, 3)
+		go func() {
+			defer close(replies)
+			pver := peer.MaxProtocolVersion
+			if !test.inbound {
+				_, _, err := wire.ReadMessage(remoteConn, pver,
+					wire.MainNet)
+				if err != nil {
+					return
+				}
+			}
+			na := wire.NewNetAddressIPPort(net.ParseIP("10.0.0.1"),
+				8333, test.services)
+			msg := wire.NewMsgVersion(na, na, 1, 0)
+			msg.ProtocolVersion = int32(test.pver)
+			msg.Services = test.services
+			msg.UserAgent = test.userAgent
+			err := wire.WriteMessage(remoteConn, msg, test.pver,
+				test.btcnet)
+			if err != nil {
+				return
+			}
+			for {
+				reply, _, err := wire.ReadMessage(remoteConn, pver,
+					wire.MainNet)
+				if err != nil {
+					return
+				}
+				replies <- reply
+				switch reply.(type) {
+				case *wire.MsgVerAck, *wire.MsgReject:
+					return
+				}
+			}
+		}()
+
+		var reply wire.Message
+		for reply == nil {
+			select {
+			case msg, ok := <-replies:
+				if !ok {
+					t.Fatalf("%s: remote peer stopped", test.name)
+				}
+				if _, ok := msg.(*wire.MsgVersion); !ok {
+					reply = msg
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatalf("%s: timed out waiting for reply", test.name)
+			}
+		}
+
+		if !test.wantReject {
+			if _, ok := reply.(*wire.MsgVerAck); !ok {
+				t.Errorf("%s: got %v, want verack", test.name,
+					reply.Command())
+			}
+			wantPver := test.pver
+			if wantPver > peer.MaxProtocolVersion {
+				wantPver = peer.MaxProtocolVersion
+			}
+			if !p.VersionKnown() || p.ProtocolVersion() != wantPver ||
+				p.Services() != test.services {
+
+				t.Errorf("%s: got negotiated version %d and "+
+					"services %v, want %d and %v", test.name,
+					p.ProtocolVersion(), p.Services(), wantPver,
+					test.services)
+			}
+			p.Disconnect()
+			p.WaitForDisconnect()
+			continue
+		}
+
+		reject, ok := reply.(*wire.MsgReject)
+		if !ok {
+			t.Errorf("%s: got %v, want reject", test.name,
+				reply.Command())
+			continue
+		}
+		if reject.Cmd != wire.CmdVersion || reject.Code != test.wantCode ||
+			!strings.Contains(reject.Reason, test.wantReason) {
+
+			t.Errorf("%s: got reject %v %v %q, want %v %v %q",
+				test.name, reject.Cmd, reject.Code, reject.Reason,
+				wire.CmdVersion, test.wantCode, test.wantReason)
+		}
+
+		// Rejected peers are disconnected before their version is
+		// negotiated.
+		disconnected := make(chan struct{})
+		go func() {
+			p.WaitForDisconnect()
+			close(disconnected)
+		}()
+		select {
+		case <-disconnected:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("%s: rejected peer was not disconnected",
+				test.name)
+		}
+		if p.VersionKnown() {
+			t.Errorf("%s: version of rejected peer negotiated",
+				test.name)
+		}
+	}
+}
+
+// TestDefaultTrickleInterval ensures the default trickle interval is
+// proportional to the target time per block and bounded.
+func TestDefaultTrickleInterval(t *testing.T) {
+	tests := []struct {
+		blockTime time.Duration
+		want      time.Duration
+	}{
+		{time.Minute * 10, time.Second * 2},
+		{time.Minute * 60, time.Second * 2},
+		{time.Second * 150, time.Millisecond * 500},
+		{time.Minute, time.Millisecond * 200},
+		{time.Second, time.Millisecond * 100},
+	}
+	for _, test := range tests {
+		params := chaincfg.RegressionNetParams
+		params.TargetTimePerBlock = test.blockTime
+		got := peer.DefaultTrickleInterval(&params)
+		if got != test.want {
+			t.Errorf("DefaultTrickleInterval(%v): got %v, want %v",
+				test.blockTime, got, test.want)
+		}
+	}
+}
+
+// TestInventoryTrickle ensures queued inventory is only sent when the trickle
+// ticker fires, in batches of at most the configured size, while inventory
+// queued to be sent immediately bypasses the ticker.
+func TestInventoryTrickle(t *testing.T) {
+	// connect returns an outbound peer with the passed trickle interval and
+	// batch size which completed the handshake with an inbound peer, along
+	// with the inventory messages the inbound peer receives.
+	connect := func(interval time.Duration, batchSize int) (*peer.Peer, <-chan *wire.MsgInv) {
+		verack := make(chan struct{}, 2)
+		invs := make(chan *wire.MsgInv, 10)
+		inCfg := &peer.Config{
+			Listeners: peer.MessageListeners{
+				OnInv: func(p *peer.Peer, msg *wire.MsgInv) {
+					invs <- msg
+				},
+				OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+					verack <- struct{}{}
+				},
+			},
+			UserAgentName:    "peer",
+			UserAgentVersion: "1.0",
+			ChainParams:      &chaincfg.MainNetParams,
+		}
+		outCfg := &peer.Config{
+			Listeners: peer.MessageListeners{
+				OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+					verack <- struct{}{}
+				},
+			},
+			UserAgentName:     "peer",
+			UserAgentVersion:  "1.0",
+			ChainParams:       &chaincfg.MainNetParams,
+			TrickleInterval:   interval,
+			MaxInvTrickleSize: batchSize,
+		}
+		inConn, outConn := pipe(
+			&conn{raddr: "10.0.0.1:8333"},
+			&conn{raddr: "10.0.0.2:8333"},
+		)
+		inPeer := peer.NewInboundPeer(inCfg)
+		inPeer.AssociateConnection(inConn)
+		outPeer, err := peer.NewOutboundPeer(outCfg, "10.0.0.1:8333")
+		if err != nil {
+			t.Fatalf("NewOutboundPeer: unexpected err %v", err)
+		}
+		outPeer.AssociateConnection(outConn)
+		for i := 0; i < 2; i++ {
+			select {
+			case <-verack:
+			case <-time.After(time.Second * 5):
+				t.Fatalf("verack timeout")
+			}
+		}
+		return outPeer, invs
+	}
+	invVect := func(i int) *wire.InvVect {
+		return wire.NewInvVect(wire.InvTypeTx, &chainhash.Hash{byte(i)})
+	}
+
+	// The queued inventory is trickled in order in batches of at most the
+	// configured size.
+	outPeer, invs := connect(time.Millisecond*50, 2)
+	for i := 0; i < 5; i++ {
+		outPeer.QueueInventory(invVect(i))
+	}
+	var next int
+	for next < 5 {
+		select {
+		case msg := <-invs:
+			if len(msg.InvList) > 2 {
+				t.Fatalf("got inv with %d entries, want at most 2",
+					len(msg.InvList))
+			}
+			for _, iv := range msg.InvList {
+				if *iv != *invVect(next) {
+					t.Fatalf("got inventory %v, want %v", iv,
+						invVect(next))
+				}
+				next++
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timed out waiting for trickled inventory")
+		}
+	}
+	outPeer.Disconnect()
+	outPeer.WaitForDisconnect()
+
+	// Inventory queued to be sent immediately is sent without waiting for
+	// the next tick, while the trickled inventory waits for it.
+	outPeer, invs = connect(time.Hour, 2)
+	outPeer.QueueInventory(invVect(0))
+	outPeer.QueueInventoryImmediate(invVect(1))
+	select {
+	case msg := <-invs:
+		if len(msg.InvList) != 1 || *msg.InvList[0] != *invVect(1) {
+			t.Fatalf("got inv %v, want the immediate inventory only",
+				msg.InvList)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("timed out waiting for immediate inventory")
+	}
+	select {
+	case msg := <-invs:
+		t.Fatalf("got inv %v before the trickle interval elapsed",
+			msg.InvList)
+	case <-time.After(time.Millisecond * 200):
+	}
+	outPeer.Disconnect()
+	outPeer.WaitForDisconnect()
+}
+
 func init() {
 	// Allow self connection when running the tests.
 	peer.TstAllowSelfConns()
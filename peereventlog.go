@@ -0,0 +1,89 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/peer"
+)
+
+const (
+	// peerEventLogPrefix is the prefix of the names of the peer event log
+	// files.
+	peerEventLogPrefix = "events"
+
+	// peerEventLogFiles is the number of files the disk budget of the peer
+	// event log is split into, so the oldest events are removed in chunks
+	// of this fraction of the budget.
+	peerEventLogFiles = 8
+)
+
+// newPeerEventLog returns the event log which counts the messages exchanged
+// with all peers and, when the peereventlog option is set, writes them to the
+// peer event log files.
+func newPeerEventLog() (*peer.EventLog, error) {
+	if !cfg.PeerEventLog {
+		return peer.NewEventLog(nil)
+	}
+
+	maxTotalSize := cfg.PeerEventLogMaxSize * 1024 * 1024
+	eventLog, err := peer.NewEventLog(&peer.EventLogConfig{
+		Dir:          cfg.PeerEventLogDir,
+		Prefix:       peerEventLogPrefix,
+		MaxFileSize:  maxTotalSize / peerEventLogFiles,
+		MaxTotalSize: maxTotalSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	srvrLog.Infof("Writing peer event log to %s-*.evt", eventLog.Prefix())
+	return eventLog, nil
+}
+
+// closePeerEventLog closes the passed peer event log and logs the number of
+// events which could not be written.
+func closePeerEventLog(eventLog *peer.EventLog) {
+	if err := eventLog.Close(); err != nil {
+		srvrLog.Errorf("Unable to write peer event log: %v", err)
+	}
+	if dropped := eventLog.Dropped(); dropped > 0 {
+		srvrLog.Warnf("Dropped %d events of the peer event log", dropped)
+	}
+}
+
+// writePeerMessageMetrics writes the number of messages exchanged with all
+// peers and their total size in bytes by command and direction to the passed
+// writer in the Prometheus text exposition format.
+func writePeerMessageMetrics(w io.Writer, eventLog *peer.EventLog) error {
+	totals := eventLog.Totals()
+
+	var buf bytes.Buffer
+	buf.WriteString("# HELP prova_peer_messages_total Number of messages " +
+		"exchanged with peers by command and direction.\n")
+	buf.WriteString("# TYPE prova_peer_messages_total counter\n")
+	for _, t := range totals {
+		fmt.Fprintf(&buf, "prova_peer_messages_total{command=%q,"+
+			"direction=\"received\"} %d\n", t.Command, t.MsgsReceived)
+		fmt.Fprintf(&buf, "prova_peer_messages_total{command=%q,"+
+			"direction=\"sent\"} %d\n", t.Command, t.MsgsSent)
+	}
+
+	buf.WriteString("# HELP prova_peer_message_bytes_total Total size in " +
+		"bytes of the messages exchanged with peers by command and " +
+		"direction.\n")
+	buf.WriteString("# TYPE prova_peer_message_bytes_total counter\n")
+	for _, t := range totals {
+		fmt.Fprintf(&buf, "prova_peer_message_bytes_total{command=%q,"+
+			"direction=\"received\"} %d\n", t.Command, t.BytesReceived)
+		fmt.Fprintf(&buf, "prova_peer_message_bytes_total{command=%q,"+
+			"direction=\"sent\"} %d\n", t.Command, t.BytesSent)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
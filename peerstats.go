@@ -0,0 +1,411 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bitgo/prova/database"
+)
+
+const (
+	// defaultMaxPeerStats is the default number of peers statistics are
+	// persisted for.  Once exceeded, the peers which were connected to least
+	// recently are dropped.
+	defaultMaxPeerStats = 1000
+
+	// maxPeerBanScoreHistory is the number of most recent misbehavior
+	// scores kept for each peer.
+	maxPeerBanScoreHistory = 8
+
+	// peerStatsHeaderSize is the size of the fixed portion of a serialized
+	// peer stats entry.  It consists of the bytes sent, bytes received,
+	// blocks served, blocks received, and number of connections as uint64s,
+	// the last connection time as an int64, and the number of misbehavior
+	// scores which follow as a byte.
+	peerStatsHeaderSize = 8*6 + 1
+
+	// peerBanScoreSize is the size of a serialized misbehavior score.  It
+	// consists of the time it was recorded as an int64 followed by the
+	// score as a uint32.
+	peerBanScoreSize = 8 + 4
+)
+
+var (
+	// peerStatsBucketName is the name of the database bucket used to house
+	// the persisted peer statistics keyed by peer address.  It lives in the
+	// block database rather than alongside the address manager state so
+	// the statistics survive resets of the latter.
+	peerStatsBucketName = []byte("peerstats")
+
+	// errDeserializePeerStats is returned when a persisted peer stats entry
+	// is malformed.
+	errDeserializePeerStats = errors.New("malformed peer stats entry")
+)
+
+// peerBanScore is a misbehavior score a peer had when it disconnected.
+type peerBanScore struct {
+	recorded time.Time
+	score    uint32
+}
+
+// peerStats houses the cumulative statistics of a peer across all of its
+// connections.
+type peerStats struct {
+	addr           string
+	bytesSent      uint64
+	bytesReceived  uint64
+	blocksServed   uint64
+	blocksReceived uint64
+	connections    uint64
+	lastConnected  time.Time
+	banScores      []peerBanScore
+}
+
+// poorService returns whether or not the peer misbehaved enough during its
+// most recent connection to have been warned about, which is half of the
+// passed ban threshold.
+func (ps *peerStats) poorService(banThreshold uint32) bool {
+	if len(ps.banScores) == 0 {
+		return false
+	}
+	return ps.banScores[len(ps.banScores)-1].score > banThreshold>>1
+}
+
+// serializePeerStats returns the serialized form of the passed peer stats
+// suitable for storage in the database.  The address is not included since it
+// is the key of the entry.
+func serializePeerStats(ps *peerStats) []byte {
+	serialized := make([]byte, peerStatsHeaderSize+
+		len(ps.banScores)*peerBanScoreSize)
+	byteOrder := binary.LittleEndian
+	byteOrder.PutUint64(serialized[0:8], ps.bytesSent)
+	byteOrder.PutUint64(serialized[8:16], ps.bytesReceived)
+	byteOrder.PutUint64(serialized[16:24], ps.blocksServed)
+	byteOrder.PutUint64(serialized[24:32], ps.blocksReceived)
+	byteOrder.PutUint64(serialized[32:40], ps.connections)
+	byteOrder.PutUint64(serialized[40:48], uint64(ps.lastConnected.Unix()))
+	serialized[48] = uint8(len(ps.banScores))
+	offset := peerStatsHeaderSize
+	for _, bs := range ps.banScores {
+		byteOrder.PutUint64(serialized[offset:], uint64(bs.recorded.Unix()))
+		byteOrder.PutUint32(serialized[offset+8:], bs.score)
+		offset += peerBanScoreSize
+	}
+	return serialized
+}
+
+// deserializePeerStats decodes the passed serialized peer stats entry for the
+// peer with the passed address.
+func deserializePeerStats(addr string, serialized []byte) (*peerStats, error) {
+	if len(serialized) < peerStatsHeaderSize {
+		return nil, errDeserializePeerStats
+	}
+	numBanScores := int(serialized[48])
+	if len(serialized) != peerStatsHeaderSize+numBanScores*peerBanScoreSize {
+		return nil, errDeserializePeerStats
+	}
+
+	byteOrder := binary.LittleEndian
+	ps := &peerStats{
+		addr:           addr,
+		bytesSent:      byteOrder.Uint64(serialized[0:8]),
+		bytesReceived:  byteOrder.Uint64(serialized[8:16]),
+		blocksServed:   byteOrder.Uint64(serialized[16:24]),
+		blocksReceived: byteOrder.Uint64(serialized[24:32]),
+		connections:    byteOrder.Uint64(serialized[32:40]),
+		lastConnected: time.Unix(int64(byteOrder.Uint64(
+			serialized[40:48])), 0),
+		banScores: make([]peerBanScore, 0, numBanScores),
+	}
+	offset := peerStatsHeaderSize
+	for i := 0; i < numBanScores; i++ {
+		ps.banScores = append(ps.banScores, peerBanScore{
+			recorded: time.Unix(int64(byteOrder.Uint64(
+				serialized[offset:])), 0),
+			score: byteOrder.Uint32(serialized[offset+8:]),
+		})
+		offset += peerBanScoreSize
+	}
+	return ps, nil
+}
+
+// peerSession houses the statistics of a single connection to a peer.
+type peerSession struct {
+	connected      time.Time
+	bytesSent      uint64
+	bytesReceived  uint64
+	blocksServed   uint64
+	blocksReceived uint64
+	banScore       uint32
+}
+
+// newPeerSession returns the statistics of the connection to the passed peer.
+func newPeerSession(sp *serverPeer) *peerSession {
+	return &peerSession{
+		connected:      sp.TimeConnected(),
+		bytesSent:      sp.BytesSent(),
+		bytesReceived:  sp.BytesReceived(),
+		blocksServed:   sp.BlocksServed(),
+		blocksReceived: sp.BlocksReceived(),
+		banScore:       sp.banScore.Int(),
+	}
+}
+
+// peerStatsStore persists the cumulative statistics of peers across restarts.
+// The statistics are updated each time a peer disconnects and are capped to
+// the peers which were connected to most recently.
+type peerStatsStore struct {
+	sync.Mutex
+	db         database.DB
+	maxEntries int
+	stats      map[string]*peerStats
+}
+
+// newPeerStatsStore returns a peer stats store backed by the passed database
+// which persists the statistics of at most the passed number of peers.  The
+// existing statistics are loaded from the database.  When the database is
+// read-only, the statistics are loaded as is without discarding malformed or
+// excess entries.
+func newPeerStatsStore(db database.DB, maxEntries int, readOnly bool) (*peerStatsStore, error) {
+	s := &peerStatsStore{
+		db:         db,
+		maxEntries: maxEntries,
+		stats:      make(map[string]*peerStats),
+	}
+	if readOnly {
+		err := db.View(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(peerStatsBucketName)
+			if bucket == nil {
+				return nil
+			}
+			_, err := s.load(bucket)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return s, nil
+	}
+
+	err := db.Update(func(dbTx database.Tx) error {
+		bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+			peerStatsBucketName)
+		if err != nil {
+			return err
+		}
+
+		// Drop malformed entries rather than failing to start since the
+		// statistics are purely informational.
+		malformed, err := s.load(bucket)
+		if err != nil {
+			return err
+		}
+		for _, k := range malformed {
+			peerLog.Warnf("Discarding malformed statistics for peer %s",
+				k)
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return s.prune(bucket)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// load reads the statistics of all peers from the passed bucket into the store
+// and returns the keys of the entries which could not be deserialized.
+//
+// This function MUST be called before the store is shared.
+func (s *peerStatsStore) load(bucket database.Bucket) ([][]byte, error) {
+	var malformed [][]byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		ps, err := deserializePeerStats(string(k), v)
+		if err != nil {
+			malformed = append(malformed, append([]byte(nil), k...))
+			return nil
+		}
+		s.stats[ps.addr] = ps
+		return nil
+	})
+	return malformed, err
+}
+
+// prune removes the statistics of the peers which were connected to least
+// recently until no more than the maximum number of entries remain.
+//
+// This function MUST be called with the store lock held (for writes) or before
+// the store is shared.
+func (s *peerStatsStore) prune(bucket database.Bucket) error {
+	if len(s.stats) <= s.maxEntries {
+		return nil
+	}
+
+	entries := make([]*peerStats, 0, len(s.stats))
+	for _, ps := range s.stats {
+		entries = append(entries, ps)
+	}
+	sortPeerStats(entries, "lastconnected")
+	for _, ps := range entries[s.maxEntries:] {
+		if err := bucket.Delete([]byte(ps.addr)); err != nil {
+			return err
+		}
+		delete(s.stats, ps.addr)
+	}
+	return nil
+}
+
+// Record adds the statistics of a finished connection to the peer with the
+// passed address to its cumulative statistics and persists the result.
+//
+// This function is safe for concurrent access.
+func (s *peerStatsStore) Record(addr string, session *peerSession) error {
+	s.Lock()
+	defer s.Unlock()
+
+	ps, ok := s.stats[addr]
+	if !ok {
+		ps = &peerStats{addr: addr}
+	}
+	updated := *ps
+	updated.bytesSent += session.bytesSent
+	updated.bytesReceived += session.bytesReceived
+	updated.blocksServed += session.blocksServed
+	updated.blocksReceived += session.blocksReceived
+	updated.connections++
+	updated.lastConnected = session.connected
+	if session.banScore > 0 {
+		banScores := make([]peerBanScore, 0, maxPeerBanScoreHistory)
+		if len(ps.banScores) >= maxPeerBanScoreHistory {
+			banScores = append(banScores, ps.banScores[len(ps.banScores)-
+				maxPeerBanScoreHistory+1:]...)
+		} else {
+			banScores = append(banScores, ps.banScores...)
+		}
+		updated.banScores = append(banScores, peerBanScore{
+			recorded: time.Now(),
+			score:    session.banScore,
+		})
+	}
+
+	return s.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(peerStatsBucketName)
+		err := bucket.Put([]byte(addr), serializePeerStats(&updated))
+		if err != nil {
+			return err
+		}
+		s.stats[addr] = &updated
+		return s.prune(bucket)
+	})
+}
+
+// PoorService returns whether or not the peer with the passed address has a
+// record of misbehaving as determined by the passed ban threshold.  Peers
+// without any statistics are not considered to provide poor service.
+//
+// This function is safe for concurrent access.
+func (s *peerStatsStore) PoorService(addr string, banThreshold uint32) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	ps, ok := s.stats[addr]
+	return ok && ps.poorService(banThreshold)
+}
+
+// Stats returns a copy of the statistics of all peers sorted by the passed
+// field in descending order.
+//
+// This function is safe for concurrent access.
+func (s *peerStatsStore) Stats(sortBy string) []peerStats {
+	s.Lock()
+	entries := make([]*peerStats, 0, len(s.stats))
+	for _, ps := range s.stats {
+		entries = append(entries, ps)
+	}
+	s.Unlock()
+
+	sortPeerStats(entries, sortBy)
+	stats := make([]peerStats, 0, len(entries))
+	for _, ps := range entries {
+		stats = append(stats, *ps)
+	}
+	return stats
+}
+
+// peerStatsSortKeys maps the fields peer statistics can be sorted by to a
+// function which returns the value of the field.
+var peerStatsSortKeys = map[string]func(ps *peerStats) int64{
+	"lastconnected": func(ps *peerStats) int64 {
+		return ps.lastConnected.Unix()
+	},
+	"bytessent": func(ps *peerStats) int64 {
+		return int64(ps.bytesSent)
+	},
+	"bytesrecv": func(ps *peerStats) int64 {
+		return int64(ps.bytesReceived)
+	},
+	"blocksserved": func(ps *peerStats) int64 {
+		return int64(ps.blocksServed)
+	},
+	"blocksreceived": func(ps *peerStats) int64 {
+		return int64(ps.blocksReceived)
+	},
+	"connections": func(ps *peerStats) int64 {
+		return int64(ps.connections)
+	},
+	"banscore": func(ps *peerStats) int64 {
+		if len(ps.banScores) == 0 {
+			return 0
+		}
+		return int64(ps.banScores[len(ps.banScores)-1].score)
+	},
+}
+
+// peerStatsSorter implements sort.Interface to allow a slice of peer
+// statistics to be sorted in descending order of a field.  Ties are broken by
+// address so the order is stable.
+type peerStatsSorter struct {
+	entries []*peerStats
+	key     func(ps *peerStats) int64
+}
+
+// Len returns the number of peer statistics in the slice.  It is part of the
+// sort.Interface implementation.
+func (s peerStatsSorter) Len() int {
+	return len(s.entries)
+}
+
+// Swap swaps the peer statistics at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s peerStatsSorter) Swap(i, j int) {
+	s.entries[i], s.entries[j] = s.entries[j], s.entries[i]
+}
+
+// Less returns whether the peer statistics with index i should sort before the
+// peer statistics with index j.  It is part of the sort.Interface
+// implementation.
+func (s peerStatsSorter) Less(i, j int) bool {
+	vi, vj := s.key(s.entries[i]), s.key(s.entries[j])
+	if vi != vj {
+		return vi > vj
+	}
+	return s.entries[i].addr < s.entries[j].addr
+}
+
+// sortPeerStats sorts the passed peer statistics in descending order of the
+// passed field, which must be one of the keys of peerStatsSortKeys.
+func sortPeerStats(entries []*peerStats, sortBy string) {
+	sort.Sort(peerStatsSorter{entries: entries, key: peerStatsSortKeys[sortBy]})
+}
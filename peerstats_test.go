@@ -0,0 +1,225 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/database"
+	_ "github.com/bitgo/prova/database/ffldb"
+)
+
+// TestPeerStatsPersistence ensures the statistics of peers accumulate across
+// connections, survive a restart, are capped to the peers connected to most
+// recently, and are exposed by the getpeerstats RPC.
+func TestPeerStatsPersistence(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	tmpDir, err := ioutil.TempDir("", "peerstats")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	dbPath := filepath.Join(tmpDir, "ffldb")
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+
+	const maxEntries = 3
+	store, err := newPeerStatsStore(db, maxEntries, false)
+	if err != nil {
+		db.Close()
+		t.Fatalf("newPeerStatsStore: unexpected error: %v", err)
+	}
+
+	// Connect and disconnect a few fake peers, one of them twice and one
+	// of them misbehaving.
+	base := time.Unix(1500000000, 0)
+	sessions := []struct {
+		addr    string
+		session peerSession
+	}{
+		{"10.0.0.1:7979", peerSession{connected: base, bytesSent: 100,
+			bytesReceived: 1000, blocksReceived: 10}},
+		{"10.0.0.2:7979", peerSession{connected: base.Add(time.Minute),
+			bytesSent: 500, blocksServed: 5}},
+		{"10.0.0.1:7979", peerSession{connected: base.Add(2 * time.Minute),
+			bytesSent: 50, bytesReceived: 200, blocksReceived: 2,
+			banScore: 10}},
+		{"10.0.0.3:7979", peerSession{connected: base.Add(3 * time.Minute),
+			bytesReceived: 10, banScore: 80}},
+	}
+	for _, s := range sessions {
+		session := s.session
+		if err := store.Record(s.addr, &session); err != nil {
+			db.Close()
+			t.Fatalf("Record: unexpected error: %v", err)
+		}
+	}
+
+	// Restart by closing and reopening the database.
+	db.Close()
+	db, err = database.Open("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("unable to open db: %v", err)
+	}
+	defer db.Close()
+	store, err = newPeerStatsStore(db, maxEntries, false)
+	if err != nil {
+		t.Fatalf("newPeerStatsStore: unexpected error: %v", err)
+	}
+
+	stats := store.Stats("lastconnected")
+	if len(stats) != 3 {
+		t.Fatalf("Stats: got %d peers, want 3", len(stats))
+	}
+	want := peerStats{
+		addr:           "10.0.0.1:7979",
+		bytesSent:      150,
+		bytesReceived:  1200,
+		blocksReceived: 12,
+		connections:    2,
+		lastConnected:  base.Add(2 * time.Minute),
+	}
+	got := stats[1]
+	if len(got.banScores) != 1 || got.banScores[0].score != 10 {
+		t.Fatalf("Stats: got ban scores %v, want a single score of 10",
+			got.banScores)
+	}
+	got.banScores = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Stats: got %+v, want %+v", got, want)
+	}
+
+	// Only the misbehaving peer is considered to provide poor service.
+	if !store.PoorService("10.0.0.3:7979", 100) {
+		t.Fatalf("PoorService: misbehaving peer not reported")
+	}
+	for _, addr := range []string{"10.0.0.1:7979", "10.0.0.2:7979",
+		"10.0.0.9:7979"} {
+
+		if store.PoorService(addr, 100) {
+			t.Fatalf("PoorService: peer %s reported", addr)
+		}
+	}
+
+	// Exceeding the cap drops the peer connected to least recently.
+	session := peerSession{connected: base.Add(4 * time.Minute)}
+	if err := store.Record("10.0.0.4:7979", &session); err != nil {
+		t.Fatalf("Record: unexpected error: %v", err)
+	}
+	var addrs []string
+	for _, ps := range store.Stats("lastconnected") {
+		addrs = append(addrs, ps.addr)
+	}
+	wantAddrs := []string{"10.0.0.4:7979", "10.0.0.3:7979", "10.0.0.1:7979"}
+	if !reflect.DeepEqual(addrs, wantAddrs) {
+		t.Fatalf("Stats: got peers %v, want %v", addrs, wantAddrs)
+	}
+
+	// The RPC sorts by the requested field and limits the results.
+	rpcServer := &rpcServer{server: &server{peerStats: store}}
+	getPeerStats := func(sortBy string, count *int) ([]btcjson.GetPeerStatsResult, error) {
+		cmd := btcjson.NewGetPeerStatsCmd(&sortBy, count)
+		result, err := handleGetPeerStats(rpcServer, cmd, nil)
+		if err != nil {
+			return nil, err
+		}
+		return result.([]btcjson.GetPeerStatsResult), nil
+	}
+	results, err := getPeerStats("bytesrecv", btcjson.Int(2))
+	if err != nil {
+		t.Fatalf("getpeerstats: unexpected error: %v", err)
+	}
+	if len(results) != 2 || results[0].Addr != "10.0.0.1:7979" ||
+		results[0].BytesRecv != 1200 || results[1].Addr != "10.0.0.3:7979" {
+
+		t.Fatalf("getpeerstats: unexpected results %+v", results)
+	}
+	results, err = getPeerStats("banscore", nil)
+	if err != nil {
+		t.Fatalf("getpeerstats: unexpected error: %v", err)
+	}
+	if len(results) != 3 || results[0].Addr != "10.0.0.3:7979" ||
+		len(results[0].BanScores) != 1 ||
+		results[0].BanScores[0].Score != 80 {
+
+		t.Fatalf("getpeerstats: unexpected results %+v", results)
+	}
+	_, err = getPeerStats("bogus", nil)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCInvalidParameter {
+
+		t.Fatalf("getpeerstats: got error %v, want invalid parameter",
+			err)
+	}
+}
+
+// TestPeerStatsBanScoreHistory ensures only the most recent misbehavior scores
+// of a peer are kept.
+func TestPeerStatsBanScoreHistory(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	tmpDir, err := ioutil.TempDir("", "peerstats")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		params.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+
+	store, err := newPeerStatsStore(db, defaultMaxPeerStats, false)
+	if err != nil {
+		t.Fatalf("newPeerStatsStore: unexpected error: %v", err)
+	}
+	const addr = "10.0.0.1:7979"
+	for i := 1; i <= maxPeerBanScoreHistory+3; i++ {
+		session := peerSession{
+			connected: time.Unix(int64(i), 0),
+			banScore:  uint32(i),
+		}
+		if err := store.Record(addr, &session); err != nil {
+			t.Fatalf("Record: unexpected error: %v", err)
+		}
+	}
+
+	stats := store.Stats("lastconnected")
+	banScores := stats[0].banScores
+	if len(banScores) != maxPeerBanScoreHistory {
+		t.Fatalf("got %d ban scores, want %d", len(banScores),
+			maxPeerBanScoreHistory)
+	}
+	for i, bs := range banScores {
+		if want := uint32(i + 4); bs.score != want {
+			t.Fatalf("ban score %d: got %d, want %d", i, bs.score, want)
+		}
+	}
+
+	// The entries round trip through their serialized form.
+	serialized := serializePeerStats(&stats[0])
+	ps, err := deserializePeerStats(addr, serialized)
+	if err != nil {
+		t.Fatalf("deserializePeerStats: unexpected error: %v", err)
+	}
+	if reserialized := serializePeerStats(ps); !bytes.Equal(reserialized,
+		serialized) {
+
+		t.Fatalf("round trip: got %x, want %x", reserialized, serialized)
+	}
+	if _, err := deserializePeerStats(addr, []byte{0x00}); err == nil {
+		t.Fatalf("deserializePeerStats: accepted malformed entry")
+	}
+}
@@ -0,0 +1,477 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+)
+
+const (
+	// processingJournalFilename is the name of the block processing journal
+	// in the data directory.
+	processingJournalFilename = "processing.journal"
+
+	// defaultProcessingJournalEntries is the number of entries the block
+	// processing journal keeps before the oldest entries are overwritten.
+	defaultProcessingJournalEntries = 10000
+
+	// processingJournalLogEntries is the number of the most recent journal
+	// entries which are logged on startup after an unclean shutdown.
+	processingJournalLogEntries = 10
+
+	// journalMagic identifies a block processing journal file.
+	journalMagic = "PRVJRNL\x00"
+
+	// journalVersion is the current version of the journal file format.
+	journalVersion = 1
+
+	// journalHeaderSize is the size of the header at the start of the
+	// journal file.  The header consists of the magic, the version, the
+	// number of entries, and a flag which is set while the journal is
+	// closed cleanly.
+	journalHeaderSize = 64
+
+	// journalEntrySize is the size of each serialized journal entry.  The
+	// entries are laid out as a ring after the header.
+	journalEntrySize = 64
+)
+
+// journalAction identifies what the node was doing when an entry was added to
+// the block processing journal.
+type journalAction uint8
+
+// These constants define the actions recorded in the block processing journal.
+const (
+	// journalConnect records the outcome of connecting a block to the
+	// main chain, or of processing a block which was rejected.
+	journalConnect journalAction = iota + 1
+
+	// journalDisconnect records a block disconnected from the main chain.
+	journalDisconnect
+
+	// journalReorgStart records the start of a reorganization of the main
+	// chain to the recorded block.
+	journalReorgStart
+
+	// journalReorgEnd records the end of a reorganization of the main
+	// chain to the recorded block.
+	journalReorgEnd
+)
+
+// journalActionStrings is a map of journal actions back to their names.
+var journalActionStrings = map[journalAction]string{
+	journalConnect:    "connect",
+	journalDisconnect: "disconnect",
+	journalReorgStart: "reorg-start",
+	journalReorgEnd:   "reorg-end",
+}
+
+// String returns the journal action in human-readable form.
+func (a journalAction) String() string {
+	if s, ok := journalActionStrings[a]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(a))
+}
+
+// journalOutcome is the outcome of the action of a journal entry.
+type journalOutcome uint8
+
+// These constants define the outcomes recorded in the block processing journal.
+const (
+	// journalSuccess indicates the action succeeded.
+	journalSuccess journalOutcome = iota + 1
+
+	// journalRejected indicates the action failed due to a violation of
+	// the consensus rules, which is identified by the error code of the
+	// entry.
+	journalRejected
+
+	// journalFailed indicates the action failed due to any other error,
+	// such as a database error.
+	journalFailed
+)
+
+// journalOutcomeStrings is a map of journal outcomes back to their names.
+var journalOutcomeStrings = map[journalOutcome]string{
+	journalSuccess:  "success",
+	journalRejected: "rejected",
+	journalFailed:   "failed",
+}
+
+// String returns the journal outcome in human-readable form.
+func (o journalOutcome) String() string {
+	if s, ok := journalOutcomeStrings[o]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(o))
+}
+
+// journalEntry is a single entry of the block processing journal.
+type journalEntry struct {
+	seq       uint64
+	time      time.Time
+	hash      chainhash.Hash
+	height    uint32
+	action    journalAction
+	outcome   journalOutcome
+	errorCode blockchain.ErrorCode
+}
+
+// newJournalEntry returns a journal entry for the passed action on the block
+// with the passed hash and height whose outcome is derived from the passed
+// error.
+func newJournalEntry(action journalAction, hash *chainhash.Hash, height uint32, err error) journalEntry {
+	entry := journalEntry{
+		hash:    *hash,
+		height:  height,
+		action:  action,
+		outcome: journalSuccess,
+	}
+	if err != nil {
+		entry.outcome = journalFailed
+		if rerr, ok := err.(blockchain.RuleError); ok {
+			entry.outcome = journalRejected
+			entry.errorCode = rerr.ErrorCode
+		}
+	}
+	return entry
+}
+
+// String returns the journal entry in human-readable form.
+func (e *journalEntry) String() string {
+	outcome := e.outcome.String()
+	if e.outcome == journalRejected {
+		outcome = fmt.Sprintf("%s (%v)", outcome, e.errorCode)
+	}
+	return fmt.Sprintf("#%d %s %s block %v (height %d): %s", e.seq,
+		e.time.Format(time.RFC3339Nano), e.action, e.hash, e.height,
+		outcome)
+}
+
+// serialize returns the journal entry serialized along with a checksum which
+// allows entries which were only partially written to be detected.
+func (e *journalEntry) serialize() []byte {
+	var buf [journalEntrySize]byte
+	binary.LittleEndian.PutUint64(buf[0:8], e.seq)
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(e.time.UnixNano()))
+	copy(buf[16:48], e.hash[:])
+	binary.LittleEndian.PutUint32(buf[48:52], e.height)
+	buf[52] = byte(e.action)
+	buf[53] = byte(e.outcome)
+	binary.LittleEndian.PutUint32(buf[56:60], uint32(e.errorCode))
+	binary.LittleEndian.PutUint32(buf[60:64], crc32.ChecksumIEEE(buf[:60]))
+	return buf[:]
+}
+
+// deserializeJournalEntry decodes the passed serialized journal entry.  It
+// returns false for an empty slot of the journal or a corrupt entry.
+func deserializeJournalEntry(serialized []byte) (journalEntry, bool) {
+	checksum := binary.LittleEndian.Uint32(serialized[60:64])
+	if crc32.ChecksumIEEE(serialized[:60]) != checksum {
+		return journalEntry{}, false
+	}
+	entry := journalEntry{
+		seq:       binary.LittleEndian.Uint64(serialized[0:8]),
+		time:      time.Unix(0, int64(binary.LittleEndian.Uint64(serialized[8:16]))),
+		height:    binary.LittleEndian.Uint32(serialized[48:52]),
+		action:    journalAction(serialized[52]),
+		outcome:   journalOutcome(serialized[53]),
+		errorCode: blockchain.ErrorCode(binary.LittleEndian.Uint32(serialized[56:60])),
+	}
+	copy(entry.hash[:], serialized[16:48])
+	return entry, entry.seq != 0
+}
+
+// journalEntriesBySeq implements sort.Interface to allow a slice of journal
+// entries to be sorted by their sequence number.
+type journalEntriesBySeq []journalEntry
+
+// Len returns the number of entries in the slice.  It is part of the
+// sort.Interface implementation.
+func (s journalEntriesBySeq) Len() int { return len(s) }
+
+// Swap swaps the entries at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s journalEntriesBySeq) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// Less returns whether the entry with index i should sort before the entry
+// with index j.  It is part of the sort.Interface implementation.
+func (s journalEntriesBySeq) Less(i, j int) bool { return s[i].seq < s[j].seq }
+
+// processingJournal is a bounded on-disk journal of the blocks the node
+// connected and disconnected along with the reorganizations it performed, which
+// allows what the node was doing to be reconstructed after a crash.
+//
+// Entries are appended to an in-memory buffer, which is written to the journal
+// file when it is flushed at safe points outside of block processing.  The
+// start and end of reorganizations are additionally synced to disk, so the
+// journal shows an incomplete reorganization when the node crashes during one.
+// The file holds a ring of a fixed number of entries, so the oldest entries are
+// overwritten once it is full.
+type processingJournal struct {
+	mtx      sync.Mutex
+	file     *os.File
+	capacity uint64
+	nextSeq  uint64
+	pending  []journalEntry
+	unclean  bool
+}
+
+// openProcessingJournal opens the block processing journal at the passed path,
+// creating it with room for the passed number of entries when it does not exist
+// yet.  The journal is marked as open until it is closed, which allows an
+// unclean shutdown to be detected the next time it is opened.
+func openProcessingJournal(path string, capacity int) (*processingJournal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	j := &processingJournal{
+		file:     file,
+		capacity: uint64(capacity),
+		nextSeq:  1,
+	}
+
+	// Load the state of an existing journal.  The number of entries of an
+	// existing journal is kept so its entries remain in their slots.
+	var header [journalHeaderSize]byte
+	n, err := file.ReadAt(header[:], 0)
+	if err != nil && err != io.EOF {
+		file.Close()
+		return nil, err
+	}
+	if n != 0 {
+		if n != journalHeaderSize || string(header[:8]) != journalMagic {
+			file.Close()
+			return nil, fmt.Errorf("%s is not a block processing "+
+				"journal", path)
+		}
+		version := binary.LittleEndian.Uint32(header[8:12])
+		if version != journalVersion {
+			file.Close()
+			return nil, fmt.Errorf("unsupported block processing "+
+				"journal version %d", version)
+		}
+		j.capacity = uint64(binary.LittleEndian.Uint32(header[12:16]))
+		j.unclean = header[16] == 0
+
+		entries, err := j.readEntries()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if len(entries) > 0 {
+			j.nextSeq = entries[len(entries)-1].seq + 1
+		}
+	}
+	if j.capacity == 0 {
+		file.Close()
+		return nil, errors.New("block processing journal must hold at " +
+			"least one entry")
+	}
+
+	if err := j.writeHeader(false); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// writeHeader writes the header of the journal with the passed clean shutdown
+// flag and syncs it to disk.
+func (j *processingJournal) writeHeader(clean bool) error {
+	var header [journalHeaderSize]byte
+	copy(header[:8], journalMagic)
+	binary.LittleEndian.PutUint32(header[8:12], journalVersion)
+	binary.LittleEndian.PutUint32(header[12:16], uint32(j.capacity))
+	if clean {
+		header[16] = 1
+	}
+	if _, err := j.file.WriteAt(header[:], 0); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// readEntries reads all entries written to the journal file ordered from
+// oldest to newest.
+func (j *processingJournal) readEntries() ([]journalEntry, error) {
+	buf := make([]byte, j.capacity*journalEntrySize)
+	n, err := j.file.ReadAt(buf, journalHeaderSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	var entries []journalEntry
+	for slot := uint64(0); slot < uint64(n)/journalEntrySize; slot++ {
+		offset := slot * journalEntrySize
+		entry, ok := deserializeJournalEntry(
+			buf[offset : offset+journalEntrySize])
+		if !ok || (entry.seq-1)%j.capacity != slot {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Sort(journalEntriesBySeq(entries))
+	return entries, nil
+}
+
+// flush writes the buffered entries to the journal file, and syncs the file to
+// disk when requested.
+//
+// This function MUST be called with the journal lock held.
+func (j *processingJournal) flush(sync bool) error {
+	for i := range j.pending {
+		entry := &j.pending[i]
+		slot := (entry.seq - 1) % j.capacity
+		offset := int64(journalHeaderSize + slot*journalEntrySize)
+		if _, err := j.file.WriteAt(entry.serialize(), offset); err != nil {
+			return err
+		}
+	}
+	j.pending = j.pending[:0]
+	if sync {
+		return j.file.Sync()
+	}
+	return nil
+}
+
+// Append adds the passed entry to the journal.  The entry is buffered until the
+// journal is flushed, except for the start and end of reorganizations, which
+// are synced to disk immediately along with the entries buffered before them.
+//
+// This function is safe for concurrent access.
+func (j *processingJournal) Append(entry journalEntry) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	entry.seq = j.nextSeq
+	entry.time = time.Now()
+	j.nextSeq++
+	j.pending = append(j.pending, entry)
+
+	if entry.action == journalReorgStart || entry.action == journalReorgEnd {
+		if err := j.flush(true); err != nil {
+			bmgrLog.Errorf("Unable to sync block processing journal: "+
+				"%v", err)
+		}
+	}
+}
+
+// Flush writes the buffered entries to the journal file.  It is called at safe
+// points outside of block processing.
+//
+// This function is safe for concurrent access.
+func (j *processingJournal) Flush() error {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	return j.flush(false)
+}
+
+// Entries returns up to the passed number of the most recent entries of the
+// journal ordered from oldest to newest.  A negative count returns all of the
+// entries.
+//
+// This function is safe for concurrent access.
+func (j *processingJournal) Entries(count int) ([]journalEntry, error) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if err := j.flush(false); err != nil {
+		return nil, err
+	}
+	entries, err := j.readEntries()
+	if err != nil {
+		return nil, err
+	}
+	if count >= 0 && count < len(entries) {
+		entries = entries[len(entries)-count:]
+	}
+	return entries, nil
+}
+
+// Capacity returns the number of entries the journal keeps.
+func (j *processingJournal) Capacity() int {
+	return int(j.capacity)
+}
+
+// Unclean returns whether the journal was not closed when it was last used,
+// which means the previous shutdown of the node was unclean.
+func (j *processingJournal) Unclean() bool {
+	return j.unclean
+}
+
+// Close writes the buffered entries to the journal file, marks the journal as
+// closed cleanly, and closes the file.
+//
+// This function is safe for concurrent access.
+func (j *processingJournal) Close() error {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if err := j.flush(false); err != nil {
+		j.file.Close()
+		return err
+	}
+	if err := j.writeHeader(true); err != nil {
+		j.file.Close()
+		return err
+	}
+	return j.file.Close()
+}
+
+// RecordNotification adds an entry to the journal for the passed blockchain
+// notification when it describes a change of the main chain.
+func (j *processingJournal) RecordNotification(notification *blockchain.Notification) {
+	switch notification.Type {
+	case blockchain.NTBlockConnected, blockchain.NTBlockDisconnected:
+		block, ok := notification.Data.(*provautil.Block)
+		if !ok {
+			return
+		}
+		action := journalConnect
+		if notification.Type == blockchain.NTBlockDisconnected {
+			action = journalDisconnect
+		}
+		j.Append(newJournalEntry(action, block.Hash(),
+			block.MsgBlock().Header.Height, nil))
+
+	case blockchain.NTReorganizationStarted:
+		data, ok := notification.Data.(*blockchain.ReorganizationNtfnsData)
+		if !ok {
+			return
+		}
+		j.Append(newJournalEntry(journalReorgStart, &data.NewHash,
+			data.NewHeight, nil))
+
+	case blockchain.NTReorganizationFinished:
+		data, ok := notification.Data.(*blockchain.ReorganizationNtfnsData)
+		if !ok {
+			return
+		}
+		j.Append(newJournalEntry(journalReorgEnd, &data.NewHash,
+			data.NewHeight, data.Err))
+	}
+}
+
+// RecordRejected adds an entry to the journal for the passed block which failed
+// to be processed with the passed error.
+func (j *processingJournal) RecordRejected(block *provautil.Block, err error) {
+	j.Append(newJournalEntry(journalConnect, block.Hash(),
+		block.MsgBlock().Header.Height, err))
+}
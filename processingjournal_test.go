@@ -0,0 +1,261 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestProcessingJournalRing ensures the processing journal keeps the most recent
+// entries up to its capacity across restarts and detects an unclean shutdown.
+func TestProcessingJournalRing(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "processingjournal")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, processingJournalFilename)
+
+	journal, err := openProcessingJournal(path, 4)
+	if err != nil {
+		t.Fatalf("openProcessingJournal: unexpected error: %v", err)
+	}
+	if journal.Unclean() {
+		t.Fatal("new journal reports an unclean shutdown")
+	}
+	rejectErr := blockchain.RuleError{ErrorCode: blockchain.ErrBadMerkleRoot}
+	for height := uint32(1); height <= 6; height++ {
+		hash := chainhash.Hash{byte(height)}
+		var err error
+		if height == 6 {
+			err = rejectErr
+		}
+		journal.Append(newJournalEntry(journalConnect, &hash, height, err))
+	}
+
+	// Only the most recent entries up to the capacity are kept.
+	checkEntries := func(entries []journalEntry, firstSeq uint64) {
+		for i, entry := range entries {
+			seq := firstSeq + uint64(i)
+			if entry.seq != seq || entry.height != uint32(seq) ||
+				entry.hash != (chainhash.Hash{byte(seq)}) {
+
+				t.Fatalf("entry %d: got %v, want seq %d", i, &entry,
+					seq)
+			}
+		}
+	}
+	entries, err := journal.Entries(-1)
+	if err != nil {
+		t.Fatalf("Entries: unexpected error: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(entries))
+	}
+	checkEntries(entries, 3)
+	last := entries[len(entries)-1]
+	if last.outcome != journalRejected ||
+		last.errorCode != blockchain.ErrBadMerkleRoot {
+
+		t.Fatalf("got last entry %v, want rejected with %v", &last,
+			blockchain.ErrBadMerkleRoot)
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+
+	// The entries survive a clean restart and new entries continue the
+	// sequence.
+	journal, err = openProcessingJournal(path, defaultProcessingJournalEntries)
+	if err != nil {
+		t.Fatalf("openProcessingJournal: unexpected error: %v", err)
+	}
+	if journal.Unclean() {
+		t.Fatal("journal closed cleanly reports an unclean shutdown")
+	}
+	if journal.Capacity() != 4 {
+		t.Fatalf("got capacity %d, want 4", journal.Capacity())
+	}
+	hash := chainhash.Hash{7}
+	journal.Append(newJournalEntry(journalConnect, &hash, 7, nil))
+	entries, err = journal.Entries(2)
+	if err != nil {
+		t.Fatalf("Entries: unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	checkEntries(entries, 6)
+
+	// A journal which is not closed reports an unclean shutdown.
+	journal.file.Close()
+	journal, err = openProcessingJournal(path, 4)
+	if err != nil {
+		t.Fatalf("openProcessingJournal: unexpected error: %v", err)
+	}
+	defer journal.Close()
+	if !journal.Unclean() {
+		t.Fatal("journal which was not closed reports a clean shutdown")
+	}
+}
+
+// TestProcessingJournalCrashMidReorg ensures the processing journal of a node
+// which crashes in the middle of a reorganization shows the incomplete
+// reorganization, and that the journal of a completed reorganization shows the
+// blocks which were disconnected and connected.
+func TestProcessingJournalCrashMidReorg(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+
+	// Generate a main chain of two blocks and a competing chain of three
+	// blocks which forks after the first block.
+	fetchBlock := func(hash *chainhash.Hash) *wire.MsgBlock {
+		block, err := h.chain.BlockByHash(hash)
+		if err != nil {
+			t.Fatalf("BlockByHash: unexpected error: %v", err)
+		}
+		return block.MsgBlock()
+	}
+	block1 := fetchBlock(h.mineBlock(t))
+	block2a := h.generateBlock(t)
+	block2b := fetchBlock(h.mineBlockToPayAddr(t))
+	block3b := fetchBlock(h.mineBlock(t))
+
+	tmpDir, err := ioutil.TempDir("", "processingjournal")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	journalPath := filepath.Join(tmpDir, processingJournalFilename)
+	journal, err := openProcessingJournal(journalPath,
+		defaultProcessingJournalEntries)
+	if err != nil {
+		t.Fatalf("openProcessingJournal: unexpected error: %v", err)
+	}
+	defer journal.Close()
+
+	// Record the notifications of a chain in the journal the same way the
+	// block manager does, and simulate a crash once the first block is
+	// connected during the reorganization by capturing the journal file
+	// as it is on disk at that point.
+	crashPath := filepath.Join(tmpDir, "crash.journal")
+	reorganizing := false
+	crashed := false
+	notifications := func(n *blockchain.Notification) {
+		switch n.Type {
+		case blockchain.NTReorganizationStarted:
+			reorganizing = true
+		case blockchain.NTBlockConnected:
+			if reorganizing && !crashed {
+				crashed = true
+				contents, err := ioutil.ReadFile(journalPath)
+				if err != nil {
+					t.Fatalf("unable to read journal: %v", err)
+				}
+				err = ioutil.WriteFile(crashPath, contents, 0600)
+				if err != nil {
+					t.Fatalf("unable to write journal: %v", err)
+				}
+			}
+		}
+		journal.RecordNotification(n)
+	}
+	params := chaincfg.RegressionNetParams
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		params.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:            db,
+		ChainParams:   &params,
+		TimeSource:    blockchain.NewMedianTime(),
+		Notifications: notifications,
+	})
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	for _, msgBlock := range []*wire.MsgBlock{block1, block2a, block2b,
+		block3b} {
+
+		block := provautil.NewBlock(msgBlock)
+		_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+		if err := journal.Flush(); err != nil {
+			t.Fatalf("Flush: unexpected error: %v", err)
+		}
+	}
+	if !crashed {
+		t.Fatal("chain was not reorganized")
+	}
+
+	// The journal of the crashed node ends with the start of the
+	// reorganization to the tip of the competing chain.
+	block3bHash := block3b.BlockHash()
+	crashJournal, err := openProcessingJournal(crashPath,
+		defaultProcessingJournalEntries)
+	if err != nil {
+		t.Fatalf("openProcessingJournal: unexpected error: %v", err)
+	}
+	defer crashJournal.Close()
+	if !crashJournal.Unclean() {
+		t.Fatal("journal of crashed node reports a clean shutdown")
+	}
+	entries, err := crashJournal.Entries(-1)
+	if err != nil {
+		t.Fatalf("Entries: unexpected error: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Fatal("journal of crashed node has no entries")
+	}
+	last := entries[len(entries)-1]
+	if last.action != journalReorgStart || last.hash != block3bHash ||
+		last.height != 3 {
+
+		t.Fatalf("got last entry %v, want start of reorganization to "+
+			"%v", &last, block3bHash)
+	}
+
+	// The journal of the node which completed the reorganization shows
+	// the disconnected and connected blocks between its start and end.
+	entries, err = journal.Entries(5)
+	if err != nil {
+		t.Fatalf("Entries: unexpected error: %v", err)
+	}
+	want := []struct {
+		action journalAction
+		hash   chainhash.Hash
+	}{
+		{journalReorgStart, block3bHash},
+		{journalDisconnect, block2a.BlockHash()},
+		{journalConnect, block2b.BlockHash()},
+		{journalConnect, block3bHash},
+		{journalReorgEnd, block3bHash},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, entry := range entries {
+		if entry.action != want[i].action || entry.hash != want[i].hash ||
+			entry.outcome != journalSuccess {
+
+			t.Errorf("entry %d: got %v, want successful %v of %v", i,
+				&entry, want[i].action, want[i].hash)
+		}
+	}
+}
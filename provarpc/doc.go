@@ -0,0 +1,42 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package provarpc implements the gRPC API of a Prova node.
+
+The API is defined by the Prova service in provarpc.proto, and the Go code in
+this package is generated from it with protoc, protoc-gen-go and
+protoc-gen-go-grpc.  It serves a subset of the JSON-RPC commands with typed
+messages and raw serialized blocks and transactions rather than JSON and hex
+strings, along with server-streaming methods for block notifications and for
+replicating the main chain to hot standby nodes.
+
+Clients authenticate with a bearer token in the authorization metadata of each
+call, and connect over TLS with the certificate of the RPC server unless TLS is
+disabled:
+
+	creds, err := credentials.NewClientTLSFromFile(certFile, "")
+	if err != nil {
+		// Handle error
+	}
+	conn, err := grpc.Dial("localhost:8335",
+		grpc.WithTransportCredentials(creds))
+	if err != nil {
+		// Handle error
+	}
+	defer conn.Close()
+	client := provarpc.NewProvaClient(conn)
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		"authorization", "Bearer "+token)
+	best, err := client.GetBestBlock(ctx, &provarpc.GetBestBlockRequest{})
+
+Regenerating
+
+After the service definition is changed, the generated code is updated with:
+
+	go generate github.com/bitgo/prova/provarpc
+*/
+package provarpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative provarpc.proto
@@ -0,0 +1,480 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: provarpc.proto
+
+package provarpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Prova_GetBestBlock_FullMethodName             = "/provarpc.Prova/GetBestBlock"
+	Prova_GetBlock_FullMethodName                 = "/provarpc.Prova/GetBlock"
+	Prova_SubmitBlock_FullMethodName              = "/provarpc.Prova/SubmitBlock"
+	Prova_SubmitTransaction_FullMethodName        = "/provarpc.Prova/SubmitTransaction"
+	Prova_GetMempoolEntry_FullMethodName          = "/provarpc.Prova/GetMempoolEntry"
+	Prova_StreamBlockNotifications_FullMethodName = "/provarpc.Prova/StreamBlockNotifications"
+	Prova_GetAdminState_FullMethodName            = "/provarpc.Prova/GetAdminState"
+	Prova_StreamReplication_FullMethodName        = "/provarpc.Prova/StreamReplication"
+)
+
+// ProvaClient is the client API for Prova service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ProvaClient interface {
+	// GetBestBlock returns the hash and height of the best block of the
+	// main chain.  It corresponds to the getbestblock command.
+	GetBestBlock(ctx context.Context, in *GetBestBlockRequest, opts ...grpc.CallOption) (*GetBestBlockResponse, error)
+	// GetBlock returns the serialized block with the passed hash, or the
+	// block of the main chain at the passed height.  It corresponds to the
+	// getblock command.
+	GetBlock(ctx context.Context, in *GetBlockRequest, opts ...grpc.CallOption) (*GetBlockResponse, error)
+	// SubmitBlock submits a serialized block to the node.  It corresponds
+	// to the submitblock command.
+	SubmitBlock(ctx context.Context, in *SubmitBlockRequest, opts ...grpc.CallOption) (*SubmitBlockResponse, error)
+	// SubmitTransaction submits a serialized transaction to the memory pool
+	// of the node and relays it to the network once it is accepted.  It
+	// corresponds to the sendrawtransaction command.
+	SubmitTransaction(ctx context.Context, in *SubmitTransactionRequest, opts ...grpc.CallOption) (*SubmitTransactionResponse, error)
+	// GetMempoolEntry returns the memory pool entry of a transaction.  It
+	// corresponds to the getmempoolentry command.
+	GetMempoolEntry(ctx context.Context, in *GetMempoolEntryRequest, opts ...grpc.CallOption) (*GetMempoolEntryResponse, error)
+	// StreamBlockNotifications streams the blocks of the main chain from a
+	// start height onward, first replaying the blocks already in the chain
+	// and then following the blocks connected to it.  The node sends the
+	// notifications as fast as the client receives them.  It corresponds to
+	// the subscribeblocks command.
+	StreamBlockNotifications(ctx context.Context, in *StreamBlockNotificationsRequest, opts ...grpc.CallOption) (Prova_StreamBlockNotificationsClient, error)
+	// GetAdminState returns the admin state of the best block of the main
+	// chain.  It corresponds to the getadmininfo command.
+	GetAdminState(ctx context.Context, in *GetAdminStateRequest, opts ...grpc.CallOption) (*GetAdminStateResponse, error)
+	// StreamReplication streams the changes to the main chain from a start
+	// height onward for a hot standby node to follow, like
+	// StreamBlockNotifications, along with the spend journal entry and the
+	// admin operations of each connected block so the standby can check
+	// that it derived the same chain state.  It has no JSON-RPC counterpart
+	// and may only be called by admin clients.
+	StreamReplication(ctx context.Context, in *StreamReplicationRequest, opts ...grpc.CallOption) (Prova_StreamReplicationClient, error)
+}
+
+type provaClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewProvaClient(cc grpc.ClientConnInterface) ProvaClient {
+	return &provaClient{cc}
+}
+
+func (c *provaClient) GetBestBlock(ctx context.Context, in *GetBestBlockRequest, opts ...grpc.CallOption) (*GetBestBlockResponse, error) {
+	out := new(GetBestBlockResponse)
+	err := c.cc.Invoke(ctx, Prova_GetBestBlock_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *provaClient) GetBlock(ctx context.Context, in *GetBlockRequest, opts ...grpc.CallOption) (*GetBlockResponse, error) {
+	out := new(GetBlockResponse)
+	err := c.cc.Invoke(ctx, Prova_GetBlock_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *provaClient) SubmitBlock(ctx context.Context, in *SubmitBlockRequest, opts ...grpc.CallOption) (*SubmitBlockResponse, error) {
+	out := new(SubmitBlockResponse)
+	err := c.cc.Invoke(ctx, Prova_SubmitBlock_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *provaClient) SubmitTransaction(ctx context.Context, in *SubmitTransactionRequest, opts ...grpc.CallOption) (*SubmitTransactionResponse, error) {
+	out := new(SubmitTransactionResponse)
+	err := c.cc.Invoke(ctx, Prova_SubmitTransaction_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *provaClient) GetMempoolEntry(ctx context.Context, in *GetMempoolEntryRequest, opts ...grpc.CallOption) (*GetMempoolEntryResponse, error) {
+	out := new(GetMempoolEntryResponse)
+	err := c.cc.Invoke(ctx, Prova_GetMempoolEntry_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *provaClient) StreamBlockNotifications(ctx context.Context, in *StreamBlockNotificationsRequest, opts ...grpc.CallOption) (Prova_StreamBlockNotificationsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Prova_ServiceDesc.Streams[0], Prova_StreamBlockNotifications_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &provaStreamBlockNotificationsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Prova_StreamBlockNotificationsClient interface {
+	Recv() (*BlockNotification, error)
+	grpc.ClientStream
+}
+
+type provaStreamBlockNotificationsClient struct {
+	grpc.ClientStream
+}
+
+func (x *provaStreamBlockNotificationsClient) Recv() (*BlockNotification, error) {
+	m := new(BlockNotification)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *provaClient) GetAdminState(ctx context.Context, in *GetAdminStateRequest, opts ...grpc.CallOption) (*GetAdminStateResponse, error) {
+	out := new(GetAdminStateResponse)
+	err := c.cc.Invoke(ctx, Prova_GetAdminState_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *provaClient) StreamReplication(ctx context.Context, in *StreamReplicationRequest, opts ...grpc.CallOption) (Prova_StreamReplicationClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Prova_ServiceDesc.Streams[1], Prova_StreamReplication_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &provaStreamReplicationClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Prova_StreamReplicationClient interface {
+	Recv() (*ReplicationEvent, error)
+	grpc.ClientStream
+}
+
+type provaStreamReplicationClient struct {
+	grpc.ClientStream
+}
+
+func (x *provaStreamReplicationClient) Recv() (*ReplicationEvent, error) {
+	m := new(ReplicationEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ProvaServer is the server API for Prova service.
+// All implementations must embed UnimplementedProvaServer
+// for forward compatibility
+type ProvaServer interface {
+	// GetBestBlock returns the hash and height of the best block of the
+	// main chain.  It corresponds to the getbestblock command.
+	GetBestBlock(context.Context, *GetBestBlockRequest) (*GetBestBlockResponse, error)
+	// GetBlock returns the serialized block with the passed hash, or the
+	// block of the main chain at the passed height.  It corresponds to the
+	// getblock command.
+	GetBlock(context.Context, *GetBlockRequest) (*GetBlockResponse, error)
+	// SubmitBlock submits a serialized block to the node.  It corresponds
+	// to the submitblock command.
+	SubmitBlock(context.Context, *SubmitBlockRequest) (*SubmitBlockResponse, error)
+	// SubmitTransaction submits a serialized transaction to the memory pool
+	// of the node and relays it to the network once it is accepted.  It
+	// corresponds to the sendrawtransaction command.
+	SubmitTransaction(context.Context, *SubmitTransactionRequest) (*SubmitTransactionResponse, error)
+	// GetMempoolEntry returns the memory pool entry of a transaction.  It
+	// corresponds to the getmempoolentry command.
+	GetMempoolEntry(context.Context, *GetMempoolEntryRequest) (*GetMempoolEntryResponse, error)
+	// StreamBlockNotifications streams the blocks of the main chain from a
+	// start height onward, first replaying the blocks already in the chain
+	// and then following the blocks connected to it.  The node sends the
+	// notifications as fast as the client receives them.  It corresponds to
+	// the subscribeblocks command.
+	StreamBlockNotifications(*StreamBlockNotificationsRequest, Prova_StreamBlockNotificationsServer) error
+	// GetAdminState returns the admin state of the best block of the main
+	// chain.  It corresponds to the getadmininfo command.
+	GetAdminState(context.Context, *GetAdminStateRequest) (*GetAdminStateResponse, error)
+	// StreamReplication streams the changes to the main chain from a start
+	// height onward for a hot standby node to follow, like
+	// StreamBlockNotifications, along with the spend journal entry and the
+	// admin operations of each connected block so the standby can check
+	// that it derived the same chain state.  It has no JSON-RPC counterpart
+	// and may only be called by admin clients.
+	StreamReplication(*StreamReplicationRequest, Prova_StreamReplicationServer) error
+	mustEmbedUnimplementedProvaServer()
+}
+
+// UnimplementedProvaServer must be embedded to have forward compatible implementations.
+type UnimplementedProvaServer struct {
+}
+
+func (UnimplementedProvaServer) GetBestBlock(context.Context, *GetBestBlockRequest) (*GetBestBlockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBestBlock not implemented")
+}
+func (UnimplementedProvaServer) GetBlock(context.Context, *GetBlockRequest) (*GetBlockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlock not implemented")
+}
+func (UnimplementedProvaServer) SubmitBlock(context.Context, *SubmitBlockRequest) (*SubmitBlockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitBlock not implemented")
+}
+func (UnimplementedProvaServer) SubmitTransaction(context.Context, *SubmitTransactionRequest) (*SubmitTransactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitTransaction not implemented")
+}
+func (UnimplementedProvaServer) GetMempoolEntry(context.Context, *GetMempoolEntryRequest) (*GetMempoolEntryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMempoolEntry not implemented")
+}
+func (UnimplementedProvaServer) StreamBlockNotifications(*StreamBlockNotificationsRequest, Prova_StreamBlockNotificationsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamBlockNotifications not implemented")
+}
+func (UnimplementedProvaServer) GetAdminState(context.Context, *GetAdminStateRequest) (*GetAdminStateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAdminState not implemented")
+}
+func (UnimplementedProvaServer) StreamReplication(*StreamReplicationRequest, Prova_StreamReplicationServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamReplication not implemented")
+}
+func (UnimplementedProvaServer) mustEmbedUnimplementedProvaServer() {}
+
+// UnsafeProvaServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ProvaServer will
+// result in compilation errors.
+type UnsafeProvaServer interface {
+	mustEmbedUnimplementedProvaServer()
+}
+
+func RegisterProvaServer(s grpc.ServiceRegistrar, srv ProvaServer) {
+	s.RegisterService(&Prova_ServiceDesc, srv)
+}
+
+func _Prova_GetBestBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBestBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProvaServer).GetBestBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Prova_GetBestBlock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProvaServer).GetBestBlock(ctx, req.(*GetBestBlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Prova_GetBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProvaServer).GetBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Prova_GetBlock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProvaServer).GetBlock(ctx, req.(*GetBlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Prova_SubmitBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProvaServer).SubmitBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Prova_SubmitBlock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProvaServer).SubmitBlock(ctx, req.(*SubmitBlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Prova_SubmitTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProvaServer).SubmitTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Prova_SubmitTransaction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProvaServer).SubmitTransaction(ctx, req.(*SubmitTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Prova_GetMempoolEntry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMempoolEntryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProvaServer).GetMempoolEntry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Prova_GetMempoolEntry_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProvaServer).GetMempoolEntry(ctx, req.(*GetMempoolEntryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Prova_StreamBlockNotifications_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamBlockNotificationsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ProvaServer).StreamBlockNotifications(m, &provaStreamBlockNotificationsServer{stream})
+}
+
+type Prova_StreamBlockNotificationsServer interface {
+	Send(*BlockNotification) error
+	grpc.ServerStream
+}
+
+type provaStreamBlockNotificationsServer struct {
+	grpc.ServerStream
+}
+
+func (x *provaStreamBlockNotificationsServer) Send(m *BlockNotification) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Prova_GetAdminState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAdminStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProvaServer).GetAdminState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Prova_GetAdminState_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProvaServer).GetAdminState(ctx, req.(*GetAdminStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Prova_StreamReplication_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamReplicationRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ProvaServer).StreamReplication(m, &provaStreamReplicationServer{stream})
+}
+
+type Prova_StreamReplicationServer interface {
+	Send(*ReplicationEvent) error
+	grpc.ServerStream
+}
+
+type provaStreamReplicationServer struct {
+	grpc.ServerStream
+}
+
+func (x *provaStreamReplicationServer) Send(m *ReplicationEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Prova_ServiceDesc is the grpc.ServiceDesc for Prova service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Prova_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "provarpc.Prova",
+	HandlerType: (*ProvaServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetBestBlock",
+			Handler:    _Prova_GetBestBlock_Handler,
+		},
+		{
+			MethodName: "GetBlock",
+			Handler:    _Prova_GetBlock_Handler,
+		},
+		{
+			MethodName: "SubmitBlock",
+			Handler:    _Prova_SubmitBlock_Handler,
+		},
+		{
+			MethodName: "SubmitTransaction",
+			Handler:    _Prova_SubmitTransaction_Handler,
+		},
+		{
+			MethodName: "GetMempoolEntry",
+			Handler:    _Prova_GetMempoolEntry_Handler,
+		},
+		{
+			MethodName: "GetAdminState",
+			Handler:    _Prova_GetAdminState_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamBlockNotifications",
+			Handler:       _Prova_StreamBlockNotifications_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamReplication",
+			Handler:       _Prova_StreamReplication_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "provarpc.proto",
+}
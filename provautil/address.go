@@ -9,6 +9,8 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
@@ -108,6 +110,62 @@ func DecodeAddress(addr string, defaultNet *chaincfg.Params) (Address, error) {
 	return nil, errors.New("decoded address is of unknown size")
 }
 
+// WrongNetworkError describes an error where an address is valid, but not for
+// the expected network.  It lists the default and registered networks the
+// address is valid for, which may be several since networks may share the same
+// address prefixes.
+type WrongNetworkError struct {
+	Address  Address
+	Nets     []*chaincfg.Params
+	Expected *chaincfg.Params
+}
+
+// NetNames returns the names of the networks the address is valid for.
+func (e *WrongNetworkError) NetNames() string {
+	names := make([]string, 0, len(e.Nets))
+	for _, net := range e.Nets {
+		names = append(names, net.Name)
+	}
+	return strings.Join(names, " or ")
+}
+
+// Error implements the error interface.
+func (e *WrongNetworkError) Error() string {
+	return fmt.Sprintf("address is valid for %s, not %s", e.NetNames(),
+		e.Expected.Name)
+}
+
+// AddressNets returns the default and registered networks the passed address
+// is valid for, in the order they were registered.
+func AddressNets(addr Address) []*chaincfg.Params {
+	var nets []*chaincfg.Params
+	for _, net := range chaincfg.RegisteredNets() {
+		if addr.IsForNet(net) {
+			nets = append(nets, net)
+		}
+	}
+	return nets
+}
+
+// DecodeAddressForNet decodes the string encoding of an address like
+// DecodeAddress and ensures the address is valid for the passed network.  A
+// WrongNetworkError, which identifies the networks the address is valid for,
+// is returned when the address is a valid encoding for other networks only.
+func DecodeAddressForNet(addr string, net *chaincfg.Params) (Address, error) {
+	decoded, err := DecodeAddress(addr, net)
+	if err != nil {
+		return nil, err
+	}
+	if !decoded.IsForNet(net) {
+		return nil, &WrongNetworkError{
+			Address:  decoded,
+			Nets:     AddressNets(decoded),
+			Expected: net,
+		}
+	}
+	return decoded, nil
+}
+
 // AddressProva is a standard 2-of-3 Prova address
 type AddressProva struct {
 	keyIDs [2]btcec.KeyID
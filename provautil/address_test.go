@@ -11,6 +11,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
@@ -105,3 +106,133 @@ func TestAddresses(t *testing.T) {
 		}
 	}
 }
+
+// TestDecodeAddressForNet ensures addresses for the expected network are
+// decoded, that addresses which are only valid for other networks are reported
+// along with the networks they are valid for, and that malformed addresses are
+// rejected as such.
+func TestDecodeAddressForNet(t *testing.T) {
+	pkHash := make([]byte, 20)
+	keyIDs := []btcec.KeyID{1, 2}
+	encode := func(net *chaincfg.Params) string {
+		addr, err := provautil.NewAddressProva(pkHash, keyIDs, net)
+		if err != nil {
+			t.Fatalf("NewAddressProva: unexpected error: %v", err)
+		}
+		return addr.EncodeAddress()
+	}
+	mainAddr := encode(&chaincfg.MainNetParams)
+	testAddr := encode(&chaincfg.TestNetParams)
+	corrupted := []byte(mainAddr)
+	corrupted[len(corrupted)-1]++
+
+	tests := []struct {
+		name     string
+		addr     string
+		net      *chaincfg.Params
+		wrongNet string // networks the address is valid for instead
+		valid    bool
+	}{
+		{
+			name:  "mainnet address on mainnet",
+			addr:  mainAddr,
+			net:   &chaincfg.MainNetParams,
+			valid: true,
+		},
+		{
+			name:  "testnet address on testnet",
+			addr:  testAddr,
+			net:   &chaincfg.TestNetParams,
+			valid: true,
+		},
+		{
+			// Regression test shares the address prefix of testnet.
+			name:  "testnet address on regtest",
+			addr:  testAddr,
+			net:   &chaincfg.RegressionNetParams,
+			valid: true,
+		},
+		{
+			name:     "mainnet address on testnet",
+			addr:     mainAddr,
+			net:      &chaincfg.TestNetParams,
+			wrongNet: "mainnet",
+		},
+		{
+			name:     "mainnet address on regtest",
+			addr:     mainAddr,
+			net:      &chaincfg.RegressionNetParams,
+			wrongNet: "mainnet",
+		},
+		{
+			name:     "testnet address on mainnet",
+			addr:     testAddr,
+			net:      &chaincfg.MainNetParams,
+			wrongNet: "testnet or regtest",
+		},
+		{
+			name:     "mainnet address on simnet",
+			addr:     mainAddr,
+			net:      &chaincfg.SimNetParams,
+			wrongNet: "mainnet",
+		},
+		{
+			name: "bad checksum",
+			addr: string(corrupted),
+			net:  &chaincfg.MainNetParams,
+		},
+		{
+			name: "not base58",
+			addr: "0OIl",
+			net:  &chaincfg.MainNetParams,
+		},
+		{
+			name: "empty",
+			addr: "",
+			net:  &chaincfg.MainNetParams,
+		},
+	}
+
+	for _, test := range tests {
+		addr, err := provautil.DecodeAddressForNet(test.addr, test.net)
+		if test.valid {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+				continue
+			}
+			if addr.EncodeAddress() != test.addr {
+				t.Errorf("%s: got address %v, want %v", test.name,
+					addr.EncodeAddress(), test.addr)
+			}
+			continue
+		}
+		if addr != nil {
+			t.Errorf("%s: got address %v, want nil", test.name, addr)
+		}
+		wrongNetErr, ok := err.(*provautil.WrongNetworkError)
+		if test.wrongNet == "" {
+			if err == nil || ok {
+				t.Errorf("%s: got error %v, want a malformed address "+
+					"error", test.name, err)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s: got error %v, want WrongNetworkError",
+				test.name, err)
+			continue
+		}
+		if got := wrongNetErr.NetNames(); got != test.wrongNet {
+			t.Errorf("%s: got networks %q, want %q", test.name, got,
+				test.wrongNet)
+		}
+		if wrongNetErr.Expected != test.net {
+			t.Errorf("%s: got expected network %v, want %v", test.name,
+				wrongNetErr.Expected.Name, test.net.Name)
+		}
+		if wrongNetErr.Address.EncodeAddress() != test.addr {
+			t.Errorf("%s: got address %v, want %v", test.name,
+				wrongNetErr.Address, test.addr)
+		}
+	}
+}
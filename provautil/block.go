@@ -38,6 +38,10 @@ type Block struct {
 	blockHash       *chainhash.Hash // Cached block hash
 	transactions    []*Tx           // Transactions
 	txnsGenerated   bool            // ALL wrapped transactions generated
+
+	// contextFreeChecked indicates the block passed the validation checks
+	// which don't depend on its position in the block chain.
+	contextFreeChecked bool
 }
 
 func (b *Block) blockHeight() uint32 {
@@ -200,7 +204,7 @@ func (b *Block) TxLoc() ([]wire.TxLoc, error) {
 	rbuf := bytes.NewBuffer(rawMsg)
 
 	var mblock wire.MsgBlock
-	txLocs, err := mblock.DeserializeTxLoc(rbuf)
+	txLocs, err := mblock.BtcDecodeTxLoc(rbuf, b.msgBlock.TxEncoding())
 	if err != nil {
 		return nil, err
 	}
@@ -217,6 +221,19 @@ func (b *Block) SetHeight(height uint32) {
 	b.msgBlock.Header.Height = height
 }
 
+// ContextFreeChecked returns whether the block was marked as having passed the
+// validation checks which don't depend on its position in the block chain.
+func (b *Block) ContextFreeChecked() bool {
+	return b.contextFreeChecked
+}
+
+// SetContextFreeChecked marks the block as having passed the validation checks
+// which don't depend on its position in the block chain so they aren't repeated
+// when the block is processed.
+func (b *Block) SetContextFreeChecked() {
+	b.contextFreeChecked = true
+}
+
 // NewBlock returns a new instance of a bitcoin block given an underlying
 // wire.MsgBlock.  See Block.
 func NewBlock(msgBlock *wire.MsgBlock) *Block {
@@ -237,6 +254,18 @@ func NewBlockFromBytes(serializedBlock []byte) (*Block, error) {
 	return b, nil
 }
 
+// NewBlockFromBytesEncoding returns a new instance of a bitcoin block given the
+// serialized bytes and the protocol version flags its transactions are encoded
+// with, such as wire.TxExpiryEncoding.  See Block.
+func NewBlockFromBytesEncoding(serializedBlock []byte, txEncoding uint32) (*Block, error) {
+	var msgBlock wire.MsgBlock
+	err := msgBlock.BtcDecode(bytes.NewReader(serializedBlock), txEncoding)
+	if err != nil {
+		return nil, err
+	}
+	return NewBlockFromBlockAndBytes(&msgBlock, serializedBlock), nil
+}
+
 // NewBlockFromReader returns a new instance of a bitcoin block given a
 // Reader to deserialize the block.  See Block.
 func NewBlockFromReader(r io.Reader) (*Block, error) {
@@ -10,6 +10,7 @@ import (
 	"io"
 
 	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil/txsort"
 	"github.com/bitgo/prova/wire"
 )
 
@@ -111,3 +112,15 @@ func NewTxFromReader(r io.Reader) (*Tx, error) {
 	}
 	return &t, nil
 }
+
+// SortTxInputsOutputs sorts the inputs and outputs of the passed transaction in
+// place into the canonical order described by BIP 69, which nodes may require
+// for relay so that transactions built independently by co-signers are
+// identical.
+//
+// It must only be called on transactions which are still being built since it
+// changes their hash.  Admin transactions must not be sorted since the order of
+// their inputs and outputs is meaningful.
+func SortTxInputsOutputs(tx *wire.MsgTx) {
+	txsort.InPlaceSort(tx)
+}
@@ -13,6 +13,8 @@ import (
 
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/txsort"
+	"github.com/bitgo/prova/wire"
 	"github.com/davecgh/go-spew/spew"
 )
 
@@ -96,3 +98,34 @@ func TestTxErrors(t *testing.T) {
 			"got %v, want %v", err, io.EOF)
 	}
 }
+
+// TestSortTxInputsOutputs ensures the inputs and outputs of a transaction are
+// sorted into the canonical order.
+func TestSortTxInputsOutputs(t *testing.T) {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for i := uint32(3); i > 0; i-- {
+		prevOut := wire.NewOutPoint(&chainhash.Hash{byte(i)}, i)
+		tx.AddTxIn(wire.NewTxIn(prevOut, nil))
+		tx.AddTxOut(wire.NewTxOut(int64(i), nil))
+	}
+	if txsort.IsSorted(tx) {
+		t.Fatalf("IsSorted: unsorted transaction reported as sorted")
+	}
+
+	provautil.SortTxInputsOutputs(tx)
+	if !txsort.IsSorted(tx) {
+		t.Fatalf("SortTxInputsOutputs: transaction is not sorted")
+	}
+	for i, txIn := range tx.TxIn {
+		if txIn.PreviousOutPoint.Index != uint32(i+1) {
+			t.Errorf("SortTxInputsOutputs: got input %d at "+
+				"position %d", txIn.PreviousOutPoint.Index, i)
+		}
+	}
+	for i, txOut := range tx.TxOut {
+		if txOut.Value != int64(i+1) {
+			t.Errorf("SortTxInputsOutputs: got output %d at "+
+				"position %d", txOut.Value, i)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// maxRejectBuckets is the maximum number of distinct command and reject
+	// code pairs the received rejects are tracked for.  Once reached,
+	// rejects for new pairs are counted under rejectOtherCommand so peers
+	// can't grow the summary without bound.
+	maxRejectBuckets = 100
+
+	// rejectOtherCommand is the command rejects are counted under once
+	// maxRejectBuckets is reached.
+	rejectOtherCommand = "other"
+
+	// maxRejectReasonLen is the maximum number of bytes of the reason of a
+	// received reject which is kept.  Longer reasons are truncated.
+	maxRejectReasonLen = 256
+
+	// maxTrackedOwnBlocks is the number of most recent blocks produced by
+	// this node the rejecting peers are tracked for.
+	maxTrackedOwnBlocks = 100
+)
+
+// rejectKey identifies the bucket the rejects for a command and reject code
+// are counted in.
+type rejectKey struct {
+	command string
+	code    wire.RejectCode
+}
+
+// rejectBucket houses the number of rejects received for a command and reject
+// code along with the details of the most recent one.
+type rejectBucket struct {
+	count      uint64
+	lastHash   *chainhash.Hash
+	lastReason string
+	lastPeer   string
+	lastTime   time.Time
+}
+
+// ownBlockRejects houses the peers which rejected a block produced by this
+// node.
+type ownBlockRejects struct {
+	peers  map[string]struct{}
+	warned bool
+}
+
+// rejectStats tracks the reject messages received from peers by command and
+// reject code, and warns when a block produced by this node is rejected by
+// more than a threshold number of distinct peers.  It is safe for concurrent
+// access.
+type rejectStats struct {
+	mtx               sync.Mutex
+	warnPeers         uint32
+	buckets           map[rejectKey]*rejectBucket
+	ownBlocks         map[chainhash.Hash]*ownBlockRejects
+	ownBlockOrder     []chainhash.Hash
+	ownBlocksRejected uint64
+}
+
+// newRejectStats returns a new reject tracker which warns when a block produced
+// by this node is rejected by more than the passed number of peers.
+func newRejectStats(warnPeers uint32) *rejectStats {
+	return &rejectStats{
+		warnPeers: warnPeers,
+		buckets:   make(map[rejectKey]*rejectBucket),
+		ownBlocks: make(map[chainhash.Hash]*ownBlockRejects),
+	}
+}
+
+// AddOwnBlock records the passed hash as a block produced by this node so the
+// peers rejecting it are tracked.  Only the most recent maxTrackedOwnBlocks
+// blocks are tracked.
+func (rs *rejectStats) AddOwnBlock(hash *chainhash.Hash) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	if _, ok := rs.ownBlocks[*hash]; ok {
+		return
+	}
+	if len(rs.ownBlockOrder) == maxTrackedOwnBlocks {
+		delete(rs.ownBlocks, rs.ownBlockOrder[0])
+		copy(rs.ownBlockOrder, rs.ownBlockOrder[1:])
+		rs.ownBlockOrder = rs.ownBlockOrder[:len(rs.ownBlockOrder)-1]
+	}
+	rs.ownBlocks[*hash] = &ownBlockRejects{
+		peers: make(map[string]struct{}),
+	}
+	rs.ownBlockOrder = append(rs.ownBlockOrder, *hash)
+}
+
+// Record records the passed reject message received from the peer with the
+// passed address.
+func (rs *rejectStats) Record(peerAddr string, msg *wire.MsgReject) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	// The hash is only part of rejects for blocks and transactions.
+	var hash *chainhash.Hash
+	if msg.Cmd == wire.CmdBlock || msg.Cmd == wire.CmdTx {
+		hash = &chainhash.Hash{}
+		*hash = msg.Hash
+	}
+
+	key := rejectKey{command: msg.Cmd, code: msg.Code}
+	bucket, ok := rs.buckets[key]
+	if !ok {
+		if len(rs.buckets) >= maxRejectBuckets {
+			key.command = rejectOtherCommand
+			bucket, ok = rs.buckets[key]
+		}
+		if !ok {
+			bucket = &rejectBucket{}
+			rs.buckets[key] = bucket
+		}
+	}
+	reason := msg.Reason
+	if len(reason) > maxRejectReasonLen {
+		reason = reason[:maxRejectReasonLen] + "..."
+	}
+	bucket.count++
+	bucket.lastHash = hash
+	bucket.lastReason = reason
+	bucket.lastPeer = peerAddr
+	bucket.lastTime = time.Now()
+
+	// Warn once the number of distinct peers which rejected a block
+	// produced by this node exceeds the threshold.
+	if msg.Cmd != wire.CmdBlock {
+		return
+	}
+	own, ok := rs.ownBlocks[msg.Hash]
+	if !ok {
+		return
+	}
+	own.peers[peerAddr] = struct{}{}
+	if own.warned || uint32(len(own.peers)) <= rs.warnPeers {
+		return
+	}
+	own.warned = true
+	rs.ownBlocksRejected++
+	srvrLog.Warnf("Block %v produced by this node was rejected by %d "+
+		"peers, most recently %s: %s (%v)", msg.Hash, len(own.peers),
+		peerAddr, reason, msg.Code)
+}
+
+// rejectKeySorter implements sort.Interface to allow a slice of reject keys to
+// be sorted by command and then by reject code.
+type rejectKeySorter []rejectKey
+
+// Len returns the number of keys in the slice.  It is part of the
+// sort.Interface implementation.
+func (s rejectKeySorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the keys at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s rejectKeySorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the key with index i should sort before the key with
+// index j.  It is part of the sort.Interface implementation.
+func (s rejectKeySorter) Less(i, j int) bool {
+	if s[i].command != s[j].command {
+		return s[i].command < s[j].command
+	}
+	return s[i].code < s[j].code
+}
+
+// sortedKeys returns the keys of the buckets ordered by command and then by
+// reject code.
+//
+// This function MUST be called with the stats lock held.
+func (rs *rejectStats) sortedKeys() []rejectKey {
+	keys := make([]rejectKey, 0, len(rs.buckets))
+	for key := range rs.buckets {
+		keys = append(keys, key)
+	}
+	sort.Sort(rejectKeySorter(keys))
+	return keys
+}
+
+// Summary returns the rejects received by command and reject code along with
+// the tracked blocks produced by this node which were rejected by any peers.
+func (rs *rejectStats) Summary() *btcjson.GetRejectSummaryResult {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	result := &btcjson.GetRejectSummaryResult{
+		WarnPeers:         rs.warnPeers,
+		OwnBlocksRejected: rs.ownBlocksRejected,
+		Rejects: make([]btcjson.RejectBucketResult, 0,
+			len(rs.buckets)),
+		OwnBlocks: make([]btcjson.RejectedOwnBlockResult, 0),
+	}
+	for _, key := range rs.sortedKeys() {
+		bucket := rs.buckets[key]
+		reject := btcjson.RejectBucketResult{
+			Command:    key.command,
+			Code:       uint8(key.code),
+			CodeName:   key.code.String(),
+			Count:      bucket.count,
+			LastReason: bucket.lastReason,
+			LastPeer:   bucket.lastPeer,
+			LastTime:   bucket.lastTime.Unix(),
+		}
+		if bucket.lastHash != nil {
+			reject.LastHash = bucket.lastHash.String()
+		}
+		result.Rejects = append(result.Rejects, reject)
+	}
+	for _, hash := range rs.ownBlockOrder {
+		own := rs.ownBlocks[hash]
+		if len(own.peers) == 0 {
+			continue
+		}
+		result.OwnBlocks = append(result.OwnBlocks,
+			btcjson.RejectedOwnBlockResult{
+				Hash:  hash.String(),
+				Peers: uint32(len(own.peers)),
+			})
+	}
+	return result
+}
+
+// WriteMetrics writes the number of rejects received by command and reject
+// code and the number of blocks produced by this node which were rejected by
+// more than the threshold number of peers to the passed writer in the
+// Prometheus text exposition format.
+func (rs *rejectStats) WriteMetrics(w io.Writer) error {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteString("# HELP prova_rejects_received_total Number of reject " +
+		"messages received from peers by command and reject code.\n")
+	buf.WriteString("# TYPE prova_rejects_received_total counter\n")
+	for _, key := range rs.sortedKeys() {
+		fmt.Fprintf(&buf, "prova_rejects_received_total{command=%q,"+
+			"code=%q} %d\n", key.command, key.code.String(),
+			rs.buckets[key].count)
+	}
+
+	buf.WriteString("# HELP prova_own_blocks_rejected_total Number of " +
+		"blocks produced by this node which were rejected by more " +
+		"than the warning threshold of peers.\n")
+	buf.WriteString("# TYPE prova_own_blocks_rejected_total counter\n")
+	fmt.Fprintf(&buf, "prova_own_blocks_rejected_total %d\n",
+		rs.ownBlocksRejected)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/peer"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestRejectStats ensures reject messages received by a server peer are
+// counted by command and reject code with the details of the most recent one,
+// that blocks produced by the node which are rejected by more than the
+// threshold number of peers are counted, and that the results are exposed by
+// the getrejectsummary command and the metrics.
+func TestRejectStats(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	// Rejected blocks are passed on to the block manager, which only
+	// queues them here.
+	s := &server{
+		chainParams:  &params,
+		rejectStats:  newRejectStats(2),
+		blockManager: &blockManager{msgChan: make(chan interface{}, 1)},
+	}
+
+	// Connect a server peer to a remote peer which negotiates the protocol.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+	remoteConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	defer remoteConn.Close()
+	localConn, ok := <-accepted
+	if !ok {
+		t.Fatalf("unable to accept connection")
+	}
+	sp := newServerPeer(s, false)
+	sp.Peer = peer.NewInboundPeer(&peer.Config{
+		ChainParams: &params,
+		Listeners: peer.MessageListeners{
+			OnReject: sp.OnReject,
+		},
+	})
+	sp.AssociateConnection(localConn)
+	defer sp.Disconnect()
+
+	pver := peer.MaxProtocolVersion
+	btcnet := params.Net
+	addr := wire.NewNetAddressIPPort(net.ParseIP("127.0.0.1"), 0, 0)
+	version := wire.NewMsgVersion(addr, addr, 1, 0)
+	if err := wire.WriteMessage(remoteConn, version, pver, btcnet); err != nil {
+		t.Fatalf("unable to send version: %v", err)
+	}
+	go func() {
+		for {
+			msg, _, err := wire.ReadMessage(remoteConn, pver, btcnet)
+			if err != nil {
+				return
+			}
+			if _, ok := msg.(*wire.MsgVersion); ok {
+				wire.WriteMessage(remoteConn, wire.NewMsgVerAck(),
+					pver, btcnet)
+			}
+		}
+	}()
+
+	// Send rejects for a block produced by the node, a transaction, and a
+	// command without a hash.
+	ownHash := chainhash.Hash{1}
+	s.rejectStats.AddOwnBlock(&ownHash)
+	txHash := chainhash.Hash{2}
+	rejects := []*wire.MsgReject{
+		{Cmd: wire.CmdBlock, Code: wire.RejectInvalid,
+			Reason: "bad-txnmrklroot", Hash: ownHash},
+		{Cmd: wire.CmdTx, Code: wire.RejectDust, Reason: "dust",
+			Hash: chainhash.Hash{3}},
+		{Cmd: wire.CmdTx, Code: wire.RejectDust,
+			Reason: strings.Repeat("a", maxRejectReasonLen*2),
+			Hash:   txHash},
+		{Cmd: wire.CmdVersion, Code: wire.RejectObsolete,
+			Reason: "obsolete"},
+	}
+	for _, msg := range rejects {
+		err := wire.WriteMessage(remoteConn, msg, pver, btcnet)
+		if err != nil {
+			t.Fatalf("unable to send reject: %v", err)
+		}
+	}
+
+	// summary returns the result of the getrejectsummary command.
+	rpcServer := &rpcServer{server: s}
+	summary := func() *btcjson.GetRejectSummaryResult {
+		cmd := btcjson.NewGetRejectSummaryCmd()
+		result, err := handleGetRejectSummary(rpcServer, cmd, nil)
+		if err != nil {
+			t.Fatalf("getrejectsummary: unexpected error: %v", err)
+		}
+		return result.(*btcjson.GetRejectSummaryResult)
+	}
+
+	// Wait for all of the rejects to be handled.
+	deadline := time.Now().Add(time.Second * 10)
+	for {
+		var count uint64
+		for _, reject := range summary().Rejects {
+			count += reject.Count
+		}
+		if count == uint64(len(rejects)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for rejects, got %d", count)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// The rejects are counted by command and code in order, keep the
+	// details of the most recent one, and only include the hash for
+	// blocks and transactions.
+	result := summary()
+	peerAddr := sp.Addr()
+	want := []btcjson.RejectBucketResult{
+		{Command: wire.CmdBlock, Code: uint8(wire.RejectInvalid),
+			CodeName: "REJECT_INVALID", Count: 1,
+			LastHash: ownHash.String(), LastReason: "bad-txnmrklroot",
+			LastPeer: peerAddr},
+		{Command: wire.CmdTx, Code: uint8(wire.RejectDust),
+			CodeName: "REJECT_DUST", Count: 2,
+			LastHash:   txHash.String(),
+			LastReason: strings.Repeat("a", maxRejectReasonLen) + "...",
+			LastPeer:   peerAddr},
+		{Command: wire.CmdVersion, Code: uint8(wire.RejectObsolete),
+			CodeName: "REJECT_OBSOLETE", Count: 1,
+			LastReason: "obsolete", LastPeer: peerAddr},
+	}
+	if len(result.Rejects) != len(want) {
+		t.Fatalf("got %d reject buckets, want %d: %+v",
+			len(result.Rejects), len(want), result.Rejects)
+	}
+	for i, got := range result.Rejects {
+		if got.LastTime == 0 {
+			t.Fatalf("reject bucket %d: missing last time", i)
+		}
+		got.LastTime = 0
+		if got != want[i] {
+			t.Fatalf("reject bucket %d: got %+v, want %+v", i, got,
+				want[i])
+		}
+	}
+
+	// The block produced by the node was rejected by a single peer, which
+	// does not exceed the threshold.
+	if result.WarnPeers != 2 || result.OwnBlocksRejected != 0 {
+		t.Fatalf("got warnpeers %d, ownblocksrejected %d, want 2 and 0",
+			result.WarnPeers, result.OwnBlocksRejected)
+	}
+	if len(result.OwnBlocks) != 1 || result.OwnBlocks[0].Peers != 1 ||
+		result.OwnBlocks[0].Hash != ownHash.String() {
+
+		t.Fatalf("unexpected rejected own blocks %+v", result.OwnBlocks)
+	}
+
+	// Repeated rejects from the same peer don't count towards the
+	// threshold, while a third distinct peer exceeds it exactly once.
+	block := &wire.MsgReject{Cmd: wire.CmdBlock, Code: wire.RejectInvalid,
+		Reason: "bad-txnmrklroot", Hash: ownHash}
+	s.rejectStats.Record(peerAddr, block)
+	s.rejectStats.Record("10.0.0.1:7979", block)
+	if got := summary().OwnBlocksRejected; got != 0 {
+		t.Fatalf("got ownblocksrejected %d with 2 peers, want 0", got)
+	}
+	s.rejectStats.Record("10.0.0.2:7979", block)
+	s.rejectStats.Record("10.0.0.3:7979", block)
+	result = summary()
+	if result.OwnBlocksRejected != 1 || result.OwnBlocks[0].Peers != 4 {
+		t.Fatalf("got ownblocksrejected %d with %d peers, want 1 with 4",
+			result.OwnBlocksRejected, result.OwnBlocks[0].Peers)
+	}
+
+	// Rejects for blocks which were not produced by the node are not
+	// tracked as own blocks.
+	for i := 0; i < 3; i++ {
+		s.rejectStats.Record(fmt.Sprintf("10.0.1.%d:7979", i),
+			&wire.MsgReject{Cmd: wire.CmdBlock,
+				Code: wire.RejectInvalid, Hash: chainhash.Hash{4}})
+	}
+	if got := summary(); got.OwnBlocksRejected != 1 ||
+		len(got.OwnBlocks) != 1 {
+
+		t.Fatalf("unexpected rejected own blocks %+v", got.OwnBlocks)
+	}
+
+	// Once the maximum number of buckets is reached, rejects for new
+	// commands are counted under the other command.
+	for i := 0; len(s.rejectStats.Summary().Rejects) < maxRejectBuckets; i++ {
+		s.rejectStats.Record(peerAddr, &wire.MsgReject{
+			Cmd: fmt.Sprintf("cmd%d", i), Code: wire.RejectInvalid})
+	}
+	for i := 0; i < 2; i++ {
+		s.rejectStats.Record(peerAddr, &wire.MsgReject{
+			Cmd: fmt.Sprintf("extra%d", i), Code: wire.RejectInvalid})
+	}
+	result = summary()
+	if len(result.Rejects) != maxRejectBuckets+1 {
+		t.Fatalf("got %d reject buckets, want %d", len(result.Rejects),
+			maxRejectBuckets+1)
+	}
+	var other *btcjson.RejectBucketResult
+	for i := range result.Rejects {
+		if result.Rejects[i].Command == rejectOtherCommand {
+			other = &result.Rejects[i]
+		}
+	}
+	if other == nil || other.Count != 2 {
+		t.Fatalf("unexpected other reject bucket %+v", other)
+	}
+
+	// The metrics contain the reject counts and the rejected own blocks.
+	var buf bytes.Buffer
+	if err := s.rejectStats.WriteMetrics(&buf); err != nil {
+		t.Fatalf("WriteMetrics: unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		`prova_rejects_received_total{command="block",code="REJECT_INVALID"} 8`,
+		`prova_rejects_received_total{command="tx",code="REJECT_DUST"} 2`,
+		`prova_rejects_received_total{command="other",code="REJECT_INVALID"} 2`,
+		"prova_own_blocks_rejected_total 1",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, buf.String())
+		}
+	}
+}
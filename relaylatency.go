@@ -0,0 +1,139 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// maxPendingRelays is the maximum number of transactions accepted to
+	// the memory pool which are tracked until their inventory is first
+	// sent to a peer.
+	maxPendingRelays = 10000
+
+	// pendingRelayExpiry is how long a transaction accepted to the memory
+	// pool is tracked when its inventory is not sent to any peer, such as
+	// when there are no peers to relay it to.
+	pendingRelayExpiry = time.Minute * 10
+)
+
+// relayLatencyBuckets are the upper bounds, in seconds, of the buckets of the
+// relay latency histogram.
+var relayLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// relayLatencyStats tracks the time from the acceptance of transactions to the
+// memory pool to the first inventory message announcing them sent to any peer,
+// which includes the time they wait for the next batch of inventory to be
+// trickled.  It is safe for concurrent access.
+type relayLatencyStats struct {
+	mtx     sync.Mutex
+	pending map[chainhash.Hash]time.Time
+	buckets []uint64
+	count   uint64
+	sum     float64
+	expired uint64
+}
+
+// newRelayLatencyStats returns a new relay latency tracker.
+func newRelayLatencyStats() *relayLatencyStats {
+	return &relayLatencyStats{
+		pending: make(map[chainhash.Hash]time.Time),
+		buckets: make([]uint64, len(relayLatencyBuckets)),
+	}
+}
+
+// Accepted records the passed time as the time the transaction with the passed
+// hash was accepted to the memory pool.  Once the maximum number of tracked
+// transactions is reached, the transactions tracked for longer than
+// pendingRelayExpiry are dropped, and new transactions aren't tracked while
+// none of them can be.
+func (rs *relayLatencyStats) Accepted(hash *chainhash.Hash, accepted time.Time) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	if len(rs.pending) >= maxPendingRelays {
+		for pendingHash, pendingTime := range rs.pending {
+			if accepted.Sub(pendingTime) > pendingRelayExpiry {
+				delete(rs.pending, pendingHash)
+				rs.expired++
+			}
+		}
+		if len(rs.pending) >= maxPendingRelays {
+			return
+		}
+	}
+	rs.pending[*hash] = accepted
+}
+
+// InvSent records the latency of the tracked transactions announced by the
+// passed inventory message, which was sent to a peer at the passed time.  Only
+// the first announcement of each transaction is recorded.
+func (rs *relayLatencyStats) InvSent(msg *wire.MsgInv, sent time.Time) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	for _, iv := range msg.InvList {
+		if iv.Type != wire.InvTypeTx {
+			continue
+		}
+		accepted, ok := rs.pending[iv.Hash]
+		if !ok {
+			continue
+		}
+		delete(rs.pending, iv.Hash)
+
+		latency := sent.Sub(accepted).Seconds()
+		if latency < 0 {
+			latency = 0
+		}
+		for i, bound := range relayLatencyBuckets {
+			if latency <= bound {
+				rs.buckets[i]++
+			}
+		}
+		rs.count++
+		rs.sum += latency
+	}
+}
+
+// WriteMetrics writes the histogram of the relay latencies of the transactions
+// and the number of transactions which were never announced to the passed
+// writer in the Prometheus text exposition format.
+func (rs *relayLatencyStats) WriteMetrics(w io.Writer) error {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteString("# HELP prova_tx_relay_latency_seconds Time from the " +
+		"acceptance of transactions to the memory pool to the first " +
+		"inventory message announcing them sent to a peer.\n")
+	buf.WriteString("# TYPE prova_tx_relay_latency_seconds histogram\n")
+	for i, bound := range relayLatencyBuckets {
+		fmt.Fprintf(&buf, "prova_tx_relay_latency_seconds_bucket{le=\"%g\"} "+
+			"%d\n", bound, rs.buckets[i])
+	}
+	fmt.Fprintf(&buf, "prova_tx_relay_latency_seconds_bucket{le=\"+Inf\"} "+
+		"%d\n", rs.count)
+	fmt.Fprintf(&buf, "prova_tx_relay_latency_seconds_sum %g\n", rs.sum)
+	fmt.Fprintf(&buf, "prova_tx_relay_latency_seconds_count %d\n", rs.count)
+
+	buf.WriteString("# HELP prova_tx_relay_expired_total Number of " +
+		"transactions accepted to the memory pool which were not " +
+		"announced to any peer before their relay latency stopped " +
+		"being tracked.\n")
+	buf.WriteString("# TYPE prova_tx_relay_expired_total counter\n")
+	fmt.Fprintf(&buf, "prova_tx_relay_expired_total %d\n", rs.expired)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/mining"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestRelayLatencyStats ensures the latency from the acceptance of transactions
+// to their first announcement is recorded once per transaction in the buckets
+// of the histogram exposed by the metrics.
+func TestRelayLatencyStats(t *testing.T) {
+	rs := newRelayLatencyStats()
+	accepted := time.Unix(1500000000, 0)
+	hashes := []chainhash.Hash{{0x01}, {0x02}, {0x03}}
+	for i := range hashes {
+		rs.Accepted(&hashes[i], accepted)
+	}
+
+	// The first transaction is announced after 200ms along with a block
+	// and a transaction which isn't tracked, and the second one after 3s.
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &hashes[0]))
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &hashes[1]))
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &chainhash.Hash{0x04}))
+	rs.InvSent(inv, accepted.Add(time.Millisecond*200))
+	inv = wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &hashes[1]))
+	rs.InvSent(inv, accepted.Add(time.Second*3))
+
+	// Announcing the first transaction to another peer is not recorded.
+	inv = wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &hashes[0]))
+	rs.InvSent(inv, accepted.Add(time.Second*20))
+
+	if rs.count != 2 || len(rs.pending) != 1 {
+		t.Fatalf("got %d latencies and %d pending transactions, want "+
+			"2 and 1", rs.count, len(rs.pending))
+	}
+	var buf bytes.Buffer
+	if err := rs.WriteMetrics(&buf); err != nil {
+		t.Fatalf("WriteMetrics: unexpected error: %v", err)
+	}
+	for _, line := range []string{
+		`prova_tx_relay_latency_seconds_bucket{le="0.1"} 0`,
+		`prova_tx_relay_latency_seconds_bucket{le="0.25"} 1`,
+		`prova_tx_relay_latency_seconds_bucket{le="2.5"} 1`,
+		`prova_tx_relay_latency_seconds_bucket{le="5"} 2`,
+		`prova_tx_relay_latency_seconds_bucket{le="+Inf"} 2`,
+		`prova_tx_relay_latency_seconds_sum 3.2`,
+		`prova_tx_relay_latency_seconds_count 2`,
+		`prova_tx_relay_expired_total 0`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("metrics missing %q:\n%s", line, buf.String())
+		}
+	}
+}
+
+// TestRelayImmediately ensures blocks and admin transactions are announced
+// right away while other transactions are trickled.
+func TestRelayImmediately(t *testing.T) {
+	threadScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(provautil.RootThread)).
+		AddOp(txscript.OP_CHECKTHREAD).Script()
+	if err != nil {
+		t.Fatalf("unable to create thread script: %v", err)
+	}
+	adminTx := wire.NewMsgTx(1)
+	adminTx.AddTxOut(wire.NewTxOut(0, threadScript))
+	tx := wire.NewMsgTx(1)
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{txscript.OP_TRUE}))
+	txDesc := func(msgTx *wire.MsgTx) *mempool.TxDesc {
+		return &mempool.TxDesc{TxDesc: mining.TxDesc{
+			Tx: provautil.NewTx(msgTx),
+		}}
+	}
+
+	tests := []struct {
+		name string
+		msg  relayMsg
+		want bool
+	}{
+		{
+			name: "block",
+			msg: relayMsg{invVect: wire.NewInvVect(wire.InvTypeBlock,
+				&chainhash.Hash{})},
+			want: true,
+		},
+		{
+			name: "admin transaction",
+			msg: relayMsg{invVect: wire.NewInvVect(wire.InvTypeTx,
+				&chainhash.Hash{}), data: txDesc(adminTx)},
+			want: true,
+		},
+		{
+			name: "transaction",
+			msg: relayMsg{invVect: wire.NewInvVect(wire.InvTypeTx,
+				&chainhash.Hash{}), data: txDesc(tx)},
+			want: false,
+		},
+		{
+			name: "transaction without details",
+			msg: relayMsg{invVect: wire.NewInvVect(wire.InvTypeTx,
+				&chainhash.Hash{})},
+			want: false,
+		},
+	}
+	for _, test := range tests {
+		if got := relayImmediately(test.msg); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provarpc"
+	"github.com/bitgo/prova/provautil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// replicationRetryInterval is how long the replication client waits before
+// resuming the replication stream after it failed.
+const replicationRetryInterval = time.Second * 5
+
+// replicationGap signifies that the replication stream skipped events, so the
+// standby can't tell how the main chain of the primary changed.
+type replicationGap string
+
+// Error implements the error interface.
+func (e replicationGap) Error() string {
+	return "replication stream gap: " + string(e)
+}
+
+// replicationDiverged signifies that the chain of the standby is not the chain
+// the primary streams, or that the standby derived a different chain state from
+// the blocks of the primary.
+type replicationDiverged string
+
+// Error implements the error interface.
+func (e replicationDiverged) Error() string {
+	return "standby diverged from primary: " + string(e)
+}
+
+// replicationProcessFunc processes a block received through the replication
+// stream with the passed flags.
+type replicationProcessFunc func(block *provautil.Block, flags blockchain.BehaviorFlags) (blockchain.BlockStatus, error)
+
+// replicatedBlock houses the chain state a primary derived from a block, which
+// is compared against the one of the standby once the block is in its main
+// chain.
+type replicatedBlock struct {
+	hash         *chainhash.Hash
+	spendJournal []byte
+	adminOps     []*provarpc.AdminOp
+}
+
+// replicationClient keeps the chain of a hot standby node in line with the
+// main chain of a primary node by following the replication stream of the
+// gRPC server of the primary instead of syncing from peers.  Blocks which
+// extend the best block of the standby are added without validating their
+// transactions unless full validation was requested, since the primary already
+// validated them, and the spend journal entry and admin operations the standby
+// derives from each block are checked against those of the primary instead.
+//
+// When the stream fails, it is resumed from the best block of the standby.  The
+// client stops and calls its fall back function, which resumes syncing from
+// peers, when the stream skips events or the standby diverges from the
+// primary, such as when the primary reorganized away from the best block of
+// the standby while it was not following.
+type replicationClient struct {
+	started       int32
+	shutdown      int32
+	conn          *grpc.ClientConn
+	client        provarpc.ProvaClient
+	token         string
+	validate      bool
+	chain         *blockchain.BlockChain
+	process       replicationProcessFunc
+	fallBack      func()
+	retryInterval time.Duration
+	ctx           context.Context
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+
+	// The following fields track the stream being followed.  The tip is
+	// the last block of the main chain of the primary the stream delivered,
+	// or nil before the block at the start height was delivered.  They are
+	// only accessed by the replication handler.
+	startHeight uint32
+	sequence    uint64
+	tip         *chainhash.Hash
+	reorging    bool
+	unverified  []*replicatedBlock
+}
+
+// dialReplication returns a connection to the gRPC server of a primary node at
+// the passed address.  It uses TLS with the certificate in the passed file
+// unless no file is passed.
+func dialReplication(addr, certFile string) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if certFile != "" {
+		var err error
+		creds, err = credentials.NewClientTLSFromFile(certFile, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+}
+
+// newReplicationClient returns a replication client which follows the primary
+// on the other end of the passed connection, authenticating with the passed
+// admin token, and adds its blocks to the passed chain with the passed process
+// function.  The passed fall back function is called when the client stops
+// following the primary on its own.
+func newReplicationClient(conn *grpc.ClientConn, token string, validate bool,
+	chain *blockchain.BlockChain, process replicationProcessFunc,
+	fallBack func()) *replicationClient {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &replicationClient{
+		conn:          conn,
+		client:        provarpc.NewProvaClient(conn),
+		token:         token,
+		validate:      validate,
+		chain:         chain,
+		process:       process,
+		fallBack:      fallBack,
+		retryInterval: replicationRetryInterval,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Start begins following the primary.
+func (c *replicationClient) Start() {
+	if atomic.AddInt32(&c.started, 1) != 1 {
+		return
+	}
+
+	replLog.Trace("Starting replication client")
+	c.wg.Add(1)
+	go c.replicationHandler()
+}
+
+// Stop stops following the primary, waits for the replication handler to
+// finish, and closes the connection to the primary.
+func (c *replicationClient) Stop() {
+	if atomic.AddInt32(&c.shutdown, 1) != 1 {
+		return
+	}
+
+	c.cancel()
+	c.wg.Wait()
+	c.conn.Close()
+}
+
+// replicationHandler follows the replication stream, resuming it when it
+// fails, until the client is stopped or the stream can no longer be followed.
+// It must be run as a goroutine.
+func (c *replicationClient) replicationHandler() {
+	defer c.wg.Done()
+
+	for {
+		err := c.follow()
+		if c.ctx.Err() != nil {
+			return
+		}
+		switch err.(type) {
+		case replicationGap, replicationDiverged:
+			replLog.Errorf("Stopped following the primary: %v -- "+
+				"syncing from peers instead", err)
+			if c.fallBack != nil {
+				c.fallBack()
+			}
+			return
+		}
+
+		replLog.Warnf("Replication stream failed: %v -- resuming in %v",
+			err, c.retryInterval)
+		select {
+		case <-time.After(c.retryInterval):
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// follow opens a replication stream starting at the best block of the standby
+// and applies its events until it fails.
+func (c *replicationClient) follow() error {
+	best := c.chain.BestSnapshot()
+	c.startHeight = best.Height
+	c.sequence = 0
+	c.tip = nil
+	c.reorging = false
+	c.unverified = nil
+
+	ctx := metadata.AppendToOutgoingContext(c.ctx, grpcAuthMetadataKey,
+		"Bearer "+c.token)
+	stream, err := c.client.StreamReplication(ctx,
+		&provarpc.StreamReplicationRequest{StartHeight: best.Height})
+	if err != nil {
+		return err
+	}
+	replLog.Infof("Following the primary from block %v (height %d)",
+		best.Hash, best.Height)
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if err := c.handleEvent(event); err != nil {
+			return err
+		}
+	}
+}
+
+// handleEvent applies the passed event of the replication stream.
+func (c *replicationClient) handleEvent(event *provarpc.ReplicationEvent) error {
+	if event.Sequence != c.sequence+1 {
+		str := fmt.Sprintf("got event %d after event %d", event.Sequence,
+			c.sequence)
+		return replicationGap(str)
+	}
+	c.sequence = event.Sequence
+
+	hash, err := chainhash.NewHashFromStr(event.Hash)
+	if err != nil {
+		str := fmt.Sprintf("event %d has malformed block hash %q",
+			event.Sequence, event.Hash)
+		return replicationGap(str)
+	}
+	switch event.Type {
+	case provarpc.ReplicationEvent_CONNECTED:
+		return c.handleConnected(event, hash)
+	case provarpc.ReplicationEvent_DISCONNECTED:
+		return c.handleDisconnected(event, hash)
+	}
+	str := fmt.Sprintf("event %d has unknown type %v", event.Sequence,
+		event.Type)
+	return replicationGap(str)
+}
+
+// handleConnected adds the block of the passed connected event to the chain.
+// The first block of the stream is the best block of the standby when the
+// stream was opened, so it is only checked against the main chain of the
+// standby.
+func (c *replicationClient) handleConnected(event *provarpc.ReplicationEvent, hash *chainhash.Hash) error {
+	block, err := provautil.NewBlockFromBytesEncoding(event.Block,
+		c.chain.TxEncoding())
+	if err != nil || !block.Hash().IsEqual(hash) {
+		str := fmt.Sprintf("event %d has a malformed block",
+			event.Sequence)
+		return replicationGap(str)
+	}
+
+	if c.tip == nil {
+		if event.Height != c.startHeight {
+			str := fmt.Sprintf("stream started with block %v at "+
+				"height %d instead of height %d", hash,
+				event.Height, c.startHeight)
+			return replicationGap(str)
+		}
+		own, err := c.chain.BlockHashByHeight(c.startHeight)
+		if err != nil {
+			return err
+		}
+		if !own.IsEqual(hash) {
+			str := fmt.Sprintf("the block at height %d is %v on "+
+				"the standby and %v on the primary",
+				c.startHeight, own, hash)
+			return replicationDiverged(str)
+		}
+		c.tip = hash
+		return nil
+	}
+
+	// The stream only disconnects blocks down to the start height, so a
+	// block there which does not extend the last block of the stream means
+	// the primary reorganized away from the chain of the standby below it.
+	header := &block.MsgBlock().Header
+	if header.PrevBlock != *c.tip {
+		str := fmt.Sprintf("block %v does not extend the last block %v "+
+			"of the stream", hash, c.tip)
+		if event.Height == c.startHeight {
+			return replicationDiverged(str)
+		}
+		return replicationGap(str)
+	}
+
+	// Blocks which extend the best block are added without validating
+	// their transactions unless full validation was requested.  Side chain
+	// blocks, such as those of a reorganization, are always validated.
+	flags := blockchain.BFNone
+	if !c.validate && header.PrevBlock == *c.chain.BestSnapshot().Hash {
+		flags = blockchain.BFFastAdd
+	}
+	if _, err := c.process(block, flags); err != nil && !isDuplicateBlock(err) {
+		str := fmt.Sprintf("block %v of the primary was rejected: %v",
+			hash, err)
+		return replicationDiverged(str)
+	}
+	c.tip = hash
+	c.unverified = append(c.unverified, &replicatedBlock{
+		hash:         hash,
+		spendJournal: event.SpendJournal,
+		adminOps:     event.AdminOps,
+	})
+
+	// The standby only reorganizes to the new main chain of the primary
+	// once it has more work than the old one, which may take more than one
+	// block.  Otherwise the block is part of its main chain now.
+	onMainChain, err := c.chain.MainChainHasBlock(hash)
+	if err != nil {
+		return err
+	}
+	if !onMainChain {
+		if c.reorging {
+			return nil
+		}
+		str := fmt.Sprintf("block %v of the primary is not in the "+
+			"main chain of the standby", hash)
+		return replicationDiverged(str)
+	}
+	c.reorging = false
+	for _, rb := range c.unverified {
+		if err := c.verify(rb); err != nil {
+			return err
+		}
+	}
+	c.unverified = nil
+	return nil
+}
+
+// handleDisconnected steps the tip of the stream back to the parent of the
+// block of the passed disconnected event.  The chain of the standby is
+// reorganized once the blocks of the new main chain of the primary arrive.
+func (c *replicationClient) handleDisconnected(event *provarpc.ReplicationEvent, hash *chainhash.Hash) error {
+	if c.tip == nil || !c.tip.IsEqual(hash) {
+		str := fmt.Sprintf("disconnected block %v is not the last "+
+			"block %v of the stream", hash, c.tip)
+		return replicationGap(str)
+	}
+	header, err := c.chain.FetchHeader(hash)
+	if err != nil {
+		return err
+	}
+
+	c.tip = &header.PrevBlock
+	if n := len(c.unverified); n > 0 && c.unverified[n-1].hash.IsEqual(hash) {
+		c.unverified = c.unverified[:n-1]
+	}
+	c.reorging = true
+	return nil
+}
+
+// verify checks the spend journal entry and the admin operations the standby
+// derived from the passed block of its main chain against those of the
+// primary.
+func (c *replicationClient) verify(rb *replicatedBlock) error {
+	journal, err := c.chain.FetchSpendJournal(rb.hash)
+	if err != nil {
+		str := fmt.Sprintf("block %v is not in the main chain of the "+
+			"standby: %v", rb.hash, err)
+		return replicationDiverged(str)
+	}
+	if !bytes.Equal(journal, rb.spendJournal) {
+		str := fmt.Sprintf("the spend journal entry of block %v "+
+			"differs from the one of the primary", rb.hash)
+		return replicationDiverged(str)
+	}
+
+	records, err := c.chain.AdminOpsInBlock(rb.hash)
+	if err != nil {
+		return err
+	}
+	adminOps := replicationAdminOps(records)
+	match := len(adminOps) == len(rb.adminOps)
+	for i := 0; match && i < len(adminOps); i++ {
+		match = proto.Equal(adminOps[i], rb.adminOps[i])
+	}
+	if !match {
+		str := fmt.Sprintf("the admin operations of block %v differ "+
+			"from those of the primary", rb.hash)
+		return replicationDiverged(str)
+	}
+	return nil
+}
+
+// isDuplicateBlock returns whether the passed error rejected a block the chain
+// already has, such as one a peer relayed to the standby before the primary
+// streamed it.
+func isDuplicateBlock(err error) bool {
+	rerr, ok := err.(blockchain.RuleError)
+	return ok && rerr.ErrorCode == blockchain.ErrDuplicateBlock
+}
+
+// replicationAdminOps returns the passed admin operation records in the format
+// used by the replication stream.  The types of the operations have the same
+// values in both formats.
+func replicationAdminOps(records []blockchain.AdminOpRecord) []*provarpc.AdminOp {
+	adminOps := make([]*provarpc.AdminOp, 0, len(records))
+	for i := range records {
+		record := &records[i]
+		adminOp := &provarpc.AdminOp{
+			Txid:   record.TxHash.String(),
+			Thread: uint32(record.Thread),
+			Type:   provarpc.AdminOp_Type(record.Op),
+		}
+		switch record.Op {
+		case blockchain.AdminOpAddKey, blockchain.AdminOpRevokeKey:
+			adminOp.KeySet = uint32(record.KeySet)
+			if record.PubKey != nil {
+				adminOp.PubKey = record.PubKey.SerializeCompressed()
+			}
+			adminOp.KeyId = uint32(record.KeyID)
+			adminOp.SetSize = uint64(record.SetSize)
+		case blockchain.AdminOpIssue, blockchain.AdminOpDestroy:
+			adminOp.Amount = record.Amount
+			adminOp.TotalSupply = record.TotalSupply
+		}
+		adminOps = append(adminOps, adminOp)
+	}
+	return adminOps
+}
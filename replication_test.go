@@ -0,0 +1,236 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provarpc"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// replicationTestPrimary serves the replication stream of the chain of the
+// passed harness over gRPC and returns the address of the server along with a
+// function which stops it.
+func replicationTestPrimary(t *testing.T, h *testRPCHarness) (string, func()) {
+	gs := &grpcServer{
+		rpc:          h.rpcServer,
+		authsha:      grpcAuthSHA("admin"),
+		limitauthsha: grpcAuthSHA("limited"),
+	}
+	server := gs.newServer()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	go server.Serve(listener)
+	return listener.Addr().String(), server.Stop
+}
+
+// replicationTestStandby returns a replication client which follows the
+// primary at the passed address into the chain of the passed harness and
+// signals the returned channel when it falls back to syncing from peers.
+func replicationTestStandby(t *testing.T, addr string, h *testRPCHarness) (*replicationClient, chan struct{}) {
+	conn, err := dialReplication(addr, "")
+	if err != nil {
+		t.Fatalf("unable to dial primary: %v", err)
+	}
+	process := func(block *provautil.Block, flags blockchain.BehaviorFlags) (blockchain.BlockStatus, error) {
+		status, _, _, err := h.chain.ProcessBlockStatus(block, flags)
+		return status, err
+	}
+	fellBack := make(chan struct{}, 1)
+	fallBack := func() {
+		fellBack <- struct{}{}
+	}
+	c := newReplicationClient(conn, "admin", false, h.chain, process,
+		fallBack)
+	c.retryInterval = time.Millisecond * 10
+	return c, fellBack
+}
+
+// waitForReplication waits for the best block of the standby to match the one
+// of the primary.
+func waitForReplication(t *testing.T, primary, standby *testRPCHarness) {
+	want := primary.chain.BestSnapshot()
+	deadline := time.Now().Add(time.Second * 30)
+	for !standby.chain.BestSnapshot().Hash.IsEqual(want.Hash) {
+		if time.Now().After(deadline) {
+			t.Fatalf("standby did not reach block %v (height %d), "+
+				"stuck at height %d", want.Hash, want.Height,
+				standby.chain.BestSnapshot().Height)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// TestReplication ensures a standby following the replication stream of a
+// primary ends up with the same chain state as the primary after it processed
+// the tests generated by the fullblocktests package, which include
+// reorganizations, also when the stream is resumed midway.
+func TestReplication(t *testing.T) {
+	// The tests must be generated before the harnesses are created since
+	// generating them signs the genesis block of the regression test
+	// network, which is restored for the other tests afterwards.
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	genesisHeader := genesis.Header
+	defer func() {
+		genesis.Header = genesisHeader
+	}()
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	primary := newTestRPCHarness(t, nil)
+	defer primary.teardown()
+	standby := newTestRPCHarness(t, nil)
+	defer standby.teardown()
+	addr, stopPrimary := replicationTestPrimary(t, primary)
+	defer stopPrimary()
+
+	var disconnected int32
+	standby.chain.Subscribe(func(n *blockchain.Notification) {
+		if n.Type == blockchain.NTBlockDisconnected {
+			atomic.AddInt32(&disconnected, 1)
+		}
+	})
+
+	client, fellBack := replicationTestStandby(t, addr, standby)
+	client.Start()
+	for i, test := range tests {
+		// Resume the stream with a new client halfway through.
+		if i == len(tests)/2 {
+			client.Stop()
+			client, fellBack = replicationTestStandby(t, addr, standby)
+			client.Start()
+		}
+
+		for _, item := range test {
+			var block *wire.MsgBlock
+			switch item := item.(type) {
+			case fullblocktests.AcceptedBlock:
+				block = item.Block
+			case fullblocktests.RejectedBlock:
+				block = item.Block
+			case fullblocktests.OrphanOrRejectedBlock:
+				block = item.Block
+			default:
+				continue
+			}
+			primary.chain.ProcessBlock(provautil.NewBlock(block),
+				blockchain.BFNone)
+		}
+		waitForReplication(t, primary, standby)
+	}
+	client.Stop()
+	select {
+	case <-fellBack:
+		t.Fatalf("standby fell back to syncing from peers")
+	default:
+	}
+
+	if atomic.LoadInt32(&disconnected) == 0 {
+		t.Fatalf("standby never reorganized")
+	}
+	got, want := standby.chain.BestSnapshot(), primary.chain.BestSnapshot()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got best state %+v, want %+v", got, want)
+	}
+	if !bytes.Equal(standby.chain.DumpAdminState(),
+		primary.chain.DumpAdminState()) {
+
+		t.Fatalf("admin state of standby differs from primary:\n%s\n"+
+			"want:\n%s", standby.chain.DumpAdminState(),
+			primary.chain.DumpAdminState())
+	}
+}
+
+// TestReplicationDiverged ensures a standby whose chain is not the chain of
+// the primary, or which misses events of the stream, falls back to syncing
+// from peers, and that the stream requires the admin token.
+func TestReplicationDiverged(t *testing.T) {
+	primary := newTestRPCHarness(t, nil)
+	defer primary.teardown()
+	standby := newTestRPCHarness(t, nil)
+	defer standby.teardown()
+	addr, stopPrimary := replicationTestPrimary(t, primary)
+	defer stopPrimary()
+
+	primary.mineBlock(t)
+	primary.mineBlock(t)
+	standby.mineBlockToPayAddr(t)
+
+	client, fellBack := replicationTestStandby(t, addr, standby)
+	client.Start()
+	select {
+	case <-fellBack:
+	case <-time.After(time.Second * 30):
+		t.Fatalf("diverged standby did not fall back to syncing " +
+			"from peers")
+	}
+	client.Stop()
+	if standby.chain.BestSnapshot().Height != 1 {
+		t.Fatalf("diverged standby processed blocks of the primary")
+	}
+
+	// A skipped event is a gap in the stream.
+	block, err := primary.chain.BlockByHeight(1)
+	if err != nil {
+		t.Fatalf("BlockByHeight: %v", err)
+	}
+	blockBytes, err := block.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	client, _ = replicationTestStandby(t, addr, standby)
+	defer client.conn.Close()
+	client.sequence = 1
+	err = client.handleEvent(&provarpc.ReplicationEvent{
+		Sequence: 3,
+		Type:     provarpc.ReplicationEvent_CONNECTED,
+		Hash:     block.Hash().String(),
+		Height:   1,
+		Block:    blockBytes,
+	})
+	if _, ok := err.(replicationGap); !ok {
+		t.Fatalf("handleEvent with a skipped event: got %v, want a gap",
+			err)
+	}
+
+	// The stream is admin-only.
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		grpcAuthMetadataKey, "Bearer limited")
+	conn, err := grpc.Dial(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("unable to dial primary: %v", err)
+	}
+	defer conn.Close()
+	stream, err := provarpc.NewProvaClient(conn).StreamReplication(ctx,
+		&provarpc.StreamReplicationRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("StreamReplication with the limited token: got %v, "+
+			"want %v", err, codes.PermissionDenied)
+	}
+}
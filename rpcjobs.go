@@ -0,0 +1,318 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+)
+
+// maxRunningRPCJobs is the maximum number of RPC jobs which may run at once.
+// Jobs are started for long running operations which scan the chain or the
+// utxo set, so running many of them at once would starve block processing.
+const maxRunningRPCJobs = 4
+
+// rpcJobState describes the state of an RPC job.
+type rpcJobState int
+
+const (
+	// rpcJobRunning indicates the job is still running.
+	rpcJobRunning rpcJobState = iota
+
+	// rpcJobCompleted indicates the job completed with a result.
+	rpcJobCompleted
+
+	// rpcJobFailed indicates the job stopped with an error.
+	rpcJobFailed
+
+	// rpcJobCancelled indicates the job was cancelled before it completed.
+	rpcJobCancelled
+)
+
+// rpcJobStateStrings is a map of RPC job states back to their constant names
+// for pretty printing.
+var rpcJobStateStrings = map[rpcJobState]string{
+	rpcJobRunning:   "running",
+	rpcJobCompleted: "completed",
+	rpcJobFailed:    "failed",
+	rpcJobCancelled: "cancelled",
+}
+
+// String returns the rpcJobState as a human-readable name.
+func (s rpcJobState) String() string {
+	if str, ok := rpcJobStateStrings[s]; ok {
+		return str
+	}
+	return "unknown"
+}
+
+// rpcJobFunc runs the command of an RPC job until it completes or the passed
+// context is cancelled, reporting its progress through the passed job, and
+// returns the result of the command.
+type rpcJobFunc func(ctx context.Context, job *rpcJob) (interface{}, error)
+
+// rpcJob houses the state of a command run in the background by the startjob
+// command.
+type rpcJob struct {
+	id      string
+	method  string
+	started time.Time
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mtx      sync.Mutex
+	state    rpcJobState
+	progress float64
+	partial  interface{}
+	result   interface{}
+	err      error
+	finished time.Time
+}
+
+// report updates the progress of the job, as a fraction between 0 and 1, and
+// its partial result, which may be nil.  It does nothing for a nil job, so the
+// functions which run commands as jobs can also run them synchronously.
+//
+// This function is safe for concurrent access.
+func (j *rpcJob) report(progress float64, partial interface{}) {
+	if j == nil {
+		return
+	}
+	if progress < 0 {
+		progress = 0
+	} else if progress > 1 {
+		progress = 1
+	}
+
+	j.mtx.Lock()
+	j.progress = progress
+	j.partial = partial
+	j.mtx.Unlock()
+}
+
+// finish records the result of the job once its function returned.  Jobs whose
+// context was cancelled are cancelled regardless of what their function
+// returned.
+func (j *rpcJob) finish(ctx context.Context, result interface{}, err error, now time.Time) {
+	j.mtx.Lock()
+	switch {
+	case ctx.Err() != nil:
+		j.state = rpcJobCancelled
+		j.err = ctx.Err()
+	case err != nil:
+		j.state = rpcJobFailed
+		j.err = err
+	default:
+		j.state = rpcJobCompleted
+		j.progress = 1
+		j.result = result
+	}
+	j.partial = nil
+	j.finished = now
+	j.mtx.Unlock()
+	close(j.done)
+}
+
+// expired returns whether the job finished at least the passed time to live
+// before the passed time.
+func (j *rpcJob) expired(now time.Time, ttl time.Duration) bool {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	return j.state != rpcJobRunning && now.Sub(j.finished) >= ttl
+}
+
+// status returns the status of the job as of the passed time.  The estimated
+// time remaining of running jobs assumes they keep progressing at the average
+// rate they progressed at so far.
+//
+// This function is safe for concurrent access.
+func (j *rpcJob) status(now time.Time) *btcjson.JobStatusResult {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	result := &btcjson.JobStatusResult{
+		ID:       j.id,
+		Method:   j.method,
+		State:    j.state.String(),
+		Progress: j.progress,
+		Started:  j.started.Unix(),
+	}
+	switch j.state {
+	case rpcJobRunning:
+		result.Result = j.partial
+		if j.progress > 0 {
+			elapsed := now.Sub(j.started)
+			remaining := time.Duration(float64(elapsed) *
+				(1 - j.progress) / j.progress)
+			result.ETA = int64(remaining / time.Second)
+		}
+	case rpcJobCompleted:
+		result.Finished = j.finished.Unix()
+		result.Result = j.result
+	default:
+		result.Finished = j.finished.Unix()
+		result.Error = j.err.Error()
+		if rpcErr, ok := j.err.(*btcjson.RPCError); ok {
+			result.Error = rpcErr.Message
+		}
+	}
+	return result
+}
+
+// rpcJobManager runs the commands started by the startjob command in the
+// background and keeps their results for a time to live after they finish so
+// clients can poll for them.
+type rpcJobManager struct {
+	ttl time.Duration
+
+	// now returns the current time and is replaced by tests.
+	now func() time.Time
+
+	mtx  sync.Mutex
+	jobs map[string]*rpcJob
+	quit bool
+	wg   sync.WaitGroup
+}
+
+// newRPCJobManager returns a new RPC job manager which keeps the results of the
+// jobs for the passed time to live after they finish.
+func newRPCJobManager(ttl time.Duration) *rpcJobManager {
+	return &rpcJobManager{
+		ttl:  ttl,
+		now:  time.Now,
+		jobs: make(map[string]*rpcJob),
+	}
+}
+
+// pruneJobs removes the jobs which finished at least the time to live ago.
+//
+// This function MUST be called with the manager lock held.
+func (m *rpcJobManager) pruneJobs() {
+	now := m.now()
+	for id, job := range m.jobs {
+		if job.expired(now, m.ttl) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// start runs the passed function as a new job for the passed method in the
+// background and returns the job.
+//
+// This function is safe for concurrent access.
+func (m *rpcJobManager) start(method string, fn rpcJobFunc) (*rpcJob, error) {
+	var idBytes [8]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return nil, err
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.quit {
+		return nil, errors.New("the RPC server is shutting down")
+	}
+	m.pruneJobs()
+	var running int
+	for _, job := range m.jobs {
+		select {
+		case <-job.done:
+		default:
+			running++
+		}
+	}
+	if running >= maxRunningRPCJobs {
+		return nil, ErrRPCTooManyRequests
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &rpcJob{
+		id:      hex.EncodeToString(idBytes[:]),
+		method:  method,
+		started: m.now(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	m.jobs[job.id] = job
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+
+		result, err := fn(ctx, job)
+		job.finish(ctx, result, err, m.now())
+		rpcsLog.Debugf("RPC job %s (%s) finished: %v", job.id,
+			job.method, job.status(m.now()).State)
+	}()
+	rpcsLog.Debugf("Started RPC job %s (%s)", job.id, method)
+	return job, nil
+}
+
+// lookup returns the job with the passed id.  Jobs which finished at least the
+// time to live ago are no longer found.
+//
+// This function is safe for concurrent access.
+func (m *rpcJobManager) lookup(id string) (*rpcJob, bool) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.pruneJobs()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+// cancel cancels the job with the passed id and waits for it to stop.  Jobs
+// which already finished are left as they are.
+//
+// This function is safe for concurrent access.
+func (m *rpcJobManager) cancel(id string) (*rpcJob, bool) {
+	job, ok := m.lookup(id)
+	if !ok {
+		return nil, false
+	}
+	job.cancel()
+	<-job.done
+	return job, true
+}
+
+// numJobs returns the number of jobs which are running or whose results are
+// kept.
+//
+// This function is safe for concurrent access.
+func (m *rpcJobManager) numJobs() int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.pruneJobs()
+	return len(m.jobs)
+}
+
+// stop cancels all running jobs, waits for them to stop and prevents new jobs
+// from being started.
+//
+// This function is safe for concurrent access.
+func (m *rpcJobManager) stop() {
+	m.mtx.Lock()
+	m.quit = true
+	for _, job := range m.jobs {
+		job.cancel()
+	}
+	m.mtx.Unlock()
+	m.wg.Wait()
+}
+
+// rpcJobNotFoundError returns the error returned to RPC clients when the job
+// with the passed id is unknown, either because it never existed or because it
+// finished more than the time to live ago.
+func rpcJobNotFoundError(id string) *btcjson.RPCError {
+	return &btcjson.RPCError{
+		Code:    btcjson.ErrRPCInvalidParameter,
+		Message: "Job not found: " + id,
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+)
+
+// rpcJobsTestClock is a clock for the RPC job tests which only moves when it
+// is advanced.
+type rpcJobsTestClock struct {
+	mtx sync.Mutex
+	now time.Time
+}
+
+// Now returns the current time of the clock.
+func (c *rpcJobsTestClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by the passed duration.
+func (c *rpcJobsTestClock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	c.now = c.now.Add(d)
+	c.mtx.Unlock()
+}
+
+// TestRPCJobManager ensures jobs report their progress and partial results
+// while running, keep their result for the time to live after they complete,
+// fail and can be cancelled, and that the number of running jobs is limited.
+func TestRPCJobManager(t *testing.T) {
+	clock := &rpcJobsTestClock{now: time.Unix(1500000000, 0)}
+	m := newRPCJobManager(time.Minute)
+	m.now = clock.Now
+
+	// Start a job which reports it is halfway done and completes once
+	// released.
+	release := make(chan struct{})
+	reported := make(chan struct{})
+	job, err := m.start("verifychain", func(ctx context.Context, job *rpcJob) (interface{}, error) {
+		job.report(0.5, "partial")
+		close(reported)
+		<-release
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("unable to start job: %v", err)
+	}
+	<-reported
+
+	// The job took 10 seconds to do half of the work, so it should be
+	// estimated to need 10 more seconds.
+	clock.Advance(10 * time.Second)
+	status := job.status(clock.Now())
+	if status.ID != job.id || status.Method != "verifychain" ||
+		status.State != "running" || status.Progress != 0.5 ||
+		status.ETA != 10 || status.Result != "partial" ||
+		status.Finished != 0 || status.Error != "" {
+
+		t.Fatalf("unexpected running job status %+v", status)
+	}
+
+	close(release)
+	<-job.done
+	status = job.status(clock.Now())
+	if status.State != "completed" || status.Progress != 1 ||
+		status.ETA != 0 || status.Result != true ||
+		status.Finished != clock.Now().Unix() {
+
+		t.Fatalf("unexpected completed job status %+v", status)
+	}
+
+	// The completed job is kept until the time to live elapsed.
+	clock.Advance(time.Minute - time.Second)
+	if _, ok := m.lookup(job.id); !ok {
+		t.Fatal("completed job pruned before its time to live")
+	}
+	clock.Advance(time.Second)
+	if _, ok := m.lookup(job.id); ok {
+		t.Fatal("completed job kept after its time to live")
+	}
+	if n := m.numJobs(); n != 0 {
+		t.Fatalf("unexpected number of jobs %d", n)
+	}
+
+	// Jobs which return an error fail with the message of the error.
+	job, err = m.start("listunspentbyaddress", func(ctx context.Context, job *rpcJob) (interface{}, error) {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid address",
+		}
+	})
+	if err != nil {
+		t.Fatalf("unable to start job: %v", err)
+	}
+	<-job.done
+	status = job.status(clock.Now())
+	if status.State != "failed" || status.Error != "Invalid address" ||
+		status.Result != nil {
+
+		t.Fatalf("unexpected failed job status %+v", status)
+	}
+
+	// Start as many blocking jobs as may run at once, ensure no more may
+	// be started, and cancel one of them to make room for another.
+	blocking := func(ctx context.Context, job *rpcJob) (interface{}, error) {
+		<-ctx.Done()
+		return nil, errors.New("interrupted")
+	}
+	var jobs []*rpcJob
+	for i := 0; i < maxRunningRPCJobs; i++ {
+		job, err := m.start("verifychain", blocking)
+		if err != nil {
+			t.Fatalf("unable to start job %d: %v", i, err)
+		}
+		jobs = append(jobs, job)
+	}
+	if _, err := m.start("verifychain", blocking); err != ErrRPCTooManyRequests {
+		t.Fatalf("unexpected error starting too many jobs: %v", err)
+	}
+	cancelled, ok := m.cancel(jobs[0].id)
+	if !ok {
+		t.Fatal("unable to cancel running job")
+	}
+	status = cancelled.status(clock.Now())
+	if status.State != "cancelled" || status.Error != context.Canceled.Error() {
+		t.Fatalf("unexpected cancelled job status %+v", status)
+	}
+	if _, ok := m.cancel("0000000000000000"); ok {
+		t.Fatal("cancelled unknown job")
+	}
+	if _, err := m.start("verifychain", blocking); err != nil {
+		t.Fatalf("unable to start job after cancelling one: %v", err)
+	}
+
+	// Stopping the manager cancels the running jobs and prevents new ones.
+	m.stop()
+	for i, job := range jobs[1:] {
+		if state := job.status(clock.Now()).State; state != "cancelled" {
+			t.Fatalf("job %d in state %s after stop", i+1, state)
+		}
+	}
+	if _, err := m.start("verifychain", blocking); err == nil {
+		t.Fatal("started job after stop")
+	}
+}
+
+// TestHandleStartJob ensures the startjob command rejects commands which
+// can't be run as jobs and invalid parameters before starting a job, and that
+// the job commands reject unknown ids.
+func TestHandleStartJob(t *testing.T) {
+	s := &rpcServer{jobs: newRPCJobManager(time.Minute)}
+	defer s.jobs.stop()
+
+	tests := []struct {
+		name string
+		cmd  *btcjson.StartJobCmd
+		code btcjson.RPCErrorCode
+	}{
+		{
+			name: "not a job command",
+			cmd:  btcjson.NewStartJobCmd("getinfo", nil),
+			code: btcjson.ErrRPCInvalidParameter,
+		},
+		{
+			name: "unknown command",
+			cmd:  btcjson.NewStartJobCmd("scantxoutset", nil),
+			code: btcjson.ErrRPCInvalidParameter,
+		},
+		{
+			name: "invalid parameters",
+			cmd: btcjson.NewStartJobCmd("verifychain",
+				&[]interface{}{"deep"}),
+			code: btcjson.ErrRPCInvalidParams.Code,
+		},
+		{
+			name: "too many parameters",
+			cmd: btcjson.NewStartJobCmd("verifychain",
+				&[]interface{}{3, 288, true}),
+			code: btcjson.ErrRPCInvalidParams.Code,
+		},
+	}
+	for _, test := range tests {
+		_, err := handleStartJob(s, test.cmd, nil)
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != test.code {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+	if n := s.jobs.numJobs(); n != 0 {
+		t.Fatalf("unexpected number of jobs %d", n)
+	}
+
+	// The commands which look up jobs reject unknown ids.
+	const id = "0123456789abcdef"
+	_, err := handleGetJobStatus(s, btcjson.NewGetJobStatusCmd(id), nil)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCInvalidParameter {
+
+		t.Errorf("unexpected getjobstatus error: %v", err)
+	}
+	_, err = handleCancelJob(s, btcjson.NewCancelJobCmd(id), nil)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCInvalidParameter {
+
+		t.Errorf("unexpected canceljob error: %v", err)
+	}
+}
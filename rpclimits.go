@@ -0,0 +1,245 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+)
+
+// rpcRequestClass describes the class of an RPC request, which determines the
+// maximum size of its body.
+type rpcRequestClass int
+
+const (
+	// rpcClassQuery is the class of the requests which only carry small
+	// parameters such as hashes, addresses and counts.
+	rpcClassQuery rpcRequestClass = iota
+
+	// rpcClassSubmit is the class of the requests which carry serialized
+	// blocks or transactions.
+	rpcClassSubmit
+)
+
+// rpcSubmitMethods is the set of methods whose requests carry serialized blocks
+// or transactions and so are in the submit class.  The requests of all other
+// methods are in the query class.
+var rpcSubmitMethods = map[string]struct{}{
+	"decodeblock":          {},
+	"decoderawtransaction": {},
+	"getblocktemplate":     {},
+	"sendrawtransaction":   {},
+	"simulateadmintx":      {},
+	"submitblock":          {},
+}
+
+// rpcNoTimeoutMethods is the set of methods which are expected to run for a
+// long time, such as to long poll for a new block template or to verify the
+// chain, and so are not aborted by the request timeout.
+var rpcNoTimeoutMethods = map[string]struct{}{
+	"generate":         {},
+	"getblocktemplate": {},
+	"verifychain":      {},
+}
+
+// Errors returned when a request exceeds the limits of the RPC server.
+var (
+	// ErrRPCTooManyRequests is an error returned to RPC clients when
+	// servicing their request would exceed the maximum number of requests
+	// serviced at once, either in total or for the client.
+	ErrRPCTooManyRequests = &btcjson.RPCError{
+		Code:    btcjson.ErrRPCTooManyRequests,
+		Message: "Too many concurrent requests, try again later",
+	}
+
+	// ErrRPCRequestTimeout is an error returned to RPC clients when their
+	// request took longer than the request timeout to service.
+	ErrRPCRequestTimeout = &btcjson.RPCError{
+		Code:    btcjson.ErrRPCRequestTimeout,
+		Message: "Request timed out",
+	}
+)
+
+// rpcMethodClass returns the class of the requests of the passed method.
+func rpcMethodClass(method string) rpcRequestClass {
+	if _, ok := rpcSubmitMethods[method]; ok {
+		return rpcClassSubmit
+	}
+	return rpcClassQuery
+}
+
+// String returns the name of the request class.
+func (c rpcRequestClass) String() string {
+	if c == rpcClassSubmit {
+		return "submit"
+	}
+	return "query"
+}
+
+// maxBodySize returns the maximum size in bytes of the body of a request of the
+// class.
+func (c rpcRequestClass) maxBodySize() int64 {
+	if c == rpcClassSubmit {
+		return cfg.RPCMaxSubmitSize
+	}
+	return cfg.RPCMaxQuerySize
+}
+
+// maxRPCBodySize returns the maximum size in bytes of the body of a request of
+// any class.  Since the class of a request isn't known until its body is
+// parsed, this much of the body is read before the limit of its class can be
+// checked.
+func maxRPCBodySize() int64 {
+	maxSize := rpcClassQuery.maxBodySize()
+	if submitSize := rpcClassSubmit.maxBodySize(); submitSize > maxSize {
+		maxSize = submitSize
+	}
+	return maxSize
+}
+
+// rpcRequestTooLargeError returns an error suitable for replies to a request of
+// the passed class whose body has the passed size, which exceeds the limit of
+// the class.
+func rpcRequestTooLargeError(class rpcRequestClass, size int) *btcjson.RPCError {
+	return &btcjson.RPCError{
+		Code: btcjson.ErrRPCRequestTooLarge,
+		Message: fmt.Sprintf("Request of %d bytes exceeds the limit of "+
+			"%d bytes for %s requests", size, class.maxBodySize(),
+			class),
+	}
+}
+
+// rpcClientHost returns the host of the passed remote address of an RPC client,
+// which identifies the client for the per-client request limit.
+func rpcClientHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// rpcRequestLimiter limits the number of RPC requests serviced at once, both in
+// total and for each client, so a flood of expensive requests can't exhaust the
+// memory of the node.  A limit of zero means there is no limit.  A nil limiter
+// doesn't limit anything.
+type rpcRequestLimiter struct {
+	mtx               sync.Mutex
+	maxRequests       int
+	maxClientRequests int
+	requests          int
+	clientRequests    map[string]int
+}
+
+// acquire reserves a slot for servicing a request of the passed client and
+// returns whether there was one.  The slot must be released once the request
+// is serviced when it was reserved.
+//
+// This function is safe for concurrent access.
+func (l *rpcRequestLimiter) acquire(client string) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.maxRequests > 0 && l.requests >= l.maxRequests {
+		return false
+	}
+	if l.maxClientRequests > 0 &&
+		l.clientRequests[client] >= l.maxClientRequests {
+
+		return false
+	}
+	l.requests++
+	l.clientRequests[client]++
+	return true
+}
+
+// release frees a slot reserved for servicing a request of the passed client.
+//
+// This function is safe for concurrent access.
+func (l *rpcRequestLimiter) release(client string) {
+	if l == nil {
+		return
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.requests--
+	if l.clientRequests[client] <= 1 {
+		delete(l.clientRequests, client)
+	} else {
+		l.clientRequests[client]--
+	}
+}
+
+// newRPCRequestLimiter returns a limiter for the passed maximum numbers of
+// requests serviced at once in total and for each client.
+func newRPCRequestLimiter(maxRequests, maxClientRequests int) *rpcRequestLimiter {
+	return &rpcRequestLimiter{
+		maxRequests:       maxRequests,
+		maxClientRequests: maxClientRequests,
+		clientRequests:    make(map[string]int),
+	}
+}
+
+// timeoutCmdResult runs the appropriate handler to reply to a parsed standard
+// command like standardCmdResult, but returns an error once the command takes
+// longer than the request timeout of the server unless its method is expected
+// to run for a long time.  The handler is passed a close channel which is
+// closed when either the passed close channel is or the request times out, so
+// handlers which support it abort their work.  A handler which is still running
+// when the request times out is added to the passed wait group, so the caller
+// can wait for it to return before freeing the resources reserved for the
+// request.
+func (s *rpcServer) timeoutCmdResult(cmd *parsedRPCCmd, closeChan <-chan struct{}, wg *sync.WaitGroup) (interface{}, error) {
+	timeout := s.requestTimeout
+	if _, ok := rpcNoTimeoutMethods[cmd.method]; ok || timeout <= 0 {
+		return s.standardCmdResult(cmd, closeChan)
+	}
+
+	type cmdResult struct {
+		result interface{}
+		err    error
+	}
+	handlerCloseChan := make(chan struct{})
+	resultChan := make(chan cmdResult, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		result, err := s.standardCmdResult(cmd, handlerCloseChan)
+		resultChan <- cmdResult{result, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	closed := false
+	for {
+		select {
+		case r := <-resultChan:
+			return r.result, r.err
+
+		case <-closeChan:
+			// Keep waiting for the handler, which is expected to
+			// return promptly now that the client went away.
+			close(handlerCloseChan)
+			closeChan = nil
+			closed = true
+
+		case <-timer.C:
+			if !closed {
+				close(handlerCloseChan)
+			}
+			rpcsLog.Warnf("RPC call to %s timed out after %v",
+				cmd.method, timeout)
+			return nil, ErrRPCRequestTimeout
+		}
+	}
+}
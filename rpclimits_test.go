@@ -0,0 +1,383 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+)
+
+// rpcLimitsTestReply is a JSON-RPC reply received by the request limit tests.
+type rpcLimitsTestReply struct {
+	Result json.RawMessage   `json:"result"`
+	Error  *btcjson.RPCError `json:"error"`
+}
+
+// newRPCLimitsTestServer returns an RPC server with the passed request limiter
+// and timeout along with an HTTP server which serves its JSON-RPC requests.
+func newRPCLimitsTestServer(limiter *rpcRequestLimiter, timeout time.Duration) (*rpcServer, *httptest.Server) {
+	s := &rpcServer{
+		server:         &server{},
+		statusLines:    make(map[int]string),
+		requestLimiter: limiter,
+		requestTimeout: timeout,
+	}
+	httpServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			r.Close = true
+			s.jsonRPCRead(w, r, true)
+		}))
+	return s, httpServer
+}
+
+// postRPCLimitsTestRequest posts the passed JSON-RPC request body to the passed
+// server and returns the HTTP status code and the decoded reply.
+func postRPCLimitsTestRequest(url string, body []byte) (int, *rpcLimitsTestReply, error) {
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	var reply rpcLimitsTestReply
+	if err := json.Unmarshal(respBody, &reply); err != nil {
+		return 0, nil, fmt.Errorf("unable to decode reply %q: %v",
+			respBody, err)
+	}
+	return resp.StatusCode, &reply, nil
+}
+
+// TestRPCBodyLimit ensures requests whose body exceeds the maximum size of the
+// class of their method are rejected, that requests carrying serialized blocks
+// may be larger than other requests, and that bodies larger than the limit of
+// every class are rejected before being parsed.
+func TestRPCBodyLimit(t *testing.T) {
+	defer func(c *config) {
+		cfg = c
+	}(cfg)
+	cfg = &config{RPCMaxQuerySize: 1000, RPCMaxSubmitSize: 5000}
+
+	var calls int32
+	handler := func(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return "done", nil
+	}
+	for _, method := range []string{"getblockcount", "submitblock"} {
+		defer func(method string, handler commandHandler) {
+			rpcHandlers[method] = handler
+		}(method, rpcHandlers[method])
+		rpcHandlers[method] = handler
+	}
+
+	_, httpServer := newRPCLimitsTestServer(nil, 0)
+	defer httpServer.Close()
+
+	// request returns a request body of exactly the passed size for the
+	// passed method by padding a parameter with whitespace.
+	request := func(method, params string, size int) []byte {
+		body := fmt.Sprintf(`{"jsonrpc":"1.0","id":1,"method":"%s",`+
+			`"params":[%s]}`, method, params)
+		padding := size - len(body)
+		return []byte(strings.Replace(body, "[", "["+
+			strings.Repeat(" ", padding), 1))
+	}
+	tests := []struct {
+		name     string
+		body     []byte
+		wantCode int
+		wantErr  btcjson.RPCErrorCode
+	}{
+		{
+			name:     "query at limit",
+			body:     request("getblockcount", "", 1000),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "query over limit",
+			body:     request("getblockcount", "", 1001),
+			wantCode: http.StatusRequestEntityTooLarge,
+			wantErr:  btcjson.ErrRPCRequestTooLarge,
+		},
+		{
+			name:     "submit over query limit",
+			body:     request("submitblock", `"00"`, 3000),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "submit at limit",
+			body:     request("submitblock", `"00"`, 5000),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "submit over limit",
+			body:     request("submitblock", `"00"`, 5001),
+			wantCode: http.StatusRequestEntityTooLarge,
+			wantErr:  btcjson.ErrRPCRequestTooLarge,
+		},
+	}
+
+	for _, test := range tests {
+		before := atomic.LoadInt32(&calls)
+		code, reply, err := postRPCLimitsTestRequest(httpServer.URL,
+			test.body)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if code != test.wantCode {
+			t.Errorf("%s: got HTTP status %d, want %d", test.name, code,
+				test.wantCode)
+		}
+		called := atomic.LoadInt32(&calls) != before
+		if test.wantErr == 0 {
+			if reply.Error != nil || !called {
+				t.Errorf("%s: unexpected error %v, handler called "+
+					"%v", test.name, reply.Error, called)
+			}
+			continue
+		}
+		if reply.Error == nil || reply.Error.Code != test.wantErr {
+			t.Errorf("%s: got error %v, want code %d", test.name,
+				reply.Error, test.wantErr)
+		}
+		if called {
+			t.Errorf("%s: handler called for a rejected request",
+				test.name)
+		}
+	}
+
+	// A body over the limit of every class is rejected without being
+	// parsed.
+	body := request("submitblock", `"00"`, 20000)
+	code, reply, err := postRPCLimitsTestRequest(httpServer.URL, body)
+	if err != nil {
+		t.Fatalf("oversized body: %v", err)
+	}
+	if code != http.StatusRequestEntityTooLarge || reply.Error == nil ||
+		reply.Error.Code != btcjson.ErrRPCRequestTooLarge {
+
+		t.Fatalf("oversized body: got HTTP status %d and error %v",
+			code, reply.Error)
+	}
+}
+
+// TestRPCRequestTimeout ensures a request whose handler takes longer than the
+// request timeout is replied to with an error, that the handler is told to
+// abort through its close channel, that the resources of the request are only
+// freed once the handler returns, and that methods which are expected to run
+// for a long time are not timed out.
+func TestRPCRequestTimeout(t *testing.T) {
+	const timeout = time.Millisecond * 100
+
+	aborted := make(chan struct{})
+	unblock := make(chan struct{})
+	defer func(handler commandHandler) {
+		rpcHandlers["getblockcount"] = handler
+	}(rpcHandlers["getblockcount"])
+	rpcHandlers["getblockcount"] = func(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+		<-closeChan
+		close(aborted)
+		<-unblock
+		return nil, nil
+	}
+	defer func(handler commandHandler) {
+		rpcHandlers["generate"] = handler
+	}(rpcHandlers["generate"])
+	rpcHandlers["generate"] = func(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+		time.Sleep(timeout * 2)
+		return "done", nil
+	}
+
+	defer func(c *config) {
+		cfg = c
+	}(cfg)
+	cfg = &config{RPCMaxQuerySize: 1000, RPCMaxSubmitSize: 5000}
+	limiter := newRPCRequestLimiter(0, 1)
+	_, httpServer := newRPCLimitsTestServer(limiter, timeout)
+	defer httpServer.Close()
+
+	// The slow request times out and its handler is told to abort, but
+	// the slot of the client is kept until the handler returns.
+	start := time.Now()
+	code, reply, err := postRPCLimitsTestRequest(httpServer.URL,
+		[]byte(`{"jsonrpc":"1.0","id":1,"method":"getblockcount","params":[]}`))
+	if err != nil {
+		t.Fatalf("slow request: %v", err)
+	}
+	if code != http.StatusOK || reply.Error == nil ||
+		reply.Error.Code != btcjson.ErrRPCRequestTimeout {
+
+		t.Fatalf("slow request: got HTTP status %d and error %v", code,
+			reply.Error)
+	}
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Fatalf("slow request: timed out after %v, want at least %v",
+			elapsed, timeout)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("slow request: handler was not told to abort")
+	}
+	if limiter.acquire("127.0.0.1") {
+		t.Fatalf("slot of the timed out request freed before its " +
+			"handler returned")
+	}
+	close(unblock)
+	deadline := time.Now().Add(time.Second * 5)
+	for !limiter.acquire("127.0.0.1") {
+		if time.Now().After(deadline) {
+			t.Fatalf("slot of the timed out request not freed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	limiter.release("127.0.0.1")
+
+	// Methods which are expected to run for a long time are not timed
+	// out.
+	code, reply, err = postRPCLimitsTestRequest(httpServer.URL,
+		[]byte(`{"jsonrpc":"1.0","id":1,"method":"generate","params":[1]}`))
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if code != http.StatusOK || reply.Error != nil ||
+		string(reply.Result) != `"done"` {
+
+		t.Fatalf("generate: got HTTP status %d, result %s and error %v",
+			code, reply.Result, reply.Error)
+	}
+}
+
+// TestRPCConcurrencyLimit ensures the number of requests serviced at once is
+// limited both in total and for each client, that requests over the limit are
+// rejected with an error while the requests within it are serviced, and that
+// the limit of a client is shared by all of its connections.
+func TestRPCConcurrencyLimit(t *testing.T) {
+	// Exercise the limits of the limiter directly with several clients.
+	limiter := newRPCRequestLimiter(3, 2)
+	for _, client := range []string{"a", "a", "b"} {
+		if !limiter.acquire(client) {
+			t.Fatalf("acquire %s: unexpectedly over the limit", client)
+		}
+	}
+	if limiter.acquire("c") {
+		t.Fatalf("acquire c: total limit not enforced")
+	}
+	limiter.release("b")
+	if limiter.acquire("a") {
+		t.Fatalf("acquire a: client limit not enforced")
+	}
+	if !limiter.acquire("c") {
+		t.Fatalf("acquire c: slot not freed")
+	}
+	var unlimited *rpcRequestLimiter
+	if !unlimited.acquire("a") {
+		t.Fatalf("nil limiter limited a request")
+	}
+	unlimited.release("a")
+
+	// Issue many requests from the same client at once over HTTP while
+	// the handler blocks, so only the requests within the client limit
+	// are serviced.
+	const (
+		numRequests       = 20
+		maxClientRequests = 4
+	)
+	var entered int32
+	unblock := make(chan struct{})
+	defer func(handler commandHandler) {
+		rpcHandlers["getblockcount"] = handler
+	}(rpcHandlers["getblockcount"])
+	rpcHandlers["getblockcount"] = func(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+		atomic.AddInt32(&entered, 1)
+		<-unblock
+		return "done", nil
+	}
+
+	defer func(c *config) {
+		cfg = c
+	}(cfg)
+	cfg = &config{RPCMaxQuerySize: 1000, RPCMaxSubmitSize: 5000}
+	s, httpServer := newRPCLimitsTestServer(
+		newRPCRequestLimiter(0, maxClientRequests), 0)
+	defer httpServer.Close()
+
+	type result struct {
+		code  int
+		reply *rpcLimitsTestReply
+		err   error
+	}
+	results := make(chan result, numRequests)
+	var wg sync.WaitGroup
+	for i := 0; i < numRequests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, reply, err := postRPCLimitsTestRequest(httpServer.URL,
+				[]byte(`{"jsonrpc":"1.0","id":1,"method":"getblockcount","params":[]}`))
+			results <- result{code, reply, err}
+		}()
+	}
+
+	// All of the requests over the limit are rejected while the serviced
+	// requests are blocked.
+	for i := 0; i < numRequests-maxClientRequests; i++ {
+		var r result
+		select {
+		case r = <-results:
+		case <-time.After(time.Second * 10):
+			t.Fatalf("timed out waiting for rejected requests")
+		}
+		if r.err != nil {
+			t.Fatalf("request: %v", r.err)
+		}
+		if r.code != http.StatusTooManyRequests || r.reply.Error == nil ||
+			r.reply.Error.Code != btcjson.ErrRPCTooManyRequests {
+
+			t.Fatalf("got HTTP status %d and error %v, want a "+
+				"rejection", r.code, r.reply.Error)
+		}
+	}
+	if n := atomic.LoadInt32(&entered); n != maxClientRequests {
+		t.Fatalf("%d requests serviced at once, want %d", n,
+			maxClientRequests)
+	}
+
+	// Requests of the same client over other connections, such as
+	// websockets, share the same limit.
+	if s.requestLimiter.acquire(rpcClientHost("127.0.0.1:1234")) {
+		t.Fatalf("other connection of the client not limited")
+	}
+
+	close(unblock)
+	wg.Wait()
+	close(results)
+	for r := range results {
+		if r.err != nil {
+			t.Fatalf("request: %v", r.err)
+		}
+		if r.code != http.StatusOK || r.reply.Error != nil ||
+			string(r.reply.Result) != `"done"` {
+
+			t.Fatalf("got HTTP status %d, result %s and error %v, "+
+				"want a result", r.code, r.reply.Result,
+				r.reply.Error)
+		}
+	}
+}
@@ -8,15 +8,19 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"crypto/subtle"
 	"crypto/tls"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/bitgo/prova/addrmgr"
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/indexers"
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/btcjson"
 	"github.com/bitgo/prova/chaincfg"
@@ -35,6 +39,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -108,6 +113,14 @@ var (
 		Code:    btcjson.ErrRPCNoWallet,
 		Message: "This implementation does not implement wallet commands",
 	}
+
+	// ErrRPCReadOnly is an error returned to RPC clients when the provided
+	// command would modify the chain or connect to peers while the server
+	// is running in read-only mode.
+	ErrRPCReadOnly = &btcjson.RPCError{
+		Code:    btcjson.ErrRPCMisc,
+		Message: "Command disabled in read-only mode",
+	}
 )
 
 type commandHandler func(*rpcServer, interface{}, <-chan struct{}) (interface{}, error)
@@ -117,47 +130,99 @@ type commandHandler func(*rpcServer, interface{}, <-chan struct{}) (interface{},
 // a dependency loop.
 var rpcHandlers map[string]commandHandler
 var rpcHandlersBeforeInit = map[string]commandHandler{
-	"addnode":               handleAddNode,
-	"createrawtransaction":  handleCreateRawTransaction,
-	"debuglevel":            handleDebugLevel,
-	"decoderawtransaction":  handleDecodeRawTransaction,
-	"generate":              handleGenerate,
-	"getaddednodeinfo":      handleGetAddedNodeInfo,
-	"getaddresstxids":       handleGetAddressTxIds,
-	"getadmininfo":          handleGetAdminInfo,
-	"getbestblock":          handleGetBestBlock,
-	"getbestblockhash":      handleGetBestBlockHash,
-	"getblock":              handleGetBlock,
-	"getblockcount":         handleGetBlockCount,
-	"getblockhash":          handleGetBlockHash,
-	"getblockheader":        handleGetBlockHeader,
-	"getblocktemplate":      handleGetBlockTemplate,
-	"getconnectioncount":    handleGetConnectionCount,
-	"getcurrentnet":         handleGetCurrentNet,
-	"getdifficulty":         handleGetDifficulty,
-	"getgenerate":           handleGetGenerate,
-	"gethashespersec":       handleGetHashesPerSec,
-	"getheaders":            handleGetHeaders,
-	"getinfo":               handleGetInfo,
-	"getmempoolinfo":        handleGetMempoolInfo,
-	"getmininginfo":         handleGetMiningInfo,
-	"getnettotals":          handleGetNetTotals,
-	"getnetworkhashps":      handleGetNetworkHashPS,
-	"getpeerinfo":           handleGetPeerInfo,
-	"getrawmempool":         handleGetRawMempool,
-	"getrawtransaction":     handleGetRawTransaction,
-	"gettxout":              handleGetTxOut,
-	"help":                  handleHelp,
-	"node":                  handleNode,
-	"ping":                  handlePing,
-	"searchrawtransactions": handleSearchRawTransactions,
-	"sendrawtransaction":    handleSendRawTransaction,
-	"setgenerate":           handleSetGenerate,
-	"setvalidatekeys":       handleSetValidateKeys,
-	"stop":                  handleStop,
-	"submitblock":           handleSubmitBlock,
-	"validateaddress":       handleValidateAddress,
-	"verifychain":           handleVerifyChain,
+	"addnode":                handleAddNode,
+	"addwatch":               handleAddWatch,
+	"backupchainstate":       handleBackupChainState,
+	"canceljob":              handleCancelJob,
+	"createrawtransaction":   handleCreateRawTransaction,
+	"debuglevel":             handleDebugLevel,
+	"decodeblock":            handleDecodeBlock,
+	"decoderawtransaction":   handleDecodeRawTransaction,
+	"exportbanlist":          handleExportBanList,
+	"exportchaindata":        handleExportChainData,
+	"generate":               handleGenerate,
+	"getaddednodeinfo":       handleGetAddedNodeInfo,
+	"getaddresstxids":        handleGetAddressTxIds,
+	"getadmininfo":           handleGetAdminInfo,
+	"getbestblock":           handleGetBestBlock,
+	"getbestblockhash":       handleGetBestBlockHash,
+	"getblock":               handleGetBlock,
+	"getaddrmaninfo":         handleGetAddrManInfo,
+	"getadminproof":          handleGetAdminProof,
+	"getblockadminops":       handleGetBlockAdminOps,
+	"getblockcommitment":     handleGetBlockCommitment,
+	"getblockcount":          handleGetBlockCount,
+	"getblockhash":           handleGetBlockHash,
+	"getblockheader":         handleGetBlockHeader,
+	"getblockproductioninfo": handleGetBlockProductionInfo,
+	"getblockraw":            handleGetBlockRaw,
+	"getblocktemplate":       handleGetBlockTemplate,
+	"getbroadcaststatus":     handleGetBroadcastStatus,
+	"getconnectioncount":     handleGetConnectionCount,
+	"getcurrentnet":          handleGetCurrentNet,
+	"getdifficulty":          handleGetDifficulty,
+	"getdoublesigns":         handleGetDoubleSigns,
+	"getgenerate":            handleGetGenerate,
+	"gethashespersec":        handleGetHashesPerSec,
+	"getheaders":             handleGetHeaders,
+	"getinfo":                handleGetInfo,
+	"getjobstatus":           handleGetJobStatus,
+	"getmempoolentry":        handleGetMempoolEntry,
+	"getmempoolinfo":         handleGetMempoolInfo,
+	"getmempoolsnapshot":     handleGetMempoolSnapshot,
+	"getnextkeyid":           handleGetNextKeyID,
+	"getmininginfo":          handleGetMiningInfo,
+	"getnettotals":           handleGetNetTotals,
+	"getnetworkinfo":         handleGetNetworkInfo,
+	"getnetworkhashps":       handleGetNetworkHashPS,
+	"getpeerinfo":            handleGetPeerInfo,
+	"getchainparams":         handleGetChainParams,
+	"getchainsplitinfo":      handleGetChainSplitInfo,
+	"geterrorstats":          handleGetErrorStats,
+	"getpeerstats":           handleGetPeerStats,
+	"getpolicyinfo":          handleGetPolicyInfo,
+	"getprocessingjournal":   handleGetProcessingJournal,
+	"getrawmempool":          handleGetRawMempool,
+	"getrawtransaction":      handleGetRawTransaction,
+	"getrejectsummary":       handleGetRejectSummary,
+	"getrpcinfo":             handleGetRPCInfo,
+	"getscrubstatus":         handleGetScrubStatus,
+	"getstatshistory":        handleGetStatsHistory,
+	"getthreadinfo":          handleGetThreadInfo,
+	"gettxout":               handleGetTxOut,
+	"help":                   handleHelp,
+	"importbanlist":          handleImportBanList,
+	"issuewstoken":           handleIssueWSToken,
+	"listunspentbyaddress":   handleListUnspentByAddress,
+	"listwatch":              handleListWatch,
+	"listwstokens":           handleListWSTokens,
+	"node":                   handleNode,
+	"ping":                   handlePing,
+	"prioritisetransaction":  handlePrioritiseTransaction,
+	"removewatch":            handleRemoveWatch,
+	"reseterrorstats":        handleResetErrorStats,
+	"revokewstoken":          handleRevokeWSToken,
+	"searchrawtransactions":  handleSearchRawTransactions,
+	"sendrawtransaction":     handleSendRawTransaction,
+	"setban":                 handleSetBan,
+	"setgenerate":            handleSetGenerate,
+	"setpeertrace":           handleSetPeerTrace,
+	"setvalidatekeys":        handleSetValidateKeys,
+	"simulateadmintx":        handleSimulateAdminTx,
+	"startjob":               handleStartJob,
+	"stop":                   handleStop,
+	"submitblock":            handleSubmitBlock,
+	"validateaddress":        handleValidateAddress,
+	"verifychain":            handleVerifyChain,
+}
+
+// rpcJobHandlers maps the commands which may be run in the background by the
+// startjob command to the functions which validate their parameters and return
+// the function running them.
+var rpcJobHandlers = map[string]func(*rpcServer, interface{}) (rpcJobFunc, error){
+	"exportchaindata":      newExportChainDataJob,
+	"listunspentbyaddress": newListUnspentByAddressJob,
+	"verifychain":          newVerifyChainJob,
 }
 
 // list of commands that we recognize, but for which there is no support because
@@ -213,14 +278,33 @@ var rpcUnimplemented = map[string]struct{}{
 	"estimatepriority":  {},
 	"getblockchaininfo": {},
 	"getchaintips":      {},
-	"getmempoolentry":   {},
-	"getnetworkinfo":    {},
 	"getwork":           {},
 	"invalidateblock":   {},
 	"preciousblock":     {},
 	"reconsiderblock":   {},
 }
 
+// Commands that are disabled when the server is running in read-only mode
+// since they would modify the chain, the memory pool, or the set of peers.
+var rpcReadOnlyDisabled = map[string]struct{}{
+	"addnode":               {},
+	"addwatch":              {},
+	"generate":              {},
+	"getblocktemplate":      {},
+	"importbanlist":         {},
+	"issuewstoken":          {},
+	"node":                  {},
+	"prioritisetransaction": {},
+	"removewatch":           {},
+	"reseterrorstats":       {},
+	"sendrawtransaction":    {},
+	"revokewstoken":         {},
+	"setban":                {},
+	"setgenerate":           {},
+	"setvalidatekeys":       {},
+	"submitblock":           {},
+}
+
 // Commands that are available to a limited user
 var rpcLimited = map[string]struct{}{
 	// Websockets commands
@@ -237,30 +321,43 @@ var rpcLimited = map[string]struct{}{
 	"help": {},
 
 	// HTTP/S-only commands
-	"createrawtransaction":  {},
-	"decoderawtransaction":  {},
-	"decodescript":          {},
-	"getaddresstxids":       {},
-	"getadmininfo":          {},
-	"getbestblock":          {},
-	"getbestblockhash":      {},
-	"getblock":              {},
-	"getblockcount":         {},
-	"getblockhash":          {},
-	"getcurrentnet":         {},
-	"getdifficulty":         {},
-	"getheaders":            {},
-	"getinfo":               {},
-	"getnettotals":          {},
-	"getnetworkhashps":      {},
-	"getrawmempool":         {},
-	"getrawtransaction":     {},
-	"gettxout":              {},
-	"searchrawtransactions": {},
-	"sendrawtransaction":    {},
-	"submitblock":           {},
-	"validateaddress":       {},
-	"verifymessage":         {},
+	"createrawtransaction":   {},
+	"decodeblock":            {},
+	"decoderawtransaction":   {},
+	"decodescript":           {},
+	"getaddresstxids":        {},
+	"getadmininfo":           {},
+	"getbestblock":           {},
+	"getbestblockhash":       {},
+	"getblock":               {},
+	"getadminproof":          {},
+	"getblockadminops":       {},
+	"getblockcommitment":     {},
+	"getblockcount":          {},
+	"getblockhash":           {},
+	"getblockproductioninfo": {},
+	"getchainparams":         {},
+	"getcurrentnet":          {},
+	"getdifficulty":          {},
+	"getdoublesigns":         {},
+	"geterrorstats":          {},
+	"getheaders":             {},
+	"getinfo":                {},
+	"getnettotals":           {},
+	"getnetworkinfo":         {},
+	"getnetworkhashps":       {},
+	"getmempoolentry":        {},
+	"getmempoolsnapshot":     {},
+	"getpolicyinfo":          {},
+	"getrawmempool":          {},
+	"getrawtransaction":      {},
+	"gettxout":               {},
+	"searchrawtransactions":  {},
+	"sendrawtransaction":     {},
+	"simulateadmintx":        {},
+	"submitblock":            {},
+	"validateaddress":        {},
+	"verifymessage":          {},
 }
 
 // builderScript is a convenience function which is used for hard-coded scripts
@@ -306,6 +403,33 @@ func rpcNoTxInfoError(txHash *chainhash.Hash) *btcjson.RPCError {
 			txHash))
 }
 
+// rpcAddressError returns a nicely formatted RPC error for the passed error
+// returned when decoding an address.  Addresses which are valid for other
+// networks are reported with a distinct error code which names the networks.
+func rpcAddressError(err error) *btcjson.RPCError {
+	if e, ok := err.(*provautil.WrongNetworkError); ok {
+		return btcjson.NewRPCError(btcjson.ErrRPCWrongNetworkAddress,
+			fmt.Sprintf("Invalid address %v: address is valid for "+
+				"%s, this node is %s", e.Address, e.NetNames(),
+				e.Expected.Name))
+	}
+	return btcjson.NewRPCError(btcjson.ErrRPCInvalidAddressOrKey,
+		"Invalid address or key: "+err.Error())
+}
+
+// indexSyncingError returns a nicely formatted RPC error which indicates the
+// passed optional index is still catching up to the main chain, or nil when the
+// index is synced and may be queried.
+func (s *rpcServer) indexSyncingError(indexer indexers.Indexer) error {
+	indexManager := s.server.indexManager
+	if indexManager == nil || indexManager.IsSynced(indexer) {
+		return nil
+	}
+	return btcjson.NewRPCError(btcjson.ErrRPCMisc, fmt.Sprintf("The %s "+
+		"is syncing to the main chain -- try again once it has caught up",
+		indexer.Name()))
+}
+
 // gbtWorkState houses state that is used in between multiple RPC invocations to
 // getblocktemplate.
 type gbtWorkState struct {
@@ -372,6 +496,78 @@ func handleAddNode(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 	return nil, nil
 }
 
+// watchlistKeyIDs converts the passed optional key IDs of a watchlist command.
+func watchlistKeyIDs(ids *[]uint32) []btcec.KeyID {
+	if ids == nil {
+		return nil
+	}
+	keyIDs := make([]btcec.KeyID, 0, len(*ids))
+	for _, id := range *ids {
+		keyIDs = append(keyIDs, btcec.KeyID(id))
+	}
+	return keyIDs
+}
+
+// watchlistRPCError returns the RPC error for the passed error returned by the
+// watchlist.
+func watchlistRPCError(err error) *btcjson.RPCError {
+	if _, ok := err.(*provautil.WrongNetworkError); ok {
+		return rpcAddressError(err)
+	}
+	if _, ok := err.(errWatchlistAddress); ok {
+		return &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: err.Error(),
+		}
+	}
+	return &btcjson.RPCError{
+		Code:    btcjson.ErrRPCDatabase,
+		Message: "Failed to update watchlist: " + err.Error(),
+	}
+}
+
+// handleAddWatch handles addwatch commands.
+func handleAddWatch(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.AddWatchCmd)
+
+	err := s.server.watchlist.Add(c.Addresses, watchlistKeyIDs(c.KeyIDs))
+	if err != nil {
+		return nil, watchlistRPCError(err)
+	}
+	return nil, nil
+}
+
+// handleBackupChainState handles backupchainstate commands.
+func handleBackupChainState(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.BackupChainStateCmd)
+
+	result, err := backupChainState(s.server.blockManager, c.Destination)
+	if err != nil {
+		if _, ok := err.(errBackupDestination); ok {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: err.Error(),
+			}
+		}
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDatabase,
+			Message: "Failed to back up chain state: " + err.Error(),
+		}
+	}
+	return result, nil
+}
+
+// handleCancelJob implements the canceljob command.
+func handleCancelJob(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.CancelJobCmd)
+
+	job, ok := s.jobs.cancel(c.ID)
+	if !ok {
+		return nil, rpcJobNotFoundError(c.ID)
+	}
+	return job.status(s.jobs.now()), nil
+}
+
 // handleNode handles node commands.
 func handleNode(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.NodeCmd)
@@ -462,6 +658,131 @@ func handleNode(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return nil, nil
 }
 
+// handleSetPeerTrace implements the setpeertrace command.
+func handleSetPeerTrace(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SetPeerTraceCmd)
+	capture, err := s.server.SetPeerTrace(c.ID, c.Enable)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+
+	result := &btcjson.SetPeerTraceResult{
+		ID:      c.ID,
+		Enabled: c.Enable,
+	}
+	if capture != nil {
+		result.Prefix = capture.Prefix()
+		result.Dropped = capture.Dropped()
+	}
+	return result, nil
+}
+
+// banListRPCError returns the JSON-RPC error describing the passed error which
+// occurred while updating the ban list.
+func banListRPCError(err error) *btcjson.RPCError {
+	if _, ok := err.(errBanSubnet); ok {
+		return &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	return &btcjson.RPCError{
+		Code:    btcjson.ErrRPCDatabase,
+		Message: "Failed to update the ban list: " + err.Error(),
+	}
+}
+
+// handleSetBan implements the setban command.
+func handleSetBan(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SetBanCmd)
+
+	subnet, err := parseBanSubnet(c.Subnet)
+	if err != nil {
+		return nil, banListRPCError(err)
+	}
+
+	switch c.SubCmd {
+	case btcjson.SBAdd:
+		var banTime int64
+		if c.BanTime != nil {
+			banTime = *c.BanTime
+		}
+		if banTime < 0 {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "The ban time must not be negative",
+			}
+		}
+		expires := time.Now().Add(cfg.BanDuration)
+		switch {
+		case c.Absolute != nil && *c.Absolute:
+			expires = time.Unix(banTime, 0)
+		case banTime != 0:
+			expires = time.Now().Add(time.Duration(banTime) *
+				time.Second)
+		}
+		var reason string
+		if c.Reason != nil {
+			reason = *c.Reason
+		}
+		err := s.server.banList.Ban(subnet, reason, expires)
+		if err != nil {
+			return nil, banListRPCError(err)
+		}
+		rpcsLog.Infof("Banned %s until %v", subnet, expires)
+		s.server.DisconnectBanned()
+
+	case btcjson.SBRemove:
+		unbanned, err := s.server.banList.Unban(subnet)
+		if err != nil {
+			return nil, banListRPCError(err)
+		}
+		if !unbanned {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Subnet %s is not banned", subnet),
+			}
+		}
+		rpcsLog.Infof("Lifted the ban of %s", subnet)
+
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "invalid subcommand for setban",
+		}
+	}
+
+	// no data returned unless an error.
+	return nil, nil
+}
+
+// handleExportBanList implements the exportbanlist command.
+func handleExportBanList(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	bans := s.server.banList.Bans()
+	result := make([]btcjson.BanListEntry, 0, len(bans))
+	for _, b := range bans {
+		result = append(result, *b.result())
+	}
+	return result, nil
+}
+
+// handleImportBanList implements the importbanlist command.
+func handleImportBanList(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.ImportBanListCmd)
+
+	imported, err := s.server.banList.Import(c.Entries)
+	if err != nil {
+		return nil, banListRPCError(err)
+	}
+	rpcsLog.Infof("Imported %d %s", imported, pickNoun(uint64(imported), "ban",
+		"bans"))
+	s.server.DisconnectBanned()
+	return imported, nil
+}
+
 // peerExists determines if a certain peer is currently connected given
 // information about all currently connected peers. Peer existence is
 // determined using either a target address or node id.
@@ -528,18 +849,13 @@ func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 		}
 
 		// Decode the provided address.
-		addr, err := provautil.DecodeAddress(encodedAddr,
-			activeNetParams.Params)
+		addr, err := provautil.DecodeAddressForNet(encodedAddr,
+			s.server.chainParams)
 		if err != nil {
-			return nil, &btcjson.RPCError{
-				Code:    btcjson.ErrRPCInvalidAddressOrKey,
-				Message: "Invalid address or key: " + err.Error(),
-			}
+			return nil, rpcAddressError(err)
 		}
 
-		// Ensure the address is one of the supported types and that
-		// the network encoded with the address matches the network the
-		// server is currently on.
+		// Ensure the address is one of the supported types.
 		switch addr.(type) {
 		default:
 			return nil, &btcjson.RPCError{
@@ -547,13 +863,6 @@ func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 				Message: "Invalid address or key",
 			}
 		}
-		if !addr.IsForNet(s.server.chainParams) {
-			return nil, &btcjson.RPCError{
-				Code: btcjson.ErrRPCInvalidAddressOrKey,
-				Message: "Invalid address: " + encodedAddr +
-					" is for the wrong network",
-			}
-		}
 
 		// Create a new script which pays to the provided address.
 		pkScript, err := txscript.PayToAddrScript(addr)
@@ -735,6 +1044,97 @@ func createTxRawResult(chainParams *chaincfg.Params, mtx *wire.MsgTx,
 	return txReply, nil
 }
 
+// handleDecodeBlock handles decodeblock commands.
+func handleDecodeBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.DecodeBlockCmd)
+
+	// Deserialize the block.
+	hexStr := c.HexBlock
+	if len(hexStr)%2 != 0 {
+		hexStr = "0" + hexStr
+	}
+	serializedBlock, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(hexStr)
+	}
+	var msgBlock wire.MsgBlock
+	r := bytes.NewReader(serializedBlock)
+	err = msgBlock.BtcDecode(r, s.server.chainParams.TxEncoding())
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "Block decode failed: " + err.Error(),
+		}
+	}
+	blk := provautil.NewBlock(&msgBlock)
+
+	// Decode the block in the same format as a verbose getblock with
+	// verbose transactions.  The block is not looked up in the chain, so
+	// there are no confirmations or next block.
+	blockHeader := &msgBlock.Header
+	blockReply := btcjson.GetBlockVerboseResult{
+		Hash:             blk.Hash().String(),
+		Version:          blockHeader.Version,
+		MerkleRoot:       blockHeader.MerkleRoot.String(),
+		PreviousHash:     blockHeader.PrevBlock.String(),
+		Nonce:            blockHeader.Nonce,
+		Time:             blockHeader.Timestamp.Unix(),
+		Height:           int64(blockHeader.Height),
+		Size:             int32(blockHeader.Size),
+		Bits:             strconv.FormatInt(int64(blockHeader.Bits), 16),
+		Difficulty:       getDifficultyRatio(blockHeader.Bits),
+		ValidatingPubKey: blockHeader.ValidatingPubKey.String(),
+		Signature:        blockHeader.Signature.String(),
+	}
+	txns := blk.Transactions()
+	rawTxns := make([]btcjson.TxRawResult, len(txns))
+	for i, tx := range txns {
+		rawTxn, err := createTxRawResult(s.server.chainParams,
+			tx.MsgTx(), tx.Hash().String(), nil, "", 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		rawTxn.Time = blockHeader.Timestamp.Unix()
+		rawTxn.Blocktime = blockHeader.Timestamp.Unix()
+		rawTxn.BlockHash = blockReply.Hash
+		rawTxns[i] = *rawTxn
+	}
+	blockReply.RawTx = rawTxns
+
+	// Run the context-free sanity checks for the current network.
+	reply := &btcjson.DecodeBlockResult{Block: blockReply}
+	err = blockchain.CheckBlockSanity(blk, s.server.chainParams,
+		s.server.timeSource)
+	if err != nil {
+		reply.SanityError = err.Error()
+	} else {
+		reply.Sane = true
+	}
+
+	// When requested, ensure the block is canonically encoded by confirming
+	// it was consumed completely and that serializing it again produces
+	// the exact same bytes.
+	if c.Strict != nil && *c.Strict {
+		canonical := false
+		var buf bytes.Buffer
+		switch {
+		case r.Len() != 0:
+			reply.CanonicalError = fmt.Sprintf("%d trailing bytes "+
+				"after block", r.Len())
+		case msgBlock.Serialize(&buf) != nil:
+			reply.CanonicalError = "block does not re-serialize"
+		case !bytes.Equal(buf.Bytes(), serializedBlock):
+			reply.CanonicalError = "re-serialized block differs " +
+				"from the provided encoding"
+		default:
+			canonical = true
+		}
+		reply.Canonical = &canonical
+	}
+
+	return reply, nil
+}
+
 // handleDecodeRawTransaction handles decoderawtransaction commands.
 func handleDecodeRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.DecodeRawTransactionCmd)
@@ -749,7 +1149,8 @@ func handleDecodeRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 		return nil, rpcDecodeHexError(hexStr)
 	}
 	var mtx wire.MsgTx
-	err = mtx.Deserialize(bytes.NewReader(serializedTx))
+	err = mtx.BtcDecode(bytes.NewReader(serializedTx),
+		s.server.chainParams.TxEncoding())
 	if err != nil {
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCDeserialization,
@@ -803,19 +1204,23 @@ func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		}
 	}
 
-	// Attempt to establish validate keys from the environment var if there
-	// are none already registered.
-	if len(s.server.cpuMiner.ValidateKeys()) == 0 {
-		s.server.cpuMiner.EstablishValidateKeys()
-	}
+	// Blocks are mined without being signed when the network accepts them
+	// on proof of work alone, so validate keys are only needed otherwise.
+	if !params.PowOnly {
+		// Attempt to establish validate keys from the environment var
+		// if there are none already registered.
+		if len(s.server.cpuMiner.BlockSigners()) == 0 {
+			s.server.cpuMiner.EstablishValidateKeys()
+		}
 
-	// Check that there are validate keys set
-	if len(s.server.cpuMiner.ValidateKeys()) == 0 {
-		return nil, &btcjson.RPCError{
-			Code: btcjson.ErrRPCInternal.Code,
-			Message: "No validate keys provided via " +
-				"--setvalidatekeys or PROVA_VALIDATE_KEYS " +
-				"environment variable",
+		// Check that there are validate keys set
+		if len(s.server.cpuMiner.BlockSigners()) == 0 {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInternal.Code,
+				Message: "No validate keys provided via " +
+					"setvalidatekeys, PROVA_VALIDATE_KEYS " +
+					"environment variable, or --blocksignerurl",
+			}
 		}
 	}
 
@@ -839,6 +1244,57 @@ func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return reply, nil
 }
 
+// handleExportChainData implements the exportchaindata command.
+func handleExportChainData(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	run, err := newExportChainDataJob(s, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := closeChanContext(closeChan)
+	defer cancel()
+	return run(ctx, nil)
+}
+
+// newExportChainDataJob returns the function which runs the passed
+// exportchaindata command, either synchronously or as a job, once the
+// destination and start height are validated.  Jobs report the range of the
+// blocks exported so far as their partial result.
+func newExportChainDataJob(s *rpcServer, cmd interface{}) (rpcJobFunc, error) {
+	c := cmd.(*btcjson.ExportChainDataCmd)
+
+	startHeight := *c.StartHeight
+	if best := s.chain.BestSnapshot(); startHeight > best.Height {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCOutOfRange,
+			Message: "Block height out of range",
+		}
+	}
+	dest, err := chainExportPath(c.Destination, startHeight)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+
+	return func(ctx context.Context, job *rpcJob) (interface{}, error) {
+		result, err := exportChainData(ctx, s.chain, dest, startHeight,
+			job)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCDatabase,
+				Message: "Failed to export chain data: " +
+					err.Error(),
+			}
+		}
+		return result, nil
+	}, nil
+}
+
 // handleGetAddedNodeInfo handles getaddednodeinfo commands.
 func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetAddedNodeInfoCmd)
@@ -938,6 +1394,9 @@ func handleGetAddressTxIds(s *rpcServer, cmd interface{}, closeChan <-chan struc
 			Message: "Address index must be enabled (--addrindex)",
 		}
 	}
+	if err := s.indexSyncingError(addrIndex); err != nil {
+		return nil, err
+	}
 
 	c := cmd.(*btcjson.GetAddressTxIdsCmd)
 
@@ -961,12 +1420,10 @@ func handleGetAddressTxIds(s *rpcServer, cmd interface{}, closeChan <-chan struc
 	// Attempt to decode the supplied addresses.
 	addressTxns := make([]retrievedTx, 0)
 	for _, address := range c.Request.Addresses {
-		addr, err := provautil.DecodeAddress(address, s.server.chainParams)
+		addr, err := provautil.DecodeAddressForNet(address,
+			s.server.chainParams)
 		if err != nil {
-			return nil, &btcjson.RPCError{
-				Code:    btcjson.ErrRPCInvalidAddressOrKey,
-				Message: "Invalid address or key: " + err.Error(),
-			}
+			return nil, rpcAddressError(err)
 		}
 
 		err = s.server.db.View(func(dbTx database.Tx) error {
@@ -1013,7 +1470,8 @@ func handleGetAddressTxIds(s *rpcServer, cmd interface{}, closeChan <-chan struc
 		if rtx.tx == nil {
 			// Deserialize the transaction.
 			mtx = new(wire.MsgTx)
-			err := mtx.Deserialize(bytes.NewReader(rtx.txBytes))
+			err := mtx.BtcDecode(bytes.NewReader(rtx.txBytes),
+				s.server.chainParams.TxEncoding())
 			if err != nil {
 				context := "Failed to deserialize transaction"
 				return nil, internalRPCError(err.Error(),
@@ -1033,50 +1491,61 @@ func handleGetAdminInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	best := s.chain.BestSnapshot()
 	adminKeySets := s.chain.AdminKeySets()
 	aspKeyIdMap := s.chain.KeyIDs()
-	rootTip := s.chain.ThreadTips()[provautil.RootThread]
-	provisionTip := s.chain.ThreadTips()[provautil.ProvisionThread]
-	issueTip := s.chain.ThreadTips()[provautil.IssueThread]
-	threadTipObj := []btcjson.ThreadTipResult{
-		{
-			ID:       uint32(provautil.RootThread),
-			Name:     "root",
-			OutPoint: rootTip.String(),
-		},
-		{
-			ID:       uint32(provautil.ProvisionThread),
-			Name:     "provision",
-			OutPoint: provisionTip.String(),
-		},
-		{
-			ID:       uint32(provautil.IssueThread),
-			Name:     "issue",
-			OutPoint: issueTip.String(),
-		},
-	}
-	aspObj := make([]btcjson.ASPKeyIdResult, len(aspKeyIdMap))
-	i := 0
-	for k, v := range aspKeyIdMap {
-		aspObj[i] = btcjson.ASPKeyIdResult{
-			KeyID:  uint32(k),
-			PubKey: hex.EncodeToString(v.SerializeCompressed()),
-		}
-		i++
-	}
 	result := &btcjson.GetAdminInfoResult{
 		Hash:          best.Hash.String(),
 		Height:        best.Height,
-		ThreadTips:    threadTipObj,
+		ThreadTips:    threadTipResults(s.chain.ThreadTips()),
 		TotalSupply:   s.chain.TotalSupply(),
 		LastKeyID:     uint32(s.chain.LastKeyID()),
 		RootKeys:      adminKeySets[btcec.RootKeySet].ToStringArray(),
 		ProvisionKeys: adminKeySets[btcec.ProvisionKeySet].ToStringArray(),
 		IssueKeys:     adminKeySets[btcec.IssueKeySet].ToStringArray(),
 		ValidateKeys:  adminKeySets[btcec.ValidateKeySet].ToStringArray(),
-		ASPKeys:       aspObj,
+		ASPKeys:       aspKeyIdResults(aspKeyIdMap),
 	}
 	return result, nil
 }
 
+// adminThreadNames maps the admin threads to the names they are reported with
+// in the results of the admin state commands.
+var adminThreadNames = map[provautil.ThreadID]string{
+	provautil.RootThread:      "root",
+	provautil.ProvisionThread: "provision",
+	provautil.IssueThread:     "issue",
+}
+
+// threadTipResults returns the passed admin thread tips in the format used by
+// the results of the admin state commands.
+func threadTipResults(threadTips map[provautil.ThreadID]*wire.OutPoint) []btcjson.ThreadTipResult {
+	results := make([]btcjson.ThreadTipResult, 0, len(adminThreadNames))
+	for id := provautil.RootThread; id <= provautil.IssueThread; id++ {
+		results = append(results, btcjson.ThreadTipResult{
+			ID:       uint32(id),
+			Name:     adminThreadNames[id],
+			OutPoint: threadTips[id].String(),
+		})
+	}
+	return results
+}
+
+// aspKeyIdResults returns the passed ASP keyIDs ordered by keyID in the format
+// used by the results of the admin state commands.
+func aspKeyIdResults(aspKeyIdMap btcec.KeyIdMap) []btcjson.ASPKeyIdResult {
+	keyIDs := make([]btcec.KeyID, 0, len(aspKeyIdMap))
+	for keyID := range aspKeyIdMap {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Sort(keyIDSorter(keyIDs))
+	results := make([]btcjson.ASPKeyIdResult, len(keyIDs))
+	for i, keyID := range keyIDs {
+		results[i] = btcjson.ASPKeyIdResult{
+			KeyID:  uint32(keyID),
+			PubKey: hex.EncodeToString(aspKeyIdMap[keyID].SerializeCompressed()),
+		}
+	}
+	return results
+}
+
 // handleGetBestBlock implements the getbestblock command.
 func handleGetBestBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// All other "get block" commands give either the height, the
@@ -1132,6 +1601,21 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		return err
 	})
 	if err != nil {
+		if s.server.blockScrubber.ReportCorrupt(hash, err) {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCDatabase,
+				Message: "Stored block data is corrupt and has " +
+					"been scheduled for re-download",
+			}
+		}
+		if dbErr, ok := err.(database.Error); ok &&
+			dbErr.ErrorCode == database.ErrBlockPruned {
+
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCMisc,
+				Message: "Block not available (pruned data)",
+			}
+		}
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCBlockNotFound,
 			Message: "Block not found",
@@ -1147,7 +1631,8 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	// The verbose flag is set, so generate the JSON object and return it.
 
 	// Deserialize the block.
-	blk, err := provautil.NewBlockFromBytes(blkBytes)
+	blk, err := provautil.NewBlockFromBytesEncoding(blkBytes,
+		s.server.chainParams.TxEncoding())
 	if err != nil {
 		context := "Failed to deserialize block"
 		return nil, internalRPCError(err.Error(), context)
@@ -1199,6 +1684,11 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 
 		blockReply.Tx = txNames
 	} else {
+		fees, err := s.chain.BlockTxFees(blk)
+		if err != nil {
+			context := "Failed to obtain transaction fees"
+			return nil, internalRPCError(err.Error(), context)
+		}
 		txns := blk.Transactions()
 		rawTxns := make([]btcjson.TxRawResult, len(txns))
 		for i, tx := range txns {
@@ -1208,6 +1698,7 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 			if err != nil {
 				return nil, err
 			}
+			rawTxn.Fee = txFeeResult(fees, i)
 			rawTxns[i] = *rawTxn
 		}
 		blockReply.RawTx = rawTxns
@@ -1216,6 +1707,227 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return blockReply, nil
 }
 
+// txFeeResult returns the fee in RMG of the transaction of a block with the
+// passed index from the passed fees of the transactions of the block, as
+// returned by BlockTxFees.  The coinbase, which is the first transaction, pays
+// no fee, so it has none.
+func txFeeResult(fees []int64, i int) *float64 {
+	if i == 0 {
+		return nil
+	}
+	fee := provautil.Amount(fees[i]).ToRMG()
+	return &fee
+}
+
+// txFeeResults returns the passed fees of the transactions of the passed block,
+// as returned by BlockTxFees, in the format used by the block connected webhook
+// event.
+func txFeeResults(block *provautil.Block, fees []int64) []btcjson.TxFeeResult {
+	txns := block.Transactions()
+	results := make([]btcjson.TxFeeResult, len(txns))
+	for i, tx := range txns {
+		results[i] = btcjson.TxFeeResult{
+			TxID: tx.Hash().String(),
+			Fee:  txFeeResult(fees, i),
+		}
+	}
+	return results
+}
+
+// adminOpResults returns the passed admin operation records in the format
+// used by the getblockadminops command and the block connected webhook event.
+func adminOpResults(records []blockchain.AdminOpRecord) []btcjson.AdminOpResult {
+	results := make([]btcjson.AdminOpResult, 0, len(records))
+	for i := range records {
+		record := &records[i]
+		result := btcjson.AdminOpResult{
+			TxID:   record.TxHash.String(),
+			Thread: adminThreadNames[record.Thread],
+			Op:     record.Op.String(),
+		}
+		switch record.Op {
+		case blockchain.AdminOpAddKey, blockchain.AdminOpRevokeKey:
+			setSize := record.SetSize
+			result.KeySet = record.KeySet.String()
+			result.PubKey = hex.EncodeToString(
+				record.PubKey.SerializeCompressed())
+			result.KeyID = uint32(record.KeyID)
+			result.SetSize = &setSize
+		case blockchain.AdminOpIssue, blockchain.AdminOpDestroy:
+			totalSupply := record.TotalSupply
+			result.Amount = record.Amount
+			result.TotalSupply = &totalSupply
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// handleGetAddrManInfo implements the getaddrmaninfo command.
+func handleGetAddrManInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	addrManager := s.server.addrManager
+	numNew, numTried := addrManager.NumNewAndTried()
+	unroutable, private, self := s.server.addrRelay.Stats()
+	return &btcjson.GetAddrManInfoResult{
+		Addresses:            addrManager.NumAddresses(),
+		New:                  numNew,
+		Tried:                numTried,
+		SuppressedUnroutable: unroutable,
+		SuppressedPrivate:    private,
+		SuppressedSelf:       self,
+	}, nil
+}
+
+// handleGetAdminProof implements the getadminproof command.
+func handleGetAdminProof(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetAdminProofCmd)
+
+	best := s.chain.BestSnapshot()
+	if c.Height > best.Height {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCOutOfRange,
+			Message: "Block height out of range",
+		}
+	}
+	proof, err := s.chain.AdminProof(c.Height)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+
+	// The checkpoint block can't be reorganized out of the main chain, so
+	// its hash can be looked up separately from the proof, while the hash
+	// of the block the proof is for is taken from its headers.
+	checkpointHash, err := s.chain.BlockHashByHeight(proof.CheckpointHeight)
+	if err != nil {
+		context := "Failed to look up checkpoint block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	hash := checkpointHash
+	if len(proof.Headers) > 0 {
+		blockHash := proof.Headers[len(proof.Headers)-1].BlockHash()
+		hash = &blockHash
+	}
+
+	var buf bytes.Buffer
+	if err := proof.Serialize(&buf); err != nil {
+		context := "Failed to serialize proof"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	stateHash := proof.CheckpointState.Hash()
+	return &btcjson.GetAdminProofResult{
+		Height:           proof.Height(),
+		Hash:             hash.String(),
+		CheckpointHeight: proof.CheckpointHeight,
+		CheckpointHash:   checkpointHash.String(),
+		StateHash:        stateHash.String(),
+		NumHeaders:       len(proof.Headers),
+		NumAdminTxs:      len(proof.AdminTxs),
+		Proof:            hex.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// handleGetBlockAdminOps implements the getblockadminops command.
+func handleGetBlockAdminOps(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBlockAdminOpsCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.Hash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Hash)
+	}
+	var header wire.BlockHeader
+	err = s.server.db.View(func(dbTx database.Tx) error {
+		headerBytes, err := dbTx.FetchBlockHeader(hash)
+		if err != nil {
+			return err
+		}
+		return header.Deserialize(bytes.NewReader(headerBytes))
+	})
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	records, err := s.chain.AdminOpsInBlock(hash)
+	if err != nil {
+		context := "Failed to compute admin operations"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	mainChain, err := s.chain.MainChainHasBlock(hash)
+	if err != nil {
+		context := "Failed to look up block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return &btcjson.GetBlockAdminOpsResult{
+		Hash:      c.Hash,
+		Height:    header.Height,
+		MainChain: mainChain,
+		Ops:       adminOpResults(records),
+	}, nil
+}
+
+// handleGetBlockCommitment implements the getblockcommitment command.
+func handleGetBlockCommitment(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBlockCommitmentCmd)
+
+	// Load the block from the database.
+	hash, err := chainhash.NewHashFromStr(c.Hash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Hash)
+	}
+	var blkBytes []byte
+	err = s.server.db.View(func(dbTx database.Tx) error {
+		var err error
+		blkBytes, err = dbTx.FetchBlock(hash)
+		return err
+	})
+	if err != nil {
+		if s.server.blockScrubber.ReportCorrupt(hash, err) {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCDatabase,
+				Message: "Stored block data is corrupt and has " +
+					"been scheduled for re-download",
+			}
+		}
+		if dbErr, ok := err.(database.Error); ok &&
+			dbErr.ErrorCode == database.ErrBlockPruned {
+
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCMisc,
+				Message: "Block not available (pruned data)",
+			}
+		}
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+	var msgBlock wire.MsgBlock
+	err = msgBlock.BtcDecode(bytes.NewReader(blkBytes),
+		s.server.chainParams.TxEncoding())
+	if err != nil {
+		context := "Failed to deserialize block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	result := &btcjson.GetBlockCommitmentResult{
+		Hash:   c.Hash,
+		Height: msgBlock.Header.Height,
+	}
+	if len(msgBlock.Transactions) > 0 {
+		coinbase := msgBlock.Transactions[0]
+		commitment := txscript.ExtractBlockCommitmentMsgTx(coinbase)
+		if commitment != nil {
+			result.Commitment = hex.EncodeToString(commitment)
+		}
+	}
+	return result, nil
+}
+
 // handleGetBlockCount implements the getblockcount command.
 func handleGetBlockCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	best := s.chain.BestSnapshot()
@@ -1270,11 +1982,111 @@ func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct
 	// Get the block height from chain.
 	blockHeight, err := s.chain.BlockHeightByHash(hash)
 	if err != nil {
-		context := "Failed to obtain block height"
+		context := "Failed to obtain block height"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return s.verboseBlockHeader(&blockHeader, blockHeight,
+		s.chain.BestSnapshot())
+}
+
+// handleGetBlockProductionInfo implements the getblockproductioninfo command.
+func handleGetBlockProductionInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBlockProductionInfoCmd)
+
+	blocks := defaultBlockProductionWindow
+	if c.Blocks != nil {
+		blocks = *c.Blocks
+	}
+	if blocks <= 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "The number of blocks must be positive",
+		}
+	}
+	result, err := blockProductionInfo(s.chain, s.server.chainParams,
+		blocks)
+	if err != nil {
+		context := "Failed to compute block production statistics"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return result, nil
+}
+
+// handleGetBlockRaw implements the getblockraw command.
+func handleGetBlockRaw(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBlockRawCmd)
+
+	// Lookup the location of the block to learn its serialized length.
+	hash, err := chainhash.NewHashFromStr(c.Hash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Hash)
+	}
+	location, err := s.chain.BlockRegion(hash)
+	if err != nil {
+		if dbErr, ok := err.(database.Error); ok &&
+			dbErr.ErrorCode == database.ErrBlockPruned {
+
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCMisc,
+				Message: "Block not available (pruned data)",
+			}
+		}
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	// The region defaults to the remainder of the block after the offset
+	// and must lie within the block.
+	var offset uint32
+	if c.Offset != nil {
+		offset = *c.Offset
+	}
+	if offset > location.Len {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Offset %d exceeds the block "+
+				"length of %d", offset, location.Len),
+		}
+	}
+	length := location.Len - offset
+	if c.Length != nil {
+		if *c.Length > length {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Offset %d and length %d "+
+					"exceed the block length of %d", offset,
+					*c.Length, location.Len),
+			}
+		}
+		length = *c.Length
+	}
+
+	// Load the requested region of the block from the database.
+	var regionHex string
+	err = s.server.db.View(func(dbTx database.Tx) error {
+		regionBytes, err := dbTx.FetchBlockRegion(&database.BlockRegion{
+			Hash:   hash,
+			Offset: offset,
+			Len:    length,
+		})
+		if err != nil {
+			return err
+		}
+		regionHex = hex.EncodeToString(regionBytes)
+		return nil
+	})
+	if err != nil {
+		context := "Failed to load block region"
 		return nil, internalRPCError(err.Error(), context)
 	}
-	best := s.chain.BestSnapshot()
+	return regionHex, nil
+}
 
+// verboseBlockHeader returns the getblockheader verbose result for the passed
+// header of the main chain block at the passed height.
+func (s *rpcServer) verboseBlockHeader(blockHeader *wire.BlockHeader, blockHeight uint32, best *blockchain.BestState) (*btcjson.GetBlockHeaderVerboseResult, error) {
 	// Get next block hash unless there are none.
 	var nextHashString string
 	if blockHeight < best.Height {
@@ -1286,8 +2098,8 @@ func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct
 		nextHashString = nextHash.String()
 	}
 
-	blockHeaderReply := btcjson.GetBlockHeaderVerboseResult{
-		Hash:             c.Hash,
+	blockHeaderReply := &btcjson.GetBlockHeaderVerboseResult{
+		Hash:             blockHeader.BlockHash().String(),
 		Confirmations:    uint64(1 + best.Height - blockHeight),
 		Height:           int32(blockHeader.Height),
 		Version:          blockHeader.Version,
@@ -1508,7 +2320,7 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		// median timestamp of the last several blocks per the chain
 		// consensus rules.
 		best := s.server.blockManager.chain.BestSnapshot()
-		minTimestamp := mining.MinimumMedianTime(best)
+		minTimestamp := mining.MinimumBlockTime(best, s.server.chainParams)
 
 		// Update work state to ensure another block template isn't
 		// generated until needed.
@@ -1918,6 +2730,10 @@ func chainErrToGBTErrString(err error) string {
 		return "time-too-old"
 	case blockchain.ErrTimeTooNew:
 		return "time-too-new"
+	case blockchain.ErrNonMonotonicTime:
+		return "time-not-monotonic"
+	case blockchain.ErrTimestampRegression:
+		return "time-regression"
 	case blockchain.ErrDifficultyTooLow:
 		return "bad-diffbits"
 	case blockchain.ErrUnexpectedDifficulty:
@@ -1954,8 +2770,12 @@ func chainErrToGBTErrString(err error) string {
 		return "bad-txns-badinput"
 	case blockchain.ErrMissingTx:
 		return "bad-txns-missinginput"
+	case blockchain.ErrSpentTxOut:
+		return "bad-txns-spentinput"
 	case blockchain.ErrUnfinalizedTx:
 		return "bad-txns-unfinalizedtx"
+	case blockchain.ErrTxExpired:
+		return "bad-txns-expired"
 	case blockchain.ErrDuplicateTx:
 		return "bad-txns-duplicate"
 	case blockchain.ErrOverwriteTx:
@@ -1990,6 +2810,8 @@ func chainErrToGBTErrString(err error) string {
 		return "bad-size-value"
 	case blockchain.ErrInvalidValidateKey:
 		return "invalid-validate-key"
+	case blockchain.ErrDoubleSigner:
+		return "double-signer"
 	case blockchain.ErrFeeTooHigh:
 		return "bad-txns-highfee"
 	}
@@ -2025,7 +2847,9 @@ func handleGetBlockTemplateProposal(s *rpcServer, request *btcjson.TemplateReque
 		}
 	}
 	var msgBlock wire.MsgBlock
-	if err := msgBlock.Deserialize(bytes.NewReader(dataBytes)); err != nil {
+	err = msgBlock.BtcDecode(bytes.NewReader(dataBytes),
+		s.server.chainParams.TxEncoding())
+	if err != nil {
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCDeserialization,
 			Message: "Block decode failed: " + err.Error(),
@@ -2041,7 +2865,7 @@ func handleGetBlockTemplateProposal(s *rpcServer, request *btcjson.TemplateReque
 	}
 
 	flags := blockchain.BFDryRun | blockchain.BFNoPoWCheck
-	isOrphan, err := s.server.blockManager.ProcessBlock(block, flags)
+	status, isOrphan, err := s.server.blockManager.ProcessBlock(block, flags)
 	if err != nil {
 		if _, ok := err.(blockchain.RuleError); !ok {
 			err := rpcsLog.Errorf("Failed to process block "+
@@ -2055,6 +2879,9 @@ func handleGetBlockTemplateProposal(s *rpcServer, request *btcjson.TemplateReque
 		rpcsLog.Infof("Rejected block proposal: %v", err)
 		return chainErrToGBTErrString(err), nil
 	}
+	if status.IsDuplicate() {
+		return "duplicate", nil
+	}
 	if isOrphan {
 		return "orphan", nil
 	}
@@ -2105,6 +2932,11 @@ func handleGetDifficulty(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 	return getDifficultyRatio(best.Bits), nil
 }
 
+// handleGetErrorStats implements the geterrorstats command.
+func handleGetErrorStats(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	return errorStatsResult(s.server.blockManager.errorStats), nil
+}
+
 // handleGetGenerate implements the getgenerate command.
 func handleGetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return s.server.cpuMiner.IsMining(), nil
@@ -2134,8 +2966,8 @@ func handleGetHeaders(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		blockLocators[i] = blockLocator
 	}
 	var hashStop chainhash.Hash
-	if c.HashStop != "" {
-		err := chainhash.Decode(&hashStop, c.HashStop)
+	if c.HashStop != nil && *c.HashStop != "" {
+		err := chainhash.Decode(&hashStop, *c.HashStop)
 		if err != nil {
 			return nil, &btcjson.RPCError{
 				Code:    btcjson.ErrRPCInvalidParameter,
@@ -2143,15 +2975,10 @@ func handleGetHeaders(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 			}
 		}
 	}
-	blockHashes, err := s.server.locateBlocks(blockLocators, &hashStop)
-	if err != nil {
-		return nil, &btcjson.RPCError{
-			Code: btcjson.ErrRPCDatabase,
-			Message: "Failed to fetch hashes of block " +
-				"headers: " + err.Error(),
-		}
-	}
-	blockHeaders, err := fetchHeaders(s.chain, blockHashes)
+
+	// Locate the headers the same way as for the getheaders wire message
+	// so header sync tools see the same headers as peers do.
+	blockHeaders, err := locateHeaders(s.chain, blockLocators, &hashStop)
 	if err != nil {
 		return nil, &btcjson.RPCError{
 			Code: btcjson.ErrRPCDatabase,
@@ -2160,6 +2987,22 @@ func handleGetHeaders(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		}
 	}
 
+	// Decode the headers into JSON objects when the verbose flag is set.
+	if c.Verbose != nil && *c.Verbose {
+		best := s.chain.BestSnapshot()
+		verboseHeaders := make([]btcjson.GetBlockHeaderVerboseResult,
+			0, len(blockHeaders))
+		for i := range blockHeaders {
+			h := &blockHeaders[i]
+			result, err := s.verboseBlockHeader(h, h.Height, best)
+			if err != nil {
+				return nil, err
+			}
+			verboseHeaders = append(verboseHeaders, *result)
+		}
+		return verboseHeaders, nil
+	}
+
 	hexBlockHeaders := make([]string, len(blockHeaders))
 	var buf bytes.Buffer
 	for i, h := range blockHeaders {
@@ -2193,6 +3036,71 @@ func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 	return ret, nil
 }
 
+// handleGetJobStatus implements the getjobstatus command.
+func handleGetJobStatus(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetJobStatusCmd)
+
+	job, ok := s.jobs.lookup(c.ID)
+	if !ok {
+		return nil, rpcJobNotFoundError(c.ID)
+	}
+	return job.status(s.jobs.now()), nil
+}
+
+// handleGetMempoolEntry implements the getmempoolentry command.
+func handleGetMempoolEntry(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMempoolEntryCmd)
+
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+	entry, err := s.server.txMemPool.MempoolEntry(txHash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCNoTxInfo,
+			Message: "Transaction not in mempool",
+		}
+	}
+	return entry, nil
+}
+
+// handleGetMempoolSnapshot implements the getmempoolsnapshot command.
+func handleGetMempoolSnapshot(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMempoolSnapshotCmd)
+
+	includeRawTx := c.IncludeRawTx != nil && *c.IncludeRawTx
+	snapshot := s.server.txMemPool.Snapshot(includeRawTx)
+	result := &btcjson.GetMempoolSnapshotResult{
+		Sequence: snapshot.Sequence,
+		Entries: make([]btcjson.MempoolSnapshotEntry, 0,
+			len(snapshot.Entries)),
+	}
+	for _, entry := range snapshot.Entries {
+		resultEntry := btcjson.MempoolSnapshotEntry{
+			TxID:        entry.Hash.String(),
+			Size:        int32(entry.Size),
+			Fee:         provautil.Amount(entry.Fee).ToRMG(),
+			ModifiedFee: provautil.Amount(entry.Fee + entry.FeeDelta).ToRMG(),
+			Time:        entry.Added.Unix(),
+			Height:      int64(entry.Height),
+			Depends:     make([]string, 0, len(entry.Depends)),
+			SpentBy:     make([]string, 0, len(entry.SpentBy)),
+			Hex:         hex.EncodeToString(entry.RawTx),
+		}
+		for _, hash := range entry.Depends {
+			resultEntry.Depends = append(resultEntry.Depends,
+				hash.String())
+		}
+		for _, hash := range entry.SpentBy {
+			resultEntry.SpentBy = append(resultEntry.SpentBy,
+				hash.String())
+		}
+		result.Entries = append(result.Entries, resultEntry)
+	}
+	return result, nil
+}
+
 // handleGetMempoolInfo implements the getmempoolinfo command.
 func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	mempoolTxns := s.server.txMemPool.TxDescs()
@@ -2231,16 +3139,18 @@ func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 
 	best := s.chain.BestSnapshot()
 	result := btcjson.GetMiningInfoResult{
-		Blocks:           int64(best.Height),
-		CurrentBlockSize: best.BlockSize,
-		CurrentBlockTx:   best.NumTxns,
-		Difficulty:       getDifficultyRatio(best.Bits),
-		Generate:         s.server.cpuMiner.IsMining(),
-		GenProcLimit:     s.server.cpuMiner.NumWorkers(),
-		HashesPerSec:     int64(s.server.cpuMiner.HashesPerSecond()),
-		NetworkHashPS:    networkHashesPerSec,
-		PooledTx:         uint64(s.server.txMemPool.Count()),
-		TestNet:          cfg.TestNet,
+		BlockMaxSize:          cfg.BlockMaxSize,
+		Blocks:                int64(best.Height),
+		ConsensusMaxBlockSize: wire.MaxBlockPayload,
+		CurrentBlockSize:      best.BlockSize,
+		CurrentBlockTx:        best.NumTxns,
+		Difficulty:            getDifficultyRatio(best.Bits),
+		Generate:              s.server.cpuMiner.IsMining(),
+		GenProcLimit:          s.server.cpuMiner.NumWorkers(),
+		HashesPerSec:          int64(s.server.cpuMiner.HashesPerSecond()),
+		NetworkHashPS:         networkHashesPerSec,
+		PooledTx:              uint64(s.server.txMemPool.Count()),
+		TestNet:               cfg.TestNet,
 	}
 	return &result, nil
 }
@@ -2256,6 +3166,55 @@ func handleGetNetTotals(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	return reply, nil
 }
 
+// handleGetNetworkInfo implements the getnetworkinfo command.
+func handleGetNetworkInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// Onion addresses are reached through the onion-specific proxy when
+	// one is configured and the normal proxy otherwise.
+	onionProxy := cfg.OnionProxy
+	if onionProxy == "" {
+		onionProxy = cfg.Proxy
+	}
+	amgr := s.server.addrManager
+	networks := make([]btcjson.NetworksResult, 0, 3)
+	for _, n := range []addrmgr.Network{addrmgr.NetIPv4, addrmgr.NetIPv6,
+		addrmgr.NetOnion} {
+
+		proxy := cfg.Proxy
+		if n == addrmgr.NetOnion {
+			proxy = onionProxy
+		}
+		networks = append(networks, btcjson.NetworksResult{
+			Name:      n.String(),
+			Limited:   !cfg.allowsNet(n),
+			Reachable: amgr.IsReachable(n),
+			Proxy:     proxy,
+		})
+	}
+
+	localAddrs := amgr.LocalAddresses()
+	addrResults := make([]btcjson.LocalAddressesResult, 0, len(localAddrs))
+	for _, la := range localAddrs {
+		addrResults = append(addrResults, btcjson.LocalAddressesResult{
+			Address: la.NetAddress.IP.String(),
+			Port:    la.NetAddress.Port,
+			Score:   int32(la.Score),
+		})
+	}
+
+	ret := &btcjson.GetNetworkInfoResult{
+		Version:         int32(1000000*appMajor + 10000*appMinor + 100*appPatch),
+		ProtocolVersion: int32(maxProtocolVersion),
+		TimeOffset:      int64(s.server.timeSource.Offset().Seconds()),
+		Connections:     s.server.ConnectedCount(),
+		Listening:       !cfg.DisableListen && !cfg.OutboundOnly,
+		OutboundOnly:    cfg.OutboundOnly,
+		Networks:        networks,
+		RelayFee:        cfg.minRelayTxFee.ToRMG(),
+		LocalAddresses:  addrResults,
+	}
+	return ret, nil
+}
+
 // handleGetNetworkHashPS implements the getnetworkhashps command.
 func handleGetNetworkHashPS(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Note: All valid error return paths should return an int64.
@@ -2358,26 +3317,28 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	for _, p := range peers {
 		statsSnap := p.StatsSnapshot()
 		info := &btcjson.GetPeerInfoResult{
-			ID:             statsSnap.ID,
-			Addr:           statsSnap.Addr,
-			AddrLocal:      p.LocalAddr().String(),
-			Services:       fmt.Sprintf("%08d", uint64(statsSnap.Services)),
-			RelayTxes:      !p.disableRelayTx,
-			LastSend:       statsSnap.LastSend.Unix(),
-			LastRecv:       statsSnap.LastRecv.Unix(),
-			BytesSent:      statsSnap.BytesSent,
-			BytesRecv:      statsSnap.BytesRecv,
-			ConnTime:       statsSnap.ConnTime.Unix(),
-			PingTime:       float64(statsSnap.LastPingMicros),
-			TimeOffset:     statsSnap.TimeOffset,
-			Version:        statsSnap.Version,
-			SubVer:         statsSnap.UserAgent,
-			Inbound:        statsSnap.Inbound,
-			StartingHeight: statsSnap.StartingHeight,
-			CurrentHeight:  statsSnap.LastBlock,
-			BanScore:       int32(p.banScore.Int()),
-			FeeFilter:      atomic.LoadInt64(&p.feeFilter),
-			SyncNode:       p == syncPeer,
+			ID:              statsSnap.ID,
+			Addr:            statsSnap.Addr,
+			AddrLocal:       p.LocalAddr().String(),
+			Services:        fmt.Sprintf("%08d", uint64(statsSnap.Services)),
+			RelayTxes:       !p.disableRelayTx,
+			LastSend:        statsSnap.LastSend.Unix(),
+			LastRecv:        statsSnap.LastRecv.Unix(),
+			BytesSent:       statsSnap.BytesSent,
+			BytesRecv:       statsSnap.BytesRecv,
+			ConnTime:        statsSnap.ConnTime.Unix(),
+			PingTime:        float64(statsSnap.LastPingMicros),
+			TimeOffset:      statsSnap.TimeOffset,
+			Version:         statsSnap.Version,
+			ProtocolVersion: p.ProtocolVersion(),
+			SubVer:          statsSnap.UserAgent,
+			Inbound:         statsSnap.Inbound,
+			StartingHeight:  statsSnap.StartingHeight,
+			CurrentHeight:   statsSnap.LastBlock,
+			BanScore:        int32(p.banScore.Int()),
+			FeeFilter:       atomic.LoadInt64(&p.feeFilter),
+			SyncNode:        p == syncPeer,
+			Deprioritized:   p.deprioritized,
 		}
 		if p.LastPingNonce() != 0 {
 			wait := float64(time.Since(statsSnap.LastPingTime).Nanoseconds())
@@ -2389,6 +3350,51 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return infos, nil
 }
 
+// handleGetPeerStats implements the getpeerstats command.
+func handleGetPeerStats(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetPeerStatsCmd)
+
+	sortBy := "lastconnected"
+	if c.SortBy != nil {
+		sortBy = *c.SortBy
+	}
+	if _, ok := peerStatsSortKeys[sortBy]; !ok {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid sort field " + sortBy,
+		}
+	}
+
+	stats := s.server.peerStats.Stats(sortBy)
+	if c.Count != nil && *c.Count >= 0 && *c.Count < len(stats) {
+		stats = stats[:*c.Count]
+	}
+	results := make([]btcjson.GetPeerStatsResult, 0, len(stats))
+	for _, ps := range stats {
+		result := btcjson.GetPeerStatsResult{
+			Addr:           ps.addr,
+			BytesSent:      ps.bytesSent,
+			BytesRecv:      ps.bytesReceived,
+			BlocksServed:   ps.blocksServed,
+			BlocksReceived: ps.blocksReceived,
+			Connections:    ps.connections,
+			LastConnected:  ps.lastConnected.Unix(),
+			BanScores: make([]btcjson.PeerBanScoreResult, 0,
+				len(ps.banScores)),
+		}
+		for _, bs := range ps.banScores {
+			result.BanScores = append(result.BanScores,
+				btcjson.PeerBanScoreResult{
+					Time:  bs.recorded.Unix(),
+					Score: bs.score,
+				})
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
 // handleGetRawMempool implements the getrawmempool command.
 func handleGetRawMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetRawMempoolCmd)
@@ -2440,6 +3446,9 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 					"(specify --txindex)",
 			}
 		}
+		if err := s.indexSyncingError(txIndex); err != nil {
+			return nil, err
+		}
 
 		// Look up the location of the transaction.
 		blockRegion, err := txIndex.TxBlockRegion(txHash)
@@ -2479,7 +3488,8 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 
 		// Deserialize the transaction
 		var msgTx wire.MsgTx
-		err = msgTx.Deserialize(bytes.NewReader(txBytes))
+		err = msgTx.BtcDecode(bytes.NewReader(txBytes),
+			s.server.chainParams.TxEncoding())
 		if err != nil {
 			context := "Failed to deserialize transaction"
 			return nil, internalRPCError(err.Error(), context)
@@ -2529,6 +3539,256 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 	return *rawTxn, nil
 }
 
+// handleGetBroadcastStatus implements the getbroadcaststatus command.
+func handleGetBroadcastStatus(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBroadcastStatusCmd)
+	hash, err := chainhash.NewHashFromStr(c.Hash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Hash)
+	}
+
+	var result *btcjson.GetBroadcastStatusResult
+	if s.server.blockBroadcaster != nil {
+		result = s.server.blockBroadcaster.Status(hash)
+	}
+	if result == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block was not broadcast",
+		}
+	}
+	return result, nil
+}
+
+// handleGetChainParams implements the getchainparams command.
+func handleGetChainParams(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// Decode the JSON encoding of the active network parameters into the
+	// result so the result always matches the encoding used by chaincfg.
+	paramsJSON, err := json.Marshal(s.server.chainParams)
+	if err != nil {
+		context := "Failed to encode chain parameters"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	var result btcjson.GetChainParamsResult
+	if err := json.Unmarshal(paramsJSON, &result); err != nil {
+		context := "Failed to decode chain parameters"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return &result, nil
+}
+
+// handleGetChainSplitInfo implements the getchainsplitinfo command.
+func handleGetChainSplitInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	return s.server.blockManager.ChainSplitInfo(), nil
+}
+
+// handleGetNextKeyID implements the getnextkeyid command.
+func handleGetNextKeyID(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// KeyIDs are provisioned in increasing order and revoked keyIDs stay
+	// bound to their keys, so every keyID up to the last one was used.
+	return uint32(s.chain.LastKeyID()) + 1, nil
+}
+
+// handleGetThreadInfo implements the getthreadinfo command.
+func handleGetThreadInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	result, err := s.server.blockManager.ThreadInfo()
+	if err != nil {
+		context := "Failed to check the admin threads"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return result, nil
+}
+
+// newDoubleSignResult returns the RPC representation of the passed evidence of
+// a validate key which signed two different blocks at the same height.
+func newDoubleSignResult(ds *blockchain.DoubleSign, rejectDoubleSigners bool) (*btcjson.DoubleSignResult, error) {
+	var firstBuf, secondBuf bytes.Buffer
+	if err := ds.First.Serialize(&firstBuf); err != nil {
+		return nil, err
+	}
+	if err := ds.Second.Serialize(&secondBuf); err != nil {
+		return nil, err
+	}
+	return &btcjson.DoubleSignResult{
+		ValidatingPubKey: ds.ValidatingPubKey.String(),
+		Height:           ds.Height,
+		FirstHash:        ds.First.BlockHash().String(),
+		FirstHeader:      hex.EncodeToString(firstBuf.Bytes()),
+		SecondHash:       ds.Second.BlockHash().String(),
+		SecondHeader:     hex.EncodeToString(secondBuf.Bytes()),
+		Detected:         ds.Detected.Unix(),
+		ClearedHeight:    ds.ClearedHeight,
+		Rejected:         rejectDoubleSigners && ds.ClearedHeight == 0,
+	}, nil
+}
+
+// handleGetDoubleSigns implements the getdoublesigns command.
+func handleGetDoubleSigns(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	reject := s.server.chainParams.RejectDoubleSigners
+	doubleSigns := s.chain.DoubleSigns()
+	result := &btcjson.GetDoubleSignsResult{
+		RejectDoubleSigners: reject,
+		DoubleSigns: make([]btcjson.DoubleSignResult, 0,
+			len(doubleSigns)),
+	}
+	for i := range doubleSigns {
+		dsResult, err := newDoubleSignResult(&doubleSigns[i], reject)
+		if err != nil {
+			context := "Failed to serialize block header"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		result.DoubleSigns = append(result.DoubleSigns, *dsResult)
+	}
+	return result, nil
+}
+
+// handleGetProcessingJournal implements the getprocessingjournal command.
+func handleGetProcessingJournal(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetProcessingJournalCmd)
+
+	journal := s.server.blockManager.journal
+	if journal == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "The block processing journal is not kept in read-only mode",
+		}
+	}
+
+	count := -1
+	if c.Count != nil && *c.Count >= 0 {
+		count = *c.Count
+	}
+	entries, err := journal.Entries(count)
+	if err != nil {
+		context := "Failed to read block processing journal"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	result := &btcjson.GetProcessingJournalResult{
+		Capacity:     journal.Capacity(),
+		UncleanStart: journal.Unclean(),
+		Entries: make([]btcjson.ProcessingJournalEntryResult, 0,
+			len(entries)),
+	}
+	for i := range entries {
+		entry := &entries[i]
+		entryResult := btcjson.ProcessingJournalEntryResult{
+			Seq:     entry.seq,
+			Time:    entry.time.Unix(),
+			Hash:    entry.hash.String(),
+			Height:  entry.height,
+			Action:  entry.action.String(),
+			Outcome: entry.outcome.String(),
+		}
+		if entry.outcome == journalRejected {
+			entryResult.ErrorCode = entry.errorCode.String()
+		}
+		result.Entries = append(result.Entries, entryResult)
+	}
+	return result, nil
+}
+
+// handleGetPolicyInfo implements the getpolicyinfo command.
+func handleGetPolicyInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	policy := s.server.txMemPool.Policy()
+	return &btcjson.GetPolicyInfoResult{
+		AcceptNonStd:          policy.AcceptNonStd,
+		RequireCanonicalOrder: policy.RequireCanonicalOrder,
+		RelayPriority:         !policy.DisableRelayPriority,
+		MinRelayTxFee:         policy.MinRelayTxFee.ToRMG(),
+		FreeTxRelayLimit:      policy.FreeTxRelayLimit,
+		MaxOrphanTxs:          policy.MaxOrphanTxs,
+		MaxTxVersion:          policy.MaxTxVersion,
+		MempoolExpiry:         int64(policy.TxExpiry / time.Second),
+	}, nil
+}
+
+// handleGetRejectSummary implements the getrejectsummary command.
+func handleGetRejectSummary(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.server.rejectStats == nil {
+		return newRejectStats(0).Summary(), nil
+	}
+	return s.server.rejectStats.Summary(), nil
+}
+
+// handleGetRPCInfo implements the getrpcinfo command.
+func handleGetRPCInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.stats == nil {
+		return newRPCStats(0).Info(), nil
+	}
+	return s.stats.Info(), nil
+}
+
+// handleGetScrubStatus implements the getscrubstatus command.
+func handleGetScrubStatus(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	status := s.server.blockScrubber.Status()
+	result := &btcjson.GetScrubStatusResult{
+		Enabled:         status.enabled,
+		Scanning:        status.scanning,
+		ScanHeight:      status.scanHeight,
+		Passes:          status.passes,
+		BlocksChecked:   status.blocksChecked,
+		CorruptDetected: status.corruptDetected,
+		Repaired:        status.repaired,
+		CorruptBlocks: make([]btcjson.ScrubCorruptBlockResult, 0,
+			len(status.corruptBlocks)),
+	}
+	if !status.lastPassStart.IsZero() {
+		result.LastPassStart = status.lastPassStart.Unix()
+	}
+	if !status.lastPassEnd.IsZero() {
+		result.LastPassEnd = status.lastPassEnd.Unix()
+	}
+	for _, cb := range status.corruptBlocks {
+		result.CorruptBlocks = append(result.CorruptBlocks,
+			btcjson.ScrubCorruptBlockResult{
+				Hash:     cb.hash.String(),
+				Height:   cb.height,
+				Detected: cb.detected.Unix(),
+			})
+	}
+
+	return result, nil
+}
+
+// handleGetStatsHistory implements the getstatshistory command.
+func handleGetStatsHistory(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetStatsHistoryCmd)
+
+	start := time.Unix(0, 0)
+	if c.Start != nil {
+		start = time.Unix(*c.Start, 0)
+	}
+	end := time.Now()
+	if c.End != nil {
+		// Include the samples taken during the last second.
+		end = time.Unix(*c.End, int64(time.Second-1))
+	}
+	if end.Before(start) {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "The end time may not be before the start time",
+		}
+	}
+	var step time.Duration
+	if c.Step != nil {
+		if *c.Step < 0 {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "The step may not be negative",
+			}
+		}
+		step = time.Duration(*c.Step) * time.Second
+	}
+
+	result, err := s.server.statsHistory.History(start, end, step)
+	if err != nil {
+		context := "Failed to read stats history"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return result, nil
+}
+
 // handleGetTxOut handles gettxout commands.
 func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetTxOutCmd)
@@ -2674,7 +3934,235 @@ func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 		context := "Failed to generate help"
 		return nil, internalRPCError(err.Error(), context)
 	}
-	return help, nil
+	return help, nil
+}
+
+// wsTokenRPCError returns the JSON-RPC error describing the passed error which
+// occurred while updating the websocket tokens.
+func wsTokenRPCError(err error) *btcjson.RPCError {
+	if _, ok := err.(errWSTokenScope); ok {
+		return &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	return &btcjson.RPCError{
+		Code:    btcjson.ErrRPCDatabase,
+		Message: "Failed to update websocket tokens: " + err.Error(),
+	}
+}
+
+// handleIssueWSToken handles issuewstoken commands.
+func handleIssueWSToken(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.IssueWSTokenCmd)
+
+	var methods []string
+	if c.Methods != nil {
+		methods = *c.Methods
+	}
+	var expires time.Time
+	if c.Expires != nil && *c.Expires != 0 {
+		expires = time.Unix(*c.Expires, 0)
+	}
+	secret, token, err := s.server.wsTokens.Issue(c.Notifications, methods,
+		expires)
+	if err != nil {
+		return nil, wsTokenRPCError(err)
+	}
+	rpcsLog.Infof("Issued websocket token %s", token.id)
+	result := token.result()
+	result.Token = secret
+	return result, nil
+}
+
+// handleListUnspentByAddress implements the listunspentbyaddress command.
+func handleListUnspentByAddress(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	run, err := newListUnspentByAddressJob(s, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := closeChanContext(closeChan)
+	defer cancel()
+	return run(ctx, nil)
+}
+
+// utxoScanProgress returns the estimated fraction of the utxo set which was
+// scanned once the transaction with the passed hash was scanned.  The utxo set
+// is scanned in the byte order of the transaction hashes, which are uniformly
+// distributed, so the leading bytes of the hash estimate the fraction.
+func utxoScanProgress(txHash *chainhash.Hash) float64 {
+	return float64(binary.BigEndian.Uint64(txHash[:8])) / (1 << 64)
+}
+
+// newListUnspentByAddressJob returns the function which runs the passed
+// listunspentbyaddress command, either synchronously or as a job, once the
+// parameters of the command are validated.  Jobs report the number and total
+// amount of the outputs which matched so far as their partial result.
+func newListUnspentByAddressJob(s *rpcServer, cmd interface{}) (rpcJobFunc, error) {
+	c := cmd.(*btcjson.ListUnspentByAddressCmd)
+
+	query := &indexers.UnspentQuery{
+		KeyIDs:  watchlistKeyIDs(c.KeyIDs),
+		MinConf: int32(*c.MinConf),
+		MaxConf: int32(*c.MaxConf),
+	}
+	for _, address := range c.Addresses {
+		addr, err := provautil.DecodeAddressForNet(address,
+			s.server.chainParams)
+		if err != nil {
+			return nil, rpcAddressError(err)
+		}
+		query.Addresses = append(query.Addresses, addr)
+	}
+	if len(query.Addresses) == 0 && len(query.KeyIDs) == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "At least one address or key ID must be specified",
+		}
+	}
+	if *c.MinConf < 0 || *c.MaxConf < *c.MinConf {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: "Confirmations must satisfy 0 <= minconf <= " +
+				"maxconf",
+		}
+	}
+	var target provautil.Amount
+	if c.Amount != nil {
+		var err error
+		target, err = provautil.NewAmount(*c.Amount)
+		if err != nil || target <= 0 {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Amount must be positive",
+			}
+		}
+	}
+	if *c.ExcludeMempoolSpent {
+		query.Exclude = func(op *wire.OutPoint) bool {
+			return s.server.txMemPool.CheckSpend(*op) != nil
+		}
+	}
+
+	return func(ctx context.Context, job *rpcJob) (interface{}, error) {
+		return listUnspentByAddress(ctx, s, c, query, target, job)
+	}, nil
+}
+
+// listUnspentByAddress scans the utxo set for the outputs matching the passed
+// query of the passed listunspentbyaddress command, reporting its progress
+// through the passed job, which may be nil, and selects the outputs to reach
+// the passed target amount when the command requests one.
+func listUnspentByAddress(ctx context.Context, s *rpcServer, c *btcjson.ListUnspentByAddressCmd, query *indexers.UnspentQuery, target provautil.Amount, job *rpcJob) (interface{}, error) {
+	if job != nil {
+		var numMatched int
+		var matchedTotal provautil.Amount
+		query.Progress = func(txHash *chainhash.Hash, outputs []indexers.UnspentOutput) {
+			for _, output := range outputs[numMatched:] {
+				matchedTotal += provautil.Amount(output.Amount)
+			}
+			numMatched = len(outputs)
+			job.report(utxoScanProgress(txHash),
+				&btcjson.UnspentScanProgressResult{
+					Matched: numMatched,
+					Total:   matchedTotal.ToRMG(),
+				})
+		}
+	}
+
+	best := s.chain.BestSnapshot()
+	outputs, err := indexers.FetchUnspentOutputs(ctx, s.chain,
+		s.server.chainParams, query)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		context := "Failed to scan unspent outputs"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	// Select the outputs to reach the requested amount, largest first
+	// when requested.
+	if c.Amount != nil {
+		selected, total, ok := indexers.SelectUnspentOutputs(outputs,
+			int64(target), *c.LargestFirst)
+		if !ok {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCWalletInsufficientFunds,
+				Message: fmt.Sprintf("Insufficient funds: the "+
+					"matching outputs total %v of the "+
+					"requested %v", provautil.Amount(total),
+					target),
+			}
+		}
+		outputs = selected
+	}
+
+	result := &btcjson.ListUnspentByAddressResult{
+		Height:  best.Height,
+		Outputs: make([]btcjson.UnspentOutputResult, 0, len(outputs)),
+	}
+	var total provautil.Amount
+	for _, output := range outputs {
+		total += provautil.Amount(output.Amount)
+		unspent := btcjson.UnspentOutputResult{
+			TxID:          output.OutPoint.Hash.String(),
+			Vout:          output.OutPoint.Index,
+			Address:       output.Address,
+			ScriptPubKey:  hex.EncodeToString(output.PkScript),
+			Amount:        provautil.Amount(output.Amount).ToRMG(),
+			Confirmations: output.Confirmations,
+			Coinbase:      output.IsCoinBase,
+		}
+		for _, keyID := range output.KeyIDs {
+			unspent.KeyIDs = append(unspent.KeyIDs, uint32(keyID))
+		}
+		result.Outputs = append(result.Outputs, unspent)
+	}
+	result.Total = total.ToRMG()
+	return result, nil
+}
+
+// handleListWatch handles listwatch commands.
+func handleListWatch(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	addrs, keyIDs := s.server.watchlist.Entries()
+	result := &btcjson.ListWatchResult{
+		Addresses: addrs,
+		KeyIDs:    make([]uint32, 0, len(keyIDs)),
+	}
+	for _, keyID := range keyIDs {
+		result.KeyIDs = append(result.KeyIDs, uint32(keyID))
+	}
+	return result, nil
+}
+
+// handleListWSTokens handles listwstokens commands.
+func handleListWSTokens(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	tokens := s.server.wsTokens.Tokens()
+	result := make([]btcjson.WSTokenResult, 0, len(tokens))
+	for _, token := range tokens {
+		result = append(result, *token.result())
+	}
+	return result, nil
+}
+
+// handlePrioritiseTransaction implements the prioritisetransaction command.
+func handlePrioritiseTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.PrioritiseTransactionCmd)
+
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+	if c.PriorityDelta != 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Priority deltas are not supported",
+		}
+	}
+	s.server.txMemPool.PrioritiseTransaction(txHash, c.FeeDelta)
+	return true, nil
 }
 
 // handlePing implements the ping command.
@@ -2703,6 +4191,29 @@ type retrievedTx struct {
 	tx      *provautil.Tx
 }
 
+// txHashSorter implements sort.Interface to allow a slice of transactions to be
+// sorted by their hashes.
+type txHashSorter []*provautil.Tx
+
+// Len returns the number of transactions in the slice.  It is part of the
+// sort.Interface implementation.
+func (s txHashSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the transactions at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s txHashSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the hash of the transaction with index i sorts before
+// the hash of the transaction with index j.  It is part of the sort.Interface
+// implementation.
+func (s txHashSorter) Less(i, j int) bool {
+	return bytes.Compare(s[i].Hash()[:], s[j].Hash()[:]) < 0
+}
+
 // fetchInputTxos fetches the outpoints from all transactions referenced by the
 // inputs to the passed transaction by checking the transaction mempool first
 // then the transaction index for those already mined into blocks.
@@ -2750,7 +4261,8 @@ func fetchInputTxos(s *rpcServer, tx *wire.MsgTx) (map[wire.OutPoint]wire.TxOut,
 
 		// Deserialize the transaction
 		var msgTx wire.MsgTx
-		err = msgTx.Deserialize(bytes.NewReader(txBytes))
+		err = msgTx.BtcDecode(bytes.NewReader(txBytes),
+			s.server.chainParams.TxEncoding())
 		if err != nil {
 			context := "Failed to deserialize transaction"
 			return nil, internalRPCError(err.Error(), context)
@@ -2769,9 +4281,68 @@ func fetchInputTxos(s *rpcServer, tx *wire.MsgTx) (map[wire.OutPoint]wire.TxOut,
 	return originOutputs, nil
 }
 
+// fetchPrevOutputs fetches the outputs spent by the inputs of the passed
+// transaction, which is confirmed in the block with the passed hash or is
+// unconfirmed when the hash is nil.  The outputs are looked up with the
+// transaction index when it is enabled.  Otherwise, they are loaded from the
+// spend journal of the block for confirmed transactions and from the mempool
+// and the utxo set for unconfirmed ones.
+func fetchPrevOutputs(s *rpcServer, mtx *wire.MsgTx, blkHash *chainhash.Hash) (map[wire.OutPoint]wire.TxOut, error) {
+	if s.server.txIndex != nil {
+		return fetchInputTxos(s, mtx)
+	}
+
+	if blkHash != nil {
+		block, err := s.chain.BlockByHash(blkHash)
+		if err != nil {
+			context := "Failed to load block"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		originOutputs, err := s.chain.FetchSpentTxOuts(block)
+		if err != nil {
+			context := "Failed to load spent outputs"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		return originOutputs, nil
+	}
+
+	view, err := s.chain.FetchUtxoView(provautil.NewTx(mtx))
+	if err != nil {
+		context := "Failed to fetch utxo view"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	originOutputs := make(map[wire.OutPoint]wire.TxOut)
+	for _, txIn := range mtx.TxIn {
+		// Attempt to fetch and use the referenced transaction from the
+		// memory pool before falling back to the utxo set.
+		origin := &txIn.PreviousOutPoint
+		if mp := s.server.txMemPool; mp != nil {
+			originTx, err := mp.FetchTransaction(&origin.Hash)
+			if err == nil {
+				txOuts := originTx.MsgTx().TxOut
+				if origin.Index < uint32(len(txOuts)) {
+					originOutputs[*origin] = *txOuts[origin.Index]
+				}
+				continue
+			}
+		}
+
+		entry := view.LookupEntry(&origin.Hash)
+		if entry == nil || entry.IsOutputSpent(origin.Index) {
+			return nil, rpcNoTxInfoError(&origin.Hash)
+		}
+		originOutputs[*origin] = wire.TxOut{
+			Value:    entry.AmountByIndex(origin.Index),
+			PkScript: entry.PkScriptByIndex(origin.Index),
+		}
+	}
+
+	return originOutputs, nil
+}
+
 // createVinListPrevOut returns a slice of JSON objects for the inputs of the
 // passed transaction.
-func createVinListPrevOut(s *rpcServer, mtx *wire.MsgTx, chainParams *chaincfg.Params, vinExtra bool, filterAddrMap map[string]struct{}) ([]btcjson.VinPrevOut, error) {
+func createVinListPrevOut(s *rpcServer, mtx *wire.MsgTx, blkHash *chainhash.Hash, chainParams *chaincfg.Params, vinExtra bool, filterAddrMap map[string]struct{}) ([]btcjson.VinPrevOut, error) {
 	// Coinbase transactions only have a single txin by definition.
 	if blockchain.IsCoinBaseTx(mtx) {
 		// Only include the transaction if the filter map is empty
@@ -2796,7 +4367,7 @@ func createVinListPrevOut(s *rpcServer, mtx *wire.MsgTx, chainParams *chaincfg.P
 	var originOutputs map[wire.OutPoint]wire.TxOut
 	if vinExtra || len(filterAddrMap) > 0 {
 		var err error
-		originOutputs, err = fetchInputTxos(s, mtx)
+		originOutputs, err = fetchPrevOutputs(s, mtx, blkHash)
 		if err != nil {
 			return nil, err
 		}
@@ -2848,9 +4419,13 @@ func createVinListPrevOut(s *rpcServer, mtx *wire.MsgTx, chainParams *chaincfg.P
 		// Encode the addresses while checking if the address passes the
 		// filter when needed.
 		encodedAddrs := make([]string, len(addrs))
+		var keyIDs []uint32
 		for j, addr := range addrs {
 			encodedAddr := addr.EncodeAddress()
 			encodedAddrs[j] = encodedAddr
+			for _, keyID := range addr.ScriptKeyIDs() {
+				keyIDs = append(keyIDs, uint32(keyID))
+			}
 
 			// No need to check the map again if the filter already
 			// passes.
@@ -2878,6 +4453,7 @@ func createVinListPrevOut(s *rpcServer, mtx *wire.MsgTx, chainParams *chaincfg.P
 			vinListEntry := &vinList[len(vinList)-1]
 			vinListEntry.PrevOut = &btcjson.PrevOut{
 				Addresses: encodedAddrs,
+				KeyIDs:    keyIDs,
 				Value:     provautil.Amount(originTxOut.Value).ToRMG(),
 			}
 		}
@@ -2886,25 +4462,71 @@ func createVinListPrevOut(s *rpcServer, mtx *wire.MsgTx, chainParams *chaincfg.P
 	return vinList, nil
 }
 
-// fetchMempoolTxnsForAddress queries the address index for all unconfirmed
-// transactions that involve the provided address.  The results will be limited
-// by the number to skip and the number requested.
-func fetchMempoolTxnsForAddress(s *rpcServer, addr provautil.Address, numToSkip, numRequested uint32) ([]*provautil.Tx, uint32) {
-	// There are no entries to return when there are less available than the
-	// number being skipped.
-	mpTxns := s.server.addrIndex.UnconfirmedTxnsForAddress(addr)
-	numAvailable := uint32(len(mpTxns))
-	if numToSkip > numAvailable {
-		return nil, numAvailable
+// numAddrIndexEntriesAbove returns the number of the newest transactions
+// involving the passed address which are confirmed in blocks above the passed
+// height.
+func numAddrIndexEntriesAbove(s *rpcServer, dbTx database.Tx, addr provautil.Address, height uint32) (uint32, error) {
+	const batchSize = 100
+	var numAbove uint32
+	for {
+		regions, _, err := s.server.addrIndex.TxRegionsForAddress(dbTx,
+			addr, numAbove, batchSize, true)
+		if err != nil {
+			return 0, err
+		}
+		for i := range regions {
+			blkHeight, err := s.chain.BlockHeightByHash(regions[i].Hash)
+			if err != nil {
+				return 0, err
+			}
+			if blkHeight <= height {
+				return numAbove, nil
+			}
+			numAbove++
+		}
+		if len(regions) < batchSize {
+			return numAbove, nil
+		}
+	}
+}
+
+// handleRemoveWatch handles removewatch commands.
+func handleRemoveWatch(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.RemoveWatchCmd)
+
+	removed, err := s.server.watchlist.Remove(c.Addresses,
+		watchlistKeyIDs(c.KeyIDs))
+	if err != nil {
+		return nil, watchlistRPCError(err)
+	}
+	return removed, nil
+}
+
+// handleResetErrorStats implements the reseterrorstats command.
+func handleResetErrorStats(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if err := s.server.blockManager.errorStats.Reset(); err != nil {
+		context := "Failed to reset error stats"
+		return nil, internalRPCError(err.Error(), context)
 	}
+	return nil, nil
+}
 
-	// Filter the available entries based on the number to skip and number
-	// requested.
-	rangeEnd := numToSkip + numRequested
-	if rangeEnd > numAvailable {
-		rangeEnd = numAvailable
+// handleRevokeWSToken handles revokewstoken commands.
+func handleRevokeWSToken(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.RevokeWSTokenCmd)
+
+	revoked, err := s.server.wsTokens.Revoke(c.ID)
+	if err != nil {
+		return nil, wsTokenRPCError(err)
+	}
+	if !revoked {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "No websocket token with ID " + c.ID,
+		}
 	}
-	return mpTxns[numToSkip:rangeEnd], numToSkip
+	rpcsLog.Infof("Revoked websocket token %s", c.ID)
+	return nil, nil
 }
 
 // handleSearchRawTransactions implements the searchrawtransactions command.
@@ -2917,6 +4539,9 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 			Message: "Address index must be enabled (--addrindex)",
 		}
 	}
+	if err := s.indexSyncingError(addrIndex); err != nil {
+		return nil, err
+	}
 
 	// Override the flag for including extra previous output information in
 	// each input if needed.
@@ -2926,24 +4551,20 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 		vinExtra = *c.VinExtra != 0
 	}
 
-	// Including the extra previous output information requires the
-	// transaction index.  Currently the address index relies on the
-	// transaction index, so this check is redundant, but it's better to be
-	// safe in case the address index is ever changed to not rely on it.
-	if vinExtra && s.server.txIndex == nil {
-		return nil, &btcjson.RPCError{
-			Code:    btcjson.ErrRPCMisc,
-			Message: "Transaction index must be enabled (--txindex)",
+	// The extra previous output information is looked up with the
+	// transaction index when it is enabled, so it must have caught up.
+	// Otherwise, it is loaded from the spend journal.
+	if vinExtra && s.server.txIndex != nil {
+		if err := s.indexSyncingError(s.server.txIndex); err != nil {
+			return nil, err
 		}
 	}
 
 	// Attempt to decode the supplied address.
-	addr, err := provautil.DecodeAddress(c.Address, s.server.chainParams)
+	addr, err := provautil.DecodeAddressForNet(c.Address,
+		s.server.chainParams)
 	if err != nil {
-		return nil, &btcjson.RPCError{
-			Code:    btcjson.ErrRPCInvalidAddressOrKey,
-			Message: "Invalid address or key: " + err.Error(),
-		}
+		return nil, rpcAddressError(err)
 	}
 
 	// Override the default number of requested entries if needed.  Also,
@@ -2975,80 +4596,113 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 		reverse = *c.Reverse
 	}
 
-	// Add transactions from mempool first if client asked for reverse
-	// order.  Otherwise, they will be added last (as needed depending on
-	// the requested counts).
-	//
-	// NOTE: This code doesn't sort by dependency.  This might be something
-	// to do in the future for the client's convenience, or leave it to the
-	// client.
-	numSkipped := uint32(0)
-	addressTxns := make([]retrievedTx, 0, numRequested)
-	if reverse {
-		// Transactions in the mempool are not in a block header yet,
-		// so the block header field in the retieved transaction struct
-		// is left nil.
-		mpTxns, mpSkipped := fetchMempoolTxnsForAddress(s, addr,
-			uint32(numToSkip), uint32(numRequested))
-		numSkipped += mpSkipped
-		for _, tx := range mpTxns {
-			addressTxns = append(addressTxns, retrievedTx{tx: tx})
-		}
+	// Override the flag for including unconfirmed transactions if needed.
+	includeMempool := true
+	if c.IncludeMempool != nil {
+		includeMempool = *c.IncludeMempool
 	}
 
-	// Fetch transactions from the database in the desired order if more are
-	// needed.
-	if len(addressTxns) < numRequested {
-		err = s.server.db.View(func(dbTx database.Tx) error {
-			regions, dbSkipped, err := addrIndex.TxRegionsForAddress(
-				dbTx, addr, uint32(numToSkip)-numSkipped,
-				uint32(numRequested-len(addressTxns)), reverse)
+	// Override the maximum height of the confirmed transactions to include
+	// if needed.  Pages requested in reverse order with the same maximum
+	// height remain stable as new blocks are connected since the newer
+	// transactions are left out instead of shifting the older ones.
+	best := s.chain.BestSnapshot()
+	maxHeight := best.Height
+	if c.MaxHeight != nil && *c.MaxHeight >= 0 &&
+		uint32(*c.MaxHeight) < maxHeight {
+
+		maxHeight = uint32(*c.MaxHeight)
+	}
+
+	// Fetch the confirmed transactions from the database in the desired
+	// order.  Only confirmed transactions are counted by the number to skip
+	// and the number requested, so transactions entering and leaving the
+	// mempool never shift the pages.
+	var confirmedTxns []retrievedTx
+	err = s.server.db.View(func(dbTx database.Tx) error {
+		// The transactions confirmed above the maximum height are the
+		// newest ones, so they need to be skipped in reverse order and
+		// are cut off below otherwise.
+		var numAbove uint32
+		if reverse {
+			var err error
+			numAbove, err = numAddrIndexEntriesAbove(s, dbTx, addr,
+				maxHeight)
 			if err != nil {
 				return err
 			}
-
-			// Load the raw transaction bytes from the database.
-			serializedTxns, err := dbTx.FetchBlockRegions(regions)
+		}
+		regions, _, err := addrIndex.TxRegionsForAddress(dbTx, addr,
+			numAbove+uint32(numToSkip), uint32(numRequested), reverse)
+		if err != nil {
+			return err
+		}
+		for i := range regions {
+			height, err := s.chain.BlockHeightByHash(regions[i].Hash)
 			if err != nil {
 				return err
 			}
-
-			// Add the transaction and the hash of the block it is
-			// contained in to the list.  Note that the transaction
-			// is left serialized here since the caller might have
-			// requested non-verbose output and hence there would be
-			// no point in deserializing it just to reserialize it
-			// later.
-			for i, serializedTx := range serializedTxns {
-				addressTxns = append(addressTxns, retrievedTx{
-					txBytes: serializedTx,
-					blkHash: regions[i].Hash,
-				})
+			if height > maxHeight {
+				regions = regions[:i]
+				break
 			}
-			numSkipped += dbSkipped
+		}
 
-			return nil
-		})
+		// Load the raw transaction bytes from the database.
+		serializedTxns, err := dbTx.FetchBlockRegions(regions)
 		if err != nil {
-			context := "Failed to load address index entries"
-			return nil, internalRPCError(err.Error(), context)
+			return err
+		}
+
+		// Add the transaction and the hash of the block it is
+		// contained in to the list.  Note that the transaction
+		// is left serialized here since the caller might have
+		// requested non-verbose output and hence there would be
+		// no point in deserializing it just to reserialize it
+		// later.
+		confirmedTxns = make([]retrievedTx, 0, len(serializedTxns))
+		for i, serializedTx := range serializedTxns {
+			confirmedTxns = append(confirmedTxns, retrievedTx{
+				txBytes: serializedTx,
+				blkHash: regions[i].Hash,
+			})
 		}
 
+		return nil
+	})
+	if err != nil {
+		context := "Failed to load address index entries"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	// Include the unconfirmed transactions on the page which is adjacent to
+	// the newest confirmed transactions, which is the first page in
+	// reverse order and the first one which is not full otherwise, so they
+	// are returned exactly once while paging through the results.  They
+	// are sorted by hash to keep the output deterministic.
+	//
+	// NOTE: This code doesn't sort by dependency.  This might be something
+	// to do in the future for the client's convenience, or leave it to the
+	// client.
+	var mpTxns []*provautil.Tx
+	if includeMempool && ((reverse && numToSkip == 0) ||
+		(!reverse && len(confirmedTxns) < numRequested)) {
+
+		mpTxns = addrIndex.UnconfirmedTxnsForAddress(addr)
+		sort.Sort(txHashSorter(mpTxns))
 	}
 
-	// Add transactions from mempool last if client did not request reverse
-	// order and the number of results is still under the number requested.
-	if !reverse && len(addressTxns) < numRequested {
-		// Transactions in the mempool are not in a block header yet,
-		// so the block header field in the retieved transaction struct
-		// is left nil.
-		mpTxns, mpSkipped := fetchMempoolTxnsForAddress(s, addr,
-			uint32(numToSkip)-numSkipped, uint32(numRequested-
-				len(addressTxns)))
-		numSkipped += mpSkipped
-		for _, tx := range mpTxns {
-			addressTxns = append(addressTxns, retrievedTx{tx: tx})
-		}
+	// Transactions in the mempool are not in a block header yet, so the
+	// block header field in the retrieved transaction struct is left nil.
+	addressTxns := make([]retrievedTx, 0, len(mpTxns)+len(confirmedTxns))
+	if !reverse {
+		addressTxns = append(addressTxns, confirmedTxns...)
+	}
+	for _, tx := range mpTxns {
+		addressTxns = append(addressTxns, retrievedTx{tx: tx})
+	}
+	if reverse {
+		addressTxns = append(addressTxns, confirmedTxns...)
 	}
 
 	// Address has never been used if neither source yielded any results.
@@ -3093,7 +4747,6 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 	}
 
 	// The verbose flag is set, so generate the JSON object and return it.
-	best := s.chain.BestSnapshot()
 	chainParams := s.server.chainParams
 	srtList := make([]btcjson.SearchRawTransactionsResult, len(addressTxns))
 	for i := range addressTxns {
@@ -3106,7 +4759,8 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 		if rtx.tx == nil {
 			// Deserialize the transaction.
 			mtx = new(wire.MsgTx)
-			err := mtx.Deserialize(bytes.NewReader(rtx.txBytes))
+			err := mtx.BtcDecode(bytes.NewReader(rtx.txBytes),
+				s.server.chainParams.TxEncoding())
 			if err != nil {
 				context := "Failed to deserialize transaction"
 				return nil, internalRPCError(err.Error(),
@@ -3119,8 +4773,8 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 		result := &srtList[i]
 		result.Hex = hexTxns[i]
 		result.Txid = mtx.TxHash().String()
-		result.Vin, err = createVinListPrevOut(s, mtx, chainParams,
-			vinExtra, filterAddrMap)
+		result.Vin, err = createVinListPrevOut(s, mtx, rtx.blkHash,
+			chainParams, vinExtra, filterAddrMap)
 		if err != nil {
 			return nil, err
 		}
@@ -3165,6 +4819,8 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 			result.Blocktime = blkHeader.Timestamp.Unix()
 			result.BlockHash = blkHashStr
 			result.Confirmations = uint64(1 + best.Height - blkHeight)
+		} else {
+			result.Unconfirmed = true
 		}
 	}
 
@@ -3184,7 +4840,8 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 		return nil, rpcDecodeHexError(hexStr)
 	}
 	var msgTx wire.MsgTx
-	err = msgTx.Deserialize(bytes.NewReader(serializedTx))
+	err = msgTx.BtcDecode(bytes.NewReader(serializedTx),
+		s.server.chainParams.TxEncoding())
 	if err != nil {
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCDeserialization,
@@ -3275,18 +4932,18 @@ func handleSetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 
 	// Attempt to establish validate keys from the environment var if there
 	// are none already registered.
-	if len(s.server.cpuMiner.ValidateKeys()) == 0 {
+	if len(s.server.cpuMiner.BlockSigners()) == 0 {
 		s.server.cpuMiner.EstablishValidateKeys()
 	}
 
 	// Respond with an error if there are no validate keys available to
 	// sign the created blocks.
-	if len(s.server.cpuMiner.ValidateKeys()) == 0 {
+	if len(s.server.cpuMiner.BlockSigners()) == 0 {
 		return nil, &btcjson.RPCError{
 			Code: btcjson.ErrRPCInternal.Code,
 			Message: "No validating priv keys specified " +
-				"via --setvalidatekeys or PROVA_VALIDATE_KEYS" +
-				"env variable",
+				"via setvalidatekeys, PROVA_VALIDATE_KEYS " +
+				"env variable, or --blocksignerurl",
 		}
 	}
 
@@ -3321,6 +4978,122 @@ func handleSetValidateKeys(s *rpcServer, cmd interface{}, closeChan <-chan struc
 	return nil, nil
 }
 
+// handleSimulateAdminTx implements the simulateadmintx command.
+func handleSimulateAdminTx(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SimulateAdminTxCmd)
+	if len(c.HexTxs) == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "At least one transaction is required",
+		}
+	}
+
+	// Deserialize the transactions and ensure they are admin transactions.
+	txns := make([]*provautil.Tx, 0, len(c.HexTxs))
+	for _, hexStr := range c.HexTxs {
+		if len(hexStr)%2 != 0 {
+			hexStr = "0" + hexStr
+		}
+		serializedTx, err := hex.DecodeString(hexStr)
+		if err != nil {
+			return nil, rpcDecodeHexError(hexStr)
+		}
+		var msgTx wire.MsgTx
+		err = msgTx.BtcDecode(bytes.NewReader(serializedTx),
+			s.server.chainParams.TxEncoding())
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCDeserialization,
+				Message: "TX decode failed: " + err.Error(),
+			}
+		}
+		tx := provautil.NewTx(&msgTx)
+		if threadInt, _ := txscript.GetAdminDetails(tx); threadInt < 0 {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Transaction %v is not an "+
+					"admin transaction", tx.Hash()),
+			}
+		}
+		txns = append(txns, tx)
+	}
+
+	// Validate the transactions against the current chain state.  A rule
+	// violation is reported in the result along with the admin state
+	// resulting from the transactions before the rejected one.
+	simulation, err := s.chain.SimulateAdminTxs(txns)
+	if err != nil {
+		if _, ok := err.(blockchain.RuleError); !ok {
+			context := "Failed to simulate admin transactions"
+			return nil, internalRPCError(err.Error(), context)
+		}
+	}
+	state := simulation.Next
+	result := &btcjson.SimulateAdminTxResult{
+		Accepted:    err == nil,
+		Applied:     simulation.Accepted,
+		ThreadTips:  threadTipResults(state.ThreadTips),
+		TotalSupply: state.TotalSupply,
+		SupplyDelta: int64(state.TotalSupply) -
+			int64(simulation.Prev.TotalSupply),
+		LastKeyID:     uint32(state.LastKeyID),
+		RootKeys:      state.KeySets[btcec.RootKeySet].ToStringArray(),
+		ProvisionKeys: state.KeySets[btcec.ProvisionKeySet].ToStringArray(),
+		IssueKeys:     state.KeySets[btcec.IssueKeySet].ToStringArray(),
+		ValidateKeys:  state.KeySets[btcec.ValidateKeySet].ToStringArray(),
+		ASPKeys:       aspKeyIdResults(state.KeyIDs),
+	}
+	if rerr, ok := err.(blockchain.RuleError); ok {
+		result.RejectedTxID = txns[simulation.Accepted].Hash().String()
+		result.RejectCode = rerr.ErrorCode.String()
+		result.RejectReason = rerr.Description
+	}
+	return result, nil
+}
+
+// handleStartJob implements the startjob command.
+func handleStartJob(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.StartJobCmd)
+
+	newJob, ok := rpcJobHandlers[c.Method]
+	if !ok {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Command can't be run as a job: " + c.Method,
+		}
+	}
+
+	// Parse the parameters of the command the same way they are parsed
+	// for requests, so invalid parameters are reported before the job is
+	// started.
+	var params []interface{}
+	if c.Params != nil {
+		params = *c.Params
+	}
+	request, err := btcjson.NewRequest(nil, c.Method, params)
+	if err != nil {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidParams.Code,
+			err.Error())
+	}
+	parsedCmd := parseCmd(request)
+	if parsedCmd.err != nil {
+		return nil, parsedCmd.err
+	}
+	run, err := newJob(s, parsedCmd.cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := s.jobs.start(c.Method, run)
+	if err != nil {
+		if rpcErr, ok := err.(*btcjson.RPCError); ok {
+			return nil, rpcErr
+		}
+		return nil, internalRPCError(err.Error(), "Failed to start job")
+	}
+	return job.id, nil
+}
+
 // handleStop implements the stop command.
 func handleStop(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	select {
@@ -3344,7 +5117,8 @@ func handleSubmitBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		return nil, rpcDecodeHexError(hexStr)
 	}
 
-	block, err := provautil.NewBlockFromBytes(serializedBlock)
+	block, err := provautil.NewBlockFromBytesEncoding(serializedBlock,
+		s.server.chainParams.TxEncoding())
 	if err != nil {
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCDeserialization,
@@ -3352,11 +5126,31 @@ func handleSubmitBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		}
 	}
 
-	_, err = s.server.blockManager.ProcessBlock(block, blockchain.BFNone)
+	status, _, err := s.server.blockManager.ProcessBlock(block,
+		blockchain.BFNone)
 	if err != nil {
+		// Only report the block as rejected when it is actually invalid.
+		// Any other failure is local to this node.
+		if _, ok := err.(blockchain.RuleError); !ok {
+			rpcsLog.Errorf("Failed to process submitted block %v: %v",
+				block.Hash(), err)
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCDatabase,
+				Message: "Failed to process block: " + err.Error(),
+			}
+		}
 		return fmt.Sprintf("rejected: %s", err.Error()), nil
 	}
 
+	// Submitting a block which is already known succeeds just like the
+	// first submission did, so retried submissions are not treated as
+	// failures.
+	if status.IsDuplicate() {
+		rpcsLog.Debugf("Block %s submitted via submitblock is already "+
+			"known (%v)", block.Hash(), status)
+		return nil, nil
+	}
+
 	rpcsLog.Infof("Accepted block %s via submitblock", block.Hash())
 	return nil, nil
 }
@@ -3378,16 +5172,28 @@ func handleValidateAddress(s *rpcServer, cmd interface{}, closeChan <-chan struc
 	return result, nil
 }
 
-func verifyChain(s *rpcServer, level int32, depth uint32) error {
+// verifyChain verifies the most recent depth blocks of the main chain at the
+// passed check level, reporting its progress through the passed job, which may
+// be nil.  Verification stops with the error of the passed context when it is
+// cancelled.
+func verifyChain(ctx context.Context, s *rpcServer, level int32, depth uint32, job *rpcJob) error {
 	best := s.chain.BestSnapshot()
 	finishHeight := best.Height - depth
 	if finishHeight < 0 {
 		finishHeight = 0
 	}
-	rpcsLog.Infof("Verifying chain for %d blocks at level %d",
-		best.Height-finishHeight, level)
+	numBlocks := best.Height - finishHeight
+	rpcsLog.Infof("Verifying chain for %d blocks at level %d", numBlocks,
+		level)
 
 	for height := best.Height; height > finishHeight; height-- {
+		// Stop verifying once the client that requested it is gone.
+		if err := ctx.Err(); err != nil {
+			rpcsLog.Infof("Chain verify aborted at height %d: %v",
+				height, err)
+			return err
+		}
+
 		// Level 0 just looks up the block.
 		block, err := s.chain.BlockByHeight(height)
 		if err != nil {
@@ -3399,7 +5205,7 @@ func verifyChain(s *rpcServer, level int32, depth uint32) error {
 		// Level 1 does basic chain sanity checks.
 		if level > 0 {
 			err := blockchain.CheckBlockSanity(block,
-				activeNetParams.PowLimit, s.server.timeSource)
+				activeNetParams.Params, s.server.timeSource)
 			if err != nil {
 				rpcsLog.Errorf("Verify is unable to validate "+
 					"block at hash %v height %d: %v",
@@ -3407,6 +5213,8 @@ func verifyChain(s *rpcServer, level int32, depth uint32) error {
 				return err
 			}
 		}
+
+		job.report(float64(best.Height-height+1)/float64(numBlocks), nil)
 	}
 	rpcsLog.Infof("Chain verify completed successfully")
 
@@ -3415,6 +5223,20 @@ func verifyChain(s *rpcServer, level int32, depth uint32) error {
 
 // handleVerifyChain implements the verifychain command.
 func handleVerifyChain(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	run, err := newVerifyChainJob(s, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := closeChanContext(closeChan)
+	defer cancel()
+	return run(ctx, nil)
+}
+
+// newVerifyChainJob returns the function which runs the passed verifychain
+// command, either synchronously or as a job.  The result is whether the chain
+// verified successfully.
+func newVerifyChainJob(s *rpcServer, cmd interface{}) (rpcJobFunc, error) {
 	c := cmd.(*btcjson.VerifyChainCmd)
 
 	var checkLevel, checkDepth int32
@@ -3425,8 +5247,13 @@ func handleVerifyChain(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		checkDepth = *c.CheckDepth
 	}
 
-	err := verifyChain(s, checkLevel, uint32(checkDepth))
-	return err == nil, nil
+	return func(ctx context.Context, job *rpcJob) (interface{}, error) {
+		err := verifyChain(ctx, s, checkLevel, uint32(checkDepth), job)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return err == nil, nil
+	}, nil
 }
 
 // rpcServer holds the items the rpc server may need to access (config,
@@ -3447,6 +5274,10 @@ type rpcServer struct {
 	listeners              []net.Listener
 	gbtWorkState           *gbtWorkState
 	helpCacher             *helpCacher
+	stats                  *rpcStats
+	requestLimiter         *rpcRequestLimiter
+	requestTimeout         time.Duration
+	jobs                   *rpcJobManager
 	requestProcessShutdown chan struct{}
 	quit                   chan int
 }
@@ -3522,6 +5353,7 @@ func (s *rpcServer) Stop() error {
 	}
 	s.ntfnMgr.Shutdown()
 	s.ntfnMgr.WaitForShutdown()
+	s.jobs.stop()
 	close(s.quit)
 	s.wg.Wait()
 	rpcsLog.Infof("RPC server shutdown complete")
@@ -3618,15 +5450,43 @@ func (s *rpcServer) checkAuth(r *http.Request, require bool) (bool, bool, error)
 type parsedRPCCmd struct {
 	id     interface{}
 	method string
+	params []json.RawMessage
 	cmd    interface{}
 	err    *btcjson.RPCError
 }
 
+// closeChanContext returns a context that is cancelled once the passed close
+// channel is closed, which happens when the client that issued a request
+// disconnects.  This allows long running chain operations to be aborted when
+// nobody is waiting for their result anymore.  A nil close channel results in
+// a context which is only cancelled by the returned cancel function, which
+// must be called once the request is complete.
+func closeChanContext(closeChan <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if closeChan != nil {
+		go func() {
+			select {
+			case <-closeChan:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, cancel
+}
+
 // standardCmdResult checks that a parsed command is a standard Bitcoin JSON-RPC
 // command and runs the appropriate handler to reply to the command.  Any
 // commands which are not recognized or not implemented will return an error
-// suitable for use in replies.
+// suitable for use in replies.  Commands which would modify the chain return an
+// error when the server is running in read-only mode.
 func (s *rpcServer) standardCmdResult(cmd *parsedRPCCmd, closeChan <-chan struct{}) (interface{}, error) {
+	if s.server.readOnly {
+		if _, ok := rpcReadOnlyDisabled[cmd.method]; ok {
+			return nil, ErrRPCReadOnly
+		}
+	}
+
 	handler, ok := rpcHandlers[cmd.method]
 	if ok {
 		goto handled
@@ -3647,6 +5507,19 @@ handled:
 	return handler(s, cmd.cmd, closeChan)
 }
 
+// timedCmdResult executes the passed parsed command by invoking the passed
+// function and records the time it took along with the error it failed with,
+// if any, in the RPC statistics.
+func (s *rpcServer) timedCmdResult(cmd *parsedRPCCmd, run func() (interface{}, error)) (interface{}, error) {
+	if s.stats == nil {
+		return run()
+	}
+	started := time.Now()
+	result, err := run()
+	s.stats.Record(cmd.method, cmd.params, started, time.Since(started), err)
+	return result, err
+}
+
 // parseCmd parses a JSON-RPC request object into known concrete command.  The
 // err field of the returned parsedRPCCmd struct will contain an RPC error that
 // is suitable for use in replies if the command is invalid in some way such as
@@ -3655,6 +5528,7 @@ func parseCmd(request *btcjson.Request) *parsedRPCCmd {
 	var parsedCmd parsedRPCCmd
 	parsedCmd.id = request.ID
 	parsedCmd.method = request.Method
+	parsedCmd.params = request.Params
 
 	cmd, err := btcjson.UnmarshalCmd(request)
 	if err != nil {
@@ -3694,14 +5568,48 @@ func createMarshalledReply(id, result interface{}, replyErr error) ([]byte, erro
 	return btcjson.MarshalResponse(id, result, jsonErr)
 }
 
+// writeErrorReply writes a JSON-RPC reply with the passed error to the caller
+// along with the passed HTTP status code.  It is used to reject requests before
+// the connection is hijacked.
+func writeErrorReply(w http.ResponseWriter, code int, jsonErr *btcjson.RPCError) {
+	msg, err := createMarshalledReply(nil, nil, jsonErr)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal reply: %v", err)
+		return
+	}
+	w.WriteHeader(code)
+	w.Write(msg)
+	w.Write([]byte{'\n'})
+}
+
 // jsonRPCRead handles reading and responding to RPC messages.
 func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin bool) {
 	if atomic.LoadInt32(&s.shutdown) != 0 {
 		return
 	}
 
-	// Read and close the JSON-RPC request body from the caller.
-	body, err := ioutil.ReadAll(r.Body)
+	// Limit the number of requests serviced at once, both in total and
+	// for each client, before the body is read so rejected requests don't
+	// use any memory.  The slot is freed once any handler which is still
+	// running after the request timed out returns.
+	client := rpcClientHost(r.RemoteAddr)
+	if !s.requestLimiter.acquire(client) {
+		rpcsLog.Debugf("Too many concurrent RPC requests - rejecting "+
+			"request from %s", r.RemoteAddr)
+		writeErrorReply(w, http.StatusTooManyRequests,
+			ErrRPCTooManyRequests)
+		return
+	}
+	defer s.requestLimiter.release(client)
+	var handlerWg sync.WaitGroup
+	defer handlerWg.Wait()
+
+	// Read and close the JSON-RPC request body from the caller.  The class
+	// of the request, which determines the maximum size of its body, isn't
+	// known until the body is parsed, so the body may be up to the largest
+	// size allowed for any class until then.
+	maxBodySize := maxRPCBodySize()
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
 	r.Body.Close()
 	if err != nil {
 		errCode := http.StatusBadRequest
@@ -3709,6 +5617,15 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 			errCode, err), errCode)
 		return
 	}
+	if int64(len(body)) > maxBodySize {
+		writeErrorReply(w, http.StatusRequestEntityTooLarge,
+			&btcjson.RPCError{
+				Code: btcjson.ErrRPCRequestTooLarge,
+				Message: fmt.Sprintf("Request exceeds the limit "+
+					"of %d bytes", maxBodySize),
+			})
+		return
+	}
 
 	// Unfortunately, the http server doesn't provide the ability to
 	// change the read deadline for the new connection and having one breaks
@@ -3740,6 +5657,7 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 	var jsonErr error
 	var result interface{}
 	var request btcjson.Request
+	status := http.StatusOK
 	if err := json.Unmarshal(body, &request); err != nil {
 		jsonErr = &btcjson.RPCError{
 			Code:    btcjson.ErrRPCParse.Code,
@@ -3773,6 +5691,14 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 		// set it for the response.
 		responseID = request.ID
 
+		// Reject requests whose body exceeds the maximum size for the
+		// class of their method.
+		class := rpcMethodClass(request.Method)
+		if int64(len(body)) > class.maxBodySize() {
+			jsonErr = rpcRequestTooLargeError(class, len(body))
+			status = http.StatusRequestEntityTooLarge
+		}
+
 		// Setup a close notifier.  Since the connection is hijacked,
 		// the CloseNotifer on the ResponseWriter is not available.
 		closeChan := make(chan struct{}, 1)
@@ -3784,7 +5710,7 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 		}()
 
 		// Check if the user is limited and set error if method unauthorized
-		if !isAdmin {
+		if jsonErr == nil && !isAdmin {
 			if _, ok := rpcLimited[request.Method]; !ok {
 				jsonErr = &btcjson.RPCError{
 					Code:    btcjson.ErrRPCInvalidParams.Code,
@@ -3800,7 +5726,11 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 			if parsedCmd.err != nil {
 				jsonErr = parsedCmd.err
 			} else {
-				result, jsonErr = s.standardCmdResult(parsedCmd, closeChan)
+				result, jsonErr = s.timedCmdResult(parsedCmd,
+					func() (interface{}, error) {
+						return s.timeoutCmdResult(parsedCmd,
+							closeChan, &handlerWg)
+					})
 			}
 		}
 	}
@@ -3813,7 +5743,7 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 	}
 
 	// Write the response.
-	err = s.writeHTTPResponseHeaders(r, w.Header(), http.StatusOK, buf)
+	err = s.writeHTTPResponseHeaders(r, w.Header(), status, buf)
 	if err != nil {
 		rpcsLog.Error(err)
 		return
@@ -3834,6 +5764,44 @@ func jsonAuthFail(w http.ResponseWriter) {
 	http.Error(w, "401 Unauthorized.", http.StatusUnauthorized)
 }
 
+// handleWebsocketRequest authenticates a websocket client and upgrades its
+// connection.  Clients which present a websocket token are limited to its
+// scope, while the others authenticate with the RPC credentials either in the
+// request or once connected.
+func (s *rpcServer) handleWebsocketRequest(w http.ResponseWriter, r *http.Request) {
+	var authenticated, isAdmin bool
+	var token *wsToken
+	if secret, ok := wsTokenFromRequest(r); ok {
+		token = s.server.wsTokens.Authenticate(secret)
+		if token == nil {
+			rpcsLog.Warnf("Websocket token authentication failure "+
+				"from %s", r.RemoteAddr)
+			jsonAuthFail(w)
+			return
+		}
+		authenticated = true
+	} else {
+		var err error
+		authenticated, isAdmin, err = s.checkAuth(r, false)
+		if err != nil {
+			jsonAuthFail(w)
+			return
+		}
+	}
+
+	// Attempt to upgrade the connection to a websocket connection using
+	// the default size for read/write buffers.
+	ws, err := websocket.Upgrade(w, r, nil, 0, 0)
+	if err != nil {
+		if _, ok := err.(websocket.HandshakeError); !ok {
+			rpcsLog.Errorf("Unexpected websocket error: %v", err)
+		}
+		http.Error(w, "400 Bad Request.", http.StatusBadRequest)
+		return
+	}
+	s.WebsocketHandler(ws, r.RemoteAddr, authenticated, isAdmin, token)
+}
+
 // Start is used by server.go to start the rpc listener.
 func (s *rpcServer) Start() {
 	if atomic.AddInt32(&s.started, 1) != 1 {
@@ -3873,25 +5841,66 @@ func (s *rpcServer) Start() {
 	})
 
 	// Websocket endpoint.
-	rpcServeMux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		authenticated, isAdmin, err := s.checkAuth(r, false)
-		if err != nil {
+	rpcServeMux.HandleFunc("/ws", s.handleWebsocketRequest)
+
+	// Metrics endpoint.
+	rpcServeMux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		_, isAdmin, err := s.checkAuth(r, true)
+		if err != nil || !isAdmin {
 			jsonAuthFail(w)
 			return
 		}
 
-		// Attempt to upgrade the connection to a websocket connection
-		// using the default size for read/write buffers.
-		ws, err := websocket.Upgrade(w, r, nil, 0, 0)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := s.stats.WriteMetrics(w); err != nil {
+			rpcsLog.Errorf("Failed to write RPC metrics: %v", err)
+		}
+		info, err := blockProductionInfo(s.chain, s.server.chainParams,
+			defaultBlockProductionWindow)
 		if err != nil {
-			if _, ok := err.(websocket.HandshakeError); !ok {
-				rpcsLog.Errorf("Unexpected websocket error: %v",
-					err)
+			rpcsLog.Errorf("Failed to compute block production "+
+				"statistics: %v", err)
+		} else if err := writeBlockProductionMetrics(w, info); err != nil {
+			rpcsLog.Errorf("Failed to write block production "+
+				"metrics: %v", err)
+		}
+		if s.server.rejectStats != nil {
+			if err := s.server.rejectStats.WriteMetrics(w); err != nil {
+				rpcsLog.Errorf("Failed to write reject "+
+					"metrics: %v", err)
+			}
+		}
+		if stats := s.server.blockManager.errorStats; stats != nil {
+			if err := writeErrorStatsMetrics(w, stats); err != nil {
+				rpcsLog.Errorf("Failed to write error stats "+
+					"metrics: %v", err)
+			}
+		}
+		err = writeValidationCacheMetrics(w,
+			s.chain.ValidationCacheStats())
+		if err != nil {
+			rpcsLog.Errorf("Failed to write validation cache "+
+				"metrics: %v", err)
+		}
+		if s.server.relayLatency != nil {
+			if err := s.server.relayLatency.WriteMetrics(w); err != nil {
+				rpcsLog.Errorf("Failed to write relay latency "+
+					"metrics: %v", err)
+			}
+		}
+		if s.server.eventLog != nil {
+			err := writePeerMessageMetrics(w, s.server.eventLog)
+			if err != nil {
+				rpcsLog.Errorf("Failed to write peer message "+
+					"metrics: %v", err)
+			}
+		}
+		if m := s.server.blockManager.chainSplit; m != nil {
+			if err := m.WriteMetrics(w); err != nil {
+				rpcsLog.Errorf("Failed to write chain split "+
+					"metrics: %v", err)
 			}
-			http.Error(w, "400 Bad Request.", http.StatusBadRequest)
-			return
 		}
-		s.WebsocketHandler(ws, r.RemoteAddr, authenticated, isAdmin)
 	})
 
 	for _, listener := range s.listeners {
@@ -3940,6 +5949,10 @@ func newRPCServer(listenAddrs []string, generator *mining.BlkTmplGenerator, s *s
 		statusLines:            make(map[int]string),
 		gbtWorkState:           newGbtWorkState(s.timeSource),
 		helpCacher:             newHelpCacher(),
+		stats:                  newRPCStats(cfg.RPCSlowThreshold),
+		requestLimiter:         newRPCRequestLimiter(cfg.RPCMaxRequests, cfg.RPCMaxClientRequests),
+		requestTimeout:         cfg.RPCRequestTimeout,
+		jobs:                   newRPCJobManager(cfg.RPCJobTTL),
 		requestProcessShutdown: make(chan struct{}),
 		quit: make(chan int),
 	}
@@ -0,0 +1,2272 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/adminstate"
+	"github.com/bitgo/prova/blockchain/indexers"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	_ "github.com/bitgo/prova/database/ffldb"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/mining"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// emptyTxSource is a mining.TxSource without any transactions.
+type emptyTxSource struct{}
+
+// LastUpdated returns the zero time since the source never changes.  It is
+// part of the mining.TxSource interface implementation.
+func (emptyTxSource) LastUpdated() time.Time {
+	return time.Time{}
+}
+
+// MiningDescs returns no transactions.  It is part of the mining.TxSource
+// interface implementation.
+func (emptyTxSource) MiningDescs() []*mining.TxDesc {
+	return nil
+}
+
+// HaveTransaction returns false since the source has no transactions.  It is
+// part of the mining.TxSource interface implementation.
+func (emptyTxSource) HaveTransaction(hash *chainhash.Hash) bool {
+	return false
+}
+
+// testRPCHarness houses an RPC server backed by a fresh regression test chain
+// along with a block template generator which signs the blocks it generates.
+type testRPCHarness struct {
+	rpcServer *rpcServer
+	db        database.DB
+	dbPath    string
+	chain     *blockchain.BlockChain
+	generator *mining.BlkTmplGenerator
+	payAddr   provautil.Address
+	signer    mining.BlockSigner
+	teardown  func()
+
+	// newGenerator returns a block template generator for the passed chain
+	// which obtains commitments from the provider of the harness.
+	newGenerator func(chain *blockchain.BlockChain) *mining.BlkTmplGenerator
+}
+
+// newTestRPCHarness returns a test harness whose block template generator
+// obtains commitments from the passed provider.
+func newTestRPCHarness(t *testing.T, provider mining.CommitmentProvider) *testRPCHarness {
+	params := chaincfg.RegressionNetParams
+	tmpDir, err := ioutil.TempDir("", "rpcserver")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	dbPath := filepath.Join(tmpDir, "ffldb")
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatalf("unable to create db: %v", err)
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(tmpDir)
+	}
+
+	timeSource := blockchain.NewMedianTime()
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  timeSource,
+	})
+	if err != nil {
+		teardown()
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	s := &server{
+		chainParams: &params,
+		db:          db,
+		timeSource:  timeSource,
+	}
+	s.blockScrubber = newBlockScrubber(db, chain, 0, time.Second, nil)
+
+	policy := mining.Policy{
+		BlockMaxSize:      defaultBlockMaxSize,
+		BlockPrioritySize: 50000,
+	}
+	newGenerator := func(chain *blockchain.BlockChain) *mining.BlkTmplGenerator {
+		return mining.NewBlkTmplGenerator(&policy, &params,
+			emptyTxSource{}, chain, timeSource, nil, nil, provider)
+	}
+
+	// Sign the blocks with one of the regression test network validate
+	// keys.
+	keyBytes, _ := hex.DecodeString("4015289a228658047520f0d0abe7ad49abc" +
+		"77f6be0be63b36b94b83c2d1fd977")
+	validateKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
+	payAddr, err := provautil.NewAddressProva(make([]byte, 20),
+		[]btcec.KeyID{1, 2}, &params)
+	if err != nil {
+		teardown()
+		t.Fatalf("unable to create address: %v", err)
+	}
+
+	return &testRPCHarness{
+		rpcServer: &rpcServer{server: s, chain: chain},
+		db:        db,
+		dbPath:    dbPath,
+		chain:     chain,
+		generator: newGenerator(chain),
+		payAddr:   payAddr,
+		signer:    mining.NewLocalSigner(validateKey),
+		teardown:  teardown,
+
+		newGenerator: newGenerator,
+	}
+}
+
+// enableIndexes enables a transaction and an address index which start out
+// behind the main chain and replaces the chain of the harness with one which
+// maintains them.
+func (h *testRPCHarness) enableIndexes(t *testing.T) {
+	s := h.rpcServer.server
+	s.txIndex = indexers.NewTxIndex(h.db)
+	s.addrIndex = indexers.NewAddrIndex(h.db, s.chainParams)
+	s.indexManager = indexers.NewManager(h.db, []indexers.Indexer{
+		s.txIndex, s.addrIndex})
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:           h.db,
+		ChainParams:  s.chainParams,
+		TimeSource:   s.timeSource,
+		IndexManager: s.indexManager,
+	})
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	h.chain = chain
+	h.rpcServer.chain = chain
+	h.generator = h.newGenerator(chain)
+}
+
+// syncIndexes starts the index manager of the harness and waits until all of
+// the indexes have caught up to the main chain.
+func (h *testRPCHarness) syncIndexes(t *testing.T) {
+	s := h.rpcServer.server
+	s.indexManager.Start()
+	deadline := time.Now().Add(time.Second * 10)
+	for _, indexer := range []indexers.Indexer{s.txIndex, s.addrIndex} {
+		for !s.indexManager.IsSynced(indexer) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for the %s to sync",
+					indexer.Name())
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+}
+
+// generateBlock generates a block template and solves it without processing
+// the resulting block.
+func (h *testRPCHarness) generateBlock(t *testing.T) *wire.MsgBlock {
+	template, err := h.generator.NewBlockTemplate(h.payAddr, h.signer)
+	if err != nil {
+		t.Fatalf("NewBlockTemplate: unexpected error: %v", err)
+	}
+	msgBlock := template.Block
+	solveBlock(msgBlock)
+	return msgBlock
+}
+
+// solveBlock solves the passed block by finding a nonce which satisfies its
+// target difficulty.
+func solveBlock(msgBlock *wire.MsgBlock) {
+	target := blockchain.CompactToBig(msgBlock.Header.Bits)
+	for nonce := uint64(1); ; nonce++ {
+		msgBlock.Header.Nonce = nonce
+		hash := msgBlock.Header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			return
+		}
+	}
+}
+
+// mineBlock generates a block and processes it as the new tip of the chain.
+func (h *testRPCHarness) mineBlock(t *testing.T) *chainhash.Hash {
+	block := provautil.NewBlock(h.generateBlock(t))
+	isMainChain, _, err := h.chain.ProcessBlock(block, blockchain.BFNone)
+	if err != nil || !isMainChain {
+		t.Fatalf("ProcessBlock: got main chain %v, err %v", isMainChain,
+			err)
+	}
+	return block.Hash()
+}
+
+// mineBlockToPayAddr mines a block whose coinbase pays to the pay address of
+// the harness and processes it as the new tip of the chain.  The block template
+// generator replaces the coinbase payment with a null data output since there
+// is no subsidy on the regression test network.
+func (h *testRPCHarness) mineBlockToPayAddr(t *testing.T) *chainhash.Hash {
+	pkScript, err := txscript.PayToAddrScript(h.payAddr)
+	if err != nil {
+		t.Fatalf("unable to create pkScript: %v", err)
+	}
+	msgBlock := h.generateBlock(t)
+	msgBlock.Transactions[0].TxOut[0].PkScript = pkScript
+	return h.processModifiedBlock(t, msgBlock)
+}
+
+// mineBlockWithTxs mines a block which includes the passed transactions after
+// the coinbase and processes it as the new tip of the chain.
+func (h *testRPCHarness) mineBlockWithTxs(t *testing.T, txns []*wire.MsgTx) *chainhash.Hash {
+	msgBlock := h.generateBlock(t)
+	msgBlock.Transactions = append(msgBlock.Transactions, txns...)
+	return h.processModifiedBlock(t, msgBlock)
+}
+
+// finishModifiedBlock updates the merkle root, size and signature of the
+// passed generated block after its header or transactions were modified, and
+// solves it.
+func (h *testRPCHarness) finishModifiedBlock(t *testing.T, msgBlock *wire.MsgBlock) {
+	merkles := blockchain.BuildMerkleTreeStore(
+		provautil.NewBlock(msgBlock).Transactions())
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+	msgBlock.Header.Size = uint32(msgBlock.SerializeSize())
+	err := msgBlock.Header.SignWith(h.signer.PubKey(), h.signer.SignHeader)
+	if err != nil {
+		t.Fatalf("unable to sign block: %v", err)
+	}
+	solveBlock(msgBlock)
+}
+
+// processModifiedBlock finishes the passed generated block after its
+// transactions were modified and processes it as the new tip of the chain.
+func (h *testRPCHarness) processModifiedBlock(t *testing.T, msgBlock *wire.MsgBlock) *chainhash.Hash {
+	h.finishModifiedBlock(t, msgBlock)
+	block := provautil.NewBlock(msgBlock)
+	isMainChain, _, err := h.chain.ProcessBlock(block, blockchain.BFNone)
+	if err != nil || !isMainChain {
+		t.Fatalf("ProcessBlock: got main chain %v, err %v", isMainChain,
+			err)
+	}
+	return block.Hash()
+}
+
+// processSideBlock finishes the passed generated block after it was modified
+// and processes it, ensuring it does not become the new tip of the chain.
+func (h *testRPCHarness) processSideBlock(t *testing.T, msgBlock *wire.MsgBlock) *chainhash.Hash {
+	h.finishModifiedBlock(t, msgBlock)
+	block := provautil.NewBlock(msgBlock)
+	isMainChain, _, err := h.chain.ProcessBlock(block, blockchain.BFNone)
+	if err != nil || isMainChain {
+		t.Fatalf("ProcessBlock: got main chain %v, err %v", isMainChain,
+			err)
+	}
+	return block.Hash()
+}
+
+// TestGetBlockCommitment ensures a commitment supplied by the commitment
+// provider of the block template generator is anchored in the generated
+// block, survives block processing, and is returned by the getblockcommitment
+// RPC.
+func TestGetBlockCommitment(t *testing.T) {
+	// Generate templates which commit to the current commitment, if any.
+	var commitment []byte
+	var providerHeight uint32
+	provider := func(prevHash *chainhash.Hash, height uint32) ([]byte, error) {
+		providerHeight = height
+		return commitment, nil
+	}
+	h := newTestRPCHarness(t, provider)
+	defer h.teardown()
+
+	// getCommitment returns the getblockcommitment result for the passed
+	// block hash.
+	getCommitment := func(hash string) (*btcjson.GetBlockCommitmentResult, error) {
+		cmd := btcjson.NewGetBlockCommitmentCmd(hash)
+		result, err := handleGetBlockCommitment(h.rpcServer, cmd, nil)
+		if err != nil {
+			return nil, err
+		}
+		return result.(*btcjson.GetBlockCommitmentResult), nil
+	}
+
+	// Mine a block which commits to a state root.
+	commitment = bytes.Repeat([]byte{0xab}, txscript.BlockCommitmentSize)
+	hash := h.mineBlock(t)
+	if providerHeight != 1 {
+		t.Fatalf("provider invoked for height %d, want 1",
+			providerHeight)
+	}
+	result, err := getCommitment(hash.String())
+	if err != nil {
+		t.Fatalf("getblockcommitment: unexpected error: %v", err)
+	}
+	if result.Height != 1 || result.Hash != hash.String() {
+		t.Fatalf("getblockcommitment: got block %s (%d), want %v (1)",
+			result.Hash, result.Height, hash)
+	}
+	if result.Commitment != hex.EncodeToString(commitment) {
+		t.Fatalf("getblockcommitment: got commitment %q, want %x",
+			result.Commitment, commitment)
+	}
+
+	// Mine a block which does not commit to anything.
+	commitment = nil
+	hash = h.mineBlock(t)
+	result, err = getCommitment(hash.String())
+	if err != nil {
+		t.Fatalf("getblockcommitment: unexpected error: %v", err)
+	}
+	if result.Height != 2 || result.Commitment != "" {
+		t.Fatalf("getblockcommitment: got height %d, commitment %q, "+
+			"want 2 and no commitment", result.Height,
+			result.Commitment)
+	}
+
+	// Commitments of the wrong size are rejected by the generator.
+	commitment = []byte{0x01}
+	_, err = h.generator.NewBlockTemplate(h.payAddr, h.signer)
+	if err == nil {
+		t.Fatalf("NewBlockTemplate: accepted invalid commitment")
+	}
+
+	// Unknown blocks are reported as such.
+	_, err = getCommitment(chainhash.Hash{}.String())
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCBlockNotFound {
+
+		t.Fatalf("getblockcommitment: got error %v, want block not "+
+			"found", err)
+	}
+}
+
+// TestDecodeBlock ensures the decodeblock RPC decodes and sanity checks blocks
+// and, in strict mode, detects blocks which are not canonically encoded.
+func TestDecodeBlock(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+
+	// decodeBlock returns the decodeblock result for the passed serialized
+	// block.
+	decodeBlock := func(serialized []byte, strict bool) (*btcjson.DecodeBlockResult, error) {
+		cmd := btcjson.NewDecodeBlockCmd(hex.EncodeToString(serialized),
+			&strict)
+		result, err := handleDecodeBlock(h.rpcServer, cmd, nil)
+		if err != nil {
+			return nil, err
+		}
+		return result.(*btcjson.DecodeBlockResult), nil
+	}
+
+	// Use a freshly generated block as the canonical fixture.
+	msgBlock := h.generateBlock(t)
+	var buf bytes.Buffer
+	if err := msgBlock.Serialize(&buf); err != nil {
+		t.Fatalf("unable to serialize block: %v", err)
+	}
+	canonical := append([]byte{}, buf.Bytes()...)
+
+	// The canonical fixture decodes, is sane, and is canonically encoded.
+	result, err := decodeBlock(canonical, true)
+	if err != nil {
+		t.Fatalf("decodeblock: unexpected error: %v", err)
+	}
+	if result.Block.Hash != msgBlock.BlockHash().String() ||
+		result.Block.Height != 1 ||
+		len(result.Block.RawTx) != len(msgBlock.Transactions) {
+
+		t.Fatalf("decodeblock: got block %s (%d) with %d transactions, "+
+			"want %v (1) with %d", result.Block.Hash,
+			result.Block.Height, len(result.Block.RawTx),
+			msgBlock.BlockHash(), len(msgBlock.Transactions))
+	}
+	if !result.Sane || result.SanityError != "" {
+		t.Fatalf("decodeblock: block not sane: %s", result.SanityError)
+	}
+	if result.Canonical == nil || !*result.Canonical {
+		t.Fatalf("decodeblock: block not canonical: %s",
+			result.CanonicalError)
+	}
+
+	// The canonical encoding is not checked without the strict flag.
+	result, err = decodeBlock(canonical, false)
+	if err != nil {
+		t.Fatalf("decodeblock: unexpected error: %v", err)
+	}
+	if result.Canonical != nil {
+		t.Fatalf("decodeblock: canonical encoding checked without " +
+			"strict flag")
+	}
+
+	// The non-canonical fixture carries trailing data after the block,
+	// which decodes fine but is only detected in strict mode.
+	nonCanonical := append(append([]byte{}, canonical...), 0x00, 0x00)
+	result, err = decodeBlock(nonCanonical, false)
+	if err != nil {
+		t.Fatalf("decodeblock: unexpected error: %v", err)
+	}
+	if !result.Sane || result.Canonical != nil {
+		t.Fatalf("decodeblock: got sane %v, canonical %v, want sane "+
+			"and unchecked", result.Sane, result.Canonical)
+	}
+	result, err = decodeBlock(nonCanonical, true)
+	if err != nil {
+		t.Fatalf("decodeblock: unexpected error: %v", err)
+	}
+	if result.Canonical == nil || *result.Canonical ||
+		result.CanonicalError == "" {
+
+		t.Fatalf("decodeblock: non-canonical block not detected")
+	}
+
+	// Blocks which fail the sanity checks are still decoded.
+	insane := *msgBlock
+	insane.Header.MerkleRoot = chainhash.Hash{}
+	buf.Reset()
+	if err := insane.Serialize(&buf); err != nil {
+		t.Fatalf("unable to serialize block: %v", err)
+	}
+	result, err = decodeBlock(buf.Bytes(), false)
+	if err != nil {
+		t.Fatalf("decodeblock: unexpected error: %v", err)
+	}
+	if result.Sane || result.SanityError == "" {
+		t.Fatalf("decodeblock: block with bad merkle root is sane")
+	}
+
+	// Truncated blocks fail to decode.
+	_, err = decodeBlock(canonical[:len(canonical)-1], true)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCDeserialization {
+
+		t.Fatalf("decodeblock: got error %v, want deserialization "+
+			"error", err)
+	}
+}
+
+// TestBlockTemplateSigner ensures block templates are only created for block
+// signers whose public key is one of the current validate keys.
+func TestBlockTemplateSigner(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+
+	// Templates are signed by signers holding a validate key.
+	template, err := h.generator.NewBlockTemplate(h.payAddr, h.signer)
+	if err != nil {
+		t.Fatalf("NewBlockTemplate: unexpected error: %v", err)
+	}
+	if !template.Block.Header.Verify(h.signer.PubKey()) {
+		t.Fatalf("NewBlockTemplate: signature does not verify")
+	}
+
+	// Signers holding any other key are refused.
+	otherKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to create key: %v", err)
+	}
+	signer := mining.NewLocalSigner(otherKey)
+	_, err = h.generator.NewBlockTemplate(h.payAddr, signer)
+	if _, ok := err.(mining.SignError); !ok {
+		t.Fatalf("NewBlockTemplate: got error %v, want SignError", err)
+	}
+}
+
+// TestGetChainParams ensures the getchainparams result matches the JSON
+// encoding of the active network parameters and can be loaded back into them.
+func TestGetChainParams(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+
+	result, err := handleGetChainParams(h.rpcServer,
+		btcjson.NewGetChainParamsCmd(), nil)
+	if err != nil {
+		t.Fatalf("handleGetChainParams: unexpected error: %v", err)
+	}
+	got, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("unable to marshal result: %v", err)
+	}
+	params := h.rpcServer.server.chainParams
+	want, err := json.Marshal(params)
+	if err != nil {
+		t.Fatalf("unable to marshal params: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("handleGetChainParams: got %s, want %s", got, want)
+	}
+
+	var loaded chaincfg.Params
+	if err := json.Unmarshal(got, &loaded); err != nil {
+		t.Fatalf("unable to load params: %v", err)
+	}
+	if loaded.Net != params.Net || *loaded.GenesisHash != *params.GenesisHash ||
+		!loaded.AdminKeySets[btcec.ValidateKeySet].Equal(
+			params.AdminKeySets[btcec.ValidateKeySet]) {
+
+		t.Fatalf("loaded params do not match the active params")
+	}
+}
+
+// TestGetPolicyInfo ensures the getpolicyinfo result reports the policy of the
+// memory pool, including whether the canonical order is required.
+func TestGetPolicyInfo(t *testing.T) {
+	policy := mempool.Policy{
+		AcceptNonStd:          false,
+		RequireCanonicalOrder: true,
+		DisableRelayPriority:  true,
+		MinRelayTxFee:         1000,
+		FreeTxRelayLimit:      15,
+		MaxOrphanTxs:          100,
+		MaxTxVersion:          2,
+		TxExpiry:              time.Hour,
+	}
+	s := &rpcServer{server: &server{
+		txMemPool: mempool.New(&mempool.Config{Policy: policy}),
+	}}
+
+	result, err := handleGetPolicyInfo(s, btcjson.NewGetPolicyInfoCmd(), nil)
+	if err != nil {
+		t.Fatalf("handleGetPolicyInfo: unexpected error: %v", err)
+	}
+	want := &btcjson.GetPolicyInfoResult{
+		AcceptNonStd:          false,
+		RequireCanonicalOrder: true,
+		RelayPriority:         false,
+		MinRelayTxFee:         0.001,
+		FreeTxRelayLimit:      15,
+		MaxOrphanTxs:          100,
+		MaxTxVersion:          2,
+		MempoolExpiry:         3600,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("handleGetPolicyInfo: got %+v, want %+v", result, want)
+	}
+}
+
+// TestReadOnly ensures a database which was closed by its writer can be opened
+// read-only by multiple instances at once, that each of them serves queries,
+// and that commands which would modify the chain are refused.
+func TestReadOnly(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+
+	var hashes []*chainhash.Hash
+	for i := 0; i < 3; i++ {
+		hashes = append(hashes, h.mineBlock(t))
+	}
+	block := provautil.NewBlock(h.generateBlock(t))
+	if err := h.db.Close(); err != nil {
+		t.Fatalf("unable to close db: %v", err)
+	}
+
+	// newReadOnlyServer opens the database read-only and returns an RPC
+	// server backed by a read-only chain.
+	params := chaincfg.RegressionNetParams
+	newReadOnlyServer := func() (*rpcServer, error) {
+		db, err := database.OpenReadOnly("ffldb", h.dbPath, params.Net)
+		if err != nil {
+			return nil, err
+		}
+		timeSource := blockchain.NewMedianTime()
+		chain, err := blockchain.New(&blockchain.Config{
+			DB:          db,
+			ChainParams: &params,
+			TimeSource:  timeSource,
+			ReadOnly:    true,
+		})
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		s := &server{
+			chainParams: &params,
+			db:          db,
+			timeSource:  timeSource,
+			readOnly:    true,
+		}
+		s.blockScrubber = newBlockScrubber(db, chain, 0, time.Second, nil)
+		return &rpcServer{server: s, chain: chain}, nil
+	}
+
+	// Open the database from two instances at once.
+	servers := make([]*rpcServer, 2)
+	errChan := make(chan error, len(servers))
+	for i := range servers {
+		go func(i int) {
+			var err error
+			servers[i], err = newReadOnlyServer()
+			errChan <- err
+		}(i)
+	}
+	for range servers {
+		if err := <-errChan; err != nil {
+			t.Fatalf("unable to open read-only server: %v", err)
+		}
+	}
+	defer func() {
+		for _, s := range servers {
+			s.server.db.Close()
+		}
+	}()
+
+	verbose := false
+	for i, s := range servers {
+		if height := s.chain.BestSnapshot().Height; height != 3 {
+			t.Fatalf("server #%d: got best height %d, want 3", i,
+				height)
+		}
+		for _, hash := range hashes {
+			cmd := btcjson.NewGetBlockCmd(hash.String(), &verbose,
+				nil)
+			if _, err := handleGetBlock(s, cmd, nil); err != nil {
+				t.Fatalf("server #%d: getblock %v: unexpected "+
+					"error: %v", i, hash, err)
+			}
+		}
+
+		// Blocks are refused by the chain.
+		_, _, err := s.chain.ProcessBlock(block, blockchain.BFNone)
+		if _, ok := err.(blockchain.DatabaseError); !ok {
+			t.Fatalf("server #%d: ProcessBlock: got error %v, want "+
+				"DatabaseError", i, err)
+		}
+
+		// Commands which modify the chain are disabled.
+		for _, method := range []string{"submitblock",
+			"sendrawtransaction", "generate"} {
+
+			_, err := s.standardCmdResult(&parsedRPCCmd{
+				method: method}, nil)
+			if err != ErrRPCReadOnly {
+				t.Fatalf("server #%d: %s: got error %v, want %v",
+					i, method, err, ErrRPCReadOnly)
+			}
+		}
+	}
+}
+
+// TestIndexSyncing ensures the commands which are backed by an optional index
+// return an error while the index is catching up to the main chain and succeed
+// once it has caught up.
+func TestIndexSyncing(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	for i := 0; i < 2; i++ {
+		h.mineBlock(t)
+	}
+
+	// Enable indexes which start out behind the main chain.
+	h.enableIndexes(t)
+	s := h.rpcServer.server
+
+	cmd := &btcjson.GetAddressTxIdsCmd{
+		Request: &btcjson.AddressTxRequest{
+			Addresses: []string{h.payAddr.EncodeAddress()},
+		},
+	}
+	_, err := handleGetAddressTxIds(h.rpcServer, cmd, nil)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		!strings.Contains(rpcErr.Message, "syncing") {
+
+		t.Fatalf("getaddresstxids: got error %v, want index syncing "+
+			"error", err)
+	}
+
+	h.syncIndexes(t)
+	defer s.indexManager.Stop()
+	if _, err := handleGetAddressTxIds(h.rpcServer, cmd, nil); err != nil {
+		t.Fatalf("getaddresstxids: unexpected error: %v", err)
+	}
+	for height := uint32(1); height <= 2; height++ {
+		block, err := h.chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockByHeight: unexpected error: %v", err)
+		}
+		coinbaseHash := block.Transactions()[0].Hash()
+		region, err := s.txIndex.TxBlockRegion(coinbaseHash)
+		if err != nil || region == nil {
+			t.Fatalf("coinbase %v not indexed: %v", coinbaseHash, err)
+		}
+	}
+}
+
+// TestGetBlockRaw ensures getblockraw returns the requested range of a
+// serialized block, so the bytes of a transaction fetched through its indexed
+// block region match getrawtransaction, and rejects ranges outside the block and
+// blocks whose data is no longer available.
+func TestGetBlockRaw(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	for i := 0; i < 2; i++ {
+		h.mineBlockToPayAddr(t)
+	}
+	h.enableIndexes(t)
+	h.syncIndexes(t)
+	s := h.rpcServer.server
+	defer s.indexManager.Stop()
+	s.txMemPool = mempool.New(&mempool.Config{})
+
+	getBlockRaw := func(hash string, offset, length *uint32) (string, error) {
+		cmd := btcjson.NewGetBlockRawCmd(hash, offset, length)
+		result, err := handleGetBlockRaw(h.rpcServer, cmd, nil)
+		if err != nil {
+			return "", err
+		}
+		return result.(string), nil
+	}
+
+	// Fetch the coinbase of the best block through its indexed block
+	// region and ensure it matches getrawtransaction.
+	block, err := h.chain.BlockByHeight(2)
+	if err != nil {
+		t.Fatalf("BlockByHeight: unexpected error: %v", err)
+	}
+	blockHash := block.Hash().String()
+	coinbaseHash := block.Transactions()[0].Hash()
+	region, err := s.txIndex.TxBlockRegion(coinbaseHash)
+	if err != nil || region == nil {
+		t.Fatalf("coinbase %v not indexed: %v", coinbaseHash, err)
+	}
+	gotTx, err := getBlockRaw(region.Hash.String(),
+		btcjson.Uint32(region.Offset), btcjson.Uint32(region.Len))
+	if err != nil {
+		t.Fatalf("getblockraw: unexpected error: %v", err)
+	}
+	rawTxCmd := btcjson.NewGetRawTransactionCmd(coinbaseHash.String(), nil)
+	wantTx, err := handleGetRawTransaction(h.rpcServer, rawTxCmd, nil)
+	if err != nil {
+		t.Fatalf("getrawtransaction: unexpected error: %v", err)
+	}
+	if gotTx != wantTx.(string) {
+		t.Fatalf("getblockraw: got transaction %s, want %s", gotTx,
+			wantTx)
+	}
+
+	// Ensure the whole block and the remainder of the block after an offset
+	// are returned without a length.
+	blockBytes, err := block.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: unexpected error: %v", err)
+	}
+	blockLen := uint32(len(blockBytes))
+	gotBlock, err := getBlockRaw(blockHash, nil, nil)
+	if err != nil {
+		t.Fatalf("getblockraw: unexpected error: %v", err)
+	}
+	if gotBlock != hex.EncodeToString(blockBytes) {
+		t.Fatalf("getblockraw: got block %s, want %x", gotBlock,
+			blockBytes)
+	}
+	gotRemainder, err := getBlockRaw(blockHash, btcjson.Uint32(region.Offset),
+		nil)
+	if err != nil {
+		t.Fatalf("getblockraw: unexpected error: %v", err)
+	}
+	if gotRemainder != hex.EncodeToString(blockBytes[region.Offset:]) {
+		t.Fatalf("getblockraw: got remainder %s, want %x", gotRemainder,
+			blockBytes[region.Offset:])
+	}
+
+	// Ensure ranges outside the block and unknown blocks are rejected.
+	tests := []struct {
+		name     string
+		hash     string
+		offset   uint32
+		length   *uint32
+		wantCode btcjson.RPCErrorCode
+	}{
+		{"offset past end", blockHash, blockLen + 1, nil,
+			btcjson.ErrRPCInvalidParameter},
+		{"length past end", blockHash, blockLen - 1, btcjson.Uint32(2),
+			btcjson.ErrRPCInvalidParameter},
+		{"length overflow", blockHash, 1, btcjson.Uint32(^uint32(0)),
+			btcjson.ErrRPCInvalidParameter},
+		{"unknown block", (&chainhash.Hash{}).String(), 0, nil,
+			btcjson.ErrRPCBlockNotFound},
+	}
+	for _, test := range tests {
+		_, err := getBlockRaw(test.hash, btcjson.Uint32(test.offset),
+			test.length)
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != test.wantCode {
+			t.Fatalf("%s: got error %v, want code %d", test.name, err,
+				test.wantCode)
+		}
+	}
+
+	// Ensure a block whose data was removed from the disk is reported as
+	// pruned.
+	location, err := h.chain.BlockRegion(block.Hash())
+	if err != nil {
+		t.Fatalf("BlockRegion: unexpected error: %v", err)
+	}
+	if location.Len != blockLen {
+		t.Fatalf("BlockRegion: got length %d, want %d", location.Len,
+			blockLen)
+	}
+	if err := os.Remove(location.File); err != nil {
+		t.Fatalf("Remove: unexpected error: %v", err)
+	}
+	_, err = getBlockRaw(blockHash, nil, nil)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		!strings.Contains(rpcErr.Message, "pruned") {
+
+		t.Fatalf("getblockraw: got error %v, want pruned block error",
+			err)
+	}
+}
+
+// TestSearchRawTransactionsPaging ensures paging through the transactions of an
+// address with searchrawtransactions returns every confirmed transaction exactly
+// once and in order in both directions while new matching transactions are
+// confirmed, and that unconfirmed transactions are flagged and returned once
+// without being counted by the pages.
+func TestSearchRawTransactionsPaging(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	for i := 0; i < 5; i++ {
+		h.mineBlockToPayAddr(t)
+	}
+	h.enableIndexes(t)
+	h.syncIndexes(t)
+	s := h.rpcServer.server
+	defer s.indexManager.Stop()
+
+	// Add an unconfirmed transaction which pays to the address.
+	pkScript, err := txscript.PayToAddrScript(h.payAddr)
+	if err != nil {
+		t.Fatalf("unable to create pkScript: %v", err)
+	}
+	mtx := wire.NewMsgTx(1)
+	mtx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{1}, 0),
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	mtx.AddTxOut(wire.NewTxOut(1000, pkScript))
+	s.addrIndex.AddUnconfirmedTx(provautil.NewTx(mtx),
+		blockchain.NewUtxoViewpoint())
+	unconfirmedID := mtx.TxHash().String()
+
+	// search returns a page of results or nil when there are none.
+	search := func(skip, count int, reverse bool, includeMempool bool,
+		maxHeight *int32) []btcjson.SearchRawTransactionsResult {
+
+		cmd := btcjson.NewSearchRawTransactionsCmd(
+			h.payAddr.EncodeAddress(), btcjson.Int(1),
+			btcjson.Int(skip), btcjson.Int(count), nil,
+			btcjson.Bool(reverse), nil, btcjson.Bool(includeMempool),
+			maxHeight)
+		result, err := handleSearchRawTransactions(h.rpcServer, cmd, nil)
+		if rpcErr, ok := err.(*btcjson.RPCError); ok &&
+			rpcErr.Code == btcjson.ErrRPCNoTxInfo {
+
+			return nil
+		}
+		if err != nil {
+			t.Fatalf("searchrawtransactions: unexpected error: %v", err)
+		}
+		return result.([]btcjson.SearchRawTransactionsResult)
+	}
+
+	// coinbaseIDs returns the ids of the coinbases of the blocks in the
+	// passed height range in the passed order.
+	coinbaseIDs := func(from, to uint32) []string {
+		var ids []string
+		for height := from; ; {
+			block, err := h.chain.BlockByHeight(height)
+			if err != nil {
+				t.Fatalf("BlockByHeight: unexpected error: %v", err)
+			}
+			ids = append(ids, block.Transactions()[0].Hash().String())
+			if height == to {
+				return ids
+			}
+			if from < to {
+				height++
+			} else {
+				height--
+			}
+		}
+	}
+
+	// pageThrough pages through the results two confirmed transactions at
+	// a time and mines a block after the first page.  It returns the ids of
+	// the confirmed and the unconfirmed transactions in the order returned.
+	const count = 2
+	pageThrough := func(reverse bool, maxHeight *int32) ([]string, []string) {
+		var confirmed, unconfirmed []string
+		for skip := 0; ; {
+			page := search(skip, count, reverse, true, maxHeight)
+			var numConfirmed int
+			for _, result := range page {
+				if result.Unconfirmed {
+					if result.BlockHash != "" {
+						t.Fatalf("unconfirmed transaction %v "+
+							"has block hash", result.Txid)
+					}
+					unconfirmed = append(unconfirmed,
+						result.Txid)
+					continue
+				}
+				confirmed = append(confirmed, result.Txid)
+				numConfirmed++
+			}
+			if numConfirmed > count {
+				t.Fatalf("got %d confirmed transactions, want at "+
+					"most %d", numConfirmed, count)
+			}
+			if skip == 0 {
+				h.mineBlockToPayAddr(t)
+			}
+			if numConfirmed < count {
+				return confirmed, unconfirmed
+			}
+			skip += numConfirmed
+		}
+	}
+
+	// Paging forwards includes the transaction confirmed while paging and
+	// returns the unconfirmed transaction after the confirmed ones.
+	confirmed, unconfirmed := pageThrough(false, nil)
+	if want := coinbaseIDs(1, 6); !reflect.DeepEqual(confirmed, want) {
+		t.Fatalf("forward: got confirmed transactions %v, want %v",
+			confirmed, want)
+	}
+	if len(unconfirmed) != 1 || unconfirmed[0] != unconfirmedID {
+		t.Fatalf("forward: got unconfirmed transactions %v, want [%v]",
+			unconfirmed, unconfirmedID)
+	}
+
+	// Paging in reverse with a fixed maximum height leaves out the
+	// transaction confirmed while paging instead of shifting the pages and
+	// returns the unconfirmed transaction on the first page.
+	maxHeight := int32(h.chain.BestSnapshot().Height)
+	confirmed, unconfirmed = pageThrough(true, &maxHeight)
+	if want := coinbaseIDs(7, 1)[1:]; !reflect.DeepEqual(confirmed, want) {
+		t.Fatalf("reverse: got confirmed transactions %v, want %v",
+			confirmed, want)
+	}
+	if len(unconfirmed) != 1 || unconfirmed[0] != unconfirmedID {
+		t.Fatalf("reverse: got unconfirmed transactions %v, want [%v]",
+			unconfirmed, unconfirmedID)
+	}
+
+	// Unconfirmed transactions are left out when requested.
+	for _, result := range search(0, count, true, false, nil) {
+		if result.Unconfirmed {
+			t.Fatalf("got unconfirmed transaction %v", result.Txid)
+		}
+	}
+}
+
+// TestGetHeaders ensures the getheaders RPC returns the same headers as the
+// getheaders wire message for a chain with a side chain, both serialized and
+// decoded.
+func TestGetHeaders(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+
+	// Generate a main chain of five blocks and a side chain block which
+	// forks after the first block.
+	main := []*chainhash.Hash{h.chain.BestSnapshot().Hash, h.mineBlock(t)}
+	sideBlock := provautil.NewBlock(h.generateBlock(t))
+	main = append(main, h.mineBlockToPayAddr(t))
+	for i := 0; i < 3; i++ {
+		main = append(main, h.mineBlock(t))
+	}
+	isMainChain, _, err := h.chain.ProcessBlock(sideBlock, blockchain.BFNone)
+	if err != nil || isMainChain {
+		t.Fatalf("ProcessBlock: got main chain %v, err %v", isMainChain,
+			err)
+	}
+	heights := make(map[chainhash.Hash]int32)
+	for height, hash := range main {
+		heights[*hash] = int32(height)
+	}
+	unknown := chainhash.Hash{0x01}
+
+	// wireHeaders returns the hashes of the headers the getheaders wire
+	// message with the passed locators and stop hash is answered with.
+	wireHeaders := func(locators []*chainhash.Hash, hashStop *chainhash.Hash) []chainhash.Hash {
+		msg := wire.NewMsgGetHeaders()
+		for _, locator := range locators {
+			msg.AddBlockLocatorHash(locator)
+		}
+		if hashStop != nil {
+			msg.HashStop = *hashStop
+		}
+		var buf bytes.Buffer
+		err := msg.BtcEncode(&buf, wire.ProtocolVersion)
+		if err != nil {
+			t.Fatalf("BtcEncode: unexpected error: %v", err)
+		}
+		msg = wire.NewMsgGetHeaders()
+		err = msg.BtcDecode(&buf, wire.ProtocolVersion)
+		if err != nil {
+			t.Fatalf("BtcDecode: unexpected error: %v", err)
+		}
+		headers, err := locateHeaders(h.chain, msg.BlockLocatorHashes,
+			&msg.HashStop)
+		if err != nil {
+			t.Fatalf("locateHeaders: unexpected error: %v", err)
+		}
+		hashes := make([]chainhash.Hash, 0, len(headers))
+		for i := range headers {
+			hashes = append(hashes, headers[i].BlockHash())
+		}
+		return hashes
+	}
+
+	// getHeaders returns the getheaders RPC result for the passed locators
+	// and stop hash.
+	getHeaders := func(locators []*chainhash.Hash, hashStop *chainhash.Hash, verbose bool) interface{} {
+		strLocators := make([]string, 0, len(locators))
+		for _, locator := range locators {
+			strLocators = append(strLocators, locator.String())
+		}
+		var strHashStop *string
+		if hashStop != nil {
+			strHashStop = btcjson.String(hashStop.String())
+		}
+		cmd := btcjson.NewGetHeadersCmd(strLocators, strHashStop,
+			btcjson.Bool(verbose))
+		result, err := handleGetHeaders(h.rpcServer, cmd, nil)
+		if err != nil {
+			t.Fatalf("getheaders: unexpected error: %v", err)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		locators []*chainhash.Hash
+		hashStop *chainhash.Hash
+		want     []*chainhash.Hash
+	}{
+		{
+			name:     "locator of the side chain",
+			locators: h.chain.BlockLocatorFromHash(sideBlock.Hash()),
+			want:     main[2:],
+		},
+		{
+			name:     "locator of the main chain",
+			locators: h.chain.BlockLocatorFromHash(main[3]),
+			want:     main[4:],
+		},
+		{
+			name:     "locator with stop hash",
+			locators: h.chain.BlockLocatorFromHash(sideBlock.Hash()),
+			hashStop: main[3],
+			want:     main[2:4],
+		},
+		{
+			name:     "unknown locator",
+			locators: []*chainhash.Hash{&unknown},
+			want:     main[1:],
+		},
+		{
+			name:     "unknown stop hash",
+			locators: []*chainhash.Hash{main[4]},
+			hashStop: &unknown,
+			want:     main[5:],
+		},
+		{
+			name:     "stop hash without locators",
+			hashStop: main[2],
+			want:     main[2:3],
+		},
+		{
+			name:     "unknown stop hash without locators",
+			hashStop: &unknown,
+		},
+		{
+			name:     "locator of the tip",
+			locators: []*chainhash.Hash{main[5]},
+		},
+	}
+	for _, test := range tests {
+		want := make([]chainhash.Hash, 0, len(test.want))
+		for _, hash := range test.want {
+			want = append(want, *hash)
+		}
+		if got := wireHeaders(test.locators, test.hashStop); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got wire headers %v, want %v", test.name,
+				got, want)
+			continue
+		}
+
+		// The serialized headers match the headers of the wire
+		// message.
+		hexHeaders := getHeaders(test.locators, test.hashStop,
+			false).([]string)
+		got := make([]chainhash.Hash, 0, len(hexHeaders))
+		for _, hexHeader := range hexHeaders {
+			serialized, err := hex.DecodeString(hexHeader)
+			if err != nil {
+				t.Fatalf("%s: unable to decode header: %v",
+					test.name, err)
+			}
+			var header wire.BlockHeader
+			err = header.Deserialize(bytes.NewReader(serialized))
+			if err != nil {
+				t.Fatalf("%s: unable to deserialize header: %v",
+					test.name, err)
+			}
+			got = append(got, header.BlockHash())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got RPC headers %v, want %v", test.name,
+				got, want)
+			continue
+		}
+
+		// The decoded headers match them as well and are linked to
+		// their neighbors in the main chain.
+		verboseHeaders := getHeaders(test.locators, test.hashStop,
+			true).([]btcjson.GetBlockHeaderVerboseResult)
+		if len(verboseHeaders) != len(want) {
+			t.Errorf("%s: got %d verbose headers, want %d",
+				test.name, len(verboseHeaders), len(want))
+			continue
+		}
+		for i, header := range verboseHeaders {
+			height := heights[want[i]]
+			var nextHash string
+			if int(height) < len(main)-1 {
+				nextHash = main[height+1].String()
+			}
+			if header.Hash != want[i].String() ||
+				header.Height != height ||
+				header.PreviousHash != main[height-1].String() ||
+				header.NextHash != nextHash {
+
+				t.Errorf("%s: got verbose header %v (%d), "+
+					"previous %v, next %v, want %v (%d)",
+					test.name, header.Hash, header.Height,
+					header.PreviousHash, header.NextHash,
+					want[i], height)
+			}
+		}
+	}
+}
+
+// privKeyFromHex returns the private key for the passed hex-encoded bytes.
+func privKeyFromHex(t *testing.T, keyHex string) *btcec.PrivateKey {
+	keyBytes, err := hex.DecodeString(keyHex)
+	if err != nil {
+		t.Fatalf("unable to decode private key: %v", err)
+	}
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
+	return key
+}
+
+// regressionRootKeys returns the private keys of the root key set of the
+// regression test network.
+func regressionRootKeys(t *testing.T) []*btcec.PrivateKey {
+	return []*btcec.PrivateKey{
+		privKeyFromHex(t, "eaf02ca348c524e6392655ba4d29603cd1a7347d9d65cfe93ce1ebffdca22694"),
+		privKeyFromHex(t, "2b8c52b77b327c755b9b375500d3f4b2da9b0a1ff65f6891d311fe94295bc26a"),
+	}
+}
+
+// testAdminOpScript returns a script which carries the passed admin op.
+func testAdminOpScript(t *testing.T, op byte, pubKey *btcec.PublicKey, keyID btcec.KeyID) []byte {
+	data := make([]byte, 1+btcec.PubKeyBytesLenCompressed)
+	data[0] = op
+	copy(data[1:], pubKey.SerializeCompressed())
+	if op == txscript.AdminOpASPKeyAdd || op == txscript.AdminOpASPKeyRevoke {
+		keyIDBuf := make([]byte, btcec.KeyIDSize)
+		keyID.ToAddressFormat(keyIDBuf)
+		data = append(data, keyIDBuf...)
+	}
+	script, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_RETURN).AddData(data).Script()
+	if err != nil {
+		t.Fatalf("unable to create admin op script: %v", err)
+	}
+	return script
+}
+
+// testAdminTx returns a transaction which continues the passed admin thread
+// from the passed tip with the passed outputs after the thread output, signed
+// by the passed keys.
+func testAdminTx(t *testing.T, params *chaincfg.Params, threadID provautil.ThreadID, tip *wire.OutPoint, keys []*btcec.PrivateKey, txOuts ...*wire.TxOut) *wire.MsgTx {
+	threadScript, err := txscript.ProvaThreadScript(threadID)
+	if err != nil {
+		t.Fatalf("unable to create thread script: %v", err)
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *tip,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxOut(wire.NewTxOut(0, threadScript))
+	for _, txOut := range txOuts {
+		tx.AddTxOut(txOut)
+	}
+	lookupKey := func(a provautil.Address) ([]txscript.PrivateKey, error) {
+		privKeys := make([]txscript.PrivateKey, 0, len(keys))
+		for _, key := range keys {
+			privKeys = append(privKeys, txscript.PrivateKey{key, true})
+		}
+		return privKeys, nil
+	}
+	sigScript, err := txscript.SignTxOutput(params, tx, 0, 0, threadScript,
+		txscript.SigHashAll, txscript.KeyClosure(lookupKey), nil)
+	if err != nil {
+		t.Fatalf("unable to sign transaction: %v", err)
+	}
+	tx.TxIn[0].SignatureScript = sigScript
+	return tx
+}
+
+// TestSimulateAdminTx ensures the admin state resulting from simulating a
+// sequence of admin transactions matches the admin state of the chain after
+// the same transactions are mined, that the chain state is not modified by the
+// simulation, and that the rule violation of a rejected transaction is
+// returned along with the state resulting from the transactions before it.
+func TestSimulateAdminTx(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	params := h.rpcServer.server.chainParams
+
+	// Mine enough blocks for the admin thread outputs of the genesis
+	// coinbase to mature.
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		h.mineBlock(t)
+	}
+
+	rootKeys := regressionRootKeys(t)
+	provisionKeys := []*btcec.PrivateKey{
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000001"),
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000002"),
+	}
+	issueKeys := []*btcec.PrivateKey{
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000003"),
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000004"),
+	}
+	aspKey := privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000005")
+
+	// Create a root transaction which provisions the provision and issue
+	// keys, a provision transaction signed by the new provision keys which
+	// provisions an ASP key, and an issue transaction signed by the new
+	// issue keys.
+	tips := h.chain.ThreadTips()
+	rootTx := testAdminTx(t, params, provautil.RootThread,
+		tips[provautil.RootThread], rootKeys,
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpProvisionKeyAdd, provisionKeys[0].PubKey(), 0)),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpProvisionKeyAdd, provisionKeys[1].PubKey(), 0)),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpIssueKeyAdd, issueKeys[0].PubKey(), 0)),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpIssueKeyAdd, issueKeys[1].PubKey(), 0)))
+	aspKeyID := h.chain.LastKeyID() + 1
+	provisionTx := testAdminTx(t, params, provautil.ProvisionThread,
+		tips[provautil.ProvisionThread], provisionKeys,
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpASPKeyAdd, aspKey.PubKey(), aspKeyID)))
+	payScript, err := txscript.PayToAddrScript(h.payAddr)
+	if err != nil {
+		t.Fatalf("unable to create pkScript: %v", err)
+	}
+	issueTx := testAdminTx(t, params, provautil.IssueThread,
+		tips[provautil.IssueThread], issueKeys,
+		wire.NewTxOut(1000, payScript))
+	txns := []*wire.MsgTx{rootTx, provisionTx, issueTx}
+
+	// simulate returns the result of the simulateadmintx command for the
+	// passed transactions.
+	simulate := func(txns ...*wire.MsgTx) *btcjson.SimulateAdminTxResult {
+		hexTxs := make([]string, len(txns))
+		for i, tx := range txns {
+			var buf bytes.Buffer
+			if err := tx.Serialize(&buf); err != nil {
+				t.Fatalf("unable to serialize transaction: %v", err)
+			}
+			hexTxs[i] = hex.EncodeToString(buf.Bytes())
+		}
+		cmd := btcjson.NewSimulateAdminTxCmd(hexTxs)
+		result, err := handleSimulateAdminTx(h.rpcServer, cmd, nil)
+		if err != nil {
+			t.Fatalf("simulateadmintx: unexpected error: %v", err)
+		}
+		return result.(*btcjson.SimulateAdminTxResult)
+	}
+	// adminInfo returns the result of the getadmininfo command.
+	adminInfo := func() *btcjson.GetAdminInfoResult {
+		result, err := handleGetAdminInfo(h.rpcServer, nil, nil)
+		if err != nil {
+			t.Fatalf("getadmininfo: unexpected error: %v", err)
+		}
+		return result.(*btcjson.GetAdminInfoResult)
+	}
+
+	// Simulating the transactions only succeeds in sequence, since the
+	// provision and issue transactions are signed by keys provisioned by
+	// the root transaction, and doesn't modify the chain state.
+	before := adminInfo()
+	result := simulate(provisionTx)
+	if result.Accepted || result.Applied != 0 ||
+		result.RejectedTxID != provisionTx.TxHash().String() ||
+		result.RejectCode != blockchain.ErrScriptMalformed.String() {
+
+		t.Fatalf("unexpected result for provision transaction alone "+
+			"%+v", result)
+	}
+	simulated := simulate(txns...)
+	if !simulated.Accepted || simulated.Applied != len(txns) ||
+		simulated.RejectedTxID != "" || simulated.SupplyDelta != 1000 {
+
+		t.Fatalf("unexpected simulation result %+v", simulated)
+	}
+	if got := adminInfo(); !reflect.DeepEqual(got, before) {
+		t.Fatalf("simulation modified the admin state: got %+v, want "+
+			"%+v", got, before)
+	}
+
+	// Mine the transactions and ensure the resulting admin state matches
+	// the simulation.
+	h.mineBlockWithTxs(t, txns)
+	after := adminInfo()
+	want := &btcjson.SimulateAdminTxResult{
+		Accepted:      true,
+		Applied:       len(txns),
+		ThreadTips:    after.ThreadTips,
+		TotalSupply:   after.TotalSupply,
+		SupplyDelta:   int64(after.TotalSupply - before.TotalSupply),
+		LastKeyID:     after.LastKeyID,
+		RootKeys:      after.RootKeys,
+		ProvisionKeys: after.ProvisionKeys,
+		IssueKeys:     after.IssueKeys,
+		ValidateKeys:  after.ValidateKeys,
+		ASPKeys:       after.ASPKeys,
+	}
+	if !reflect.DeepEqual(simulated, want) {
+		t.Fatalf("simulation does not match mined state: got %+v, "+
+			"want %+v", simulated, want)
+	}
+	if len(after.ProvisionKeys) != 2 || len(after.IssueKeys) != 2 ||
+		after.LastKeyID != uint32(aspKeyID) {
+
+		t.Fatalf("unexpected admin state after mining %+v", after)
+	}
+
+	// A sequence which revokes a provision key and then provisions an ASP
+	// key with a keyID which skips one is rejected on the second
+	// transaction, and returns the state after the revocation.
+	tips = h.chain.ThreadTips()
+	revokeTx := testAdminTx(t, params, provautil.RootThread,
+		tips[provautil.RootThread], rootKeys,
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpProvisionKeyRevoke, provisionKeys[1].PubKey(), 0)))
+	skipTx := testAdminTx(t, params, provautil.ProvisionThread,
+		tips[provautil.ProvisionThread], provisionKeys[:1],
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpASPKeyAdd, aspKey.PubKey(), aspKeyID+2)))
+	result = simulate(revokeTx, skipTx)
+	if result.Accepted || result.Applied != 1 ||
+		result.RejectedTxID != skipTx.TxHash().String() ||
+		result.RejectCode != blockchain.ErrInvalidAdminOp.String() ||
+		result.RejectReason == "" || result.SupplyDelta != 0 {
+
+		t.Fatalf("unexpected result for rejected sequence %+v", result)
+	}
+	revokeHash := revokeTx.TxHash()
+	if len(result.ProvisionKeys) != 1 || result.ThreadTips[0].OutPoint !=
+		wire.NewOutPoint(&revokeHash, 0).String() {
+
+		t.Fatalf("unexpected state before rejected transaction %+v",
+			result)
+	}
+	if got := adminInfo(); !reflect.DeepEqual(got, after) {
+		t.Fatalf("simulation modified the admin state: got %+v, want "+
+			"%+v", got, after)
+	}
+
+	// Transactions which aren't admin transactions are refused.
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: revokeHash}, nil))
+	tx.AddTxOut(wire.NewTxOut(0, payScript))
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		t.Fatalf("unable to serialize transaction: %v", err)
+	}
+	cmd := btcjson.NewSimulateAdminTxCmd([]string{
+		hex.EncodeToString(buf.Bytes())})
+	_, err = handleSimulateAdminTx(h.rpcServer, cmd, nil)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCInvalidParameter {
+
+		t.Fatalf("simulateadmintx: got error %v for transaction which "+
+			"is not an admin transaction, want invalid parameter", err)
+	}
+}
+
+// TestListUnspentByAddress ensures the listunspentbyaddress command validates
+// its parameters, filters the unspent outputs of the queried addresses by their
+// confirmations, and reports insufficient funds when the amount can't be
+// reached.
+func TestListUnspentByAddress(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	var coinbases []string
+	for i := 0; i < 3; i++ {
+		hash := h.mineBlockToPayAddr(t)
+		block, err := h.chain.BlockByHash(hash)
+		if err != nil {
+			t.Fatalf("BlockByHash: unexpected error: %v", err)
+		}
+		coinbases = append(coinbases,
+			block.Transactions()[0].Hash().String())
+	}
+	h.rpcServer.server.txMemPool = mempool.New(&mempool.Config{})
+
+	listUnspent := func(addrs []string, keyIDs *[]uint32, minConf, maxConf *int, amount *float64) (*btcjson.ListUnspentByAddressResult, error) {
+		cmd := btcjson.NewListUnspentByAddressCmd(addrs, keyIDs, minConf,
+			maxConf, amount, btcjson.Bool(false), btcjson.Bool(true))
+		if cmd.MinConf == nil {
+			cmd.MinConf = btcjson.Int(1)
+		}
+		if cmd.MaxConf == nil {
+			cmd.MaxConf = btcjson.Int(9999999)
+		}
+		result, err := handleListUnspentByAddress(h.rpcServer, cmd, nil)
+		if err != nil {
+			return nil, err
+		}
+		return result.(*btcjson.ListUnspentByAddressResult), nil
+	}
+
+	// Invalid parameters are rejected.
+	addr := h.payAddr.EncodeAddress()
+	mainNetAddr, err := provautil.NewAddressProva(h.payAddr.ScriptAddress(),
+		h.payAddr.ScriptKeyIDs(), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	invalid := []struct {
+		name    string
+		addrs   []string
+		minConf int
+		maxConf int
+		amount  *float64
+		code    btcjson.RPCErrorCode
+	}{
+		{"no addresses", nil, 1, 10, nil, btcjson.ErrRPCInvalidParameter},
+		{"bad address", []string{"bogus"}, 1, 10, nil,
+			btcjson.ErrRPCInvalidAddressOrKey},
+		{"mainnet address", []string{mainNetAddr.String()}, 1, 10, nil,
+			btcjson.ErrRPCWrongNetworkAddress},
+		{"negative minconf", []string{addr}, -1, 10, nil,
+			btcjson.ErrRPCInvalidParameter},
+		{"minconf above maxconf", []string{addr}, 3, 2, nil,
+			btcjson.ErrRPCInvalidParameter},
+		{"zero amount", []string{addr}, 1, 10, btcjson.Float64(0),
+			btcjson.ErrRPCInvalidParameter},
+		{"insufficient funds", []string{addr}, 1, 10,
+			btcjson.Float64(1), btcjson.ErrRPCWalletInsufficientFunds},
+	}
+	for _, test := range invalid {
+		_, err := listUnspent(test.addrs, nil, btcjson.Int(test.minConf),
+			btcjson.Int(test.maxConf), test.amount)
+		if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+			rpcErr.Code != test.code {
+
+			t.Errorf("%s: got error %v, want code %v", test.name, err,
+				test.code)
+		}
+	}
+
+	// The outputs of the coinbases are returned oldest first within the
+	// inclusive confirmation bounds.  The coinbase at index i of the
+	// coinbases has 3-i confirmations.
+	tests := []struct {
+		name    string
+		minConf int
+		maxConf int
+		first   int
+		count   int
+	}{
+		{"all", 1, 9999999, 0, 3},
+		{"tip", 1, 1, 2, 1},
+		{"bounded", 2, 3, 0, 2},
+		{"none", 4, 9999999, 0, 0},
+	}
+	for _, test := range tests {
+		result, err := listUnspent([]string{addr}, nil,
+			btcjson.Int(test.minConf), btcjson.Int(test.maxConf), nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if result.Height != 3 || len(result.Outputs) != test.count {
+			t.Fatalf("%s: got %d outputs at height %d, want %d at "+
+				"height 3", test.name, len(result.Outputs),
+				result.Height, test.count)
+		}
+		for i, output := range result.Outputs {
+			index := test.first + i
+			if output.TxID != coinbases[index] || output.Vout != 0 ||
+				output.Address != addr || !output.Coinbase ||
+				output.Confirmations != int32(3-index) {
+
+				t.Fatalf("%s: unexpected output %+v", test.name,
+					output)
+			}
+		}
+	}
+
+	// The outputs are also found by their key IDs.
+	result, err := listUnspent(nil, &[]uint32{1}, btcjson.Int(1),
+		btcjson.Int(3), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Outputs) != len(coinbases) {
+		t.Fatalf("got %d outputs by key ID, want %d", len(result.Outputs),
+			len(coinbases))
+	}
+}
+
+// TestGeneratePowOnly ensures the generate command mines unsigned blocks
+// without any validate keys on a network which accepts blocks on proof of work
+// alone, and that the blocks extend the main chain.
+func TestGeneratePowOnly(t *testing.T) {
+	defer func(c *config, p *params) {
+		cfg = c
+		activeNetParams = p
+	}(cfg, activeNetParams)
+	chainParams := *regressionNetParams.Params
+	chainParams.PowOnly = true
+	netParams := regressionNetParams
+	netParams.Params = &chainParams
+	activeNetParams = &netParams
+
+	tmpDir, err := ioutil.TempDir("", "generatepowonly")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cfg = newTestConfig(tmpDir)
+	payAddr, err := provautil.NewAddressProva(make([]byte, 20),
+		[]btcec.KeyID{1, 2}, &chainParams)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	cfg.miningAddrs = []provautil.Address{payAddr}
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		chainParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+	s, err := newServer(nil, db, &chainParams)
+	if err != nil {
+		t.Fatalf("newServer: unexpected error: %v", err)
+	}
+	s.Start()
+	defer func() {
+		s.Stop()
+		s.WaitForShutdown()
+	}()
+	if len(s.cpuMiner.BlockSigners()) != 0 {
+		t.Fatalf("unexpected validate keys")
+	}
+
+	const numBlocks = 3
+	rpc := &rpcServer{server: s, chain: s.blockManager.chain}
+	result, err := handleGenerate(rpc, btcjson.NewGenerateCmd(numBlocks),
+		nil)
+	if err != nil {
+		t.Fatalf("generate: unexpected error: %v", err)
+	}
+	hashes := result.([]string)
+	if len(hashes) != numBlocks {
+		t.Fatalf("generate: got %d blocks, want %d", len(hashes),
+			numBlocks)
+	}
+	best := rpc.chain.BestSnapshot()
+	if best.Height != numBlocks || best.Hash.String() != hashes[numBlocks-1] {
+		t.Fatalf("best block is %v at height %d, want %v at height %d",
+			best.Hash, best.Height, hashes[numBlocks-1], numBlocks)
+	}
+	for _, hashStr := range hashes {
+		hash, err := chainhash.NewHashFromStr(hashStr)
+		if err != nil {
+			t.Fatalf("invalid block hash %q: %v", hashStr, err)
+		}
+		block, err := rpc.chain.BlockByHash(hash)
+		if err != nil {
+			t.Fatalf("BlockByHash %v: unexpected error: %v", hash, err)
+		}
+		header := &block.MsgBlock().Header
+		if header.ValidatingPubKey != (wire.BlockValidatingPubKey{}) {
+			t.Fatalf("block %v is signed by %v", hash,
+				header.ValidatingPubKey)
+		}
+	}
+}
+
+// sliceTxSource is a mining.TxSource which offers a fixed set of transactions.
+type sliceTxSource []*mining.TxDesc
+
+// LastUpdated returns the zero time since the source never changes.  It is
+// part of the mining.TxSource interface implementation.
+func (s sliceTxSource) LastUpdated() time.Time {
+	return time.Time{}
+}
+
+// MiningDescs returns the transactions of the source.  It is part of the
+// mining.TxSource interface implementation.
+func (s sliceTxSource) MiningDescs() []*mining.TxDesc {
+	return s
+}
+
+// HaveTransaction returns whether the source offers the transaction with the
+// passed hash.  It is part of the mining.TxSource interface implementation.
+func (s sliceTxSource) HaveTransaction(hash *chainhash.Hash) bool {
+	for _, desc := range s {
+		if *desc.Tx.Hash() == *hash {
+			return true
+		}
+	}
+	return false
+}
+
+// issueTestOutputs mines enough blocks for the admin thread outputs of the
+// genesis coinbase to mature, provisions issue keys, and mines a block with an
+// issue transaction whose first output is the tip of the issue thread, followed
+// by the passed number of outputs of the passed amount.  The outputs pay to an
+// address whose keys are known: the key of the public key hash is the second
+// root key, and both keyIDs of the regression test network belong to the root
+// keys.  It returns the issue transaction, the issue keys, the pkScript of the
+// issued outputs and a closure which looks up the keys which sign for them.
+func issueTestOutputs(t *testing.T, h *testRPCHarness, numOutputs int, amount int64) (*wire.MsgTx, []*btcec.PrivateKey, []byte, txscript.KeyClosure) {
+	params := h.rpcServer.server.chainParams
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		h.mineBlock(t)
+	}
+	issueKeys := []*btcec.PrivateKey{
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000003"),
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000004"),
+	}
+	tips := h.chain.ThreadTips()
+	rootTx := testAdminTx(t, params, provautil.RootThread,
+		tips[provautil.RootThread], regressionRootKeys(t),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpIssueKeyAdd, issueKeys[0].PubKey(), 0)),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpIssueKeyAdd, issueKeys[1].PubKey(), 0)))
+
+	spendKeys := regressionRootKeys(t)
+	spendAddr, err := provautil.NewAddressProva(
+		provautil.Hash160(spendKeys[1].PubKey().SerializeCompressed()),
+		[]btcec.KeyID{1, 2}, params)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	spendScript, err := txscript.PayToAddrScript(spendAddr)
+	if err != nil {
+		t.Fatalf("unable to create pkScript: %v", err)
+	}
+	issueOuts := make([]*wire.TxOut, numOutputs)
+	for i := range issueOuts {
+		issueOuts[i] = wire.NewTxOut(amount, spendScript)
+	}
+	issueTx := testAdminTx(t, params, provautil.IssueThread,
+		tips[provautil.IssueThread], issueKeys, issueOuts...)
+	h.mineBlockWithTxs(t, []*wire.MsgTx{rootTx, issueTx})
+
+	lookupKey := func(a provautil.Address) ([]txscript.PrivateKey, error) {
+		return []txscript.PrivateKey{
+			{Key: spendKeys[1], Compressed: true},
+			{Key: spendKeys[0], Compressed: true},
+		}, nil
+	}
+	return issueTx, issueKeys, spendScript, lookupKey
+}
+
+// TestBlockTemplateSoftCap ensures block templates generated from a source
+// pool exceeding the maximum block size of the mining policy stay within it,
+// that admin transactions are included even when they alone exceed it, and
+// that the resulting blocks are valid.
+func TestBlockTemplateSoftCap(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	params := h.rpcServer.server.chainParams
+
+	// Issue outputs which are each spent by a transaction offered for the
+	// template.
+	const numSpends = 20
+	issueTx, issueKeys, spendScript, lookupKey := issueTestOutputs(t, h,
+		numSpends, 100000)
+	issueOuts := issueTx.TxOut[1:]
+
+	// Offer transactions which each spend one of the issued outputs to
+	// several outputs while paying a fee, along with an admin transaction
+	// which issues more outputs.
+	var source sliceTxSource
+	issueHash := issueTx.TxHash()
+	for i := 0; i < numSpends; i++ {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&issueHash,
+			uint32(i+1)), nil))
+		for j := 0; j < 5; j++ {
+			tx.AddTxOut(wire.NewTxOut(19000, spendScript))
+		}
+		sigScript, err := txscript.SignTxOutput(params, tx, 0, 100000,
+			spendScript, txscript.SigHashAll,
+			lookupKey, nil)
+		if err != nil {
+			t.Fatalf("unable to sign transaction: %v", err)
+		}
+		tx.TxIn[0].SignatureScript = sigScript
+		size := int64(tx.SerializeSize())
+		source = append(source, &mining.TxDesc{
+			Tx:       provautil.NewTx(tx),
+			Fee:      5000,
+			FeePerKB: 5000 * 1000 / size,
+		})
+	}
+	adminTx := testAdminTx(t, params, provautil.IssueThread,
+		wire.NewOutPoint(&issueHash, 0), issueKeys, issueOuts...)
+	source = append(source, &mining.TxDesc{Tx: provautil.NewTx(adminTx)})
+
+	// newTemplate returns a block template generated from the offered
+	// transactions with the passed maximum block size along with whether
+	// it includes the admin transaction and the number of other
+	// transactions it includes.
+	newTemplate := func(maxSize uint32) (*wire.MsgBlock, bool, int) {
+		policy := mining.Policy{BlockMaxSize: maxSize}
+		generator := mining.NewBlkTmplGenerator(&policy, params,
+			source, h.chain, h.rpcServer.server.timeSource, nil,
+			txscript.NewHashCache(uint(len(source))), nil)
+		template, err := generator.NewBlockTemplate(h.payAddr, h.signer)
+		if err != nil {
+			t.Fatalf("NewBlockTemplate: unexpected error: %v", err)
+		}
+		var hasAdmin bool
+		var numOthers int
+		for _, tx := range template.Block.Transactions[1:] {
+			if tx.TxHash() == adminTx.TxHash() {
+				hasAdmin = true
+			} else {
+				numOthers++
+			}
+		}
+		return template.Block, hasAdmin, numOthers
+	}
+
+	// Without a binding cap, all of the offered transactions are included.
+	full, hasAdmin, numOthers := newTemplate(wire.MaxBlockPayload)
+	fullSize := full.SerializeSize()
+	if !hasAdmin || numOthers != numSpends {
+		t.Fatalf("unexpected uncapped template with admin tx %v and %d "+
+			"other txs", hasAdmin, numOthers)
+	}
+
+	// A cap of half the size of the full template only leaves room for
+	// some of the other transactions after the admin transaction.
+	maxSize := uint32(fullSize / 2)
+	capped, hasAdmin, numOthers := newTemplate(maxSize)
+	if size := capped.SerializeSize(); size > int(maxSize) {
+		t.Fatalf("capped template size %d exceeds the cap %d", size,
+			maxSize)
+	}
+	if !hasAdmin || numOthers == 0 || numOthers >= numSpends {
+		t.Fatalf("unexpected capped template with admin tx %v and %d "+
+			"other txs", hasAdmin, numOthers)
+	}
+
+	// The admin transaction is included even when it alone exceeds the
+	// cap, while none of the other transactions are.
+	maxSize = uint32(full.Transactions[0].SerializeSize() +
+		adminTx.SerializeSize())
+	tiny, hasAdmin, numOthers := newTemplate(maxSize)
+	if size := tiny.SerializeSize(); size <= int(maxSize) {
+		t.Fatalf("template size %d does not exceed the cap %d", size,
+			maxSize)
+	}
+	if !hasAdmin || numOthers != 0 {
+		t.Fatalf("unexpected template exceeding the cap with admin tx "+
+			"%v and %d other txs", hasAdmin, numOthers)
+	}
+
+	// The capped template is a valid block.
+	solveBlock(capped)
+	block := provautil.NewBlock(capped)
+	isMainChain, _, err := h.chain.ProcessBlock(block, blockchain.BFNone)
+	if err != nil || !isMainChain {
+		t.Fatalf("ProcessBlock: got main chain %v, err %v", isMainChain,
+			err)
+	}
+}
+
+// TestGetBlockAdminOps ensures the getblockadminops command returns each kind
+// of admin operation of a block along with the admin state it results in, also
+// for blocks buried by later blocks, that blocks without admin transactions
+// have an empty list, that side chain blocks are described by the admin state
+// of their side chain, and that block connected webhook events list the same
+// operations.
+func TestGetBlockAdminOps(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	params := h.rpcServer.server.chainParams
+	before := h.chain.AdminState()
+
+	// adminOps returns the result of the getblockadminops command for the
+	// block with the passed hash.
+	adminOps := func(hash *chainhash.Hash) *btcjson.GetBlockAdminOpsResult {
+		cmd := btcjson.NewGetBlockAdminOpsCmd(hash.String())
+		result, err := handleGetBlockAdminOps(h.rpcServer, cmd, nil)
+		if err != nil {
+			t.Fatalf("getblockadminops: unexpected error: %v", err)
+		}
+		return result.(*btcjson.GetBlockAdminOpsResult)
+	}
+	keyOp := func(tx *wire.MsgTx, thread, op string, keySet btcec.KeySetType, pubKey *btcec.PublicKey, keyID btcec.KeyID, setSize int) btcjson.AdminOpResult {
+		return btcjson.AdminOpResult{
+			TxID:    tx.TxHash().String(),
+			Thread:  thread,
+			Op:      op,
+			KeySet:  keySet.String(),
+			PubKey:  hex.EncodeToString(pubKey.SerializeCompressed()),
+			KeyID:   uint32(keyID),
+			SetSize: &setSize,
+		}
+	}
+	supplyOp := func(tx *wire.MsgTx, op string, amount int64, totalSupply uint64) btcjson.AdminOpResult {
+		return btcjson.AdminOpResult{
+			TxID:        tx.TxHash().String(),
+			Thread:      "issue",
+			Op:          op,
+			Amount:      amount,
+			TotalSupply: &totalSupply,
+		}
+	}
+	checkOps := func(name string, result *btcjson.GetBlockAdminOpsResult, mainChain bool, want []btcjson.AdminOpResult) {
+		if result.MainChain != mainChain {
+			t.Fatalf("%s: got main chain %v, want %v", name,
+				result.MainChain, mainChain)
+		}
+		if !reflect.DeepEqual(result.Ops, want) {
+			gotJSON, _ := json.Marshal(result.Ops)
+			wantJSON, _ := json.Marshal(want)
+			t.Fatalf("%s: got ops %s, want %s", name, gotJSON,
+				wantJSON)
+		}
+	}
+
+	// Block A provisions two issue keys and issues two outputs.
+	issueTx, issueKeys, spendScript, lookupKey := issueTestOutputs(t, h,
+		2, 1000)
+	hashA := h.chain.BestSnapshot().Hash
+	blockA, err := h.chain.BlockByHash(hashA)
+	if err != nil {
+		t.Fatalf("unable to fetch block: %v", err)
+	}
+	rootTxA := blockA.MsgBlock().Transactions[1]
+	numIssueKeys := len(before.KeySets[btcec.IssueKeySet])
+	wantA := []btcjson.AdminOpResult{
+		keyOp(rootTxA, "root", "ADD_KEY", btcec.IssueKeySet,
+			issueKeys[0].PubKey(), 0, numIssueKeys+1),
+		keyOp(rootTxA, "root", "ADD_KEY", btcec.IssueKeySet,
+			issueKeys[1].PubKey(), 0, numIssueKeys+2),
+		supplyOp(issueTx, "ISSUE", 2000, before.TotalSupply+2000),
+	}
+	checkOps("block A", adminOps(hashA), true, wantA)
+
+	// Generate the first block of a side chain which forks from block A
+	// before block B is mined.
+	rootKeys := regressionRootKeys(t)
+	sideKeys := []*btcec.PrivateKey{
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000006"),
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000007"),
+	}
+	tips := h.chain.ThreadTips()
+	sideRootTx1 := testAdminTx(t, params, provautil.RootThread,
+		tips[provautil.RootThread], rootKeys,
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpProvisionKeyAdd, sideKeys[0].PubKey(), 0)))
+	side1 := h.generateBlock(t)
+	side1.Transactions = append(side1.Transactions, sideRootTx1)
+	side1.Transactions[0].TxIn[0].SignatureScript = append(
+		side1.Transactions[0].TxIn[0].SignatureScript, 1)
+
+	// Block B provisions provision keys, which sign a provision
+	// transaction in the same block that provisions a validate key, an ASP
+	// key and an op reserved for later soft forks, and destroys one of the
+	// issued outputs.
+	provisionKeys := []*btcec.PrivateKey{
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000001"),
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000002"),
+	}
+	validateKey := privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000008")
+	aspKey := privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000005")
+	aspKeyID := h.chain.LastKeyID() + 1
+	rootTxB := testAdminTx(t, params, provautil.RootThread,
+		tips[provautil.RootThread], rootKeys,
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpProvisionKeyAdd, provisionKeys[0].PubKey(), 0)),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpProvisionKeyAdd, provisionKeys[1].PubKey(), 0)))
+	upgradableScript, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_RETURN).
+		AddData([]byte{txscript.AdminOpUpgradableThreshold, 0x01}).
+		Script()
+	if err != nil {
+		t.Fatalf("unable to create admin op script: %v", err)
+	}
+	provisionTxB := testAdminTx(t, params, provautil.ProvisionThread,
+		tips[provautil.ProvisionThread], provisionKeys,
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpValidateKeyAdd, validateKey.PubKey(), 0)),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpASPKeyAdd, aspKey.PubKey(), aspKeyID)),
+		wire.NewTxOut(0, upgradableScript))
+
+	threadScript, err := txscript.ProvaThreadScript(provautil.IssueThread)
+	if err != nil {
+		t.Fatalf("unable to create thread script: %v", err)
+	}
+	issueHash := issueTx.TxHash()
+	destroyTx := wire.NewMsgTx(wire.TxVersion)
+	destroyTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *tips[provautil.IssueThread],
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	destroyTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&issueHash, 1),
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	destroyTx.AddTxOut(wire.NewTxOut(0, threadScript))
+	destroyTx.AddTxOut(wire.NewTxOut(1000, []byte{txscript.OP_RETURN}))
+	issueLookupKey := func(a provautil.Address) ([]txscript.PrivateKey, error) {
+		return []txscript.PrivateKey{
+			{Key: issueKeys[0], Compressed: true},
+			{Key: issueKeys[1], Compressed: true},
+		}, nil
+	}
+	sigScript, err := txscript.SignTxOutput(params, destroyTx, 0, 0,
+		threadScript, txscript.SigHashAll,
+		txscript.KeyClosure(issueLookupKey), nil)
+	if err != nil {
+		t.Fatalf("unable to sign transaction: %v", err)
+	}
+	destroyTx.TxIn[0].SignatureScript = sigScript
+	sigScript, err = txscript.SignTxOutput(params, destroyTx, 1, 1000,
+		spendScript, txscript.SigHashAll, lookupKey, nil)
+	if err != nil {
+		t.Fatalf("unable to sign transaction: %v", err)
+	}
+	destroyTx.TxIn[1].SignatureScript = sigScript
+
+	hashB := h.mineBlockWithTxs(t, []*wire.MsgTx{rootTxB, provisionTxB,
+		destroyTx})
+	numProvisionKeys := len(before.KeySets[btcec.ProvisionKeySet])
+	numValidateKeys := len(before.KeySets[btcec.ValidateKeySet])
+	wantB := []btcjson.AdminOpResult{
+		keyOp(rootTxB, "root", "ADD_KEY", btcec.ProvisionKeySet,
+			provisionKeys[0].PubKey(), 0, numProvisionKeys+1),
+		keyOp(rootTxB, "root", "ADD_KEY", btcec.ProvisionKeySet,
+			provisionKeys[1].PubKey(), 0, numProvisionKeys+2),
+		keyOp(provisionTxB, "provision", "ADD_KEY",
+			btcec.ValidateKeySet, validateKey.PubKey(), 0,
+			numValidateKeys+1),
+		keyOp(provisionTxB, "provision", "ADD_KEY", btcec.ASPKeySet,
+			aspKey.PubKey(), aspKeyID, len(before.KeyIDs)+1),
+		{
+			TxID:   provisionTxB.TxHash().String(),
+			Thread: "provision",
+			Op:     "UNKNOWN_OP",
+		},
+		supplyOp(destroyTx, "DESTROY", 1000, before.TotalSupply+1000),
+	}
+	checkOps("block B", adminOps(hashB), true, wantB)
+
+	// The block connected webhook event of the best block lists the same
+	// operations.
+	blockB, err := h.chain.BlockByHash(hashB)
+	if err != nil {
+		t.Fatalf("unable to fetch block: %v", err)
+	}
+	hookOps := adminOpResults(h.chain.BestBlockAdminOps(blockB))
+	if !reflect.DeepEqual(hookOps, wantB) {
+		t.Fatalf("unexpected webhook ops %+v", hookOps)
+	}
+
+	// Generate the second block of the side chain, which provisions
+	// another key on top of the first one.
+	sideRootHash := sideRootTx1.TxHash()
+	sideRootTx2 := testAdminTx(t, params, provautil.RootThread,
+		wire.NewOutPoint(&sideRootHash, 0), rootKeys,
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpProvisionKeyAdd, sideKeys[1].PubKey(), 0)))
+	side2 := h.generateBlock(t)
+	side2.Transactions = append(side2.Transactions, sideRootTx2)
+	side2.Transactions[0].TxIn[0].SignatureScript = append(
+		side2.Transactions[0].TxIn[0].SignatureScript, 1)
+
+	// Block C revokes the keys provisioned by block B and one of the issue
+	// keys.
+	tips = h.chain.ThreadTips()
+	provisionTxC := testAdminTx(t, params, provautil.ProvisionThread,
+		tips[provautil.ProvisionThread], provisionKeys,
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpValidateKeyRevoke, validateKey.PubKey(), 0)),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpASPKeyRevoke, aspKey.PubKey(), aspKeyID)))
+	rootTxC := testAdminTx(t, params, provautil.RootThread,
+		tips[provautil.RootThread], rootKeys,
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpIssueKeyRevoke, issueKeys[1].PubKey(), 0)))
+	hashC := h.mineBlockWithTxs(t, []*wire.MsgTx{provisionTxC, rootTxC})
+	wantC := []btcjson.AdminOpResult{
+		keyOp(provisionTxC, "provision", "REVOKE_KEY",
+			btcec.ValidateKeySet, validateKey.PubKey(), 0,
+			numValidateKeys),
+		keyOp(provisionTxC, "provision", "REVOKE_KEY", btcec.ASPKeySet,
+			aspKey.PubKey(), aspKeyID, len(before.KeyIDs)),
+		keyOp(rootTxC, "root", "REVOKE_KEY", btcec.IssueKeySet,
+			issueKeys[1].PubKey(), 0, numIssueKeys+1),
+	}
+	checkOps("block C", adminOps(hashC), true, wantC)
+
+	// A block without admin transactions has an empty list.
+	hashD := h.mineBlock(t)
+	result := adminOps(hashD)
+	checkOps("block D", result, true, []btcjson.AdminOpResult{})
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("unable to marshal result: %v", err)
+	}
+	if !strings.Contains(string(resultJSON), `"ops":[]`) {
+		t.Fatalf("unexpected result without admin ops %s", resultJSON)
+	}
+
+	// The blocks buried by later blocks still return the admin state as of
+	// when they were connected.
+	checkOps("buried block A", adminOps(hashA), true, wantA)
+	checkOps("buried block B", adminOps(hashB), true, wantB)
+
+	// The side chain blocks are described by the admin state of the side
+	// chain, which doesn't include the keys provisioned by block B.
+	side1Hash := h.processSideBlock(t, side1)
+	side2.Header.PrevBlock = *side1Hash
+	side2Hash := h.processSideBlock(t, side2)
+	result = adminOps(side1Hash)
+	checkOps("side block 1", result, false, []btcjson.AdminOpResult{
+		keyOp(sideRootTx1, "root", "ADD_KEY", btcec.ProvisionKeySet,
+			sideKeys[0].PubKey(), 0, numProvisionKeys+1),
+	})
+	if result.Height != blockA.Height()+1 {
+		t.Fatalf("unexpected side block height %d", result.Height)
+	}
+	checkOps("side block 2", adminOps(side2Hash), false,
+		[]btcjson.AdminOpResult{
+			keyOp(sideRootTx2, "root", "ADD_KEY",
+				btcec.ProvisionKeySet, sideKeys[1].PubKey(), 0,
+				numProvisionKeys+2),
+		})
+
+	// Unknown blocks are not found.
+	cmd := btcjson.NewGetBlockAdminOpsCmd(chainhash.Hash{}.String())
+	_, err = handleGetBlockAdminOps(h.rpcServer, cmd, nil)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCBlockNotFound {
+
+		t.Fatalf("getblockadminops: got error %v for unknown block, "+
+			"want block not found", err)
+	}
+}
+
+// TestGetAdminProof ensures the proofs returned by the getadminproof command
+// verify from the genesis block and its admin state, prove the validate keys as
+// of the block they are for, and fail verification once tampered with.
+func TestGetAdminProof(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	params := h.rpcServer.server.chainParams
+
+	// The regression test network has no checkpoints, so the proofs start
+	// from the genesis block and its admin state.
+	genesisHash := *params.GenesisHash
+	stateHash := h.chain.AdminState().Hash()
+
+	// adminProof returns the result of the getadminproof command for the
+	// passed height along with the proof it decodes to.
+	adminProof := func(height uint32) (*btcjson.GetAdminProofResult, *adminstate.Proof) {
+		cmd := btcjson.NewGetAdminProofCmd(height)
+		result, err := handleGetAdminProof(h.rpcServer, cmd, nil)
+		if err != nil {
+			t.Fatalf("getadminproof: unexpected error: %v", err)
+		}
+		proofResult := result.(*btcjson.GetAdminProofResult)
+		proofBytes, err := hex.DecodeString(proofResult.Proof)
+		if err != nil {
+			t.Fatalf("getadminproof: invalid proof hex: %v", err)
+		}
+		var proof adminstate.Proof
+		if err := proof.Deserialize(bytes.NewReader(proofBytes)); err != nil {
+			t.Fatalf("Deserialize: unexpected error: %v", err)
+		}
+		return proofResult, &proof
+	}
+
+	// Once the admin thread outputs of the genesis block mature, block
+	// base+1 provisions provision keys, block base+2 provisions a validate
+	// key, block base+3 revokes it and block base+4 has no admin
+	// transactions.
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		h.mineBlock(t)
+	}
+	base := h.chain.BestSnapshot().Height
+	rootKeys := regressionRootKeys(t)
+	provisionKeys := []*btcec.PrivateKey{
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000001"),
+		privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000002"),
+	}
+	validateKey := privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000008")
+	tips := h.chain.ThreadTips()
+	rootTx := testAdminTx(t, params, provautil.RootThread,
+		tips[provautil.RootThread], rootKeys,
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpProvisionKeyAdd, provisionKeys[0].PubKey(), 0)),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpProvisionKeyAdd, provisionKeys[1].PubKey(), 0)))
+	h.mineBlockWithTxs(t, []*wire.MsgTx{rootTx})
+	addTx := testAdminTx(t, params, provautil.ProvisionThread,
+		tips[provautil.ProvisionThread], provisionKeys,
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpValidateKeyAdd, validateKey.PubKey(), 0)))
+	h.mineBlockWithTxs(t, []*wire.MsgTx{addTx})
+	addHash := addTx.TxHash()
+	revokeTx := testAdminTx(t, params, provautil.ProvisionThread,
+		wire.NewOutPoint(&addHash, 0), provisionKeys,
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpValidateKeyRevoke, validateKey.PubKey(), 0)))
+	h.mineBlockWithTxs(t, []*wire.MsgTx{revokeTx})
+	bestHash := h.mineBlock(t)
+
+	tests := []struct {
+		height      uint32
+		numAdminTxs int
+		isValidate  bool
+	}{
+		{height: 0, numAdminTxs: 0, isValidate: false},
+		{height: base + 1, numAdminTxs: 1, isValidate: false},
+		{height: base + 2, numAdminTxs: 2, isValidate: true},
+		{height: base + 3, numAdminTxs: 3, isValidate: false},
+		{height: base + 4, numAdminTxs: 3, isValidate: false},
+	}
+	for _, test := range tests {
+		result, proof := adminProof(test.height)
+		if result.Height != test.height || result.CheckpointHeight != 0 ||
+			result.CheckpointHash != genesisHash.String() ||
+			result.StateHash != stateHash.String() ||
+			result.NumHeaders != int(test.height) ||
+			result.NumAdminTxs != test.numAdminTxs {
+
+			t.Errorf("height %d: unexpected result %+v", test.height,
+				result)
+			continue
+		}
+		isValidate, err := adminstate.VerifyValidateKey(proof,
+			&genesisHash, &stateHash, validateKey.PubKey())
+		if err != nil {
+			t.Errorf("height %d: VerifyValidateKey: unexpected error: "+
+				"%v", test.height, err)
+			continue
+		}
+		if isValidate != test.isValidate {
+			t.Errorf("height %d: got validate key %v, want %v",
+				test.height, isValidate, test.isValidate)
+		}
+	}
+	if result, _ := adminProof(base + 4); result.Hash != bestHash.String() {
+		t.Fatalf("got hash %s, want %s", result.Hash, bestHash)
+	}
+
+	// Proofs which were tampered with fail verification.
+	tamperTests := []struct {
+		name      string
+		stateHash chainhash.Hash
+		tamper    func(proof *adminstate.Proof)
+	}{
+		{
+			name:      "wrong admin state hash",
+			stateHash: chainhash.Hash{0x01},
+			tamper:    func(proof *adminstate.Proof) {},
+		},
+		{
+			name:      "dropped admin transaction",
+			stateHash: stateHash,
+			tamper: func(proof *adminstate.Proof) {
+				proof.AdminTxs = append(proof.AdminTxs[:1],
+					proof.AdminTxs[2:]...)
+			},
+		},
+		{
+			name:      "modified merkle branch",
+			stateHash: stateHash,
+			tamper: func(proof *adminstate.Proof) {
+				proof.AdminTxs[1].MerkleBranch[0][0] ^= 0x01
+			},
+		},
+		{
+			name:      "dropped header",
+			stateHash: stateHash,
+			tamper: func(proof *adminstate.Proof) {
+				proof.Headers = proof.Headers[:base+2]
+			},
+		},
+		{
+			name:      "unsigned header",
+			stateHash: stateHash,
+			tamper: func(proof *adminstate.Proof) {
+				header := &proof.Headers[base+3]
+				header.Timestamp = header.Timestamp.Add(time.Second)
+			},
+		},
+	}
+	for _, test := range tamperTests {
+		_, proof := adminProof(base + 4)
+		test.tamper(proof)
+		_, err := adminstate.VerifyValidateKey(proof, &genesisHash,
+			&test.stateHash, validateKey.PubKey())
+		var ruleErr adminstate.RuleError
+		if !errors.As(err, &ruleErr) ||
+			ruleErr.ErrorCode != adminstate.ErrInvalidProof {
+
+			t.Errorf("%s: got error %v, want ErrInvalidProof",
+				test.name, err)
+		}
+	}
+
+	// Heights after the best block are out of range.
+	cmd := btcjson.NewGetAdminProofCmd(base + 5)
+	_, err := handleGetAdminProof(h.rpcServer, cmd, nil)
+	rpcErr, ok := err.(*btcjson.RPCError)
+	if !ok || rpcErr.Code != btcjson.ErrRPCOutOfRange {
+		t.Fatalf("getadminproof: got error %v for height past the best "+
+			"block, want out of range", err)
+	}
+}
@@ -22,7 +22,7 @@ var helpDescsEnUS = map[string]string{
 		"The levelspec can either a debug level or of the form:\n" +
 		"<subsystem>=<level>,<subsystem2>=<level2>,...\n" +
 		"The valid debug levels are trace, debug, info, warn, error, and critical.\n" +
-		"The valid subsystems are AMGR, ADXR, BCDB, BMGR, CHAN, DISC, PEER, PRVA, RPCS, SCRP, SRVR, and TXMP.\n" +
+		"The valid subsystems are AMGR, ADXR, BCDB, BMGR, CHAN, DISC, HOOK, PEER, PRVA, RPCS, SCRP, SRVR, and TXMP.\n" +
 		"Finally the keyword 'show' will return a list of the available subsystems.",
 	"debuglevel-levelspec":   "The debug level(s) to use or the keyword 'show'",
 	"debuglevel--condition0": "levelspec!=show",
@@ -35,6 +35,34 @@ var helpDescsEnUS = map[string]string{
 	"addnode-addr":      "IP address and port of the peer to operate on",
 	"addnode-subcmd":    "'add' to add a persistent peer, 'remove' to remove a persistent peer, or 'onetry' to try a single connection to a peer",
 
+	// AddWatchCmd help.
+	"addwatch--synopsis": "Adds addresses and key IDs to the watchlist.\n" +
+		"Spends of outputs paying to an address or key ID on the watchlist are logged and sent as watchedspend notifications to websocket clients registered with notifywatchedspends and as events to the configured webhooks.\n" +
+		"The watchlist is persisted across restarts.",
+	"addwatch-addresses": "The Prova addresses to watch",
+	"addwatch-keyids":    "The key IDs to watch",
+
+	// BackupChainStateCmd help.
+	"backupchainstate--synopsis": "Writes a consistent backup of the block database as of the current best block to a new directory while the node keeps running.\n" +
+		"Block processing is paused only while pending writes are flushed and the database state is captured.\n" +
+		"The backup contains a copy of the database directory and a manifest listing the best block and the checksums of all files.",
+	"backupchainstate-destination": "The directory to write the backup to, which must not exist. Relative paths are relative to the data directory",
+
+	// BackupChainStateResult help.
+	"backupchainstateresult-destination":  "The absolute path of the backup directory",
+	"backupchainstateresult-manifest":     "The path of the manifest of the backup",
+	"backupchainstateresult-hash":         "The hash of the best block contained in the backup",
+	"backupchainstateresult-height":       "The height of the best block contained in the backup",
+	"backupchainstateresult-files":        "The number of database files in the backup",
+	"backupchainstateresult-bytes":        "The total size of the database files in the backup",
+	"backupchainstateresult-pauseseconds": "The number of seconds block processing was paused while the database state was captured",
+	"backupchainstateresult-seconds":      "The number of seconds the backup took to complete",
+
+	// CancelJobCmd help.
+	"canceljob--synopsis": "Cancels an RPC job started with startjob and waits for it to stop.\n" +
+		"Jobs which already finished are left as they are.",
+	"canceljob-id": "The id of the job returned by startjob",
+
 	// NodeCmd help.
 	"node--synopsis":     "Attempts to add or remove a peer.",
 	"node-subcmd":        "'disconnect' to remove all matching non-persistent peers, 'remove' to remove a persistent peer, or 'connect' to connect to a peer",
@@ -63,6 +91,7 @@ var helpDescsEnUS = map[string]string{
 
 	// PrevOut help.
 	"prevout-addresses": "previous output addresses",
+	"prevout-keyids":    "previous output key ids",
 	"prevout-value":     "previous output value",
 
 	// VinPrevOut help.
@@ -100,14 +129,95 @@ var helpDescsEnUS = map[string]string{
 	"txrawdecoderesult-vin":      "The transaction inputs as JSON objects",
 	"txrawdecoderesult-vout":     "The transaction outputs as JSON objects",
 
+	// DecodeBlockCmd help.
+	"decodeblock--synopsis": "Returns a JSON object representing the provided serialized, hex-encoded block along with the results of the context-free sanity checks for the current network.\n" +
+		"The block is not submitted to or looked up in the chain.",
+	"decodeblock-hexblock": "Serialized, hex-encoded block",
+	"decodeblock-strict":   "Additionally confirm the block is canonically encoded by serializing it again",
+
+	// DecodeBlockResult help.
+	"decodeblockresult-block":          "The decoded block in the same format as getblock with verbose transactions",
+	"decodeblockresult-sane":           "Whether the block passes the sanity checks",
+	"decodeblockresult-sanityerror":    "The reason the block fails the sanity checks (only when sane is false)",
+	"decodeblockresult-canonical":      "Whether the block is canonically encoded (only when strict is true)",
+	"decodeblockresult-canonicalerror": "The reason the block is not canonically encoded (only when canonical is false)",
+
+	// ExportBanListCmd help.
+	"exportbanlist--synopsis": "Returns the banned subnets in the order they were banned, in the format importbanlist accepts so the ban list can be shared between nodes.",
+
+	// BanListEntry help.
+	"banlistentry-subnet":  "The banned subnet in CIDR notation",
+	"banlistentry-reason":  "The reason of the ban, omitted when none was given",
+	"banlistentry-created": "The time the subnet was banned as a Unix timestamp",
+	"banlistentry-expires": "The time the ban expires as a Unix timestamp",
+
+	// ExportChainDataCmd help.
+	"exportchaindata--synopsis": "Writes a CSV file with a row summarizing each main chain block, with the height, hash, time, size, tx_count, fee_total, signer_key and admin_op_count columns, from a height to the best block.\n" +
+		"Exports from the genesis block are written to a new file starting with a header line, while exports from a later height are appended to an existing file to resume an export which stopped early.\n" +
+		"Large exports should be run in the background with startjob.",
+	"exportchaindata-destination": "The file to write the rows to. Relative paths are relative to the data directory",
+	"exportchaindata-startheight": "The height of the first block to export",
+
+	// ExportChainDataResult help.
+	"exportchaindataresult-destination": "The absolute path of the file the rows were written to",
+	"exportchaindataresult-startheight": "The height of the first block exported",
+	"exportchaindataresult-endheight":   "The height of the last block exported",
+	"exportchaindataresult-rows":        "The number of rows written",
+	"exportchaindataresult-bytes":       "The size of the file once the rows were written",
+	"exportchaindataresult-seconds":     "The number of seconds the export took to complete",
+
 	// DecodeRawTransactionCmd help.
 	"decoderawtransaction--synopsis": "Returns a JSON object representing the provided serialized, hex-encoded transaction.",
 	"decoderawtransaction-hextx":     "Serialized, hex-encoded transaction",
 
+	// SetBanCmd help.
+	"setban--synopsis": "Bans or lifts the ban of an IP address or of a whole subnet in CIDR notation.\n" +
+		"Connections from banned addresses are refused, banned addresses are neither connected to nor handed out to peers, and connected peers which become banned are disconnected.\n" +
+		"Bans are kept across restarts until they expire.",
+	"setban-subnet":   "The IP address or subnet in CIDR notation, such as 192.168.0.0/16 or 2001:db8::/32",
+	"setban-subcmd":   "'add' to ban the subnet or 'remove' to lift the ban of the subnet",
+	"setban-bantime":  "The number of seconds the subnet is banned for, or 0 to ban it for the duration set by the --banduration option",
+	"setban-absolute": "Whether the ban time is the time the ban expires as a Unix timestamp",
+	"setban-reason":   "The reason of the ban",
+
+	// SetPeerTraceCmd help.
+	"setpeertrace--synopsis": "Starts or stops capturing the raw messages exchanged with a peer to capture files in the directory set by the --peertracedir option.\n" +
+		"Each message is captured with its time and direction.  The capture files move on to a new file once they reach the size set by the --peertracemaxsize option.\n" +
+		"Messages are dropped rather than slowing down the peer when they can't be written fast enough.",
+	"setpeertrace-id":     "The id of the peer as returned by getpeerinfo",
+	"setpeertrace-enable": "Whether to start or stop capturing the messages of the peer",
+
+	// SetPeerTraceResult help.
+	"setpeertraceresult-id":      "The id of the peer",
+	"setpeertraceresult-enabled": "Whether the messages of the peer are captured",
+	"setpeertraceresult-prefix":  "The path prefix of the capture files the capture was started or stopped for, which are named by appending -<n>.cap to it; omitted when the peer was already in the requested state",
+	"setpeertraceresult-dropped": "The number of messages which were dropped rather than captured, as of when the capture was stopped",
+
 	// SetValidateKeysCmd help.
 	"setvalidatekeys--synopsis": "Sets the private keys to use to sign generated blocks",
 	"setvalidatekeys-privkeys":  "Hex-encoded 32 byte private keys",
 
+	// SimulateAdminTxCmd help.
+	"simulateadmintx--synopsis": "Validates a sequence of admin transactions against the current chain state as if they were included in the next block and returns the resulting admin state without modifying it.\n" +
+		"Each transaction is validated against the admin state left behind by the transactions before it.",
+	"simulateadmintx-hextxs": "Serialized, hex-encoded admin transactions in the order they are applied",
+
+	// SimulateAdminTxResult help.
+	"simulateadmintxresult-accepted":      "Whether all of the transactions were accepted",
+	"simulateadmintxresult-applied":       "The number of transactions, from the start of the sequence, which were accepted",
+	"simulateadmintxresult-rejectedtxid":  "The hash of the rejected transaction, only set when a transaction was rejected",
+	"simulateadmintxresult-rejectcode":    "The rule violation the transaction was rejected for, only set when a transaction was rejected",
+	"simulateadmintxresult-rejectreason":  "The description of the rule violation, only set when a transaction was rejected",
+	"simulateadmintxresult-threadtips":    "Unspent tx ids for admin threads after the accepted transactions",
+	"simulateadmintxresult-totalsupply":   "Net chain issuance value after the accepted transactions",
+	"simulateadmintxresult-supplydelta":   "The change of the net chain issuance value caused by the accepted transactions",
+	"simulateadmintxresult-lastkeyid":     "Last provisioned keyID after the accepted transactions",
+	"simulateadmintxresult-rootkeys":      "List of root pubKeys after the accepted transactions",
+	"simulateadmintxresult-provisionkeys": "List of provision pubKeys after the accepted transactions",
+	"simulateadmintxresult-issuekeys":     "List of issue pubKeys after the accepted transactions",
+	"simulateadmintxresult-validatekeys":  "List of validate pubKeys after the accepted transactions",
+	"simulateadmintxresult-aspkeys":       "Mapping of keyIDs to ASP pubKeys after the accepted transactions",
+
 	// DecodeScriptResult help.
 	"decodescriptresult-asm":       "Disassembly of the script",
 	"decodescriptresult-reqSigs":   "The number of required signatures",
@@ -211,6 +321,7 @@ var helpDescsEnUS = map[string]string{
 	"txrawresult-confirmations": "Number of confirmations of the block",
 	"txrawresult-time":          "Transaction time in seconds since 1 Jan 1970 GMT",
 	"txrawresult-blocktime":     "Block time in seconds since the 1 Jan 1970 GMT",
+	"txrawresult-fee":           "The fee paid by the transaction in RMG, which is zero for admin transactions (only for the transactions of blocks returned by getblock other than the coinbase)",
 
 	// SearchRawTransactionsResult help.
 	"searchrawtransactionsresult-hex":           "Hex-encoded transaction",
@@ -223,6 +334,7 @@ var helpDescsEnUS = map[string]string{
 	"searchrawtransactionsresult-confirmations": "Number of confirmations of the block",
 	"searchrawtransactionsresult-time":          "Transaction time in seconds since 1 Jan 1970 GMT",
 	"searchrawtransactionsresult-blocktime":     "Block time in seconds since the 1 Jan 1970 GMT",
+	"searchrawtransactionsresult-unconfirmed":   "Whether the transaction is in the mempool rather than confirmed in a block",
 
 	// GetBlockVerboseResult help.
 	"getblockverboseresult-hash":              "The hash of the block (same as provided)",
@@ -274,6 +386,13 @@ var helpDescsEnUS = map[string]string{
 	"getblockheaderverboseresult-signature":         "The signature of this block by the validator who created it",
 	"getblockheaderverboseresult-validatingpubkey":  "The validating public key of the block",
 
+	// GetBlockRawCmd help.
+	"getblockraw--synopsis": "Returns a byte range of the serialized block with the given hash as a hex-encoded string.",
+	"getblockraw-hash":      "The hash of the block",
+	"getblockraw-offset":    "The offset of the range from the start of the serialized block",
+	"getblockraw-length":    "The length of the range (default: the remainder of the block)",
+	"getblockraw--result0":  "Hex-encoded bytes of the requested range of the serialized block",
+
 	// TemplateRequest help.
 	"templaterequest-mode":         "This is 'template', 'proposal', or omitted",
 	"templaterequest-capabilities": "List of capabilities",
@@ -380,14 +499,54 @@ var helpDescsEnUS = map[string]string{
 	"infowalletresult-errors":          "Any current errors",
 
 	// GetHeadersCmd help.
-	"getheaders--synopsis":     "Returns block headers starting with the first known block hash from the request",
+	"getheaders--synopsis":     "Returns block headers starting with the first known block hash from the request.  The headers are located the same way as for the getheaders wire message",
 	"getheaders-blocklocators": "JSON array of hex-encoded hashes of blocks.  Headers are returned starting from the first known hash in this list",
-	"getheaders-hashstop":      "Block hash to stop including block headers for; if not found, all headers to the latest known block are returned.",
+	"getheaders-hashstop":      "Block hash to stop including block headers for; if omitted or not found, all headers to the latest known block are returned.",
+	"getheaders-verbose":       "Specifies the block headers are returned as JSON objects instead of hex-encoded strings",
+	"getheaders--condition0":   "verbose=false",
+	"getheaders--condition1":   "verbose=true",
 	"getheaders--result0":      "Serialized block headers of all located blocks, limited to some arbitrary maximum number of hashes (currently 2000, which matches the wire protocol headers message, but this is not guaranteed)",
 
 	// GetInfoCmd help.
 	"getinfo--synopsis": "Returns a JSON object containing various state info.",
 
+	// GetJobStatusCmd help.
+	"getjobstatus--synopsis": "Returns the state, progress and result of an RPC job started with startjob.\n" +
+		"The status of finished jobs is kept for the duration set by the rpcjobttl option.",
+	"getjobstatus-id": "The id of the job returned by startjob",
+
+	// JobStatusResult help.
+	"jobstatusresult-id":       "The id of the job",
+	"jobstatusresult-method":   "The command the job runs",
+	"jobstatusresult-state":    "The state of the job: running, completed, failed or cancelled",
+	"jobstatusresult-progress": "The estimated fraction of the work of the job which is done, between 0 and 1",
+	"jobstatusresult-started":  "The time the job started in seconds since 1 Jan 1970 GMT",
+	"jobstatusresult-finished": "The time the job finished in seconds since 1 Jan 1970 GMT, omitted while it is running",
+	"jobstatusresult-eta":      "The estimated number of seconds until the job completes, omitted until it reports progress",
+	"jobstatusresult-result":   "The result of the command once the job completed, or the partial result of a running job when the command reports one",
+	"jobstatusresult-error":    "The error of a job which failed or was cancelled",
+
+	// GetMempoolEntryCmd help.
+	"getmempoolentry--synopsis": "Returns information about a transaction in the memory pool.",
+	"getmempoolentry-txid":      "The hash of the transaction",
+
+	// GetMempoolEntryResult help.
+	"getmempoolentryresult-size":             "Transaction size in bytes",
+	"getmempoolentryresult-fee":              "Transaction fee in RMG",
+	"getmempoolentryresult-modifiedfee":      "Transaction fee in RMG including the adjustment made with prioritisetransaction",
+	"getmempoolentryresult-time":             "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
+	"getmempoolentryresult-height":           "Block height when transaction entered the pool",
+	"getmempoolentryresult-startingpriority": "Priority when transaction entered the pool",
+	"getmempoolentryresult-currentpriority":  "Current priority",
+	"getmempoolentryresult-descendantcount":  "Number of in-mempool descendant transactions, including this one",
+	"getmempoolentryresult-descendantsize":   "Size in bytes of in-mempool descendants, including this one",
+	"getmempoolentryresult-descendantfees":   "Modified fees in RMG of in-mempool descendants, including this one",
+	"getmempoolentryresult-ancestorcount":    "Number of in-mempool ancestor transactions, including this one",
+	"getmempoolentryresult-ancestorsize":     "Size in bytes of in-mempool ancestors, including this one",
+	"getmempoolentryresult-ancestorfees":     "Modified fees in RMG of in-mempool ancestors, including this one",
+	"getmempoolentryresult-depends":          "Unconfirmed transactions used as inputs for this transaction",
+	"getmempoolentryresult-expirytime":       "Time the transaction expires from the pool in seconds since 1 Jan 1970 GMT, omitted when it never expires",
+
 	// GetMempoolInfoCmd help.
 	"getmempoolinfo--synopsis": "Returns memory pool information",
 
@@ -395,18 +554,45 @@ var helpDescsEnUS = map[string]string{
 	"getmempoolinforesult-bytes": "Size in bytes of the mempool",
 	"getmempoolinforesult-size":  "Number of transactions in the mempool",
 
+	// GetMempoolSnapshotCmd help.
+	"getmempoolsnapshot--synopsis": "Returns a consistent snapshot of the transactions in the memory pool along with the sequence number of the pool.\n" +
+		"The sequence number is incremented each time a transaction is added to, removed from or prioritised in the pool, so two snapshots with the same sequence number hold the same transactions.",
+	"getmempoolsnapshot-includerawtx": "Include the hex-encoded serialized transactions",
+
+	// GetNextKeyIDCmd help.
+	"getnextkeyid--synopsis": "Returns the lowest keyID which was never provisioned in the best chain, which is the keyID the next ASP key must be provisioned with.\n" +
+		"KeyIDs which were revoked are not reported since they can only be provisioned again to the key they were bound to.",
+	"getnextkeyid--result0": "The next keyID to provision",
+
+	// GetMempoolSnapshotResult help.
+	"getmempoolsnapshotresult-sequence": "The sequence number of the memory pool when the snapshot was taken",
+	"getmempoolsnapshotresult-entries":  "The transactions in the memory pool, ordered by the time they entered the pool",
+
+	// MempoolSnapshotEntry help.
+	"mempoolsnapshotentry-txid":        "The hash of the transaction",
+	"mempoolsnapshotentry-size":        "Transaction size in bytes",
+	"mempoolsnapshotentry-fee":         "Transaction fee in RMG",
+	"mempoolsnapshotentry-modifiedfee": "Transaction fee in RMG including the adjustment made with prioritisetransaction",
+	"mempoolsnapshotentry-time":        "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
+	"mempoolsnapshotentry-height":      "Block height when transaction entered the pool",
+	"mempoolsnapshotentry-depends":     "Unconfirmed transactions in the pool used as inputs for this transaction",
+	"mempoolsnapshotentry-spentby":     "Unconfirmed transactions in the pool spending outputs of this transaction",
+	"mempoolsnapshotentry-hex":         "The hex-encoded serialized transaction, only included when requested",
+
 	// GetMiningInfoResult help.
-	"getmininginforesult-blocks":           "Height of the latest best block",
-	"getmininginforesult-currentblocksize": "Size of the latest best block",
-	"getmininginforesult-currentblocktx":   "Number of transactions in the latest best block",
-	"getmininginforesult-difficulty":       "Current target difficulty",
-	"getmininginforesult-errors":           "Any current errors",
-	"getmininginforesult-generate":         "Whether or not server is set to generate coins",
-	"getmininginforesult-genproclimit":     "Number of processors to use for coin generation (-1 when disabled)",
-	"getmininginforesult-hashespersec":     "Recent hashes per second performance measurement while generating coins",
-	"getmininginforesult-networkhashps":    "Estimated network hashes per second for the most recent blocks",
-	"getmininginforesult-pooledtx":         "Number of transactions in the memory pool",
-	"getmininginforesult-testnet":          "Whether or not server is using testnet",
+	"getmininginforesult-blockmaxsize":          "Maximum size of the blocks generated by this node, a soft cap below the consensus limit which admin transactions may exceed",
+	"getmininginforesult-blocks":                "Height of the latest best block",
+	"getmininginforesult-consensusmaxblocksize": "Maximum size of the blocks accepted by consensus",
+	"getmininginforesult-currentblocksize":      "Size of the latest best block",
+	"getmininginforesult-currentblocktx":        "Number of transactions in the latest best block",
+	"getmininginforesult-difficulty":            "Current target difficulty",
+	"getmininginforesult-errors":                "Any current errors",
+	"getmininginforesult-generate":              "Whether or not server is set to generate coins",
+	"getmininginforesult-genproclimit":          "Number of processors to use for coin generation (-1 when disabled)",
+	"getmininginforesult-hashespersec":          "Recent hashes per second performance measurement while generating coins",
+	"getmininginforesult-networkhashps":         "Estimated network hashes per second for the most recent blocks",
+	"getmininginforesult-pooledtx":              "Number of transactions in the memory pool",
+	"getmininginforesult-testnet":               "Whether or not server is using testnet",
 
 	// GetMiningInfoCmd help.
 	"getmininginfo--synopsis": "Returns a JSON object containing mining-related information.",
@@ -425,28 +611,55 @@ var helpDescsEnUS = map[string]string{
 	"getnettotalsresult-totalbytessent": "Total bytes sent",
 	"getnettotalsresult-timemillis":     "Number of milliseconds since 1 Jan 1970 GMT",
 
+	// GetNetworkInfoCmd help.
+	"getnetworkinfo--synopsis": "Returns a JSON object containing information about the peer-to-peer network state.",
+
+	// GetNetworkInfoResult help.
+	"getnetworkinforesult-version":         "The version of the server",
+	"getnetworkinforesult-protocolversion": "The latest supported protocol version",
+	"getnetworkinforesult-timeoffset":      "The time offset",
+	"getnetworkinforesult-connections":     "The number of connected peers",
+	"getnetworkinforesult-listening":       "Whether or not the server is listening for incoming connections",
+	"getnetworkinforesult-outboundonly":    "Whether or not the server only connects to the peers specified with --connect without listening or advertising addresses",
+	"getnetworkinforesult-networks":        "Information about each network peers are connected over",
+	"getnetworkinforesult-relayfee":        "The minimum relay fee for non-free transactions in RMG/KB",
+	"getnetworkinforesult-localaddresses":  "The local addresses advertised to peers",
+
+	// NetworksResult help.
+	"networksresult-name":      "The name of the network (ipv4, ipv6, or onion)",
+	"networksresult-limited":   "Whether or not connections are limited to the network",
+	"networksresult-reachable": "Whether or not peers on the network can be connected to",
+	"networksresult-proxy":     "The proxy used to connect to peers on the network, if any",
+
+	// LocalAddressesResult help.
+	"localaddressesresult-address": "The local address",
+	"localaddressesresult-port":    "The port of the local address",
+	"localaddressesresult-score":   "The priority the address is chosen by when advertised",
+
 	// GetPeerInfoResult help.
-	"getpeerinforesult-id":             "A unique node ID",
-	"getpeerinforesult-addr":           "The ip address and port of the peer",
-	"getpeerinforesult-addrlocal":      "Local address",
-	"getpeerinforesult-services":       "Services bitmask which represents the services supported by the peer",
-	"getpeerinforesult-relaytxes":      "Peer has requested transactions be relayed to it",
-	"getpeerinforesult-lastsend":       "Time the last message was received in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-lastrecv":       "Time the last message was sent in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-bytessent":      "Total bytes sent",
-	"getpeerinforesult-bytesrecv":      "Total bytes received",
-	"getpeerinforesult-conntime":       "Time the connection was made in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-timeoffset":     "The time offset of the peer",
-	"getpeerinforesult-pingtime":       "Number of microseconds the last ping took",
-	"getpeerinforesult-pingwait":       "Number of microseconds a queued ping has been waiting for a response",
-	"getpeerinforesult-version":        "The protocol version of the peer",
-	"getpeerinforesult-subver":         "The user agent of the peer",
-	"getpeerinforesult-inbound":        "Whether or not the peer is an inbound connection",
-	"getpeerinforesult-startingheight": "The latest block height the peer knew about when the connection was established",
-	"getpeerinforesult-currentheight":  "The current height of the peer",
-	"getpeerinforesult-banscore":       "The ban score",
-	"getpeerinforesult-feefilter":      "The requested minimum fee a transaction must have to be announced to the peer",
-	"getpeerinforesult-syncnode":       "Whether or not the peer is the sync peer",
+	"getpeerinforesult-id":              "A unique node ID",
+	"getpeerinforesult-addr":            "The ip address and port of the peer",
+	"getpeerinforesult-addrlocal":       "Local address",
+	"getpeerinforesult-services":        "Services bitmask which represents the services supported by the peer",
+	"getpeerinforesult-relaytxes":       "Peer has requested transactions be relayed to it",
+	"getpeerinforesult-lastsend":        "Time the last message was received in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-lastrecv":        "Time the last message was sent in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-bytessent":       "Total bytes sent",
+	"getpeerinforesult-bytesrecv":       "Total bytes received",
+	"getpeerinforesult-conntime":        "Time the connection was made in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-timeoffset":      "The time offset of the peer",
+	"getpeerinforesult-pingtime":        "Number of microseconds the last ping took",
+	"getpeerinforesult-pingwait":        "Number of microseconds a queued ping has been waiting for a response",
+	"getpeerinforesult-version":         "The protocol version advertised by the peer",
+	"getpeerinforesult-protocolversion": "The protocol version negotiated with the peer",
+	"getpeerinforesult-subver":          "The user agent of the peer",
+	"getpeerinforesult-inbound":         "Whether or not the peer is an inbound connection",
+	"getpeerinforesult-startingheight":  "The latest block height the peer knew about when the connection was established",
+	"getpeerinforesult-currentheight":   "The current height of the peer",
+	"getpeerinforesult-banscore":        "The ban score",
+	"getpeerinforesult-feefilter":       "The requested minimum fee a transaction must have to be announced to the peer",
+	"getpeerinforesult-syncnode":        "Whether or not the peer is the sync peer",
+	"getpeerinforesult-deprioritized":   "Whether or not the user agent of the peer matched a deprioritizeuseragent pattern",
 
 	// GetPeerInfoCmd help.
 	"getpeerinfo--synopsis": "Returns data about each connected network peer as an array of json objects.",
@@ -475,6 +688,397 @@ var helpDescsEnUS = map[string]string{
 	"getrawtransaction--condition1": "verbose=true",
 	"getrawtransaction--result0":    "Hex-encoded bytes of the serialized transaction",
 
+	// GetBlockProductionInfoCmd help.
+	"getblockproductioninfo--synopsis": "Returns statistics about the production of the most recent blocks of the main chain, such as the intervals between them and the number of blocks signed by each validate key.",
+	"getblockproductioninfo-blocks":    "The number of most recent blocks of the main chain to compute the statistics over",
+
+	// BlockProductionKeyResult help.
+	"blockproductionkeyresult-pubkey": "The hex-encoded validate public key",
+	"blockproductionkeyresult-blocks": "The number of blocks signed by the key",
+
+	// GetBlockProductionInfoResult help.
+	"getblockproductioninforesult-height":           "The height of the best block",
+	"getblockproductioninforesult-blocks":           "The number of blocks the statistics cover, which is less than requested when the chain is shorter",
+	"getblockproductioninforesult-intervals":        "The number of intervals between the blocks and their parents, which excludes the genesis block",
+	"getblockproductioninforesult-targetinterval":   "The target interval between blocks in seconds",
+	"getblockproductioninforesult-meaninterval":     "The mean interval between blocks in seconds",
+	"getblockproductioninforesult-medianinterval":   "The median interval between blocks in seconds",
+	"getblockproductioninforesult-p95interval":      "The 95th percentile of the intervals between blocks in seconds",
+	"getblockproductioninforesult-deviation":        "The difference between the mean and the target interval in seconds",
+	"getblockproductioninforesult-deviationpercent": "The difference between the mean and the target interval as a percentage of the target interval",
+	"getblockproductioninforesult-validatekeys":     "The number of blocks signed by each validate key, ordered by the number of blocks",
+
+	// GetAddrManInfoCmd help.
+	"getaddrmaninfo--synopsis": "Returns the number of addresses known to the address manager and the number of addresses and announcements of local addresses which were not relayed to peers to keep them private.",
+
+	// GetAddrManInfoResult help.
+	"getaddrmaninforesult-addresses":            "The number of addresses known to the address manager",
+	"getaddrmaninforesult-new":                  "The number of addresses which were never connected to successfully",
+	"getaddrmaninforesult-tried":                "The number of addresses which were connected to successfully",
+	"getaddrmaninforesult-suppressedunroutable": "The number of unroutable addresses which were not relayed to peers",
+	"getaddrmaninforesult-suppressedprivate":    "The number of addresses in the networks configured with --privatenet which were not relayed to peers",
+	"getaddrmaninforesult-suppressedself":       "The number of announcements of local addresses which were suppressed by --noadvertise",
+
+	// GetAdminProofCmd help.
+	"getadminproof--synopsis": "Returns a proof of the admin state as of the main chain block at a height, which can be verified without the chain by trusting the hash of the checkpoint block it starts from and the hash of the admin state as of that block.\n" +
+		"The proof starts from the most recent checkpoint at or before the height, or from the genesis block when there is none.",
+	"getadminproof-height": "The height of the block",
+
+	// GetAdminProofResult help.
+	"getadminproofresult-height":           "The height of the block the proof is for",
+	"getadminproofresult-hash":             "The hash of the block the proof is for",
+	"getadminproofresult-checkpointheight": "The height of the checkpoint block the proof starts from",
+	"getadminproofresult-checkpointhash":   "The hash of the checkpoint block the proof starts from",
+	"getadminproofresult-statehash":        "The hash of the serialized admin state as of the checkpoint block",
+	"getadminproofresult-numheaders":       "The number of block headers after the checkpoint block in the proof",
+	"getadminproofresult-numadmintxs":      "The number of admin transactions in the proof",
+	"getadminproofresult-proof":            "The hex-encoded serialized proof",
+
+	// GetBlockAdminOpsCmd help.
+	"getblockadminops--synopsis": "Returns the admin operations performed by a block, in the order of its transactions, along with the admin state each of them results in.\n" +
+		"The block may be in a side chain, in which case the admin state is that of the side chain.",
+	"getblockadminops-hash": "The hash of the block",
+
+	// GetBlockAdminOpsResult help.
+	"getblockadminopsresult-hash":      "The hash of the block",
+	"getblockadminopsresult-height":    "The height of the block",
+	"getblockadminopsresult-mainchain": "Whether the block is in the main chain",
+	"getblockadminopsresult-ops":       "The admin operations of the block, empty when the block has no admin transactions",
+
+	// AdminOpResult help.
+	"adminopresult-txid":        "The hash of the admin transaction",
+	"adminopresult-thread":      "The admin thread of the transaction (root, provision or issue)",
+	"adminopresult-op":          "The operation (ADD_KEY, REVOKE_KEY, ISSUE, DESTROY or UNKNOWN_OP for operations reserved for later soft forks)",
+	"adminopresult-keyset":      "The key set of the affected key, only set for key operations",
+	"adminopresult-pubkey":      "The affected public key, only set for key operations",
+	"adminopresult-keyid":       "The keyID of the affected ASP key, only set for ASP key operations",
+	"adminopresult-amount":      "The amount issued or destroyed, only set for issuance and destruction",
+	"adminopresult-setsize":     "The number of keys in the affected key set, or of provisioned ASP keyIDs, after the operation; only set for key operations",
+	"adminopresult-totalsupply": "Net chain issuance value after the operation, only set for issuance and destruction",
+
+	// GetBlockCommitmentCmd help.
+	"getblockcommitment--synopsis": "Returns the commitment anchored in the coinbase of a block.",
+	"getblockcommitment-hash":      "The hash of the block",
+
+	// GetBlockCommitmentResult help.
+	"getblockcommitmentresult-hash":       "The hash of the block",
+	"getblockcommitmentresult-height":     "The height of the block",
+	"getblockcommitmentresult-commitment": "The hex-encoded commitment (omitted when the block does not commit to anything)",
+
+	// ScrubCorruptBlockResult help.
+	"scrubcorruptblockresult-hash":     "The hash of the corrupt block",
+	"scrubcorruptblockresult-height":   "The height of the corrupt block",
+	"scrubcorruptblockresult-detected": "Unix time the corruption was detected",
+
+	// GetScrubStatusResult help.
+	"getscrubstatusresult-enabled":         "Whether or not background scrubbing of the stored blocks is enabled",
+	"getscrubstatusresult-scanning":        "Whether or not a scrub pass is currently in progress",
+	"getscrubstatusresult-scanheight":      "Height of the block most recently verified by the current or last scrub pass",
+	"getscrubstatusresult-passes":          "Number of scrub passes completed since startup",
+	"getscrubstatusresult-lastpassstart":   "Unix time the current or last scrub pass started",
+	"getscrubstatusresult-lastpassend":     "Unix time the last scrub pass completed",
+	"getscrubstatusresult-blockschecked":   "Number of blocks verified by scrubbing since startup",
+	"getscrubstatusresult-corruptdetected": "Number of corrupt blocks detected since startup",
+	"getscrubstatusresult-repaired":        "Number of corrupt blocks re-downloaded from peers and repaired since startup",
+	"getscrubstatusresult-corruptblocks":   "Corrupt blocks which are waiting to be re-downloaded from peers",
+
+	// GetBroadcastStatusCmd help.
+	"getbroadcaststatus--synopsis": "Returns the status of the submissions of a block produced by this node to the endpoints configured with the --broadcasturl option.\n" +
+		"The status is kept for the most recent blocks produced by this node while it is running.",
+	"getbroadcaststatus-hash": "The hash of the block",
+
+	// GetBroadcastStatusResult help.
+	"getbroadcaststatusresult-hash":      "The hash of the block",
+	"getbroadcaststatusresult-height":    "The height of the block",
+	"getbroadcaststatusresult-endpoints": "The submissions of the block to each endpoint",
+
+	// BroadcastEndpointResult help.
+	"broadcastendpointresult-url":         "The URL of the endpoint",
+	"broadcastendpointresult-status":      "The status of the submission (pending, succeeded, or failed)",
+	"broadcastendpointresult-attempts":    "The number of submission attempts made so far",
+	"broadcastendpointresult-error":       "The error of the most recent failed attempt, omitted when the submission succeeded",
+	"broadcastendpointresult-lastattempt": "Unix time of the most recent attempt, or 0 when no attempt was made yet",
+
+	// GetChainParamsCmd help.
+	"getchainparams--synopsis": "Returns the parameters of the active network, such as its magic bytes, address prefixes, block interval, and initial admin keys.",
+
+	// ChainParamsDNSSeedResult help.
+	"chainparamsdnsseedresult-host":         "The hostname of the seed",
+	"chainparamsdnsseedresult-hasfiltering": "Whether or not the seed supports filtering by service flags",
+
+	// ChainParamsCheckpointResult help.
+	"chainparamscheckpointresult-height": "The height of the checkpoint block",
+	"chainparamscheckpointresult-hash":   "The hash of the checkpoint block",
+
+	// GetChainParamsResult help.
+	"getchainparamsresult-name":                     "The name of the network",
+	"getchainparamsresult-net":                      "The magic bytes identifying the network as a number",
+	"getchainparamsresult-defaultport":              "The default peer-to-peer port",
+	"getchainparamsresult-dnsseeds":                 "The DNS seeds used to discover peers",
+	"getchainparamsresult-genesisblock":             "The hex-encoded serialized genesis block",
+	"getchainparamsresult-genesishash":              "The hash of the genesis block",
+	"getchainparamsresult-adminkeysets":             "The hex-encoded initial admin public keys keyed by the name of their key set",
+	"getchainparamsresult-aspkeyids":                "The hex-encoded initial ASP public keys keyed by their key id",
+	"getchainparamsresult-adminkeysets--key":        "keyset",
+	"getchainparamsresult-adminkeysets--value":      "[\"pubkey\",...]",
+	"getchainparamsresult-adminkeysets--desc":       "The name of the key set (ROOT, PROVISION, ISSUE, VALIDATE, or ASP) as the key and its public keys as the value",
+	"getchainparamsresult-aspkeyids--key":           "keyid",
+	"getchainparamsresult-aspkeyids--value":         "pubkey",
+	"getchainparamsresult-aspkeyids--desc":          "The key id as the key and the public key as the value",
+	"getchainparamsresult-powlimit":                 "The hex-encoded highest allowed proof of work value",
+	"getchainparamsresult-powlimitbits":             "The highest allowed proof of work value in compact form",
+	"getchainparamsresult-coinbasematurity":         "The number of blocks before coinbase outputs can be spent",
+	"getchainparamsresult-subsidyreductioninterval": "The number of blocks between subsidy reductions",
+	"getchainparamsresult-targettimeperblock":       "The target time between blocks as a duration such as 2m30s",
+	"getchainparamsresult-generatesupported":        "Whether or not CPU mining is allowed",
+	"getchainparamsresult-checkpoints":              "The checkpoints ordered from oldest to newest",
+	"getchainparamsresult-blockenforcenumrequired":  "The number of blocks with the current version required to enforce it",
+	"getchainparamsresult-blockrejectnumrequired":   "The number of blocks with the current version required to reject older versions",
+	"getchainparamsresult-blockupgradenumtocheck":   "The number of blocks checked for block version upgrades",
+	"getchainparamsresult-relaynonstdtxs":           "Whether or not non-standard transactions are relayed",
+	"getchainparamsresult-provaaddrid":              "The first byte of a Prova address",
+	"getchainparamsresult-privatekeyid":             "The first byte of a WIF private key",
+	"getchainparamsresult-hdprivatekeyid":           "The hex-encoded magic of extended private keys",
+	"getchainparamsresult-hdpublickeyid":            "The hex-encoded magic of extended public keys",
+	"getchainparamsresult-hdcointype":               "The BIP44 coin type",
+	"getchainparamsresult-powaveragingwindow":       "The number of blocks averaged over when adjusting the difficulty",
+	"getchainparamsresult-powmaxadjustdown":         "The maximum downward difficulty adjustment as a percentage",
+	"getchainparamsresult-powmaxadjustup":           "The maximum upward difficulty adjustment as a percentage",
+	"getchainparamsresult-chaintrailingsigkeylimit": "The maximum number of consecutive blocks signed by a single validate key",
+	"getchainparamsresult-chainwindowsharelimit":    "The maximum share of blocks signed by a single validate key as a percentage",
+	"getchainparamsresult-maximumfeeamount":         "The maximum fee allowed in a single transaction in atoms",
+	"getchainparamsresult-maxblocktransactions":     "The maximum number of transactions a block may contain, including the coinbase",
+	"getchainparamsresult-strictmonotonictime":      "Whether each block timestamp must be after the timestamp of its parent",
+	"getchainparamsresult-timeregressionwindow":     "The number of most recent blocks whose latest timestamp limits how far back the timestamp of the next block may go, or 0 when the limit is disabled",
+	"getchainparamsresult-maxtimeregression":        "How much earlier than the latest timestamp of the time regression window a block timestamp may be as a duration such as 5m0s",
+	"getchainparamsresult-scriptversions":           "Whether outputs may carry a script version, with unknown versions being anyone-can-spend",
+	"getchainparamsresult-rejectdoublesigners":      "Whether blocks signed by a validate key which signed two different blocks at the same height are rejected until the key is provisioned again",
+	"getchainparamsresult-powonly":                  "Whether blocks are accepted on proof of work alone without a validate key signature",
+	"getchainparamsresult-upgradableadminops":       "Whether admin operations with op types reserved for later soft forks are accepted and ignored",
+	"getchainparamsresult-burnfees":                 "Whether the coinbase may pay less than the subsidy and fees of its block, burning the remainder",
+	"getchainparamsresult-reprovisionkeyids":        "Whether a revoked keyID may be provisioned again to the ASP key it was bound to",
+	"getchainparamsresult-txexpiry":                 "Whether transactions of version 3 carry an expiry height at or after which they can't be included in a block",
+
+	// GetChainSplitInfoCmd help.
+	"getchainsplitinfo--synopsis": "Compares the best block known of each connected peer, as learned from its version, inv, and headers messages and the blocks it sent, against the best chain and returns the tips the peers are on.\n" +
+		"A chain split is reported when more than the configured fraction of the peers whose best block is known have diverged from the best chain by more than the configured depth for longer than the configured duration.\n" +
+		"Chain splits are logged, delivered to the configured webhooks, and exposed in the Prometheus text format by the /metrics endpoint of the RPC server.",
+
+	// GetChainSplitInfoResult help.
+	"getchainsplitinforesult-hash":           "The hash of the best block",
+	"getchainsplitinforesult-height":         "The height of the best block",
+	"getchainsplitinforesult-fraction":       "A chain split is reported when more than this fraction of the peers whose best block is known diverge",
+	"getchainsplitinforesult-depth":          "Peers diverge when their best block diverges from the best chain by more than this number of blocks",
+	"getchainsplitinforesult-duration":       "The number of seconds the peers must diverge before a chain split is reported",
+	"getchainsplitinforesult-current":        "Whether the chain is synced with the peers, chain splits are only detected while it is",
+	"getchainsplitinforesult-peers":          "The number of connected peers",
+	"getchainsplitinforesult-knownpeers":     "The number of connected peers whose best block is known",
+	"getchainsplitinforesult-divergedpeers":  "The number of peers whose best block diverges from the best chain by more than depth blocks",
+	"getchainsplitinforesult-split":          "Whether more than the fraction of the peers diverge",
+	"getchainsplitinforesult-divergingsince": "Unix time since when more than the fraction of the peers diverge",
+	"getchainsplitinforesult-warned":         "Whether the ongoing chain split was reported",
+	"getchainsplitinforesult-warnings":       "The number of chain splits reported since the server started",
+	"getchainsplitinforesult-tips":           "The best blocks the peers are on ordered by descending number of peers and then by descending height",
+
+	// ChainSplitTipResult help.
+	"chainsplittipresult-hash":       "The hash of the block, omitted when only the height advertised by the peers is known",
+	"chainsplittipresult-height":     "The height of the block",
+	"chainsplittipresult-status":     "The status of the block relative to the best chain (active, behind, fork, unknown, heightonly)",
+	"chainsplittipresult-divergence": "The number of blocks of the higher of the block and the best block past the most recent block both chains share",
+	"chainsplittipresult-peers":      "The peers on the block",
+
+	// ChainSplitPeerResult help.
+	"chainsplitpeerresult-id":   "A unique node ID",
+	"chainsplitpeerresult-addr": "The ip address and port of the peer",
+
+	// GetThreadInfoCmd help.
+	"getthreadinfo--synopsis": "Returns the tip of each admin thread of the best chain, the height at which it was last advanced, and the number of admin transactions for it pending in the memory pool.\n" +
+		"A thread is reported stuck when it has not advanced for more than the configured number of blocks while admin transactions for it are pending.\n" +
+		"Stuck threads are logged and delivered to the configured webhooks.",
+
+	// GetThreadInfoResult help.
+	"getthreadinforesult-hash":        "The hash of the best block",
+	"getthreadinforesult-height":      "The height of the best block",
+	"getthreadinforesult-stuckblocks": "A thread is reported stuck when it has not advanced for more than this number of blocks while admin transactions for it are pending",
+	"getthreadinforesult-warnings":    "The number of stuck threads reported since the server started",
+	"getthreadinforesult-threads":     "The admin threads ordered by thread ID",
+
+	// ThreadInfoResult help.
+	"threadinforesult-id":             "ID of admin thread",
+	"threadinforesult-name":           "Name of admin thread",
+	"threadinforesult-outpoint":       "Outpoint of current tip of admin thread",
+	"threadinforesult-advancedheight": "The height of the block which last advanced the thread",
+	"threadinforesult-pendingtxs":     "The number of admin transactions for the thread pending in the memory pool",
+	"threadinforesult-pendingsince":   "The height of the best block when the pending transactions were first seen, omitted when none are pending",
+	"threadinforesult-stalledblocks":  "The number of blocks the thread has not advanced for while transactions are pending",
+	"threadinforesult-stuck":          "Whether the thread has not advanced for more than stuckblocks blocks while transactions are pending",
+
+	// GetDoubleSignsCmd help.
+	"getdoublesigns--synopsis": "Returns the evidence of validate keys which signed two different blocks at the same height, ordered by the time the double signs were detected.\n" +
+		"Double signs are persisted across restarts, logged, and delivered to the configured webhooks when detected.",
+
+	// GetDoubleSignsResult help.
+	"getdoublesignsresult-rejectdoublesigners": "Whether blocks signed by a validate key which double signed are rejected until the key is provisioned again",
+	"getdoublesignsresult-doublesigns":         "The double signs ordered by the time they were detected",
+
+	// DoubleSignResult help.
+	"doublesignresult-validatingpubkey": "The hex-encoded validate key which signed both blocks",
+	"doublesignresult-height":           "The height of both blocks",
+	"doublesignresult-firsthash":        "The hash of the block which was accepted first",
+	"doublesignresult-firstheader":      "The hex-encoded serialized header of the block which was accepted first",
+	"doublesignresult-secondhash":       "The hash of the block whose acceptance revealed the double sign",
+	"doublesignresult-secondheader":     "The hex-encoded serialized header of the block whose acceptance revealed the double sign",
+	"doublesignresult-detected":         "Unix time when the double sign was detected",
+	"doublesignresult-clearedheight":    "The height of the block which provisioned the key again, omitted when it was not provisioned again",
+	"doublesignresult-rejected":         "Whether blocks signed by the key are currently rejected",
+
+	// GetErrorStatsCmd help.
+	"geterrorstats--synopsis": "Returns the number of blocks and transactions rejected by level and error code.\n" +
+		"The counts are persisted across restarts and are also exposed in the Prometheus text format by the /metrics endpoint of the RPC server.",
+
+	// GetErrorStatsResult help.
+	"geterrorstatsresult-errors": "The rejections by level and error code ordered by level and then by code",
+
+	// ErrorCountResult help.
+	"errorcountresult-level": "The level the rejection happened at (block or mempool)",
+	"errorcountresult-code":  "The name of the error code, a rule error code for blocks and either a rule error code or a reject code for transactions",
+	"errorcountresult-count": "The number of rejections with the error code at the level",
+
+	// GetPeerStatsCmd help.
+	"getpeerstats--synopsis": "Returns the cumulative statistics of the peers connected to most recently.\n" +
+		"The statistics are persisted across restarts and updated each time a peer disconnects.",
+	"getpeerstats-sortby": "The field to sort the peers by in descending order (lastconnected, bytessent, bytesrecv, blocksserved, blocksreceived, connections, or banscore)",
+	"getpeerstats-count":  "The maximum number of peers to return",
+
+	// GetPeerStatsResult help.
+	"getpeerstatsresult-addr":           "The address of the peer",
+	"getpeerstatsresult-bytessent":      "Total bytes sent to the peer",
+	"getpeerstatsresult-bytesrecv":      "Total bytes received from the peer",
+	"getpeerstatsresult-blocksserved":   "Total blocks sent to the peer in response to its requests",
+	"getpeerstatsresult-blocksreceived": "Total blocks received from the peer",
+	"getpeerstatsresult-connections":    "Number of completed connections to the peer",
+	"getpeerstatsresult-lastconnected":  "Unix time the most recent connection to the peer was established",
+	"getpeerstatsresult-banscores":      "The most recent non-zero misbehavior scores the peer disconnected with",
+
+	// PeerBanScoreResult help.
+	"peerbanscoreresult-time":  "Unix time the score was recorded",
+	"peerbanscoreresult-score": "The misbehavior score",
+
+	// GetPolicyInfoCmd help.
+	"getpolicyinfo--synopsis": "Returns the policy the memory pool applies to transactions before accepting and relaying them.\n" +
+		"The policy does not affect the validity of blocks.",
+
+	// GetPolicyInfoResult help.
+	"getpolicyinforesult-acceptnonstd":          "Whether non-standard transactions are accepted",
+	"getpolicyinforesult-requirecanonicalorder": "Whether transactions other than admin transactions are rejected unless their inputs and outputs are in the canonical BIP 69 order",
+	"getpolicyinforesult-relaypriority":         "Whether free or low-fee transactions are required to have sufficient priority to be relayed",
+	"getpolicyinforesult-minrelaytxfee":         "Minimum transaction fee in RMG/kB to be considered a non-zero fee",
+	"getpolicyinforesult-freetxrelaylimit":      "Limit in thousands of bytes per minute for relaying free transactions",
+	"getpolicyinforesult-maxorphantxs":          "Maximum number of orphan transactions which can be queued",
+	"getpolicyinforesult-maxtxversion":          "Highest transaction version which is accepted",
+	"getpolicyinforesult-mempoolexpiry":         "Number of seconds a transaction may stay in the memory pool before it expires, 0 when transactions never expire",
+
+	// GetProcessingJournalCmd help.
+	"getprocessingjournal--synopsis": "Returns the most recent entries of the block processing journal, which records the blocks connected to and disconnected from the main chain along with the start and end of reorganizations.\n" +
+		"The journal is kept on disk across restarts and holds a bounded number of entries, so it shows what the node was doing before an unclean shutdown.",
+	"getprocessingjournal-count": "The maximum number of the most recent entries to return",
+
+	// GetProcessingJournalResult help.
+	"getprocessingjournalresult-capacity":     "The number of entries the journal keeps before the oldest entries are overwritten",
+	"getprocessingjournalresult-uncleanstart": "Whether the previous shutdown of the node was unclean",
+	"getprocessingjournalresult-entries":      "The journal entries ordered from oldest to newest",
+
+	// ProcessingJournalEntryResult help.
+	"processingjournalentryresult-seq":       "The sequence number of the entry",
+	"processingjournalentryresult-time":      "Unix time the entry was recorded",
+	"processingjournalentryresult-hash":      "The hash of the block",
+	"processingjournalentryresult-height":    "The height of the block",
+	"processingjournalentryresult-action":    "The action on the block (connect, disconnect, reorg-start, or reorg-end); reorg entries identify the new best block of the reorganization",
+	"processingjournalentryresult-outcome":   "The outcome of the action (success, rejected, or failed)",
+	"processingjournalentryresult-errorcode": "The rule violation the block was rejected for, only set for the rejected outcome",
+
+	// GetRejectSummaryCmd help.
+	"getrejectsummary--synopsis": "Returns the reject messages received from peers by command and reject code along with the blocks produced by this node which peers rejected.\n" +
+		"The reject counts are also exposed in the Prometheus text format by the /metrics endpoint of the RPC server.",
+
+	// GetRejectSummaryResult help.
+	"getrejectsummaryresult-warnpeers":         "A warning is logged when a block produced by this node is rejected by more than this number of peers",
+	"getrejectsummaryresult-ownblocksrejected": "The number of blocks produced by this node which were rejected by more than warnpeers peers",
+	"getrejectsummaryresult-rejects":           "The rejects received by command and reject code ordered by command and then by code",
+	"getrejectsummaryresult-ownblocks":         "The most recent blocks produced by this node which were rejected by any peers ordered from oldest to newest",
+
+	// RejectBucketResult help.
+	"rejectbucketresult-command":    "The command which was rejected, or other for rejects received after too many distinct commands and codes were seen",
+	"rejectbucketresult-code":       "The reject code",
+	"rejectbucketresult-codename":   "The name of the reject code",
+	"rejectbucketresult-count":      "The number of rejects received for the command and code",
+	"rejectbucketresult-lasthash":   "The hash of the item of the most recent reject, only set for blocks and transactions",
+	"rejectbucketresult-lastreason": "The reason of the most recent reject, truncated if it is long",
+	"rejectbucketresult-lastpeer":   "The address of the peer which sent the most recent reject",
+	"rejectbucketresult-lasttime":   "Unix time the most recent reject was received",
+
+	// RejectedOwnBlockResult help.
+	"rejectedownblockresult-hash":  "The hash of the block",
+	"rejectedownblockresult-peers": "The number of distinct peers which rejected the block",
+
+	// GetRPCInfoCmd help.
+	"getrpcinfo--synopsis": "Returns the number of calls, errors, and latencies of each RPC method called since the server started along with the most recent slow calls.\n" +
+		"The same statistics are exposed in the Prometheus text format by the /metrics endpoint of the RPC server.",
+
+	// GetRPCInfoResult help.
+	"getrpcinforesult-slowthreshold": "The number of seconds after which calls are logged as slow, 0 if the slow call log is disabled",
+	"getrpcinforesult-methods":       "The statistics of each method which was called ordered by method name",
+	"getrpcinforesult-slowcalls":     "The most recent slow calls ordered from oldest to newest",
+
+	// RPCMethodInfoResult help.
+	"rpcmethodinforesult-method":            "The name of the method",
+	"rpcmethodinforesult-calls":             "The number of calls to the method",
+	"rpcmethodinforesult-errors":            "The number of calls to the method which failed",
+	"rpcmethodinforesult-errorcodes":        "The number of failed calls by JSON-RPC error code",
+	"rpcmethodinforesult-errorcodes--key":   "code",
+	"rpcmethodinforesult-errorcodes--value": "n",
+	"rpcmethodinforesult-errorcodes--desc":  "The JSON-RPC error code as the key and the number of calls which failed with it as the value",
+	"rpcmethodinforesult-totalseconds":      "The total number of seconds spent executing the method",
+	"rpcmethodinforesult-latency":           "The latency histogram of the method",
+
+	// RPCLatencyBucketResult help.
+	"rpclatencybucketresult-upperbound": "The upper bound of the bucket in seconds",
+	"rpclatencybucketresult-count":      "The number of calls which completed within the upper bound",
+
+	// RPCSlowCallResult help.
+	"rpcslowcallresult-method":  "The name of the method",
+	"rpcslowcallresult-params":  "The JSON-encoded parameters of the call, truncated if they are long",
+	"rpcslowcallresult-time":    "Unix time the call started",
+	"rpcslowcallresult-seconds": "The number of seconds the call took to complete",
+
+	// GetScrubStatusCmd help.
+	"getscrubstatus--synopsis": "Returns the status of the integrity checks of the stored blocks and any corrupt blocks awaiting repair.",
+
+	// GetStatsHistoryCmd help.
+	"getstatshistory--synopsis": "Returns the mempool, orphan pool, UTXO cache and peer statistics recorded at the configured interval during the configured retention period.\n" +
+		"When a step is given, the samples are averaged over periods of that many seconds aligned to multiples of the step since the Unix epoch.",
+	"getstatshistory-start": "Unix time of the earliest sample to return",
+	"getstatshistory-end":   "Unix time of the latest sample to return (default: now)",
+	"getstatshistory-step":  "The number of seconds to average the samples over, 0 to return each sample",
+
+	// GetStatsHistoryResult help.
+	"getstatshistoryresult-interval":    "The number of seconds between samples, 0 when samples are not recorded",
+	"getstatshistoryresult-retention":   "The number of seconds samples are kept for",
+	"getstatshistoryresult-percentiles": "The percentiles of the mempool fee rates in each sample",
+	"getstatshistoryresult-samples":     "The samples ordered from oldest to newest",
+
+	// StatsSampleResult help.
+	"statssampleresult-time":               "Unix time the sample was taken, or the start of the period the samples were averaged over",
+	"statssampleresult-samples":            "The number of samples averaged",
+	"statssampleresult-mempooltxs":         "The number of transactions in the memory pool",
+	"statssampleresult-mempoolbytes":       "The total serialized size of the transactions in the memory pool",
+	"statssampleresult-feeratepercentiles": "The fee rates of the transactions in the memory pool in atoms per kilobyte at each of the percentiles",
+	"statssampleresult-orphans":            "The number of transactions in the orphan pool",
+	"statssampleresult-utxocachesize":      "The number of bytes in the UTXO cache",
+	"statssampleresult-utxocachemaxsize":   "The maximum number of bytes in the UTXO cache before it is flushed",
+	"statssampleresult-inboundpeers":       "The number of inbound peers",
+	"statssampleresult-outboundpeers":      "The number of outbound peers",
+
 	// GetTxOutResult help.
 	"gettxoutresult-bestblock":     "The block hash that contains the transaction output",
 	"gettxoutresult-confirmations": "The number of confirmations",
@@ -497,26 +1101,108 @@ var helpDescsEnUS = map[string]string{
 	"help--result0":    "List of commands",
 	"help--result1":    "Help for specified command",
 
+	// ImportBanListCmd help.
+	"importbanlist--synopsis": "Adds the bans of a ban list exported by exportbanlist and disconnects the connected peers which become banned.\n" +
+		"The bans replace existing bans of the same subnets and bans which are already expired are skipped.",
+	"importbanlist-entries":  "The bans to add",
+	"importbanlist--result0": "The number of bans which were added",
+
+	// IssueWSTokenCmd help.
+	"issuewstoken--synopsis": "Issues a token which authenticates websocket clients in place of the RPC credentials and limits them to its scope.\n" +
+		"The token is presented in an 'Authorization: Bearer <token>' header during the websocket handshake and is only returned by this command.\n" +
+		"Clients are disconnected once the token is revoked or expires.",
+	"issuewstoken-notifications": "The types of notifications the clients may register for: blocks, newtransactions, received, spent, txfilter, watchedspends",
+	"issuewstoken-methods":       "Other methods available to limited users which the clients may call",
+	"issuewstoken-expires":       "The time the token expires as a Unix timestamp, or 0 for a token which never expires",
+
+	// WSTokenResult help.
+	"wstokenresult-token":         "The token, which is only returned when it is issued",
+	"wstokenresult-id":            "The ID of the token used to revoke it",
+	"wstokenresult-notifications": "The types of notifications the clients may register for",
+	"wstokenresult-methods":       "Other methods the clients may call",
+	"wstokenresult-created":       "The time the token was issued as a Unix timestamp",
+	"wstokenresult-expires":       "The time the token expires as a Unix timestamp, omitted for tokens which never expire",
+
+	// ListUnspentByAddressCmd help.
+	"listunspentbyaddress--synopsis": "Returns the unspent transaction outputs of the main chain which pay to any of the passed addresses or include any of the passed key IDs, oldest first.\n" +
+		"When an amount is specified, only the outputs selected to reach it are returned, and an insufficient funds error is returned when all of the matching outputs don't reach it.\n" +
+		"The outputs are found by scanning the whole unspent transaction output set.",
+	"listunspentbyaddress-addresses":           "The Prova addresses to return the unspent outputs of",
+	"listunspentbyaddress-keyids":              "The key IDs to return the unspent outputs of",
+	"listunspentbyaddress-minconf":             "The minimum number of confirmations of the outputs",
+	"listunspentbyaddress-maxconf":             "The maximum number of confirmations of the outputs",
+	"listunspentbyaddress-amount":              "The amount in RMG the selected outputs must total at least",
+	"listunspentbyaddress-largestfirst":        "Select the outputs to reach the amount greedily in the order of their amount, largest first, instead of oldest first",
+	"listunspentbyaddress-excludemempoolspent": "Exclude the outputs spent by transactions in the memory pool",
+
+	// UnspentOutputResult help.
+	"unspentoutputresult-txid":          "The hash of the transaction of the output",
+	"unspentoutputresult-vout":          "The index of the output",
+	"unspentoutputresult-address":       "The address the output pays to",
+	"unspentoutputresult-keyids":        "The key IDs the output script includes",
+	"unspentoutputresult-scriptPubKey":  "The hex-encoded public key script of the output",
+	"unspentoutputresult-amount":        "The amount of the output in RMG",
+	"unspentoutputresult-confirmations": "The number of confirmations of the output",
+	"unspentoutputresult-coinbase":      "Whether the output is an output of a coinbase transaction",
+
+	// ListUnspentByAddressResult help.
+	"listunspentbyaddressresult-height":  "The height of the best block the confirmations are relative to",
+	"listunspentbyaddressresult-total":   "The total amount of the returned outputs in RMG",
+	"listunspentbyaddressresult-outputs": "The unspent outputs",
+
+	// ListWatchCmd help.
+	"listwatch--synopsis": "Returns the addresses and key IDs on the watchlist.",
+
+	// ListWatchResult help.
+	"listwatchresult-addresses": "The watched addresses in sorted order",
+	"listwatchresult-keyids":    "The watched key IDs in ascending order",
+
+	// ListWSTokensCmd help.
+	"listwstokens--synopsis": "Returns the websocket tokens in the order they were issued, without the tokens themselves.",
+
 	// PingCmd help.
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
 
+	// PrioritiseTransactionCmd help.
+	"prioritisetransaction--synopsis":     "Adjusts the fee of a transaction used to select it for block templates and exempts it from mempool expiry.\nThe transaction does not need to be in the memory pool yet.",
+	"prioritisetransaction-txid":          "The hash of the transaction",
+	"prioritisetransaction-prioritydelta": "Not supported and must be 0",
+	"prioritisetransaction-feedelta":      "The amount in atoms to add to (or subtract from, if negative) the fee of the transaction",
+	"prioritisetransaction--result0":      "Always true",
+
+	// RemoveWatchCmd help.
+	"removewatch--synopsis": "Removes addresses and key IDs from the watchlist.",
+	"removewatch-addresses": "The Prova addresses to stop watching",
+	"removewatch-keyids":    "The key IDs to stop watching",
+	"removewatch--result0":  "The number of entries which were removed from the watchlist",
+
+	// ResetErrorStatsCmd help.
+	"reseterrorstats--synopsis": "Sets the number of rejected blocks and transactions counted by geterrorstats to zero.",
+
+	// RevokeWSTokenCmd help.
+	"revokewstoken--synopsis": "Revokes a websocket token and disconnects the clients which authenticated with it.",
+	"revokewstoken-id":        "The ID of the token",
+
 	// SearchRawTransactionsCmd help.
 	"searchrawtransactions--synopsis": "Returns raw data for transactions involving the passed address.\n" +
-		"Returned transactions are pulled from both the database, and transactions currently in the mempool.\n" +
-		"Transactions pulled from the mempool will have the 'confirmations' field set to 0.\n" +
+		"Confirmed transactions are pulled from the database in the order they appear in the main chain and are paged with the skip and count parameters.\n" +
+		"Paging forwards is stable as new blocks are connected.  Paging in reverse is stable when maxheight is set to the same height for every page.\n" +
+		"Unconfirmed transactions in the mempool are not counted by skip and count.  They are included on the first page in reverse order, or on the first page with less than count confirmed transactions otherwise, and have the 'unconfirmed' field set.\n" +
 		"Usage of this RPC requires the optional --addrindex flag to be activated, otherwise all responses will simply return with an error stating the address index has not yet been built.\n" +
 		"Similarly, until the address index has caught up with the current best height, all requests will return an error response in order to avoid serving stale data.",
-	"searchrawtransactions-address":     "The Bitcoin address to search for",
-	"searchrawtransactions-verbose":     "Specifies the transaction is returned as a JSON object instead of hex-encoded string",
-	"searchrawtransactions--condition0": "verbose=0",
-	"searchrawtransactions--condition1": "verbose=1",
-	"searchrawtransactions-skip":        "The number of leading transactions to leave out of the final response",
-	"searchrawtransactions-count":       "The maximum number of transactions to return",
-	"searchrawtransactions-vinextra":    "Specify that extra data from previous output will be returned in vin",
-	"searchrawtransactions-reverse":     "Specifies that the transactions should be returned in reverse chronological order",
-	"searchrawtransactions-filteraddrs": "Address list.  Only inputs or outputs with matching address will be returned",
-	"searchrawtransactions--result0":    "Hex-encoded serialized transaction",
+	"searchrawtransactions-address":        "The Bitcoin address to search for",
+	"searchrawtransactions-verbose":        "Specifies the transaction is returned as a JSON object instead of hex-encoded string",
+	"searchrawtransactions--condition0":    "verbose=0",
+	"searchrawtransactions--condition1":    "verbose=1",
+	"searchrawtransactions-skip":           "The number of leading confirmed transactions to leave out of the final response",
+	"searchrawtransactions-count":          "The maximum number of confirmed transactions to return",
+	"searchrawtransactions-vinextra":       "Specify that extra data from previous output will be returned in vin, which is looked up in the transaction index when it is enabled and in the spend journal otherwise",
+	"searchrawtransactions-reverse":        "Specifies that the transactions should be returned in reverse chronological order",
+	"searchrawtransactions-filteraddrs":    "Address list.  Only inputs or outputs with matching address will be returned",
+	"searchrawtransactions-includemempool": "Specifies that matching unconfirmed transactions in the mempool are included",
+	"searchrawtransactions-maxheight":      "Only transactions confirmed at or below this height are returned (default: the current best height)",
+	"searchrawtransactions--result0":       "Hex-encoded serialized transaction",
 
 	// SendRawTransactionCmd help.
 	"sendrawtransaction--synopsis":     "Submits the serialized, hex-encoded transaction to the local peer and relays it to the network.",
@@ -529,6 +1215,14 @@ var helpDescsEnUS = map[string]string{
 	"setgenerate-generate":     "Use true to enable generation, false to disable it",
 	"setgenerate-genproclimit": "The number of processors (cores) to limit generation to or -1 for default",
 
+	// StartJobCmd help.
+	"startjob--synopsis": "Runs a long running command in the background and returns the id of the job running it.\n" +
+		"The progress and result of the job are returned by getjobstatus and the job is cancelled by canceljob.\n" +
+		"The commands which may be run as jobs are exportchaindata, listunspentbyaddress and verifychain.",
+	"startjob-method":   "The command to run",
+	"startjob-params":   "The parameters of the command",
+	"startjob--result0": "The id of the job",
+
 	// StopCmd help.
 	"stop--synopsis": "Shutdown Prova.",
 	"stop--result0":  "The string 'Prova stopping.'",
@@ -588,6 +1282,21 @@ var helpDescsEnUS = map[string]string{
 	// StopNotifyNewTransactionsCmd help.
 	"stopnotifynewtransactions--synopsis": "Stop sending either a txaccepted or a txacceptedverbose notification when a new transaction is accepted into the mempool.",
 
+	// NotifyWatchedSpendsCmd help.
+	"notifywatchedspends--synopsis": "Send a watchedspend notification when an output paying to an address or key ID on the watchlist is spent by a transaction accepted into the mempool or in a newly-attached block, and when such a spend is reversed because its block is detached.",
+
+	// StopNotifyWatchedSpendsCmd help.
+	"stopnotifywatchedspends--synopsis": "Stop sending watchedspend notifications.",
+
+	// SubscribeBlocksCmd help.
+	"subscribeblocks--synopsis": "Send a subscribedblockconnected notification for every block of the main chain from the start height onward, first replaying the blocks already in the chain and then following new blocks as they are connected.\n" +
+		"A subscribedblockdisconnected notification is sent for each previously sent block which is no longer part of the main chain, such as after a reorganization, before the blocks replacing it.\n" +
+		"The notifications are only sent as fast as the client receives them.  Any previous block subscription of the client is replaced.",
+	"subscribeblocks-startheight": "The height of the first block to send",
+
+	// UnsubscribeBlocksCmd help.
+	"unsubscribeblocks--synopsis": "Stop the block subscription started with subscribeblocks.",
+
 	// NotifyReceivedCmd help.
 	"notifyreceived--synopsis": "Send a recvtx notification when a transaction added to mempool or appears in a newly-attached block contains a txout pkScript sending to any of the passed addresses.\n" +
 		"Matching outpoints are automatically registered for redeemingtx notifications.",
@@ -639,49 +1348,92 @@ var helpDescsEnUS = map[string]string{
 // This information is used to generate the help.  Each result type must be a
 // pointer to the type (or nil to indicate no return value).
 var rpcResultTypes = map[string][]interface{}{
-	"addnode":               nil,
-	"createrawtransaction":  {(*string)(nil)},
-	"debuglevel":            {(*string)(nil), (*string)(nil)},
-	"decoderawtransaction":  {(*btcjson.TxRawDecodeResult)(nil)},
-	"decodescript":          {(*btcjson.DecodeScriptResult)(nil)},
-	"generate":              {(*[]string)(nil)},
-	"getaddednodeinfo":      {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
-	"getaddresstxids":       {(*[]string)(nil)},
-	"getadmininfo":          {(*btcjson.GetAdminInfoResult)(nil)},
-	"getbestblock":          {(*btcjson.GetBestBlockResult)(nil)},
-	"getbestblockhash":      {(*string)(nil)},
-	"getblock":              {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
-	"getblockcount":         {(*int64)(nil)},
-	"getblockhash":          {(*string)(nil)},
-	"getblockheader":        {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
-	"getblocktemplate":      {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
-	"getconnectioncount":    {(*int32)(nil)},
-	"getcurrentnet":         {(*uint32)(nil)},
-	"getdifficulty":         {(*float64)(nil)},
-	"getgenerate":           {(*bool)(nil)},
-	"gethashespersec":       {(*float64)(nil)},
-	"getheaders":            {(*[]string)(nil)},
-	"getinfo":               {(*btcjson.InfoChainResult)(nil)},
-	"getmempoolinfo":        {(*btcjson.GetMempoolInfoResult)(nil)},
-	"getmininginfo":         {(*btcjson.GetMiningInfoResult)(nil)},
-	"getnettotals":          {(*btcjson.GetNetTotalsResult)(nil)},
-	"getnetworkhashps":      {(*int64)(nil)},
-	"getpeerinfo":           {(*[]btcjson.GetPeerInfoResult)(nil)},
-	"getrawmempool":         {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
-	"getrawtransaction":     {(*string)(nil), (*btcjson.TxRawResult)(nil)},
-	"gettxout":              {(*btcjson.GetTxOutResult)(nil)},
-	"node":                  nil,
-	"help":                  {(*string)(nil), (*string)(nil)},
-	"ping":                  nil,
-	"searchrawtransactions": {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
-	"sendrawtransaction":    {(*string)(nil)},
-	"setgenerate":           nil,
-	"setvalidatekeys":       nil,
-	"stop":                  {(*string)(nil)},
-	"submitblock":           {nil, (*string)(nil)},
-	"validateaddress":       {(*btcjson.ValidateAddressChainResult)(nil)},
-	"verifychain":           {(*bool)(nil)},
-	"verifymessage":         {(*bool)(nil)},
+	"addnode":                nil,
+	"addwatch":               nil,
+	"backupchainstate":       {(*btcjson.BackupChainStateResult)(nil)},
+	"canceljob":              {(*btcjson.JobStatusResult)(nil)},
+	"createrawtransaction":   {(*string)(nil)},
+	"debuglevel":             {(*string)(nil), (*string)(nil)},
+	"decodeblock":            {(*btcjson.DecodeBlockResult)(nil)},
+	"decoderawtransaction":   {(*btcjson.TxRawDecodeResult)(nil)},
+	"exportbanlist":          {(*[]btcjson.BanListEntry)(nil)},
+	"exportchaindata":        {(*btcjson.ExportChainDataResult)(nil)},
+	"decodescript":           {(*btcjson.DecodeScriptResult)(nil)},
+	"generate":               {(*[]string)(nil)},
+	"getaddednodeinfo":       {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
+	"getaddresstxids":        {(*[]string)(nil)},
+	"getadmininfo":           {(*btcjson.GetAdminInfoResult)(nil)},
+	"getbestblock":           {(*btcjson.GetBestBlockResult)(nil)},
+	"getbestblockhash":       {(*string)(nil)},
+	"getblock":               {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
+	"getaddrmaninfo":         {(*btcjson.GetAddrManInfoResult)(nil)},
+	"getadminproof":          {(*btcjson.GetAdminProofResult)(nil)},
+	"getblockadminops":       {(*btcjson.GetBlockAdminOpsResult)(nil)},
+	"getblockcommitment":     {(*btcjson.GetBlockCommitmentResult)(nil)},
+	"getblockcount":          {(*int64)(nil)},
+	"getblockhash":           {(*string)(nil)},
+	"getblockheader":         {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
+	"getblockproductioninfo": {(*btcjson.GetBlockProductionInfoResult)(nil)},
+	"getblockraw":            {(*string)(nil)},
+	"getblocktemplate":       {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
+	"getbroadcaststatus":     {(*btcjson.GetBroadcastStatusResult)(nil)},
+	"getchainparams":         {(*btcjson.GetChainParamsResult)(nil)},
+	"getchainsplitinfo":      {(*btcjson.GetChainSplitInfoResult)(nil)},
+	"getconnectioncount":     {(*int32)(nil)},
+	"getcurrentnet":          {(*uint32)(nil)},
+	"getdifficulty":          {(*float64)(nil)},
+	"getdoublesigns":         {(*btcjson.GetDoubleSignsResult)(nil)},
+	"getgenerate":            {(*bool)(nil)},
+	"gethashespersec":        {(*float64)(nil)},
+	"getheaders":             {(*[]string)(nil), (*[]btcjson.GetBlockHeaderVerboseResult)(nil)},
+	"getinfo":                {(*btcjson.InfoChainResult)(nil)},
+	"getjobstatus":           {(*btcjson.JobStatusResult)(nil)},
+	"getmempoolentry":        {(*btcjson.GetMempoolEntryResult)(nil)},
+	"getmempoolinfo":         {(*btcjson.GetMempoolInfoResult)(nil)},
+	"getmempoolsnapshot":     {(*btcjson.GetMempoolSnapshotResult)(nil)},
+	"getnextkeyid":           {(*uint32)(nil)},
+	"getmininginfo":          {(*btcjson.GetMiningInfoResult)(nil)},
+	"getnettotals":           {(*btcjson.GetNetTotalsResult)(nil)},
+	"getnetworkinfo":         {(*btcjson.GetNetworkInfoResult)(nil)},
+	"getnetworkhashps":       {(*int64)(nil)},
+	"getpeerinfo":            {(*[]btcjson.GetPeerInfoResult)(nil)},
+	"geterrorstats":          {(*btcjson.GetErrorStatsResult)(nil)},
+	"getpeerstats":           {(*[]btcjson.GetPeerStatsResult)(nil)},
+	"getpolicyinfo":          {(*btcjson.GetPolicyInfoResult)(nil)},
+	"getrawmempool":          {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
+	"getrawtransaction":      {(*string)(nil), (*btcjson.TxRawResult)(nil)},
+	"getprocessingjournal":   {(*btcjson.GetProcessingJournalResult)(nil)},
+	"getrejectsummary":       {(*btcjson.GetRejectSummaryResult)(nil)},
+	"getrpcinfo":             {(*btcjson.GetRPCInfoResult)(nil)},
+	"getscrubstatus":         {(*btcjson.GetScrubStatusResult)(nil)},
+	"getstatshistory":        {(*btcjson.GetStatsHistoryResult)(nil)},
+	"getthreadinfo":          {(*btcjson.GetThreadInfoResult)(nil)},
+	"gettxout":               {(*btcjson.GetTxOutResult)(nil)},
+	"node":                   nil,
+	"help":                   {(*string)(nil), (*string)(nil)},
+	"importbanlist":          {(*int)(nil)},
+	"issuewstoken":           {(*btcjson.WSTokenResult)(nil)},
+	"listunspentbyaddress":   {(*btcjson.ListUnspentByAddressResult)(nil)},
+	"listwatch":              {(*btcjson.ListWatchResult)(nil)},
+	"listwstokens":           {(*[]btcjson.WSTokenResult)(nil)},
+	"ping":                   nil,
+	"prioritisetransaction":  {(*bool)(nil)},
+	"removewatch":            {(*int)(nil)},
+	"reseterrorstats":        nil,
+	"revokewstoken":          nil,
+	"searchrawtransactions":  {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
+	"sendrawtransaction":     {(*string)(nil)},
+	"setban":                 nil,
+	"setgenerate":            nil,
+	"setpeertrace":           {(*btcjson.SetPeerTraceResult)(nil)},
+	"setvalidatekeys":        nil,
+	"simulateadmintx":        {(*btcjson.SimulateAdminTxResult)(nil)},
+	"startjob":               {(*string)(nil)},
+	"stop":                   {(*string)(nil)},
+	"submitblock":            {nil, (*string)(nil)},
+	"validateaddress":        {(*btcjson.ValidateAddressChainResult)(nil)},
+	"verifychain":            {(*bool)(nil)},
+	"verifymessage":          {(*bool)(nil)},
 
 	// Websocket commands.
 	"loadtxfilter":              nil,
@@ -694,6 +1446,10 @@ var rpcResultTypes = map[string][]interface{}{
 	"stopnotifyreceived":        nil,
 	"notifyspent":               nil,
 	"stopnotifyspent":           nil,
+	"notifywatchedspends":       nil,
+	"stopnotifywatchedspends":   nil,
+	"subscribeblocks":           nil,
+	"unsubscribeblocks":         nil,
 	"rescan":                    nil,
 	"rescanblocks":              {(*[]btcjson.RescannedBlock)(nil)},
 }
@@ -0,0 +1,285 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+)
+
+const (
+	// maxSlowRPCParamsLen is the maximum number of bytes of the parameters
+	// of a slow RPC call which are logged and kept.  Longer parameters are
+	// truncated.
+	maxSlowRPCParamsLen = 256
+
+	// maxRecentSlowRPCCalls is the number of most recent slow RPC calls
+	// which are kept to be returned by the getrpcinfo command.
+	maxRecentSlowRPCCalls = 20
+)
+
+// rpcLatencyBuckets are the upper bounds of the buckets of the RPC latency
+// histograms.  Calls which take longer than the last bound are only included
+// in the total count.
+var rpcLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	time.Millisecond * 5,
+	time.Millisecond * 10,
+	time.Millisecond * 50,
+	time.Millisecond * 100,
+	time.Millisecond * 500,
+	time.Second,
+	time.Second * 5,
+	time.Second * 10,
+	time.Second * 30,
+}
+
+// rpcMethodStats houses the cumulative statistics of the calls to a single RPC
+// method.
+type rpcMethodStats struct {
+	calls     uint64
+	errors    map[int]uint64
+	totalTime time.Duration
+
+	// buckets holds the number of calls which completed within each of
+	// the bounds in rpcLatencyBuckets.  The counts are cumulative, so a
+	// call is counted in every bucket whose bound it did not exceed.
+	buckets []uint64
+}
+
+// numErrors returns the total number of calls to the method which failed.
+func (ms *rpcMethodStats) numErrors() uint64 {
+	var n uint64
+	for _, count := range ms.errors {
+		n += count
+	}
+	return n
+}
+
+// errorCodes returns the error codes the calls to the method failed with in
+// ascending order.
+func (ms *rpcMethodStats) errorCodes() []int {
+	codes := make([]int, 0, len(ms.errors))
+	for code := range ms.errors {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	return codes
+}
+
+// slowRPCCall describes an RPC call which took longer than the slow call
+// threshold to complete.
+type slowRPCCall struct {
+	method  string
+	params  string
+	started time.Time
+	elapsed time.Duration
+}
+
+// rpcStats tracks the number of calls, errors, and latencies of the RPC
+// methods along with the most recent calls which were slow.  It is safe for
+// concurrent access.
+type rpcStats struct {
+	mtx           sync.Mutex
+	slowThreshold time.Duration
+	methods       map[string]*rpcMethodStats
+	slowCalls     []slowRPCCall
+}
+
+// newRPCStats returns a new RPC statistics tracker which logs calls taking
+// longer than the passed threshold.  A threshold of 0 disables the slow call
+// log.
+func newRPCStats(slowThreshold time.Duration) *rpcStats {
+	return &rpcStats{
+		slowThreshold: slowThreshold,
+		methods:       make(map[string]*rpcMethodStats),
+	}
+}
+
+// formatRPCParams returns the passed raw parameters of an RPC call as a JSON
+// array truncated to maxSlowRPCParamsLen bytes.
+func formatRPCParams(params []json.RawMessage) string {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, param := range params {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(param)
+		if buf.Len() > maxSlowRPCParamsLen {
+			break
+		}
+	}
+	buf.WriteByte(']')
+	if buf.Len() > maxSlowRPCParamsLen {
+		return string(buf.Bytes()[:maxSlowRPCParamsLen]) + "..."
+	}
+	return buf.String()
+}
+
+// Record records a call to the passed method which started at the passed time,
+// took the passed duration to complete, and failed with the passed error, if
+// any.  Errors which are not RPC errors are counted as internal errors since
+// that is how they are reported to the client.
+func (rs *rpcStats) Record(method string, params []json.RawMessage, started time.Time, elapsed time.Duration, err error) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	ms, ok := rs.methods[method]
+	if !ok {
+		ms = &rpcMethodStats{
+			errors:  make(map[int]uint64),
+			buckets: make([]uint64, len(rpcLatencyBuckets)),
+		}
+		rs.methods[method] = ms
+	}
+	ms.calls++
+	ms.totalTime += elapsed
+	for i, bound := range rpcLatencyBuckets {
+		if elapsed <= bound {
+			ms.buckets[i]++
+		}
+	}
+	if err != nil {
+		code := btcjson.ErrRPCInternal.Code
+		if jErr, ok := err.(*btcjson.RPCError); ok {
+			code = jErr.Code
+		}
+		ms.errors[int(code)]++
+	}
+
+	if rs.slowThreshold == 0 || elapsed < rs.slowThreshold {
+		return
+	}
+	call := slowRPCCall{
+		method:  method,
+		params:  formatRPCParams(params),
+		started: started,
+		elapsed: elapsed,
+	}
+	rpcsLog.Warnf("Slow RPC call: %s %s took %v", call.method, call.params,
+		call.elapsed)
+	if len(rs.slowCalls) == maxRecentSlowRPCCalls {
+		copy(rs.slowCalls, rs.slowCalls[1:])
+		rs.slowCalls = rs.slowCalls[:len(rs.slowCalls)-1]
+	}
+	rs.slowCalls = append(rs.slowCalls, call)
+}
+
+// sortedMethods returns the names of the methods which were called in
+// ascending order.
+//
+// This function MUST be called with the stats lock held.
+func (rs *rpcStats) sortedMethods() []string {
+	methods := make([]string, 0, len(rs.methods))
+	for method := range rs.methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Info returns the statistics of all methods which were called ordered by
+// method name along with the most recent slow calls ordered from oldest to
+// newest.
+func (rs *rpcStats) Info() *btcjson.GetRPCInfoResult {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	result := &btcjson.GetRPCInfoResult{
+		SlowThreshold: rs.slowThreshold.Seconds(),
+		Methods:       make([]btcjson.RPCMethodInfoResult, 0, len(rs.methods)),
+		SlowCalls:     make([]btcjson.RPCSlowCallResult, 0, len(rs.slowCalls)),
+	}
+	for _, method := range rs.sortedMethods() {
+		ms := rs.methods[method]
+		info := btcjson.RPCMethodInfoResult{
+			Method:       method,
+			Calls:        ms.calls,
+			Errors:       ms.numErrors(),
+			ErrorCodes:   make(map[string]uint64, len(ms.errors)),
+			TotalSeconds: ms.totalTime.Seconds(),
+			Latency: make([]btcjson.RPCLatencyBucketResult, 0,
+				len(rpcLatencyBuckets)),
+		}
+		for code, count := range ms.errors {
+			info.ErrorCodes[strconv.Itoa(code)] = count
+		}
+		for i, bound := range rpcLatencyBuckets {
+			info.Latency = append(info.Latency,
+				btcjson.RPCLatencyBucketResult{
+					UpperBound: bound.Seconds(),
+					Count:      ms.buckets[i],
+				})
+		}
+		result.Methods = append(result.Methods, info)
+	}
+	for _, call := range rs.slowCalls {
+		result.SlowCalls = append(result.SlowCalls, btcjson.RPCSlowCallResult{
+			Method:  call.method,
+			Params:  call.params,
+			Time:    call.started.Unix(),
+			Seconds: call.elapsed.Seconds(),
+		})
+	}
+	return result
+}
+
+// WriteMetrics writes the statistics of all methods which were called to the
+// passed writer in the Prometheus text exposition format.
+func (rs *rpcStats) WriteMetrics(w io.Writer) error {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	var buf bytes.Buffer
+	methods := rs.sortedMethods()
+	buf.WriteString("# HELP prova_rpc_calls_total Number of RPC calls " +
+		"by method.\n")
+	buf.WriteString("# TYPE prova_rpc_calls_total counter\n")
+	for _, method := range methods {
+		fmt.Fprintf(&buf, "prova_rpc_calls_total{method=%q} %d\n", method,
+			rs.methods[method].calls)
+	}
+
+	buf.WriteString("# HELP prova_rpc_errors_total Number of failed RPC " +
+		"calls by method and JSON-RPC error code.\n")
+	buf.WriteString("# TYPE prova_rpc_errors_total counter\n")
+	for _, method := range methods {
+		ms := rs.methods[method]
+		for _, code := range ms.errorCodes() {
+			fmt.Fprintf(&buf, "prova_rpc_errors_total{method=%q,"+
+				"code=\"%d\"} %d\n", method, code, ms.errors[code])
+		}
+	}
+
+	buf.WriteString("# HELP prova_rpc_duration_seconds Latency of RPC " +
+		"calls by method.\n")
+	buf.WriteString("# TYPE prova_rpc_duration_seconds histogram\n")
+	for _, method := range methods {
+		ms := rs.methods[method]
+		for i, bound := range rpcLatencyBuckets {
+			fmt.Fprintf(&buf, "prova_rpc_duration_seconds_bucket{"+
+				"method=%q,le=\"%g\"} %d\n", method,
+				bound.Seconds(), ms.buckets[i])
+		}
+		fmt.Fprintf(&buf, "prova_rpc_duration_seconds_bucket{method=%q,"+
+			"le=\"+Inf\"} %d\n", method, ms.calls)
+		fmt.Fprintf(&buf, "prova_rpc_duration_seconds_sum{method=%q} %g\n",
+			method, ms.totalTime.Seconds())
+		fmt.Fprintf(&buf, "prova_rpc_duration_seconds_count{method=%q} "+
+			"%d\n", method, ms.calls)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+)
+
+// TestRPCStats ensures calls dispatched over both HTTP and websockets are
+// recorded in the latency histograms and error counts of their method, that
+// calls exceeding the slow call threshold are kept with their parameters
+// truncated, and that the statistics are exposed by the getrpcinfo command and
+// the metrics endpoint.
+func TestRPCStats(t *testing.T) {
+	const slowThreshold = time.Millisecond * 50
+
+	// The test handler sleeps for the delay of the command and fails with
+	// a misc error when asked to.
+	type testSlowCmd struct {
+		delay time.Duration
+		fail  bool
+	}
+	rpcHandlers["testslow"] = func(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+		c := cmd.(*testSlowCmd)
+		time.Sleep(c.delay)
+		if c.fail {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCMisc,
+				Message: "failed",
+			}
+		}
+		return "done", nil
+	}
+	defer delete(rpcHandlers, "testslow")
+
+	s := &rpcServer{server: &server{}, stats: newRPCStats(slowThreshold)}
+	longParam := json.RawMessage(`"` + strings.Repeat("a", maxSlowRPCParamsLen*2) + `"`)
+	newCmd := func(delay time.Duration, fail bool) *parsedRPCCmd {
+		return &parsedRPCCmd{
+			id:     1,
+			method: "testslow",
+			params: []json.RawMessage{longParam},
+			cmd:    &testSlowCmd{delay: delay, fail: fail},
+		}
+	}
+
+	// Issue a fast call and a slow failing call the way the HTTP server
+	// does, followed by a slow call over a websocket.
+	for _, cmd := range []*parsedRPCCmd{newCmd(0, false),
+		newCmd(slowThreshold*2, true)} {
+
+		s.timedCmdResult(cmd, func() (interface{}, error) {
+			return s.standardCmdResult(cmd, nil)
+		})
+	}
+	c := &wsClient{
+		server:   s,
+		sendChan: make(chan wsResponse, 1),
+		quit:     make(chan struct{}),
+	}
+	c.serviceRequest(newCmd(slowThreshold*2, false))
+	reply := <-c.sendChan
+	if !bytes.Contains(reply.msg, []byte(`"result":"done"`)) {
+		t.Fatalf("unexpected websocket reply: %s", reply.msg)
+	}
+
+	result, err := handleGetRPCInfo(s, btcjson.NewGetRPCInfoCmd(), nil)
+	if err != nil {
+		t.Fatalf("handleGetRPCInfo: unexpected error: %v", err)
+	}
+	info := result.(*btcjson.GetRPCInfoResult)
+	if info.SlowThreshold != slowThreshold.Seconds() {
+		t.Errorf("got slow threshold %v, want %v", info.SlowThreshold,
+			slowThreshold.Seconds())
+	}
+
+	// All three calls are counted along with the error code of the failed
+	// one, and only the fast call completed before the slow threshold.
+	if len(info.Methods) != 1 {
+		t.Fatalf("got statistics for %d methods, want 1",
+			len(info.Methods))
+	}
+	ms := info.Methods[0]
+	if ms.Method != "testslow" || ms.Calls != 3 || ms.Errors != 1 {
+		t.Errorf("got method %s with %d calls and %d errors, want "+
+			"testslow with 3 calls and 1 error", ms.Method, ms.Calls,
+			ms.Errors)
+	}
+	if len(ms.ErrorCodes) != 1 || ms.ErrorCodes["-1"] != 1 {
+		t.Errorf("got error codes %v, want 1 misc error", ms.ErrorCodes)
+	}
+	if ms.TotalSeconds < (slowThreshold * 4).Seconds() {
+		t.Errorf("got total of %vs, want at least %vs", ms.TotalSeconds,
+			(slowThreshold * 4).Seconds())
+	}
+	if len(ms.Latency) != len(rpcLatencyBuckets) {
+		t.Fatalf("got %d latency buckets, want %d", len(ms.Latency),
+			len(rpcLatencyBuckets))
+	}
+	for i, bucket := range ms.Latency {
+		var want uint64
+		switch bound := rpcLatencyBuckets[i]; {
+		case bound >= time.Second:
+			want = 3
+		case bound < slowThreshold*2:
+			want = 1
+		default:
+			continue
+		}
+		if bucket.Count != want {
+			t.Errorf("bucket %vs: got %d calls, want %d",
+				bucket.UpperBound, bucket.Count, want)
+		}
+	}
+
+	// Both slow calls are kept in the order they were made with their
+	// parameters truncated.
+	if len(info.SlowCalls) != 2 {
+		t.Fatalf("got %d slow calls, want 2", len(info.SlowCalls))
+	}
+	wantParams := string(append([]byte{'['},
+		longParam[:maxSlowRPCParamsLen-1]...)) + "..."
+	for _, call := range info.SlowCalls {
+		if call.Method != "testslow" || call.Params != wantParams ||
+			call.Seconds < slowThreshold.Seconds() {
+
+			t.Errorf("unexpected slow call %+v", call)
+		}
+	}
+
+	// The metrics contain the call count, error count, and histogram.
+	var buf bytes.Buffer
+	if err := s.stats.WriteMetrics(&buf); err != nil {
+		t.Fatalf("WriteMetrics: unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"# TYPE prova_rpc_duration_seconds histogram\n",
+		`prova_rpc_calls_total{method="testslow"} 3` + "\n",
+		`prova_rpc_errors_total{method="testslow",code="-1"} 1` + "\n",
+		`prova_rpc_duration_seconds_bucket{method="testslow",le="0.001"} 1` + "\n",
+		`prova_rpc_duration_seconds_bucket{method="testslow",le="30"} 3` + "\n",
+		`prova_rpc_duration_seconds_bucket{method="testslow",le="+Inf"} 3` + "\n",
+		`prova_rpc_duration_seconds_count{method="testslow"} 3` + "\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, buf.String())
+		}
+	}
+
+	// Calls are not logged as slow when the slow call log is disabled.
+	s.stats = newRPCStats(0)
+	cmd := newCmd(slowThreshold, false)
+	s.timedCmdResult(cmd, func() (interface{}, error) {
+		return s.standardCmdResult(cmd, nil)
+	})
+	if info := s.stats.Info(); len(info.SlowCalls) != 0 {
+		t.Errorf("got %d slow calls with the log disabled, want 0",
+			len(info.SlowCalls))
+	}
+}
@@ -9,6 +9,7 @@ package main
 import (
 	"bytes"
 	"container/list"
+	"context"
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
@@ -25,6 +26,7 @@ import (
 	"github.com/bitgo/prova/btcjson"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/mempool"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
@@ -39,6 +41,11 @@ const (
 	// handler since notifications have their own queuing mechanism
 	// independent of the send channel buffer.
 	websocketSendBufferSize = 50
+
+	// blockSubscriptionQueueSize is the number of block subscription
+	// events buffered for a websocket client.  The subscription waits for
+	// the client to receive its notifications once they are used up.
+	blockSubscriptionQueueSize = 8
 )
 
 type semaphore chan struct{}
@@ -69,11 +76,15 @@ var wsHandlersBeforeInit = map[string]wsCommandHandler{
 	"notifynewtransactions":     handleNotifyNewTransactions,
 	"notifyreceived":            handleNotifyReceived,
 	"notifyspent":               handleNotifySpent,
+	"notifywatchedspends":       handleNotifyWatchedSpends,
 	"session":                   handleSession,
 	"stopnotifyblocks":          handleStopNotifyBlocks,
 	"stopnotifynewtransactions": handleStopNotifyNewTransactions,
 	"stopnotifyspent":           handleStopNotifySpent,
 	"stopnotifyreceived":        handleStopNotifyReceived,
+	"stopnotifywatchedspends":   handleStopNotifyWatchedSpends,
+	"subscribeblocks":           handleSubscribeBlocks,
+	"unsubscribeblocks":         handleUnsubscribeBlocks,
 	"rescan":                    handleRescan,
 	"rescanblocks":              handleRescanBlocks,
 }
@@ -82,14 +93,20 @@ var wsHandlersBeforeInit = map[string]wsCommandHandler{
 // starting it, and blocking until the connection closes.  Since it blocks, it
 // must be run in a separate goroutine.  It should be invoked from the websocket
 // server handler which runs each new connection in a new goroutine thereby
-// satisfying the requirement.
+// satisfying the requirement.  Clients which authenticated with a websocket
+// token are disconnected once it is revoked or expires.
 func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
-	authenticated bool, isAdmin bool) {
+	authenticated bool, isAdmin bool, token *wsToken) {
 
 	// Clear the read deadline that was set before the websocket hijacked
 	// the connection.
 	conn.SetReadDeadline(timeZeroVal)
 
+	// Limit the size of the messages read from the client to the largest
+	// size allowed for a request of any class.  The connection is closed
+	// when a larger message is received.
+	conn.SetReadLimit(maxRPCBodySize())
+
 	// Limit max number of websocket clients.
 	rpcsLog.Infof("New websocket client %s", remoteAddr)
 	if s.ntfnMgr.NumClients()+1 > cfg.RPCMaxWebsockets {
@@ -109,8 +126,12 @@ func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
 		conn.Close()
 		return
 	}
+	client.token = token
 	s.ntfnMgr.AddClient(client)
 	client.Start()
+	if token != nil {
+		go client.watchToken()
+	}
 	client.WaitForShutdown()
 	s.ntfnMgr.RemoveClient(client)
 	rpcsLog.Infof("Disconnected websocket client %s", remoteAddr)
@@ -124,6 +145,17 @@ func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
 // figure out which websocket clients need to be notified based on what they
 // have registered for and notifies them accordingly.  It is also used to keep
 // track of all connected websocket clients.
+//
+// Notifications derived from changes of the main chain are dispatched in a
+// strict order through a queue of their own.  The blockconnected and
+// filteredblockconnected notifications of a block are sent before any
+// notification of a transaction derived from the block, such as recvtx and
+// redeemingtx with block details, watched spends and mempool removals caused by
+// the block.  During a reorganization, the blocks of the old branch are
+// disconnected in reverse height order, starting with the tip, before any
+// block of the replacing branch is connected.  Notifications originating from
+// the memory pool, such as txaccepted, are queued independently and may be
+// interleaved anywhere between them.
 type wsNotificationManager struct {
 	// server is the RPC server the notification manager is associated with.
 	server *rpcServer
@@ -131,6 +163,16 @@ type wsNotificationManager struct {
 	// queueNotification queues a notification for handling.
 	queueNotification chan interface{}
 
+	// queueChainNotification queues a notification derived from a change
+	// of the main chain for handling.  Chain notifications have a queue of
+	// their own so they are handled in the order of the chain changes
+	// which produced them.
+	queueChainNotification chan interface{}
+
+	// chainNotificationMsgs feeds notificationHandler with the chain
+	// notifications from their queue.
+	chainNotificationMsgs chan interface{}
+
 	// notificationMsgs feeds notificationHandler with notifications
 	// and client (un)registeration requests from a queue as well as
 	// registeration and unregisteration requests from clients.
@@ -199,6 +241,13 @@ func (m *wsNotificationManager) queueHandler() {
 	m.wg.Done()
 }
 
+// chainQueueHandler maintains the queue of notifications derived from changes
+// of the main chain.
+func (m *wsNotificationManager) chainQueueHandler() {
+	queueHandler(m.queueChainNotification, m.chainNotificationMsgs, m.quit)
+	m.wg.Done()
+}
+
 // NotifyBlockConnected passes a block newly-connected to the best chain
 // to the notification manager for block and transaction notification
 // processing.
@@ -208,7 +257,7 @@ func (m *wsNotificationManager) NotifyBlockConnected(block *provautil.Block) {
 	// statement to unblock enqueuing the notification once the RPC
 	// server has begun shutting down.
 	select {
-	case m.queueNotification <- (*notificationBlockConnected)(block):
+	case m.queueChainNotification <- (*notificationBlockConnected)(block):
 	case <-m.quit:
 	}
 }
@@ -221,7 +270,7 @@ func (m *wsNotificationManager) NotifyBlockDisconnected(block *provautil.Block)
 	// statement to unblock enqueuing the notification once the RPC
 	// server has begun shutting down.
 	select {
-	case m.queueNotification <- (*notificationBlockDisconnected)(block):
+	case m.queueChainNotification <- (*notificationBlockDisconnected)(block):
 	case <-m.quit:
 	}
 }
@@ -246,6 +295,56 @@ func (m *wsNotificationManager) NotifyMempoolTx(tx *provautil.Tx, isNew bool) {
 	}
 }
 
+// NotifyTxExpired passes a transaction evicted from the mempool because it, or a
+// transaction it depends on, expired to the notification manager for
+// transaction notification processing.
+func (m *wsNotificationManager) NotifyTxExpired(tx *provautil.Tx) {
+	// As NotifyTxExpired will be called by mempool and the RPC server may
+	// no longer be running, use a select statement to unblock enqueuing
+	// the notification once the RPC server has begun shutting down.
+	select {
+	case m.queueNotification <- (*notificationTxExpired)(tx):
+	case <-m.quit:
+	}
+}
+
+// NotifyTxRemoved passes a transaction removed from the mempool without being
+// mined for the passed reason to the notification manager for transaction
+// notification processing.  Transactions are only removed this way because of
+// changes of the main chain, so the notification is queued along with the
+// chain notifications.
+func (m *wsNotificationManager) NotifyTxRemoved(tx *provautil.Tx, reason mempool.RemovalReason) {
+	// As NotifyTxRemoved will be called by the block manager and the RPC
+	// server may no longer be running, use a select statement to unblock
+	// enqueuing the notification once the RPC server has begun shutting
+	// down.
+	n := &notificationTxRemoved{tx: tx, reason: reason}
+	select {
+	case m.queueChainNotification <- n:
+	case <-m.quit:
+	}
+}
+
+// NotifyWatchedSpend passes the spend of an output paying to an address or key
+// ID on the watchlist to the notification manager for watched spend
+// notification processing.  Spends in a block are queued along with the chain
+// notifications, while spends in the memory pool are not.
+func (m *wsNotificationManager) NotifyWatchedSpend(spend *btcjson.WatchedSpendResult) {
+	queue := m.queueNotification
+	if spend.BlockHash != "" {
+		queue = m.queueChainNotification
+	}
+
+	// As NotifyWatchedSpend will be called by the block manager and
+	// mempool and the RPC server may no longer be running, use a select
+	// statement to unblock enqueuing the notification once the RPC server
+	// has begun shutting down.
+	select {
+	case queue <- (*notificationWatchedSpend)(spend):
+	case <-m.quit:
+	}
+}
+
 // Notification types
 type notificationBlockConnected provautil.Block
 type notificationBlockDisconnected provautil.Block
@@ -253,6 +352,12 @@ type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *provautil.Tx
 }
+type notificationTxExpired provautil.Tx
+type notificationTxRemoved struct {
+	tx     *provautil.Tx
+	reason mempool.RemovalReason
+}
+type notificationWatchedSpend btcjson.WatchedSpendResult
 
 // Notification control requests
 type notificationRegisterClient wsClient
@@ -261,6 +366,8 @@ type notificationRegisterBlocks wsClient
 type notificationUnregisterBlocks wsClient
 type notificationRegisterNewMempoolTxs wsClient
 type notificationUnregisterNewMempoolTxs wsClient
+type notificationRegisterWatchedSpends wsClient
+type notificationUnregisterWatchedSpends wsClient
 type notificationRegisterSpent struct {
 	wsc *wsClient
 	ops []*wire.OutPoint
@@ -279,7 +386,9 @@ type notificationUnregisterAddr struct {
 }
 
 // notificationHandler reads notifications and control messages from the queue
-// handler and processes one at a time.
+// handlers and processes one at a time.  Pending chain notifications are
+// handled ahead of the other queue so mempool notifications do not hold them
+// back.
 func (m *wsNotificationManager) notificationHandler() {
 	// clients is a map of all currently connected websocket clients.
 	clients := make(map[chan struct{}]*wsClient)
@@ -293,110 +402,165 @@ func (m *wsNotificationManager) notificationHandler() {
 	// since it is quite a bit more efficient than using the entire struct.
 	blockNotifications := make(map[chan struct{}]*wsClient)
 	txNotifications := make(map[chan struct{}]*wsClient)
+	watchedSpendNotifications := make(map[chan struct{}]*wsClient)
 	watchedOutPoints := make(map[wire.OutPoint]map[chan struct{}]*wsClient)
 	watchedAddrs := make(map[string]map[chan struct{}]*wsClient)
 
+	// chainTip is the tip of the main chain once the chain notifications
+	// handled so far are applied.  It is used to detect notifications which
+	// break the ordering guarantee.
+	var chainTip *chainhash.Hash
+
 out:
 	for {
+		var n interface{}
+		var ok bool
 		select {
-		case n, ok := <-m.notificationMsgs:
-			if !ok {
-				// queueHandler quit.
+		case n, ok = <-m.chainNotificationMsgs:
+		default:
+			select {
+			case n, ok = <-m.chainNotificationMsgs:
+			case n, ok = <-m.notificationMsgs:
+			case m.numClients <- len(clients):
+				continue
+			case <-m.quit:
+				// RPC server shutting down.
 				break out
 			}
-			switch n := n.(type) {
-			case *notificationBlockConnected:
-				block := (*provautil.Block)(n)
+		}
+		if !ok {
+			// A queue handler quit.
+			break out
+		}
 
-				// Skip iterating through all txs if no
-				// tx notification requests exist.
-				if len(watchedOutPoints) != 0 || len(watchedAddrs) != 0 {
-					for _, tx := range block.Transactions() {
-						m.notifyForTx(watchedOutPoints,
-							watchedAddrs, tx, block)
-					}
-				}
+		switch n := n.(type) {
+		case *notificationBlockConnected:
+			block := (*provautil.Block)(n)
+			prevHash := &block.MsgBlock().Header.PrevBlock
+			if chainTip != nil && !prevHash.IsEqual(chainTip) {
+				rpcsLog.Errorf("Connected block %v does not "+
+					"extend the notified tip %v",
+					block.Hash(), chainTip)
+			}
+			chainTip = block.Hash()
+
+			// Notify the clients of the block before any of its
+			// transactions.
+			if len(blockNotifications) != 0 {
+				m.notifyBlockConnected(blockNotifications,
+					block)
+				m.notifyFilteredBlockConnected(blockNotifications,
+					block)
+			}
 
-				if len(blockNotifications) != 0 {
-					m.notifyBlockConnected(blockNotifications,
-						block)
-					m.notifyFilteredBlockConnected(blockNotifications,
-						block)
+			// Skip iterating through all txs if no
+			// tx notification requests exist.
+			if len(watchedOutPoints) != 0 || len(watchedAddrs) != 0 {
+				for _, tx := range block.Transactions() {
+					m.notifyForTx(watchedOutPoints,
+						watchedAddrs, tx, block)
 				}
+			}
 
-			case *notificationBlockDisconnected:
-				block := (*provautil.Block)(n)
+		case *notificationBlockDisconnected:
+			block := (*provautil.Block)(n)
+			if chainTip != nil && !block.Hash().IsEqual(chainTip) {
+				rpcsLog.Errorf("Disconnected block %v is not "+
+					"the notified tip %v", block.Hash(),
+					chainTip)
+			}
+			chainTip = &block.MsgBlock().Header.PrevBlock
 
-				if len(blockNotifications) != 0 {
-					m.notifyBlockDisconnected(blockNotifications,
-						block)
-					m.notifyFilteredBlockDisconnected(blockNotifications,
-						block)
-				}
+			if len(blockNotifications) != 0 {
+				m.notifyBlockDisconnected(blockNotifications,
+					block)
+				m.notifyFilteredBlockDisconnected(blockNotifications,
+					block)
+			}
 
-			case *notificationTxAcceptedByMempool:
-				if n.isNew && len(txNotifications) != 0 {
-					m.notifyForNewTx(txNotifications, n.tx)
-				}
-				m.notifyForTx(watchedOutPoints, watchedAddrs, n.tx, nil)
-				m.notifyRelevantTxAccepted(n.tx, clients)
-
-			case *notificationRegisterBlocks:
-				wsc := (*wsClient)(n)
-				blockNotifications[wsc.quit] = wsc
-
-			case *notificationUnregisterBlocks:
-				wsc := (*wsClient)(n)
-				delete(blockNotifications, wsc.quit)
-
-			case *notificationRegisterClient:
-				wsc := (*wsClient)(n)
-				clients[wsc.quit] = wsc
-
-			case *notificationUnregisterClient:
-				wsc := (*wsClient)(n)
-				// Remove any requests made by the client as well as
-				// the client itself.
-				delete(blockNotifications, wsc.quit)
-				delete(txNotifications, wsc.quit)
-				for k := range wsc.spentRequests {
-					op := k
-					m.removeSpentRequest(watchedOutPoints, wsc, &op)
-				}
-				for addr := range wsc.addrRequests {
-					m.removeAddrRequest(watchedAddrs, wsc, addr)
-				}
-				delete(clients, wsc.quit)
+		case *notificationTxAcceptedByMempool:
+			if n.isNew && len(txNotifications) != 0 {
+				m.notifyForNewTx(txNotifications, n.tx)
+			}
+			m.notifyForTx(watchedOutPoints, watchedAddrs, n.tx, nil)
+			m.notifyRelevantTxAccepted(n.tx, clients)
 
-			case *notificationRegisterSpent:
-				m.addSpentRequests(watchedOutPoints, n.wsc, n.ops)
+		case *notificationTxExpired:
+			if len(txNotifications) != 0 {
+				m.notifyTxExpired(txNotifications,
+					(*provautil.Tx)(n))
+			}
 
-			case *notificationUnregisterSpent:
-				m.removeSpentRequest(watchedOutPoints, n.wsc, n.op)
+		case *notificationTxRemoved:
+			if len(txNotifications) != 0 {
+				m.notifyTxRemoved(txNotifications, n.tx,
+					n.reason)
+			}
 
-			case *notificationRegisterAddr:
-				m.addAddrRequests(watchedAddrs, n.wsc, n.addrs)
+		case *notificationWatchedSpend:
+			if len(watchedSpendNotifications) != 0 {
+				m.notifyWatchedSpend(watchedSpendNotifications,
+					(*btcjson.WatchedSpendResult)(n))
+			}
 
-			case *notificationUnregisterAddr:
-				m.removeAddrRequest(watchedAddrs, n.wsc, n.addr)
+		case *notificationRegisterBlocks:
+			wsc := (*wsClient)(n)
+			blockNotifications[wsc.quit] = wsc
+
+		case *notificationUnregisterBlocks:
+			wsc := (*wsClient)(n)
+			delete(blockNotifications, wsc.quit)
+
+		case *notificationRegisterClient:
+			wsc := (*wsClient)(n)
+			clients[wsc.quit] = wsc
+
+		case *notificationUnregisterClient:
+			wsc := (*wsClient)(n)
+			// Remove any requests made by the client as well as
+			// the client itself.
+			delete(blockNotifications, wsc.quit)
+			delete(txNotifications, wsc.quit)
+			delete(watchedSpendNotifications, wsc.quit)
+			for k := range wsc.spentRequests {
+				op := k
+				m.removeSpentRequest(watchedOutPoints, wsc, &op)
+			}
+			for addr := range wsc.addrRequests {
+				m.removeAddrRequest(watchedAddrs, wsc, addr)
+			}
+			delete(clients, wsc.quit)
 
-			case *notificationRegisterNewMempoolTxs:
-				wsc := (*wsClient)(n)
-				txNotifications[wsc.quit] = wsc
+		case *notificationRegisterSpent:
+			m.addSpentRequests(watchedOutPoints, n.wsc, n.ops)
 
-			case *notificationUnregisterNewMempoolTxs:
-				wsc := (*wsClient)(n)
-				delete(txNotifications, wsc.quit)
+		case *notificationUnregisterSpent:
+			m.removeSpentRequest(watchedOutPoints, n.wsc, n.op)
 
-			default:
-				rpcsLog.Warn("Unhandled notification type")
-			}
+		case *notificationRegisterAddr:
+			m.addAddrRequests(watchedAddrs, n.wsc, n.addrs)
 
-		case m.numClients <- len(clients):
+		case *notificationUnregisterAddr:
+			m.removeAddrRequest(watchedAddrs, n.wsc, n.addr)
 
-		case <-m.quit:
-			// RPC server shutting down.
-			break out
+		case *notificationRegisterNewMempoolTxs:
+			wsc := (*wsClient)(n)
+			txNotifications[wsc.quit] = wsc
+
+		case *notificationUnregisterNewMempoolTxs:
+			wsc := (*wsClient)(n)
+			delete(txNotifications, wsc.quit)
+
+		case *notificationRegisterWatchedSpends:
+			wsc := (*wsClient)(n)
+			watchedSpendNotifications[wsc.quit] = wsc
+
+		case *notificationUnregisterWatchedSpends:
+			wsc := (*wsClient)(n)
+			delete(watchedSpendNotifications, wsc.quit)
+
+		default:
+			rpcsLog.Warn("Unhandled notification type")
 		}
 	}
 
@@ -744,6 +908,69 @@ func (m *wsNotificationManager) UnregisterNewMempoolTxsUpdates(wsc *wsClient) {
 	m.queueNotification <- (*notificationUnregisterNewMempoolTxs)(wsc)
 }
 
+// RegisterWatchedSpendsUpdates requests notifications to the passed websocket
+// client when outputs paying to an address or key ID on the watchlist are
+// spent.
+func (m *wsNotificationManager) RegisterWatchedSpendsUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationRegisterWatchedSpends)(wsc)
+}
+
+// UnregisterWatchedSpendsUpdates removes notifications to the passed websocket
+// client when outputs paying to an address or key ID on the watchlist are
+// spent.
+func (m *wsNotificationManager) UnregisterWatchedSpendsUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationUnregisterWatchedSpends)(wsc)
+}
+
+// notifyTxExpired notifies websocket clients that have registered for updates
+// when a new transaction is added to the memory pool that the passed
+// transaction was evicted from the memory pool because it expired.
+func (m *wsNotificationManager) notifyTxExpired(clients map[chan struct{}]*wsClient, tx *provautil.Tx) {
+	ntfn := btcjson.NewTxExpiredNtfn(tx.Hash().String(),
+		txHexString(tx.MsgTx()))
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal tx expired notification: %v",
+			err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
+// notifyTxRemoved notifies websocket clients that have registered for updates
+// when a new transaction is added to the memory pool that the passed
+// transaction was removed from the memory pool for the passed reason.
+func (m *wsNotificationManager) notifyTxRemoved(clients map[chan struct{}]*wsClient, tx *provautil.Tx, reason mempool.RemovalReason) {
+	ntfn := btcjson.NewTxRemovedNtfn(tx.Hash().String(),
+		txHexString(tx.MsgTx()), reason.String())
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal tx removed notification: %v",
+			err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
+// notifyWatchedSpend notifies websocket clients that have registered for
+// watched spend updates of the passed spend.
+func (m *wsNotificationManager) notifyWatchedSpend(clients map[chan struct{}]*wsClient, spend *btcjson.WatchedSpendResult) {
+	ntfn := btcjson.NewWatchedSpendNtfn(*spend)
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal watched spend notification: "+
+			"%v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // notifyForNewTx notifies websocket clients that have registered for updates
 // when a new transaction is added to the memory pool.
 func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClient, tx *provautil.Tx) {
@@ -1103,8 +1330,9 @@ func (m *wsNotificationManager) RemoveClient(wsc *wsClient) {
 // Start starts the goroutines required for the manager to queue and process
 // websocket client notifications.
 func (m *wsNotificationManager) Start() {
-	m.wg.Add(2)
+	m.wg.Add(3)
 	go m.queueHandler()
+	go m.chainQueueHandler()
 	go m.notificationHandler()
 }
 
@@ -1124,11 +1352,13 @@ func (m *wsNotificationManager) Shutdown() {
 // See wsNotificationManager for more details.
 func newWsNotificationManager(server *rpcServer) *wsNotificationManager {
 	return &wsNotificationManager{
-		server:            server,
-		queueNotification: make(chan interface{}),
-		notificationMsgs:  make(chan interface{}),
-		numClients:        make(chan int),
-		quit:              make(chan struct{}),
+		server:                 server,
+		queueNotification:      make(chan interface{}),
+		queueChainNotification: make(chan interface{}),
+		chainNotificationMsgs:  make(chan interface{}),
+		notificationMsgs:       make(chan interface{}),
+		numClients:             make(chan int),
+		quit:                   make(chan struct{}),
 	}
 }
 
@@ -1178,6 +1408,10 @@ type wsClient struct {
 	// false means its access is only to the limited set of RPC calls.
 	isAdmin bool
 
+	// token is the websocket token the client authenticated with, if any.
+	// Such clients may only call the methods in the scope of the token.
+	token *wsToken
+
 	// sessionID is a random ID generated for each client when connected.
 	// These IDs may be queried by a client using the session RPC.  A change
 	// to the session ID indicates that the client reconnected.
@@ -1202,6 +1436,10 @@ type wsClient struct {
 	// `rescanblocks` methods.
 	filterData *wsClientFilter
 
+	// blockSub is the block subscription requested with subscribeblocks,
+	// if any.  It is protected by the client mutex.
+	blockSub *wsBlockSubscription
+
 	// Networking infrastructure.
 	serviceRequestSem semaphore
 	ntfnChan          chan []byte
@@ -1279,6 +1517,26 @@ out:
 			continue
 		}
 
+		// Reject requests whose message exceeds the maximum size for
+		// the class of their method.
+		class := rpcMethodClass(request.Method)
+		if int64(len(msg)) > class.maxBodySize() {
+			if !c.authenticated {
+				break out
+			}
+
+			jsonErr := rpcRequestTooLargeError(class, len(msg))
+			reply, err := createMarshalledReply(request.ID, nil,
+				jsonErr)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal request size "+
+					"reply: %v", err)
+				continue
+			}
+			c.SendMessage(reply, nil)
+			continue
+		}
+
 		cmd := parseCmd(&request)
 		if cmd.err != nil {
 			if !c.authenticated {
@@ -1335,9 +1593,31 @@ out:
 			continue
 		}
 
-		// Check if the client is using limited RPC credentials and
-		// error when not authorized to call this RPC.
-		if !c.isAdmin {
+		// Check if the client authenticated with a websocket token or
+		// is using limited RPC credentials and error when not
+		// authorized to call this RPC.  Clients whose token was
+		// revoked or expired are disconnected.
+		if c.token != nil {
+			if c.token.Revoked() || c.token.Expired(time.Now()) {
+				rpcsLog.Infof("Websocket token %s of client %s "+
+					"is no longer valid", c.token.id, c.addr)
+				break out
+			}
+			if !c.token.Allows(request.Method) {
+				jsonErr := &btcjson.RPCError{
+					Code:    btcjson.ErrRPCInvalidParams.Code,
+					Message: "token not authorized for this method",
+				}
+				reply, err := createMarshalledReply(request.ID, nil, jsonErr)
+				if err != nil {
+					rpcsLog.Errorf("Failed to marshal parse failure "+
+						"reply: %v", err)
+					continue
+				}
+				c.SendMessage(reply, nil)
+				continue
+			}
+		} else if !c.isAdmin {
 			if _, ok := rpcLimited[request.Method]; !ok {
 				jsonErr := &btcjson.RPCError{
 					Code:    btcjson.ErrRPCInvalidParams.Code,
@@ -1375,9 +1655,27 @@ out:
 		// that also reads a time.After channel.  This will unblock the
 		// read of the next request from the websocket client and allow
 		// many requests to be waited on concurrently.
+		//
+		// The request also counts towards the number of requests the
+		// RPC server services at once, in total and for the client,
+		// and is rejected when either limit is reached.
 		c.serviceRequestSem.acquire()
+		client := rpcClientHost(c.addr)
+		if !c.server.requestLimiter.acquire(client) {
+			c.serviceRequestSem.release()
+			reply, err := createMarshalledReply(cmd.id, nil,
+				ErrRPCTooManyRequests)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal request limit "+
+					"reply: %v", err)
+				continue
+			}
+			c.SendMessage(reply, nil)
+			continue
+		}
 		go func() {
 			c.serviceRequest(cmd)
+			c.server.requestLimiter.release(client)
 			c.serviceRequestSem.release()
 		}()
 	}
@@ -1390,21 +1688,24 @@ out:
 
 // serviceRequest services a parsed RPC request by looking up and executing the
 // appropriate RPC handler.  The response is marshalled and sent to the
-// websocket client.
+// websocket client.  It returns once the handler returns, even when the
+// request timed out before.
 func (c *wsClient) serviceRequest(r *parsedRPCCmd) {
-	var (
-		result interface{}
-		err    error
-	)
+	var handlerWg sync.WaitGroup
+	defer handlerWg.Wait()
 
 	// Lookup the websocket extension for the command and if it doesn't
 	// exist fallback to handling the command as a standard command.
-	wsHandler, ok := wsHandlers[r.method]
-	if ok {
-		result, err = wsHandler(c, r.cmd)
-	} else {
-		result, err = c.server.standardCmdResult(r, nil)
-	}
+	result, err := c.server.timedCmdResult(r, func() (interface{}, error) {
+		wsHandler, ok := wsHandlers[r.method]
+		if ok {
+			return wsHandler(c, r.cmd)
+		}
+
+		// Tie the lifetime of the request to the connection so long
+		// running commands are aborted when the client goes away.
+		return c.server.timeoutCmdResult(r, c.quit, &handlerWg)
+	})
 	reply, err := createMarshalledReply(r.id, result, err)
 	if err != nil {
 		rpcsLog.Errorf("Failed to marshal reply for <%s> "+
@@ -1595,6 +1896,30 @@ func (c *wsClient) Disconnect() {
 	c.disconnected = true
 }
 
+// watchToken disconnects the client once the websocket token it authenticated
+// with is revoked or expires.  It returns when the client disconnects first.
+// It must be run as a goroutine.
+func (c *wsClient) watchToken() {
+	var expired <-chan time.Time
+	if !c.token.expires.IsZero() {
+		timer := time.NewTimer(c.token.expires.Sub(time.Now()))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-c.token.revoked:
+		rpcsLog.Infof("Disconnecting websocket client %s since its "+
+			"token %s was revoked", c.addr, c.token.id)
+	case <-expired:
+		rpcsLog.Infof("Disconnecting websocket client %s since its "+
+			"token %s expired", c.addr, c.token.id)
+	case <-c.quit:
+		return
+	}
+	c.Disconnect()
+}
+
 // Start begins processing input and output messages.
 func (c *wsClient) Start() {
 	rpcsLog.Tracef("Starting websocket client %s", c.addr)
@@ -1789,6 +2114,174 @@ func handleStopNotifyNewTransactions(wsc *wsClient, icmd interface{}) (interface
 	return nil, nil
 }
 
+// handleNotifyWatchedSpends implements the notifywatchedspends command
+// extension for websocket connections.
+func handleNotifyWatchedSpends(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.RegisterWatchedSpendsUpdates(wsc)
+	return nil, nil
+}
+
+// handleStopNotifyWatchedSpends implements the stopnotifywatchedspends command
+// extension for websocket connections.
+func handleStopNotifyWatchedSpends(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.UnregisterWatchedSpendsUpdates(wsc)
+	return nil, nil
+}
+
+// wsBlockSubscription houses the block subscription of a websocket client
+// along with the state needed to stop sending its notifications.
+type wsBlockSubscription struct {
+	sub  *blockchain.BlockSubscription
+	quit chan struct{}
+	done chan struct{}
+}
+
+// sendSubscriptionNtfn sends the passed marshalled notification of the block
+// subscription to the client and waits until it was written.  Unlike
+// QueueNotification, which never blocks, this only lets the subscription
+// proceed as fast as the client receives its notifications, so the events of
+// the subscription are held back by the bounded send channel of the client
+// rather than piling up in memory.  It returns false when the client
+// disconnected before the notification was written.
+func (c *wsClient) sendSubscriptionNtfn(marshalledJSON []byte) bool {
+	doneChan := make(chan bool, 1)
+	select {
+	case c.sendChan <- wsResponse{msg: marshalledJSON, doneChan: doneChan}:
+	case <-c.quit:
+		return false
+	}
+	select {
+	case sent := <-doneChan:
+		return sent
+	case <-c.quit:
+		return false
+	}
+}
+
+// blockSubscriptionHandler sends the events of the passed block subscription to
+// the client until the subscription or the client is stopped.  It must be run
+// as a goroutine.
+func (c *wsClient) blockSubscriptionHandler(bs *wsBlockSubscription) {
+	defer close(bs.done)
+	defer bs.sub.Stop()
+
+	for {
+		var event *blockchain.BlockEvent
+		var ok bool
+		select {
+		case event, ok = <-bs.sub.Events():
+		case <-bs.quit:
+			return
+		case <-c.quit:
+			return
+		}
+		if !ok {
+			if err := bs.sub.Err(); err != nil {
+				rpcsLog.Errorf("Block subscription of websocket "+
+					"client %s failed: %v", c.addr, err)
+			}
+			return
+		}
+
+		block := event.Block
+		header := &block.MsgBlock().Header
+		var ntfn interface{}
+		switch event.Type {
+		case blockchain.NTBlockConnected:
+			blockBytes, err := block.Bytes()
+			if err != nil {
+				rpcsLog.Errorf("Failed to serialize block %v for "+
+					"block subscription: %v", block.Hash(), err)
+				return
+			}
+			ntfn = btcjson.NewSubscribedBlockConnectedNtfn(
+				block.Hash().String(), int32(header.Height),
+				header.Timestamp.Unix(),
+				hex.EncodeToString(blockBytes))
+
+		case blockchain.NTBlockDisconnected:
+			ntfn = btcjson.NewSubscribedBlockDisconnectedNtfn(
+				block.Hash().String(), int32(header.Height),
+				header.Timestamp.Unix())
+
+		default:
+			continue
+		}
+		marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+		if err != nil {
+			rpcsLog.Errorf("Failed to marshal block subscription "+
+				"notification: %v", err)
+			return
+		}
+
+		// Don't send notifications of a subscription which was
+		// replaced or stopped while the event was prepared.
+		select {
+		case <-bs.quit:
+			return
+		default:
+		}
+		if !c.sendSubscriptionNtfn(marshalledJSON) {
+			return
+		}
+	}
+}
+
+// stopBlockSubscription stops the block subscription of the client, if any, and
+// waits until its notifications are no longer sent.
+func (c *wsClient) stopBlockSubscription() {
+	c.Lock()
+	bs := c.blockSub
+	c.blockSub = nil
+	c.Unlock()
+
+	if bs != nil {
+		close(bs.quit)
+		<-bs.done
+	}
+}
+
+// handleSubscribeBlocks implements the subscribeblocks command extension for
+// websocket connections.  It replaces any existing block subscription of the
+// client.
+func handleSubscribeBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	cmd, ok := icmd.(*btcjson.SubscribeBlocksCmd)
+	if !ok {
+		return nil, btcjson.ErrRPCInternal
+	}
+
+	// Stop the previous subscription first so none of its notifications
+	// are sent after those of the new one.
+	wsc.stopBlockSubscription()
+
+	bs := &wsBlockSubscription{
+		sub: wsc.server.chain.SubscribeBlocks(cmd.StartHeight,
+			blockSubscriptionQueueSize),
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	wsc.Lock()
+	prev := wsc.blockSub
+	wsc.blockSub = bs
+	wsc.Unlock()
+	go wsc.blockSubscriptionHandler(bs)
+
+	// Another subscribeblocks request of the client may have replaced the
+	// previous subscription in the meantime.
+	if prev != nil {
+		close(prev.quit)
+		<-prev.done
+	}
+	return nil, nil
+}
+
+// handleUnsubscribeBlocks implements the unsubscribeblocks command extension for
+// websocket connections.
+func handleUnsubscribeBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.stopBlockSubscription()
+	return nil, nil
+}
+
 // handleNotifyReceived implements the notifyreceived command extension for
 // websocket connections.
 func handleNotifyReceived(wsc *wsClient, icmd interface{}) (interface{}, error) {
@@ -1853,10 +2346,15 @@ func handleStopNotifyReceived(wsc *wsClient, icmd interface{}) (interface{}, err
 // checkAddressValidity checks the validity of each address in the passed
 // string slice. It does this by attempting to decode each address using the
 // current active network parameters. If any single address fails to decode
-// properly, the function returns an error. Otherwise, nil is returned.
+// properly or is for another network, the function returns an error.
+// Otherwise, nil is returned.
 func checkAddressValidity(addrs []string) error {
 	for _, addr := range addrs {
-		_, err := provautil.DecodeAddress(addr, activeNetParams.Params)
+		_, err := provautil.DecodeAddressForNet(addr,
+			activeNetParams.Params)
+		if _, ok := err.(*provautil.WrongNetworkError); ok {
+			return rpcAddressError(err)
+		}
 		if err != nil {
 			return &btcjson.RPCError{
 				Code: btcjson.ErrRPCInvalidAddressOrKey,
@@ -2135,10 +2633,10 @@ func handleRescanBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
 // verifies that the new range of blocks is on the same fork as a previous
 // range of blocks.  If this condition does not hold true, the JSON-RPC error
 // for an unrecoverable reorganize is returned.
-func recoverFromReorg(chain *blockchain.BlockChain, minBlock, maxBlock uint32,
-	lastBlock *chainhash.Hash) ([]chainhash.Hash, error) {
+func recoverFromReorg(ctx context.Context, chain *blockchain.BlockChain,
+	minBlock, maxBlock uint32, lastBlock *chainhash.Hash) ([]chainhash.Hash, error) {
 
-	hashList, err := chain.HeightRange(minBlock, maxBlock)
+	hashList, err := chain.HeightRangeContext(ctx, minBlock, maxBlock)
 	if err != nil {
 		rpcsLog.Errorf("Error looking up block range: %v", err)
 		return nil, &btcjson.RPCError{
@@ -2222,7 +2720,11 @@ func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
 		unspent:             map[wire.OutPoint]struct{}{},
 	}
 	for _, addrStr := range cmd.Addresses {
-		_, err := provautil.DecodeAddress(addrStr, activeNetParams.Params)
+		_, err := provautil.DecodeAddressForNet(addrStr,
+			activeNetParams.Params)
+		if _, ok := err.(*provautil.WrongNetworkError); ok {
+			return nil, rpcAddressError(err)
+		}
 		if err != nil {
 			jsonErr := btcjson.RPCError{
 				Code: btcjson.ErrRPCInvalidAddressOrKey,
@@ -2274,6 +2776,10 @@ func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
 	var lastBlock *provautil.Block
 	var lastBlockHash *chainhash.Hash
 
+	// Abort fetching block hashes once the client disconnects.
+	ctx, cancel := closeChanContext(wsc.quit)
+	defer cancel()
+
 	// A ticker is created to wait at least 10 seconds before notifying the
 	// websocket client of the current progress completed by the rescan.
 	ticker := time.NewTicker(10 * time.Second)
@@ -2292,7 +2798,13 @@ fetchRange:
 		if maxLoopBlock-minBlock > wire.MaxInvPerMsg {
 			maxLoopBlock = minBlock + wire.MaxInvPerMsg
 		}
-		hashList, err := chain.HeightRange(minBlock, maxLoopBlock)
+		hashList, err := chain.HeightRangeContext(ctx, minBlock,
+			maxLoopBlock)
+		if err == context.Canceled {
+			rpcsLog.Debugf("Stopped rescan at height %v for "+
+				"disconnected client", minBlock)
+			return nil, nil
+		}
 		if err != nil {
 			rpcsLog.Errorf("Error looking up block range: %v", err)
 			return nil, &btcjson.RPCError{
@@ -2385,7 +2897,7 @@ fetchRange:
 				// before the range was evaluated, as it must be
 				// reevaluated for the new hashList.
 				minBlock += uint32(i)
-				hashList, err = recoverFromReorg(chain,
+				hashList, err = recoverFromReorg(ctx, chain,
 					minBlock, maxBlock, lastBlockHash)
 				if err != nil {
 					return nil, err
@@ -0,0 +1,334 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// wsTestNtfn is a websocket notification received by a test client.
+type wsTestNtfn struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// ntfnStreamChecker follows the stream of notifications received by a websocket
+// client and ensures the chain notifications honor the ordering guarantee of
+// the notification manager.
+type ntfnStreamChecker struct {
+	// chain holds the hashes of the main chain blocks by height, as
+	// described by the notifications received so far.
+	chain []string
+
+	// pendingTx is the hash of the connected block whose recvtx
+	// notification for its coinbase has not been received yet.
+	pendingTx string
+
+	disconnects int
+	txAccepted  int
+}
+
+// check applies the passed notification to the stream and returns an error when
+// it breaks the ordering guarantee.
+func (c *ntfnStreamChecker) check(msg []byte) error {
+	var n wsTestNtfn
+	if err := json.Unmarshal(msg, &n); err != nil {
+		return err
+	}
+	switch n.Method {
+	case btcjson.BlockConnectedNtfnMethod, btcjson.BlockDisconnectedNtfnMethod:
+		var hash string
+		var height int
+		if err := json.Unmarshal(n.Params[0], &hash); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(n.Params[1], &height); err != nil {
+			return err
+		}
+		if c.pendingTx != "" {
+			return fmt.Errorf("%s %s before the recvtx of block %s",
+				n.Method, hash, c.pendingTx)
+		}
+		if n.Method == btcjson.BlockConnectedNtfnMethod {
+			if height != len(c.chain) {
+				return fmt.Errorf("connected block %s at height "+
+					"%d does not extend the tip at height %d",
+					hash, height, len(c.chain)-1)
+			}
+			c.chain = append(c.chain, hash)
+			c.pendingTx = hash
+			return nil
+		}
+		tip := len(c.chain) - 1
+		if height != tip || c.chain[tip] != hash {
+			return fmt.Errorf("disconnected block %s at height %d is "+
+				"not the tip %s at height %d", hash, height,
+				c.chain[tip], tip)
+		}
+		c.chain = c.chain[:tip]
+		c.disconnects++
+
+	case btcjson.FilteredBlockConnectedNtfnMethod:
+		var height int
+		if err := json.Unmarshal(n.Params[0], &height); err != nil {
+			return err
+		}
+		if height != len(c.chain)-1 {
+			return fmt.Errorf("filteredblockconnected at height %d "+
+				"with the tip at height %d", height,
+				len(c.chain)-1)
+		}
+
+	case btcjson.RecvTxNtfnMethod:
+		if len(n.Params) < 2 || string(n.Params[1]) == "null" {
+			// Transaction accepted into the memory pool.
+			return nil
+		}
+		var details btcjson.BlockDetails
+		if err := json.Unmarshal(n.Params[1], &details); err != nil {
+			return err
+		}
+		if details.Hash != c.pendingTx {
+			return fmt.Errorf("recvtx of block %s while expecting "+
+				"the recvtx of block %q", details.Hash,
+				c.pendingTx)
+		}
+		c.pendingTx = ""
+
+	case btcjson.TxAcceptedNtfnMethod:
+		c.txAccepted++
+	}
+	return nil
+}
+
+// TestNotificationOrdering ensures the chain notifications received by a
+// websocket client during rapid reorganizations honor the ordering guarantee,
+// with the blockconnected notification of each block preceding the
+// notifications of its transactions and disconnected blocks notified from the
+// tip down before the blocks of the replacing branch are connected, while
+// memory pool notifications are delivered concurrently.
+func TestNotificationOrdering(t *testing.T) {
+	const (
+		numReorgs      = 12
+		numMempoolTxns = 300
+	)
+	defer func(c *config, p *params) {
+		cfg = c
+		activeNetParams = p
+	}(cfg, activeNetParams)
+	activeNetParams = &regressionNetParams
+	chainParams := activeNetParams.Params
+
+	tmpDir, err := ioutil.TempDir("", "ntfnordering")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cfg = newTestConfig(tmpDir)
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		chainParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+	s, err := newServer(nil, db, chainParams)
+	if err != nil {
+		t.Fatalf("newServer: unexpected error: %v", err)
+	}
+	chain := s.blockManager.chain
+	rpc := &rpcServer{
+		server:       s,
+		chain:        chain,
+		gbtWorkState: newGbtWorkState(s.timeSource),
+	}
+	rpc.ntfnMgr = newWsNotificationManager(rpc)
+	s.rpcServer = rpc
+	rpc.ntfnMgr.Start()
+	s.Start()
+	defer func() {
+		s.Stop()
+		s.WaitForShutdown()
+	}()
+
+	// Register a client for block notifications, notifications of the
+	// transactions paying to the pay address of the harness, and new
+	// memory pool transactions.  The client is added last, so all of the
+	// requests were handled once it is counted.
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	h.generator = h.newGenerator(chain)
+	m := rpc.ntfnMgr
+	wsc := &wsClient{
+		addr:          "test",
+		addrRequests:  make(map[string]struct{}),
+		spentRequests: make(map[wire.OutPoint]struct{}),
+		ntfnChan:      make(chan []byte, 64),
+		quit:          make(chan struct{}),
+	}
+	m.RegisterBlockUpdates(wsc)
+	m.RegisterTxOutAddressRequests(wsc, []string{h.payAddr.EncodeAddress()})
+	m.RegisterNewMempoolTxsUpdates(wsc)
+	m.AddClient(wsc)
+	for m.NumClients() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Check the stream of notifications as it is received until the
+	// expected tip is sent, draining the client until it is removed.
+	checker := &ntfnStreamChecker{
+		chain: []string{chainParams.GenesisHash.String()},
+	}
+	finalTip := make(chan string, 1)
+	checked := make(chan error, 1)
+	stop := make(chan struct{})
+	var readerWg sync.WaitGroup
+	readerWg.Add(1)
+	go func() {
+		defer readerWg.Done()
+		var tip string
+		var err error
+		done := false
+		for {
+			select {
+			case msg := <-wsc.ntfnChan:
+				if err != nil || done {
+					continue
+				}
+				err = checker.check(msg)
+				if err != nil {
+					checked <- err
+				}
+			case tip = <-finalTip:
+			case <-stop:
+				return
+			}
+			if err == nil && !done && tip != "" &&
+				checker.chain[len(checker.chain)-1] == tip &&
+				checker.pendingTx == "" &&
+				checker.txAccepted == numMempoolTxns {
+
+				done = true
+				checked <- nil
+			}
+		}
+	}()
+
+	// Flood the manager with memory pool notifications while the chain is
+	// reorganized.
+	payScript, err := txscript.PayToAddrScript(h.payAddr)
+	if err != nil {
+		t.Fatalf("unable to create pkScript: %v", err)
+	}
+	var floodWg sync.WaitGroup
+	floodWg.Add(1)
+	go func() {
+		defer floodWg.Done()
+		for i := 0; i < numMempoolTxns; i++ {
+			tx := wire.NewMsgTx(1)
+			tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+				uint32(i)), nil))
+			tx.AddTxOut(wire.NewTxOut(1000, payScript))
+			m.NotifyMempoolTx(provautil.NewTx(tx), true)
+		}
+	}()
+
+	// Each round extends the tip with a branch, then builds a longer
+	// competing branch from the same fork point which reorganizes the
+	// chain.  Blocks at the same height of both branches are generated
+	// from the same template and told apart by their coinbase script, and
+	// every coinbase pays to the watched address.
+	newBlock := func(prevHash *chainhash.Hash, variant byte) *wire.MsgBlock {
+		msgBlock := h.generateBlock(t)
+		coinbase := msgBlock.Transactions[0]
+		coinbase.TxOut[0].PkScript = payScript
+		coinbase.TxIn[0].SignatureScript = append(
+			coinbase.TxIn[0].SignatureScript, variant)
+		if prevHash != nil {
+			msgBlock.Header.PrevBlock = *prevHash
+		}
+		h.finishModifiedBlock(t, msgBlock)
+		return msgBlock
+	}
+	processBlock := func(msgBlock *wire.MsgBlock) {
+		block := provautil.NewBlock(msgBlock)
+		_, _, err := s.blockManager.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+	}
+	for round := 0; round < numReorgs; round++ {
+		depth := round%3 + 1
+		var competing []*wire.MsgBlock
+		var prevHash *chainhash.Hash
+		for i := 0; i <= depth; i++ {
+			msgBlock := newBlock(prevHash, 1)
+			hash := msgBlock.BlockHash()
+			prevHash = &hash
+			competing = append(competing, msgBlock)
+			if i < depth {
+				processBlock(newBlock(nil, 0))
+			}
+		}
+		for _, msgBlock := range competing {
+			processBlock(msgBlock)
+		}
+		best := chain.BestSnapshot()
+		if *best.Hash != *prevHash {
+			t.Fatalf("round %d: best block is %v, want %v", round,
+				best.Hash, prevHash)
+		}
+	}
+	floodWg.Wait()
+	finalTip <- chain.BestSnapshot().Hash.String()
+
+	var checkErr error
+	timedOut := false
+	select {
+	case checkErr = <-checked:
+	case <-time.After(time.Second * 10):
+		timedOut = true
+	}
+
+	m.RemoveClient(wsc)
+	for m.NumClients() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	m.Shutdown()
+	m.WaitForShutdown()
+	close(stop)
+	readerWg.Wait()
+
+	if checkErr != nil {
+		t.Fatalf("unexpected notification order: %v", checkErr)
+	}
+	if timedOut {
+		t.Fatalf("timed out waiting for notifications: tip %d, pending "+
+			"recvtx %q, %d txaccepted", len(checker.chain)-1,
+			checker.pendingTx, checker.txAccepted)
+	}
+	wantDisconnects := 0
+	for round := 0; round < numReorgs; round++ {
+		wantDisconnects += round%3 + 1
+	}
+	if checker.disconnects != wantDisconnects {
+		t.Fatalf("got %d disconnected blocks, want %d",
+			checker.disconnects, wantDisconnects)
+	}
+}
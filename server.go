@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -54,6 +55,21 @@ const (
 	// retries when connecting to persistent peers.  It is adjusted by the
 	// number of retries such that there is a retry backoff.
 	connectionRetryInterval = time.Second * 5
+
+	// outboundOnlyRetryInterval is the base amount of time to wait in
+	// between retries when connecting to the connect peers in outbound-only
+	// mode.  It is much shorter than connectionRetryInterval since those
+	// peers are the only ones the server ever connects to.
+	outboundOnlyRetryInterval = time.Second
+
+	// outboundOnlyMaxRetryInterval is the maximum amount of time the retry
+	// backoff is allowed to grow to in outbound-only mode.
+	outboundOnlyMaxRetryInterval = time.Second * 10
+
+	// maxUnknownTxns is the maximum number of transactions per peer which
+	// the peer is known not to have that are tracked so the transactions
+	// spending them can be delivered along with them.
+	maxUnknownTxns = 100
 )
 
 var (
@@ -123,12 +139,11 @@ type updatePeerHeightsMsg struct {
 }
 
 // peerState maintains state of inbound, persistent, outbound peers as well
-// as banned peers and outbound groups.
+// as outbound groups.
 type peerState struct {
 	inboundPeers    map[int32]*serverPeer
 	outboundPeers   map[int32]*serverPeer
 	persistentPeers map[int32]*serverPeer
-	banned          map[string]time.Time
 	outboundGroups  map[string]int
 }
 
@@ -171,11 +186,26 @@ type server struct {
 
 	chainParams          *chaincfg.Params
 	addrManager          *addrmgr.AddrManager
+	addrRelay            *addrRelay
 	connManager          *connmgr.ConnManager
 	sigCache             *txscript.SigCache
 	hashCache            *txscript.HashCache
 	rpcServer            *rpcServer
+	grpcServer           *grpcServer
+	debugServer          *debugServer
 	blockManager         *blockManager
+	replication          *replicationClient
+	blockScrubber        *blockScrubber
+	webhookNotifier      *webhookNotifier
+	blockBroadcaster     *blockBroadcaster
+	peerStats            *peerStatsStore
+	rejectStats          *rejectStats
+	relayLatency         *relayLatencyStats
+	eventLog             *peer.EventLog
+	watchlist            *watchlist
+	wsTokens             *wsTokenStore
+	banList              *banList
+	statsHistory         *statsHistory
 	txMemPool            *mempool.TxPool
 	cpuMiner             *cpuminer.CPUMiner
 	modifyRebroadcastInv chan interface{}
@@ -193,19 +223,34 @@ type server struct {
 	timeSource           blockchain.MedianTimeSource
 	services             wire.ServiceFlag
 
+	// readOnly indicates the block database was opened read-only, in which
+	// case nothing which modifies the chain or the database is permitted.
+	readOnly bool
+
+	// deprioritizedAddrs houses the addresses of outbound peers whose user
+	// agent matched one of the deprioritizeuseragent patterns so they are
+	// tried last when choosing outbound peers.
+	deprioritizedMtx   sync.Mutex
+	deprioritizedAddrs map[string]struct{}
+
 	// The following fields are used for optional indexes.  They will be nil
-	// if the associated index is not enabled.  These fields are set during
-	// initial creation of the server and never changed afterwards, so they
-	// do not need to be protected for concurrent access.
-	txIndex   *indexers.TxIndex
-	addrIndex *indexers.AddrIndex
+	// if the associated index is not enabled.  The index manager is also nil
+	// in read-only mode.  These fields are set during initial creation of
+	// the server and never changed afterwards, so they do not need to be
+	// protected for concurrent access.
+	indexManager  *indexers.Manager
+	txIndex       *indexers.TxIndex
+	addrIndex     *indexers.AddrIndex
+	issuanceIndex *indexers.IssuanceIndex
 }
 
 // serverPeer extends the peer to maintain state shared by the server and
 // the blockmanager.
 type serverPeer struct {
 	// The following variables must only be used atomically
-	feeFilter int64
+	feeFilter      int64
+	blocksServed   uint64
+	blocksReceived uint64
 
 	*peer.Peer
 
@@ -219,10 +264,26 @@ type serverPeer struct {
 	requestQueue    []*wire.InvVect
 	requestedTxns   map[chainhash.Hash]struct{}
 	requestedBlocks map[chainhash.Hash]struct{}
+	blockTimeouts   int
 	filter          *bloom.Filter
+	knownAddrsMtx   sync.Mutex
 	knownAddresses  map[string]struct{}
 	banScore        connmgr.DynamicBanScore
+	deprioritized   bool
 	quit            chan struct{}
+
+	// unknownTxns holds the transactions the peer rejected for paying too
+	// little fee or reported as not found.  The transactions spending them
+	// are delivered to the peer right after them instead of announced, so
+	// the peer can evaluate them together when a child pays for its
+	// parent.  It is protected by the relay mutex.
+	unknownTxns map[chainhash.Hash]struct{}
+
+	// chainTip is the best block known of the peer, which is used to
+	// detect chain splits among the peers.  It is only accessed by the
+	// block handler of the block manager.
+	chainTip peerTip
+
 	// The following chans are used to sync blockmanager and server.
 	txProcessed    chan struct{}
 	blockProcessed chan struct{}
@@ -239,6 +300,7 @@ func newServerPeer(s *server, isPersistent bool) *serverPeer {
 		filter:          bloom.LoadFilter(nil),
 		knownAddresses:  make(map[string]struct{}),
 		quit:            make(chan struct{}),
+		unknownTxns:     make(map[chainhash.Hash]struct{}),
 		txProcessed:     make(chan struct{}, 1),
 		blockProcessed:  make(chan struct{}, 1),
 	}
@@ -251,17 +313,36 @@ func (sp *serverPeer) newestBlock() (*chainhash.Hash, uint32, error) {
 	return best.Hash, best.Height, nil
 }
 
+// BlocksServed returns the number of blocks sent to the peer in response to
+// its requests.
+//
+// This function is safe for concurrent access.
+func (sp *serverPeer) BlocksServed() uint64 {
+	return atomic.LoadUint64(&sp.blocksServed)
+}
+
+// BlocksReceived returns the number of blocks received from the peer.
+//
+// This function is safe for concurrent access.
+func (sp *serverPeer) BlocksReceived() uint64 {
+	return atomic.LoadUint64(&sp.blocksReceived)
+}
+
 // addKnownAddresses adds the given addresses to the set of known addresses to
 // the peer to prevent sending duplicate addresses.
 func (sp *serverPeer) addKnownAddresses(addresses []*wire.NetAddress) {
+	sp.knownAddrsMtx.Lock()
 	for _, na := range addresses {
 		sp.knownAddresses[addrmgr.NetAddressKey(na)] = struct{}{}
 	}
+	sp.knownAddrsMtx.Unlock()
 }
 
 // addressKnown true if the given address is already known to the peer.
 func (sp *serverPeer) addressKnown(na *wire.NetAddress) bool {
+	sp.knownAddrsMtx.Lock()
 	_, exists := sp.knownAddresses[addrmgr.NetAddressKey(na)]
+	sp.knownAddrsMtx.Unlock()
 	return exists
 }
 
@@ -284,6 +365,53 @@ func (sp *serverPeer) relayTxDisabled() bool {
 	return isDisabled
 }
 
+// addUnknownTx records that the peer doesn't have the passed transaction.  A
+// random transaction is forgotten when the maximum number are tracked.
+//
+// This function is safe for concurrent access.
+func (sp *serverPeer) addUnknownTx(hash *chainhash.Hash) {
+	sp.relayMtx.Lock()
+	defer sp.relayMtx.Unlock()
+
+	if _, exists := sp.unknownTxns[*hash]; !exists &&
+		len(sp.unknownTxns) >= maxUnknownTxns {
+
+		for txHash := range sp.unknownTxns {
+			delete(sp.unknownTxns, txHash)
+			break
+		}
+	}
+	sp.unknownTxns[*hash] = struct{}{}
+}
+
+// takeUnknownParents returns the transactions in the memory pool spent by the
+// passed transaction which the peer doesn't have, in the order they are first
+// spent, and forgets them since they are about to be delivered to the peer.
+//
+// This function is safe for concurrent access.
+func (sp *serverPeer) takeUnknownParents(tx *provautil.Tx) []*provautil.Tx {
+	sp.relayMtx.Lock()
+	defer sp.relayMtx.Unlock()
+
+	if len(sp.unknownTxns) == 0 {
+		return nil
+	}
+	var parents []*provautil.Tx
+	for _, txIn := range tx.MsgTx().TxIn {
+		parentHash := txIn.PreviousOutPoint.Hash
+		if _, exists := sp.unknownTxns[parentHash]; !exists {
+			continue
+		}
+		delete(sp.unknownTxns, parentHash)
+		parent, err := sp.server.txMemPool.FetchTransaction(&parentHash)
+		if err != nil {
+			continue
+		}
+		parents = append(parents, parent)
+	}
+	return parents
+}
+
 // pushAddrMsg sends an addr message to the connected peer using the provided
 // addresses.
 func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
@@ -356,20 +484,26 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) {
 	// remote peer for outbound connections.  This is skipped when running
 	// on the simulation test network since it is only intended to connect
 	// to specified peers and actively avoids advertising and connecting to
-	// discovered peers.
-	if !cfg.SimNet {
+	// discovered peers.  Outbound-only mode never advertises or connects
+	// to discovered peers either.
+	if !cfg.SimNet && !cfg.OutboundOnly {
 		addrManager := sp.server.addrManager
 		// Outbound connections.
 		if !sp.Inbound() {
 			// TODO(davec): Only do this if not doing the initial block
 			// download and the local address is routable.
 			if !cfg.DisableListen /* && isCurrent? */ {
-				// Get address that best matches.
+				// Get address that best matches.  It is not
+				// announced when advertising is disabled or
+				// when it is in a private network.
 				lna := addrManager.GetBestLocalAddress(sp.NA())
 				if addrmgr.IsRoutable(lna) {
-					// Filter addresses the peer already knows about.
-					addresses := []*wire.NetAddress{lna}
-					sp.pushAddrMsg(addresses)
+					if cfg.NoAdvertise {
+						sp.server.addrRelay.SuppressSelf()
+					} else {
+						addresses := []*wire.NetAddress{lna}
+						sp.relayAddrs(addresses)
+					}
 				}
 			}
 
@@ -387,6 +521,18 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) {
 		}
 	}
 
+	// Note peers running software known to be unreliable so they are tried
+	// last when choosing outbound peers in the future.
+	for _, pattern := range cfg.deprioritizeAgents {
+		if pattern.MatchString(msg.UserAgent) {
+			sp.deprioritized = true
+			break
+		}
+	}
+	if sp.deprioritized && !sp.Inbound() {
+		sp.server.deprioritizeAddr(addrmgr.NetAddressKey(sp.NA()))
+	}
+
 	// Add valid peer to the server.
 	sp.server.AddPeer(sp)
 }
@@ -467,11 +613,13 @@ func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
 }
 
 // OnBlock is invoked when a peer receives a block bitcoin message.  It
-// blocks until the bitcoin block has been fully processed.
+// blocks until the bitcoin block has been queued in the validation pipeline of
+// the block manager, or fully processed in regression test mode.
 func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 	// Convert the raw MsgBlock to a provautil.Block which provides some
 	// convenience methods and things such as hash caching.
 	block := provautil.NewBlockFromBlockAndBytes(msg, buf)
+	atomic.AddUint64(&sp.blocksReceived, 1)
 
 	// Add the block to the known inventory for the peer.
 	iv := wire.NewInvVect(wire.InvTypeBlock, block.Hash())
@@ -479,15 +627,16 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 
 	// Queue the block up to be handled by the block
 	// manager and intentionally block further receives
-	// until the bitcoin block is fully processed and known
-	// good or bad.  This helps prevent a malicious peer
-	// from queuing up a bunch of bad blocks before
+	// until the bitcoin block is queued in the bounded
+	// validation pipeline.  This helps prevent a malicious
+	// peer from queuing up a bunch of bad blocks before
 	// disconnecting (or being disconnected) and wasting
-	// memory.  Additionally, this behavior is depended on
-	// by at least the block acceptance test tool as the
-	// reference implementation processes blocks in the same
-	// thread and therefore blocks further messages until
-	// the bitcoin block has been fully processed.
+	// memory.  In regression test mode, further receives
+	// are blocked until the bitcoin block is fully
+	// processed and known good or bad since this behavior
+	// is depended on by at least the block acceptance test
+	// tool as the reference implementation processes
+	// blocks in the same thread.
 	sp.server.blockManager.QueueBlock(block, sp)
 	<-sp.blockProcessed
 }
@@ -529,6 +678,15 @@ func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
 	}
 }
 
+// OnHeaders is invoked when a peer receives a headers bitcoin message.  The
+// headers are passed on to the block manager, which tracks the best block
+// known of the peer.
+func (sp *serverPeer) OnHeaders(_ *peer.Peer, msg *wire.MsgHeaders) {
+	if len(msg.Headers) > 0 {
+		sp.server.blockManager.QueueHeaders(msg, sp)
+	}
+}
+
 // handleGetData is invoked when a peer receives a getdata bitcoin message and
 // is used to deliver block and transaction information.
 func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
@@ -561,12 +719,32 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 			// Buffered so as to not make the send goroutine block.
 			c = make(chan struct{}, 1)
 		}
+		// Blocks outside of the served history are rejected so the peer
+		// can request them elsewhere right away.
+		if (iv.Type == wire.InvTypeBlock ||
+			iv.Type == wire.InvTypeFilteredBlock) &&
+			!sp.server.servesBlock(&iv.Hash) {
+
+			reason := fmt.Sprintf("only the last %d blocks are served",
+				cfg.RetainBlocks)
+			sp.PushRejectMsg(wire.CmdBlock, wire.RejectObsolete, reason,
+				&iv.Hash, false)
+			if c != nil {
+				c <- struct{}{}
+			}
+			numAdded++
+			continue
+		}
+
 		var err error
 		switch iv.Type {
 		case wire.InvTypeTx:
 			err = sp.server.pushTxMsg(sp, &iv.Hash, c, waitChan)
 		case wire.InvTypeBlock:
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan)
+			if err == nil {
+				atomic.AddUint64(&sp.blocksServed, 1)
+			}
 		case wire.InvTypeFilteredBlock:
 			err = sp.server.pushMerkleBlockMsg(sp, &iv.Hash, c, waitChan)
 		default:
@@ -603,6 +781,22 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 	}
 }
 
+// servesBlock returns whether or not the block with the passed hash is served
+// to peers.  All blocks are served unless the node only serves a limited block
+// history, in which case blocks of the main chain which are older than the
+// most recent cfg.RetainBlocks blocks are not.
+func (s *server) servesBlock(hash *chainhash.Hash) bool {
+	if cfg.RetainBlocks == 0 {
+		return true
+	}
+	chain := s.blockManager.chain
+	height, err := chain.BlockHeightByHash(hash)
+	if err != nil {
+		return true
+	}
+	return height+cfg.RetainBlocks > chain.BestSnapshot().Height
+}
+
 // OnGetBlocks is invoked when a peer receives a getblocks bitcoin
 // message.
 func (sp *serverPeer) OnGetBlocks(_ *peer.Peer, msg *wire.MsgGetBlocks) {
@@ -669,13 +863,12 @@ func (sp *serverPeer) OnGetBlocks(_ *peer.Peer, msg *wire.MsgGetBlocks) {
 	}
 }
 
-// locateBlocks returns the hashes of the blocks after the first known block in
-// locators, until hashStop is reached, or up to a max of
-// wire.MaxBlockHeadersPerMsg block hashes.  This implements the search
-// algorithm used by getheaders.
-func (s *server) locateBlocks(locators []*chainhash.Hash, hashStop *chainhash.Hash) ([]chainhash.Hash, error) {
+// locateBlocks returns the hashes of the blocks in the main chain of the passed
+// chain after the first known block in locators, until hashStop is reached, or
+// up to a max of wire.MaxBlockHeadersPerMsg block hashes.  This implements the
+// search algorithm used by getheaders.
+func locateBlocks(chain *blockchain.BlockChain, locators []*chainhash.Hash, hashStop *chainhash.Hash) ([]chainhash.Hash, error) {
 	// Attempt to look up the height of the provided stop hash.
-	chain := s.blockManager.chain
 	endIdx := uint32(math.MaxUint32)
 	height, err := chain.BlockHeightByHash(hashStop)
 	if err == nil {
@@ -688,7 +881,7 @@ func (s *server) locateBlocks(locators []*chainhash.Hash, hashStop *chainhash.Ha
 		// No blocks with the stop hash were found so there is nothing
 		// to do.  Just return.  This behavior mirrors the reference
 		// implementation.
-		if endIdx == math.MaxInt32 {
+		if endIdx == math.MaxUint32 {
 			return nil, nil
 		}
 
@@ -735,6 +928,17 @@ func fetchHeaders(chain *blockchain.BlockChain, blockHashes []chainhash.Hash) ([
 	return headers, nil
 }
 
+// locateHeaders returns the headers of the blocks located by locateBlocks.  It
+// is shared by the getheaders wire message and RPC so both return the same
+// headers for the same request.
+func locateHeaders(chain *blockchain.BlockChain, locators []*chainhash.Hash, hashStop *chainhash.Hash) ([]wire.BlockHeader, error) {
+	blockHashes, err := locateBlocks(chain, locators, hashStop)
+	if err != nil {
+		return nil, err
+	}
+	return fetchHeaders(chain, blockHashes)
+}
+
 // OnGetHeaders is invoked when a peer receives a getheaders bitcoin
 // message.
 func (sp *serverPeer) OnGetHeaders(_ *peer.Peer, msg *wire.MsgGetHeaders) {
@@ -743,15 +947,10 @@ func (sp *serverPeer) OnGetHeaders(_ *peer.Peer, msg *wire.MsgGetHeaders) {
 		return
 	}
 
-	blockHashes, err := sp.server.locateBlocks(msg.BlockLocatorHashes,
-		&msg.HashStop)
-	if err != nil {
-		peerLog.Errorf("OnGetHeaders: failed to fetch hashes: %v", err)
-		return
-	}
-	headers, err := fetchHeaders(sp.server.blockManager.chain, blockHashes)
+	headers, err := locateHeaders(sp.server.blockManager.chain,
+		msg.BlockLocatorHashes, &msg.HashStop)
 	if err != nil {
-		peerLog.Errorf("OnGetHeaders: failed to fetch block headers: "+
+		peerLog.Errorf("OnGetHeaders: failed to locate block headers: "+
 			"%v", err)
 		return
 	}
@@ -887,8 +1086,9 @@ func (sp *serverPeer) OnGetAddr(_ *peer.Peer, msg *wire.MsgGetAddr) {
 	// Don't return any addresses when running on the simulation test
 	// network.  This helps prevent the network from becoming another
 	// public test network since it will not be able to learn about other
-	// peers that have not specifically been provided.
-	if cfg.SimNet {
+	// peers that have not specifically been provided.  Addresses are not
+	// advertised in outbound-only mode either.
+	if cfg.SimNet || cfg.OutboundOnly {
 		return
 	}
 
@@ -909,11 +1109,10 @@ func (sp *serverPeer) OnGetAddr(_ *peer.Peer, msg *wire.MsgGetAddr) {
 	}
 	sp.sentAddrs = true
 
-	// Get the current known addresses from the address manager.
+	// Get the current known addresses from the address manager and relay
+	// a random subset of those which may be relayed.
 	addrCache := sp.server.addrManager.AddressCache()
-
-	// Push the addresses.
-	sp.pushAddrMsg(addrCache)
+	sp.relayAddrs(addrCache)
 }
 
 // OnAddr is invoked when a peer receives an addr bitcoin message and is
@@ -922,8 +1121,10 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 	// Ignore addresses when running on the simulation test network.  This
 	// helps prevent the network from becoming another public test network
 	// since it will not be able to learn about other peers that have not
-	// specifically been provided.
-	if cfg.SimNet {
+	// specifically been provided.  The addresses are of no use in
+	// outbound-only mode either since only the connect peers are connected
+	// to.
+	if cfg.SimNet || cfg.OutboundOnly {
 		return
 	}
 
@@ -940,6 +1141,7 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		return
 	}
 
+	addrs := make([]*wire.NetAddress, 0, len(msg.AddrList))
 	for _, na := range msg.AddrList {
 		// Don't add more address if we're disconnecting.
 		if !sp.Connected() {
@@ -956,6 +1158,13 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 
 		// Add address to known addresses for this peer.
 		sp.addKnownAddresses([]*wire.NetAddress{na})
+
+		// Skip addresses which don't advertise the required services
+		// since they would be rejected when connected to.
+		if na.Services&cfg.requiredServices != cfg.requiredServices {
+			continue
+		}
+		addrs = append(addrs, na)
 	}
 
 	// Add addresses to server address manager.  The address manager handles
@@ -963,19 +1172,63 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 	// addresses, and last seen updates.
 	// XXX bitcoind gives a 2 hour time penalty here, do we want to do the
 	// same?
-	sp.server.addrManager.AddAddresses(msg.AddrList, sp.NA())
+	sp.server.addrManager.AddAddresses(addrs, sp.NA())
+}
+
+// OnReject is invoked when a peer receives a reject bitcoin message and it is
+// used to track the rejects received from peers.
+func (sp *serverPeer) OnReject(_ *peer.Peer, msg *wire.MsgReject) {
+	peerLog.Debugf("Received reject from %s: %v", sp, msg)
+	sp.server.rejectStats.Record(sp.Addr(), msg)
+
+	// Blocks requested from the peer which it rejects, such as blocks
+	// outside of the history it serves, are requested elsewhere.
+	if msg.Cmd == wire.CmdBlock {
+		sp.server.blockManager.QueueBlockReject(&msg.Hash, sp)
+	}
+
+	// Transactions the peer rejected for paying too little fee are
+	// delivered to it again along with the first transaction spending
+	// them, which may pay enough fee for both.
+	if msg.Cmd == wire.CmdTx && msg.Code == wire.RejectInsufficientFee {
+		sp.addUnknownTx(&msg.Hash)
+	}
+}
+
+// OnNotFound is invoked when a peer receives a notfound bitcoin message and it
+// is used to track the transactions the peer doesn't have, so they are
+// delivered to it along with the first transaction spending them.
+func (sp *serverPeer) OnNotFound(_ *peer.Peer, msg *wire.MsgNotFound) {
+	for _, iv := range msg.InvList {
+		if iv.Type == wire.InvTypeTx {
+			sp.addUnknownTx(&iv.Hash)
+		}
+	}
 }
 
 // OnRead is invoked when a peer receives a message and it is used to update
-// the bytes received by the server.
+// the bytes received by the server and to penalize peers which send messages
+// whose payload exceeds the maximum allowed for their command.
 func (sp *serverPeer) OnRead(_ *peer.Peer, bytesRead int, msg wire.Message, err error) {
 	sp.server.AddBytesReceived(uint64(bytesRead))
+
+	// The peer disconnects after a read error, so only the ban score is
+	// increased here.
+	if msgErr, ok := err.(*wire.MessageError); ok && msgErr.PayloadSize != 0 {
+		sp.addBanScore(100, 0, fmt.Sprintf("oversized %s message of %d "+
+			"bytes", msgErr.Command, msgErr.PayloadSize))
+	}
 }
 
 // OnWrite is invoked when a peer sends a message and it is used to update
 // the bytes sent by the server.
 func (sp *serverPeer) OnWrite(_ *peer.Peer, bytesWritten int, msg wire.Message, err error) {
 	sp.server.AddBytesSent(uint64(bytesWritten))
+
+	// Record the relay latency of the transactions announced to the peer.
+	if invMsg, ok := msg.(*wire.MsgInv); ok && err == nil {
+		sp.server.relayLatency.InvSent(invMsg, time.Now())
+	}
 }
 
 // randomUint16Number returns a random uint16 in a specified input range.  Note
@@ -1027,10 +1280,17 @@ func (s *server) AnnounceNewTransactions(newTxs []*mempool.TxDesc) {
 	// transactions into the memory pool due to the original being
 	// accepted.
 	for _, txD := range newTxs {
+		// Track the relay latency of the transaction from the time it
+		// was accepted.
+		s.relayLatency.Accepted(txD.Tx.Hash(), txD.Added)
+
 		// Generate the inventory vector and relay it.
 		iv := wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash())
 		s.RelayInventory(iv, txD)
 
+		// Flag spends of outputs on the watchlist.
+		s.checkWatchedMempoolTx(txD.Tx)
+
 		if s.rpcServer != nil {
 			// Notify websocket clients about mempool transactions.
 			s.rpcServer.ntfnMgr.NotifyMempoolTx(txD.Tx, true)
@@ -1043,6 +1303,33 @@ func (s *server) AnnounceNewTransactions(newTxs []*mempool.TxDesc) {
 	}
 }
 
+// notifyExpiredTxns notifies websocket clients of the passed transactions which
+// were evicted from the mempool because they, or a transaction they depend on,
+// expired, so wallets can rebroadcast or replace them.  It is called by the
+// mempool with its lock held.
+func (s *server) notifyExpiredTxns(txns []*provautil.Tx) {
+	for _, tx := range txns {
+		srvrLog.Debugf("Transaction %v expired from the mempool",
+			tx.Hash())
+		if s.rpcServer != nil {
+			s.rpcServer.ntfnMgr.NotifyTxExpired(tx)
+		}
+	}
+}
+
+// notifyRemovedTxns notifies websocket clients of the passed transactions which
+// were removed from the mempool without being mined for the passed reason, so
+// wallets can replace them.
+func (s *server) notifyRemovedTxns(txns []*provautil.Tx, reason mempool.RemovalReason) {
+	for _, tx := range txns {
+		srvrLog.Debugf("Transaction %v removed from the mempool (%v)",
+			tx.Hash(), reason)
+		if s.rpcServer != nil {
+			s.rpcServer.ntfnMgr.NotifyTxRemoved(tx, reason)
+		}
+	}
+}
+
 // pushTxMsg sends a tx message for the provided transaction hash to the
 // connected peer.  An error is returned if the transaction hash is not known.
 func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{}, waitChan <-chan struct{}) error {
@@ -1083,6 +1370,7 @@ func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan cha
 	if err != nil {
 		peerLog.Tracef("Unable to fetch requested block hash %v: %v",
 			hash, err)
+		s.blockScrubber.ReportCorrupt(hash, err)
 
 		if doneChan != nil {
 			doneChan <- struct{}{}
@@ -1092,7 +1380,8 @@ func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan cha
 
 	// Deserialize the block.
 	var msgBlock wire.MsgBlock
-	err = msgBlock.Deserialize(bytes.NewReader(blockBytes))
+	err = msgBlock.BtcDecode(bytes.NewReader(blockBytes),
+		s.chainParams.TxEncoding())
 	if err != nil {
 		peerLog.Tracef("Unable to deserialize requested block hash "+
 			"%v: %v", hash, err)
@@ -1241,16 +1530,10 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		sp.Disconnect()
 		return false
 	}
-	if banEnd, ok := state.banned[host]; ok {
-		if time.Now().Before(banEnd) {
-			srvrLog.Debugf("Peer %s is banned for another %v - disconnecting",
-				host, banEnd.Sub(time.Now()))
-			sp.Disconnect()
-			return false
-		}
-
-		srvrLog.Infof("Peer %s is no longer banned", host)
-		delete(state.banned, host)
+	if s.banList.Banned(net.ParseIP(host)) {
+		srvrLog.Debugf("Peer %s is banned - disconnecting", host)
+		sp.Disconnect()
+		return false
 	}
 
 	// TODO: Check for max peers from a single IP.
@@ -1284,6 +1567,16 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 // handleDonePeerMsg deals with peers that have signalled they are done.  It is
 // invoked from the peerHandler goroutine.
 func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
+	// Add the statistics of the connection to the persisted statistics of
+	// the peer when the handshake completed.
+	if s.peerStats != nil && sp.VerAckReceived() && sp.VersionKnown() {
+		err := s.peerStats.Record(sp.Addr(), newPeerSession(sp))
+		if err != nil {
+			srvrLog.Errorf("Unable to record statistics for peer %s: %v",
+				sp, err)
+		}
+	}
+
 	var list map[int32]*serverPeer
 	if sp.persistent {
 		list = state.persistentPeers
@@ -1326,10 +1619,20 @@ func (s *server) handleBanPeerMsg(state *peerState, sp *serverPeer) {
 		srvrLog.Debugf("can't split ban peer %s %v", sp.Addr(), err)
 		return
 	}
+	subnet, err := parseBanSubnet(host)
+	if err != nil {
+		srvrLog.Debugf("can't ban peer %s: %v", sp.Addr(), err)
+		return
+	}
+	err = s.banList.Ban(subnet, "exceeded the ban threshold",
+		time.Now().Add(cfg.BanDuration))
+	if err != nil {
+		srvrLog.Errorf("Unable to ban peer %s: %v", host, err)
+		return
+	}
 	direction := directionString(sp.Inbound())
 	srvrLog.Infof("Banned peer %s (%s) for %v", host, direction,
 		cfg.BanDuration)
-	state.banned[host] = time.Now().Add(cfg.BanDuration)
 }
 
 // handleRelayInvMsg deals with relaying inventory to peers that are not already
@@ -1389,6 +1692,32 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 					return
 				}
 			}
+
+			// Deliver the transaction right after the transactions
+			// it spends which the peer doesn't have instead of
+			// announcing it, so the peer can accept them together
+			// when the transaction pays for them.
+			parents := sp.takeUnknownParents(txD.Tx)
+			if len(parents) > 0 {
+				for _, parent := range parents {
+					sp.AddKnownInventory(wire.NewInvVect(
+						wire.InvTypeTx, parent.Hash()))
+					sp.QueueMessage(parent.MsgTx(), nil)
+				}
+				sp.AddKnownInventory(msg.invVect)
+				sp.QueueMessage(txD.Tx.MsgTx(), nil)
+				return
+			}
+		}
+
+		// Announce blocks and admin transactions right away rather
+		// than with the next batch since the transactions after them
+		// are validated against them.  In outbound-only mode, the
+		// connect peers are also the only route the blocks signed by
+		// the server have to the network.
+		if relayImmediately(msg) {
+			sp.QueueInventoryImmediate(msg.invVect)
+			return
 		}
 
 		// Queue the inventory to be relayed with the next batch.
@@ -1398,6 +1727,20 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 	})
 }
 
+// relayImmediately returns whether the inventory of the passed relay message
+// should be announced to peers right away rather than trickled to them with the
+// next batch, which is the case for blocks and admin transactions.
+func relayImmediately(msg relayMsg) bool {
+	switch msg.invVect.Type {
+	case wire.InvTypeBlock:
+		return true
+	case wire.InvTypeTx:
+		txD, ok := msg.data.(*mempool.TxDesc)
+		return ok && mining.IsAdminTx(txD.Tx.MsgTx())
+	}
+	return false
+}
+
 // handleBroadcastMsg deals with broadcasting messages to peers.  It is invoked
 // from the peerHandler goroutine.
 func (s *server) handleBroadcastMsg(state *peerState, bmsg *broadcastMsg) {
@@ -1594,6 +1937,7 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnTx:          sp.OnTx,
 			OnBlock:       sp.OnBlock,
 			OnInv:         sp.OnInv,
+			OnHeaders:     sp.OnHeaders,
 			OnGetData:     sp.OnGetData,
 			OnGetBlocks:   sp.OnGetBlocks,
 			OnGetHeaders:  sp.OnGetHeaders,
@@ -1603,6 +1947,8 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnFilterLoad:  sp.OnFilterLoad,
 			OnGetAddr:     sp.OnGetAddr,
 			OnAddr:        sp.OnAddr,
+			OnReject:      sp.OnReject,
+			OnNotFound:    sp.OnNotFound,
 			OnRead:        sp.OnRead,
 			OnWrite:       sp.OnWrite,
 
@@ -1612,15 +1958,24 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			// other implementations' alert messages, we will not relay theirs.
 			OnAlert: nil,
 		},
-		NewestBlock:      sp.newestBlock,
-		HostToNetAddress: sp.server.addrManager.HostToNetAddress,
-		Proxy:            cfg.Proxy,
-		UserAgentName:    userAgentName,
-		UserAgentVersion: userAgentVersion,
-		ChainParams:      sp.server.chainParams,
-		Services:         sp.server.services,
-		DisableRelayTx:   cfg.BlocksOnly,
-		ProtocolVersion:  wire.FeeFilterVersion,
+		NewestBlock:         sp.newestBlock,
+		HostToNetAddress:    sp.server.addrManager.HostToNetAddress,
+		Proxy:               cfg.Proxy,
+		UserAgentName:       userAgentName,
+		UserAgentVersion:    userAgentVersion,
+		ChainParams:         sp.server.chainParams,
+		Services:            sp.server.services,
+		DisableRelayTx:      cfg.BlocksOnly,
+		ProtocolVersion:     wire.FeeFilterVersion,
+		MinProtocolVersion:  cfg.MinProtocolVersion,
+		RequiredServices:    cfg.requiredServices,
+		RejectUserAgents:    cfg.rejectUserAgents,
+		MaxPayloadOverrides: cfg.maxPayloadOverrides,
+		StrictBlockDecoding: cfg.StrictBlockDecoding,
+		TrickleInterval:     cfg.TrickleInterval,
+		MaxInvTrickleSize:   cfg.MaxInvBatch,
+		OutputQueueSize:     cfg.PeerQueueSize,
+		EventLog:            sp.server.eventLog,
 	}
 }
 
@@ -1629,6 +1984,14 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 // instance, associates it with the connection, and starts a goroutine to wait
 // for disconnection.
 func (s *server) inboundPeerConnected(conn net.Conn) {
+	// Refuse banned addresses before negotiating the protocol with them.
+	if s.bannedAddr(conn.RemoteAddr()) {
+		srvrLog.Debugf("Refused connection from banned address %s",
+			conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+
 	sp := newServerPeer(s, false)
 	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp))
 	sp.AssociateConnection(conn)
@@ -1654,12 +2017,39 @@ func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	s.addrManager.Attempt(sp.NA())
 }
 
+// bannedAddr returns whether the IP address of the passed network address is
+// banned.  Addresses without an IP address, such as onion addresses, are never
+// banned.
+func (s *server) bannedAddr(addr net.Addr) bool {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return s.banList.Banned(tcpAddr.IP)
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	return s.banList.Banned(net.ParseIP(host))
+}
+
+// dial connects to the passed address unless it is banned.
+func (s *server) dial(addr net.Addr) (net.Conn, error) {
+	if s.bannedAddr(addr) {
+		return nil, fmt.Errorf("address %s is banned", addr)
+	}
+	return btcdDial(addr)
+}
+
 // peerDoneHandler handles peer disconnects by notifiying the server that it's
 // done along with other performing other desirable cleanup.
 func (s *server) peerDoneHandler(sp *serverPeer) {
 	sp.WaitForDisconnect()
 	s.donePeers <- sp
 
+	// Stop capturing the messages of the peer when it was traced.
+	if capture := sp.SetCapture(nil); capture != nil {
+		closePeerTrace(sp, capture)
+	}
+
 	// Only tell block manager we are gone if we ever told it we existed.
 	if sp.VersionKnown() {
 		s.blockManager.DonePeer(sp)
@@ -1683,9 +2073,22 @@ func (s *server) peerHandler() {
 	// by peers.  This is done here since their lifecycle is closely tied
 	// to this handler and rather than adding more channels to sychronize
 	// things, it's easier and slightly faster to simply start and stop them
-	// in this handler.
-	s.addrManager.Start()
+	// in this handler.  The address manager is not started in read-only
+	// mode since peers are never connected to, which also leaves the peers
+	// file in the data directory untouched.
+	if !s.readOnly {
+		s.addrManager.Start()
+	}
+	if s.indexManager != nil {
+		s.indexManager.Start()
+	}
 	s.blockManager.Start()
+	if s.replication != nil {
+		s.replication.Start()
+	}
+	s.blockScrubber.Start()
+	s.webhookNotifier.Start()
+	s.blockBroadcaster.Start()
 
 	srvrLog.Tracef("Starting peer handler")
 
@@ -1693,7 +2096,6 @@ func (s *server) peerHandler() {
 		inboundPeers:    make(map[int32]*serverPeer),
 		persistentPeers: make(map[int32]*serverPeer),
 		outboundPeers:   make(map[int32]*serverPeer),
-		banned:          make(map[string]time.Time),
 		outboundGroups:  make(map[string]int),
 	}
 
@@ -1753,8 +2155,18 @@ out:
 	}
 
 	s.connManager.Stop()
+	s.blockBroadcaster.Stop()
+	s.webhookNotifier.Stop()
+	s.blockScrubber.Stop()
+	if s.replication != nil {
+		s.replication.Stop()
+	}
 	s.blockManager.Stop()
+	if s.indexManager != nil {
+		s.indexManager.Stop()
+	}
 	s.addrManager.Stop()
+	closePeerEventLog(s.eventLog)
 
 	// Drain channels before exiting so nothing is left waiting around
 	// to send.
@@ -1775,6 +2187,30 @@ cleanup:
 	srvrLog.Tracef("Peer handler done")
 }
 
+// deprioritizeAddr marks the passed address so it is tried last when choosing
+// outbound peers.
+//
+// This function is safe for concurrent access.
+func (s *server) deprioritizeAddr(addr string) {
+	s.deprioritizedMtx.Lock()
+	if s.deprioritizedAddrs == nil {
+		s.deprioritizedAddrs = make(map[string]struct{})
+	}
+	s.deprioritizedAddrs[addr] = struct{}{}
+	s.deprioritizedMtx.Unlock()
+}
+
+// isDeprioritized returns whether or not the passed address was marked to be
+// tried last when choosing outbound peers.
+//
+// This function is safe for concurrent access.
+func (s *server) isDeprioritized(addr string) bool {
+	s.deprioritizedMtx.Lock()
+	_, ok := s.deprioritizedAddrs[addr]
+	s.deprioritizedMtx.Unlock()
+	return ok
+}
+
 // AddPeer adds a new peer that has already been connected to the server.
 func (s *server) AddPeer(sp *serverPeer) {
 	s.newPeers <- sp
@@ -1785,6 +2221,22 @@ func (s *server) BanPeer(sp *serverPeer) {
 	s.banPeers <- sp
 }
 
+// DisconnectBanned disconnects the connected peers whose address is banned,
+// such as after new bans were added, and returns how many were disconnected.
+func (s *server) DisconnectBanned() int {
+	var numDisconnected int
+	for _, sp := range s.Peers() {
+		host, _, err := net.SplitHostPort(sp.Addr())
+		if err != nil || !s.banList.Banned(net.ParseIP(host)) {
+			continue
+		}
+		srvrLog.Infof("Disconnecting banned peer %s", sp)
+		sp.Disconnect()
+		numDisconnected++
+	}
+	return numDisconnected
+}
+
 // RelayInventory relays the passed inventory vector to all connected peers
 // that are not already known to have it.
 func (s *server) RelayInventory(invVect *wire.InvVect, data interface{}) {
@@ -1834,6 +2286,29 @@ func (s *server) Peers() []*serverPeer {
 	return <-replyChan
 }
 
+// collectStats returns a sample of the statistics recorded by the stats
+// history.  Only accessors which take snapshots are used, so the mempool,
+// database cache and peer state are not locked while the sample is computed.
+func (s *server) collectStats() *statsSample {
+	var sample statsSample
+	sample.MempoolTxs, sample.MempoolBytes, sample.FeeRates =
+		mempoolStats(s.txMemPool.TxDescs())
+	sample.Orphans = s.txMemPool.OrphanCount()
+	if reporter, ok := s.db.(database.CacheReporter); ok {
+		stats := reporter.CacheStats()
+		sample.UtxoCacheSize = stats.Size
+		sample.UtxoCacheMaxSize = stats.MaxSize
+	}
+	for _, sp := range s.Peers() {
+		if sp.Inbound() {
+			sample.InboundPeers++
+		} else {
+			sample.OutboundPeers++
+		}
+	}
+	return &sample
+}
+
 // DisconnectNodeByAddr disconnects a peer by target address. Both outbound and
 // inbound nodes will be searched for the target node. An error message will
 // be returned if the peer was not found.
@@ -1862,6 +2337,77 @@ func (s *server) DisconnectNodeByID(id int32) error {
 	return <-replyChan
 }
 
+// closePeerTrace closes the passed message capture of the passed peer and logs
+// the number of messages which could not be captured.
+func closePeerTrace(sp *serverPeer, capture *peer.MessageCapture) {
+	if err := capture.Close(); err != nil {
+		srvrLog.Errorf("Unable to write message capture of peer %s: %v",
+			sp, err)
+	}
+	if dropped := capture.Dropped(); dropped > 0 {
+		srvrLog.Warnf("Dropped %d %s while tracing peer %s", dropped,
+			pickNoun(dropped, "message", "messages"), sp)
+	}
+	srvrLog.Infof("Stopped tracing peer %s to %s-*.cap", sp,
+		capture.Prefix())
+}
+
+// SetPeerTrace starts or stops capturing the raw messages exchanged with the
+// peer with the passed id to the capture files in the peer trace directory.
+// It returns the capture which was started or stopped, or nil when the peer was
+// already in the requested state.  An error is returned when the peer is not
+// connected.
+func (s *server) SetPeerTrace(id int32, enable bool) (*peer.MessageCapture, error) {
+	var sp *serverPeer
+	for _, p := range s.Peers() {
+		if p.ID() == id {
+			sp = p
+			break
+		}
+	}
+	if sp == nil {
+		return nil, errors.New("peer not found")
+	}
+
+	if !enable {
+		capture := sp.SetCapture(nil)
+		if capture != nil {
+			closePeerTrace(sp, capture)
+		}
+		return capture, nil
+	}
+	if sp.Capture() != nil {
+		return nil, nil
+	}
+
+	prefix := fmt.Sprintf("peer%d-%s", id,
+		time.Now().UTC().Format("20060102T150405"))
+	capture, err := peer.NewMessageCapture(&peer.CaptureConfig{
+		Dir:         cfg.PeerTraceDir,
+		Prefix:      prefix,
+		MaxFileSize: cfg.PeerTraceMaxSize * 1024 * 1024,
+		MaxFiles:    cfg.PeerTraceMaxFiles,
+		Net:         s.chainParams.Net,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if prev := sp.SetCapture(capture); prev != nil {
+		closePeerTrace(sp, prev)
+	}
+
+	// Stop right away when the peer disconnected in the meantime since
+	// the capture would otherwise never be closed.
+	if !sp.Connected() {
+		if capture := sp.SetCapture(nil); capture != nil {
+			closePeerTrace(sp, capture)
+		}
+		return nil, errors.New("peer not found")
+	}
+	srvrLog.Infof("Tracing peer %s to %s-*.cap", sp, capture.Prefix())
+	return capture, nil
+}
+
 // RemoveNodeByAddr removes a peer from the list of persistent peers if
 // present. An error will be returned if the peer was not found.
 func (s *server) RemoveNodeByAddr(addr string) error {
@@ -1892,6 +2438,12 @@ func (s *server) RemoveNodeByID(id int32) error {
 // peer will be persistent and reconnect if the connection is lost.
 // It is an error to call this with an already existing peer.
 func (s *server) ConnectNode(addr string, permanent bool) error {
+	// Only the connect peers are ever connected to in outbound-only mode.
+	if cfg.OutboundOnly {
+		return errors.New("connecting to peers is disabled in " +
+			"outbound-only mode")
+	}
+
 	replyChan := make(chan error)
 
 	s.query <- connectNodeMsg{addr: addr, permanent: permanent, reply: replyChan}
@@ -2015,12 +2567,20 @@ func (s *server) Start() {
 		go s.rebroadcastHandler()
 
 		s.rpcServer.Start()
+		if s.grpcServer != nil {
+			s.grpcServer.Start()
+		}
+		if s.debugServer != nil {
+			s.debugServer.Start()
+		}
 	}
 
 	// Start the CPU miner if generation is enabled.
 	if cfg.Generate {
 		s.cpuMiner.Start()
 	}
+
+	s.statsHistory.Start()
 }
 
 // Stop gracefully shuts down the server by stopping and disconnecting all
@@ -2037,8 +2597,18 @@ func (s *server) Stop() error {
 	// Stop the CPU miner if needed
 	s.cpuMiner.Stop()
 
+	// Stop recording statistics before the peer handler quits since the
+	// peers are queried from it.
+	s.statsHistory.Stop()
+
 	// Shutdown the RPC server if it's not disabled.
 	if !cfg.DisableRPC {
+		if s.debugServer != nil {
+			s.debugServer.Stop()
+		}
+		if s.grpcServer != nil {
+			s.grpcServer.Stop()
+		}
 		s.rpcServer.Stop()
 	}
 
@@ -2142,6 +2712,65 @@ func parseListeners(addrs []string) ([]string, []string, bool, error) {
 	return ipv4ListenAddrs, ipv6ListenAddrs, haveWildcard, nil
 }
 
+// setReachableNetworks marks the networks peers can't be connected to on as
+// unreachable in the passed address manager so it never picks addresses on
+// them.  Those are the networks excluded by --onlynet, the onion network unless
+// a proxy reaches it, and, unless a proxy dials every connection, the networks
+// none of the passed interface addresses are on.  It also sets the network
+// preferred by --prefernet.
+func setReachableNetworks(amgr *addrmgr.AddrManager, ifaceAddrs []net.Addr) {
+	reachable := map[addrmgr.Network]bool{
+		addrmgr.NetIPv4: true,
+		addrmgr.NetIPv6: true,
+		addrmgr.NetOnion: !cfg.NoOnion &&
+			(cfg.OnionProxy != "" || cfg.Proxy != ""),
+	}
+
+	// The interfaces can't be listed on some platforms, so they only limit
+	// the networks when they reach at least one of them.
+	if cfg.Proxy == "" {
+		ipv4, ipv6 := addrmgr.InterfaceNetworks(ifaceAddrs)
+		if ipv4 || ipv6 {
+			reachable[addrmgr.NetIPv4] = ipv4
+			reachable[addrmgr.NetIPv6] = ipv6
+		}
+	}
+	for n, ok := range reachable {
+		ok = ok && cfg.allowsNet(n)
+		if !ok {
+			srvrLog.Debugf("Not connecting to peers on the %v "+
+				"network", n)
+		}
+		amgr.SetReachable(n, ok)
+	}
+	if cfg.PreferNet != "" {
+		amgr.SetPreferredNetwork(cfg.preferNet)
+	}
+}
+
+// addListenAddress adds the address the passed listener accepts connections on
+// to the local addresses advertised to peers.  A listener on the unspecified
+// address of its network accepts connections on every interface address on
+// that network, so those are added with the port of the listener instead.
+func addListenAddress(amgr *addrmgr.AddrManager, listener net.Listener,
+	ifaceAddrs []net.Addr, services wire.ServiceFlag) {
+
+	tcpAddr, ok := listener.Addr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	na := wire.NewNetAddressIPPort(tcpAddr.IP, uint16(tcpAddr.Port),
+		services)
+	if tcpAddr.IP.IsUnspecified() {
+		amgr.AddInterfaceAddresses(ifaceAddrs, addrmgr.AddrNetwork(na),
+			na.Port, services)
+		return
+	}
+	if err := amgr.AddLocalAddress(na, addrmgr.BoundPrio); err != nil {
+		amgrLog.Debugf("Skipping bound address: %v", err)
+	}
+}
+
 func (s *server) upnpUpdateThread() {
 	// Go off immediately to prevent code duplication, thereafter we renew
 	// lease every 15 minutes.
@@ -2204,14 +2833,27 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	if cfg.NoPeerBloomFilters {
 		services &^= wire.SFNodeBloom
 	}
+	if cfg.RetainBlocks != 0 {
+		services &^= wire.SFNodeNetwork
+		services |= wire.SFNodeNetworkLimited
+	}
 
 	amgr := addrmgr.New(cfg.DataDir, btcdLookup)
 
+	// The interface addresses tell both which networks peers can be reached
+	// on and which local addresses are advertised to them.
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		srvrLog.Warnf("Can't list interface addresses: %v", err)
+	}
+	setReachableNetworks(amgr, ifaceAddrs)
+
+	// Nothing is ever listened on in outbound-only mode, regardless of any
+	// listen addresses.
 	var listeners []net.Listener
 	var nat NAT
-	if !cfg.DisableListen {
-		ipv4Addrs, ipv6Addrs, wildcard, err :=
-			parseListeners(listenAddrs)
+	if !cfg.DisableListen && !cfg.OutboundOnly {
+		ipv4Addrs, ipv6Addrs, _, err := parseListeners(listenAddrs)
 		if err != nil {
 			return nil, err
 		}
@@ -2262,33 +2904,6 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 			// nil nat here is fine, just means no upnp on network.
 		}
 
-		// TODO: nonstandard port...
-		if wildcard {
-			port, err :=
-				strconv.ParseUint(activeNetParams.DefaultPort,
-					10, 16)
-			if err != nil {
-				// I can't think of a cleaner way to do this...
-				goto nowc
-			}
-			addrs, err := net.InterfaceAddrs()
-			for _, a := range addrs {
-				ip, _, err := net.ParseCIDR(a.String())
-				if err != nil {
-					continue
-				}
-				na := wire.NewNetAddressIPPort(ip,
-					uint16(port), services)
-				if discover {
-					err = amgr.AddLocalAddress(na, addrmgr.InterfacePrio)
-					if err != nil {
-						amgrLog.Debugf("Skipping local address: %v", err)
-					}
-				}
-			}
-		}
-	nowc:
-
 		for _, addr := range ipv4Addrs {
 			listener, err := net.Listen("tcp4", addr)
 			if err != nil {
@@ -2297,14 +2912,9 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 				continue
 			}
 			listeners = append(listeners, listener)
-
 			if discover {
-				if na, err := amgr.DeserializeNetAddress(addr); err == nil {
-					err = amgr.AddLocalAddress(na, addrmgr.BoundPrio)
-					if err != nil {
-						amgrLog.Warnf("Skipping bound address: %v", err)
-					}
-				}
+				addListenAddress(amgr, listener, ifaceAddrs,
+					services)
 			}
 		}
 
@@ -2317,12 +2927,8 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 			}
 			listeners = append(listeners, listener)
 			if discover {
-				if na, err := amgr.DeserializeNetAddress(addr); err == nil {
-					err = amgr.AddLocalAddress(na, addrmgr.BoundPrio)
-					if err != nil {
-						amgrLog.Debugf("Skipping bound address: %v", err)
-					}
-				}
+				addListenAddress(amgr, listener, ifaceAddrs,
+					services)
 			}
 		}
 
@@ -2349,21 +2955,34 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		services:             services,
 		sigCache:             txscript.NewSigCache(cfg.SigCacheMaxSize),
 		hashCache:            txscript.NewHashCache(cfg.SigCacheMaxSize),
+		readOnly:             cfg.ReadOnly,
+		rejectStats:          newRejectStats(cfg.RejectWarnPeers),
+		relayLatency:         newRelayLatencyStats(),
+		addrRelay: newAddrRelay(cfg.privateNets,
+			defaultAddrRelayMaxDelay),
 	}
 
-	// Create the transaction and address indexes if needed.
+	// Count the messages exchanged with peers, writing them to the peer
+	// event log as well when it is enabled.
+	eventLog, err := newPeerEventLog()
+	if err != nil {
+		return nil, err
+	}
+	s.eventLog = eventLog
+
+	// Create the transaction, address, and issuance indexes if needed.
 	//
 	// CAUTION: the txindex needs to be first in the indexes array because
-	// the addrindex uses data from the txindex during catchup.  If the
-	// addrindex is run first, it may not have the transactions from the
-	// current block indexed.
+	// the addrindex and issuanceindex use data from the txindex during
+	// catchup.  If they are run first, they may not have the transactions
+	// from the current block indexed.
 	var indexes []indexers.Indexer
-	if cfg.TxIndex || cfg.AddrIndex {
-		// Enable transaction index if address index is enabled since it
-		// requires it.
+	if cfg.TxIndex || cfg.AddrIndex || cfg.IssuanceIndex {
+		// Enable transaction index if the address or issuance index is
+		// enabled since they require it.
 		if !cfg.TxIndex {
 			indxLog.Infof("Transaction index enabled because it " +
-				"is required by the address index")
+				"is required by the address or issuance index")
 			cfg.TxIndex = true
 		} else {
 			indxLog.Info("Transaction index is enabled")
@@ -2377,11 +2996,19 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		s.addrIndex = indexers.NewAddrIndex(db, chainParams)
 		indexes = append(indexes, s.addrIndex)
 	}
+	if cfg.IssuanceIndex {
+		indxLog.Info("Issuance index is enabled")
+		s.issuanceIndex = indexers.NewIssuanceIndex(db)
+		indexes = append(indexes, s.issuanceIndex)
+	}
 
 	// Create an index manager if any of the optional indexes are enabled.
+	// The indexes are not updated in read-only mode, so they are only used
+	// for queries against their existing contents.
 	var indexManager blockchain.IndexManager
-	if len(indexes) > 0 {
-		indexManager = indexers.NewManager(db, indexes)
+	if len(indexes) > 0 && !cfg.ReadOnly {
+		s.indexManager = indexers.NewManager(db, indexes)
+		indexManager = s.indexManager
 	}
 	bm, err := newBlockManager(&s, indexManager)
 	if err != nil {
@@ -2389,16 +3016,72 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	}
 	s.blockManager = bm
 
+	// A hot standby follows the primary instead of syncing from peers.
+	if cfg.ReplicateFrom != "" {
+		conn, err := dialReplication(cfg.ReplicateFrom,
+			cfg.ReplicationCert)
+		if err != nil {
+			return nil, err
+		}
+		s.replication = newReplicationClient(conn, cfg.ReplicationToken,
+			cfg.ReplicationValidate, bm.chain, bm.ProcessReplicatedBlock,
+			bm.FallBackToSync)
+	}
+	// Corrupt blocks can't be repaired in read-only mode since the repaired
+	// blocks can't be stored.
+	requestRepair := bm.RequestBlockRepair
+	if cfg.ReadOnly {
+		requestRepair = nil
+	}
+	s.blockScrubber = newBlockScrubber(s.db, bm.chain, cfg.ScrubRate,
+		cfg.ScrubInterval, requestRepair)
+	s.webhookNotifier = newWebhookNotifier(cfg.Webhooks, cfg.WebhookSecret,
+		cfg.WebhookQueueSize, filepath.Join(cfg.DataDir,
+			webhookDeadLetterFilename))
+	s.blockBroadcaster = newBlockBroadcaster(cfg.BroadcastURLs,
+		cfg.BroadcastWorkers)
+	s.peerStats, err = newPeerStatsStore(s.db, defaultMaxPeerStats,
+		cfg.ReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	s.watchlist, err = newWatchlist(s.db, s.chainParams, cfg.ReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	s.wsTokens, err = newWSTokenStore(s.db, cfg.ReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	s.banList, err = newBanList(s.db, cfg.ReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	s.addrManager.SetBanFilter(s.banList.Banned)
+	s.statsHistory, err = newStatsHistory(s.db, cfg.StatsInterval,
+		cfg.StatsRetention, cfg.ReadOnly, s.collectStats)
+	if err != nil {
+		return nil, err
+	}
+
+	// Transactions of the expiry version are only standard on networks
+	// which enable transaction expiry.
+	maxTxVersion := int32(2)
+	if chainParams.TxExpiry {
+		maxTxVersion = wire.TxVersionExpiry
+	}
 	txC := mempool.Config{
 		Policy: mempool.Policy{
-			DisableRelayPriority: !cfg.RelayPriority,
-			AcceptNonStd:         cfg.RelayNonStd,
-			FreeTxRelayLimit:     cfg.FreeTxRelayLimit,
-			MaxOrphanTxs:         cfg.MaxOrphanTxs,
-			MaxOrphanTxSize:      defaultMaxOrphanTxSize,
-			MaxSigOpsPerTx:       blockchain.MaxSigOpsPerBlock / 5,
-			MinRelayTxFee:        cfg.minRelayTxFee,
-			MaxTxVersion:         2,
+			DisableRelayPriority:  !cfg.RelayPriority,
+			AcceptNonStd:          cfg.RelayNonStd,
+			FreeTxRelayLimit:      cfg.FreeTxRelayLimit,
+			MaxOrphanTxs:          cfg.MaxOrphanTxs,
+			MaxOrphanTxSize:       defaultMaxOrphanTxSize,
+			MaxSigOpsPerTx:        blockchain.MaxSigOpsPerBlock / 5,
+			MinRelayTxFee:         cfg.minRelayTxFee,
+			MaxTxVersion:          maxTxVersion,
+			TxExpiry:              cfg.MempoolExpiry,
+			RequireCanonicalOrder: cfg.RejectNonCanonical,
 		},
 		ChainParams:     chainParams,
 		FetchUtxoView:   s.blockManager.chain.FetchUtxoView,
@@ -2416,6 +3099,9 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		CalcSequenceLock: func(tx *provautil.Tx, view *blockchain.UtxoViewpoint) (*blockchain.SequenceLock, error) {
 			return bm.chain.CalcSequenceLock(tx, view, true)
 		},
+		TxExpired:        s.notifyExpiredTxns,
+		ErrorStats:       bm.errorStats,
+		SigVerifyWorkers: cfg.SigVerifyWorkers,
 	}
 	s.txMemPool = mempool.New(&txC)
 
@@ -2432,7 +3118,8 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	}
 
 	blockTemplateGenerator := mining.NewBlkTmplGenerator(&policy, s.chainParams,
-		s.txMemPool, s.blockManager.chain, s.timeSource, s.sigCache, s.hashCache)
+		s.txMemPool, s.blockManager.chain, s.timeSource, s.sigCache, s.hashCache,
+		nil)
 	s.cpuMiner = cpuminer.New(&cpuminer.Config{
 		ChainParams:              chainParams,
 		BlockTemplateGenerator:   blockTemplateGenerator,
@@ -2444,14 +3131,25 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		AdminKeySets:             bm.chain.AdminKeySets,
 	})
 
+	// Sign generated blocks with the remote block signer when one is
+	// configured rather than local validate keys.
+	if cfg.BlockSignerURL != "" {
+		signers := make([]mining.BlockSigner, 0, len(cfg.blockSignerPubKeys))
+		for _, pubKey := range cfg.blockSignerPubKeys {
+			signers = append(signers, mining.NewRemoteSigner(
+				cfg.BlockSignerURL, pubKey, cfg.BlockSignerTimeout))
+		}
+		s.cpuMiner.SetBlockSigners(signers)
+	}
+
 	// Only setup a function to return new addresses to connect to when
 	// not running in connect-only mode.  The simulation network is always
 	// in connect-only mode since it is only intended to connect to
 	// specified peers and actively avoid advertising and connecting to
 	// discovered peers in order to prevent it from becoming a public test
-	// network.
+	// network.  Peers are never connected to in read-only mode.
 	var newAddressFunc func() (net.Addr, error)
-	if !cfg.SimNet && len(cfg.ConnectPeers) == 0 {
+	if !cfg.SimNet && !cfg.ReadOnly && len(cfg.ConnectPeers) == 0 {
 		newAddressFunc = func() (net.Addr, error) {
 			for tries := 0; tries < 100; tries++ {
 				addr := s.addrManager.GetAddress()
@@ -2470,6 +3168,16 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 					continue
 				}
 
+				// Mildly prefer peers which have served us well by
+				// skipping those with a record of misbehaving or
+				// running deprioritized software until we failed 20
+				// times.
+				addrString := addrmgr.NetAddressKey(addr.NetAddress())
+				if tries < 20 && (s.peerStats.PoorService(addrString,
+					cfg.BanThreshold) || s.isDeprioritized(addrString)) {
+					continue
+				}
+
 				// only allow recent nodes (10mins) after we failed 30
 				// times
 				if tries < 30 && time.Since(addr.LastAttempt()) < 10*time.Minute {
@@ -2482,7 +3190,6 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 					continue
 				}
 
-				addrString := addrmgr.NetAddressKey(addr.NetAddress())
 				return addrStringToNetAddr(addrString)
 			}
 
@@ -2495,14 +3202,23 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	if cfg.MaxPeers < targetOutbound {
 		targetOutbound = cfg.MaxPeers
 	}
+	// Reconnect to the connect peers aggressively in outbound-only mode
+	// since they are the only peers the server has.
+	retryDuration := connectionRetryInterval
+	var maxRetryDuration time.Duration
+	if cfg.OutboundOnly {
+		retryDuration = outboundOnlyRetryInterval
+		maxRetryDuration = outboundOnlyMaxRetryInterval
+	}
 	cmgr, err := connmgr.New(&connmgr.Config{
-		Listeners:      listeners,
-		OnAccept:       s.inboundPeerConnected,
-		RetryDuration:  connectionRetryInterval,
-		TargetOutbound: uint32(targetOutbound),
-		Dial:           btcdDial,
-		OnConnection:   s.outboundPeerConnected,
-		GetNewAddress:  newAddressFunc,
+		Listeners:        listeners,
+		OnAccept:         s.inboundPeerConnected,
+		RetryDuration:    retryDuration,
+		MaxRetryDuration: maxRetryDuration,
+		TargetOutbound:   uint32(targetOutbound),
+		Dial:             s.dial,
+		OnConnection:     s.outboundPeerConnected,
+		GetNewAddress:    newAddressFunc,
 	})
 	if err != nil {
 		return nil, err
@@ -2538,6 +3254,22 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 			<-s.rpcServer.RequestedProcessShutdown()
 			shutdownRequestChannel <- struct{}{}
 		}()
+
+		if len(cfg.GRPCListeners) > 0 {
+			s.grpcServer, err = newGRPCServer(cfg.GRPCListeners,
+				s.rpcServer)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if len(cfg.DebugListeners) > 0 {
+			s.debugServer, err = newDebugServer(cfg.DebugListeners,
+				s.rpcServer)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return &s, nil
@@ -0,0 +1,622 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/addrmgr"
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/peer"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// newTestConfig returns a configuration for a server under test which stores
+// its data in the passed directory and neither listens for peers, looks them up
+// through DNS seeds, nor serves RPC clients.
+func newTestConfig(dataDir string) *config {
+	return &config{
+		DataDir:            dataDir,
+		DbType:             "ffldb",
+		MaxPeers:           defaultMaxPeers,
+		BanThreshold:       defaultBanThreshold,
+		ChainSplitFraction: defaultChainSplitFraction,
+		ChainSplitDepth:    defaultChainSplitDepth,
+		ChainSplitDuration: defaultChainSplitDuration,
+		SigCacheMaxSize:    defaultSigCacheMaxSize,
+		MaxOrphanTxs:       defaultMaxOrphanTransactions,
+		BlockMaxSize:       defaultBlockMaxSize,
+		WebhookQueueSize:   defaultWebhookQueueSize,
+		RPCMaxQuerySize:    defaultRPCMaxQuerySize,
+		RPCMaxSubmitSize:   defaultRPCMaxSubmitSize,
+		DisableListen:      true,
+		DisableRPC:         true,
+		DisableDNSSeed:     true,
+		BlockPrioritySize:  50000,
+		dial:               net.DialTimeout,
+	}
+}
+
+// TestOutboundOnly ensures a server in outbound-only mode does not listen even
+// when given a listen address, negotiates with its connect peer without
+// answering address requests, announces the blocks it signs to the peer and
+// serves them, reports the mode in getnetworkinfo, and reconnects to the peer
+// sooner than it would outside of outbound-only mode.
+func TestOutboundOnly(t *testing.T) {
+	defer func(c *config, p *params) {
+		cfg = c
+		activeNetParams = p
+	}(cfg, activeNetParams)
+	activeNetParams = &regressionNetParams
+	chainParams := activeNetParams.Params
+
+	// Pass the address of a closed listener as the listen address of the
+	// server so the test can tell whether the server binds it, and listen
+	// for the connections of the server as its connect peer.
+	unused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	listenAddr := unused.Addr().String()
+	unused.Close()
+	remote, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer remote.Close()
+
+	tmpDir, err := ioutil.TempDir("", "outboundonly")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cfg = newTestConfig(tmpDir)
+	cfg.DisableListen = false
+	cfg.OutboundOnly = true
+	cfg.ConnectPeers = []string{remote.Addr().String()}
+	cfg.Listeners = []string{listenAddr}
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		chainParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+	s, err := newServer(cfg.Listeners, db, chainParams)
+	if err != nil {
+		t.Fatalf("newServer: unexpected error: %v", err)
+	}
+	s.Start()
+	defer func() {
+		s.Stop()
+		s.WaitForShutdown()
+	}()
+
+	// The listen address is still free.
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("listen address was bound by the server: %v", err)
+	}
+	listener.Close()
+
+	// accept accepts the next connection of the server to the connect peer
+	// within the passed duration and returns it along with the messages
+	// the server sends over it.
+	pver := peer.MaxProtocolVersion
+	btcnet := chainParams.Net
+	accept := func(timeout time.Duration) (net.Conn, <-chan wire.Message) {
+		remote.(*net.TCPListener).SetDeadline(time.Now().Add(timeout))
+		conn, err := remote.Accept()
+		if err != nil {
+			t.Fatalf("server did not connect: %v", err)
+		}
+		msgs := make(chan wire.Message, 100)
+		go func() {
+			defer close(msgs)
+			for {
+				msg, _, err := wire.ReadMessage(conn, pver, btcnet)
+				if err != nil {
+					return
+				}
+				msgs <- msg
+			}
+		}()
+		return conn, msgs
+	}
+
+	// waitFor reads the messages sent by the server until one satisfies
+	// the passed function and returns it.
+	waitFor := func(msgs <-chan wire.Message, desc string, match func(wire.Message) bool) wire.Message {
+		timeout := time.After(time.Second * 10)
+		for {
+			select {
+			case msg, ok := <-msgs:
+				if !ok {
+					t.Fatalf("connection closed waiting for %s", desc)
+				}
+				if match(msg) {
+					return msg
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %s", desc)
+			}
+		}
+	}
+
+	// The server negotiates the protocol with the connect peer by sending
+	// its version message first since it is the outbound side.
+	conn, msgs := accept(time.Second * 10)
+	defer conn.Close()
+	waitFor(msgs, "version", func(msg wire.Message) bool {
+		_, ok := msg.(*wire.MsgVersion)
+		return ok
+	})
+	addr := wire.NewNetAddressIPPort(net.ParseIP("127.0.0.1"), 0, 0)
+	version := wire.NewMsgVersion(addr, addr, 1, 0)
+	if err := wire.WriteMessage(conn, version, pver, btcnet); err != nil {
+		t.Fatalf("unable to send version: %v", err)
+	}
+	if err := wire.WriteMessage(conn, wire.NewMsgVerAck(), pver, btcnet); err != nil {
+		t.Fatalf("unable to send verack: %v", err)
+	}
+	waitFor(msgs, "verack", func(msg wire.Message) bool {
+		_, ok := msg.(*wire.MsgVerAck)
+		return ok
+	})
+
+	// Address requests are not answered, so the pong for a ping sent after
+	// a getaddr request arrives without any addresses before it.
+	for _, msg := range []wire.Message{wire.NewMsgGetAddr(),
+		wire.NewMsgPing(42)} {
+
+		if err := wire.WriteMessage(conn, msg, pver, btcnet); err != nil {
+			t.Fatalf("unable to send %s: %v", msg.Command(), err)
+		}
+	}
+	waitFor(msgs, "pong", func(msg wire.Message) bool {
+		if _, ok := msg.(*wire.MsgAddr); ok {
+			t.Fatalf("server answered getaddr request")
+		}
+		pong, ok := msg.(*wire.MsgPong)
+		return ok && pong.Nonce == 42
+	})
+
+	// A block signed with a validate key and processed by the server is
+	// announced to the connect peer and served when requested.
+	source := newTestRPCHarness(t, nil)
+	defer source.teardown()
+	block := provautil.NewBlock(source.generateBlock(t))
+	if _, _, err := s.blockManager.ProcessBlock(block, blockchain.BFNone); err != nil {
+		t.Fatalf("ProcessBlock: unexpected error: %v", err)
+	}
+	waitFor(msgs, "block inventory", func(msg wire.Message) bool {
+		inv, ok := msg.(*wire.MsgInv)
+		if !ok {
+			return false
+		}
+		for _, iv := range inv.InvList {
+			if iv.Type == wire.InvTypeBlock && iv.Hash == *block.Hash() {
+				return true
+			}
+		}
+		return false
+	})
+	getData := wire.NewMsgGetData()
+	getData.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, block.Hash()))
+	if err := wire.WriteMessage(conn, getData, pver, btcnet); err != nil {
+		t.Fatalf("unable to send getdata: %v", err)
+	}
+	waitFor(msgs, "block", func(msg wire.Message) bool {
+		msgBlock, ok := msg.(*wire.MsgBlock)
+		return ok && msgBlock.BlockHash() == *block.Hash()
+	})
+
+	result, err := handleGetNetworkInfo(&rpcServer{server: s},
+		btcjson.NewGetNetworkInfoCmd(), nil)
+	if err != nil {
+		t.Fatalf("handleGetNetworkInfo: unexpected error: %v", err)
+	}
+	info := result.(*btcjson.GetNetworkInfoResult)
+	if !info.OutboundOnly || info.Listening || info.Connections != 1 {
+		t.Errorf("got outbound only %v, listening %v, and %d "+
+			"connections, want true, false, and 1", info.OutboundOnly,
+			info.Listening, info.Connections)
+	}
+
+	// The server reconnects to the connect peer once the connection is
+	// lost before it would outside of outbound-only mode.
+	conn.Close()
+	conn, _ = accept(connectionRetryInterval)
+	conn.Close()
+}
+
+// TestLimitedHistory ensures a server which only serves the most recent blocks
+// advertises limited block history instead of full history in its version
+// message, and that it answers requests for older blocks with a reject message
+// while serving the recent ones.
+func TestLimitedHistory(t *testing.T) {
+	defer func(c *config, p *params) {
+		cfg = c
+		activeNetParams = p
+	}(cfg, activeNetParams)
+	activeNetParams = &regressionNetParams
+	chainParams := activeNetParams.Params
+
+	// Pass the address of a closed listener as the listen address of the
+	// server so the test can connect to it.
+	unused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	listenAddr := unused.Addr().String()
+	unused.Close()
+
+	tmpDir, err := ioutil.TempDir("", "limitedhistory")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cfg = newTestConfig(tmpDir)
+	cfg.DisableListen = false
+	cfg.Listeners = []string{listenAddr}
+	cfg.RetainBlocks = 2
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		chainParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+	s, err := newServer(cfg.Listeners, db, chainParams)
+	if err != nil {
+		t.Fatalf("newServer: unexpected error: %v", err)
+	}
+	s.Start()
+	defer func() {
+		s.Stop()
+		s.WaitForShutdown()
+	}()
+
+	// Extend the chain of the server to five blocks, so only the last two
+	// of them are served.
+	const numBlocks = 5
+	source := newTestRPCHarness(t, nil)
+	defer source.teardown()
+	hashes := make([]*chainhash.Hash, 0, numBlocks)
+	for i := 0; i < numBlocks; i++ {
+		block := provautil.NewBlock(source.generateBlock(t))
+		_, _, err := source.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+		_, _, err = s.blockManager.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+		hashes = append(hashes, block.Hash())
+	}
+
+	// Negotiate the protocol with the server, which advertises limited
+	// block history.
+	conn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("unable to connect to the server: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second * 10))
+	pver := peer.MaxProtocolVersion
+	btcnet := chainParams.Net
+	addr := wire.NewNetAddressIPPort(net.ParseIP("127.0.0.1"), 0, 0)
+	version := wire.NewMsgVersion(addr, addr, 1, 0)
+	if err := wire.WriteMessage(conn, version, pver, btcnet); err != nil {
+		t.Fatalf("unable to send version: %v", err)
+	}
+	var services wire.ServiceFlag
+	for {
+		msg, _, err := wire.ReadMessage(conn, pver, btcnet)
+		if err != nil {
+			t.Fatalf("unable to read version: %v", err)
+		}
+		if msg, ok := msg.(*wire.MsgVersion); ok {
+			services = msg.Services
+			break
+		}
+	}
+	if services&wire.SFNodeNetwork != 0 ||
+		services&wire.SFNodeNetworkLimited == 0 {
+
+		t.Fatalf("unexpected advertised services %v", services)
+	}
+	if err := wire.WriteMessage(conn, wire.NewMsgVerAck(), pver, btcnet); err != nil {
+		t.Fatalf("unable to send verack: %v", err)
+	}
+
+	// Request an old block and a recent one.  The old one is rejected and
+	// the recent one is served.
+	getData := wire.NewMsgGetData()
+	getData.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, hashes[0]))
+	getData.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, hashes[4]))
+	if err := wire.WriteMessage(conn, getData, pver, btcnet); err != nil {
+		t.Fatalf("unable to send getdata: %v", err)
+	}
+	var reject *wire.MsgReject
+	var served *wire.MsgBlock
+	for reject == nil || served == nil {
+		msg, _, err := wire.ReadMessage(conn, pver, btcnet)
+		if err != nil {
+			t.Fatalf("unable to read response to getdata: %v", err)
+		}
+		switch msg := msg.(type) {
+		case *wire.MsgReject:
+			reject = msg
+		case *wire.MsgBlock:
+			served = msg
+		case *wire.MsgNotFound:
+			t.Fatalf("block not found: %v", msg.InvList[0].Hash)
+		}
+	}
+	if reject.Cmd != wire.CmdBlock || reject.Code != wire.RejectObsolete ||
+		reject.Hash != *hashes[0] {
+
+		t.Fatalf("unexpected reject message %v", reject)
+	}
+	if served.BlockHash() != *hashes[4] {
+		t.Fatalf("unexpected block %v served, want %v",
+			served.BlockHash(), hashes[4])
+	}
+}
+
+// TestPackageRelay ensures a transaction paying too little fee which a peer
+// rejected ends up in the memory pool of the peer along with a child paying
+// enough fee for both once the child is relayed to it.
+func TestPackageRelay(t *testing.T) {
+	defer func(c *config, p *params) {
+		cfg = c
+		activeNetParams = p
+	}(cfg, activeNetParams)
+	activeNetParams = &regressionNetParams
+	chainParams := activeNetParams.Params
+	peer.AllowSelfConns()
+
+	// Issue an output to spend, and build a parent which spends it without
+	// paying a fee along with a child which spends the parent paying a
+	// fee for both.
+	source := newTestRPCHarness(t, nil)
+	defer source.teardown()
+	issueTx, _, spendScript, lookupKey := issueTestOutputs(t, source, 1,
+		100000)
+	signTx := func(tx *wire.MsgTx, amount int64) *provautil.Tx {
+		sigScript, err := txscript.SignTxOutput(chainParams, tx, 0,
+			amount, spendScript, txscript.SigHashAll, lookupKey, nil)
+		if err != nil {
+			t.Fatalf("unable to sign transaction: %v", err)
+		}
+		tx.TxIn[0].SignatureScript = sigScript
+		return provautil.NewTx(tx)
+	}
+	issueHash := issueTx.TxHash()
+	parentMsg := wire.NewMsgTx(wire.TxVersion)
+	parentMsg.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&issueHash, 1), nil))
+	parentMsg.AddTxOut(wire.NewTxOut(100000, spendScript))
+	parent := signTx(parentMsg, 100000)
+	childMsg := wire.NewMsgTx(wire.TxVersion)
+	childMsg.AddTxIn(wire.NewTxIn(wire.NewOutPoint(parent.Hash(), 0), nil))
+	childMsg.AddTxOut(wire.NewTxOut(90000, spendScript))
+	child := signTx(childMsg, 100000)
+
+	// Both servers require a minimum relay fee since there is none by
+	// default, and rate limit transactions from peers paying less to
+	// nothing.
+	tmpDir, err := ioutil.TempDir("", "packagerelay")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cfg = newTestConfig(tmpDir)
+	cfg.minRelayTxFee = 1000
+
+	// startServer starts a server which listens on the passed address, if
+	// any, and extends its chain to the chain of the source harness.
+	startServer := func(name, listenAddr string) *server {
+		cfg.DisableListen = listenAddr == ""
+		cfg.DataDir = filepath.Join(tmpDir, name)
+		db, err := database.Create("ffldb", filepath.Join(cfg.DataDir,
+			"ffldb"), chainParams.Net)
+		if err != nil {
+			t.Fatalf("unable to create db: %v", err)
+		}
+		s, err := newServer([]string{listenAddr}, db, chainParams)
+		if err != nil {
+			db.Close()
+			t.Fatalf("newServer: unexpected error: %v", err)
+		}
+		s.Start()
+		best := source.chain.BestSnapshot().Height
+		for height := uint32(1); height <= best; height++ {
+			block, err := source.chain.BlockByHeight(height)
+			if err != nil {
+				t.Fatalf("BlockByHeight: unexpected error: %v", err)
+			}
+			_, _, err = s.blockManager.ProcessBlock(block,
+				blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock: unexpected error: %v", err)
+			}
+		}
+		return s
+	}
+	stopServer := func(s *server) {
+		s.Stop()
+		s.WaitForShutdown()
+		s.db.Close()
+	}
+	unused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	listenAddr := unused.Addr().String()
+	unused.Close()
+	receiver := startServer("receiver", listenAddr)
+	defer stopServer(receiver)
+	sender := startServer("sender", "")
+	defer stopServer(sender)
+	if err := sender.ConnectNode(listenAddr, false); err != nil {
+		t.Fatalf("ConnectNode: unexpected error: %v", err)
+	}
+
+	// waitFor waits until the passed condition holds.
+	waitFor := func(desc string, cond func() bool) {
+		timeout := time.After(time.Second * 10)
+		for !cond() {
+			select {
+			case <-timeout:
+				t.Fatalf("timed out waiting for %s", desc)
+			case <-time.After(time.Millisecond * 10):
+			}
+		}
+	}
+	waitFor("connection", func() bool {
+		return sender.ConnectedCount() == 1 &&
+			receiver.ConnectedCount() == 1
+	})
+
+	// The parent is accepted by the sender, which submits it locally, but
+	// rejected by the receiver when relayed to it.
+	accepted, err := sender.txMemPool.ProcessTransaction(parent, false,
+		false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	sender.AnnounceNewTransactions(accepted)
+	waitFor("parent reject", func() bool {
+		for _, reject := range sender.rejectStats.Summary().Rejects {
+			if reject.Command == wire.CmdTx && reject.LastHash ==
+				parent.Hash().String() {
+
+				return true
+			}
+		}
+		return false
+	})
+	if receiver.txMemPool.IsTransactionInPool(parent.Hash()) {
+		t.Fatal("receiver accepted the parent paying too little fee")
+	}
+
+	// Once the sender relays the child, the receiver accepts both.
+	accepted, err = sender.txMemPool.ProcessTransaction(child, false,
+		false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	sender.AnnounceNewTransactions(accepted)
+	waitFor("package acceptance", func() bool {
+		return receiver.txMemPool.IsTransactionInPool(parent.Hash()) &&
+			receiver.txMemPool.IsTransactionInPool(child.Hash())
+	})
+}
+
+// TestSetReachableNetworks ensures the networks peers are connected to on
+// follow the interfaces of IPv6-only, IPv4-only, and dual-stack hosts unless a
+// proxy dials the connections, are limited by --onlynet, and that a listener
+// on an unspecified address advertises the interface addresses on its network
+// with its port.
+func TestSetReachableNetworks(t *testing.T) {
+	defer func(c *config) {
+		cfg = c
+	}(cfg)
+
+	ipv4Addrs := []net.Addr{&net.IPNet{IP: net.ParseIP("204.124.8.100"),
+		Mask: net.CIDRMask(24, 32)}}
+	ipv6Addrs := []net.Addr{&net.IPNet{IP: net.ParseIP("2602:100::5"),
+		Mask: net.CIDRMask(64, 128)}}
+	dualStack := append(append([]net.Addr{}, ipv4Addrs...), ipv6Addrs...)
+	tests := []struct {
+		name       string
+		ifaceAddrs []net.Addr
+		proxy      string
+		onlyNets   []addrmgr.Network
+		reachable  []addrmgr.Network
+	}{
+		{
+			name:       "ipv6 only",
+			ifaceAddrs: ipv6Addrs,
+			reachable:  []addrmgr.Network{addrmgr.NetIPv6},
+		},
+		{
+			name:       "ipv4 only",
+			ifaceAddrs: ipv4Addrs,
+			reachable:  []addrmgr.Network{addrmgr.NetIPv4},
+		},
+		{
+			name:       "dual stack",
+			ifaceAddrs: dualStack,
+			reachable: []addrmgr.Network{addrmgr.NetIPv4,
+				addrmgr.NetIPv6},
+		},
+		{
+			name:       "dual stack limited to ipv6",
+			ifaceAddrs: dualStack,
+			onlyNets:   []addrmgr.Network{addrmgr.NetIPv6},
+			reachable:  []addrmgr.Network{addrmgr.NetIPv6},
+		},
+		{
+			name:       "no interfaces",
+			ifaceAddrs: nil,
+			reachable: []addrmgr.Network{addrmgr.NetIPv4,
+				addrmgr.NetIPv6},
+		},
+		{
+			name:       "ipv4 only with proxy",
+			ifaceAddrs: ipv4Addrs,
+			proxy:      "127.0.0.1:9050",
+			reachable: []addrmgr.Network{addrmgr.NetIPv4,
+				addrmgr.NetIPv6, addrmgr.NetOnion},
+		},
+	}
+
+	for _, test := range tests {
+		cfg = newTestConfig("")
+		cfg.Proxy = test.proxy
+		cfg.onlyNets = test.onlyNets
+		amgr := addrmgr.New("", nil)
+		setReachableNetworks(amgr, test.ifaceAddrs)
+		want := make(map[addrmgr.Network]bool)
+		for _, n := range test.reachable {
+			want[n] = true
+		}
+		for _, n := range []addrmgr.Network{addrmgr.NetIPv4,
+			addrmgr.NetIPv6, addrmgr.NetOnion} {
+
+			if amgr.IsReachable(n) != want[n] {
+				t.Errorf("%s: got reachable %v for %v, want %v",
+					test.name, amgr.IsReachable(n), n, want[n])
+			}
+		}
+	}
+
+	listener, err := net.Listen("tcp4", "0.0.0.0:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+	amgr := addrmgr.New("", nil)
+	addListenAddress(amgr, listener, dualStack, wire.SFNodeNetwork)
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+	localAddrs := amgr.LocalAddresses()
+	if len(localAddrs) != 1 || localAddrs[0].NetAddress.Port != port ||
+		!localAddrs[0].NetAddress.IP.Equal(net.ParseIP("204.124.8.100")) {
+
+		t.Errorf("got local addresses %v for a listener on port %d, "+
+			"want 204.124.8.100", localAddrs, port)
+	}
+}
@@ -0,0 +1,404 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/mempool"
+)
+
+var (
+	// statsHistoryBucketName is the name of the database bucket used to
+	// house the samples of the stats history.  The samples are keyed by the
+	// time they were taken in Unix nanoseconds, encoded big endian so they
+	// are iterated in the order they were taken.
+	statsHistoryBucketName = []byte("statshistory")
+
+	// statsFeeRatePercentiles are the percentiles of the fee rates of the
+	// transactions in the mempool which are recorded with each sample.
+	statsFeeRatePercentiles = []int{10, 25, 50, 75, 90}
+)
+
+// int64Sorter implements sort.Interface to allow a slice of 64-bit integers to
+// be sorted.
+type int64Sorter []int64
+
+// Len returns the number of 64-bit integers in the slice.  It is part of the
+// sort.Interface implementation.
+func (s int64Sorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the 64-bit integers at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s int64Sorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the 64-bit integer with index i should sort before the
+// 64-bit integer with index j.  It is part of the sort.Interface
+// implementation.
+func (s int64Sorter) Less(i, j int) bool {
+	return s[i] < s[j]
+}
+
+// statsSample is a sample of the stats history as it is stored in the
+// database.  The fee rates are in atoms per kilobyte, one for each of the
+// statsFeeRatePercentiles.
+type statsSample struct {
+	MempoolTxs       int     `json:"mempooltxs"`
+	MempoolBytes     int64   `json:"mempoolbytes"`
+	FeeRates         []int64 `json:"feerates"`
+	Orphans          int     `json:"orphans"`
+	UtxoCacheSize    uint64  `json:"utxocachesize"`
+	UtxoCacheMaxSize uint64  `json:"utxocachemaxsize"`
+	InboundPeers     int     `json:"inboundpeers"`
+	OutboundPeers    int     `json:"outboundpeers"`
+}
+
+// timedStatsSample is a sample of the stats history along with the time it was
+// taken.
+type timedStatsSample struct {
+	time   time.Time
+	sample *statsSample
+}
+
+// mempoolStats returns the number of the passed mempool transactions, their
+// total serialized size, and the statsFeeRatePercentiles of their fee rates in
+// atoms per kilobyte using the nearest-rank method.  The fee rates are all
+// zero when there are no transactions.
+func mempoolStats(descs []*mempool.TxDesc) (int, int64, []int64) {
+	var totalSize int64
+	feeRates := make([]int64, 0, len(descs))
+	for _, desc := range descs {
+		size := int64(desc.Tx.MsgTx().SerializeSize())
+		totalSize += size
+		feeRates = append(feeRates, desc.Fee*1000/size)
+	}
+	sort.Sort(int64Sorter(feeRates))
+
+	percentiles := make([]int64, len(statsFeeRatePercentiles))
+	if len(feeRates) == 0 {
+		return 0, 0, percentiles
+	}
+	for i, p := range statsFeeRatePercentiles {
+		rank := (p*len(feeRates) + 99) / 100
+		if rank < 1 {
+			rank = 1
+		}
+		percentiles[i] = feeRates[rank-1]
+	}
+	return len(descs), totalSize, percentiles
+}
+
+// statsHistoryKey returns the database key of a sample taken at the passed
+// time.
+func statsHistoryKey(t time.Time) []byte {
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], uint64(t.UnixNano()))
+	return key[:]
+}
+
+// statsHistory periodically samples the size of the mempool and the orphan
+// pool, the fee rates of the mempool transactions, the occupancy of the UTXO
+// cache and the number of peers, and keeps the samples taken during the
+// retention period in the database.  Older samples are removed as new ones
+// are recorded, so the history never grows beyond the retention period.
+type statsHistory struct {
+	started  int32
+	shutdown int32
+
+	db        database.DB
+	interval  time.Duration
+	retention time.Duration
+	readOnly  bool
+	collect   func() *statsSample
+
+	// mtx serializes recording samples and protects numSamples, which is
+	// the number of samples in the database.
+	mtx        sync.Mutex
+	numSamples int
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// newStatsHistory returns a stats history backed by the passed database which
+// invokes collect every interval and keeps the samples it returns for the
+// passed retention period.  An interval of zero or a read-only database
+// disables sampling, however the existing history can still be queried.
+func newStatsHistory(db database.DB, interval, retention time.Duration,
+	readOnly bool, collect func() *statsSample) (*statsHistory, error) {
+
+	h := &statsHistory{
+		db:        db,
+		interval:  interval,
+		retention: retention,
+		readOnly:  readOnly,
+		collect:   collect,
+		quit:      make(chan struct{}),
+	}
+	count := func(bucket database.Bucket) error {
+		return bucket.ForEach(func(k, v []byte) error {
+			h.numSamples++
+			return nil
+		})
+	}
+
+	var err error
+	if readOnly {
+		err = db.View(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(statsHistoryBucketName)
+			if bucket == nil {
+				return nil
+			}
+			return count(bucket)
+		})
+	} else {
+		err = db.Update(func(dbTx database.Tx) error {
+			bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+				statsHistoryBucketName)
+			if err != nil {
+				return err
+			}
+			return count(bucket)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// maxSamples returns the number of samples which are taken during the
+// retention period.
+func (h *statsHistory) maxSamples() int {
+	if h.interval <= 0 {
+		return h.numSamples + 1
+	}
+	return int(h.retention/h.interval) + 1
+}
+
+// record stores the passed sample as taken at the passed time and removes the
+// samples which were taken before the retention period, along with the oldest
+// samples in excess of the number taken during the retention period.
+func (h *statsHistory) record(now time.Time, sample *statsSample) error {
+	serialized, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	numSamples := h.numSamples
+	err = h.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(statsHistoryBucketName)
+		key := statsHistoryKey(now)
+		if bucket.Get(key) == nil {
+			numSamples++
+		}
+		if err := bucket.Put(key, serialized); err != nil {
+			return err
+		}
+
+		// Collect the expired samples before removing them since the
+		// bucket must not be modified while it is being iterated.
+		cutoff := statsHistoryKey(now.Add(-h.retention))
+		excess := numSamples - h.maxSamples()
+		var expired [][]byte
+		cursor := bucket.Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			k := cursor.Key()
+			if excess <= 0 && string(k) >= string(cutoff) {
+				break
+			}
+			expired = append(expired, append([]byte(nil), k...))
+			excess--
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		numSamples -= len(expired)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	h.numSamples = numSamples
+	return nil
+}
+
+// samples returns the samples taken between the passed start and end times,
+// inclusive, in the order they were taken.
+func (h *statsHistory) samples(start, end time.Time) ([]timedStatsSample, error) {
+	var samples []timedStatsSample
+	err := h.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(statsHistoryBucketName)
+		if bucket == nil {
+			return nil
+		}
+		endKey := statsHistoryKey(end)
+		cursor := bucket.Cursor()
+		for ok := cursor.Seek(statsHistoryKey(start)); ok; ok = cursor.Next() {
+			k := cursor.Key()
+			if string(k) > string(endKey) {
+				break
+			}
+			if len(k) != 8 {
+				return fmt.Errorf("malformed stats history key %x", k)
+			}
+			var sample statsSample
+			if err := json.Unmarshal(cursor.Value(), &sample); err != nil {
+				return fmt.Errorf("malformed stats history sample "+
+					"%x: %v", k, err)
+			}
+			nanos := int64(binary.BigEndian.Uint64(k))
+			samples = append(samples, timedStatsSample{
+				time:   time.Unix(0, nanos),
+				sample: &sample,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// History returns the samples taken between the passed start and end times,
+// inclusive.  When step is positive, the samples are averaged over periods of
+// step, aligned to multiples of step since the Unix epoch, and each result is
+// the average of the samples taken during the period starting at its time.
+func (h *statsHistory) History(start, end time.Time, step time.Duration) (*btcjson.GetStatsHistoryResult, error) {
+	samples, err := h.samples(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &btcjson.GetStatsHistoryResult{
+		Interval:    int64(h.interval / time.Second),
+		Retention:   int64(h.retention / time.Second),
+		Percentiles: statsFeeRatePercentiles,
+		Samples:     downsampleStats(samples, step),
+	}, nil
+}
+
+// downsampleStats returns the results for the passed samples, which must be in
+// the order they were taken, averaged over periods of step.  Each sample is
+// returned on its own when step is not positive.
+func downsampleStats(samples []timedStatsSample, step time.Duration) []btcjson.StatsSampleResult {
+	results := make([]btcjson.StatsSampleResult, 0, len(samples))
+	stepSecs := int64(step / time.Second)
+	for _, s := range samples {
+		t := s.time.Unix()
+		if stepSecs > 0 {
+			t -= t % stepSecs
+		}
+
+		// Start a new result when the sample was taken in a different
+		// period than the previous one.
+		if len(results) == 0 || stepSecs <= 0 ||
+			results[len(results)-1].Time != t {
+
+			results = append(results, btcjson.StatsSampleResult{
+				Time: t,
+				FeeRatePercentiles: make([]float64,
+					len(statsFeeRatePercentiles)),
+			})
+		}
+		r := &results[len(results)-1]
+		r.Samples++
+		r.MempoolTxs += float64(s.sample.MempoolTxs)
+		r.MempoolBytes += float64(s.sample.MempoolBytes)
+		r.Orphans += float64(s.sample.Orphans)
+		r.UtxoCacheSize += float64(s.sample.UtxoCacheSize)
+		r.UtxoCacheMaxSize += float64(s.sample.UtxoCacheMaxSize)
+		r.InboundPeers += float64(s.sample.InboundPeers)
+		r.OutboundPeers += float64(s.sample.OutboundPeers)
+		for i := range r.FeeRatePercentiles {
+			if i < len(s.sample.FeeRates) {
+				r.FeeRatePercentiles[i] += float64(s.sample.FeeRates[i])
+			}
+		}
+	}
+
+	// Turn the sums into averages.
+	for i := range results {
+		r := &results[i]
+		n := float64(r.Samples)
+		r.MempoolTxs /= n
+		r.MempoolBytes /= n
+		r.Orphans /= n
+		r.UtxoCacheSize /= n
+		r.UtxoCacheMaxSize /= n
+		r.InboundPeers /= n
+		r.OutboundPeers /= n
+		for j := range r.FeeRatePercentiles {
+			r.FeeRatePercentiles[j] /= n
+		}
+	}
+	return results
+}
+
+// sampleHandler takes a sample every interval until the stats history is
+// stopped.  It must be run as a goroutine.
+func (h *statsHistory) sampleHandler() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := h.record(now, h.collect()); err != nil {
+				srvrLog.Errorf("Unable to record stats sample: %v",
+					err)
+			}
+		case <-h.quit:
+			break out
+		}
+	}
+
+	h.wg.Done()
+	srvrLog.Trace("Stats history sampler done")
+}
+
+// Start begins taking samples when sampling is enabled.
+func (h *statsHistory) Start() {
+	// Already started?
+	if atomic.AddInt32(&h.started, 1) != 1 {
+		return
+	}
+	if h.interval == 0 || h.readOnly {
+		return
+	}
+
+	srvrLog.Trace("Starting stats history sampler")
+	h.wg.Add(1)
+	go h.sampleHandler()
+}
+
+// Stop stops taking samples and waits for the sample being taken, if any, to
+// be recorded.
+func (h *statsHistory) Stop() {
+	if atomic.AddInt32(&h.shutdown, 1) != 1 {
+		return
+	}
+
+	close(h.quit)
+	h.wg.Wait()
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/mining"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestMempoolStats ensures the fee rate percentiles of the mempool
+// transactions are computed with the nearest-rank method.
+func TestMempoolStats(t *testing.T) {
+	msgTx := wire.NewMsgTx(1)
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil))
+	msgTx.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	size := int64(msgTx.SerializeSize())
+
+	// The fee rates are 1000 to 10000 atoms per kilobyte, out of order.
+	var descs []*mempool.TxDesc
+	for _, rate := range []int64{7, 2, 9, 4, 10, 1, 5, 8, 3, 6} {
+		descs = append(descs, &mempool.TxDesc{
+			TxDesc: mining.TxDesc{
+				Tx:  provautil.NewTx(msgTx),
+				Fee: rate * size,
+			},
+		})
+	}
+
+	numTxs, numBytes, feeRates := mempoolStats(descs)
+	if numTxs != 10 {
+		t.Errorf("mempoolStats: got %d txs, want 10", numTxs)
+	}
+	if numBytes != 10*size {
+		t.Errorf("mempoolStats: got %d bytes, want %d", numBytes, 10*size)
+	}
+	want := []int64{1000, 3000, 5000, 8000, 9000}
+	if !reflect.DeepEqual(feeRates, want) {
+		t.Errorf("mempoolStats: got fee rates %v, want %v", feeRates, want)
+	}
+
+	numTxs, numBytes, feeRates = mempoolStats(nil)
+	if numTxs != 0 || numBytes != 0 ||
+		!reflect.DeepEqual(feeRates, []int64{0, 0, 0, 0, 0}) {
+
+		t.Errorf("mempoolStats of an empty mempool: got %d txs, %d "+
+			"bytes, fee rates %v", numTxs, numBytes, feeRates)
+	}
+}
+
+// TestStatsHistory ensures samples older than the retention period are removed
+// as samples are recorded, that the samples are kept across restarts, and that
+// range queries and downsampling return the expected averages.
+func TestStatsHistory(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "statshistory")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		chaincfg.RegressionNetParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+
+	h, err := newStatsHistory(db, time.Minute, 10*time.Minute, false, nil)
+	if err != nil {
+		t.Fatalf("newStatsHistory: unexpected error: %v", err)
+	}
+
+	// Record a sample every minute for 15 minutes, starting at the start
+	// of an hour.
+	base := time.Unix(1499997600, 0)
+	sampleAt := func(minute int) *statsSample {
+		return &statsSample{
+			MempoolTxs:    minute,
+			MempoolBytes:  int64(minute) * 250,
+			FeeRates:      []int64{1000, 1000, 2000, 3000, int64(minute)},
+			InboundPeers:  minute % 2,
+			OutboundPeers: 8,
+		}
+	}
+	for minute := 0; minute < 15; minute++ {
+		err := h.record(base.Add(time.Duration(minute)*time.Minute),
+			sampleAt(minute))
+		if err != nil {
+			t.Fatalf("record: unexpected error: %v", err)
+		}
+	}
+	checkMinutes := func(desc string, samples []timedStatsSample, want []int) {
+		var minutes []int
+		for _, s := range samples {
+			minute := int(s.time.Sub(base) / time.Minute)
+			if s.sample.MempoolTxs != minute {
+				t.Errorf("%s: sample at minute %d has %d mempool "+
+					"txs", desc, minute, s.sample.MempoolTxs)
+			}
+			minutes = append(minutes, minute)
+		}
+		if !reflect.DeepEqual(minutes, want) {
+			t.Errorf("%s: got samples at minutes %v, want %v", desc,
+				minutes, want)
+		}
+	}
+
+	// Only the samples of the last 10 minutes are kept.
+	samples, err := h.samples(time.Unix(0, 0), base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("samples: unexpected error: %v", err)
+	}
+	checkMinutes("retained", samples, []int{4, 5, 6, 7, 8, 9, 10, 11, 12,
+		13, 14})
+	if h.numSamples != 11 {
+		t.Errorf("retained: got %d samples counted, want 11", h.numSamples)
+	}
+
+	// Range queries include the samples taken at both ends.
+	samples, err = h.samples(base.Add(6*time.Minute), base.Add(9*time.Minute))
+	if err != nil {
+		t.Fatalf("samples: unexpected error: %v", err)
+	}
+	checkMinutes("range", samples, []int{6, 7, 8, 9})
+	samples, err = h.samples(base, base.Add(3*time.Minute))
+	if err != nil {
+		t.Fatalf("samples: unexpected error: %v", err)
+	}
+	checkMinutes("expired range", samples, nil)
+
+	// Downsampling averages the samples over periods aligned to multiples
+	// of the step.
+	result, err := h.History(time.Unix(0, 0), base.Add(time.Hour),
+		5*time.Minute)
+	if err != nil {
+		t.Fatalf("History: unexpected error: %v", err)
+	}
+	if result.Interval != 60 || result.Retention != 600 {
+		t.Errorf("History: got interval %d and retention %d, want 60 "+
+			"and 600", result.Interval, result.Retention)
+	}
+	wantAverages := []struct {
+		minute  int
+		samples int
+		average float64
+		inbound float64
+	}{
+		{minute: 0, samples: 1, average: 4, inbound: 0},
+		{minute: 5, samples: 5, average: 7, inbound: 0.6},
+		{minute: 10, samples: 5, average: 12, inbound: 0.4},
+	}
+	if len(result.Samples) != len(wantAverages) {
+		t.Fatalf("History: got %d results, want %d", len(result.Samples),
+			len(wantAverages))
+	}
+	for i, want := range wantAverages {
+		r := result.Samples[i]
+		wantTime := base.Add(time.Duration(want.minute) * time.Minute).Unix()
+		wantFeeRates := []float64{1000, 1000, 2000, 3000, want.average}
+		if r.Time != wantTime || r.Samples != want.samples ||
+			r.MempoolTxs != want.average ||
+			r.MempoolBytes != want.average*250 ||
+			r.InboundPeers != want.inbound || r.OutboundPeers != 8 ||
+			!reflect.DeepEqual(r.FeeRatePercentiles, wantFeeRates) {
+
+			t.Errorf("History result #%d: got %+v", i, r)
+		}
+	}
+
+	// Without a step, each sample is returned on its own.
+	result, err = h.History(base.Add(14*time.Minute), base.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("History: unexpected error: %v", err)
+	}
+	if len(result.Samples) != 1 || result.Samples[0].Samples != 1 ||
+		result.Samples[0].MempoolTxs != 14 {
+
+		t.Errorf("History without a step: got %+v", result.Samples)
+	}
+
+	// The samples are kept across restarts, and the oldest ones are
+	// removed when there are more than the number taken during the
+	// retention period, such as after the interval is made longer.
+	h, err = newStatsHistory(db, 5*time.Minute, 10*time.Minute, false, nil)
+	if err != nil {
+		t.Fatalf("newStatsHistory: unexpected error: %v", err)
+	}
+	if h.numSamples != 11 {
+		t.Errorf("restarted: got %d samples counted, want 11", h.numSamples)
+	}
+	if err := h.record(base.Add(15*time.Minute), sampleAt(15)); err != nil {
+		t.Fatalf("record: unexpected error: %v", err)
+	}
+	samples, err = h.samples(time.Unix(0, 0), base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("samples: unexpected error: %v", err)
+	}
+	checkMinutes("restarted", samples, []int{13, 14, 15})
+}
+
+// TestStatsHistorySampler ensures samples are taken at the configured interval
+// and that no more than the samples taken during the retention period are
+// kept.
+func TestStatsHistorySampler(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "statshistory")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		chaincfg.RegressionNetParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+
+	collected := make(chan struct{}, 100)
+	collect := func() *statsSample {
+		collected <- struct{}{}
+		return &statsSample{MempoolTxs: 1}
+	}
+	h, err := newStatsHistory(db, 10*time.Millisecond, 30*time.Millisecond,
+		false, collect)
+	if err != nil {
+		t.Fatalf("newStatsHistory: unexpected error: %v", err)
+	}
+	h.Start()
+	for i := 0; i < 8; i++ {
+		select {
+		case <-collected:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for sample #%d", i)
+		}
+	}
+	h.Stop()
+
+	samples, err := h.samples(time.Unix(0, 0), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("samples: unexpected error: %v", err)
+	}
+	if len(samples) == 0 || len(samples) > 4 {
+		t.Fatalf("got %d samples, want between 1 and 4", len(samples))
+	}
+	for i, s := range samples {
+		if s.sample.MempoolTxs != 1 {
+			t.Errorf("sample #%d: got %d mempool txs, want 1", i,
+				s.sample.MempoolTxs)
+		}
+	}
+}
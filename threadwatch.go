@@ -0,0 +1,141 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+)
+
+// pendingAdminTxs returns the number of admin transactions of each admin
+// thread among the passed transactions of the mempool.
+func pendingAdminTxs(txDescs []*mempool.TxDesc) map[provautil.ThreadID]int {
+	pending := make(map[provautil.ThreadID]int)
+	for _, txDesc := range txDescs {
+		threadInt, _ := txscript.GetAdminDetails(txDesc.Tx)
+		if threadInt < 0 {
+			continue
+		}
+		pending[provautil.ThreadID(threadInt)]++
+	}
+	return pending
+}
+
+// threadWatchdog watches the admin threads of the best chain and warns when a
+// thread has not advanced for more than a number of blocks while admin
+// transactions for it are pending in the mempool, such as when its tip can't
+// be spent by the transactions the operators submitted.  The blocks a thread
+// is stalled for are counted from the later of the block which last advanced
+// it and the best block as of when transactions for it were first seen
+// pending, so a thread which is rarely used isn't reported as soon as a
+// transaction for it arrives.  The watchdog is only accessed by the block
+// handler.
+type threadWatchdog struct {
+	chain       *blockchain.BlockChain
+	stuckBlocks uint32
+
+	pendingSince map[provautil.ThreadID]uint32
+	warned       map[provautil.ThreadID]bool
+	warnings     uint64
+}
+
+// newThreadWatchdog returns a new watchdog for the admin threads of the passed
+// chain which warns when a thread has not advanced for more than the passed
+// number of blocks while admin transactions for it are pending.
+func newThreadWatchdog(chain *blockchain.BlockChain, stuckBlocks uint32) *threadWatchdog {
+	return &threadWatchdog{
+		chain:        chain,
+		stuckBlocks:  stuckBlocks,
+		pendingSince: make(map[provautil.ThreadID]uint32),
+		warned:       make(map[provautil.ThreadID]bool),
+	}
+}
+
+// Check compares the tip of each admin thread of the best chain against the
+// passed number of admin transactions pending for each thread and returns the
+// state of the threads along with the threads which were found stuck and were
+// not reported yet.  The warning for those threads is logged and counted, and
+// should be delivered to the webhooks by the caller.
+//
+// This function MUST be called from the block handler.
+func (w *threadWatchdog) Check(pending map[provautil.ThreadID]int) (*btcjson.GetThreadInfoResult, []*btcjson.ThreadInfoResult, error) {
+	best := w.chain.BestSnapshot()
+	tips, err := w.chain.ThreadTipInfos()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &btcjson.GetThreadInfoResult{
+		Hash:        best.Hash.String(),
+		Height:      best.Height,
+		StuckBlocks: w.stuckBlocks,
+		Threads:     make([]btcjson.ThreadInfoResult, len(tips)),
+	}
+	var stuck []*btcjson.ThreadInfoResult
+	for i, tip := range tips {
+		thread := &result.Threads[i]
+		*thread = btcjson.ThreadInfoResult{
+			ID:             uint32(tip.ThreadID),
+			Name:           adminThreadNames[tip.ThreadID],
+			OutPoint:       tip.Tip.String(),
+			AdvancedHeight: tip.Height,
+			PendingTxs:     pending[tip.ThreadID],
+		}
+
+		// Forget the pending transactions of threads which have none
+		// left, and resolve any warning about them.
+		if thread.PendingTxs == 0 {
+			if w.warned[tip.ThreadID] {
+				bmgrLog.Infof("Admin thread %s advanced or has no "+
+					"pending transactions left at height %d",
+					thread.Name, best.Height)
+			}
+			delete(w.pendingSince, tip.ThreadID)
+			delete(w.warned, tip.ThreadID)
+			continue
+		}
+
+		since, ok := w.pendingSince[tip.ThreadID]
+		if !ok {
+			since = best.Height
+			w.pendingSince[tip.ThreadID] = since
+		}
+		thread.PendingSince = since
+		if tip.Height > since {
+			since = tip.Height
+		}
+		if best.Height > since {
+			thread.StalledBlocks = best.Height - since
+		}
+		thread.Stuck = thread.StalledBlocks > w.stuckBlocks
+
+		switch {
+		case !thread.Stuck:
+			if w.warned[tip.ThreadID] {
+				bmgrLog.Infof("Admin thread %s advanced to %s at "+
+					"height %d", thread.Name, thread.OutPoint,
+					tip.Height)
+			}
+			delete(w.warned, tip.ThreadID)
+
+		case !w.warned[tip.ThreadID]:
+			w.warned[tip.ThreadID] = true
+			stuck = append(stuck, thread)
+			bmgrLog.Warnf("Admin thread %s is stuck: it has not "+
+				"advanced from %s for %d blocks while %d admin "+
+				"transactions for it are pending in the mempool",
+				thread.Name, thread.OutPoint, thread.StalledBlocks,
+				thread.PendingTxs)
+		}
+	}
+
+	w.warnings += uint64(len(stuck))
+	result.Warnings = w.warnings
+
+	return result, stuck, nil
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/mining"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestThreadWatchdog ensures the tip of each admin thread is reported along
+// with the height it was last advanced at and the admin transactions pending
+// for it, and that a thread which has not advanced for more than the
+// configured number of blocks while transactions for it are pending is
+// reported stuck once, through the log and the webhooks, until it advances.
+func TestThreadWatchdog(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	s := h.rpcServer.server
+	params := s.chainParams
+
+	// Mine enough blocks for the admin thread outputs of the genesis
+	// coinbase to mature.
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		h.mineBlock(t)
+	}
+	maturity := uint32(params.CoinbaseMaturity)
+
+	// Create a root transaction which provisions a provision key.
+	tips := h.chain.ThreadTips()
+	provisionKey := privKeyFromHex(t, "0000000000000000000000000000000000000000000000000000000000000001")
+	rootTx := testAdminTx(t, params, provautil.RootThread,
+		tips[provautil.RootThread], regressionRootKeys(t),
+		wire.NewTxOut(0, testAdminOpScript(t,
+			txscript.AdminOpProvisionKeyAdd, provisionKey.PubKey(), 0)))
+
+	// Only admin transactions are counted as pending for their thread.
+	payScript, err := txscript.PayToAddrScript(h.payAddr)
+	if err != nil {
+		t.Fatalf("unable to create pkScript: %v", err)
+	}
+	payTx := wire.NewMsgTx(wire.TxVersion)
+	payTx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Index: 1}})
+	payTx.AddTxOut(wire.NewTxOut(1000, payScript))
+	txDescs := []*mempool.TxDesc{
+		{TxDesc: mining.TxDesc{Tx: provautil.NewTx(rootTx)}},
+		{TxDesc: mining.TxDesc{Tx: provautil.NewTx(payTx)}},
+	}
+	pending := pendingAdminTxs(txDescs)
+	if len(pending) != 1 || pending[provautil.RootThread] != 1 {
+		t.Fatalf("unexpected pending admin transactions: %v", pending)
+	}
+
+	// Deliver stuck admin thread events to a test webhook endpoint.
+	recorder := &webhookRecorder{delivered: make(chan struct{}, 10)}
+	hookServer := httptest.NewServer(recorder)
+	defer hookServer.Close()
+	n, _ := newTestWebhookNotifier(hookServer.URL, 10)
+	n.Start()
+	defer n.Stop()
+
+	w := newThreadWatchdog(h.chain, 2)
+	check := func(pending map[provautil.ThreadID]int) (*btcjson.GetThreadInfoResult, []*btcjson.ThreadInfoResult) {
+		result, stuck, err := w.Check(pending)
+		if err != nil {
+			t.Fatalf("Check: unexpected error: %v", err)
+		}
+		for _, thread := range stuck {
+			n.NotifyThreadStuck(thread, result.Hash, result.Height)
+		}
+		return result, stuck
+	}
+
+	// All threads continue from the genesis coinbase and nothing is
+	// pending.
+	result, stuck := check(nil)
+	if len(stuck) != 0 || result.Height != maturity ||
+		result.StuckBlocks != 2 || len(result.Threads) != 3 {
+
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	names := []string{"root", "provision", "issue"}
+	for i, thread := range result.Threads {
+		tip := tips[provautil.ThreadID(i)]
+		if thread.ID != uint32(i) || thread.Name != names[i] ||
+			thread.OutPoint != tip.String() ||
+			thread.AdvancedHeight != 0 || thread.PendingTxs != 0 ||
+			thread.Stuck {
+
+			t.Errorf("thread %d: unexpected state %+v", i, thread)
+		}
+	}
+
+	// Although the root thread was last advanced long ago, the blocks it
+	// is stalled for are only counted from when the transaction was first
+	// seen pending.
+	result, stuck = check(pending)
+	root := result.Threads[provautil.RootThread]
+	if len(stuck) != 0 || root.PendingTxs != 1 ||
+		root.PendingSince != maturity || root.StalledBlocks != 0 ||
+		root.Stuck {
+
+		t.Fatalf("unexpected root thread once pending: %+v", root)
+	}
+	for i := 0; i < 2; i++ {
+		h.mineBlock(t)
+	}
+	result, stuck = check(pending)
+	root = result.Threads[provautil.RootThread]
+	if len(stuck) != 0 || root.StalledBlocks != 2 || root.Stuck {
+		t.Fatalf("root thread stuck at the limit: %+v", root)
+	}
+
+	// The thread is reported stuck once it stalled for more than the
+	// limit, but only once.
+	h.mineBlock(t)
+	result, stuck = check(pending)
+	root = result.Threads[provautil.RootThread]
+	if len(stuck) != 1 || stuck[0].ID != uint32(provautil.RootThread) ||
+		root.StalledBlocks != 3 || !root.Stuck || result.Warnings != 1 {
+
+		t.Fatalf("root thread not reported stuck: %+v", result)
+	}
+	result, stuck = check(pending)
+	if len(stuck) != 0 || !result.Threads[provautil.RootThread].Stuck ||
+		result.Warnings != 1 {
+
+		t.Fatalf("root thread reported stuck twice: %+v", result)
+	}
+
+	// The stuck thread is delivered to the webhooks.
+	recorder.waitDelivered(t, 1)
+	recorder.Lock()
+	payload := recorder.payloads[0]
+	recorder.Unlock()
+	var event webhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		t.Fatalf("unable to decode payload: %v", err)
+	}
+	if event.Type != webhookThreadStuck || event.Height != maturity+3 ||
+		event.Thread == nil || event.Thread.Name != "root" ||
+		event.Thread.PendingTxs != 1 || event.Thread.StalledBlocks != 3 {
+
+		t.Fatalf("unexpected payload: %s", payload)
+	}
+
+	// Once the transaction is mined, the thread advances and is no longer
+	// stuck, even while another transaction for it is pending.
+	h.mineBlockWithTxs(t, []*wire.MsgTx{rootTx})
+	result, stuck = check(pending)
+	root = result.Threads[provautil.RootThread]
+	wantTip := wire.OutPoint{Hash: rootTx.TxHash(), Index: 0}
+	if len(stuck) != 0 || root.OutPoint != wantTip.String() ||
+		root.AdvancedHeight != maturity+4 || root.StalledBlocks != 0 ||
+		root.Stuck {
+
+		t.Fatalf("unexpected root thread once advanced: %+v", root)
+	}
+
+	// The pending height starts over once nothing is pending.
+	check(nil)
+	h.mineBlock(t)
+	result, _ = check(pending)
+	root = result.Threads[provautil.RootThread]
+	if root.PendingSince != maturity+5 || root.StalledBlocks != 0 {
+		t.Fatalf("unexpected root thread when pending again: %+v", root)
+	}
+}
@@ -74,6 +74,20 @@ const (
 	// ScriptVerifyStrictEncoding defines that signature scripts and
 	// public keys must follow the strict encoding requirements.
 	ScriptVerifyStrictEncoding
+
+	// ScriptVerifyScriptVersions defines whether public key scripts with a
+	// script version higher than MaxScriptVersion are treated as
+	// anyone-can-spend, so semantics can be assigned to the versions by
+	// later soft forks.  Otherwise, they are executed as any other script.
+	ScriptVerifyScriptVersions
+
+	// ScriptDiscourageUpgradableScriptVersions defines whether to reject
+	// spending public key scripts with a script version higher than
+	// MaxScriptVersion, which are reserved for future soft-fork upgrades.
+	// This flag must not be used for consensus critical code nor applied
+	// to blocks as this flag is only for stricter standard transaction
+	// checks.
+	ScriptDiscourageUpgradableScriptVersions
 )
 
 const (
@@ -106,6 +120,7 @@ type Engine struct {
 	bip16           bool     // treat execution as pay-to-script-hash
 	savedFirstStack [][]byte // stack from first script for bip16 scripts
 	inputAmount     int64
+	scriptVersion   uint16
 }
 
 // hasFlag returns whether the script engine instance has the passed flag set.
@@ -364,6 +379,12 @@ func (vm *Engine) Step() (done bool, err error) {
 // Execute will execute all scripts in the script engine and return either nil
 // for successful validation or an error if one occurred.
 func (vm *Engine) Execute() (err error) {
+	// Public key scripts with an unknown script version are anyone-can-spend
+	// when script versions are enforced, so there is nothing to execute.
+	if vm.isUpgradableScriptVersion() {
+		return nil
+	}
+
 	done := false
 	for !done {
 		log.Tracef("%v", newLogClosure(func() string {
@@ -627,11 +648,32 @@ func (vm *Engine) SetAltStack(data [][]byte) {
 	setStack(&vm.astack, data)
 }
 
+// isUpgradableScriptVersion returns whether the public key script has a script
+// version without defined semantics which is treated as anyone-can-spend.
+func (vm *Engine) isUpgradableScriptVersion() bool {
+	return vm.scriptVersion > MaxScriptVersion &&
+		vm.hasFlag(ScriptVerifyScriptVersions)
+}
+
 // NewEngine returns a new script engine for the provided public key script,
 // transaction, and input index.  The flags modify the behavior of the script
-// engine according to the description provided by each flag.
+// engine according to the description provided by each flag.  The public key
+// script is executed with the default script version.
 func NewEngine(scriptPubKey []byte, tx *wire.MsgTx, txIdx int, flags ScriptFlags,
 	sigCache *SigCache, hashCache *TxSigHashes, inputAmount int64) (*Engine, error) {
+
+	return NewVersionedEngine(DefaultScriptVersion, scriptPubKey, tx, txIdx,
+		flags, sigCache, hashCache, inputAmount)
+}
+
+// NewVersionedEngine returns a new script engine for the provided public key
+// script with the provided script version, transaction, and input index.  When
+// the ScriptVerifyScriptVersions flag is set, public key scripts with a version
+// higher than MaxScriptVersion are not executed and the resulting engine
+// succeeds as long as the signature script is well formed.
+func NewVersionedEngine(version uint16, scriptPubKey []byte, tx *wire.MsgTx,
+	txIdx int, flags ScriptFlags, sigCache *SigCache, hashCache *TxSigHashes,
+	inputAmount int64) (*Engine, error) {
 	// The provided transaction input index must refer to a valid input.
 	if txIdx < 0 || txIdx >= len(tx.TxIn) {
 		str := fmt.Sprintf("transaction input index %d is negative or "+
@@ -658,16 +700,28 @@ func NewEngine(scriptPubKey []byte, tx *wire.MsgTx, txIdx int, flags ScriptFlags
 	// possible to have a situation where P2SH would not be a soft fork when
 	// it should be.
 	vm := Engine{
-		flags:       flags,
-		sigCache:    sigCache,
-		hashCache:   hashCache,
-		inputAmount: inputAmount,
+		flags:         flags,
+		sigCache:      sigCache,
+		hashCache:     hashCache,
+		inputAmount:   inputAmount,
+		scriptVersion: version,
 	}
 	if vm.hasFlag(ScriptVerifyCleanStack) && !vm.hasFlag(ScriptBip16) {
 		return nil, scriptError(ErrInvalidFlags,
 			"invalid flags combination")
 	}
 
+	// Spending public key scripts with a script version reserved for
+	// future upgrades is rejected when the associated flag is set.
+	if version > MaxScriptVersion &&
+		vm.hasFlag(ScriptDiscourageUpgradableScriptVersions) {
+
+		str := fmt.Sprintf("script version %d is reserved for soft-fork "+
+			"upgrades", version)
+		return nil, scriptError(ErrDiscourageUpgradableScriptVersion,
+			str)
+	}
+
 	// The signature script must only contain data pushes when the
 	// associated flag is set.
 	if vm.hasFlag(ScriptVerifySigPushOnly) && !IsPushOnlyScript(scriptSig) {
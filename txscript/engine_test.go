@@ -203,6 +203,98 @@ func TestInvalidFlagCombinations(t *testing.T) {
 	}
 }
 
+// TestUpgradableScriptVersions ensures public key scripts with a script version
+// reserved for future upgrades are only treated as anyone-can-spend when script
+// versions are enforced, and are rejected when they are discouraged.
+func TestUpgradableScriptVersions(t *testing.T) {
+	t.Parallel()
+
+	// The script evaluates to false when it is executed.
+	pkScript := append([]byte{OP_1, OP_DATA_20}, make([]byte, 20)...)
+
+	tests := []struct {
+		name      string
+		version   uint16
+		flags     ScriptFlags
+		sigScript []byte
+		newErr    ErrorCode
+		execErr   ErrorCode
+	}{
+		{
+			name:    "unknown version enforced",
+			version: 1,
+			flags:   ScriptVerifyScriptVersions,
+			newErr:  -1,
+			execErr: -1,
+		},
+		{
+			name:    "unknown version not enforced",
+			version: 1,
+			newErr:  -1,
+			execErr: ErrEvalFalse,
+		},
+		{
+			name:    "default version enforced",
+			version: DefaultScriptVersion,
+			flags:   ScriptVerifyScriptVersions,
+			newErr:  -1,
+			execErr: ErrEvalFalse,
+		},
+		{
+			name:    "unknown version discouraged",
+			version: 1,
+			flags: ScriptVerifyScriptVersions |
+				ScriptDiscourageUpgradableScriptVersions,
+			newErr: ErrDiscourageUpgradableScriptVersion,
+		},
+		{
+			name:      "unknown version with malformed signature script",
+			version:   1,
+			flags:     ScriptVerifyScriptVersions,
+			sigScript: []byte{OP_DATA_2, 0x01},
+			newErr:    ErrMalformedPush,
+		},
+	}
+
+	for _, test := range tests {
+		tx := &wire.MsgTx{
+			Version: 1,
+			TxIn: []*wire.TxIn{{
+				PreviousOutPoint: wire.OutPoint{Index: 0},
+				SignatureScript:  test.sigScript,
+				Sequence:         wire.MaxTxInSequenceNum,
+			}},
+			TxOut: []*wire.TxOut{{Value: 1000000000}},
+		}
+		vm, err := NewVersionedEngine(test.version, pkScript, tx, 0,
+			test.flags, nil, nil, -1)
+		if test.newErr != -1 {
+			if !IsErrorCode(err, test.newErr) {
+				t.Errorf("%s: NewVersionedEngine: got error %v, "+
+					"want %v", test.name, err, test.newErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: NewVersionedEngine: unexpected error: %v",
+				test.name, err)
+			continue
+		}
+		err = vm.Execute()
+		if test.execErr == -1 {
+			if err != nil {
+				t.Errorf("%s: Execute: unexpected error: %v",
+					test.name, err)
+			}
+			continue
+		}
+		if !IsErrorCode(err, test.execErr) {
+			t.Errorf("%s: Execute: got error %v, want %v", test.name,
+				err, test.execErr)
+		}
+	}
+}
+
 // TestCheckPubKeyEncoding ensures the internal checkPubKeyEncoding function
 // works as expected.
 func TestCheckPubKeyEncoding(t *testing.T) {
@@ -42,6 +42,9 @@ const (
 	// ErrTooMuchNullData is returned from NullDataScript when the length of
 	// the provided data exceeds MaxDataCarrierSize.
 	ErrTooMuchNullData
+	// ErrInvalidCommitmentSize is returned from BlockCommitmentScript when
+	// the length of the provided commitment is not BlockCommitmentSize.
+	ErrInvalidCommitmentSize
 	// ------------------------------------------
 	// Failures related to final execution state.
 	// ------------------------------------------
@@ -199,6 +202,11 @@ const (
 	// encountered in a script.
 	ErrDiscourageUpgradableNOPs
 
+	// ErrDiscourageUpgradableScriptVersion is returned when the
+	// ScriptDiscourageUpgradableScriptVersions flag is set and a public key
+	// script with a script version reserved for future upgrades is spent.
+	ErrDiscourageUpgradableScriptVersion
+
 	// ErrNegativeLockTime is returned when a script contains an opcode that
 	// interprets a negative lock time.
 	ErrNegativeLockTime
@@ -215,48 +223,50 @@ const (
 
 // Map of ErrorCode values back to their constant names for pretty printing.
 var errorCodeStrings = map[ErrorCode]string{
-	ErrInternal:                 "ErrInternal",
-	ErrInvalidFlags:             "ErrInvalidFlags",
-	ErrInvalidIndex:             "ErrInvalidIndex",
-	ErrUnsupportedAddress:       "ErrUnsupportedAddress",
-	ErrNotMultisigScript:        "ErrNotMultisigScript",
-	ErrTooManyRequiredSigs:      "ErrTooManyRequiredSigs",
-	ErrInvalidNumberOfKeyIds:    "ErrInvalidNumberOfKeyIds",
-	ErrTooMuchNullData:          "ErrTooMuchNullData",
-	ErrEarlyReturn:              "ErrEarlyReturn",
-	ErrEmptyStack:               "ErrEmptyStack",
-	ErrEvalFalse:                "ErrEvalFalse",
-	ErrScriptUnfinished:         "ErrScriptUnfinished",
-	ErrInvalidProgramCounter:    "ErrInvalidProgramCounter",
-	ErrScriptTooBig:             "ErrScriptTooBig",
-	ErrElementTooBig:            "ErrElementTooBig",
-	ErrTooManyOperations:        "ErrTooManyOperations",
-	ErrStackOverflow:            "ErrStackOverflow",
-	ErrInvalidPubKeyCount:       "ErrInvalidPubKeyCount",
-	ErrInvalidSignatureCount:    "ErrInvalidSignatureCount",
-	ErrNumberTooBig:             "ErrNumberTooBig",
-	ErrVerify:                   "ErrVerify",
-	ErrEqualVerify:              "ErrEqualVerify",
-	ErrNumEqualVerify:           "ErrNumEqualVerify",
-	ErrCheckSigVerify:           "ErrCheckSigVerify",
-	ErrCheckMultiSigVerify:      "ErrCheckMultiSigVerify",
-	ErrDisabledOpcode:           "ErrDisabledOpcode",
-	ErrReservedOpcode:           "ErrReservedOpcode",
-	ErrMalformedPush:            "ErrMalformedPush",
-	ErrInvalidStackOperation:    "ErrInvalidStackOperation",
-	ErrUnbalancedConditional:    "ErrUnbalancedConditional",
-	ErrMinimalData:              "ErrMinimalData",
-	ErrInvalidSigHashType:       "ErrInvalidSigHashType",
-	ErrSigDER:                   "ErrSigDER",
-	ErrSigHighS:                 "ErrSigHighS",
-	ErrNotPushOnly:              "ErrNotPushOnly",
-	ErrSigNullDummy:             "ErrSigNullDummy",
-	ErrPubKeyType:               "ErrPubKeyType",
-	ErrCleanStack:               "ErrCleanStack",
-	ErrNullFail:                 "ErrNullFail",
-	ErrDiscourageUpgradableNOPs: "ErrDiscourageUpgradableNOPs",
-	ErrNegativeLockTime:         "ErrNegativeLockTime",
-	ErrUnsatisfiedLockTime:      "ErrUnsatisfiedLockTime",
+	ErrInternal:                          "ErrInternal",
+	ErrInvalidFlags:                      "ErrInvalidFlags",
+	ErrInvalidIndex:                      "ErrInvalidIndex",
+	ErrUnsupportedAddress:                "ErrUnsupportedAddress",
+	ErrNotMultisigScript:                 "ErrNotMultisigScript",
+	ErrTooManyRequiredSigs:               "ErrTooManyRequiredSigs",
+	ErrInvalidNumberOfKeyIds:             "ErrInvalidNumberOfKeyIds",
+	ErrTooMuchNullData:                   "ErrTooMuchNullData",
+	ErrInvalidCommitmentSize:             "ErrInvalidCommitmentSize",
+	ErrEarlyReturn:                       "ErrEarlyReturn",
+	ErrEmptyStack:                        "ErrEmptyStack",
+	ErrEvalFalse:                         "ErrEvalFalse",
+	ErrScriptUnfinished:                  "ErrScriptUnfinished",
+	ErrInvalidProgramCounter:             "ErrInvalidProgramCounter",
+	ErrScriptTooBig:                      "ErrScriptTooBig",
+	ErrElementTooBig:                     "ErrElementTooBig",
+	ErrTooManyOperations:                 "ErrTooManyOperations",
+	ErrStackOverflow:                     "ErrStackOverflow",
+	ErrInvalidPubKeyCount:                "ErrInvalidPubKeyCount",
+	ErrInvalidSignatureCount:             "ErrInvalidSignatureCount",
+	ErrNumberTooBig:                      "ErrNumberTooBig",
+	ErrVerify:                            "ErrVerify",
+	ErrEqualVerify:                       "ErrEqualVerify",
+	ErrNumEqualVerify:                    "ErrNumEqualVerify",
+	ErrCheckSigVerify:                    "ErrCheckSigVerify",
+	ErrCheckMultiSigVerify:               "ErrCheckMultiSigVerify",
+	ErrDisabledOpcode:                    "ErrDisabledOpcode",
+	ErrReservedOpcode:                    "ErrReservedOpcode",
+	ErrMalformedPush:                     "ErrMalformedPush",
+	ErrInvalidStackOperation:             "ErrInvalidStackOperation",
+	ErrUnbalancedConditional:             "ErrUnbalancedConditional",
+	ErrMinimalData:                       "ErrMinimalData",
+	ErrInvalidSigHashType:                "ErrInvalidSigHashType",
+	ErrSigDER:                            "ErrSigDER",
+	ErrSigHighS:                          "ErrSigHighS",
+	ErrNotPushOnly:                       "ErrNotPushOnly",
+	ErrSigNullDummy:                      "ErrSigNullDummy",
+	ErrPubKeyType:                        "ErrPubKeyType",
+	ErrCleanStack:                        "ErrCleanStack",
+	ErrNullFail:                          "ErrNullFail",
+	ErrDiscourageUpgradableNOPs:          "ErrDiscourageUpgradableNOPs",
+	ErrDiscourageUpgradableScriptVersion: "ErrDiscourageUpgradableScriptVersion",
+	ErrNegativeLockTime:                  "ErrNegativeLockTime",
+	ErrUnsatisfiedLockTime:               "ErrUnsatisfiedLockTime",
 }
 
 // String returns the ErrorCode as a human-readable name.
@@ -269,10 +279,10 @@ func (e ErrorCode) String() string {
 
 // Error identifies a script-related error.  It is used to indicate three
 // classes of errors:
-// 1) Script execution failures due to violating one of the many requirements
-//    imposed by the script engine or evaluating to false
-// 2) Improper API usage by callers
-// 3) Internal consistency check failures
+//  1. Script execution failures due to violating one of the many requirements
+//     imposed by the script engine or evaluating to false
+//  2. Improper API usage by callers
+//  3. Internal consistency check failures
 //
 // The caller can use type assertions on the returned errors to access the
 // ErrorCode field to ascertain the specific reason for the error.  As an
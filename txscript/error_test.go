@@ -23,6 +23,7 @@ func TestErrorCodeStringer(t *testing.T) {
 		{ErrTooManyRequiredSigs, "ErrTooManyRequiredSigs"},
 		{ErrInvalidNumberOfKeyIds, "ErrInvalidNumberOfKeyIds"},
 		{ErrTooMuchNullData, "ErrTooMuchNullData"},
+		{ErrInvalidCommitmentSize, "ErrInvalidCommitmentSize"},
 		{ErrNotMultisigScript, "ErrNotMultisigScript"},
 		{ErrEarlyReturn, "ErrEarlyReturn"},
 		{ErrEmptyStack, "ErrEmptyStack"},
@@ -56,6 +57,7 @@ func TestErrorCodeStringer(t *testing.T) {
 		{ErrCleanStack, "ErrCleanStack"},
 		{ErrNullFail, "ErrNullFail"},
 		{ErrDiscourageUpgradableNOPs, "ErrDiscourageUpgradableNOPs"},
+		{ErrDiscourageUpgradableScriptVersion, "ErrDiscourageUpgradableScriptVersion"},
 		{ErrNegativeLockTime, "ErrNegativeLockTime"},
 		{ErrUnsatisfiedLockTime, "ErrUnsatisfiedLockTime"},
 		{0xffff, "Unknown ErrorCode (65535)"},
@@ -161,3 +161,35 @@ func TestSigHashNew(t *testing.T) {
 			expectedHash, hex.EncodeToString(sigHash))
 	}
 }
+
+// TestSigHashNewExpiry ensures the signature hash covers the expiry height of
+// the transactions of the version which carries one when they use the expiry
+// encoding, and ignores it otherwise, since it isn't serialized then.
+func TestSigHashNewExpiry(t *testing.T) {
+	tx := wire.NewMsgTx(wire.TxVersionExpiry)
+	tx.ExpiryEncoding = true
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{OP_TRUE}))
+
+	sigHash := func(expiry uint32) []byte {
+		tx.Expiry = expiry
+		return calcSignatureHashNew(nil, NewTxSigHashes(tx), SigHashAll,
+			tx, 0, 2000)
+	}
+	if bytes.Equal(sigHash(0), sigHash(100)) {
+		t.Fatalf("signature hash doesn't cover the expiry")
+	}
+
+	tx.Version = 1
+	if !bytes.Equal(sigHash(0), sigHash(100)) {
+		t.Fatalf("signature hash of version 1 transaction covers the " +
+			"expiry")
+	}
+
+	tx.Version = wire.TxVersionExpiry
+	tx.ExpiryEncoding = false
+	if !bytes.Equal(sigHash(0), sigHash(100)) {
+		t.Fatalf("signature hash covers the expiry of a transaction " +
+			"which doesn't use the expiry encoding")
+	}
+}
@@ -308,6 +308,12 @@ const (
 	AdminOpASPKeyRevoke       = 0x14 // 20
 )
 
+// AdminOpUpgradableThreshold is the lowest admin op type reserved for later
+// soft forks.  Admin ops with a type at or above it have no defined semantics
+// yet, so chains which enable upgradable admin ops accept them and leave the
+// admin state unchanged, while unknown types below it are always invalid.
+const AdminOpUpgradableThreshold = 0x80 // 128
+
 // Conditional execution constants.
 const (
 	OpCondFalse = 0
@@ -45,6 +45,18 @@ const (
 	MaxScriptElementSize  = 520 // Max bytes pushable to the stack.
 )
 
+// These are the script versions of public key scripts.
+const (
+	// DefaultScriptVersion is the script version of public key scripts
+	// which don't carry a version.
+	DefaultScriptVersion = 0
+
+	// MaxScriptVersion is the highest script version with defined
+	// semantics.  Public key scripts with a higher version are reserved
+	// for future soft-fork upgrades.
+	MaxScriptVersion = DefaultScriptVersion
+)
+
 // isSmallInt returns whether or not the opcode is considered a small integer,
 // which is an OP_0, or OP_1 through OP_16.
 func isSmallInt(op *opcode) bool {
@@ -102,6 +114,28 @@ func isPushOnly(pops []parsedOpcode) bool {
 	return true
 }
 
+// isVersionedScript returns true if the script passed carries a script version,
+// which is the case when it consists of a small integer from OP_1 through OP_16,
+// encoding the version, followed by a single direct push of 2 to 40 bytes of
+// data, false otherwise.
+func isVersionedScript(pops []parsedOpcode) bool {
+	return len(pops) == 2 &&
+		pops[0].opcode.value >= OP_1 && pops[0].opcode.value <= OP_16 &&
+		pops[1].opcode.value >= OP_DATA_2 &&
+		pops[1].opcode.value <= OP_DATA_40
+}
+
+// ScriptVersion returns the script version carried by the passed public key
+// script.  Scripts which don't carry a version, including those which don't
+// parse, have the DefaultScriptVersion.
+func ScriptVersion(pkScript []byte) uint16 {
+	pops, err := ParseScript(pkScript)
+	if err != nil || !isVersionedScript(pops) {
+		return DefaultScriptVersion
+	}
+	return uint16(asSmallInt(pops[0].opcode))
+}
+
 // IsPushOnlyScript returns whether or not the passed script only pushes data.
 //
 // False will be returned when the script does not parse.
@@ -420,12 +454,17 @@ func ExtractAdminOpData(pkScript []parsedOpcode) (bool, btcec.KeySetType, *btcec
 }
 
 // AdminOpString gives a human-readable version of an admin op script.
-// The function assumes previous validation as an actual valid admin op script.
+// The function assumes previous validation as an actual valid admin op script
+// or an admin op script reserved for later soft forks.
 func AdminOpString(buf []byte) string {
 	opcodes, err := ParseScript(buf)
 	if err != nil {
 		return ""
 	}
+	if IsUpgradableAdminOp(opcodes) {
+		return fmt.Sprintf("UNKNOWN_OP %d %s", opcodes[1].data[0],
+			hex.EncodeToString(opcodes[1].data[1:]))
+	}
 	isAddOp, keySetType, pubKey, keyID := ExtractAdminOpData(opcodes)
 	op := "REVOKE_KEY"
 	if isAddOp {
@@ -693,11 +732,16 @@ func calcSignatureHashNew(subScript []parsedOpcode, sigHashes *TxSigHashes,
 	// Next, add the  pre-generated hashoutputs sighash fragment.
 	sigHash.Write(sigHashes.HashOutputs[:])
 
-	// Finally, write out the transaction's locktime, and the sig hash
-	// type.
+	// Finally, write out the transaction's locktime, its expiry for the
+	// versions which carry one, and the sig hash type.
 	var bLockTime [4]byte
 	binary.LittleEndian.PutUint32(bLockTime[:], tx.LockTime)
 	sigHash.Write(bLockTime[:])
+	if tx.HasExpiry() {
+		var bExpiry [4]byte
+		binary.LittleEndian.PutUint32(bExpiry[:], tx.Expiry)
+		sigHash.Write(bExpiry[:])
+	}
 	var bHashType [4]byte
 	binary.LittleEndian.PutUint32(bHashType[:], uint32(hashType))
 	sigHash.Write(bHashType[:])
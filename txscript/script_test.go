@@ -4163,3 +4163,71 @@ func TestIsUnspendable(t *testing.T) {
 		}
 	}
 }
+
+// TestScriptVersion ensures the ScriptVersion function returns the expected
+// script versions.
+func TestScriptVersion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		pkScript []byte
+		expected uint16
+	}{
+		{
+			name:     "version 1 with 20 bytes",
+			pkScript: append([]byte{OP_1, OP_DATA_20}, make([]byte, 20)...),
+			expected: 1,
+		},
+		{
+			name:     "version 16 with 40 bytes",
+			pkScript: append([]byte{OP_16, OP_DATA_40}, make([]byte, 40)...),
+			expected: 16,
+		},
+		{
+			name:     "version 0 is not a versioned script",
+			pkScript: append([]byte{OP_0, OP_DATA_20}, make([]byte, 20)...),
+			expected: DefaultScriptVersion,
+		},
+		{
+			name:     "too little data",
+			pkScript: []byte{OP_1, OP_DATA_1, 0x01},
+			expected: DefaultScriptVersion,
+		},
+		{
+			name:     "too much data",
+			pkScript: append([]byte{OP_1, OP_DATA_41}, make([]byte, 41)...),
+			expected: DefaultScriptVersion,
+		},
+		{
+			name: "data not pushed directly",
+			pkScript: append([]byte{OP_1, OP_PUSHDATA1, 20},
+				make([]byte, 20)...),
+			expected: DefaultScriptVersion,
+		},
+		{
+			name: "trailing opcode",
+			pkScript: append(append([]byte{OP_1, OP_DATA_20},
+				make([]byte, 20)...), OP_CHECKSIG),
+			expected: DefaultScriptVersion,
+		},
+		{
+			name:     "does not parse",
+			pkScript: []byte{OP_1, OP_DATA_20, 0x01},
+			expected: DefaultScriptVersion,
+		},
+		{
+			name:     "empty",
+			pkScript: nil,
+			expected: DefaultScriptVersion,
+		},
+	}
+
+	for _, test := range tests {
+		version := ScriptVersion(test.pkScript)
+		if version != test.expected {
+			t.Errorf("ScriptVersion (%s): got %d, want %d",
+				test.name, version, test.expected)
+		}
+	}
+}
@@ -12,12 +12,29 @@ import (
 	"github.com/bitgo/prova/chaincfg/chainhash"
 )
 
-// sigCacheEntry represents an entry in the SigCache. Entries within the
-// SigCache are keyed according to the sigHash of the signature. In the
-// scenario of a cache-hit (according to the sigHash), an additional comparison
-// of the signature, and public key will be executed in order to ensure a complete
-// match. In the occasion that two sigHashes collide, the newer sigHash will
-// simply overwrite the existing entry.
+// sigCacheKey identifies an entry in the SigCache by the sigHash of the
+// signature along with the compressed public key it is verified under.  Keying
+// the entries by the public key as well keeps the signatures of different keys
+// over the same sigHash, such as the ones of a Prova multisig input, from
+// overwriting each other.
+type sigCacheKey struct {
+	sigHash chainhash.Hash
+	pubKey  [btcec.PubKeyBytesLenCompressed]byte
+}
+
+// newSigCacheKey returns the key of the entry for a signature over sigHash
+// under pubKey.
+func newSigCacheKey(sigHash *chainhash.Hash, pubKey *btcec.PublicKey) sigCacheKey {
+	key := sigCacheKey{sigHash: *sigHash}
+	copy(key.pubKey[:], pubKey.SerializeCompressed())
+	return key
+}
+
+// sigCacheEntry represents an entry in the SigCache. In the scenario of a
+// cache-hit (according to the sigHash and public key), an additional
+// comparison of the signature, and public key will be executed in order to
+// ensure a complete match. In the occasion that a key signs the same sigHash
+// more than once, the newer signature will simply overwrite the existing entry.
 type sigCacheEntry struct {
 	sig    *btcec.Signature
 	pubKey *btcec.PublicKey
@@ -35,7 +52,7 @@ type sigCacheEntry struct {
 // if they've already been seen and verified within the mempool.
 type SigCache struct {
 	sync.RWMutex
-	validSigs  map[chainhash.Hash]sigCacheEntry
+	validSigs  map[sigCacheKey]sigCacheEntry
 	maxEntries uint
 }
 
@@ -46,7 +63,7 @@ type SigCache struct {
 // cache to exceed the max.
 func NewSigCache(maxEntries uint) *SigCache {
 	return &SigCache{
-		validSigs:  make(map[chainhash.Hash]sigCacheEntry, maxEntries),
+		validSigs:  make(map[sigCacheKey]sigCacheEntry, maxEntries),
 		maxEntries: maxEntries,
 	}
 }
@@ -57,8 +74,9 @@ func NewSigCache(maxEntries uint) *SigCache {
 // NOTE: This function is safe for concurrent access. Readers won't be blocked
 // unless there exists a writer, adding an entry to the SigCache.
 func (s *SigCache) Exists(sigHash chainhash.Hash, sig *btcec.Signature, pubKey *btcec.PublicKey) bool {
+	key := newSigCacheKey(&sigHash, pubKey)
 	s.RLock()
-	entry, ok := s.validSigs[sigHash]
+	entry, ok := s.validSigs[key]
 	s.RUnlock()
 
 	return ok && entry.pubKey.IsEqual(pubKey) && entry.sig.IsEqual(sig)
@@ -72,6 +90,7 @@ func (s *SigCache) Exists(sigHash chainhash.Hash, sig *btcec.Signature, pubKey *
 // NOTE: This function is safe for concurrent access. Writers will block
 // simultaneous readers until function execution has concluded.
 func (s *SigCache) Add(sigHash chainhash.Hash, sig *btcec.Signature, pubKey *btcec.PublicKey) {
+	key := newSigCacheKey(&sigHash, pubKey)
 	s.Lock()
 	defer s.Unlock()
 
@@ -80,8 +99,10 @@ func (s *SigCache) Add(sigHash chainhash.Hash, sig *btcec.Signature, pubKey *btc
 	}
 
 	// If adding this new entry will put us over the max number of allowed
-	// entries, then evict an entry.
-	if uint(len(s.validSigs)+1) > s.maxEntries {
+	// entries, then evict an entry.  Replacing an existing entry doesn't
+	// add one.
+	_, exists := s.validSigs[key]
+	if !exists && uint(len(s.validSigs)+1) > s.maxEntries {
 		// Remove a random entry from the map. Relying on the random
 		// starting point of Go's map iteration. It's worth noting that
 		// the random iteration starting point is not 100% guaranteed
@@ -96,5 +117,5 @@ func (s *SigCache) Add(sigHash chainhash.Hash, sig *btcec.Signature, pubKey *btc
 			break
 		}
 	}
-	s.validSigs[sigHash] = sigCacheEntry{sig, pubKey}
+	s.validSigs[key] = sigCacheEntry{sig, pubKey}
 }
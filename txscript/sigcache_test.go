@@ -139,3 +139,45 @@ func TestSigCacheAddMaxEntriesZeroOrNegative(t *testing.T) {
 			"been added", len(sigCache.validSigs))
 	}
 }
+
+// TestSigCacheSameSigHash tests that the signatures of different public keys
+// over the same sigHash, such as the ones of a multisig input, are cached side
+// by side, and that a cached signature isn't found for another sigHash.
+func TestSigCacheSameSigHash(t *testing.T) {
+	sigCache := NewSigCache(200)
+
+	msg, sig1, key1, err := genRandomSig()
+	if err != nil {
+		t.Fatalf("unable to generate random signature test data")
+	}
+	privKey2, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate private key: %v", err)
+	}
+	sig2, err := privKey2.Sign(msg[:])
+	if err != nil {
+		t.Fatalf("unable to sign: %v", err)
+	}
+	key2 := privKey2.PubKey()
+
+	sigCache.Add(*msg, sig1, key1)
+	sigCache.Add(*msg, sig2, key2)
+	if !sigCache.Exists(*msg, sig1, key1) {
+		t.Errorf("signature of the first key not found in signature " +
+			"cache")
+	}
+	if !sigCache.Exists(*msg, sig2, key2) {
+		t.Errorf("signature of the second key not found in signature " +
+			"cache")
+	}
+	if sigCache.Exists(*msg, sig1, key2) {
+		t.Errorf("signature of the first key found for the second key")
+	}
+
+	otherMsg := *msg
+	otherMsg[0] ^= 0xff
+	if sigCache.Exists(otherMsg, sig1, key1) {
+		t.Errorf("signature found in signature cache for another " +
+			"sigHash")
+	}
+}
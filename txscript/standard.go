@@ -6,6 +6,7 @@
 package txscript
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/bitgo/prova/btcec"
@@ -19,6 +20,10 @@ const (
 	// data to be considered a nulldata transaction
 	MaxDataCarrierSize = 80
 
+	// BlockCommitmentSize is the number of bytes of data a block commitment
+	// output commits to.
+	BlockCommitmentSize = 32
+
 	// StandardVerifyFlags are the script flags which are used when
 	// executing transaction scripts to enforce additional checks which
 	// are required for the script to be considered standard.  These checks
@@ -39,7 +44,8 @@ const (
 		ScriptVerifyNullFail |
 		ScriptVerifyCheckLockTimeVerify |
 		ScriptVerifyCheckSequenceVerify |
-		ScriptVerifyLowS
+		ScriptVerifyLowS |
+		ScriptDiscourageUpgradableScriptVersions
 )
 
 // ScriptClass is an enumeration for the list of standard types of script.
@@ -164,8 +170,10 @@ func isProva(pops []parsedOpcode) bool {
 }
 
 // IsProvaTx determines if a transaction is a standard prova transaction
-// consisting of only outputs to standard prova scripts and 0-value nulldata
-// scripts.
+// consisting of only outputs to standard prova scripts, scripts which carry a
+// script version, and 0-value nulldata scripts.  Whether outputs which carry a
+// script version are allowed depends on the chain parameters and is left to
+// the caller.
 func IsProvaTx(tx *provautil.Tx) bool {
 	msgTx := tx.MsgTx()
 
@@ -190,7 +198,7 @@ func IsProvaTx(tx *provautil.Tx) bool {
 			if atoms != 0 {
 				return false
 			}
-		} else if !isGeneralProva(pops) {
+		} else if !isGeneralProva(pops) && !isVersionedScript(pops) {
 			return false
 		}
 	}
@@ -294,6 +302,28 @@ func IsValidAdminOp(pops []parsedOpcode, threadID provautil.ThreadID) bool {
 	return false
 }
 
+// IsUpgradableAdminOp returns true if the passed script is an admin operation
+// with an op type reserved for later soft forks, which is an OP_RETURN
+// followed by a data push of at most MaxDataCarrierSize bytes starting with an
+// op type at or above AdminOpUpgradableThreshold.  The data after the op type
+// is not interpreted.
+func IsUpgradableAdminOp(pops []parsedOpcode) bool {
+	if len(pops) != 2 {
+		return false
+	}
+	if pops[0].opcode.value != OP_RETURN {
+		return false
+	}
+	if pops[1].opcode.value > OP_PUSHDATA4 {
+		return false
+	}
+	data := pops[1].data
+	if len(data) == 0 || len(data) > MaxDataCarrierSize {
+		return false
+	}
+	return data[0] >= AdminOpUpgradableThreshold
+}
+
 // isNullData returns true if the passed script is a null data transaction,
 // false otherwise.
 func isNullData(pops []parsedOpcode) bool {
@@ -440,6 +470,58 @@ func NullDataScript(data []byte) ([]byte, error) {
 	return NewScriptBuilder().AddOp(OP_RETURN).AddData(data).Script()
 }
 
+// blockCommitmentPrefix is the marker which starts the pushed data of a null
+// data output in order to identify it as a block commitment.
+var blockCommitmentPrefix = []byte{'P', 'R', 'V', 'C'}
+
+// BlockCommitmentScript creates a null data script which anchors the passed
+// commitment in a block when it is included as an output of the coinbase
+// transaction.  The commitment is ignored by the consensus rules.  An Error
+// with the error code ErrInvalidCommitmentSize is returned if the commitment
+// is not BlockCommitmentSize bytes.
+func BlockCommitmentScript(commitment []byte) ([]byte, error) {
+	if len(commitment) != BlockCommitmentSize {
+		str := fmt.Sprintf("commitment size %d is not the required "+
+			"size %d", len(commitment), BlockCommitmentSize)
+		return nil, scriptError(ErrInvalidCommitmentSize, str)
+	}
+
+	data := make([]byte, 0, len(blockCommitmentPrefix)+BlockCommitmentSize)
+	data = append(data, blockCommitmentPrefix...)
+	data = append(data, commitment...)
+	return NullDataScript(data)
+}
+
+// ExtractBlockCommitment returns the commitment of the passed script when it
+// is a block commitment script.  It returns nil otherwise.
+func ExtractBlockCommitment(pkScript []byte) []byte {
+	pops, err := ParseScript(pkScript)
+	if err != nil || !isNullData(pops) || len(pops) != 2 {
+		return nil
+	}
+	data := pops[1].data
+	if len(data) != len(blockCommitmentPrefix)+BlockCommitmentSize ||
+		!bytes.HasPrefix(data, blockCommitmentPrefix) {
+
+		return nil
+	}
+	commitment := make([]byte, BlockCommitmentSize)
+	copy(commitment, data[len(blockCommitmentPrefix):])
+	return commitment
+}
+
+// ExtractBlockCommitmentMsgTx returns the commitment of the first block
+// commitment output of the passed transaction.  It returns nil when the
+// transaction does not have one.
+func ExtractBlockCommitmentMsgTx(msgTx *wire.MsgTx) []byte {
+	for _, txOut := range msgTx.TxOut {
+		if commitment := ExtractBlockCommitment(txOut.PkScript); commitment != nil {
+			return commitment
+		}
+	}
+	return nil
+}
+
 // MultiSigScript returns a valid script for a multisignature redemption where
 // nrequired of the keys in pubkeys are required to have signed the transaction
 // for success.  An ErrBadNumRequired will be returned if nrequired is larger
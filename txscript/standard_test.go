@@ -216,6 +216,77 @@ func TestIsValidAdminOp(t *testing.T) {
 	}
 }
 
+// TestIsUpgradableAdminOp ensures only admin ops with an op type reserved for
+// later soft forks are treated as upgradable.
+func TestIsUpgradableAdminOp(t *testing.T) {
+	pubKey := hexToBytes("02b4632d08485ff1df2db55b9dafd23347d1c47a457072a1e87" +
+		"be26896549a8737")
+	adminOpScript := func(op byte, payload []byte) []byte {
+		data := append([]byte{op}, payload...)
+		script, err := NewScriptBuilder().AddOp(OP_RETURN).AddData(data).
+			Script()
+		if err != nil {
+			t.Fatalf("unable to build admin op script: %v", err)
+		}
+		return script
+	}
+
+	tests := []struct {
+		name       string
+		script     []byte
+		upgradable bool
+	}{
+		{
+			name:       "known op",
+			script:     adminOpScript(AdminOpValidateKeyAdd, pubKey),
+			upgradable: false,
+		},
+		{
+			name:       "unknown op below threshold",
+			script:     adminOpScript(AdminOpUpgradableThreshold-1, pubKey),
+			upgradable: false,
+		},
+		{
+			name:       "op at threshold",
+			script:     adminOpScript(AdminOpUpgradableThreshold, pubKey),
+			upgradable: true,
+		},
+		{
+			name:       "highest op without payload",
+			script:     adminOpScript(0xff, nil),
+			upgradable: true,
+		},
+		{
+			name: "payload above max data carrier size",
+			script: adminOpScript(AdminOpUpgradableThreshold,
+				make([]byte, MaxDataCarrierSize)),
+			upgradable: false,
+		},
+		{
+			name:       "empty push",
+			script:     []byte{OP_RETURN, OP_0},
+			upgradable: false,
+		},
+		{
+			name:       "missing OP_RETURN",
+			script:     adminOpScript(AdminOpUpgradableThreshold, pubKey)[1:],
+			upgradable: false,
+		},
+	}
+	for _, test := range tests {
+		pops, err := ParseScript(test.script)
+		if err != nil {
+			t.Errorf("%s: unable to parse script: %v", test.name, err)
+			continue
+		}
+		upgradable := IsUpgradableAdminOp(pops)
+		if upgradable != test.upgradable {
+			t.Errorf("%s: got upgradable %v, want %v", test.name,
+				upgradable, test.upgradable)
+		}
+	}
+}
+
 // bogusAddress implements the provautil.Address interface so the tests can ensure
 // unsupported address types are handled properly.
 type bogusAddress struct{}
@@ -772,3 +843,67 @@ func TestNullDataScript(t *testing.T) {
 		}
 	}
 }
+
+// TestBlockCommitmentScript ensures block commitment scripts are standard null
+// data scripts and the commitment can be extracted from them again.
+func TestBlockCommitmentScript(t *testing.T) {
+	commitment := hexToBytes("000102030405060708090a0b0c0d0e0f101112131" +
+		"415161718191a1b1c1d1e1f")
+	script, err := BlockCommitmentScript(commitment)
+	if err != nil {
+		t.Fatalf("BlockCommitmentScript: unexpected error: %v", err)
+	}
+	expected := mustParseShortForm("RETURN 0x24 0x50525643000102030405" +
+		"060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	if !bytes.Equal(script, expected) {
+		t.Fatalf("BlockCommitmentScript: wrong result\ngot: %x\nwant: %x",
+			script, expected)
+	}
+	if class := GetScriptClass(script); class != NullDataTy {
+		t.Fatalf("GetScriptClass: got %v, want %v", class, NullDataTy)
+	}
+	if got := ExtractBlockCommitment(script); !bytes.Equal(got, commitment) {
+		t.Fatalf("ExtractBlockCommitment: got %x, want %x", got,
+			commitment)
+	}
+
+	// Commitments of the wrong size are rejected.
+	_, err = BlockCommitmentScript(commitment[1:])
+	if e := tstCheckScriptError(err, scriptError(ErrInvalidCommitmentSize,
+		"")); e != nil {
+
+		t.Fatalf("BlockCommitmentScript: %v", e)
+	}
+
+	// Null data scripts which are not commitments don't have one.
+	tests := []struct {
+		name   string
+		script []byte
+	}{
+		{"bare return", mustParseShortForm("RETURN")},
+		{"no prefix", mustParseShortForm("RETURN 0x24 0x5052564400010203" +
+			"0405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")},
+		{"short", mustParseShortForm("RETURN 0x23 0x50525643000102030405" +
+			"060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e")},
+		{"not null data", mustParseShortForm("0x24 0x50525643000102030405" +
+			"060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")},
+	}
+	for _, test := range tests {
+		if got := ExtractBlockCommitment(test.script); got != nil {
+			t.Errorf("ExtractBlockCommitment (%s): got %x, want nil",
+				test.name, got)
+		}
+	}
+
+	// The commitment is found among the outputs of a transaction.
+	tx := wire.NewMsgTx(1)
+	tx.AddTxOut(wire.NewTxOut(0, mustParseShortForm("RETURN")))
+	if got := ExtractBlockCommitmentMsgTx(tx); got != nil {
+		t.Fatalf("ExtractBlockCommitmentMsgTx: got %x, want nil", got)
+	}
+	tx.AddTxOut(wire.NewTxOut(0, script))
+	if got := ExtractBlockCommitmentMsgTx(tx); !bytes.Equal(got, commitment) {
+		t.Fatalf("ExtractBlockCommitmentMsgTx: got %x, want %x", got,
+			commitment)
+	}
+}
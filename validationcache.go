@@ -0,0 +1,41 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/blockchain"
+)
+
+// writeValidationCacheMetrics writes the number of blocks rejected with the
+// cached outcome of a previous validation, the number of blocks which were
+// validated instead, and the number of cached outcomes to the passed writer in
+// the Prometheus text exposition format.
+func writeValidationCacheMetrics(w io.Writer, stats blockchain.ValidationCacheStats) error {
+	var buf bytes.Buffer
+	buf.WriteString("# HELP prova_validation_cache_hits_total Number of " +
+		"blocks rejected with the cached outcome of a previous " +
+		"validation.\n")
+	buf.WriteString("# TYPE prova_validation_cache_hits_total counter\n")
+	fmt.Fprintf(&buf, "prova_validation_cache_hits_total %d\n", stats.Hits)
+
+	buf.WriteString("# HELP prova_validation_cache_misses_total Number of " +
+		"blocks without a cached validation outcome which were " +
+		"validated.\n")
+	buf.WriteString("# TYPE prova_validation_cache_misses_total counter\n")
+	fmt.Fprintf(&buf, "prova_validation_cache_misses_total %d\n",
+		stats.Misses)
+
+	buf.WriteString("# HELP prova_validation_cache_entries Number of " +
+		"validation outcomes in the cache.\n")
+	buf.WriteString("# TYPE prova_validation_cache_entries gauge\n")
+	fmt.Fprintf(&buf, "prova_validation_cache_entries %d\n", stats.Entries)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
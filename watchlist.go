@@ -0,0 +1,545 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// Statuses of watched spends.
+const (
+	watchedSpendMempool      = "mempool"
+	watchedSpendConnected    = "connected"
+	watchedSpendDisconnected = "disconnected"
+)
+
+const (
+	// watchlistAddrPrefix prefixes the keys of watched addresses in the
+	// watchlist bucket.  The encoded address follows.
+	watchlistAddrPrefix = 'a'
+
+	// watchlistKeyIDPrefix prefixes the keys of watched key IDs in the
+	// watchlist bucket.  The key ID follows as a big-endian uint32.
+	watchlistKeyIDPrefix = 'k'
+)
+
+var (
+	// watchlistBucketName is the name of the database bucket used to house
+	// the addresses and key IDs on the watchlist.
+	watchlistBucketName = []byte("watchlist")
+
+	// watchlistEntryValue is the value of all entries in the watchlist
+	// bucket.  The entries only consist of their keys, however the
+	// database treats nil values as removed.
+	watchlistEntryValue = []byte{0}
+
+	// errMalformedWatchlistEntry is returned when a persisted watchlist
+	// entry is malformed.
+	errMalformedWatchlistEntry = errors.New("malformed watchlist entry")
+)
+
+// errWatchlistAddress describes an error due to an address passed to the
+// watchlist which is not a valid Prova address for the network.
+type errWatchlistAddress string
+
+// Error implements the error interface.
+func (e errWatchlistAddress) Error() string {
+	return string(e)
+}
+
+// watchedSpend describes an input which spends an output paying to an address
+// or key ID on the watchlist.
+type watchedSpend struct {
+	txHash  *chainhash.Hash
+	vin     uint32
+	addr    string
+	keyID   btcec.KeyID
+	byKeyID bool
+	amount  int64
+}
+
+// result returns the JSON-RPC representation of the spend with the passed
+// status.  The block is nil for spends in the memory pool.
+func (ws *watchedSpend) result(status string, block *provautil.Block) *btcjson.WatchedSpendResult {
+	result := &btcjson.WatchedSpendResult{
+		Status:  status,
+		TxID:    ws.txHash.String(),
+		Vin:     ws.vin,
+		Address: ws.addr,
+		Amount:  provautil.Amount(ws.amount).ToRMG(),
+	}
+	if ws.byKeyID {
+		keyID := uint32(ws.keyID)
+		result.KeyID = &keyID
+	}
+	if block != nil {
+		result.BlockHash = block.Hash().String()
+		result.Height = block.Height()
+	}
+	return result
+}
+
+// keyIDSorter implements sort.Interface to allow a slice of key IDs to be
+// sorted in ascending order.
+type keyIDSorter []btcec.KeyID
+
+// Len returns the number of key IDs in the slice.  It is part of the
+// sort.Interface implementation.
+func (s keyIDSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the key IDs at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s keyIDSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the key ID with index i should sort before the key ID
+// with index j.  It is part of the sort.Interface implementation.
+func (s keyIDSorter) Less(i, j int) bool {
+	return s[i] < s[j]
+}
+
+// watchlist houses the addresses and key IDs whose outputs are flagged when
+// they are spent.  The entries are kept in maps so checking an output costs
+// the same regardless of the size of the watchlist, and are persisted in the
+// database so they survive restarts.
+type watchlist struct {
+	sync.RWMutex
+	db     database.DB
+	params *chaincfg.Params
+	addrs  map[string]struct{}
+	keyIDs map[btcec.KeyID]struct{}
+}
+
+// watchlistAddrKey returns the database key of the passed watched address.
+func watchlistAddrKey(addr string) []byte {
+	return append([]byte{watchlistAddrPrefix}, addr...)
+}
+
+// watchlistKeyIDKey returns the database key of the passed watched key ID.
+func watchlistKeyIDKey(keyID btcec.KeyID) []byte {
+	key := make([]byte, 5)
+	key[0] = watchlistKeyIDPrefix
+	binary.BigEndian.PutUint32(key[1:], uint32(keyID))
+	return key
+}
+
+// newWatchlist returns a watchlist backed by the passed database which accepts
+// addresses for the passed network.  The existing entries are loaded from the
+// database.
+func newWatchlist(db database.DB, params *chaincfg.Params, readOnly bool) (*watchlist, error) {
+	w := &watchlist{
+		db:     db,
+		params: params,
+		addrs:  make(map[string]struct{}),
+		keyIDs: make(map[btcec.KeyID]struct{}),
+	}
+	load := func(bucket database.Bucket) error {
+		return bucket.ForEach(func(k, v []byte) error {
+			switch {
+			case len(k) > 1 && k[0] == watchlistAddrPrefix:
+				w.addrs[string(k[1:])] = struct{}{}
+			case len(k) == 5 && k[0] == watchlistKeyIDPrefix:
+				keyID := btcec.KeyID(binary.BigEndian.Uint32(k[1:]))
+				w.keyIDs[keyID] = struct{}{}
+			default:
+				return errMalformedWatchlistEntry
+			}
+			return nil
+		})
+	}
+
+	var err error
+	if readOnly {
+		err = db.View(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(watchlistBucketName)
+			if bucket == nil {
+				return nil
+			}
+			return load(bucket)
+		})
+	} else {
+		err = db.Update(func(dbTx database.Tx) error {
+			bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+				watchlistBucketName)
+			if err != nil {
+				return err
+			}
+			return load(bucket)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// decodeAddrs returns the canonical encoding of the passed addresses.  An
+// error is returned if any of them is not a valid Prova address for the
+// network of the watchlist, which is a provautil.WrongNetworkError when the
+// address is valid for other networks.
+func (w *watchlist) decodeAddrs(addrs []string) ([]string, error) {
+	encoded := make([]string, 0, len(addrs))
+	for _, addrStr := range addrs {
+		addr, err := provautil.DecodeAddressForNet(addrStr, w.params)
+		if _, ok := err.(*provautil.WrongNetworkError); ok {
+			return nil, err
+		}
+		if err != nil {
+			str := fmt.Sprintf("invalid address %q: %v", addrStr, err)
+			return nil, errWatchlistAddress(str)
+		}
+		if _, ok := addr.(*provautil.AddressProva); !ok {
+			str := fmt.Sprintf("invalid address %q: not a Prova "+
+				"address", addrStr)
+			return nil, errWatchlistAddress(str)
+		}
+		encoded = append(encoded, addr.EncodeAddress())
+	}
+	return encoded, nil
+}
+
+// Add adds the passed addresses and key IDs to the watchlist and persists
+// them.  Entries which are already on the watchlist are ignored.  Nothing is
+// added when any of the addresses is invalid.
+//
+// This function is safe for concurrent access.
+func (w *watchlist) Add(addrs []string, keyIDs []btcec.KeyID) error {
+	encoded, err := w.decodeAddrs(addrs)
+	if err != nil {
+		return err
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	err = w.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(watchlistBucketName)
+		for _, addr := range encoded {
+			err := bucket.Put(watchlistAddrKey(addr),
+				watchlistEntryValue)
+			if err != nil {
+				return err
+			}
+		}
+		for _, keyID := range keyIDs {
+			err := bucket.Put(watchlistKeyIDKey(keyID),
+				watchlistEntryValue)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range encoded {
+		w.addrs[addr] = struct{}{}
+	}
+	for _, keyID := range keyIDs {
+		w.keyIDs[keyID] = struct{}{}
+	}
+	return nil
+}
+
+// Remove removes the passed addresses and key IDs from the watchlist and
+// persists the result.  It returns the number of entries which were removed.
+// Entries which are not on the watchlist are ignored.
+//
+// This function is safe for concurrent access.
+func (w *watchlist) Remove(addrs []string, keyIDs []btcec.KeyID) (int, error) {
+	encoded, err := w.decodeAddrs(addrs)
+	if err != nil {
+		return 0, err
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	var removedAddrs []string
+	var removedKeyIDs []btcec.KeyID
+	err = w.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(watchlistBucketName)
+		for _, addr := range encoded {
+			if _, ok := w.addrs[addr]; !ok {
+				continue
+			}
+			if err := bucket.Delete(watchlistAddrKey(addr)); err != nil {
+				return err
+			}
+			removedAddrs = append(removedAddrs, addr)
+		}
+		for _, keyID := range keyIDs {
+			if _, ok := w.keyIDs[keyID]; !ok {
+				continue
+			}
+			err := bucket.Delete(watchlistKeyIDKey(keyID))
+			if err != nil {
+				return err
+			}
+			removedKeyIDs = append(removedKeyIDs, keyID)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, addr := range removedAddrs {
+		delete(w.addrs, addr)
+	}
+	for _, keyID := range removedKeyIDs {
+		delete(w.keyIDs, keyID)
+	}
+	return len(removedAddrs) + len(removedKeyIDs), nil
+}
+
+// Entries returns the addresses and key IDs on the watchlist in sorted order.
+//
+// This function is safe for concurrent access.
+func (w *watchlist) Entries() ([]string, []btcec.KeyID) {
+	w.RLock()
+	addrs := make([]string, 0, len(w.addrs))
+	for addr := range w.addrs {
+		addrs = append(addrs, addr)
+	}
+	keyIDs := make([]btcec.KeyID, 0, len(w.keyIDs))
+	for keyID := range w.keyIDs {
+		keyIDs = append(keyIDs, keyID)
+	}
+	w.RUnlock()
+
+	sort.Strings(addrs)
+	sort.Sort(keyIDSorter(keyIDs))
+	return addrs, keyIDs
+}
+
+// Empty returns whether or not the watchlist has no entries.
+//
+// This function is safe for concurrent access.
+func (w *watchlist) Empty() bool {
+	w.RLock()
+	defer w.RUnlock()
+
+	return len(w.addrs) == 0 && len(w.keyIDs) == 0
+}
+
+// MatchTx returns the spends of the passed transaction of outputs which pay to
+// an address or key ID on the watchlist.  An input matching several entries
+// results in a spend for each of them.  The outputs spent by the transaction
+// are looked up with the passed function, which returns nil for outputs that
+// can't be found.  Inputs spending such outputs are skipped.
+//
+// This function is safe for concurrent access.
+func (w *watchlist) MatchTx(tx *provautil.Tx, fetchOutput func(op *wire.OutPoint) *wire.TxOut) []watchedSpend {
+	w.RLock()
+	defer w.RUnlock()
+
+	if len(w.addrs) == 0 && len(w.keyIDs) == 0 {
+		return nil
+	}
+
+	var spends []watchedSpend
+	for vin, txIn := range tx.MsgTx().TxIn {
+		txOut := fetchOutput(&txIn.PreviousOutPoint)
+		if txOut == nil {
+			continue
+		}
+
+		// Classify the script of the spent output to find the address
+		// and key IDs it pays to.
+		class, addrs, _, err := txscript.ExtractPkScriptAddrs(
+			txOut.PkScript, w.params)
+		if err != nil {
+			continue
+		}
+		var addr string
+		var keyIDs []btcec.KeyID
+		if len(addrs) != 0 {
+			addr = addrs[0].EncodeAddress()
+			if provaAddr, ok := addrs[0].(*provautil.AddressProva); ok {
+				keyIDs = provaAddr.ScriptKeyIDs()
+			}
+		} else if class == txscript.GeneralProvaTy {
+			pops, err := txscript.ParseScript(txOut.PkScript)
+			if err == nil {
+				keyIDs, _ = txscript.ExtractKeyIDs(pops)
+			}
+		}
+
+		spend := watchedSpend{
+			txHash: tx.Hash(),
+			vin:    uint32(vin),
+			addr:   addr,
+			amount: txOut.Value,
+		}
+		if _, ok := w.addrs[addr]; addr != "" && ok {
+			spends = append(spends, spend)
+		}
+		for _, keyID := range keyIDs {
+			if _, ok := w.keyIDs[keyID]; ok {
+				keyIDSpend := spend
+				keyIDSpend.keyID = keyID
+				keyIDSpend.byKeyID = true
+				spends = append(spends, keyIDSpend)
+			}
+		}
+	}
+	return spends
+}
+
+// MatchBlock returns the spends of the transactions of the passed block of
+// outputs which pay to an address or key ID on the watchlist.  When connected
+// is true, the block must be in the main chain of the passed chain and the
+// spent outputs are loaded from its spend journal.  Otherwise the block must
+// have just been disconnected, so the outputs it spent are unspent again.
+//
+// This function is safe for concurrent access.
+func (w *watchlist) MatchBlock(block *provautil.Block, chain *blockchain.BlockChain, connected bool) ([]watchedSpend, error) {
+	if w.Empty() {
+		return nil, nil
+	}
+
+	var fetchOutput func(op *wire.OutPoint) *wire.TxOut
+	if connected {
+		spent, err := chain.FetchSpentTxOuts(block)
+		if err != nil {
+			return nil, err
+		}
+		fetchOutput = func(op *wire.OutPoint) *wire.TxOut {
+			txOut, ok := spent[*op]
+			if !ok {
+				return nil
+			}
+			return &txOut
+		}
+	} else {
+		// Outputs created earlier in the same block were removed along
+		// with the block, so they are looked up in the block itself.
+		blockTxns := make(map[chainhash.Hash]*wire.MsgTx)
+		for _, tx := range block.Transactions() {
+			blockTxns[*tx.Hash()] = tx.MsgTx()
+		}
+		fetchOutput = func(op *wire.OutPoint) *wire.TxOut {
+			if msgTx, ok := blockTxns[op.Hash]; ok {
+				if op.Index >= uint32(len(msgTx.TxOut)) {
+					return nil
+				}
+				return msgTx.TxOut[op.Index]
+			}
+			return fetchUtxoOutput(chain, op)
+		}
+	}
+
+	var spends []watchedSpend
+	for _, tx := range block.Transactions()[1:] {
+		spends = append(spends, w.MatchTx(tx, fetchOutput)...)
+	}
+	return spends, nil
+}
+
+// fetchUtxoOutput returns the unspent output referenced by the passed outpoint
+// from the utxo set of the passed chain, or nil if there is no such output.
+func fetchUtxoOutput(chain *blockchain.BlockChain, op *wire.OutPoint) *wire.TxOut {
+	entry, err := chain.FetchUtxoEntry(&op.Hash)
+	if err != nil || entry == nil {
+		return nil
+	}
+	pkScript := entry.PkScriptByIndex(op.Index)
+	if pkScript == nil {
+		return nil
+	}
+	return &wire.TxOut{
+		Value:    entry.AmountByIndex(op.Index),
+		PkScript: pkScript,
+	}
+}
+
+// notifyWatchedSpends logs the passed spends with the passed status and
+// notifies websocket clients and webhook endpoints of them.  The block is nil
+// for spends in the memory pool.
+func (s *server) notifyWatchedSpends(spends []watchedSpend, status string, block *provautil.Block) {
+	for i := range spends {
+		spend := spends[i].result(status, block)
+		match := spend.Address
+		if spend.KeyID != nil {
+			match = fmt.Sprintf("key ID %d", *spend.KeyID)
+		}
+		srvrLog.Infof("Watched spend of %s (%s) by input %d of %s: %s",
+			match, provautil.Amount(spends[i].amount), spend.Vin,
+			spend.TxID, status)
+
+		if s.rpcServer != nil {
+			s.rpcServer.ntfnMgr.NotifyWatchedSpend(spend)
+		}
+		if s.webhookNotifier != nil {
+			s.webhookNotifier.NotifyWatchedSpend(spend, block)
+		}
+	}
+}
+
+// checkWatchedMempoolTx flags the spends of watched outputs by the passed
+// transaction which was just accepted into the memory pool.
+func (s *server) checkWatchedMempoolTx(tx *provautil.Tx) {
+	if s.watchlist == nil || s.watchlist.Empty() {
+		return
+	}
+
+	// The spent outputs are either created by transactions in the memory
+	// pool or unspent outputs of the main chain.
+	chain := s.blockManager.chain
+	spends := s.watchlist.MatchTx(tx, func(op *wire.OutPoint) *wire.TxOut {
+		parent, err := s.txMemPool.FetchTransaction(&op.Hash)
+		if err == nil {
+			txOuts := parent.MsgTx().TxOut
+			if op.Index >= uint32(len(txOuts)) {
+				return nil
+			}
+			return txOuts[op.Index]
+		}
+		return fetchUtxoOutput(chain, op)
+	})
+	s.notifyWatchedSpends(spends, watchedSpendMempool, nil)
+}
+
+// checkWatchedBlock flags the spends of watched outputs by the passed block,
+// which was just connected to or disconnected from the main chain of the
+// passed chain.  Spends of a disconnected block are flagged as reversed.
+func (s *server) checkWatchedBlock(block *provautil.Block, chain *blockchain.BlockChain, connected bool) {
+	if s.watchlist == nil {
+		return
+	}
+
+	spends, err := s.watchlist.MatchBlock(block, chain, connected)
+	if err != nil {
+		srvrLog.Errorf("Unable to check block %v against the watchlist: "+
+			"%v", block.Hash(), err)
+		return
+	}
+	status := watchedSpendConnected
+	if !connected {
+		status = watchedSpendDisconnected
+	}
+	s.notifyWatchedSpends(spends, status, block)
+}
@@ -0,0 +1,363 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// watchlistTestAddr returns a Prova address on the regression test network
+// which is unique to the passed number and pays to the passed key IDs.
+func watchlistTestAddr(t *testing.T, n uint32, keyIDs ...btcec.KeyID) *provautil.AddressProva {
+	pkHash := make([]byte, 20)
+	binary.LittleEndian.PutUint32(pkHash, n)
+	addr, err := provautil.NewAddressProva(pkHash, keyIDs,
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	return addr
+}
+
+// TestWatchlist ensures entries are added to and removed from a large
+// watchlist, persist across restarts, and are matched against the outputs
+// spent by a transaction.
+func TestWatchlist(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	tmpDir, err := ioutil.TempDir("", "watchlist")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		params.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+
+	w, err := newWatchlist(db, &params, false)
+	if err != nil {
+		t.Fatalf("newWatchlist: unexpected error: %v", err)
+	}
+	if !w.Empty() {
+		t.Fatal("new watchlist is not empty")
+	}
+
+	// Watch a large number of addresses along with some key IDs.
+	const numAddrs = 20000
+	addrs := make([]string, 0, numAddrs)
+	for i := uint32(0); i < numAddrs; i++ {
+		addrs = append(addrs, watchlistTestAddr(t, i, 1, 2).String())
+	}
+	if err := w.Add(addrs, []btcec.KeyID{7, 9}); err != nil {
+		t.Fatalf("Add: unexpected error: %v", err)
+	}
+
+	// Invalid addresses are rejected without adding anything.
+	err = w.Add([]string{watchlistTestAddr(t, numAddrs, 1, 2).String(),
+		"invalid"}, []btcec.KeyID{11})
+	if _, ok := err.(errWatchlistAddress); !ok {
+		t.Fatalf("Add: got error %v, want errWatchlistAddress", err)
+	}
+	mainNetAddr, err := provautil.NewAddressProva(make([]byte, 20),
+		[]btcec.KeyID{1, 2}, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	err = w.Add([]string{mainNetAddr.String()}, nil)
+	if _, ok := err.(*provautil.WrongNetworkError); !ok {
+		t.Fatalf("Add: got error %v, want WrongNetworkError", err)
+	}
+	if code := watchlistRPCError(err).Code; code != btcjson.ErrRPCWrongNetworkAddress {
+		t.Fatalf("watchlistRPCError: got code %v, want %v", code,
+			btcjson.ErrRPCWrongNetworkAddress)
+	}
+
+	// Removing entries reports the number which were on the watchlist.
+	removed, err := w.Remove(addrs[:2], []btcec.KeyID{9, 11})
+	if err != nil {
+		t.Fatalf("Remove: unexpected error: %v", err)
+	}
+	if removed != 3 {
+		t.Fatalf("Remove: got %d removed entries, want 3", removed)
+	}
+	wantAddrs, wantKeyIDs := w.Entries()
+	if len(wantAddrs) != numAddrs-2 ||
+		!reflect.DeepEqual(wantKeyIDs, []btcec.KeyID{7}) {
+
+		t.Fatalf("got %d addresses and key IDs %v, want %d addresses "+
+			"and key IDs [7]", len(wantAddrs), wantKeyIDs, numAddrs-2)
+	}
+
+	// The entries survive a restart, including in read-only mode.
+	for _, readOnly := range []bool{false, true} {
+		reloaded, err := newWatchlist(db, &params, readOnly)
+		if err != nil {
+			t.Fatalf("newWatchlist: unexpected error: %v", err)
+		}
+		gotAddrs, gotKeyIDs := reloaded.Entries()
+		if !reflect.DeepEqual(gotAddrs, wantAddrs) ||
+			!reflect.DeepEqual(gotKeyIDs, wantKeyIDs) {
+
+			t.Fatalf("read-only %v: reloaded entries differ",
+				readOnly)
+		}
+	}
+
+	// Spend outputs paying to a removed address, a watched address, an
+	// address with a watched key ID, and a watched address with a
+	// watched key ID.
+	spentAddrs := []*provautil.AddressProva{
+		watchlistTestAddr(t, 1, 1, 2),
+		watchlistTestAddr(t, 2, 1, 2),
+		watchlistTestAddr(t, numAddrs+1, 7, 2),
+		watchlistTestAddr(t, numAddrs+2, 1, 7),
+	}
+	if err := w.Add([]string{spentAddrs[3].String()}, nil); err != nil {
+		t.Fatalf("Add: unexpected error: %v", err)
+	}
+	outputs := make(map[wire.OutPoint]*wire.TxOut)
+	mtx := wire.NewMsgTx(1)
+	for i, addr := range spentAddrs {
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			t.Fatalf("unable to create pkScript: %v", err)
+		}
+		op := wire.OutPoint{Hash: chainhash.Hash{byte(i)}, Index: 1}
+		outputs[op] = wire.NewTxOut(int64(i+1)*1000, pkScript)
+		mtx.AddTxIn(wire.NewTxIn(&op, nil))
+	}
+	mtx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{9}}, nil))
+	tx := provautil.NewTx(mtx)
+	spends := w.MatchTx(tx, func(op *wire.OutPoint) *wire.TxOut {
+		return outputs[*op]
+	})
+	want := []watchedSpend{
+		{txHash: tx.Hash(), vin: 1, addr: spentAddrs[1].String(),
+			amount: 2000},
+		{txHash: tx.Hash(), vin: 2, addr: spentAddrs[2].String(),
+			keyID: 7, byKeyID: true, amount: 3000},
+		{txHash: tx.Hash(), vin: 3, addr: spentAddrs[3].String(),
+			amount: 4000},
+		{txHash: tx.Hash(), vin: 3, addr: spentAddrs[3].String(),
+			keyID: 7, byKeyID: true, amount: 4000},
+	}
+	if !reflect.DeepEqual(spends, want) {
+		t.Fatalf("MatchTx: got %+v, want %+v", spends, want)
+	}
+}
+
+// appendBlockTxns appends the passed transactions to the passed block generated
+// by the harness and signs and solves the block again.
+func appendBlockTxns(t *testing.T, h *testRPCHarness, msgBlock *wire.MsgBlock, txns ...*wire.MsgTx) {
+	for _, tx := range txns {
+		msgBlock.AddTransaction(tx)
+	}
+	merkles := blockchain.BuildMerkleTreeStore(
+		provautil.NewBlock(msgBlock).Transactions())
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+	msgBlock.Header.Size = uint32(msgBlock.SerializeSize())
+	err := msgBlock.Header.SignWith(h.signer.PubKey(), h.signer.SignHeader)
+	if err != nil {
+		t.Fatalf("unable to sign block: %v", err)
+	}
+	solveBlock(msgBlock)
+}
+
+// TestWatchedSpends ensures the spend of an output paying to a watched address
+// and key ID is flagged when it is accepted into the memory pool and when its
+// block is connected, and that disconnecting the block during a reorganization
+// flags the spend as reversed.
+func TestWatchedSpends(t *testing.T) {
+	h := newTestRPCHarness(t, nil)
+	defer h.teardown()
+	h.chain.DisableVerify(true)
+
+	// Generate a chain where the coinbase of the first block pays to the
+	// pay address of the harness and is mature at the tip, followed by a
+	// block which spends it and a longer competing chain without the
+	// spend.
+	h.mineBlockToPayAddr(t)
+	for i := 0; i < int(chaincfg.RegressionNetParams.CoinbaseMaturity); i++ {
+		h.mineBlock(t)
+	}
+	coinbase, err := h.chain.BlockByHeight(1)
+	if err != nil {
+		t.Fatalf("BlockByHeight: unexpected error: %v", err)
+	}
+	coinbaseOut := coinbase.MsgBlock().Transactions[0].TxOut[0]
+	pkScript, err := txscript.PayToAddrScript(watchlistTestAddr(t, 1, 1, 2))
+	if err != nil {
+		t.Fatalf("unable to create pkScript: %v", err)
+	}
+	spendTx := wire.NewMsgTx(1)
+	spendTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(
+		coinbase.Transactions()[0].Hash(), 0), nil))
+	spendTx.AddTxOut(wire.NewTxOut(coinbaseOut.Value, pkScript))
+	spendBlock := h.generateBlock(t)
+	appendBlockTxns(t, h, spendBlock, spendTx)
+	h.mineBlock(t)
+	h.mineBlock(t)
+	tipHeight := h.chain.BestSnapshot().Height
+
+	// Process the blocks into a chain which flags watched spends the same
+	// way the block manager does, delivering them to a webhook notifier
+	// which is not started so the events remain queued.
+	params := chaincfg.RegressionNetParams
+	tmpDir, err := ioutil.TempDir("", "watchedspends")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		params.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+	w, err := newWatchlist(db, &params, false)
+	if err != nil {
+		t.Fatalf("newWatchlist: unexpected error: %v", err)
+	}
+	err = w.Add([]string{h.payAddr.EncodeAddress()}, []btcec.KeyID{2})
+	if err != nil {
+		t.Fatalf("Add: unexpected error: %v", err)
+	}
+	s := &server{
+		chainParams:     &params,
+		db:              db,
+		watchlist:       w,
+		txMemPool:       mempool.New(&mempool.Config{}),
+		webhookNotifier: newWebhookNotifier([]string{"http://127.0.0.1"}, "secret", 10, ""),
+	}
+	var chain *blockchain.BlockChain
+	notifications := func(n *blockchain.Notification) {
+		block, ok := n.Data.(*provautil.Block)
+		if !ok {
+			return
+		}
+		switch n.Type {
+		case blockchain.NTBlockConnected:
+			s.checkWatchedBlock(block, chain, true)
+		case blockchain.NTBlockDisconnected:
+			s.checkWatchedBlock(block, chain, false)
+		}
+	}
+	chain, err = blockchain.New(&blockchain.Config{
+		DB:            db,
+		ChainParams:   &params,
+		TimeSource:    blockchain.NewMedianTime(),
+		Notifications: notifications,
+	})
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	chain.DisableVerify(true)
+	s.blockManager = &blockManager{chain: chain}
+	processBlock := func(msgBlock *wire.MsgBlock) {
+		_, _, err := chain.ProcessBlock(provautil.NewBlock(msgBlock),
+			blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+	}
+	var competing []*wire.MsgBlock
+	for height := uint32(1); height <= tipHeight; height++ {
+		block, err := h.chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockByHeight: unexpected error: %v", err)
+		}
+		if height <= tipHeight-2 {
+			processBlock(block.MsgBlock())
+		} else {
+			competing = append(competing, block.MsgBlock())
+		}
+	}
+
+	// checkEvents ensures the queued webhook events are the spend of the
+	// watched address followed by the spend of the watched key ID with the
+	// passed type, status, and block.
+	queue := s.webhookNotifier.endpoints[0].queue
+	spendHash := spendTx.TxHash()
+	checkEvents := func(eventType, status string, block *wire.MsgBlock) {
+		for _, keyID := range []*uint32{nil, btcjson.Uint32(2)} {
+			var d *webhookDelivery
+			select {
+			case d = <-queue:
+			default:
+				t.Fatalf("%s: missing webhook event", status)
+			}
+			var event webhookEvent
+			if err := json.Unmarshal(d.payload, &event); err != nil {
+				t.Fatalf("unable to decode event: %v", err)
+			}
+			want := btcjson.WatchedSpendResult{
+				Status:  status,
+				TxID:    spendHash.String(),
+				Address: h.payAddr.EncodeAddress(),
+				KeyID:   keyID,
+				Amount:  provautil.Amount(coinbaseOut.Value).ToRMG(),
+			}
+			var wantHash string
+			if block != nil {
+				wantHash = block.BlockHash().String()
+				want.BlockHash = wantHash
+				want.Height = block.Header.Height
+			}
+			if event.Type != eventType || event.Hash != wantHash ||
+				event.Spend == nil || !reflect.DeepEqual(*event.Spend,
+				want) {
+
+				t.Fatalf("%s: got event %s %+v, want %s %+v",
+					status, event.Type, event.Spend, eventType,
+					want)
+			}
+		}
+		if len(queue) != 0 {
+			t.Fatalf("%s: got %d unexpected webhook events", status,
+				len(queue))
+		}
+	}
+
+	// The spend is flagged when it is accepted into the memory pool.
+	if len(queue) != 0 {
+		t.Fatalf("got %d unexpected webhook events", len(queue))
+	}
+	s.checkWatchedMempoolTx(provautil.NewTx(spendTx))
+	checkEvents(webhookWatchedSpend, watchedSpendMempool, nil)
+
+	// The spend is flagged again when its block is connected.
+	processBlock(spendBlock)
+	checkEvents(webhookWatchedSpend, watchedSpendConnected, spendBlock)
+
+	// The spend is flagged as reversed when the competing chain becomes
+	// the main chain and its block is disconnected.
+	processBlock(competing[0])
+	if len(queue) != 0 {
+		t.Fatalf("side chain block: got %d unexpected webhook events",
+			len(queue))
+	}
+	processBlock(competing[1])
+	checkEvents(webhookWatchedSpendReversed, watchedSpendDisconnected,
+		spendBlock)
+}
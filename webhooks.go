@@ -0,0 +1,525 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+)
+
+const (
+	// webhookSignatureHeader is the HTTP header which carries the hex
+	// encoded HMAC-SHA256 of the payload, keyed with the webhook secret.
+	webhookSignatureHeader = "X-Prova-Signature"
+
+	// webhookEventHeader is the HTTP header which carries the type of the
+	// event in the payload.
+	webhookEventHeader = "X-Prova-Event"
+
+	// webhookMaxAttempts is the number of times delivery of an event to an
+	// endpoint is attempted before it is written to the dead-letter log.
+	webhookMaxAttempts = 5
+
+	// webhookRetryDelay is the delay before the first retry of a failed
+	// delivery.  It doubles with each further attempt up to
+	// webhookMaxRetryDelay.
+	webhookRetryDelay = time.Second
+
+	// webhookMaxRetryDelay is the maximum delay between delivery attempts.
+	webhookMaxRetryDelay = time.Minute
+
+	// webhookTimeout is the maximum amount of time a single delivery
+	// attempt may take.
+	webhookTimeout = time.Second * 10
+)
+
+// Webhook event types.
+const (
+	webhookBlockConnected       = "blockconnected"
+	webhookBlockDisconnected    = "blockdisconnected"
+	webhookAdminKeysChanged     = "adminkeyschanged"
+	webhookWatchedSpend         = "watchedspend"
+	webhookWatchedSpendReversed = "watchedspendreversed"
+	webhookChainSplit           = "chainsplit"
+	webhookThreadStuck          = "threadstuck"
+	webhookDoubleSign           = "doublesign"
+)
+
+// webhookAdminKeys describes the admin key sets of the best chain for
+// adminkeyschanged events.
+type webhookAdminKeys struct {
+	RootKeys      []string                 `json:"rootkeys"`
+	ProvisionKeys []string                 `json:"provisionkeys"`
+	IssueKeys     []string                 `json:"issuekeys"`
+	ValidateKeys  []string                 `json:"validatekeys"`
+	ASPKeys       []btcjson.ASPKeyIdResult `json:"aspkeys"`
+}
+
+// webhookEvent is the JSON payload which is delivered to webhook endpoints.
+// The block fields of watched spend events describe the block containing the
+// spend and are empty for spends in the memory pool.  The block fields of chain
+// split and stuck admin thread events describe the tip of the best chain, and
+// those of double sign events describe the block which revealed it.  Block
+// connected events list the admin operations of the block, if any.
+type webhookEvent struct {
+	ID         uint64                           `json:"id"`
+	Type       string                           `json:"type"`
+	Hash       string                           `json:"hash"`
+	Height     uint32                           `json:"height"`
+	Time       int64                            `json:"time"`
+	NumTx      int                              `json:"numtx"`
+	AdminKeys  *webhookAdminKeys                `json:"adminkeys,omitempty"`
+	Spend      *btcjson.WatchedSpendResult      `json:"spend,omitempty"`
+	ChainSplit *btcjson.GetChainSplitInfoResult `json:"chainsplit,omitempty"`
+	Thread     *btcjson.ThreadInfoResult        `json:"thread,omitempty"`
+	DoubleSign *btcjson.DoubleSignResult        `json:"doublesign,omitempty"`
+	AdminOps   []btcjson.AdminOpResult          `json:"adminops,omitempty"`
+	TxFees     []btcjson.TxFeeResult            `json:"txfees,omitempty"`
+}
+
+// webhookDelivery is a signed payload waiting to be delivered to an endpoint.
+type webhookDelivery struct {
+	eventType string
+	payload   []byte
+	signature string
+}
+
+// webhookDeadLetter is an entry of the dead-letter log which records a
+// payload that could not be delivered.
+type webhookDeadLetter struct {
+	Endpoint string          `json:"endpoint"`
+	Reason   string          `json:"reason"`
+	Time     int64           `json:"time"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// webhookEndpoint houses the delivery queue of a single endpoint so a slow or
+// unreachable endpoint does not hold up delivery to the others.
+type webhookEndpoint struct {
+	url   string
+	queue chan *webhookDelivery
+}
+
+// webhookNotifier delivers block connected, block disconnected, admin key
+// change, watched spend, chain split, stuck admin thread, and double sign
+// events to HTTP endpoints as signed JSON payloads.  Events are queued without
+// blocking, so a slow endpoint can never stall block processing, and delivered
+// in order to each endpoint by a dedicated goroutine.  Failed deliveries are retried with
+// exponential backoff and payloads which can't be delivered, including those
+// dropped because a queue is full, are written to the dead-letter log.
+type webhookNotifier struct {
+	started  int32
+	shutdown int32
+	nextID   uint64 // atomic
+
+	endpoints     []*webhookEndpoint
+	secret        []byte
+	client        *http.Client
+	maxAttempts   int
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+
+	deadLetterLock sync.Mutex
+	deadLetterPath string
+	deadLetter     io.Writer
+
+	// ctx is canceled when the notifier is stopped in order to abort
+	// deliveries which are in progress.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the passed payload keyed with
+// the webhook secret.
+func (n *webhookNotifier) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, n.secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// writeDeadLetter records the passed delivery as undeliverable to the passed
+// endpoint.
+//
+// This function is safe for concurrent access.
+func (n *webhookNotifier) writeDeadLetter(endpoint string, d *webhookDelivery, reason string) {
+	hookLog.Errorf("Unable to deliver %s webhook to %s: %s", d.eventType,
+		endpoint, reason)
+
+	entry, err := json.Marshal(&webhookDeadLetter{
+		Endpoint: endpoint,
+		Reason:   reason,
+		Time:     time.Now().Unix(),
+		Payload:  d.payload,
+	})
+	if err != nil {
+		hookLog.Errorf("Unable to encode dead-letter entry: %v", err)
+		return
+	}
+
+	n.deadLetterLock.Lock()
+	defer n.deadLetterLock.Unlock()
+
+	// Open the dead-letter log the first time it is needed.
+	if n.deadLetter == nil {
+		if n.deadLetterPath == "" {
+			return
+		}
+		f, err := os.OpenFile(n.deadLetterPath,
+			os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			hookLog.Errorf("Unable to open webhook dead-letter log: %v",
+				err)
+			return
+		}
+		n.deadLetter = f
+	}
+	if _, err := n.deadLetter.Write(append(entry, '\n')); err != nil {
+		hookLog.Errorf("Unable to write webhook dead-letter log: %v",
+			err)
+	}
+}
+
+// queueEvent signs the passed event and adds it to the queue of each endpoint.
+// Events for endpoints whose queue is full are written to the dead-letter log
+// instead.
+func (n *webhookNotifier) queueEvent(event *webhookEvent) {
+	if len(n.endpoints) == 0 || atomic.LoadInt32(&n.shutdown) != 0 {
+		return
+	}
+
+	event.ID = atomic.AddUint64(&n.nextID, 1)
+	payload, err := json.Marshal(event)
+	if err != nil {
+		hookLog.Errorf("Unable to encode %s webhook: %v", event.Type, err)
+		return
+	}
+	d := &webhookDelivery{
+		eventType: event.Type,
+		payload:   payload,
+		signature: n.sign(payload),
+	}
+	for _, endpoint := range n.endpoints {
+		select {
+		case endpoint.queue <- d:
+		default:
+			n.writeDeadLetter(endpoint.url, d, "delivery queue is full")
+		}
+	}
+}
+
+// NotifyBlockConnected queues block connected events for the passed block,
+// which list the admin operations of the block and the fees paid by its
+// transactions, along with an admin key change event when the block changes the
+// admin keys.  It must only be called once the block is committed to the main
+// chain and before any other block is.
+func (n *webhookNotifier) NotifyBlockConnected(block *provautil.Block, chain *blockchain.BlockChain) {
+	if len(n.endpoints) == 0 {
+		return
+	}
+	event := newWebhookBlockEvent(webhookBlockConnected, block)
+	event.AdminOps = adminOpResults(chain.BestBlockAdminOps(block))
+	fees, err := chain.BlockTxFees(block)
+	if err != nil {
+		hookLog.Errorf("Unable to obtain the transaction fees of block "+
+			"%v for webhook event: %v", block.Hash(), err)
+	} else {
+		event.TxFees = txFeeResults(block, fees)
+	}
+	n.queueEvent(event)
+	if changesAdminKeys(block) {
+		n.queueEvent(newWebhookAdminKeysEvent(block, chain))
+	}
+}
+
+// NotifyBlockDisconnected queues block disconnected events for the passed
+// block, along with an admin key change event when the block changed the admin
+// keys.  It must only be called once the block is removed from the main chain.
+func (n *webhookNotifier) NotifyBlockDisconnected(block *provautil.Block, chain *blockchain.BlockChain) {
+	n.queueEvent(newWebhookBlockEvent(webhookBlockDisconnected, block))
+	if changesAdminKeys(block) {
+		n.queueEvent(newWebhookAdminKeysEvent(block, chain))
+	}
+}
+
+// NotifyWatchedSpend queues a watched spend event for the passed spend of an
+// output paying to an address or key ID on the watchlist.  Spends which were
+// reversed by disconnecting their block are queued as watched spend reversed
+// events.  The block is nil for spends in the memory pool.
+func (n *webhookNotifier) NotifyWatchedSpend(spend *btcjson.WatchedSpendResult, block *provautil.Block) {
+	eventType := webhookWatchedSpend
+	if spend.Status == watchedSpendDisconnected {
+		eventType = webhookWatchedSpendReversed
+	}
+
+	var event *webhookEvent
+	if block != nil {
+		event = newWebhookBlockEvent(eventType, block)
+	} else {
+		event = &webhookEvent{Type: eventType, Time: time.Now().Unix()}
+	}
+	event.Spend = spend
+	n.queueEvent(event)
+}
+
+// NotifyChainSplit queues a chain split event for the passed summary of the
+// tips the peers are on.
+func (n *webhookNotifier) NotifyChainSplit(info *btcjson.GetChainSplitInfoResult) {
+	n.queueEvent(&webhookEvent{
+		Type:       webhookChainSplit,
+		Hash:       info.Hash,
+		Height:     info.Height,
+		Time:       time.Now().Unix(),
+		ChainSplit: info,
+	})
+}
+
+// NotifyThreadStuck queues a stuck admin thread event for the passed admin
+// thread as of the best block with the passed hash and height.
+func (n *webhookNotifier) NotifyThreadStuck(thread *btcjson.ThreadInfoResult, hash string, height uint32) {
+	n.queueEvent(&webhookEvent{
+		Type:   webhookThreadStuck,
+		Hash:   hash,
+		Height: height,
+		Time:   time.Now().Unix(),
+		Thread: thread,
+	})
+}
+
+// NotifyDoubleSign queues a double sign event for the passed evidence of a
+// validate key which signed two different blocks at the same height.
+func (n *webhookNotifier) NotifyDoubleSign(ds *btcjson.DoubleSignResult) {
+	n.queueEvent(&webhookEvent{
+		Type:       webhookDoubleSign,
+		Hash:       ds.SecondHash,
+		Height:     ds.Height,
+		Time:       time.Now().Unix(),
+		DoubleSign: ds,
+	})
+}
+
+// post makes a single attempt to deliver the passed payload to the passed
+// endpoint.
+func (n *webhookNotifier) post(url string, d *webhookDelivery) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(d.payload))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(n.ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, d.eventType)
+	req.Header.Set(webhookSignatureHeader, d.signature)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint responded with status %s",
+			resp.Status)
+	}
+	return nil
+}
+
+// deliver attempts to deliver the passed payload to the passed endpoint,
+// retrying with exponential backoff.  It returns false if the notifier is
+// shutting down before the delivery completes.
+func (n *webhookNotifier) deliver(url string, d *webhookDelivery) bool {
+	delay := n.retryDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = n.post(url, d)
+		if err == nil {
+			return true
+		}
+		if attempt >= n.maxAttempts {
+			break
+		}
+
+		hookLog.Debugf("Delivery attempt %d of %s webhook to %s failed: "+
+			"%v", attempt, d.eventType, url, err)
+		select {
+		case <-time.After(delay):
+		case <-n.quit:
+			n.writeDeadLetter(url, d, "shutting down")
+			return false
+		}
+		delay *= 2
+		if delay > n.maxRetryDelay {
+			delay = n.maxRetryDelay
+		}
+	}
+
+	n.writeDeadLetter(url, d, fmt.Sprintf("giving up after %d attempts: "+
+		"%v", n.maxAttempts, err))
+	return true
+}
+
+// deliveryHandler delivers the queued payloads of the passed endpoint until
+// the notifier is stopped.  Payloads which are still queued at that point are
+// written to the dead-letter log.  It must be run as a goroutine.
+func (n *webhookNotifier) deliveryHandler(endpoint *webhookEndpoint) {
+out:
+	for {
+		select {
+		case d := <-endpoint.queue:
+			if !n.deliver(endpoint.url, d) {
+				break out
+			}
+
+		case <-n.quit:
+			break out
+		}
+	}
+
+	// Drain the queue so nothing that was accepted is silently lost.
+cleanup:
+	for {
+		select {
+		case d := <-endpoint.queue:
+			n.writeDeadLetter(endpoint.url, d, "shutting down")
+		default:
+			break cleanup
+		}
+	}
+
+	n.wg.Done()
+	hookLog.Tracef("Webhook delivery handler for %s done", endpoint.url)
+}
+
+// Start begins delivering events to the configured endpoints.
+func (n *webhookNotifier) Start() {
+	// Already started?
+	if atomic.AddInt32(&n.started, 1) != 1 {
+		return
+	}
+
+	hookLog.Trace("Starting webhook notifier")
+	for _, endpoint := range n.endpoints {
+		n.wg.Add(1)
+		go n.deliveryHandler(endpoint)
+	}
+}
+
+// Stop gracefully shuts down the webhook notifier and waits for the delivery
+// handlers to finish.
+func (n *webhookNotifier) Stop() {
+	if atomic.AddInt32(&n.shutdown, 1) != 1 {
+		return
+	}
+
+	close(n.quit)
+	n.cancel()
+	n.wg.Wait()
+
+	n.deadLetterLock.Lock()
+	if c, ok := n.deadLetter.(io.Closer); ok {
+		c.Close()
+	}
+	n.deadLetter = nil
+	n.deadLetterLock.Unlock()
+}
+
+// changesAdminKeys returns whether or not the passed block contains an admin
+// transaction which modifies the admin keys.  Transactions on the issue thread
+// only change the supply, so they are not included.
+func changesAdminKeys(block *provautil.Block) bool {
+	for _, tx := range block.Transactions() {
+		threadID, _ := txscript.GetAdminDetails(tx)
+		if threadID == int(provautil.RootThread) ||
+			threadID == int(provautil.ProvisionThread) {
+
+			return true
+		}
+	}
+	return false
+}
+
+// newWebhookBlockEvent returns an event of the passed type for the passed
+// block.
+func newWebhookBlockEvent(eventType string, block *provautil.Block) *webhookEvent {
+	header := &block.MsgBlock().Header
+	return &webhookEvent{
+		Type:   eventType,
+		Hash:   block.Hash().String(),
+		Height: header.Height,
+		Time:   header.Timestamp.Unix(),
+		NumTx:  len(block.Transactions()),
+	}
+}
+
+// newWebhookAdminKeysEvent returns an admin key change event for the passed
+// block which describes the admin keys of the best chain of the passed chain.
+func newWebhookAdminKeysEvent(block *provautil.Block, chain *blockchain.BlockChain) *webhookEvent {
+	adminKeySets := chain.AdminKeySets()
+	aspKeyIdMap := chain.KeyIDs()
+	aspKeys := make([]btcjson.ASPKeyIdResult, 0, len(aspKeyIdMap))
+	for keyID, pubKey := range aspKeyIdMap {
+		aspKeys = append(aspKeys, btcjson.ASPKeyIdResult{
+			KeyID:  uint32(keyID),
+			PubKey: hex.EncodeToString(pubKey.SerializeCompressed()),
+		})
+	}
+
+	event := newWebhookBlockEvent(webhookAdminKeysChanged, block)
+	event.AdminKeys = &webhookAdminKeys{
+		RootKeys:      adminKeySets[btcec.RootKeySet].ToStringArray(),
+		ProvisionKeys: adminKeySets[btcec.ProvisionKeySet].ToStringArray(),
+		IssueKeys:     adminKeySets[btcec.IssueKeySet].ToStringArray(),
+		ValidateKeys:  adminKeySets[btcec.ValidateKeySet].ToStringArray(),
+		ASPKeys:       aspKeys,
+	}
+	return event
+}
+
+// newWebhookNotifier returns a new webhook notifier which delivers events to
+// the passed endpoints, signing them with the passed secret.  Each endpoint
+// queues at most queueSize events and undeliverable events are appended to
+// the dead-letter log at the passed path.
+func newWebhookNotifier(endpoints []string, secret string, queueSize int,
+	deadLetterPath string) *webhookNotifier {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &webhookNotifier{
+		secret:         []byte(secret),
+		client:         &http.Client{Timeout: webhookTimeout},
+		maxAttempts:    webhookMaxAttempts,
+		retryDelay:     webhookRetryDelay,
+		maxRetryDelay:  webhookMaxRetryDelay,
+		deadLetterPath: deadLetterPath,
+		ctx:            ctx,
+		cancel:         cancel,
+		quit:           make(chan struct{}),
+	}
+	for _, url := range endpoints {
+		n.endpoints = append(n.endpoints, &webhookEndpoint{
+			url:   url,
+			queue: make(chan *webhookDelivery, queueSize),
+		})
+	}
+	return n
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+)
+
+// webhookRecorder is a test webhook endpoint which records the payloads it
+// receives and fails the first configured number of requests.
+type webhookRecorder struct {
+	sync.Mutex
+	failures  int
+	requests  int
+	payloads  [][]byte
+	headers   []http.Header
+	delivered chan struct{}
+}
+
+// ServeHTTP records the request and responds with an error until the
+// configured number of failures is reached.
+func (r *webhookRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	payload, _ := ioutil.ReadAll(req.Body)
+
+	r.Lock()
+	r.requests++
+	if r.requests <= r.failures {
+		r.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	r.payloads = append(r.payloads, payload)
+	r.headers = append(r.headers, req.Header)
+	r.Unlock()
+	r.delivered <- struct{}{}
+}
+
+// waitDelivered waits for the passed number of payloads to be delivered to the
+// recorder.
+func (r *webhookRecorder) waitDelivered(t *testing.T, count int) {
+	for i := 0; i < count; i++ {
+		select {
+		case <-r.delivered:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timeout waiting for webhook delivery %d", i+1)
+		}
+	}
+}
+
+// syncBuffer is a bytes.Buffer which is safe for concurrent access.
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write appends the passed data to the buffer.
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+// deadLetters returns the decoded dead-letter log entries written so far.
+func (b *syncBuffer) deadLetters(t *testing.T) []webhookDeadLetter {
+	b.Lock()
+	defer b.Unlock()
+	var entries []webhookDeadLetter
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry webhookDeadLetter
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("unable to decode dead-letter entry %q: %v", line,
+				err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// newTestWebhookNotifier returns a webhook notifier for the passed endpoint
+// which retries quickly and writes its dead-letter log to the returned buffer.
+func newTestWebhookNotifier(url string, queueSize int) (*webhookNotifier, *syncBuffer) {
+	n := newWebhookNotifier([]string{url}, "secret", queueSize, "")
+	n.retryDelay = time.Millisecond
+	n.maxRetryDelay = time.Millisecond * 4
+	deadLetter := &syncBuffer{}
+	n.deadLetter = deadLetter
+	return n, deadLetter
+}
+
+// TestWebhookSigning ensures delivered payloads describe the block and carry a
+// valid signature of the payload.
+func TestWebhookSigning(t *testing.T) {
+	recorder := &webhookRecorder{delivered: make(chan struct{}, 10)}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	n, deadLetter := newTestWebhookNotifier(server.URL, 10)
+	n.Start()
+	defer n.Stop()
+
+	block := provautil.NewBlock(chaincfg.RegressionNetParams.GenesisBlock)
+	n.queueEvent(newWebhookBlockEvent(webhookBlockConnected, block))
+	recorder.waitDelivered(t, 1)
+
+	recorder.Lock()
+	payload, header := recorder.payloads[0], recorder.headers[0]
+	recorder.Unlock()
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(payload)
+	wantSig := hex.EncodeToString(mac.Sum(nil))
+	if sig := header.Get(webhookSignatureHeader); sig != wantSig {
+		t.Fatalf("signature: got %q, want %q", sig, wantSig)
+	}
+	if typ := header.Get(webhookEventHeader); typ != webhookBlockConnected {
+		t.Fatalf("event header: got %q, want %q", typ,
+			webhookBlockConnected)
+	}
+
+	var event webhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		t.Fatalf("unable to decode payload: %v", err)
+	}
+	if event.Type != webhookBlockConnected || event.ID != 1 ||
+		event.Hash != block.Hash().String() || event.Height != 0 ||
+		event.NumTx != 1 {
+
+		t.Fatalf("unexpected payload: %s", payload)
+	}
+	if entries := deadLetter.deadLetters(t); len(entries) != 0 {
+		t.Fatalf("unexpected dead-letter entries: %v", entries)
+	}
+}
+
+// TestWebhookRetries ensures failed deliveries are retried until they succeed
+// and are written to the dead-letter log once all attempts fail.
+func TestWebhookRetries(t *testing.T) {
+	recorder := &webhookRecorder{
+		failures:  webhookMaxAttempts - 1,
+		delivered: make(chan struct{}, 10),
+	}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	n, deadLetter := newTestWebhookNotifier(server.URL, 10)
+	n.Start()
+	defer n.Stop()
+
+	// The delivery succeeds with the final attempt.
+	block := provautil.NewBlock(chaincfg.RegressionNetParams.GenesisBlock)
+	n.queueEvent(newWebhookBlockEvent(webhookBlockConnected, block))
+	recorder.waitDelivered(t, 1)
+	recorder.Lock()
+	requests := recorder.requests
+	recorder.Unlock()
+	if requests != webhookMaxAttempts {
+		t.Fatalf("requests: got %d, want %d", requests,
+			webhookMaxAttempts)
+	}
+
+	// Fail every attempt of the next delivery and ensure it is written to
+	// the dead-letter log followed by delivery of the next event.
+	recorder.Lock()
+	recorder.failures = recorder.requests + webhookMaxAttempts
+	recorder.Unlock()
+	n.queueEvent(newWebhookBlockEvent(webhookBlockDisconnected, block))
+	n.queueEvent(newWebhookBlockEvent(webhookBlockConnected, block))
+	recorder.waitDelivered(t, 1)
+
+	entries := deadLetter.deadLetters(t)
+	if len(entries) != 1 {
+		t.Fatalf("dead-letter entries: got %d, want 1", len(entries))
+	}
+	if entries[0].Endpoint != server.URL {
+		t.Fatalf("dead-letter endpoint: got %q, want %q",
+			entries[0].Endpoint, server.URL)
+	}
+	var event webhookEvent
+	if err := json.Unmarshal(entries[0].Payload, &event); err != nil {
+		t.Fatalf("unable to decode dead-letter payload: %v", err)
+	}
+	if event.Type != webhookBlockDisconnected {
+		t.Fatalf("dead-letter event: got %q, want %q", event.Type,
+			webhookBlockDisconnected)
+	}
+}
+
+// TestWebhookQueueOverflow ensures queueing events never blocks when the
+// endpoint is stalled and events beyond the queue size are written to the
+// dead-letter log.
+func TestWebhookQueueOverflow(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			<-release
+		}))
+	defer server.Close()
+	defer close(release)
+
+	// Don't start the notifier so nothing is taken off the queue.
+	const queueSize = 3
+	n, deadLetter := newTestWebhookNotifier(server.URL, queueSize)
+
+	block := provautil.NewBlock(chaincfg.RegressionNetParams.GenesisBlock)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < queueSize+2; i++ {
+			n.queueEvent(newWebhookBlockEvent(webhookBlockConnected,
+				block))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("queueing events blocked")
+	}
+
+	entries := deadLetter.deadLetters(t)
+	if len(entries) != 2 {
+		t.Fatalf("dead-letter entries: got %d, want 2", len(entries))
+	}
+	for i, entry := range entries {
+		var event webhookEvent
+		if err := json.Unmarshal(entry.Payload, &event); err != nil {
+			t.Fatalf("unable to decode dead-letter payload: %v", err)
+		}
+		if wantID := uint64(queueSize + i + 1); event.ID != wantID {
+			t.Fatalf("dead-letter event id: got %d, want %d",
+				event.ID, wantID)
+		}
+	}
+
+	// Stopping the notifier writes the events still queued to the
+	// dead-letter log.
+	n.Start()
+	n.Stop()
+	entries = deadLetter.deadLetters(t)
+	if len(entries) != queueSize+2 {
+		t.Fatalf("dead-letter entries after stop: got %d, want %d",
+			len(entries), queueSize+2)
+	}
+}
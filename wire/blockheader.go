@@ -146,8 +146,16 @@ func (h *BlockHeader) hashForSigning() []byte {
 // Sign uses the supplied private key to sign the signing-hash of the block
 // header, and sets it in the Signature field.
 func (h *BlockHeader) Sign(key *btcec.PrivateKey) error {
+	return h.SignWith(key.PubKey(), key.Sign)
+}
+
+// SignWith uses the supplied function to sign the signing-hash of the block
+// header with the private key of the supplied public key, and sets it in the
+// Signature field.  It allows the private key to be held elsewhere, such as in
+// a hardware security module.
+func (h *BlockHeader) SignWith(pubKey *btcec.PublicKey, sign func(hash []byte) (*btcec.Signature, error)) error {
 	hash := h.hashForSigning()
-	signature, err := key.Sign(hash)
+	signature, err := sign(hash)
 	if err != nil {
 		return err
 	}
@@ -161,8 +169,8 @@ func (h *BlockHeader) Sign(key *btcec.PrivateKey) error {
 	// )
 
 	// Mark the public key used to sign the block.
-	pubKey := key.PubKey().SerializeCompressed()[:BlockValidatingPubKeySize]
-	copy(h.ValidatingPubKey[:BlockValidatingPubKeySize], pubKey[:BlockValidatingPubKeySize])
+	pubKeyBytes := pubKey.SerializeCompressed()[:BlockValidatingPubKeySize]
+	copy(h.ValidatingPubKey[:BlockValidatingPubKeySize], pubKeyBytes[:BlockValidatingPubKeySize])
 
 	copy(h.Signature[:], serialized)
 	return nil
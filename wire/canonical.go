@@ -0,0 +1,173 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// NonCanonicalError describes a serialized block which decodes to a block
+// whose canonical serialization differs from it.
+type NonCanonicalError struct {
+	// Offset is the offset of the first byte of the serialized block which
+	// differs from the canonical serialization.
+	Offset int
+
+	// Field names the field of the canonical serialization containing the
+	// first differing byte, such as "transaction count" or
+	// "transaction 0 input 0 signature script length", or "trailing data"
+	// when the serialized block is followed by additional bytes.
+	Field string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e *NonCanonicalError) Error() string {
+	return fmt.Sprintf("non-canonical block serialization: %s at offset %d",
+		e.Field, e.Offset)
+}
+
+// lenientVarIntReader wraps a reader to make ReadVarInt accept variable length
+// integers which are not encoded in the fewest possible bytes.  It is only used
+// by IsCanonicalBlock to decode the blocks BtcDecode rejects so the first
+// non-canonical field can be reported.
+type lenientVarIntReader struct {
+	io.Reader
+}
+
+// IsCanonicalBlock decodes the passed serialized block, re-encodes it and
+// returns a NonCanonicalError describing the first byte which differs between
+// the two when the serialized block is not canonical.  Blocks which can't be
+// decoded at all, even when accepting variable length integers which are not
+// minimally encoded, return the decoding error instead.  Canonical blocks
+// return nil.
+func IsCanonicalBlock(raw []byte) error {
+	return isCanonicalBlock(raw, 0)
+}
+
+// isCanonicalBlock is IsCanonicalBlock for blocks which are decoded with the
+// passed protocol version.
+func isCanonicalBlock(raw []byte, pver uint32) error {
+	var msg MsgBlock
+	err := msg.BtcDecode(lenientVarIntReader{bytes.NewReader(raw)}, pver)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(msg.SerializeSize())
+	if err := msg.Serialize(&buf); err != nil {
+		return err
+	}
+	canonical := buf.Bytes()
+	if bytes.Equal(raw, canonical) {
+		return nil
+	}
+
+	// The re-encoding can't be longer than the serialized block since every
+	// field is encoded in the fewest possible bytes, so when it is a prefix
+	// of the serialized block the first difference is trailing data.
+	offset := 0
+	for offset < len(canonical) && raw[offset] == canonical[offset] {
+		offset++
+	}
+	return &NonCanonicalError{
+		Offset: offset,
+		Field:  blockFieldAt(&msg, offset),
+	}
+}
+
+// CheckCanonicalBlock returns a NonCanonicalError when the passed serialized
+// block, which the passed block MUST have been decoded from with BtcDecode, is
+// not canonical.  Since BtcDecode already rejects variable length integers
+// which are not minimally encoded, this only needs to fully check blocks which
+// are followed by trailing data.
+func CheckCanonicalBlock(msg *MsgBlock, raw []byte) error {
+	if len(raw) == msg.SerializeSize() {
+		return nil
+	}
+	return isCanonicalBlock(raw, msg.TxEncoding())
+}
+
+// DecodeCanonical decodes the passed serialized block into the receiver like
+// BtcDecode, but also rejects blocks which are not serialized canonically, such
+// as blocks followed by trailing data, with a NonCanonicalError.
+func (msg *MsgBlock) DecodeCanonical(raw []byte, pver uint32) error {
+	if err := msg.BtcDecode(bytes.NewReader(raw), pver); err != nil {
+		return err
+	}
+	return CheckCanonicalBlock(msg, raw)
+}
+
+// blockFieldAt returns the name of the field of the canonical serialization of
+// the passed block which contains the byte at the passed offset, or
+// "trailing data" when the offset is past its end.
+func blockFieldAt(msg *MsgBlock, offset int) string {
+	// field moves past a field of the passed size and returns whether it
+	// contains the offset.
+	pos := 0
+	field := func(size int) bool {
+		pos += size
+		return offset < pos
+	}
+
+	if field(blockHeaderLen) {
+		return "block header"
+	}
+	if field(VarIntSerializeSize(uint64(len(msg.Transactions)))) {
+		return "transaction count"
+	}
+	for i, tx := range msg.Transactions {
+		txField := fmt.Sprintf("transaction %d ", i)
+		if field(4) {
+			return txField + "version"
+		}
+		if field(VarIntSerializeSize(uint64(len(tx.TxIn)))) {
+			return txField + "input count"
+		}
+		for j, txIn := range tx.TxIn {
+			inField := fmt.Sprintf("%sinput %d ", txField, j)
+			scriptLen := len(txIn.SignatureScript)
+			if field(chainhash.HashSize + 4) {
+				return inField + "previous outpoint"
+			}
+			if field(VarIntSerializeSize(uint64(scriptLen))) {
+				return inField + "signature script length"
+			}
+			if field(scriptLen) {
+				return inField + "signature script"
+			}
+			if field(4) {
+				return inField + "sequence"
+			}
+		}
+		if field(VarIntSerializeSize(uint64(len(tx.TxOut)))) {
+			return txField + "output count"
+		}
+		for j, txOut := range tx.TxOut {
+			outField := fmt.Sprintf("%soutput %d ", txField, j)
+			scriptLen := len(txOut.PkScript)
+			if field(8) {
+				return outField + "value"
+			}
+			if field(VarIntSerializeSize(uint64(scriptLen))) {
+				return outField + "public key script length"
+			}
+			if field(scriptLen) {
+				return outField + "public key script"
+			}
+		}
+		if field(4) {
+			return txField + "lock time"
+		}
+		if tx.HasExpiry() && field(4) {
+			return txField + "expiry"
+		}
+	}
+	return "trailing data"
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestIsCanonicalBlock ensures serialized blocks which are not canonical are
+// detected with the offset and field of their first non-canonical byte, and
+// that DecodeCanonical rejects them while BtcDecode only rejects the ones with
+// variable length integers which are not minimally encoded.
+func TestIsCanonicalBlock(t *testing.T) {
+	// replace returns a copy of the serialized block one with the byte at
+	// the passed offset replaced by the passed bytes.
+	replace := func(offset int, b ...byte) []byte {
+		raw := make([]byte, 0, len(blockOneBytes)+len(b))
+		raw = append(raw, blockOneBytes[:offset]...)
+		raw = append(raw, b...)
+		return append(raw, blockOneBytes[offset+1:]...)
+	}
+
+	// The signature script length of the only input of the coinbase
+	// follows the transaction count, the version and input count of the
+	// coinbase and the previous outpoint of the input.
+	sigScriptLenOffset := blockHeaderLen + 1 + 4 + 1 + 36
+	sigScriptLen := blockOneBytes[sigScriptLenOffset]
+
+	tests := []struct {
+		name   string
+		raw    []byte
+		offset int
+		field  string
+		strict bool // whether BtcDecode rejects the block
+	}{
+		{
+			name:   "transaction count",
+			raw:    replace(blockHeaderLen, 0xfd, 0x01, 0x00),
+			offset: blockHeaderLen,
+			field:  "transaction count",
+			strict: true,
+		},
+		{
+			name: "signature script length",
+			raw: replace(sigScriptLenOffset, 0xfe, sigScriptLen,
+				0x00, 0x00, 0x00),
+			offset: sigScriptLenOffset,
+			field:  "transaction 0 input 0 signature script length",
+			strict: true,
+		},
+		{
+			name:   "trailing data",
+			raw:    append(append([]byte{}, blockOneBytes...), 0x00),
+			offset: len(blockOneBytes),
+			field:  "trailing data",
+		},
+	}
+
+	if err := IsCanonicalBlock(blockOneBytes); err != nil {
+		t.Fatalf("IsCanonicalBlock: canonical block rejected: %v", err)
+	}
+	var msg MsgBlock
+	if err := msg.DecodeCanonical(blockOneBytes, 0); err != nil {
+		t.Fatalf("DecodeCanonical: canonical block rejected: %v", err)
+	}
+
+	for _, test := range tests {
+		err := IsCanonicalBlock(test.raw)
+		ncErr, ok := err.(*NonCanonicalError)
+		if !ok {
+			t.Errorf("IsCanonicalBlock (%s): unexpected error %v",
+				test.name, err)
+			continue
+		}
+		if ncErr.Offset != test.offset || ncErr.Field != test.field {
+			t.Errorf("IsCanonicalBlock (%s): got %q at offset %d, "+
+				"want %q at offset %d", test.name, ncErr.Field,
+				ncErr.Offset, test.field, test.offset)
+		}
+
+		var msg MsgBlock
+		err = msg.DecodeCanonical(test.raw, 0)
+		if err == nil {
+			t.Errorf("DecodeCanonical (%s): non-canonical block "+
+				"accepted", test.name)
+		}
+
+		err = msg.BtcDecode(bytes.NewReader(test.raw), 0)
+		if _, ok := err.(*MessageError); ok != test.strict {
+			t.Errorf("BtcDecode (%s): unexpected error %v",
+				test.name, err)
+		}
+	}
+
+	// Blocks which can't be decoded at all return the decoding error.
+	if err := IsCanonicalBlock(blockOneBytes[:blockHeaderLen]); err == nil {
+		t.Fatal("IsCanonicalBlock: truncated block accepted")
+	} else if _, ok := err.(*NonCanonicalError); ok {
+		t.Fatalf("IsCanonicalBlock: unexpected error %v", err)
+	}
+}
@@ -488,7 +488,9 @@ func writeElements(w io.Writer, elements ...interface{}) error {
 }
 
 // ReadVarInt reads a variable length integer from r and returns it as a uint64.
+// Integers which are not encoded in the fewest possible bytes are rejected.
 func ReadVarInt(r io.Reader, pver uint32) (uint64, error) {
+	_, lenient := r.(lenientVarIntReader)
 	discriminant, err := binarySerializer.Uint8(r)
 	if err != nil {
 		return 0, err
@@ -506,7 +508,7 @@ func ReadVarInt(r io.Reader, pver uint32) (uint64, error) {
 		// The encoding is not canonical if the value could have been
 		// encoded using fewer bytes.
 		min := uint64(0x100000000)
-		if rv < min {
+		if rv < min && !lenient {
 			return 0, messageError("ReadVarInt", fmt.Sprintf(
 				errNonCanonicalVarInt, rv, discriminant, min))
 		}
@@ -521,7 +523,7 @@ func ReadVarInt(r io.Reader, pver uint32) (uint64, error) {
 		// The encoding is not canonical if the value could have been
 		// encoded using fewer bytes.
 		min := uint64(0x10000)
-		if rv < min {
+		if rv < min && !lenient {
 			return 0, messageError("ReadVarInt", fmt.Sprintf(
 				errNonCanonicalVarInt, rv, discriminant, min))
 		}
@@ -536,7 +538,7 @@ func ReadVarInt(r io.Reader, pver uint32) (uint64, error) {
 		// The encoding is not canonical if the value could have been
 		// encoded using fewer bytes.
 		min := uint64(0xfd)
-		if rv < min {
+		if rv < min && !lenient {
 			return 0, messageError("ReadVarInt", fmt.Sprintf(
 				errNonCanonicalVarInt, rv, discriminant, min))
 		}
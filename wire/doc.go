@@ -146,7 +146,9 @@ Errors returned by this package are either the raw errors provided by underlying
 calls to read/write from streams such as io.EOF, io.ErrUnexpectedEOF, and
 io.ErrShortWrite, or of type wire.MessageError.  This allows the caller to
 differentiate between general IO errors and malformed messages through type
-assertions.
+assertions.  A wire.MessageError for a message whose header indicates a payload
+larger than the maximum allowed for its command also includes the command and
+payload size.  Such messages are rejected without reading their payload.
 
 Bitcoin Improvement Proposals
 
@@ -19,6 +19,13 @@ import (
 type MessageError struct {
 	Func        string // Function name
 	Description string // Human readable description of the issue
+
+	// Command and PayloadSize are the command and payload size indicated
+	// by the header of a message whose payload exceeds the maximum allowed
+	// for its command.  PayloadSize is only non-zero for such errors, in
+	// which case the payload was not read from the stream.
+	Command     string
+	PayloadSize uint32
 }
 
 // Error satisfies the error interface and prints human-readable errors.
@@ -33,3 +40,10 @@ func (e *MessageError) Error() string {
 func messageError(f string, desc string) *MessageError {
 	return &MessageError{Func: f, Description: desc}
 }
+
+// payloadSizeError creates an error for the given function, description, and
+// the command and payload size of the oversized message.
+func payloadSizeError(f string, desc string, command string, size uint32) *MessageError {
+	return &MessageError{Func: f, Description: desc, Command: command,
+		PayloadSize: size}
+}
@@ -197,6 +197,18 @@ func discardInput(r io.Reader, n uint32) {
 	}
 }
 
+// messagePver returns the protocol version the passed message is encoded and
+// decoded with for the passed protocol version.  The TxExpiryEncoding flag only
+// applies to the messages which carry transactions, so it is cleared for the
+// others.
+func messagePver(msg Message, pver uint32) uint32 {
+	switch msg.(type) {
+	case *MsgTx, *MsgBlock:
+		return pver
+	}
+	return pver &^ TxExpiryEncoding
+}
+
 // WriteMessageN writes a bitcoin Message to w including the necessary header
 // information and returns the number of bytes written.    This function is the
 // same as WriteMessage except it also returns the number of bytes written.
@@ -214,6 +226,7 @@ func WriteMessageN(w io.Writer, msg Message, pver uint32, btcnet BitcoinNet) (in
 	copy(command[:], []byte(cmd))
 
 	// Encode the message payload.
+	pver = messagePver(msg, pver)
 	var bw bytes.Buffer
 	err := msg.BtcEncode(&bw, pver)
 	if err != nil {
@@ -275,12 +288,36 @@ func WriteMessage(w io.Writer, msg Message, pver uint32, btcnet BitcoinNet) erro
 	return err
 }
 
+// MaxCommandPayload returns the maximum payload length of messages with the
+// passed command for the passed protocol version.  An error is returned when the
+// command is not supported.
+func MaxCommandPayload(command string, pver uint32) (uint32, error) {
+	msg, err := makeEmptyMessage(command)
+	if err != nil {
+		return 0, err
+	}
+	return msg.MaxPayloadLength(pver), nil
+}
+
 // ReadMessageN reads, validates, and parses the next bitcoin Message from r for
 // the provided protocol version and bitcoin network.  It returns the number of
 // bytes read in addition to the parsed Message and raw bytes which comprise the
 // message.  This function is the same as ReadMessage except it also returns the
 // number of bytes read.
 func ReadMessageN(r io.Reader, pver uint32, btcnet BitcoinNet) (int, Message, []byte, error) {
+	return ReadMessageWithLimitsN(r, pver, btcnet, nil)
+}
+
+// ReadMessageWithLimitsN reads, validates, and parses the next bitcoin Message
+// from r the same as ReadMessageN, except the maximum payload lengths of
+// messages with the commands in the passed map are overridden by the lengths in
+// the map.  The overrides are still subject to MaxMessagePayload.
+//
+// A message whose header indicates a payload larger than the maximum allowed
+// for its command is rejected after only reading the header, with a
+// MessageError which includes the command and payload size.  Since the payload
+// is not read, no further messages can be read from r.
+func ReadMessageWithLimitsN(r io.Reader, pver uint32, btcnet BitcoinNet, limits map[string]uint32) (int, Message, []byte, error) {
 	totalBytes := 0
 	n, hdr, err := readMessageHeader(r)
 	totalBytes += n
@@ -293,7 +330,8 @@ func ReadMessageN(r io.Reader, pver uint32, btcnet BitcoinNet) (int, Message, []
 		str := fmt.Sprintf("message payload is too large - header "+
 			"indicates %d bytes, but max message payload is %d "+
 			"bytes.", hdr.length, MaxMessagePayload)
-		return totalBytes, nil, nil, messageError("ReadMessage", str)
+		return totalBytes, nil, nil, payloadSizeError("ReadMessage", str,
+			hdr.command, hdr.length)
 
 	}
 
@@ -320,16 +358,23 @@ func ReadMessageN(r io.Reader, pver uint32, btcnet BitcoinNet) (int, Message, []
 			err.Error())
 	}
 
+	pver = messagePver(msg, pver)
+
 	// Check for maximum length based on the message type as a malicious client
 	// could otherwise create a well-formed header and set the length to max
-	// numbers in order to exhaust the machine's memory.
+	// numbers in order to exhaust the machine's memory.  The payload is not
+	// discarded since reading it would let the client make us read up to
+	// MaxMessagePayload bytes for each message.
 	mpl := msg.MaxPayloadLength(pver)
+	if limit, ok := limits[command]; ok {
+		mpl = limit
+	}
 	if hdr.length > mpl {
-		discardInput(r, hdr.length)
 		str := fmt.Sprintf("payload exceeds max length - header "+
 			"indicates %v bytes, but max payload size for "+
 			"messages of type [%v] is %v.", hdr.length, command, mpl)
-		return totalBytes, nil, nil, messageError("ReadMessage", str)
+		return totalBytes, nil, nil, payloadSizeError("ReadMessage", str,
+			command, hdr.length)
 	}
 
 	// Read payload.
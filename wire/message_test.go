@@ -368,6 +368,138 @@ func TestReadMessageWireErrors(t *testing.T) {
 	}
 }
 
+// TestReadMessagePayloadLimits ensures messages whose header indicates a
+// payload at the maximum allowed for their command are not rejected for their
+// size, while messages with one more byte are rejected after reading only the
+// header with an error which includes the command and payload size.  It also
+// ensures the maximum payload sizes may be overridden by command.
+func TestReadMessagePayloadLimits(t *testing.T) {
+	pver := ProtocolVersion
+	btcnet := MainNet
+
+	// The maximum payload sizes of the bounded commands, along with the
+	// overrides the sizes are read with.
+	locatorsPayload := uint32(4 + MaxVarIntPayload +
+		MaxBlockLocatorsPerMsg*chainhash.HashSize + chainhash.HashSize)
+	invPayload := uint32(MaxVarIntPayload + MaxInvPerMsg*(4+chainhash.HashSize))
+	tests := []struct {
+		command string            // Command of the message
+		limits  map[string]uint32 // Maximum payload overrides
+		max     uint32            // Expected maximum payload size
+	}{
+		{CmdVersion, nil, 33 + 30*2 + MaxVarIntPayload + MaxUserAgentLen},
+		{CmdVerAck, nil, 0},
+		{CmdGetAddr, nil, 0},
+		{CmdAddr, nil, MaxVarIntPayload + MaxAddrPerMsg*30},
+		{CmdGetBlocks, nil, locatorsPayload},
+		{CmdInv, nil, invPayload},
+		{CmdGetData, nil, invPayload},
+		{CmdNotFound, nil, invPayload},
+		{CmdBlock, nil, MaxBlockPayload},
+		{CmdTx, nil, MaxBlockPayload},
+		{CmdGetHeaders, nil, locatorsPayload},
+		{CmdHeaders, nil, MaxVarIntPayload +
+			(MaxBlockHeaderPayload+1)*MaxBlockHeadersPerMsg},
+		{CmdPing, nil, 8},
+		{CmdPong, nil, 8},
+		{CmdMemPool, nil, 0},
+		{CmdFilterAdd, nil, 3 + MaxFilterAddDataSize},
+		{CmdFilterClear, nil, 0},
+		{CmdFilterLoad, nil, 3 + MaxFilterLoadFilterSize + 9},
+		{CmdMerkleBlock, nil, MaxBlockPayload},
+		{CmdSendHeaders, nil, 0},
+		{CmdFeeFilter, nil, 8},
+
+		// Overrides may lower and raise the maximum payload sizes of
+		// their commands only.
+		{CmdHeaders, map[string]uint32{CmdHeaders: 100}, 100},
+		{CmdFeeFilter, map[string]uint32{CmdFeeFilter: 16}, 16},
+		{CmdAddr, map[string]uint32{CmdHeaders: 100},
+			MaxVarIntPayload + MaxAddrPerMsg*30},
+
+		// Overrides are still subject to the maximum message payload.
+		{CmdBlock, map[string]uint32{CmdBlock: MaxMessagePayload * 2},
+			MaxMessagePayload},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// A message at the limit is not rejected for its size.  Since
+		// only the header is provided, reading the payload fails
+		// unless it is empty.
+		buf := makeHeader(btcnet, test.command, test.max, 0)
+		_, _, _, err := ReadMessageWithLimitsN(bytes.NewReader(buf), pver,
+			btcnet, test.limits)
+		if msgErr, ok := err.(*MessageError); ok && msgErr.PayloadSize != 0 {
+			t.Errorf("ReadMessage #%d (%s) rejected payload at the "+
+				"limit: %v", i, test.command, err)
+			continue
+		}
+
+		// A message one byte over the limit is rejected without
+		// reading the payload.
+		buf = makeHeader(btcnet, test.command, test.max+1, 0)
+		buf = append(buf, 0x00)
+		r := bytes.NewReader(buf)
+		nr, _, _, err := ReadMessageWithLimitsN(r, pver, btcnet,
+			test.limits)
+		msgErr, ok := err.(*MessageError)
+		if !ok {
+			t.Errorf("ReadMessage #%d (%s) wrong error got: %v <%T>, "+
+				"want: *MessageError", i, test.command, err, err)
+			continue
+		}
+		if msgErr.Command != test.command ||
+			msgErr.PayloadSize != test.max+1 {
+
+			t.Errorf("ReadMessage #%d wrong error details got: "+
+				"%s of %d bytes, want: %s of %d bytes", i,
+				msgErr.Command, msgErr.PayloadSize, test.command,
+				test.max+1)
+			continue
+		}
+		if nr != MessageHeaderSize || r.Len() != 1 {
+			t.Errorf("ReadMessage #%d (%s) read %d bytes with %d "+
+				"unread, want %d with 1 unread", i, test.command, nr,
+				r.Len(), MessageHeaderSize)
+		}
+	}
+}
+
+// TestReadMessageTxExpiry ensures the TxExpiryEncoding flag of the protocol
+// version decodes the expiry height of transactions, and doesn't affect the
+// decoding of messages which don't carry transactions.
+func TestReadMessageTxExpiry(t *testing.T) {
+	btcnet := MainNet
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, expiryTx, ProtocolVersion, btcnet); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+	msg, _, err := ReadMessage(bytes.NewReader(buf.Bytes()),
+		ProtocolVersion|TxExpiryEncoding, btcnet)
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if !reflect.DeepEqual(msg, expiryTx) {
+		t.Fatalf("ReadMessage\n got: %s want: %s", spew.Sdump(msg),
+			spew.Sdump(expiryTx))
+	}
+
+	// A pong can't be decoded at the protocol version before it was added,
+	// even with the flag.
+	buf.Reset()
+	err = WriteMessage(&buf, NewMsgPong(1), ProtocolVersion, btcnet)
+	if err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+	_, _, err = ReadMessage(bytes.NewReader(buf.Bytes()),
+		BIP0031Version|TxExpiryEncoding, btcnet)
+	if _, ok := err.(*MessageError); !ok {
+		t.Fatalf("ReadMessage wrong error got: %v <%T>, want: "+
+			"*MessageError", err, err)
+	}
+}
+
 // TestWriteMessageWireErrors performs negative tests against wire encoding from
 // concrete messages to confirm error paths work correctly.
 func TestWriteMessageWireErrors(t *testing.T) {
@@ -61,6 +61,10 @@ func (msg *MsgBlock) ClearTransactions() {
 // This is part of the Message interface implementation.
 // See Deserialize for decoding blocks stored to disk, such as in a database, as
 // opposed to decoding blocks from the wire.
+//
+// Variable length integers which are not encoded in the fewest possible bytes
+// are always rejected, but any data following the block is not read.  See
+// DecodeCanonical for also rejecting serialized blocks with trailing data.
 func (msg *MsgBlock) BtcDecode(r io.Reader, pver uint32) error {
 	err := readBlockHeader(r, pver, &msg.Header)
 	if err != nil {
@@ -115,17 +119,25 @@ func (msg *MsgBlock) Deserialize(r io.Reader) error {
 // start and length of each transaction within the raw data that is being
 // deserialized.
 func (msg *MsgBlock) DeserializeTxLoc(r *bytes.Buffer) ([]TxLoc, error) {
-	fullLen := r.Len()
-
 	// At the current time, there is no difference between the wire encoding
 	// at protocol version 0 and the stable long-term storage format.  As
-	// a result, make use of existing wire protocol functions.
-	err := readBlockHeader(r, 0, &msg.Header)
+	// a result, make use of BtcDecodeTxLoc.
+	return msg.BtcDecodeTxLoc(r, 0)
+}
+
+// BtcDecodeTxLoc decodes r in the same manner BtcDecode does, but it takes a
+// byte buffer instead of a generic reader and returns a slice containing the
+// start and length of each transaction within the raw data that is being
+// decoded.
+func (msg *MsgBlock) BtcDecodeTxLoc(r *bytes.Buffer, pver uint32) ([]TxLoc, error) {
+	fullLen := r.Len()
+
+	err := readBlockHeader(r, pver, &msg.Header)
 	if err != nil {
 		return nil, err
 	}
 
-	txCount, err := ReadVarInt(r, 0)
+	txCount, err := ReadVarInt(r, pver)
 	if err != nil {
 		return nil, err
 	}
@@ -136,7 +148,7 @@ func (msg *MsgBlock) DeserializeTxLoc(r *bytes.Buffer) ([]TxLoc, error) {
 	if txCount > maxTxPerBlock {
 		str := fmt.Sprintf("too many transactions to fit into a block "+
 			"[count %d, max %d]", txCount, maxTxPerBlock)
-		return nil, messageError("MsgBlock.DeserializeTxLoc", str)
+		return nil, messageError("MsgBlock.BtcDecodeTxLoc", str)
 	}
 
 	// Deserialize each transaction while keeping track of its location
@@ -146,7 +158,7 @@ func (msg *MsgBlock) DeserializeTxLoc(r *bytes.Buffer) ([]TxLoc, error) {
 	for i := uint64(0); i < txCount; i++ {
 		txLocs[i].TxStart = fullLen - r.Len()
 		tx := MsgTx{}
-		err := tx.Deserialize(r)
+		err := tx.BtcDecode(r, pver)
 		if err != nil {
 			return nil, err
 		}
@@ -157,6 +169,18 @@ func (msg *MsgBlock) DeserializeTxLoc(r *bytes.Buffer) ([]TxLoc, error) {
 	return txLocs, nil
 }
 
+// TxEncoding returns the protocol version flags the transactions of the block
+// need to be decoded with again from its serialization, which is
+// TxExpiryEncoding when any of them carries an expiry height.
+func (msg *MsgBlock) TxEncoding() uint32 {
+	for _, tx := range msg.Transactions {
+		if tx.HasExpiry() {
+			return TxExpiryEncoding
+		}
+	}
+	return 0
+}
+
 // BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
 // This is part of the Message interface implementation.
 // See Serialize for encoding blocks to be stored to disk, such as in a
@@ -18,6 +18,18 @@ const (
 	// TxVersion is the current latest supported transaction version.
 	TxVersion = 1
 
+	// TxVersionExpiry is the transaction version which carries an expiry
+	// height, serialized after the lock time, on the networks which enable
+	// it as reported by the ExpiryEncoding field of the transaction.
+	// Transactions of any other version don't serialize the expiry and
+	// never expire.  Version 2 is skipped since it only enables
+	// the relative lock times of BIP0068.
+	TxVersionExpiry = 3
+
+	// NoExpiryValue is the expiry height of transactions which don't
+	// expire.
+	NoExpiryValue uint32 = 0
+
 	// MaxTxInSequenceNum is the maximum sequence number the sequence field
 	// of a transaction input can be.
 	MaxTxInSequenceNum uint32 = 0xffffffff
@@ -251,6 +263,26 @@ type MsgTx struct {
 	TxIn     []*TxIn
 	TxOut    []*TxOut
 	LockTime uint32
+
+	// Expiry is the block height at or after which the transaction can no
+	// longer be included in a block, or NoExpiryValue when it doesn't
+	// expire.  It is only serialized by transactions which carry one as
+	// reported by HasExpiry.
+	Expiry uint32
+
+	// ExpiryEncoding is whether the transaction is encoded for a network
+	// on which transactions of version TxVersionExpiry carry an expiry
+	// height.  BtcDecode sets it for the transactions of that version
+	// which are decoded with the TxExpiryEncoding protocol version flag,
+	// and it must be set for the ones created for such networks.
+	ExpiryEncoding bool
+}
+
+// HasExpiry returns whether the transaction carries an expiry height, which
+// is the case for the transactions of version TxVersionExpiry which use the
+// expiry encoding.
+func (msg *MsgTx) HasExpiry() bool {
+	return msg.Version == TxVersionExpiry && msg.ExpiryEncoding
 }
 
 // AddTxIn adds a transaction input to the message.
@@ -292,10 +324,12 @@ func (msg *MsgTx) Copy() *MsgTx {
 	// Create new tx and start by copying primitive values and making space
 	// for the transaction inputs and outputs.
 	newTx := MsgTx{
-		Version:  msg.Version,
-		TxIn:     make([]*TxIn, 0, len(msg.TxIn)),
-		TxOut:    make([]*TxOut, 0, len(msg.TxOut)),
-		LockTime: msg.LockTime,
+		Version:        msg.Version,
+		TxIn:           make([]*TxIn, 0, len(msg.TxIn)),
+		TxOut:          make([]*TxOut, 0, len(msg.TxOut)),
+		LockTime:       msg.LockTime,
+		Expiry:         msg.Expiry,
+		ExpiryEncoding: msg.ExpiryEncoding,
 	}
 
 	// Deep copy the old TxIn data.
@@ -450,6 +484,17 @@ func (msg *MsgTx) BtcDecode(r io.Reader, pver uint32) error {
 		return err
 	}
 
+	msg.Expiry = NoExpiryValue
+	msg.ExpiryEncoding = msg.Version == TxVersionExpiry &&
+		pver&TxExpiryEncoding != 0
+	if msg.HasExpiry() {
+		msg.Expiry, err = binarySerializer.Uint32(r, littleEndian)
+		if err != nil {
+			returnScriptBuffers()
+			return err
+		}
+	}
+
 	// Create a single allocation to house all of the scripts and set each
 	// input signature script and output public key script to the
 	// appropriate subslice of the overall contiguous buffer.  Then, return
@@ -553,13 +598,25 @@ func (msg *MsgTx) btcEncode(w io.Writer, pver uint32, strip bool) error {
 		}
 	}
 
-	return binarySerializer.PutUint32(w, littleEndian, msg.LockTime)
+	err = binarySerializer.PutUint32(w, littleEndian, msg.LockTime)
+	if err != nil {
+		return err
+	}
+
+	if msg.HasExpiry() {
+		return binarySerializer.PutUint32(w, littleEndian, msg.Expiry)
+	}
+	return nil
 }
 
 // BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
 // This is part of the Message interface implementation.
 // See Serialize for encoding transactions to be stored to disk, such as in a
 // database, as opposed to encoding transactions for the wire.
+//
+// The expiry height is encoded when the transaction carries one as reported by
+// HasExpiry regardless of the TxExpiryEncoding flag, so the encoding, and the
+// hash, of a transaction don't depend on the protocol version.
 func (msg *MsgTx) BtcEncode(w io.Writer, pver uint32) error {
 	return msg.btcEncode(w, pver, false)
 }
@@ -596,6 +653,11 @@ func (msg *MsgTx) serializeSize(strip bool) int {
 	n := 8 + VarIntSerializeSize(uint64(len(msg.TxIn))) +
 		VarIntSerializeSize(uint64(len(msg.TxOut)))
 
+	// Expiry 4 bytes for the transaction versions which carry it.
+	if msg.HasExpiry() {
+		n += 4
+	}
+
 	if strip {
 		// StrippedTxInSize is the length of a TxIn stripped of its scriptSigs
 		// calculated by: Outpoint Hash 32 bytes + Outpoint Index 4 bytes +
@@ -546,6 +546,89 @@ func TestTxSerialize(t *testing.T) {
 	}
 }
 
+// TestTxSerializeExpiry ensures transactions of the version which carries an
+// expiry height only encode it when they use the expiry encoding, only decode
+// it with the TxExpiryEncoding protocol version flag, and are otherwise encoded
+// like the transactions of any other version.
+func TestTxSerializeExpiry(t *testing.T) {
+	// The expiry height of a transaction which doesn't use the expiry
+	// encoding is neither encoded nor decoded.
+	plainTx := *expiryTx
+	plainTx.ExpiryEncoding = false
+	plainTxDecoded := plainTx
+	plainTxDecoded.Expiry = NoExpiryValue
+
+	tests := []struct {
+		in   *MsgTx // Message to encode
+		out  *MsgTx // Expected decoded message
+		buf  []byte // Wire encoding
+		pver uint32 // Protocol version for wire encoding
+	}{
+		{&plainTx, &plainTxDecoded, expiryTxEncoded[:10], 0},
+		{&plainTx, &plainTxDecoded, expiryTxEncoded[:10], ProtocolVersion},
+		{expiryTx, expiryTx, expiryTxEncoded, TxExpiryEncoding},
+		{expiryTx, expiryTx, expiryTxEncoded,
+			ProtocolVersion | TxExpiryEncoding},
+
+		// Transactions of other versions are decoded the same way with
+		// the flag.
+		{multiTx, multiTx, multiTxEncoded, TxExpiryEncoding},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		if err := test.in.BtcEncode(&buf, test.pver); err != nil {
+			t.Errorf("BtcEncode #%d error %v", i, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("BtcEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+		if size := test.in.SerializeSize(); size != len(test.buf) {
+			t.Errorf("SerializeSize #%d: got %d, want %d", i, size,
+				len(test.buf))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var tx MsgTx
+		err := tx.BtcDecode(bytes.NewReader(test.buf), test.pver)
+		if err != nil {
+			t.Errorf("BtcDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(&tx, test.out) {
+			t.Errorf("BtcDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(&tx), spew.Sdump(test.out))
+			continue
+		}
+		if tx.TxHash() != test.in.TxHash() {
+			t.Errorf("TxHash #%d: got %v, want %v", i, tx.TxHash(),
+				test.in.TxHash())
+			continue
+		}
+
+		// Ensure the expiry height is required when it is carried.
+		if !test.out.HasExpiry() {
+			continue
+		}
+		w := newFixedWriter(10)
+		if err := test.in.BtcEncode(w, test.pver); err != io.ErrShortWrite {
+			t.Errorf("BtcEncode #%d wrong error got: %v, want: %v",
+				i, err, io.ErrShortWrite)
+		}
+		r := newFixedReader(10, test.buf)
+		if err := tx.BtcDecode(r, test.pver); err != io.EOF {
+			t.Errorf("BtcDecode #%d wrong error got: %v, want: %v",
+				i, err, io.EOF)
+		}
+	}
+}
+
 // TestTxSerializeErrors performs negative tests against wire encode and decode
 // of MsgTx to confirm error paths work correctly.
 func TestTxSerializeErrors(t *testing.T) {
@@ -904,3 +987,23 @@ var multiTxEncoded = []byte{
 // multiTxPkScriptLocs is the location information for the public key scripts
 // located in multiTx.
 var multiTxPkScriptLocs = []int{63, 139}
+
+// expiryTx is a transaction of the version which carries an expiry height
+// which uses the expiry encoding.
+var expiryTx = &MsgTx{
+	Version:        TxVersionExpiry,
+	TxIn:           []*TxIn{},
+	TxOut:          []*TxOut{},
+	LockTime:       0,
+	Expiry:         0x1234,
+	ExpiryEncoding: true,
+}
+
+// expiryTxEncoded is the wire encoded bytes for expiryTx.
+var expiryTxEncoded = []byte{
+	0x03, 0x00, 0x00, 0x00, // Version
+	0x00,                   // Varint for number of input transactions
+	0x00,                   // Varint for number of output transactions
+	0x00, 0x00, 0x00, 0x00, // Lock time
+	0x34, 0x12, 0x00, 0x00, // Expiry
+}
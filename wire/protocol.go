@@ -53,6 +53,14 @@ const (
 	FeeFilterVersion uint32 = 70013
 )
 
+// TxExpiryEncoding is a flag which is set in the protocol version passed to
+// BtcDecode to decode the transactions of version TxVersionExpiry, including
+// the ones in blocks, with an expiry height.  It is set on the networks whose
+// chain parameters enable transaction expiry.  Only the messages which carry
+// transactions are decoded with it, so it never affects the comparisons of
+// protocol versions.
+const TxExpiryEncoding uint32 = 1 << 31
+
 // ServiceFlag identifies services supported by a bitcoin peer.
 type ServiceFlag uint64
 
@@ -67,13 +75,23 @@ const (
 	// SFNodeBloom is a flag used to indiciate a peer supports bloom
 	// filtering.
 	SFNodeBloom
+
+	// SFNodeNetworkLimited is a flag used to indicate a peer only serves
+	// the most recent blocks, at least NodeNetworkLimitedMinBlocks of them,
+	// rather than the full block history (BIP0159).
+	SFNodeNetworkLimited ServiceFlag = 1 << 10
 )
 
+// NodeNetworkLimitedMinBlocks is the minimum number of most recent blocks a
+// peer which advertises SFNodeNetworkLimited serves.
+const NodeNetworkLimitedMinBlocks = 288
+
 // Map of service flags back to their constant names for pretty printing.
 var sfStrings = map[ServiceFlag]string{
-	SFNodeNetwork: "SFNodeNetwork",
-	SFNodeGetUTXO: "SFNodeGetUTXO",
-	SFNodeBloom:   "SFNodeBloom",
+	SFNodeNetwork:        "SFNodeNetwork",
+	SFNodeGetUTXO:        "SFNodeGetUTXO",
+	SFNodeBloom:          "SFNodeBloom",
+	SFNodeNetworkLimited: "SFNodeNetworkLimited",
 }
 
 // orderedSFStrings is an ordered list of service flags from highest to
@@ -82,6 +100,7 @@ var orderedSFStrings = []ServiceFlag{
 	SFNodeNetwork,
 	SFNodeGetUTXO,
 	SFNodeBloom,
+	SFNodeNetworkLimited,
 }
 
 // String returns the ServiceFlag in human-readable form.
@@ -0,0 +1,454 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/database"
+)
+
+const (
+	// wsTokenSize is the number of random bytes of a websocket token.  The
+	// token is handed to clients hex encoded.
+	wsTokenSize = 32
+
+	// wsTokenIDSize is the number of random bytes of the ID of a websocket
+	// token, which identifies it to the admin without revealing it.
+	wsTokenIDSize = 8
+
+	// wsTokenAuthScheme is the scheme of the Authorization header which
+	// carries a websocket token during the websocket handshake.
+	wsTokenAuthScheme = "Bearer"
+)
+
+var (
+	// wsTokenBucketName is the name of the database bucket used to house
+	// the issued websocket tokens.  The entries are keyed by the SHA-256
+	// hash of the token, so the tokens themselves are never stored.
+	wsTokenBucketName = []byte("wstokens")
+)
+
+// wsTokenNtfnMethods maps the types of notifications websocket tokens may be
+// scoped to onto the websocket methods which register and unregister them.
+var wsTokenNtfnMethods = map[string][]string{
+	"blocks": {"notifyblocks", "stopnotifyblocks", "subscribeblocks",
+		"unsubscribeblocks"},
+	"newtransactions": {"notifynewtransactions",
+		"stopnotifynewtransactions"},
+	"received":      {"notifyreceived", "stopnotifyreceived"},
+	"spent":         {"notifyspent", "stopnotifyspent"},
+	"txfilter":      {"loadtxfilter"},
+	"watchedspends": {"notifywatchedspends", "stopnotifywatchedspends"},
+}
+
+// wsTokenNtfnMethod returns whether the passed method registers or unregisters
+// notifications, and is therefore only allowed by the notification types of
+// websocket tokens.
+func wsTokenNtfnMethod(method string) bool {
+	for _, methods := range wsTokenNtfnMethods {
+		for _, m := range methods {
+			if m == method {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// errWSTokenScope describes an error due to an invalid scope requested for a
+// websocket token.
+type errWSTokenScope string
+
+// Error implements the error interface.
+func (e errWSTokenScope) Error() string {
+	return string(e)
+}
+
+// wsTokenRecord is the database representation of a websocket token.  The
+// times are Unix timestamps, and tokens which never expire have an expiry
+// of zero.
+type wsTokenRecord struct {
+	ID            string   `json:"id"`
+	Notifications []string `json:"notifications"`
+	Methods       []string `json:"methods"`
+	Created       int64    `json:"created"`
+	Expires       int64    `json:"expires"`
+}
+
+// wsToken describes an issued websocket token and the scope of the websocket
+// clients which authenticate with it.
+type wsToken struct {
+	id            string
+	notifications []string
+	methods       []string
+	allowed       map[string]struct{}
+	created       time.Time
+
+	// expires is the time the token expires, which is zero for tokens
+	// which never expire.
+	expires time.Time
+
+	// revoked is closed once the token is revoked, which disconnects the
+	// clients which authenticated with it.
+	revoked chan struct{}
+}
+
+// newWSToken returns the token described by the passed record.  An error is
+// returned if the record refers to an unknown notification type, or to a
+// method which is either not available to limited users or which registers
+// notifications.
+func newWSToken(record *wsTokenRecord) (*wsToken, error) {
+	t := &wsToken{
+		id:      record.ID,
+		allowed: make(map[string]struct{}),
+		created: time.Unix(record.Created, 0),
+		revoked: make(chan struct{}),
+	}
+	if record.Expires != 0 {
+		t.expires = time.Unix(record.Expires, 0)
+	}
+
+	seen := make(map[string]struct{})
+	for _, ntfn := range record.Notifications {
+		methods, ok := wsTokenNtfnMethods[ntfn]
+		if !ok {
+			str := fmt.Sprintf("unknown notification type %q", ntfn)
+			return nil, errWSTokenScope(str)
+		}
+		if _, ok := seen[ntfn]; ok {
+			continue
+		}
+		seen[ntfn] = struct{}{}
+		t.notifications = append(t.notifications, ntfn)
+		for _, method := range methods {
+			t.allowed[method] = struct{}{}
+		}
+	}
+	for _, method := range record.Methods {
+		if wsTokenNtfnMethod(method) {
+			str := fmt.Sprintf("method %q registers notifications "+
+				"and is allowed by the notification types", method)
+			return nil, errWSTokenScope(str)
+		}
+		if _, ok := rpcLimited[method]; !ok {
+			str := fmt.Sprintf("method %q is not available to "+
+				"limited users", method)
+			return nil, errWSTokenScope(str)
+		}
+		if _, ok := t.allowed[method]; ok {
+			continue
+		}
+		t.allowed[method] = struct{}{}
+		t.methods = append(t.methods, method)
+	}
+	if len(t.allowed) == 0 {
+		return nil, errWSTokenScope("the token must allow at least one " +
+			"notification type or method")
+	}
+	sort.Strings(t.notifications)
+	sort.Strings(t.methods)
+
+	return t, nil
+}
+
+// record returns the database representation of the token.
+func (t *wsToken) record() *wsTokenRecord {
+	record := &wsTokenRecord{
+		ID:            t.id,
+		Notifications: t.notifications,
+		Methods:       t.methods,
+		Created:       t.created.Unix(),
+	}
+	if !t.expires.IsZero() {
+		record.Expires = t.expires.Unix()
+	}
+	return record
+}
+
+// result returns the JSON-RPC representation of the token.
+func (t *wsToken) result() *btcjson.WSTokenResult {
+	record := t.record()
+	result := &btcjson.WSTokenResult{
+		ID:            record.ID,
+		Notifications: record.Notifications,
+		Methods:       record.Methods,
+		Created:       record.Created,
+		Expires:       record.Expires,
+	}
+	if result.Notifications == nil {
+		result.Notifications = []string{}
+	}
+	if result.Methods == nil {
+		result.Methods = []string{}
+	}
+	return result
+}
+
+// Allows returns whether the token allows its clients to call the passed
+// method.
+func (t *wsToken) Allows(method string) bool {
+	_, ok := t.allowed[method]
+	return ok
+}
+
+// Expired returns whether the token is expired at the passed time.
+func (t *wsToken) Expired(now time.Time) bool {
+	return !t.expires.IsZero() && !now.Before(t.expires)
+}
+
+// Revoked returns whether the token was revoked.
+func (t *wsToken) Revoked() bool {
+	select {
+	case <-t.revoked:
+		return true
+	default:
+		return false
+	}
+}
+
+// wsTokenSorter implements sort.Interface to allow a slice of websocket tokens
+// to be sorted in the order they were issued.
+type wsTokenSorter []*wsToken
+
+// Len returns the number of tokens in the slice.  It is part of the
+// sort.Interface implementation.
+func (s wsTokenSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the tokens at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s wsTokenSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the token with index i should sort before the token
+// with index j.  It is part of the sort.Interface implementation.
+func (s wsTokenSorter) Less(i, j int) bool {
+	if !s[i].created.Equal(s[j].created) {
+		return s[i].created.Before(s[j].created)
+	}
+	return s[i].id < s[j].id
+}
+
+// wsTokenStore houses the tokens which authenticate websocket clients in
+// place of the RPC credentials, such as for dashboards which only receive
+// notifications.  The tokens are kept by their SHA-256 hash, so looking up a
+// presented token only depends on its hash rather than on how much of it
+// matches an issued token, and are persisted in the database so they survive
+// restarts.
+type wsTokenStore struct {
+	sync.RWMutex
+	db     database.DB
+	tokens map[[sha256.Size]byte]*wsToken
+}
+
+// newWSTokenStore returns a websocket token store backed by the passed
+// database.  The existing tokens are loaded from the database.
+func newWSTokenStore(db database.DB, readOnly bool) (*wsTokenStore, error) {
+	s := &wsTokenStore{
+		db:     db,
+		tokens: make(map[[sha256.Size]byte]*wsToken),
+	}
+	load := func(bucket database.Bucket) error {
+		return bucket.ForEach(func(k, v []byte) error {
+			var record wsTokenRecord
+			if len(k) != sha256.Size {
+				return fmt.Errorf("malformed websocket token "+
+					"key %x", k)
+			}
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("malformed websocket token "+
+					"%x: %v", k, err)
+			}
+			token, err := newWSToken(&record)
+			if err != nil {
+				return fmt.Errorf("malformed websocket token "+
+					"%s: %v", record.ID, err)
+			}
+			var hash [sha256.Size]byte
+			copy(hash[:], k)
+			s.tokens[hash] = token
+			return nil
+		})
+	}
+
+	var err error
+	if readOnly {
+		err = db.View(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(wsTokenBucketName)
+			if bucket == nil {
+				return nil
+			}
+			return load(bucket)
+		})
+	} else {
+		err = db.Update(func(dbTx database.Tx) error {
+			bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+				wsTokenBucketName)
+			if err != nil {
+				return err
+			}
+			return load(bucket)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Issue issues a token which allows the passed notification types and methods
+// until the passed expiry, which is zero for tokens which never expire and is
+// truncated to the second, and persists it.  It returns the token, which is not retrievable afterwards,
+// along with its description.  Expired tokens are removed.
+//
+// This function is safe for concurrent access.
+func (s *wsTokenStore) Issue(notifications, methods []string, expires time.Time) (string, *wsToken, error) {
+	now := time.Now()
+	var secret [wsTokenSize]byte
+	var id [wsTokenIDSize]byte
+	if _, err := rand.Read(secret[:]); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", nil, err
+	}
+	record := &wsTokenRecord{
+		ID:            hex.EncodeToString(id[:]),
+		Notifications: notifications,
+		Methods:       methods,
+		Created:       now.Unix(),
+	}
+	if !expires.IsZero() {
+		record.Expires = expires.Unix()
+	}
+	token, err := newWSToken(record)
+	if err != nil {
+		return "", nil, err
+	}
+	if token.Expired(now) {
+		return "", nil, errWSTokenScope("the expiry time is in the past")
+	}
+	encoded := hex.EncodeToString(secret[:])
+	hash := sha256.Sum256([]byte(encoded))
+	serialized, err := json.Marshal(token.record())
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	var expired [][sha256.Size]byte
+	for h, t := range s.tokens {
+		if t.Expired(now) {
+			expired = append(expired, h)
+		}
+	}
+	err = s.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(wsTokenBucketName)
+		for i := range expired {
+			if err := bucket.Delete(expired[i][:]); err != nil {
+				return err
+			}
+		}
+		return bucket.Put(hash[:], serialized)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, h := range expired {
+		delete(s.tokens, h)
+	}
+	s.tokens[hash] = token
+	return encoded, token, nil
+}
+
+// Revoke revokes the token with the passed ID, which disconnects the clients
+// which authenticated with it, and removes it from the database.  It returns
+// whether a token with the ID was issued.
+//
+// This function is safe for concurrent access.
+func (s *wsTokenStore) Revoke(id string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for hash, token := range s.tokens {
+		if token.id != id {
+			continue
+		}
+		err := s.db.Update(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(wsTokenBucketName)
+			return bucket.Delete(hash[:])
+		})
+		if err != nil {
+			return false, err
+		}
+		delete(s.tokens, hash)
+		close(token.revoked)
+		return true, nil
+	}
+	return false, nil
+}
+
+// Tokens returns the issued tokens, including the expired ones which were not
+// removed yet, in the order they were issued.
+//
+// This function is safe for concurrent access.
+func (s *wsTokenStore) Tokens() []*wsToken {
+	s.RLock()
+	tokens := make([]*wsToken, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		tokens = append(tokens, token)
+	}
+	s.RUnlock()
+
+	sort.Sort(wsTokenSorter(tokens))
+	return tokens
+}
+
+// Authenticate returns the token matching the passed one, or nil when it was
+// never issued, was revoked, or is expired.
+//
+// This function is safe for concurrent access.
+func (s *wsTokenStore) Authenticate(secret string) *wsToken {
+	hash := sha256.Sum256([]byte(secret))
+
+	s.RLock()
+	token := s.tokens[hash]
+	s.RUnlock()
+
+	if token == nil || token.Expired(time.Now()) {
+		return nil
+	}
+	return token
+}
+
+// wsTokenFromRequest returns the websocket token carried by the Authorization
+// header of the passed request, if any.
+func wsTokenFromRequest(r *http.Request) (string, bool) {
+	authhdr := r.Header.Get("Authorization")
+	prefix := wsTokenAuthScheme + " "
+	if len(authhdr) <= len(prefix) ||
+		!strings.EqualFold(authhdr[:len(prefix)], prefix) {
+
+		return "", false
+	}
+	return strings.TrimSpace(authhdr[len(prefix):]), true
+}
@@ -0,0 +1,300 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/database"
+	"github.com/btcsuite/websocket"
+)
+
+// wsTokenTestReply is the reply of a websocket server to a request.
+type wsTokenTestReply struct {
+	Result json.RawMessage   `json:"result"`
+	Error  *btcjson.RPCError `json:"error"`
+	ID     *int              `json:"id"`
+}
+
+// wsTokenTestClient is a websocket client of the server under test which
+// authenticated with a token.
+type wsTokenTestClient struct {
+	t      *testing.T
+	conn   *websocket.Conn
+	nextID int
+}
+
+// call sends a request for the passed method without parameters and returns
+// the message of the error it fails with, which is empty when it succeeds.
+func (c *wsTokenTestClient) call(method string) string {
+	c.nextID++
+	request := fmt.Sprintf(`{"jsonrpc":"1.0","method":%q,"params":[],"id":%d}`,
+		method, c.nextID)
+	err := c.conn.WriteMessage(websocket.TextMessage, []byte(request))
+	if err != nil {
+		c.t.Fatalf("%s: unable to send request: %v", method, err)
+	}
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			c.t.Fatalf("%s: unable to read reply: %v", method, err)
+		}
+		var reply wsTokenTestReply
+		if err := json.Unmarshal(msg, &reply); err != nil {
+			c.t.Fatalf("%s: unable to decode reply %q: %v", method,
+				msg, err)
+		}
+		if reply.ID == nil || *reply.ID != c.nextID {
+			continue
+		}
+		if reply.Error != nil {
+			return reply.Error.Message
+		}
+		return ""
+	}
+}
+
+// waitForDisconnect ensures the server closes the connection of the client.
+func (c *wsTokenTestClient) waitForDisconnect(desc string) {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := c.conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if netErr, ok := err.(interface {
+			Timeout() bool
+		}); ok && netErr.Timeout() {
+			c.t.Fatalf("%s: the connection was not closed", desc)
+		}
+		return
+	}
+}
+
+// TestWSTokens ensures websocket clients which authenticate with a token may
+// only register for the notifications and call the methods in its scope, that
+// they are disconnected once the token is revoked or expires, that such tokens
+// are refused during the handshake, and that the tokens survive restarts.
+func TestWSTokens(t *testing.T) {
+	defer func(c *config) {
+		cfg = c
+	}(cfg)
+	params := chaincfg.RegressionNetParams
+
+	tmpDir, err := ioutil.TempDir("", "wstokens")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cfg = newTestConfig(tmpDir)
+	cfg.RPCMaxWebsockets = defaultMaxRPCWebsockets
+	cfg.RPCMaxConcurrentReqs = defaultMaxRPCConcurrentReqs
+	db, err := database.Create("ffldb", filepath.Join(tmpDir, "ffldb"),
+		params.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	defer db.Close()
+
+	store, err := newWSTokenStore(db, false)
+	if err != nil {
+		t.Fatalf("newWSTokenStore: unexpected error: %v", err)
+	}
+	s := &rpcServer{
+		server:         &server{wsTokens: store},
+		statusLines:    make(map[int]string),
+		requestLimiter: newRPCRequestLimiter(100, 100),
+	}
+	s.ntfnMgr = newWsNotificationManager(s)
+	s.ntfnMgr.Start()
+	defer func() {
+		s.ntfnMgr.Shutdown()
+		s.ntfnMgr.WaitForShutdown()
+	}()
+	httpServer := httptest.NewServer(http.HandlerFunc(
+		s.handleWebsocketRequest))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+
+	// dial connects to the server with the passed token and returns the
+	// client along with the HTTP status of the handshake.
+	dial := func(token string) (*wsTokenTestClient, int) {
+		header := http.Header{}
+		header.Set("Authorization", "Bearer "+token)
+		conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+		if err != nil {
+			if resp == nil {
+				t.Fatalf("unable to connect: %v", err)
+			}
+			return nil, resp.StatusCode
+		}
+		return &wsTokenTestClient{t: t, conn: conn},
+			http.StatusSwitchingProtocols
+	}
+	issue := func(notifications, methods []string, expires int64) *btcjson.WSTokenResult {
+		cmd := btcjson.NewIssueWSTokenCmd(notifications, &methods,
+			&expires)
+		result, err := handleIssueWSToken(s, cmd, nil)
+		if err != nil {
+			t.Fatalf("issuewstoken %v %v: unexpected error: %v",
+				notifications, methods, err)
+		}
+		return result.(*btcjson.WSTokenResult)
+	}
+
+	// Tokens must allow something, and may only allow other methods which
+	// are available to limited users and don't register notifications.
+	invalid := []struct {
+		notifications []string
+		methods       []string
+		expires       int64
+	}{
+		{nil, nil, 0},
+		{[]string{"blocks", "unknown"}, nil, 0},
+		{[]string{"blocks"}, []string{"stop"}, 0},
+		{[]string{"blocks"}, []string{"notifyspent"}, 0},
+		{[]string{"blocks"}, nil, time.Now().Add(-time.Hour).Unix()},
+	}
+	for _, test := range invalid {
+		cmd := btcjson.NewIssueWSTokenCmd(test.notifications,
+			&test.methods, &test.expires)
+		_, err := handleIssueWSToken(s, cmd, nil)
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != btcjson.ErrRPCInvalidParameter {
+			t.Fatalf("issuewstoken %v %v %d: got error %v, want "+
+				"invalid parameter", test.notifications,
+				test.methods, test.expires, err)
+		}
+	}
+	if tokens := store.Tokens(); len(tokens) != 0 {
+		t.Fatalf("got %d tokens after invalid requests, want 0",
+			len(tokens))
+	}
+
+	// Unknown tokens are refused during the handshake.
+	if _, status := dial(strings.Repeat("0", wsTokenSize*2)); status != http.StatusUnauthorized {
+		t.Fatalf("unknown token: got status %d, want %d", status,
+			http.StatusUnauthorized)
+	}
+
+	// A client may only register for the notifications and call the
+	// methods allowed by its token.
+	scoped := issue([]string{"blocks", "blocks"}, []string{"session"}, 0)
+	if len(scoped.Token) != wsTokenSize*2 || len(scoped.ID) != wsTokenIDSize*2 {
+		t.Fatalf("got token %q with ID %q", scoped.Token, scoped.ID)
+	}
+	if len(scoped.Notifications) != 1 || scoped.Expires != 0 {
+		t.Fatalf("got notifications %v expiring at %d, want [blocks] "+
+			"never expiring", scoped.Notifications, scoped.Expires)
+	}
+	client, status := dial(scoped.Token)
+	if client == nil {
+		t.Fatalf("scoped token: got status %d", status)
+	}
+	defer client.conn.Close()
+	const unauthorized = "token not authorized for this method"
+	calls := []struct {
+		method  string
+		wantErr string
+	}{
+		{"notifyblocks", ""},
+		{"session", ""},
+		{"stopnotifyblocks", ""},
+		{"notifynewtransactions", unauthorized},
+		{"getbestblock", unauthorized},
+		{"notifywatchedspends", unauthorized},
+		{"help", unauthorized},
+		{"stop", unauthorized},
+	}
+	for _, call := range calls {
+		if got := client.call(call.method); got != call.wantErr {
+			t.Fatalf("%s: got error %q, want %q", call.method, got,
+				call.wantErr)
+		}
+	}
+
+	// Revoking the token disconnects its client and refuses it afterwards.
+	result, err := handleListWSTokens(s, btcjson.NewListWSTokensCmd(), nil)
+	if err != nil {
+		t.Fatalf("listwstokens: unexpected error: %v", err)
+	}
+	listed := result.([]btcjson.WSTokenResult)
+	if len(listed) != 1 || listed[0].ID != scoped.ID || listed[0].Token != "" {
+		t.Fatalf("listwstokens: got %+v, want token %s without the "+
+			"token itself", listed, scoped.ID)
+	}
+	_, err = handleRevokeWSToken(s, btcjson.NewRevokeWSTokenCmd(scoped.ID),
+		nil)
+	if err != nil {
+		t.Fatalf("revokewstoken: unexpected error: %v", err)
+	}
+	client.waitForDisconnect("revoked")
+	if _, status := dial(scoped.Token); status != http.StatusUnauthorized {
+		t.Fatalf("revoked token: got status %d, want %d", status,
+			http.StatusUnauthorized)
+	}
+	_, err = handleRevokeWSToken(s, btcjson.NewRevokeWSTokenCmd(scoped.ID),
+		nil)
+	if err == nil {
+		t.Fatalf("revokewstoken of a revoked token succeeded")
+	}
+
+	// A token which expires disconnects its client once it does and is
+	// refused afterwards.
+	expiring := issue([]string{"newtransactions"}, nil,
+		time.Now().Add(3*time.Second).Unix())
+	client, status = dial(expiring.Token)
+	if client == nil {
+		t.Fatalf("expiring token: got status %d", status)
+	}
+	defer client.conn.Close()
+	if got := client.call("notifynewtransactions"); got != "" {
+		t.Fatalf("notifynewtransactions: unexpected error %q", got)
+	}
+	client.waitForDisconnect("expired")
+	if _, status := dial(expiring.Token); status != http.StatusUnauthorized {
+		t.Fatalf("expired token: got status %d, want %d", status,
+			http.StatusUnauthorized)
+	}
+
+	// The tokens survive a restart, while expired tokens are removed once
+	// another one is issued.
+	persisted := issue([]string{"spent", "received"}, []string{"rescan"}, 0)
+	store, err = newWSTokenStore(db, true)
+	if err != nil {
+		t.Fatalf("newWSTokenStore: unexpected error: %v", err)
+	}
+	token := store.Authenticate(persisted.Token)
+	if token == nil {
+		t.Fatalf("token %s was not persisted", persisted.ID)
+	}
+	got := token.result()
+	if got.ID != persisted.ID || got.Created != persisted.Created ||
+		strings.Join(got.Notifications, ",") != "received,spent" ||
+		strings.Join(got.Methods, ",") != "rescan" {
+
+		t.Fatalf("got persisted token %+v, want %+v", got, persisted)
+	}
+	if !token.Allows("notifyreceived") || !token.Allows("rescan") ||
+		token.Allows("notifyblocks") {
+
+		t.Fatalf("persisted token %s has the wrong scope", persisted.ID)
+	}
+	if tokens := store.Tokens(); len(tokens) != 1 {
+		t.Fatalf("got %d persisted tokens, want 1", len(tokens))
+	}
+}